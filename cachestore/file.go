@@ -0,0 +1,151 @@
+package cachestore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+// File is a Store of files in a directory, one for each key, which
+// instances on the same machine or sharing the directory can share.
+// Files that expire are removed when they are read, and by sweeps of
+// the directory every so often as values are stored.
+type File struct {
+	Dir string
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// fileSweepInterval is how often a file store removes the files that
+// have expired, at most.
+const fileSweepInterval = 10 * time.Minute
+
+// NewFile returns a store in dir, which is made if it doesn't exist.
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	// values are stored once listening, also in a sandbox
+	caddy.RegisterWritableDir(dir)
+	return &File{Dir: dir}, nil
+}
+
+func newFileFromURL(u *url.URL) (Store, error) {
+	dir := u.Path
+	if u.Host != "" {
+		dir = u.Host + dir // file://relative/dir
+	}
+	if dir == "" {
+		return nil, errors.New("file store requires a directory")
+	}
+	return NewFile(filepath.FromSlash(dir))
+}
+
+// Get returns the value stored at key.
+func (s *File) Get(key string) ([]byte, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, ErrNotFound
+	}
+	if expired(b) {
+		os.Remove(s.path(key))
+		return nil, ErrNotFound
+	}
+	return b[8:], nil
+}
+
+// expired returns whether the value in the file b has expired.
+func expired(b []byte) bool {
+	expires := int64(binary.BigEndian.Uint64(b))
+	return expires != 0 && time.Now().UnixNano() > expires
+}
+
+// Set stores value at key. The file is written in full before it
+// replaces any before it, so that it is never read half written.
+func (s *File) Set(key string, value []byte, ttl time.Duration) error {
+	b := make([]byte, 8+len(value))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(b, uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(b[8:], value)
+	tmp, err := ioutil.TempFile(s.Dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	s.mu.Lock()
+	if time.Since(s.lastSweep) >= fileSweepInterval {
+		s.lastSweep = time.Now()
+		go s.sweep()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// sweep removes the files that have expired.
+func (s *File) sweep() {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		name := filepath.Join(s.Dir, info.Name())
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		b := make([]byte, 8)
+		_, err = io.ReadFull(f, b)
+		f.Close()
+		if err == nil && expired(b) {
+			os.Remove(name)
+		}
+	}
+}
+
+// Delete removes the value at key.
+func (s *File) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path returns the path of the file of key, whose name is a hash of
+// it so that any key makes a safe name.
+func (s *File) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:]))
+}
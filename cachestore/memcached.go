@@ -0,0 +1,173 @@
+package cachestore
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMemcachedKey is the length of the longest key memcached accepts.
+const maxMemcachedKey = 250
+
+// maxRelativeExpiry is the longest expiry time memcached takes as
+// relative; longer ones are taken as unix times.
+const maxRelativeExpiry = 30 * 24 * time.Hour
+
+// Memcached is a Store in a memcached server.
+type Memcached struct {
+	Addr    string
+	Timeout time.Duration
+
+	idle chan *conn
+}
+
+// NewMemcached returns a store in the memcached server at addr.
+func NewMemcached(addr string) *Memcached {
+	return &Memcached{Addr: addr, Timeout: defaultTimeout, idle: make(chan *conn, maxIdleConns)}
+}
+
+func newMemcachedFromURL(u *url.URL) (Store, error) {
+	if u.Host == "" {
+		return nil, errors.New("memcached store requires a host")
+	}
+	return NewMemcached(u.Host), nil
+}
+
+// Get returns the value stored at key.
+func (s *Memcached) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.do("get "+memcachedKey(key), func(c *conn) error {
+		line, err := c.line()
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return ErrNotFound
+		}
+		// VALUE <key> <flags> <bytes>
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[0] != "VALUE" {
+			return memcachedReplyError(line)
+		}
+		n, err := strconv.Atoi(fields[3])
+		if err != nil || n < 0 {
+			return memcachedReplyError(line)
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return err
+		}
+		if line, err = c.line(); err != nil {
+			return err
+		}
+		if line != "END" {
+			return memcachedReplyError(line)
+		}
+		value = b[:n]
+		return nil
+	})
+	return value, err
+}
+
+// Set stores value at key.
+func (s *Memcached) Set(key string, value []byte, ttl time.Duration) error {
+	var exptime int64
+	if ttl > 0 {
+		exptime = int64((ttl + time.Second - 1) / time.Second)
+		if ttl > maxRelativeExpiry {
+			exptime += time.Now().Unix()
+		}
+	}
+	cmd := fmt.Sprintf("set %s 0 %d %d\r\n%s", memcachedKey(key), exptime, len(value), value)
+	return s.do(cmd, expectReply("STORED"))
+}
+
+// Delete removes the value at key.
+func (s *Memcached) Delete(key string) error {
+	err := s.do("delete "+memcachedKey(key), expectReply("DELETED"))
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// do sends cmd and reads its reply with read.
+func (s *Memcached) do(cmd string, read func(*conn) error) error {
+	c, err := s.get()
+	if err != nil {
+		return err
+	}
+	c.SetDeadline(time.Now().Add(s.Timeout))
+	w := bufio.NewWriter(c)
+	w.WriteString(cmd)
+	w.WriteString("\r\n")
+	if err = w.Flush(); err == nil {
+		err = read(c)
+	}
+	s.put(c, err)
+	return err
+}
+
+func (s *Memcached) get() (*conn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+	return dial(s.Addr, s.Timeout)
+}
+
+// put makes c idle, unless an exchange on it failed in a way that
+// may have left it out of step.
+func (s *Memcached) put(c *conn, err error) {
+	if err != nil && err != ErrNotFound {
+		c.Close()
+		return
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+// expectReply returns a reader of the reply want, taking NOT_FOUND as
+// ErrNotFound.
+func expectReply(want string) func(*conn) error {
+	return func(c *conn) error {
+		line, err := c.line()
+		if err != nil {
+			return err
+		}
+		switch line {
+		case want:
+			return nil
+		case "NOT_FOUND":
+			return ErrNotFound
+		}
+		return memcachedReplyError(line)
+	}
+}
+
+func memcachedReplyError(line string) error {
+	return fmt.Errorf("memcached: unexpected reply %q", line)
+}
+
+// memcachedKey returns key, or a hash of it if it is too long for
+// memcached or has characters it doesn't accept in keys.
+func memcachedKey(key string) string {
+	if len(key) <= maxMemcachedKey && key != "" && strings.IndexFunc(key, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f
+	}) < 0 {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
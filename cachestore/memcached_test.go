@@ -0,0 +1,131 @@
+package cachestore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMemcached is a memcached server of the commands used by
+// memcached stores.
+type fakeMemcached struct {
+	net.Listener
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeMemcached{Listener: ln, values: make(map[string]string)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeMemcached) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		var value []byte
+		if len(args) == 5 && args[0] == "set" {
+			var n int
+			fmt.Sscan(args[4], &n)
+			value = make([]byte, n+2)
+			if _, err := io.ReadFull(r, value); err != nil {
+				return
+			}
+			value = value[:n]
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		var reply string
+		switch args[0] {
+		case "set":
+			s.values[args[1]] = string(value)
+			reply = "STORED\r\n"
+		case "get":
+			reply = "END\r\n"
+			if v, ok := s.values[args[1]]; ok {
+				reply = fmt.Sprintf("VALUE %s 0 %d\r\n%s\r\nEND\r\n", args[1], len(v), v)
+			}
+		case "delete":
+			reply = "NOT_FOUND\r\n"
+			if _, ok := s.values[args[1]]; ok {
+				delete(s.values, args[1])
+				reply = "DELETED\r\n"
+			}
+		default:
+			reply = "ERROR\r\n"
+		}
+		s.mu.Unlock()
+		io.WriteString(c, reply)
+	}
+}
+
+func TestMemcached(t *testing.T) {
+	server := newFakeMemcached(t)
+	defer server.Close()
+
+	s := NewMemcached(server.Addr().String())
+	testStore(t, s)
+
+	long := strings.Repeat("k", 300)
+	if err := s.Set(long, []byte("v"), 31*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.Get(long); err != nil || string(value) != "v" {
+		t.Errorf("Expected value of long key, got %q (%v)", value, err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	set := strings.Fields(server.commands[len(server.commands)-2])
+	if len(set[1]) != 64 {
+		t.Errorf("Expected long key to be hashed, got %s", set[1])
+	}
+	var exptime int64
+	fmt.Sscan(set[3], &exptime)
+	if exptime < time.Now().Unix() {
+		t.Errorf("Expected expiry beyond 30 days to be a unix time, got %d", exptime)
+	}
+}
+
+func TestMemcachedKey(t *testing.T) {
+	for i, test := range []struct {
+		key    string
+		hashed bool
+	}{
+		{"example.com/index.html", false},
+		{"example.com/a b", true},
+		{"example.com/é", true},
+		{"", true},
+		{strings.Repeat("k", 250), false},
+		{strings.Repeat("k", 251), true},
+	} {
+		if hashed := memcachedKey(test.key) != test.key; hashed != test.hashed {
+			t.Errorf("Test %d: expected hashed %v, got %v", i, test.hashed, hashed)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package cachestore
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries is the number of entries a memory store keeps
+// by default.
+const DefaultMaxEntries = 1000
+
+// ErrFull is returned by a memory store that doesn't evict entries
+// for a new key once it is full.
+var ErrFull = errors.New("cachestore: full")
+
+// Memory is a Store in memory of up to a number of entries, evicting
+// those least recently used.
+type Memory struct {
+	max     int
+	noEvict bool // whether new keys are refused rather than others evicted
+	mu      sync.Mutex
+	order   *list.List               // of *memoryEntry, most recently used first
+	entries map[string]*list.Element // by key
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero if never
+}
+
+// NewMemory returns a memory store of up to max entries.
+func NewMemory(max int) *Memory {
+	return &Memory{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// NewBoundedMemory returns a memory store of up to max entries that,
+// once full, removes those expired and then refuses to store new keys
+// with ErrFull, rather than evicting others. It suits counters that
+// must not be lost to a flood of new keys.
+func NewBoundedMemory(max int) *Memory {
+	m := NewMemory(max)
+	m.noEvict = true
+	return m
+}
+
+// Get returns the value stored at key.
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		m.remove(elem)
+		return nil, ErrNotFound
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, nil
+}
+
+// Set stores a copy of value at key.
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	entry := &memoryEntry{key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	} else if m.noEvict && m.order.Len() >= m.max {
+		m.removeExpired()
+		if m.order.Len() >= m.max {
+			return ErrFull
+		}
+	}
+	m.entries[key] = m.order.PushFront(entry)
+	for m.order.Len() > m.max {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Delete removes the value at key.
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	}
+	return nil
+}
+
+// Max returns the number of entries m keeps.
+func (m *Memory) Max() int {
+	return m.max
+}
+
+// Len returns the number of entries, including any expired ones not
+// yet removed.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// removeExpired removes the entries that have expired. m.mu must be
+// locked.
+func (m *Memory) removeExpired() {
+	now := time.Now()
+	for elem := m.order.Front(); elem != nil; {
+		next := elem.Next()
+		if entry := elem.Value.(*memoryEntry); !entry.expires.IsZero() && now.After(entry.expires) {
+			m.remove(elem)
+		}
+		elem = next
+	}
+}
+
+func (m *Memory) remove(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.entries, elem.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,231 @@
+package cachestore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIdleConns is the number of idle connections kept to each Redis
+// or memcached server.
+const maxIdleConns = 8
+
+// defaultTimeout limits each exchange with a Redis or memcached
+// server, including dialing it.
+const defaultTimeout = time.Second
+
+// Redis is a Store in a Redis server.
+type Redis struct {
+	Addr     string
+	Password string
+	DB       int
+	Timeout  time.Duration
+
+	idle chan *conn
+}
+
+// NewRedis returns a store in the Redis server at addr, authenticated
+// with password if not empty, in the database db.
+func NewRedis(addr, password string, db int) *Redis {
+	return &Redis{Addr: addr, Password: password, DB: db, Timeout: defaultTimeout, idle: make(chan *conn, maxIdleConns)}
+}
+
+func newRedisFromURL(u *url.URL) (Store, error) {
+	if u.Host == "" {
+		return nil, errors.New("redis store requires a host")
+	}
+	var password string
+	if u.User != nil {
+		password, _ = u.User.Password()
+	}
+	var db int
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		n, err := strconv.Atoi(path)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid redis database '%s'", path)
+		}
+		db = n
+	}
+	return NewRedis(u.Host, password, db), nil
+}
+
+// Get returns the value stored at key.
+func (s *Redis) Get(key string) ([]byte, error) {
+	reply, err := s.do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNotFound
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply to GET: %v", reply)
+	}
+	return value, nil
+}
+
+// Set stores value at key.
+func (s *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		ms := int64(ttl / time.Millisecond)
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := s.do(args...)
+	return err
+}
+
+// Delete removes the value at key.
+func (s *Redis) Delete(key string) error {
+	_, err := s.do("DEL", key)
+	return err
+}
+
+// do sends the command args and returns its reply, which is a string
+// for a status, an int64, a []byte for a bulk string or nil for a nil
+// one, or an []interface{}.
+func (s *Redis) do(args ...string) (interface{}, error) {
+	c, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.redis(s.Timeout, args...)
+	s.put(c, err)
+	return reply, err
+}
+
+// get returns an idle connection, or a new one that's authenticated
+// and has selected the database.
+func (s *Redis) get() (*conn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+	c, err := dial(s.Addr, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if s.Password != "" {
+		if _, err := c.redis(s.Timeout, "AUTH", s.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.DB != 0 {
+		if _, err := c.redis(s.Timeout, "SELECT", strconv.Itoa(s.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// put makes c idle, unless an exchange on it failed in a way that
+// may have left it out of step.
+func (s *Redis) put(c *conn, err error) {
+	if _, ok := err.(redisError); err != nil && !ok {
+		c.Close()
+		return
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+// redisError is an error reply from Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// conn is a connection to a Redis or memcached server.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func dial(addr string, timeout time.Duration) (*conn, error) {
+	c, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+// redis sends the command args and reads its reply.
+func (c *conn) redis(timeout time.Duration, args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	w := bufio.NewWriter(c)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.redisReply()
+}
+
+func (c *conn) redisReply() (interface{}, error) {
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = c.redisReply(); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("redis: malformed reply %q", line)
+}
+
+// line reads a line ending in CRLF, without it.
+func (c *conn) line() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,135 @@
+package cachestore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a Redis server of the commands used by Redis stores.
+type fakeRedis struct {
+	net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{Listener: ln, password: password, values: make(map[string]string)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := s.password == ""
+	for {
+		var n int
+		if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+			return
+		}
+		args := make([]string, n)
+		for i := range args {
+			var size int
+			if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+				return
+			}
+			b := make([]byte, size+2)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			args[i] = string(b[:size])
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authed = args[1] == s.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-ERR invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "SELECT":
+			reply = "+OK\r\n"
+		case cmd == "SET":
+			s.values[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case cmd == "GET":
+			value, ok := s.values[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			}
+		case cmd == "DEL":
+			_, ok := s.values[args[1]]
+			delete(s.values, args[1])
+			reply = ":0\r\n"
+			if ok {
+				reply = ":1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		io.WriteString(c, reply)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	defer server.Close()
+
+	s := NewRedis(server.Addr().String(), "secret", 3)
+	testStore(t, s)
+	if err := s.Set("c", []byte("3"), 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.commands) < 2 || server.commands[0] != "AUTH secret" || server.commands[1] != "SELECT 3" {
+		t.Errorf("Expected AUTH and SELECT first, got %q", server.commands)
+	}
+	if n := strings.Count(strings.Join(server.commands, "\n"), "AUTH"); n != 1 {
+		t.Errorf("Expected connection to be reused, got %d AUTH commands", n)
+	}
+	if last := server.commands[len(server.commands)-1]; last != "SET c 3 PX 1500" {
+		t.Errorf("Expected SET with expiry, got %q", last)
+	}
+}
+
+func TestRedisErrors(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	defer server.Close()
+
+	if _, err := NewRedis(server.Addr().String(), "wrong", 0).Get("a"); err == nil {
+		t.Error("Expected error with wrong password")
+	}
+	if _, err := NewRedis(server.Addr().String(), "", 0).Get("a"); err == nil || err == ErrNotFound {
+		t.Errorf("Expected error without password, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package cachestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Response is a cached HTTP response.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Stored time.Time
+	TTL    time.Duration // how long it is fresh for
+}
+
+// The encoding of responses begins with its version, so that entries
+// written by other versions of Caddy sharing a store are recognized,
+// and flags.
+const (
+	responseVersion = 1
+	flagGzip        = 1 << 0
+)
+
+// compressMin is the size of encoded responses above which they are
+// compressed, if that makes them smaller.
+const compressMin = 1024
+
+// ErrVersion is returned when decoding a response encoded in an
+// unknown version, which callers should treat as a miss.
+var ErrVersion = errors.New("cachestore: unknown encoding version")
+
+var errCorrupt = errors.New("cachestore: corrupt response")
+
+// EncodeResponse encodes resp to be stored.
+func EncodeResponse(resp *Response) []byte {
+	var buf bytes.Buffer
+	putUvarint(&buf, uint64(resp.Status))
+	putVarint(&buf, resp.Stored.UnixNano())
+	putVarint(&buf, int64(resp.TTL))
+	fields := make([]string, 0, len(resp.Header))
+	for field := range resp.Header {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	putUvarint(&buf, uint64(len(fields)))
+	for _, field := range fields {
+		putString(&buf, field)
+		putUvarint(&buf, uint64(len(resp.Header[field])))
+		for _, value := range resp.Header[field] {
+			putString(&buf, value)
+		}
+	}
+	buf.Write(resp.Body)
+
+	payload, flags := buf.Bytes(), byte(0)
+	if len(payload) > compressMin {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		w.Write(payload)
+		w.Close()
+		if gz.Len() < len(payload) {
+			payload, flags = gz.Bytes(), flagGzip
+		}
+	}
+	return append([]byte{responseVersion, flags}, payload...)
+}
+
+// DecodeResponse decodes a response encoded by EncodeResponse.
+func DecodeResponse(b []byte) (*Response, error) {
+	if len(b) < 2 {
+		return nil, errCorrupt
+	}
+	if b[0] != responseVersion {
+		return nil, ErrVersion
+	}
+	payload := b[2:]
+	if b[1]&flagGzip != 0 {
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+
+	d := decoder{b: payload}
+	resp := &Response{
+		Status: int(d.uvarint()),
+		Stored: time.Unix(0, d.varint()),
+		TTL:    time.Duration(d.varint()),
+		Header: make(http.Header),
+	}
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		field := d.string()
+		for m := d.uvarint(); m > 0 && d.err == nil; m-- {
+			resp.Header[field] = append(resp.Header[field], d.string())
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	resp.Body = d.b
+	return resp, nil
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func putVarint(buf *bytes.Buffer, v int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	putUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// decoder reads the parts of an encoded response, remembering the
+// first error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.b)) {
+		d.err = errCorrupt
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
@@ -0,0 +1,77 @@
+package cachestore
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeResponse(t *testing.T) {
+	stored := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, test := range []struct {
+		body       []byte
+		compressed bool
+	}{
+		{nil, false},
+		{[]byte("hello"), false},
+		{bytes.Repeat([]byte("hello "), 1000), true},
+		{randomBytes(4096), false},
+	} {
+		resp := &Response{
+			Status: http.StatusOK,
+			Header: http.Header{"Content-Type": {"text/plain"}, "Vary": {"Accept-Encoding", "Origin"}},
+			Body:   test.body,
+			Stored: stored,
+			TTL:    time.Minute,
+		}
+		b := EncodeResponse(resp)
+		if b[0] != responseVersion {
+			t.Errorf("Test %d: expected version %d, got %d", i, responseVersion, b[0])
+		}
+		if compressed := b[1]&flagGzip != 0; compressed != test.compressed {
+			t.Errorf("Test %d: expected compressed %v, got %v", i, test.compressed, compressed)
+		}
+		got, err := DecodeResponse(b)
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		if got.Status != resp.Status || !got.Stored.Equal(stored) || got.TTL != resp.TTL ||
+			!reflect.DeepEqual(got.Header, resp.Header) || !bytes.Equal(got.Body, resp.Body) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, resp, got)
+		}
+	}
+}
+
+func TestDecodeResponseErrors(t *testing.T) {
+	valid := EncodeResponse(&Response{Status: http.StatusOK, Header: http.Header{"Etag": {`"x"`}}})
+	for i, test := range []struct {
+		b      []byte
+		expect error
+	}{
+		{nil, errCorrupt},
+		{[]byte{responseVersion + 1, 0, 1, 2, 3}, ErrVersion},
+		{valid[:len(valid)-2], errCorrupt},
+		{[]byte{responseVersion, flagGzip, 1, 2, 3}, nil},
+	} {
+		_, err := DecodeResponse(test.b)
+		if err == nil || test.expect != nil && err != test.expect {
+			t.Errorf("Test %d: expected error %v, got %v", i, test.expect, err)
+		}
+	}
+}
+
+// randomBytes returns n bytes that don't compress.
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	x := uint32(2463534242)
+	for i := range b {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		b[i] = byte(x)
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+// Package cachestore provides storage for caches and sessions, in
+// memory, in files or in Redis or memcached servers that several
+// Caddy instances can share, and a versioned, compressed encoding of
+// cached HTTP responses.
+package cachestore
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for a key it doesn't have.
+var ErrNotFound = errors.New("cachestore: not found")
+
+// Store is storage for a cache. Its methods may be called
+// concurrently.
+type Store interface {
+	// Get returns the value stored at key, or ErrNotFound. The
+	// value must not be modified.
+	Get(key string) ([]byte, error)
+
+	// Set stores value at key for ttl, or until it is evicted
+	// if ttl is 0.
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the value at key, if any.
+	Delete(key string) error
+}
+
+// Constructor makes a Store from a URL such as redis://host:6379/1.
+type Constructor func(u *url.URL) (Store, error)
+
+var (
+	backends   = make(map[string]Constructor)
+	backendsMu sync.RWMutex
+)
+
+// RegisterBackend registers the constructor of the stores of URLs
+// with scheme.
+func RegisterBackend(scheme string, c Constructor) {
+	backendsMu.Lock()
+	backends[scheme] = c
+	backendsMu.Unlock()
+}
+
+func init() {
+	RegisterBackend("memory", func(u *url.URL) (Store, error) {
+		max := DefaultMaxEntries
+		if s := u.Query().Get("max"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid maximum number of entries '%s'", s)
+			}
+			max = n
+		}
+		return NewMemory(max), nil
+	})
+	RegisterBackend("file", newFileFromURL)
+	RegisterBackend("redis", newRedisFromURL)
+	RegisterBackend("memcached", newMemcachedFromURL)
+}
+
+// New returns the store for rawurl, whose scheme is that of a
+// registered backend: memory (memory://?max=entries), file
+// (file:///path/to/dir), redis
+// (redis://[:password@]host:port[/db]) or memcached
+// (memcached://host:port).
+func New(rawurl string) (Store, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" && u.Path == "memory" {
+		u.Scheme = "memory"
+	}
+	backendsMu.RLock()
+	c, ok := backends[u.Scheme]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown cache store '%s'", u.Scheme)
+	}
+	return c(u)
+}
@@ -0,0 +1,178 @@
+package cachestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+func TestNew(t *testing.T) {
+	for i, test := range []struct {
+		url       string
+		shouldErr bool
+		expect    Store
+	}{
+		{"memory", false, NewMemory(DefaultMaxEntries)},
+		{"memory://?max=10", false, NewMemory(10)},
+		{"memory://?max=0", true, nil},
+		{"redis://:secret@localhost:6379/2", false, &Redis{Addr: "localhost:6379", Password: "secret", DB: 2}},
+		{"redis://localhost:6379", false, &Redis{Addr: "localhost:6379"}},
+		{"redis://localhost:6379/x", true, nil},
+		{"redis:///1", true, nil},
+		{"memcached://localhost:11211", false, &Memcached{Addr: "localhost:11211"}},
+		{"memcached:", true, nil},
+		{"file://", true, nil},
+		{"bolt://localhost", true, nil},
+	} {
+		store, err := New(test.url)
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: expected error %v, got %v", i, test.shouldErr, err)
+			continue
+		}
+		switch expect := test.expect.(type) {
+		case *Memory:
+			if m, ok := store.(*Memory); !ok || m.max != expect.max {
+				t.Errorf("Test %d: expected memory store of %d entries, got %#v", i, expect.max, store)
+			}
+		case *Redis:
+			r, ok := store.(*Redis)
+			if !ok || r.Addr != expect.Addr || r.Password != expect.Password || r.DB != expect.DB {
+				t.Errorf("Test %d: expected %#v, got %#v", i, expect, store)
+			}
+		case *Memcached:
+			if m, ok := store.(*Memcached); !ok || m.Addr != expect.Addr {
+				t.Errorf("Test %d: expected %#v, got %#v", i, expect, store)
+			}
+		}
+	}
+}
+
+// testStore checks the behaviour common to every store.
+func testStore(t *testing.T, s Store) {
+	if _, err := s.Get("a"); err != ErrNotFound {
+		t.Errorf("Get of missing key: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Set("a", []byte("1"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := s.Set("b", []byte("2\r\nEND\r\n"), time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	for key, expect := range map[string]string{"a": "1", "b": "2\r\nEND\r\n"} {
+		if value, err := s.Get(key); err != nil || string(value) != expect {
+			t.Errorf("Get %s: expected %q, got %q (%v)", key, expect, value, err)
+		}
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Errorf("Delete of missing key: %v", err)
+	}
+	if _, err := s.Get("a"); err != ErrNotFound {
+		t.Errorf("Get of deleted key: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New("file://" + filepath.ToSlash(filepath.Join(dir, "store")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	if !caddy.Writable(filepath.Join(dir, "store", "value")) {
+		t.Error("Expected the folder to be writable once privileges are dropped")
+	}
+
+	s.Set("../c", []byte("3"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, err := s.Get("../c"); err != ErrNotFound {
+		t.Errorf("Expected expired entry to be missing, got %v", err)
+	}
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "store"))
+	if len(files) != 1 {
+		t.Errorf("Expected only the file of b to be left, got %d files", len(files))
+	}
+}
+
+func TestFileSweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("a", []byte("1"), time.Nanosecond)
+	s.Set("b", []byte("2"), 0)
+	s.Set("c", []byte("3"), time.Hour)
+	time.Sleep(time.Millisecond)
+
+	// expired files that are never read again are removed too
+	s.sweep()
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("Expected only the files of b and c to be left, got %d files", len(files))
+	}
+	if v, err := s.Get("c"); err != nil || string(v) != "3" {
+		t.Errorf("Expected c to be kept, got %q (%v)", v, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory(10))
+
+	m := NewMemory(2)
+	m.Set("a", []byte("1"), 0)
+	m.Set("b", []byte("2"), 0)
+	m.Get("a")
+	m.Set("c", []byte("3"), 0)
+	if _, err := m.Get("b"); err != ErrNotFound {
+		t.Errorf("Expected least recently used entry to be evicted, got %v", err)
+	}
+	if _, err := m.Get("a"); err != nil {
+		t.Errorf("Expected recently used entry to be kept, got %v", err)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", m.Len())
+	}
+
+	m.Set("d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, err := m.Get("d"); err != ErrNotFound {
+		t.Errorf("Expected expired entry to be missing, got %v", err)
+	}
+}
+
+func TestBoundedMemory(t *testing.T) {
+	m := NewBoundedMemory(2)
+	m.Set("a", []byte("1"), 0)
+	m.Set("b", []byte("2"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if err := m.Set("c", []byte("3"), 0); err != nil {
+		t.Errorf("Expected an expired entry to make room, got %v", err)
+	}
+	if err := m.Set("d", []byte("4"), 0); err != ErrFull {
+		t.Errorf("Expected a new key to be refused when full, got %v", err)
+	}
+	if err := m.Set("a", []byte("5"), 0); err != nil {
+		t.Errorf("Expected a key stored already to be updated when full, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := m.Get(key); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", key, err)
+		}
+	}
+}
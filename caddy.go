@@ -16,14 +16,17 @@
 package caddy
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -46,9 +49,18 @@ var (
 	// PidFile is the path to the pidfile to create.
 	PidFile string
 
+	// EnvFile is the path to a file of environment variables
+	// to set before the Caddyfile is loaded or reloaded.
+	EnvFile string
+
 	// GracefulTimeout is the maximum duration of a graceful shutdown.
 	GracefulTimeout time.Duration
 
+	// StrictReload makes a reload fail entirely if any server
+	// block fails to set up. Otherwise, such server blocks keep
+	// their previous configuration and the rest are reloaded.
+	StrictReload bool
+
 	// isUpgrade will be set to true if this process
 	// was started as part of an upgrade, where a parent
 	// Caddy process started this one.
@@ -72,6 +84,11 @@ type Instance struct {
 	// caddyfileInput is the input configuration text used for this process
 	caddyfileInput Input
 
+	// serverBlocks are the server blocks the instance was set
+	// up with; they differ from those in caddyfileInput if some
+	// of those failed to set up on reload
+	serverBlocks []caddyfile.ServerBlock
+
 	// wg is used to wait for all servers to shut down
 	wg *sync.WaitGroup
 
@@ -81,12 +98,26 @@ type Instance struct {
 	// servers is the list of servers with their listeners.
 	servers []ServerListener
 
+	// tenant is the tenant the instance runs, if any.
+	tenant *Tenant
+
 	// these callbacks execute when certain events occur
-	onFirstStartup  []func() error // starting, not as part of a restart
-	onStartup       []func() error // starting, even as part of a restart
-	onRestart       []func() error // before restart commences
-	onShutdown      []func() error // stopping, even as part of a restart
-	onFinalShutdown []func() error // stopping, not as part of a restart
+	onFirstStartup         []func() error // starting, not as part of a restart
+	onFirstStartupComplete []func() error // listening, not as part of a restart
+	onStartup              []func() error // starting, even as part of a restart
+	onRestart              []func() error // before restart commences
+	onShutdown             []func() error // stopping, even as part of a restart
+	onFinalShutdown        []func() error // stopping, not as part of a restart
+
+	// onStartupBlocks is the index of the server block that
+	// added each of the onStartup callbacks
+	onStartupBlocks []int
+
+	// onBlockError, if set, is called with the index of each server
+	// block that fails to set up or start, and the error, so that the
+	// instance can be started again without it; setting up or starting
+	// still stops at the first failure
+	onBlockError func(sblockIndex int, err error)
 }
 
 // Servers returns the ServerListeners in i.
@@ -142,11 +173,22 @@ func (i *Instance) ShutdownCallbacks() []error {
 // executing the newCaddyfile. Upon success, it returns the new
 // instance to replace i. Upon failure, i will not be replaced.
 func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
-	log.Println("[INFO] Reloading")
+	reloading := "Reloading"
+	if i.tenant != nil {
+		reloading += " tenant " + i.tenant.Name
+	}
+	log.Printf("[INFO] %s", reloading)
 
 	i.wg.Add(1)
 	defer i.wg.Done()
 
+	// whether or not the reload succeeds, an instance is running;
+	// tenants reload without the service manager knowing
+	if i.tenant == nil {
+		sdNotify("RELOADING=1")
+		defer sdNotifyReady()
+	}
+
 	// run restart callbacks
 	for _, fn := range i.onRestart {
 		err := fn()
@@ -181,13 +223,26 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 		}
 	}
 
-	// create new instance; if the restart fails, it is simply discarded
-	newInst := &Instance{serverType: newCaddyfile.ServerType(), wg: i.wg}
-
-	// attempt to start new instance
-	err := startWithListenerFds(newCaddyfile, newInst, restartFds)
-	if err != nil {
-		return i, err
+	// unless reloads are all-or-nothing, server blocks that fail
+	// to set up or start keep their previous configuration
+	var newInst *Instance
+	if StrictReload {
+		// create new instance; if the restart fails, it is simply discarded
+		newInst = &Instance{serverType: newCaddyfile.ServerType(), wg: i.wg, tenant: i.tenant}
+		err := startWithListenerFds(newCaddyfile, nil, newInst, restartFds)
+		if err != nil {
+			return i, err
+		}
+	} else {
+		var failures []error
+		var err error
+		newInst, failures, err = i.startIsolated(newCaddyfile, restartFds)
+		if err != nil {
+			return i, err
+		}
+		for _, failure := range failures {
+			log.Printf("[ERROR] %s: %v", reloading, failure)
+		}
 	}
 
 	// success! stop the old instance
@@ -199,11 +254,101 @@ func (i *Instance) Restart(newCaddyfile Input) (*Instance, error) {
 	}
 	i.Stop()
 
-	log.Println("[INFO] Reloading complete")
+	log.Printf("[INFO] %s complete", reloading)
+
+	EmitEvent(ConfigLoadedEvent, newInst.caddyfileInput)
+	EmitEvent(InstanceRestartedEvent, newInst)
 
 	return newInst, nil
 }
 
+// startIsolated starts a new instance with newCaddyfile. Each
+// server block that fails to set up or start is replaced by the
+// server block of i with the same keys, or left out if i has none,
+// and the new instance is started again without the failure; its
+// Caddyfile is then made of the server blocks it runs. The new
+// instance is returned along with an error describing each failure.
+// An error is returned only if newCaddyfile can't be loaded at all,
+// every server block fails or the instance fails to start otherwise.
+func (i *Instance) startIsolated(newCaddyfile Input, restartFds map[string]restartTriple) (*Instance, []error, error) {
+	stypeName := newCaddyfile.ServerType()
+	sblocks, err := loadServerBlocks(stypeName, newCaddyfile.Path(), bytes.NewReader(newCaddyfile.Body()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previous := make(map[string]caddyfile.ServerBlock)
+	for _, sb := range i.serverBlocks {
+		previous[serverBlockID(sb)] = sb
+	}
+	kept := make([]bool, len(sblocks)) // whether each block is the previous one
+	cdyfile := newCaddyfile
+	var failures []error
+	for {
+		failed := make(map[int]error)
+		newInst := &Instance{serverType: stypeName, wg: i.wg, tenant: i.tenant}
+		newInst.onBlockError = func(sblockIndex int, err error) {
+			if _, ok := failed[sblockIndex]; !ok {
+				failed[sblockIndex] = err
+			}
+		}
+		err := startWithListenerFds(cdyfile, sblocks, newInst, restartFds)
+		newInst.onBlockError = nil
+		if len(failed) == 0 {
+			if err != nil {
+				return nil, nil, err
+			}
+			return newInst, failures, nil
+		}
+		if len(failed) == len(sblocks) {
+			// nothing would be reloaded, so it's a failure
+			return nil, nil, failed[0]
+		}
+
+		var started []caddyfile.ServerBlock
+		var startedKept []bool
+		for j, sb := range sblocks {
+			err, ok := failed[j]
+			if !ok {
+				started = append(started, sb)
+				startedKept = append(startedKept, kept[j])
+				continue
+			}
+			keys := strings.Join(sb.Keys, ", ")
+			if prev, ok := previous[serverBlockID(sb)]; ok && !kept[j] {
+				started = append(started, prev)
+				startedKept = append(startedKept, true)
+				failures = append(failures, fmt.Errorf("%s: %v (keeping previous configuration)", keys, err))
+			} else {
+				failures = append(failures, fmt.Errorf("%s: %v (not started)", keys, err))
+			}
+		}
+		sblocks, kept = started, startedKept
+		cdyfile = CaddyfileInput{
+			Contents:       caddyfile.Text(sblocks),
+			Filepath:       newCaddyfile.Path(),
+			ServerTypeName: stypeName,
+		}
+	}
+}
+
+// serverBlockID returns a string that identifies sb by its keys.
+func serverBlockID(sb caddyfile.ServerBlock) string {
+	keys := make([]string, len(sb.Keys))
+	for i, key := range sb.Keys {
+		keys[i] = strings.ToLower(key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\x00")
+}
+
+// Instances returns the running instances.
+func Instances() []*Instance {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	return append([]*Instance(nil), instances...)
+}
+
 // SaveServer adds s and its associated listener ln to the
 // internally-kept list of servers that is running. For
 // saved servers, graceful restarts will be provided.
@@ -436,7 +581,7 @@ func (i *Instance) Caddyfile() Input {
 // This function blocks until all the servers are listening.
 func Start(cdyfile Input) (*Instance, error) {
 	inst := &Instance{serverType: cdyfile.ServerType(), wg: new(sync.WaitGroup)}
-	err := startWithListenerFds(cdyfile, inst, nil)
+	err := startWithListenerFds(cdyfile, nil, inst, nil)
 	if err != nil {
 		return inst, err
 	}
@@ -444,15 +589,25 @@ func Start(cdyfile Input) (*Instance, error) {
 	if pidErr := writePidFile(); pidErr != nil {
 		log.Printf("[ERROR] Could not write pidfile: %v", pidErr)
 	}
+	sdNotifyReady()
+	EmitEvent(ConfigLoadedEvent, cdyfile)
 	return inst, nil
 }
 
-func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]restartTriple) error {
+// startWithListenerFds starts inst with the configuration in
+// cdyfile, or with sblocks in place of its server blocks if
+// sblocks is not nil.
+func startWithListenerFds(cdyfile Input, sblocks []caddyfile.ServerBlock, inst *Instance, restartFds map[string]restartTriple) error {
 	if cdyfile == nil {
 		cdyfile = CaddyfileInput{}
 	}
 
-	err := ValidateAndExecuteDirectives(cdyfile, inst, false)
+	var err error
+	if sblocks != nil {
+		err = executeServerBlocks(cdyfile, sblocks, inst, false)
+	} else {
+		err = ValidateAndExecuteDirectives(cdyfile, inst, false)
+	}
 	if err != nil {
 		return err
 	}
@@ -472,9 +627,12 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 			}
 		}
 	}
-	for _, startupFunc := range inst.onStartup {
+	for j, startupFunc := range inst.onStartup {
 		err := startupFunc()
 		if err != nil {
+			if inst.onBlockError != nil {
+				inst.onBlockError(inst.onStartupBlocks[j], err)
+			}
 			return err
 		}
 	}
@@ -488,6 +646,18 @@ func startWithListenerFds(cdyfile Input, inst *Instance, restartFds map[string]r
 	instances = append(instances, inst)
 	instancesMu.Unlock()
 
+	// run callbacks that need the servers to be listening; if
+	// one fails, the servers are stopped again
+	if !IsUpgrade() && restartFds == nil {
+		for _, completeFunc := range inst.onFirstStartupComplete {
+			err := completeFunc()
+			if err != nil {
+				inst.Stop()
+				return err
+			}
+		}
+	}
+
 	// run any AfterStartup callbacks if this is not
 	// part of a restart; then show file descriptor notice
 	if restartFds == nil {
@@ -524,21 +694,32 @@ func ValidateAndExecuteDirectives(cdyfile Input, inst *Instance, justValidate bo
 		inst = &Instance{serverType: cdyfile.ServerType(), wg: new(sync.WaitGroup)}
 	}
 
+	sblocks, err := loadServerBlocks(cdyfile.ServerType(), cdyfile.Path(), bytes.NewReader(cdyfile.Body()))
+	if err != nil {
+		return err
+	}
+
+	return executeServerBlocks(cdyfile, sblocks, inst, justValidate)
+}
+
+// executeServerBlocks executes the directives in sblocks, which
+// were loaded from cdyfile, and stores the results into inst.
+func executeServerBlocks(cdyfile Input, sblocks []caddyfile.ServerBlock, inst *Instance, justValidate bool) error {
 	stypeName := cdyfile.ServerType()
 
 	stype, err := getServerType(stypeName)
 	if err != nil {
 		return err
 	}
-
-	inst.caddyfileInput = cdyfile
-
-	sblocks, err := loadServerBlocks(stypeName, cdyfile.Path(), bytes.NewReader(cdyfile.Body()))
+	directives, err := directivesOf(stypeName, stype)
 	if err != nil {
 		return err
 	}
 
-	inst.context = stype.NewContext()
+	inst.caddyfileInput = cdyfile
+	inst.serverBlocks = sblocks
+
+	inst.context = inst.newContext(stype)
 	if inst.context == nil {
 		return fmt.Errorf("server type %s produced a nil Context", stypeName)
 	}
@@ -548,16 +729,43 @@ func ValidateAndExecuteDirectives(cdyfile Input, inst *Instance, justValidate bo
 		return err
 	}
 
-	err = executeDirectives(inst, cdyfile.Path(), stype.Directives(), sblocks, justValidate)
+	var onError func(int, error, []caddyfile.Token)
+	failed := false
+	if inst.onBlockError != nil {
+		if len(sblocks) != len(inst.serverBlocks) {
+			// can't tell which blocks are which, so don't try
+			inst.onBlockError = nil
+		} else {
+			onError = func(sblockIndex int, err error, _ []caddyfile.Token) {
+				failed = true
+				inst.onBlockError(sblockIndex, err)
+			}
+		}
+	}
+
+	err = executeDirectives(inst, cdyfile.Path(), directives, sblocks, justValidate, onError)
 	if err != nil {
 		return err
 	}
+	if failed {
+		return errServerBlockFailed
+	}
 
 	return nil
 }
 
+// errServerBlockFailed stops an instance from starting after the
+// failures of its server blocks were passed to its onBlockError.
+var errServerBlockFailed = errors.New("server blocks failed to set up")
+
+// executeDirectives executes the directives in sblocks. If a
+// directive's setup fails and onError is nil, execution stops
+// and the error is returned; otherwise onError is called with
+// the index of the server block, the error and the directive's
+// tokens, and execution carries on with the next server block.
 func executeDirectives(inst *Instance, filename string,
-	directives []string, sblocks []caddyfile.ServerBlock, justValidate bool) error {
+	directives []string, sblocks []caddyfile.ServerBlock, justValidate bool,
+	onError func(sblockIndex int, err error, tokens []caddyfile.Token)) error {
 	// map of server block ID to map of directive name to whatever.
 	storages := make(map[int]map[string]interface{})
 
@@ -590,6 +798,7 @@ func executeDirectives(inst *Instance, filename string,
 						ServerBlockKeyIndex: j,
 						ServerBlockKeys:     sb.Keys,
 						ServerBlockStorage:  storages[i][dir],
+						Directive:           dir,
 					}
 
 					setup, err := DirectiveAction(inst.serverType, dir)
@@ -599,7 +808,11 @@ func executeDirectives(inst *Instance, filename string,
 
 					err = setup(controller)
 					if err != nil {
-						return err
+						if onError == nil {
+							return err
+						}
+						onError(i, err, tokens)
+						break
 					}
 
 					storages[i][dir] = controller.ServerBlockStorage // persist for this server block
@@ -767,6 +980,12 @@ func loadServerBlocks(serverType, filename string, input io.Reader) ([]caddyfile
 			return nil, err
 		}
 	}
+	// the files imported are read again on reload, also in a sandbox
+	for _, sb := range serverBlocks {
+		for _, file := range sb.Imports {
+			RegisterReadablePath(file)
+		}
+	}
 	return serverBlocks, nil
 }
 
@@ -894,6 +1113,45 @@ func DefaultInput(serverType string) Input {
 	return serverTypes[serverType].DefaultInput()
 }
 
+// LoadEnvFile sets the environment variables listed in the
+// file at EnvFile, one KEY=VALUE pair per line. Blank lines
+// and lines starting with # are ignored. It does nothing if
+// EnvFile is not set. It is called again on every reload so
+// that changed values take effect along with the Caddyfile.
+func LoadEnvFile() error {
+	if EnvFile == "" {
+		return nil
+	}
+	file, err := os.Open(EnvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", EnvFile, lineNum)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %v", EnvFile, lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
 // writePidFile writes the process ID to the file at PidFile.
 // It does nothing if PidFile is not set.
 func writePidFile() error {
@@ -1,6 +1,7 @@
 package caddymain
 
 import (
+	"crypto"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,16 +11,23 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
 
 	"github.com/xenolf/lego/acme"
 
 	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyadmin"
+	// plug in the DNS server type
+	_ "github.com/mholt/caddy/caddydns"
+	"github.com/mholt/caddy/caddyfile"
 	// plug in the HTTP server type
 	_ "github.com/mholt/caddy/caddyhttp"
 
 	"github.com/mholt/caddy/caddytls"
+	"github.com/mholt/caddy/privileges"
+	"github.com/mholt/caddy/remoteconfig"
 	// This is where other plugins get plugged in (imported)
 )
 
@@ -27,22 +35,39 @@ func init() {
 	caddy.TrapSignals()
 	setVersion()
 
+	flag.StringVar(&admin, "admin", "", "Address (or unix:/path) of the admin API; a token may be set in "+adminTokenEnv)
 	flag.BoolVar(&caddytls.Agreed, "agree", false, "Agree to the CA's Subscriber Agreement")
 	flag.StringVar(&caddytls.DefaultCAUrl, "ca", "https://acme-v01.api.letsencrypt.org/directory", "URL to certificate authority's ACME server directory")
 	flag.BoolVar(&caddytls.DisableHTTPChallenge, "disable-http-challenge", caddytls.DisableHTTPChallenge, "Disable the ACME HTTP challenge")
 	flag.BoolVar(&caddytls.DisableTLSSNIChallenge, "disable-tls-sni-challenge", caddytls.DisableTLSSNIChallenge, "Disable the ACME TLS-SNI challenge")
-	flag.StringVar(&conf, "conf", "", "Caddyfile to load (default \""+caddy.DefaultConfigFile+"\")")
+	flag.StringVar(&privileges.Flags.Chroot, "chroot", "", "Directory to confine the process to once it is listening; the assets path must be inside")
+	flag.StringVar(&conf, "conf", "", "Caddyfile to load (default \""+caddy.DefaultConfigFile+"\"); .json and .yaml files are converted, .tmpl files expanded; may be an http(s)://, etcd:// or s3:// URL")
+	flag.DurationVar(&confPoll, "conf-poll", 0, "Interval at which to check a remote Caddyfile for changes and reload (0 to disable)")
+	flag.StringVar(&confPubKey, "conf-pubkey", "", "PEM public key with which to verify the signature (at URL + \".sig\") of a remote Caddyfile")
+	flag.StringVar(&convert, "convert", "", "Print the Caddyfile converted to the given format (json, yaml or caddyfile)")
 	flag.StringVar(&cpu, "cpu", "100%", "CPU cap")
+	flag.BoolVar(&diff, "diff", false, "Print how the Caddyfile differs from the configuration of the Caddy whose admin API is at -admin, and exit with 0 if it doesn't, 1 if it does")
+	flag.StringVar(&caddy.EnvFile, "envfile", "", "Path to file of environment variables (KEY=VALUE) to set")
+	flag.BoolVar(&expand, "expand", false, "Print the Caddyfile with its template expanded, and exit")
+	flag.StringVar(&privileges.Flags.Group, "group", "", "Group to run as once listening (default the primary group of -user)")
+	flag.BoolVar(&privileges.Flags.Landlock, "landlock", false, "Confine the process to writing to the assets path and log folders once it is listening (Linux only)")
 	flag.BoolVar(&plugins, "plugins", false, "List installed plugins")
 	flag.StringVar(&caddytls.DefaultEmail, "email", "", "Default ACME CA account email address")
 	flag.DurationVar(&acme.HTTPClient.Timeout, "catimeout", acme.HTTPClient.Timeout, "Default ACME CA HTTP timeout")
 	flag.StringVar(&logfile, "log", "", "Process log file")
 	flag.StringVar(&caddy.PidFile, "pidfile", "", "Path to write pid file")
 	flag.BoolVar(&caddy.Quiet, "quiet", false, "Quiet mode (no initialization output)")
+	flag.BoolVar(&privileges.Flags.Sandbox, "sandbox", false, "Confine the process to the files and system calls its configuration needs once it is listening (Linux only)")
+	flag.BoolVar(&caddyfile.StrictEnv, "strict-env", false, "Fail if the Caddyfile uses an environment variable that is not set and has no default")
 	flag.StringVar(&revoke, "revoke", "", "Hostname for which to revoke the certificate")
+	flag.StringVar(&serviceAction, "service", "", "Windows service action: install (with the other flags given), uninstall or run")
+	flag.StringVar(&serviceName, "service-name", "caddy", "Name of the Windows service")
+	flag.BoolVar(&caddy.StrictReload, "strict-reload", false, "Abort a reload if any site fails to set up, rather than keeping its previous configuration")
+	flag.BoolVar(&caddyfile.Templates, "template", false, "Expand the Caddyfile as a template, as is done for .tmpl files")
 	flag.StringVar(&serverType, "type", "http", "Type of server to run")
+	flag.StringVar(&privileges.Flags.User, "user", "", "User to run as once listening, having bound any privileged ports as root")
 	flag.BoolVar(&version, "version", false, "Show version")
-	flag.BoolVar(&validate, "validate", false, "Parse the Caddyfile but do not start the server")
+	flag.BoolVar(&validate, "validate", false, "Parse the Caddyfile and set up its directives, reporting all problems, but do not start the server")
 
 	caddy.RegisterCaddyfileLoader("flag", caddy.LoaderFunc(confLoader))
 	caddy.SetDefaultCaddyfileLoader("default", caddy.LoaderFunc(defaultLoader))
@@ -64,7 +89,16 @@ func Run() {
 		log.SetOutput(os.Stderr)
 	case "":
 		log.SetOutput(ioutil.Discard)
+		if serviceAction == "run" {
+			// services have no console, so use the system log
+			w, err := serviceLog()
+			if err != nil {
+				mustLogFatalf("%v", err)
+			}
+			log.SetOutput(w)
+		}
 	default:
+		caddy.RegisterWritablePath(logfile)
 		log.SetOutput(&lumberjack.Logger{
 			Filename:   logfile,
 			MaxSize:    100,
@@ -74,6 +108,13 @@ func Run() {
 	}
 
 	// Check for one-time actions
+	if serviceAction != "" && serviceAction != "run" {
+		if err := controlService(serviceAction, serviceArgs(os.Args[1:])); err != nil {
+			mustLogFatalf("%v", err)
+		}
+		fmt.Printf("Service %s: %s done\n", serviceName, serviceAction)
+		os.Exit(0)
+	}
 	if revoke != "" {
 		err := caddytls.Revoke(revoke)
 		if err != nil {
@@ -100,6 +141,11 @@ func Run() {
 		mustLogFatalf("%v", err)
 	}
 
+	// Set environment variables from file
+	if err := caddy.LoadEnvFile(); err != nil {
+		mustLogFatalf("%v", err)
+	}
+
 	// Executes Startup events
 	caddy.EmitEvent(caddy.StartupEvent, nil)
 
@@ -108,20 +154,69 @@ func Run() {
 	if err != nil {
 		mustLogFatalf("%v", err)
 	}
+	if _, err := os.Stat(caddyfileinput.Path()); err == nil {
+		// it is read again on reload
+		caddy.RegisterReadablePath(caddyfileinput.Path())
+	}
 
-	if validate {
-		err := caddy.ValidateAndExecuteDirectives(caddyfileinput, nil, true)
+	if expand {
+		fmt.Printf("%s\n", caddyfileinput.Body())
+		os.Exit(0)
+	}
+
+	if convert != "" {
+		output, err := caddyfile.Convert(caddyfileinput.Body(), convert)
 		if err != nil {
 			mustLogFatalf("%v", err)
 		}
-		msg := "Caddyfile is valid"
-		fmt.Println(msg)
-		log.Printf("[INFO] %s", msg)
+		fmt.Printf("%s\n", output)
 		os.Exit(0)
 	}
 
+	if validate {
+		os.Exit(runValidate(caddyfileinput))
+	}
+	if diff {
+		os.Exit(runDiff(caddyfileinput))
+	}
+
+	// Serve the admin API
+	if admin != "" {
+		if err := caddyadmin.Start(admin, os.Getenv(adminTokenEnv)); err != nil {
+			mustLogFatalf("%v", err)
+		}
+	}
+
 	// Start your engines
-	instance, err := caddy.Start(caddyfileinput)
+	if privileges.Flags != (caddy.Privileges{}) {
+		caddy.PlanChroot(privileges.Flags.Chroot)
+	}
+	start := func() (*caddy.Instance, error) {
+		instance, err := caddy.Start(caddyfileinput)
+		if err != nil {
+			return instance, err
+		}
+		// Drop privileges, unless the Caddyfile did; an upgraded
+		// process has the privileges of the one it replaced
+		if privileges.Flags != (caddy.Privileges{}) && !caddy.IsUpgrade() {
+			if err := caddy.DropPrivileges(privileges.Flags); err != nil {
+				return instance, err
+			}
+		}
+		// Apply changes to a remote Caddyfile
+		if remote != nil && confPoll > 0 {
+			remote.Poll(confPoll, caddy.Reload)
+		}
+		return instance, nil
+	}
+	if serviceAction == "run" {
+		// the service manager decides when to stop
+		if err := runService(start); err != nil {
+			mustLogFatalf("%v", err)
+		}
+		return
+	}
+	instance, err := start()
 	if err != nil {
 		mustLogFatalf("%v", err)
 	}
@@ -130,6 +225,69 @@ func Run() {
 	instance.Wait()
 }
 
+// serviceArgs returns args without the -service flag, to be
+// given to the installed service.
+func serviceArgs(args []string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if name == "service" {
+			i++ // skip its value
+			continue
+		}
+		if strings.HasPrefix(name, "service=") {
+			continue
+		}
+		kept = append(kept, args[i])
+	}
+	return kept
+}
+
+// runValidate validates the Caddyfile, printing every problem
+// found, and returns the exit status: 1 if there were errors,
+// 0 otherwise, even if there were warnings.
+func runValidate(input caddy.Input) int {
+	var errs int
+	for _, diag := range caddy.Validate(input) {
+		fmt.Fprintln(os.Stderr, diag)
+		log.Printf("[INFO] %s", diag)
+		if !diag.Warning {
+			errs++
+		}
+	}
+	if errs > 0 {
+		msg := fmt.Sprintf("Caddyfile is invalid: %d error(s)", errs)
+		fmt.Fprintln(os.Stderr, msg)
+		log.Printf("[ERROR] %s", msg)
+		return 1
+	}
+	msg := "Caddyfile is valid"
+	fmt.Println(msg)
+	log.Printf("[INFO] %s", msg)
+	return 0
+}
+
+// runDiff prints how the Caddyfile differs from the configuration
+// of the running Caddy, got from its admin API, and returns the exit
+// status: 0 if there are no differences, 1 if there are, and 2 if
+// they couldn't be found, as diff does.
+func runDiff(input caddy.Input) int {
+	if admin == "" {
+		fmt.Fprintln(os.Stderr, "-diff requires the address of the admin API of the running Caddy, with -admin")
+		return 2
+	}
+	diff, err := caddyadmin.Diff(admin, os.Getenv(adminTokenEnv), input.Body())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Print(diff)
+	if diff.Empty() {
+		return 0
+	}
+	return 1
+}
+
 // mustLogFatalf wraps log.Fatalf() in a way that ensures the
 // output is always printed to stderr so the user can see it
 // if the user is still there, even if the process log was not
@@ -153,10 +311,28 @@ func confLoader(serverType string) (caddy.Input, error) {
 		return caddy.CaddyfileFromPipe(os.Stdin, serverType)
 	}
 
-	contents, err := ioutil.ReadFile(conf)
+	var contents []byte
+	var err error
+	name := conf
+	if remoteconfig.IsRemote(conf) {
+		if remote == nil {
+			remote, err = newRemote()
+			if err != nil {
+				return nil, err
+			}
+		}
+		name = remote.Name()
+		contents, err = remote.Load()
+	} else {
+		contents, err = ioutil.ReadFile(conf)
+	}
 	if err != nil {
 		return nil, err
 	}
+	contents, err = caddyfile.Adapt(name, contents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", conf, err)
+	}
 	return caddy.CaddyfileInput{
 		Contents:       contents,
 		Filepath:       conf,
@@ -164,6 +340,20 @@ func confLoader(serverType string) (caddy.Input, error) {
 	}, nil
 }
 
+// newRemote returns the remote Caddyfile given by the -conf
+// and -conf-pubkey flags.
+func newRemote() (*remoteconfig.Remote, error) {
+	var key crypto.PublicKey
+	if confPubKey != "" {
+		var err error
+		key, err = remoteconfig.LoadPublicKey(confPubKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return remoteconfig.New(conf, key)
+}
+
 // defaultLoader loads the Caddyfile from the current working directory.
 func defaultLoader(serverType string) (caddy.Input, error) {
 	contents, err := ioutil.ReadFile(caddy.DefaultConfigFile)
@@ -173,6 +363,10 @@ func defaultLoader(serverType string) (caddy.Input, error) {
 		}
 		return nil, err
 	}
+	contents, err = caddyfile.Adapt(caddy.DefaultConfigFile, contents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", caddy.DefaultConfigFile, err)
+	}
 	return caddy.CaddyfileInput{
 		Contents:       contents,
 		Filepath:       caddy.DefaultConfigFile,
@@ -238,16 +432,31 @@ func setCPU(cpu string) error {
 
 const appName = "Caddy"
 
+// adminTokenEnv is the environment variable holding the token
+// required by the admin API; it's not a flag so that it doesn't
+// show up in the process list.
+const adminTokenEnv = "CADDY_ADMIN_TOKEN"
+
 // Flags that control program flow or startup
 var (
+	admin      string
 	serverType string
 	conf       string
+	confPoll   time.Duration
+	confPubKey string
+	remote     *remoteconfig.Remote
+	convert    string
+	expand     bool
 	cpu        string
 	logfile    string
 	revoke     string
 	version    bool
 	plugins    bool
 	validate   bool
+	diff       bool
+
+	serviceAction string
+	serviceName   string
 )
 
 // Build information obtained with the help of -ldflags
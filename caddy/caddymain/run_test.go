@@ -1,6 +1,12 @@
 package caddymain
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
 )
@@ -42,3 +48,89 @@ func TestSetCPU(t *testing.T) {
 		runtime.GOMAXPROCS(currentCPU)
 	}
 }
+
+func TestConfLoaderAdaptsJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddymain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "caddy.json")
+	err = ioutil.WriteFile(path, []byte(`[{"keys":["localhost"],"body":[["gzip"]]}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf = path
+	defer func() { conf = "" }()
+	input, err := confLoader("http")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expected, actual := "localhost {\n\tgzip\n}", string(input.Body()); actual != expected {
+		t.Errorf("Expected body '%s', got '%s'", expected, actual)
+	}
+	if input.Path() != path {
+		t.Errorf("Expected path '%s', got '%s'", path, input.Path())
+	}
+}
+
+func TestConfLoaderExpandsTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddymain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "Caddyfile.tmpl")
+	err = ioutil.WriteFile(path, []byte("{{range split \" \" \"a b\"}}{{.}}.localhost {\n\tgzip\n}\n{{end}}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf = path
+	defer func() { conf = "" }()
+	input, err := confLoader("http")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expected, actual := "a.localhost {\n\tgzip\n}\nb.localhost {\n\tgzip\n}\n", string(input.Body()); actual != expected {
+		t.Errorf("Expected body '%s', got '%s'", expected, actual)
+	}
+}
+
+func TestConfLoaderRemote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"keys":["localhost"],"body":[["gzip"]]}]`))
+	}))
+	defer srv.Close()
+
+	conf = srv.URL + "/caddy.json"
+	defer func() { conf, remote = "", nil }()
+	input, err := confLoader("http")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expected, actual := "localhost {\n\tgzip\n}", string(input.Body()); actual != expected {
+		t.Errorf("Expected body '%s', got '%s'", expected, actual)
+	}
+	if input.Path() != conf {
+		t.Errorf("Expected path '%s', got '%s'", conf, input.Path())
+	}
+}
+
+func TestServiceArgs(t *testing.T) {
+	for i, test := range []struct {
+		args   []string
+		expect []string
+	}{
+		{[]string{"-service", "install", "-conf", "C:\\Caddyfile"}, []string{"-conf", "C:\\Caddyfile"}},
+		{[]string{"-agree", "--service=install", "-log", "stdout"}, []string{"-agree", "-log", "stdout"}},
+		{[]string{"-service-name", "web", "-service", "install"}, []string{"-service-name", "web"}},
+	} {
+		if actual := serviceArgs(test.args); !reflect.DeepEqual(actual, test.expect) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expect, actual)
+		}
+	}
+}
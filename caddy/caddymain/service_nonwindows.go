@@ -0,0 +1,28 @@
+// +build !windows
+
+package caddymain
+
+import (
+	"errors"
+	"io"
+
+	"github.com/mholt/caddy"
+)
+
+// errNoService is returned by the service functions, since
+// services are only implemented for Windows; elsewhere, the init
+// system runs Caddy like any other process (with systemd, use
+// Type=notify to get lifecycle notifications).
+var errNoService = errors.New("-service is only supported on Windows")
+
+func controlService(action string, args []string) error {
+	return errNoService
+}
+
+func runService(start func() (*caddy.Instance, error)) error {
+	return errNoService
+}
+
+func serviceLog() (io.Writer, error) {
+	return nil, errNoService
+}
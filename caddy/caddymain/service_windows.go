@@ -0,0 +1,318 @@
+// +build windows
+
+package caddymain
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/mholt/caddy"
+)
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procOpenSCManagerW                = advapi32.NewProc("OpenSCManagerW")
+	procCreateServiceW                = advapi32.NewProc("CreateServiceW")
+	procOpenServiceW                  = advapi32.NewProc("OpenServiceW")
+	procDeleteService                 = advapi32.NewProc("DeleteService")
+	procCloseServiceHandle            = advapi32.NewProc("CloseServiceHandle")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+	procRegisterEventSourceW          = advapi32.NewProc("RegisterEventSourceW")
+	procReportEventW                  = advapi32.NewProc("ReportEventW")
+	procRegCreateKeyExW               = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW                = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteKeyW                 = advapi32.NewProc("RegDeleteKeyW")
+	procRegCloseKey                   = advapi32.NewProc("RegCloseKey")
+)
+
+// Constants from the Windows SDK.
+const (
+	scManagerAllAccess     = 0xF003F
+	serviceAllAccess       = 0xF01FF
+	deleteAccess           = 0x10000
+	serviceWin32OwnProcess = 0x10
+	serviceAutoStart       = 2
+	serviceErrorNormal     = 1
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop     = 1
+	serviceAcceptShutdown = 4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	eventlogErrorType       = 1
+	eventlogWarningType     = 2
+	eventlogInformationType = 4
+
+	hkeyLocalMachine = 0x80000002
+	keyAllAccess     = 0xF003F
+	regExpandSz      = 2
+	regDword         = 4
+)
+
+// eventLogKey is the registry key under which event sources
+// are registered.
+const eventLogKey = `SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// controlService installs or uninstalls the Windows service.
+// The installed service runs this executable with args.
+func controlService(action string, args []string) error {
+	switch action {
+	case "install":
+		return installService(args)
+	case "uninstall":
+		return uninstallService()
+	}
+	return fmt.Errorf("unknown service action '%s'; must be install, uninstall or run", action)
+}
+
+func openSCManager() (uintptr, error) {
+	m, _, err := procOpenSCManagerW.Call(0, 0, scManagerAllAccess)
+	if m == 0 {
+		return 0, fmt.Errorf("connecting to service manager: %v", err)
+	}
+	return m, nil
+}
+
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmdline := syscall.EscapeArg(exe) + " -service run"
+	for _, arg := range args {
+		cmdline += " " + syscall.EscapeArg(arg)
+	}
+
+	m, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(m)
+
+	s, _, err := procCreateServiceW.Call(m,
+		uintptr(unsafe.Pointer(utf16Ptr(serviceName))),
+		uintptr(unsafe.Pointer(utf16Ptr(appName+" ("+serviceName+")"))),
+		serviceAllAccess, serviceWin32OwnProcess, serviceAutoStart, serviceErrorNormal,
+		uintptr(unsafe.Pointer(utf16Ptr(cmdline))), 0, 0, 0, 0, 0)
+	if s == 0 {
+		return fmt.Errorf("creating service %s: %v", serviceName, err)
+	}
+	procCloseServiceHandle.Call(s)
+
+	if err := installEventSource(); err != nil {
+		return fmt.Errorf("registering event source: %v", err)
+	}
+	return nil
+}
+
+func uninstallService() error {
+	m, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(m)
+
+	s, _, err := procOpenServiceW.Call(m, uintptr(unsafe.Pointer(utf16Ptr(serviceName))), deleteAccess)
+	if s == 0 {
+		return fmt.Errorf("opening service %s: %v", serviceName, err)
+	}
+	defer procCloseServiceHandle.Call(s)
+	if r, _, err := procDeleteService.Call(s); r == 0 {
+		return fmt.Errorf("deleting service %s: %v", serviceName, err)
+	}
+
+	r, _, _ := procRegDeleteKeyW.Call(hkeyLocalMachine, uintptr(unsafe.Pointer(utf16Ptr(eventLogKey+serviceName))))
+	if r != 0 {
+		return fmt.Errorf("unregistering event source: %v", syscall.Errno(r))
+	}
+	return nil
+}
+
+// installEventSource registers the service as an event source
+// whose messages are shown as they are, using the message file
+// of EventCreate.exe.
+func installEventSource() error {
+	var key uintptr
+	r, _, _ := procRegCreateKeyExW.Call(hkeyLocalMachine, uintptr(unsafe.Pointer(utf16Ptr(eventLogKey+serviceName))),
+		0, 0, 0, keyAllAccess, 0, uintptr(unsafe.Pointer(&key)), 0)
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	defer procRegCloseKey.Call(key)
+
+	msgFile, err := syscall.UTF16FromString(`%SystemRoot%\System32\EventCreate.exe`)
+	if err != nil {
+		return err
+	}
+	r, _, _ = procRegSetValueExW.Call(key, uintptr(unsafe.Pointer(utf16Ptr("EventMessageFile"))), 0, regExpandSz,
+		uintptr(unsafe.Pointer(&msgFile[0])), uintptr(len(msgFile)*2))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	types := uint32(eventlogErrorType | eventlogWarningType | eventlogInformationType)
+	r, _, _ = procRegSetValueExW.Call(key, uintptr(unsafe.Pointer(utf16Ptr("TypesSupported"))), 0, regDword,
+		uintptr(unsafe.Pointer(&types)), 4)
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+// serviceLog returns a writer that logs to the event log.
+func serviceLog() (io.Writer, error) {
+	h, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(utf16Ptr(serviceName))))
+	if h == 0 {
+		return nil, fmt.Errorf("opening event log: %v", err)
+	}
+	return eventLogWriter(h), nil
+}
+
+// eventLogWriter writes each log entry to the event log, as an
+// error or warning if it is marked as one.
+type eventLogWriter uintptr
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(strings.Replace(string(p), "\x00", "", -1))
+	etype := eventlogInformationType
+	switch {
+	case strings.Contains(msg, "[ERROR]"), strings.Contains(msg, "[FATAL]"):
+		etype = eventlogErrorType
+	case strings.Contains(msg, "[WARNING]"):
+		etype = eventlogWarningType
+	}
+	str := utf16Ptr(msg)
+	r, _, err := procReportEventW.Call(uintptr(w), uintptr(etype), 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&str)), 0)
+	if r == 0 {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// service is the state of the running service.
+var service struct {
+	sync.Mutex
+	handle uintptr
+	status serviceStatus
+	stop   chan struct{}
+	start  func() (*caddy.Instance, error)
+	err    error
+}
+
+// runService runs Caddy as a Windows service: it hands control
+// to the service manager, which calls start and later asks to
+// stop. It returns once the service has stopped.
+func runService(start func() (*caddy.Instance, error)) error {
+	service.start = start
+	service.stop = make(chan struct{}, 1)
+	table := []serviceTableEntry{
+		{name: utf16Ptr(serviceName), proc: syscall.NewCallback(serviceMain)},
+		{},
+	}
+	r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))
+	if r == 0 {
+		return fmt.Errorf("connecting to service manager (only the service manager can run the service): %v", err)
+	}
+	return service.err
+}
+
+// serviceMain is called by the service manager on its own thread.
+func serviceMain(argc, argv uintptr) uintptr {
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(utf16Ptr(serviceName))),
+		syscall.NewCallback(serviceHandler), 0)
+	if h == 0 {
+		service.err = fmt.Errorf("registering service control handler: %v", err)
+		return 0
+	}
+	service.handle = h
+
+	setServiceStatus(serviceStartPending, 0, 0)
+	if _, err := service.start(); err != nil {
+		log.Printf("[ERROR] %v", err)
+		service.err = err
+		setServiceStatus(serviceStopped, 0, 1)
+		return 0
+	}
+	setServiceStatus(serviceRunning, serviceAcceptStop|serviceAcceptShutdown, 0)
+
+	<-service.stop
+	exitCode := caddy.Quit("service stop")
+	setServiceStatus(serviceStopped, 0, uint32(exitCode))
+	return 0
+}
+
+// serviceHandler handles control requests from the service manager.
+func serviceHandler(control, eventType, eventData, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		setServiceStatus(serviceStopPending, 0, 0)
+		select {
+		case service.stop <- struct{}{}:
+		default:
+		}
+	case serviceControlInterrogate:
+		service.Lock()
+		status := service.status
+		service.Unlock()
+		procSetServiceStatus.Call(service.handle, uintptr(unsafe.Pointer(&status)))
+	}
+	return 0
+}
+
+func setServiceStatus(state, accepts, exitCode uint32) {
+	service.Lock()
+	defer service.Unlock()
+	service.status = serviceStatus{
+		ServiceType:      serviceWin32OwnProcess,
+		CurrentState:     state,
+		ControlsAccepted: accepts,
+	}
+	if exitCode != 0 {
+		// ERROR_SERVICE_SPECIFIC_ERROR
+		service.status.Win32ExitCode = 1066
+		service.status.ServiceSpecificExitCode = exitCode
+	}
+	if state == serviceStartPending || state == serviceStopPending {
+		service.status.WaitHint = 30000
+	}
+	procSetServiceStatus.Call(service.handle, uintptr(unsafe.Pointer(&service.status)))
+}
+
+// utf16Ptr converts s, which must not contain NUL, for the API.
+func utf16Ptr(s string) *uint16 {
+	p, err := syscall.UTF16PtrFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
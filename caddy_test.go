@@ -1,9 +1,20 @@
 package caddy
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
 )
 
 /*
@@ -157,3 +168,196 @@ func TestListenerAddrEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_envfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func() { EnvFile = "" }()
+	defer os.Unsetenv("CADDY_TEST_PLAIN")
+	defer os.Unsetenv("CADDY_TEST_QUOTED")
+	defer os.Unsetenv("CADDY_TEST_EXPORTED")
+
+	EnvFile = filepath.Join(dir, "env")
+	contents := "# comment\n\nCADDY_TEST_PLAIN=plain\nCADDY_TEST_QUOTED = \"a b=c\"\nexport CADDY_TEST_EXPORTED='x'\n"
+	if err := ioutil.WriteFile(EnvFile, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadEnvFile(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for key, expected := range map[string]string{
+		"CADDY_TEST_PLAIN":    "plain",
+		"CADDY_TEST_QUOTED":   "a b=c",
+		"CADDY_TEST_EXPORTED": "x",
+	} {
+		if actual := os.Getenv(key); actual != expected {
+			t.Errorf("Expected %s to be '%s', got '%s'", key, expected, actual)
+		}
+	}
+
+	if err := ioutil.WriteFile(EnvFile, []byte("CADDY_TEST_PLAIN=1\nnot a variable\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadEnvFile(); err == nil {
+		t.Error("Expected an error for malformed line, got none")
+	}
+
+	EnvFile = ""
+	if err := LoadEnvFile(); err != nil {
+		t.Errorf("Expected no error without EnvFile, got: %v", err)
+	}
+}
+
+func TestRestartIsolated(t *testing.T) {
+	input := func(contents string) Input {
+		return CaddyfileInput{Filepath: "Caddyfile", ServerTypeName: "validatetest", Contents: []byte(contents)}
+	}
+	inst := &Instance{serverType: "validatetest", wg: new(sync.WaitGroup)}
+	if err := startWithListenerFds(input("host1 {\n\tgood 1\n}\nhost2, HOST3 {\n\tgood 2\n}\nhost5 {\n\tgood 5\n}"), nil, inst, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer func() { inst.Stop() }()
+
+	// host1 is fixed, host2 and host5 keep their previous blocks
+	// and host4 and host6 are left out
+	inst, err := inst.Restart(input(`host1 {
+	good 3
+}
+host3, host2 {
+	bad x
+}
+host4 {
+	bad y
+}
+host5 {
+	failstart
+}
+host6 {
+	failstart
+}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	blockTexts := func(sblocks []caddyfile.ServerBlock) [][]string {
+		var texts [][]string
+		for _, sb := range sblocks {
+			text := append([]string{}, sb.Keys...)
+			for _, dir := range []string{"good", "bad", "failstart"} {
+				for _, token := range sb.Tokens[dir] {
+					text = append(text, token.Text)
+				}
+			}
+			texts = append(texts, text)
+		}
+		return texts
+	}
+	expected := [][]string{{"host1", "good", "3"}, {"host2", "HOST3", "good", "2"}, {"host5", "good", "5"}}
+	if actual := blockTexts(inst.serverBlocks); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected server blocks %v, got %v", expected, actual)
+	}
+
+	// the Caddyfile is the one that runs
+	cdyfile := inst.Caddyfile()
+	sblocks, err := loadServerBlocks("validatetest", cdyfile.Path(), bytes.NewReader(cdyfile.Body()))
+	if err != nil {
+		t.Fatalf("Expected no error loading the Caddyfile, got: %v", err)
+	}
+	if actual := blockTexts(sblocks); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected the Caddyfile to have server blocks %v, got %v", expected, actual)
+	}
+
+	// nothing to isolate, so each block is set up once
+	setups := goodSetups
+	inst, err = inst.Restart(input("host1 {\n\tgood\n}\nhost2 {\n\tgood\n}"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(inst.serverBlocks) != 2 || goodSetups-setups != 2 {
+		t.Errorf("Expected 2 server blocks set up once each, got %d blocks and %d setups", len(inst.serverBlocks), goodSetups-setups)
+	}
+	if string(inst.Caddyfile().Body()) != "host1 {\n\tgood\n}\nhost2 {\n\tgood\n}" {
+		t.Errorf("Expected the Caddyfile as given, got %s", inst.Caddyfile().Body())
+	}
+
+	// everything failing is an error
+	if _, err := inst.Restart(input("host7 {\n\tbad x\n}\nhost8 {\n\tfailstart\n}")); err == nil {
+		t.Error("Expected an error when every server block fails, got none")
+	}
+
+	// so is a Caddyfile that can't be parsed
+	if _, err := inst.Restart(input("host1 {\n\tunknown\n}")); err == nil {
+		t.Error("Expected an error for an unparsable Caddyfile, got none")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	var got []interface{}
+	unsubscribe := Subscribe(CertExpiringEvent, func(info interface{}) error {
+		got = append(got, info)
+		return nil
+	})
+	EmitEvent(CertExpiringEvent, "a")
+	EmitEvent(CertObtainedEvent, "b")
+	unsubscribe()
+	EmitEvent(CertExpiringEvent, "c")
+	if !reflect.DeepEqual(got, []interface{}{"a"}) {
+		t.Errorf("Expected only the subscribed event before unsubscribing, got %v", got)
+	}
+}
+
+func TestCheckReadiness(t *testing.T) {
+	RegisterReadinessCheck("test_ok", func() error { return nil })
+	RegisterReadinessCheck("test_fail", func() error { return errors.New("down") })
+	RegisterReadinessCheck("test_slow", func() error { time.Sleep(time.Second); return nil })
+	RegisterReadinessCheck("test_panic", func() error { panic("oops") })
+	defer func() {
+		readinessChecksMu.Lock()
+		for _, name := range []string{"test_ok", "test_fail", "test_slow", "test_panic"} {
+			delete(readinessChecks, name)
+		}
+		readinessChecksMu.Unlock()
+	}()
+
+	errs := CheckReadiness(50 * time.Millisecond)
+	if len(errs) != len(ReadinessChecks()) {
+		t.Errorf("Expected a result for each of %v, got %v", ReadinessChecks(), errs)
+	}
+	if err := errs["test_ok"]; err != nil {
+		t.Errorf("Expected test_ok to pass, got: %v", err)
+	}
+	if err := errs["test_fail"]; err == nil || err.Error() != "down" {
+		t.Errorf("Expected test_fail to fail with its error, got: %v", err)
+	}
+	if err := errs["test_slow"]; err != errReadinessTimeout {
+		t.Errorf("Expected test_slow to time out, got: %v", err)
+	}
+	if err := errs["test_panic"]; err == nil {
+		t.Error("Expected test_panic to fail")
+	}
+	if err := errs["config"]; err != errNoInstance {
+		t.Errorf("Expected config check to fail without instances, got: %v", err)
+	}
+}
+
+func TestLoadServerBlocksRegistersImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy-imports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	imported := filepath.Join(dir, "good.conf")
+	if err := ioutil.WriteFile(imported, []byte("good 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	caddyfile := filepath.Join(dir, "Caddyfile")
+	if _, err := loadServerBlocks("validatetest", caddyfile, strings.NewReader("host1 {\n\timport good.conf\n}")); err != nil {
+		t.Fatal(err)
+	}
+	if !Readable(imported) {
+		t.Error("Expected the imported file to be readable on reload once privileges are dropped")
+	}
+}
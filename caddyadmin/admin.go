@@ -0,0 +1,833 @@
+// Package caddyadmin implements an HTTP API for inspecting and
+// controlling a running Caddy process: its configuration and how a
+// candidate differs from it, its listeners, certificates and plugins, reloading, upgrading and
+// stopping it, starting, reloading and stopping tenants, toggling maintenance mode, draining proxy
+// upstreams, switching blue/green deployments, adjusting canaries, purging cached template output, inspecting the
+// traces of recent requests, signing links to protected paths and
+// inspecting and lifting the bans of client IPs, checking whether
+// sites are ready for HSTS preload and issuing and revoking API keys.
+package caddyadmin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/apikeys"
+	"github.com/mholt/caddy/caddyhttp/hsts"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/proxy"
+	"github.com/mholt/caddy/caddyhttp/signedurl"
+	"github.com/mholt/caddy/caddyhttp/templates"
+	"github.com/mholt/caddy/caddytls"
+)
+
+// unixPrefix marks an address as the path of a unix socket.
+const unixPrefix = "unix:"
+
+// Handler serves the admin API.
+type Handler struct {
+	// Token, if not empty, must be presented as a bearer
+	// token in the Authorization header of every request.
+	Token string
+
+	// Addr is the address the API listens at, as given to Listen.
+	// Without a Token, requests to a network address must have a
+	// loopback Host, so that pages whose names resolve to a
+	// loopback address can't reach it.
+	Addr string
+
+	mux *http.ServeMux
+}
+
+// bodyTypes are the media types of request bodies accepted. Browsers
+// can't send them cross-origin without asking first, as they can
+// send forms and text/plain.
+var bodyTypes = map[string]bool{
+	"text/caddyfile":   true,
+	"application/json": true,
+	"application/yaml": true,
+}
+
+// New returns a Handler that requires token, if not empty.
+func New(token string) *Handler {
+	h := &Handler{Token: token, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/config", h.config)
+	h.mux.HandleFunc("/config/diff", h.configDiff)
+	h.mux.HandleFunc("/listeners", h.listeners)
+	h.mux.HandleFunc("/certificates", h.certificates)
+	h.mux.HandleFunc("/plugins", h.plugins)
+	h.mux.HandleFunc("/reload", h.reload)
+	h.mux.HandleFunc("/tenants", h.tenants)
+	h.mux.HandleFunc("/tenants/reload", h.reloadTenant)
+	h.mux.HandleFunc("/stop", h.stop)
+	h.mux.HandleFunc("/upgrade", h.upgrade)
+	h.mux.HandleFunc("/maintenance", h.maintenance)
+	h.mux.HandleFunc("/upstreams/drain", h.drain)
+	h.mux.HandleFunc("/upstreams/deployments", h.deployments)
+	h.mux.HandleFunc("/upstreams/canaries", h.canaries)
+	h.mux.HandleFunc("/templates/cache", h.templatesCache)
+	h.mux.HandleFunc("/requests", h.requests)
+	h.mux.HandleFunc("/signed_url", h.signedURL)
+	h.mux.HandleFunc("/bans", h.bans)
+	h.mux.HandleFunc("/hsts", h.hsts)
+	h.mux.HandleFunc("/apikeys", h.apiKeys)
+	return h
+}
+
+// Listen opens a listener for the admin API at addr, which is
+// either a network address or "unix:" followed by the path of a
+// unix socket, which is created accessible to its owner only. A
+// network address that isn't a loopback address requires a token,
+// since the API would be reachable from other hosts.
+func Listen(addr, token string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		path := strings.TrimPrefix(addr, unixPrefix)
+		os.Remove(path) // left behind if the last process didn't exit cleanly
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	}
+	if token == "" && !isLoopback(addr) {
+		return nil, fmt.Errorf("admin API at %s is not on a loopback address, so it requires a token", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Start serves the admin API at addr in the background; see Listen.
+// In a process started by an upgrade, the address may still be in
+// use by the old process for a while, so it keeps trying.
+func Start(addr, token string) error {
+	ln, err := Listen(addr, token)
+	if err != nil && caddy.IsUpgrade() {
+		go func() {
+			deadline := time.Now().Add(upgradeListenTimeout)
+			for err != nil && time.Now().Before(deadline) {
+				time.Sleep(250 * time.Millisecond)
+				ln, err = Listen(addr, token)
+			}
+			if err != nil {
+				log.Printf("[ERROR] Admin API: %v", err)
+				return
+			}
+			serve(ln, addr, token)
+		}()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	serve(ln, addr, token)
+	return nil
+}
+
+// upgradeListenTimeout is how long the admin API waits for its
+// address to be released by the process that started an upgrade.
+const upgradeListenTimeout = time.Minute
+
+// serve serves the admin API at addr on ln in the background.
+func serve(ln net.Listener, addr, token string) {
+	h := New(token)
+	h.Addr = addr
+	srv := &http.Server{
+		Handler:      h,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			log.Printf("[ERROR] Admin API: %v", err)
+		}
+	}()
+	log.Printf("[INFO] Admin API listening on %s", ln.Addr())
+}
+
+// isLoopback returns whether the host of addr is a loopback
+// address; an empty host means all interfaces, so it isn't.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ServeHTTP implements http.Handler. Requests from web pages, which
+// have an Origin header, are refused, as are bodies that pages could
+// send without asking first, so that pages can't use the API of a
+// browser's host.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Origin") != "" {
+		writeError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+		return
+	}
+	if h.Token == "" && h.Addr != "" && !strings.HasPrefix(h.Addr, unixPrefix) && !isLoopback(r.Host) {
+		writeError(w, http.StatusForbidden, "host not allowed")
+		return
+	}
+	if r.ContentLength != 0 {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || !bodyTypes[mediaType] {
+			writeError(w, http.StatusUnsupportedMediaType, "the body must be text/caddyfile, application/json or application/yaml")
+			return
+		}
+	}
+	if h.Token != "" {
+		auth := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(auth, "Bearer ")
+		if given == auth || subtle.ConstantTimeCompare([]byte(given), []byte(h.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="caddy admin"`)
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// reloadFunc and quitFunc are variables so tests don't restart
+// or exit the process.
+var (
+	reloadFunc  = caddy.Reload
+	quitFunc    = func() { os.Exit(caddy.Quit("admin API")) }
+	upgradeFunc = caddy.Upgrade
+)
+
+// config returns the running Caddyfile, or that of the tenant
+// parameter, converted to the format parameter if given.
+func (h *Handler) config(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	inst := caddy.MainInstance()
+	if name := r.URL.Query().Get("tenant"); name != "" {
+		inst = caddy.TenantInstance(name)
+	}
+	if inst == nil || inst.Caddyfile() == nil {
+		writeError(w, http.StatusNotFound, "no configuration loaded")
+		return
+	}
+	input := inst.Caddyfile()
+	body := input.Body()
+	if format := r.URL.Query().Get("format"); format != "" {
+		var err error
+		body, err = caddyfile.Convert(body, format)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Caddyfile-Path", input.Path())
+	w.Write(body)
+}
+
+// maxCandidateSize is the largest candidate Caddyfile accepted.
+const maxCandidateSize = 10 << 20
+
+// configDiff reports how the Caddyfile in the request body differs
+// from the running one, without changing anything. The format
+// parameter says if the candidate is JSON or YAML.
+func (h *Handler) configDiff(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	inst := caddy.MainInstance()
+	if inst == nil || inst.Caddyfile() == nil {
+		writeError(w, http.StatusNotFound, "no configuration loaded")
+		return
+	}
+	running := inst.Caddyfile()
+	body, err := readCandidate(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	candidate := caddy.CaddyfileInput{
+		Contents:       body,
+		Filepath:       running.Path(), // so that imports are found alike
+		ServerTypeName: running.ServerType(),
+	}
+	diff, err := caddy.DiffCaddyfiles(running, candidate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, diff)
+}
+
+// readCandidate reads the Caddyfile in the body of r, adapted from
+// the format parameter if given.
+func readCandidate(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCandidateSize))
+	if err != nil {
+		return nil, err
+	}
+	if format := r.URL.Query().Get("format"); format != "" {
+		return caddyfile.Adapt("candidate."+format, body)
+	}
+	return body, nil
+}
+
+// listenerInfo describes a server's listener.
+type listenerInfo struct {
+	ServerType string `json:"server_type"`
+	Network    string `json:"network"`
+	Address    string `json:"address"`
+}
+
+func (h *Handler) listeners(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	list := []listenerInfo{}
+	for _, inst := range caddy.Instances() {
+		var stype string
+		if input := inst.Caddyfile(); input != nil {
+			stype = input.ServerType()
+		}
+		for _, s := range inst.Servers() {
+			for _, addr := range []net.Addr{s.Addr(), s.LocalAddr()} {
+				if addr != nil {
+					list = append(list, listenerInfo{stype, addr.Network(), addr.String()})
+				}
+			}
+		}
+	}
+	writeJSON(w, list)
+}
+
+// certificateInfo describes a cached certificate.
+type certificateInfo struct {
+	Names    []string  `json:"names"`
+	NotAfter time.Time `json:"not_after"`
+	Managed  bool      `json:"managed"`
+	OnDemand bool      `json:"on_demand"`
+	OCSP     string    `json:"ocsp,omitempty"`
+}
+
+// ocspStatuses are the names of the OCSP response statuses.
+var ocspStatuses = map[int]string{0: "good", 1: "revoked", 2: "unknown"}
+
+func (h *Handler) certificates(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	list := []certificateInfo{}
+	for _, cert := range caddytls.CachedCertificates() {
+		info := certificateInfo{NotAfter: cert.NotAfter}
+		for _, name := range cert.Names {
+			if name != "" { // the key of the default certificate
+				info.Names = append(info.Names, name)
+			}
+		}
+		if cert.Config != nil {
+			info.Managed = cert.Config.Managed
+			info.OnDemand = cert.Config.OnDemand
+		}
+		if cert.OCSP != nil {
+			info.OCSP = ocspStatuses[cert.OCSP.Status]
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].Names, ",") < strings.Join(list[j].Names, ",")
+	})
+	writeJSON(w, list)
+}
+
+func (h *Handler) plugins(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, caddy.ListPlugins())
+}
+
+func (h *Handler) reload(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	log.Println("[INFO] Admin API: Reloading")
+	if err := reloadFunc(); err != nil {
+		log.Printf("[ERROR] Admin API: reloading: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tenantInfo describes a running tenant.
+type tenantInfo struct {
+	Name       string `json:"name"`
+	AssetsPath string `json:"assets_path"`
+	Caddyfile  string `json:"caddyfile,omitempty"`
+	Servers    int    `json:"servers"`
+}
+
+// tenants lists the running tenants on GET, starts the tenant of
+// the name parameter with the Caddyfile in the body on POST, and
+// stops it on DELETE. On POST, the assets parameter is where it
+// keeps its assets, and the server_type parameter is that of the
+// Caddyfile, http by default.
+func (h *Handler) tenants(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodPost:
+		if q.Get("name") == "" {
+			writeError(w, http.StatusBadRequest, "missing name parameter")
+			return
+		}
+		body, err := readCandidate(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		stype := q.Get("server_type")
+		if stype == "" {
+			stype = "http"
+		}
+		input := caddy.CaddyfileInput{Contents: body, ServerTypeName: stype}
+		log.Printf("[INFO] Admin API: Starting tenant %s", q.Get("name"))
+		if _, err := caddy.StartTenant(caddy.Tenant{Name: q.Get("name"), AssetsPath: q.Get("assets")}, input); err != nil {
+			log.Printf("[ERROR] Admin API: %v", err)
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case http.MethodDelete:
+		if q.Get("name") == "" {
+			writeError(w, http.StatusBadRequest, "missing name parameter")
+			return
+		}
+		log.Printf("[INFO] Admin API: Stopping tenant %s", q.Get("name"))
+		if err := caddy.StopTenant(q.Get("name")); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+	list := []tenantInfo{}
+	for _, name := range caddy.TenantNames() {
+		inst := caddy.TenantInstance(name)
+		if inst == nil {
+			continue // stopped meanwhile
+		}
+		info := tenantInfo{Name: name, AssetsPath: inst.Tenant().AssetsPath, Servers: len(inst.Servers())}
+		if input := inst.Caddyfile(); input != nil {
+			info.Caddyfile = input.Path()
+		}
+		list = append(list, info)
+	}
+	writeJSON(w, list)
+}
+
+// reloadTenant reloads the tenant of the name parameter with the
+// Caddyfile in the body, or, if it is empty, with its Caddyfile
+// read again. The other instances are left as they are.
+func (h *Handler) reloadTenant(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "missing name parameter")
+		return
+	}
+	inst := caddy.TenantInstance(name)
+	if inst == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no tenant %s is running", name))
+		return
+	}
+	body, err := readCandidate(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var input caddy.Input
+	if len(body) > 0 {
+		running := inst.Caddyfile()
+		input = caddy.CaddyfileInput{Contents: body, Filepath: running.Path(), ServerTypeName: running.ServerType()}
+	}
+	log.Printf("[INFO] Admin API: Reloading tenant %s", name)
+	if _, err := caddy.ReloadTenant(name, input); err != nil {
+		log.Printf("[ERROR] Admin API: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stop(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	log.Println("[INFO] Admin API: Shutting down")
+	w.WriteHeader(http.StatusAccepted)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	// stop after this response is sent, since stopping
+	// ends the process
+	go quitFunc()
+}
+
+// lastUpgradeError is the error of the last failed upgrade.
+var (
+	lastUpgradeError   string
+	lastUpgradeErrorMu sync.Mutex
+)
+
+// upgrade starts an upgrade of the binary on POST, or reports
+// on upgrades on GET. Since a successful upgrade ends this
+// process, it happens in the background; the new process
+// reports that it was started by an upgrade.
+func (h *Handler) upgrade(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		log.Println("[INFO] Admin API: Upgrading")
+		go func() {
+			err := upgradeFunc()
+			lastUpgradeErrorMu.Lock()
+			defer lastUpgradeErrorMu.Unlock()
+			lastUpgradeError = ""
+			if err != nil {
+				log.Printf("[ERROR] Admin API: upgrading: %v", err)
+				lastUpgradeError = err.Error()
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	lastUpgradeErrorMu.Lock()
+	defer lastUpgradeErrorMu.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"upgraded":   caddy.IsUpgrade(),
+		"last_error": lastUpgradeError,
+	})
+}
+
+func (h *Handler) maintenance(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		httpserver.SetMaintenance(true)
+		log.Println("[INFO] Admin API: Maintenance mode on")
+	case http.MethodDelete:
+		httpserver.SetMaintenance(false)
+		log.Println("[INFO] Admin API: Maintenance mode off")
+	}
+	writeJSON(w, map[string]bool{"maintenance": httpserver.InMaintenance()})
+}
+
+func (h *Handler) drain(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		host := r.URL.Query().Get("host")
+		if host == "" {
+			writeError(w, http.StatusBadRequest, "missing host parameter")
+			return
+		}
+		proxy.Drain(host, r.Method == http.MethodPut)
+		log.Printf("[INFO] Admin API: Draining %s: %t", host, r.Method == http.MethodPut)
+	}
+	writeJSON(w, map[string][]string{"drained": proxy.Drained()})
+}
+
+// deployments lists the blue/green deployments of the proxies on
+// GET, or, on PUT, switches the deployment of the name parameter to
+// the pool of the pool parameter, if the hosts of that pool are
+// healthy.
+func (h *Handler) deployments(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	if r.Method == http.MethodPut {
+		q := r.URL.Query()
+		if q.Get("name") == "" || q.Get("pool") == "" {
+			writeError(w, http.StatusBadRequest, "missing name or pool parameter")
+			return
+		}
+		switch err := proxy.SwitchDeployment(q.Get("name"), q.Get("pool")); err {
+		case nil:
+			log.Printf("[INFO] Admin API: Switched deployment %s to pool %s", q.Get("name"), q.Get("pool"))
+		case proxy.ErrNoDeployment, proxy.ErrNoPool:
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		default:
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+	}
+	writeJSON(w, proxy.Deployments())
+}
+
+// canaries lists the canaries of the proxies on GET, or, on PUT,
+// sends the percent parameter percent of clients to the canary of
+// the name parameter.
+func (h *Handler) canaries(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	if r.Method == http.MethodPut {
+		q := r.URL.Query()
+		if q.Get("name") == "" {
+			writeError(w, http.StatusBadRequest, "missing name parameter")
+			return
+		}
+		percent, err := strconv.Atoi(q.Get("percent"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid percent parameter")
+			return
+		}
+		switch err := proxy.SetCanaryPercent(q.Get("name"), percent); err {
+		case nil:
+			log.Printf("[INFO] Admin API: Sending %d%% of clients to canary %s", percent, q.Get("name"))
+		case proxy.ErrNoCanary:
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		default:
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	writeJSON(w, proxy.Canaries())
+}
+
+// templatesCache reports how much template output is cached on
+// GET, or purges it on DELETE: all of it, or that of the pages
+// within the path parameter, optionally only of the host one.
+func (h *Handler) templatesCache(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	resp := make(map[string]int)
+	if r.Method == http.MethodDelete {
+		prefix := r.URL.Query().Get("path")
+		if prefix == "" {
+			prefix = "/"
+		}
+		resp["purged"] = templates.Purge(r.URL.Query().Get("host"), prefix)
+		log.Printf("[INFO] Admin API: Purged %d cached templates in %s", resp["purged"], prefix)
+	}
+	resp["entries"] = templates.CacheSize()
+	writeJSON(w, resp)
+}
+
+// requests reports the traces of the last requests to the sites
+// that keep them, most recent first: all of them, or those of the
+// site parameter, optionally only the slowest, with the slow
+// parameter, in milliseconds.
+func (h *Handler) requests(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	var slow float64
+	if s := r.URL.Query().Get("slow"); s != "" {
+		var err error
+		slow, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid slow parameter")
+			return
+		}
+	}
+	list := []httpserver.RequestTrace{}
+	for _, trace := range httpserver.RecentRequests(r.URL.Query().Get("site")) {
+		if trace.DurationMS >= slow {
+			list = append(list, trace)
+		}
+	}
+	writeJSON(w, list)
+}
+
+// defaultSignedURLTTL is how long links signed through the admin
+// API are valid, unless the ttl parameter says otherwise.
+const defaultSignedURLTTL = time.Hour
+
+// signedURL returns a signed link to the path parameter, valid for
+// the ttl parameter or an hour, for the client at the ip parameter
+// if links are bound to clients. The site parameter is needed if
+// more than one site serves the path through signed links.
+func (h *Handler) signedURL(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("path") == "" {
+		writeError(w, http.StatusBadRequest, "missing path parameter")
+		return
+	}
+	ttl := defaultSignedURLTTL
+	if s := q.Get("ttl"); s != "" {
+		var err error
+		ttl, err = time.ParseDuration(s)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid ttl parameter")
+			return
+		}
+	}
+	link, err := signedurl.Sign(q.Get("site"), q.Get("path"), ttl, q.Get("ip"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"url":     link,
+		"expires": time.Now().Add(ttl).Truncate(time.Second),
+	})
+}
+
+// bans lists the banned client IPs on GET, or lifts the ban of the
+// ip parameter on DELETE.
+func (h *Handler) bans(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	if r.Method == http.MethodDelete {
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			writeError(w, http.StatusBadRequest, "missing ip parameter")
+			return
+		}
+		if !httpserver.UnbanIP(ip) {
+			writeError(w, http.StatusNotFound, "not banned: "+ip)
+			return
+		}
+		log.Printf("[INFO] Admin API: Lifted the ban of %s", ip)
+	}
+	writeJSON(w, httpserver.Bans())
+}
+
+// hsts reports whether the sites with an HSTS policy, or the one
+// of the site parameter, are ready to be preloaded, and what they
+// lack if not.
+func (h *Handler) hsts(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, hsts.Reports(r.URL.Query().Get("site")))
+}
+
+// apiKeys lists the API keys of the keys file of the file parameter
+// on GET, issues one named by the name parameter with the scopes
+// parameter, separated by commas, that expires after the ttl
+// parameter if any on POST, or revokes the key with the id parameter
+// on DELETE. The file parameter may be left out if only one keys
+// file is in use. The key itself is only returned when it is issued.
+func (h *Handler) apiKeys(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	q := r.URL.Query()
+	store, err := apikeys.Lookup(q.Get("file"))
+	if err == apikeys.ErrNoStore {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var ttl time.Duration
+		if s := q.Get("ttl"); s != "" {
+			ttl, err = time.ParseDuration(s)
+			if err != nil || ttl <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid ttl parameter")
+				return
+			}
+		}
+		var scopes []string
+		if s := q.Get("scopes"); s != "" {
+			scopes = strings.Split(s, ",")
+		}
+		k, raw, err := store.Issue(q.Get("name"), scopes, ttl)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("[INFO] Admin API: Issued API key %s in %s", k.ID, store.File)
+		k.Hash = ""
+		writeJSON(w, map[string]interface{}{"key": raw, "info": k})
+		return
+	case http.MethodDelete:
+		id := q.Get("id")
+		if id == "" {
+			writeError(w, http.StatusBadRequest, "missing id parameter")
+			return
+		}
+		err := store.Revoke(id)
+		if err == apikeys.ErrNoKey {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("[INFO] Admin API: Revoked API key %s in %s", id, store.File)
+	}
+
+	keys := store.Keys()
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+	writeJSON(w, keys)
+}
+
+// allowMethods writes a 405 response and returns false if the
+// method of r is not one of methods.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
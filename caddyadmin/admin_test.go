@@ -0,0 +1,519 @@
+package caddyadmin
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/proxy"
+)
+
+func TestAuthorization(t *testing.T) {
+	h := New("secret")
+	for i, test := range []struct {
+		header     string
+		expectCode int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/plugins", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	for i, test := range []struct {
+		addr      string
+		token     string
+		shouldErr bool
+	}{
+		{"127.0.0.1:0", "", false},
+		{"localhost:0", "", false},
+		{":0", "", true},
+		{"0.0.0.0:0", "", true},
+		{":0", "secret", false},
+	} {
+		ln, err := Listen(test.addr, test.token)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected error for %s, got none", i, test.addr)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error for %s, got: %v", i, test.addr, err)
+		}
+		if ln != nil {
+			ln.Close()
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	defer httpserver.SetMaintenance(false)
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		expectCode int
+		expectOn   bool
+	}{
+		{http.MethodGet, http.StatusOK, false},
+		{http.MethodPut, http.StatusOK, true},
+		{http.MethodGet, http.StatusOK, true},
+		{http.MethodPost, http.StatusMethodNotAllowed, true},
+		{http.MethodDelete, http.StatusOK, false},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/maintenance", nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if httpserver.InMaintenance() != test.expectOn {
+			t.Errorf("Test %d: Expected maintenance %t, got %t", i, test.expectOn, !test.expectOn)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		query      string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodPut, "?host=http://b:80", http.StatusOK, `"http://b:80"`},
+		{http.MethodPut, "?host=http://a:80", http.StatusOK, `"http://a:80",`},
+		{http.MethodPut, "", http.StatusBadRequest, "missing host"},
+		{http.MethodDelete, "?host=http://a:80", http.StatusOK, `"http://b:80"`},
+		{http.MethodDelete, "?host=http://b:80", http.StatusOK, `"drained": []`},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/upstreams/drain"+test.query, nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+	if len(proxy.Drained()) != 0 {
+		t.Errorf("Expected no drained hosts, got %v", proxy.Drained())
+	}
+}
+
+func TestDeployments(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		query      string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, "", http.StatusOK, `[]`},
+		{http.MethodPut, "?name=app&pool=green", http.StatusNotFound, "no such deployment"},
+		{http.MethodPut, "?name=app", http.StatusBadRequest, "missing name or pool"},
+		{http.MethodDelete, "?name=app", http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/upstreams/deployments"+test.query, nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestCanaries(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		query      string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, "", http.StatusOK, `[]`},
+		{http.MethodPut, "?name=app&percent=10", http.StatusNotFound, "no such canary"},
+		{http.MethodPut, "?name=app&percent=ten", http.StatusBadRequest, "invalid percent"},
+		{http.MethodPut, "?percent=10", http.StatusBadRequest, "missing name"},
+		{http.MethodPut, "?name=app&percent=101", http.StatusBadRequest, "from 0 to 100"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/upstreams/canaries"+test.query, nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestTemplatesCache(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		query      string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, "", http.StatusOK, `"entries": 0`},
+		{http.MethodDelete, "?path=/blog", http.StatusOK, `"purged": 0`},
+		{http.MethodPost, "", http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/templates/cache"+test.query, nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer func(f func() error) { reloadFunc = f }(reloadFunc)
+	h := New("")
+
+	var reloaded bool
+	reloadFunc = func() error { reloaded = true; return nil }
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	if rec.Code != http.StatusNoContent || !reloaded {
+		t.Errorf("Expected reload and status %d, got reloaded=%t and %d", http.StatusNoContent, reloaded, rec.Code)
+	}
+
+	reloadFunc = func() error { return errors.New("bad config") }
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "bad config") {
+		t.Errorf("Expected status %d with error, got %d: %s", http.StatusInternalServerError, rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for GET, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	defer func(f func() error) { upgradeFunc = f }(upgradeFunc)
+	h := New("")
+
+	done := make(chan struct{})
+	upgradeFunc = func() error {
+		defer close(done)
+		return errors.New("child failed to initialize")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upgrade", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	<-done
+
+	// the error is recorded once the upgrade returns
+	for i := 0; i < 100; i++ {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upgrade", nil))
+		if strings.Contains(rec.Body.String(), "child failed") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(rec.Body.String(), `"last_error": "child failed to initialize"`) {
+		t.Errorf("Expected last error to be reported, got: %s", rec.Body.String())
+	}
+}
+
+func TestRequests(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		query      string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, "", http.StatusOK, "["},
+		{http.MethodGet, "?site=nowhere&slow=100", http.StatusOK, "[]"},
+		{http.MethodGet, "?slow=soon", http.StatusBadRequest, "invalid slow parameter"},
+		{http.MethodDelete, "", http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/requests"+test.query, nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		query      string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, "", http.StatusBadRequest, "missing path parameter"},
+		{http.MethodGet, "?path=/dl/a.zip&ttl=soon", http.StatusBadRequest, "invalid ttl parameter"},
+		{http.MethodGet, "?path=/dl/a.zip&ttl=-1h", http.StatusBadRequest, "invalid ttl parameter"},
+		{http.MethodGet, "?path=/dl/a.zip", http.StatusBadRequest, "not served through signed links"},
+		{http.MethodPost, "?path=/dl/a.zip", http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/signed_url"+test.query, nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodPost, http.StatusNotFound, "no configuration loaded"},
+		{http.MethodGet, http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(test.method, "/config/diff", strings.NewReader("a.com"))
+		req.Header.Set("Content-Type", "text/caddyfile")
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestTenants(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		path       string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, "/tenants", http.StatusOK, "[]"},
+		{http.MethodPost, "/tenants", http.StatusBadRequest, "missing name parameter"},
+		{http.MethodPost, "/tenants?name=a&server_type=none", http.StatusInternalServerError, "starting tenant a"},
+		{http.MethodDelete, "/tenants", http.StatusBadRequest, "missing name parameter"},
+		{http.MethodDelete, "/tenants?name=a", http.StatusNotFound, "no tenant a is running"},
+		{http.MethodPut, "/tenants", http.StatusMethodNotAllowed, "method not allowed"},
+		{http.MethodPost, "/tenants/reload", http.StatusBadRequest, "missing name parameter"},
+		{http.MethodPost, "/tenants/reload?name=a", http.StatusNotFound, "no tenant a is running"},
+		{http.MethodGet, "/tenants/reload?name=a", http.StatusMethodNotAllowed, "method not allowed"},
+		{http.MethodGet, "/config?tenant=a", http.StatusNotFound, "no configuration loaded"},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader("a.com"))
+		req.Header.Set("Content-Type", "text/caddyfile; charset=utf-8")
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestBans(t *testing.T) {
+	h := New("")
+	httpserver.BanIP("198.51.100.40", time.Hour, "testing")
+	defer httpserver.UnbanIP("198.51.100.40")
+	for i, test := range []struct {
+		method     string
+		query      string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, "", http.StatusOK, `"ip": "198.51.100.40"`},
+		{http.MethodDelete, "", http.StatusBadRequest, "missing ip parameter"},
+		{http.MethodDelete, "?ip=198.51.100.40", http.StatusOK, "[]"},
+		{http.MethodDelete, "?ip=198.51.100.40", http.StatusNotFound, "not banned"},
+		{http.MethodPut, "?ip=198.51.100.40", http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/bans"+test.query, nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, http.StatusOK, `[]`},
+		{http.MethodPost, http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/hsts?site=nosuchsite", nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestAPIKeysWithoutStore(t *testing.T) {
+	h := New("")
+	for i, test := range []struct {
+		method     string
+		expectCode int
+		expectBody string
+	}{
+		{http.MethodGet, http.StatusNotFound, "no such keys file"},
+		{http.MethodPut, http.StatusMethodNotAllowed, "method not allowed"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/apikeys?file=/nonexistent/keys.json", nil))
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got: %s", i, test.expectBody, rec.Body.String())
+		}
+	}
+}
+
+func TestAPIKeysIssue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "keys.json")
+
+	setup, err := caddy.DirectiveAction("http", "api_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := caddy.NewTestController("http", "api_keys "+file)
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+
+	h := New("")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/apikeys?file="+file+"&name=ci", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var issued struct {
+		Key  string
+		Info map[string]interface{}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &issued); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := issued.Info["hash"]; ok || issued.Key == "" {
+		t.Errorf("Expected the key without its hash, got %s", rec.Body.String())
+	}
+
+	// the key issued is good right away
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", issued.Key)
+	if status, err := handler.ServeHTTP(httptest.NewRecorder(), req); status != 0 || err != nil {
+		t.Errorf("Expected the key issued to be accepted, got %d, %v", status, err)
+	}
+	req.Header.Set("X-API-Key", issued.Key+"x")
+	if status, _ := handler.ServeHTTP(httptest.NewRecorder(), req); status != http.StatusUnauthorized {
+		t.Errorf("Expected another key to be refused, got %d", status)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	defer func(f func() error) { reloadFunc = f }(reloadFunc)
+	reloadFunc = func() error { return nil }
+
+	h := New("")
+	h.Addr = "localhost:2019"
+	for i, test := range []struct {
+		host, origin, contentType string
+		body                      string
+		expectCode                int
+	}{
+		{"localhost:2019", "", "", "", http.StatusNoContent},
+		{"127.0.0.1:2019", "", "", "", http.StatusNoContent},
+		{"[::1]:2019", "", "", "", http.StatusNoContent},
+		{"localhost:2019", "https://evil.example", "", "", http.StatusForbidden},
+		{"evil.example:2019", "", "", "", http.StatusForbidden},
+		{"localhost:2019", "", "text/plain", "a.com", http.StatusUnsupportedMediaType},
+		{"localhost:2019", "", "application/x-www-form-urlencoded", "a=b", http.StatusUnsupportedMediaType},
+		{"localhost:2019", "", "", "a.com", http.StatusUnsupportedMediaType},
+		{"localhost:2019", "", "text/caddyfile", "a.com", http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/reload", strings.NewReader(test.body))
+		req.Host = test.host
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d: %s", i, test.expectCode, rec.Code, rec.Body.String())
+		}
+	}
+
+	// with a token, or on a unix socket, any host will do
+	for i, h := range []*Handler{{Token: "secret", Addr: "0.0.0.0:2019", mux: New("").mux}, {Addr: "unix:/run/caddy.sock", mux: New("").mux}} {
+		req := httptest.NewRequest(http.MethodGet, "/plugins", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Test %d: Expected any host to be allowed, got %d", i, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package caddyadmin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+// newClient returns a client of the admin API at addr, which is as
+// given to Listen, and the base URL of its requests.
+func newClient(addr string) (*http.Client, string) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return client, "http://" + addr
+	}
+	path := strings.TrimPrefix(addr, unixPrefix)
+	client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	return client, "http://unix"
+}
+
+// Diff asks the admin API at addr, with token if not empty, how
+// caddyfile differs from the configuration Caddy is running.
+func Diff(addr, token string, caddyfile []byte) (caddy.ConfigDiff, error) {
+	var diff caddy.ConfigDiff
+	client, base := newClient(addr)
+	req, err := http.NewRequest(http.MethodPost, base+"/config/diff", bytes.NewReader(caddyfile))
+	if err != nil {
+		return diff, err
+	}
+	req.Header.Set("Content-Type", "text/caddyfile")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return diff, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return diff, fmt.Errorf("admin API: %s: %s", resp.Status, e.Error)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&diff)
+	return diff, err
+}
@@ -0,0 +1,82 @@
+package caddydns
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/acme"
+
+	"github.com/mholt/caddy/caddytls"
+)
+
+func init() {
+	caddytls.RegisterDNSProvider("self", func(credentials ...string) (caddytls.ChallengeProvider, error) {
+		return selfProvider{}, nil
+	})
+}
+
+// challenge is the TXT record of an ACME DNS challenge.
+type challenge struct {
+	value string
+	ttl   uint32
+}
+
+var (
+	// challenges are the challenges being published, by the
+	// lower-case, fully-qualified name of their TXT records.
+	challenges   = make(map[string][]challenge)
+	challengesMu sync.RWMutex
+)
+
+// selfProvider solves the ACME DNS challenges of the sites of this
+// process by publishing their TXT records in the zones it serves,
+// so that no external DNS API is needed; it is the "self" provider
+// of the dns subdirective of tls.
+type selfProvider struct{}
+
+// Present publishes the TXT record of the challenge for domain.
+func (selfProvider) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := acme.DNS01Record(domain, keyAuth)
+	fqdn = strings.ToLower(fqdn)
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+	challenges[fqdn] = append(challenges[fqdn], challenge{value: value, ttl: uint32(ttl)})
+	return nil
+}
+
+// CleanUp stops publishing the TXT record of the challenge for domain.
+func (selfProvider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := acme.DNS01Record(domain, keyAuth)
+	fqdn = strings.ToLower(fqdn)
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+	published := challenges[fqdn]
+	for i, c := range published {
+		if c.value == value {
+			published = append(published[:i], published[i+1:]...)
+			break
+		}
+	}
+	if len(published) == 0 {
+		delete(challenges, fqdn)
+	} else {
+		challenges[fqdn] = published
+	}
+	return nil
+}
+
+// challengeRecords returns the TXT records of the challenges being
+// published for name.
+func challengeRecords(name string) []dns.RR {
+	challengesMu.RLock()
+	defer challengesMu.RUnlock()
+	var rrs []dns.RR
+	for _, c := range challenges[name] {
+		rrs = append(rrs, &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: c.ttl},
+			Txt: []string{c.value},
+		})
+	}
+	return rrs
+}
@@ -0,0 +1,166 @@
+// Package caddydns implements the dns server type: a minimal
+// authoritative DNS server that serves the zones of its Caddyfile,
+// and publishes the TXT records of the ACME DNS challenges of the
+// same process, so that certificates can be obtained with the DNS
+// challenge without the API of an external DNS provider, such as in
+// lab environments.
+//
+// Each server block of its Caddyfile is a zone, whose origin, and
+// optionally port, is the key:
+//
+//	example.com {
+//		file   db.example.com
+//		record www 300 IN A 192.0.2.1
+//	}
+//
+// The sites of the process use the challenges published by it with
+// "dns self" in their tls directive.
+package caddydns
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyfile"
+)
+
+const serverType = "dns"
+
+// DefaultPort is the default port of DNS servers.
+const DefaultPort = "53"
+
+// Port is the port on which zones are served if not given.
+var Port = DefaultPort
+
+func init() {
+	flag.StringVar(&Port, "dns-port", DefaultPort, "Default port to use for DNS")
+
+	caddy.RegisterServerType(serverType, caddy.ServerType{
+		Directives: func() []string { return directives },
+		DefaultInput: func() caddy.Input {
+			return caddy.CaddyfileInput{ServerTypeName: serverType}
+		},
+		NewContext: newContext,
+	})
+}
+
+// directives is the list of the directives of the dns server type,
+// in the order they are executed.
+var directives = []string{
+	"bind",
+	"file",
+	"record",
+	"tenant",
+}
+
+func newContext() caddy.Context {
+	return &dnsContext{keysToConfigs: make(map[string]*Config)}
+}
+
+// Config is the configuration of a zone.
+type Config struct {
+	Zone *Zone
+
+	// Port is the port the zone is served on.
+	Port string
+
+	// ListenHost is the host the zone is served on; all
+	// interfaces if empty.
+	ListenHost string
+}
+
+type dnsContext struct {
+	// keysToConfigs maps the key of a server block to the
+	// Config of its zone.
+	keysToConfigs map[string]*Config
+
+	// configs is the list of all the configs, in order.
+	configs []*Config
+}
+
+// InspectServerBlocks makes a Config for the zone of each key.
+func (d *dnsContext) InspectServerBlocks(sourceFile string, serverBlocks []caddyfile.ServerBlock) ([]caddyfile.ServerBlock, error) {
+	for _, sb := range serverBlocks {
+		for _, key := range sb.Keys {
+			key = strings.ToLower(key)
+			if _, dup := d.keysToConfigs[key]; dup {
+				return serverBlocks, fmt.Errorf("duplicate zone: %s", key)
+			}
+			origin, port, err := parseKey(key)
+			if err != nil {
+				return serverBlocks, err
+			}
+			cfg := &Config{Zone: NewZone(origin), Port: port}
+			d.configs = append(d.configs, cfg)
+			d.keysToConfigs[key] = cfg
+		}
+	}
+	return serverBlocks, nil
+}
+
+// parseKey parses the key of a server block, which is the origin of
+// a zone, optionally with the port it is served on, as in
+// "example.com:5353" or "dns://example.com".
+func parseKey(key string) (origin, port string, err error) {
+	key = strings.TrimPrefix(key, "dns://")
+	origin, port = key, Port
+	if strings.Contains(key, ":") {
+		if origin, port, err = net.SplitHostPort(key); err != nil {
+			return "", "", fmt.Errorf("invalid zone %s: %v", key, err)
+		}
+		if port == "" {
+			port = Port
+		} else if _, err := strconv.Atoi(port); err != nil {
+			return "", "", fmt.Errorf("invalid zone %s: bad port %s", key, port)
+		}
+	}
+	if _, ok := dns.IsDomainName(origin); !ok || origin == "" || strings.Contains(origin, "/") {
+		return "", "", fmt.Errorf("invalid zone %s: not a domain name", key)
+	}
+	return origin, port, nil
+}
+
+// MakeServers makes a server for each address that zones are
+// served on.
+func (d *dnsContext) MakeServers() ([]caddy.Server, error) {
+	groups := make(map[string][]*Zone)
+	var addrs []string
+	for _, cfg := range d.configs {
+		addr := net.JoinHostPort(cfg.ListenHost, cfg.Port)
+		for _, z := range groups[addr] {
+			if z.Origin == cfg.Zone.Origin {
+				return nil, fmt.Errorf("zone %s is served more than once on %s", z.Origin, addr)
+			}
+		}
+		if _, ok := groups[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+		groups[addr] = append(groups[addr], cfg.Zone)
+	}
+	var servers []caddy.Server
+	for _, addr := range addrs {
+		servers = append(servers, NewServer(addr, groups[addr]))
+	}
+	return servers, nil
+}
+
+// GetConfig gets the Config of the zone that corresponds to c.
+// If none exists (which should only happen in tests), a new one
+// is made for c.Key.
+func GetConfig(c *caddy.Controller) *Config {
+	ctx := c.Context().(*dnsContext)
+	key := strings.ToLower(c.Key)
+	if cfg, ok := ctx.keysToConfigs[key]; ok {
+		return cfg
+	}
+	cfg := &Config{Zone: NewZone(key), Port: Port}
+	ctx.configs = append(ctx.configs, cfg)
+	ctx.keysToConfigs[key] = cfg
+	return cfg
+}
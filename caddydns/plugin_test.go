@@ -0,0 +1,68 @@
+package caddydns
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+func TestParseKey(t *testing.T) {
+	for i, test := range []struct {
+		key, origin, port string
+		shouldErr         bool
+	}{
+		{"example.com", "example.com", DefaultPort, false},
+		{"example.com:5353", "example.com", "5353", false},
+		{"dns://lab.internal", "lab.internal", DefaultPort, false},
+		{"http://example.com", "", "", true},
+		{"example.com:", "example.com", DefaultPort, false},
+		{"", "", "", true},
+	} {
+		origin, port, err := parseKey(test.key)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if origin != test.origin || port != test.port {
+			t.Errorf("Test %d: Expected %s and %s, got %s and %s", i, test.origin, test.port, origin, port)
+		}
+	}
+}
+
+func TestMakeServers(t *testing.T) {
+	ctx := newContext().(*dnsContext)
+	blocks := []caddyfile.ServerBlock{
+		{Keys: []string{"example.com", "example.net"}},
+		{Keys: []string{"lab.internal:5353"}},
+	}
+	if _, err := ctx.InspectServerBlocks("Testfile", blocks); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	servers, err := ctx.MakeServers()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %d", len(servers))
+	}
+	if s := servers[0].(*Server); s.Address() != ":53" || len(s.zones) != 2 {
+		t.Errorf("Expected 2 zones on :53, got %d on %s", len(s.zones), s.Address())
+	}
+	if s := servers[1].(*Server); s.Address() != ":5353" || s.zones[0].Origin != "lab.internal." {
+		t.Errorf("Expected lab.internal. on :5353, got %s on %s", s.zones[0].Origin, s.Address())
+	}
+
+	ctx = newContext().(*dnsContext)
+	if _, err := ctx.InspectServerBlocks("Testfile", []caddyfile.ServerBlock{
+		{Keys: []string{"example.com"}},
+		{Keys: []string{"EXAMPLE.com"}},
+	}); err == nil {
+		t.Error("Expected an error for a duplicate zone, got none")
+	}
+}
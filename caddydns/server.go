@@ -0,0 +1,162 @@
+package caddydns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/mholt/caddy"
+)
+
+// Server serves the zones of a listener address over UDP and TCP.
+type Server struct {
+	addr  string
+	zones []*Zone
+
+	mu         sync.Mutex
+	tcp, udp   *dns.Server
+	listener   net.Listener
+	packetConn net.PacketConn
+}
+
+// ensure it satisfies the interface
+var _ caddy.GracefulServer = new(Server)
+
+// NewServer returns a new Server that will listen on addr and serve
+// zones.
+func NewServer(addr string, zones []*Zone) *Server {
+	now := time.Now()
+	for _, z := range zones {
+		z.ensureSOA(now)
+	}
+	return &Server{addr: addr, zones: zones}
+}
+
+// Address returns the address the server listens on.
+func (s *Server) Address() string {
+	return s.addr
+}
+
+// Listen creates the TCP listener of s.
+func (s *Server) Listen() (net.Listener, error) {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	return ln.(caddy.Listener), nil
+}
+
+// ListenPacket creates the UDP connection of s.
+func (s *Server) ListenPacket() (net.PacketConn, error) {
+	return net.ListenPacket("udp", s.addr)
+}
+
+// Serve answers queries over TCP on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.listener = ln
+	s.tcp = &dns.Server{Listener: ln, Handler: s}
+	s.mu.Unlock()
+	return s.tcp.ActivateAndServe()
+}
+
+// ServePacket answers queries over UDP on pc until it is closed.
+func (s *Server) ServePacket(pc net.PacketConn) error {
+	s.mu.Lock()
+	s.packetConn = pc
+	s.udp = &dns.Server{PacketConn: pc, Handler: s}
+	s.mu.Unlock()
+	return s.udp.ActivateAndServe()
+}
+
+// Stop stops s, letting the queries being answered finish.
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []string
+	for _, srv := range []*dns.Server{s.tcp, s.udp} {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	// the listeners are closed even if they weren't served yet
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("stopping DNS server %s: %s", s.addr, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// OnStartupComplete lists the zones served by s, unless
+// caddy.Quiet is set.
+func (s *Server) OnStartupComplete() {
+	if caddy.Quiet {
+		return
+	}
+	for _, z := range s.zones {
+		output := fmt.Sprintf("dns://%s (%s)", z.Origin, s.addr)
+		fmt.Println(output)
+		log.Println(output)
+	}
+}
+
+// ServeDNS implements dns.Handler; it answers queries of the zones
+// of s authoritatively, and refuses the others.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	if len(r.Question) != 1 || r.Opcode != dns.OpcodeQuery {
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		w.WriteMsg(m)
+		return
+	}
+	m.SetReply(r)
+	q := r.Question[0]
+	z := s.zone(q.Name)
+	if z == nil || q.Qclass != dns.ClassINET && q.Qclass != dns.ClassANY {
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+	m.Authoritative = true
+	z.answer(m, q.Name, q.Qtype)
+
+	size := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil {
+		if opt.UDPSize() > dns.MinMsgSize {
+			size = int(opt.UDPSize())
+		}
+		m.SetEdns0(uint16(size), false)
+	}
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); udp && m.Len() > size {
+		// the client asks again over TCP
+		m.Answer, m.Ns = nil, nil
+		m.Truncated = true
+	}
+	w.WriteMsg(m)
+}
+
+// zone returns the zone of s that name is in, the most specific if
+// there are several, or nil if it is in none.
+func (s *Server) zone(name string) *Zone {
+	name = strings.ToLower(dns.Fqdn(name))
+	var match *Zone
+	for _, z := range s.zones {
+		if dns.IsSubDomain(z.Origin, name) && (match == nil || len(z.Origin) > len(match.Origin)) {
+			match = z
+		}
+	}
+	return match
+}
@@ -0,0 +1,179 @@
+package caddydns
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/xenolf/lego/acme"
+)
+
+// testZone returns the zone of example.com used by the tests.
+func testZone(t *testing.T) *Zone {
+	z := NewZone("example.com")
+	err := z.Parse(strings.NewReader(`
+@      300 IN NS    ns1
+ns1    300 IN A     192.0.2.53
+www    300 IN A     192.0.2.1
+www    300 IN AAAA  2001:db8::1
+alias  300 IN CNAME www
+away   300 IN CNAME example.net.
+a.b.c  300 IN A     192.0.2.2
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func TestServeDNS(t *testing.T) {
+	s := NewServer("127.0.0.1:0", []*Zone{testZone(t), NewZone("sub.example.com")})
+
+	for i, test := range []struct {
+		name     string
+		qtype    uint16
+		rcode    int
+		answers  []uint16 // the types of the answers
+		authSOA  string   // the zone of the SOA in the authority section, if any
+		authAnsw bool
+	}{
+		{"www.example.com.", dns.TypeA, dns.RcodeSuccess, []uint16{dns.TypeA}, "", true},
+		{"WWW.Example.COM.", dns.TypeAAAA, dns.RcodeSuccess, []uint16{dns.TypeAAAA}, "", true},
+		{"www.example.com.", dns.TypeANY, dns.RcodeSuccess, []uint16{dns.TypeA, dns.TypeAAAA}, "", true},
+		{"www.example.com.", dns.TypeMX, dns.RcodeSuccess, nil, "example.com.", true},
+		{"alias.example.com.", dns.TypeA, dns.RcodeSuccess, []uint16{dns.TypeCNAME, dns.TypeA}, "", true},
+		{"alias.example.com.", dns.TypeCNAME, dns.RcodeSuccess, []uint16{dns.TypeCNAME}, "", true},
+		{"away.example.com.", dns.TypeA, dns.RcodeSuccess, []uint16{dns.TypeCNAME}, "", true},
+		{"example.com.", dns.TypeSOA, dns.RcodeSuccess, []uint16{dns.TypeSOA}, "", true},
+		{"example.com.", dns.TypeNS, dns.RcodeSuccess, []uint16{dns.TypeNS}, "", true},
+		{"b.c.example.com.", dns.TypeA, dns.RcodeSuccess, nil, "example.com.", true},
+		{"missing.example.com.", dns.TypeA, dns.RcodeNameError, nil, "example.com.", true},
+		{"x.sub.example.com.", dns.TypeA, dns.RcodeNameError, nil, "sub.example.com.", true},
+		{"example.net.", dns.TypeA, dns.RcodeRefused, nil, "", false},
+	} {
+		m := new(dns.Msg)
+		m.SetQuestion(test.name, test.qtype)
+		w := &testWriter{}
+		s.ServeDNS(w, m)
+		r := w.msg
+		if r == nil {
+			t.Errorf("Test %d: Expected a reply", i)
+			continue
+		}
+		if r.Rcode != test.rcode {
+			t.Errorf("Test %d: Expected rcode %s, got %s", i, dns.RcodeToString[test.rcode], dns.RcodeToString[r.Rcode])
+		}
+		if r.Authoritative != test.authAnsw {
+			t.Errorf("Test %d: Expected authoritative %v, got %v", i, test.authAnsw, r.Authoritative)
+		}
+		if len(r.Answer) != len(test.answers) {
+			t.Errorf("Test %d: Expected %d answers, got %v", i, len(test.answers), r.Answer)
+			continue
+		}
+		for j, rr := range r.Answer {
+			if rr.Header().Rrtype != test.answers[j] {
+				t.Errorf("Test %d: Expected answer %d to be of type %s, got %v", i, j, dns.TypeToString[test.answers[j]], rr)
+			}
+		}
+		if test.authSOA != "" {
+			if len(r.Ns) != 1 || r.Ns[0].Header().Name != test.authSOA {
+				t.Errorf("Test %d: Expected the SOA of %s in the authority section, got %v", i, test.authSOA, r.Ns)
+			}
+		} else if len(r.Ns) != 0 {
+			t.Errorf("Test %d: Expected no authority section, got %v", i, r.Ns)
+		}
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	s := NewServer("127.0.0.1:0", []*Zone{testZone(t)})
+	query := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("_acme-challenge.www.example.com.", dns.TypeTXT)
+		w := &testWriter{}
+		s.ServeDNS(w, m)
+		return w.msg
+	}
+
+	if r := query(); r.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected %s before the challenge, got %s", dns.RcodeToString[dns.RcodeNameError], dns.RcodeToString[r.Rcode])
+	}
+
+	var p selfProvider
+	if err := p.Present("www.example.com", "token", "keyauth1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Present("WWW.example.com", "token", "keyauth2"); err != nil {
+		t.Fatal(err)
+	}
+	_, value, _ := acme.DNS01Record("www.example.com", "keyauth1")
+	r := query()
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 2 {
+		t.Fatalf("Expected 2 TXT records, got %s %v", dns.RcodeToString[r.Rcode], r.Answer)
+	}
+	if txt := r.Answer[0].(*dns.TXT); txt.Txt[0] != value {
+		t.Errorf("Expected TXT record %s, got %s", value, txt.Txt[0])
+	}
+
+	p.CleanUp("www.example.com", "token", "keyauth1")
+	if r := query(); len(r.Answer) != 1 {
+		t.Errorf("Expected 1 TXT record after cleaning up one, got %v", r.Answer)
+	}
+	p.CleanUp("www.example.com", "token", "keyauth2")
+	if r := query(); r.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected %s after cleaning up, got %v", dns.RcodeToString[dns.RcodeNameError], r)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer("127.0.0.1:0", []*Zone{testZone(t)})
+	ln, err := s.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := s.ListenPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	go s.ServePacket(pc)
+
+	for _, test := range []struct {
+		net, addr string
+	}{
+		{"udp", pc.LocalAddr().String()},
+		{"tcp", ln.Addr().String()},
+	} {
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.com.", dns.TypeA)
+		c := &dns.Client{Net: test.net}
+		r, _, err := c.Exchange(m, test.addr)
+		if err != nil {
+			t.Errorf("%s: Expected no error, got: %v", test.net, err)
+			continue
+		}
+		if len(r.Answer) != 1 || !r.Answer[0].(*dns.A).A.Equal(net.ParseIP("192.0.2.1")) {
+			t.Errorf("%s: Expected 192.0.2.1, got %v", test.net, r.Answer)
+		}
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Errorf("Expected no error stopping, got: %v", err)
+	}
+}
+
+// testWriter is a dns.ResponseWriter that keeps the reply.
+type testWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *testWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *testWriter) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
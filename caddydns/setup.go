@@ -0,0 +1,86 @@
+package caddydns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("bind", caddy.Plugin{ServerType: serverType, Action: setupBind})
+	caddy.RegisterPlugin("file", caddy.Plugin{ServerType: serverType, Action: setupFile})
+	caddy.RegisterPlugin("record", caddy.Plugin{ServerType: serverType, Action: setupRecord})
+}
+
+// setupBind sets the host that the zone is served on:
+//
+//	bind host
+func setupBind(c *caddy.Controller) error {
+	cfg := GetConfig(c)
+	for c.Next() {
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		cfg.ListenHost = c.Val()
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	}
+	return nil
+}
+
+// setupFile adds the records of zone files to the zone:
+//
+//	file path
+//
+// where the path is relative to the folder of the Caddyfile.
+func setupFile(c *caddy.Controller) error {
+	cfg := GetConfig(c)
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		file := args[0]
+		if !filepath.IsAbs(file) && c.File() != "" {
+			file = filepath.Join(filepath.Dir(c.File()), file)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return c.Errf("Reading zone file: %v", err)
+		}
+		err = cfg.Zone.Parse(f, file)
+		f.Close()
+		if err != nil {
+			return c.Errf("Invalid zone file: %v", err)
+		}
+	}
+	return nil
+}
+
+// setupRecord adds a record to the zone:
+//
+//	record name [ttl] [class] type data...
+//
+// as in a zone file, where the name is relative to the zone.
+func setupRecord(c *caddy.Controller) error {
+	cfg := GetConfig(c)
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 3 {
+			return c.ArgErr()
+		}
+		for i, arg := range args {
+			// the Caddyfile took the quotes off strings, such as of TXT records
+			if strings.ContainsAny(arg, " \t") {
+				args[i] = `"` + strings.Replace(arg, `"`, `\"`, -1) + `"`
+			}
+		}
+		if err := cfg.Zone.Parse(strings.NewReader(strings.Join(args, " ")), c.File()); err != nil {
+			return c.Errf("Invalid record: %v", err)
+		}
+	}
+	return nil
+}
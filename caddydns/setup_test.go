@@ -0,0 +1,109 @@
+package caddydns
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/mholt/caddy"
+)
+
+func TestSetupRecord(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		owner     string
+		rrtype    uint16
+	}{
+		{`record www 300 IN A 192.0.2.1`, false, "www.example.com.", dns.TypeA},
+		{`record @ MX 10 mail`, false, "example.com.", dns.TypeMX},
+		{`record @ TXT "v=spf1 -all"`, false, "example.com.", dns.TypeTXT},
+		{`record mail.example.com. AAAA 2001:db8::1`, false, "mail.example.com.", dns.TypeAAAA},
+		{`record @ SOA ns1 hostmaster 1 3600 600 86400 60`, false, "", dns.TypeSOA},
+		{`record www A`, true, "", 0},
+		{`record www A not-an-ip`, true, "", 0},
+		{`record www.example.net. A 192.0.2.1`, true, "", 0},
+	} {
+		c := caddy.NewTestController(serverType, test.input)
+		c.Key = "example.com"
+		err := setupRecord(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		z := GetConfig(c).Zone
+		if test.rrtype == dns.TypeSOA {
+			if z.SOA == nil || z.SOA.Ns != "ns1.example.com." {
+				t.Errorf("Test %d: Expected the SOA to be set, got %v", i, z.SOA)
+			}
+			continue
+		}
+		rrs := z.records[test.owner]
+		if len(rrs) != 1 || rrs[0].Header().Rrtype != test.rrtype {
+			t.Errorf("Test %d: Expected a record of type %d at %s, got %v", i, test.rrtype, test.owner, rrs)
+		}
+		if txt, ok := rrs[0].(*dns.TXT); ok && (len(txt.Txt) != 1 || txt.Txt[0] != "v=spf1 -all") {
+			t.Errorf("Test %d: Expected one string in the TXT record, got %q", i, txt.Txt)
+		}
+	}
+}
+
+func TestSetupFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddydns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	zoneFile := filepath.Join(dir, "db.example.com")
+	if err := ioutil.WriteFile(zoneFile, []byte("$TTL 300\n@ IN NS ns1\nns1 IN A 192.0.2.53\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	badFile := filepath.Join(dir, "db.bad")
+	if err := ioutil.WriteFile(badFile, []byte("@ IN BOGUS x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController(serverType, `file `+zoneFile)
+	c.Key = "example.com"
+	if err := setupFile(c); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	z := GetConfig(c).Zone
+	if len(z.records["example.com."]) != 1 || len(z.records["ns1.example.com."]) != 1 {
+		t.Errorf("Expected the records of the zone file, got %v", z.records)
+	}
+
+	for i, input := range []string{
+		`file`,
+		`file ` + badFile,
+		`file ` + filepath.Join(dir, "missing"),
+	} {
+		c := caddy.NewTestController(serverType, input)
+		c.Key = "example.com"
+		if err := setupFile(c); err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		}
+	}
+}
+
+func TestSetupBind(t *testing.T) {
+	c := caddy.NewTestController(serverType, `bind 127.0.0.1`)
+	if err := setupBind(c); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if host := GetConfig(c).ListenHost; host != "127.0.0.1" {
+		t.Errorf("Expected ListenHost 127.0.0.1, got '%s'", host)
+	}
+	if err := setupBind(caddy.NewTestController(serverType, `bind`)); err == nil {
+		t.Error("Expected an error, got none")
+	}
+}
@@ -0,0 +1,149 @@
+package caddydns
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain limits how many CNAMEs are followed in a zone.
+const maxCNAMEChain = 8
+
+// Zone is a zone of which the server is authoritative.
+type Zone struct {
+	// Origin is the fully-qualified, lower-case name of the zone.
+	Origin string
+
+	// SOA is the start of authority of the zone; one is made up
+	// for zones that don't have their own.
+	SOA *dns.SOA
+
+	// records are the records of the zone, by lower-case owner.
+	records map[string][]dns.RR
+}
+
+// NewZone returns an empty zone with the given origin.
+func NewZone(origin string) *Zone {
+	return &Zone{Origin: strings.ToLower(dns.Fqdn(origin)), records: make(map[string][]dns.RR)}
+}
+
+// Parse adds the records in r, in the format of a zone file, in
+// which names are relative to the origin of z. The file is the name
+// of r in errors.
+func (z *Zone) Parse(r io.Reader, file string) error {
+	for token := range dns.ParseZone(r, z.Origin, file) {
+		if token.Error != nil {
+			return token.Error
+		}
+		if err := z.Add(token.RR); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// Add adds rr to z; its owner must be in the zone.
+func (z *Zone) Add(rr dns.RR) error {
+	hdr := rr.Header()
+	name := strings.ToLower(hdr.Name)
+	if !dns.IsSubDomain(z.Origin, name) {
+		return fmt.Errorf("%s is not in zone %s", hdr.Name, z.Origin)
+	}
+	if soa, ok := rr.(*dns.SOA); ok {
+		if name != z.Origin {
+			return fmt.Errorf("SOA of %s is not at the apex of zone %s", hdr.Name, z.Origin)
+		}
+		z.SOA = soa
+		return nil
+	}
+	z.records[name] = append(z.records[name], rr)
+	return nil
+}
+
+// ensureSOA makes up an SOA for z if it doesn't have one, with the
+// serial number of now.
+func (z *Zone) ensureSOA(now time.Time) {
+	if z.SOA != nil {
+		return
+	}
+	z.SOA = &dns.SOA{
+		Hdr:     dns.RR_Header{Name: z.Origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Ns:      "ns." + z.Origin,
+		Mbox:    "hostmaster." + z.Origin,
+		Serial:  uint32(now.Unix()),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  60,
+	}
+}
+
+// answer fills in m, the reply to a question of the name and type,
+// with the records of z and the challenges being published in it.
+func (z *Zone) answer(m *dns.Msg, name string, qtype uint16) {
+	name = strings.ToLower(name)
+	for i := 0; i < maxCNAMEChain; i++ {
+		rrs := z.lookup(name)
+		if len(rrs) == 0 {
+			if i == 0 && !z.exists(name) {
+				m.Rcode = dns.RcodeNameError
+			}
+			break
+		}
+		var matched []dns.RR
+		var cname *dns.CNAME
+		for _, rr := range rrs {
+			if c, ok := rr.(*dns.CNAME); ok && qtype != dns.TypeCNAME {
+				cname = c
+			}
+			if qtype == dns.TypeANY || rr.Header().Rrtype == qtype {
+				matched = append(matched, rr)
+			}
+		}
+		if len(matched) == 0 && cname != nil {
+			m.Answer = append(m.Answer, cname)
+			name = strings.ToLower(cname.Target)
+			if dns.IsSubDomain(z.Origin, name) {
+				continue
+			}
+			return // the resolver follows it from here
+		}
+		m.Answer = append(m.Answer, matched...)
+		break
+	}
+	if len(m.Answer) == 0 || m.Rcode == dns.RcodeNameError {
+		m.Ns = append(m.Ns, dns.Copy(z.SOA))
+	}
+}
+
+// lookup returns copies of the records of name, including the TXT records of
+// the challenges being published for it.
+func (z *Zone) lookup(name string) []dns.RR {
+	var rrs []dns.RR
+	if name == z.Origin {
+		rrs = append(rrs, dns.Copy(z.SOA))
+	}
+	// copies, since packing a record writes to it
+	for _, rr := range z.records[name] {
+		rrs = append(rrs, dns.Copy(rr))
+	}
+	return append(rrs, challengeRecords(name)...)
+}
+
+// exists returns whether name is in z, even if it has no records of
+// its own but names below it do.
+func (z *Zone) exists(name string) bool {
+	if name == z.Origin {
+		return true
+	}
+	suffix := "." + name
+	for owner := range z.records {
+		if strings.HasSuffix(owner, suffix) {
+			return true
+		}
+	}
+	return false
+}
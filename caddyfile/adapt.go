@@ -0,0 +1,48 @@
+package caddyfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Adapt converts the contents of a config file to Caddyfile
+// text according to the file's extension: .json files are
+// converted with FromJSON, and .yaml or .yml files with
+// FromYAML. The contents of any other file are assumed to be
+// a Caddyfile and are returned unchanged. Files with the .tmpl
+// extension, or any file if Templates is set, are expanded with
+// ExpandTemplate first, and then adapted by the extension before.
+func Adapt(filename string, contents []byte) ([]byte, error) {
+	if isTemplate := strings.EqualFold(filepath.Ext(filename), templateExt); isTemplate || Templates {
+		var err error
+		contents, err = ExpandTemplate(filepath.Base(filename), contents)
+		if err != nil {
+			return nil, err
+		}
+		if isTemplate {
+			filename = filename[:len(filename)-len(templateExt)]
+		}
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return FromJSON(contents)
+	case ".yaml", ".yml":
+		return FromYAML(contents)
+	}
+	return contents, nil
+}
+
+// Convert converts caddyfile to the named format, which
+// may be "json", "yaml" or "caddyfile".
+func Convert(caddyfile []byte, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "json":
+		return ToJSON(caddyfile)
+	case "yaml", "yml":
+		return ToYAML(caddyfile)
+	case "caddyfile":
+		return caddyfile, nil
+	}
+	return nil, fmt.Errorf("unknown config format '%s'", format)
+}
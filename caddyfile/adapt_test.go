@@ -0,0 +1,66 @@
+package caddyfile
+
+import "testing"
+
+func TestAdapt(t *testing.T) {
+	caddyfile := "host {\n\tdir a\n}"
+	for i, test := range []struct {
+		filename string
+		contents string
+	}{
+		{"Caddyfile", caddyfile},
+		{"site.conf", caddyfile},
+		{"caddy.json", `[{"keys":["host"],"body":[["dir","a"]]}]`},
+		{"caddy.JSON", `[{"keys":["host"],"body":[["dir","a"]]}]`},
+		{"caddy.yaml", "- keys: [host]\n  body: [[dir, a]]"},
+		{"caddy.yml", "- keys: [host]\n  body: [[dir, a]]"},
+		{"Caddyfile.tmpl", "{{\"host\"}} {\n\tdir a\n}"},
+		{"caddy.yaml.tmpl", "- keys: [{{\"host\"}}]\n  body: [[dir, a]]"},
+	} {
+		output, err := Adapt(test.filename, []byte(test.contents))
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if string(output) != caddyfile {
+			t.Errorf("Test %d: Expected:\n'%s'\nActual:\n'%s'", i, caddyfile, string(output))
+		}
+	}
+
+	if _, err := Adapt("caddy.json", []byte("host {")); err == nil {
+		t.Error("Expected an error for invalid JSON, got none")
+	}
+	if _, err := Adapt("Caddyfile.tmpl", []byte("{{host")); err == nil {
+		t.Error("Expected an error for an invalid template, got none")
+	}
+
+	// any file is a template if Templates is set
+	Templates = true
+	defer func() { Templates = false }()
+	output, err := Adapt("Caddyfile", []byte("{{\"host\"}} {\n\tdir a\n}"))
+	if err != nil || string(output) != caddyfile {
+		t.Errorf("Expected template to be expanded to:\n'%s'\nActual:\n'%s' (%v)", caddyfile, output, err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	caddyfile := []byte("host {\n\tdir a\n}")
+	for _, format := range []string{"json", "yaml", "caddyfile"} {
+		output, err := Convert(caddyfile, format)
+		if err != nil {
+			t.Errorf("Format %s: Expected no error, got: %v", format, err)
+			continue
+		}
+		back, err := Adapt("Caddyfile."+format, output)
+		if err != nil {
+			t.Errorf("Format %s: Expected no error converting back, got: %v", format, err)
+		}
+		if string(back) != string(caddyfile) {
+			t.Errorf("Format %s: Expected round trip to give:\n'%s'\nActual:\n'%s'", format, caddyfile, back)
+		}
+	}
+
+	if _, err := Convert(caddyfile, "toml"); err == nil {
+		t.Error("Expected an error for unknown format, got none")
+	}
+}
@@ -1,7 +1,6 @@
 package caddyfile
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -61,6 +60,7 @@ func (d *Dispenser) NextArg() bool {
 	}
 	if d.cursor < len(d.tokens)-1 &&
 		d.tokens[d.cursor].File == d.tokens[d.cursor+1].File &&
+		d.tokens[d.cursor].expansion == d.tokens[d.cursor+1].expansion &&
 		d.tokens[d.cursor].Line+d.numLineBreaks(d.cursor) == d.tokens[d.cursor+1].Line {
 		d.cursor++
 		return true
@@ -82,6 +82,7 @@ func (d *Dispenser) NextLine() bool {
 	}
 	if d.cursor < len(d.tokens)-1 &&
 		(d.tokens[d.cursor].File != d.tokens[d.cursor+1].File ||
+			d.tokens[d.cursor].expansion != d.tokens[d.cursor+1].expansion ||
 			d.tokens[d.cursor].Line+d.numLineBreaks(d.cursor) < d.tokens[d.cursor+1].Line) {
 		d.cursor++
 		return true
@@ -138,6 +139,15 @@ func (d *Dispenser) Line() int {
 	return d.tokens[d.cursor].Line
 }
 
+// Column gets the column number, counted in characters from 1, of the
+// current token. If there is no token loaded, it returns 0.
+func (d *Dispenser) Column() int {
+	if d.cursor < 0 || d.cursor >= len(d.tokens) {
+		return 0
+	}
+	return d.tokens[d.cursor].Column
+}
+
 // File gets the filename of the current token. If there is no token loaded,
 // it returns the filename originally given when parsing started.
 func (d *Dispenser) File() string {
@@ -200,8 +210,8 @@ func (d *Dispenser) ArgErr() error {
 // SyntaxErr creates a generic syntax error which explains what was
 // found and what was expected.
 func (d *Dispenser) SyntaxErr(expected string) error {
-	msg := fmt.Sprintf("%s:%d - Syntax error: Unexpected token '%s', expecting '%s'", d.File(), d.Line(), d.Val(), expected)
-	return errors.New(msg)
+	msg := fmt.Sprintf("Syntax error: Unexpected token '%s', expecting '%s'", d.Val(), expected)
+	return d.errorAt(msg)
 }
 
 // EOFErr returns an error indicating that the dispenser reached
@@ -212,8 +222,7 @@ func (d *Dispenser) EOFErr() error {
 
 // Err generates a custom parse-time error with a message of msg.
 func (d *Dispenser) Err(msg string) error {
-	msg = fmt.Sprintf("%s:%d - Error during parsing: %s", d.File(), d.Line(), msg)
-	return errors.New(msg)
+	return d.errorAt("Error during parsing: " + msg)
 }
 
 // Errf is like Err, but for formatted error messages
@@ -221,6 +230,25 @@ func (d *Dispenser) Errf(format string, args ...interface{}) error {
 	return d.Err(fmt.Sprintf(format, args...))
 }
 
+// errorAt returns an Error with the given message at the
+// position of the current token.
+func (d *Dispenser) errorAt(msg string) error {
+	return Error{File: d.File(), Line: d.Line(), Column: d.Column(), Message: msg}
+}
+
+// Error is an error at a position in a Caddyfile.
+type Error struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error implements the error interface.
+func (e Error) Error() string {
+	return fmt.Sprintf("%s:%d - %s", e.File, e.Line, e.Message)
+}
+
 // numLineBreaks counts how many line breaks are in the token
 // value given by the token index tknIdx. It returns 0 if the
 // token does not exist or there are no line breaks.
@@ -242,5 +270,6 @@ func (d *Dispenser) isNewLine() bool {
 		return false
 	}
 	return d.tokens[d.cursor-1].File != d.tokens[d.cursor].File ||
+		d.tokens[d.cursor-1].expansion != d.tokens[d.cursor].expansion ||
 		d.tokens[d.cursor-1].Line+d.numLineBreaks(d.cursor-1) < d.tokens[d.cursor].Line
 }
@@ -13,6 +13,21 @@ const filename = "Caddyfile"
 
 // ToJSON converts caddyfile to its JSON representation.
 func ToJSON(caddyfile []byte) ([]byte, error) {
+	j, err := encode(caddyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// encode converts caddyfile to its encodable structure.
+func encode(caddyfile []byte) (EncodedCaddyfile, error) {
 	var j EncodedCaddyfile
 
 	serverBlocks, err := Parse(filename, bytes.NewReader(caddyfile), nil)
@@ -45,12 +60,7 @@ func ToJSON(caddyfile []byte) ([]byte, error) {
 		j = append(j, block)
 	}
 
-	result, err := json.Marshal(j)
-	if err != nil {
-		return nil, err
-	}
-
-	return result, nil
+	return j, nil
 }
 
 // constructLine transforms tokens into a JSON-encodable structure;
@@ -92,13 +102,19 @@ func constructBlock(d *Dispenser) [][]interface{} {
 // FromJSON converts JSON-encoded jsonBytes to Caddyfile text
 func FromJSON(jsonBytes []byte) ([]byte, error) {
 	var j EncodedCaddyfile
-	var result string
 
 	err := json.Unmarshal(jsonBytes, &j)
 	if err != nil {
 		return nil, err
 	}
 
+	return decode(j), nil
+}
+
+// decode converts j to Caddyfile text.
+func decode(j EncodedCaddyfile) []byte {
+	var result string
+
 	for sbPos, sb := range j {
 		if sbPos > 0 {
 			result += "\n\n"
@@ -113,7 +129,7 @@ func FromJSON(jsonBytes []byte) ([]byte, error) {
 		result += jsonToText(sb.Body, 1)
 	}
 
-	return []byte(result), nil
+	return []byte(result)
 }
 
 // jsonToText recursively transforms a scope of JSON into plain
@@ -123,7 +139,7 @@ func jsonToText(scope interface{}, depth int) string {
 
 	switch val := scope.(type) {
 	case string:
-		if strings.ContainsAny(val, "\" \n\t\r") {
+		if val == "" || strings.ContainsAny(val, "\" \n\t\r") {
 			result += `"` + strings.Replace(val, "\"", "\\\"", -1) + `"`
 		} else {
 			result += val
@@ -179,6 +195,6 @@ type EncodedCaddyfile []EncodedServerBlock
 
 // EncodedServerBlock represents a server block ripe for encoding.
 type EncodedServerBlock struct {
-	Keys []string        `json:"keys"`
-	Body [][]interface{} `json:"body"`
+	Keys []string        `json:"keys" yaml:"keys"`
+	Body [][]interface{} `json:"body" yaml:"body"`
 }
@@ -15,13 +15,21 @@ type (
 		reader *bufio.Reader
 		token  Token
 		line   int
+		column int
 	}
 
 	// Token represents a single parsable unit.
 	Token struct {
-		File string
-		Line int
-		Text string
+		File   string
+		Line   int
+		Column int
+		Text   string
+
+		// expansion identifies the import that brought
+		// the token in, so that tokens from different
+		// imports are never considered to be on the
+		// same line; 0 for tokens that weren't imported.
+		expansion int
 	}
 )
 
@@ -76,6 +84,7 @@ func (l *lexer) next() bool {
 			}
 			panic(err)
 		}
+		l.column++
 
 		if quoted {
 			if !escaped {
@@ -89,6 +98,7 @@ func (l *lexer) next() bool {
 			}
 			if ch == '\n' {
 				l.line++
+				l.column = 0
 			}
 			if escaped {
 				// only escape quotes
@@ -107,6 +117,7 @@ func (l *lexer) next() bool {
 			}
 			if ch == '\n' {
 				l.line++
+				l.column = 0
 				comment = false
 			}
 			if len(val) > 0 {
@@ -124,7 +135,7 @@ func (l *lexer) next() bool {
 		}
 
 		if len(val) == 0 {
-			l.token = Token{Line: l.line}
+			l.token = Token{Line: l.line, Column: l.column}
 			if ch == '"' {
 				quoted = true
 				continue
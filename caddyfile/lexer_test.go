@@ -169,3 +169,28 @@ func lexerCompare(t *testing.T, n int, expected, actual []Token) {
 		}
 	}
 }
+
+func TestLexerColumns(t *testing.T) {
+	tokens := tokenize("host {\n\tdir  \"a\nb\" c\n  d\n}")
+	expected := []struct {
+		text         string
+		line, column int
+	}{
+		{"host", 1, 1},
+		{"{", 1, 6},
+		{"dir", 2, 2},
+		{"a\nb", 2, 7},
+		{"c", 3, 4},
+		{"d", 4, 3},
+		{"}", 5, 1},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+	for i, e := range expected {
+		if tokens[i].Text != e.text || tokens[i].Line != e.line || tokens[i].Column != e.column {
+			t.Errorf("Token %d: expected '%s' at %d:%d, got '%s' at %d:%d",
+				i, e.text, e.line, e.column, tokens[i].Text, tokens[i].Line, tokens[i].Column)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package caddyfile
 
 import (
+	"bytes"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -37,11 +41,17 @@ func allTokens(input io.Reader) ([]Token, error) {
 
 type parser struct {
 	Dispenser
-	block           ServerBlock // current server block being parsed
-	validDirectives []string    // a directive must be valid or it's an error
-	eof             bool        // if we encounter a valid EOF in a hard place
+	block           ServerBlock        // current server block being parsed
+	validDirectives []string           // a directive must be valid or it's an error
+	eof             bool               // if we encounter a valid EOF in a hard place
+	snippets        map[string][]Token // snippets defined so far, by name
+	importDepths    []int              // import nesting depth of each token expansion
 }
 
+// maxImportDepth limits how deeply imports may be nested,
+// which stops import cycles.
+const maxImportDepth = 20
+
 func (p *parser) parseAll() ([]ServerBlock, error) {
 	var blocks []ServerBlock
 
@@ -75,6 +85,10 @@ func (p *parser) begin() error {
 		return err
 	}
 
+	if len(p.block.Keys) == 1 && isSnippet(p.block.Keys[0]) {
+		return p.defineSnippet(p.block.Keys[0][1 : len(p.block.Keys[0])-1])
+	}
+
 	if p.eof {
 		// this happens if the Caddyfile consists of only
 		// a line of addresses and nothing else
@@ -88,7 +102,10 @@ func (p *parser) addresses() error {
 	var expectingAnother bool
 
 	for {
-		tkn := replaceEnvVars(p.Val())
+		tkn, err := p.replaceEnvVars(p.Val())
+		if err != nil {
+			return err
+		}
 
 		// special case: import directive replaces tokens during parse-time
 		if tkn == "import" && p.isNewLine() {
@@ -189,30 +206,146 @@ func (p *parser) directives() error {
 	return nil
 }
 
-// doImport swaps out the import directive and its argument
-// (a total of 2 tokens) with the tokens in the specified file
-// or globbing pattern. When the function returns, the cursor
-// is on the token before where the import directive was. In
-// other words, call Next() to access the first token that was
-// imported.
+// isSnippet returns true if key, the only key of a server
+// block, names a snippet rather than an address: (name).
+func isSnippet(key string) bool {
+	return len(key) > 2 && key[0] == '(' && key[len(key)-1] == ')'
+}
+
+// defineSnippet collects the tokens in the block that follows
+// the snippet's name, so they can be imported later. The block
+// is not a server block, so no keys are left in p.block.
+func (p *parser) defineSnippet(name string) error {
+	if p.eof || p.Val() != "{" {
+		return p.SyntaxErr("{")
+	}
+	if _, ok := p.snippets[name]; ok {
+		return p.Errf("Redefinition of snippet '%s'", name)
+	}
+
+	var tokens []Token
+	nesting := 1
+	for p.Next() {
+		if p.Val() == "{" {
+			nesting++
+		} else if p.Val() == "}" {
+			if nesting--; nesting == 0 {
+				break
+			}
+		}
+		tokens = append(tokens, p.tokens[p.cursor])
+	}
+	if nesting > 0 {
+		return p.EOFErr()
+	}
+
+	if p.snippets == nil {
+		p.snippets = make(map[string][]Token)
+	}
+	p.snippets[name] = tokens
+	p.block.Keys = nil
+	return nil
+}
+
+// snippetArg matches a reference to an import argument in a snippet.
+var snippetArg = regexp.MustCompile(`\{args\.(\d+)\}`)
+
+// expandSnippet returns a copy of the snippet's tokens with
+// {args.N} replaced by the Nth argument. References to missing
+// arguments are replaced by empty strings.
+func expandSnippet(snippet []Token, args []string) []Token {
+	tokens := make([]Token, len(snippet))
+	for i, token := range snippet {
+		token.Text = snippetArg.ReplaceAllStringFunc(token.Text, func(ref string) string {
+			n, err := strconv.Atoi(snippetArg.FindStringSubmatch(ref)[1])
+			if err != nil || n >= len(args) {
+				return ""
+			}
+			return args[n]
+		})
+		tokens[i] = token
+	}
+	return tokens
+}
+
+// importDepth returns the number of imports that token
+// was brought in through.
+func (p *parser) importDepth(token Token) int {
+	if token.expansion < len(p.importDepths) {
+		return p.importDepths[token.expansion]
+	}
+	return 0
+}
+
+// doImport swaps out the import directive and its arguments
+// with the tokens of the named snippet, or of the specified file
+// or globbing pattern. Files matching a pattern are imported in
+// lexical order. When the function returns, the cursor is on
+// the first token that was imported.
 func (p *parser) doImport() error {
+	importIndex := p.cursor
+	depth := p.importDepth(p.tokens[importIndex])
+	if depth >= maxImportDepth {
+		return p.Errf("Imports nested more than %d deep (is there an import cycle?)", maxImportDepth)
+	}
+
 	// syntax checks
 	if !p.NextArg() {
 		return p.ArgErr()
 	}
-	importPattern := replaceEnvVars(p.Val())
+	importPattern, err := p.replaceEnvVars(p.Val())
+	if err != nil {
+		return err
+	}
 	if importPattern == "" {
 		return p.Err("Import requires a non-empty filepath")
 	}
-	if p.NextArg() {
-		return p.Err("Import takes only one argument (glob pattern or file)")
+	var args []string
+	for p.NextArg() {
+		arg, err := p.replaceEnvVars(p.Val())
+		if err != nil {
+			return err
+		}
+		args = append(args, arg)
+	}
+
+	var importedTokens []Token
+	if snippet, ok := p.snippets[importPattern]; ok {
+		importedTokens = expandSnippet(snippet, args)
+	} else if len(args) > 0 {
+		return p.Err("Import takes only one argument (glob pattern or file); only snippets take arguments")
+	} else if importedTokens, err = p.importFiles(importPattern); err != nil {
+		return err
+	}
+
+	// mark the imported tokens as a new expansion one level deeper
+	if p.importDepths == nil {
+		p.importDepths = []int{0}
+	}
+	expansion := len(p.importDepths)
+	p.importDepths = append(p.importDepths, depth+1)
+	for i := range importedTokens {
+		importedTokens[i].expansion = expansion
 	}
 
+	// splice the imported tokens in the place of the import
+	// directive and its arguments, and put the cursor on the
+	// first imported token
+	tokensBefore := p.tokens[:importIndex]
+	tokensAfter := p.tokens[p.cursor+1:]
+	p.tokens = append(tokensBefore, append(importedTokens, tokensAfter...)...)
+	p.cursor = importIndex
+
+	return nil
+}
+
+// importFiles returns the tokens of the files matching importPattern.
+func (p *parser) importFiles(importPattern string) ([]Token, error) {
 	// make path relative to Caddyfile rather than current working directory (issue #867)
 	// and then use glob to get list of matching filenames
 	absFile, err := filepath.Abs(p.Dispenser.filename)
 	if err != nil {
-		return p.Errf("Failed to get absolute path of file: %s", p.Dispenser.filename)
+		return nil, p.Errf("Failed to get absolute path of file: %s", p.Dispenser.filename)
 	}
 
 	var matches []string
@@ -225,27 +358,28 @@ func (p *parser) doImport() error {
 	matches, err = filepath.Glob(globPattern)
 
 	if err != nil {
-		return p.Errf("Failed to use import pattern %s: %v", importPattern, err)
+		return nil, p.Errf("Failed to use import pattern %s: %v", importPattern, err)
 	}
 	if len(matches) == 0 {
 		if strings.Contains(globPattern, "*") {
 			log.Printf("[WARNING] No files matching import pattern: %s", importPattern)
 		} else {
-			return p.Errf("File to import not found: %s", importPattern)
+			return nil, p.Errf("File to import not found: %s", importPattern)
 		}
 	}
 
-	// splice out the import directive and its argument (2 tokens total)
-	tokensBefore := p.tokens[:p.cursor-1]
-	tokensAfter := p.tokens[p.cursor+1:]
+	// guarantee the order in which files are imported, since
+	// it determines the order of server blocks and directives
+	sort.Strings(matches)
 
 	// collect all the imported tokens
 	var importedTokens []Token
 	for _, importFile := range matches {
 		newTokens, err := p.doSingleImport(importFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		p.block.Imports = append(p.block.Imports, importFile)
 		var importLine int
 		importDir := filepath.Dir(importFile)
 		for i, token := range newTokens {
@@ -272,12 +406,7 @@ func (p *parser) doImport() error {
 		importedTokens = append(importedTokens, newTokens...)
 	}
 
-	// splice the imported tokens in the place of the import statement
-	// and rewind cursor so Next() will land on first imported token
-	p.tokens = append(tokensBefore, append(importedTokens, tokensAfter...)...)
-	p.cursor--
-
-	return nil
+	return importedTokens, nil
 }
 
 // doSingleImport lexes the individual file at importFile and returns
@@ -338,7 +467,11 @@ func (p *parser) directive() error {
 		} else if p.Val() == "}" && nesting == 0 {
 			return p.Err("Unexpected '}' because no matching opening brace")
 		}
-		p.tokens[p.cursor].Text = replaceEnvVars(p.tokens[p.cursor].Text)
+		text, err := p.replaceEnvVars(p.tokens[p.cursor].Text)
+		if err != nil {
+			return err
+		}
+		p.tokens[p.cursor].Text = text
 		p.block.Tokens[dir] = append(p.block.Tokens[dir], p.tokens[p.cursor])
 	}
 
@@ -383,29 +516,64 @@ func (p *parser) validDirective(dir string) bool {
 	return false
 }
 
+// StrictEnv, if true, makes it an error for the Caddyfile
+// to refer to an environment variable that is not set and
+// has no default value.
+var StrictEnv bool
+
+// replaceEnvVars replaces the environment variables in s, and
+// returns an error if StrictEnv is set and any of them are unset.
+func (p *parser) replaceEnvVars(s string) (string, error) {
+	s, unset := replaceEnvVars(s)
+	if StrictEnv && len(unset) > 0 {
+		return s, p.Errf("Environment variable '%s' is not set", unset[0])
+	}
+	return s, nil
+}
+
 // replaceEnvVars replaces environment variables that appear in the token
-// and understands both the $UNIX and %WINDOWS% syntaxes.
-func replaceEnvVars(s string) string {
-	s = replaceEnvReferences(s, "{%", "%}")
-	s = replaceEnvReferences(s, "{$", "}")
-	return s
+// and understands both the $UNIX and %WINDOWS% syntaxes. A default value
+// may follow the variable name after a colon, as in {$PORT:80}; it is
+// used if the variable is unset or empty. The names of variables that
+// are unset and have no default are returned.
+func replaceEnvVars(s string) (string, []string) {
+	s, unset := replaceEnvReferences(s, "{%", "%}")
+	s, unset2 := replaceEnvReferences(s, "{$", "}")
+	return s, append(unset, unset2...)
 }
 
 // replaceEnvReferences performs the actual replacement of env variables
 // in s, given the placeholder start and placeholder end strings.
-func replaceEnvReferences(s, refStart, refEnd string) string {
-	index := strings.Index(s, refStart)
-	for index != -1 {
-		endIndex := strings.Index(s, refEnd)
-		if endIndex != -1 {
-			ref := s[index : endIndex+len(refEnd)]
-			s = strings.Replace(s, ref, os.Getenv(ref[len(refStart):len(ref)-len(refEnd)]), -1)
-		} else {
-			return s
+func replaceEnvReferences(s, refStart, refEnd string) (string, []string) {
+	var unset []string
+	var result string
+	for {
+		index := strings.Index(s, refStart)
+		if index == -1 {
+			break
+		}
+		endIndex := strings.Index(s[index+len(refStart):], refEnd)
+		if endIndex == -1 {
+			break
 		}
-		index = strings.Index(s, refStart)
+		endIndex += index + len(refStart)
+
+		name, defaultValue := s[index+len(refStart):endIndex], ""
+		hasDefault := false
+		if colon := strings.Index(name, ":"); colon >= 0 {
+			name, defaultValue, hasDefault = name[:colon], name[colon+1:], true
+		}
+		value, ok := os.LookupEnv(name)
+		if value == "" && hasDefault {
+			value = defaultValue
+		} else if !ok && !hasDefault {
+			unset = append(unset, name)
+		}
+
+		result += s[:index] + value
+		s = s[endIndex+len(refEnd):]
 	}
-	return s
+	return result + s, unset
 }
 
 // ServerBlock associates any number of keys (usually addresses
@@ -413,4 +581,67 @@ func replaceEnvReferences(s, refStart, refEnd string) string {
 type ServerBlock struct {
 	Keys   []string
 	Tokens map[string][]Token
+
+	// Imports are the files imported while parsing the block.
+	Imports []string
+}
+
+// Text returns Caddyfile text that parses to sblocks. Imports and
+// environment variables appear already expanded, and the directives
+// of each server block are sorted by name.
+func Text(sblocks []ServerBlock) []byte {
+	var buf bytes.Buffer
+	for i, sb := range sblocks {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		for j, key := range sb.Keys {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(quoteToken(key))
+		}
+		buf.WriteString(" {\n")
+
+		dirs := make([]string, 0, len(sb.Tokens))
+		for dir := range sb.Tokens {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			depth := 1
+			tokens := sb.Tokens[dir]
+			for k, t := range tokens {
+				if t.Text == "}" {
+					depth--
+				}
+				if k > 0 {
+					prev := tokens[k-1]
+					if prev.File != t.File || prev.expansion != t.expansion ||
+						prev.Line+strings.Count(prev.Text, "\n") < t.Line {
+						buf.WriteString("\n" + strings.Repeat("\t", depth))
+					} else {
+						buf.WriteString(" ")
+					}
+				} else {
+					buf.WriteString("\t")
+				}
+				if t.Text == "{" {
+					depth++
+				}
+				buf.WriteString(quoteToken(t.Text))
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes()
+}
+
+// quoteToken returns s quoted if it has to be to read as one token.
+func quoteToken(s string) string {
+	if s == "" || strings.ContainsAny(s, "\" \n\t\r#") {
+		return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+	}
+	return s
 }
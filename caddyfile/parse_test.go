@@ -1,9 +1,11 @@
 package caddyfile
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -423,6 +425,83 @@ func TestParseAll(t *testing.T) {
 	}
 }
 
+func TestSnippets(t *testing.T) {
+	p := testParser(`(common) {
+		dir1 {args.0}
+		dir2 {args.1} {
+			foo {args.0}-{args.2}
+		}
+	}
+	(empty) {
+	}
+	localhost {
+		import common a b
+		import empty
+		import common c
+		dir3
+	}`)
+	blocks, err := p.parseAll()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("Expected 1 server block, got %d", len(blocks))
+	}
+	if actual, expected := blocks[0].Keys, []string{"localhost"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected keys %v, got %v", expected, actual)
+	}
+	texts := func(tokens []Token) []string {
+		var s []string
+		for _, token := range tokens {
+			s = append(s, token.Text)
+		}
+		return s
+	}
+	for dir, expected := range map[string][]string{
+		"dir1": {"dir1", "a", "dir1", "c"},
+		"dir2": {"dir2", "b", "{", "foo", "a-", "}", "dir2", "", "{", "foo", "c-", "}"},
+		"dir3": {"dir3"},
+	} {
+		if actual := texts(blocks[0].Tokens[dir]); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Directive %s: Expected tokens %q, got %q", dir, expected, actual)
+		}
+	}
+
+	// a snippet can hold whole server blocks
+	p = testParser(`(site) {
+		{args.0} {
+			dir1
+		}
+	}
+	import site host1
+	import site host2`)
+	blocks, err = p.parseAll()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0].Keys[0] != "host1" || blocks[1].Keys[0] != "host2" {
+		t.Errorf("Expected server blocks host1 and host2, got %v", blocks)
+	}
+
+	for i, input := range []string{
+		// redefinition
+		"(s) {\n}\n(s) {\n}",
+		// no block
+		"(s)",
+		// unclosed block
+		"(s) {\ndir1",
+		// recursion
+		"(s) {\nimport s\n}\nlocalhost {\nimport s\n}",
+		// arguments to a file import
+		"localhost {\nimport testdata/import_test1.txt arg\n}",
+	} {
+		p := testParser(input)
+		if _, err := p.parseAll(); err == nil {
+			t.Errorf("Test %d: Expected an error, but didn't get one", i)
+		}
+	}
+}
+
 func TestEnvironmentReplacement(t *testing.T) {
 	os.Setenv("PORT", "8080")
 	os.Setenv("ADDRESS", "servername.com")
@@ -466,6 +545,13 @@ func TestEnvironmentReplacement(t *testing.T) {
 		t.Errorf("Expected argument to be '%s' but was '%s'", expected, actual)
 	}
 
+	// runtime env placeholders are left for the replacer
+	p = testParser(":8080\ndir1 {env.FOOBAR}")
+	blocks, _ = p.parseAll()
+	if actual, expected := blocks[0].Tokens["dir1"][1].Text, "{env.FOOBAR}"; expected != actual {
+		t.Errorf("Expected argument to be '%s' but was '%s'", expected, actual)
+	}
+
 	// combined windows env vars in argument
 	p = testParser(":{%PORT%}\ndir1 {%ADDRESS%}/{%FOOBAR%}")
 	blocks, _ = p.parseAll()
@@ -495,6 +581,128 @@ func TestEnvironmentReplacement(t *testing.T) {
 	}
 }
 
+func TestEnvironmentDefaults(t *testing.T) {
+	os.Setenv("PORT", "8080")
+	os.Setenv("EMPTY", "")
+	os.Unsetenv("UNSET")
+
+	for i, test := range []struct {
+		input  string
+		expect string
+	}{
+		{`{$PORT:80}`, "8080"},
+		{`{$UNSET:80}`, "80"},
+		{`{$EMPTY:80}`, "80"},
+		{`x{$UNSET:}`, "x"},
+		{`{%UNSET:80%}`, "80"},
+		{`localhost:{$UNSET:80}/{$PORT}`, "localhost:80/8080"},
+		{`{$UNSET:a:b}`, "a:b"},
+	} {
+		p := testParser(test.input + " {\n}")
+		blocks, err := p.parseAll()
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if actual := blocks[0].Keys[0]; actual != test.expect {
+			t.Errorf("Test %d: Expected key to be '%s' but was '%s'", i, test.expect, actual)
+		}
+	}
+}
+
+func TestStrictEnv(t *testing.T) {
+	os.Setenv("PORT", "8080")
+	os.Unsetenv("UNSET")
+	StrictEnv = true
+	defer func() { StrictEnv = false }()
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{":{$PORT}\ndir1 {$PORT}", false},
+		{":{$UNSET:80}\ndir1 {%UNSET:foo%}", false},
+		{":{$UNSET}", true},
+		{":8080\ndir1 {$UNSET}", true},
+		{":8080\ndir1 {%UNSET%}", true},
+	} {
+		p := testParser(test.input)
+		_, err := p.parseAll()
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		}
+		if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if test.shouldErr && err != nil && !strings.Contains(err.Error(), "UNSET") {
+			t.Errorf("Test %d: Expected error to name the variable, got: %v", i, err)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	for i, input := range []string{
+		`localhost`,
+		`localhost:1234, http://host2 {
+			dir1 a "b c" "d \"e\"" ""
+			dir2 {
+				sub1 "#f"
+				sub2 {
+					x
+				}
+			}
+			dir3 "multi
+line" same
+			dir3 next
+		}
+		host3 {
+			dir1
+		}`,
+		`import testdata/import_glob*.txt`,
+	} {
+		p := testParser(input)
+		expected, err := p.parseAll()
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		text := Text(expected)
+		actual, err := Parse("Caddyfile", bytes.NewReader(text), nil)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error parsing %s, got: %v", i, text, err)
+		}
+		if len(actual) != len(expected) {
+			t.Fatalf("Test %d: Expected %d server blocks, got %d", i, len(expected), len(actual))
+		}
+		for j := range expected {
+			if !reflect.DeepEqual(actual[j].Keys, expected[j].Keys) {
+				t.Errorf("Test %d, block %d: Expected keys %v, got %v", i, j, expected[j].Keys, actual[j].Keys)
+			}
+			for dir, tokens := range expected[j].Tokens {
+				want, got := tokenLines(tokens), tokenLines(actual[j].Tokens[dir])
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Test %d, block %d: Expected %s to be %q, got %q", i, j, dir, want, got)
+				}
+			}
+			if len(actual[j].Tokens) != len(expected[j].Tokens) {
+				t.Errorf("Test %d, block %d: Expected %d directives, got %d", i, j, len(expected[j].Tokens), len(actual[j].Tokens))
+			}
+		}
+	}
+}
+
+// tokenLines returns the text of tokens, line by line.
+func tokenLines(tokens []Token) [][]string {
+	var lines [][]string
+	d := NewDispenserTokens("", tokens)
+	for d.Next() {
+		if d.isNewLine() {
+			lines = append(lines, nil)
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], d.Val())
+	}
+	return lines
+}
+
 func testParser(input string) parser {
 	buf := strings.NewReader(input)
 	p := parser{Dispenser: NewDispenser("Caddyfile", buf)}
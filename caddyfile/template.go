@@ -0,0 +1,86 @@
+package caddyfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Templates, if true, makes Adapt expand every config file as a
+// template, not only those with the .tmpl extension.
+var Templates bool
+
+// templateExt is the extension of config files that are templates.
+const templateExt = ".tmpl"
+
+// ExpandTemplate executes contents, named filename, as a Go text
+// template, so that repetitive sites can be generated at load time
+// with loops and conditionals over the environment. Besides the
+// built-in actions and functions of templates, it has:
+//
+//	env NAME             the value of an environment variable
+//	list NAME            the items of a variable, split on commas
+//	                     and white space
+//	split SEP S          S split on SEP
+//	join SEP LIST        the items of LIST joined by SEP
+//	seq N                the numbers 1 to N
+//	default DEF VALUE    VALUE, or DEF if VALUE is empty
+//	lower, upper, trim   S in lower or upper case, or trimmed
+//	replace OLD NEW S    S with OLD replaced by NEW
+//	contains, hasPrefix  whether S has the substring, prefix
+//	hasSuffix SUB S      or suffix SUB
+//
+// Arguments come before the string they apply to, so that they
+// can be chained, as in {{env "SITE" | default "localhost"}}.
+// Caddyfiles imported by the template are not templates.
+func ExpandTemplate(filename string, contents []byte) ([]byte, error) {
+	tmpl, err := template.New(filename).Funcs(templateFuncs).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// templateFuncs are the functions of config templates.
+var templateFuncs = template.FuncMap{
+	"env": os.Getenv,
+	"list": func(name string) []string {
+		return strings.FieldsFunc(os.Getenv(name), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		})
+	},
+	"split": func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":  func(sep string, list []string) string { return strings.Join(list, sep) },
+	"seq": func(n int) ([]int, error) {
+		if n < 0 || n > maxTemplateSeq {
+			return nil, fmt.Errorf("seq %d is not between 0 and %d", n, maxTemplateSeq)
+		}
+		seq := make([]int, n)
+		for i := range seq {
+			seq[i] = i + 1
+		}
+		return seq, nil
+	},
+	"default": func(def, value string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	},
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"trim":      strings.TrimSpace,
+	"replace":   func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"contains":  func(sub, s string) bool { return strings.Contains(s, sub) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+}
+
+// maxTemplateSeq limits seq, so that a typo can't exhaust memory.
+const maxTemplateSeq = 100000
@@ -0,0 +1,50 @@
+package caddyfile
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	os.Setenv("CADDY_TEST_SITES", "a.com, b.com\tc.com")
+	os.Setenv("CADDY_TEST_TLS", "on")
+	defer os.Unsetenv("CADDY_TEST_SITES")
+	defer os.Unsetenv("CADDY_TEST_TLS")
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  string
+	}{
+		{"localhost", false, "localhost"},
+		{`{{range list "CADDY_TEST_SITES"}}{{.}} {
+	root /srv/{{replace "." "_" .}}
+}
+{{end}}`, false, "a.com {\n\troot /srv/a_com\n}\nb.com {\n\troot /srv/b_com\n}\nc.com {\n\troot /srv/c_com\n}\n"},
+		{`{{if eq (env "CADDY_TEST_TLS") "on"}}tls self_signed{{else}}tls off{{end}}`, false, "tls self_signed"},
+		{`{{env "CADDY_TEST_UNSET" | default "localhost"}}:{{env "CADDY_TEST_UNSET" | default "80"}}`, false, "localhost:80"},
+		{`{{range seq 3}}:800{{.}} {{end}}`, false, ":8001 :8002 :8003 "},
+		{`{{split "," "x,y" | join " "}} {{upper "a"}}{{lower "B"}} {{trim " c "}}`, false, "x y Ab c"},
+		{`{{if hasPrefix "a." "a.com"}}yes{{end}}{{if hasSuffix ".org" "a.com"}}no{{end}}{{if contains "com" "a.com"}}!{{end}}`, false, "yes!"},
+		{`{placeholder} {$ENV}`, false, "{placeholder} {$ENV}"},
+		{`{{range}}`, true, ""},
+		{`{{nofunc}}`, true, ""},
+		{`{{range seq -1}}{{end}}`, true, ""},
+		{`{{.Missing}}`, true, ""},
+	} {
+		actual, err := ExpandTemplate("Caddyfile", []byte(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if string(actual) != test.expected {
+			t.Errorf("Test %d: Expected:\n'%s'\nActual:\n'%s'", i, test.expected, actual)
+		}
+	}
+}
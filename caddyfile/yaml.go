@@ -0,0 +1,22 @@
+package caddyfile
+
+import "gopkg.in/yaml.v2"
+
+// ToYAML converts caddyfile to its YAML representation,
+// which has the same structure as its JSON representation.
+func ToYAML(caddyfile []byte) ([]byte, error) {
+	j, err := encode(caddyfile)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(j)
+}
+
+// FromYAML converts YAML-encoded yamlBytes to Caddyfile text.
+func FromYAML(yamlBytes []byte) ([]byte, error) {
+	var j EncodedCaddyfile
+	if err := yaml.Unmarshal(yamlBytes, &j); err != nil {
+		return nil, err
+	}
+	return decode(j), nil
+}
@@ -0,0 +1,58 @@
+package caddyfile
+
+import "testing"
+
+func TestYAMLRoundTrip(t *testing.T) {
+	for i, test := range tests {
+		yamlBytes, err := ToYAML([]byte(test.caddyfile))
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+			continue
+		}
+		output, err := FromYAML(yamlBytes)
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+		}
+		if string(output) != test.caddyfile {
+			t.Errorf("Test %d\nExpected:\n'%s'\nActual:\n'%s'\nYAML:\n%s", i, test.caddyfile, string(output), yamlBytes)
+		}
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	input := `
+- keys: [example.com, "www.example.com"]
+  body:
+    - [root, /var/www]
+    - [gzip]
+    - - proxy
+      - /api
+      - localhost:8080
+      - - [transparent]
+        - [header_upstream, X-Custom, "a b"]
+    - [basicauth, /, user, ""]
+- keys: [":8080"]
+  body:
+    - [browse]
+`
+	expected := `example.com, www.example.com {
+	root /var/www
+	gzip
+	proxy /api localhost:8080 {
+		transparent
+		header_upstream X-Custom "a b"
+	}
+	basicauth / user ""
+}
+
+:8080 {
+	browse
+}`
+	output, err := FromYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if string(output) != expected {
+		t.Errorf("Expected:\n'%s'\nActual:\n'%s'", expected, string(output))
+	}
+}
@@ -0,0 +1,228 @@
+// Package accounting is middleware that counts the requests to sites
+// and the bytes of their bodies, by status class, and writes the
+// totals periodically to a CSV or JSON file or posts them to a
+// collector, for billing the tenants of shared hosting.
+package accounting
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var droppedTotal = metrics.NewCounter("caddy_http_accounting_dropped_total",
+	"Number of accounting records dropped because they could not be written.")
+
+// Accounting is middleware that counts requests for an account.
+type Accounting struct {
+	Next       httpserver.Handler
+	Account    string
+	Accountant *Accountant
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a Accounting) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body *countingReader
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &countingReader{ReadCloser: r.Body}
+		r.Body = body
+	}
+	rec := httpserver.NewResponseRecorder(w)
+
+	status, err := a.Next.ServeHTTP(rec, r)
+
+	in := r.ContentLength
+	if body != nil && atomic.LoadInt64(&body.n) > in {
+		in = atomic.LoadInt64(&body.n)
+	}
+	if in < 0 {
+		in = 0
+	}
+	code := rec.Status()
+	if status != 0 && rec.Size() == 0 {
+		// the response is written further up the chain, if at all
+		code = status
+	}
+	a.Accountant.Add(a.Account, code, in, int64(rec.Size()))
+	return status, err
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// Record is the totals of an account, for responses of a status
+// class, over a period.
+type Record struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Account     string    `json:"account"`
+	StatusClass string    `json:"status_class"`
+	Requests    int64     `json:"requests"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+}
+
+// statusClass returns the class of status, such as 2xx.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+type totalsKey struct {
+	account, class string
+}
+
+type totals struct {
+	requests, in, out int64
+}
+
+// maxPending is how many records that could not be written are kept
+// to be written again.
+const maxPending = 10000
+
+// Accountant totals requests in memory and writes the totals to a
+// sink every Interval.
+type Accountant struct {
+	Sink     Sink
+	Interval time.Duration
+
+	mu      sync.Mutex
+	totals  map[totalsKey]*totals
+	since   time.Time
+	pending []Record
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewAccountant returns an accountant that writes to sink every
+// interval.
+func NewAccountant(sink Sink, interval time.Duration) *Accountant {
+	return &Accountant{
+		Sink:     sink,
+		Interval: interval,
+		totals:   make(map[totalsKey]*totals),
+		since:    time.Now(),
+	}
+}
+
+// Add counts a request for account with a response of status, and
+// the bytes of the bodies of both.
+func (a *Accountant) Add(account string, status int, in, out int64) {
+	key := totalsKey{account, statusClass(status)}
+	a.mu.Lock()
+	t, ok := a.totals[key]
+	if !ok {
+		t = new(totals)
+		a.totals[key] = t
+	}
+	t.requests++
+	t.in += in
+	t.out += out
+	a.mu.Unlock()
+}
+
+// Flush writes the totals since the last flush, along with any
+// records that could not be written before, and starts over.
+func (a *Accountant) Flush() error {
+	end := time.Now()
+	a.mu.Lock()
+	records := a.pending
+	for key, t := range a.totals {
+		records = append(records, Record{
+			Start:       a.since.UTC().Truncate(time.Second),
+			End:         end.UTC().Truncate(time.Second),
+			Account:     key.account,
+			StatusClass: key.class,
+			Requests:    t.requests,
+			BytesIn:     t.in,
+			BytesOut:    t.out,
+		})
+	}
+	a.totals = make(map[totalsKey]*totals)
+	a.since = end
+	a.pending = nil
+	a.mu.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].Start.Equal(records[j].Start) {
+			return records[i].Start.Before(records[j].Start)
+		}
+		if records[i].Account != records[j].Account {
+			return records[i].Account < records[j].Account
+		}
+		return records[i].StatusClass < records[j].StatusClass
+	})
+	err := a.Sink.Write(records)
+	if err != nil {
+		// keep them to try again, as they are what tenants are billed by
+		a.mu.Lock()
+		a.pending = append(records, a.pending...)
+		if over := len(a.pending) - maxPending; over > 0 {
+			droppedTotal.Add(float64(over))
+			a.pending = a.pending[over:]
+		}
+		a.mu.Unlock()
+	}
+	return err
+}
+
+// Start starts flushing the totals every interval.
+func (a *Accountant) Start() error {
+	a.stop = make(chan struct{})
+	a.stopped = make(chan struct{})
+	go a.run()
+	return nil
+}
+
+// Stop flushes the totals and stops flushing them.
+func (a *Accountant) Stop() error {
+	if a.stop == nil {
+		return nil
+	}
+	close(a.stop)
+	<-a.stopped
+	a.stop = nil
+	return nil
+}
+
+func (a *Accountant) run() {
+	defer close(a.stopped)
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.stop:
+			if err := a.Flush(); err != nil {
+				log.Printf("[ERROR] accounting: %v", err)
+			}
+			return
+		}
+		if err := a.Flush(); err != nil {
+			log.Printf("[ERROR] accounting: %v", err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package accounting
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// memorySink keeps the records written to it, or fails.
+type memorySink struct {
+	records []Record
+	fail    bool
+}
+
+func (s *memorySink) Write(records []Record) error {
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func TestAccounting(t *testing.T) {
+	sink := new(memorySink)
+	accountant := NewAccountant(sink, DefaultInterval)
+	a := Accounting{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/missing" {
+				return http.StatusNotFound, nil
+			}
+			ioutil.ReadAll(r.Body)
+			w.Write([]byte("hello"))
+			return 0, nil
+		}),
+		Account:    "acme",
+		Accountant: accountant,
+	}
+
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("12345678")))
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	accountant.Add("other", http.StatusInternalServerError, 0, 10)
+
+	if err := accountant.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 3 {
+		t.Fatalf("Expected 3 records, got %d: %+v", len(sink.records), sink.records)
+	}
+	ok, missing, other := sink.records[0], sink.records[1], sink.records[2]
+	if ok.Account != "acme" || ok.StatusClass != "2xx" || ok.Requests != 2 || ok.BytesIn != 8 || ok.BytesOut != 10 {
+		t.Errorf("Unexpected record %+v", ok)
+	}
+	if missing.StatusClass != "4xx" || missing.Requests != 1 || missing.BytesOut != 0 {
+		t.Errorf("Unexpected record %+v", missing)
+	}
+	if other.Account != "other" || other.StatusClass != "5xx" {
+		t.Errorf("Unexpected record %+v", other)
+	}
+
+	// the totals start over after a flush
+	sink.records = nil
+	if err := accountant.Flush(); err != nil || len(sink.records) != 0 {
+		t.Errorf("Expected nothing to flush, got %v and %+v", err, sink.records)
+	}
+}
+
+func TestFlushRetries(t *testing.T) {
+	sink := &memorySink{fail: true}
+	accountant := NewAccountant(sink, DefaultInterval)
+	accountant.Add("acme", http.StatusOK, 0, 0)
+	if err := accountant.Flush(); err == nil {
+		t.Fatal("Expected an error")
+	}
+	accountant.Add("acme", http.StatusOK, 0, 0)
+	sink.fail = false
+	if err := accountant.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the totals of both periods are written, as separate records
+	if len(sink.records) != 2 {
+		t.Errorf("Expected 2 records, got %+v", sink.records)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accounting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "usage.csv")
+	rec := Record{Account: "acme", StatusClass: "2xx", Requests: 3, BytesIn: 1, BytesOut: 2}
+
+	s := FileSink{Path: path, Format: FormatCSV}
+	for i := 0; i < 2; i++ {
+		if err := s.Write([]Record{rec}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 || lines[0] != "start,end,account,status_class,requests,bytes_in,bytes_out" {
+		t.Fatalf("Expected a header and 2 records, got:\n%s", body)
+	}
+	if !strings.HasSuffix(lines[1], ",acme,2xx,3,1,2") {
+		t.Errorf("Unexpected record %s", lines[1])
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var body, contentType, auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body, contentType, auth = string(b), r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+	}))
+	defer collector.Close()
+
+	s := NewHTTPSink(collector.URL, http.Header{"Authorization": {"key"}}, FormatJSON)
+	if err := s.Write([]Record{{Account: "acme", StatusClass: "2xx", Requests: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, `"account":"acme"`) || contentType != "application/x-ndjson" || auth != "key" {
+		t.Errorf("Unexpected request: %s %s %s", contentType, auth, body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if err := NewHTTPSink(failing.URL, nil, FormatCSV).Write([]Record{{}}); err == nil {
+		t.Error("Expected an error from a failing collector")
+	}
+}
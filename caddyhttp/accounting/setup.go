@@ -0,0 +1,139 @@
+package accounting
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("accounting", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// DefaultInterval is how often totals are written when no other
+// interval is given.
+const DefaultInterval = time.Minute
+
+// config is the parsed accounting directive.
+type config struct {
+	account  string
+	to       string
+	format   string
+	interval time.Duration
+	headers  http.Header
+}
+
+// setup configures a new Accounting middleware instance. The sites
+// of a server block share one accountant.
+func setup(c *caddy.Controller) error {
+	cfg, err := accountingParse(c)
+	if err != nil {
+		return err
+	}
+	site := httpserver.GetConfig(c)
+	if cfg.account == "" {
+		cfg.account = site.Addr.String()
+	}
+
+	accountant, ok := c.ServerBlockStorage.(*Accountant)
+	if !ok {
+		var sink Sink = FileSink{Path: cfg.to, Format: cfg.format}
+		if u, err := url.Parse(cfg.to); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			sink = NewHTTPSink(cfg.to, cfg.headers, cfg.format)
+		} else {
+			// totals are appended once listening, also in a sandbox
+			caddy.RegisterWritablePath(cfg.to)
+		}
+		accountant = NewAccountant(sink, cfg.interval)
+		c.OnStartup(accountant.Start)
+		c.OnShutdown(accountant.Stop)
+		c.ServerBlockStorage = accountant
+	}
+
+	site.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Accounting{Next: next, Account: cfg.account, Accountant: accountant}
+	})
+
+	return nil
+}
+
+// accountingParse parses
+//
+//	accounting {
+//		to       file|url
+//		format   json|csv
+//		interval duration
+//		account  name
+//		header   name value
+//	}
+//
+// where the totals are appended to the file or posted to the URL
+// with the headers, as lines of JSON by default, every interval, a
+// minute by default. They are for the account name, which is the
+// address of the site by default, so that sites can share one.
+func accountingParse(c *caddy.Controller) (config, error) {
+	cfg := config{format: FormatJSON, interval: DefaultInterval, headers: make(http.Header)}
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return cfg, c.Err("accounting may only be given once per site")
+		}
+		parsed = true
+		if len(c.RemainingArgs()) != 0 {
+			return cfg, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "to", "account":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				if what == "to" {
+					cfg.to = args[0]
+				} else {
+					cfg.account = args[0]
+				}
+			case "format":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				if args[0] != FormatJSON && args[0] != FormatCSV {
+					return cfg, c.Errf("accounting format must be json or csv, not '%s'", args[0])
+				}
+				cfg.format = args[0]
+			case "interval":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return cfg, c.Errf("Bad accounting interval '%s'", args[0])
+				}
+				cfg.interval = d
+			case "header":
+				if len(args) != 2 {
+					return cfg, c.ArgErr()
+				}
+				cfg.headers.Add(args[0], args[1])
+			default:
+				return cfg, c.Errf("Unknown accounting property '%s'", what)
+			}
+		}
+	}
+
+	if parsed && cfg.to == "" {
+		return cfg, c.Err("accounting requires a destination to be given with 'to'")
+	}
+
+	return cfg, nil
+}
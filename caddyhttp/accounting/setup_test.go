@@ -0,0 +1,86 @@
+package accounting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input         string
+		expectHTTP    bool
+		expectAccount string
+	}{
+		{"accounting {\n to usage.csv\n format csv\n}", false, ""},
+		{"accounting {\n to https://billing/usage\n account acme\n}", true, "acme"},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		httpserver.GetConfig(c).Addr = httpserver.Address{Original: "example.com", Host: "example.com"}
+		if test.expectAccount == "" {
+			test.expectAccount = httpserver.GetConfig(c).Addr.String()
+		}
+		if err := setup(c); err != nil {
+			t.Fatalf("Test %d: expected no errors, got: %v", i, err)
+		}
+		mids := httpserver.GetConfig(c).Middleware()
+		if len(mids) == 0 {
+			t.Fatalf("Test %d: expected middleware, had 0 instead", i)
+		}
+		handler := mids[0](httpserver.EmptyNext)
+		myHandler, ok := handler.(Accounting)
+		if !ok {
+			t.Fatalf("Test %d: expected handler to be type Accounting, got: %#v", i, handler)
+		}
+		if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+			t.Errorf("Test %d: 'Next' field of handler was not set properly", i)
+		}
+		if _, isHTTP := myHandler.Accountant.Sink.(*HTTPSink); isHTTP != test.expectHTTP {
+			t.Errorf("Test %d: expected an HTTP sink %t, got %T", i, test.expectHTTP, myHandler.Accountant.Sink)
+		}
+		if myHandler.Account != test.expectAccount {
+			t.Errorf("Test %d: expected account %s, got %s", i, test.expectAccount, myHandler.Account)
+		}
+		if !test.expectHTTP && !caddy.Writable("usage.csv") {
+			t.Errorf("Test %d: expected the file to be writable once privileges are dropped", i)
+		}
+	}
+}
+
+func TestAccountingParse(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectFormat   string
+		expectInterval time.Duration
+		expectHeaders  int
+	}{
+		{"accounting {\n to usage.log\n}", false, FormatJSON, DefaultInterval, 0},
+		{"accounting {\n to usage.csv\n format csv\n interval 1h\n}", false, FormatCSV, time.Hour, 0},
+		{"accounting {\n to https://billing/usage\n header Authorization key\n}", false, FormatJSON, DefaultInterval, 1},
+		{"accounting", true, "", 0, 0},
+		{"accounting usage.log", true, "", 0, 0},
+		{"accounting {\n to usage.log\n format xml\n}", true, "", 0, 0},
+		{"accounting {\n to usage.log\n interval 0s\n}", true, "", 0, 0},
+		{"accounting {\n to usage.log\n header Authorization\n}", true, "", 0, 0},
+		{"accounting {\n to usage.log\n foo\n}", true, "", 0, 0},
+		{"accounting {\n to a.log\n}\naccounting {\n to b.log\n}", true, "", 0, 0},
+	} {
+		cfg, err := accountingParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, but had none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		if cfg.format != test.expectFormat || cfg.interval != test.expectInterval || len(cfg.headers) != test.expectHeaders {
+			t.Errorf("Test %d: unexpected config %+v", i, cfg)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package accounting
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Sink is where the totals of accounts are written.
+type Sink interface {
+	Write(records []Record) error
+}
+
+// Formats of records.
+const (
+	FormatJSON = "json" // lines of JSON
+	FormatCSV  = "csv"
+)
+
+// csvHeader is the first line of CSV files.
+var csvHeader = []string{"start", "end", "account", "status_class", "requests", "bytes_in", "bytes_out"}
+
+// encode writes records to w in format; with a CSV header if header
+// is true.
+func encode(w io.Writer, format string, records []Record, header bool) error {
+	if format != FormatCSV {
+		enc := json.NewEncoder(w)
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	if header {
+		cw.Write(csvHeader)
+	}
+	for _, rec := range records {
+		cw.Write([]string{
+			rec.Start.Format(time.RFC3339),
+			rec.End.Format(time.RFC3339),
+			rec.Account,
+			rec.StatusClass,
+			strconv.FormatInt(rec.Requests, 10),
+			strconv.FormatInt(rec.BytesIn, 10),
+			strconv.FormatInt(rec.BytesOut, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// FileSink appends records to a file, which starts with a header
+// if it is CSV.
+type FileSink struct {
+	Path   string
+	Format string
+}
+
+// Write appends records to the file.
+func (s FileSink) Write(records []Record) error {
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// write the records at once, so that those of other instances
+	// appending to the file don't interleave with them
+	var buf bytes.Buffer
+	if err := encode(&buf, s.Format, records, fi.Size() == 0); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HTTPSink posts records to a collector, with a CSV header if they
+// are CSV.
+type HTTPSink struct {
+	Endpoint string
+	Headers  http.Header
+	Format   string
+
+	client *http.Client
+}
+
+// NewHTTPSink returns a sink that posts records in format to
+// endpoint, adding headers to each request.
+func NewHTTPSink(endpoint string, headers http.Header, format string) *HTTPSink {
+	return &HTTPSink{
+		Endpoint: endpoint,
+		Headers:  headers,
+		Format:   format,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Write posts records to the collector.
+func (s *HTTPSink) Write(records []Record) error {
+	var body bytes.Buffer
+	if err := encode(&body, s.Format, records, true); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.Endpoint, &body)
+	if err != nil {
+		return err
+	}
+	for field, values := range s.Headers {
+		req.Header[field] = values
+	}
+	if s.Format == FormatCSV {
+		req.Header.Set("Content-Type", "text/csv")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
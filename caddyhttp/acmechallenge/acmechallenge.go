@@ -0,0 +1,105 @@
+// Package acmechallenge implements the acme_challenge directive,
+// which passes the ACME HTTP challenges of a site through to a
+// backend, or answers them from a directory that a backend shares,
+// so that backends which manage their own certificates behind Caddy
+// can still obtain them with the HTTP-01 challenge.
+package acmechallenge
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func init() {
+	caddy.RegisterPlugin("acme_challenge", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures the challenges of the site to be passed through.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		if c.NextBlock() {
+			return c.ArgErr()
+		}
+		if cfg.ACMEChallenge != nil {
+			return c.Err("acme_challenge may only be given once per site")
+		}
+		handler, err := newHandler(args[0])
+		if err != nil {
+			return c.Err(err.Error())
+		}
+		cfg.ACMEChallenge = handler
+	}
+	return nil
+}
+
+// newHandler returns the handler that passes challenges through to
+// dest, which is the URL of a backend or a directory.
+func newHandler(dest string) (http.Handler, error) {
+	if strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://") {
+		backend, err := url.Parse(dest)
+		if err != nil {
+			return nil, err
+		}
+		proxy := httputil.NewSingleHostReverseProxy(backend)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("[ERROR] Passing ACME challenge for %s through to %s: %v", r.Host, dest, err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return proxy, nil
+	}
+	// the directory is read after the servers listen, also in a sandbox
+	caddy.RegisterReadablePath(dest)
+	return Dir(dest), nil
+}
+
+// Dir answers challenges with the files of the tokens in a directory,
+// such as one that backends write them to.
+type Dir string
+
+// ServeHTTP implements http.Handler.
+func (d Dir) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, caddytls.HTTPChallengePath+"/")
+	if !validToken(token) {
+		http.NotFound(w, r)
+		return
+	}
+	keyAuth, err := ioutil.ReadFile(filepath.Join(string(d), token))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(keyAuth)
+}
+
+// validToken returns whether token is made of the characters of
+// base64url, of which tokens are, so that it can't name files
+// outside of the directory.
+func validToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, c := range token {
+		if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
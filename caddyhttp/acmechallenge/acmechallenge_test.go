@@ -0,0 +1,124 @@
+package acmechallenge
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		isDir     bool
+	}{
+		{`acme_challenge http://10.0.0.5:8080`, false, false},
+		{`acme_challenge /var/lib/acme/challenges`, false, true},
+		{`acme_challenge`, true, false},
+		{`acme_challenge a b`, true, false},
+		{`acme_challenge http://10.0.0.5 {
+			foo
+		}`, true, false},
+		{`acme_challenge http://10.0.0.5
+		acme_challenge /var/lib/acme/challenges`, true, false},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		handler := httpserver.GetConfig(c).ACMEChallenge
+		if handler == nil {
+			t.Errorf("Test %d: Expected ACMEChallenge to be set", i)
+			continue
+		}
+		if _, ok := handler.(Dir); ok != test.isDir {
+			t.Errorf("Test %d: Expected handler to be a Dir: %v, got: %#v", i, test.isDir, handler)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acmechallenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "tok-EN_1"), []byte("tok-EN_1.thumb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		token    string
+		status   int
+		expected string
+	}{
+		{"tok-EN_1", http.StatusOK, "tok-EN_1.thumb"},
+		{"missing", http.StatusNotFound, ""},
+		{"../secret", http.StatusNotFound, ""},
+		{"", http.StatusNotFound, ""},
+	} {
+		r := httptest.NewRequest("GET", "http://example.com"+caddytls.HTTPChallengePath+"/"+test.token, nil)
+		w := httptest.NewRecorder()
+		Dir(dir).ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, w.Code)
+		}
+		if test.status == http.StatusOK {
+			if body := w.Body.String(); body != test.expected {
+				t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.expected, body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+				t.Errorf("Test %d: Expected Content-Type text/plain, got '%s'", i, ct)
+			}
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var host, path string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, path = r.Host, r.URL.Path
+		w.Write([]byte("keyauth"))
+	}))
+	defer backend.Close()
+
+	handler, err := newHandler(backend.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r := httptest.NewRequest("GET", "http://example.com"+caddytls.HTTPChallengePath+"/tok", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Body.String() != "keyauth" {
+		t.Errorf("Expected 200 keyauth, got %d %s", w.Code, w.Body.String())
+	}
+	if host != "example.com" {
+		t.Errorf("Expected backend to get Host example.com, got '%s'", host)
+	}
+	if path != caddytls.HTTPChallengePath+"/tok" {
+		t.Errorf("Expected backend to get the challenge path, got '%s'", path)
+	}
+
+	backend.Close()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected %d with the backend down, got %d", http.StatusBadGateway, w.Code)
+	}
+}
@@ -0,0 +1,82 @@
+// Package apikeys is middleware that requires valid API keys for
+// paths, kept hashed in a keys file with their scopes and expiry, and
+// issued and revoked through the admin API, so that simple API
+// gateways need no service of their own to manage keys.
+package apikeys
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var rejected = metrics.NewCounter("caddy_http_api_key_rejections_total",
+	"Number of requests refused for lack of a valid API key, by reason.",
+	"reason")
+
+// APIKeys is middleware that requires valid API keys.
+type APIKeys struct {
+	Next  httpserver.Handler
+	Store *Store
+
+	// Header is the header with the key, or if it is empty,
+	// Query is the query parameter with it.
+	Header string
+	Query  string
+
+	Rules []Rule
+}
+
+// Rule requires a key with all of Scopes for Path.
+type Rule struct {
+	Path   string
+	Scopes []string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a APIKeys) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	rule := a.ruleFor(r.URL.Path)
+	if rule == nil {
+		return a.Next.ServeHTTP(w, r)
+	}
+
+	var raw string
+	if a.Header != "" {
+		raw = r.Header.Get(a.Header)
+	} else {
+		raw = r.URL.Query().Get(a.Query)
+	}
+	if raw == "" {
+		rejected.Inc("missing")
+		return http.StatusUnauthorized, nil
+	}
+	key, ok := a.Store.Validate(raw)
+	if !ok {
+		rejected.Inc("invalid")
+		return http.StatusUnauthorized, nil
+	}
+	for _, scope := range rule.Scopes {
+		if !key.HasScope(scope) {
+			rejected.Inc("scope")
+			return http.StatusForbidden, nil
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.RemoteUserCtxKey, key.ID))
+	return a.Next.ServeHTTP(w, r)
+}
+
+// ruleFor returns the rule with the longest path that urlPath is
+// in, if any.
+func (a APIKeys) ruleFor(urlPath string) *Rule {
+	var found *Rule
+	for i, rule := range a.Rules {
+		if httpserver.Path(urlPath).Matches(rule.Path) &&
+			(found == nil || len(rule.Path) > len(found.Path)) {
+			found = &a.Rules[i]
+		}
+	}
+	return found
+}
@@ -0,0 +1,74 @@
+package apikeys
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestAPIKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStore(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reader, err := store.Issue("reader", []string{"read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, adminKey, err := store.Issue("admin", []string{"read", "admin"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var user string
+	a := APIKeys{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			user, _ = r.Context().Value(httpserver.RemoteUserCtxKey).(string)
+			return http.StatusOK, nil
+		}),
+		Store:  store,
+		Header: DefaultHeader,
+		Rules:  []Rule{{Path: "/api", Scopes: []string{"read"}}, {Path: "/api/admin", Scopes: []string{"admin"}}},
+	}
+
+	for i, test := range []struct {
+		path     string
+		key      string
+		expected int
+	}{
+		{"/public", "", http.StatusOK},
+		{"/api/items", "", http.StatusUnauthorized},
+		{"/api/items", "bogus", http.StatusUnauthorized},
+		{"/api/items", reader, http.StatusOK},
+		{"/api/admin/users", reader, http.StatusForbidden},
+		{"/api/admin/users", adminKey, http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.key != "" {
+			req.Header.Set(DefaultHeader, test.key)
+		}
+		status, _ := a.ServeHTTP(httptest.NewRecorder(), req)
+		if status != test.expected {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expected, status)
+		}
+	}
+	if user != admin.ID {
+		t.Errorf("Expected the user to be the ID of the key, %s, got %s", admin.ID, user)
+	}
+
+	a.Header, a.Query = "", "api_key"
+	req := httptest.NewRequest("GET", "/api/items?api_key="+reader, nil)
+	if status, _ := a.ServeHTTP(httptest.NewRecorder(), req); status != http.StatusOK {
+		t.Errorf("Expected a key in the query to be accepted, got %d", status)
+	}
+}
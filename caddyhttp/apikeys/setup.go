@@ -0,0 +1,96 @@
+package apikeys
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("api_keys", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// DefaultHeader is the header with the key when no other is given.
+const DefaultHeader = "X-API-Key"
+
+// setup configures a new APIKeys middleware instance.
+func setup(c *caddy.Controller) error {
+	a, file, err := apiKeysParse(c)
+	if err != nil {
+		return err
+	}
+	if a.Store, err = storeFor(file); err != nil {
+		return c.Err(err.Error())
+	}
+	// keys are issued and revoked once listening, also in a sandbox
+	caddy.RegisterWritablePath(file)
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		h := a
+		h.Next = next
+		return h
+	})
+
+	return nil
+}
+
+// apiKeysParse parses
+//
+//	api_keys file {
+//		key     header|query name
+//		require path [scopes...]
+//	}
+//
+// where the file holds the keys, and requests for the paths required
+// must have a valid key with all of the scopes; without require, all
+// of them must. The key is in the X-API-Key header by default. It
+// returns the file too.
+func apiKeysParse(c *caddy.Controller) (APIKeys, string, error) {
+	a := APIKeys{Header: DefaultHeader}
+	var file string
+
+	for c.Next() {
+		if file != "" {
+			return a, "", c.Err("api_keys may only be given once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return a, "", c.ArgErr()
+		}
+		file = args[0]
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "key":
+				if len(args) != 2 {
+					return a, "", c.ArgErr()
+				}
+				switch args[0] {
+				case "header":
+					a.Header, a.Query = args[1], ""
+				case "query":
+					a.Header, a.Query = "", args[1]
+				default:
+					return a, "", c.Errf("api_keys key must be in a header or query parameter, not '%s'", args[0])
+				}
+			case "require":
+				if len(args) == 0 {
+					return a, "", c.ArgErr()
+				}
+				a.Rules = append(a.Rules, Rule{Path: args[0], Scopes: args[1:]})
+			default:
+				return a, "", c.Errf("Unknown api_keys property '%s'", what)
+			}
+		}
+
+		if len(a.Rules) == 0 {
+			a.Rules = []Rule{{Path: "/"}}
+		}
+	}
+
+	return a, file, nil
+}
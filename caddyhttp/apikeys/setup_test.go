@@ -0,0 +1,103 @@
+package apikeys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "keys.json")
+
+	c := caddy.NewTestController("http", "api_keys "+file)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(APIKeys)
+	if !ok {
+		t.Fatalf("Expected handler to be type APIKeys, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if s, err := Lookup(file); err != nil || s != myHandler.Store {
+		t.Errorf("Expected the store to be registered, got %v", err)
+	}
+	if !caddy.Writable(file) {
+		t.Error("Expected the keys file to be writable once privileges are dropped")
+	}
+}
+
+func TestAPIKeysParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		file      string
+		header    string
+		query     string
+		rules     []Rule
+	}{
+		{`api_keys keys.json`, false, "keys.json", DefaultHeader, "", []Rule{{Path: "/"}}},
+		{`api_keys keys.json {
+			key query api_key
+			require /api read
+			require /api/admin read admin
+		}`, false, "keys.json", "", "api_key", []Rule{
+			{Path: "/api", Scopes: []string{"read"}},
+			{Path: "/api/admin", Scopes: []string{"read", "admin"}},
+		}},
+		{`api_keys keys.json {
+			key header Authorization
+		}`, false, "keys.json", "Authorization", "", []Rule{{Path: "/"}}},
+		{`api_keys`, true, "", "", "", nil},
+		{`api_keys a.json b.json`, true, "", "", "", nil},
+		{`api_keys keys.json {
+			require
+		}`, true, "", "", "", nil},
+		{`api_keys keys.json {
+			key cookie id
+		}`, true, "", "", "", nil},
+		{`api_keys keys.json {
+			foo
+		}`, true, "", "", "", nil},
+		{"api_keys a.json\napi_keys b.json", true, "", "", "", nil},
+	}
+	for i, test := range tests {
+		a, file, err := apiKeysParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr || err != nil {
+			continue
+		}
+		if file != test.file || a.Header != test.header || a.Query != test.query {
+			t.Errorf("Test %d: expected file %s, header %q and query %q, got %s, %q and %q",
+				i, test.file, test.header, test.query, file, a.Header, a.Query)
+		}
+		if len(a.Rules) != len(test.rules) {
+			t.Fatalf("Test %d: expected %d rules, got %d", i, len(test.rules), len(a.Rules))
+		}
+		for j, rule := range a.Rules {
+			if rule.Path != test.rules[j].Path || len(rule.Scopes) != len(test.rules[j].Scopes) {
+				t.Errorf("Test %d: expected rule %d to be %+v, got %+v", i, j, test.rules[j], rule)
+			}
+		}
+	}
+}
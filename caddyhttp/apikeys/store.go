@@ -0,0 +1,298 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors of looking up stores and keys.
+var (
+	ErrNoKey   = errors.New("api keys: no such key")
+	ErrNoStore = errors.New("api keys: no such keys file")
+)
+
+// Key is an API key as it is stored: only the hash of its secret is
+// kept, so the key itself is only known when it is issued.
+type Key struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name,omitempty"`
+	Hash    string     `json:"hash,omitempty"`
+	Scopes  []string   `json:"scopes,omitempty"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// expired returns whether k has expired at t.
+func (k *Key) expired(t time.Time) bool {
+	return k.Expires != nil && !t.Before(*k.Expires)
+}
+
+// HasScope returns whether k has scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is the keys in a file, which is read again when it changes,
+// such as when another instance issues or revokes keys.
+type Store struct {
+	File string
+
+	mu      sync.Mutex
+	keys    map[string]*Key // by ID
+	modTime time.Time
+	checked time.Time
+}
+
+// reloadInterval is how often the file of a store is checked for
+// changes, at most.
+const reloadInterval = 5 * time.Second
+
+// NewStore returns the store of the keys in file, which is created
+// when the first key is issued if it doesn't exist.
+func NewStore(file string) (*Store, error) {
+	s := &Store{File: file, keys: make(map[string]*Key)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the file of s. s.mu must be locked or s not yet shared.
+func (s *Store) load() error {
+	fi, err := os.Stat(s.File)
+	if os.IsNotExist(err) {
+		s.keys = make(map[string]*Key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadFile(s.File)
+	if err != nil {
+		return err
+	}
+	var list []*Key
+	if err := json.Unmarshal(body, &list); err != nil {
+		return errors.New("api keys: " + s.File + ": " + err.Error())
+	}
+	keys := make(map[string]*Key, len(list))
+	for _, k := range list {
+		keys[k.ID] = k
+	}
+	s.keys, s.modTime = keys, fi.ModTime()
+	return nil
+}
+
+// refresh reads the file of s again if it changed since it was
+// last read. s.mu must be locked.
+func (s *Store) refresh() error {
+	t := time.Now()
+	if t.Sub(s.checked) < reloadInterval {
+		return nil
+	}
+	s.checked = t
+	fi, err := os.Stat(s.File)
+	if err != nil || fi.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	return s.load()
+}
+
+// save writes the keys of s to its file, replacing it atomically.
+// s.mu must be locked.
+func (s *Store) save() error {
+	list := make([]*Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	body, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.File), ".apikeys")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.File); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if fi, err := os.Stat(s.File); err == nil {
+		s.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+// Issue makes a new key with name and scopes that expires after ttl,
+// or never if ttl is 0, and returns a copy of it along with the key
+// itself, which is not stored.
+func (s *Store) Issue(name string, scopes []string, ttl time.Duration) (*Key, string, error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	k := &Key{
+		ID:      hex.EncodeToString(id),
+		Name:    name,
+		Scopes:  scopes,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	if ttl > 0 {
+		expires := k.Created.Add(ttl)
+		k.Expires = &expires
+	}
+	raw := base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hash(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, "", err
+	}
+	s.keys[k.ID] = k
+	if err := s.save(); err != nil {
+		delete(s.keys, k.ID)
+		return nil, "", err
+	}
+	issued := *k
+	return &issued, k.ID + "." + raw, nil
+}
+
+// Revoke removes the key with id.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrNoKey
+	}
+	delete(s.keys, id)
+	if err := s.save(); err != nil {
+		s.keys[id] = k
+		return err
+	}
+	return nil
+}
+
+// Keys returns the keys of s, sorted by ID.
+func (s *Store) Keys() []Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	list := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, *k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Validate returns the key that key is, if it is one of s and has
+// not expired.
+func (s *Store) Validate(key string) (*Key, bool) {
+	dot := strings.IndexByte(key, '.')
+	if dot < 0 {
+		return nil, false
+	}
+	s.mu.Lock()
+	s.refresh()
+	k, ok := s.keys[key[:dot]]
+	s.mu.Unlock()
+	if !ok || k.expired(time.Now()) {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(key[dot+1:])), []byte(k.Hash)) != 1 {
+		return nil, false
+	}
+	return k, true
+}
+
+// hash returns the hash of the secret of a key, as it is stored.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// stores are the stores of the sites that require keys, by file, for
+// managing keys through the admin API.
+var (
+	stores   = make(map[string]*Store)
+	storesMu sync.Mutex
+)
+
+// storeFor returns the store of file, which is shared by the sites
+// that use it.
+func storeFor(file string) (*Store, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[file]; ok {
+		s.mu.Lock()
+		err := s.load()
+		s.mu.Unlock()
+		return s, err
+	}
+	s, err := NewStore(file)
+	if err != nil {
+		return nil, err
+	}
+	stores[file] = s
+	return s, nil
+}
+
+// Lookup returns the store of the keys file file, or the only store
+// if file is empty and there is just one.
+func Lookup(file string) (*Store, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if file != "" {
+		s, ok := stores[file]
+		if !ok {
+			return nil, ErrNoStore
+		}
+		return s, nil
+	}
+	if len(stores) == 0 {
+		return nil, ErrNoStore
+	}
+	if len(stores) > 1 {
+		return nil, errors.New("api keys: more than one keys file; give the file")
+	}
+	for _, s := range stores {
+		return s, nil
+	}
+	return nil, ErrNoStore
+}
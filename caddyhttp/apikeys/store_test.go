@@ -0,0 +1,112 @@
+package apikeys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "keys.json")
+
+	s, err := NewStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, raw, err := s.Issue("ci", []string{"read", "write"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, k.ID+".") || k.Expires != nil {
+		t.Errorf("Unexpected key %s: %+v", raw, k)
+	}
+
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), raw[len(k.ID)+1:]) {
+		t.Error("Expected the key not to be stored")
+	}
+
+	// the key returned is a copy, so changing it changes nothing stored
+	k.Hash = ""
+	got, ok := s.Validate(raw)
+	if !ok || got.ID != k.ID || !got.HasScope("write") || got.HasScope("admin") {
+		t.Errorf("Expected the key to be valid with its scopes, got %+v, %v", got, ok)
+	}
+	for _, bad := range []string{"", "nodot", k.ID + ".wrong", "000000000000." + raw[len(k.ID)+1:]} {
+		if _, ok := s.Validate(bad); ok {
+			t.Errorf("Expected %q to be invalid", bad)
+		}
+	}
+
+	// another store of the same file sees the key
+	other, err := NewStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.Validate(raw); !ok {
+		t.Error("Expected the key to be valid in another store of the file")
+	}
+
+	if err := s.Revoke(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Validate(raw); ok {
+		t.Error("Expected a revoked key to be invalid")
+	}
+	if err := s.Revoke(k.ID); err != ErrNoKey {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+	if len(s.Keys()) != 0 {
+		t.Errorf("Expected no keys, got %v", s.Keys())
+	}
+}
+
+func TestKeyExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, raw, err := s.Issue("", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Validate(raw); !ok {
+		t.Error("Expected the key to be valid before it expires")
+	}
+	past := time.Now().Add(-time.Minute)
+	s.keys[k.ID].Expires = &past
+	if _, ok := s.Validate(raw); ok {
+		t.Error("Expected an expired key to be invalid")
+	}
+}
+
+func TestBadKeysFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not json")
+	f.Close()
+
+	if _, err := NewStore(f.Name()); err == nil {
+		t.Error("Expected an error for a bad keys file")
+	}
+}
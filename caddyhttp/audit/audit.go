@@ -0,0 +1,271 @@
+// Package audit implements the audit directive, which records the
+// requests to selected paths together with their responses, with
+// bodies bounded in size and secrets redacted, in an audit store.
+package audit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// redacted replaces the values of redacted headers and fields.
+const redacted = "REDACTED"
+
+// Audit is middleware that records transactions.
+type Audit struct {
+	Next  httpserver.Handler
+	Site  string
+	Paths []string
+
+	// MaxBody is the most of each request and response body that
+	// is recorded.
+	MaxBody int64
+
+	// RedactHeaders are the canonical names of the headers whose
+	// values are redacted, and RedactFields the names of the fields
+	// of JSON and form bodies whose values are.
+	RedactHeaders []string
+	RedactFields  []string
+
+	Sink Sink
+}
+
+// Record is a recorded transaction.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Site       string    `json:"site"`
+	RequestID  string    `json:"request_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Request    Message   `json:"request"`
+	Response   Message   `json:"response"`
+	Duration   float64   `json:"duration"` // in seconds
+}
+
+// Message is a request or response of a recorded transaction.
+type Message struct {
+	Method string      `json:"method,omitempty"`
+	URI    string      `json:"uri,omitempty"`
+	Proto  string      `json:"proto,omitempty"`
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header"`
+
+	// Body is what's recorded of the body, encoded as base64 if it
+	// isn't text. It is omitted if fields were to be redacted from
+	// it but it could not be parsed, such as when it's truncated or
+	// neither JSON nor a form.
+	Body      string `json:"body,omitempty"`
+	Base64    bool   `json:"base64,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Omitted   bool   `json:"omitted,omitempty"`
+}
+
+// ServeHTTP records the transaction if the path of r is audited.
+func (a Audit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !a.audited(r.URL.Path) {
+		return a.Next.ServeHTTP(w, r)
+	}
+
+	// one byte more than is recorded tells whether it's truncated
+	body, err := httpserver.BufferBody(r, a.MaxBody+1)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	rec := Record{
+		Time:       time.Now().UTC(),
+		Site:       a.Site,
+		RemoteAddr: r.RemoteAddr,
+		Request: Message{
+			Method: r.Method,
+			URI:    a.redactURI(r.URL),
+			Proto:  r.Proto,
+			Header: a.redactHeader(r.Header),
+		},
+	}
+	rec.RequestID, _ = r.Context().Value(httpserver.RequestIDCtxKey).(string)
+
+	t := &tee{ResponseRecorder: httpserver.NewResponseRecorder(w), limit: a.MaxBody}
+	status, err := a.Next.ServeHTTP(t, r)
+
+	rec.Duration = time.Since(rec.Time).Seconds()
+	buffered, bodyErr := body.Bytes()
+	if bodyErr == nil {
+		truncated := int64(len(buffered)) > a.MaxBody
+		if truncated {
+			buffered = buffered[:a.MaxBody]
+		}
+		a.setBody(&rec.Request, buffered, truncated, r.Header.Get("Content-Type"))
+	} else {
+		rec.Request.Omitted = true
+	}
+	rec.Response.Status = status
+	if status == 0 {
+		rec.Response.Status = t.Status()
+	}
+	rec.Response.Header = a.redactHeader(t.Header())
+	a.setBody(&rec.Response, t.body.Bytes(), t.truncated, t.Header().Get("Content-Type"))
+
+	a.Sink.Audit(rec)
+	return status, err
+}
+
+// audited returns whether requests for path are recorded.
+func (a Audit) audited(path string) bool {
+	for _, p := range a.Paths {
+		if httpserver.Path(path).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeader returns a copy of h with the values of the redacted
+// headers replaced.
+func (a Audit) redactHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for field, values := range h {
+		out[field] = append([]string(nil), values...)
+	}
+	for _, field := range a.RedactHeaders {
+		if values, ok := out[field]; ok {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return out
+}
+
+// setBody sets the body of m to body, of the given content type,
+// redacting its fields.
+func (a Audit) setBody(m *Message, body []byte, truncated bool, contentType string) {
+	m.Truncated = truncated
+	if len(body) == 0 {
+		return
+	}
+	if len(a.RedactFields) > 0 {
+		var ok bool
+		if body, ok = a.redactBody(body, contentType); !ok {
+			m.Omitted = true
+			return
+		}
+	}
+	if utf8.Valid(body) {
+		m.Body = string(body)
+	} else {
+		m.Body, m.Base64 = base64.StdEncoding.EncodeToString(body), true
+	}
+}
+
+// redactBody returns body, of the given content type, with the values
+// of the redacted fields replaced, and whether it could be parsed, as
+// JSON or a form, to redact them.
+func (a Audit) redactBody(body []byte, contentType string) ([]byte, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, false
+		}
+		out, err := json.Marshal(a.redactJSON(v))
+		return out, err == nil
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, false
+		}
+		for field, values := range form {
+			if a.redactedField(field) {
+				for i := range values {
+					values[i] = redacted
+				}
+			}
+		}
+		return []byte(form.Encode()), true
+	}
+	// the fields of other bodies, such as multipart forms, can't
+	// be found to redact them
+	return nil, false
+}
+
+// redactURI returns the request URI of u with the values of the
+// redacted fields of its query replaced.
+func (a Audit) redactURI(u *url.URL) string {
+	if len(a.RedactFields) == 0 || u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	redactedURL := *u
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		// what can't be parsed can't be redacted in part
+		redactedURL.RawQuery = redacted
+		return redactedURL.RequestURI()
+	}
+	for field, values := range query {
+		if a.redactedField(field) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.RequestURI()
+}
+
+// redactJSON replaces the values of the redacted fields in v, at any
+// depth.
+func (a Audit) redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for field, value := range v {
+			if a.redactedField(field) {
+				v[field] = redacted
+			} else {
+				v[field] = a.redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = a.redactJSON(value)
+		}
+	}
+	return v
+}
+
+func (a Audit) redactedField(field string) bool {
+	for _, f := range a.RedactFields {
+		if strings.EqualFold(f, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// tee is a response writer that keeps a copy of up to limit bytes of
+// the body it writes.
+type tee struct {
+	*httpserver.ResponseRecorder
+	body      bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (t *tee) Write(p []byte) (int, error) {
+	room := t.limit - int64(t.body.Len())
+	if int64(len(p)) > room {
+		t.body.Write(p[:room])
+		t.truncated = true
+	} else {
+		t.body.Write(p)
+	}
+	return t.ResponseRecorder.Write(p)
+}
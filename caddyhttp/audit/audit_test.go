@@ -0,0 +1,192 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+type recordSink []Record
+
+func (s *recordSink) Audit(rec Record) {
+	*s = append(*s, rec)
+}
+
+func TestAudit(t *testing.T) {
+	var sink recordSink
+	a := Audit{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=secret")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"echo":` + string(body) + `}`))
+			return 0, nil
+		}),
+		Site:          "audit-test",
+		Paths:         []string{"/api"},
+		MaxBody:       64,
+		RedactHeaders: defaultRedactHeaders,
+		RedactFields:  []string{"password"},
+		Sink:          &sink,
+	}
+
+	for i, test := range []struct {
+		path, body   string
+		expectRecord bool
+	}{
+		{"/", `{"user":"a","password":"b"}`, false},
+		{"/api/login", `{"user":"a","password":"b"}`, true},
+	} {
+		sink = nil
+		r := httptest.NewRequest("POST", test.path, strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		if _, err := a.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+		if expect := `{"echo":` + test.body + `}`; w.Body.String() != expect {
+			t.Errorf("Test %d: expected the response %s, got %s", i, expect, w.Body.String())
+		}
+		if !test.expectRecord {
+			if len(sink) != 0 {
+				t.Errorf("Test %d: expected no record, got %v", i, sink)
+			}
+			continue
+		}
+		if len(sink) != 1 {
+			t.Fatalf("Test %d: expected a record, got %d", i, len(sink))
+		}
+		rec := sink[0]
+		if rec.Site != "audit-test" || rec.Request.Method != "POST" || rec.Request.URI != test.path {
+			t.Errorf("Test %d: unexpected record %+v", i, rec)
+		}
+		if rec.Request.Body != `{"password":"REDACTED","user":"a"}` {
+			t.Errorf("Test %d: expected the password redacted from the request, got %s", i, rec.Request.Body)
+		}
+		if rec.Response.Body != `{"echo":{"password":"REDACTED","user":"a"}}` {
+			t.Errorf("Test %d: expected the password redacted from the response, got %s", i, rec.Response.Body)
+		}
+		if rec.Response.Status != http.StatusCreated {
+			t.Errorf("Test %d: expected status %d, got %d", i, http.StatusCreated, rec.Response.Status)
+		}
+		if got := rec.Request.Header.Get("Authorization"); got != redacted {
+			t.Errorf("Test %d: expected the Authorization header redacted, got %s", i, got)
+		}
+		if got := rec.Response.Header.Get("Set-Cookie"); got != redacted {
+			t.Errorf("Test %d: expected the Set-Cookie header redacted, got %s", i, got)
+		}
+		if got := w.Header().Get("Set-Cookie"); got != "session=secret" {
+			t.Errorf("Test %d: expected the response itself not redacted, got %s", i, got)
+		}
+	}
+}
+
+func TestAuditBodies(t *testing.T) {
+	for i, test := range []struct {
+		contentType  string
+		body         string
+		maxBody      int64
+		redact       bool
+		expectBody   string
+		expectBase64 bool
+		expectTrunc  bool
+		expectOmit   bool
+	}{
+		{"text/plain", "hello", 8, false, "hello", false, false, false},
+		{"text/plain", "hello, world", 8, false, "hello, w", false, true, false},
+		{"text/plain", "password=b", 64, true, "", false, false, true}, // can't be redacted
+		{"application/octet-stream", "\xff\xfe", 8, false, "//4=", true, false, false},
+		{"application/octet-stream", "\xff\xfe", 8, true, "", false, false, true},
+		{"multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"password\"\r\n\r\nb\r\n--x--\r\n", 256, true, "", false, false, true},
+		{"application/x-www-form-urlencoded", "user=a&password=b", 64, true, "password=REDACTED&user=a", false, false, false},
+		{"application/json", `{"password":1}`, 64, true, `{"password":"REDACTED"}`, false, false, false},
+		{"application/vnd.api+json", `[{"a":{"Password":1}}]`, 64, true, `[{"a":{"Password":"REDACTED"}}]`, false, false, false},
+		{"application/json", `{"pass`, 64, true, "", false, false, true},
+		{"application/json", `{"user":"abcdef"}`, 8, true, "", false, true, true},
+	} {
+		var sink recordSink
+		a := Audit{
+			Next:    httpserver.EmptyNext,
+			Paths:   []string{"/"},
+			MaxBody: test.maxBody,
+			Sink:    &sink,
+		}
+		if test.redact {
+			a.RedactFields = []string{"password"}
+		}
+		r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		a.ServeHTTP(httptest.NewRecorder(), r)
+
+		m := sink[0].Request
+		if m.Body != test.expectBody || m.Base64 != test.expectBase64 || m.Truncated != test.expectTrunc || m.Omitted != test.expectOmit {
+			t.Errorf("Test %d: expected body %q (base64 %t, truncated %t, omitted %t), got %+v",
+				i, test.expectBody, test.expectBase64, test.expectTrunc, test.expectOmit, m)
+		}
+	}
+}
+
+func TestAuditURI(t *testing.T) {
+	for i, test := range []struct {
+		uri    string
+		expect string
+	}{
+		{"/login", "/login"},
+		{"/login?user=a", "/login?user=a"},
+		{"/login?user=a&password=b", "/login?password=REDACTED&user=a"},
+		{"/login?PASSWORD=b&PASSWORD=c", "/login?PASSWORD=REDACTED&PASSWORD=REDACTED"},
+		{"/login?password=%zz", "/login?REDACTED"},
+	} {
+		var sink recordSink
+		a := Audit{
+			Next:         httpserver.EmptyNext,
+			Paths:        []string{"/"},
+			RedactFields: []string{"password"},
+			Sink:         &sink,
+		}
+		a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.uri, nil))
+		if got := sink[0].Request.URI; got != test.expect {
+			t.Errorf("Test %d: expected URI %s, got %s", i, test.expect, got)
+		}
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	received := make(chan []string, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "key" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- strings.Split(strings.TrimSpace(string(body)), "\n")
+	}))
+	defer collector.Close()
+
+	s := NewHTTPSink(collector.URL, http.Header{"Authorization": {"key"}})
+	s.Start()
+	s.Audit(Record{Site: "a", Time: time.Now()})
+	s.Audit(Record{Site: "b", Time: time.Now()})
+	s.Stop()
+
+	select {
+	case lines := <-received:
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 records, got %d", len(lines))
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil || rec.Site != "b" {
+			t.Errorf("Expected the second record for site b, got %s (%v)", lines[1], err)
+		}
+	default:
+		t.Fatal("Expected the records to be sent when the sink stopped")
+	}
+}
@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("audit", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultMaxBody is the most of each body that is recorded by default.
+const defaultMaxBody = 64 << 10
+
+// defaultRedactHeaders are the headers that are always redacted.
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// config is the parsed audit directive.
+type config struct {
+	handler Audit
+	to      string
+	headers http.Header
+	roller  *httpserver.LogRoller
+}
+
+// setup configures a new Audit middleware instance. The sites of a
+// server block share one sink.
+func setup(c *caddy.Controller) error {
+	cfg, err := auditParse(c)
+	if err != nil {
+		return err
+	}
+	handler := cfg.handler
+	handler.Site = httpserver.GetConfig(c).Addr.String()
+
+	sink, ok := c.ServerBlockStorage.(Sink)
+	if !ok {
+		if u, err := url.Parse(cfg.to); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			s := NewHTTPSink(cfg.to, cfg.headers)
+			c.OnStartup(s.Start)
+			c.OnShutdown(s.Stop)
+			sink = s
+		} else {
+			l := &httpserver.Logger{Output: cfg.to, Roller: cfg.roller}
+			l.Attach(c)
+			sink = FileSink{Log: l}
+		}
+		c.ServerBlockStorage = sink
+	}
+	handler.Sink = sink
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		handler.Next = next
+		return handler
+	})
+
+	return nil
+}
+
+// auditParse parses
+//
+//	audit [paths...] {
+//		to            file|url
+//		max_body      size
+//		redact_header names...
+//		redact_field  names...
+//		header        name value
+//	}
+//
+// where the transactions for the paths, / by default, are stored in
+// the file, which may also be stdout, stderr or syslog, and rolled
+// with the log roller subdirectives, or are posted to the URL with
+// the headers. Up to max_body, 64KB by default, of each body is
+// recorded. The Authorization, Proxy-Authorization, Cookie and
+// Set-Cookie headers are always redacted, and the named fields of
+// query strings, and of JSON and form bodies at any depth, are
+// redacted; other bodies are then omitted, as they can't be.
+func auditParse(c *caddy.Controller) (config, error) {
+	cfg := config{
+		handler: Audit{
+			MaxBody:       defaultMaxBody,
+			RedactHeaders: append([]string(nil), defaultRedactHeaders...),
+		},
+		headers: make(http.Header),
+		roller:  httpserver.DefaultLogRoller(),
+	}
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return cfg, c.Err("audit may only be given once per site")
+		}
+		parsed = true
+		cfg.handler.Paths = c.RemainingArgs()
+		if len(cfg.handler.Paths) == 0 {
+			cfg.handler.Paths = []string{"/"}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "to":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				cfg.to = args[0]
+			case "max_body":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(args[0])
+				if err != nil {
+					return cfg, c.Errf("invalid max_body '%s': %v", args[0], err)
+				}
+				cfg.handler.MaxBody = int64(size)
+			case "redact_header":
+				if len(args) == 0 {
+					return cfg, c.ArgErr()
+				}
+				for _, arg := range args {
+					cfg.handler.RedactHeaders = append(cfg.handler.RedactHeaders, http.CanonicalHeaderKey(arg))
+				}
+			case "redact_field":
+				if len(args) == 0 {
+					return cfg, c.ArgErr()
+				}
+				cfg.handler.RedactFields = append(cfg.handler.RedactFields, args...)
+			case "header":
+				if len(args) != 2 {
+					return cfg, c.ArgErr()
+				}
+				cfg.headers.Add(args[0], args[1])
+			default:
+				if !httpserver.IsLogRollerSubdirective(what) {
+					return cfg, c.Errf("Unknown audit property '%s'", what)
+				}
+				if err := httpserver.ParseRoller(cfg.roller, what, args...); err != nil {
+					return cfg, err
+				}
+			}
+		}
+	}
+
+	if parsed && cfg.to == "" {
+		return cfg, c.Err("audit requires a store to be given with 'to'")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input      string
+		expectHTTP bool
+	}{
+		{"audit {\n to audit.log\n}", false},
+		{"audit /api {\n to https://collector/audit\n header Authorization key\n}", true},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		if err := setup(c); err != nil {
+			t.Fatalf("Test %d: expected no errors, got: %v", i, err)
+		}
+		mids := httpserver.GetConfig(c).Middleware()
+		if len(mids) == 0 {
+			t.Fatalf("Test %d: expected middleware, had 0 instead", i)
+		}
+		handler := mids[0](httpserver.EmptyNext)
+		myHandler, ok := handler.(Audit)
+		if !ok {
+			t.Fatalf("Test %d: expected handler to be type Audit, got: %#v", i, handler)
+		}
+		if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+			t.Errorf("Test %d: 'Next' field of handler was not set properly", i)
+		}
+		if _, isHTTP := myHandler.Sink.(*HTTPSink); isHTTP != test.expectHTTP {
+			t.Errorf("Test %d: expected an HTTP sink %t, got %T", i, test.expectHTTP, myHandler.Sink)
+		}
+	}
+}
+
+func TestAuditParse(t *testing.T) {
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		expectPaths   []string
+		expectMaxBody int64
+		expectHeaders int
+		expectFields  int
+	}{
+		{"audit {\n to stdout\n}", false, []string{"/"}, defaultMaxBody, 4, 0},
+		{`audit /api /admin {
+			to            /var/log/audit.log
+			max_body      1MB
+			redact_header X-Api-Key
+			redact_field  password card_number
+			rotate_size   100
+		}`, false, []string{"/api", "/admin"}, 1000000, 5, 2},
+		{`audit`, true, nil, 0, 0, 0},
+		{"audit {\n to\n}", true, nil, 0, 0, 0},
+		{"audit {\n to stdout\n max_body lots\n}", true, nil, 0, 0, 0},
+		{"audit {\n to stdout\n redact_field\n}", true, nil, 0, 0, 0},
+		{"audit {\n to stdout\n header X-Key\n}", true, nil, 0, 0, 0},
+		{"audit {\n to stdout\n record everything\n}", true, nil, 0, 0, 0},
+		{"audit {\n to stdout\n}\naudit {\n to stderr\n}", true, nil, 0, 0, 0},
+	} {
+		cfg, err := auditParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		h := cfg.handler
+		if strings.Join(h.Paths, " ") != strings.Join(test.expectPaths, " ") {
+			t.Errorf("Test %d: expected paths %v, got %v", i, test.expectPaths, h.Paths)
+		}
+		if h.MaxBody != test.expectMaxBody {
+			t.Errorf("Test %d: expected max body %d, got %d", i, test.expectMaxBody, h.MaxBody)
+		}
+		if len(h.RedactHeaders) != test.expectHeaders || len(h.RedactFields) != test.expectFields {
+			t.Errorf("Test %d: expected %d redacted headers and %d fields, got %v and %v",
+				i, test.expectHeaders, test.expectFields, h.RedactHeaders, h.RedactFields)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var droppedTotal = metrics.NewCounter("caddy_http_audit_dropped_total",
+	"Number of audit records dropped because they could not be stored.")
+
+// Sink is an audit store.
+type Sink interface {
+	Audit(Record)
+}
+
+// FileSink stores records as lines of JSON in a log, which may be a
+// rolled file, stdout, stderr or syslog.
+type FileSink struct {
+	Log *httpserver.Logger
+}
+
+// Audit writes rec to the log.
+func (s FileSink) Audit(rec Record) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		droppedTotal.Inc()
+		log.Printf("[ERROR] audit: encoding record: %v", err)
+		return
+	}
+	s.Log.Println(string(line))
+}
+
+// HTTP sink batching settings.
+const (
+	batchSize     = 100
+	queueSize     = 4096
+	flushInterval = time.Second
+)
+
+// HTTPSink sends records in batches, as lines of JSON, to a
+// collector.
+type HTTPSink struct {
+	Endpoint string
+	Headers  http.Header
+
+	client  *http.Client
+	queue   chan Record
+	stop    chan struct{}
+	stopped chan struct{}
+	started bool
+	mu      sync.Mutex
+}
+
+// NewHTTPSink returns a sink that posts records to endpoint, adding
+// headers to each request.
+func NewHTTPSink(endpoint string, headers http.Header) *HTTPSink {
+	return &HTTPSink{
+		Endpoint: endpoint,
+		Headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan Record, queueSize),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Start starts sending queued records in the background.
+func (s *HTTPSink) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		s.started = true
+		go s.run()
+	}
+	return nil
+}
+
+// Stop sends any queued records and stops the sink.
+// A sink cannot be restarted once stopped.
+func (s *HTTPSink) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return nil
+	}
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.stopped
+	return nil
+}
+
+// Audit queues rec to be sent. If the queue is full, as it may be
+// when the collector is unreachable, the record is dropped.
+func (s *HTTPSink) Audit(rec Record) {
+	select {
+	case s.queue <- rec:
+	default:
+		droppedTotal.Inc()
+	}
+}
+
+func (s *HTTPSink) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []Record
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(batch); err != nil {
+			droppedTotal.Add(float64(len(batch)))
+			log.Printf("[ERROR] audit: sending %d records to %s: %v", len(batch), s.Endpoint, err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case rec := <-s.queue:
+			batch = append(batch, rec)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.stop:
+			for {
+				select {
+				case rec := <-s.queue:
+					batch = append(batch, rec)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *HTTPSink) send(batch []Record) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, rec := range batch {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest("POST", s.Endpoint, &body)
+	if err != nil {
+		return err
+	}
+	for field, values := range s.Headers {
+		req.Header[field] = values
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
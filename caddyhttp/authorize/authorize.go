@@ -0,0 +1,298 @@
+// Package authorize is middleware that allows or denies requests
+// according to policies: rules with conditions on who made a request,
+// as authenticated by basicauth, oidc or a client certificate, on
+// what was requested, and on when, by time windows that can also
+// turn maintenance mode on.
+package authorize
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Authorize is middleware that enforces policies.
+type Authorize struct {
+	Next     httpserver.Handler
+	Policies []*Policy
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a Authorize) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var windows []string
+	t := now()
+	for _, p := range a.Policies {
+		windows = append(windows, p.openWindows(t)...)
+	}
+	if len(windows) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.WindowsCtxKey, windows))
+		httpserver.SetPlaceholder(r, "window", strings.Join(windows, ","))
+	}
+	for _, p := range a.Policies {
+		if !p.Allows(r) {
+			return http.StatusForbidden, nil
+		}
+	}
+	return a.Next.ServeHTTP(w, r)
+}
+
+// Rule allows or denies requests with one of Methods for Path
+// that meet a condition.
+type Rule struct {
+	Allow   bool
+	Methods []string // empty for any method
+	Path    string
+	Cond    Expr // nil if the rule has no condition
+
+	// Source is the text of the rule, for logs.
+	Source string
+}
+
+// matches returns whether rule applies to r.
+func (rule Rule) matches(r *http.Request) bool {
+	if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+		return false
+	}
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, m := range rule.Methods {
+			if m == r.Method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return rule.Cond == nil || rule.Cond.eval(r)
+}
+
+// ParseRule parses a rule:
+//
+//	allow|deny <methods> <path> [if <condition>]
+//
+// where methods is * for any method, or a list of methods
+// separated by commas.
+func ParseRule(line string) (Rule, error) {
+	rule := Rule{Source: line}
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return rule, fmt.Errorf("rule must have an action, methods and a path: %s", line)
+	}
+	switch fields[0] {
+	case "allow":
+		rule.Allow = true
+	case "deny":
+	default:
+		return rule, fmt.Errorf("rule must start with allow or deny: %s", line)
+	}
+	if fields[1] != "*" {
+		for _, m := range strings.Split(fields[1], ",") {
+			if m == "" {
+				return rule, fmt.Errorf("empty method in rule: %s", line)
+			}
+			rule.Methods = append(rule.Methods, strings.ToUpper(m))
+		}
+	}
+	rule.Path = fields[2]
+	if !strings.HasPrefix(rule.Path, "/") {
+		return rule, fmt.Errorf("path must start with /: %s", line)
+	}
+
+	if len(fields) > 3 {
+		if fields[3] != "if" || len(fields) == 4 {
+			return rule, fmt.Errorf("expected if and a condition after the path: %s", line)
+		}
+		// the condition is the rest of the line, as written
+		rest := line
+		for _, f := range fields[:4] {
+			rest = rest[strings.Index(rest, f)+len(f):]
+		}
+		cond, err := Compile(rest)
+		if err != nil {
+			return rule, fmt.Errorf("%v: %s", err, line)
+		}
+		rule.Cond = cond
+	}
+	return rule, nil
+}
+
+// Policy is a list of rules, the first of which that applies to
+// a request decides whether it is allowed. Rules may be read from
+// a file, which is read again when it changes.
+type Policy struct {
+	// Rules are those of the Caddyfile, which come first.
+	Rules []Rule
+
+	// Default is whether requests that no rule applies to are
+	// allowed; a policy file can change it.
+	Default bool
+
+	// File is the file rules are read from, if any.
+	File string
+
+	// Interval is how often the file is checked for changes; if
+	// 0, it is only read at startup.
+	Interval time.Duration
+
+	// Windows are the time windows that rules can be conditioned
+	// on, in Location, or local time if it is nil.
+	Windows  []*Window
+	Location *time.Location
+
+	mu            sync.RWMutex
+	fileRules     []Rule
+	fileDef       *bool
+	modTime       time.Time
+	inMaintenance bool
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// Allows returns whether the policy allows r.
+func (p *Policy) Allows(r *http.Request) bool {
+	for _, rule := range p.Rules {
+		if rule.matches(r) {
+			return rule.Allow
+		}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, rule := range p.fileRules {
+		if rule.matches(r) {
+			return rule.Allow
+		}
+	}
+	if p.fileDef != nil {
+		return *p.fileDef
+	}
+	return p.Default
+}
+
+// maxPolicyFileSize bounds the size of policy files.
+const maxPolicyFileSize = 1 << 20
+
+// Load reads the rules of the policy file. Lines are rules, or
+//
+//	default allow|deny
+//
+// and blank lines and lines that start with # are ignored. If
+// the file is invalid, the rules read before stay in effect.
+func (p *Policy) Load() error {
+	if p.File == "" {
+		return nil
+	}
+	fi, err := os.Stat(p.File)
+	if err != nil {
+		return err
+	}
+	if fi.Size() > maxPolicyFileSize {
+		return fmt.Errorf("policy file %s is too large", p.File)
+	}
+	body, err := ioutil.ReadFile(p.File)
+	if err != nil {
+		return err
+	}
+
+	var rules []Rule
+	var def *bool
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Fields(line); fields[0] == "default" {
+			if len(fields) != 2 || (fields[1] != "allow" && fields[1] != "deny") {
+				return fmt.Errorf("%s:%d: expected default allow or default deny", p.File, n)
+			}
+			allow := fields[1] == "allow"
+			def = &allow
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", p.File, n, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	p.mu.Lock()
+	p.fileRules, p.fileDef, p.modTime = rules, def, fi.ModTime()
+	p.mu.Unlock()
+	return nil
+}
+
+// Start starts watching the policy file for changes, and turning
+// maintenance mode on and off as maintenance windows open and close.
+func (p *Policy) Start() error {
+	watch := p.File != "" && p.Interval > 0
+	schedule := p.hasMaintenanceWindow()
+	if !watch && !schedule {
+		return nil
+	}
+	p.stop = make(chan struct{})
+	if watch {
+		p.wg.Add(1)
+		go p.watch()
+	}
+	if schedule {
+		p.wg.Add(1)
+		go p.schedule()
+	}
+	return nil
+}
+
+// Stop stops what Start started.
+func (p *Policy) Stop() error {
+	if p.stop == nil {
+		return nil
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.stop = nil
+	return nil
+}
+
+func (p *Policy) watch() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fi, err := os.Stat(p.File)
+			if err != nil {
+				continue
+			}
+			p.mu.RLock()
+			changed := !fi.ModTime().Equal(p.modTime)
+			p.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := p.Load(); err != nil {
+				log.Printf("[ERROR] authorize: reloading policy: %v", err)
+				// don't try again until it changes again
+				p.mu.Lock()
+				p.modTime = fi.ModTime()
+				p.mu.Unlock()
+				continue
+			}
+			log.Printf("[INFO] authorize: reloaded policy %s", p.File)
+		case <-p.stop:
+			return
+		}
+	}
+}
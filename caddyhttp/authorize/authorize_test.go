@@ -0,0 +1,142 @@
+package authorize
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func mustRule(t *testing.T, line string) Rule {
+	rule, err := ParseRule(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func TestAuthorize(t *testing.T) {
+	a := Authorize{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Policies: []*Policy{{
+			Rules: []Rule{
+				mustRule(t, "allow GET,HEAD /public"),
+				mustRule(t, "allow * /admin if user in ['alice', 'bob']"),
+				mustRule(t, "deny DELETE /api"),
+				mustRule(t, "allow * /api if user"),
+			},
+		}},
+	}
+
+	for i, test := range []struct {
+		method, path, user string
+		expect             int
+	}{
+		{"GET", "/public/x", "", http.StatusOK},
+		{"POST", "/public/x", "", http.StatusForbidden},
+		{"GET", "/admin", "alice", http.StatusOK},
+		{"GET", "/admin", "carol", http.StatusForbidden},
+		{"GET", "/api/items", "carol", http.StatusOK},
+		{"DELETE", "/api/items", "alice", http.StatusForbidden},
+		{"GET", "/api/items", "", http.StatusForbidden},
+		{"GET", "/other", "alice", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.user != "" {
+			r = r.WithContext(context.WithValue(r.Context(), httpserver.RemoteUserCtxKey, test.user))
+		}
+		if code, _ := a.ServeHTTP(httptest.NewRecorder(), r); code != test.expect {
+			t.Errorf("Test %d: %s %s as %q: expected %d, got %d", i, test.method, test.path, test.user, test.expect, code)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule := mustRule(t, "deny post,put /api if  ip within '10.0.0.0/8'")
+	if rule.Allow || len(rule.Methods) != 2 || rule.Methods[0] != "POST" || rule.Path != "/api" || rule.Cond == nil {
+		t.Errorf("Unexpected rule: %+v", rule)
+	}
+
+	for i, line := range []string{
+		"allow /api",
+		"permit * /api",
+		"allow GET, /api",
+		"allow * api",
+		"allow * /api when user",
+		"allow * /api if",
+		"allow * /api if user ==",
+	} {
+		if _, err := ParseRule(line); err == nil {
+			t.Errorf("Test %d: %s: expected an error", i, line)
+		}
+	}
+}
+
+func TestPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_authorize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "policy")
+	write := func(body string, mod time.Time) {
+		if err := ioutil.WriteFile(file, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allows := func(p *Policy, path string) bool {
+		return p.Allows(httptest.NewRequest("GET", path, nil))
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("# the policy\n\ndeny * /private\ndefault allow\n", start)
+	p := &Policy{File: file, Interval: 10 * time.Millisecond, Rules: []Rule{mustRule(t, "allow * /private/ok")}}
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if allows(p, "/private/x") || !allows(p, "/private/ok") || !allows(p, "/other") {
+		t.Error("Expected the rules of the policy file and the Caddyfile")
+	}
+
+	p.Start()
+	defer p.Stop()
+
+	// a change is picked up
+	write("allow * /private\n", start.Add(time.Minute))
+	waitFor(t, func() bool { return allows(p, "/private/x") })
+	if allows(p, "/other") {
+		t.Error("Expected the default to be deny again")
+	}
+
+	// a bad change keeps the rules in effect
+	write("allow * /private if user ==\n", start.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if !allows(p, "/private/x") {
+		t.Error("Expected the rules to stay in effect after a bad change")
+	}
+
+	if err := (&Policy{File: file}).Load(); err == nil {
+		t.Error("Expected an error loading a bad policy file")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the policy to be reloaded")
+}
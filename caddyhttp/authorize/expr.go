@@ -0,0 +1,466 @@
+package authorize
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/oidc"
+)
+
+// Expr is a compiled condition of a rule.
+//
+// Conditions compare the attributes of a request, such as user,
+// method, path, host, ip, header.<name>, query.<name>, cert.<field>
+// and claims.<name>, with quoted strings and lists of them, using
+// ==, !=, in, contains, matches (a regular expression) and within
+// (a CIDR range), and combine the comparisons with !, && and ||.
+// Since an attribute may have several values, as groups do, a
+// comparison is true if it is true of any of the values. An
+// attribute on its own is true if it has a value that is not
+// empty; blocked, for one, is true if the client IP is on the
+// blocklist that honeypots put clients on. The values of window are
+// the names of the time windows of the policies that are open.
+type Expr interface {
+	eval(r *http.Request) bool
+}
+
+// operand is a value in an expression.
+type operand interface {
+	values(r *http.Request) []string
+}
+
+// literal is a string or a list of strings.
+type literal []string
+
+func (l literal) values(*http.Request) []string { return l }
+
+// attribute is an attribute of a request, such as cert.cn.
+type attribute struct {
+	name string
+	get  func(r *http.Request) []string
+}
+
+func (a attribute) values(r *http.Request) []string { return a.get(r) }
+
+type notExpr struct{ x Expr }
+
+func (e notExpr) eval(r *http.Request) bool { return !e.x.eval(r) }
+
+type andExpr struct{ x, y Expr }
+
+func (e andExpr) eval(r *http.Request) bool { return e.x.eval(r) && e.y.eval(r) }
+
+type orExpr struct{ x, y Expr }
+
+func (e orExpr) eval(r *http.Request) bool { return e.x.eval(r) || e.y.eval(r) }
+
+type boolExpr bool
+
+func (e boolExpr) eval(*http.Request) bool { return bool(e) }
+
+// truthExpr is true if its operand has a non-empty value.
+type truthExpr struct{ x operand }
+
+func (e truthExpr) eval(r *http.Request) bool {
+	for _, v := range e.x.values(r) {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// compareExpr is true if match is true of any pair of values of
+// its operands.
+type compareExpr struct {
+	x, y  operand
+	match func(a, b string) bool
+	neg   bool
+}
+
+func (e compareExpr) eval(r *http.Request) bool {
+	ys := e.y.values(r)
+	for _, a := range e.x.values(r) {
+		for _, b := range ys {
+			if e.match(a, b) {
+				return !e.neg
+			}
+		}
+	}
+	return e.neg
+}
+
+// regexpExpr is true if any value of its operand matches re.
+type regexpExpr struct {
+	x  operand
+	re *regexp.Regexp
+}
+
+func (e regexpExpr) eval(r *http.Request) bool {
+	for _, v := range e.x.values(r) {
+		if e.re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinExpr is true if any value of its operand is an IP
+// address in one of nets.
+type withinExpr struct {
+	x    operand
+	nets []*net.IPNet
+}
+
+func (e withinExpr) eval(r *http.Request) bool {
+	for _, v := range e.x.values(r) {
+		ip := net.ParseIP(v)
+		for _, n := range e.nets {
+			if ip != nil && n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Compile compiles the condition expr.
+func Compile(expr string) (Expr, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %s in condition", p.toks[p.pos].text)
+	}
+	return e, nil
+}
+
+// token kinds of expressions.
+const (
+	tokIdent = iota
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+// symbols are the operators and punctuation of expressions,
+// longest first.
+var symbols = []string{"&&", "||", "==", "!=", "!", "(", ")", "[", "]", ","}
+
+func tokenize(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(expr) && expr[j] != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				sb.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string in condition")
+			}
+			toks = append(toks, token{tokString, sb.String()})
+			i = j + 1
+		case isIdentByte(c):
+			j := i
+			for j < len(expr) && isIdentByte(expr[j]) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, expr[i:j]})
+			i = j
+		default:
+			sym := ""
+			for _, s := range symbols {
+				if strings.HasPrefix(expr[i:], s) {
+					sym = s
+					break
+				}
+			}
+			if sym == "" {
+				return nil, fmt.Errorf("unexpected %c in condition", c)
+			}
+			toks = append(toks, token{tokOp, sym})
+			i += len(sym)
+		}
+	}
+	return toks, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.'
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// accept consumes the next token if it is the operator or
+// keyword s.
+func (p *parser) accept(s string) bool {
+	if p.pos < len(p.toks) && p.toks[p.pos].kind != tokString && p.toks[p.pos].text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Expr, error) {
+	x, err := p.and()
+	for err == nil && p.accept("||") {
+		var y Expr
+		if y, err = p.and(); err == nil {
+			x = orExpr{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) and() (Expr, error) {
+	x, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var y Expr
+		if y, err = p.unary(); err == nil {
+			x = andExpr{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.accept("!") {
+		x, err := p.unary()
+		return notExpr{x}, err
+	}
+	if p.accept("(") {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ) in condition")
+		}
+		return x, nil
+	}
+	if p.accept("true") {
+		return boolExpr(true), nil
+	}
+	if p.accept("false") {
+		return boolExpr(false), nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expr, error) {
+	x, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.accept("=="):
+		y, err := p.operand()
+		return compareExpr{x: x, y: y, match: equal}, err
+	case p.accept("!="):
+		y, err := p.operand()
+		return compareExpr{x: x, y: y, match: equal, neg: true}, err
+	case p.accept("in"):
+		y, err := p.operand()
+		return compareExpr{x: x, y: y, match: equal}, err
+	case p.accept("contains"):
+		y, err := p.operand()
+		return compareExpr{x: y, y: x, match: equal}, err
+	case p.accept("matches"):
+		pattern, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(strings.Join(pattern, "|"))
+		return regexpExpr{x, re}, err
+	case p.accept("within"):
+		ranges, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		var nets []*net.IPNet
+		for _, cidr := range ranges {
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, n)
+		}
+		return withinExpr{x, nets}, nil
+	}
+	return truthExpr{x}, nil
+}
+
+func equal(a, b string) bool { return a == b }
+
+func (p *parser) operand() (operand, error) {
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == tokIdent {
+		name := p.toks[p.pos].text
+		get, err := attributeFunc(name)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		return attribute{name, get}, nil
+	}
+	return p.literal()
+}
+
+// literal parses a string, or a list of strings in brackets.
+func (p *parser) literal() (literal, error) {
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == tokString {
+		p.pos++
+		return literal{p.toks[p.pos-1].text}, nil
+	}
+	if !p.accept("[") {
+		return nil, fmt.Errorf("expected an attribute, a string or a list in condition")
+	}
+	var list literal
+	for !p.accept("]") {
+		if len(list) > 0 && !p.accept(",") {
+			return nil, fmt.Errorf("expected , or ] in list")
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokString {
+			return nil, fmt.Errorf("expected a string in list")
+		}
+		list = append(list, p.toks[p.pos].text)
+		p.pos++
+	}
+	return list, nil
+}
+
+// attributeFunc returns the function that gets the values of
+// the attribute name of requests.
+func attributeFunc(name string) (func(*http.Request) []string, error) {
+	switch name {
+	case "user":
+		return func(r *http.Request) []string {
+			user, _ := r.Context().Value(httpserver.RemoteUserCtxKey).(string)
+			return []string{user}
+		}, nil
+	case "method":
+		return func(r *http.Request) []string { return []string{r.Method} }, nil
+	case "path":
+		return func(r *http.Request) []string { return []string{r.URL.Path} }, nil
+	case "host":
+		return func(r *http.Request) []string {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
+			}
+			return []string{host}
+		}, nil
+	case "ip":
+		return func(r *http.Request) []string {
+			return []string{httpserver.ClientIP(r)}
+		}, nil
+	case "blocked":
+		return func(r *http.Request) []string {
+			ip := httpserver.ClientIP(r)
+			if httpserver.IPBlocked(ip) {
+				return []string{"true"}
+			}
+			return nil
+		}, nil
+	case "window":
+		return func(r *http.Request) []string {
+			windows, _ := r.Context().Value(httpserver.WindowsCtxKey).([]string)
+			return windows
+		}, nil
+	case "scheme":
+		return func(r *http.Request) []string {
+			if r.TLS != nil {
+				return []string{"https"}
+			}
+			return []string{"http"}
+		}, nil
+	}
+
+	prefix, sub := name, ""
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		prefix, sub = name[:i], name[i+1:]
+	}
+	if sub == "" {
+		return nil, fmt.Errorf("unknown attribute %s", name)
+	}
+	switch prefix {
+	case "header":
+		key := http.CanonicalHeaderKey(sub)
+		return func(r *http.Request) []string { return r.Header[key] }, nil
+	case "query":
+		return func(r *http.Request) []string { return r.URL.Query()[sub] }, nil
+	case "claims":
+		return func(r *http.Request) []string {
+			claims, _ := r.Context().Value(httpserver.ClaimsCtxKey).(map[string]interface{})
+			return oidc.ClaimStrings(claims, sub)
+		}, nil
+	case "cert":
+		field, ok := certFields[sub]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %s", name)
+		}
+		return func(r *http.Request) []string {
+			if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+				return nil
+			}
+			return field(r)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown attribute %s", name)
+}
+
+// certFields get the fields of the client certificate of a request,
+// which must have one.
+var certFields = map[string]func(*http.Request) []string{
+	"cn": func(r *http.Request) []string {
+		return []string{r.TLS.PeerCertificates[0].Subject.CommonName}
+	},
+	"o": func(r *http.Request) []string {
+		return r.TLS.PeerCertificates[0].Subject.Organization
+	},
+	"ou": func(r *http.Request) []string {
+		return r.TLS.PeerCertificates[0].Subject.OrganizationalUnit
+	},
+	"email": func(r *http.Request) []string {
+		return r.TLS.PeerCertificates[0].EmailAddresses
+	},
+	"dns": func(r *http.Request) []string {
+		return r.TLS.PeerCertificates[0].DNSNames
+	},
+	"serial": func(r *http.Request) []string {
+		return []string{r.TLS.PeerCertificates[0].SerialNumber.String()}
+	},
+	"issuer.cn": func(r *http.Request) []string {
+		return []string{r.TLS.PeerCertificates[0].Issuer.CommonName}
+	},
+	"fingerprint": func(r *http.Request) []string {
+		sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+		return []string{fmt.Sprintf("%x", sum)}
+	},
+}
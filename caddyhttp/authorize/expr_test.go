@@ -0,0 +1,106 @@
+package authorize
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestExpr(t *testing.T) {
+	r := httptest.NewRequest("POST", "https://example.com:8443/api/items?debug=1", nil)
+	r.RemoteAddr = "10.1.2.3:5555"
+	r.Header.Set("X-Api-Key", "secret")
+	ctx := context.WithValue(r.Context(), httpserver.RemoteUserCtxKey, "alice")
+	ctx = context.WithValue(ctx, httpserver.ClaimsCtxKey, map[string]interface{}{
+		"email_verified": true,
+		"realm_access":   map[string]interface{}{"roles": []interface{}{"admin", "dev"}},
+	})
+	r = r.WithContext(ctx)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Subject:      pkix.Name{CommonName: "client1", Organization: []string{"Acme"}},
+		Issuer:       pkix.Name{CommonName: "Acme CA"},
+		SerialNumber: big.NewInt(42),
+	}}}
+
+	for i, test := range []struct {
+		expr   string
+		expect bool
+	}{
+		{`true`, true},
+		{`!true`, false},
+		{`user == 'alice'`, true},
+		{`user == "bob"`, false},
+		{`user != 'bob'`, true},
+		{`user in ['bob', 'alice']`, true},
+		{`method == 'GET' || method == 'POST'`, true},
+		{`method == 'POST' && !(path matches '^/admin')`, true},
+		{`path matches ['^/admin', '^/api/']`, true},
+		{`host == 'example.com' && scheme == 'https'`, true},
+		{`ip within ['10.0.0.0/8', '192.168.0.0/16']`, true},
+		{`ip within '127.0.0.0/8'`, false},
+		{`header.x-api-key == 'secret'`, true},
+		{`header.X-Other`, false},
+		{`query.debug`, true},
+		{`claims.realm_access.roles contains 'admin'`, true},
+		{`claims.realm_access.roles contains 'ops'`, false},
+		{`claims.email_verified == 'true'`, true},
+		{`claims.missing`, false},
+		{`cert.cn == 'client1' && cert.o == 'Acme'`, true},
+		{`cert.issuer.cn == 'Acme CA' && cert.serial == '42'`, true},
+		{`cert.email`, false},
+		{`user == 'it\'s'`, false},
+	} {
+		e, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("Test %d: %s: unexpected error: %v", i, test.expr, err)
+			continue
+		}
+		if got := e.eval(r); got != test.expect {
+			t.Errorf("Test %d: %s: expected %v, got %v", i, test.expr, test.expect, got)
+		}
+	}
+}
+
+func TestExprBlocked(t *testing.T) {
+	e, err := Compile(`blocked`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "198.51.100.9:5555"
+	if e.eval(r) {
+		t.Error("Expected the client not to be blocked")
+	}
+	httpserver.BlockIP("198.51.100.9", time.Hour)
+	defer httpserver.UnblockIP("198.51.100.9")
+	if !e.eval(r) {
+		t.Error("Expected the client to be blocked")
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for i, expr := range []string{
+		``,
+		`user ==`,
+		`nobody == 'x'`,
+		`cert.nothing`,
+		`(user == 'a'`,
+		`user == 'a`,
+		`user == 'a' 'b'`,
+		`path matches '('`,
+		`ip within 'nonsense'`,
+		`user in ['a' 'b']`,
+		`user # 'a'`,
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Test %d: %s: expected an error", i, expr)
+		}
+	}
+}
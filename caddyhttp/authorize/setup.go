@@ -0,0 +1,148 @@
+package authorize
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("authorize", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultInterval is how often policy files are checked for
+// changes when reload is given without an interval.
+const defaultInterval = 5 * time.Second
+
+// setup configures a new Authorize middleware instance.
+func setup(c *caddy.Controller) error {
+	policies, err := authorizeParse(c)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range policies {
+		p := p
+		if err := p.Load(); err != nil {
+			return c.Errf("Loading authorize policy: %v", err)
+		}
+		c.OnStartup(p.Start)
+		c.OnShutdown(p.Stop)
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Authorize{Next: next, Policies: policies}
+	})
+
+	return nil
+}
+
+func authorizeParse(c *caddy.Controller) ([]*Policy, error) {
+	var policies []*Policy
+
+	for c.Next() {
+		p := &Policy{}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			p.File = args[0]
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow", "deny":
+				line := append([]string{c.Val()}, c.RemainingArgs()...)
+				rule, err := ParseRule(strings.Join(line, " "))
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				p.Rules = append(p.Rules, rule)
+			case "default":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "allow":
+					p.Default = true
+				case "deny":
+					p.Default = false
+				default:
+					return nil, c.Errf("Bad authorize default '%s'", c.Val())
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "reload":
+				p.Interval = defaultInterval
+				if c.NextArg() {
+					d, err := time.ParseDuration(c.Val())
+					if err != nil || d <= 0 {
+						return nil, c.Errf("Bad authorize reload interval '%s'", c.Val())
+					}
+					p.Interval = d
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "window":
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return nil, c.ArgErr()
+				}
+				var specs []string
+				maintenance := false
+				for _, arg := range args[1:] {
+					if arg == "maintenance" {
+						maintenance = true
+						continue
+					}
+					specs = append(specs, arg)
+				}
+				for _, w := range p.Windows {
+					if w.Name == args[0] {
+						return nil, c.Errf("Duplicate authorize window '%s'", args[0])
+					}
+				}
+				w, err := ParseWindow(args[0], specs)
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				w.Maintenance = maintenance
+				p.Windows = append(p.Windows, w)
+			case "timezone":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				loc, err := time.LoadLocation(c.Val())
+				if err != nil {
+					return nil, c.Errf("Bad authorize timezone '%s'", c.Val())
+				}
+				p.Location = loc
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			default:
+				return nil, c.Errf("Unknown authorize property '%s'", c.Val())
+			}
+		}
+
+		if p.File == "" && len(p.Rules) == 0 && !p.hasMaintenanceWindow() {
+			return nil, c.Err("authorize needs a policy file, rules or a maintenance window")
+		}
+		if p.File == "" && p.Interval > 0 {
+			return nil, c.Err("authorize can only reload a policy file")
+		}
+
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
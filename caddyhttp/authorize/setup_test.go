@@ -0,0 +1,162 @@
+package authorize
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `authorize {
+		allow * /admin if "user == 'alice'"
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Authorize)
+	if !ok {
+		t.Fatalf("Expected handler to be type Authorize, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestAuthorizeParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		rules     int
+		file      string
+		def       bool
+		interval  time.Duration
+	}{
+		{`authorize {
+			allow GET,HEAD /public
+			deny * /admin if "!(user in ['alice'])"
+			default allow
+		}`, false, 2, "", true, 0},
+		{`authorize policy.txt`, false, 0, "policy.txt", false, 0},
+		{`authorize policy.txt {
+			reload
+		}`, false, 0, "policy.txt", false, defaultInterval},
+		{`authorize policy.txt {
+			allow * /health
+			reload 1m
+		}`, false, 1, "policy.txt", false, time.Minute},
+		{`authorize`, true, 0, "", false, 0},
+		{`authorize a b`, true, 0, "", false, 0},
+		{`authorize {
+			allow * /x
+			reload
+		}`, true, 0, "", false, 0},
+		{`authorize policy.txt {
+			reload soon
+		}`, true, 0, "", false, 0},
+		{`authorize {
+			allow * /x if "user =="
+		}`, true, 0, "", false, 0},
+		{`authorize {
+			allow * /x
+			default maybe
+		}`, true, 0, "", false, 0},
+		{`authorize policy.txt {
+			unknown
+		}`, true, 0, "", false, 0},
+	}
+	for i, test := range tests {
+		policies, err := authorizeParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr || err != nil {
+			continue
+		}
+		if len(policies) != 1 {
+			t.Fatalf("Test %d: expected 1 policy, got %d", i, len(policies))
+		}
+		p := policies[0]
+		if len(p.Rules) != test.rules || p.File != test.file || p.Default != test.def || p.Interval != test.interval {
+			t.Errorf("Test %d: unexpected policy %+v", i, p)
+		}
+	}
+}
+
+func TestAuthorizeParseWindows(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		windows     int
+		maintenance bool
+		location    string
+	}{
+		{`authorize {
+			window business mon-fri 09:00-17:00
+			deny * /admin if "!(window contains 'business')"
+		}`, false, 1, false, "Local"},
+		{`authorize {
+			timezone UTC
+			window upgrade sun 02:00-04:00 maintenance
+			window holidays 2026-12-24/2026-12-26
+			allow * /
+		}`, false, 2, true, "UTC"},
+		{`authorize {
+			window upgrade 2026-11-01 01:00-03:00 maintenance
+		}`, false, 1, true, "Local"},
+		{`authorize {
+			window business
+			allow * /
+		}`, true, 0, false, ""},
+		{`authorize {
+			window business mon-fri 9-17
+			allow * /
+		}`, true, 0, false, ""},
+		{`authorize {
+			window business mon-fri
+			window business sat
+			allow * /
+		}`, true, 0, false, ""},
+		{`authorize {
+			timezone Nowhere/Place
+			allow * /
+		}`, true, 0, false, ""},
+		{`authorize {
+			window business mon-fri
+		}`, true, 0, false, ""},
+	}
+	for i, test := range tests {
+		policies, err := authorizeParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr || err != nil {
+			continue
+		}
+		p := policies[0]
+		if len(p.Windows) != test.windows || p.hasMaintenanceWindow() != test.maintenance {
+			t.Errorf("Test %d: unexpected windows %+v", i, p.Windows)
+		}
+		location := "Local"
+		if p.Location != nil {
+			location = p.Location.String()
+		}
+		if location != test.location {
+			t.Errorf("Test %d: expected time zone %s, got %s", i, test.location, location)
+		}
+	}
+}
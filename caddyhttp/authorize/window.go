@@ -0,0 +1,257 @@
+package authorize
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Window is a time of day on some days of the week, and between
+// some dates, that rules can be conditioned on with the window
+// attribute, and during which maintenance mode can be turned on.
+type Window struct {
+	Name string
+
+	// Days are the days of the week the window opens on, by
+	// time.Weekday; all of them if none is set.
+	Days [7]bool
+
+	// From and To are the minutes after midnight the window opens
+	// and closes at; if To is before From, the window closes the
+	// next day, and if they are equal, it lasts all day.
+	From, To int
+
+	// Start and End are the first and last dates, as 2006-01-02,
+	// of the window, if it has them.
+	Start, End string
+
+	// Maintenance is whether maintenance mode is on while the
+	// window is open.
+	Maintenance bool
+}
+
+// opens returns whether the window opens on the day of t.
+func (w *Window) opens(t time.Time) bool {
+	any := false
+	for _, d := range w.Days {
+		any = any || d
+	}
+	if any && !w.Days[t.Weekday()] {
+		return false
+	}
+	date := t.Format("2006-01-02")
+	return (w.Start == "" || date >= w.Start) && (w.End == "" || date <= w.End)
+}
+
+// Open returns whether the window is open at t, which is in the
+// time zone the window is in.
+func (w *Window) Open(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case w.From == w.To:
+		return w.opens(t)
+	case w.From < w.To:
+		return w.opens(t) && m >= w.From && m < w.To
+	}
+	// the window closes the day after it opens
+	return (w.opens(t) && m >= w.From) || (w.opens(t.AddDate(0, 0, -1)) && m < w.To)
+}
+
+// weekdays are the names of the days of the week, by time.Weekday.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseWindow parses the window name from args, which are any of
+//
+//	days   like mon-fri or sat,sun
+//	times  like 09:00-17:00 or 22:00-06:00
+//	dates  like 2026-12-24 or 2026-12-24/2027-01-01
+//
+// in any order. A window without days is open every day, one
+// without times all day, and one without dates on any date.
+func ParseWindow(name string, args []string) (*Window, error) {
+	w := &Window{Name: name}
+	var hasDays, hasTimes, hasDates bool
+	for _, arg := range args {
+		var err error
+		switch {
+		case strings.Contains(arg, ":"):
+			if hasTimes {
+				return nil, fmt.Errorf("window %s has more than one time range", name)
+			}
+			hasTimes = true
+			err = w.parseTimes(arg)
+		case arg != "" && arg[0] >= '0' && arg[0] <= '9':
+			if hasDates {
+				return nil, fmt.Errorf("window %s has more than one date range", name)
+			}
+			hasDates = true
+			err = w.parseDates(arg)
+		default:
+			if hasDays {
+				return nil, fmt.Errorf("window %s has more than one list of days", name)
+			}
+			hasDays = true
+			err = w.parseDays(arg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("window %s: %v", name, err)
+		}
+	}
+	return w, nil
+}
+
+func (w *Window) parseTimes(arg string) error {
+	parts := strings.Split(arg, "-")
+	if len(parts) != 2 {
+		return fmt.Errorf("times must be a range like 09:00-17:00, not %s", arg)
+	}
+	var err error
+	if w.From, err = parseClock(parts[0]); err != nil {
+		return err
+	}
+	w.To, err = parseClock(parts[1])
+	return err
+}
+
+// parseClock returns the minutes after midnight of s, such as 09:30.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("bad time of day %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *Window) parseDates(arg string) error {
+	parts := strings.Split(arg, "/")
+	if len(parts) > 2 {
+		return fmt.Errorf("dates must be a date or a range like 2026-12-24/2027-01-01, not %s", arg)
+	}
+	for _, p := range parts {
+		if _, err := time.Parse("2006-01-02", p); err != nil {
+			return fmt.Errorf("bad date %s", p)
+		}
+	}
+	w.Start, w.End = parts[0], parts[len(parts)-1]
+	if w.End < w.Start {
+		return fmt.Errorf("dates %s end before they start", arg)
+	}
+	return nil
+}
+
+func (w *Window) parseDays(arg string) error {
+	for _, item := range strings.Split(strings.ToLower(arg), ",") {
+		bounds := strings.Split(item, "-")
+		if len(bounds) > 2 {
+			return fmt.Errorf("bad days %s", arg)
+		}
+		first, err := weekday(bounds[0])
+		if err != nil {
+			return err
+		}
+		last, err := weekday(bounds[len(bounds)-1])
+		if err != nil {
+			return err
+		}
+		// ranges such as fri-mon go round the end of the week
+		for d := first; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func weekday(s string) (int, error) {
+	for i, name := range weekdays {
+		if s == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %s", s)
+}
+
+// openWindows returns the names of the windows of p that are open
+// at t.
+func (p *Policy) openWindows(t time.Time) []string {
+	if p.Location != nil {
+		t = t.In(p.Location)
+	}
+	var names []string
+	for _, w := range p.Windows {
+		if w.Open(t) {
+			names = append(names, w.Name)
+		}
+	}
+	return names
+}
+
+// setScheduledMaintenance records whether p has a maintenance window
+// open, and turns maintenance mode on or off for it when that
+// changes. Policies of a reloaded configuration start before those
+// of the previous one stop, so a window open in both keeps it on.
+func (p *Policy) setScheduledMaintenance(open bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if open == p.inMaintenance {
+		return
+	}
+	p.inMaintenance = open
+	if open {
+		log.Printf("[INFO] authorize: maintenance window open; turning maintenance mode on")
+	} else {
+		log.Printf("[INFO] authorize: maintenance window closed; turning maintenance mode off")
+	}
+	httpserver.ScheduleMaintenance(open)
+}
+
+// checkMaintenance opens or closes the maintenance windows of p
+// according to t.
+func (p *Policy) checkMaintenance(t time.Time) {
+	if p.Location != nil {
+		t = t.In(p.Location)
+	}
+	open := false
+	for _, w := range p.Windows {
+		open = open || (w.Maintenance && w.Open(t))
+	}
+	p.setScheduledMaintenance(open)
+}
+
+// hasMaintenanceWindow returns whether any window of p turns on
+// maintenance mode.
+func (p *Policy) hasMaintenanceWindow() bool {
+	for _, w := range p.Windows {
+		if w.Maintenance {
+			return true
+		}
+	}
+	return false
+}
+
+// windowInterval is how often maintenance windows are checked.
+const windowInterval = 15 * time.Second
+
+func (p *Policy) schedule() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(windowInterval)
+	defer ticker.Stop()
+	p.checkMaintenance(now())
+	for {
+		select {
+		case <-ticker.C:
+			p.checkMaintenance(now())
+		case <-p.stop:
+			p.setScheduledMaintenance(false)
+			return
+		}
+	}
+}
+
+// now is the clock of windows; tests replace it.
+var now = time.Now
@@ -0,0 +1,153 @@
+package authorize
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestWindowOpen(t *testing.T) {
+	// 2026-10-12 is a Monday
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		args     []string
+		time     string
+		expected bool
+	}{
+		{[]string{"mon-fri", "09:00-17:00"}, "2026-10-12 09:00", true},
+		{[]string{"mon-fri", "09:00-17:00"}, "2026-10-12 16:59", true},
+		{[]string{"mon-fri", "09:00-17:00"}, "2026-10-12 17:00", false},
+		{[]string{"mon-fri", "09:00-17:00"}, "2026-10-11 12:00", false},
+		{[]string{"09:00-17:00"}, "2026-10-11 12:00", true},
+		{[]string{"sat,sun"}, "2026-10-11 23:59", true},
+		{[]string{"fri-mon"}, "2026-10-12 00:00", true},
+		{[]string{"fri-mon"}, "2026-10-13 00:00", false},
+		{[]string{"fri", "22:00-06:00"}, "2026-10-16 23:00", true},
+		{[]string{"fri", "22:00-06:00"}, "2026-10-17 05:59", true},
+		{[]string{"fri", "22:00-06:00"}, "2026-10-17 23:00", false},
+		{[]string{"2026-12-24/2026-12-26"}, "2026-12-25 12:00", true},
+		{[]string{"2026-12-24/2026-12-26"}, "2026-12-27 00:00", false},
+		{[]string{"2026-10-12", "01:00-03:00"}, "2026-10-12 02:00", true},
+		{[]string{"2026-10-12", "01:00-03:00"}, "2026-10-13 02:00", false},
+	}
+	for i, test := range tests {
+		w, err := ParseWindow("w", test.args)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if got := w.Open(at(test.time)); got != test.expected {
+			t.Errorf("Test %d: expected %v at %s, got %v", i, test.expected, test.time, got)
+		}
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for i, args := range [][]string{
+		{"someday"},
+		{"mon-fri-sat"},
+		{"mon", "tue"},
+		{"09:00"},
+		{"09:00-25:00"},
+		{"09:00-17:00", "10:00-11:00"},
+		{"2026-13-01"},
+		{"2026-12-26/2026-12-24"},
+		{"2026-12-24/2026-12-25/2026-12-26"},
+		{"2026-12-24", "2026-12-25"},
+	} {
+		if _, err := ParseWindow("w", args); err == nil {
+			t.Errorf("Test %d: expected an error for %v", i, args)
+		}
+	}
+}
+
+func TestAuthorizeWindows(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2026, 10, 12, 20, 0, 0, 0, time.UTC) }
+
+	business, _ := ParseWindow("business", []string{"mon-fri", "09:00-17:00"})
+	rule, err := ParseRule(`deny * /admin if !(window contains "business")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var windows []string
+	a := Authorize{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			windows, _ = r.Context().Value(httpserver.WindowsCtxKey).([]string)
+			return http.StatusOK, nil
+		}),
+		Policies: []*Policy{{Rules: []Rule{rule}, Default: true, Windows: []*Window{business}}},
+	}
+
+	// 20:00 UTC on Monday is outside the window, but 09:00 on Tuesday
+	// at UTC+13 is inside
+	status, _ := a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/admin", nil))
+	if status != http.StatusForbidden {
+		t.Errorf("Expected status %d outside the window, got %d", http.StatusForbidden, status)
+	}
+	a.Policies[0].Location = time.FixedZone("UTC+13", 13*60*60)
+	r := httpserver.WithPlaceholders(httptest.NewRequest("GET", "/admin", nil))
+	status, _ = a.ServeHTTP(&httpserver.ResponseWriterWrapper{ResponseWriter: httptest.NewRecorder()}, r)
+	if status != http.StatusOK {
+		t.Errorf("Expected status %d inside the window, got %d", http.StatusOK, status)
+	}
+	if len(windows) != 1 || windows[0] != "business" {
+		t.Errorf("Expected the business window to be open, got %v", windows)
+	}
+	// the middleware before authorize, such as log, sees them too
+	if got := httpserver.NewReplacer(r, nil, "-").Replace("{window}"); got != "business" {
+		t.Errorf("Expected {window} to be business before authorize, got %s", got)
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	defer httpserver.SetMaintenance(false)
+	upgrade, _ := ParseWindow("upgrade", []string{"02:00-04:00"})
+	upgrade.Maintenance = true
+	old := &Policy{Windows: []*Window{upgrade}}
+	reloaded := &Policy{Windows: []*Window{upgrade}}
+
+	old.checkMaintenance(time.Date(2026, 10, 12, 1, 0, 0, 0, time.Local))
+	if httpserver.InMaintenance() {
+		t.Fatal("Expected maintenance mode to be off before the window")
+	}
+	old.checkMaintenance(time.Date(2026, 10, 12, 2, 0, 0, 0, time.Local))
+	if !httpserver.InMaintenance() {
+		t.Fatal("Expected maintenance mode to be on in the window")
+	}
+
+	// the policy of a reloaded configuration keeps it on as the old one stops
+	reloaded.checkMaintenance(time.Date(2026, 10, 12, 2, 30, 0, 0, time.Local))
+	old.setScheduledMaintenance(false)
+	if !httpserver.InMaintenance() {
+		t.Fatal("Expected maintenance mode to stay on after reloading")
+	}
+	reloaded.checkMaintenance(time.Date(2026, 10, 12, 4, 0, 0, 0, time.Local))
+	if httpserver.InMaintenance() {
+		t.Error("Expected maintenance mode to be off after the window")
+	}
+
+	// maintenance mode turned on by hand outlasts the window
+	httpserver.SetMaintenance(true)
+	reloaded.checkMaintenance(time.Date(2026, 10, 13, 2, 0, 0, 0, time.Local))
+	reloaded.checkMaintenance(time.Date(2026, 10, 13, 4, 0, 0, 0, time.Local))
+	if !httpserver.InMaintenance() {
+		t.Error("Expected maintenance mode turned on by hand to stay on after the window")
+	}
+
+	// and turning it off by hand doesn't close the window
+	reloaded.checkMaintenance(time.Date(2026, 10, 14, 2, 0, 0, 0, time.Local))
+	httpserver.SetMaintenance(false)
+	if !httpserver.InMaintenance() {
+		t.Error("Expected maintenance mode to stay on in the window")
+	}
+	reloaded.setScheduledMaintenance(false)
+}
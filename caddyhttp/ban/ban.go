@@ -0,0 +1,157 @@
+// Package ban implements middleware that bans clients for a while, in
+// the way of fail2ban, once they have had too many responses of some
+// statuses, such as 401 for failing to log in, in too short a time.
+// The listener of the site then closes their connections as soon as
+// it accepts them, until the ban expires or is lifted through the
+// admin API.
+package ban
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var bansTotal = metrics.NewCounter("caddy_http_bans_total",
+	"Number of client IPs banned for too many failures, by site.",
+	"site")
+
+// Jail is middleware that counts the failures of clients and bans
+// those with too many.
+type Jail struct {
+	Next httpserver.Handler
+	Site string // for logs and metrics
+
+	// Paths are those whose responses count, and Statuses the
+	// statuses of the responses that count as failures.
+	Paths    []string
+	Statuses []int
+
+	// MaxRetry is the most failures a client may have within
+	// FindTime before it's banned for BanTime.
+	MaxRetry int
+	FindTime time.Duration
+	BanTime  time.Duration
+
+	// Trusted are the networks whose clients are never banned.
+	Trusted []*net.IPNet
+
+	failures *failures
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (j Jail) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	ip := httpserver.ClientIP(r)
+	if j.trusted(ip) {
+		return j.Next.ServeHTTP(w, r)
+	}
+	if httpserver.IPBanned(ip) {
+		// banned while its connection was open, or behind a proxy
+		w.Header().Set("Connection", "close")
+		return http.StatusForbidden, nil
+	}
+	if !j.watches(r.URL.Path) {
+		return j.Next.ServeHTTP(w, r)
+	}
+
+	rec := httpserver.NewResponseRecorder(w)
+	status, err := j.Next.ServeHTTP(rec, r)
+	code := status
+	if code == 0 {
+		code = rec.Status()
+	}
+	if j.failed(code) && j.failures.add(ip, time.Now(), j.FindTime) >= j.MaxRetry {
+		j.failures.reset(ip)
+		httpserver.BanIP(ip, j.BanTime, j.Site+": "+strconv.Itoa(j.MaxRetry)+" failures")
+		bansTotal.Inc(j.Site)
+		log.Printf("[WARNING] ban: %s %s had %d failures within %v; banned for %v",
+			j.Site, ip, j.MaxRetry, j.FindTime, j.BanTime)
+		if status != 0 {
+			w.Header().Set("Connection", "close")
+		}
+	}
+	return status, err
+}
+
+// watches returns whether the responses for urlPath count.
+func (j Jail) watches(urlPath string) bool {
+	for _, p := range j.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// failed returns whether status counts as a failure.
+func (j Jail) failed(status int) bool {
+	for _, s := range j.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// trusted returns whether ip is in a trusted network.
+func (j Jail) trusted(ip string) bool {
+	if len(j.Trusted) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	for _, network := range j.Trusted {
+		if parsed != nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// failures are the recent failures of clients, by IP.
+type failures struct {
+	mu        sync.Mutex
+	byIP      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newFailures() *failures {
+	return &failures{byIP: make(map[string][]time.Time)}
+}
+
+// add records a failure of ip at now, and returns how many it has had
+// within window.
+func (f *failures) add(ip string, now time.Time, window time.Duration) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.Sub(f.lastSweep) > window {
+		for ip, times := range f.byIP {
+			if now.Sub(times[len(times)-1]) > window {
+				delete(f.byIP, ip)
+			}
+		}
+		f.lastSweep = now
+	}
+
+	times := f.byIP[ip]
+	expired := 0
+	for expired < len(times) && now.Sub(times[expired]) > window {
+		expired++
+	}
+	times = append(times[expired:], now)
+	f.byIP[ip] = times
+	return len(times)
+}
+
+// reset forgets the failures of ip.
+func (f *failures) reset(ip string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.byIP, ip)
+}
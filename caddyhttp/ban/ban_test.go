@@ -0,0 +1,88 @@
+package ban
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+func TestJail(t *testing.T) {
+	j := Jail{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.Header.Get("Authorization") == "" {
+				return http.StatusUnauthorized, nil
+			}
+			return http.StatusOK, nil
+		}),
+		Site:     "ban-test",
+		Paths:    []string{"/admin"},
+		Statuses: []int{http.StatusUnauthorized},
+		MaxRetry: 2,
+		FindTime: time.Minute,
+		BanTime:  time.Hour,
+		failures: newFailures(),
+	}
+	defer httpserver.UnbanIP("198.51.100.30")
+
+	for i, test := range []struct {
+		ip           string
+		path         string
+		auth         bool
+		expectStatus int
+	}{
+		{"198.51.100.30", "/", false, http.StatusUnauthorized}, // not watched
+		{"198.51.100.30", "/admin", false, http.StatusUnauthorized},
+		{"198.51.100.31", "/admin", false, http.StatusUnauthorized}, // another client
+		{"198.51.100.30", "/admin", false, http.StatusUnauthorized}, // banned
+		{"198.51.100.30", "/admin", true, http.StatusForbidden},
+		{"198.51.100.30", "/", true, http.StatusForbidden},
+		{"198.51.100.31", "/admin", true, http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.RemoteAddr = test.ip + ":1234"
+		if test.auth {
+			r.Header.Set("Authorization", "Basic x")
+		}
+		status, err := j.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectStatus, status)
+		}
+	}
+	if httpserver.IPBanned("198.51.100.31") {
+		t.Error("Expected the client with one failure not to be banned")
+	}
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	if expect := `caddy_http_bans_total{site="ban-test"} 1`; !strings.Contains(buf.String(), expect) {
+		t.Errorf("Expected %s in:\n%s", expect, buf.String())
+	}
+}
+
+func TestFailures(t *testing.T) {
+	f := newFailures()
+	start := time.Now()
+	for i, test := range []struct {
+		at     time.Duration
+		expect int
+	}{
+		{0, 1},
+		{10 * time.Second, 2},
+		{50 * time.Second, 3},
+		{65 * time.Second, 3}, // the first expired
+		{3 * time.Minute, 1},
+	} {
+		if n := f.add("192.0.2.1", start.Add(test.at), time.Minute); n != test.expect {
+			t.Errorf("Test %d: expected %d failures, got %d", i, test.expect, n)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package ban
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("ban", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// The defaults, which are those of fail2ban.
+const (
+	defaultMaxRetry = 5
+	defaultFindTime = 10 * time.Minute
+	defaultBanTime  = 10 * time.Minute
+)
+
+// setup configures a new Jail middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	handler, err := banParse(c)
+	if err != nil {
+		return err
+	}
+	handler.Site = cfg.Addr.String()
+	cfg.RefuseBanned = true
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		handler.Next = next
+		return handler
+	})
+
+	return nil
+}
+
+// banParse parses
+//
+//	ban [paths...] {
+//		status    codes...
+//		max_retry failures
+//		find_time duration
+//		ban_time  duration
+//		trust     networks...
+//	}
+//
+// where the responses for the paths, / by default, with the statuses,
+// 401 by default, are failures, and clients with max_retry failures,
+// 5 by default, within find_time, 10 minutes by default, are banned
+// for ban_time, 10 minutes by default; the networks, which may be IPs
+// or CIDR ranges, are those whose clients are never banned.
+func banParse(c *caddy.Controller) (Jail, error) {
+	handler := Jail{
+		MaxRetry: defaultMaxRetry,
+		FindTime: defaultFindTime,
+		BanTime:  defaultBanTime,
+		failures: newFailures(),
+	}
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return handler, c.Err("ban may only be given once per site")
+		}
+		parsed = true
+		handler.Paths = c.RemainingArgs()
+		if len(handler.Paths) == 0 {
+			handler.Paths = []string{"/"}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "status":
+				if len(args) == 0 {
+					return handler, c.ArgErr()
+				}
+				for _, arg := range args {
+					code, err := strconv.Atoi(arg)
+					if err != nil || code < 400 || code > 599 {
+						return handler, c.Errf("ban status must be an error status code, not '%s'", arg)
+					}
+					handler.Statuses = append(handler.Statuses, code)
+				}
+			case "max_retry":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return handler, c.Errf("max_retry must be a positive number of failures, not '%s'", args[0])
+				}
+				handler.MaxRetry = n
+			case "find_time", "ban_time":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return handler, c.Errf("invalid %s '%s'", what, args[0])
+				}
+				if what == "find_time" {
+					handler.FindTime = d
+				} else {
+					handler.BanTime = d
+				}
+			case "trust":
+				if len(args) == 0 {
+					return handler, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := httpserver.ParseNetwork(arg)
+					if err != nil {
+						return handler, c.Err(err.Error())
+					}
+					handler.Trusted = append(handler.Trusted, network)
+				}
+			default:
+				return handler, c.Errf("Unknown ban property '%s'", what)
+			}
+		}
+	}
+
+	if len(handler.Statuses) == 0 {
+		handler.Statuses = []int{http.StatusUnauthorized}
+	}
+
+	return handler, nil
+}
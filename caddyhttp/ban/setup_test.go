@@ -0,0 +1,103 @@
+package ban
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `ban /admin`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	cfg := httpserver.GetConfig(c)
+	if !cfg.RefuseBanned {
+		t.Error("Expected the listener of the site to refuse banned clients")
+	}
+	mids := cfg.Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Jail)
+	if !ok {
+		t.Fatalf("Expected handler to be type Jail, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestBanParse(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectPaths    []string
+		expectStatuses []int
+		expectRetry    int
+		expectFind     time.Duration
+		expectBan      time.Duration
+		expectTrusted  int
+	}{
+		{`ban`, false, []string{"/"}, []int{401}, defaultMaxRetry, defaultFindTime, defaultBanTime, 0},
+		{`ban /admin /api {
+			status 401 403
+			max_retry 3
+			find_time 30s
+			ban_time 1h
+			trust 10.0.0.0/8 ::1
+		}`, false, []string{"/admin", "/api"}, []int{401, 403}, 3, 30 * time.Second, time.Hour, 2},
+		{`ban {
+			status 200
+		}`, true, nil, nil, 0, 0, 0, 0},
+		{`ban {
+			status
+		}`, true, nil, nil, 0, 0, 0, 0},
+		{`ban {
+			max_retry 0
+		}`, true, nil, nil, 0, 0, 0, 0},
+		{`ban {
+			find_time soon
+		}`, true, nil, nil, 0, 0, 0, 0},
+		{`ban {
+			ban_time -1h
+		}`, true, nil, nil, 0, 0, 0, 0},
+		{`ban {
+			trust nowhere
+		}`, true, nil, nil, 0, 0, 0, 0},
+		{`ban {
+			jail
+		}`, true, nil, nil, 0, 0, 0, 0},
+		{`ban
+		ban /admin`, true, nil, nil, 0, 0, 0, 0},
+	} {
+		handler, err := banParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(handler.Paths, test.expectPaths) {
+			t.Errorf("Test %d: expected paths %v, got %v", i, test.expectPaths, handler.Paths)
+		}
+		if !reflect.DeepEqual(handler.Statuses, test.expectStatuses) {
+			t.Errorf("Test %d: expected statuses %v, got %v", i, test.expectStatuses, handler.Statuses)
+		}
+		if handler.MaxRetry != test.expectRetry || handler.FindTime != test.expectFind || handler.BanTime != test.expectBan {
+			t.Errorf("Test %d: expected %d failures in %v to ban for %v, got %d in %v for %v", i,
+				test.expectRetry, test.expectFind, test.expectBan, handler.MaxRetry, handler.FindTime, handler.BanTime)
+		}
+		if len(handler.Trusted) != test.expectTrusted {
+			t.Errorf("Test %d: expected %d trusted networks, got %d", i, test.expectTrusted, len(handler.Trusted))
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"sync"
 
 	"github.com/jimstudt/http-authentication/basic"
+	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -104,6 +105,8 @@ var (
 // GetHtpasswdMatcher matches password rules.
 func GetHtpasswdMatcher(filename, username, siteRoot string) (PasswordMatcher, error) {
 	filename = filepath.Join(siteRoot, filename)
+	// it is needed again on reload, also in a sandbox
+	caddy.RegisterReadablePath(filename)
 	htpasswordsMu.Lock()
 	if htpasswords == nil {
 		htpasswords = make(map[string]map[string]PasswordMatcher)
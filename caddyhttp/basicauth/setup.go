@@ -48,13 +48,13 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 		switch len(args) {
 		case 2:
 			rule.Username = args[0]
-			if rule.Password, err = passwordMatcher(rule.Username, args[1], cfg.Root); err != nil {
+			if rule.Password, err = GetPasswordMatcher(rule.Username, args[1], cfg.Root); err != nil {
 				return rules, c.Errf("Get password matcher from %s: %v", c.Val(), err)
 			}
 		case 3:
 			rule.Resources = append(rule.Resources, args[0])
 			rule.Username = args[1]
-			if rule.Password, err = passwordMatcher(rule.Username, args[2], cfg.Root); err != nil {
+			if rule.Password, err = GetPasswordMatcher(rule.Username, args[2], cfg.Root); err != nil {
 				return rules, c.Errf("Get password matcher from %s: %v", c.Val(), err)
 			}
 		default:
@@ -90,7 +90,11 @@ func basicAuthParse(c *caddy.Controller) ([]Rule, error) {
 	return rules, nil
 }
 
-func passwordMatcher(username, passw, siteRoot string) (PasswordMatcher, error) {
+// GetPasswordMatcher returns the PasswordMatcher of the password
+// passw of username, as given to the basicauth directive: plain, or
+// htpasswd=<file> for the password of username in that file, which
+// is relative to siteRoot.
+func GetPasswordMatcher(username, passw, siteRoot string) (PasswordMatcher, error) {
 	htpasswdPrefix := "htpasswd="
 	if !strings.HasPrefix(passw, htpasswdPrefix) {
 		return PlainMatcher(passw), nil
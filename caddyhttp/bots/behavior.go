@@ -0,0 +1,103 @@
+package bots
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// window is how far back the requests of a client are tracked.
+const window = time.Minute
+
+// pathSamples is how many of the recent paths of a client are kept to
+// measure how scattered they are.
+const pathSamples = 32
+
+// tracker tracks how clients behave, by IP address, to find those
+// that send too many requests, or that scan for paths.
+type tracker struct {
+	// Rate is the most requests per minute from a client, and
+	// Entropy the most bits of entropy of its recent paths, before
+	// it is abusive; 0 for no limit.
+	Rate    int
+	Entropy float64
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+// client is the recent requests of one client.
+type client struct {
+	last  time.Time   // of the latest request
+	times []time.Time // in the window, no more than Rate+1
+	paths []string    // the last pathSamples
+	next  int         // of paths, to replace
+}
+
+func newTracker(rate int, entropy float64) *tracker {
+	return &tracker{Rate: rate, Entropy: entropy, clients: make(map[string]*client)}
+}
+
+// abusive records a request from ip for path at now, and returns
+// whether the client has become abusive.
+func (t *tracker) abusive(ip, path string, now time.Time) bool {
+	if t.Rate == 0 && t.Entropy == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) > window {
+		for ip, c := range t.clients {
+			if now.Sub(c.last) > window {
+				delete(t.clients, ip)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	c, ok := t.clients[ip]
+	if !ok {
+		c = new(client)
+		t.clients[ip] = c
+	}
+	c.last = now
+	if t.Rate > 0 {
+		// only whether there were more than Rate matters, so
+		// keep no more than Rate+1 of them
+		expired := 0
+		for expired < len(c.times) && (now.Sub(c.times[expired]) > window || len(c.times)-expired > t.Rate) {
+			expired++
+		}
+		c.times = append(c.times[:0], c.times[expired:]...)
+		c.times = append(c.times, now)
+	}
+	if len(c.paths) < pathSamples {
+		c.paths = append(c.paths, path)
+	} else {
+		c.paths[c.next] = path
+		c.next = (c.next + 1) % pathSamples
+	}
+
+	if t.Rate > 0 && len(c.times) > t.Rate {
+		return true
+	}
+	return t.Entropy > 0 && len(c.paths) == pathSamples && entropy(c.paths) > t.Entropy
+}
+
+// entropy returns the Shannon entropy, in bits, of paths: 0 if they
+// are all the same, and more the more of them are different, up to
+// log2(len(paths)) if they all are.
+func entropy(paths []string) float64 {
+	counts := make(map[string]int)
+	for _, p := range paths {
+		counts[p]++
+	}
+	var h float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(paths))
+		h -= p * math.Log2(p)
+	}
+	return h
+}
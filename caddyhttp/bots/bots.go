@@ -0,0 +1,184 @@
+// Package bots implements middleware that classifies the clients of a
+// site as browsers, crawlers, tools, spoofed browsers or abusive
+// clients, from their User-Agent, the fingerprint of their TLS
+// handshake and how they behave, and acts on each class as configured:
+// letting it through, slowing it down, challenging it or blocking it.
+package bots
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var classifiedRequests = metrics.NewCounter("caddy_http_bot_requests_total",
+	"Number of requests classified by bot detection, by site, class and action.",
+	"site", "class", "action")
+
+// The classes of clients.
+const (
+	Browser = "browser"
+	Crawler = "crawler"
+	Tool    = "tool"    // such as curl or a library
+	Spoofed = "spoofed" // claims to be a browser, but isn't
+	Abusive = "abusive" // too many requests, or scanning
+)
+
+// Classes are the classes of clients, in order.
+var Classes = []string{Browser, Crawler, Tool, Spoofed, Abusive}
+
+// Action is what is done with the requests of a class.
+type Action int
+
+// The actions.
+const (
+	Allow     Action = iota
+	Tarpit           // delay, then let through
+	Challenge        // let through browsers that run JavaScript
+	Block
+)
+
+// actionNames are the names of the actions, in configuration.
+var actionNames = map[string]Action{
+	"allow":     Allow,
+	"tarpit":    Tarpit,
+	"challenge": Challenge,
+	"block":     Block,
+}
+
+func (a Action) String() string {
+	for name, action := range actionNames {
+		if action == a {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// DefaultActions are the actions of classes that aren't configured.
+var DefaultActions = map[string]Action{
+	Browser: Allow,
+	Crawler: Allow,
+	Tool:    Allow,
+	Spoofed: Challenge,
+	Abusive: Tarpit,
+}
+
+// Bots is middleware that classifies clients and acts on each class.
+type Bots struct {
+	Next httpserver.Handler
+	Site string // for metrics
+
+	// Actions are what is done with the requests of each class.
+	Actions map[string]Action
+
+	// Fingerprints are the classes of clients with known JA3
+	// fingerprints, by MD5 hash in hex.
+	Fingerprints map[string]string
+
+	// TarpitDelay is how long the requests of tarpitted clients
+	// are held before they are let through.
+	TarpitDelay time.Duration
+
+	// Secret is the key that challenge cookies are signed with.
+	Secret []byte
+
+	clients *tracker
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (b Bots) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	ip := httpserver.ClientIP(r)
+	class := b.classify(r, ip)
+	action := b.Actions[class]
+	if action == Challenge && b.passedChallenge(r, ip, time.Now()) {
+		action = Allow
+	}
+	classifiedRequests.Inc(b.Site, class, action.String())
+
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.BotClassCtxKey, class))
+	httpserver.SetPlaceholder(r, "bot_class", class)
+
+	switch action {
+	case Tarpit:
+		if !(httpserver.Tarpit{Delay: b.TarpitDelay}).Hold(r.Context()) {
+			return 0, nil // gone, so there is no one to respond to
+		}
+	case Challenge:
+		b.challenge(w, ip, time.Now())
+		return 0, nil
+	case Block:
+		return http.StatusForbidden, nil
+	}
+	return b.Next.ServeHTTP(w, r)
+}
+
+// classify returns the class of the client at ip that sent r. How
+// the client behaves counts first, then the fingerprint of its TLS
+// handshake, if it is known, then its User-Agent; a client whose
+// User-Agent claims a browser is spoofed if its handshake is that of
+// something else.
+func (b Bots) classify(r *http.Request, ip string) string {
+	if b.clients != nil && b.clients.abusive(ip, r.URL.Path, time.Now()) {
+		return Abusive
+	}
+	class := classifyUserAgent(r.UserAgent())
+	if class == Abusive {
+		return class
+	}
+	if ja3, ok := r.Context().Value(httpserver.TLSFingerprintCtxKey).(string); ok {
+		if known, ok := b.Fingerprints[ja3]; ok {
+			if class == Browser && known != Browser {
+				return Spoofed
+			}
+			return known
+		}
+	}
+	if mitm, ok := r.Context().Value(httpserver.MitmCtxKey).(bool); ok && mitm && class == Browser {
+		return Spoofed
+	}
+	return class
+}
+
+// The substrings, in lower case, of the User-Agents of each class.
+var (
+	scannerAgents = []string{"nikto", "sqlmap", "nmap", "masscan", "zgrab", "nuclei",
+		"wpscan", "dirbuster", "gobuster", "acunetix", "netsparker"}
+	crawlerAgents = []string{"bot", "crawl", "spider", "slurp", "facebookexternalhit",
+		"mediapartners", "bingpreview", "feedfetcher"}
+	toolAgents = []string{"curl/", "wget/", "python-requests", "python-urllib", "aiohttp",
+		"go-http-client", "libwww-perl", "java/", "okhttp", "httpie", "scrapy",
+		"axios/", "node-fetch", "powershell"}
+	browserAgents = []string{"gecko", "applewebkit", "trident"}
+)
+
+// classifyUserAgent returns the class of a client by its User-Agent
+// alone, which says nothing of whether it is spoofed: scanners are
+// abusive, and clients that don't say what they are are tools.
+func classifyUserAgent(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case containsAny(ua, scannerAgents):
+		return Abusive
+	case containsAny(ua, crawlerAgents):
+		return Crawler
+	case containsAny(ua, toolAgents):
+		return Tool
+	case strings.HasPrefix(ua, "mozilla/") && containsAny(ua, browserAgents):
+		return Browser
+	}
+	return Tool
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
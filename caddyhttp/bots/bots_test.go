@@ -0,0 +1,246 @@
+package bots
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+const (
+	chromeUA = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	curlJA3  = "456523fc94726331a4d5a2e1d40b2cd7"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	for i, test := range []struct {
+		ua     string
+		expect string
+	}{
+		{chromeUA, Browser},
+		{"Mozilla/5.0 (Windows NT 10.0; rv:120.0) Gecko/20100101 Firefox/120.0", Browser},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", Crawler},
+		{"facebookexternalhit/1.1", Crawler},
+		{"curl/8.4.0", Tool},
+		{"python-requests/2.31.0", Tool},
+		{"Go-http-client/1.1", Tool},
+		{"", Tool},
+		{"Mozilla/5.0", Tool},
+		{"sqlmap/1.7", Abusive},
+		{"Mozilla/5.00 (Nikto/2.1.6)", Abusive},
+	} {
+		if actual := classifyUserAgent(test.ua); actual != test.expect {
+			t.Errorf("Test %d: expected %s to be %s, got %s", i, test.ua, test.expect, actual)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	b := Bots{Fingerprints: map[string]string{curlJA3: Tool}}
+	for i, test := range []struct {
+		ua     string
+		ja3    string
+		mitm   interface{}
+		expect string
+	}{
+		{chromeUA, "", nil, Browser},
+		{chromeUA, "0123456789abcdef0123456789abcdef", false, Browser},
+		{chromeUA, curlJA3, true, Spoofed}, // a browser UA on curl
+		{chromeUA, "", true, Spoofed},
+		{"curl/8.4.0", curlJA3, false, Tool},
+		{"Googlebot/2.1", "", true, Crawler},
+		{"sqlmap/1.7", curlJA3, nil, Abusive},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", test.ua)
+		ctx := r.Context()
+		if test.ja3 != "" {
+			ctx = context.WithValue(ctx, httpserver.TLSFingerprintCtxKey, test.ja3)
+		}
+		if test.mitm != nil {
+			ctx = context.WithValue(ctx, httpserver.MitmCtxKey, test.mitm)
+		}
+		if actual := b.classify(r.WithContext(ctx), "192.0.2.1"); actual != test.expect {
+			t.Errorf("Test %d: expected %s, got %s", i, test.expect, actual)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	start := time.Now()
+
+	rate := newTracker(3, 0)
+	for i := 0; i < 3; i++ {
+		if rate.abusive("192.0.2.1", "/", start.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("Request %d: expected not to be abusive yet", i)
+		}
+	}
+	if !rate.abusive("192.0.2.1", "/", start.Add(3*time.Second)) {
+		t.Error("Expected the 4th request in a minute to be abusive")
+	}
+	if rate.abusive("192.0.2.2", "/", start.Add(3*time.Second)) {
+		t.Error("Expected another client not to be abusive")
+	}
+	for i := 0; i < 100; i++ {
+		rate.abusive("192.0.2.1", "/", start.Add(4*time.Second))
+	}
+	if n := len(rate.clients["192.0.2.1"].times); n != 4 {
+		t.Errorf("Expected no more than %d request times to be kept, got %d", 4, n)
+	}
+	if rate.abusive("192.0.2.1", "/", start.Add(2*time.Minute)) {
+		t.Error("Expected the client not to be abusive after a quiet minute")
+	}
+
+	scan := newTracker(0, 4)
+	for i := 0; i < pathSamples; i++ {
+		if scan.abusive("192.0.2.1", "/index.html", start) {
+			t.Fatalf("Request %d: expected the same path not to be abusive", i)
+		}
+	}
+	var abusive bool
+	for i := 0; i < pathSamples; i++ {
+		abusive = scan.abusive("192.0.2.1", fmt.Sprintf("/admin%d.php", i), start)
+	}
+	if !abusive {
+		t.Error("Expected scanning paths to be abusive")
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	for i, test := range []struct {
+		paths  []string
+		expect float64
+	}{
+		{[]string{"/", "/", "/", "/"}, 0},
+		{[]string{"/", "/", "/a", "/a"}, 1},
+		{[]string{"/", "/a", "/b", "/c"}, 2},
+	} {
+		if actual := entropy(test.paths); actual != test.expect {
+			t.Errorf("Test %d: expected %v bits, got %v", i, test.expect, actual)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	b := Bots{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			class, _ := r.Context().Value(httpserver.BotClassCtxKey).(string)
+			w.Write([]byte(class))
+			return http.StatusOK, nil
+		}),
+		Site:        "bots-test",
+		Actions:     map[string]Action{Browser: Allow, Crawler: Tarpit, Tool: Block, Spoofed: Challenge, Abusive: Block},
+		TarpitDelay: time.Millisecond,
+		Secret:      []byte("secret"),
+	}
+
+	for i, test := range []struct {
+		ua           string
+		expectStatus int
+		expectBody   string
+	}{
+		{chromeUA, http.StatusOK, Browser},
+		{"Googlebot/2.1", http.StatusOK, Crawler},
+		{"curl/8.4.0", http.StatusForbidden, ""},
+	} {
+		r := httpserver.WithPlaceholders(httptest.NewRequest("GET", "/", nil))
+		r.Header.Set("User-Agent", test.ua)
+		w := httptest.NewRecorder()
+		status, err := b.ServeHTTP(&httpserver.ResponseWriterWrapper{ResponseWriter: w}, r)
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, w.Body.String())
+		}
+		if class := httpserver.NewReplacer(r, nil, "").Replace("{bot_class}"); class == "" || class == "{bot_class}" {
+			t.Errorf("Test %d: expected {bot_class} to be set, got %q", i, class)
+		}
+	}
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	if expect := `caddy_http_bot_requests_total{site="bots-test",class="tool",action="block"} 1`; !strings.Contains(buf.String(), expect) {
+		t.Errorf("Expected %s in:\n%s", expect, buf.String())
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	b := Bots{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Actions: map[string]Action{Spoofed: Challenge},
+		Secret:  []byte("secret"),
+	}
+	spoofed := func() *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", chromeUA)
+		return r.WithContext(context.WithValue(r.Context(), httpserver.MitmCtxKey, true))
+	}
+
+	w := httptest.NewRecorder()
+	status, _ := b.ServeHTTP(w, spoofed())
+	if status != 0 || w.Code != http.StatusForbidden {
+		t.Fatalf("Expected the challenge page, got status %d, response %d", status, w.Code)
+	}
+	m := regexp.MustCompile(`seed = "([0-9a-f]+)"`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("Expected the challenge page to have the seed, got:\n%s", w.Body.String())
+	}
+
+	r := spoofed()
+	r.AddCookie(&http.Cookie{Name: ChallengeCookie, Value: m[1]})
+	if status, _ := b.ServeHTTP(httptest.NewRecorder(), r); status != 0 {
+		t.Errorf("Expected the client with the seed but no answer to be challenged, got status %d", status)
+	}
+
+	answer := solve(m[1])
+	r = spoofed()
+	r.AddCookie(&http.Cookie{Name: ChallengeCookie, Value: answer})
+	if status, _ := b.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusOK {
+		t.Errorf("Expected the client with the cookie to be let through, got status %d", status)
+	}
+
+	r = spoofed()
+	r.RemoteAddr = "203.0.113.1:1234"
+	r.AddCookie(&http.Cookie{Name: ChallengeCookie, Value: answer})
+	if status, _ := b.ServeHTTP(httptest.NewRecorder(), r); status != 0 {
+		t.Errorf("Expected the cookie of another client to be challenged, got status %d", status)
+	}
+
+	now := time.Now()
+	if !b.passedChallenge(cookieRequest(solve(b.token("192.0.2.1", now.Add(-24*time.Hour)))), "192.0.2.1", now) {
+		t.Error("Expected yesterday's cookie to pass")
+	}
+	if b.passedChallenge(cookieRequest(solve(b.token("192.0.2.1", now.Add(-48*time.Hour)))), "192.0.2.1", now) {
+		t.Error("Expected an older cookie not to pass")
+	}
+}
+
+// solve answers the challenge with seed, as the challenge page does.
+func solve(seed string) string {
+	for n := 0; ; n++ {
+		if answer := seed + ":" + strconv.Itoa(n); answers(answer) {
+			return answer
+		}
+	}
+}
+
+func cookieRequest(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: ChallengeCookie, Value: token})
+	return r
+}
@@ -0,0 +1,110 @@
+package bots
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChallengeCookie is the name of the cookie that clients which pass
+// the challenge send.
+const ChallengeCookie = "caddy_bots"
+
+// challengeBits is how many leading zero bits the hash of the
+// answer to the challenge must have: the page tries about 2^18
+// answers, in well under a second, before it finds one.
+const challengeBits = 18
+
+// challengePage is the page that challenged clients get, whose
+// script works out the answer to the challenge and sets the cookie
+// to it. The cookie isn't in the page, so clients that don't run
+// the script, as most bots don't, never get past it, and those that
+// only look for it in the page don't either.
+const challengePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Checking your browser</title>
+<script>
+(function() {
+	var name = "%s", seed = "%s", bits = %d;
+	function fnv(s) {
+		var h = 0x811c9dc5;
+		for (var i = 0; i < s.length; i++) {
+			h = Math.imul(h ^ s.charCodeAt(i), 0x01000193);
+		}
+		return h >>> 0;
+	}
+	var n = 0;
+	while (fnv(seed + ":" + n) >>> (32 - bits) !== 0) {
+		n++;
+	}
+	document.cookie = name + "=" + seed + ":" + n + "; path=/; max-age=86400; SameSite=Lax";
+	location.reload();
+})();
+</script>
+</head>
+<body>
+<noscript>Please enable JavaScript to continue.</noscript>
+</body>
+</html>
+`
+
+// challenge responds with the challenge page for the client at ip.
+func (b Bots) challenge(w http.ResponseWriter, ip string, now time.Time) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprintf(w, challengePage, ChallengeCookie, b.token(ip, now), challengeBits)
+}
+
+// passedChallenge returns whether the client at ip that sent r has
+// the cookie of the challenge, answering that of today or yesterday.
+func (b Bots) passedChallenge(r *http.Request, ip string, now time.Time) bool {
+	cookie, err := r.Cookie(ChallengeCookie)
+	if err != nil {
+		return false
+	}
+	if !answers(cookie.Value) {
+		return false
+	}
+	seed := cookie.Value[:strings.IndexByte(cookie.Value, ':')]
+	for _, day := range []time.Time{now, now.Add(-24 * time.Hour)} {
+		if hmac.Equal([]byte(seed), []byte(b.token(ip, day))) {
+			return true
+		}
+	}
+	return false
+}
+
+// answers returns whether answer, the seed of a challenge and a
+// number separated by a colon, is an answer to it: whether its hash
+// has challengeBits leading zero bits.
+func answers(answer string) bool {
+	i := strings.IndexByte(answer, ':')
+	if i < 0 {
+		return false
+	}
+	if _, err := strconv.ParseUint(answer[i+1:], 10, 64); err != nil {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(answer))
+	return bits.LeadingZeros32(h.Sum32()) >= challengeBits
+}
+
+// token returns the seed of the challenge for the client at ip, on
+// the day of now, so that answers can't be shared between clients,
+// and expire.
+func (b Bots) token(ip string, now time.Time) string {
+	mac := hmac.New(sha256.New, b.Secret)
+	mac.Write([]byte(ip + "|" + now.UTC().Format("2006-01-02")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,166 @@
+package bots
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("bots", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultTarpitDelay is how long tarpitted requests are held by
+// default.
+const defaultTarpitDelay = 10 * time.Second
+
+// setup configures a new Bots middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	handler, err := botsParse(c)
+	if err != nil {
+		return err
+	}
+	handler.Site = cfg.Addr.String()
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		handler.Next = next
+		return handler
+	})
+
+	return nil
+}
+
+// botsParse parses
+//
+//	bots {
+//		rate         requests
+//		entropy      bits
+//		fingerprint  ja3 class
+//		tarpit_delay duration
+//		secret       key
+//		class        allow|tarpit|challenge|block
+//	}
+//
+// where the rate is the most requests per minute from a client, and
+// the entropy the most bits of entropy of its last 32 paths (up to 5,
+// if they are all different), before it is abusive; the fingerprint,
+// which may be given more than once, is the MD5 hash of a JA3
+// fingerprint of the given class; and each class, one of browser,
+// crawler, tool, spoofed and abusive, may be given the action taken
+// on its requests. Without a secret, challenge cookies are signed
+// with a random key, and so last until the next restart.
+func botsParse(c *caddy.Controller) (Bots, error) {
+	handler := Bots{
+		Actions:      make(map[string]Action),
+		Fingerprints: make(map[string]string),
+		TarpitDelay:  defaultTarpitDelay,
+	}
+	for class, action := range DefaultActions {
+		handler.Actions[class] = action
+	}
+	var rate int
+	var bits float64
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return handler, c.Err("bots may only be given once per site")
+		}
+		parsed = true
+		if len(c.RemainingArgs()) != 0 {
+			return handler, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "rate":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return handler, c.Errf("rate must be a positive number of requests per minute, not '%s'", args[0])
+				}
+				rate = n
+			case "entropy":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				f, err := strconv.ParseFloat(args[0], 64)
+				if err != nil || f <= 0 {
+					return handler, c.Errf("entropy must be a positive number of bits, not '%s'", args[0])
+				}
+				bits = f
+			case "fingerprint":
+				if len(args) != 2 {
+					return handler, c.ArgErr()
+				}
+				ja3 := strings.ToLower(args[0])
+				if b, err := hex.DecodeString(ja3); err != nil || len(b) != 16 {
+					return handler, c.Errf("invalid JA3 fingerprint '%s'; it must be an MD5 hash in hex", args[0])
+				}
+				if !isClass(args[1]) {
+					return handler, c.Errf("Unknown bots class '%s'", args[1])
+				}
+				handler.Fingerprints[ja3] = args[1]
+			case "tarpit_delay":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return handler, c.Errf("invalid tarpit_delay '%s'", args[0])
+				}
+				handler.TarpitDelay = d
+			case "secret":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				handler.Secret = []byte(args[0])
+			default:
+				if !isClass(what) {
+					return handler, c.Errf("Unknown bots property '%s'", what)
+				}
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				action, ok := actionNames[args[0]]
+				if !ok {
+					return handler, c.Errf("Unknown bots action '%s'", args[0])
+				}
+				handler.Actions[what] = action
+			}
+		}
+	}
+
+	if handler.Secret == nil {
+		handler.Secret = make([]byte, 32)
+		if _, err := rand.Read(handler.Secret); err != nil {
+			return handler, err
+		}
+	}
+	handler.clients = newTracker(rate, bits)
+
+	return handler, nil
+}
+
+// isClass returns whether name is that of a class.
+func isClass(name string) bool {
+	for _, class := range Classes {
+		if name == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package bots
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `bots`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Bots)
+	if !ok {
+		t.Fatalf("Expected handler to be type Bots, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if len(myHandler.Secret) != 32 {
+		t.Errorf("Expected a random secret, got %q", myHandler.Secret)
+	}
+}
+
+func TestBotsParse(t *testing.T) {
+	const ja3 = "83e04bc58d402f9633983cbf22724b02"
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		expectActions map[string]Action
+		expectPrints  map[string]string
+		expectDelay   time.Duration
+		expectRate    int
+		expectEntropy float64
+	}{
+		{`bots`, false, DefaultActions, map[string]string{}, defaultTarpitDelay, 0, 0},
+		{`bots {
+			rate 120
+			entropy 4.5
+			fingerprint 83E04BC58D402F9633983CBF22724B02 tool
+			tarpit_delay 3s
+			secret hush
+			tool block
+			crawler challenge
+		}`, false, map[string]Action{Browser: Allow, Crawler: Challenge, Tool: Block, Spoofed: Challenge, Abusive: Tarpit},
+			map[string]string{ja3: Tool}, 3 * time.Second, 120, 4.5},
+		{`bots tool`, true, nil, nil, 0, 0, 0},
+		{`bots {
+			rate 0
+		}`, true, nil, nil, 0, 0, 0},
+		{`bots {
+			entropy lots
+		}`, true, nil, nil, 0, 0, 0},
+		{`bots {
+			fingerprint 83e04bc58d402f96 tool
+		}`, true, nil, nil, 0, 0, 0},
+		{`bots {
+			fingerprint 83e04bc58d402f9633983cbf22724b02 robot
+		}`, true, nil, nil, 0, 0, 0},
+		{`bots {
+			tarpit_delay forever
+		}`, true, nil, nil, 0, 0, 0},
+		{`bots {
+			tool ignore
+		}`, true, nil, nil, 0, 0, 0},
+		{`bots {
+			robot block
+		}`, true, nil, nil, 0, 0, 0},
+		{`bots
+		bots`, true, nil, nil, 0, 0, 0},
+	} {
+		handler, err := botsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(handler.Actions, test.expectActions) {
+			t.Errorf("Test %d: expected actions %v, got %v", i, test.expectActions, handler.Actions)
+		}
+		if !reflect.DeepEqual(handler.Fingerprints, test.expectPrints) {
+			t.Errorf("Test %d: expected fingerprints %v, got %v", i, test.expectPrints, handler.Fingerprints)
+		}
+		if handler.TarpitDelay != test.expectDelay {
+			t.Errorf("Test %d: expected tarpit delay %v, got %v", i, test.expectDelay, handler.TarpitDelay)
+		}
+		if handler.clients.Rate != test.expectRate || handler.clients.Entropy != test.expectEntropy {
+			t.Errorf("Test %d: expected rate %d and entropy %v, got %d and %v",
+				i, test.expectRate, test.expectEntropy, handler.clients.Rate, handler.clients.Entropy)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package browse
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Archive formats a directory can be downloaded as.
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// Default limits on what a single archive may contain.
+const (
+	defaultArchiveMaxFiles = 10000
+	defaultArchiveMaxSize  = 1 << 30
+)
+
+// errArchiveTooLarge is returned when a directory exceeds the
+// limits on the number of entries or the size of an archive.
+var errArchiveTooLarge = errors.New("directory too large to archive")
+
+// archiveEntry is a file or directory to be put in an archive.
+type archiveEntry struct {
+	name string // relative to the archived directory, slash-separated
+	path string // the URL path, used to open it
+	info os.FileInfo
+}
+
+// allowsArchive returns whether directories can be downloaded
+// in format.
+func (c *Config) allowsArchive(format string) bool {
+	for _, f := range c.ArchiveFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded returns whether the entry at urlPath, with info fi,
+// must be left out of archives; ignored are the ignore patterns
+// of its directory.
+func (c *Config) excluded(urlPath string, fi os.FileInfo, ignored []string) bool {
+	if c.isHidden(urlPath) || c.Fs.IsHidden(fi) || c.isIgnored(ignored, fi) {
+		return true
+	}
+	for _, pattern := range c.ArchiveExclude {
+		if ok, _ := path.Match(pattern, fi.Name()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeArchive streams the directory at the URL path of r as an
+// archive in format. The directory is walked once beforehand to
+// enforce the limits, since an error can't be reported once the
+// archive has started.
+func (b Browse) ServeArchive(w http.ResponseWriter, r *http.Request, bc *Config, format string) (int, error) {
+	if !bc.allowsArchive(format) {
+		return http.StatusBadRequest, fmt.Errorf("unsupported archive format: %s", format)
+	}
+
+	entries, err := bc.archiveEntries(r.URL.Path)
+	if err == errArchiveTooLarge {
+		// the limits are the site's, not the request's
+		return http.StatusForbidden, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	name := path.Base(strings.TrimSuffix(r.URL.Path, "/"))
+	if name == "/" || name == "." {
+		name = "archive"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+
+	switch format {
+	case archiveZip:
+		w.Header().Set("Content-Type", "application/zip")
+		err = bc.writeZip(w, name, entries)
+	case archiveTarGz:
+		w.Header().Set("Content-Type", "application/gzip")
+		err = bc.writeTarGz(w, name, entries)
+	}
+	if err != nil {
+		// the status has been sent, so all that
+		// can be done is to truncate the archive
+		return 0, err
+	}
+	return 0, nil
+}
+
+// archiveEntries walks the directory at urlPath and returns what
+// is to be archived, leaving out symlinked directories as they
+// may form cycles.
+func (c *Config) archiveEntries(urlPath string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	var size int64
+
+	var walk func(dir, prefix string) error
+	walk = func(dir, prefix string) error {
+		f, err := c.Fs.Root.Open(dir)
+		if err != nil {
+			return err
+		}
+		files, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		ignored := c.ignorePatterns(dir)
+		for _, fi := range files {
+			p := path.Join(dir, fi.Name())
+			if c.excluded(p, fi, ignored) {
+				continue
+			}
+			if isSymlink(fi) {
+				target, err := c.Fs.Root.Open(p)
+				if err != nil {
+					continue // dangling
+				}
+				fi, err = target.Stat()
+				target.Close()
+				if err != nil || fi.IsDir() {
+					continue
+				}
+			}
+			entries = append(entries, archiveEntry{name: prefix + fi.Name(), path: p, info: fi})
+			if !fi.IsDir() {
+				size += fi.Size()
+			}
+			if (c.ArchiveMaxFiles > 0 && len(entries) > c.ArchiveMaxFiles) ||
+				(c.ArchiveMaxSize > 0 && size > c.ArchiveMaxSize) {
+				return errArchiveTooLarge
+			}
+			if fi.IsDir() {
+				if err := walk(p, prefix+fi.Name()+"/"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	return entries, walk(path.Clean("/"+urlPath), "")
+}
+
+// copyEntry copies the content of the file e to w. It copies
+// no more than the size seen when walking, so that a file that
+// grew since can't exceed the limits or corrupt a tar stream.
+func (c *Config) copyEntry(w io.Writer, e archiveEntry) error {
+	f, err := c.Fs.Root.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(w, f, e.info.Size())
+	return err
+}
+
+func (c *Config) writeZip(w io.Writer, root string, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = root + "/" + e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+			if _, err := zw.CreateHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := c.copyEntry(fw, e); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (c *Config) writeTarGz(w io.Writer, root string, entries []archiveEntry) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr, err := tar.FileInfoHeader(e.info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = root + "/" + e.name
+		if e.info.IsDir() {
+			hdr.Name += "/"
+		}
+		// ownership on the server means nothing to the client
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !e.info.IsDir() {
+			if err := c.copyEntry(tw, e); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -4,11 +4,17 @@ package browse
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -41,6 +47,68 @@ type Config struct {
 	Fs        staticfiles.FileServer
 	Variables interface{}
 	Template  *template.Template
+
+	// PathTemplates are used instead of Template to list
+	// directories within their paths; the longest matching
+	// path wins.
+	PathTemplates []PathTemplate
+
+	// IgnoreFile is the name of the file in a directory that
+	// lists entries to leave out of its listing and archives;
+	// if empty, ignore files aren't used.
+	IgnoreFile string
+
+	// Writable enables uploading files to, deleting from and
+	// creating directories in the site root within PathScope.
+	Writable bool
+
+	// Root is the directory on disk that writes go to.
+	Root string
+
+	// Rules control which users may use which write methods.
+	Rules []AccessRule
+
+	// MaxUpload is the largest upload request body allowed,
+	// in bytes; if 0, uploads are not limited.
+	MaxUpload int64
+
+	// ArchiveFormats are the formats directories can be
+	// downloaded in with ?download=format; if empty,
+	// directories can't be downloaded.
+	ArchiveFormats []string
+
+	// ArchiveMaxFiles and ArchiveMaxSize limit the number of
+	// entries and the total size of the files in an archive;
+	// if 0, there is no limit.
+	ArchiveMaxFiles int
+	ArchiveMaxSize  int64
+
+	// ArchiveExclude are patterns of names of files and
+	// directories to leave out of archives.
+	ArchiveExclude []string
+
+	// Checksums enables the checksums of files in listings,
+	// with ?checksum=sha256; as they read every file listed,
+	// they are off by default.
+	Checksums bool
+}
+
+// PathTemplate is a template for listing the directories
+// within a path.
+type PathTemplate struct {
+	Path     string
+	Template *template.Template
+}
+
+// template returns the template for listing urlPath.
+func (c *Config) template(urlPath string) *template.Template {
+	tpl, longest := c.Template, ""
+	for _, pt := range c.PathTemplates {
+		if httpserver.Path(urlPath).Matches(pt.Path) && len(pt.Path) > len(longest) {
+			tpl, longest = pt.Template, pt.Path
+		}
+	}
+	return tpl
 }
 
 // A Listing is the context used to fill out a template.
@@ -72,9 +140,21 @@ type Listing struct {
 	// If ≠0 then Items have been limited to that many elements
 	ItemsLimitedTo int
 
+	// If ≠0 then that many elements were skipped before Items
+	ItemsOffset int
+
+	// Whether files can be uploaded to and deleted from the directory
+	CanWrite bool
+
+	// The formats the directory can be downloaded in
+	ArchiveFormats []string
+
 	// Optional custom variables for use in browse templates
 	User interface{}
 
+	// All the items, before offset and limit are applied
+	allItems []FileInfo
+
 	httpserver.Context
 }
 
@@ -119,6 +199,16 @@ type FileInfo struct {
 	Mode      os.FileMode
 	IsDir     bool
 	IsSymlink bool
+
+	// SymlinkTarget is the path on the site a symbolic link
+	// points to, if it points within the site root and
+	// the site's files are on the local file system
+	SymlinkTarget string `json:",omitempty"`
+
+	// Checksum is the hex-encoded SHA-256 of a file's
+	// content, if requested with ?checksum=sha256 where
+	// checksums are enabled
+	Checksum string `json:",omitempty"`
 }
 
 // HumanSize returns the size of the file as a human-readable string
@@ -235,6 +325,7 @@ func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string, config
 		hasIndexFile        bool
 	)
 
+	ignored := config.ignorePatterns(urlPath)
 	for _, f := range files {
 		name := f.Name()
 
@@ -245,6 +336,10 @@ func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string, config
 			}
 		}
 
+		if config.isIgnored(ignored, f) {
+			continue
+		}
+
 		isDir := f.IsDir() || isSymlinkTargetDir(f, urlPath, config)
 
 		if isDir {
@@ -261,13 +356,14 @@ func directoryListing(files []os.FileInfo, canGoUp bool, urlPath string, config
 		url := url.URL{Path: "./" + name} // prepend with "./" to fix paths with ':' in the name
 
 		fileinfos = append(fileinfos, FileInfo{
-			IsDir:     isDir,
-			IsSymlink: isSymlink(f),
-			Name:      f.Name(),
-			Size:      f.Size(),
-			URL:       url.String(),
-			ModTime:   f.ModTime().UTC(),
-			Mode:      f.Mode(),
+			IsDir:         isDir,
+			IsSymlink:     isSymlink(f),
+			SymlinkTarget: symlinkTarget(f, urlPath, config),
+			Name:          f.Name(),
+			Size:          f.Size(),
+			URL:           url.String(),
+			ModTime:       f.ModTime().UTC(),
+			Mode:          f.Mode(),
 		})
 	}
 
@@ -286,6 +382,38 @@ func isSymlink(f os.FileInfo) bool {
 	return f.Mode()&os.ModeSymlink != 0
 }
 
+// symlinkTarget returns the path on the site of the target of f if
+// it is a symbolic link and the file system is a directory on disk,
+// or "" if not, or if the target is outside the directory, so that
+// listings don't give away the layout of the disk.
+func symlinkTarget(f os.FileInfo, urlPath string, config *Config) string {
+	root := config.Fs.Root
+	if hfs, ok := root.(httpserver.HiddenFS); ok {
+		root = hfs.FileSystem
+	}
+	dir, ok := root.(http.Dir)
+	if !ok || !isSymlink(f) {
+		return ""
+	}
+	base, err := filepath.Abs(string(dir))
+	if err != nil {
+		return ""
+	}
+	link := filepath.Join(base, filepath.FromSlash(path.Join(urlPath, f.Name())))
+	target, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return path.Join("/", filepath.ToSlash(rel))
+}
+
 // isSymlinkTargetDir return true if f's symbolic link target
 // is a directory. Return false if not a symbolic link.
 func isSymlinkTargetDir(f os.FileInfo, urlPath string, config *Config) bool {
@@ -322,6 +450,10 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		return b.Next.ServeHTTP(w, r)
 	}
 
+	if bc.Writable && isWriteMethod(r.Method) {
+		return b.ServeWrite(w, r, bc)
+	}
+
 	// Browse works on existing directories; delegate everything else
 	requestedFilepath, err := bc.Fs.Root.Open(r.URL.Path)
 	if err != nil {
@@ -399,11 +531,12 @@ func (b Browse) loadDirectoryContents(requestedFilepath http.File, urlPath strin
 }
 
 // handleSortOrder gets and stores for a Listing the 'sort' and 'order',
-// and reads 'limit' if given. The latter is 0 if not given.
+// and reads 'limit' and 'offset' if given. These are 0 if not given.
 //
 // This sets Cookies.
-func (b Browse) handleSortOrder(w http.ResponseWriter, r *http.Request, scope string) (sort string, order string, limit int, err error) {
+func (b Browse) handleSortOrder(w http.ResponseWriter, r *http.Request, scope string) (sort string, order string, limit int, offset int, err error) {
 	sort, order, limitQuery := r.URL.Query().Get("sort"), r.URL.Query().Get("order"), r.URL.Query().Get("limit")
+	offsetQuery := r.URL.Query().Get("offset")
 
 	// If the query 'sort' or 'order' is empty, use defaults or any values previously saved in Cookies
 	switch sort {
@@ -433,6 +566,13 @@ func (b Browse) handleSortOrder(w http.ResponseWriter, r *http.Request, scope st
 		}
 	}
 
+	if offsetQuery != "" {
+		offset, err = strconv.Atoi(offsetQuery)
+		if err == nil && offset < 0 {
+			err = fmt.Errorf("negative offset: %d", offset)
+		}
+	}
+
 	return
 }
 
@@ -452,42 +592,96 @@ func (b Browse) ServeListing(w http.ResponseWriter, r *http.Request, requestedFi
 	if containsIndex && !b.IgnoreIndexes { // directory isn't browsable
 		return b.Next.ServeHTTP(w, r)
 	}
+	if format := r.URL.Query().Get("download"); format != "" {
+		return b.ServeArchive(w, r, bc, strings.ToLower(format))
+	}
+	if name := r.URL.Query().Get("thumbnail"); name != "" {
+		return b.ServeThumbnail(w, r, bc, name)
+	}
 	listing.Context = httpserver.Context{
 		Root: bc.Fs.Root,
 		Req:  r,
 		URL:  r.URL,
 	}
 	listing.User = bc.Variables
+	listing.ArchiveFormats = bc.ArchiveFormats
+	if bc.Writable {
+		user, _ := r.Context().Value(httpserver.RemoteUserCtxKey).(string)
+		listing.CanWrite = bc.Allowed(user, http.MethodPost)
+	}
 
 	// Copy the query values into the Listing struct
-	var limit int
-	listing.Sort, listing.Order, limit, err = b.handleSortOrder(w, r, bc.PathScope)
+	var limit, offset int
+	listing.Sort, listing.Order, limit, offset, err = b.handleSortOrder(w, r, bc.PathScope)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
 
 	listing.applySort()
 
+	total := len(listing.Items)
+	listing.allItems = listing.Items
+	if offset > 0 {
+		if offset > len(listing.Items) {
+			offset = len(listing.Items)
+		}
+		listing.Items = listing.Items[offset:]
+		listing.ItemsOffset = offset
+	}
+
 	if limit > 0 && limit <= len(listing.Items) {
 		listing.Items = listing.Items[:limit]
 		listing.ItemsLimitedTo = limit
 	}
 
+	switch checksum := r.URL.Query().Get("checksum"); checksum {
+	case "":
+	case "sha256":
+		if !bc.Checksums {
+			return http.StatusBadRequest, fmt.Errorf("checksums are not enabled")
+		}
+		addChecksums(listing, bc)
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unsupported checksum: %s", checksum)
+	}
+
+	// the format can be requested in the query string for
+	// the convenience of scripts, or with the Accept header
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		acceptHeader := strings.ToLower(strings.Join(r.Header["Accept"], ","))
+		switch {
+		case strings.Contains(acceptHeader, "application/json"):
+			format = "json"
+		case strings.Contains(acceptHeader, "text/csv"):
+			format = "csv"
+		}
+	}
+
 	var buf *bytes.Buffer
-	acceptHeader := strings.ToLower(strings.Join(r.Header["Accept"], ","))
-	switch {
-	case strings.Contains(acceptHeader, "application/json"):
+	switch format {
+	case "json":
 		if buf, err = b.formatAsJSON(listing, bc); err != nil {
 			return http.StatusInternalServerError, err
 		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	case "csv":
+		if buf, err = b.formatAsCSV(listing, bc); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
 
-	default: // There's no 'application/json' in the 'Accept' header; browse normally
+	case "", "html": // browse normally
 		if buf, err = b.formatAsHTML(listing, bc); err != nil {
 			return http.StatusInternalServerError, err
 		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unsupported listing format: %s", format)
 	}
 
 	buf.WriteTo(w)
@@ -506,8 +700,51 @@ func (b Browse) formatAsJSON(listing *Listing, bc *Config) (*bytes.Buffer, error
 	return buf, err
 }
 
+// csvHeader is the first record of a listing formatted as CSV.
+var csvHeader = []string{"name", "size", "url", "mod_time", "mode", "is_dir", "is_symlink", "symlink_target", "checksum"}
+
+func (b Browse) formatAsCSV(listing *Listing, bc *Config) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	cw := csv.NewWriter(buf)
+	cw.Write(csvHeader)
+	for _, fi := range listing.Items {
+		cw.Write([]string{
+			fi.Name,
+			strconv.FormatInt(fi.Size, 10),
+			fi.URL,
+			fi.ModTime.Format(time.RFC3339),
+			fi.Mode.String(),
+			strconv.FormatBool(fi.IsDir),
+			strconv.FormatBool(fi.IsSymlink),
+			fi.SymlinkTarget,
+			fi.Checksum,
+		})
+	}
+	cw.Flush()
+	return buf, cw.Error()
+}
+
+// addChecksums sets the checksum of every file in listing.
+// Files that cannot be read are left without one.
+func addChecksums(listing *Listing, bc *Config) {
+	for i, fi := range listing.Items {
+		if fi.IsDir {
+			continue
+		}
+		f, err := bc.Fs.Root.Open(path.Join(listing.Path, fi.Name))
+		if err != nil {
+			continue
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err == nil {
+			listing.Items[i].Checksum = hex.EncodeToString(h.Sum(nil))
+		}
+		f.Close()
+	}
+}
+
 func (b Browse) formatAsHTML(listing *Listing, bc *Config) (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
-	err := bc.Template.Execute(buf, listing)
+	err := bc.template(listing.Path).Execute(buf, listing)
 	return buf, err
 }
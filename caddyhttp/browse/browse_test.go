@@ -1,15 +1,29 @@
 package browse
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
 	"strings"
@@ -577,10 +591,11 @@ func TestDirSymlink(t *testing.T) {
 			}
 
 			type jsonEntry struct {
-				Name      string
-				IsDir     bool
-				IsSymlink bool
-				URL       string
+				Name          string
+				IsDir         bool
+				IsSymlink     bool
+				SymlinkTarget string
+				URL           string
 			}
 			var entries []jsonEntry
 			if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
@@ -602,6 +617,10 @@ func TestDirSymlink(t *testing.T) {
 				if e.URL != tc.expectedURL {
 					t.Errorf("Test %d - wrong URL, expected %v, got %v", i, tc.expectedURL, e.URL)
 				}
+				// the target is given as a path on the site
+				if expected := "/" + path.Base(tc.source); e.SymlinkTarget != expected {
+					t.Errorf("Test %d - wrong symlink target, expected %v, got %v", i, expected, e.SymlinkTarget)
+				}
 			}
 			if !found {
 				t.Errorf("Test %d - failed, could not find name %v", i, tc.expectedName)
@@ -609,3 +628,671 @@ func TestDirSymlink(t *testing.T) {
 		}()
 	}
 }
+
+func TestSymlinkTargetOutsideRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	root, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := os.Symlink(outside, filepath.Join(root, "abs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../"+filepath.Base(outside), filepath.Join(root, "rel")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Browse{
+		Next:    httpserver.EmptyNext,
+		Configs: []Config{{PathScope: "/", Fs: staticfiles.FileServer{Root: http.Dir(root)}}},
+	}
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=json", nil))
+	var items []FileInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %v", items)
+	}
+	for _, item := range items {
+		if !item.IsSymlink || item.SymlinkTarget != "" {
+			t.Errorf("Expected the target of %s, outside the root, to be left out, got %q", item.Name, item.SymlinkTarget)
+		}
+	}
+}
+
+func TestBrowseFormats(t *testing.T) {
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			t.Fatalf("Next shouldn't be called: %s", r.URL)
+			return 0, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/photos/",
+				Fs: staticfiles.FileServer{
+					Root: http.Dir("./testdata"),
+				},
+			},
+		},
+	}
+
+	// hidden.html, test.html, test1/, test2.html, test3.html
+	for i, test := range []struct {
+		query          string
+		accept         string
+		expectedStatus int
+		expectedType   string
+		expectedNames  []string
+	}{
+		{"?format=json&sort=name&order=asc&offset=1&limit=2", "", http.StatusOK, "application/json", []string{"test.html", "test1"}},
+		{"?format=csv&sort=name&order=asc&offset=3", "", http.StatusOK, "text/csv", []string{"test2.html", "test3.html"}},
+		{"?sort=name&order=asc&offset=10", "text/csv", http.StatusOK, "text/csv", []string{}},
+		{"?format=xml", "", http.StatusBadRequest, "", nil},
+		{"?offset=-1", "", http.StatusBadRequest, "", nil},
+		{"?format=json&checksum=md5", "", http.StatusBadRequest, "", nil},
+		{"?format=json&checksum=sha256", "", http.StatusBadRequest, "", nil},
+	} {
+		req := httptest.NewRequest("GET", "/photos/"+test.query, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		code, _ := b.ServeHTTP(rec, req)
+		if code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, code)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, test.expectedType) {
+			t.Errorf("Test %d: Expected Content-Type %s, got %s", i, test.expectedType, ct)
+		}
+		if total := rec.Header().Get("X-Total-Count"); total != "5" {
+			t.Errorf("Test %d: Expected X-Total-Count 5, got %q", i, total)
+		}
+
+		var names []string
+		if test.expectedType == "text/csv" {
+			records, err := csv.NewReader(rec.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("Test %d: Failed to parse CSV: %v", i, err)
+			}
+			if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+				t.Errorf("Test %d: Expected CSV header, got %v", i, records)
+			}
+			for _, record := range records[1:] {
+				names = append(names, record[0])
+			}
+		} else {
+			var items []FileInfo
+			if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+				t.Fatalf("Test %d: Failed to parse JSON: %v", i, err)
+			}
+			for _, item := range items {
+				names = append(names, item.Name)
+			}
+		}
+		if strings.Join(names, ",") != strings.Join(test.expectedNames, ",") {
+			t.Errorf("Test %d: Expected items %v, got %v", i, test.expectedNames, names)
+		}
+	}
+
+	// checksums are only computed for files, on request, where enabled
+	b.Configs[0].Checksums = true
+	req := httptest.NewRequest("GET", "/photos/?format=json&sort=name&order=asc&checksum=sha256", nil)
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, req)
+	var items []FileInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "photos", "test.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	for _, item := range items {
+		switch {
+		case item.Name == "test.html" && item.Checksum != hex.EncodeToString(sum[:]):
+			t.Errorf("Expected checksum of test.html to be %x, got %s", sum, item.Checksum)
+		case item.IsDir && item.Checksum != "":
+			t.Errorf("Expected no checksum for directory %s, got %s", item.Name, item.Checksum)
+		}
+	}
+}
+
+func TestBrowseWrite(t *testing.T) {
+	root, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "files"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "files", "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "files", "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := os.Symlink(outside, filepath.Join(root, "files", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "files", "old.txt"), filepath.Join(root, "files", "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/files",
+				Fs: staticfiles.FileServer{
+					Root: http.Dir(root),
+					Hide: []string{"/files/secret"},
+				},
+				Writable: true,
+				Root:     root,
+				Rules: []AccessRule{
+					{User: "admin", Allow: true, Methods: []string{"*"}},
+					{User: "*", Allow: false, Methods: []string{"DELETE"}},
+					{User: "*", Allow: true, Methods: []string{"POST", "MKCOL"}},
+				},
+				MaxUpload: 1024,
+			},
+		},
+	}
+
+	upload := func(fields map[string]string) (string, io.Reader) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, value := range fields {
+			if name == "mkdir" {
+				mw.WriteField(name, value)
+				continue
+			}
+			fw, _ := mw.CreateFormFile("file", name)
+			io.WriteString(fw, value)
+		}
+		mw.Close()
+		return mw.FormDataContentType(), &body
+	}
+
+	for i, test := range []struct {
+		method         string
+		path           string
+		user           string
+		origin         string
+		fields         map[string]string
+		expectedStatus int
+		expectedFile   string // relative to root; its expected content, or "/" for a directory
+		expectedData   string
+		expectGone     string
+	}{
+		{"POST", "/files/", "", "", map[string]string{"new.txt": "new"}, http.StatusCreated, "files/new.txt", "new", ""},
+		{"POST", "/files/", "", "", map[string]string{"old.txt": "replaced"}, http.StatusCreated, "files/old.txt", "replaced", ""},
+		{"POST", "/files/", "", "", map[string]string{"mkdir": "sub"}, http.StatusCreated, "files/sub", "/", ""},
+		{"POST", "/files/", "", "", map[string]string{"big.txt": strings.Repeat("x", 2000)}, http.StatusRequestEntityTooLarge, "", "", "files/big.txt"},
+		{"POST", "/files/", "", "", map[string]string{"mkdir": ".."}, http.StatusBadRequest, "", "", ""},
+		{"POST", "/files/", "", "", map[string]string{"secret": "overwritten"}, http.StatusForbidden, "files/secret", "secret", ""},
+		{"POST", "/files/old.txt", "", "", map[string]string{"x": "x"}, http.StatusMethodNotAllowed, "files/old.txt", "replaced", ""},
+		{"MKCOL", "/files/made", "", "", nil, http.StatusCreated, "files/made", "/", ""},
+		{"MKCOL", "/files/made", "", "", nil, http.StatusMethodNotAllowed, "", "", ""},
+		{"MKCOL", "/files/missing/made", "", "", nil, http.StatusConflict, "", "", "files/missing"},
+		{"DELETE", "/files/made", "", "", nil, http.StatusForbidden, "files/made", "/", ""},
+		{"DELETE", "/files/made", "admin", "", nil, http.StatusNoContent, "", "", "files/made"},
+		{"DELETE", "/files/secret", "admin", "", nil, http.StatusNotFound, "files/secret", "secret", ""},
+		{"DELETE", "/files/", "admin", "", nil, http.StatusForbidden, "files", "/", ""},
+		{"DELETE", "/files/../files", "admin", "", nil, http.StatusForbidden, "files", "/", ""},
+		{"PUT", "/files/put.txt", "", "", nil, http.StatusTeapot, "", "", "files/put.txt"},
+		{"POST", "/files/link/", "", "", map[string]string{"escaped.txt": "x"}, http.StatusForbidden, "", "", "files/link/escaped.txt"},
+		{"POST", "/files/", "", "", map[string]string{"link.txt": "x"}, http.StatusForbidden, "files/old.txt", "replaced", ""},
+		{"MKCOL", "/files/link/made", "", "", nil, http.StatusForbidden, "", "", "files/link/made"},
+		{"DELETE", "/files/link", "admin", "", nil, http.StatusForbidden, "files/link", "/", ""},
+		{"POST", "/files/", "", "http://evil.example", map[string]string{"csrf.txt": "x"}, http.StatusForbidden, "", "", "files/csrf.txt"},
+		{"POST", "/files/", "", "http://example.com", map[string]string{"same.txt": "same"}, http.StatusCreated, "files/same.txt", "same", ""},
+	} {
+		var body io.Reader
+		contentType := ""
+		if test.fields != nil {
+			contentType, body = upload(test.fields)
+		}
+		req := httptest.NewRequest(test.method, test.path, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if test.user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), httpserver.RemoteUserCtxKey, test.user))
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		rec := httptest.NewRecorder()
+		code, _ := b.ServeHTTP(rec, req)
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, code)
+		}
+		if test.expectedFile != "" {
+			fpath := filepath.Join(root, filepath.FromSlash(test.expectedFile))
+			if test.expectedData == "/" {
+				if fi, err := os.Stat(fpath); err != nil || !fi.IsDir() {
+					t.Errorf("Test %d: Expected directory %s", i, test.expectedFile)
+				}
+			} else if data, err := ioutil.ReadFile(fpath); err != nil || string(data) != test.expectedData {
+				t.Errorf("Test %d: Expected %s to contain %q, got %q (%v)", i, test.expectedFile, test.expectedData, data, err)
+			}
+		}
+		if test.expectGone != "" {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(test.expectGone))); !os.IsNotExist(err) {
+				t.Errorf("Test %d: Expected %s not to exist", i, test.expectGone)
+			}
+		}
+	}
+
+	// failed uploads leave nothing behind
+	files, _ := ioutil.ReadDir(filepath.Join(root, "files"))
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), ".upload-") {
+			t.Errorf("Temporary upload file %s was not removed", f.Name())
+		}
+	}
+
+	// browsers are sent back to the listing, which offers the upload form
+	contentType, body := upload(map[string]string{"form.txt": "form"})
+	req := httptest.NewRequest("POST", "/files/", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/files/" {
+		t.Errorf("Expected redirect to listing, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	for i, test := range []struct {
+		rules  []AccessRule
+		user   string
+		method string
+		expect bool
+	}{
+		{nil, "", "POST", false},
+		{nil, "", "DELETE", false},
+		{nil, "alice", "DELETE", true},
+		{[]AccessRule{{User: "*", Allow: true, Methods: []string{"POST"}}}, "", "POST", true},
+		{[]AccessRule{{User: "*", Allow: true, Methods: []string{"POST"}}}, "", "DELETE", false},
+		{[]AccessRule{{User: "alice", Allow: false, Methods: []string{"*"}}}, "alice", "MKCOL", false},
+	} {
+		c := Config{Rules: test.rules}
+		if got := c.Allowed(test.user, test.method); got != test.expect {
+			t.Errorf("Test %d: Expected %q to be allowed %s: %v, got %v", i, test.user, test.method, test.expect, got)
+		}
+	}
+}
+
+func TestBrowseArchive(t *testing.T) {
+	root, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"dir/a.txt":       "a",
+		"dir/sub/b.txt":   "bb",
+		"dir/debug.log":   "excluded",
+		"dir/secret.txt":  "hidden",
+		"dir/.git/config": "excluded",
+	} {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newBrowse := func(maxFiles int, maxSize int64) Browse {
+		return Browse{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				return http.StatusTeapot, nil
+			}),
+			Configs: []Config{
+				{
+					PathScope: "/",
+					Fs: staticfiles.FileServer{
+						Root: http.Dir(root),
+						Hide: []string{"/dir/secret.txt"},
+					},
+					ArchiveFormats:  []string{archiveZip, archiveTarGz},
+					ArchiveMaxFiles: maxFiles,
+					ArchiveMaxSize:  maxSize,
+					ArchiveExclude:  []string{"*.log", ".git"},
+				},
+			},
+		}
+	}
+	expected := map[string]string{
+		"dir/a.txt":     "a",
+		"dir/sub/":      "",
+		"dir/sub/b.txt": "bb",
+	}
+
+	// zip
+	rec := httptest.NewRecorder()
+	code, err := newBrowse(0, 0).ServeHTTP(rec, httptest.NewRequest("GET", "/dir/?download=zip", nil))
+	if code != 0 || err != nil {
+		t.Fatalf("Expected zip to be served, got %d: %v", code, err)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="dir.zip"` {
+		t.Errorf("Unexpected Content-Disposition: %s", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected zip entries %v, got %v", expected, got)
+	}
+
+	// tar.gz
+	rec = httptest.NewRecorder()
+	code, err = newBrowse(0, 0).ServeHTTP(rec, httptest.NewRequest("GET", "/dir/?download=tar.gz", nil))
+	if code != 0 || err != nil {
+		t.Fatalf("Expected tar.gz to be served, got %d: %v", code, err)
+	}
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to read gzip: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	got = make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		data, _ := ioutil.ReadAll(tr)
+		got[hdr.Name] = string(data)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected tar entries %v, got %v", expected, got)
+	}
+
+	for i, test := range []struct {
+		query          string
+		maxFiles       int
+		maxSize        int64
+		expectedStatus int
+	}{
+		{"?download=rar", 0, 0, http.StatusBadRequest},
+		{"?download=zip", 2, 0, http.StatusForbidden},
+		{"?download=zip", 3, 0, 0},
+		{"?download=zip", 0, 2, http.StatusForbidden},
+		{"?download=zip", 0, 3, 0},
+	} {
+		code, _ := newBrowse(test.maxFiles, test.maxSize).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/dir/"+test.query, nil))
+		if code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, code)
+		}
+	}
+
+	// formats must be enabled
+	b := newBrowse(0, 0)
+	b.Configs[0].ArchiveFormats = []string{archiveTarGz}
+	if code, _ := b.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/dir/?download=zip", nil)); code != http.StatusBadRequest {
+		t.Errorf("Expected disabled format to be refused, got %d", code)
+	}
+}
+
+func TestBrowseIgnoreFileAndTemplates(t *testing.T) {
+	root, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"docs/.caddyignore":    "# build output\n*.o\nbuild/\n[\n",
+		"docs/README.md":       "# Docs\n\n<script>alert(1)</script>\n",
+		"docs/main.c":          "",
+		"docs/main.o":          "",
+		"docs/build/out":       "",
+		"docs/sub/build":       "", // a file, so not ignored by build/
+		"photos/.caddyignore":  "",
+		"photos/a.txt":         "",
+		"notes/README.txt":     "<b>plain</b>",
+		"notes/README.md.bak":  "",
+		"hidden/README.md":     "hidden",
+		"hidden/.caddyignore":  "README.md",
+		"hidden/other.txt":     "",
+		"hidden/build/x":       "",
+		"hidden/sub/build/out": "",
+	} {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/",
+				Fs:        staticfiles.FileServer{Root: http.Dir(root)},
+				Template:  template.Must(template.New("listing").Parse(`default:{{.Readme}}`)),
+				PathTemplates: []PathTemplate{
+					{Path: "/photos", Template: template.Must(template.New("listing").Parse(`photos`))},
+					{Path: "/notes", Template: template.Must(template.New("listing").Parse(`notes:{{.Readme}}`))},
+				},
+				IgnoreFile:     defaultIgnoreFile,
+				ArchiveFormats: []string{archiveZip},
+			},
+		},
+	}
+
+	for i, test := range []struct {
+		path          string
+		expectedNames []string
+	}{
+		{"/docs/", []string{"main.c", "README.md", "sub"}},
+		{"/docs/sub/", []string{"build"}},
+		{"/photos/", []string{"a.txt"}},
+		{"/hidden/", []string{"build", "other.txt", "sub"}},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path+"?format=json&sort=name&order=asc", nil)
+		if code, err := b.ServeHTTP(rec, req); code != http.StatusOK {
+			t.Fatalf("Test %d: Expected status 200, got %d: %v", i, code, err)
+		}
+		var items []FileInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+			t.Fatalf("Test %d: Failed to parse JSON: %v", i, err)
+		}
+		var names []string
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		if !reflect.DeepEqual(names, test.expectedNames) {
+			t.Errorf("Test %d: Expected items %v, got %v", i, test.expectedNames, names)
+		}
+	}
+
+	// ignored files are left out of archives too
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest("GET", "/docs/?download=zip", nil))
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if expected := []string{"docs/README.md", "docs/main.c", "docs/sub/", "docs/sub/build"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected archive entries %v, got %v", expected, names)
+	}
+
+	// templates are chosen by path and READMEs rendered safely
+	for i, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/docs/", "default:<h1>Docs</h1>\n"},
+		{"/photos/", "photos"},
+		{"/notes/", "notes:<pre>&lt;b&gt;plain&lt;/b&gt;</pre>"},
+		{"/hidden/", "default:"},
+	} {
+		rec := httptest.NewRecorder()
+		if code, err := b.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil)); code != http.StatusOK {
+			t.Fatalf("Test %d: Expected status 200, got %d: %v", i, code, err)
+		}
+		if got := rec.Body.String(); got != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestBrowseThumbnail(t *testing.T) {
+	root, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	for name, content := range map[string][]byte{
+		"wide.png":   buf.Bytes(),
+		"broken.jpg": []byte("not an image"),
+		"notes.txt":  []byte("text"),
+		"secret.png": buf.Bytes(),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Browse{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []Config{
+			{
+				PathScope: "/",
+				Fs:        staticfiles.FileServer{Root: http.Dir(root), Hide: []string{"/secret.png"}},
+			},
+		},
+	}
+
+	for i, test := range []struct {
+		query          string
+		expectedStatus int
+	}{
+		{"?thumbnail=notes.txt", http.StatusBadRequest},
+		{"?thumbnail=../wide.png", http.StatusBadRequest},
+		{"?thumbnail=missing.png", http.StatusNotFound},
+		{"?thumbnail=secret.png", http.StatusNotFound},
+		{"?thumbnail=broken.jpg", http.StatusUnsupportedMediaType},
+	} {
+		code, _ := b.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/"+test.query, nil))
+		if code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest("GET", "/"+FileInfo{Name: "wide.png"}.Thumbnail(), nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("Expected PNG thumbnail, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	thumb, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode thumbnail: %v", err)
+	}
+	if size := thumb.Bounds().Size(); size.X != thumbnailSize || size.Y != thumbnailSize/2 {
+		t.Errorf("Expected thumbnail of %dx%d, got %v", thumbnailSize, thumbnailSize/2, size)
+	}
+	if r, g, b, _ := thumb.At(10, 10).RGBA(); r>>8 != 255 || g != 0 || b != 0 {
+		t.Errorf("Expected thumbnail to stay red, got %v", thumb.At(10, 10))
+	}
+
+	if _, ok := cachedThumbnail(thumbnailKey{path: "/wide.png"}, time.Time{}, 0); ok {
+		t.Error("Expected a cached thumbnail not to be used for another version of the image")
+	}
+	fi, err := os.Stat(filepath.Join(root, "wide.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cachedThumbnail(thumbnailKey{path: "/wide.png"}, fi.ModTime(), fi.Size()); !ok {
+		t.Error("Expected the thumbnail to be cached")
+	}
+
+	// a changed image gets a new thumbnail
+	tall := image.NewNRGBA(image.Rect(0, 0, 100, 400))
+	buf.Reset()
+	png.Encode(&buf, tall)
+	if err := ioutil.WriteFile(filepath.Join(root, "wide.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest("GET", "/"+FileInfo{Name: "wide.png"}.Thumbnail(), nil))
+	thumb, err = png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode thumbnail: %v", err)
+	}
+	if size := thumb.Bounds().Size(); size.X != thumbnailSize/4 || size.Y != thumbnailSize {
+		t.Errorf("Expected thumbnail of changed image of %dx%d, got %v", thumbnailSize/4, thumbnailSize, size)
+	}
+
+	if thumb := (FileInfo{Name: "notes.txt"}).Thumbnail(); thumb != "" {
+		t.Errorf("Expected no thumbnail for text file, got %q", thumb)
+	}
+}
@@ -0,0 +1,66 @@
+package browse
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// defaultIgnoreFile is the name of the file in a directory that
+// lists the entries to leave out of its listing.
+const defaultIgnoreFile = ".caddyignore"
+
+// maxIgnoreFileSize bounds how much of an ignore file is read.
+const maxIgnoreFileSize = 64 << 10
+
+// ignorePatterns returns the patterns in the ignore file of the
+// directory at urlPath, if there is one. Each line of the file is
+// a pattern as understood by path.Match that is matched against
+// the names of entries in the directory; a pattern ending in "/"
+// only matches directories. Blank lines and lines starting with
+// "#" are skipped.
+func (c *Config) ignorePatterns(urlPath string) []string {
+	if c.IgnoreFile == "" {
+		return nil
+	}
+	f, err := c.Fs.Root.Open(path.Join("/", urlPath, c.IgnoreFile))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(io.LimitReader(f, maxIgnoreFileSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := path.Match(strings.TrimSuffix(line, "/"), ""); err != nil {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// isIgnored returns whether fi is to be left out of a listing of
+// a directory with the given ignore patterns. The ignore file is
+// always left out.
+func (c *Config) isIgnored(patterns []string, fi os.FileInfo) bool {
+	if c.IgnoreFile != "" && fi.Name() == c.IgnoreFile {
+		return true
+	}
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		if dirOnly && !fi.IsDir() {
+			continue
+		}
+		if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), fi.Name()); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package browse
+
+import (
+	"html"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// readmeNames are the names of files shown at the top of a listing
+// by Readme, in order of preference.
+var readmeNames = []string{"README.md", "README.markdown", "README.txt", "README"}
+
+// maxReadmeSize bounds how much of a README is rendered.
+const maxReadmeSize = 1 << 20
+
+// Readme returns the README of the listed directory rendered as
+// HTML, or "" if it has none. Markdown is rendered without any raw
+// HTML it contains, since the README may have been uploaded by
+// anyone; other READMEs are shown as preformatted text.
+func (l Listing) Readme() string {
+	if l.Root == nil {
+		return ""
+	}
+	for _, name := range readmeNames {
+		if !l.hasItem(name) {
+			continue
+		}
+		f, err := l.Root.Open(path.Join("/", l.Path, name))
+		if err != nil {
+			continue
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(f, maxReadmeSize))
+		f.Close()
+		if err != nil {
+			continue
+		}
+		if ext := strings.ToLower(path.Ext(name)); ext == ".md" || ext == ".markdown" {
+			renderer := blackfriday.HtmlRenderer(blackfriday.HTML_SKIP_HTML|blackfriday.HTML_SAFELINK, "", "")
+			extns := blackfriday.EXTENSION_TABLES | blackfriday.EXTENSION_FENCED_CODE |
+				blackfriday.EXTENSION_STRIKETHROUGH | blackfriday.EXTENSION_AUTOLINK
+			return string(blackfriday.Markdown(body, renderer, extns))
+		}
+		return "<pre>" + html.EscapeString(string(body)) + "</pre>"
+	}
+	return ""
+}
+
+// hasItem returns whether the listing has a file named name, so
+// that hidden and ignored files are never rendered. It looks at
+// every item, not just the page of them in Items.
+func (l Listing) hasItem(name string) bool {
+	for _, item := range l.allItems {
+		if item.Name == name && !item.IsDir {
+			return true
+		}
+	}
+	return false
+}
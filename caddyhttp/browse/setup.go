@@ -3,9 +3,12 @@ package browse
 import (
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"text/template"
 
+	"github.com/dustin/go-humanize"
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 	"github.com/mholt/caddy/caddyhttp/staticfiles"
@@ -25,6 +28,13 @@ func setup(c *caddy.Controller) error {
 		return err
 	}
 
+	for _, bc := range configs {
+		if bc.Writable {
+			// files are uploaded once listening, also in a sandbox
+			caddy.RegisterWritableDir(bc.Root)
+		}
+	}
+
 	b := Browse{
 		Configs:       configs,
 		IgnoreIndexes: false,
@@ -56,22 +66,28 @@ func browseParse(c *caddy.Controller) ([]Config, error) {
 	for c.Next() {
 		var bc Config
 
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return configs, c.ArgErr()
+		}
+
 		// First argument is directory to allow browsing; default is site root
-		if c.NextArg() {
-			bc.PathScope = c.Val()
+		if len(args) > 0 {
+			bc.PathScope = args[0]
 		} else {
 			bc.PathScope = "/"
 		}
 
 		bc.Fs = staticfiles.FileServer{
-			Root: http.Dir(cfg.Root),
-			Hide: cfg.HiddenFiles,
+			Root:      cfg.FileSystem(),
+			Hide:      cfg.HiddenFiles,
+			Languages: cfg.Languages,
 		}
 
 		// Second argument would be the template file to use
 		var tplText string
-		if c.NextArg() {
-			tplBytes, err := ioutil.ReadFile(c.Val())
+		if len(args) > 1 {
+			tplBytes, err := ioutil.ReadFile(args[1])
 			if err != nil {
 				return configs, err
 			}
@@ -87,6 +103,128 @@ func browseParse(c *caddy.Controller) ([]Config, error) {
 		}
 		bc.Template = tpl
 
+		bc.Root = cfg.Root
+		bc.IgnoreFile = defaultIgnoreFile
+		bc.MaxUpload = defaultMaxUpload
+		bc.ArchiveMaxFiles = defaultArchiveMaxFiles
+		bc.ArchiveMaxSize = defaultArchiveMaxSize
+		for c.NextBlock() {
+			switch c.Val() {
+			case "write":
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				if cfg.RootFS != nil {
+					return configs, c.Err("write needs a site root on disk")
+				}
+				bc.Writable = true
+			case "allow", "deny":
+				allow := c.Val() == "allow"
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return configs, c.ArgErr()
+				}
+				methods, err := expandMethods(args[1:])
+				if err != nil {
+					return configs, c.Err(err.Error())
+				}
+				bc.Rules = append(bc.Rules, AccessRule{User: args[0], Allow: allow, Methods: methods})
+			case "max_upload":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				size, err := parseSize(c.Val())
+				if err != nil {
+					return configs, c.Err(err.Error())
+				}
+				bc.MaxUpload = size
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			case "template":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return configs, c.ArgErr()
+				}
+				tplBytes, err := ioutil.ReadFile(args[1])
+				if err != nil {
+					return configs, err
+				}
+				tpl, err := template.New("listing").Parse(string(tplBytes))
+				if err != nil {
+					return configs, err
+				}
+				bc.PathTemplates = append(bc.PathTemplates, PathTemplate{Path: args[0], Template: tpl})
+			case "ignore_file":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				bc.IgnoreFile = c.Val()
+				if bc.IgnoreFile == "off" {
+					bc.IgnoreFile = ""
+				}
+				if strings.ContainsAny(bc.IgnoreFile, `/\`) {
+					return configs, c.Errf("ignore file must be a name, not a path: '%s'", bc.IgnoreFile)
+				}
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			case "archive":
+				formats := c.RemainingArgs()
+				if len(formats) == 0 {
+					formats = []string{archiveZip, archiveTarGz}
+				}
+				for _, format := range formats {
+					if format != archiveZip && format != archiveTarGz {
+						return configs, c.Errf("unknown archive format '%s'", format)
+					}
+				}
+				bc.ArchiveFormats = formats
+			case "archive_max_files":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 0 {
+					return configs, c.Errf("invalid number of files '%s'", c.Val())
+				}
+				bc.ArchiveMaxFiles = n
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			case "archive_max_size":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				size, err := parseSize(c.Val())
+				if err != nil {
+					return configs, c.Err(err.Error())
+				}
+				bc.ArchiveMaxSize = size
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			case "archive_exclude":
+				patterns := c.RemainingArgs()
+				if len(patterns) == 0 {
+					return configs, c.ArgErr()
+				}
+				for _, pattern := range patterns {
+					if _, err := path.Match(pattern, ""); err != nil {
+						return configs, c.Errf("invalid pattern '%s': %v", pattern, err)
+					}
+				}
+				bc.ArchiveExclude = append(bc.ArchiveExclude, patterns...)
+			case "checksums":
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				bc.Checksums = true
+			default:
+				return configs, c.Errf("Unknown browse property '%s'", c.Val())
+			}
+		}
+
 		// Save configuration
 		err = appendCfg(bc)
 		if err != nil {
@@ -97,6 +235,39 @@ func browseParse(c *caddy.Controller) ([]Config, error) {
 	return configs, nil
 }
 
+// parseSize parses a size such as 10MB; 0 means no limit.
+func parseSize(s string) (int64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	size, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(size), nil
+}
+
+// expandMethods normalizes a list of write methods, expanding
+// "upload" to POST and "mkdir" to MKCOL.
+func expandMethods(list []string) ([]string, error) {
+	var methods []string
+	for _, m := range list {
+		switch m = strings.ToUpper(m); m {
+		case "UPLOAD":
+			m = "POST"
+		case "MKDIR":
+			m = "MKCOL"
+		case "*":
+		default:
+			if !isWriteMethod(m) {
+				return nil, fmt.Errorf("unknown write method '%s'", m)
+			}
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
+
 // The default template to use when serving up directory listings
 const defaultTemplate = `<!DOCTYPE html>
 <html>
@@ -182,6 +353,10 @@ main {
 	margin-right: 1em;
 }
 
+form.meta-item {
+	display: inline;
+}
+
 #filter {
 	padding: 4px;
 	border: 1px solid #CCC;
@@ -275,6 +450,17 @@ td .goup {
 	left: 0;
 }
 
+.readme {
+	padding: 20px 5%;
+	border-bottom: 1px solid #9C9C9C;
+	font-size: 14px;
+	line-height: 1.5;
+}
+
+.readme pre {
+	white-space: pre-wrap;
+}
+
 footer {
 	padding: 40px 20px;
 	font-size: 12px;
@@ -369,8 +555,18 @@ footer {
 					<span class="meta-item">(of which only <b>{{.ItemsLimitedTo}}</b> are displayed)</span>
 					{{- end}}
 					<span class="meta-item"><input type="text" placeholder="filter" id="filter" onkeyup='filter()'></span>
+					{{- range .ArchiveFormats}}
+					<a class="meta-item" href="?download={{.}}">Download .{{.}}</a>
+					{{- end}}
+					{{- if .CanWrite}}
+					<form class="meta-item" method="post" enctype="multipart/form-data"><input type="file" name="file" multiple> <input type="submit" value="Upload"></form>
+					<form class="meta-item" method="post" enctype="multipart/form-data"><input type="text" name="mkdir" placeholder="new folder"> <input type="submit" value="Create"></form>
+					{{- end}}
 				</div>
 			</div>
+			{{- with .Readme}}
+			<div class="readme">{{.}}</div>
+			{{- end}}
 			<div class="listing">
 				<table aria-describedby="summary">
 					<thead>
@@ -2,8 +2,10 @@ package browse
 
 import (
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -79,3 +81,253 @@ func TestSetup(t *testing.T) {
 		t.Errorf("Test for non-existent browse path received an error, but shouldn't have: %v", err)
 	}
 }
+
+func TestSetupRegistersWritableRoot(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "caddy-browse-write-test")
+	c := caddy.NewTestController("http", "browse /files {\n\twrite\n}")
+	httpserver.GetConfig(c).Root = root
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	if !caddy.Writable(filepath.Join(root, "files", "upload.txt")) {
+		t.Errorf("Expected the root %s to be writable once privileges are dropped", root)
+	}
+}
+
+func TestBrowseParseWrite(t *testing.T) {
+	for i, test := range []struct {
+		input             string
+		shouldErr         bool
+		expectedWritable  bool
+		expectedRules     []AccessRule
+		expectedMaxUpload int64
+	}{
+		{`browse`, false, false, nil, defaultMaxUpload},
+		{`browse /files {
+			write
+		}`, false, true, nil, defaultMaxUpload},
+		{`browse /files {
+			write
+			allow admin *
+			deny * delete mkdir
+			max_upload 1MiB
+		}`, false, true, []AccessRule{
+			{User: "admin", Allow: true, Methods: []string{"*"}},
+			{User: "*", Allow: false, Methods: []string{"DELETE", "MKCOL"}},
+		}, 1 << 20},
+		{`browse {
+			write
+			max_upload 0
+		}`, false, true, nil, 0},
+		{`browse {
+			write
+			deny * upload
+		}`, false, true, []AccessRule{{User: "*", Allow: false, Methods: []string{"POST"}}}, defaultMaxUpload},
+		{`browse {
+			write now
+		}`, true, false, nil, 0},
+		{`browse {
+			allow admin
+		}`, true, false, nil, 0},
+		{`browse {
+			allow admin GET
+		}`, true, false, nil, 0},
+		{`browse {
+			max_upload lots
+		}`, true, false, nil, 0},
+		{`browse {
+			upload
+		}`, true, false, nil, 0},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		configs, err := browseParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		bc := configs[0]
+		if bc.Writable != test.expectedWritable {
+			t.Errorf("Test %d: Expected Writable %v, got %v", i, test.expectedWritable, bc.Writable)
+		}
+		if !reflect.DeepEqual(bc.Rules, test.expectedRules) {
+			t.Errorf("Test %d: Expected rules %v, got %v", i, test.expectedRules, bc.Rules)
+		}
+		if bc.MaxUpload != test.expectedMaxUpload {
+			t.Errorf("Test %d: Expected MaxUpload %d, got %d", i, test.expectedMaxUpload, bc.MaxUpload)
+		}
+	}
+}
+
+func TestBrowseParseArchive(t *testing.T) {
+	for i, test := range []struct {
+		input            string
+		shouldErr        bool
+		expectedFormats  []string
+		expectedMaxFiles int
+		expectedMaxSize  int64
+		expectedExclude  []string
+	}{
+		{`browse`, false, nil, defaultArchiveMaxFiles, defaultArchiveMaxSize, nil},
+		{`browse {
+			archive
+		}`, false, []string{"zip", "tar.gz"}, defaultArchiveMaxFiles, defaultArchiveMaxSize, nil},
+		{`browse {
+			archive tar.gz
+			archive_max_files 100
+			archive_max_size 10MiB
+			archive_exclude .git *.tmp
+			archive_exclude node_modules
+		}`, false, []string{"tar.gz"}, 100, 10 << 20, []string{".git", "*.tmp", "node_modules"}},
+		{`browse {
+			archive
+			archive_max_files 0
+			archive_max_size 0
+		}`, false, []string{"zip", "tar.gz"}, 0, 0, nil},
+		{`browse {
+			archive rar
+		}`, true, nil, 0, 0, nil},
+		{`browse {
+			archive_max_files -1
+		}`, true, nil, 0, 0, nil},
+		{`browse {
+			archive_max_size
+		}`, true, nil, 0, 0, nil},
+		{`browse {
+			archive_exclude [
+		}`, true, nil, 0, 0, nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		configs, err := browseParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		bc := configs[0]
+		if !reflect.DeepEqual(bc.ArchiveFormats, test.expectedFormats) {
+			t.Errorf("Test %d: Expected formats %v, got %v", i, test.expectedFormats, bc.ArchiveFormats)
+		}
+		if bc.ArchiveMaxFiles != test.expectedMaxFiles {
+			t.Errorf("Test %d: Expected ArchiveMaxFiles %d, got %d", i, test.expectedMaxFiles, bc.ArchiveMaxFiles)
+		}
+		if bc.ArchiveMaxSize != test.expectedMaxSize {
+			t.Errorf("Test %d: Expected ArchiveMaxSize %d, got %d", i, test.expectedMaxSize, bc.ArchiveMaxSize)
+		}
+		if !reflect.DeepEqual(bc.ArchiveExclude, test.expectedExclude) {
+			t.Errorf("Test %d: Expected exclusions %v, got %v", i, test.expectedExclude, bc.ArchiveExclude)
+		}
+	}
+}
+
+func TestBrowseParseChecksums(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  bool
+	}{
+		{`browse`, false, false},
+		{`browse {
+			checksums
+		}`, false, true},
+		{`browse {
+			checksums sha256
+		}`, true, false},
+	} {
+		configs, err := browseParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		if configs[0].Checksums != test.expected {
+			t.Errorf("Test %d: Expected Checksums %v, got %v", i, test.expected, configs[0].Checksums)
+		}
+	}
+}
+
+func TestBrowseParseTemplatesAndIgnoreFile(t *testing.T) {
+	tpl, err := ioutil.TempFile("", "browse_template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.WriteString("{{.Name}}")
+	tpl.Close()
+	defer os.Remove(tpl.Name())
+
+	for i, test := range []struct {
+		input              string
+		shouldErr          bool
+		expectedPaths      []string
+		expectedIgnoreFile string
+	}{
+		{`browse`, false, nil, defaultIgnoreFile},
+		{`browse / {
+			template /photos ` + tpl.Name() + `
+			template /docs ` + tpl.Name() + `
+			ignore_file .hidden
+		}`, false, []string{"/photos", "/docs"}, ".hidden"},
+		{`browse {
+			ignore_file off
+		}`, false, nil, ""},
+		{`browse {
+			ignore_file dir/.hidden
+		}`, true, nil, ""},
+		{`browse {
+			template /photos
+		}`, true, nil, ""},
+		{`browse {
+			template /photos /does/not/exist
+		}`, true, nil, ""},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		configs, err := browseParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		bc := configs[0]
+		var paths []string
+		for _, pt := range bc.PathTemplates {
+			paths = append(paths, pt.Path)
+			if pt.Template == nil {
+				t.Errorf("Test %d: Expected template for %s", i, pt.Path)
+			}
+		}
+		if !reflect.DeepEqual(paths, test.expectedPaths) {
+			t.Errorf("Test %d: Expected template paths %v, got %v", i, test.expectedPaths, paths)
+		}
+		if bc.IgnoreFile != test.expectedIgnoreFile {
+			t.Errorf("Test %d: Expected ignore file %q, got %q", i, test.expectedIgnoreFile, bc.IgnoreFile)
+		}
+	}
+}
+
+func TestSetupWriteArchiveRoot(t *testing.T) {
+	c := caddy.NewTestController("http", "browse /files {\n\twrite\n}")
+	httpserver.GetConfig(c).RootFS = http.Dir(".")
+	if err := setup(c); err == nil {
+		t.Error("Expected an error for write when the root is not on disk")
+	}
+}
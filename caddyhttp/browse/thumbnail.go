@@ -0,0 +1,184 @@
+package browse
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/images"
+
+	// registered for image.Decode
+	_ "image/gif"
+)
+
+// Thumbnails fit in a square of this many pixels.
+const thumbnailSize = 160
+
+// maxThumbnailPixels bounds the size of images that thumbnails
+// are made of, since an image is decoded whole into memory.
+const maxThumbnailPixels = 40 << 20
+
+// maxThumbnails and maxThumbnailsSize bound how many thumbnails
+// are cached at once, and their size. When the cache is full,
+// thumbnails are evicted to make room, as any can be made again.
+const (
+	maxThumbnails     = 10000
+	maxThumbnailsSize = 32 << 20
+)
+
+// imageExts are the extensions of files that thumbnails can be
+// made of.
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// IsImage returns whether fi is an image that a thumbnail can be
+// made of.
+func (fi FileInfo) IsImage() bool {
+	return !fi.IsDir && imageExts[strings.ToLower(path.Ext(fi.Name))]
+}
+
+// Thumbnail returns the URL of a thumbnail of fi, relative to the
+// listing, or "" if fi is not an image.
+func (fi FileInfo) Thumbnail() string {
+	if !fi.IsImage() {
+		return ""
+	}
+	return "?thumbnail=" + url.QueryEscape(fi.Name)
+}
+
+// ServeThumbnail serves a thumbnail of the image named name in
+// the directory at the URL path of r.
+func (b Browse) ServeThumbnail(w http.ResponseWriter, r *http.Request, bc *Config, name string) (int, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || !(FileInfo{Name: name}).IsImage() {
+		return http.StatusBadRequest, nil
+	}
+	urlPath := path.Join("/", r.URL.Path, name)
+	if bc.isHidden(urlPath) {
+		return http.StatusNotFound, nil
+	}
+
+	f, err := bc.Fs.Root.Open(urlPath)
+	if err != nil {
+		return statusForError(err), nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if bc.Fs.IsHidden(fi) || bc.isIgnored(bc.ignorePatterns(r.URL.Path), fi) {
+		return http.StatusNotFound, nil
+	}
+
+	key := thumbnailKey{root: bc.Root, path: urlPath}
+	thumb, ok := cachedThumbnail(key, fi.ModTime(), fi.Size())
+	if !ok {
+		cfg, format, err := image.DecodeConfig(f)
+		if err != nil {
+			return http.StatusUnsupportedMediaType, nil
+		}
+		if cfg.Width*cfg.Height > maxThumbnailPixels {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return http.StatusUnsupportedMediaType, nil
+		}
+		thumb, err = makeThumbnail(img, format)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		thumb.modTime, thumb.size = fi.ModTime(), fi.Size()
+		cacheThumbnail(key, thumb)
+	}
+
+	w.Header().Set("Content-Type", thumb.contentType)
+	http.ServeContent(w, r, "", thumb.modTime, bytes.NewReader(thumb.data))
+	return 0, nil
+}
+
+// makeThumbnail returns a thumbnail of img, which was decoded
+// from format, scaled down to fit in a square of thumbnailSize
+// pixels unless it already does.
+func makeThumbnail(img image.Image, format string) (thumbnail, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() > thumbnailSize || bounds.Dy() > thumbnailSize {
+		img = images.Transform(img, thumbnailSize, thumbnailSize, images.FitContain)
+	}
+
+	// JPEGs stay JPEGs; anything else may be transparent
+	var buf bytes.Buffer
+	var thumb thumbnail
+	var err error
+	if format == "jpeg" {
+		thumb.contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80})
+	} else {
+		thumb.contentType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	thumb.data = buf.Bytes()
+	return thumb, err
+}
+
+// thumbnailKey identifies the image a thumbnail is of.
+type thumbnailKey struct {
+	root string // the site root
+	path string // the URL path of the image
+}
+
+// thumbnail is a thumbnail of an image, as encoded.
+type thumbnail struct {
+	data        []byte
+	contentType string
+	modTime     time.Time // of the image
+	size        int64     // of the image
+}
+
+// thumbnailCache holds the thumbnails made, shared by all sites.
+var thumbnailCache = struct {
+	sync.Mutex
+	entries map[thumbnailKey]thumbnail
+	size    int // of the data of the entries
+}{entries: make(map[thumbnailKey]thumbnail)}
+
+// cachedThumbnail returns the thumbnail cached for key, if it is
+// of the image as it is, with modTime and size.
+func cachedThumbnail(key thumbnailKey, modTime time.Time, size int64) (thumbnail, bool) {
+	thumbnailCache.Lock()
+	defer thumbnailCache.Unlock()
+	thumb, ok := thumbnailCache.entries[key]
+	return thumb, ok && thumb.modTime.Equal(modTime) && thumb.size == size
+}
+
+// cacheThumbnail caches thumb for key, evicting other thumbnails
+// if the cache is full.
+func cacheThumbnail(key thumbnailKey, thumb thumbnail) {
+	if len(thumb.data) > maxThumbnailsSize {
+		return
+	}
+	thumbnailCache.Lock()
+	defer thumbnailCache.Unlock()
+	if old, ok := thumbnailCache.entries[key]; ok {
+		delete(thumbnailCache.entries, key)
+		thumbnailCache.size -= len(old.data)
+	}
+	for k, old := range thumbnailCache.entries {
+		if len(thumbnailCache.entries) < maxThumbnails && thumbnailCache.size+len(thumb.data) <= maxThumbnailsSize {
+			break
+		}
+		delete(thumbnailCache.entries, k)
+		thumbnailCache.size -= len(old.data)
+	}
+	thumbnailCache.entries[key] = thumb
+	thumbnailCache.size += len(thumb.data)
+}
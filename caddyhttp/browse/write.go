@@ -0,0 +1,318 @@
+package browse
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// AccessRule allows or denies a user a set of write methods.
+type AccessRule struct {
+	// User is the authenticated user (as set by basicauth)
+	// the rule applies to, or "*" for anyone.
+	User string
+
+	// Allow is false if the rule denies access.
+	Allow bool
+
+	// Methods are the HTTP methods the rule applies to.
+	Methods []string
+}
+
+// writeMethods are the methods that modify files: POST uploads
+// files to a directory, DELETE removes a file or directory and
+// MKCOL creates a directory.
+var writeMethods = []string{http.MethodPost, http.MethodDelete, "MKCOL"}
+
+// defaultMaxUpload is the default limit on the size of an upload.
+const defaultMaxUpload = 32 << 20
+
+// Allowed reports whether user may use method according to
+// the rules; the first rule that applies decides, and if no
+// rule applies the method is only allowed to authenticated
+// users, so that anonymous clients need a rule for user "*".
+func (c *Config) Allowed(user, method string) bool {
+	for _, rule := range c.Rules {
+		if rule.User != "*" && rule.User != user {
+			continue
+		}
+		for _, m := range rule.Methods {
+			if m == "*" || m == method {
+				return rule.Allow
+			}
+		}
+	}
+	return user != ""
+}
+
+// isWriteMethod returns whether method modifies files.
+func isWriteMethod(method string) bool {
+	for _, m := range writeMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// file returns the path on disk of urlPath, which is within
+// the site root; uploads never go to fallback roots.
+func (c *Config) file(urlPath string) string {
+	return filepath.Join(c.Root, filepath.FromSlash(path.Clean("/"+urlPath)))
+}
+
+// errSymlink is returned for a path that goes through a symlink,
+// which writes don't follow out of the site root.
+var errSymlink = errors.New("path goes through a symlink")
+
+// checkSymlinks returns errSymlink if urlPath, or any directory
+// it is in below the site root, is a symlink. Those that don't
+// exist yet are not checked, nor are any below them.
+func (c *Config) checkSymlinks(urlPath string) error {
+	fpath := c.Root
+	for _, elem := range strings.Split(strings.Trim(path.Clean("/"+urlPath), "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		fpath = filepath.Join(fpath, elem)
+		fi, err := os.Lstat(fpath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errSymlink
+		}
+	}
+	return nil
+}
+
+// sameOrigin returns whether r, if it was sent by a browser,
+// comes from a page of the site itself, so that other sites
+// can't make their visitors' browsers write files. Requests
+// with neither Origin nor Referer are not from browsers.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// isHidden returns whether urlPath is, or is within, one of
+// the files hidden from the site.
+func (c *Config) isHidden(urlPath string) bool {
+	if hfs, ok := c.Fs.Root.(httpserver.HiddenFS); ok && hfs.IsHidden(urlPath) {
+		return true
+	}
+	name := path.Clean("/" + urlPath)
+	for _, hidden := range c.Fs.Hide {
+		hidden = path.Clean("/" + hidden)
+		if name == hidden || strings.HasPrefix(name, hidden+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeWrite handles a request that modifies the files in the
+// scope of bc, which must be writable.
+func (b Browse) ServeWrite(w http.ResponseWriter, r *http.Request, bc *Config) (int, error) {
+	user, _ := r.Context().Value(httpserver.RemoteUserCtxKey).(string)
+	if !bc.Allowed(user, r.Method) || !sameOrigin(r) {
+		return http.StatusForbidden, nil
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	if bc.isHidden(name) {
+		return http.StatusNotFound, nil
+	}
+	if err := bc.checkSymlinks(name); err == errSymlink {
+		return http.StatusForbidden, nil
+	} else if err != nil {
+		return statusForError(err), err
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		return b.upload(w, r, bc, name)
+	case http.MethodDelete:
+		// the scope itself may not be deleted
+		if name == path.Clean("/"+bc.PathScope) {
+			return http.StatusForbidden, nil
+		}
+		return b.delete(w, bc, name)
+	case "MKCOL":
+		return b.mkdir(w, bc, name)
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+// upload saves the files of the multipart form in the body of r
+// to the directory name. Files are sent in parts named "file";
+// a field named "mkdir" creates a subdirectory instead.
+func (b Browse) upload(w http.ResponseWriter, r *http.Request, bc *Config, name string) (int, error) {
+	dir := bc.file(name)
+	if fi, err := os.Stat(dir); err != nil {
+		return statusForError(err), nil
+	} else if !fi.IsDir() {
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	if bc.MaxUpload > 0 {
+		if r.ContentLength > bc.MaxUpload {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bc.MaxUpload)
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return uploadErrorStatus(err), nil
+		}
+		code, err := b.savePart(part, bc, name)
+		part.Close()
+		if code != 0 {
+			return code, err
+		}
+	}
+
+	// browsers posting the upload form expect to return to the listing
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		u := *r.URL
+		u.RawQuery = ""
+		http.Redirect(w, r, u.String(), http.StatusSeeOther)
+		return 0, nil
+	}
+	w.WriteHeader(http.StatusCreated)
+	return 0, nil
+}
+
+// savePart saves one part of an upload to the directory name.
+func (b Browse) savePart(part *multipart.Part, bc *Config, name string) (int, error) {
+	var base string
+	switch part.FormName() {
+	case "file":
+		base = part.FileName()
+	case "mkdir":
+		value, err := ioutil.ReadAll(io.LimitReader(part, 256))
+		if err != nil {
+			return uploadErrorStatus(err), nil
+		}
+		base = string(value)
+	default:
+		return 0, nil
+	}
+	if base == "" || base == "." || base == ".." || strings.ContainsAny(base, `/\`) {
+		return http.StatusBadRequest, nil
+	}
+	target := path.Join(name, base)
+	if bc.isHidden(target) || bc.checkSymlinks(target) != nil {
+		return http.StatusForbidden, nil
+	}
+
+	if part.FormName() == "mkdir" {
+		if err := os.Mkdir(bc.file(target), 0777); err != nil && !os.IsExist(err) {
+			return statusForError(err), err
+		}
+		return 0, nil
+	}
+
+	// write to a temporary file first, so that a failed upload
+	// doesn't leave a truncated file behind
+	tmp, err := ioutil.TempFile(bc.file(name), ".upload-*")
+	if err != nil {
+		return statusForError(err), err
+	}
+	_, copyErr := io.Copy(tmp, part)
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		os.Remove(tmp.Name())
+		return uploadErrorStatus(copyErr), nil
+	}
+	if closeErr != nil {
+		os.Remove(tmp.Name())
+		return http.StatusInternalServerError, closeErr
+	}
+	if fi, err := os.Stat(bc.file(target)); err == nil && fi.IsDir() {
+		os.Remove(tmp.Name())
+		return http.StatusConflict, nil
+	}
+	if err := os.Rename(tmp.Name(), bc.file(target)); err != nil {
+		os.Remove(tmp.Name())
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+func (b Browse) delete(w http.ResponseWriter, bc *Config, name string) (int, error) {
+	fpath := bc.file(name)
+	if _, err := os.Lstat(fpath); err != nil {
+		return statusForError(err), nil
+	}
+	if err := os.RemoveAll(fpath); err != nil {
+		return statusForError(err), err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+}
+
+func (b Browse) mkdir(w http.ResponseWriter, bc *Config, name string) (int, error) {
+	fpath := bc.file(name)
+	if _, err := os.Lstat(fpath); err == nil {
+		return http.StatusMethodNotAllowed, nil
+	}
+	if err := os.Mkdir(fpath, 0777); err != nil {
+		if os.IsNotExist(err) {
+			return http.StatusConflict, nil
+		}
+		return statusForError(err), err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return 0, nil
+}
+
+// uploadErrorStatus maps an error reading an upload to a status code.
+func uploadErrorStatus(err error) int {
+	if err != nil && strings.Contains(err.Error(), "request body too large") {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// statusForError maps a file system error to a status code.
+func statusForError(err error) int {
+	switch {
+	case os.IsNotExist(err):
+		return http.StatusNotFound
+	case os.IsPermission(err):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
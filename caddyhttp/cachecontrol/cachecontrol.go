@@ -0,0 +1,167 @@
+// Package cachecontrol implements the cache_control directive, which
+// sets the Cache-Control and Expires headers of responses by path and
+// content type.
+package cachecontrol
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// CacheControl is middleware that sets caching headers on responses.
+type CacheControl struct {
+	Next  httpserver.Handler
+	Rules []Rule
+
+	// Override makes the rules replace caching headers set by the
+	// handlers, such as by proxied upstreams, which are otherwise
+	// kept.
+	Override bool
+}
+
+// Rule is the caching of the responses for requests whose paths
+// match Pattern or of the content type Type.
+type Rule struct {
+	// Pattern is a path prefix, or a glob pattern matched against
+	// the whole path if it has a slash or else against its last
+	// element, such as *.css.
+	Pattern string
+
+	// Type is a media type, or a wildcard such as image/*.
+	Type string
+
+	// MaxAge is how long responses are fresh for, unless NoStore.
+	MaxAge  time.Duration
+	NoStore bool
+
+	// Directives are the other directives of the Cache-Control
+	// header, such as immutable or must-revalidate.
+	Directives []string
+}
+
+// Matches returns whether the rule applies to the response to r with
+// the headers h.
+func (rule Rule) Matches(r *http.Request, h http.Header) bool {
+	if rule.Type != "" {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(h.Get("Content-Type"), ";")[0]))
+		return rule.Type == mediaType ||
+			strings.HasSuffix(rule.Type, "/*") && strings.HasPrefix(mediaType, rule.Type[:len(rule.Type)-1])
+	}
+	if !strings.ContainsAny(rule.Pattern, "*?[") {
+		return httpserver.Path(r.URL.Path).Matches(rule.Pattern)
+	}
+	name := r.URL.Path
+	if !strings.Contains(rule.Pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(rule.Pattern, name)
+	return ok
+}
+
+// private returns whether the rule keeps responses out of shared
+// caches.
+func (rule Rule) private() bool {
+	if rule.NoStore {
+		return true
+	}
+	for _, d := range rule.Directives {
+		if d == "private" {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply sets the caching headers in h, those of a response at now.
+func (rule Rule) Apply(h http.Header, now time.Time) {
+	if rule.NoStore {
+		h.Set("Cache-Control", "no-store")
+		h.Set("Expires", "0")
+		return
+	}
+	directives := []string{"max-age=" + strconv.FormatInt(int64(rule.MaxAge/time.Second), 10)}
+	if !rule.private() {
+		directives = append([]string{"public"}, directives...)
+	}
+	h.Set("Cache-Control", strings.Join(append(directives, rule.Directives...), ", "))
+	h.Set("Expires", now.Add(rule.MaxAge).UTC().Format(http.TimeFormat))
+}
+
+// ServeHTTP sets the caching headers of the response to r by the
+// first rule that matches it, once the response is known.
+func (cc CacheControl) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	ccw := &cacheWriter{
+		ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+		cc:                    cc,
+		r:                     r,
+	}
+	return cc.Next.ServeHTTP(ccw, r)
+}
+
+// revise sets the caching headers in h for the response to r of
+// status.
+func (cc CacheControl) revise(r *http.Request, h http.Header, status int) {
+	if !cacheable(status) || !cc.Override && h.Get("Cache-Control") != "" {
+		return
+	}
+	// responses for particular users stay out of shared caches
+	user, _ := r.Context().Value(httpserver.RemoteUserCtxKey).(string)
+	authenticated := r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" ||
+		user != "" || h.Get("Set-Cookie") != ""
+	for _, rule := range cc.Rules {
+		if rule.Matches(r, h) {
+			if !authenticated || rule.private() {
+				rule.Apply(h, time.Now())
+			}
+			return
+		}
+	}
+}
+
+// cacheable returns whether responses of status may be given caching
+// headers.
+func cacheable(status int) bool {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusPartialContent, http.StatusMovedPermanently, http.StatusNotModified,
+		http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// cacheWriter sets the caching headers of a response when it writes
+// its header.
+type cacheWriter struct {
+	*httpserver.ResponseWriterWrapper
+	cc          CacheControl
+	r           *http.Request
+	wroteHeader bool
+}
+
+func (w *cacheWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.cc.revise(w.r, w.Header(), status)
+	w.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriterWrapper.Write(b)
+}
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*cacheWriter)(nil)
@@ -0,0 +1,130 @@
+package cachecontrol
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestCacheControl(t *testing.T) {
+	cc := CacheControl{Rules: []Rule{
+		{Pattern: "*.css", MaxAge: 365 * 24 * time.Hour, Directives: []string{"immutable"}},
+		{Pattern: "/account/", MaxAge: time.Minute, Directives: []string{"private"}},
+		{Pattern: "/docs/*.html", MaxAge: time.Hour, Directives: []string{"must-revalidate"}},
+		{Type: "image/*", MaxAge: 24 * time.Hour},
+		{Type: "application/json", NoStore: true},
+	}}
+
+	for i, test := range []struct {
+		path, contentType string
+		status            int
+		auth              bool
+		setCookie         bool
+		upstream          string
+		expect            string
+		expectExpires     bool
+	}{
+		{"/css/site.css", "text/css", 200, false, false, "", "public, max-age=31536000, immutable", true},
+		{"/css/site.css", "text/css", 304, false, false, "", "public, max-age=31536000, immutable", true},
+		{"/css/site.css", "text/css", 404, false, false, "", "", false},
+		{"/docs/intro.html", "text/html", 200, false, false, "", "public, max-age=3600, must-revalidate", true},
+		{"/docs/v1/intro.html", "text/html", 200, false, false, "", "", false},
+		{"/logo", "image/png", 200, false, false, "", "public, max-age=86400", true},
+		{"/api", "application/json; charset=utf-8", 200, false, false, "", "no-store", true},
+		{"/account/me", "text/html", 200, true, false, "", "max-age=60, private", true},
+		{"/css/site.css", "text/css", 200, true, false, "", "", false},
+		{"/css/site.css", "text/css", 200, false, true, "", "", false},
+		{"/api", "application/json", 200, true, false, "", "no-store", true},
+		{"/css/site.css", "text/css", 200, false, false, "no-cache", "no-cache", false},
+		{"/index.html", "text/html", 200, false, false, "", "", false},
+	} {
+		cc.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", test.contentType)
+			if test.setCookie {
+				w.Header().Set("Set-Cookie", "session=1")
+			}
+			if test.upstream != "" {
+				w.Header().Set("Cache-Control", test.upstream)
+			}
+			w.WriteHeader(test.status)
+			return 0, nil
+		})
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.auth {
+			r.Header.Set("Authorization", "Basic x")
+		}
+		w := httptest.NewRecorder()
+		if _, err := cc.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+		if got := w.Header().Get("Cache-Control"); got != test.expect {
+			t.Errorf("Test %d: expected Cache-Control %q, got %q", i, test.expect, got)
+		}
+		if got := w.Header().Get("Expires") != ""; got != test.expectExpires {
+			t.Errorf("Test %d: expected Expires %t, got %q", i, test.expectExpires, w.Header().Get("Expires"))
+		}
+	}
+}
+
+func TestCacheControlCredentials(t *testing.T) {
+	cc := CacheControl{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write([]byte("body {}"))
+			return 0, nil
+		}),
+		Rules: []Rule{
+			{Pattern: "/account/", MaxAge: time.Minute, Directives: []string{"private"}},
+			{Pattern: "/", MaxAge: time.Hour},
+		},
+	}
+	for i, test := range []struct {
+		path   string
+		cookie string
+		user   string
+		expect string
+	}{
+		{"/site.css", "", "", "public, max-age=3600"},
+		{"/site.css", "session=1", "", ""},
+		{"/site.css", "", "alice", ""},
+		{"/account/me", "session=1", "", "max-age=60, private"},
+		{"/account/me", "", "alice", "max-age=60, private"},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.cookie != "" {
+			r.Header.Set("Cookie", test.cookie)
+		}
+		if test.user != "" {
+			r = r.WithContext(context.WithValue(r.Context(), httpserver.RemoteUserCtxKey, test.user))
+		}
+		w := httptest.NewRecorder()
+		cc.ServeHTTP(w, r)
+		if got := w.Header().Get("Cache-Control"); got != test.expect {
+			t.Errorf("Test %d: expected Cache-Control %q, got %q", i, test.expect, got)
+		}
+	}
+}
+
+func TestCacheControlOverride(t *testing.T) {
+	cc := CacheControl{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write([]byte("body {}"))
+			return 0, nil
+		}),
+		Rules:    []Rule{{Pattern: "/", MaxAge: time.Hour}},
+		Override: true,
+	}
+	w := httptest.NewRecorder()
+	cc.ServeHTTP(w, httptest.NewRequest("GET", "/site.css", nil))
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Expected the rule to override the handler, got %q", got)
+	}
+	expires, err := time.Parse(http.TimeFormat, w.Header().Get("Expires"))
+	if err != nil || expires.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("Expected Expires in an hour, got %q", w.Header().Get("Expires"))
+	}
+}
@@ -0,0 +1,152 @@
+package cachecontrol
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("cache_control", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new CacheControl middleware instance.
+func setup(c *caddy.Controller) error {
+	handler, err := cacheControlParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		handler.Next = next
+		return handler
+	})
+
+	return nil
+}
+
+// cacheControlParse parses
+//
+//	cache_control {
+//		match    pattern age [directives...]
+//		type     type    age [directives...]
+//		override
+//	}
+//
+// where the rules, the first of which that matches a response applies
+// to it, are for the paths matching the pattern, a prefix such as
+// /static/ or a glob pattern such as *.css, or for the content type,
+// which may be a wildcard such as image/*. The age is a duration,
+// which may be in days (d), weeks (w) or years (y), or no-store, and
+// the directives are immutable, private, no-cache, no-transform,
+// must-revalidate, proxy-revalidate, stale-while-revalidate=age or
+// stale-if-error=age. Caching headers set by handlers are kept unless
+// override is given.
+func cacheControlParse(c *caddy.Controller) (CacheControl, error) {
+	var handler CacheControl
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return handler, c.Err("cache_control may only be given once per site")
+		}
+		parsed = true
+		if len(c.RemainingArgs()) > 0 {
+			return handler, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "match", "type":
+				if len(args) < 2 {
+					return handler, c.ArgErr()
+				}
+				rule := Rule{}
+				if what == "match" {
+					rule.Pattern = args[0]
+				} else {
+					if !strings.Contains(args[0], "/") {
+						return handler, c.Errf("invalid content type '%s'", args[0])
+					}
+					rule.Type = strings.ToLower(args[0])
+				}
+				if args[1] == "no-store" {
+					rule.NoStore = true
+				} else {
+					age, err := parseAge(args[1])
+					if err != nil {
+						return handler, c.Errf("invalid age '%s'", args[1])
+					}
+					rule.MaxAge = age
+				}
+				for _, arg := range args[2:] {
+					directive, err := parseDirective(arg)
+					if err != nil || rule.NoStore {
+						return handler, c.Errf("invalid directive '%s'", arg)
+					}
+					rule.Directives = append(rule.Directives, directive)
+				}
+				handler.Rules = append(handler.Rules, rule)
+			case "override":
+				if len(args) != 0 {
+					return handler, c.ArgErr()
+				}
+				handler.Override = true
+			default:
+				return handler, c.Errf("Unknown cache_control property '%s'", what)
+			}
+		}
+	}
+
+	return handler, nil
+}
+
+// parseAge parses a duration such as 1h, 30d, 2w or 1y.
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour}
+	if len(s) > 1 {
+		if unit, ok := units[s[len(s)-1:]]; ok {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err != nil || n < 0 {
+				return 0, strconv.ErrSyntax
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	if s == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return d, nil
+}
+
+// parseDirective parses a Cache-Control directive, converting the age
+// of one that has one to seconds.
+func parseDirective(s string) (string, error) {
+	switch s {
+	case "immutable", "private", "no-cache", "no-transform", "must-revalidate", "proxy-revalidate":
+		return s, nil
+	}
+	if i := strings.Index(s, "="); i > 0 {
+		switch name := s[:i]; name {
+		case "stale-while-revalidate", "stale-if-error":
+			age, err := parseAge(s[i+1:])
+			if err != nil {
+				return "", err
+			}
+			return name + "=" + strconv.FormatInt(int64(age/time.Second), 10), nil
+		}
+	}
+	return "", strconv.ErrSyntax
+}
@@ -0,0 +1,83 @@
+package cachecontrol
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", "cache_control {\n match *.css 1y immutable\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(CacheControl)
+	if !ok {
+		t.Fatalf("Expected handler to be type CacheControl, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestCacheControlParse(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectRules    []Rule
+		expectOverride bool
+	}{
+		{`cache_control`, false, nil, false},
+		{`cache_control {
+			match *.css 1y immutable
+			match /static/ 2w stale-while-revalidate=1d stale-if-error=1h
+			type  image/* 1h30m must-revalidate no-transform
+			type  application/JSON no-store
+			match /api/ 0 no-cache private
+			override
+		}`, false, []Rule{
+			{Pattern: "*.css", MaxAge: 365 * 24 * time.Hour, Directives: []string{"immutable"}},
+			{Pattern: "/static/", MaxAge: 14 * 24 * time.Hour, Directives: []string{"stale-while-revalidate=86400", "stale-if-error=3600"}},
+			{Type: "image/*", MaxAge: 90 * time.Minute, Directives: []string{"must-revalidate", "no-transform"}},
+			{Type: "application/json", NoStore: true},
+			{Pattern: "/api/", Directives: []string{"no-cache", "private"}},
+		}, true},
+		{`cache_control /`, true, nil, false},
+		{"cache_control {\n match *.css\n}", true, nil, false},
+		{"cache_control {\n match *.css forever\n}", true, nil, false},
+		{"cache_control {\n match *.css -1h\n}", true, nil, false},
+		{"cache_control {\n match *.css 1y public-ish\n}", true, nil, false},
+		{"cache_control {\n match *.css 1y stale-if-error=soon\n}", true, nil, false},
+		{"cache_control {\n match *.css no-store immutable\n}", true, nil, false},
+		{"cache_control {\n type css 1y\n}", true, nil, false},
+		{"cache_control {\n override all\n}", true, nil, false},
+		{"cache_control {\n expires 1y\n}", true, nil, false},
+		{"cache_control\ncache_control", true, nil, false},
+	} {
+		handler, err := cacheControlParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(handler.Rules, test.expectRules) {
+			t.Errorf("Test %d: expected rules %+v, got %+v", i, test.expectRules, handler.Rules)
+		}
+		if handler.Override != test.expectOverride {
+			t.Errorf("Test %d: expected override %t, got %t", i, test.expectOverride, handler.Override)
+		}
+	}
+}
@@ -5,31 +5,81 @@ import (
 	_ "github.com/mholt/caddy/caddyhttp/httpserver"
 
 	// plug in the standard directives
+	_ "github.com/mholt/caddy/caddyhttp/accounting"
+	_ "github.com/mholt/caddy/caddyhttp/acmechallenge"
+	_ "github.com/mholt/caddy/caddyhttp/apikeys"
+	_ "github.com/mholt/caddy/caddyhttp/audit"
+	_ "github.com/mholt/caddy/caddyhttp/authorize"
+	_ "github.com/mholt/caddy/caddyhttp/ban"
 	_ "github.com/mholt/caddy/caddyhttp/basicauth"
 	_ "github.com/mholt/caddy/caddyhttp/bind"
+	_ "github.com/mholt/caddy/caddyhttp/bots"
 	_ "github.com/mholt/caddy/caddyhttp/browse"
+	_ "github.com/mholt/caddy/caddyhttp/cachecontrol"
+	_ "github.com/mholt/caddy/caddyhttp/canonical"
+	_ "github.com/mholt/caddy/caddyhttp/connlimit"
+	_ "github.com/mholt/caddy/caddyhttp/disposition"
 	_ "github.com/mholt/caddy/caddyhttp/errors"
+	_ "github.com/mholt/caddy/caddyhttp/esi"
+	_ "github.com/mholt/caddy/caddyhttp/exporter"
 	_ "github.com/mholt/caddy/caddyhttp/expvar"
 	_ "github.com/mholt/caddy/caddyhttp/extensions"
+	_ "github.com/mholt/caddy/caddyhttp/external"
 	_ "github.com/mholt/caddy/caddyhttp/fastcgi"
+	_ "github.com/mholt/caddy/caddyhttp/forms"
+	_ "github.com/mholt/caddy/caddyhttp/forwardauth"
 	_ "github.com/mholt/caddy/caddyhttp/gzip"
 	_ "github.com/mholt/caddy/caddyhttp/header"
+	_ "github.com/mholt/caddy/caddyhttp/health"
+	_ "github.com/mholt/caddy/caddyhttp/hide"
+	_ "github.com/mholt/caddy/caddyhttp/honeypot"
+	_ "github.com/mholt/caddy/caddyhttp/hsts"
+	_ "github.com/mholt/caddy/caddyhttp/httpsredirect"
+	_ "github.com/mholt/caddy/caddyhttp/images"
 	_ "github.com/mholt/caddy/caddyhttp/index"
+	_ "github.com/mholt/caddy/caddyhttp/inject"
 	_ "github.com/mholt/caddy/caddyhttp/internalsrv"
+	_ "github.com/mholt/caddy/caddyhttp/languages"
 	_ "github.com/mholt/caddy/caddyhttp/limits"
+	_ "github.com/mholt/caddy/caddyhttp/loadshed"
 	_ "github.com/mholt/caddy/caddyhttp/log"
+	_ "github.com/mholt/caddy/caddyhttp/maps"
 	_ "github.com/mholt/caddy/caddyhttp/markdown"
 	_ "github.com/mholt/caddy/caddyhttp/mime"
+	_ "github.com/mholt/caddy/caddyhttp/minify"
+	_ "github.com/mholt/caddy/caddyhttp/oidc"
+	_ "github.com/mholt/caddy/caddyhttp/passthrough"
 	_ "github.com/mholt/caddy/caddyhttp/pprof"
 	_ "github.com/mholt/caddy/caddyhttp/proxy"
 	_ "github.com/mholt/caddy/caddyhttp/push"
+	_ "github.com/mholt/caddy/caddyhttp/quota"
+	_ "github.com/mholt/caddy/caddyhttp/realip"
+	_ "github.com/mholt/caddy/caddyhttp/recovery"
 	_ "github.com/mholt/caddy/caddyhttp/redirect"
 	_ "github.com/mholt/caddy/caddyhttp/requestid"
+	_ "github.com/mholt/caddy/caddyhttp/requesttrace"
+	_ "github.com/mholt/caddy/caddyhttp/response"
 	_ "github.com/mholt/caddy/caddyhttp/rewrite"
 	_ "github.com/mholt/caddy/caddyhttp/root"
+	_ "github.com/mholt/caddy/caddyhttp/signedurl"
+	_ "github.com/mholt/caddy/caddyhttp/spa"
+	_ "github.com/mholt/caddy/caddyhttp/split"
+	_ "github.com/mholt/caddy/caddyhttp/sse"
+	_ "github.com/mholt/caddy/caddyhttp/ssi"
 	_ "github.com/mholt/caddy/caddyhttp/status"
 	_ "github.com/mholt/caddy/caddyhttp/templates"
+	_ "github.com/mholt/caddy/caddyhttp/throttle"
 	_ "github.com/mholt/caddy/caddyhttp/timeouts"
+	_ "github.com/mholt/caddy/caddyhttp/tracing"
+	_ "github.com/mholt/caddy/caddyhttp/transform"
+	_ "github.com/mholt/caddy/caddyhttp/tryfiles"
+	_ "github.com/mholt/caddy/caddyhttp/validaterequests"
+	_ "github.com/mholt/caddy/caddyhttp/waf"
+	_ "github.com/mholt/caddy/caddyhttp/webdav"
+	_ "github.com/mholt/caddy/caddyhttp/webhook"
 	_ "github.com/mholt/caddy/caddyhttp/websocket"
+	_ "github.com/mholt/caddy/onevent"
+	_ "github.com/mholt/caddy/privileges"
 	_ "github.com/mholt/caddy/startupshutdown"
+	_ "github.com/mholt/caddy/tenant"
 )
@@ -0,0 +1,144 @@
+// Package canonical is middleware for redirecting requests to
+// the canonical form of their URL.
+package canonical
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Trailing slash policies.
+const (
+	SlashKeep  = ""
+	SlashAdd   = "add"
+	SlashStrip = "strip"
+)
+
+// Rule describes how URLs under a base path are canonicalized.
+type Rule struct {
+	// Base path; requests to this path and sub-paths are
+	// subject to this rule.
+	Base string
+
+	// TrailingSlash is one of SlashKeep, SlashAdd or SlashStrip.
+	TrailingSlash string
+
+	// LowercasePath lowercases the request path.
+	LowercasePath bool
+
+	// LowercaseHost lowercases the Host header.
+	LowercaseHost bool
+
+	// MergeSlashes collapses consecutive slashes in the path.
+	MergeSlashes bool
+
+	// Code is the redirect status code to use.
+	Code int
+
+	// Except lists sub-paths that are left untouched.
+	Except []string
+
+	httpserver.RequestMatcher
+}
+
+// NewRule creates a new Rule with default values.
+func NewRule(basePath string) *Rule {
+	return &Rule{
+		Base:           basePath,
+		Code:           http.StatusMovedPermanently,
+		RequestMatcher: httpserver.PathMatcher(basePath),
+	}
+}
+
+// BasePath implements httpserver.HandlerConfig interface.
+func (rule *Rule) BasePath() string {
+	return rule.Base
+}
+
+// Match implements httpserver.RequestMatcher, taking the
+// excepted paths into account.
+func (rule *Rule) Match(r *http.Request) bool {
+	for _, e := range rule.Except {
+		if httpserver.Path(r.URL.Path).Matches(e) {
+			return false
+		}
+	}
+	return rule.RequestMatcher.Match(r)
+}
+
+// Canonical is middleware that redirects requests whose URL
+// differs from its canonical form.
+type Canonical struct {
+	Next  httpserver.Handler
+	Rules []httpserver.HandlerConfig
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (c Canonical) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := httpserver.ConfigSelector(c.Rules).Select(r)
+	if cfg == nil {
+		return c.Next.ServeHTTP(w, r)
+	}
+	rule := cfg.(*Rule)
+
+	host := r.Host
+	if rule.LowercaseHost {
+		host = strings.ToLower(host)
+	}
+	p := rule.canonicalPath(r.URL.Path)
+
+	if host == r.Host && p == r.URL.Path {
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	// the path is written escaped, so that an encoded "?" or "#"
+	// stays part of it, and with a single leading slash, so that
+	// the Location can't be read as a scheme-relative URL
+	to := (&url.URL{Path: "/" + strings.TrimLeft(p, "/")}).EscapedPath()
+	if host != r.Host {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		to = scheme + "://" + host + to
+	}
+	if r.URL.RawQuery != "" {
+		to += "?" + r.URL.RawQuery
+	}
+
+	w.Header().Set("Location", to)
+	w.WriteHeader(rule.Code)
+	return 0, nil
+}
+
+// canonicalPath returns the canonical form of p according to rule.
+func (rule *Rule) canonicalPath(p string) string {
+	if rule.MergeSlashes {
+		for strings.Contains(p, "//") {
+			p = strings.Replace(p, "//", "/", -1)
+		}
+	}
+	if rule.LowercasePath {
+		p = strings.ToLower(p)
+	}
+	switch rule.TrailingSlash {
+	case SlashAdd:
+		// only directory-like paths, i.e. those whose last
+		// element has no file extension, get a trailing slash
+		if !strings.HasSuffix(p, "/") && path.Ext(p) == "" {
+			p += "/"
+		}
+	case SlashStrip:
+		if p != "/" {
+			p = strings.TrimRight(p, "/")
+			if p == "" {
+				p = "/"
+			}
+		}
+	}
+	return p
+}
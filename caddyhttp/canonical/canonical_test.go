@@ -0,0 +1,114 @@
+package canonical
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestCanonical(t *testing.T) {
+	strip := NewRule("/")
+	strip.TrailingSlash = SlashStrip
+	strip.MergeSlashes = true
+	strip.LowercaseHost = true
+
+	add := NewRule("/docs")
+	add.TrailingSlash = SlashAdd
+	add.LowercasePath = true
+	add.Code = http.StatusPermanentRedirect
+	add.Except = []string{"/docs/API"}
+
+	h := Canonical{
+		Rules: []httpserver.HandlerConfig{strip, add},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+	}
+
+	tests := []struct {
+		url          string
+		expectedCode int
+		expectedLoc  string
+	}{
+		{"http://example.com/", http.StatusOK, ""},
+		{"http://example.com/foo", http.StatusOK, ""},
+		{"http://example.com/foo/", http.StatusMovedPermanently, "/foo"},
+		{"http://example.com/foo//bar", http.StatusMovedPermanently, "/foo/bar"},
+		{"http://example.com/foo/?a=b", http.StatusMovedPermanently, "/foo?a=b"},
+		{"http://Example.COM/foo", http.StatusMovedPermanently, "http://example.com/foo"},
+		{"http://example.com/docs/", http.StatusOK, ""},
+		{"http://example.com/docs/intro", http.StatusPermanentRedirect, "/docs/intro/"},
+		{"http://example.com/docs/Intro/", http.StatusPermanentRedirect, "/docs/intro/"},
+		{"http://example.com/docs/logo.png", http.StatusOK, ""},
+		{"http://example.com/docs/API/Thing", http.StatusOK, ""},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+
+		rec := httptest.NewRecorder()
+		code, err := h.ServeHTTP(rec, req)
+		if err != nil {
+			t.Fatalf("Test %d: Serving request failed with error %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code %d, got %d", i, test.expectedCode, code)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.expectedLoc {
+			t.Errorf("Test %d: Expected Location '%s', got '%s'", i, test.expectedLoc, loc)
+		}
+	}
+}
+
+func TestCanonicalLocation(t *testing.T) {
+	rule := NewRule("/")
+	rule.TrailingSlash = SlashStrip
+	rule.LowercasePath = true
+
+	h := Canonical{
+		Rules: []httpserver.HandlerConfig{rule},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+	}
+
+	tests := []struct {
+		url         string
+		expectedLoc string
+	}{
+		{"http://example.com//evil.com/", "/evil.com"},
+		{"http://example.com//Evil.com", "/evil.com"},
+		{"http://example.com///Evil.com", "/evil.com"},
+		{"http://example.com/%5CEvil.com", "/%5Cevil.com"},
+		{"http://example.com/A%3Fb", "/a%3Fb"},
+		{"http://example.com/A%23b", "/a%23b"},
+		{"http://example.com/A%20b?c=d", "/a%20b?c=d"},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		rec := httptest.NewRecorder()
+
+		code, err := h.ServeHTTP(rec, req)
+		if err != nil {
+			t.Fatalf("Test %d: Unexpected error: %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != http.StatusMovedPermanently {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusMovedPermanently, code)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.expectedLoc {
+			t.Errorf("Test %d: Expected Location '%s', got '%s'", i, test.expectedLoc, loc)
+		}
+	}
+}
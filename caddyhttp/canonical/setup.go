@@ -0,0 +1,105 @@
+package canonical
+
+import (
+	"net/http"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("canonical", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Canonical middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := canonicalParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Canonical{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func canonicalParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		basePath := "/"
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			basePath = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		for _, cfg := range rules {
+			if cfg.BasePath() == basePath {
+				return rules, c.Errf("Duplicate path: '%s'", basePath)
+			}
+		}
+
+		rule := NewRule(basePath)
+		for c.NextBlock() {
+			switch c.Val() {
+			case "trailing_slash":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				switch c.Val() {
+				case SlashAdd, SlashStrip:
+					rule.TrailingSlash = c.Val()
+				default:
+					return rules, c.Errf("Unknown trailing_slash policy '%s'", c.Val())
+				}
+			case "lowercase_path":
+				rule.LowercasePath = true
+			case "lowercase_host":
+				rule.LowercaseHost = true
+			case "merge_slashes":
+				rule.MergeSlashes = true
+			case "code":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				code, ok := redirectCodes[c.Val()]
+				if !ok {
+					return rules, c.Errf("Invalid redirect code '%s'", c.Val())
+				}
+				rule.Code = code
+			case "except":
+				except := c.RemainingArgs()
+				if len(except) == 0 {
+					return rules, c.ArgErr()
+				}
+				rule.Except = append(rule.Except, except...)
+			default:
+				return rules, c.Errf("Unknown canonical property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return rules, c.ArgErr()
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// redirectCodes is the list of supported redirect codes.
+var redirectCodes = map[string]int{
+	"301": http.StatusMovedPermanently,
+	"302": http.StatusFound,
+	"307": http.StatusTemporaryRedirect,
+	"308": http.StatusPermanentRedirect,
+}
@@ -0,0 +1,124 @@
+package canonical
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `canonical {
+		trailing_slash strip
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Canonical)
+	if !ok {
+		t.Fatalf("Expected handler to be type Canonical, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	if len(myHandler.Rules) != 1 {
+		t.Errorf("Expected handler to have %d rule, has %d instead", 1, len(myHandler.Rules))
+	}
+}
+
+func TestCanonicalParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`canonical`, false, []Rule{{Base: "/", Code: http.StatusMovedPermanently}}},
+		{`canonical /foo {
+			trailing_slash add
+			lowercase_path
+			lowercase_host
+			merge_slashes
+			code 308
+			except /foo/api /foo/raw
+		}`, false, []Rule{{
+			Base:          "/foo",
+			TrailingSlash: SlashAdd,
+			LowercasePath: true,
+			LowercaseHost: true,
+			MergeSlashes:  true,
+			Code:          http.StatusPermanentRedirect,
+			Except:        []string{"/foo/api", "/foo/raw"},
+		}}},
+		{`canonical / {
+			trailing_slash strip
+		}
+		canonical /blog {
+			trailing_slash add
+		}`, false, []Rule{
+			{Base: "/", TrailingSlash: SlashStrip, Code: http.StatusMovedPermanently},
+			{Base: "/blog", TrailingSlash: SlashAdd, Code: http.StatusMovedPermanently},
+		}},
+		{`canonical / /foo`, true, nil},
+		{`canonical {
+			trailing_slash sideways
+		}`, true, nil},
+		{`canonical {
+			trailing_slash
+		}`, true, nil},
+		{`canonical {
+			code 200
+		}`, true, nil},
+		{`canonical {
+			lowercase_path yes
+		}`, true, nil},
+		{`canonical {
+			except
+		}`, true, nil},
+		{`canonical {
+			unknown
+		}`, true, nil},
+		{"canonical /foo\ncanonical /foo", true, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		actual, err := canonicalParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d expected %d rules, but got %d", i, len(test.expected), len(actual))
+		}
+		for j, cfg := range actual {
+			rule := cfg.(*Rule)
+			expected := test.expected[j]
+			if rule.Base != expected.Base ||
+				rule.TrailingSlash != expected.TrailingSlash ||
+				rule.LowercasePath != expected.LowercasePath ||
+				rule.LowercaseHost != expected.LowercaseHost ||
+				rule.MergeSlashes != expected.MergeSlashes ||
+				rule.Code != expected.Code ||
+				len(rule.Except) != len(expected.Except) {
+				t.Errorf("Test %d, rule %d: expected %+v, got %+v", i, j, expected, *rule)
+			}
+		}
+	}
+}
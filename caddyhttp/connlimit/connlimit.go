@@ -0,0 +1,75 @@
+package connlimit
+
+import (
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("conn_limit", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupConnLimit,
+	})
+}
+
+func setupConnLimit(c *caddy.Controller) error {
+	limit, err := parseConnLimit(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).ConnLimit = limit
+	return nil
+}
+
+// parseConnLimit parses
+//
+//	conn_limit max {
+//		trust networks...
+//	}
+//
+// where max is the most connections that each client IP may have
+// open to the listener, and the networks, which may be IPs or CIDR
+// ranges, are those whose connections aren't limited, such as those
+// of proxies that many clients connect through.
+func parseConnLimit(c *caddy.Controller) (*httpserver.ConnLimit, error) {
+	var limit *httpserver.ConnLimit
+
+	for c.Next() {
+		if limit != nil {
+			return nil, c.Err("conn_limit may only be given once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return nil, c.Errf("conn_limit must be a positive number of connections, not '%s'", args[0])
+		}
+		limit = &httpserver.ConnLimit{PerIP: n}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "trust":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := httpserver.ParseNetwork(arg)
+					if err != nil {
+						return nil, c.Err(err.Error())
+					}
+					limit.Trusted = append(limit.Trusted, network)
+				}
+			default:
+				return nil, c.Errf("Unknown conn_limit property '%s'", what)
+			}
+		}
+	}
+
+	return limit, nil
+}
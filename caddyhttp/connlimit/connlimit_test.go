@@ -0,0 +1,50 @@
+package connlimit
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupConnLimit(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	lb := &net.IPNet{IP: net.ParseIP("192.0.2.1").To4(), Mask: net.CIDRMask(32, 32)}
+
+	testCases := []struct {
+		input     string
+		shouldErr bool
+		expected  *httpserver.ConnLimit
+	}{
+		{input: "conn_limit 10", expected: &httpserver.ConnLimit{PerIP: 10}},
+		{input: "conn_limit 5 {\n trust 10.0.0.0/8 192.0.2.1 \n}", expected: &httpserver.ConnLimit{PerIP: 5, Trusted: []*net.IPNet{proxies, lb}}},
+		{input: "conn_limit", shouldErr: true},
+		{input: "conn_limit 0", shouldErr: true},
+		{input: "conn_limit ten", shouldErr: true},
+		{input: "conn_limit 1 2", shouldErr: true},
+		{input: "conn_limit 5 {\n trust \n}", shouldErr: true},
+		{input: "conn_limit 5 {\n trust 10.0.0.0/33 \n}", shouldErr: true},
+		{input: "conn_limit 5 {\n trust nowhere \n}", shouldErr: true},
+		{input: "conn_limit 5 {\n foo \n}", shouldErr: true},
+		{input: "conn_limit 5\nconn_limit 6", shouldErr: true},
+	}
+	for i, tc := range testCases {
+		c := caddy.NewTestController("http", tc.input)
+		err := setupConnLimit(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but did not have one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Did not expect error, but got: %v", i, err)
+			continue
+		}
+		if got := httpserver.GetConfig(c).ConnLimit; !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Package disposition is middleware that sets the Content-Disposition
+// header of responses, so that browsers download the files in a path,
+// or of some extensions, as attachments with filenames made from
+// placeholders, or display them inline. Filenames are encoded as RFC
+// 6266 says, and either made safe or refused if they're not.
+package disposition
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Disposition is middleware that sets Content-Disposition headers.
+type Disposition struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the disposition of the responses to requests in a path.
+type Rule struct {
+	Path string
+
+	// Exts, if not empty, are the extensions of the paths of the
+	// requests the rule is for, such as .pdf.
+	Exts []string
+
+	// Inline is whether responses are displayed, rather than
+	// downloaded as attachments.
+	Inline bool
+
+	// Filename is the filename of the responses, which may have
+	// placeholders, such as {file}; if "", they have none.
+	Filename string
+
+	// Strict is whether filenames that aren't safe are refused,
+	// rather than made safe.
+	Strict bool
+}
+
+// maxFilename is the length of the longest filename, in bytes.
+const maxFilename = 255
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (d Disposition) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range d.Rules {
+		if !rule.matches(r) {
+			continue
+		}
+		filename := httpserver.NewReplacer(r, nil, "").Replace(rule.Filename)
+		if err := validFilename(filename); err != nil {
+			if rule.Strict {
+				return http.StatusInternalServerError, fmt.Errorf("disposition: filename for %s: %v", r.URL.Path, err)
+			}
+			filename = safeFilename(filename)
+		}
+		typ := "attachment"
+		if rule.Inline {
+			typ = "inline"
+		}
+		dw := &dispositionWriter{
+			ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+			value:                 Format(typ, filename),
+		}
+		return d.Next.ServeHTTP(dw, r)
+	}
+	return d.Next.ServeHTTP(w, r)
+}
+
+// matches returns whether the rule is for r.
+func (rule Rule) matches(r *http.Request) bool {
+	if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+		return false
+	}
+	if len(rule.Exts) == 0 {
+		return true
+	}
+	ext := path.Ext(r.URL.Path)
+	for _, e := range rule.Exts {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Format returns the value of a Content-Disposition header of typ,
+// attachment or inline, with filename, if not "": as a quoted string
+// if it is printable ASCII, or, if it's not, as a quoted string with
+// other characters replaced for older clients, then encoded as UTF-8
+// (RFC 6266, RFC 5987).
+func Format(typ, filename string) string {
+	if filename == "" {
+		return typ
+	}
+	var fallback strings.Builder
+	ascii := true
+	for _, c := range filename {
+		switch {
+		case c == '"' || c == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(c)
+		case c < 0x20 || c >= 0x7f:
+			fallback.WriteByte('_')
+			ascii = false
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+	v := typ + `; filename="` + fallback.String() + `"`
+	if !ascii {
+		v += "; filename*=UTF-8''" + encodeExtValue(filename)
+	}
+	return v
+}
+
+// encodeExtValue percent-encodes s as the value of an extended
+// parameter (RFC 5987).
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
+
+// validFilename returns an error if filename isn't safe to give to
+// clients: if it isn't UTF-8, is too long, has control characters or
+// path separators, or is a name of a directory.
+func validFilename(filename string) error {
+	switch {
+	case filename == "":
+		return nil
+	case filename == "." || filename == "..":
+		return fmt.Errorf("%q is a directory", filename)
+	case len(filename) > maxFilename:
+		return fmt.Errorf("longer than %d bytes", maxFilename)
+	case !utf8.ValidString(filename):
+		return fmt.Errorf("%q is not UTF-8", filename)
+	}
+	for _, c := range filename {
+		if c < 0x20 || c == 0x7f {
+			return fmt.Errorf("%q has control characters", filename)
+		}
+		if c == '/' || c == '\\' {
+			return fmt.Errorf("%q has path separators", filename)
+		}
+	}
+	return nil
+}
+
+// safeFilename returns filename with the characters that make it
+// unsafe replaced, and cut to length.
+func safeFilename(filename string) string {
+	filename = strings.ToValidUTF8(filename, "_")
+	filename = strings.Map(func(c rune) rune {
+		if c < 0x20 || c == 0x7f || c == '/' || c == '\\' {
+			return '_'
+		}
+		return c
+	}, filename)
+	for len(filename) > maxFilename {
+		_, size := utf8.DecodeLastRuneInString(filename)
+		filename = filename[:len(filename)-size]
+	}
+	if filename == "." || filename == ".." {
+		return "_"
+	}
+	return filename
+}
+
+// dispositionWriter sets the Content-Disposition header of successful
+// responses.
+type dispositionWriter struct {
+	*httpserver.ResponseWriterWrapper
+	value       string
+	wroteHeader bool
+}
+
+func (w *dispositionWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status >= 200 && status < 300 {
+			w.Header().Set("Content-Disposition", w.value)
+		}
+	}
+	w.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (w *dispositionWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriterWrapper.Write(p)
+}
@@ -0,0 +1,93 @@
+package disposition
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestFormat(t *testing.T) {
+	for i, test := range []struct {
+		typ, filename, expect string
+	}{
+		{"inline", "", "inline"},
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"attachment", `say "hi".txt`, `attachment; filename="say \"hi\".txt"`},
+		{"attachment", "naïve résumé.pdf", `attachment; filename="na_ve r_sum_.pdf"; filename*=UTF-8''na%C3%AFve%20r%C3%A9sum%C3%A9.pdf`},
+		{"attachment", "€ rates.csv", `attachment; filename="_ rates.csv"; filename*=UTF-8''%E2%82%AC%20rates.csv`},
+	} {
+		if got := Format(test.typ, test.filename); got != test.expect {
+			t.Errorf("Test %d: expected %s, got %s", i, test.expect, got)
+		}
+	}
+}
+
+func TestValidFilename(t *testing.T) {
+	for i, test := range []struct {
+		filename, safe string
+		valid          bool
+	}{
+		{"report.pdf", "report.pdf", true},
+		{"résumé.pdf", "résumé.pdf", true},
+		{"../etc/passwd", ".._etc_passwd", false},
+		{`a\b.txt`, "a_b.txt", false},
+		{"a\r\nSet-Cookie: x", "a__Set-Cookie: x", false},
+		{"..", "_", false},
+		{"bad\xffname", "bad_name", false},
+		{strings.Repeat("é", 200), strings.Repeat("é", 127), false},
+	} {
+		err := validFilename(test.filename)
+		if (err == nil) != test.valid {
+			t.Errorf("Test %d: expected valid %t, got %v", i, test.valid, err)
+		}
+		if got := safeFilename(test.filename); got != test.safe {
+			t.Errorf("Test %d: expected safe %q, got %q", i, test.safe, got)
+		} else if err := validFilename(got); err != nil {
+			t.Errorf("Test %d: expected %q to be safe, got %v", i, got, err)
+		}
+	}
+}
+
+func TestDisposition(t *testing.T) {
+	d := Disposition{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if strings.Contains(r.URL.Path, "missing") {
+				return http.StatusNotFound, nil
+			}
+			w.Write([]byte("content"))
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{
+			{Path: "/docs", Exts: []string{".pdf"}, Inline: true},
+			{Path: "/reports", Filename: "report-{?id}.csv", Strict: true},
+			{Path: "/exports", Filename: "export-{?id}.csv"},
+			{Path: "/", Filename: "{file}"},
+		},
+	}
+
+	for i, test := range []struct {
+		path         string
+		expectStatus int
+		expect       string
+	}{
+		{"/docs/guide.PDF", http.StatusOK, "inline"},
+		{"/docs/guide.zip", http.StatusOK, `attachment; filename="guide.zip"`},
+		{"/reports/q3?id=7", http.StatusOK, `attachment; filename="report-7.csv"`},
+		{"/reports/q3?id=a%2Fb", http.StatusInternalServerError, ""},
+		{"/exports/q3?id=a%2Fb", http.StatusOK, `attachment; filename="export-a_b.csv"`},
+		{"/files/na%C3%AFve.txt", http.StatusOK, `attachment; filename="na_ve.txt"; filename*=UTF-8''na%C3%AFve.txt`},
+		{"/files/missing.txt", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		status, _ := d.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if status != test.expectStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != test.expect {
+			t.Errorf("Test %d: expected %q, got %q", i, test.expect, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package disposition
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("disposition", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Disposition middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := dispositionParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Disposition{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// defaultFilename is the filename of attachments, unless another is
+// given.
+const defaultFilename = "{file}"
+
+// dispositionParse parses
+//
+//	disposition attachment|inline [path] {
+//		ext      extensions...
+//		filename name
+//		strict
+//	}
+//
+// once for each rule; the first that a request matches applies.
+// Attachments are named after the files requested, unless filename,
+// which may have placeholders, says otherwise. Unsafe filenames are
+// made safe, unless strict, when they're refused.
+func dispositionParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return nil, c.ArgErr()
+		}
+		rule := Rule{Path: "/"}
+		switch args[0] {
+		case "attachment":
+			rule.Filename = defaultFilename
+		case "inline":
+			rule.Inline = true
+		default:
+			return nil, c.Errf("Unknown disposition '%s'", args[0])
+		}
+		if len(args) == 2 {
+			rule.Path = args[1]
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "ext":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, ext := range args {
+					if !strings.HasPrefix(ext, ".") {
+						return nil, c.Errf("Extension '%s' must start with a dot", ext)
+					}
+				}
+				rule.Exts = append(rule.Exts, args...)
+			case "filename":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Filename = args[0]
+			case "strict":
+				if len(args) != 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Strict = true
+			default:
+				return nil, c.Errf("Unknown disposition property '%s'", what)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
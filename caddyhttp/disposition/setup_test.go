@@ -0,0 +1,81 @@
+package disposition
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `disposition attachment /downloads`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Disposition)
+	if !ok {
+		t.Fatalf("Expected handler to be type Disposition, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestDispositionParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`disposition attachment`, false, []Rule{{Path: "/", Filename: "{file}"}}},
+		{`disposition inline /docs {
+			ext .pdf .PNG
+		}
+		disposition attachment /reports {
+			filename "report-{when_unix}.csv"
+			strict
+		}`, false, []Rule{
+			{Path: "/docs", Exts: []string{".pdf", ".PNG"}, Inline: true},
+			{Path: "/reports", Filename: "report-{when_unix}.csv", Strict: true},
+		}},
+		{`disposition`, true, nil},
+		{`disposition download`, true, nil},
+		{`disposition inline / /docs`, true, nil},
+		{`disposition inline {
+			ext pdf
+		}`, true, nil},
+		{`disposition inline {
+			ext
+		}`, true, nil},
+		{`disposition inline {
+			filename
+		}`, true, nil},
+		{`disposition inline {
+			strict yes
+		}`, true, nil},
+		{`disposition inline {
+			type text/plain
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := dispositionParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
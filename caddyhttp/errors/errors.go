@@ -28,14 +28,37 @@ type ErrorHandler struct {
 	ErrorPages       map[int]string // map of status code to filename
 	Log              *httpserver.Logger
 	Debug            bool // if true, errors are written out to client rather than to a log
+
+	// Site is the address of the site, by which panics are counted.
+	Site string
+
+	// Templates is whether error pages are executed as templates.
+	Templates bool
+
+	// JSON is whether clients that prefer JSON to HTML get JSON
+	// error responses; JSONPage is the template of them, if any.
+	JSON     bool
+	JSONPage string
+
+	// Intercepts are the rules for replacing error responses
+	// written by other handlers with the error pages.
+	Intercepts []InterceptRule
 }
 
 func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	defer h.recovery(w, r)
 
-	status, err := h.Next.ServeHTTP(w, r)
+	var iw *interceptWriter
+	next := w
+	if len(h.Intercepts) > 0 {
+		iw = newInterceptWriter(w, func(code int) bool { return h.intercepts(r, code) })
+		next = iw
+	}
+
+	status, err := h.Next.ServeHTTP(next, r)
 
 	if err != nil {
+		setPlaceholders(r, err.Error(), nil)
 		errMsg := fmt.Sprintf("%s [ERROR %d %s] %v", time.Now().Format(timeFormat), status, r.URL.Path, err)
 		if h.Debug {
 			// Write error to response instead of to log
@@ -47,6 +70,12 @@ func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, er
 		h.Log.Println(errMsg)
 	}
 
+	if iw != nil && iw.status != 0 {
+		// the response was intercepted; replace it, with its status
+		h.errorPage(w, r, iw.status)
+		return 0, err
+	}
+
 	if status >= 400 {
 		h.errorPage(w, r, status)
 		return 0, err
@@ -55,12 +84,36 @@ func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, er
 	return status, err
 }
 
-// errorPage serves a static error page to w according to the status
-// code. If there is an error serving the error page, a plaintext error
-// message is written instead, and the extra error is logged.
+// errorPage serves an error page to w according to the status code:
+// JSON to clients that prefer it, if enabled, or else the page for
+// the code, executed as a template if enabled. If there is an error
+// serving the error page, a plaintext error message is written
+// instead, and the extra error is logged.
 func (h ErrorHandler) errorPage(w http.ResponseWriter, r *http.Request, code int) {
+	if h.JSON {
+		w.Header().Add("Vary", "Accept")
+		if wantsJSON(r) {
+			h.jsonErrorPage(w, r, code)
+			return
+		}
+	}
+
 	// See if an error page for this status code was specified
-	if pagePath, ok := h.findErrorPage(code); ok {
+	pagePath, ok := h.findErrorPage(code)
+	if ok && h.Templates {
+		body, err := h.templatePage(r, code, pagePath)
+		if err != nil {
+			h.Log.Printf("%s [NOTICE %d %s] could not execute error page: %v",
+				time.Now().Format(timeFormat), code, r.URL.String(), err)
+			httpserver.DefaultErrorFunc(w, r, code)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		w.Write(body)
+		return
+	}
+	if ok {
 		// Try to open it
 		errorPage, err := os.Open(pagePath)
 		if err != nil {
@@ -109,20 +162,14 @@ func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Obtain source of panic
-	// From: https://gist.github.com/swdunlop/9629168
-	var name, file string // function name, file name
+	// log and count it as the recover directive does; where it
+	// panicked is the first frame of its stack outside the runtime
+	p := httpserver.RecoverPanic(h.Site, r, rec)
+	var file string
 	var line int
-	var pc [16]uintptr
-	n := runtime.Callers(3, pc[:])
-	for _, pc := range pc[:n] {
-		fn := runtime.FuncForPC(pc)
-		if fn == nil {
-			continue
-		}
-		file, line = fn.FileLine(pc)
-		name = fn.Name()
-		if !strings.HasPrefix(name, "runtime.") {
+	for _, frame := range p.Stack {
+		file, line = frame.File, frame.Line
+		if !strings.HasPrefix(frame.Function, "runtime.") {
 			break
 		}
 	}
@@ -134,11 +181,13 @@ func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 		file = file[pkgPathPos+len(delim):]
 	}
 
+	var stackBuf [4096]byte
+	stack := stackBuf[:runtime.Stack(stackBuf[:], false)]
+	setPlaceholders(r, fmt.Sprintf("%s:%d - %v", file, line, rec), stack)
+
 	panicMsg := fmt.Sprintf("%s [PANIC %s] %s:%d - %v", time.Now().Format(timeFormat), r.URL.String(), file, line, rec)
 	if h.Debug {
 		// Write error and stack trace to the response rather than to a log
-		var stackBuf [4096]byte
-		stack := stackBuf[:runtime.Stack(stackBuf[:], false)]
 		httpserver.WriteTextResponse(w, http.StatusInternalServerError, fmt.Sprintf("%s\n\n%s", panicMsg, stack))
 	} else {
 		// Currently we don't use the function name, since file:line is more conventional
@@ -147,4 +196,20 @@ func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// setPlaceholders sets the placeholders of the error of r for the
+// log: {error}, the error or panic, {error_handler}, the handler it
+// came from, and {error_stack}, the stack of a panic, on one line.
+func setPlaceholders(r *http.Request, msg string, stack []byte) {
+	httpserver.SetPlaceholder(r, "error", oneLine.Replace(msg))
+	if handler := httpserver.FailedHandler(r); handler != "" {
+		httpserver.SetPlaceholder(r, "error_handler", handler)
+	}
+	if stack != nil {
+		httpserver.SetPlaceholder(r, "error_stack", oneLine.Replace(strings.TrimSpace(string(stack))))
+	}
+}
+
+// oneLine escapes line breaks, as the {request} placeholder does.
+var oneLine = strings.NewReplacer("\r", "\\r", "\n", "\\n", "\t", "\\t")
+
 const timeFormat = "02/Jan/2006:15:04:05 -0700"
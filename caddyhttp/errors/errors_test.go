@@ -2,6 +2,7 @@ package errors
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
 )
 
 func TestErrors(t *testing.T) {
@@ -150,6 +152,75 @@ func TestVisibleErrorWithPanic(t *testing.T) {
 	}
 }
 
+func TestPanicRecovered(t *testing.T) {
+	eh := ErrorHandler{
+		ErrorPages: make(map[int]string),
+		Debug:      true,
+		Site:       "errors.test:80",
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			panic("oops")
+		}),
+	}
+	rec := httptest.NewRecorder()
+	eh.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	if expect := `caddy_http_panics_total{site="errors.test:80",handler=""} 1`; !strings.Contains(buf.String(), expect) {
+		t.Errorf("Expected %s in:\n%s", expect, buf.String())
+	}
+
+	// responses aborted on purpose stay aborted
+	eh.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		panic(http.ErrAbortHandler)
+	})
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("Expected the response to be aborted, got %v", rec)
+		}
+	}()
+	eh.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestErrorPlaceholders(t *testing.T) {
+	for i, test := range []struct {
+		next        httpserver.HandlerFunc
+		expectError string
+		expectStack bool
+	}{
+		{func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}, "-", false},
+		{func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusBadGateway, errors.New("no upstream\navailable")
+		}, `no upstream\navailable`, false},
+		{func(w http.ResponseWriter, r *http.Request) (int, error) {
+			panic("oops")
+		}, "caddyhttp/errors/errors_test.go", true},
+	} {
+		eh := ErrorHandler{Next: test.next, Log: httpserver.NewTestLogger(&bytes.Buffer{})}
+		r := httpserver.WithPlaceholders(httptest.NewRequest("GET", "/", nil))
+		rec := httpserver.NewResponseRecorder(httptest.NewRecorder())
+		rec.Replacer = httpserver.NewReplacer(r, rec, "-")
+
+		// as by middleware between the log and the errors
+		eh.ServeHTTP(&httpserver.ResponseWriterWrapper{ResponseWriter: rec}, r)
+
+		if got := rec.Replacer.Replace("{error}"); !strings.HasPrefix(got, test.expectError) {
+			t.Errorf("Test %d: Expected {error} %q, got %q", i, test.expectError, got)
+		}
+		stack := rec.Replacer.Replace("{error_stack}")
+		if test.expectStack && (!strings.HasPrefix(stack, "goroutine ") || strings.Contains(stack, "\n")) {
+			t.Errorf("Test %d: Expected the stack on one line in {error_stack}, got %q", i, stack)
+		}
+		if !test.expectStack && stack != "-" {
+			t.Errorf("Test %d: Expected no {error_stack}, got %q", i, stack)
+		}
+	}
+}
+
 func TestGenericErrorPage(t *testing.T) {
 	// create temporary generic error page
 	const genericErrorContent = "This is a generic error page"
@@ -256,3 +327,154 @@ func createErrorPageFile(name string, content string) (string, error) {
 
 	return errorPageFilePath, nil
 }
+
+func TestTemplateErrorPages(t *testing.T) {
+	page, err := createErrorPageFile("template_error_test.html",
+		`<h1>{{.Status}} {{.StatusText}}</h1><p>{{.Path}} on {{.Replace "{host}"}}, request {{.RequestID}}</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(page)
+	jsonPage, err := createErrorPageFile("template_error_test.json",
+		`{"code": {{.Status}}, "path": {{json .Path}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(jsonPage)
+
+	buf := bytes.Buffer{}
+	em := ErrorHandler{
+		Next:             genErrorHandler(http.StatusNotFound, nil, ""),
+		GenericErrorPage: page,
+		Templates:        true,
+		JSON:             true,
+		Log:              httpserver.NewTestLogger(&buf),
+	}
+
+	tests := []struct {
+		accept       string
+		jsonPage     string
+		expectedType string
+		expectedBody string
+	}{
+		{"", "", "text/html; charset=utf-8",
+			`<h1>404 Not Found</h1><p>/a&lt;b&gt; on example.com, request abc</p>`},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", "text/html; charset=utf-8",
+			`<h1>404 Not Found</h1><p>/a&lt;b&gt; on example.com, request abc</p>`},
+		{"application/json", "", "application/json; charset=utf-8",
+			`{"status":404,"error":"Not Found","path":"/a\u003cb\u003e","request_id":"abc"}`},
+		{"text/html;q=0.5, application/problem+json", "", "application/json; charset=utf-8",
+			`{"status":404,"error":"Not Found","path":"/a\u003cb\u003e","request_id":"abc"}`},
+		{"application/json", jsonPage, "application/json; charset=utf-8",
+			`{"code": 404, "path": "/a\u003cb\u003e"}`},
+		{"application/json", "not_exist_file", "application/json; charset=utf-8",
+			`{"status":404,"error":"Not Found","path":"/a\u003cb\u003e","request_id":"abc"}`},
+	}
+
+	for i, test := range tests {
+		em.JSONPage = test.jsonPage
+		req := httptest.NewRequest("GET", "http://example.com/a%3Cb%3E", nil)
+		req = req.WithContext(context.WithValue(req.Context(), httpserver.RequestIDCtxKey, "abc"))
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		em.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusNotFound, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != test.expectedType {
+			t.Errorf("Test %d: Expected Content-Type %q, got %q", i, test.expectedType, ct)
+		}
+		if rec.Header().Get("Vary") != "Accept" {
+			t.Errorf("Test %d: Expected Vary: Accept", i)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, but got %q", i, test.expectedBody, body)
+		}
+	}
+}
+
+func TestInterceptErrors(t *testing.T) {
+	const content = "This is the error page"
+	page, err := createErrorPageFile("intercept_error_test.html", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(page)
+
+	buf := bytes.Buffer{}
+	em := ErrorHandler{
+		ErrorPages: map[int]string{
+			http.StatusNotFound:   page,
+			http.StatusBadGateway: page,
+			http.StatusConflict:   page,
+		},
+		Intercepts: []InterceptRule{
+			{Path: "/", Codes: []string{"404", "5xx"}},
+			{Path: "/api", Off: true},
+			{Path: "/api/html"},
+		},
+		Log: httpserver.NewTestLogger(&buf),
+	}
+
+	tests := []struct {
+		path         string
+		upstream     int
+		expectedCode int
+		expectedBody string
+	}{
+		{"/", http.StatusOK, http.StatusOK, "upstream"},
+		{"/", http.StatusNotFound, http.StatusNotFound, content},
+		{"/", http.StatusBadGateway, http.StatusBadGateway, content},
+		{"/", http.StatusConflict, http.StatusConflict, "upstream"},
+		{"/", http.StatusServiceUnavailable, http.StatusServiceUnavailable, "upstream"}, // no page
+		{"/api/x", http.StatusNotFound, http.StatusNotFound, "upstream"},
+		{"/api/html/x", http.StatusConflict, http.StatusConflict, content},
+	}
+
+	for i, test := range tests {
+		em.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			// as the proxy writes responses
+			w.Header().Set("Content-Type", "application/x-upstream")
+			w.Header().Set("Content-Length", "8")
+			w.WriteHeader(test.upstream)
+			fmt.Fprint(w, "upstream")
+			return 0, nil
+		})
+		rec := httptest.NewRecorder()
+		code, err := em.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if code != 0 || err != nil {
+			t.Errorf("Test %d: Expected the response to be written, got %d, %v", i, code, err)
+		}
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedCode, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, but got %q", i, test.expectedBody, body)
+		}
+		if test.expectedBody == content && rec.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("Test %d: Expected the header of the error page, got %v", i, rec.Header())
+		}
+	}
+}
+
+func TestMatchCode(t *testing.T) {
+	for i, test := range []struct {
+		pattern string
+		code    int
+		expect  bool
+	}{
+		{"404", 404, true},
+		{"404", 403, false},
+		{"4xx", 418, true},
+		{"5xx", 418, false},
+		{"50x", 503, true},
+		{"50x", 510, false},
+	} {
+		if got := matchCode(test.pattern, test.code); got != test.expect {
+			t.Errorf("Test %d: matchCode(%q, %d): expected %v, got %v", i, test.pattern, test.code, test.expect, got)
+		}
+	}
+}
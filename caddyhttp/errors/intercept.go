@@ -0,0 +1,160 @@
+package errors
+
+import (
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// InterceptRule intercepts error responses written by the handlers
+// of Path, such as proxy and fastcgi, so that they can be replaced
+// with the error pages. Of the rules whose path matches that of a
+// request, the one with the longest path applies.
+type InterceptRule struct {
+	Path string
+
+	// Codes are the status codes intercepted, such as 404 or 5xx;
+	// if there are none, all error status codes are.
+	Codes []string
+
+	// Off is whether error responses are not intercepted at all.
+	Off bool
+}
+
+// matchCode returns whether code matches pattern, in which x stands
+// for any digit.
+func matchCode(pattern string, code int) bool {
+	if len(pattern) != 3 || code < 100 || code > 999 {
+		return false
+	}
+	digits := [3]byte{byte('0' + code/100), byte('0' + code/10%10), byte('0' + code%10)}
+	for i := range digits {
+		if pattern[i] != 'x' && pattern[i] != digits[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// validCodePattern returns whether s is a status code or a pattern
+// of them, such as 5xx.
+func validCodePattern(s string) bool {
+	if len(s) != 3 || s[0] < '4' || s[0] > '5' {
+		return false
+	}
+	for i := 1; i < 3; i++ {
+		if s[i] != 'x' && (s[i] < '0' || s[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// intercepts returns whether an error response with code to r is
+// to be replaced by an error page. It is only if there is a page to
+// replace it with.
+func (h ErrorHandler) intercepts(r *http.Request, code int) bool {
+	if code < 400 {
+		return false
+	}
+	var rule *InterceptRule
+	for i, ir := range h.Intercepts {
+		if httpserver.Path(r.URL.Path).Matches(ir.Path) && (rule == nil || len(ir.Path) > len(rule.Path)) {
+			rule = &h.Intercepts[i]
+		}
+	}
+	if rule == nil || rule.Off {
+		return false
+	}
+	if len(rule.Codes) > 0 {
+		found := false
+		for _, pattern := range rule.Codes {
+			if matchCode(pattern, code) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if _, ok := h.findErrorPage(code); ok {
+		return true
+	}
+	return h.JSON && wantsJSON(r)
+}
+
+// interceptWriter holds back the header of responses until their
+// status is known, and discards error responses that are to be
+// intercepted.
+type interceptWriter struct {
+	*httpserver.ResponseWriterWrapper
+	header      http.Header
+	intercept   func(code int) bool
+	wroteHeader bool
+	status      int // of the response intercepted, if any
+}
+
+func newInterceptWriter(w http.ResponseWriter, intercept func(code int) bool) *interceptWriter {
+	header := make(http.Header, len(w.Header()))
+	for k, v := range w.Header() {
+		header[k] = v
+	}
+	return &interceptWriter{
+		ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+		header:                header,
+		intercept:             intercept,
+	}
+}
+
+// Header returns the header of the response, which is only that of
+// the underlying ResponseWriter once the status is written.
+func (w *interceptWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader writes the header and code, unless the response is to
+// be intercepted.
+func (w *interceptWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.intercept(code) {
+		w.status = code
+		return
+	}
+	header := w.ResponseWriterWrapper.Header()
+	for k := range header {
+		delete(header, k)
+	}
+	for k, v := range w.header {
+		header[k] = v
+	}
+	w.header = header
+	w.ResponseWriterWrapper.WriteHeader(code)
+}
+
+// Write writes b, unless the response is intercepted.
+func (w *interceptWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status != 0 {
+		return len(b), nil
+	}
+	return w.ResponseWriterWrapper.Write(b)
+}
+
+// Flush implements http.Flusher, unless the response is intercepted.
+func (w *interceptWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status == 0 {
+		w.ResponseWriterWrapper.Flush()
+	}
+}
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*interceptWriter)(nil)
@@ -0,0 +1,135 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// pageData is what templated error pages are executed with.
+type pageData struct {
+	Status     int
+	StatusText string
+	Path       string
+	RequestID  string
+
+	repl httpserver.Replacer
+}
+
+func newPageData(r *http.Request, code int) pageData {
+	reqID, _ := r.Context().Value(httpserver.RequestIDCtxKey).(string)
+	repl := httpserver.NewReplacer(r, nil, "")
+	repl.Set("status", strconv.Itoa(code))
+	return pageData{
+		Status:     code,
+		StatusText: http.StatusText(code),
+		Path:       r.URL.Path,
+		RequestID:  reqID,
+		repl:       repl,
+	}
+}
+
+// Replace replaces the placeholders in s, such as {host} or
+// {status}, with their values for the request.
+func (d pageData) Replace(s string) string {
+	return d.repl.Replace(s)
+}
+
+// jsonError is the body of JSON error responses, unless a JSON
+// error page is configured.
+type jsonError struct {
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	Path      string `json:"path"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// templateFuncs are the functions of JSON error pages.
+var templateFuncs = texttemplate.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// templatePage executes the error page at pagePath as a template.
+func (h ErrorHandler) templatePage(r *http.Request, code int, pagePath string) ([]byte, error) {
+	text, err := ioutil.ReadFile(pagePath)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := htmltemplate.New(pagePath).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, newPageData(r, code)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonErrorPage writes a JSON error response to w, either the JSON
+// error page executed as a template or a plain description of the
+// error.
+func (h ErrorHandler) jsonErrorPage(w http.ResponseWriter, r *http.Request, code int) {
+	data := newPageData(r, code)
+	var body []byte
+	var err error
+	if h.JSONPage != "" {
+		var text []byte
+		var tpl *texttemplate.Template
+		if text, err = ioutil.ReadFile(h.JSONPage); err == nil {
+			if tpl, err = texttemplate.New(h.JSONPage).Funcs(templateFuncs).Parse(string(text)); err == nil {
+				var buf bytes.Buffer
+				err = tpl.Execute(&buf, data)
+				body = buf.Bytes()
+			}
+		}
+		if err != nil {
+			h.Log.Printf("%s [NOTICE %d %s] could not load JSON error page: %v",
+				time.Now().Format(timeFormat), code, r.URL.String(), err)
+		}
+	}
+	if h.JSONPage == "" || err != nil {
+		body, _ = json.Marshal(jsonError{
+			Status:    code,
+			Error:     data.StatusText,
+			Path:      data.Path,
+			RequestID: data.RequestID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// wantsJSON returns whether the client prefers JSON to HTML,
+// according to the Accept header of r. Clients that accept
+// anything get HTML.
+func wantsJSON(r *http.Request) bool {
+	jsonQ, htmlQ := 0.0, 0.0
+	for _, a := range staticfiles.ParseAccept(r.Header["Accept"]) {
+		switch {
+		case a.Value == "application/json" || strings.HasSuffix(a.Value, "+json"):
+			if a.Q > jsonQ {
+				jsonQ = a.Q
+			}
+		case a.Value == "text/html":
+			if a.Q > htmlQ {
+				htmlQ = a.Q
+			}
+		}
+	}
+	return jsonQ > htmlQ
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -20,6 +21,9 @@ func setup(c *caddy.Controller) error {
 
 	handler.Log.Attach(c)
 
+	// for the {error_handler} placeholder
+	httpserver.GetConfig(c).TimeHandlers = true
+
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		handler.Next = next
 		return handler
@@ -39,6 +43,7 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 	}
 
 	cfg := httpserver.GetConfig(c)
+	handler.Site = cfg.Addr.String()
 
 	optionalBlock := func() error {
 		for c.NextBlock() {
@@ -52,6 +57,41 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 				if err != nil {
 					return err
 				}
+			} else if what == "templates" {
+				if len(where) != 0 {
+					return c.ArgErr()
+				}
+				handler.Templates = true
+			} else if what == "intercept" {
+				rule := InterceptRule{Path: "/"}
+				if len(where) > 0 && strings.HasPrefix(where[0], "/") {
+					rule.Path = where[0]
+					where = where[1:]
+				}
+				if len(where) == 1 && where[0] == "off" {
+					rule.Off = true
+				} else {
+					for _, code := range where {
+						code = strings.ToLower(code)
+						if !validCodePattern(code) {
+							return c.Errf("Bad intercept status code '%s'", code)
+						}
+						rule.Codes = append(rule.Codes, code)
+					}
+				}
+				handler.Intercepts = append(handler.Intercepts, rule)
+			} else if what == "json" {
+				if len(where) > 1 {
+					return c.ArgErr()
+				}
+				handler.JSON = true
+				if len(where) == 1 {
+					handler.JSONPage = where[0]
+					if !filepath.IsAbs(handler.JSONPage) {
+						handler.JSONPage = filepath.Join(cfg.Root, handler.JSONPage)
+					}
+					caddy.RegisterReadablePath(handler.JSONPage)
+				}
 			} else {
 				if len(where) != 1 {
 					return c.ArgErr()
@@ -68,6 +108,7 @@ func errorsParse(c *caddy.Controller) (*ErrorHandler, error) {
 					log.Printf("[WARNING] Unable to open error page '%s': %v", where, err)
 				}
 				f.Close()
+				caddy.RegisterReadablePath(where)
 
 				if what == "*" {
 					if handler.GenericErrorPage != "" {
@@ -35,6 +35,9 @@ func TestSetup(t *testing.T) {
 	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
 		t.Error("'Next' field of handler was not set properly")
 	}
+	if !httpserver.GetConfig(c).TimeHandlers {
+		t.Error("Expected handlers to be timed, for the failed handler")
+	}
 
 	// Test Startup function -- TODO
 	// if len(c.Startup) == 0 {
@@ -165,6 +168,50 @@ func TestErrorsParse(t *testing.T) {
 			* generic_error.html
 			* generic_error.html
 		}`, true, ErrorHandler{ErrorPages: map[int]string{}, Log: &httpserver.Logger{}}},
+		{`errors {
+			* error.html
+			templates
+			json
+		}`, false, ErrorHandler{
+			GenericErrorPage: "error.html",
+			ErrorPages:       map[int]string{},
+			Templates:        true,
+			JSON:             true,
+			Log:              &httpserver.Logger{},
+		}},
+		{`errors {
+			json error.json
+		}`, false, ErrorHandler{
+			ErrorPages: map[int]string{},
+			JSON:       true,
+			JSONPage:   "error.json",
+			Log:        &httpserver.Logger{},
+		}},
+		{`errors {
+			intercept
+			intercept /api 404 5XX
+			intercept /api/raw off
+		}`, false, ErrorHandler{
+			ErrorPages: map[int]string{},
+			Intercepts: []InterceptRule{
+				{Path: "/"},
+				{Path: "/api", Codes: []string{"404", "5xx"}},
+				{Path: "/api/raw", Off: true},
+			},
+			Log: &httpserver.Logger{},
+		}},
+		{`errors {
+			intercept 200
+		}`, true, ErrorHandler{ErrorPages: map[int]string{}, Log: &httpserver.Logger{}}},
+		{`errors {
+			intercept /api 40
+		}`, true, ErrorHandler{ErrorPages: map[int]string{}, Log: &httpserver.Logger{}}},
+		{`errors {
+			templates yes
+		}`, true, ErrorHandler{ErrorPages: map[int]string{}, Log: &httpserver.Logger{}}},
+		{`errors {
+			json a.json b.json
+		}`, true, ErrorHandler{ErrorPages: map[int]string{}, Log: &httpserver.Logger{}}},
 	}
 
 	for i, test := range tests {
@@ -0,0 +1,473 @@
+// Package esi implements Edge Side Includes: it assembles pages from
+// the fragments that their <esi:include> tags refer to, on this site
+// or on upstream hosts, each fetched with a timeout and cached for as
+// long as it may be, so that the parts of dynamic pages that change
+// less often than others can be cached apart from them.
+package esi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var fragmentsTotal = metrics.NewCounter("caddy_http_esi_fragments_total",
+	"Number of ESI fragments included, by whether they were cached (hit), fetched (miss) or failed (error).",
+	"result")
+
+// ESI is middleware that processes the ESI tags of responses.
+type ESI struct {
+	Next    httpserver.Handler
+	Rules   []*Rule
+	BufPool *sync.Pool
+
+	// Site serves the fragments on the site itself, with all of
+	// its middleware, or this middleware does if it is nil.
+	Site *httpserver.SiteConfig
+}
+
+// Rule is the configuration of the responses in a path that are
+// processed.
+type Rule struct {
+	Path string
+
+	// Types are the content types of the responses processed.
+	Types []string
+
+	// Timeout limits how long each fragment may take to fetch.
+	Timeout time.Duration
+
+	// Cache, if not nil, keeps fragments for as long as their
+	// Cache-Control header allows, or CacheTTL if they have none;
+	// those fetched with the client's cookies or credentials only
+	// if they're public.
+	Cache    cachestore.Store
+	CacheTTL time.Duration
+
+	// Hosts are those that fragments may be fetched from by
+	// absolute URLs, other than the host of the site.
+	Hosts []string
+}
+
+// Limits of processing.
+const (
+	maxDepth        = 5       // of fragments that include others
+	maxIncludes     = 64      // per document
+	maxFetches      = 256     // per page, at all depths together
+	maxFragmentSize = 1 << 20 // in bytes
+)
+
+// depthKey is the context key of how deeply the request for a
+// fragment is nested.
+const depthKey caddy.CtxKey = "esi_depth"
+
+// fetchesKey is the context key of the number of fragments that
+// may still be fetched for the page that a request is part of.
+const fetchesKey caddy.CtxKey = "esi_fetches"
+
+// The first byte of a cached fragment: whether it may be served to
+// any client, or only to those without cookies or credentials.
+const (
+	cachedPublic    = 'P'
+	cachedAnonymous = 'A'
+)
+
+// errTooManyFetches is returned for the fragments of a page after
+// maxFetches of them are fetched.
+var errTooManyFetches = fmt.Errorf("more than %d fragments fetched for the page", maxFetches)
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e ESI) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range e.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+
+		buf := e.BufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer e.BufPool.Put(buf)
+
+		shouldBuf := func(status int, header http.Header) bool {
+			return status < 300 && rule.processes(header)
+		}
+		rb := httpserver.NewResponseBuffer(buf, w, shouldBuf)
+		code, err := e.Next.ServeHTTP(rb, r)
+		if !rb.Buffered() || code >= 300 || err != nil {
+			return code, err
+		}
+		if !rule.processes(rb.Header()) {
+			// WriteHeader wasn't called to decide
+			rb.CopyHeader()
+			w.Write(rb.Buffer.Bytes())
+			return code, nil
+		}
+
+		depth, _ := r.Context().Value(depthKey).(int)
+		if _, ok := r.Context().Value(fetchesKey).(*int32); !ok {
+			fetches := int32(maxFetches)
+			r = r.WithContext(context.WithValue(r.Context(), fetchesKey, &fetches))
+		}
+		out, err := e.process(r, rule, rb.Buffer.Bytes(), depth)
+		if err != nil {
+			return http.StatusBadGateway, err
+		}
+
+		rb.CopyHeader()
+		h := w.Header()
+		// the page is assembled anew every time it is served
+		h.Del("Last-Modified")
+		h.Del("ETag")
+		h.Del("Surrogate-Control")
+		h.Set("Content-Length", strconv.Itoa(len(out)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(out)
+		}
+		return 0, nil
+	}
+	return e.Next.ServeHTTP(w, r)
+}
+
+// processes returns whether responses with header are processed,
+// which are those of the rule's types, unless they're encoded.
+func (rule *Rule) processes(header http.Header) bool {
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return false
+	}
+	ct := header.Get("Content-Type")
+	if ct == "" {
+		return false
+	}
+	for _, t := range rule.Types {
+		if strings.HasPrefix(ct, t) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// includeRE matches an include tag, with its attributes.
+	includeRE = regexp.MustCompile(`<esi:include\s([^>]*?)/?>(?:\s*</esi:include>)?`)
+
+	// removeRE matches what is removed from documents: remove
+	// elements, with their content, which is shown only where
+	// ESI isn't processed, and comment tags.
+	removeRE = regexp.MustCompile(`(?s)<esi:remove>.*?</esi:remove>|<esi:comment[^>]*/>`)
+
+	// commentRE matches an ESI comment, whose content is shown
+	// only where ESI is processed.
+	commentRE = regexp.MustCompile(`(?s)<!--esi(.*?)-->`)
+
+	// attrRE matches an attribute of a tag.
+	attrRE = regexp.MustCompile(`([a-z]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// include is an include tag of a document.
+type include struct {
+	start, end int // of the tag in the document
+	src, alt   string
+	optional   bool // whether onerror="continue"
+
+	body []byte
+	err  error
+}
+
+// process returns doc, the response to r, with its ESI tags
+// processed; depth is how deeply it is included.
+func (e ESI) process(r *http.Request, rule *Rule, doc []byte, depth int) ([]byte, error) {
+	if !bytes.Contains(doc, []byte("esi")) {
+		return doc, nil
+	}
+	doc = removeRE.ReplaceAll(doc, nil)
+	doc = commentRE.ReplaceAll(doc, []byte("$1"))
+
+	locs := includeRE.FindAllSubmatchIndex(doc, -1)
+	if len(locs) == 0 {
+		return doc, nil
+	}
+	if len(locs) > maxIncludes {
+		return nil, fmt.Errorf("esi: %s has more than %d includes", r.URL.Path, maxIncludes)
+	}
+	if depth >= maxDepth {
+		return nil, fmt.Errorf("esi: %s: includes nested too deeply", r.URL.Path)
+	}
+
+	includes := make([]include, len(locs))
+	for i, loc := range locs {
+		inc := &includes[i]
+		inc.start, inc.end = loc[0], loc[1]
+		for _, m := range attrRE.FindAllSubmatch(doc[loc[2]:loc[3]], -1) {
+			value := string(m[2])
+			if m[2] == nil {
+				value = string(m[3])
+			}
+			switch string(m[1]) {
+			case "src":
+				inc.src = value
+			case "alt":
+				inc.alt = value
+			case "onerror":
+				inc.optional = value == "continue"
+			}
+		}
+	}
+
+	// fetch the fragments at once
+	var wg sync.WaitGroup
+	for i := range includes {
+		wg.Add(1)
+		go func(inc *include) {
+			defer wg.Done()
+			inc.body, inc.err = e.fragment(r, rule, inc.src, depth)
+			if inc.err != nil && inc.alt != "" {
+				inc.body, inc.err = e.fragment(r, rule, inc.alt, depth)
+			}
+		}(&includes[i])
+	}
+	wg.Wait()
+
+	var out bytes.Buffer
+	var last int
+	for _, inc := range includes {
+		out.Write(doc[last:inc.start])
+		last = inc.end
+		if inc.err != nil {
+			if !inc.optional {
+				return nil, fmt.Errorf("esi: %s: including %s: %v", r.URL.Path, inc.src, inc.err)
+			}
+			log.Printf("[WARNING] esi: %s: leaving out %s: %v", r.URL.Path, inc.src, inc.err)
+			continue
+		}
+		out.Write(inc.body)
+	}
+	out.Write(doc[last:])
+	return out.Bytes(), nil
+}
+
+// fragment returns the fragment at src, relative to the URL of r,
+// from the cache if it's there.
+func (e ESI) fragment(r *http.Request, rule *Rule, src string, depth int) ([]byte, error) {
+	if src == "" {
+		fragmentsTotal.Inc("error")
+		return nil, errors.New("no src")
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		fragmentsTotal.Inc("error")
+		return nil, err
+	}
+	u := r.URL.ResolveReference(ref)
+	internal := u.Host == "" || strings.EqualFold(u.Host, r.Host)
+	if !internal && !rule.allows(u) {
+		fragmentsTotal.Inc("error")
+		return nil, fmt.Errorf("%s is not on this site or an upstream host", src)
+	}
+
+	key := "esi:" + u.String()
+	if internal {
+		key = "esi:" + r.Host + u.RequestURI()
+	}
+	// a fragment of this site is fetched with the client's cookies
+	// and credentials, so it may be theirs alone unless it says it's
+	// public; those fetched without may only be served to the clients
+	// that have none either
+	credentialed := internal && (r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "")
+	if rule.Cache != nil {
+		if entry, err := rule.Cache.Get(key); err == nil && len(entry) > 0 && (entry[0] == cachedPublic || !credentialed) {
+			fragmentsTotal.Inc("hit")
+			return entry[1:], nil
+		}
+	}
+
+	if fetches, ok := r.Context().Value(fetchesKey).(*int32); ok && atomic.AddInt32(fetches, -1) < 0 {
+		fragmentsTotal.Inc("error")
+		return nil, errTooManyFetches
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), rule.Timeout)
+	defer cancel()
+	var body []byte
+	var header http.Header
+	if internal {
+		body, header, err = e.fetchInternal(ctx, r, u, depth)
+	} else {
+		body, header, err = e.fetchUpstream(ctx, r, rule, u, depth)
+	}
+	if err != nil {
+		fragmentsTotal.Inc("error")
+		return nil, err
+	}
+	fragmentsTotal.Inc("miss")
+
+	public := isPublic(header)
+	if rule.Cache != nil && (!credentialed || public) {
+		if ttl := cacheTTL(header, rule.CacheTTL); ttl > 0 {
+			entry := append([]byte{cachedAnonymous}, body...)
+			if public {
+				entry[0] = cachedPublic
+			}
+			if err := rule.Cache.Set(key, entry, ttl); err != nil {
+				log.Printf("[ERROR] esi: caching %s: %v", u, err)
+			}
+		}
+	}
+	return body, nil
+}
+
+// allows returns whether fragments may be fetched from u.
+func (rule *Rule) allows(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	for _, host := range rule.Hosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchInternal returns the response to a subrequest for u, on this
+// site, which is handled by all the middleware of the site, so that
+// it passes the same checks as requests of clients do and the
+// fragment's own tags are processed. The handler is given the
+// deadline of ctx, and waited for, so that nothing is left running.
+func (e ESI) fetchInternal(ctx context.Context, r *http.Request, u *url.URL, depth int) ([]byte, http.Header, error) {
+	target := &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery}
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header = httpserver.CloneHeader(r.Header)
+	// the whole response is needed, and uncompressed
+	req.Header.Del("Range")
+	req.Header.Del("Accept-Encoding")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Del("If-None-Match")
+	req.Host = r.Host
+	req.RemoteAddr = r.RemoteAddr
+	req.TLS = r.TLS
+	ctx = context.WithValue(ctx, depthKey, depth+1)
+	req = req.WithContext(context.WithValue(ctx, httpserver.OriginalURLCtxKey, *req.URL))
+
+	rec := httpserver.NewSubresponse()
+	status, err := e.Site.ServeSubrequest(rec, req, e)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if status >= 400 {
+		return nil, nil, fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+	if rec.Status >= 400 {
+		return nil, nil, fmt.Errorf("%d %s", rec.Status, http.StatusText(rec.Status))
+	}
+	if rec.Body.Len() > maxFragmentSize {
+		return nil, nil, fmt.Errorf("larger than %d bytes", maxFragmentSize)
+	}
+	return rec.Body.Bytes(), rec.Header(), nil
+}
+
+// client fetches fragments from upstream hosts.
+var client = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// fetchUpstream returns the fragment at u, on an upstream host,
+// with its tags processed if it's of a type that is.
+func (e ESI) fetchUpstream(ctx context.Context, r *http.Request, rule *Rule, u *url.URL, depth int) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	if lang := r.Header.Get("Accept-Language"); lang != "" {
+		req.Header.Set("Accept-Language", lang)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("%s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFragmentSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) > maxFragmentSize {
+		return nil, nil, fmt.Errorf("larger than %d bytes", maxFragmentSize)
+	}
+	if rule.processes(resp.Header) {
+		fragReq := *r
+		fragReq.URL = u
+		if body, err = e.process(&fragReq, rule, body, depth+1); err != nil {
+			return nil, nil, err
+		}
+	}
+	return body, resp.Header, nil
+}
+
+// cacheTTL returns how long a fragment with header may be cached:
+// as long as its Cache-Control header says, or def if it doesn't
+// say, but not at all if it sets a cookie.
+func cacheTTL(header http.Header, def time.Duration) time.Duration {
+	if header.Get("Set-Cookie") != "" {
+		return 0
+	}
+	cc := header.Get("Cache-Control")
+	if cc == "" {
+		return def
+	}
+	ttl := def
+	for _, directive := range strings.Split(strings.ToLower(cc), ",") {
+		directive = strings.TrimSpace(directive)
+		switch {
+		case directive == "no-store" || directive == "no-cache" || directive == "private":
+			return 0
+		case strings.HasPrefix(directive, "s-maxage="):
+			if secs, err := strconv.Atoi(directive[len("s-maxage="):]); err == nil {
+				return time.Duration(secs) * time.Second
+			}
+		case strings.HasPrefix(directive, "max-age="):
+			if secs, err := strconv.Atoi(directive[len("max-age="):]); err == nil {
+				ttl = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return ttl
+}
+
+// isPublic returns whether the Cache-Control header of header says
+// that a response may be cached for anyone.
+func isPublic(header http.Header) bool {
+	for _, directive := range strings.Split(strings.ToLower(header.Get("Cache-Control")), ",") {
+		if strings.TrimSpace(directive) == "public" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package esi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// pages is a site of the HTML pages it maps paths to.
+type pages map[string]string
+
+func (p pages) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	page, ok := p[r.URL.Path]
+	if !ok {
+		return http.StatusNotFound, nil
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("ETag", `"page"`)
+	w.Write([]byte(page))
+	return http.StatusOK, nil
+}
+
+func newTestESI(next httpserver.Handler, rule *Rule) ESI {
+	rule.Path = "/"
+	if rule.Types == nil {
+		rule.Types = defaultTypes
+	}
+	if rule.Timeout == 0 {
+		rule.Timeout = time.Second
+	}
+	return ESI{
+		Next:    next,
+		Rules:   []*Rule{rule},
+		BufPool: &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
+	}
+}
+
+// serve returns the status and body of the response of e to path.
+func serve(e ESI, path string) (int, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest("GET", "http://example.com"+path, nil)
+	r.Header.Set("Accept-Language", "de")
+	w := httptest.NewRecorder()
+	status, _ := e.ServeHTTP(w, r)
+	if status == 0 {
+		status = w.Code
+	}
+	return status, w
+}
+
+func TestESI(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/footer" {
+			w.Write([]byte("FOOTER"))
+			return
+		}
+		// relative to the upstream host, not the site
+		w.Write([]byte(`upstream ` + r.Header.Get("Accept-Language") + ` <esi:include src="/footer"/>`))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	e := newTestESI(pages{
+		"/header.html":        "HEADER",
+		"/page.html":          `<p><esi:include src="/header.html"/></p>`,
+		"/alt.html":           `<esi:include src="/missing.html" alt="/header.html"></esi:include>`,
+		"/optional.html":      `a<esi:include src="/missing.html" onerror="continue"/>b`,
+		"/required.html":      `a<esi:include src="/missing.html"/>b`,
+		"/relative/page.html": `<esi:include src='../header.html' />`,
+		"/tags.html":          `<esi:remove>no ESI</esi:remove><esi:comment text="note"/><!--esi <b>ESI</b>-->`,
+		"/nested.html":        `[<esi:include src="/header.html"/>]`,
+		"/nesting.html":       `<esi:include src="/nested.html"/>`,
+		"/loop.html":          `<esi:include src="/loop.html"/>`,
+		"/upstream.html":      `<esi:include src="` + upstream.URL + `/frag"/>`,
+		"/elsewhere.html":     `<esi:include src="http://elsewhere.example.com/frag"/>`,
+		"/scheme.html":        `<esi:include src="file:///etc/passwd"/>`,
+	}, &Rule{Hosts: []string{u.Host}})
+
+	for i, test := range []struct {
+		path         string
+		expectStatus int
+		expectBody   string
+	}{
+		{"/page.html", http.StatusOK, "<p>HEADER</p>"},
+		{"/alt.html", http.StatusOK, "HEADER"},
+		{"/optional.html", http.StatusOK, "ab"},
+		{"/required.html", http.StatusBadGateway, ""},
+		{"/relative/page.html", http.StatusOK, "HEADER"},
+		{"/tags.html", http.StatusOK, " <b>ESI</b>"},
+		{"/nesting.html", http.StatusOK, "[HEADER]"},
+		{"/loop.html", http.StatusBadGateway, ""},
+		{"/upstream.html", http.StatusOK, "upstream de FOOTER"},
+		{"/elsewhere.html", http.StatusBadGateway, ""},
+		{"/scheme.html", http.StatusBadGateway, ""},
+		{"/missing.html", http.StatusNotFound, ""},
+	} {
+		status, w := serve(e, test.path)
+		if status != test.expectStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if got := w.Body.String(); got != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, got)
+		}
+		if w.Header().Get("ETag") != "" {
+			t.Errorf("Test %d: expected ETag of the page to be removed", i)
+		}
+		if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(test.expectBody)) {
+			t.Errorf("Test %d: expected Content-Length %d, got %s", i, len(test.expectBody), got)
+		}
+	}
+}
+
+func TestESITypes(t *testing.T) {
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if r.URL.Path != "/" {
+			return http.StatusNotFound, nil
+		}
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Header().Set("Content-Encoding", r.URL.Query().Get("encoding"))
+		w.Write([]byte(`<esi:include src="/missing"/>`))
+		return http.StatusOK, nil
+	})
+	e := newTestESI(next, &Rule{Types: []string{"text/html", "application/xhtml+xml"}})
+
+	for i, test := range []struct {
+		query   string
+		process bool
+	}{
+		{"type=text/html", true},
+		{"type=application/xhtml%2Bxml", true},
+		{"type=text/plain", false},
+		{"type=text/html&encoding=gzip", false},
+		{"", false},
+	} {
+		status, w := serve(e, "/?"+test.query)
+		if processed := status == http.StatusBadGateway; processed != test.process {
+			t.Errorf("Test %d: expected processed %t, got status %d", i, test.process, status)
+		}
+		if !test.process && w.Body.String() != `<esi:include src="/missing"/>` {
+			t.Errorf("Test %d: expected body to be unchanged, got %q", i, w.Body.String())
+		}
+	}
+}
+
+func TestESICache(t *testing.T) {
+	var fetched int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+		w.Write([]byte("fragment"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	e := newTestESI(pages{
+		"/cached.html":   `<esi:include src="` + upstream.URL + `/?cc=max-age=60"/>`,
+		"/uncached.html": `<esi:include src="` + upstream.URL + `/?cc=no-store"/>`,
+	}, &Rule{Hosts: []string{u.Hostname()}, Cache: cachestore.NewMemory(10), CacheTTL: time.Minute})
+
+	for i, test := range []struct {
+		path        string
+		expectFetch int32
+	}{
+		{"/cached.html", 1},
+		{"/cached.html", 1},
+		{"/uncached.html", 2},
+		{"/uncached.html", 3},
+	} {
+		status, w := serve(e, test.path)
+		if status != http.StatusOK || w.Body.String() != "fragment" {
+			t.Errorf("Test %d: expected the fragment, got %d %q", i, status, w.Body.String())
+		}
+		if got := atomic.LoadInt32(&fetched); got != test.expectFetch {
+			t.Errorf("Test %d: expected %d fetches, got %d", i, test.expectFetch, got)
+		}
+	}
+}
+
+func TestESITimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	e := newTestESI(pages{
+		"/slow.html": `a<esi:include src="` + upstream.URL + `/" onerror="continue"/>b`,
+	}, &Rule{Hosts: []string{u.Host}, Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	status, w := serve(e, "/slow.html")
+	if status != http.StatusOK || w.Body.String() != "ab" {
+		t.Errorf("Expected the slow fragment to be left out, got %d %q", status, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the fragment to time out, took %v", elapsed)
+	}
+}
+
+func TestESICredentials(t *testing.T) {
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/page.html":
+			w.Write([]byte(`<esi:include src="/user"/>|<esi:include src="/public"/>`))
+		case "/user":
+			w.Write([]byte(r.Header.Get("Cookie")))
+		case "/public":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Write([]byte("public " + r.Header.Get("Cookie")))
+		default:
+			return http.StatusNotFound, nil
+		}
+		return http.StatusOK, nil
+	})
+	e := newTestESI(next, &Rule{Cache: cachestore.NewMemory(10), CacheTTL: time.Minute})
+
+	for i, test := range []struct {
+		cookie     string
+		expectBody string
+	}{
+		{"user=a", "user=a|public user=a"},
+		{"user=b", "user=b|public user=a"},
+		{"", "|public user=a"},
+		{"user=c", "user=c|public user=a"},
+	} {
+		r := httptest.NewRequest("GET", "http://example.com/page.html", nil)
+		if test.cookie != "" {
+			r.Header.Set("Cookie", test.cookie)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, r)
+		if got := w.Body.String(); got != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, got)
+		}
+	}
+}
+
+func TestESIFetchLimit(t *testing.T) {
+	fanOut := func(n int, src string) string {
+		return strings.Repeat(`<esi:include src="`+src+`"/>`, n)
+	}
+	e := newTestESI(pages{
+		"/leaf.html":  "x",
+		"/wide.html":  fanOut(maxIncludes, "/leaf.html"),
+		"/huge.html":  fanOut(maxIncludes, "/wide.html"),
+		"/small.html": fanOut(3, "/wide.html"),
+	}, &Rule{})
+
+	if status, _ := serve(e, "/huge.html"); status != http.StatusBadGateway {
+		t.Errorf("Expected a page of too many fragments to fail, got %d", status)
+	}
+	status, w := serve(e, "/small.html")
+	if status != http.StatusOK || w.Body.Len() != 3*maxIncludes {
+		t.Errorf("Expected the fragments of the page, got %d %q", status, w.Body.String())
+	}
+}
+
+func TestESIInternalTimeout(t *testing.T) {
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return http.StatusOK, nil
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`a<esi:include src="/slow" onerror="continue"/>b`))
+		return http.StatusOK, nil
+	})
+	e := newTestESI(next, &Rule{Timeout: 50 * time.Millisecond})
+
+	status, w := serve(e, "/page.html")
+	if status != http.StatusOK || w.Body.String() != "ab" {
+		t.Errorf("Expected the slow fragment to be left out, got %d %q", status, w.Body.String())
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	for i, test := range []struct {
+		cacheControl string
+		setCookie    string
+		expect       time.Duration
+	}{
+		{"", "", time.Minute},
+		{"public", "", time.Minute},
+		{"max-age=30", "", 30 * time.Second},
+		{"max-age=30, s-maxage=90", "", 90 * time.Second},
+		{"max-age=0", "", 0},
+		{"public, no-store", "", 0},
+		{"no-cache", "", 0},
+		{"Private, max-age=30", "", 0},
+		{"max-age=30", "id=1", 0},
+	} {
+		header := http.Header{}
+		header.Set("Cache-Control", test.cacheControl)
+		header.Set("Set-Cookie", test.setCookie)
+		if got := cacheTTL(header, time.Minute); got != test.expect {
+			t.Errorf("Test %d: expected %v, got %v", i, test.expect, got)
+		}
+	}
+}
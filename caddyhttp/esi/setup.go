@@ -0,0 +1,124 @@
+package esi
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("esi", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// Defaults of a Rule.
+const defaultTimeout = 2 * time.Second
+
+var defaultTypes = []string{"text/html"}
+
+// setup configures a new ESI middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := esiParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return ESI{
+			Next:  next,
+			Rules: rules,
+			Site:  cfg,
+			BufPool: &sync.Pool{
+				New: func() interface{} {
+					return new(bytes.Buffer)
+				},
+			},
+		}
+	})
+
+	return nil
+}
+
+// esiParse parses
+//
+//	esi [path] {
+//		types    content_types...
+//		timeout  duration
+//		cache    ttl [store_url]
+//		upstream hosts...
+//	}
+//
+// where fragments are cached, in memory unless in the store at
+// store_url, for as long as their Cache-Control header says, or
+// for ttl if they have none, and may be fetched by absolute URLs
+// from the upstream hosts as well as from the site.
+func esiParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Path: "/", Types: defaultTypes, Timeout: defaultTimeout}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "types":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Types = args
+			case "timeout":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return nil, c.Errf("Bad esi timeout '%s'", args[0])
+				}
+				rule.Timeout = d
+			case "cache":
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ttl, err := time.ParseDuration(args[0])
+				if err != nil || ttl < 0 {
+					return nil, c.Errf("Bad esi cache ttl '%s'", args[0])
+				}
+				rule.CacheTTL = ttl
+				var store cachestore.Store = cachestore.NewMemory(cachestore.DefaultMaxEntries)
+				if len(args) == 2 {
+					if store, err = cachestore.New(args[1]); err != nil {
+						return nil, c.Err(err.Error())
+					}
+				}
+				rule.Cache = store
+			case "upstream":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Hosts = append(rule.Hosts, args...)
+			default:
+				return nil, c.Errf("Unknown esi property '%s'", what)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,105 @@
+package esi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `esi`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(ESI)
+	if !ok {
+		t.Fatalf("Expected handler to be type ESI, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestESIParse(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		expected    []Rule
+		expectCache []interface{}
+	}{
+		{`esi`, false, []Rule{{Path: "/", Types: defaultTypes, Timeout: defaultTimeout}}, []interface{}{nil}},
+		{`esi /pages {
+			types text/html application/xhtml+xml
+			timeout 500ms
+			cache 1m
+			upstream fragments.internal:8080 cdn.example.com
+		}
+		esi /api {
+			cache 0s memcached://localhost:11211
+		}`, false, []Rule{
+			{
+				Path:     "/pages",
+				Types:    []string{"text/html", "application/xhtml+xml"},
+				Timeout:  500 * time.Millisecond,
+				CacheTTL: time.Minute,
+				Hosts:    []string{"fragments.internal:8080", "cdn.example.com"},
+			},
+			{Path: "/api", Types: defaultTypes, Timeout: defaultTimeout},
+		}, []interface{}{&cachestore.Memory{}, &cachestore.Memcached{}}},
+		{`esi / /other`, true, nil, nil},
+		{`esi {
+			timeout 0s
+		}`, true, nil, nil},
+		{`esi {
+			cache soon
+		}`, true, nil, nil},
+		{`esi {
+			cache 1m bolt://localhost
+		}`, true, nil, nil},
+		{`esi {
+			upstream
+		}`, true, nil, nil},
+		{`esi {
+			types
+		}`, true, nil, nil},
+		{`esi {
+			fetch all
+		}`, true, nil, nil},
+	}
+	for i, test := range tests {
+		actual, err := esiParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d: expected %d rules, got %d", i, len(test.expected), len(actual))
+		}
+		for j, rule := range actual {
+			if reflect.TypeOf(rule.Cache) != reflect.TypeOf(test.expectCache[j]) {
+				t.Errorf("Test %d: expected cache %T, got %T", i, test.expectCache[j], rule.Cache)
+			}
+			rule.Cache = nil
+			if !reflect.DeepEqual(*rule, test.expected[j]) {
+				t.Errorf("Test %d: expected %#v, got %#v", i, test.expected[j], *rule)
+			}
+		}
+	}
+}
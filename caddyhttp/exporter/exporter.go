@@ -0,0 +1,38 @@
+// Package exporter implements the metrics directive, which counts
+// and times the requests to a site and exposes the metrics registry
+// in the Prometheus text format.
+package exporter
+
+import (
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+// Exporter is a middleware that serves the metrics registry
+// at a path.
+type Exporter struct {
+	Next httpserver.Handler
+	Path string
+}
+
+// ServeHTTP writes the metrics registry in response to requests
+// for e.Path and passes all other requests up the chain.
+func (e Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !httpserver.Path(r.URL.Path).Matches(e.Path) {
+		return e.Next.ServeHTTP(w, r)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return http.StatusMethodNotAllowed, nil
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return 0, nil
+	}
+	metrics.DefaultRegistry.WriteTo(w)
+	return 0, nil
+}
@@ -0,0 +1,49 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+func TestExporter(t *testing.T) {
+	e := Exporter{Path: "/metrics", Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusTeapot, nil
+	})}
+
+	for i, test := range []struct {
+		method, path   string
+		expectedStatus int
+		expectedBody   bool
+	}{
+		{"GET", "/metrics", 0, true},
+		{"HEAD", "/metrics", 0, false},
+		{"POST", "/metrics", http.StatusMethodNotAllowed, false},
+		{"GET", "/other", http.StatusTeapot, false},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		status, err := e.ServeHTTP(w, r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		body := w.Body.String()
+		if test.expectedBody {
+			if ct := w.Header().Get("Content-Type"); ct != metrics.ContentType {
+				t.Errorf("Test %d: Expected Content-Type %s, got %s", i, metrics.ContentType, ct)
+			}
+			if !strings.Contains(body, "# TYPE go_goroutines gauge") {
+				t.Errorf("Test %d: Expected runtime metrics in body, got:\n%s", i, body)
+			}
+		} else if body != "" {
+			t.Errorf("Test %d: Expected empty body, got:\n%s", i, body)
+		}
+	}
+}
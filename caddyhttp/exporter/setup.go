@@ -0,0 +1,59 @@
+package exporter
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("metrics", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup enables metrics for a site and configures a new
+// Exporter middleware instance, unless the path is "off".
+func setup(c *caddy.Controller) error {
+	path, err := metricsParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.Metrics = true
+
+	if path != "off" {
+		cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+			return Exporter{Next: next, Path: path}
+		})
+	}
+
+	return nil
+}
+
+// metricsParse parses
+//
+//     metrics [path]
+//
+// where path is where the exporter is served, or "off" to
+// collect metrics for the site without serving them there.
+func metricsParse(c *caddy.Controller) (string, error) {
+	path := defaultMetricsPath
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			path = args[0]
+		default:
+			return "", c.ArgErr()
+		}
+		if c.NextBlock() {
+			return "", c.Errf("unknown property '%s'", c.Val())
+		}
+	}
+	return path, nil
+}
+
+const defaultMetricsPath = "/metrics"
@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input        string
+		shouldErr    bool
+		expectedPath string // empty if no exporter is expected
+	}{
+		{`metrics`, false, "/metrics"},
+		{`metrics /stats`, false, "/stats"},
+		{`metrics off`, false, ""},
+		{`metrics /a /b`, true, ""},
+		{"metrics {\n path /a\n}", true, ""},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+
+		cfg := httpserver.GetConfig(c)
+		if !cfg.Metrics {
+			t.Errorf("Test %d: Expected metrics to be enabled for the site", i)
+		}
+		mids := cfg.Middleware()
+		if test.expectedPath == "" {
+			if len(mids) != 0 {
+				t.Errorf("Test %d: Expected no middleware, got %d", i, len(mids))
+			}
+			continue
+		}
+		if len(mids) == 0 {
+			t.Fatalf("Test %d: Expected middleware, got 0 instead", i)
+		}
+		handler := mids[0](httpserver.EmptyNext)
+		e, ok := handler.(Exporter)
+		if !ok {
+			t.Fatalf("Test %d: Expected handler to be type Exporter, got: %#v", i, handler)
+		}
+		if e.Path != test.expectedPath {
+			t.Errorf("Test %d: Expected path %s, got %s", i, test.expectedPath, e.Path)
+		}
+		if !httpserver.SameNext(e.Next, httpserver.EmptyNext) {
+			t.Errorf("Test %d: 'Next' field of handler was not set properly", i)
+		}
+	}
+}
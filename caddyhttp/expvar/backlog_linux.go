@@ -0,0 +1,81 @@
+package expvar
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenerBacklogs returns the accept queues of the listening
+// sockets on the given ports, by listener address, as reported
+// in /proc/net/tcp and /proc/net/tcp6. For a socket in the LISTEN
+// state, the receive queue column is the number of connections
+// waiting to be accepted; the transmit queue column is not the
+// length the queue may grow to, which is the backlog Go listens
+// with: net.core.somaxconn.
+func listenerBacklogs(ports map[int]string) map[string]backlog {
+	max := somaxconn()
+	backlogs := make(map[string]backlog)
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		parseBacklogs(bufio.NewScanner(f), ports, max, backlogs)
+		f.Close()
+	}
+	return backlogs
+}
+
+// somaxconn returns the limit of the backlog of listening sockets,
+// or 0 if it can't be read.
+func somaxconn() int {
+	data, err := ioutil.ReadFile("/proc/sys/net/core/somaxconn")
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// tcpListen is the LISTEN state in /proc/net/tcp.
+const tcpListen = "0A"
+
+// parseBacklogs adds the accept queues of the sockets listening on
+// ports in the lines of /proc/net/tcp from scanner to backlogs; each
+// socket's queue may hold max connections.
+func parseBacklogs(scanner *bufio.Scanner, ports map[int]string, max int, backlogs map[string]backlog) {
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[3] != tcpListen {
+			continue
+		}
+		local := strings.Split(fields[1], ":")
+		queues := strings.Split(fields[4], ":") // tx_queue:rx_queue
+		if len(local) != 2 || len(queues) != 2 {
+			continue
+		}
+		port, err := strconv.ParseInt(local[1], 16, 32)
+		if err != nil {
+			continue
+		}
+		addr, ok := ports[int(port)]
+		if !ok {
+			continue
+		}
+		queued, err := strconv.ParseInt(queues[1], 16, 64)
+		if err != nil {
+			continue
+		}
+		b := backlogs[addr]
+		b.Queued += int(queued)
+		b.Max += max
+		backlogs[addr] = b
+	}
+}
@@ -0,0 +1,23 @@
+package expvar
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestParseBacklogs(t *testing.T) {
+	const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000003 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:1F90 0100007F:D2A4 01 00000000:00000000 00:00000000 00000000     0        0 3 1 0000000000000000 20 4 30 10 -1
+`
+	backlogs := make(map[string]backlog)
+	parseBacklogs(bufio.NewScanner(strings.NewReader(procNetTCP)), map[int]string{8080: "[::]:8080"}, 4096, backlogs)
+	if len(backlogs) != 1 {
+		t.Fatalf("Expected only the listener on port 8080, got %v", backlogs)
+	}
+	if b := backlogs["[::]:8080"]; b.Queued != 3 || b.Max != 4096 {
+		t.Errorf("Expected 3 of 4096 queued, got %+v", b)
+	}
+}
@@ -0,0 +1,9 @@
+// +build !linux
+
+package expvar
+
+// listenerBacklogs returns nothing, since only Linux
+// reports the accept queues of listening sockets.
+func listenerBacklogs(ports map[int]string) map[string]backlog {
+	return nil
+}
@@ -1,6 +1,7 @@
 package expvar
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -41,6 +42,25 @@ func TestExpVar(t *testing.T) {
 }
 
 func contentHandler(w http.ResponseWriter, r *http.Request) (int, error) {
-	fmt.Fprintf(w, r.URL.String())
+	fmt.Fprint(w, r.URL.String())
 	return http.StatusOK, nil
 }
+
+func TestCaddyStats(t *testing.T) {
+	stats, ok := caddyStats().(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a map, got %T", caddyStats())
+	}
+	for _, key := range []string{"runtime", "process", "sites", "listeners"} {
+		if _, ok := stats[key]; !ok {
+			t.Errorf("Expected %s in stats", key)
+		}
+	}
+	process := stats["process"].(map[string]interface{})
+	if fds := process["open_fds"].(int); fds == 0 {
+		t.Errorf("Expected open file descriptors to be counted or -1, got 0")
+	}
+	if _, err := json.Marshal(stats); err != nil {
+		t.Errorf("Expected stats to marshal as JSON, got error: %v", err)
+	}
+}
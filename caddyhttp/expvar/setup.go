@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/basicauth"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -18,7 +19,7 @@ func init() {
 
 // setup configures a new ExpVar middleware instance.
 func setup(c *caddy.Controller) error {
-	resource, err := expVarParse(c)
+	resource, auth, err := expVarParse(c)
 	if err != nil {
 		return err
 	}
@@ -28,17 +29,30 @@ func setup(c *caddy.Controller) error {
 
 	ev := ExpVar{Resource: resource}
 
-	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		ev.Next = next
+		if auth != nil {
+			// only the expvar resource itself is protected
+			return basicauth.BasicAuth{Next: ev, SiteRoot: cfg.Root, Rules: []basicauth.Rule{*auth}}
+		}
 		return ev
 	})
 
 	return nil
 }
 
-func expVarParse(c *caddy.Controller) (Resource, error) {
+// expVarParse parses
+//
+//     expvar [path] {
+//         basicauth <username> <password>
+//     }
+//
+// where the password may be htpasswd=<file>, as with the
+// basicauth directive.
+func expVarParse(c *caddy.Controller) (Resource, *basicauth.Rule, error) {
 	var resource Resource
-	var err error
+	var auth *basicauth.Rule
 
 	for c.Next() {
 		args := c.RemainingArgs()
@@ -48,11 +62,31 @@ func expVarParse(c *caddy.Controller) (Resource, error) {
 		case 1:
 			resource = Resource(args[0])
 		default:
-			return resource, c.ArgErr()
+			return resource, nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "basicauth":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return resource, nil, c.ArgErr()
+				}
+				pm, err := basicauth.GetPasswordMatcher(args[0], args[1], httpserver.GetConfig(c).Root)
+				if err != nil {
+					return resource, nil, err
+				}
+				auth = &basicauth.Rule{Username: args[0], Password: pm, Realm: "expvar"}
+			default:
+				return resource, nil, c.Errf("unknown property '%s'", c.Val())
+			}
 		}
 	}
 
-	return resource, err
+	if auth != nil {
+		auth.Resources = []string{string(resource)}
+	}
+	return resource, auth, nil
 }
 
 func publishExtraVars() {
@@ -62,6 +96,7 @@ func publishExtraVars() {
 		expvar.Publish("Goroutines", expvar.Func(func() interface{} {
 			return runtime.NumGoroutine()
 		}))
+		expvar.Publish("caddy", expvar.Func(caddyStats))
 	})
 }
 
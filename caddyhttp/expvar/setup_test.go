@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/basicauth"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -40,3 +41,39 @@ func TestSetup(t *testing.T) {
 		t.Error("'Next' field of handler was not set properly")
 	}
 }
+
+func TestSetupBasicAuth(t *testing.T) {
+	c := caddy.NewTestController("http", "expvar /d/v {\n basicauth admin s3cret\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	auth, ok := handler.(basicauth.BasicAuth)
+	if !ok {
+		t.Fatalf("Expected handler to be type BasicAuth, got: %#v", handler)
+	}
+	if len(auth.Rules) != 1 || auth.Rules[0].Username != "admin" ||
+		!auth.Rules[0].Password("s3cret") || auth.Rules[0].Password("wrong") {
+		t.Errorf("Expected a rule for admin with the given password, got %#v", auth.Rules)
+	}
+	if res := auth.Rules[0].Resources; len(res) != 1 || res[0] != "/d/v" {
+		t.Errorf("Expected only /d/v to be protected, got %v", res)
+	}
+	if ev, ok := auth.Next.(ExpVar); !ok || !httpserver.SameNext(ev.Next, httpserver.EmptyNext) {
+		t.Errorf("Expected BasicAuth to wrap ExpVar, got: %#v", auth.Next)
+	}
+
+	for _, input := range []string{
+		"expvar {\n basicauth admin\n}",
+		"expvar {\n bogus\n}",
+		`expvar /a /b`,
+	} {
+		if err := setup(caddy.NewTestController("http", input)); err == nil {
+			t.Errorf("Expected an error for %q, got none", input)
+		}
+	}
+}
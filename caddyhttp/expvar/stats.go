@@ -0,0 +1,102 @@
+package expvar
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+var startTime = time.Now()
+
+// caddyStats returns the value of the "caddy" variable, which
+// groups the runtime, process, site and listener statistics.
+func caddyStats() interface{} {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	var lastGC time.Time
+	if ms.LastGC > 0 {
+		lastGC = time.Unix(0, int64(ms.LastGC))
+	}
+
+	return map[string]interface{}{
+		"runtime": map[string]interface{}{
+			"go_version": runtime.Version(),
+			"goroutines": runtime.NumGoroutine(),
+			"num_cpu":    runtime.NumCPU(),
+			"memory": map[string]interface{}{
+				"alloc":        ms.Alloc,
+				"total_alloc":  ms.TotalAlloc,
+				"sys":          ms.Sys,
+				"heap_alloc":   ms.HeapAlloc,
+				"heap_inuse":   ms.HeapInuse,
+				"heap_objects": ms.HeapObjects,
+				"stack_inuse":  ms.StackInuse,
+			},
+			"gc": map[string]interface{}{
+				"num_gc":         ms.NumGC,
+				"pause_total_ns": ms.PauseTotalNs,
+				"next_gc":        ms.NextGC,
+				"last_gc":        lastGC,
+			},
+		},
+		"process": map[string]interface{}{
+			"pid":            os.Getpid(),
+			"open_fds":       openFDs(),
+			"uptime_seconds": int64(time.Since(startTime).Seconds()),
+		},
+		"sites":     httpserver.SiteRequests(),
+		"listeners": listenerBacklogs(listenerPorts()),
+	}
+}
+
+// openFDs returns the number of open file descriptors of the
+// process, or -1 if the platform offers no way to count them.
+func openFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		d, err := os.Open(dir)
+		if err != nil {
+			continue
+		}
+		names, err := d.Readdirnames(-1)
+		d.Close()
+		if err != nil {
+			continue
+		}
+		return len(names) - 1 // not counting d
+	}
+	return -1
+}
+
+// listenerPorts returns the addresses of Caddy's TCP listeners
+// by port number.
+func listenerPorts() map[int]string {
+	ports := make(map[int]string)
+	for _, inst := range caddy.Instances() {
+		for _, s := range inst.Servers() {
+			addr := s.Addr()
+			if addr == nil || addr.Network() != "tcp" {
+				continue
+			}
+			_, portStr, err := net.SplitHostPort(addr.String())
+			if err != nil {
+				continue
+			}
+			if port, err := strconv.Atoi(portStr); err == nil {
+				ports[port] = addr.String()
+			}
+		}
+	}
+	return ports
+}
+
+// backlog is the state of a listener's accept queue.
+type backlog struct {
+	Queued int `json:"queued"`
+	Max    int `json:"max"`
+}
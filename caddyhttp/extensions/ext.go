@@ -3,7 +3,8 @@
 // The root path of the site is passed in as well as possible extensions
 // to try internally for paths requested that don't match an existing
 // resource. The first path+ext combination that matches a valid file
-// will be used.
+// will be used, unless negotiation is on, in which case the one that
+// best matches the Accept header of the request will be.
 package extensions
 
 import (
@@ -24,17 +25,37 @@ type Ext struct {
 	// Path to site root
 	Root string
 
+	// FileSys is the file system of the site, in place of Root,
+	// if it isn't a directory on disk, such as an archive.
+	FileSys http.FileSystem
+
 	// List of extensions to try
 	Extensions []string
+
+	// Negotiate is whether to choose among the files that exist
+	// by the Accept header of requests, rather than by order.
+	Negotiate bool
+
+	// Priorities are the qualities of the files with extensions,
+	// by which the client's preferences are weighed; 1 if not set.
+	Priorities map[string]float64
 }
 
 // ServeHTTP implements the httpserver.Handler interface.
 func (e Ext) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	urlpath := strings.TrimSuffix(r.URL.Path, "/")
 	if len(r.URL.Path) > 0 && path.Ext(urlpath) == "" && r.URL.Path[len(r.URL.Path)-1] != '/' {
+		if e.Negotiate {
+			if len(e.Extensions) > 1 {
+				w.Header().Add("Vary", "Accept")
+			}
+			if ext, ok := e.negotiate(r, urlpath); ok {
+				r.URL.Path = urlpath + ext
+			}
+			return e.Next.ServeHTTP(w, r)
+		}
 		for _, ext := range e.Extensions {
-			_, err := os.Stat(httpserver.SafePath(e.Root, urlpath) + ext)
-			if err == nil {
+			if e.exists(urlpath + ext) {
 				r.URL.Path = urlpath + ext
 				break
 			}
@@ -42,3 +63,17 @@ func (e Ext) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	}
 	return e.Next.ServeHTTP(w, r)
 }
+
+// exists returns whether the file at urlpath exists.
+func (e Ext) exists(urlpath string) bool {
+	if e.FileSys == nil {
+		_, err := os.Stat(httpserver.SafePath(e.Root, urlpath))
+		return err == nil
+	}
+	f, err := e.FileSys.Open(urlpath)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
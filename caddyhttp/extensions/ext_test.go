@@ -0,0 +1,47 @@
+package extensions
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestExtFileSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_ext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "about.html"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var served string
+	e := Ext{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			served = r.URL.Path
+			return 0, nil
+		}),
+		// the root of a site served from an archive is the path of
+		// the archive, which isn't a directory
+		Root:       filepath.Join(dir, "site.zip"),
+		FileSys:    http.Dir(dir),
+		Extensions: []string{".txt", ".html"},
+	}
+	for i, test := range []struct {
+		path, expectPath string
+	}{
+		{"/about", "/about.html"},
+		{"/contact", "/contact"},
+	} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if served != test.expectPath {
+			t.Errorf("Test %d: Expected %s to be served as %s, got %s", i, test.path, test.expectPath, served)
+		}
+	}
+}
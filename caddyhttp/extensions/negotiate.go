@@ -0,0 +1,94 @@
+package extensions
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// fallbackTypes are the media types of extensions that systems may
+// not know.
+var fallbackTypes = map[string]string{
+	".json":     "application/json",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+}
+
+// negotiate returns the extension of the file for urlpath that best
+// matches the Accept header of r, weighed by the priorities of the
+// extensions; ties go to the extension listed first. If the client
+// accepts none of the files, the first that exists is chosen.
+func (e Ext) negotiate(r *http.Request, urlpath string) (string, bool) {
+	accept := parseAccept(r.Header["Accept"])
+	var first, best string
+	bestQ := 0.0
+	for _, ext := range e.Extensions {
+		if !e.exists(urlpath + ext) {
+			continue
+		}
+		if first == "" {
+			first = ext
+		}
+		q := accept.quality(mediaType(ext))
+		if priority, ok := e.Priorities[ext]; ok {
+			q *= priority
+		}
+		if q > bestQ {
+			best, bestQ = ext, q
+		}
+	}
+	if best != "" {
+		return best, true
+	}
+	return first, first != ""
+}
+
+// mediaType returns the media type of files with the extension ext,
+// without parameters.
+func mediaType(ext string) string {
+	t := mime.TypeByExtension(ext)
+	if t == "" {
+		t = fallbackTypes[strings.ToLower(ext)]
+	}
+	if t == "" {
+		return "application/octet-stream"
+	}
+	return strings.ToLower(strings.TrimSpace(strings.SplitN(t, ";", 2)[0]))
+}
+
+// acceptRanges are the media ranges of an Accept header.
+type acceptRanges []staticfiles.AcceptValue
+
+// parseAccept parses the values of Accept headers. No values accept
+// anything.
+func parseAccept(values []string) acceptRanges {
+	ranges := acceptRanges(staticfiles.ParseAccept(values))
+	if len(ranges) == 0 {
+		ranges = acceptRanges{{Value: "*/*", Q: 1}}
+	}
+	return ranges
+}
+
+// quality returns the quality of the most specific range that
+// matches mediaType, or 0 if none does.
+func (ranges acceptRanges) quality(mediaType string) float64 {
+	major := strings.SplitN(mediaType, "/", 2)[0]
+	q, specificity := 0.0, 0
+	for _, ar := range ranges {
+		s := 0
+		switch ar.Value {
+		case mediaType:
+			s = 3
+		case major + "/*":
+			s = 2
+		case "*/*":
+			s = 1
+		}
+		if s > specificity {
+			q, specificity = ar.Q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,69 @@
+package extensions
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestNegotiate(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_ext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"doc.html", "doc.json", "doc.md", "page.md"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var served string
+	e := Ext{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			served = r.URL.Path
+			return 0, nil
+		}),
+		Root:       root,
+		Extensions: []string{".html", ".json", ".md"},
+		Negotiate:  true,
+		Priorities: map[string]float64{".md": 0.5},
+	}
+
+	for i, test := range []struct {
+		path, accept string
+		expectPath   string
+		expectVary   bool
+	}{
+		{"/doc", "", "/doc.html", true},
+		{"/doc", "application/json", "/doc.json", true},
+		{"/doc", "text/html;q=0.8, application/json", "/doc.json", true},
+		{"/doc", "text/*", "/doc.html", true},
+		{"/doc", "text/markdown, text/html;q=0.6", "/doc.html", true},
+		{"/doc", "text/markdown, text/html;q=0.4", "/doc.md", true},
+		{"/doc", "*/*, application/json;q=0", "/doc.html", true},
+		{"/doc", "image/png", "/doc.html", true},
+		{"/page", "application/json", "/page.md", true},
+		{"/none", "application/json", "/none", true},
+		{"/doc.html", "application/json", "/doc.html", false},
+		{"/doc/", "application/json", "/doc/", false},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, r)
+		if served != test.expectPath {
+			t.Errorf("Test %d: expected %s to be served, got %s", i, test.expectPath, served)
+		}
+		if vary := rec.Header().Get("Vary") == "Accept"; vary != test.expectVary {
+			t.Errorf("Test %d: expected Vary: Accept to be %v, got %v", i, test.expectVary, vary)
+		}
+	}
+}
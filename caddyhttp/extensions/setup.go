@@ -1,6 +1,8 @@
 package extensions
 
 import (
+	"strconv"
+
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -15,39 +17,68 @@ func init() {
 // setup configures a new instance of 'extensions' middleware for clean URLs.
 func setup(c *caddy.Controller) error {
 	cfg := httpserver.GetConfig(c)
-	root := cfg.Root
+	root, fs := cfg.Root, cfg.RootFS
 
-	exts, err := extParse(c)
+	ext, err := extParse(c)
 	if err != nil {
 		return err
 	}
 
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return Ext{
-			Next:       next,
-			Extensions: exts,
-			Root:       root,
-		}
+		ext.Next = next
+		ext.Root, ext.FileSys = root, fs
+		return ext
 	})
 
 	return nil
 }
 
 // extParse sets up an instance of extension middleware
-// from a middleware controller and returns a list of extensions.
-func extParse(c *caddy.Controller) ([]string, error) {
-	var exts []string
+// from a middleware controller and returns it with its list of
+// extensions and options for negotiation, which are
+//
+//	ext .ext... {
+//		negotiate
+//		priority .ext quality
+//	}
+func extParse(c *caddy.Controller) (Ext, error) {
+	var ext Ext
 
 	for c.Next() {
 		// At least one extension is required
 		if !c.NextArg() {
-			return exts, c.ArgErr()
+			return ext, c.ArgErr()
 		}
-		exts = append(exts, c.Val())
+		ext.Extensions = append(ext.Extensions, c.Val())
 
 		// Tack on any other extensions that may have been listed
-		exts = append(exts, c.RemainingArgs()...)
+		ext.Extensions = append(ext.Extensions, c.RemainingArgs()...)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "negotiate":
+				if c.NextArg() {
+					return ext, c.ArgErr()
+				}
+				ext.Negotiate = true
+			case "priority":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return ext, c.ArgErr()
+				}
+				q, err := strconv.ParseFloat(args[1], 64)
+				if err != nil || q < 0 || q > 1 {
+					return ext, c.Errf("Invalid ext priority '%s' (must be from 0 to 1)", args[1])
+				}
+				if ext.Priorities == nil {
+					ext.Priorities = make(map[string]float64)
+				}
+				ext.Priorities[args[0]] = q
+			default:
+				return ext, c.Errf("Unknown ext property '%s'", c.Val())
+			}
+		}
 	}
 
-	return exts, nil
+	return ext, nil
 }
@@ -50,9 +50,23 @@ func TestExtParse(t *testing.T) {
 		{`ext .html .htm .php`, false, []string{".html", ".htm", ".php"}},
 		{`ext .php .html .xml`, false, []string{".php", ".html", ".xml"}},
 		{`ext .txt .php .xml`, false, []string{".txt", ".php", ".xml"}},
+		{`ext .html .json .md {
+			negotiate
+			priority .md 0.5
+		}`, false, []string{".html", ".json", ".md"}},
+		{`ext .html {
+			priority .html 2
+		}`, true, []string{".html"}},
+		{`ext .html {
+			priority .html
+		}`, true, []string{".html"}},
+		{`ext .html {
+			unknown
+		}`, true, []string{".html"}},
 	}
 	for i, test := range tests {
-		actualExts, err := extParse(caddy.NewTestController("http", test.inputExts))
+		ext, err := extParse(caddy.NewTestController("http", test.inputExts))
+		actualExts := ext.Extensions
 
 		if err == nil && test.shouldErr {
 			t.Errorf("Test %d didn't error, but it should have", i)
@@ -73,3 +87,19 @@ func TestExtParse(t *testing.T) {
 	}
 
 }
+
+func TestExtParseNegotiate(t *testing.T) {
+	ext, err := extParse(caddy.NewTestController("http", `ext .html .json .md {
+		negotiate
+		priority .md 0.5
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ext.Negotiate {
+		t.Error("Expected negotiation to be on")
+	}
+	if len(ext.Priorities) != 1 || ext.Priorities[".md"] != 0.5 {
+		t.Errorf("Expected priority 0.5 for .md, got %v", ext.Priorities)
+	}
+}
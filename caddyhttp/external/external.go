@@ -0,0 +1,97 @@
+// Package external is middleware that hands requests to plugins
+// running as separate processes, so that handlers can be written
+// in any language and changed without recompiling Caddy. A plugin
+// that crashes or hangs fails only the requests it was handling.
+package external
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// External is middleware that invokes external plugins.
+type External struct {
+	Next    httpserver.Handler
+	Plugins []*Plugin
+}
+
+// Plugin is the configuration of one external plugin.
+type Plugin struct {
+	// Path is the base path of the requests handled.
+	Path string
+
+	// Command and Args run the plugin.
+	Command string
+	Args    []string
+
+	// Timeout limits how long the plugin may take to respond
+	// to a request, and to the handshake.
+	Timeout time.Duration
+
+	// MaxBody limits the size of request bodies passed to
+	// the plugin.
+	MaxBody int64
+
+	process *process
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (e External) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, p := range e.Plugins {
+		if httpserver.Path(r.URL.Path).Matches(p.Path) {
+			return p.serveHTTP(w, r, e.Next)
+		}
+	}
+	return e.Next.ServeHTTP(w, r)
+}
+
+func (p *Plugin) serveHTTP(w http.ResponseWriter, r *http.Request, next httpserver.Handler) (int, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, p.MaxBody))
+		if err != nil {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+	}
+
+	resp, err := p.process.Call(Message{
+		Method:     r.Method,
+		URI:        r.URL.RequestURI(),
+		Host:       r.Host,
+		Proto:      r.Proto,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header,
+		Body:       body,
+	})
+	if err == errTimeout {
+		return http.StatusGatewayTimeout, fmt.Errorf("external %s: %v", p.Command, err)
+	}
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("external %s: %v", p.Command, err)
+	}
+
+	if resp.Next {
+		for field, values := range resp.Header {
+			r.Header[http.CanonicalHeaderKey(field)] = values
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return next.ServeHTTP(w, r)
+	}
+
+	for field, values := range resp.Header {
+		w.Header()[http.CanonicalHeaderKey(field)] = values
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(resp.Body)
+	return 0, nil
+}
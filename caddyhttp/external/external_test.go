@@ -0,0 +1,185 @@
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// The test binary doubles as a plugin when this variable is set.
+const helperEnv = "CADDY_EXTERNAL_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) != "" {
+		runTestPlugin()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTestPlugin is an external plugin that answers according to
+// the request path.
+func runTestPlugin() {
+	enc := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			os.Exit(2)
+		}
+		switch {
+		case msg.Type == "handshake":
+			enc.Encode(Message{Type: "handshake", Version: ProtocolVersion, Name: "test"})
+		case msg.URI == "/hello":
+			enc.Encode(Message{Type: "response", ID: msg.ID, Status: http.StatusCreated,
+				Header: http.Header{"X-Method": {msg.Method}}, Body: append([]byte("hello "), msg.Body...)})
+		case msg.URI == "/next":
+			enc.Encode(Message{Type: "response", ID: msg.ID, Next: true, Header: http.Header{"X-Plugin": {"yes"}}})
+		case msg.URI == "/slow":
+			go func(id uint64) {
+				time.Sleep(time.Second)
+				enc.Encode(Message{Type: "response", ID: id})
+			}(msg.ID)
+		case msg.URI == "/block":
+			// stop reading requests
+			time.Sleep(time.Hour)
+		case msg.URI == "/crash":
+			os.Exit(1)
+		}
+	}
+}
+
+func newTestExternal(t *testing.T, timeout time.Duration) (External, *process) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(helperEnv, "1")
+	proc := newProcess(exe, nil, timeout)
+	if err := proc.Start(); err != nil {
+		t.Fatalf("Expected plugin to start, got: %v", err)
+	}
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Write([]byte("next " + r.Header.Get("X-Plugin")))
+		return 0, nil
+	})
+	return External{
+		Next:    next,
+		Plugins: []*Plugin{{Path: "/", Command: exe, MaxBody: defaultMaxBody, process: proc}},
+	}, proc
+}
+
+func TestExternal(t *testing.T) {
+	defer os.Unsetenv(helperEnv)
+	ext, proc := newTestExternal(t, 200*time.Millisecond)
+	defer proc.Stop()
+
+	for i, test := range []struct {
+		method      string
+		path        string
+		body        string
+		expectCode  int
+		expectBody  string
+		expectError bool
+	}{
+		{"POST", "/hello", "world", http.StatusCreated, "hello world", false},
+		{"GET", "/next", "", http.StatusOK, "next yes", false},
+		{"GET", "/slow", "", http.StatusGatewayTimeout, "", true},
+		{"GET", "/crash", "", http.StatusBadGateway, "", true},
+		// restarts are delayed after a crash
+		{"GET", "/hello", "", http.StatusBadGateway, "", true},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		rec := httptest.NewRecorder()
+		code, err := ext.ServeHTTP(rec, req)
+		if test.expectError != (err != nil) {
+			t.Errorf("Test %d: Expected error %t, got: %v", i, test.expectError, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, code)
+		}
+		if rec.Body.String() != test.expectBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectBody, rec.Body.String())
+		}
+	}
+
+	if proc.name != "test" {
+		t.Errorf("Expected name from handshake, got %s", proc.name)
+	}
+
+	// once the delay is over, the plugin is restarted
+	proc.mu.Lock()
+	proc.restartAt = time.Now()
+	proc.mu.Unlock()
+	rec := httptest.NewRecorder()
+	if _, err := ext.ServeHTTP(rec, httptest.NewRequest("GET", "/hello", nil)); err != nil {
+		t.Errorf("Expected restarted plugin to respond, got: %v", err)
+	}
+	if rec.Body.String() != "hello " {
+		t.Errorf("Expected body from restarted plugin, got %q", rec.Body.String())
+	}
+}
+
+func TestExternalTimeouts(t *testing.T) {
+	defer os.Unsetenv(helperEnv)
+	ext, proc := newTestExternal(t, 200*time.Millisecond)
+	defer proc.Stop()
+
+	for i, test := range []struct {
+		path       string
+		body       string
+		expectCode int
+	}{
+		{"/block", "", http.StatusGatewayTimeout},
+		// a plugin that was killed for timing out is restarted
+		// straight away
+		{"/hello", "", http.StatusCreated},
+		{"/block", "", http.StatusGatewayTimeout},
+		{"/hello", "", http.StatusCreated},
+	} {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		code, _ := ext.ServeHTTP(rec, httptest.NewRequest("POST", test.path, strings.NewReader(test.body)))
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectCode, code)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Test %d: Expected the timeout to cover the whole request, took %v", i, elapsed)
+		}
+	}
+
+	// a plugin that doesn't read its requests holds up no others
+	done := make(chan int, 3)
+	serve := func(path, body string) {
+		code, _ := ext.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, strings.NewReader(body)))
+		done <- code
+	}
+	go serve("/block", "")
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		go serve("/hello", strings.Repeat("x", 1<<20))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case code := <-done:
+			if code != http.StatusGatewayTimeout && code != http.StatusBadGateway {
+				t.Errorf("Expected requests to a plugin that doesn't read them to fail, got %d", code)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected requests to a plugin that doesn't read them to time out")
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	// errTimeout is returned when a plugin takes too long
+	// to respond.
+	errTimeout = errors.New("plugin timed out")
+
+	// errUnavailable is returned when a plugin isn't running
+	// and may not be restarted yet.
+	errUnavailable = errors.New("plugin unavailable")
+)
+
+// Delays before restarting a plugin that failed or crashed.
+const (
+	minRestartDelay = 1 * time.Second
+	maxRestartDelay = 1 * time.Minute
+)
+
+// stopTimeout is how long a plugin has to exit once its
+// standard input is closed before it is killed.
+const stopTimeout = 5 * time.Second
+
+// process runs a plugin and exchanges messages with it. If the
+// plugin exits, requests in flight fail and it is restarted on
+// the next request, after a delay that grows while it keeps
+// failing; if it doesn't respond in time, it is killed and
+// restarted on the next request straight away. Caddy itself is
+// unaffected.
+type process struct {
+	command string
+	args    []string
+	timeout time.Duration
+
+	// wmu serializes writes to the plugin, which may block if it
+	// doesn't read them, so they are not made holding mu
+	wmu sync.Mutex
+
+	mu           sync.Mutex
+	name         string
+	cmd          *exec.Cmd
+	stdin        io.WriteCloser
+	enc          *json.Encoder
+	exited       chan struct{}
+	starting     chan struct{} // closed once a restart in progress is done
+	pending      map[uint64]call
+	lastID       uint64
+	stopped      bool
+	restartAt    time.Time
+	restartDelay time.Duration
+}
+
+// call is a request in flight to the plugin run by cmd.
+type call struct {
+	cmd *exec.Cmd
+	ch  chan Message
+}
+
+func newProcess(command string, args []string, timeout time.Duration) *process {
+	return &process{
+		command: command,
+		args:    args,
+		timeout: timeout,
+		name:    command,
+		pending: make(map[uint64]call),
+	}
+}
+
+// Start starts the plugin; unlike the restarts on later
+// requests, a failure to start is returned.
+func (p *process) Start() error {
+	p.mu.Lock()
+	p.stopped = false
+	p.mu.Unlock()
+	return p.start(time.After(p.timeout))
+}
+
+// start starts the plugin and performs the handshake, which must be
+// done before timeout, and makes it the running plugin; p.mu must
+// not be held.
+func (p *process) start(timeout <-chan time.Time) error {
+	cmd := exec.Command(p.command, p.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting plugin %s: %v", p.command, err)
+	}
+
+	enc := json.NewEncoder(stdin)
+	dec := json.NewDecoder(bufio.NewReader(stdout))
+	type result struct {
+		reply Message
+		err   error
+	}
+	handshake := make(chan result, 1)
+	go func() {
+		var res result
+		res.err = enc.Encode(Message{Type: "handshake", Version: ProtocolVersion})
+		if res.err == nil {
+			res.err = dec.Decode(&res.reply)
+		}
+		handshake <- res
+	}()
+	var name string
+	select {
+	case res := <-handshake:
+		err = res.err
+		if err == nil && (res.reply.Type != "handshake" || res.reply.Version != ProtocolVersion) {
+			err = fmt.Errorf("unsupported handshake: type %q, version %d", res.reply.Type, res.reply.Version)
+		}
+		name = res.reply.Name
+	case <-timeout:
+		err = errTimeout
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("handshake with plugin %s: %v", p.command, err)
+	}
+
+	exited := make(chan struct{})
+	p.mu.Lock()
+	if name != "" {
+		p.name = name
+	}
+	name = p.name
+	p.cmd, p.stdin, p.enc, p.exited = cmd, stdin, enc, exited
+	p.mu.Unlock()
+	go logStderr(name, stderr)
+	go p.read(name, cmd, dec, exited)
+	return nil
+}
+
+// logStderr logs each line the plugin writes to standard error.
+func logStderr(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Printf("[INFO] external %s: %s", name, scanner.Text())
+	}
+}
+
+// read dispatches the responses from the plugin run by cmd until it
+// exits.
+func (p *process) read(name string, cmd *exec.Cmd, dec *json.Decoder, exited chan struct{}) {
+	var err error
+	for {
+		var msg Message
+		if err = dec.Decode(&msg); err != nil {
+			break
+		}
+		if msg.Type != "response" {
+			continue
+		}
+		p.mu.Lock()
+		c, ok := p.pending[msg.ID]
+		if ok && c.cmd == cmd {
+			delete(p.pending, msg.ID)
+			c.ch <- msg
+		}
+		p.mu.Unlock()
+	}
+	waitErr := cmd.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == cmd {
+		if !p.stopped {
+			if waitErr == nil && err != io.EOF {
+				waitErr = err
+			}
+			log.Printf("[ERROR] external %s: plugin exited: %v", name, waitErr)
+			p.backOff()
+		}
+		p.cmd, p.stdin, p.enc = nil, nil, nil
+	}
+	for id, c := range p.pending {
+		if c.cmd == cmd {
+			close(c.ch)
+			delete(p.pending, id)
+		}
+	}
+	close(exited)
+}
+
+// Call sends req to the plugin and waits for its response. The
+// timeout of the plugin applies to all of it, restarting the plugin
+// if need be included.
+func (p *process) Call(req Message) (Message, error) {
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	p.mu.Lock()
+	for p.cmd == nil {
+		if starting := p.starting; starting != nil {
+			// another request is restarting it
+			p.mu.Unlock()
+			select {
+			case <-starting:
+			case <-timer.C:
+				return Message{}, errTimeout
+			}
+			p.mu.Lock()
+			continue
+		}
+		if p.stopped || time.Now().Before(p.restartAt) {
+			p.mu.Unlock()
+			return Message{}, errUnavailable
+		}
+		starting := make(chan struct{})
+		p.starting = starting
+		p.mu.Unlock()
+		err := p.start(timer.C)
+		p.mu.Lock()
+		p.starting = nil
+		close(starting)
+		if err != nil {
+			p.backOff()
+			p.mu.Unlock()
+			return Message{}, err
+		}
+		log.Printf("[INFO] external %s: plugin restarted", p.name)
+	}
+	p.lastID++
+	req.Type, req.ID = "request", p.lastID
+	ch := make(chan Message, 1)
+	name, cmd, enc := p.name, p.cmd, p.enc
+	p.pending[req.ID] = call{cmd: cmd, ch: ch}
+	p.mu.Unlock()
+
+	sent := make(chan error, 1)
+	go func() {
+		p.wmu.Lock()
+		defer p.wmu.Unlock()
+		sent <- enc.Encode(req)
+	}()
+	for {
+		select {
+		case err := <-sent:
+			if err != nil {
+				p.forget(req.ID)
+				return Message{}, err
+			}
+			sent = nil
+		case resp, ok := <-ch:
+			if !ok {
+				return Message{}, fmt.Errorf("plugin %s exited", name)
+			}
+			p.mu.Lock()
+			p.restartDelay = 0
+			p.mu.Unlock()
+			return resp, nil
+		case <-timer.C:
+			p.forget(req.ID)
+			p.kill(cmd)
+			return Message{}, errTimeout
+		}
+	}
+}
+
+// kill kills the plugin run by cmd, if it is still the running one,
+// so that it is restarted on the next request.
+func (p *process) kill(cmd *exec.Cmd) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != cmd || p.stopped {
+		return
+	}
+	log.Printf("[ERROR] external %s: plugin timed out; killing it", p.name)
+	cmd.Process.Kill()
+	p.cmd, p.stdin, p.enc = nil, nil, nil
+}
+
+// backOff delays the next restart; p.mu must be held.
+func (p *process) backOff() {
+	if p.restartDelay < minRestartDelay {
+		p.restartDelay = minRestartDelay
+	} else if p.restartDelay *= 2; p.restartDelay > maxRestartDelay {
+		p.restartDelay = maxRestartDelay
+	}
+	p.restartAt = time.Now().Add(p.restartDelay)
+}
+
+func (p *process) forget(id uint64) {
+	p.mu.Lock()
+	delete(p.pending, id)
+	p.mu.Unlock()
+}
+
+// Stop stops the plugin: it closes its standard input, which
+// should make it exit, and kills it if it doesn't.
+func (p *process) Stop() error {
+	p.mu.Lock()
+	p.stopped = true
+	cmd, stdin, exited := p.cmd, p.stdin, p.exited
+	p.mu.Unlock()
+	if cmd == nil {
+		return nil
+	}
+	stdin.Close()
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		cmd.Process.Kill()
+		<-exited
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package external
+
+import "net/http"
+
+// ProtocolVersion is the version of the protocol spoken with
+// plugins, which is exchanged in the handshake.
+const ProtocolVersion = 1
+
+// Message is the unit of the protocol. Messages are encoded as
+// JSON, one per line, and sent to the plugin on its standard
+// input and read from its standard output; its standard error is
+// logged. Caddy first sends a handshake, which the plugin must
+// answer with a handshake of the same version; then it sends a
+// request for each HTTP request to handle, to which the plugin
+// answers with a response with the same ID, in any order.
+type Message struct {
+	// Type is "handshake", "request" or "response".
+	Type string `json:"type"`
+
+	// Version and Name are set in handshakes; Name is the
+	// name of the plugin, for logs.
+	Version int    `json:"version,omitempty"`
+	Name    string `json:"name,omitempty"`
+
+	// ID matches responses to requests.
+	ID uint64 `json:"id,omitempty"`
+
+	// Method, URI, Host, Proto and RemoteAddr describe the
+	// HTTP request in requests.
+	Method     string `json:"method,omitempty"`
+	URI        string `json:"uri,omitempty"`
+	Host       string `json:"host,omitempty"`
+	Proto      string `json:"proto,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// Status is the status code of the HTTP response in
+	// responses.
+	Status int `json:"status,omitempty"`
+
+	// Header is the request header in requests and the
+	// response header in responses, unless Next is set.
+	Header http.Header `json:"header,omitempty"`
+
+	// Body is the request or response body, base64-encoded.
+	Body []byte `json:"body,omitempty"`
+
+	// Next, in a response, passes the request on to the next
+	// handler instead, with the headers in Header set on it.
+	Next bool `json:"next,omitempty"`
+}
@@ -0,0 +1,111 @@
+package external
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("external", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new External middleware instance.
+func setup(c *caddy.Controller) error {
+	plugins, err := externalParse(c)
+	if err != nil {
+		return err
+	}
+
+	if len(plugins) > 0 {
+		// plugins are restarted as needed, also in a sandbox
+		caddy.AllowExec()
+	}
+	for _, p := range plugins {
+		p.process = newProcess(p.Command, p.Args, p.Timeout)
+		c.OnStartup(p.process.Start)
+		c.OnShutdown(p.process.Stop)
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return External{Next: next, Plugins: plugins}
+	})
+
+	return nil
+}
+
+// externalParse parses the external directives:
+//
+//	external <path> [<command> [<args...>]] {
+//		command  <command> [<args...>]
+//		timeout  <duration>
+//		max_body <bytes>
+//	}
+func externalParse(c *caddy.Controller) ([]*Plugin, error) {
+	var plugins []*Plugin
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 1 {
+			return plugins, c.ArgErr()
+		}
+		p := &Plugin{Path: args[0], Timeout: defaultTimeout, MaxBody: defaultMaxBody}
+		if len(args) > 1 {
+			p.Command, p.Args = args[1], args[2:]
+		}
+
+		for c.NextBlock() {
+			prop := c.Val()
+			vals := c.RemainingArgs()
+			if len(vals) == 0 {
+				return plugins, c.ArgErr()
+			}
+			switch prop {
+			case "command":
+				p.Command, p.Args = vals[0], vals[1:]
+			case "timeout":
+				if len(vals) != 1 {
+					return plugins, c.ArgErr()
+				}
+				d, err := time.ParseDuration(vals[0])
+				if err != nil || d <= 0 {
+					return plugins, c.Errf("Invalid timeout '%s'", vals[0])
+				}
+				p.Timeout = d
+			case "max_body":
+				if len(vals) != 1 {
+					return plugins, c.ArgErr()
+				}
+				size, err := strconv.ParseInt(vals[0], 10, 64)
+				if err != nil || size <= 0 {
+					return plugins, c.Errf("Invalid max_body '%s'", vals[0])
+				}
+				p.MaxBody = size
+			default:
+				return plugins, c.Errf("Unknown external property '%s'", prop)
+			}
+		}
+
+		if p.Command == "" {
+			return plugins, c.Err("external: no command given")
+		}
+		for _, other := range plugins {
+			if other.Path == p.Path {
+				return plugins, c.Errf("Duplicate external plugin for %s", p.Path)
+			}
+		}
+		plugins = append(plugins, p)
+	}
+
+	return plugins, nil
+}
+
+const (
+	defaultTimeout = 10 * time.Second
+	defaultMaxBody = 10 << 20
+)
@@ -0,0 +1,88 @@
+package external
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `external /api plugin`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	if _, ok := handler.(External); !ok {
+		t.Fatalf("Expected handler to be type External, got: %#v", handler)
+	}
+}
+
+func TestExternalParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Plugin
+	}{
+		{`external /api plugin`, false, []Plugin{
+			{Path: "/api", Command: "plugin", Args: []string{}, Timeout: defaultTimeout, MaxBody: defaultMaxBody},
+		}},
+		{`external /api python3 handler.py --verbose`, false, []Plugin{
+			{Path: "/api", Command: "python3", Args: []string{"handler.py", "--verbose"}, Timeout: defaultTimeout, MaxBody: defaultMaxBody},
+		}},
+		{`external / {
+			command  node plugin.js
+			timeout  2s
+			max_body 1024
+		}`, false, []Plugin{
+			{Path: "/", Command: "node", Args: []string{"plugin.js"}, Timeout: 2 * time.Second, MaxBody: 1024},
+		}},
+		{`external /a plugin
+		  external /b plugin`, false, []Plugin{
+			{Path: "/a", Command: "plugin", Args: []string{}, Timeout: defaultTimeout, MaxBody: defaultMaxBody},
+			{Path: "/b", Command: "plugin", Args: []string{}, Timeout: defaultTimeout, MaxBody: defaultMaxBody},
+		}},
+		{`external`, true, nil},
+		{`external /api`, true, nil},
+		{`external /api plugin {
+			timeout 0s
+		}`, true, nil},
+		{`external /api plugin {
+			max_body lots
+		}`, true, nil},
+		{`external /api plugin {
+			restart always
+		}`, true, nil},
+		{`external /a plugin
+		  external /a plugin`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := externalParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Errorf("Test %d: Expected %d plugins, got %d", i, len(test.expected), len(actual))
+			continue
+		}
+		for j, p := range actual {
+			if !reflect.DeepEqual(*p, test.expected[j]) {
+				t.Errorf("Test %d, plugin %d: Expected %+v, got %+v", i, j, test.expected[j], *p)
+			}
+		}
+	}
+}
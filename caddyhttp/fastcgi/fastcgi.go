@@ -83,6 +83,11 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 			}
 		}
 
+		// Scripts hidden from the site are never run.
+		if hfs, ok := h.FileSys.(httpserver.HiddenFS); ok && hfs.IsHidden(fpath[:rule.splitPos(fpath)+len(rule.SplitPath)]) {
+			return http.StatusNotFound, nil
+		}
+
 		// These criteria work well in this order for PHP sites
 		if !h.exists(fpath) || fpath[len(fpath)-1] == '/' || strings.HasSuffix(fpath, rule.Ext) {
 
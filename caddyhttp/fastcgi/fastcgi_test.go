@@ -56,6 +56,25 @@ func TestServeHTTP(t *testing.T) {
 	}
 }
 
+func TestServeHTTPHidden(t *testing.T) {
+	// the backend is never reached, so there is none
+	site := httpserver.SiteConfig{Root: ".", HideDotfiles: true, HideVCS: true}
+	handler := Handler{
+		Rules:   []Rule{{Path: "/", Ext: ".php", SplitPath: ".php", balancer: address("127.0.0.1:1")}},
+		FileSys: site.HideFrom(http.Dir(".")),
+	}
+	for i, target := range []string{
+		"/.git/hooks/shell.php",
+		"/vendor/.hidden/x.php/info",
+		"/a/../.GIT/x.php",
+	} {
+		status, err := handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+		if status != http.StatusNotFound || err != nil {
+			t.Errorf("Test %d: expected %s to be not found, got %d, %v", i, target, status, err)
+		}
+	}
+}
+
 func TestRuleParseAddress(t *testing.T) {
 	getClientTestTable := []struct {
 		rule            *Rule
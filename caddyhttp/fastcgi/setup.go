@@ -31,7 +31,7 @@ func setup(c *caddy.Controller) error {
 			Next:            next,
 			Rules:           rules,
 			Root:            cfg.Root,
-			FileSys:         http.Dir(cfg.Root),
+			FileSys:         cfg.HideFrom(http.Dir(cfg.Root)),
 			SoftwareName:    caddy.AppName,
 			SoftwareVersion: caddy.AppVersion,
 			ServerName:      cfg.Addr.Host,
@@ -46,6 +46,9 @@ func fastcgiParse(c *caddy.Controller) ([]Rule, error) {
 	var rules []Rule
 
 	cfg := httpserver.GetConfig(c)
+	if cfg.RootFS != nil {
+		return nil, c.Err("fastcgi needs a site root on disk")
+	}
 	absRoot, err := filepath.Abs(cfg.Root)
 	if err != nil {
 		return nil, err
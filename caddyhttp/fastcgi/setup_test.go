@@ -2,6 +2,7 @@ package fastcgi
 
 import (
 	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -120,3 +121,11 @@ func TestFastcgiParse(t *testing.T) {
 	}
 
 }
+
+func TestSetupArchiveRoot(t *testing.T) {
+	c := caddy.NewTestController("http", `php / 127.0.0.1:9000`)
+	httpserver.GetConfig(c).RootFS = http.Dir(".")
+	if err := setup(c); err == nil {
+		t.Error("Expected an error when the root is not on disk")
+	}
+}
@@ -0,0 +1,453 @@
+// Package forms implements middleware that receives the forms of
+// static sites: it validates their fields, turns away spam with a
+// honeypot field, a captcha and rate limits, then sends them on by
+// email or to a webhook, so that a contact form doesn't need an
+// application behind Caddy.
+package forms
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/sessions"
+)
+
+// sendTimeout limits how long a submission may take to send.
+const sendTimeout = 10 * time.Second
+
+// Forms is middleware that receives forms.
+type Forms struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Rule is the path that a form is posted to, how its submissions
+// are checked and where they are sent.
+type Rule struct {
+	Path string
+
+	// Fields, if not empty, are the fields of the form; others
+	// are not sent on.
+	Fields []Field
+
+	// Honeypot is the name of a field that people leave empty,
+	// since it's hidden from them, but spam bots fill in; their
+	// submissions seem to succeed, but are dropped.
+	Honeypot string
+
+	Captcha *Captcha
+	Limit   *RateLimit
+
+	// MaxBody is the largest submission accepted.
+	MaxBody int64
+
+	// CSRF is whether submissions must carry the CSRF token of
+	// the session of the user, which middleware such as oidc
+	// must have loaded, in a header or the csrf_token field.
+	CSRF bool
+
+	// Mail, if not nil, is where submissions are emailed.
+	Mail *Mail
+
+	// WebhookURL, if not empty, is where submissions are posted,
+	// as JSON unless Template makes them into something else of
+	// WebhookType.
+	WebhookURL  string
+	WebhookType string
+
+	// Template, if not nil, makes the body of the email or
+	// webhook from the Submission.
+	Template *template.Template
+
+	// Redirect, if not empty, is where the client is sent after
+	// submitting the form.
+	Redirect string
+}
+
+// Field is a field of a form, and what its value must be like.
+type Field struct {
+	Name     string
+	Required bool
+	Email    bool // whether it must be an email address
+	Max      int  // characters, if not 0
+}
+
+// Captcha is the verification of the response to a captcha.
+type Captcha struct {
+	Field     string // of the response to the captcha
+	Secret    string
+	VerifyURL string
+}
+
+// Mail is how submissions are emailed.
+type Mail struct {
+	Addr     string // of the SMTP server, as host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+	Subject  *template.Template
+
+	// ReplyTo, if not empty, is the field with the address of
+	// the sender, to which replies go.
+	ReplyTo string
+}
+
+// Submission is a valid submission of a form, the data of the
+// templates of its email or webhook.
+type Submission struct {
+	Path   string            `json:"path"`
+	Fields map[string]string `json:"fields"` // the first value of each field
+	Values url.Values        `json:"-"`
+	IP     string            `json:"ip"`
+	Time   time.Time         `json:"time"`
+}
+
+// sendMail sends email; it is a variable for tests.
+var sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	return sendMailTimeout(addr, a, from, to, msg, sendTimeout)
+}
+
+// sendMailTimeout is smtp.SendMail, except that it gives up once
+// timeout has passed.
+func sendMailTimeout(addr string, a smtp.Auth, from string, to []string, msg []byte, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (f Forms) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range f.Rules {
+		if httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			return rule.serve(w, r)
+		}
+	}
+	return f.Next.ServeHTTP(w, r)
+}
+
+// serve receives a submission of the form of the rule.
+func (rule *Rule) serve(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return http.StatusMethodNotAllowed, nil
+	}
+	ip := httpserver.ClientIP(r)
+	if rule.Limit != nil && !rule.Limit.allow(ip, time.Now()) {
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", rule.Limit.Window.Seconds()))
+		return http.StatusTooManyRequests, fmt.Errorf("form %s: too many submissions from %s", rule.Path, ip)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, rule.MaxBody)
+	if err := r.ParseMultipartForm(rule.MaxBody); err != nil && err != http.ErrNotMultipart {
+		return http.StatusBadRequest, fmt.Errorf("form %s: %v", rule.Path, err)
+	}
+
+	if rule.CSRF {
+		token := r.Header.Get(sessions.CSRFHeader)
+		if token == "" {
+			token = r.PostForm.Get(sessions.CSRFField)
+		}
+		if s, ok := sessions.FromContext(r.Context()); !ok || !s.ValidToken(token) {
+			return http.StatusForbidden, fmt.Errorf("form %s: missing or invalid CSRF token from %s", rule.Path, ip)
+		}
+	}
+	if rule.Honeypot != "" && r.PostForm.Get(rule.Honeypot) != "" {
+		log.Printf("[INFO] Form %s: dropped a submission from %s that filled in the honeypot", rule.Path, ip)
+		return rule.done(w, r)
+	}
+	if rule.Captcha != nil {
+		if err := rule.Captcha.verify(r.PostForm.Get(rule.Captcha.Field), ip); err != nil {
+			return http.StatusForbidden, fmt.Errorf("form %s: captcha: %v", rule.Path, err)
+		}
+	}
+	sub, err := rule.submission(r.PostForm, ip)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("form %s: %v", rule.Path, err)
+	}
+
+	if rule.Mail != nil {
+		if err := rule.email(sub); err != nil {
+			return http.StatusBadGateway, fmt.Errorf("form %s: emailing: %v", rule.Path, err)
+		}
+	}
+	if rule.WebhookURL != "" {
+		if err := rule.post(sub); err != nil {
+			return http.StatusBadGateway, fmt.Errorf("form %s: webhook: %v", rule.Path, err)
+		}
+	}
+	return rule.done(w, r)
+}
+
+// done responds to a successful submission.
+func (rule *Rule) done(w http.ResponseWriter, r *http.Request) (int, error) {
+	if rule.Redirect != "" {
+		http.Redirect(w, r, rule.Redirect, http.StatusSeeOther)
+		return http.StatusSeeOther, nil
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+// submission returns the submission of the values of the form, or
+// an error saying what is wrong with them.
+func (rule *Rule) submission(values url.Values, ip string) (Submission, error) {
+	sub := Submission{Path: rule.Path, Fields: make(map[string]string), Values: url.Values{}, IP: ip, Time: time.Now()}
+	if len(rule.Fields) == 0 {
+		for name, vals := range values {
+			if name == rule.Honeypot || rule.Captcha != nil && name == rule.Captcha.Field ||
+				rule.CSRF && name == sessions.CSRFField {
+				continue
+			}
+			sub.Values[name] = vals
+			sub.Fields[name] = vals[0]
+		}
+		return sub, nil
+	}
+	var problems []string
+	for _, field := range rule.Fields {
+		value := strings.TrimSpace(values.Get(field.Name))
+		switch {
+		case value == "":
+			if field.Required {
+				problems = append(problems, field.Name+" is required")
+			}
+			continue
+		case field.Max > 0 && utf8.RuneCountInString(value) > field.Max:
+			problems = append(problems, fmt.Sprintf("%s is longer than %d characters", field.Name, field.Max))
+		case field.Email && !isEmail(value):
+			problems = append(problems, field.Name+" is not an email address")
+		}
+		sub.Values[field.Name] = values[field.Name]
+		sub.Fields[field.Name] = value
+	}
+	if len(problems) > 0 {
+		return sub, errors.New(strings.Join(problems, "; "))
+	}
+	return sub, nil
+}
+
+// isEmail returns whether s is a bare email address.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// body returns the body of the email, if forMail, or webhook of
+// sub: without a template, the fields as text or JSON.
+func (rule *Rule) body(sub Submission, forMail bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if rule.Template != nil {
+		err := rule.Template.Execute(&buf, sub)
+		return buf.Bytes(), err
+	}
+	if !forMail {
+		return json.Marshal(sub)
+	}
+	var names []string
+	for name := range sub.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\n", name, sub.Fields[name])
+	}
+	return buf.Bytes(), nil
+}
+
+// email emails sub.
+func (rule *Rule) email(sub Submission) error {
+	m := rule.Mail
+	var subject bytes.Buffer
+	if err := m.Subject.Execute(&subject, sub); err != nil {
+		return err
+	}
+	body, err := rule.body(sub, true)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.To, ", "))
+	if replyTo := sub.Fields[m.ReplyTo]; m.ReplyTo != "" && isEmail(replyTo) {
+		fmt.Fprintf(&msg, "Reply-To: %s\r\n", replyTo)
+	}
+	// a header can't be injected through the subject
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue.Replace(subject.String()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", sub.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.Write(bytes.Replace(body, []byte("\n"), []byte("\r\n"), -1))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return sendMail(m.Addr, auth, m.From, m.To, msg.Bytes())
+}
+
+// headerValue makes a string safe to be the value of a header.
+var headerValue = strings.NewReplacer("\r", " ", "\n", " ")
+
+// post posts sub to the webhook.
+func (rule *Rule) post(sub Submission) error {
+	body, err := rule.body(sub, false)
+	if err != nil {
+		return err
+	}
+	contentType := rule.WebhookType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	client := &http.Client{Timeout: sendTimeout}
+	resp, err := client.Post(rule.WebhookURL, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", rule.WebhookURL, resp.Status)
+	}
+	return nil
+}
+
+// verify verifies response, the response of the client at ip to the
+// captcha.
+func (c *Captcha) verify(response, ip string) error {
+	if response == "" {
+		return errors.New("no response")
+	}
+	client := &http.Client{Timeout: sendTimeout}
+	resp, err := client.PostForm(c.VerifyURL, url.Values{
+		"secret":   {c.Secret},
+		"response": {response},
+		"remoteip": {ip},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("verifying: %v", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("not solved %v", result.ErrorCodes)
+	}
+	return nil
+}
+
+// RateLimit limits how many forms each client may submit in a
+// window of time.
+type RateLimit struct {
+	Submissions int
+	Window      time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*window
+}
+
+// window counts the submissions of a client since it started.
+type window struct {
+	start time.Time
+	count int
+}
+
+// maxClients limits the number of clients of which submissions are
+// counted, so that many clients can't exhaust memory.
+const maxClients = 10000
+
+// allow returns whether the client at ip may submit a form at now,
+// counting it if so. Once the submissions of maxClients clients are
+// counted in their windows, other clients are refused until one ends,
+// rather than forgetting what clients submitted.
+func (l *RateLimit) allow(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clients == nil {
+		l.clients = make(map[string]*window)
+	}
+	win, ok := l.clients[ip]
+	if !ok || now.Sub(win.start) >= l.Window {
+		if len(l.clients) >= maxClients {
+			for client, win := range l.clients {
+				if now.Sub(win.start) >= l.Window {
+					delete(l.clients, client)
+				}
+			}
+			if len(l.clients) >= maxClients {
+				return false
+			}
+		}
+		win = &window{start: now}
+		l.clients[ip] = win
+	}
+	if win.count >= l.Submissions {
+		return false
+	}
+	win.count++
+	return true
+}
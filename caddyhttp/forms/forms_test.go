@@ -0,0 +1,235 @@
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/sessions"
+)
+
+func TestForms(t *testing.T) {
+	var sent []string
+	defer func(send func(string, smtp.Auth, string, []string, []byte) error) { sendMail = send }(sendMail)
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, fmt.Sprintf("%s %s %v\n%s", addr, from, to, msg))
+		return nil
+	}
+
+	var posted []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		posted = append(posted, r.Header.Get("Content-Type")+" "+string(body))
+	}))
+	defer hook.Close()
+	captcha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"success": %t}`, r.FormValue("secret") == "shh" && r.FormValue("response") == "solved")
+	}))
+	defer captcha.Close()
+
+	f := Forms{
+		Next: httpserver.EmptyNext,
+		Rules: []*Rule{
+			{
+				Path: "/contact",
+				Fields: []Field{
+					{Name: "name", Required: true, Max: 10},
+					{Name: "email", Required: true, Email: true},
+					{Name: "message"},
+				},
+				Honeypot: "website",
+				MaxBody:  1024,
+				Mail: &Mail{
+					Addr: "localhost:25", From: "forms@example.com", To: []string{"me@example.com"},
+					Subject: template.Must(template.New("").Parse("From {{.Fields.name}}")), ReplyTo: "email",
+				},
+				Redirect: "/thanks",
+			},
+			{
+				Path:       "/signup",
+				Captcha:    &Captcha{Field: "h-captcha-response", Secret: "shh", VerifyURL: captcha.URL},
+				Limit:      &RateLimit{Submissions: 2, Window: time.Minute},
+				MaxBody:    1024,
+				WebhookURL: hook.URL,
+			},
+		},
+	}
+
+	for i, test := range []struct {
+		method, path string
+		form         url.Values
+		expectStatus int
+		expectSent   string
+		expectPosted string
+	}{
+		{"POST", "/contact", url.Values{"name": {"Ann"}, "email": {"ann@example.com"}, "message": {"Hi\nthere"}, "extra": {"x"}},
+			http.StatusSeeOther, "Reply-To: ann@example.com\r\nSubject: From Ann\r\n", ""},
+		{"POST", "/contact", url.Values{"name": {"Ann\r\nBcc: x@example.com"}, "email": {"ann@example.com"}},
+			http.StatusBadRequest, "", ""},
+		{"POST", "/contact", url.Values{"name": {"Bob\nBcc"}, "email": {"bob@example.com"}},
+			http.StatusSeeOther, "Subject: From Bob Bcc\r\n", ""},
+		{"POST", "/contact", url.Values{"email": {"ann@example.com"}}, http.StatusBadRequest, "", ""},
+		{"POST", "/contact", url.Values{"name": {"Ann"}, "email": {"Ann <ann@example.com>"}}, http.StatusBadRequest, "", ""},
+		{"POST", "/contact", url.Values{"name": {"Bot"}, "email": {"bot@example.com"}, "website": {"spam"}},
+			http.StatusSeeOther, "", ""},
+		{"GET", "/contact", nil, http.StatusMethodNotAllowed, "", ""},
+		{"POST", "/signup", url.Values{"plan": {"pro"}, "h-captcha-response": {"solved"}},
+			http.StatusNoContent, "", `application/json {"path":"/signup","fields":{"plan":"pro"}`},
+		{"POST", "/signup", url.Values{"plan": {"pro"}, "h-captcha-response": {"robot"}}, http.StatusForbidden, "", ""},
+		{"POST", "/signup", url.Values{"plan": {"pro"}}, http.StatusTooManyRequests, "", ""},
+		{"POST", "/other", url.Values{"plan": {"pro"}}, http.StatusOK, "", ""},
+	} {
+		sent, posted = nil, nil
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		status, _ := f.ServeHTTP(w, r)
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if test.expectSent == "" && len(sent) > 0 || test.expectSent != "" && (len(sent) != 1 || !strings.Contains(sent[0], test.expectSent)) {
+			t.Errorf("Test %d: Expected email containing %q, got %q", i, test.expectSent, sent)
+		}
+		if test.expectPosted == "" && len(posted) > 0 || test.expectPosted != "" && (len(posted) != 1 || !strings.HasPrefix(posted[0], test.expectPosted)) {
+			t.Errorf("Test %d: Expected webhook starting %q, got %q", i, test.expectPosted, posted)
+		}
+	}
+}
+
+func TestFormsCSRF(t *testing.T) {
+	var posted []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		posted = append(posted, string(body))
+	}))
+	defer hook.Close()
+
+	f := Forms{
+		Next:  httpserver.EmptyNext,
+		Rules: []*Rule{{Path: "/order", CSRF: true, MaxBody: 1024, WebhookURL: hook.URL}},
+	}
+	session := &sessions.Session{CSRF: "token"}
+	for i, test := range []struct {
+		session      bool
+		header       string
+		form         url.Values
+		expectStatus int
+	}{
+		{true, "", url.Values{"item": {"a"}, "csrf_token": {"token"}}, http.StatusNoContent},
+		{true, "token", url.Values{"item": {"a"}}, http.StatusNoContent},
+		{true, "", url.Values{"item": {"a"}, "csrf_token": {"wrong"}}, http.StatusForbidden},
+		{true, "", url.Values{"item": {"a"}}, http.StatusForbidden},
+		{false, "", url.Values{"item": {"a"}, "csrf_token": {"token"}}, http.StatusForbidden},
+	} {
+		posted = nil
+		r := httptest.NewRequest("POST", "/order", strings.NewReader(test.form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.header != "" {
+			r.Header.Set(sessions.CSRFHeader, test.header)
+		}
+		if test.session {
+			r = r.WithContext(sessions.NewContext(r.Context(), session))
+		}
+		status, _ := f.ServeHTTP(httptest.NewRecorder(), r)
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if status == http.StatusNoContent && (len(posted) != 1 || strings.Contains(posted[0], "token")) {
+			t.Errorf("Test %d: Expected submission without the CSRF token, got %q", i, posted)
+		}
+	}
+}
+
+func TestFormsBody(t *testing.T) {
+	rule := &Rule{Mail: &Mail{}}
+	sub := Submission{Path: "/contact", Fields: map[string]string{"name": "Ann", "email": "ann@example.com"}}
+	if body, _ := rule.body(sub, true); string(body) != "email: ann@example.com\nname: Ann\n" {
+		t.Errorf("Expected the fields as text, got %q", body)
+	}
+	body, _ := rule.body(sub, false)
+	var decoded Submission
+	if err := json.Unmarshal(body, &decoded); err != nil || decoded.Fields["name"] != "Ann" {
+		t.Errorf("Expected the submission as JSON, got %s (%v)", body, err)
+	}
+	rule.Template = template.Must(template.New("").Parse(`{"text": "{{.Fields.name}} wrote"}`))
+	if body, _ := rule.body(sub, false); string(body) != `{"text": "Ann wrote"}` {
+		t.Errorf("Expected the templated body, got %s", body)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := &RateLimit{Submissions: 2, Window: time.Minute}
+	now := time.Now()
+	for i, test := range []struct {
+		ip     string
+		at     time.Duration
+		expect bool
+	}{
+		{"a", 0, true},
+		{"a", time.Second, true},
+		{"b", time.Second, true},
+		{"a", 2 * time.Second, false},
+		{"a", time.Minute, true},
+	} {
+		if actual := l.allow(test.ip, now.Add(test.at)); actual != test.expect {
+			t.Errorf("Test %d: Expected %t, got %t", i, test.expect, actual)
+		}
+	}
+}
+
+func TestRateLimitFull(t *testing.T) {
+	l := &RateLimit{Submissions: 2, Window: time.Minute}
+	now := time.Now()
+	for i := 0; i < maxClients; i++ {
+		l.allow(fmt.Sprintf("10.0.%d.%d", i/256, i%256), now)
+	}
+	if l.allow("a", now) {
+		t.Error("Expected a new client to be refused while the table is full")
+	}
+	if !l.allow("10.0.0.1", now) || l.allow("10.0.0.1", now) {
+		t.Error("Expected the clients counted to keep their counts")
+	}
+	if !l.allow("a", now.Add(time.Minute)) {
+		t.Error("Expected a new client to be allowed once the windows ended")
+	}
+}
+
+func TestSendMailTimeout(t *testing.T) {
+	// a server that accepts connections, but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	err = sendMailTimeout(ln.Addr().String(), nil, "a@example.com", []string{"b@example.com"}, []byte("hi"), 100*time.Millisecond)
+	if err == nil {
+		t.Error("Expected an error from a server that doesn't respond, got none")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected to give up after the timeout, took %v", elapsed)
+	}
+}
@@ -0,0 +1,264 @@
+package forms
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("forms", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultMaxBody is the largest submission accepted by default.
+const defaultMaxBody = 64 << 10
+
+// defaultSubject is the subject of emails by default.
+const defaultSubject = "Form {{.Path}}"
+
+// captchas are the fields of the responses to the captchas of the
+// known providers, and the URLs at which they are verified.
+var captchas = map[string]Captcha{
+	"recaptcha": {Field: "g-recaptcha-response", VerifyURL: "https://www.google.com/recaptcha/api/siteverify"},
+	"hcaptcha":  {Field: "h-captcha-response", VerifyURL: "https://api.hcaptcha.com/siteverify"},
+	"turnstile": {Field: "cf-turnstile-response", VerifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify"},
+}
+
+// setup configures a new Forms middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	rules, err := formsParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Forms{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// formsParse parses
+//
+//	forms path {
+//		field      name [required] [email] [max <chars>]
+//		honeypot   name
+//		captcha    recaptcha|hcaptcha|turnstile secret
+//		rate_limit submissions window
+//		csrf
+//		max_body   size
+//		smtp       host:port [username password]
+//		from       address
+//		to         addresses...
+//		subject    template
+//		reply_to   field
+//		webhook    url [content_type]
+//		template   file
+//		redirect   path
+//	}
+//
+// where submissions are emailed through the smtp server, posted to
+// the webhook, or both. The template file, relative to root, makes
+// the body of both from the Submission. With csrf, submissions must
+// carry the CSRF token of the session of the user.
+func formsParse(c *caddy.Controller, root string) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		rule := &Rule{Path: args[0], MaxBody: defaultMaxBody}
+		var mail Mail
+		subject := defaultSubject
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "field":
+				field, err := parseField(args)
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				rule.Fields = append(rule.Fields, field)
+			case "honeypot":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Honeypot = args[0]
+			case "captcha":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				captcha, ok := captchas[args[0]]
+				if !ok {
+					return nil, c.Errf("Unknown captcha '%s'; must be recaptcha, hcaptcha or turnstile", args[0])
+				}
+				captcha.Secret = args[1]
+				rule.Captcha = &captcha
+			case "rate_limit":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return nil, c.Errf("Invalid number of submissions '%s'", args[0])
+				}
+				window, err := time.ParseDuration(args[1])
+				if err != nil || window <= 0 {
+					return nil, c.Errf("Invalid rate_limit window '%s'", args[1])
+				}
+				rule.Limit = &RateLimit{Submissions: n, Window: window}
+			case "csrf":
+				if len(args) != 0 {
+					return nil, c.ArgErr()
+				}
+				rule.CSRF = true
+			case "max_body":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(args[0])
+				if err != nil || size == 0 {
+					return nil, c.Errf("Invalid max_body size '%s'", args[0])
+				}
+				rule.MaxBody = int64(size)
+			case "smtp":
+				if len(args) != 1 && len(args) != 3 {
+					return nil, c.ArgErr()
+				}
+				if _, _, err := net.SplitHostPort(args[0]); err != nil {
+					return nil, c.Errf("Invalid smtp server '%s'; must be host:port", args[0])
+				}
+				mail.Addr = args[0]
+				if len(args) == 3 {
+					mail.Username, mail.Password = args[1], args[2]
+				}
+			case "from":
+				if len(args) != 1 || !isEmail(args[0]) {
+					return nil, c.ArgErr()
+				}
+				mail.From = args[0]
+			case "to":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, to := range args {
+					if !isEmail(to) {
+						return nil, c.Errf("Invalid email address '%s'", to)
+					}
+				}
+				mail.To = append(mail.To, args...)
+			case "subject":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				subject = args[0]
+			case "reply_to":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				mail.ReplyTo = args[0]
+			case "webhook":
+				if len(args) != 1 && len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				if u, err := url.Parse(args[0]); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					return nil, c.Errf("Invalid webhook URL '%s'", args[0])
+				}
+				rule.WebhookURL = args[0]
+				if len(args) == 2 {
+					rule.WebhookType = args[1]
+				}
+			case "template":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				file := args[0]
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(root, file)
+				}
+				text, err := ioutil.ReadFile(file)
+				if err != nil {
+					return nil, c.Errf("Unable to read form template: %v", err)
+				}
+				if rule.Template, err = template.New(args[0]).Parse(string(text)); err != nil {
+					return nil, c.Errf("Invalid form template: %v", err)
+				}
+			case "redirect":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Redirect = args[0]
+			default:
+				return nil, c.Errf("Unknown forms property '%s'", what)
+			}
+		}
+
+		if mail.Addr != "" || mail.From != "" || len(mail.To) > 0 {
+			if mail.Addr == "" || mail.From == "" || len(mail.To) == 0 {
+				return nil, c.Errf("Form %s needs smtp, from and to to send email", rule.Path)
+			}
+			var err error
+			if mail.Subject, err = template.New("subject").Parse(subject); err != nil {
+				return nil, c.Errf("Invalid form subject: %v", err)
+			}
+			rule.Mail = &mail
+		}
+		if rule.Mail == nil && rule.WebhookURL == "" {
+			return nil, c.Errf("Form %s must be sent by smtp or to a webhook", rule.Path)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// parseField parses the arguments of a field: its name, and what
+// its value must be like.
+func parseField(args []string) (Field, error) {
+	if len(args) == 0 {
+		return Field{}, errArgs
+	}
+	field := Field{Name: args[0]}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "required":
+			field.Required = true
+		case "email":
+			field.Email = true
+		case "max":
+			i++
+			if i == len(args) {
+				return field, errArgs
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n <= 0 {
+				return field, fmt.Errorf("Invalid max length '%s'", args[i])
+			}
+			field.Max = n
+		default:
+			return field, fmt.Errorf("Unknown field option '%s'", args[i])
+		}
+	}
+	return field, nil
+}
+
+// errArgs is the error of a field with a wrong number of arguments.
+var errArgs = errors.New("Wrong argument count for field")
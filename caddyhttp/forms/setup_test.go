@@ -0,0 +1,146 @@
+package forms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `forms /contact {
+		webhook https://example.com/hook
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Forms)
+	if !ok {
+		t.Fatalf("Expected handler to be type Forms, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestFormsParse(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_forms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "contact.tmpl"), []byte("{{.Fields.message}}"), 0644)
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		check     func(*Rule) bool
+	}{
+		{`forms /contact {
+			field name required max 100
+			field email required email
+			honeypot website
+			captcha turnstile 0x4AAA
+			rate_limit 5 1h
+			max_body 16KB
+			smtp smtp.example.com:587 user pass
+			from forms@example.com
+			to me@example.com you@example.com
+			subject "Contact from {{.Fields.name}}"
+			reply_to email
+			template contact.tmpl
+			redirect /thanks.html
+		}`, false, func(r *Rule) bool {
+			return len(r.Fields) == 2 && r.Fields[0] == Field{Name: "name", Required: true, Max: 100} &&
+				r.Fields[1] == Field{Name: "email", Required: true, Email: true} &&
+				r.Honeypot == "website" && r.Captcha.Field == "cf-turnstile-response" && r.Captcha.Secret == "0x4AAA" &&
+				r.Limit.Submissions == 5 && r.Limit.Window == time.Hour && r.MaxBody == 16000 &&
+				r.Mail.Addr == "smtp.example.com:587" && r.Mail.Username == "user" && len(r.Mail.To) == 2 &&
+				r.Mail.ReplyTo == "email" && r.Template != nil && r.Redirect == "/thanks.html" && r.WebhookURL == ""
+		}},
+		{`forms /contact {
+			webhook https://hooks.example.com/x application/x-www-form-urlencoded
+		}`, false, func(r *Rule) bool {
+			return r.Mail == nil && r.WebhookType == "application/x-www-form-urlencoded" && r.MaxBody == defaultMaxBody
+		}},
+		{`forms /order {
+			webhook https://hooks.example.com/x
+			csrf
+		}`, false, func(r *Rule) bool {
+			return r.CSRF
+		}},
+		{`forms /order {
+			webhook https://hooks.example.com/x
+			csrf yes
+		}`, true, nil},
+		{`forms /contact`, true, nil},
+		{`forms /contact {
+			smtp localhost:25
+			to me@example.com
+		}`, true, nil},
+		{`forms /contact {
+			webhook ftp://example.com
+		}`, true, nil},
+		{`forms /contact {
+			webhook https://example.com/hook
+			field
+		}`, true, nil},
+		{`forms /contact {
+			webhook https://example.com/hook
+			field name max
+		}`, true, nil},
+		{`forms /contact {
+			webhook https://example.com/hook
+			field name optional
+		}`, true, nil},
+		{`forms /contact {
+			webhook https://example.com/hook
+			captcha mycaptcha secret
+		}`, true, nil},
+		{`forms /contact {
+			webhook https://example.com/hook
+			rate_limit 0 1m
+		}`, true, nil},
+		{`forms /contact {
+			webhook https://example.com/hook
+			template missing.tmpl
+		}`, true, nil},
+		{`forms /contact {
+			smtp localhost:25
+			from forms@example.com
+			to me@example.com
+			subject "{{.Fields"
+		}`, true, nil},
+		{`forms /contact {
+			smtp localhost
+		}`, true, nil},
+		{`forms /contact {
+			webhook https://example.com/hook
+			cc me@example.com
+		}`, true, nil},
+	} {
+		rules, err := formsParse(caddy.NewTestController("http", test.input), root)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if len(rules) != 1 || !test.check(rules[0]) {
+			t.Errorf("Test %d: Rule not as expected: %+v", i, rules[0])
+		}
+	}
+}
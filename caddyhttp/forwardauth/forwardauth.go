@@ -0,0 +1,159 @@
+// Package forwardauth is middleware that asks an external service
+// whether each request may proceed, as with the forward auth of
+// Traefik or the auth_request module of nginx, so that services
+// such as Authelia or oauth2-proxy can protect a site.
+package forwardauth
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// maxDeniedBody bounds how much of the response of the auth
+// service is passed on to clients that are denied.
+const maxDeniedBody = 1 << 20
+
+// deniedHeaders are the headers of a response of the auth
+// service that are passed on to clients that are denied, so
+// that they can log in.
+var deniedHeaders = []string{"Location", "WWW-Authenticate", "Set-Cookie", "Content-Type", "Cache-Control"}
+
+// ForwardAuth is middleware that authorizes requests with an
+// external service.
+type ForwardAuth struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is the configuration of the paths authorized by a
+// service.
+type Rule struct {
+	// Paths are authorized by the service.
+	Paths []string
+
+	// To is the URL of the service. Each request is
+	// authorized with a GET request to it, with the headers
+	// of the request.
+	To string
+
+	// CopyHeaders are the headers of responses of the service
+	// that allow requests, such as Remote-User, that are added
+	// to those requests for the applications behind the site.
+	CopyHeaders []string
+
+	// Timeout is how long the service has to respond.
+	Timeout time.Duration
+
+	client *http.Client
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (a ForwardAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range a.Rules {
+		if !rule.matches(r.URL.Path) {
+			continue
+		}
+
+		resp, err := rule.authorize(r)
+		if err != nil {
+			return http.StatusBadGateway, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			for _, name := range rule.CopyHeaders {
+				// never let the client set what the
+				// service is trusted to say
+				r.Header.Del(name)
+				if v := resp.Header.Get(name); v != "" {
+					r.Header.Set(name, v)
+				}
+			}
+			return a.Next.ServeHTTP(w, r)
+		}
+
+		for _, name := range deniedHeaders {
+			for _, v := range resp.Header[http.CanonicalHeaderKey(name)] {
+				w.Header().Add(name, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, io.LimitReader(resp.Body, maxDeniedBody))
+		return 0, nil
+	}
+	return a.Next.ServeHTTP(w, r)
+}
+
+func (rule Rule) matches(urlPath string) bool {
+	for _, p := range rule.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize asks the service whether r may proceed. The service
+// is told about r with the X-Forwarded-* headers.
+func (rule Rule) authorize(r *http.Request) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rule.To, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	// these describe the request to the service itself
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Type")
+	req.Header.Del("Accept-Encoding")
+	req.Header.Del("Connection")
+	req.Header.Del("Upgrade")
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Proto", scheme)
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		req.Header.Set("X-Forwarded-For", ip)
+	}
+	req = req.WithContext(r.Context())
+
+	client := rule.client
+	if client == nil {
+		client = newClient(rule.Timeout)
+	}
+	return client.Do(req)
+}
+
+// newClient returns a client for a service that responds within
+// timeout, which doesn't follow redirects: they are for the
+// client, to log in.
+func newClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// canonical returns the canonical forms of the header names.
+func canonical(names []string) []string {
+	for i, name := range names {
+		names[i] = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	}
+	return names
+}
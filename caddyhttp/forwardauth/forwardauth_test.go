@@ -0,0 +1,106 @@
+package forwardauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestForwardAuth(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-Method") != "GET" || r.Header.Get("X-Forwarded-Host") != "example.com" ||
+			r.Header.Get("X-Forwarded-Uri") != "/app/page?x=1" || r.Header.Get("X-Forwarded-For") != "192.0.2.1" {
+			http.Error(w, "missing forwarded headers", http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("Cookie") {
+		case "session=good":
+			w.Header().Set("Remote-User", "alice")
+			w.WriteHeader(http.StatusOK)
+		case "":
+			w.Header().Set("Set-Cookie", "rd=/app/page")
+			w.Header().Set("X-Internal", "secret")
+			http.Redirect(w, r, "https://login.example.com/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("go away"))
+		}
+	}))
+	defer auth.Close()
+
+	var seen *http.Request
+	a := ForwardAuth{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			seen = r
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{{
+			Paths:       []string{"/app"},
+			To:          auth.URL + "/verify",
+			CopyHeaders: []string{"Remote-User"},
+			Timeout:     defaultTimeout,
+		}},
+	}
+
+	for i, test := range []struct {
+		target       string
+		cookie       string
+		expectCode   int
+		expectUser   string
+		expectHeader string
+		expectBody   string
+	}{
+		{"/public", "", http.StatusOK, "spoofed", "", ""},
+		{"/app/page?x=1", "session=good", http.StatusOK, "alice", "", ""},
+		{"/app/page?x=1", "", http.StatusFound, "", "https://login.example.com/", ""},
+		{"/app/page?x=1", "session=bad", http.StatusForbidden, "", "", "go away"},
+	} {
+		seen = nil
+		req := httptest.NewRequest("GET", test.target, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Remote-User", "spoofed")
+		if test.cookie != "" {
+			req.Header.Set("Cookie", test.cookie)
+		}
+		rec := httptest.NewRecorder()
+		code, err := a.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectCode {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectCode, code)
+		}
+		if test.expectUser != "" {
+			if seen == nil || seen.Header.Get("Remote-User") != test.expectUser {
+				t.Errorf("Test %d: expected request with user %s to be passed on", i, test.expectUser)
+			}
+		} else if seen != nil {
+			t.Errorf("Test %d: expected request to be denied", i)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.expectHeader {
+			t.Errorf("Test %d: expected Location %q, got %q", i, test.expectHeader, loc)
+		}
+		if test.expectBody != "" && rec.Body.String() != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, rec.Body.String())
+		}
+		if rec.Header().Get("X-Internal") != "" {
+			t.Errorf("Test %d: expected headers of the service not to be passed on", i)
+		}
+	}
+}
+
+func TestForwardAuthUnavailable(t *testing.T) {
+	a := ForwardAuth{
+		Next:  httpserver.EmptyNext,
+		Rules: []Rule{{Paths: []string{"/"}, To: "http://127.0.0.1:1/verify", Timeout: defaultTimeout}},
+	}
+	code, err := a.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if code != http.StatusBadGateway || err == nil {
+		t.Errorf("Expected 502 and an error, got %d and %v", code, err)
+	}
+}
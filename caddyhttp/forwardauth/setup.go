@@ -0,0 +1,87 @@
+package forwardauth
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("forward_auth", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultTimeout is how long a service has to respond, unless
+// configured otherwise.
+const defaultTimeout = 5 * time.Second
+
+// setup configures a new ForwardAuth middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := forwardAuthParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return ForwardAuth{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+func forwardAuthParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Paths: c.RemainingArgs(), Timeout: defaultTimeout}
+		if len(rule.Paths) == 0 {
+			rule.Paths = []string{"/"}
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "to":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				rule.To = c.Val()
+				if u, err := url.Parse(rule.To); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return nil, c.Errf("Bad forward_auth URL '%s'", rule.To)
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "copy_headers":
+				rule.CopyHeaders = canonical(c.RemainingArgs())
+				if len(rule.CopyHeaders) == 0 {
+					return nil, c.ArgErr()
+				}
+			case "timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d <= 0 {
+					return nil, c.Errf("Bad forward_auth timeout '%s'", c.Val())
+				}
+				rule.Timeout = d
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			default:
+				return nil, c.Errf("Unknown forward_auth property '%s'", c.Val())
+			}
+		}
+
+		if rule.To == "" {
+			return nil, c.Err("forward_auth requires the URL of a service to authorize requests")
+		}
+		rule.client = newClient(rule.Timeout)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,93 @@
+package forwardauth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `forward_auth {
+		to http://auth:9091/verify
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(ForwardAuth)
+	if !ok {
+		t.Fatalf("Expected handler to be type ForwardAuth, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestForwardAuthParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`forward_auth {
+			to http://auth:9091/verify
+		}`, false, []Rule{{Paths: []string{"/"}, To: "http://auth:9091/verify", Timeout: defaultTimeout}}},
+		{`forward_auth /app /api {
+			to https://auth.example.com/
+			copy_headers remote-user Remote-Groups
+			timeout 2s
+		}`, false, []Rule{{
+			Paths:       []string{"/app", "/api"},
+			To:          "https://auth.example.com/",
+			CopyHeaders: []string{"Remote-User", "Remote-Groups"},
+			Timeout:     2 * time.Second,
+		}}},
+		{`forward_auth`, true, nil},
+		{`forward_auth {
+			to auth:9091
+		}`, true, nil},
+		{`forward_auth {
+			to http://auth http://other
+		}`, true, nil},
+		{`forward_auth {
+			to http://auth
+			timeout -1s
+		}`, true, nil},
+		{`forward_auth {
+			to http://auth
+			copy_headers
+		}`, true, nil},
+		{`forward_auth {
+			to http://auth
+			trust_all
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := forwardAuthParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		for j := range actual {
+			if actual[j].client == nil {
+				t.Errorf("Test %d: expected client to be set up", i)
+			}
+			actual[j].client = nil
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, test.expected, actual)
+		}
+	}
+}
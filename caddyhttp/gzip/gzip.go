@@ -3,12 +3,16 @@
 package gzip
 
 import (
+	"compress/gzip"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
 )
 
 func init() {
@@ -34,13 +38,56 @@ type Config struct {
 	RequestFilters  []RequestFilter
 	ResponseFilters []ResponseFilter
 	Level           int // Compression level
+
+	// PathLevels and TypeLevels are compression levels other
+	// than Level for requests under a path and responses of a
+	// content type respectively, the latter taking precedence.
+	PathLevels []PathLevel
+	TypeLevels []TypeLevel
+}
+
+// PathLevel is the compression level for requests under Path.
+type PathLevel struct {
+	Path  string
+	Level int
+}
+
+// TypeLevel is the compression level for responses of the content
+// type Type, which may be a wildcard such as text/*.
+type TypeLevel struct {
+	Type  string
+	Level int
+}
+
+// level returns the compression level for responses to r of the
+// given content type.
+func (c Config) level(r *http.Request, contentType string) int {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, tl := range c.TypeLevels {
+		if typeMatches(mediaType, tl.Type) {
+			return tl.Level
+		}
+	}
+	level, longest := c.Level, -1
+	for _, pl := range c.PathLevels {
+		if len(pl.Path) > longest && httpserver.Path(r.URL.Path).Matches(pl.Path) {
+			level, longest = pl.Level, len(pl.Path)
+		}
+	}
+	return level
+}
+
+// typeMatches returns whether mediaType is of pattern, which is either
+// a media type or a wildcard such as text/*.
+func typeMatches(mediaType, pattern string) bool {
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+	}
+	return mediaType == pattern
 }
 
 // ServeHTTP serves a gzipped response if the client supports it.
 func (g Gzip) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-		return g.Next.ServeHTTP(w, r)
-	}
 outer:
 	for _, c := range g.Configs {
 
@@ -51,23 +98,26 @@ outer:
 			}
 		}
 
-		// gzipWriter modifies underlying writer at init,
-		// use a discard writer instead to leave ResponseWriter in
-		// original form.
-		gzipWriter := getWriter(c.Level)
-		defer putWriter(c.Level, gzipWriter)
+		// The response could be compressed, so caches must know
+		// that it depends on whether the client accepts gzip.
+		if !acceptsGzip(r) {
+			return g.Next.ServeHTTP(varyWriter{&httpserver.ResponseWriterWrapper{ResponseWriter: w}}, r)
+		}
+
+		// The compressor only gets a gzip writer, at the level for
+		// the content type, once the response is written.
+		comp := &compressor{
+			w:      w,
+			levels: func(contentType string) int { return c.level(r, contentType) },
+		}
+		defer comp.close()
 		gz := &gzipResponseWriter{
-			Writer:                gzipWriter,
+			Writer:                comp,
 			ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
 		}
 
-		var rw http.ResponseWriter
-		// if no response filter is used
-		if len(c.ResponseFilters) == 0 {
-			// replace discard writer with ResponseWriter
-			gzipWriter.Reset(w)
-			rw = gz
-		} else {
+		var rw http.ResponseWriter = gz
+		if len(c.ResponseFilters) > 0 {
 			// wrap gzip writer with ResponseFilterWriter
 			rw = NewResponseFilterWriter(c.ResponseFilters, gz)
 		}
@@ -82,6 +132,11 @@ outer:
 			httpserver.DefaultErrorFunc(w, r, status)
 			return 0, err
 		}
+
+		comp.close()
+		if comp.out > 0 {
+			httpserver.SetPlaceholder(r, "gzip_ratio", strconv.FormatFloat(float64(comp.in)/float64(comp.out), 'f', 2, 64))
+		}
 		return status, err
 	}
 
@@ -89,6 +144,100 @@ outer:
 	return g.Next.ServeHTTP(w, r)
 }
 
+// acceptsGzip returns whether the client of r accepts responses
+// compressed with gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range staticfiles.ParseAccept(r.Header["Accept-Encoding"]) {
+		switch coding.Value {
+		case "gzip", "x-gzip", "*":
+			if coding.Q > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addVary adds Accept-Encoding to the Vary header in h unless
+// it is already there.
+func addVary(h http.Header) {
+	for _, header := range h["Vary"] {
+		for _, field := range strings.Split(header, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// compressor is the writer of a compressed response. It gets a
+// gzip writer once the content type is known and counts the bytes
+// it compresses and writes.
+type compressor struct {
+	w      io.Writer
+	levels func(contentType string) int
+	gz     *gzip.Writer
+	level  int // of gz
+	in     int64
+	out    int64
+}
+
+// start gets the gzip writer for a response of the given content
+// type.
+func (c *compressor) start(contentType string) {
+	if c.gz == nil {
+		c.level = c.levels(contentType)
+		c.gz = getWriter(c.level)
+		c.gz.Reset(countingWriter{c.w, &c.out})
+	}
+}
+
+func (c *compressor) Write(b []byte) (int, error) {
+	c.start("")
+	n, err := c.gz.Write(b)
+	c.in += int64(n)
+	return n, err
+}
+
+// close finishes the response and returns the gzip writer to its
+// pool.
+func (c *compressor) close() {
+	if c.gz != nil {
+		putWriter(c.level, c.gz)
+		c.gz = nil
+	}
+}
+
+// countingWriter is a writer that counts the bytes it writes.
+type countingWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w countingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	*w.n += int64(n)
+	return n, err
+}
+
+// varyWriter is a response writer that adds Accept-Encoding to the
+// Vary header of responses it doesn't compress, but could have.
+type varyWriter struct {
+	*httpserver.ResponseWriterWrapper
+}
+
+func (w varyWriter) WriteHeader(code int) {
+	addVary(w.Header())
+	w.ResponseWriterWrapper.WriteHeader(code)
+}
+
+func (w varyWriter) Write(b []byte) (int, error) {
+	addVary(w.Header())
+	return w.ResponseWriterWrapper.Write(b)
+}
+
 // gzipResponeWriter wraps the underlying Write method
 // with a gzip.Writer to compress the output.
 type gzipResponseWriter struct {
@@ -104,11 +253,14 @@ type gzipResponseWriter struct {
 func (w *gzipResponseWriter) WriteHeader(code int) {
 	w.Header().Del("Content-Length")
 	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Add("Vary", "Accept-Encoding")
+	addVary(w.Header())
 	originalEtag := w.Header().Get("ETag")
 	if originalEtag != "" && !strings.HasPrefix(originalEtag, "W/") {
 		w.Header().Set("ETag", "W/"+originalEtag)
 	}
+	if c, ok := w.Writer.(*compressor); ok {
+		c.start(w.Header().Get("Content-Type"))
+	}
 	w.ResponseWriterWrapper.WriteHeader(code)
 	w.statusCodeWritten = true
 }
@@ -126,4 +278,7 @@ func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 }
 
 // Interface guards
-var _ httpserver.HTTPInterfaces = (*gzipResponseWriter)(nil)
+var (
+	_ httpserver.HTTPInterfaces = (*gzipResponseWriter)(nil)
+	_ httpserver.HTTPInterfaces = varyWriter{}
+)
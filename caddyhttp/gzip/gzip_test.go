@@ -104,6 +104,113 @@ func TestGzipHandler(t *testing.T) {
 	}
 }
 
+func TestConfigLevel(t *testing.T) {
+	c := Config{
+		Level:      6,
+		PathLevels: []PathLevel{{"/api", 1}, {"/api/reports", 9}},
+		TypeLevels: []TypeLevel{{"text/*", 8}, {"application/json", 2}},
+	}
+	for i, test := range []struct {
+		path, contentType string
+		expect            int
+	}{
+		{"/", "", 6},
+		{"/", "text/html; charset=utf-8", 8},
+		{"/api/users", "", 1},
+		{"/api/reports/2017", "", 9},
+		{"/api/users", "application/json", 2},
+		{"/api/users", "application/jsonx", 1},
+	} {
+		if level := c.level(urlRequest(test.path), test.contentType); level != test.expect {
+			t.Errorf("Test %d: expected level %d, got %d", i, test.expect, level)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for i, test := range []struct {
+		header string
+		expect bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, GZIP;q=0.5", true},
+		{"gzip;q=0, br", false},
+		{"gzip; q=0.0", false},
+		{"*", true},
+		{"identity", false},
+		{"gzipx", false},
+	} {
+		r := urlRequest("/")
+		if test.header != "" {
+			r.Header.Set("Accept-Encoding", test.header)
+		}
+		if got := acceptsGzip(r); got != test.expect {
+			t.Errorf("Test %d: expected %t for %q, got %t", i, test.expect, test.header, got)
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	gz := Gzip{Configs: []Config{
+		{RequestFilters: []RequestFilter{DefaultExtFilter()}, ResponseFilters: []ResponseFilter{SkipCompressedFilter{}}},
+	}}
+	for i, test := range []struct {
+		path, acceptEncoding, contentType, vary string
+		expectEncoding, expectVary              string
+	}{
+		{"/", "gzip", "text/plain", "", "gzip", "Accept-Encoding"},
+		{"/", "", "text/plain", "", "", "Accept-Encoding"},
+		{"/", "gzip", "image/png", "", "", "Accept-Encoding"},
+		{"/", "gzip", "text/plain", "Origin, accept-encoding", "gzip", "Origin, accept-encoding"},
+		{"/", "", "text/plain", "*", "", "*"},
+		{"/image.png", "gzip", "image/png", "", "", ""}, // never compressed
+	} {
+		gz.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", test.contentType)
+			if test.vary != "" {
+				w.Header().Set("Vary", test.vary)
+			}
+			w.Write([]byte("hello"))
+			return 0, nil
+		})
+		r := urlRequest(test.path)
+		if test.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		if _, err := gz.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != test.expectEncoding {
+			t.Errorf("Test %d: expected Content-Encoding %q, got %q", i, test.expectEncoding, got)
+		}
+		if got := strings.Join(w.Header()["Vary"], ", "); got != test.expectVary {
+			t.Errorf("Test %d: expected Vary %q, got %q", i, test.expectVary, got)
+		}
+	}
+}
+
+func TestGzipRatio(t *testing.T) {
+	gz := Gzip{Configs: []Config{{}}, Next: nextFunc(true)}
+	r := httpserver.WithPlaceholders(urlRequest("/file.txt"))
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	rr := httpserver.NewResponseRecorder(w)
+	rep := httpserver.NewReplacer(r, rr, "-")
+	rr.Replacer = rep
+
+	// as by middleware between the log and gzip
+	if _, err := gz.ServeHTTP(&httpserver.ResponseWriterWrapper{ResponseWriter: rr}, r); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := ioutil.ReadFile("testdata/test.txt")
+	expect := fmt.Sprintf("%.2f", float64(len(original))/float64(w.Body.Len()))
+	if got := rep.Replace("{gzip_ratio}"); got != expect {
+		t.Errorf("Expected ratio %s, got %s", expect, got)
+	}
+}
+
 func nextFunc(shouldGzip bool) httpserver.Handler {
 	return httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
 		// write a relatively large text file
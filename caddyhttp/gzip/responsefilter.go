@@ -1,9 +1,10 @@
 package gzip
 
 import (
-	"compress/gzip"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // ResponseFilter determines if the response should be gzipped.
@@ -28,15 +29,36 @@ func (l LengthFilter) ShouldCompress(w http.ResponseWriter) bool {
 // SkipCompressedFilter is ResponseFilter that will discard already compressed responses
 type SkipCompressedFilter struct{}
 
-// ShouldCompress returns true if served file is not already compressed
-// encodings via https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Encoding
+// compressedTypes are the content types, or their prefixes, of
+// formats that are already compressed.
+var compressedTypes = []string{"image/", "audio/", "video/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+	"application/x-xz", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/zstd", "application/pdf"}
+
+// uncompressedTypes are exceptions to compressedTypes.
+var uncompressedTypes = []string{"image/svg+xml", "image/bmp", "image/x-icon", "image/vnd.microsoft.icon"}
+
+// ShouldCompress returns true if served file is not already compressed, either
+// with an encoding (see https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Encoding)
+// or by its format.
 func (n SkipCompressedFilter) ShouldCompress(w http.ResponseWriter) bool {
 	switch w.Header().Get("Content-Encoding") {
 	case "gzip", "compress", "deflate", "br":
 		return false
-	default:
-		return true
 	}
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	for _, t := range uncompressedTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	for _, t := range compressedTypes {
+		if mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+	return true
 }
 
 // ResponseFilterWriter validates ResponseFilters. It writes
@@ -67,14 +89,11 @@ func (r *ResponseFilterWriter) WriteHeader(code int) {
 	}
 
 	if r.shouldCompress {
-		// replace discard writer with ResponseWriter
-		if gzWriter, ok := r.gzipResponseWriter.Writer.(*gzip.Writer); ok {
-			gzWriter.Reset(r.ResponseWriter)
-		}
 		// use gzip WriteHeader to include and delete
 		// necessary headers
 		r.gzipResponseWriter.WriteHeader(code)
 	} else {
+		addVary(r.Header())
 		r.ResponseWriter.WriteHeader(code)
 	}
 	r.statusCodeWritten = true
@@ -84,6 +103,10 @@ func (r *ResponseFilterWriter) WriteHeader(code int) {
 // are satisfied
 func (r *ResponseFilterWriter) Write(b []byte) (int, error) {
 	if !r.statusCodeWritten {
+		// so that filters can tell what the response is
+		if r.Header().Get("Content-Type") == "" {
+			r.Header().Set("Content-Type", http.DetectContentType(b))
+		}
 		r.WriteHeader(http.StatusOK)
 	}
 	if r.shouldCompress {
@@ -110,3 +110,25 @@ func TestResponseGzippedOutput(t *testing.T) {
 		t.Errorf("Expected output not to be gzipped")
 	}
 }
+
+func TestSkipCompressedTypes(t *testing.T) {
+	for i, test := range []struct {
+		contentType    string
+		shouldCompress bool
+	}{
+		{"", true},
+		{"text/html; charset=utf-8", true},
+		{"image/svg+xml", true},
+		{"image/png", false},
+		{"video/mp4", false},
+		{"application/zip", false},
+		{"font/woff2", false},
+		{"application/json", true},
+	} {
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Type", test.contentType)
+		if got := (SkipCompressedFilter{}).ShouldCompress(w); got != test.shouldCompress {
+			t.Errorf("Test %d: expected %t for %q, got %t", i, test.shouldCompress, test.contentType, got)
+		}
+	}
+}
@@ -26,6 +26,20 @@ func setup(c *caddy.Controller) error {
 	return nil
 }
 
+// gzipParse parses
+//
+//	gzip {
+//		ext        extensions...
+//		not        paths...
+//		level      level
+//		path_level level paths...
+//		type_level level types...
+//		min_length bytes
+//	}
+//
+// where path_level and type_level set the compression level for
+// requests under the paths and for responses of the content types,
+// which may be wildcards such as text/*, instead of level.
 func gzipParse(c *caddy.Controller) ([]Config, error) {
 	var configs []Config
 
@@ -77,6 +91,29 @@ func gzipParse(c *caddy.Controller) ([]Config, error) {
 				}
 				level, _ := strconv.Atoi(c.Val())
 				config.Level = level
+			case "path_level", "type_level":
+				what := c.Val()
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return configs, c.ArgErr()
+				}
+				level, err := strconv.Atoi(args[0])
+				if err != nil {
+					return configs, fmt.Errorf(`gzip: invalid level "%v"`, args[0])
+				}
+				for _, scope := range args[1:] {
+					if what == "path_level" {
+						if !strings.HasPrefix(scope, "/") {
+							return configs, fmt.Errorf(`gzip: invalid path "%v" (must start with /)`, scope)
+						}
+						config.PathLevels = append(config.PathLevels, PathLevel{Path: scope, Level: level})
+					} else {
+						if !strings.Contains(scope, "/") {
+							return configs, fmt.Errorf(`gzip: invalid content type "%v"`, scope)
+						}
+						config.TypeLevels = append(config.TypeLevels, TypeLevel{Type: strings.ToLower(scope), Level: level})
+					}
+				}
 			case "min_length":
 				if !c.NextArg() {
 					return configs, c.ArgErr()
@@ -89,6 +89,23 @@ func TestSetup(t *testing.T) {
 		 min_length 1000
 		}
 		`, false},
+		{`gzip {
+		 level 6
+		 type_level 9 text/html text/*
+		 path_level 1 /api
+		}`, false},
+		{`gzip {
+		 path_level 1
+		}`, true},
+		{`gzip {
+		 path_level fast /api
+		}`, true},
+		{`gzip {
+		 path_level 1 api
+		}`, true},
+		{`gzip {
+		 type_level 9 html
+		}`, true},
 	}
 	for i, test := range tests {
 		_, err := gzipParse(caddy.NewTestController("http", test.input))
@@ -127,3 +144,24 @@ func TestShouldAddResponseFilters(t *testing.T) {
 		}
 	}
 }
+
+func TestLevels(t *testing.T) {
+	configs, err := gzipParse(caddy.NewTestController("http", `gzip {
+		level 6
+		type_level 9 text/HTML
+		path_level 1 /api /feeds
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error but found: %v", err)
+	}
+	c := configs[0]
+	if c.Level != 6 {
+		t.Errorf("Expected level 6, got %d", c.Level)
+	}
+	if len(c.TypeLevels) != 1 || c.TypeLevels[0] != (TypeLevel{"text/html", 9}) {
+		t.Errorf("Expected level 9 for text/html, got %v", c.TypeLevels)
+	}
+	if len(c.PathLevels) != 2 || c.PathLevels[1] != (PathLevel{"/feeds", 1}) {
+		t.Errorf("Expected level 1 for /api and /feeds, got %v", c.PathLevels)
+	}
+}
@@ -1,10 +1,12 @@
 // Package header provides middleware that appends headers to
 // requests based on a set of configuration rules that define
-// which routes receive which headers.
+// which routes receive which headers, and on which conditions.
 package header
 
 import (
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -25,27 +27,83 @@ func (h Headers) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
 	}
 	for _, rule := range h.Rules {
-		if httpserver.Path(r.URL.Path).Matches(rule.Path) {
-			for name := range rule.Headers {
-
-				// One can either delete a header, add multiple values to a header, or simply
-				// set a header.
-
-				if strings.HasPrefix(name, "-") {
-					rww.delHeader(strings.TrimLeft(name, "-"))
-				} else if strings.HasPrefix(name, "+") {
-					for _, value := range rule.Headers[name] {
-						rww.Header().Add(strings.TrimLeft(name, "+"), replacer.Replace(value))
-					}
-				} else {
-					for _, value := range rule.Headers[name] {
-						rww.Header().Set(name, replacer.Replace(value))
-					}
+		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+		if rule.Matcher != nil && !rule.Matcher.Match(r) {
+			continue
+		}
+
+		if len(rule.Status) > 0 || len(rule.ContentTypes) > 0 {
+			// the whole rule waits for the response
+			rule := rule
+			rww.ops = append(rww.ops, func(h http.Header, status int) {
+				if rule.MatchesResponse(h, status) {
+					rule.Apply(h, replacer)
+				}
+			})
+			continue
+		}
+
+		for name := range rule.Headers {
+
+			// One can either delete a header, add multiple values to a header, or simply
+			// set a header; setting one if it is empty, or once the response is known,
+			// must wait for the response.
+
+			if strings.HasPrefix(name, "-") {
+				rww.delHeader(strings.TrimLeft(name, "-"))
+			} else if strings.HasPrefix(name, "+") {
+				for _, value := range rule.Headers[name] {
+					rww.Header().Add(strings.TrimLeft(name, "+"), replacer.Replace(value))
+				}
+			} else if strings.HasPrefix(name, "?") || strings.HasPrefix(name, ">") {
+				name, values := name, rule.Headers[name]
+				rww.ops = append(rww.ops, func(h http.Header, _ int) {
+					applyHeader(h, name, values, replacer)
+				})
+			} else {
+				for _, value := range rule.Headers[name] {
+					rww.Header().Set(name, replacer.Replace(value))
 				}
 			}
 		}
+		if len(rule.Replacements) > 0 {
+			rule := rule
+			rww.ops = append(rww.ops, func(h http.Header, _ int) { rule.replace(h) })
+		}
+	}
+	status, err := h.Next.ServeHTTP(rww, r)
+	if !rww.wroteHeader && status >= 400 {
+		// the error is written further up the chain, to the
+		// same headers, which must be revised for it first
+		rww.revise(status)
+	}
+	return status, err
+}
+
+// applyHeader applies the operation of a header of a rule, named
+// with its prefix, to h.
+func applyHeader(h http.Header, name string, values []string, replacer httpserver.Replacer) {
+	switch {
+	case strings.HasPrefix(name, "-"):
+		h.Del(strings.TrimLeft(name, "-"))
+	case strings.HasPrefix(name, "+"):
+		for _, value := range values {
+			h.Add(strings.TrimLeft(name, "+"), replacer.Replace(value))
+		}
+	case strings.HasPrefix(name, "?"):
+		name = strings.TrimLeft(name, "?")
+		if h.Get(name) == "" {
+			for _, value := range values {
+				h.Set(name, replacer.Replace(value))
+			}
+		}
+	default:
+		for _, value := range values {
+			h.Set(strings.TrimLeft(name, ">"), replacer.Replace(value))
+		}
 	}
-	return h.Next.ServeHTTP(rww, r)
 }
 
 type (
@@ -53,11 +111,92 @@ type (
 	Rule struct {
 		Path    string
 		Headers http.Header
+
+		// Matcher, if not nil, must match the request,
+		// as with `if` conditions.
+		Matcher httpserver.RequestMatcher
+
+		// Status, if not empty, are the status codes, or
+		// classes of them such as "4xx", of the responses
+		// to which the rule applies.
+		Status []string
+
+		// ContentTypes, if not empty, are the media types,
+		// or wildcards such as "text/*", of the responses
+		// to which the rule applies.
+		ContentTypes []string
+
+		// Replacements substitute the values of headers
+		// once the response is known.
+		Replacements []Replacement
+	}
+
+	// Replacement replaces the matches of Regexp in the
+	// values of the header Name with Replace, which may
+	// refer to submatches as ${1}.
+	Replacement struct {
+		Name    string
+		Regexp  *regexp.Regexp
+		Replace string
 	}
 )
 
-// headerOperation represents an operation on the header
-type headerOperation func(http.Header)
+// conditional returns whether the rule applies on conditions
+// besides its path.
+func (rule Rule) conditional() bool {
+	return rule.Matcher != nil || len(rule.Status) > 0 || len(rule.ContentTypes) > 0
+}
+
+// MatchesResponse returns whether the response, of status and with
+// headers h, satisfies the conditions of the rule on it.
+func (rule Rule) MatchesResponse(h http.Header, status int) bool {
+	if len(rule.Status) > 0 {
+		code := strconv.Itoa(status)
+		var ok bool
+		for _, s := range rule.Status {
+			if s == code || len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] == code[0] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(rule.ContentTypes) > 0 {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(h.Get("Content-Type"), ";")[0]))
+		for _, ct := range rule.ContentTypes {
+			if ct == mediaType || strings.HasSuffix(ct, "/*") && strings.HasPrefix(mediaType, ct[:len(ct)-1]) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Apply performs the operations of the rule on the headers h of
+// a response, such as once it satisfies the conditions of the rule.
+func (rule Rule) Apply(h http.Header, replacer httpserver.Replacer) {
+	for name, values := range rule.Headers {
+		applyHeader(h, name, values, replacer)
+	}
+	rule.replace(h)
+}
+
+// replace substitutes the values of the headers in h.
+func (rule Rule) replace(h http.Header) {
+	for _, repl := range rule.Replacements {
+		key := http.CanonicalHeaderKey(repl.Name)
+		for i, value := range h[key] {
+			h[key][i] = repl.Regexp.ReplaceAllString(value, repl.Replace)
+		}
+	}
+}
+
+// headerOperation represents an operation on the header,
+// once the status of the response is known
+type headerOperation func(h http.Header, status int)
 
 // responseWriterWrapper wraps the real ResponseWriter.
 // It defers header operations until writeHeader
@@ -83,15 +222,20 @@ func (rww *responseWriterWrapper) WriteHeader(status int) {
 		return
 	}
 	rww.wroteHeader = true
+	rww.revise(status)
+	rww.ResponseWriterWrapper.WriteHeader(status)
+}
+
+// revise performs the deferred operations on the headers of
+// a response of status.
+func (rww *responseWriterWrapper) revise(status int) {
 	// capture the original headers
 	h := rww.Header()
 
 	// perform our revisions
 	for _, op := range rww.ops {
-		op(h)
+		op(h, status)
 	}
-
-	rww.ResponseWriterWrapper.WriteHeader(status)
 }
 
 // delHeader deletes the existing header according to the key
@@ -101,7 +245,7 @@ func (rww *responseWriterWrapper) delHeader(key string) {
 	rww.Header().Del(key)
 
 	// register a future deletion
-	rww.ops = append(rww.ops, func(h http.Header) {
+	rww.ops = append(rww.ops, func(h http.Header, _ int) {
 		h.Del(key)
 	})
 }
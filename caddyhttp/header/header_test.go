@@ -1,6 +1,7 @@
 package header
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,7 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -93,3 +95,83 @@ func TestMultipleHeaders(t *testing.T) {
 		t.Errorf("Expected header to contain: %v but got: %v", desiredHeaders, actualHeaders)
 	}
 }
+
+func TestConditionalHeaders(t *testing.T) {
+	rules, err := headersParse(caddy.NewTestController("http", `header / {
+		if_status 4xx
+		X-Error yes
+	}
+	header / {
+		if_content_type text/*
+		X-Text yes
+	}
+	header /js {
+		if {path} ends_with .js
+		X-Script yes
+	}
+	header / {
+		?Cache-Control "max-age=60"
+		>Server Caddy
+		~Set-Cookie "domain=old\.com" "domain=new.com"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		path        string
+		status      int
+		contentType string
+		upstream    http.Header
+		written     bool // whether the handler writes the response
+		expected    map[string]string
+	}{
+		{"/a", 200, "text/plain", nil, true, map[string]string{
+			"X-Error": "", "X-Text": "yes", "X-Script": "", "Cache-Control": "max-age=60", "Server": "Caddy",
+		}},
+		{"/a", 404, "application/json", nil, true, map[string]string{
+			"X-Error": "yes", "X-Text": "",
+		}},
+		{"/a", 404, "", nil, false, map[string]string{
+			"X-Error": "yes",
+		}},
+		{"/js/app.js", 200, "application/javascript", nil, true, map[string]string{
+			"X-Script": "yes", "X-Text": "",
+		}},
+		{"/js/app.css", 200, "text/css", nil, true, map[string]string{
+			"X-Script": "",
+		}},
+		{"/a", 200, "text/plain", http.Header{
+			"Cache-Control": {"no-store"},
+			"Server":        {"upstream"},
+			"Set-Cookie":    {"id=1; domain=old.com; path=/"},
+		}, true, map[string]string{
+			"Cache-Control": "no-store", "Server": "Caddy", "Set-Cookie": "id=1; domain=new.com; path=/",
+		}},
+	} {
+		test := test
+		he := Headers{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				for name, values := range test.upstream {
+					w.Header()[name] = values
+				}
+				if !test.written {
+					return test.status, nil
+				}
+				w.Header().Set("Content-Type", test.contentType)
+				w.WriteHeader(test.status)
+				return 0, nil
+			}),
+			Rules: rules,
+		}
+		req, _ := http.NewRequest("GET", test.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), httpserver.OriginalURLCtxKey, *req.URL))
+		rec := httptest.NewRecorder()
+		he.ServeHTTP(rec, req)
+		for name, value := range test.expected {
+			if got := rec.Header().Get(name); got != value {
+				t.Errorf("Test %d: Expected %s header to be %q but was %q", i, name, value, got)
+			}
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package header
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -34,34 +38,64 @@ func headersParse(c *caddy.Controller) ([]Rule, error) {
 	for c.NextLine() {
 		var head Rule
 		head.Headers = http.Header{}
-		var isNewPattern bool
+		var conditional bool
 
 		if !c.NextArg() {
 			return rules, c.ArgErr()
 		}
-		pattern := c.Val()
+		head.Path = c.Val()
 
-		// See if we already have a definition for this Path pattern...
-		for _, h := range rules {
-			if h.Path == pattern {
-				head = h
-				break
-			}
-		}
-
-		// ...otherwise, this is a new pattern
-		if head.Path == "" {
-			head.Path = pattern
-			isNewPattern = true
+		matcher, err := httpserver.SetupIfMatcher(c)
+		if err != nil {
+			return rules, err
 		}
 
 		for c.NextBlock() {
 			// A block of headers was opened...
+			if httpserver.IfMatcherKeyword(c) {
+				head.Matcher = matcher
+				conditional = true
+				continue
+			}
 			name := c.Val()
 			value := ""
 
 			args := c.RemainingArgs()
 
+			switch {
+			case name == "if_status":
+				if len(args) == 0 {
+					return rules, c.ArgErr()
+				}
+				for _, status := range args {
+					if !ValidStatus(status) {
+						return rules, c.Errf("Invalid status '%s'", status)
+					}
+				}
+				head.Status = append(head.Status, args...)
+				conditional = true
+				continue
+			case name == "if_content_type":
+				if len(args) == 0 {
+					return rules, c.ArgErr()
+				}
+				for _, ct := range args {
+					head.ContentTypes = append(head.ContentTypes, strings.ToLower(ct))
+				}
+				conditional = true
+				continue
+			case strings.HasPrefix(name, "~"):
+				if len(args) != 2 {
+					return rules, c.ArgErr()
+				}
+				repl, err := NewReplacement(name, args[0], args[1])
+				if err != nil {
+					return rules, c.Err(err.Error())
+				}
+				head.Replacements = append(head.Replacements, repl)
+				continue
+			}
+
 			if len(args) > 1 {
 				return rules, c.ArgErr()
 			} else if len(args) == 1 {
@@ -76,24 +110,67 @@ func headersParse(c *caddy.Controller) ([]Rule, error) {
 			name := c.Val()
 			value := c.Val()
 
-			if c.NextArg() {
-				value = c.Val()
-			}
+			if strings.HasPrefix(name, "~") {
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return rules, c.ArgErr()
+				}
+				repl, err := NewReplacement(name, args[0], args[1])
+				if err != nil {
+					return rules, c.Err(err.Error())
+				}
+				head.Replacements = append(head.Replacements, repl)
+			} else {
+				if c.NextArg() {
+					value = c.Val()
+				}
 
-			head.Headers.Add(name, value)
+				head.Headers.Add(name, value)
+			}
 		}
 
-		if isNewPattern {
-			rules = append(rules, head)
-		} else {
-			for i := 0; i < len(rules); i++ {
-				if rules[i].Path == pattern {
-					rules[i] = head
+		// See if we already have a definition for this Path pattern,
+		// into which to merge; rules with conditions stand alone
+		merged := false
+		if !conditional {
+			for i := range rules {
+				if rules[i].Path == head.Path && !rules[i].conditional() {
+					for name, values := range head.Headers {
+						rules[i].Headers[name] = append(rules[i].Headers[name], values...)
+					}
+					rules[i].Replacements = append(rules[i].Replacements, head.Replacements...)
+					merged = true
 					break
 				}
 			}
 		}
+		if !merged {
+			rules = append(rules, head)
+		}
 	}
 
 	return rules, nil
 }
+
+// NewReplacement returns the replacement of matches of pattern with
+// repl in the values of the header named with its ~ prefix.
+func NewReplacement(name, pattern, repl string) (Replacement, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Replacement{}, fmt.Errorf("Invalid regular expression '%s': %v", pattern, err)
+	}
+	return Replacement{Name: strings.TrimLeft(name, "~"), Regexp: re, Replace: repl}, nil
+}
+
+// ValidStatus returns whether s is a status code, or a class
+// of them such as "4xx".
+func ValidStatus(s string) bool {
+	if len(s) != 3 || s[0] < '1' || s[0] > '5' {
+		return false
+	}
+	if s[1:] == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
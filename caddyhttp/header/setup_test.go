@@ -98,3 +98,70 @@ func TestHeadersParse(t *testing.T) {
 		}
 	}
 }
+
+func TestHeadersParseConditions(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		rules     int
+	}{
+		{`header / {
+			if_status 404 5xx
+			if_content_type text/html
+			X-Frame-Options DENY
+		}`, false, 1},
+		{`header / {
+			if {path} match \.js$
+			?Cache-Control "max-age=60"
+		}
+		header / Foo Bar`, false, 2},
+		{`header / Foo Bar
+		header / {
+			~Set-Cookie "domain=old\.com" "domain=new.com"
+		}`, false, 1},
+		{`header / ~Location ^http: https:`, false, 1},
+		{`header / {
+			if_status 4xy
+		}`, true, 0},
+		{`header / {
+			if_status
+		}`, true, 0},
+		{`header / {
+			~Set-Cookie "(" x
+		}`, true, 0},
+		{`header / {
+			~Set-Cookie only_pattern
+		}`, true, 0},
+		{`header / {
+			if {path} bogus x
+		}`, true, 0},
+	} {
+		rules, err := headersParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if len(rules) != test.rules {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, test.rules, len(rules))
+		}
+	}
+
+	rules, _ := headersParse(caddy.NewTestController("http", `header / {
+		if_status 404 5xx
+		if_content_type Text/HTML
+		~Set-Cookie "domain=old\.com" "domain=new.com"
+	}`))
+	rule := rules[0]
+	if !reflect.DeepEqual(rule.Status, []string{"404", "5xx"}) || !reflect.DeepEqual(rule.ContentTypes, []string{"text/html"}) {
+		t.Errorf("Expected conditions on 404 and 5xx text/html, got %v %v", rule.Status, rule.ContentTypes)
+	}
+	if len(rule.Replacements) != 1 || rule.Replacements[0].Name != "Set-Cookie" || rule.Replacements[0].Replace != "domain=new.com" {
+		t.Errorf("Expected a replacement in Set-Cookie, got %+v", rule.Replacements)
+	}
+}
@@ -0,0 +1,76 @@
+// Package health implements the health directive, which serves
+// liveness and readiness endpoints for load balancers and
+// orchestrators such as Kubernetes.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Health is a middleware that serves the liveness and
+// readiness endpoints.
+type Health struct {
+	Next      httpserver.Handler
+	Liveness  string
+	Readiness string
+
+	// Timeout is how long readiness checks may take.
+	Timeout time.Duration
+}
+
+// status is the response body of both endpoints.
+type status struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkStatus `json:"checks,omitempty"`
+}
+
+type checkStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ServeHTTP responds to requests for the liveness path with
+// 200 OK as long as Caddy is serving requests at all, and to
+// requests for the readiness path with the result of every
+// readiness check: 200 OK if all pass, 503 otherwise. All other
+// requests are passed up the chain.
+func (h Health) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var live bool
+	switch r.URL.Path {
+	case h.Liveness:
+		live = true
+	case h.Readiness:
+	default:
+		return h.Next.ServeHTTP(w, r)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	code, body := http.StatusOK, status{Status: "ok"}
+	if !live {
+		body.Checks = make(map[string]checkStatus)
+		for name, err := range caddy.CheckReadiness(h.Timeout) {
+			if err != nil {
+				code, body.Status = http.StatusServiceUnavailable, "unavailable"
+				body.Checks[name] = checkStatus{Status: "fail", Error: err.Error()}
+			} else {
+				body.Checks[name] = checkStatus{Status: "ok"}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		json.NewEncoder(w).Encode(body)
+	}
+	return 0, nil
+}
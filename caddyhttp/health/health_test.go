@@ -0,0 +1,72 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestHealth(t *testing.T) {
+	var failing error
+	caddy.RegisterReadinessCheck("health_test", func() error { return failing })
+
+	h := Health{
+		Liveness:  "/healthz",
+		Readiness: "/readyz",
+		Timeout:   time.Second,
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+	}
+
+	serve := func(method, path string) (int, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		code, err := h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if err != nil {
+			t.Errorf("%s %s: Expected no error, got: %v", method, path, err)
+		}
+		if code == 0 {
+			code = w.Code
+		}
+		return code, w
+	}
+
+	if code, _ := serve("GET", "/other"); code != http.StatusTeapot {
+		t.Errorf("Expected other paths to be passed on, got %d", code)
+	}
+	if code, _ := serve("POST", "/healthz"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to be disallowed, got %d", code)
+	}
+
+	code, w := serve("GET", "/healthz")
+	if code != http.StatusOK || w.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("Expected liveness to be ok, got %d: %s", code, w.Body.String())
+	}
+
+	failing = errors.New("storage unreachable")
+	code, w = serve("GET", "/readyz")
+	var body status
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON, got error: %v", err)
+	}
+	if code != http.StatusServiceUnavailable || body.Status != "unavailable" {
+		t.Errorf("Expected readiness to be unavailable, got %d: %s", code, w.Body.String())
+	}
+	if check := body.Checks["health_test"]; check.Status != "fail" || check.Error != "storage unreachable" {
+		t.Errorf("Expected failing check to be reported, got %+v", check)
+	}
+	if check, ok := body.Checks["config"]; !ok || check.Status != "fail" {
+		t.Errorf("Expected config check to fail without a running instance, got %+v", check)
+	}
+
+	code, w = serve("HEAD", "/readyz")
+	if code != http.StatusServiceUnavailable || w.Body.Len() != 0 {
+		t.Errorf("Expected HEAD to give the status without a body, got %d: %s", code, w.Body.String())
+	}
+}
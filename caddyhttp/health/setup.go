@@ -0,0 +1,96 @@
+package health
+
+import (
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("health", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Health middleware instance. The health
+// endpoints are served even in maintenance mode, in which case
+// the readiness endpoint reports that maintenance mode is on.
+func setup(c *caddy.Controller) error {
+	h, err := healthParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.MaintenanceExempt = append(cfg.MaintenanceExempt, h.Liveness, h.Readiness)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		h.Next = next
+		return h
+	})
+
+	return nil
+}
+
+// healthParse parses
+//
+//     health [liveness [readiness]] {
+//         liveness  <path>
+//         readiness <path>
+//         timeout   <duration>
+//     }
+func healthParse(c *caddy.Controller) (Health, error) {
+	h := Health{
+		Liveness:  defaultLivenessPath,
+		Readiness: defaultReadinessPath,
+		Timeout:   defaultTimeout,
+	}
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 2:
+			h.Readiness = args[1]
+			fallthrough
+		case 1:
+			h.Liveness = args[0]
+		case 0:
+		default:
+			return h, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return h, c.ArgErr()
+			}
+			switch what {
+			case "liveness":
+				h.Liveness = c.Val()
+			case "readiness":
+				h.Readiness = c.Val()
+			case "timeout":
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d <= 0 {
+					return h, c.Errf("invalid timeout '%s'", c.Val())
+				}
+				h.Timeout = d
+			default:
+				return h, c.Errf("unknown property '%s'", what)
+			}
+			if c.NextArg() {
+				return h, c.ArgErr()
+			}
+		}
+	}
+	if h.Liveness == h.Readiness {
+		return h, c.Errf("liveness and readiness paths must differ, both are '%s'", h.Liveness)
+	}
+	return h, nil
+}
+
+const (
+	defaultLivenessPath  = "/healthz"
+	defaultReadinessPath = "/readyz"
+	defaultTimeout       = 5 * time.Second
+)
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Health
+	}{
+		{`health`, false, Health{Liveness: "/healthz", Readiness: "/readyz", Timeout: 5 * time.Second}},
+		{`health /live`, false, Health{Liveness: "/live", Readiness: "/readyz", Timeout: 5 * time.Second}},
+		{`health /live /ready`, false, Health{Liveness: "/live", Readiness: "/ready", Timeout: 5 * time.Second}},
+		{"health {\n readiness /r\n timeout 1s\n}", false, Health{Liveness: "/healthz", Readiness: "/r", Timeout: time.Second}},
+		{"health {\n timeout soon\n}", true, Health{}},
+		{"health {\n timeout\n}", true, Health{}},
+		{"health {\n liveness /a /b\n}", true, Health{}},
+		{"health {\n bogus /a\n}", true, Health{}},
+		{`health /same /same`, true, Health{}},
+		{`health /a /b /c`, true, Health{}},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+
+		cfg := httpserver.GetConfig(c)
+		mids := cfg.Middleware()
+		if len(mids) == 0 {
+			t.Fatalf("Test %d: Expected middleware, got 0 instead", i)
+		}
+		handler := mids[0](httpserver.EmptyNext)
+		h, ok := handler.(Health)
+		if !ok {
+			t.Fatalf("Test %d: Expected handler to be type Health, got: %#v", i, handler)
+		}
+		if h.Liveness != test.expected.Liveness || h.Readiness != test.expected.Readiness || h.Timeout != test.expected.Timeout {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, h)
+		}
+		if len(cfg.MaintenanceExempt) != 2 || cfg.MaintenanceExempt[0] != h.Liveness || cfg.MaintenanceExempt[1] != h.Readiness {
+			t.Errorf("Test %d: Expected health paths to be exempt from maintenance mode, got %v", i, cfg.MaintenanceExempt)
+		}
+		if !httpserver.SameNext(h.Next, httpserver.EmptyNext) {
+			t.Errorf("Test %d: 'Next' field of handler was not set properly", i)
+		}
+	}
+}
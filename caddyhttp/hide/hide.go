@@ -0,0 +1,54 @@
+// Package hide implements the hide directive, which hides files from
+// a site, whichever handler would serve or list them.
+package hide
+
+import (
+	"path"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("hide", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupHide,
+	})
+}
+
+// setupHide parses
+//
+//	hide [patterns...]
+//
+// where patterns are glob patterns of the names of files, or of
+// their paths if they contain a slash, or one of the words dotfiles,
+// for files whose names start with a dot, except the .well-known
+// directory, and vcs, for the directories of version control
+// systems. Without patterns, dot files and those directories are
+// hidden.
+func setupHide(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			args = []string{"dotfiles", "vcs"}
+		}
+
+		for _, arg := range args {
+			switch arg {
+			case "dotfiles":
+				config.HideDotfiles = true
+			case "vcs":
+				config.HideVCS = true
+			default:
+				if _, err := path.Match(arg, ""); err != nil {
+					return c.Errf("Bad hide pattern '%s': %v", arg, err)
+				}
+				config.HiddenPatterns = append(config.HiddenPatterns, arg)
+			}
+		}
+	}
+
+	return nil
+}
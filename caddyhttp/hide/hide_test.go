@@ -0,0 +1,46 @@
+package hide
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupHide(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectDotfiles bool
+		expectVCS      bool
+		expectPatterns []string
+	}{
+		{`hide`, false, true, true, nil},
+		{`hide vcs`, false, false, true, nil},
+		{`hide *.bak /private/*
+		  hide dotfiles`, false, true, false, []string{"*.bak", "/private/*"}},
+		{`hide [`, true, false, false, nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupHide(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		cfg := httpserver.GetConfig(c)
+		if cfg.HideDotfiles != test.expectDotfiles || cfg.HideVCS != test.expectVCS {
+			t.Errorf("Test %d: expected dotfiles %v and vcs %v, got %v and %v",
+				i, test.expectDotfiles, test.expectVCS, cfg.HideDotfiles, cfg.HideVCS)
+		}
+		if !reflect.DeepEqual(cfg.HiddenPatterns, test.expectPatterns) {
+			t.Errorf("Test %d: expected patterns %v, got %v", i, test.expectPatterns, cfg.HiddenPatterns)
+		}
+	}
+}
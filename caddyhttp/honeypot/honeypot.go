@@ -0,0 +1,106 @@
+// Package honeypot implements middleware that lays decoy paths, such
+// as /wp-login.php on a site that isn't WordPress, which only
+// scanners request, and puts the clients that request them on the
+// blocklist shared by all sites, so that they are turned away from
+// the rest of them too.
+package honeypot
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var honeypotHits = metrics.NewCounter("caddy_http_honeypot_hits_total",
+	"Number of requests for decoy paths, by site.",
+	"site")
+
+// Honeypot is middleware that blocks the clients that request decoy
+// paths, and turns away blocked clients.
+type Honeypot struct {
+	Next httpserver.Handler
+	Site string // for logs and metrics
+
+	// Paths are the decoy paths.
+	Paths []string
+
+	// TTL is how long clients that request decoy paths are blocked.
+	TTL time.Duration
+
+	// Trusted are the networks whose clients are never blocked,
+	// such as those of monitoring.
+	Trusted []*net.IPNet
+
+	// Tarpit, if its Delay isn't 0, holds requests for decoy paths
+	// before they are responded to.
+	Tarpit httpserver.Tarpit
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (h Honeypot) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	ip := httpserver.ClientIP(r)
+	if h.trusted(ip) {
+		return h.Next.ServeHTTP(w, r)
+	}
+	if httpserver.IPBlocked(ip) {
+		return http.StatusForbidden, nil
+	}
+	for _, p := range h.Paths {
+		if httpserver.Path(r.URL.Path).Matches(p) {
+			if crossSite(r) {
+				// another site may have had the browsers of its
+				// visitors request it, to have them blocked
+				return http.StatusNotFound, nil
+			}
+			honeypotHits.Inc(h.Site)
+			httpserver.BlockIP(ip, h.TTL)
+			log.Printf("[WARNING] honeypot: %s %s requested %s; blocked for %v", h.Site, ip, r.URL.Path, h.TTL)
+			// look like any other path that isn't there
+			if h.Tarpit.Delay > 0 {
+				return h.Tarpit.Respond(w, r, http.StatusNotFound)
+			}
+			return http.StatusNotFound, nil
+		}
+	}
+	return h.Next.ServeHTTP(w, r)
+}
+
+// crossSite returns whether r is a GET or HEAD request that a browser
+// made for another site, such as for an image on its page, which
+// anyone can have any visitor make.
+func crossSite(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "cross-site", "same-site":
+		return true
+	case "same-origin", "none":
+		return false
+	}
+	if referer := r.Header.Get("Referer"); referer != "" {
+		u, err := url.Parse(referer)
+		return err != nil || !strings.EqualFold(u.Host, r.Host)
+	}
+	return false
+}
+
+// trusted returns whether ip is in a trusted network.
+func (h Honeypot) trusted(ip string) bool {
+	if len(h.Trusted) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	for _, network := range h.Trusted {
+		if parsed != nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package honeypot
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+func TestHoneypot(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("203.0.113.0/24")
+	h := Honeypot{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Site:    "honeypot-test",
+		Paths:   []string{"/wp-login.php", "/.env"},
+		TTL:     time.Hour,
+		Trusted: []*net.IPNet{trusted},
+	}
+	defer httpserver.UnblockIP("198.51.100.1")
+	defer httpserver.UnblockIP("203.0.113.1")
+
+	for i, test := range []struct {
+		ip           string
+		path         string
+		expectStatus int
+	}{
+		{"198.51.100.1", "/", http.StatusOK},
+		{"198.51.100.1", "/wp-login.php", http.StatusNotFound},
+		{"198.51.100.1", "/", http.StatusForbidden}, // blocked now
+		{"198.51.100.2", "/", http.StatusOK},        // but not others
+		{"203.0.113.1", "/.env", http.StatusOK},     // trusted
+		{"203.0.113.1", "/", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.RemoteAddr = test.ip + ":1234"
+		status, err := h.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %v", i, err)
+		}
+		if status != test.expectStatus {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectStatus, status)
+		}
+	}
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	if expect := `caddy_http_honeypot_hits_total{site="honeypot-test"} 1`; !strings.Contains(buf.String(), expect) {
+		t.Errorf("Expected %s in:\n%s", expect, buf.String())
+	}
+}
+
+func TestHoneypotCrossSite(t *testing.T) {
+	h := Honeypot{
+		Next:  httpserver.EmptyNext,
+		Paths: []string{"/wp-login.php"},
+		TTL:   time.Hour,
+	}
+	for i, test := range []struct {
+		method      string
+		header      map[string]string
+		expectBlock bool
+	}{
+		{"GET", nil, true},
+		{"GET", map[string]string{"Sec-Fetch-Site": "none"}, true},
+		{"GET", map[string]string{"Sec-Fetch-Site": "same-origin"}, true},
+		{"GET", map[string]string{"Referer": "http://example.com/"}, true},
+		{"GET", map[string]string{"Sec-Fetch-Site": "cross-site"}, false},
+		{"GET", map[string]string{"Referer": "https://evil.test/page"}, false},
+		{"HEAD", map[string]string{"Sec-Fetch-Site": "same-site"}, false},
+		{"POST", map[string]string{"Sec-Fetch-Site": "cross-site"}, true},
+	} {
+		ip := fmt.Sprintf("198.51.100.%d", 100+i)
+		r := httptest.NewRequest(test.method, "http://example.com/wp-login.php", nil)
+		r.RemoteAddr = ip + ":1234"
+		for name, value := range test.header {
+			r.Header.Set(name, value)
+		}
+		if status, _ := h.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusNotFound {
+			t.Errorf("Test %d: expected status %d, got %d", i, http.StatusNotFound, status)
+		}
+		if blocked := httpserver.IPBlocked(ip); blocked != test.expectBlock {
+			t.Errorf("Test %d: expected blocked %v, got %v", i, test.expectBlock, blocked)
+		}
+		httpserver.UnblockIP(ip)
+	}
+}
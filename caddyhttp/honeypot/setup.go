@@ -0,0 +1,120 @@
+package honeypot
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("honeypot", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultTTL is how long clients that request decoy paths are blocked
+// by default.
+const defaultTTL = time.Hour
+
+// setup configures a new Honeypot middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	handler, err := honeypotParse(c)
+	if err != nil {
+		return err
+	}
+	handler.Site = cfg.Addr.String()
+	if !cfg.HasMiddleware("real_ip") && !cfg.HasMiddleware("realip") && len(cfg.ProxyProtocol) == 0 {
+		log.Printf("[WARNING] %s: honeypot blocks clients by the address they connect from; "+
+			"behind a proxy, without real_ip, that is the proxy's, and all clients would be blocked", handler.Site)
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		handler.Next = next
+		return handler
+	})
+
+	return nil
+}
+
+// honeypotParse parses
+//
+//	honeypot paths... {
+//		ttl    duration
+//		tarpit delay [trickle]
+//		trust  networks...
+//	}
+//
+// where the paths are the decoys, the ttl, an hour by default, is how
+// long clients that request them are blocked, the tarpit holds their
+// requests for them, and the networks, which may be IPs or CIDR
+// ranges, are those whose clients are never blocked. Browsers that
+// request the paths for the pages of other sites, which could have
+// any visitor request them, get 404s but aren't blocked.
+func honeypotParse(c *caddy.Controller) (Honeypot, error) {
+	handler := Honeypot{TTL: defaultTTL}
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return handler, c.Err("honeypot may only be given once per site")
+		}
+		parsed = true
+		handler.Paths = c.RemainingArgs()
+		if len(handler.Paths) == 0 {
+			return handler, c.ArgErr()
+		}
+		for _, p := range handler.Paths {
+			if !strings.HasPrefix(p, "/") {
+				return handler, c.Errf("honeypot path '%s' must start with /", p)
+			}
+			if p == "/" {
+				return handler, c.Err("honeypot path / would block every client")
+			}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "ttl":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return handler, c.Errf("invalid honeypot ttl '%s'", args[0])
+				}
+				handler.TTL = d
+			case "tarpit":
+				if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "trickle") {
+					return handler, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return handler, c.Errf("invalid tarpit delay '%s'", args[0])
+				}
+				handler.Tarpit = httpserver.Tarpit{Delay: d, Trickle: len(args) == 2}
+			case "trust":
+				if len(args) == 0 {
+					return handler, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := httpserver.ParseNetwork(arg)
+					if err != nil {
+						return handler, c.Err(err.Error())
+					}
+					handler.Trusted = append(handler.Trusted, network)
+				}
+			default:
+				return handler, c.Errf("Unknown honeypot property '%s'", what)
+			}
+		}
+	}
+
+	return handler, nil
+}
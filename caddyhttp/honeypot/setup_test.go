@@ -0,0 +1,123 @@
+package honeypot
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `honeypot /wp-login.php`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Honeypot)
+	if !ok {
+		t.Fatalf("Expected handler to be type Honeypot, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSetupWarnsWithoutRealIP(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	c := caddy.NewTestController("http", `honeypot /wp-login.php`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "[WARNING]") {
+		t.Errorf("Expected a warning without real_ip, got %q", buf.String())
+	}
+
+	buf.Reset()
+	c = caddy.NewTestController("http", `honeypot /wp-login.php`)
+	_, proxy, _ := net.ParseCIDR("10.0.0.0/8")
+	httpserver.GetConfig(c).ProxyProtocol = []*net.IPNet{proxy}
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no warning with the client addresses from proxies, got %q", buf.String())
+	}
+}
+
+func TestHoneypotParse(t *testing.T) {
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		expectPaths   []string
+		expectTTL     time.Duration
+		expectTarpit  httpserver.Tarpit
+		expectTrusted []string
+	}{
+		{`honeypot /wp-login.php /.env`, false, []string{"/wp-login.php", "/.env"}, defaultTTL, httpserver.Tarpit{}, nil},
+		{`honeypot /wp-admin {
+			ttl 24h
+			tarpit 30s trickle
+			trust 10.0.0.0/8 192.0.2.1
+		}`, false, []string{"/wp-admin"}, 24 * time.Hour, httpserver.Tarpit{Delay: 30 * time.Second, Trickle: true},
+			[]string{"10.0.0.0/8", "192.0.2.1/32"}},
+		{`honeypot`, true, nil, 0, httpserver.Tarpit{}, nil},
+		{`honeypot wp-login.php`, true, nil, 0, httpserver.Tarpit{}, nil},
+		{`honeypot /`, true, nil, 0, httpserver.Tarpit{}, nil},
+		{`honeypot /wp-admin {
+			ttl forever
+		}`, true, nil, 0, httpserver.Tarpit{}, nil},
+		{`honeypot /wp-admin {
+			tarpit 30s slowly
+		}`, true, nil, 0, httpserver.Tarpit{}, nil},
+		{`honeypot /wp-admin {
+			trust nowhere
+		}`, true, nil, 0, httpserver.Tarpit{}, nil},
+		{`honeypot /wp-admin {
+			block
+		}`, true, nil, 0, httpserver.Tarpit{}, nil},
+		{`honeypot /wp-admin
+		honeypot /.env`, true, nil, 0, httpserver.Tarpit{}, nil},
+	} {
+		handler, err := honeypotParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(handler.Paths, test.expectPaths) {
+			t.Errorf("Test %d: expected paths %v, got %v", i, test.expectPaths, handler.Paths)
+		}
+		if handler.TTL != test.expectTTL {
+			t.Errorf("Test %d: expected ttl %v, got %v", i, test.expectTTL, handler.TTL)
+		}
+		if handler.Tarpit != test.expectTarpit {
+			t.Errorf("Test %d: expected tarpit %+v, got %+v", i, test.expectTarpit, handler.Tarpit)
+		}
+		var trusted []string
+		for _, network := range handler.Trusted {
+			trusted = append(trusted, network.String())
+		}
+		if !reflect.DeepEqual(trusted, test.expectTrusted) {
+			t.Errorf("Test %d: expected trusted %v, got %v", i, test.expectTrusted, trusted)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package hsts implements the hsts directive, which sets the
+// Strict-Transport-Security header on responses served over HTTPS,
+// and checks whether sites meet the requirements of the HSTS preload
+// list before they ask to be included in it.
+package hsts
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DefaultMaxAge is the max-age of the policy when no other is given.
+const DefaultMaxAge = 365 * 24 * time.Hour
+
+// MinPreloadMaxAge is the shortest max-age accepted by the preload list.
+const MinPreloadMaxAge = 365 * 24 * time.Hour
+
+// HSTS is middleware that sets the Strict-Transport-Security header.
+type HSTS struct {
+	Next   httpserver.Handler
+	Policy *Policy
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (h HSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// browsers ignore the header over plaintext HTTP
+	if r.TLS != nil {
+		w.Header().Set("Strict-Transport-Security", h.Policy.Header())
+	}
+	return h.Next.ServeHTTP(w, r)
+}
+
+// Policy is the HSTS policy of a site.
+type Policy struct {
+	MaxAge            time.Duration
+	IncludeSubdomains bool
+
+	// Preload adds the preload token, which asks for the site
+	// to be included in the preload list.
+	Preload bool
+
+	// PreloadIfReady withholds the preload token while the site
+	// does not meet the requirements of the preload list.
+	PreloadIfReady bool
+
+	site     *httpserver.SiteConfig
+	withheld int32 // atomic; 1 while the preload token is withheld
+}
+
+// Header returns the value of the Strict-Transport-Security header.
+func (p *Policy) Header() string {
+	v := "max-age=" + strconv.FormatInt(int64(p.MaxAge/time.Second), 10)
+	if p.IncludeSubdomains {
+		v += "; includeSubDomains"
+	}
+	if p.Preload && atomic.LoadInt32(&p.withheld) == 0 {
+		v += "; preload"
+	}
+	return v
+}
+
+// Gaps returns what keeps the site from meeting the requirements of
+// the preload list, if anything, other than the preload token itself.
+func (p *Policy) Gaps() []string {
+	var gaps []string
+	if p.MaxAge < MinPreloadMaxAge {
+		gaps = append(gaps, fmt.Sprintf("max-age must be at least %d seconds, not %d",
+			int64(MinPreloadMaxAge/time.Second), int64(p.MaxAge/time.Second)))
+	}
+	if !p.IncludeSubdomains {
+		gaps = append(gaps, "include_subdomains is required")
+	}
+	if p.site == nil {
+		return gaps
+	}
+	host := p.site.Addr.Host
+	if base, err := publicsuffix.EffectiveTLDPlusOne(host); err != nil || base != host || net.ParseIP(host) != nil {
+		gaps = append(gaps, fmt.Sprintf("only registered domains can be preloaded, not '%s'", host))
+	}
+	if p.site.TLS == nil || !p.site.TLS.Enabled {
+		gaps = append(gaps, "the site is not served over HTTPS")
+	} else if !p.site.TLS.Managed || (p.site.HTTPSRedirect != nil && p.site.HTTPSRedirect.Off) {
+		gaps = append(gaps, "plaintext HTTP is not redirected to HTTPS automatically; make sure it is redirected to the same host")
+	} else if p.site.HTTPSRedirect != nil && len(p.site.HTTPSRedirect.Except) > 0 {
+		gaps = append(gaps, "paths excepted by https_redirect are served over plaintext HTTP")
+	}
+	return gaps
+}
+
+// check logs the gaps of a policy with the preload token, and
+// withholds the token while there are any if it is to be.
+func (p *Policy) check() error {
+	if !p.Preload {
+		return nil
+	}
+	gaps := p.Gaps()
+	for _, gap := range gaps {
+		log.Printf("[WARNING] %s: not ready for HSTS preload: %s", p.site.Addr, gap)
+	}
+	if p.PreloadIfReady && len(gaps) > 0 {
+		log.Printf("[WARNING] %s: withholding the HSTS preload token", p.site.Addr)
+		atomic.StoreInt32(&p.withheld, 1)
+	} else {
+		atomic.StoreInt32(&p.withheld, 0)
+	}
+	return nil
+}
+
+// Report is the preload readiness of the HSTS policy of a site.
+type Report struct {
+	Site   string   `json:"site"`
+	Header string   `json:"header"`
+	Ready  bool     `json:"ready"`
+	Gaps   []string `json:"gaps,omitempty"`
+}
+
+// policies are the HSTS policies of sites, by site address.
+var (
+	policies   = make(map[string]*Policy)
+	policiesMu sync.Mutex
+)
+
+// register makes p the policy of the site with address addr.
+func register(addr string, p *Policy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[addr] = p
+}
+
+// unregister removes the policy of the site with address addr, if it
+// is still p rather than that of the configuration that replaced it.
+func unregister(addr string, p *Policy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	if policies[addr] == p {
+		delete(policies, addr)
+	}
+}
+
+// Reports returns the preload readiness of the site with address
+// site, or of all sites with an HSTS policy if site is empty, sorted
+// by site address.
+func Reports(site string) []Report {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	reports := []Report{}
+	for addr, p := range policies {
+		if site != "" && addr != site {
+			continue
+		}
+		gaps := p.Gaps()
+		if !p.Preload {
+			gaps = append(gaps, "the preload token is missing")
+		}
+		reports = append(reports, Report{
+			Site:   addr,
+			Header: p.Header(),
+			Ready:  len(gaps) == 0,
+			Gaps:   gaps,
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Site < reports[j].Site })
+	return reports
+}
@@ -0,0 +1,137 @@
+package hsts
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestHSTS(t *testing.T) {
+	h := HSTS{
+		Next:   httpserver.EmptyNext,
+		Policy: &Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true, Preload: true},
+	}
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.TLS = new(tls.ConnectionState)
+	rec := httptest.NewRecorder()
+	if _, err := h.ServeHTTP(rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.Header().Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains; preload"; got != want {
+		t.Errorf("Expected header %q, got %q", want, got)
+	}
+
+	req = httptest.NewRequest("GET", "http://example.com/", nil)
+	rec = httptest.NewRecorder()
+	if _, err := h.ServeHTTP(rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Expected no header over plaintext HTTP, got %q", got)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	managed := &caddytls.Config{Enabled: true, Managed: true}
+	for i, test := range []struct {
+		policy   Policy
+		site     *httpserver.SiteConfig
+		expected int
+	}{
+		{Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}, TLS: managed}, 0},
+		{Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.co.uk"}, TLS: managed}, 0},
+		{Policy{MaxAge: time.Hour},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}, TLS: managed}, 2},
+		{Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "www.example.com"}, TLS: managed}, 1},
+		{Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}, TLS: new(caddytls.Config)}, 1},
+		{Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}, TLS: &caddytls.Config{Enabled: true, Manual: true}}, 1},
+		{Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}, TLS: managed,
+				HTTPSRedirect: &httpserver.HTTPSRedirect{Off: true}}, 1},
+		{Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true},
+			&httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}, TLS: managed,
+				HTTPSRedirect: &httpserver.HTTPSRedirect{Except: []string{"/health"}}}, 1},
+	} {
+		p := test.policy
+		p.site = test.site
+		if gaps := p.Gaps(); len(gaps) != test.expected {
+			t.Errorf("Test %d: Expected %d gaps, got %d: %v", i, test.expected, len(gaps), gaps)
+		}
+	}
+}
+
+func TestPreloadIfReady(t *testing.T) {
+	p := &Policy{
+		MaxAge:         time.Hour,
+		Preload:        true,
+		PreloadIfReady: true,
+		site:           &httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}},
+	}
+	p.check()
+	if got, want := p.Header(), "max-age=3600"; got != want {
+		t.Errorf("Expected preload token to be withheld, got %q", got)
+	}
+
+	p.MaxAge = DefaultMaxAge
+	p.IncludeSubdomains = true
+	p.site.TLS = &caddytls.Config{Enabled: true, Managed: true}
+	p.check()
+	if got, want := p.Header(), "max-age=31536000; includeSubDomains; preload"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestReports(t *testing.T) {
+	register("https://ready.example", &Policy{
+		MaxAge: DefaultMaxAge, IncludeSubdomains: true, Preload: true,
+		site: &httpserver.SiteConfig{Addr: httpserver.Address{Host: "example.com"}, TLS: &caddytls.Config{Enabled: true, Managed: true}},
+	})
+	register("https://notready.example", &Policy{MaxAge: DefaultMaxAge})
+	defer func() {
+		policiesMu.Lock()
+		delete(policies, "https://ready.example")
+		delete(policies, "https://notready.example")
+		policiesMu.Unlock()
+	}()
+
+	reports := Reports("")
+	if len(reports) != 2 {
+		t.Fatalf("Expected 2 reports, got %d", len(reports))
+	}
+	if reports[0].Site != "https://notready.example" || reports[0].Ready || len(reports[0].Gaps) != 2 {
+		t.Errorf("Expected site not to be ready for lack of include_subdomains and preload, got %+v", reports[0])
+	}
+	if !reports[1].Ready || len(reports[1].Gaps) != 0 {
+		t.Errorf("Expected site to be ready, got %+v", reports[1])
+	}
+	if len(Reports("https://ready.example")) != 1 {
+		t.Error("Expected the report of the site asked for only")
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	old, replacement := &Policy{MaxAge: DefaultMaxAge}, &Policy{MaxAge: time.Hour}
+	register("https://site.example", old)
+	register("https://site.example", replacement)
+
+	// the configuration that was replaced shuts down after the new
+	// one starts
+	unregister("https://site.example", old)
+	if reports := Reports("https://site.example"); len(reports) != 1 || reports[0].Header != replacement.Header() {
+		t.Errorf("Expected the policy of the new configuration to be kept, got %+v", reports)
+	}
+	unregister("https://site.example", replacement)
+	if reports := Reports("https://site.example"); len(reports) != 0 {
+		t.Errorf("Expected no policy once the site is gone, got %+v", reports)
+	}
+}
@@ -0,0 +1,99 @@
+package hsts
+
+import (
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("hsts", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new HSTS middleware instance.
+func setup(c *caddy.Controller) error {
+	p, err := hstsParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	p.site = cfg
+	addr := cfg.Addr.String()
+	// only the sites of the running configuration are reported, not
+	// those of one that is only checked or has been replaced
+	c.OnStartup(func() error {
+		register(addr, p)
+		return p.check()
+	})
+	c.OnShutdown(func() error {
+		unregister(addr, p)
+		return nil
+	})
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return HSTS{Next: next, Policy: p}
+	})
+
+	return nil
+}
+
+// hstsParse parses
+//
+//	hsts [max_age] {
+//		include_subdomains
+//		preload [if_ready]
+//	}
+//
+// where max_age is a duration, a year by default. With if_ready, the
+// preload token is withheld while the site does not meet the
+// requirements of the preload list; either way, what it lacks is
+// logged at startup.
+func hstsParse(c *caddy.Controller) (*Policy, error) {
+	var p *Policy
+
+	for c.Next() {
+		if p != nil {
+			return nil, c.Err("hsts may only be given once per site")
+		}
+		p = &Policy{MaxAge: DefaultMaxAge}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			d, err := time.ParseDuration(args[0])
+			if err != nil || d < 0 {
+				return nil, c.Errf("Bad hsts max_age '%s'", args[0])
+			}
+			p.MaxAge = d
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "include_subdomains":
+				if len(args) != 0 {
+					return nil, c.ArgErr()
+				}
+				p.IncludeSubdomains = true
+			case "preload":
+				if len(args) > 1 || (len(args) == 1 && args[0] != "if_ready") {
+					return nil, c.ArgErr()
+				}
+				p.Preload = true
+				p.PreloadIfReady = len(args) == 1
+			default:
+				return nil, c.Errf("Unknown hsts property '%s'", what)
+			}
+		}
+	}
+
+	return p, nil
+}
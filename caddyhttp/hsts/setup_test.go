@@ -0,0 +1,72 @@
+package hsts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `hsts`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(HSTS)
+	if !ok {
+		t.Fatalf("Expected handler to be type HSTS, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	// the site is reported once its configuration starts
+	if reports := Reports(httpserver.GetConfig(c).Addr.String()); len(reports) != 0 {
+		t.Errorf("Expected no report of a site that hasn't started, got %+v", reports)
+	}
+}
+
+func TestHSTSParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  Policy
+	}{
+		{`hsts`, false, Policy{MaxAge: DefaultMaxAge}},
+		{`hsts 1h`, false, Policy{MaxAge: time.Hour}},
+		{`hsts 0s`, false, Policy{}},
+		{"hsts {\n include_subdomains \n preload \n}", false, Policy{MaxAge: DefaultMaxAge, IncludeSubdomains: true, Preload: true}},
+		{"hsts {\n preload if_ready \n}", false, Policy{MaxAge: DefaultMaxAge, Preload: true, PreloadIfReady: true}},
+		{`hsts forever`, true, Policy{}},
+		{`hsts -1h`, true, Policy{}},
+		{`hsts 1h 2h`, true, Policy{}},
+		{"hsts {\n include_subdomains yes \n}", true, Policy{}},
+		{"hsts {\n preload always \n}", true, Policy{}},
+		{"hsts {\n foo \n}", true, Policy{}},
+		{"hsts\nhsts", true, Policy{}},
+	}
+	for i, test := range tests {
+		p, err := hstsParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, but had none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, but got: %v", i, err)
+			continue
+		}
+		if p.MaxAge != test.expected.MaxAge || p.IncludeSubdomains != test.expected.IncludeSubdomains ||
+			p.Preload != test.expected.Preload || p.PreloadIfReady != test.expected.PreloadIfReady {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, *p)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package httpserver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchivePrefix marks a root as the path of an archive, as in
+// "root archive:/srv/site.zip".
+const ArchivePrefix = "archive:"
+
+// archiveCheckInterval is how often, at most, an archive is
+// checked for having been replaced.
+const archiveCheckInterval = time.Second
+
+// Archive is an http.FileSystem of the files in a zip or tar
+// archive, optionally gzipped, so that a site can be deployed as
+// a single file. The archive is read again when its modification
+// time or size changes, so that it can be replaced while serving,
+// by renaming a new archive over it.
+//
+// Files stored without compression, and those of a tar archive,
+// are read from the archive as they are served; a gzipped tar
+// archive is decompressed into a temporary file first. Compressed
+// files of a zip archive are decompressed into memory when opened,
+// and kept there if they're small, until the archive changes.
+type Archive struct {
+	path string
+
+	mu      sync.Mutex
+	index   *archiveIndex
+	checked time.Time // when the archive was last checked
+}
+
+// OpenArchive opens the archive at path, which is a .zip, .tar,
+// .tar.gz or .tgz file.
+func OpenArchive(path string) (*Archive, error) {
+	a := &Archive{path: path}
+	index, err := a.current()
+	if err != nil {
+		return nil, err
+	}
+	index.release()
+	return a, nil
+}
+
+// Path returns the path of the archive.
+func (a *Archive) Path() string { return a.path }
+
+// Open implements http.FileSystem.
+func (a *Archive) Open(name string) (http.File, error) {
+	index, err := a.current()
+	if err != nil {
+		return nil, err
+	}
+	name = path.Clean("/" + name)
+	entry, ok := index.entries[name]
+	if !ok {
+		index.release()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	var content io.ReadSeeker = strings.NewReader("")
+	if entry.open != nil {
+		if content, err = index.open(name, entry); err != nil {
+			index.release()
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return &archiveFile{ReadSeeker: content, entry: entry, index: index}, nil
+}
+
+// current returns the index of the archive, read again if the
+// archive changed, for the caller to release once done with it. If
+// the archive can't be read again, the last index is kept, so that
+// a failed deployment doesn't take the site down.
+func (a *Archive) current() (*archiveIndex, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.index != nil && time.Since(a.checked) < archiveCheckInterval {
+		a.index.acquire()
+		return a.index, nil
+	}
+	a.checked = time.Now()
+	info, err := os.Stat(a.path)
+	if err == nil && a.index != nil && info.ModTime().Equal(a.index.modTime) && info.Size() == a.index.size {
+		a.index.acquire()
+		return a.index, nil
+	}
+	var index *archiveIndex
+	if err == nil {
+		index, err = readArchive(a.path, info)
+	}
+	if err != nil {
+		if a.index != nil {
+			log.Printf("[ERROR] Reading archive %s again: %v", a.path, err)
+			a.index.acquire()
+			return a.index, nil
+		}
+		return nil, err
+	}
+	if a.index != nil {
+		log.Printf("[INFO] Archive %s changed; serving the new contents", a.path)
+		// files of the last index may still be being served, so
+		// its archive is closed once they are done
+		a.index.retire()
+	}
+	a.index = index
+	index.acquire()
+	return index, nil
+}
+
+// maxArchiveCacheFile and maxArchiveCache are how big a compressed
+// file of a zip archive may be, and all of them together, to be
+// kept in memory once decompressed.
+const (
+	maxArchiveCacheFile = 1 << 20
+	maxArchiveCache     = 32 << 20
+)
+
+// archiveIndex is the contents of an archive, as read at a
+// modification time and size.
+type archiveIndex struct {
+	modTime time.Time
+	size    int64
+	entries map[string]*archiveEntry // by clean path, as "/dir/file"
+
+	file *os.File // that the entries are read from
+	temp bool     // whether file is temporary, and removed once closed
+
+	mu      sync.Mutex
+	refs    int               // the files open, and callers of current
+	retired bool              // whether the archive has been replaced
+	cache   map[string][]byte // decompressed files, by path
+	cached  int               // bytes in cache
+}
+
+// acquire records that the index is in use.
+func (index *archiveIndex) acquire() {
+	index.mu.Lock()
+	index.refs++
+	index.mu.Unlock()
+}
+
+// release records that the index is no longer in use by one of
+// those that acquired it, and closes it if it has been retired and
+// nothing uses it.
+func (index *archiveIndex) release() {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.refs--
+	if index.retired && index.refs == 0 {
+		index.close()
+	}
+}
+
+// retire closes the index of an archive that has been replaced, or
+// has it closed once the files open in it are.
+func (index *archiveIndex) retire() {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.retired = true
+	if index.refs == 0 {
+		index.close()
+	}
+}
+
+// close closes the file of the index. index.mu must be locked.
+func (index *archiveIndex) close() {
+	index.file.Close()
+	if index.temp {
+		os.Remove(index.file.Name())
+	}
+	index.cache = nil
+}
+
+// open returns the contents of the file entry at name, from the
+// cache if they're in it.
+func (index *archiveIndex) open(name string, entry *archiveEntry) (io.ReadSeeker, error) {
+	if entry.decompress == nil {
+		return entry.open()
+	}
+	index.mu.Lock()
+	contents, ok := index.cache[name]
+	index.mu.Unlock()
+	if ok {
+		return bytes.NewReader(contents), nil
+	}
+	contents, err := entry.decompress()
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) <= maxArchiveCacheFile {
+		index.mu.Lock()
+		if index.cache != nil && index.cached+len(contents) <= maxArchiveCache {
+			index.cache[name] = contents
+			index.cached += len(contents)
+		}
+		index.mu.Unlock()
+	}
+	return bytes.NewReader(contents), nil
+}
+
+// archiveEntry is a file or directory of an archive.
+type archiveEntry struct {
+	info     os.FileInfo
+	children []os.FileInfo                 // of a directory, sorted by name
+	open     func() (io.ReadSeeker, error) // of a file
+	listed   bool                          // whether it is among the children of its directory
+
+	// decompress returns the contents of a file that is compressed,
+	// which open returns a reader of
+	decompress func() ([]byte, error)
+}
+
+// readArchive reads the index of the archive at name, of which
+// info is the file info.
+func readArchive(name string, info os.FileInfo) (*archiveIndex, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	index := &archiveIndex{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		entries: make(map[string]*archiveEntry),
+		file:    f,
+		cache:   make(map[string][]byte),
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = index.readZip(f, info.Size())
+	case strings.HasSuffix(lower, ".tar"):
+		err = index.readTar(f, f)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		index.file, err = gunzip(f)
+		f.Close()
+		if err == nil {
+			index.temp = true
+			err = index.readTar(index.file, index.file)
+		}
+	default:
+		err = fmt.Errorf("not a .zip, .tar, .tar.gz or .tgz archive")
+	}
+	if err != nil {
+		if index.file != nil {
+			index.close()
+		}
+		return nil, err
+	}
+	index.addDirs()
+	return index, nil
+}
+
+// gunzip returns a temporary file of the decompressed contents of
+// r, to be read from the start.
+func gunzip(r io.Reader) (*os.File, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	f, err := ioutil.TempFile("", "caddy-archive-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(f, zr); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// readZip adds the files of the zip archive in ra, of size bytes.
+func (index *archiveIndex) readZip(ra io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		zf := zf
+		entry := &archiveEntry{info: zf.FileInfo()}
+		if !entry.info.IsDir() {
+			if !entry.info.Mode().IsRegular() {
+				continue // such as symbolic links
+			}
+			offset, err := zf.DataOffset()
+			if err != nil {
+				return err
+			}
+			if zf.Method == zip.Store {
+				entry.open = func() (io.ReadSeeker, error) {
+					return io.NewSectionReader(ra, offset, int64(zf.UncompressedSize64)), nil
+				}
+			} else {
+				entry.decompress = func() ([]byte, error) {
+					rc, err := zf.Open()
+					if err != nil {
+						return nil, err
+					}
+					defer rc.Close()
+					return ioutil.ReadAll(rc)
+				}
+				entry.open = func() (io.ReadSeeker, error) {
+					contents, err := entry.decompress()
+					if err != nil {
+						return nil, err
+					}
+					return bytes.NewReader(contents), nil
+				}
+			}
+		}
+		index.add(zf.Name, entry)
+	}
+	return nil
+}
+
+// readTar adds the files of the tar archive read from r, which are
+// then read from ra at their offsets.
+func (index *archiveIndex) readTar(r io.Reader, ra io.ReaderAt) error {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := &archiveEntry{info: hdr.FileInfo()}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg, tar.TypeRegA:
+			offset, size := cr.n, hdr.Size
+			entry.open = func() (io.ReadSeeker, error) {
+				return io.NewSectionReader(ra, offset, size), nil
+			}
+		default:
+			continue // such as links and devices
+		}
+		index.add(hdr.Name, entry)
+	}
+}
+
+// add adds entry at name, a path in the archive.
+func (index *archiveIndex) add(name string, entry *archiveEntry) {
+	index.entries[path.Clean("/"+name)] = entry
+}
+
+// addDirs adds the directories that the archive only implies, and
+// lists the children of all of them.
+func (index *archiveIndex) addDirs() {
+	if _, ok := index.entries["/"]; !ok {
+		index.entries["/"] = &archiveEntry{info: archiveDirInfo{name: "/", modTime: index.modTime}}
+	}
+	var names []string
+	for name := range index.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for name != "/" {
+			dir := path.Dir(name)
+			parent, ok := index.entries[dir]
+			if !ok {
+				parent = &archiveEntry{info: archiveDirInfo{name: path.Base(dir), modTime: index.modTime}}
+				index.entries[dir] = parent
+			}
+			entry := index.entries[name]
+			if entry.listed {
+				break
+			}
+			entry.listed = true
+			parent.children = append(parent.children, entry.info)
+			name = dir
+		}
+	}
+	for _, entry := range index.entries {
+		sort.Slice(entry.children, func(i, j int) bool {
+			return entry.children[i].Name() < entry.children[j].Name()
+		})
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// archiveDirInfo is the file info of a directory that an archive
+// only implies.
+type archiveDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (fi archiveDirInfo) Name() string       { return fi.name }
+func (fi archiveDirInfo) Size() int64        { return 0 }
+func (fi archiveDirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (fi archiveDirInfo) ModTime() time.Time { return fi.modTime }
+func (fi archiveDirInfo) IsDir() bool        { return true }
+func (fi archiveDirInfo) Sys() interface{}   { return nil }
+
+// archiveFile is an open file or directory of an archive.
+type archiveFile struct {
+	io.ReadSeeker
+	entry  *archiveEntry
+	index  *archiveIndex
+	closed bool
+	dirPos int // how many children Readdir returned
+}
+
+// Close implements http.File.
+func (f *archiveFile) Close() error {
+	if !f.closed {
+		f.closed = true
+		f.index.release()
+	}
+	return nil
+}
+
+// Stat implements http.File.
+func (f *archiveFile) Stat() (os.FileInfo, error) { return f.entry.info, nil }
+
+// Readdir implements http.File.
+func (f *archiveFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.entry.info.IsDir() {
+		return nil, errors.New("not a directory")
+	}
+	rest := f.entry.children[f.dirPos:]
+	if count <= 0 {
+		f.dirPos += len(rest)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	f.dirPos += count
+	return rest[:count], nil
+}
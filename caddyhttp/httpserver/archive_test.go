@@ -0,0 +1,292 @@
+package httpserver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// archiveTestFiles are the files of the test archives, without
+// entries for their directories.
+var archiveTestFiles = map[string]string{
+	"index.html":       "<h1>home</h1>",
+	"css/site.css":     "body { margin: 0 }",
+	"docs/a/page.html": "0123456789",
+}
+
+func writeZip(t *testing.T, name string, files map[string]string) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for fname, content := range files {
+		method := zip.Deflate
+		if filepath.Ext(fname) == ".html" {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: fname, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, name string, files map[string]string, gzipped bool) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if gzipped {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	tw.WriteHeader(&tar.Header{Name: "./docs/", Typeflag: tar.TypeDir, Mode: 0755})
+	for fname, content := range files {
+		hdr := &tar.Header{Name: "./" + fname, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		zw.Close()
+	}
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := map[string]func(string){
+		"site.zip":    func(name string) { writeZip(t, name, archiveTestFiles) },
+		"site.tar":    func(name string) { writeTar(t, name, archiveTestFiles, false) },
+		"site.tar.gz": func(name string) { writeTar(t, name, archiveTestFiles, true) },
+	}
+	for base, write := range paths {
+		name := filepath.Join(dir, base)
+		write(name)
+		a, err := OpenArchive(name)
+		if err != nil {
+			t.Fatalf("%s: Expected no error opening archive, got %v", base, err)
+		}
+
+		for fname, content := range archiveTestFiles {
+			f, err := a.Open("/" + fname)
+			if err != nil {
+				t.Errorf("%s: Expected no error opening %s, got %v", base, fname, err)
+				continue
+			}
+			actual, _ := ioutil.ReadAll(f)
+			f.Close()
+			if string(actual) != content {
+				t.Errorf("%s: Expected %s to contain '%s', got '%s'", base, fname, content, actual)
+			}
+		}
+
+		// ranges are read by seeking
+		f, err := a.Open("/docs/a/page.html")
+		if err != nil {
+			t.Fatalf("%s: Expected no error, got %v", base, err)
+		}
+		f.Seek(4, io.SeekStart)
+		part := make([]byte, 3)
+		io.ReadFull(f, part)
+		if string(part) != "456" {
+			t.Errorf("%s: Expected to read '456' at offset 4, got '%s'", base, part)
+		}
+		if info, _ := f.Stat(); info.Name() != "page.html" || info.Size() != 10 || info.IsDir() {
+			t.Errorf("%s: Expected info of page.html of 10 bytes, got %s of %d", base, info.Name(), info.Size())
+		}
+
+		// directories are implied, and list their children
+		for dirName, expected := range map[string][]string{
+			"/":       {"css", "docs", "index.html"},
+			"/docs":   {"a"},
+			"/docs/a": {"page.html"},
+		} {
+			d, err := a.Open(dirName)
+			if err != nil {
+				t.Errorf("%s: Expected no error opening %s, got %v", base, dirName, err)
+				continue
+			}
+			if info, _ := d.Stat(); !info.IsDir() {
+				t.Errorf("%s: Expected %s to be a directory", base, dirName)
+			}
+			infos, _ := d.Readdir(-1)
+			var names []string
+			for _, info := range infos {
+				names = append(names, info.Name())
+			}
+			if len(names) != len(expected) {
+				t.Errorf("%s: Expected %s to list %v, got %v", base, dirName, expected, names)
+				continue
+			}
+			for i := range names {
+				if names[i] != expected[i] {
+					t.Errorf("%s: Expected %s to list %v, got %v", base, dirName, expected, names)
+					break
+				}
+			}
+		}
+
+		for _, missing := range []string{"/nope.html", "/link", "/index.html/x"} {
+			if _, err := a.Open(missing); !os.IsNotExist(err) {
+				t.Errorf("%s: Expected %s not to exist, got %v", base, missing, err)
+			}
+		}
+	}
+
+	if _, err := OpenArchive(filepath.Join(dir, "missing.zip")); err == nil {
+		t.Error("Expected an error opening a missing archive, got none")
+	}
+	other := filepath.Join(dir, "site.rar")
+	ioutil.WriteFile(other, []byte("rar"), 0644)
+	if _, err := OpenArchive(other); err == nil {
+		t.Error("Expected an error opening an unknown kind of archive, got none")
+	}
+}
+
+func TestArchiveReplaced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "site.zip")
+	writeZip(t, name, map[string]string{"index.html": "v1"})
+	a, err := OpenArchive(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func() string {
+		a.mu.Lock()
+		a.checked = time.Time{} // don't wait to check it again
+		a.mu.Unlock()
+		f, err := a.Open("/index.html")
+		if err != nil {
+			return err.Error()
+		}
+		defer f.Close()
+		content, _ := ioutil.ReadAll(f)
+		return string(content)
+	}
+
+	// archives are replaced by renaming new ones over them
+	next := filepath.Join(dir, "next.zip")
+	writeZip(t, next, map[string]string{"index.html": "v2!"})
+	os.Rename(next, name)
+	if actual := read(); actual != "v2!" {
+		t.Errorf("Expected the replaced archive to be served, got '%s'", actual)
+	}
+
+	// a broken deployment leaves the last contents in place
+	ioutil.WriteFile(next, []byte("not a zip file at all"), 0644)
+	os.Rename(next, name)
+	if actual := read(); actual != "v2!" {
+		t.Errorf("Expected the last archive to be kept, got '%s'", actual)
+	}
+}
+
+func TestArchiveClosedWhenReplaced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "site.tar.gz")
+	writeTar(t, name, map[string]string{"index.html": "v1"}, true)
+	a, err := OpenArchive(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := a.index
+	if !old.temp {
+		t.Fatal("Expected a gzipped archive to be decompressed into a temporary file")
+	}
+
+	// a file still being served keeps the last archive open
+	f, err := a.Open("/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := filepath.Join(dir, "next.tar.gz")
+	writeTar(t, next, map[string]string{"index.html": "v2!"}, true)
+	os.Rename(next, name)
+	a.mu.Lock()
+	a.checked = time.Time{}
+	a.mu.Unlock()
+	g, err := a.Open("/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Close()
+	if content, _ := ioutil.ReadAll(f); string(content) != "v1" {
+		t.Errorf("Expected the file open before the archive was replaced to read 'v1', got '%s'", content)
+	}
+	if _, err := os.Stat(old.file.Name()); err != nil {
+		t.Errorf("Expected the temporary file to be kept while a file is open, got %v", err)
+	}
+
+	f.Close()
+	f.Close()
+	if _, err := os.Stat(old.file.Name()); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be removed once the last file is closed, got %v", err)
+	}
+	if _, err := old.file.Stat(); err == nil {
+		t.Error("Expected the replaced archive to be closed")
+	}
+	if a.index.refs != 0 {
+		t.Errorf("Expected no references to the current archive, got %d", a.index.refs)
+	}
+}
+
+func TestArchiveCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "site.zip")
+	writeZip(t, name, archiveTestFiles)
+	a, err := OpenArchive(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		f, err := a.Open("/css/site.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		if string(content) != archiveTestFiles["css/site.css"] {
+			t.Errorf("Read %d: Expected the decompressed file, got '%s'", i, content)
+		}
+	}
+	if _, ok := a.index.cache["/css/site.css"]; !ok || len(a.index.cache) != 1 {
+		t.Errorf("Expected only the compressed file to be cached, got %v", a.index.cache)
+	}
+}
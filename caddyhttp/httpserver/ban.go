@@ -0,0 +1,162 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+var (
+	bannedConnections = metrics.NewCounter("caddy_http_banned_connections_total",
+		"Number of connections closed because their client IP was banned, by listener address.",
+		"server")
+	bannedIPs = metrics.NewGauge("caddy_http_banned_ips",
+		"Number of client IPs banned.")
+)
+
+// Ban is a client IP that is banned for a while, such as for failing
+// to log in too often.
+type Ban struct {
+	IP     string    `json:"ip"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+}
+
+// bans are the banned client IPs. Like the blocklist, they belong to
+// the process, so that they outlive reloads; but the listeners of
+// sites that refuse banned clients close their connections as soon
+// as they are accepted.
+var bans = struct {
+	sync.Mutex
+	byIP      map[string]Ban
+	lastSweep time.Time
+}{byIP: make(map[string]Ban)}
+
+// BanIP bans ip for d, for reason, or for longer if it's already
+// banned for longer.
+func BanIP(ip string, d time.Duration, reason string) {
+	now := time.Now()
+	bans.Lock()
+	defer bans.Unlock()
+
+	if now.Sub(bans.lastSweep) > time.Minute {
+		for ip, ban := range bans.byIP {
+			if !now.Before(ban.Until) {
+				delete(bans.byIP, ip)
+			}
+		}
+		bans.lastSweep = now
+	}
+	if until := now.Add(d); until.After(bans.byIP[ip].Until) {
+		bans.byIP[ip] = Ban{IP: ip, Until: until, Reason: reason}
+	}
+	bannedIPs.Set(float64(len(bans.byIP)))
+}
+
+// UnbanIP lifts the ban of ip, and returns whether it was banned.
+func UnbanIP(ip string) bool {
+	bans.Lock()
+	defer bans.Unlock()
+	ban, ok := bans.byIP[ip]
+	delete(bans.byIP, ip)
+	bannedIPs.Set(float64(len(bans.byIP)))
+	return ok && time.Now().Before(ban.Until)
+}
+
+// IPBanned returns whether ip is banned.
+func IPBanned(ip string) bool {
+	bans.Lock()
+	defer bans.Unlock()
+	ban, ok := bans.byIP[ip]
+	return ok && time.Now().Before(ban.Until)
+}
+
+// Bans returns the bans in effect, by IP.
+func Bans() []Ban {
+	now := time.Now()
+	bans.Lock()
+	list := make([]Ban, 0, len(bans.byIP))
+	for _, ban := range bans.byIP {
+		if now.Before(ban.Until) {
+			list = append(list, ban)
+		}
+	}
+	bans.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].IP < list[j].IP })
+	return list
+}
+
+// refuseBanned returns whether the listener of group refuses banned
+// clients, as it does if any of its sites do.
+func refuseBanned(group []*SiteConfig) bool {
+	for _, site := range group {
+		if site.RefuseBanned {
+			return true
+		}
+	}
+	return false
+}
+
+// banListener closes the connections of banned clients as soon as it
+// accepts them, or, for those whose address comes in a PROXY protocol
+// header, as soon as they're read from, so that a slow peer can't
+// hold up other connections.
+type banListener struct {
+	net.Listener
+	server string // the address of the listener
+}
+
+// Accept accepts the next connection of a client that isn't known to
+// be banned.
+func (l *banListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := conn.(*proxyProtocolConn); ok {
+			return &banConn{Conn: conn, server: l.server}, nil
+		}
+		if connBanned(conn) {
+			bannedConnections.Inc(l.server)
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// connBanned returns whether the client of conn is banned.
+func connBanned(conn net.Conn) bool {
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	return ok && IPBanned(tcpAddr.IP.String())
+}
+
+// banConn is a connection that is closed on first read if its client
+// is banned.
+type banConn struct {
+	net.Conn
+	server string
+
+	once sync.Once
+	err  error
+}
+
+// Read reads from the connection of a client that isn't banned.
+func (c *banConn) Read(b []byte) (int, error) {
+	c.once.Do(func() {
+		if connBanned(c.Conn) {
+			bannedConnections.Inc(c.server)
+			c.Conn.Close()
+			c.err = fmt.Errorf("client %s is banned", c.Conn.RemoteAddr())
+		}
+	})
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Read(b)
+}
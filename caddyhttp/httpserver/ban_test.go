@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBans(t *testing.T) {
+	const ip = "198.51.100.20"
+	defer UnbanIP(ip)
+
+	BanIP(ip, time.Hour, "testing")
+	if !IPBanned(ip) {
+		t.Fatal("Expected the IP to be banned")
+	}
+	BanIP(ip, time.Minute, "again")
+	found := false
+	for _, ban := range Bans() {
+		if ban.IP == ip {
+			found = true
+			if ban.Reason != "testing" || time.Until(ban.Until) < 59*time.Minute {
+				t.Errorf("Expected the longer ban to stay, got %+v", ban)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the ban to be listed, got %+v", Bans())
+	}
+	if !UnbanIP(ip) {
+		t.Error("Expected the ban to be lifted")
+	}
+	if IPBanned(ip) || UnbanIP(ip) {
+		t.Error("Expected the IP not to be banned any more")
+	}
+}
+
+func TestBanListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := &banListener{Listener: inner, server: "test"}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	BanIP("127.0.0.1", time.Hour, "testing")
+	banned, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer banned.Close()
+	banned.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := banned.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected the connection of a banned client to be closed")
+	} else if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		t.Error("Expected the connection of a banned client to be closed, but it stayed open")
+	}
+
+	UnbanIP("127.0.0.1")
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Error("Expected the connection of a client no longer banned to be accepted")
+	}
+
+	if !refuseBanned([]*SiteConfig{{}, {RefuseBanned: true}}) || refuseBanned([]*SiteConfig{{}}) {
+		t.Error("Expected the listener to refuse banned clients if any of its sites do")
+	}
+}
+
+func TestBanListenerProxyProtocol(t *testing.T) {
+	const ip = "192.0.2.30"
+	defer UnbanIP(ip)
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trusted, _ := net.ParseCIDR("127.0.0.0/8")
+	ln := &banListener{Listener: &proxyProtocolListener{Listener: inner, trusted: []*net.IPNet{trusted}}, server: "test"}
+	defer ln.Close()
+
+	// a peer yet to send its header doesn't hold up the next one
+	slow, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	select {
+	case c := <-accepted:
+		defer c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("Expected a connection to be accepted before its PROXY protocol header is read")
+	}
+
+	BanIP(ip, time.Hour, "testing")
+	banned, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer banned.Close()
+	banned.Write([]byte("PROXY TCP4 " + ip + " 198.51.100.1 56324 443\r\nhello"))
+	c := <-accepted
+	defer c.Close()
+	if _, err := c.Read(make([]byte, 5)); err == nil {
+		t.Error("Expected reading from the connection of a banned client to fail")
+	}
+}
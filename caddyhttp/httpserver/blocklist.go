@@ -0,0 +1,57 @@
+package httpserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+var blockedIPs = metrics.NewGauge("caddy_http_blocked_ips",
+	"Number of client IPs on the blocklist.")
+
+// blocklist is the list of client IPs blocked by all sites, such as
+// by honeypots. It belongs to the process, not to a server instance,
+// so that it outlives reloads.
+var blocklist = struct {
+	sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+}{expires: make(map[string]time.Time)}
+
+// BlockIP puts ip on the blocklist for ttl, or longer if it's already
+// on it for longer.
+func BlockIP(ip string, ttl time.Duration) {
+	now := time.Now()
+	blocklist.Lock()
+	defer blocklist.Unlock()
+
+	if now.Sub(blocklist.lastSweep) > time.Minute {
+		for ip, expires := range blocklist.expires {
+			if !now.Before(expires) {
+				delete(blocklist.expires, ip)
+			}
+		}
+		blocklist.lastSweep = now
+	}
+	if expires := now.Add(ttl); expires.After(blocklist.expires[ip]) {
+		blocklist.expires[ip] = expires
+	}
+	blockedIPs.Set(float64(len(blocklist.expires)))
+}
+
+// UnblockIP takes ip off the blocklist.
+func UnblockIP(ip string) {
+	blocklist.Lock()
+	defer blocklist.Unlock()
+	delete(blocklist.expires, ip)
+	blockedIPs.Set(float64(len(blocklist.expires)))
+}
+
+// IPBlocked returns whether ip is on the blocklist.
+func IPBlocked(ip string) bool {
+	blocklist.Lock()
+	defer blocklist.Unlock()
+	expires, ok := blocklist.expires[ip]
+	return ok && time.Now().Before(expires)
+}
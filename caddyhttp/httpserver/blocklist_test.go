@@ -0,0 +1,31 @@
+package httpserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlocklist(t *testing.T) {
+	const ip = "198.51.100.7"
+	defer UnblockIP(ip)
+
+	if IPBlocked(ip) {
+		t.Fatal("Expected the IP not to be blocked yet")
+	}
+	BlockIP(ip, time.Hour)
+	if !IPBlocked(ip) {
+		t.Error("Expected the IP to be blocked")
+	}
+	BlockIP(ip, -time.Minute)
+	if !IPBlocked(ip) {
+		t.Error("Expected a shorter block not to shorten the longer one")
+	}
+	UnblockIP(ip)
+	if IPBlocked(ip) {
+		t.Error("Expected the IP to be unblocked")
+	}
+	BlockIP(ip, -time.Minute)
+	if IPBlocked(ip) {
+		t.Error("Expected an expired block not to block the IP")
+	}
+}
@@ -0,0 +1,207 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/mholt/caddy"
+)
+
+// MaxBodyMemory is the most of a request body that BufferBody keeps
+// in memory; the rest of what it buffers is spooled to a temporary
+// file.
+var MaxBodyMemory int64 = 1 << 20
+
+// bodiesCtxKey is the context key of the bodies buffered for a
+// request, which are released once it has been handled.
+const bodiesCtxKey = caddy.CtxKey("buffered_bodies")
+
+// errBodyStreamed is returned by BufferedBody when more of the body
+// is asked for after some of it has been read past the buffer.
+var errBodyStreamed = errors.New("request body already read past what was buffered")
+
+// BufferedBody is a request body of which some has been buffered, so
+// that middleware can read it, such as to inspect or verify it,
+// without consuming it for the handlers after them. As the body of
+// the request, it reads what was buffered and then the rest.
+type BufferedBody struct {
+	mem  []byte
+	file *os.File // what's buffered beyond mem, if anything
+	size int64    // buffered, in mem and file
+
+	rest     io.ReadCloser // the body beyond what's buffered
+	eof      bool          // whether rest is all read
+	pos      int64         // of Read, in the whole body
+	streamed bool          // whether Read has read from rest
+}
+
+// BufferBody buffers up to limit bytes of the body of r, keeping up
+// to MaxBodyMemory of them in memory and spooling the rest to a
+// temporary file, and makes r read them again, followed by the rest
+// of the body. Middleware that buffers the body of a request after
+// other middleware has, without the body being replaced in between,
+// gets the same buffer, with more buffered if its limit is higher.
+// Temporary files are removed once the request has been handled.
+func BufferBody(r *http.Request, limit int64) (*BufferedBody, error) {
+	b, ok := r.Body.(*BufferedBody)
+	if !ok {
+		rest := r.Body
+		if rest == nil {
+			rest = http.NoBody
+		}
+		b = &BufferedBody{rest: rest, eof: rest == http.NoBody}
+		if bodies, ok := r.Context().Value(bodiesCtxKey).(*[]*BufferedBody); ok {
+			*bodies = append(*bodies, b)
+		}
+		r.Body = b
+	}
+	return b, b.fill(limit)
+}
+
+// fill buffers the body up to limit bytes.
+func (b *BufferedBody) fill(limit int64) error {
+	if b.eof || b.size >= limit {
+		return nil
+	}
+	if b.streamed {
+		return errBodyStreamed
+	}
+
+	if b.size < MaxBodyMemory {
+		n := limit - b.size
+		if n > MaxBodyMemory-b.size {
+			n = MaxBodyMemory - b.size
+		}
+		buf := bytes.NewBuffer(b.mem)
+		read, err := io.Copy(buf, io.LimitReader(b.rest, n))
+		b.mem, b.size = buf.Bytes(), b.size+read
+		if err != nil {
+			return err
+		}
+		if read < n {
+			b.eof = true
+			return nil
+		}
+	}
+	if b.size >= limit {
+		return nil
+	}
+
+	if b.file == nil {
+		f, err := ioutil.TempFile("", "caddy-body-")
+		if err != nil {
+			return err
+		}
+		b.file = f
+	}
+	n := limit - b.size
+	read, err := io.Copy(b.file, io.LimitReader(b.rest, n))
+	b.size += read
+	if err != nil {
+		return err
+	}
+	if read < n {
+		b.eof = true
+	}
+	return nil
+}
+
+// Size returns how much of the body is buffered.
+func (b *BufferedBody) Size() int64 {
+	return b.size
+}
+
+// Truncated returns whether there may be more of the body than is
+// buffered.
+func (b *BufferedBody) Truncated() bool {
+	return !b.eof
+}
+
+// Reader returns a reader of what's buffered of the body, from the
+// start, which doesn't affect what the request reads.
+func (b *BufferedBody) Reader() io.Reader {
+	mem := bytes.NewReader(b.mem)
+	if b.file == nil {
+		return mem
+	}
+	return io.MultiReader(mem, io.NewSectionReader(b.file, 0, b.size-int64(len(b.mem))))
+}
+
+// Bytes returns what's buffered of the body.
+func (b *BufferedBody) Bytes() ([]byte, error) {
+	if b.file == nil {
+		return b.mem, nil
+	}
+	return ioutil.ReadAll(b.Reader())
+}
+
+// Read reads the body, from what's buffered and then the rest.
+func (b *BufferedBody) Read(p []byte) (int, error) {
+	if b.pos < b.size {
+		if max := b.size - b.pos; int64(len(p)) > max {
+			p = p[:max]
+		}
+		var n int
+		var err error
+		if b.pos < int64(len(b.mem)) {
+			n = copy(p, b.mem[b.pos:])
+		} else {
+			n, err = b.file.ReadAt(p, b.pos-int64(len(b.mem)))
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+		}
+		b.pos += int64(n)
+		return n, err
+	}
+	if b.eof {
+		return 0, io.EOF
+	}
+	b.streamed = true
+	n, err := b.rest.Read(p)
+	b.pos += int64(n)
+	return n, err
+}
+
+// Rewind makes the request read the body from the start again, such
+// as to retry it, which it can only do if it hasn't read past what's
+// buffered.
+func (b *BufferedBody) Rewind() error {
+	if b.streamed {
+		return errBodyStreamed
+	}
+	b.pos = 0
+	return nil
+}
+
+// Close closes the rest of the body. What's buffered stays readable
+// until the request has been handled.
+func (b *BufferedBody) Close() error {
+	return b.rest.Close()
+}
+
+// release removes the temporary file of the body, if any.
+func (b *BufferedBody) release() {
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+}
+
+// withBodies returns ctx with a list of the bodies buffered for its
+// request, and a function that releases them once the request has
+// been handled.
+func withBodies(ctx context.Context) (context.Context, func()) {
+	bodies := new([]*BufferedBody)
+	return context.WithValue(ctx, bodiesCtxKey, bodies), func() {
+		for _, b := range *bodies {
+			b.release()
+		}
+	}
+}
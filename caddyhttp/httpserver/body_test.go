@@ -0,0 +1,125 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestBufferBody(t *testing.T) {
+	defer func(max int64) { MaxBodyMemory = max }(MaxBodyMemory)
+
+	for i, test := range []struct {
+		memory, limit   int64
+		expectBuffered  string
+		expectTruncated bool
+		expectFile      bool
+	}{
+		{100, 100, "hello, world", false, false},
+		{100, 5, "hello", true, false},
+		{4, 100, "hello, world", false, true},
+		{4, 8, "hello, w", true, true},
+	} {
+		MaxBodyMemory = test.memory
+		r := httptest.NewRequest("POST", "/", strings.NewReader("hello, world"))
+		ctx, release := withBodies(r.Context())
+		r = r.WithContext(ctx)
+
+		b, err := BufferBody(r, test.limit)
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+		buffered, err := b.Bytes()
+		if err != nil || string(buffered) != test.expectBuffered {
+			t.Errorf("Test %d: expected %q buffered, got %q (%v)", i, test.expectBuffered, buffered, err)
+		}
+		if b.Truncated() != test.expectTruncated {
+			t.Errorf("Test %d: expected truncated %t, got %t", i, test.expectTruncated, b.Truncated())
+		}
+		if (b.file != nil) != test.expectFile {
+			t.Errorf("Test %d: expected spooling to a file %t", i, test.expectFile)
+		}
+
+		// the buffer is read again by the request, with the rest
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != "hello, world" {
+			t.Errorf("Test %d: expected the request to read the whole body, got %q", i, body)
+		}
+		r.Body.Close()
+		if again, _ := ioutil.ReadAll(b.Reader()); string(again) != test.expectBuffered {
+			t.Errorf("Test %d: expected the buffer to stay readable, got %q", i, again)
+		}
+
+		var name string
+		if b.file != nil {
+			name = b.file.Name()
+		}
+		release()
+		if name != "" {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("Test %d: expected the temporary file to be removed, got %v", i, err)
+			}
+		}
+	}
+}
+
+func TestBufferBodyShared(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello, world"))
+	first, err := BufferBody(r, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := BufferBody(r, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("Expected middleware buffering the body again to share the buffer")
+	}
+	if buffered, _ := second.Bytes(); string(buffered) != "hello, world" {
+		t.Errorf("Expected more to be buffered for the higher limit, got %q", buffered)
+	}
+
+	if body, _ := ioutil.ReadAll(r.Body); string(body) != "hello, world" {
+		t.Errorf("Expected the request to read the whole body, got %q", body)
+	}
+	if err := second.Rewind(); err != nil {
+		t.Fatalf("Expected to rewind the buffered body, got %v", err)
+	}
+	if body, _ := ioutil.ReadAll(r.Body); string(body) != "hello, world" {
+		t.Errorf("Expected the request to read the whole body again, got %q", body)
+	}
+}
+
+func TestBufferBodyStreamed(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello, world"))
+	b, err := BufferBody(r, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r.Body); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Rewind(); err == nil {
+		t.Error("Expected an error rewinding a body read past its buffer")
+	}
+	if _, err := BufferBody(r, 100); err == nil {
+		t.Error("Expected an error buffering more of a body read past its buffer")
+	}
+}
+
+func TestBodySpoolWritable(t *testing.T) {
+	ctx := newContext().(*httpContext)
+	ctx.siteConfigs = []*SiteConfig{{Addr: Address{Original: "localhost:2015", Host: "localhost", Port: "2015"}, Root: ".", TLS: new(caddytls.Config)}}
+	if _, err := ctx.MakeServers(); err != nil {
+		t.Fatal(err)
+	}
+	if !caddy.Writable(filepath.Join(os.TempDir(), "caddy-body-123")) {
+		t.Error("Expected request bodies to be spooled to a writable folder once privileges are dropped")
+	}
+}
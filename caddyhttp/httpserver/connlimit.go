@@ -0,0 +1,132 @@
+package httpserver
+
+import (
+	"net"
+	"sync"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+var (
+	limitedConnections = metrics.NewCounter("caddy_http_limited_connections_total",
+		"Number of connections closed for exceeding the limit of connections per client IP, by listener address.",
+		"server")
+	clientIPs = metrics.NewGauge("caddy_http_client_ips",
+		"Number of client IPs with connections open, by listener address.",
+		"server")
+)
+
+// ConnLimit limits the connections open at once to a listener from
+// each client IP. It's enforced as connections are accepted, before
+// any TLS handshake, so that clients can't flood the listener with
+// handshakes.
+type ConnLimit struct {
+	// PerIP is the most connections that one IP may have open.
+	PerIP int
+
+	// Trusted are the networks, such as those of proxies that
+	// many clients connect through, whose connections aren't
+	// limited.
+	Trusted []*net.IPNet
+}
+
+// connLimit returns the limit of connections for the sites of group,
+// which share a listener: the lowest of theirs, trusting the networks
+// that any of them trust, or nil if none of them limit connections.
+func connLimit(group []*SiteConfig) *ConnLimit {
+	var limit *ConnLimit
+	for _, site := range group {
+		sl := site.ConnLimit
+		if sl == nil {
+			continue
+		}
+		if limit == nil {
+			limit = new(ConnLimit)
+		}
+		if sl.PerIP > 0 && (limit.PerIP == 0 || sl.PerIP < limit.PerIP) {
+			limit.PerIP = sl.PerIP
+		}
+		limit.Trusted = append(limit.Trusted, sl.Trusted...)
+	}
+	if limit != nil && limit.PerIP == 0 {
+		return nil
+	}
+	return limit
+}
+
+// limitListener accepts connections from each client IP up to a
+// limit, closing any more straight away.
+type limitListener struct {
+	net.Listener
+	server string // the address of the listener
+	limit  *ConnLimit
+
+	mu   sync.Mutex
+	open map[string]int // connections by IP
+}
+
+func newLimitListener(ln net.Listener, server string, limit *ConnLimit) *limitListener {
+	return &limitListener{Listener: ln, server: server, limit: limit, open: make(map[string]int)}
+}
+
+// Accept accepts the next connection within the limit.
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+		if !ok || inNetworks(l.limit.Trusted, tcpAddr) {
+			return conn, nil
+		}
+		ip := tcpAddr.IP.String()
+		if !l.acquire(ip) {
+			limitedConnections.Inc(l.server)
+			conn.Close()
+			continue
+		}
+		return &limitedConn{Conn: conn, release: func() { l.release(ip) }}, nil
+	}
+}
+
+// acquire counts a connection from ip, if it's within the limit.
+func (l *limitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.open[ip]
+	if n >= l.limit.PerIP {
+		return false
+	}
+	if n == 0 {
+		clientIPs.Inc(l.server)
+	}
+	l.open[ip] = n + 1
+	return true
+}
+
+// release uncounts a connection from ip.
+func (l *limitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.open[ip] <= 1 {
+		delete(l.open, ip)
+		clientIPs.Dec(l.server)
+		return
+	}
+	l.open[ip]--
+}
+
+// limitedConn is a connection counted against the limit of its IP
+// until it's closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+// Close closes the connection.
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,100 @@
+package httpserver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConnLimitMerge(t *testing.T) {
+	_, a, _ := net.ParseCIDR("10.0.0.0/8")
+	_, b, _ := net.ParseCIDR("192.168.0.0/16")
+	group := []*SiteConfig{
+		{},
+		{ConnLimit: &ConnLimit{PerIP: 20, Trusted: []*net.IPNet{a}}},
+		{ConnLimit: &ConnLimit{PerIP: 10, Trusted: []*net.IPNet{b}}},
+	}
+	expect := &ConnLimit{PerIP: 10, Trusted: []*net.IPNet{a, b}}
+	if got := connLimit(group); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected %+v, got %+v", expect, got)
+	}
+	if got := connLimit(group[:1]); got != nil {
+		t.Errorf("Expected no limit when no site has one, got %+v", got)
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	for i, test := range []struct {
+		trusted string
+		limited bool
+	}{
+		{"10.0.0.0/8", true},
+		{"127.0.0.0/8", false},
+	} {
+		_, trusted, _ := net.ParseCIDR(test.trusted)
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln := newLimitListener(inner, "test", &ConnLimit{PerIP: 2, Trusted: []*net.IPNet{trusted}})
+
+		accepted := make(chan net.Conn, 4)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					close(accepted)
+					return
+				}
+				accepted <- conn
+			}
+		}()
+
+		var clients []net.Conn
+		for j := 0; j < 3; j++ {
+			conn, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			clients = append(clients, conn)
+		}
+
+		// the third is closed unless its IP is trusted
+		third := clients[2]
+		third.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		_, err = third.Read(make([]byte, 1))
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			if test.limited {
+				t.Errorf("Test %d: Expected the third connection to be closed", i)
+			}
+		} else if !test.limited {
+			t.Errorf("Test %d: Expected the third connection to stay open, got: %v", i, err)
+		}
+
+		if test.limited {
+			// closing one makes room for another
+			first := <-accepted
+			first.Close()
+			conn, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			clients = append(clients, conn)
+			conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Errorf("Test %d: Expected nothing to read", i)
+			} else if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+				t.Errorf("Test %d: Expected a connection after one was closed, got: %v", i, err)
+			}
+		}
+
+		for _, c := range clients {
+			c.Close()
+		}
+		ln.Close()
+		for c := range accepted {
+			c.Close()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package httpserver
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// siteRequests is the number of requests handled by each site,
+// by site address. Counters are kept across restarts.
+var (
+	siteRequests   = make(map[string]*uint64)
+	siteRequestsMu sync.Mutex
+)
+
+// siteRequestCounter returns the request counter of the site
+// with address addr, creating it if necessary.
+func siteRequestCounter(addr string) *uint64 {
+	siteRequestsMu.Lock()
+	defer siteRequestsMu.Unlock()
+	counter, ok := siteRequests[addr]
+	if !ok {
+		counter = new(uint64)
+		siteRequests[addr] = counter
+	}
+	return counter
+}
+
+// SiteRequests returns the number of requests that each site
+// has handled since the process started, by site address.
+func SiteRequests() map[string]uint64 {
+	siteRequestsMu.Lock()
+	defer siteRequestsMu.Unlock()
+	counts := make(map[string]uint64, len(siteRequests))
+	for addr, counter := range siteRequests {
+		counts[addr] = atomic.LoadUint64(counter)
+	}
+	return counts
+}
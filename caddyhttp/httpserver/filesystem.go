@@ -0,0 +1,56 @@
+package httpserver
+
+import (
+	"net/http"
+	"os"
+)
+
+// Dirs is an http.FileSystem made of several directories,
+// or archives, that are searched in order; a name is opened
+// from the first directory in which it exists. This allows,
+// for example, build output to be layered over source assets.
+//
+// Directories are not merged: listing a directory shows
+// only the entries of the first root that contains it.
+type Dirs []http.FileSystem
+
+// Open implements http.FileSystem.
+func (d Dirs) Open(name string) (http.File, error) {
+	var firstErr error
+	for _, dir := range d {
+		f, err := dir.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !os.IsNotExist(err) {
+			// permission problems and the like must not be
+			// masked by a file of the same name further down
+			return nil, err
+		}
+	}
+	if firstErr == nil {
+		return nil, os.ErrNotExist
+	}
+	return nil, firstErr
+}
+
+// FileSystem returns the file system that serves the
+// site's content: its Root, or RootFS, followed by
+// any FallbackRoots, without the files hidden from the site.
+func (s SiteConfig) FileSystem() http.FileSystem {
+	var root http.FileSystem = http.Dir(s.Root)
+	if s.RootFS != nil {
+		root = s.RootFS
+	}
+	if len(s.FallbackRoots) == 0 {
+		return s.HideFrom(root)
+	}
+	dirs := Dirs{root}
+	for _, root := range s.FallbackRoots {
+		dirs = append(dirs, http.Dir(root))
+	}
+	return s.HideFrom(dirs)
+}
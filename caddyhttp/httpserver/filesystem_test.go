@@ -0,0 +1,65 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirs(t *testing.T) {
+	first, err := ioutil.TempDir("", "caddy_dirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(first)
+	second, err := ioutil.TempDir("", "caddy_dirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(second)
+
+	files := map[string]string{
+		filepath.Join(first, "both.txt"):   "first",
+		filepath.Join(second, "both.txt"):  "second",
+		filepath.Join(second, "only2.txt"): "second",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := SiteConfig{Root: first, FallbackRoots: []string{second}}.FileSystem()
+
+	for i, test := range []struct {
+		name     string
+		expected string
+	}{
+		{"/both.txt", "first"},
+		{"/only2.txt", "second"},
+		{"/missing.txt", ""},
+	} {
+		f, err := fs.Open(test.name)
+		if test.expected == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("Test %d: Expected not-exist error, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+			continue
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		if string(content) != test.expected {
+			t.Errorf("Test %d: Expected content %q, got %q", i, test.expected, content)
+		}
+	}
+
+	if _, ok := (SiteConfig{Root: first}).FileSystem().(http.Dir); !ok {
+		t.Error("Expected a plain http.Dir without fallback roots")
+	}
+}
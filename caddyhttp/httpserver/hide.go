@@ -0,0 +1,160 @@
+package httpserver
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// vcsDirs are the names of the directories in which version
+// control systems keep their data.
+var vcsDirs = map[string]bool{
+	".git":   true,
+	".svn":   true,
+	".hg":    true,
+	".bzr":   true,
+	"_darcs": true,
+	"cvs":    true,
+}
+
+// hiddenPaths is what is hidden from a site; see SiteConfig.
+type hiddenPaths struct {
+	files    []string
+	patterns []string
+	dotfiles bool
+	vcs      bool
+}
+
+// hidden returns what is hidden from s.
+func (s SiteConfig) hidden() hiddenPaths {
+	h := hiddenPaths{dotfiles: s.HideDotfiles, vcs: s.HideVCS}
+	for _, file := range s.HiddenFiles {
+		h.files = append(h.files, normalizePath(file))
+	}
+	for _, pattern := range s.HiddenPatterns {
+		h.patterns = append(h.patterns, strings.ToLower(pattern))
+	}
+	return h
+}
+
+// empty returns whether nothing is hidden.
+func (h hiddenPaths) empty() bool {
+	return len(h.files) == 0 && len(h.patterns) == 0 && !h.dotfiles && !h.vcs
+}
+
+// normalizePath returns urlPath cleaned, in lower case, and without
+// the dots and spaces that end any of its elements, so that it names
+// the file that urlPath names on any file system, including those
+// that ignore case or such dots and spaces.
+func normalizePath(urlPath string) string {
+	elems := strings.Split(strings.ToLower(path.Clean("/"+urlPath)), "/")
+	for i, elem := range elems {
+		if trimmed := strings.TrimRight(elem, ". "); trimmed != "" {
+			elems[i] = trimmed
+		}
+	}
+	return strings.Join(elems, "/")
+}
+
+// matches returns whether urlPath is, or is within, a hidden path.
+func (h hiddenPaths) matches(urlPath string) bool {
+	name := normalizePath(urlPath)
+	for _, file := range h.files {
+		if name == file || strings.HasPrefix(name, file+"/") {
+			return true
+		}
+	}
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		if elem == "" {
+			continue
+		}
+		if h.dotfiles && elem[0] == '.' && elem != ".well-known" {
+			return true
+		}
+		if h.vcs && vcsDirs[elem] {
+			return true
+		}
+		for _, pattern := range h.patterns {
+			// patterns with a slash are of paths, the others
+			// of names
+			subject := elem
+			if strings.Contains(pattern, "/") {
+				subject = strings.Join(elems[:i+1], "/")
+			}
+			if ok, _ := path.Match(pattern, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsHidden returns whether urlPath is, or is within, a path hidden
+// from the site.
+func (s SiteConfig) IsHidden(urlPath string) bool {
+	return s.hidden().matches(urlPath)
+}
+
+// HideFrom returns fs with the paths hidden from the site taken out
+// of it, or fs itself if nothing is hidden.
+func (s SiteConfig) HideFrom(fs http.FileSystem) http.FileSystem {
+	h := s.hidden()
+	if h.empty() {
+		return fs
+	}
+	return HiddenFS{FileSystem: fs, hidden: h}
+}
+
+// HiddenFS is a file system with the paths hidden from a site taken
+// out of it: they can't be opened, and aren't listed. Since handlers
+// open the files of a site through it, they are hidden from all of
+// them alike.
+type HiddenFS struct {
+	http.FileSystem
+	hidden hiddenPaths
+}
+
+// IsHidden returns whether name is hidden.
+func (fs HiddenFS) IsHidden(name string) bool {
+	return fs.hidden.matches(name)
+}
+
+// Open implements http.FileSystem.
+func (fs HiddenFS) Open(name string) (http.File, error) {
+	if fs.hidden.matches(name) {
+		return nil, os.ErrNotExist
+	}
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+		// a regular file is returned as is, so that it can
+		// still be sent with sendfile
+		return f, nil
+	}
+	return hiddenFile{File: f, dir: path.Clean("/" + name), hidden: fs.hidden}, nil
+}
+
+// hiddenFile is a file of a HiddenFS, which doesn't list the hidden
+// files within it if it is a directory.
+type hiddenFile struct {
+	http.File
+	dir    string
+	hidden hiddenPaths
+}
+
+// Readdir implements http.File. It may return fewer than count
+// files, even none, before the end of the directory.
+func (f hiddenFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	visible := infos[:0]
+	for _, fi := range infos {
+		if !f.hidden.matches(path.Join(f.dir, fi.Name())) {
+			visible = append(visible, fi)
+		}
+	}
+	return visible, err
+}
@@ -0,0 +1,133 @@
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestIsHidden(t *testing.T) {
+	site := SiteConfig{
+		HiddenFiles:    []string{"/Caddyfile", "private/"},
+		HiddenPatterns: []string{"*.bak", "/config/*.json"},
+		HideDotfiles:   true,
+		HideVCS:        true,
+	}
+	for i, test := range []struct {
+		path   string
+		hidden bool
+	}{
+		{"/index.html", false},
+		{"/Caddyfile", true},
+		{"/caddyfile", true},
+		{"/Caddyfile.", true},
+		{"/Caddyfile ", true},
+		{"/Caddyfile.txt", false},
+		{"/private", true},
+		{"/private/notes.txt", true},
+		{"/privateer", false},
+		{"/.env", true},
+		{"/assets/.htaccess", true},
+		{"/.git/config", true},
+		{"/.GIT/config", true},
+		{"/.git./config", true},
+		{"/a/../.git/config", true},
+		{"/a/./../../.git/HEAD", true},
+		{"//.git//config", true},
+		{"/.well-known/acme-challenge/token", false},
+		{"/.well-known/.secret", true},
+		{"/CVS/Entries", true},
+		{"/project/_darcs/prefs", true},
+		{"/backup.bak", true},
+		{"/docs/old.BAK", true},
+		{"/config/site.json", true},
+		{"/config/sub/site.json", false},
+		{"/other/site.json", false},
+	} {
+		if hidden := site.IsHidden(test.path); hidden != test.hidden {
+			t.Errorf("Test %d: expected %s hidden %v, got %v", i, test.path, test.hidden, hidden)
+		}
+	}
+
+	vcsOnly := SiteConfig{HideVCS: true}
+	if vcsOnly.IsHidden("/.env") || !vcsOnly.IsHidden("/repo/.svn/entries") {
+		t.Error("Expected only the directories of version control systems to be hidden")
+	}
+}
+
+func TestHiddenFS(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_hide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{".git", "public"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{".git/config", ".env", "index.html", "notes.bak", "public/app.js"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	site := SiteConfig{Root: root, HideDotfiles: true, HiddenPatterns: []string{"*.bak"}}
+	fs := site.FileSystem()
+	hfs, ok := fs.(HiddenFS)
+	if !ok {
+		t.Fatalf("Expected a HiddenFS, got %T", fs)
+	}
+	if !hfs.IsHidden("/.env") {
+		t.Error("Expected /.env to be hidden")
+	}
+
+	for i, test := range []struct {
+		name   string
+		exists bool
+	}{
+		{"/index.html", true},
+		{"/public/app.js", true},
+		{"/.env", false},
+		{"/.git/config", false},
+		{"/public/../.git/config", false},
+		{"/notes.bak", false},
+	} {
+		f, err := fs.Open(test.name)
+		if test.exists {
+			if err != nil {
+				t.Errorf("Test %d: expected %s to open, got %v", i, test.name, err)
+				continue
+			}
+			f.Close()
+		} else if !os.IsNotExist(err) {
+			t.Errorf("Test %d: expected %s not to exist, got %v", i, test.name, err)
+		}
+	}
+
+	// hidden files aren't listed either
+	dir, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "index.html" || names[1] != "public" {
+		t.Errorf("Expected only index.html and public to be listed, got %v", names)
+	}
+
+	if _, ok := (SiteConfig{Root: root}).FileSystem().(http.Dir); !ok {
+		t.Error("Expected a plain http.Dir when nothing is hidden")
+	}
+}
@@ -115,7 +115,7 @@ func enableAutoHTTPS(configs []*SiteConfig, loadCertificates bool) error {
 // all configs.
 func makePlaintextRedirects(allConfigs []*SiteConfig) []*SiteConfig {
 	for i, cfg := range allConfigs {
-		if cfg.TLS.Managed &&
+		if cfg.TLS.Managed && !cfg.HTTPSRedirect.disabled() &&
 			!hostHasOtherPort(allConfigs, i, HTTPPort) &&
 			(cfg.Addr.Port == HTTPSPort || !hostHasOtherPort(allConfigs, i, HTTPSPort)) {
 			allConfigs = append(allConfigs, redirPlaintextHost(cfg))
@@ -140,17 +140,73 @@ func hostHasOtherPort(allConfigs []*SiteConfig, thisConfigIdx int, otherPort str
 	return false
 }
 
+// HTTPSRedirect is how plaintext HTTP requests are redirected to
+// a site that is served over HTTPS automatically.
+type HTTPSRedirect struct {
+	// Off disables the redirect; the certificate of the site
+	// is still managed.
+	Off bool
+
+	// Status is the status code of the redirect; 0 for
+	// http.StatusMovedPermanently.
+	Status int
+
+	// Port is the port to redirect to, if not the one the site
+	// listens on, such as when it is behind a port mapping.
+	Port string
+
+	// Except holds the paths that are served over plaintext HTTP
+	// by the site itself rather than being redirected, such as
+	// health checks.
+	Except []string
+}
+
+// disabled returns whether the redirect is turned off. r may be nil.
+func (r *HTTPSRedirect) disabled() bool {
+	return r != nil && r.Off
+}
+
+// exempt returns whether requests for path are served rather than
+// redirected. r may be nil.
+func (r *HTTPSRedirect) exempt(path string) bool {
+	if r == nil {
+		return false
+	}
+	for _, p := range r.Except {
+		if Path(path).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
 // redirPlaintextHost returns a new plaintext HTTP configuration for
 // a virtualHost that simply redirects to cfg, which is assumed to
 // be the HTTPS configuration. The returned configuration is set
 // to listen on HTTPPort. The TLS field of cfg must not be nil.
 func redirPlaintextHost(cfg *SiteConfig) *SiteConfig {
 	redirPort := cfg.Addr.Port
+	status := http.StatusMovedPermanently
+	if r := cfg.HTTPSRedirect; r != nil {
+		if r.Port != "" {
+			redirPort = r.Port
+		}
+		if r.Status != 0 {
+			status = r.Status
+		}
+	}
 	if redirPort == DefaultHTTPSPort {
 		redirPort = "" // default port is redundant
 	}
 	redirMiddleware := func(next Handler) Handler {
 		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if cfg.HTTPSRedirect.exempt(r.URL.Path) {
+				if cfg.middlewareChain == nil {
+					return http.StatusNotFound, nil
+				}
+				return cfg.middlewareChain.ServeHTTP(w, r)
+			}
+
 			// Construct the URL to which to redirect. Note that the Host in a request might
 			// contain a port, but we just need the hostname; we'll set the port if needed.
 			toURL := "https://"
@@ -166,7 +222,7 @@ func redirPlaintextHost(cfg *SiteConfig) *SiteConfig {
 			toURL += r.URL.RequestURI()
 
 			w.Header().Set("Connection", "close")
-			http.Redirect(w, r, toURL, http.StatusMovedPermanently)
+			http.Redirect(w, r, toURL, status)
 			return 0, nil
 		})
 	}
@@ -179,5 +235,7 @@ func redirPlaintextHost(cfg *SiteConfig) *SiteConfig {
 		middleware: []Middleware{redirMiddleware},
 		TLS:        &caddytls.Config{AltHTTPPort: cfg.TLS.AltHTTPPort, AltTLSSNIPort: cfg.TLS.AltTLSSNIPort},
 		Timeouts:   cfg.Timeouts,
+
+		ACMEChallenge: cfg.ACMEChallenge,
 	}
 }
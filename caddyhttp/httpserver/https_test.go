@@ -115,6 +115,44 @@ func TestRedirPlaintextHost(t *testing.T) {
 	}
 }
 
+func TestRedirPlaintextHostCustomized(t *testing.T) {
+	site := &SiteConfig{
+		Addr: Address{Host: "foohost", Port: "8443"},
+		TLS:  new(caddytls.Config),
+		HTTPSRedirect: &HTTPSRedirect{
+			Status: http.StatusPermanentRedirect,
+			Port:   "443",
+			Except: []string{"/health"},
+		},
+	}
+	site.middlewareChain = HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Write([]byte("ok"))
+		return 0, nil
+	})
+	handler := redirPlaintextHost(site).middleware[0](nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://foohost/bar?q=1", nil)
+	if _, err := handler.ServeHTTP(rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusPermanentRedirect {
+		t.Errorf("Expected status %d but got %d", http.StatusPermanentRedirect, rec.Code)
+	}
+	if got, want := rec.Header().Get("Location"), "https://foohost/bar?q=1"; got != want {
+		t.Errorf("Expected Location: '%s' but got '%s'", want, got)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "http://foohost/health/ready", nil)
+	if _, err := handler.ServeHTTP(rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("Expected exempt path to be served, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
 func TestHostHasOtherPort(t *testing.T) {
 	configs := []*SiteConfig{
 		{Addr: Address{Host: "example.com", Port: "80"}},
@@ -148,6 +186,8 @@ func TestMakePlaintextRedirects(t *testing.T) {
 		// Can redirect from 80 to either 443 or 5001, but choose 443
 		{Addr: Address{Host: "sub3.example.com", Port: "443"}, TLS: &caddytls.Config{Managed: true}},
 		{Addr: Address{Host: "sub3.example.com", Port: "5001", Scheme: "https"}, TLS: &caddytls.Config{Managed: true}},
+		// Redirect turned off, but still managed
+		{Addr: Address{Host: "sub4.example.com"}, TLS: &caddytls.Config{Managed: true}, HTTPSRedirect: &HTTPSRedirect{Off: true}},
 	}
 
 	result := makePlaintextRedirects(configs)
@@ -115,6 +115,8 @@ selectwriter:
 		if err != nil {
 			return err
 		}
+		// keep it writable if privileges are dropped
+		caddy.RegisterWritablePath(l.Output)
 
 		if l.Roller != nil {
 			file.Close()
@@ -0,0 +1,67 @@
+package httpserver
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterReadinessCheck("maintenance", func() error {
+		if InMaintenance() {
+			return errMaintenance
+		}
+		return nil
+	})
+}
+
+// maintenance is 1 while maintenance mode is turned on, and
+// scheduledMaintenance how many schedules have it on; it is on while
+// either is, so that neither turns it off while the other has it on.
+var maintenance, scheduledMaintenance int32
+
+// maintenanceRetryAfter is the value of the Retry-After header
+// sent with responses while in maintenance mode, in seconds.
+const maintenanceRetryAfter = "120"
+
+// SetMaintenance turns maintenance mode on or off. While it is
+// on, all sites respond with 503 Service Unavailable, except to
+// ACME challenges, so that certificates can still be renewed.
+func SetMaintenance(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&maintenance, v)
+}
+
+// ScheduleMaintenance turns maintenance mode on or off for a
+// schedule, such as a maintenance window: each schedule that turns
+// it on must turn it off again, and it stays on until all have, or
+// while it is turned on with SetMaintenance.
+func ScheduleMaintenance(on bool) {
+	if on {
+		atomic.AddInt32(&scheduledMaintenance, 1)
+	} else {
+		atomic.AddInt32(&scheduledMaintenance, -1)
+	}
+}
+
+// InMaintenance returns whether maintenance mode is on.
+func InMaintenance() bool {
+	return atomic.LoadInt32(&maintenance) == 1 || atomic.LoadInt32(&scheduledMaintenance) > 0
+}
+
+// maintenanceExempt returns whether requests for path are served
+// by s even in maintenance mode.
+func (s *SiteConfig) maintenanceExempt(path string) bool {
+	for _, p := range s.MaintenanceExempt {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+var errMaintenance = errors.New("maintenance mode is on")
@@ -0,0 +1,93 @@
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounter("caddy_http_requests_total",
+		"Number of HTTP requests handled, by site, handler, method and status code.",
+		"site", "handler", "method", "code")
+	requestDuration = metrics.NewHistogram("caddy_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by site and handler.",
+		nil, "site", "handler")
+	middlewareDuration = metrics.NewHistogram("caddy_http_middleware_duration_seconds",
+		"Time taken by handlers themselves to handle HTTP requests, without the handlers they pass them on to, by site and handler.",
+		nil, "site", "handler")
+	openConnections = metrics.NewGauge("caddy_http_open_connections",
+		"Number of open client connections, by listener address.",
+		"server")
+)
+
+// handlerNameCtxKey is the context key of the name of the handler
+// which a request has reached; see nameHandler.
+const handlerNameCtxKey = caddy.CtxKey("handler_name")
+
+// fileServerName is the handler name of the file server at the
+// bottom of every middleware chain.
+const fileServerName = "fileserver"
+
+// nameHandler wraps next so that requests entering it record name
+// as the handler they reached. Since every handler in an instrumented
+// chain is wrapped like this, the last name recorded is that of the
+// handler which produced the response.
+func nameHandler(name string, next Handler) Handler {
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if reached, ok := r.Context().Value(handlerNameCtxKey).(*string); ok {
+			*reached = name
+		}
+		return next.ServeHTTP(w, r)
+	})
+}
+
+// instrumentHandler wraps the middleware chain of a site so that
+// each request to it is counted and timed in the metrics registry.
+func instrumentHandler(site string, next Handler) Handler {
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		reached := new(string)
+		r = r.WithContext(context.WithValue(r.Context(), handlerNameCtxKey, reached))
+		rec := NewResponseRecorder(w)
+		start := time.Now()
+
+		status, err := next.ServeHTTP(rec, r)
+
+		code := status
+		if code == 0 {
+			code = rec.Status()
+		}
+		requestsTotal.Inc(site, *reached, methodLabel(r.Method), strconv.Itoa(code))
+		requestDuration.Observe(time.Since(start).Seconds(), site, *reached)
+		return status, err
+	})
+}
+
+// methodLabel returns method as the label of metrics, unless it
+// is not a standard method: clients choose methods, so they could
+// make a series of each otherwise.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// trackConnState counts the open connections of the listener at addr.
+func trackConnState(addr string) func(net.Conn, http.ConnState) {
+	return func(c net.Conn, cs http.ConnState) {
+		switch cs {
+		case http.StateNew:
+			openConnections.Inc(addr)
+		case http.StateHijacked, http.StateClosed:
+			openConnections.Dec(addr)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package httpserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	// the proxy-like handler passes requests on
+	// unless they are for /api
+	inner := nameHandler(fileServerName, HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusNotFound, nil
+	}))
+	proxy := nameHandler("proxy", HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if r.URL.Path == "/api" {
+			w.WriteHeader(http.StatusAccepted)
+			return 0, nil
+		}
+		return inner.ServeHTTP(w, r)
+	}))
+	h := instrumentHandler("instrument.test:80", proxy)
+
+	for _, path := range []string{"/api", "/api", "/x"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("X-RANDOM-1", "/api", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("X-RANDOM-2", "/api", nil))
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	out := buf.String()
+	for _, expected := range []string{
+		`caddy_http_requests_total{site="instrument.test:80",handler="proxy",method="GET",code="202"} 2`,
+		`caddy_http_requests_total{site="instrument.test:80",handler="fileserver",method="GET",code="404"} 1`,
+		`caddy_http_requests_total{site="instrument.test:80",handler="proxy",method="OTHER",code="202"} 2`,
+		`caddy_http_request_duration_seconds_count{site="instrument.test:80",handler="proxy"} 4`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %s in metrics, got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "X-RANDOM") {
+		t.Errorf("Expected unknown methods not to be labels, got:\n%s", out)
+	}
+}
@@ -203,9 +203,43 @@ const (
 	// RemoteUserCtxKey is the key for the remote user of the request, if any (basicauth).
 	RemoteUserCtxKey caddy.CtxKey = "remote_user"
 
+	// ClaimsCtxKey is the key for the claims about the remote user, if any (oidc),
+	// as a map[string]interface{}
+	ClaimsCtxKey caddy.CtxKey = "claims"
+
+	// MapsCtxKey is the key for the lookups of the maps of the request,
+	// if any (map), as a map[string]func(*http.Request) string by name
+	MapsCtxKey caddy.CtxKey = "maps"
+
 	// MitmCtxKey is the key for the result of MITM detection
 	MitmCtxKey caddy.CtxKey = "mitm"
 
+	// TLSFingerprintCtxKey is the key for the JA3 fingerprint of the TLS
+	// client, as the MD5 hash in hex, if the request came over TLS
+	TLSFingerprintCtxKey caddy.CtxKey = "tls_fingerprint"
+
 	// RequestIDCtxKey is the key for the U4 UUID value
 	RequestIDCtxKey caddy.CtxKey = "request_id"
+
+	// TraceIDCtxKey is the key for the trace ID of the request's span (tracing)
+	TraceIDCtxKey caddy.CtxKey = "trace_id"
+
+	// SpanIDCtxKey is the key for the span ID of the request's span (tracing)
+	SpanIDCtxKey caddy.CtxKey = "span_id"
+
+	// PeerAddrCtxKey is the key for the address of the peer that sent the
+	// request, if its RemoteAddr is instead that of the client (real_ip)
+	PeerAddrCtxKey caddy.CtxKey = "peer_addr"
+
+	// BotClassCtxKey is the key for the class of client the request
+	// came from, such as browser or crawler (bots)
+	BotClassCtxKey caddy.CtxKey = "bot_class"
+
+	// SplitCtxKey is the key for the variants the client of the request is
+	// assigned to, if any (split), as a map[string]string by experiment
+	SplitCtxKey caddy.CtxKey = "split"
+
+	// WindowsCtxKey is the key for the names of the time windows of
+	// access policies that are active, if any (authorize), as a []string
+	WindowsCtxKey caddy.CtxKey = "windows"
 )
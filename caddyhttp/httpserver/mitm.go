@@ -3,7 +3,9 @@ package httpserver
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"crypto/tls"
+	"encoding/hex"
 	"io"
 	"net"
 	"net/http"
@@ -81,9 +83,14 @@ func (h *tlsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		mitm = !info.looksLikeSafari()
 	}
 
+	ctx := r.Context()
 	if checked {
-		r = r.WithContext(context.WithValue(r.Context(), MitmCtxKey, mitm))
+		ctx = context.WithValue(ctx, MitmCtxKey, mitm)
 	}
+	if len(info.cipherSuites) > 0 {
+		ctx = context.WithValue(ctx, TLSFingerprintCtxKey, info.ja3Hash())
+	}
+	r = r.WithContext(ctx)
 
 	if mitm && h.closeOnMITM {
 		// TODO: This termination might need to happen later in the middleware
@@ -201,6 +208,7 @@ func parseRawClientHello(data []byte) (info rawHelloInfo) {
 	if len(data) < 42 {
 		return
 	}
+	info.version = uint16(data[4])<<8 | uint16(data[5])
 	sessionIDLen := int(data[38])
 	if sessionIDLen > 32 || len(data) < 39+sessionIDLen {
 		return
@@ -261,6 +269,27 @@ func parseRawClientHello(data []byte) (info rawHelloInfo) {
 		info.extensions = append(info.extensions, extension)
 
 		switch extension {
+		case extensionServerName:
+			// https://tools.ietf.org/html/rfc6066#section-3
+			if length < 2 {
+				return
+			}
+			l := int(data[0])<<8 | int(data[1])
+			if length != l+2 {
+				return
+			}
+			d := data[2:length]
+			for len(d) >= 3 {
+				nameType, nameLen := d[0], int(d[1])<<8|int(d[2])
+				if len(d) < 3+nameLen {
+					return
+				}
+				if nameType == 0 { // host_name
+					info.serverName = string(d[3 : 3+nameLen])
+					break
+				}
+				d = d[3+nameLen:]
+			}
 		case extensionSupportedCurves:
 			// http://tools.ietf.org/html/rfc4492#section-5.5.1
 			if length < 2 {
@@ -339,11 +368,61 @@ func (l *tlsHelloListener) Accept() (net.Conn, error) {
 // "The Security Impact of HTTPS Interception":
 // https://jhalderm.com/pub/papers/interception-ndss17.pdf
 type rawHelloInfo struct {
+	version            uint16 // that the client offers
 	cipherSuites       []uint16
 	extensions         []uint16
 	compressionMethods []byte
 	curves             []tls.CurveID
 	points             []uint8
+	serverName         string // SNI
+}
+
+// ja3 returns the JA3 fingerprint of the client: its version, cipher
+// suites, extensions, curves and point formats, in decimal, without
+// the GREASE values that clients add at random.
+// https://github.com/salesforce/ja3
+func (info rawHelloInfo) ja3() string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(int(info.version)))
+	writeList := func(values []uint16) {
+		b.WriteByte(',')
+		first := true
+		for _, v := range values {
+			if isGrease(v) {
+				continue
+			}
+			if !first {
+				b.WriteByte('-')
+			}
+			b.WriteString(strconv.Itoa(int(v)))
+			first = false
+		}
+	}
+	writeList(info.cipherSuites)
+	writeList(info.extensions)
+	curves := make([]uint16, len(info.curves))
+	for i, c := range info.curves {
+		curves[i] = uint16(c)
+	}
+	writeList(curves)
+	points := make([]uint16, len(info.points))
+	for i, p := range info.points {
+		points[i] = uint16(p)
+	}
+	writeList(points)
+	return b.String()
+}
+
+// ja3Hash returns the MD5 hash of the JA3 fingerprint, in hex, which
+// is how fingerprints are usually listed.
+func (info rawHelloInfo) ja3Hash() string {
+	sum := md5.Sum([]byte(info.ja3()))
+	return hex.EncodeToString(sum[:])
+}
+
+// isGrease returns whether v is one of the GREASE values of RFC 8701.
+func isGrease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
 }
 
 // advertisesHeartbeatSupport returns true if info indicates
@@ -722,6 +801,7 @@ var greaseCiphers = map[uint16]struct{}{
 
 // Define variables used for TLS communication
 const (
+	extensionServerName        = 0
 	extensionOCSPStatusRequest = 5
 	extensionSupportedCurves   = 10 // also called "SupportedGroups"
 	extensionSupportedPoints   = 11
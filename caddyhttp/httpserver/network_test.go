@@ -0,0 +1,55 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseNetwork(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  string
+	}{
+		{"192.168.0.0/16", false, "192.168.0.0/16"},
+		{"192.168.1.2/16", false, "192.168.0.0/16"},
+		{"10.0.0.1", false, "10.0.0.1/32"},
+		{"::1", false, "::1/128"},
+		{"2001:db8::/32", false, "2001:db8::/32"},
+		{"10.0.0", true, ""},
+		{"10.0.0.0/33", true, ""},
+		{"localhost", true, ""},
+	} {
+		network, err := ParseNetwork(test.input)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if actual := network.String(); actual != test.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expected, actual)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	for i, test := range []struct {
+		remoteAddr string
+		expected   string
+	}{
+		{"10.0.0.1:1234", "10.0.0.1"},
+		{"[::1]:1234", "::1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"", ""},
+	} {
+		r := &http.Request{RemoteAddr: test.remoteAddr}
+		if actual := ClientIP(r); actual != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, actual)
+		}
+	}
+}
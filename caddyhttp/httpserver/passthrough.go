@@ -0,0 +1,214 @@
+package httpserver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// passthroughHelloTimeout limits how long a client may take
+	// to send its ClientHello before it is served as usual.
+	passthroughHelloTimeout = 10 * time.Second
+
+	// passthroughDialTimeout limits how long connecting to the
+	// backend of a site that passes TLS through may take.
+	passthroughDialTimeout = 10 * time.Second
+
+	// recordTypeHandshake is the type of the TLS record
+	// that carries the ClientHello.
+	recordTypeHandshake = 22
+)
+
+// errListenerClosed is returned by Accept once the listener is closed.
+var errListenerClosed = errors.New("use of closed network connection")
+
+// passthroughRoutes returns the backends of the sites in group that
+// pass TLS through, keyed by their host names, or nil if none do.
+func passthroughRoutes(group []*SiteConfig) map[string]string {
+	var routes map[string]string
+	for _, site := range group {
+		if site.Passthrough == "" {
+			continue
+		}
+		if routes == nil {
+			routes = make(map[string]string)
+		}
+		routes[strings.ToLower(site.Addr.Host)] = site.Passthrough
+	}
+	return routes
+}
+
+// passthroughListener routes the connections it accepts by the server
+// name (SNI) of their ClientHello: those to sites that pass TLS through
+// are relayed to their backends, still encrypted, and the rest are
+// returned by Accept, with the ClientHello intact, to be served as usual.
+type passthroughListener struct {
+	net.Listener
+	routes map[string]string // server name to backend address
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newPassthroughListener returns a passthroughListener that wraps ln
+// and accepts connections from it until it is closed.
+func newPassthroughListener(ln net.Listener, routes map[string]string) *passthroughListener {
+	l := &passthroughListener{
+		Listener: ln,
+		routes:   routes,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go l.acceptConns()
+	return l
+}
+
+// acceptConns accepts connections and routes each of them in its own
+// goroutine, so that a slow client can't hold up the others.
+func (l *passthroughListener) acceptConns() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				select {
+				case l.errs <- err:
+					continue
+				case <-l.done:
+					return
+				}
+			}
+			// keep returning the error, as a net.Listener would
+			for {
+				select {
+				case l.errs <- err:
+				case <-l.done:
+					return
+				}
+			}
+		}
+		go l.route(conn)
+	}
+}
+
+// Accept waits for and returns the next connection that isn't
+// passed through.
+func (l *passthroughListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+// Close closes the listener. Connections already passed through
+// stay open until either end closes them.
+func (l *passthroughListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// route reads the ClientHello of conn, then either relays conn to the
+// backend of its server name or hands it to Accept.
+func (l *passthroughListener) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(passthroughHelloTimeout))
+	record, info, err := readClientHello(conn)
+	conn.SetReadDeadline(time.Time{})
+
+	// whatever was read must still be read by whoever serves conn
+	conn = &replayConn{Conn: conn, r: io.MultiReader(bytes.NewReader(record), conn)}
+
+	if err == nil {
+		if backend := l.backend(info.serverName); backend != "" {
+			relay(conn, backend)
+			return
+		}
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// backend returns the backend of serverName, matching a wildcard
+// site such as *.example.com too, or "" if it isn't passed through.
+func (l *passthroughListener) backend(serverName string) string {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return ""
+	}
+	if backend, ok := l.routes[name]; ok {
+		return backend
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		return l.routes["*"+name[i:]]
+	}
+	return ""
+}
+
+// readClientHello reads the TLS record of the ClientHello from r and
+// parses it. It returns the bytes read even if there is an error.
+func readClientHello(r io.Reader) ([]byte, rawHelloInfo, error) {
+	hdr := make([]byte, 5)
+	if n, err := io.ReadFull(r, hdr); err != nil {
+		return hdr[:n], rawHelloInfo{}, err
+	}
+	if hdr[0] != recordTypeHandshake {
+		return hdr, rawHelloInfo{}, errors.New("not a TLS handshake")
+	}
+	length := int(uint16(hdr[3])<<8 | uint16(hdr[4]))
+	record := make([]byte, 5+length)
+	copy(record, hdr)
+	if n, err := io.ReadFull(r, record[5:]); err != nil {
+		return record[:5+n], rawHelloInfo{}, err
+	}
+	return record, parseRawClientHello(record[5:]), nil
+}
+
+// relay copies between conn and a connection to backend until either
+// is done, then closes both.
+func relay(conn net.Conn, backend string) {
+	defer conn.Close()
+	upstream, err := net.DialTimeout("tcp", backend, passthroughDialTimeout)
+	if err != nil {
+		log.Printf("[ERROR] Passing TLS through to %s: %v", backend, err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// replayConn is a net.Conn that reads from r, which begins with
+// what has already been read from the connection.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// Read reads from c.r.
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
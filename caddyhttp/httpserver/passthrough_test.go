@@ -0,0 +1,126 @@
+package httpserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPassthroughRoutes(t *testing.T) {
+	routes := passthroughRoutes([]*SiteConfig{
+		{Addr: Address{Host: "Example.com"}, Passthrough: "10.0.0.1:443"},
+		{Addr: Address{Host: "*.example.net"}, Passthrough: "10.0.0.2:8443"},
+		{Addr: Address{Host: "caddy.example.com"}},
+	})
+	l := &passthroughListener{routes: routes}
+	for _, test := range []struct {
+		serverName, expected string
+	}{
+		{"example.com", "10.0.0.1:443"},
+		{"EXAMPLE.com.", "10.0.0.1:443"},
+		{"a.example.net", "10.0.0.2:8443"},
+		{"a.b.example.net", ""},
+		{"example.net", ""},
+		{"caddy.example.com", ""},
+		{"", ""},
+	} {
+		if actual := l.backend(test.serverName); actual != test.expected {
+			t.Errorf("%s: Expected backend '%s', got '%s'", test.serverName, test.expected, actual)
+		}
+	}
+
+	if routes := passthroughRoutes([]*SiteConfig{{Addr: Address{Host: "example.com"}}}); routes != nil {
+		t.Errorf("Expected no routes, got %v", routes)
+	}
+}
+
+func TestPassthroughListener(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := newPassthroughListener(ln, map[string]string{
+		"backend.example": strings.TrimPrefix(backend.URL, "https://"),
+	})
+	defer pl.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := pl.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// a connection to a passed-through site is relayed, and its
+	// TLS is terminated by the backend
+	client := &http.Client{Transport: &http.Transport{
+		DialTLS: func(network, addr string) (net.Conn, error) {
+			return tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: "backend.example", InsecureSkipVerify: true})
+		},
+	}}
+	resp, err := client.Get("https://backend.example/")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "backend" {
+		t.Errorf("Expected body 'backend', got '%s' (%v)", body, err)
+	}
+	if state := resp.TLS; state == nil || len(state.PeerCertificates) == 0 ||
+		!state.PeerCertificates[0].Equal(backend.Certificate()) {
+		t.Error("Expected the backend's certificate")
+	}
+
+	// other connections are accepted as usual, with what was read
+	// of them intact
+	for _, test := range []struct {
+		serverName string
+		expected   byte
+	}{
+		{"other.example", recordTypeHandshake},
+		{"", 'G'}, // plain HTTP
+	} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.serverName != "" {
+			go tls.Client(conn, &tls.Config{ServerName: test.serverName}).Handshake()
+		} else {
+			conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		}
+		select {
+		case accepted := <-accepted:
+			accepted.SetReadDeadline(time.Now().Add(5 * time.Second))
+			first, err := bufio.NewReader(accepted).ReadByte()
+			if err != nil || first != test.expected {
+				t.Errorf("%q: Expected to read %d first, got %d (%v)", test.serverName, test.expected, first, err)
+			}
+			accepted.Close()
+		case <-time.After(5 * time.Second):
+			t.Errorf("%q: Expected connection to be accepted", test.serverName)
+		}
+		conn.Close()
+	}
+
+	pl.Close()
+	if _, err := pl.Accept(); err == nil {
+		t.Error("Expected an error accepting after close")
+	}
+}
@@ -0,0 +1,60 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/mholt/caddy"
+)
+
+// placeholdersCtxKey is the context key of the values of the
+// placeholders that middleware set for a request.
+const placeholdersCtxKey = caddy.CtxKey("placeholders")
+
+// placeholderValues are the values of the placeholders set for a
+// request, by placeholder, braces and all.
+type placeholderValues struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// WithPlaceholders returns r with somewhere to keep the values of
+// the placeholders that middleware set for it with SetPlaceholder.
+// The server gives every request that; tests and others that serve
+// requests themselves may use it to do the same.
+func WithPlaceholders(r *http.Request) *http.Request {
+	return r.WithContext(withPlaceholders(r.Context()))
+}
+
+func withPlaceholders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, placeholdersCtxKey, &placeholderValues{values: make(map[string]string)})
+}
+
+// SetPlaceholder sets the placeholder {key} to value for r. As the
+// values are kept with the request from when the server got it,
+// the replacers of all the middleware that handle it replace the
+// placeholder, even those, such as that of the log, that come
+// before the middleware that sets it, and however the response
+// writer is wrapped. Without WithPlaceholders, it does nothing.
+func SetPlaceholder(r *http.Request, key, value string) {
+	p, ok := r.Context().Value(placeholdersCtxKey).(*placeholderValues)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	p.values["{"+key+"}"] = value
+	p.mu.Unlock()
+}
+
+// placeholder returns the value of placeholder set for r, if any.
+func placeholder(r *http.Request, placeholder string) (string, bool) {
+	p, ok := r.Context().Value(placeholdersCtxKey).(*placeholderValues)
+	if !ok {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	value, ok := p.values[placeholder]
+	return value, ok
+}
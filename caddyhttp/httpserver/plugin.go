@@ -89,6 +89,15 @@ type httpContext struct {
 
 	// siteConfigs is the master list of all site configs.
 	siteConfigs []*SiteConfig
+
+	// tenant is the tenant whose sites these are, if any.
+	tenant *caddy.Tenant
+}
+
+// SetTenant makes the sites keep their TLS assets in the assets
+// path of t.
+func (h *httpContext) SetTenant(t caddy.Tenant) {
+	h.tenant = &t
 }
 
 func (h *httpContext) saveConfig(key string, cfg *SiteConfig) {
@@ -142,6 +151,9 @@ func (h *httpContext) InspectServerBlocks(sourceFile string, serverBlocks []cadd
 				},
 				originCaddyfile: sourceFile,
 			}
+			if h.tenant != nil {
+				cfg.TLS.StoragePath = h.tenant.AssetsPath
+			}
 			h.saveConfig(key, cfg)
 		}
 	}
@@ -181,7 +193,7 @@ func (h *httpContext) MakeServers() ([]caddy.Server, error) {
 			// is incorrect for this site.
 			cfg.Addr.Scheme = "https"
 		}
-		if cfg.Addr.Port == "" && ((!cfg.TLS.Manual && !cfg.TLS.SelfSigned) || cfg.TLS.OnDemand) {
+		if cfg.Addr.Port == "" && ((!cfg.TLS.Manual && !cfg.TLS.SelfSigned) || cfg.TLS.OnDemand || cfg.Passthrough != "") {
 			// this is vital, otherwise the function call below that
 			// sets the listener address will use the default port
 			// instead of 443 because it doesn't know about TLS.
@@ -189,6 +201,19 @@ func (h *httpContext) MakeServers() ([]caddy.Server, error) {
 		}
 	}
 
+	// the sites are served from their roots, also in a sandbox
+	// and a chroot, which they must be reachable from
+	for _, cfg := range h.siteConfigs {
+		if !strings.Contains(cfg.Root, "://") {
+			if err := caddy.CheckChroot(cfg.Root); err != nil {
+				return nil, fmt.Errorf("root of %s: %v", cfg.Addr, err)
+			}
+			caddy.RegisterReadablePath(cfg.Root)
+		}
+	}
+	// and request bodies are spooled to temporary files
+	caddy.RegisterWritableDir(os.TempDir())
+
 	// we must map (group) each config to a bind address
 	groups, err := groupSiteConfigsByListenAddr(h.siteConfigs)
 	if err != nil {
@@ -215,12 +240,13 @@ func GetConfig(c *caddy.Controller) *SiteConfig {
 	ctx := c.Context().(*httpContext)
 	key := strings.ToLower(c.Key)
 	if cfg, ok := ctx.keysToSiteConfigs[key]; ok {
+		cfg.directive = c.Directive
 		return cfg
 	}
 	// we should only get here during tests because directive
 	// actions typically skip the server blocks where we make
 	// the configs
-	cfg := &SiteConfig{Root: Root, TLS: new(caddytls.Config)}
+	cfg := &SiteConfig{Root: Root, TLS: new(caddytls.Config), directive: c.Directive}
 	ctx.saveConfig(key, cfg)
 	return cfg
 }
@@ -242,6 +268,46 @@ func shortCaddyfileLoader(serverType string) (caddy.Input, error) {
 	return nil, nil
 }
 
+// Listeners implements caddy.ListenersReporter. It tells the
+// addresses the sites of serverBlocks would be served on, as well
+// as it can without executing their directives: sites that qualify
+// for automatic HTTPS are assumed to get it, with a redirect from
+// HTTP, unless their tls directive turns it off.
+func (h *httpContext) Listeners(serverBlocks []caddyfile.ServerBlock) []string {
+	var listeners []string
+	for _, sb := range serverBlocks {
+		tlsOff := firstArg(sb, "tls") == "off"
+		host := firstArg(sb, "bind")
+		for _, key := range sb.Keys {
+			cfg, ok := h.keysToSiteConfigs[strings.ToLower(key)]
+			if !ok {
+				continue
+			}
+			port := cfg.Addr.Port
+			switch {
+			case port != "":
+			case cfg.Addr.Scheme != "http" && !tlsOff && caddytls.HostQualifies(cfg.Addr.Host):
+				port = HTTPSPort
+				listeners = append(listeners, net.JoinHostPort(host, HTTPPort))
+			default:
+				port = Port
+			}
+			listeners = append(listeners, net.JoinHostPort(host, port))
+		}
+	}
+	return listeners
+}
+
+// firstArg returns the first argument of the first use of the
+// directive dir in sb, or "" if there is none.
+func firstArg(sb caddyfile.ServerBlock, dir string) string {
+	tokens := sb.Tokens[dir]
+	if len(tokens) < 2 || tokens[1].Line != tokens[0].Line {
+		return ""
+	}
+	return tokens[1].Text
+}
+
 // groupSiteConfigsByListenAddr groups site configs by their listen
 // (bind) address, so sites that use the same listener can be served
 // on the same server instance. The return value maps the listen
@@ -388,6 +454,9 @@ func standardizeAddress(str string) (Address, error) {
 // Directive names must be lower-cased and unique. Any errors
 // here are fatal, and even successful calls print a message
 // to stdout as a reminder to use it only in development.
+//
+// To give a directive its place for good, set the Before or
+// After fields of its caddy.Plugin instead.
 func RegisterDevDirective(name, before string) {
 	if name == "" {
 		fmt.Println("[FATAL] Cannot register empty directive name")
@@ -435,15 +504,28 @@ var directives = []string{
 	// primitive actions that set up the fundamental vitals of each config
 	"root",
 	"index",
+	"hide",
+	"languages",
 	"bind",
 	"limits",
 	"timeouts",
+	"validate_requests",
+	"conn_limit",
+	"passthrough", // must come before tls, so that passed-through sites aren't managed
 	"tls",
+	"acme_challenge",
+	"https_redirect",
 
 	// services/utilities, or other directives that don't necessarily inject handlers
 	"startup",
 	"shutdown",
+	"on",
+	"privileges",
+	"tenant",
 	"request_id",
+	"tracing",
+	"request_trace",
+	"real_ip",
 	"realip", // github.com/captncraig/caddy-realip
 	"git",    // github.com/abiosoft/caddy-git
 
@@ -451,23 +533,52 @@ var directives = []string{
 	"proxyprotocol", // github.com/mastercactapus/caddy-proxyprotocol
 
 	// directives that add middleware to the stack
+	"recover", // must be first, to recover from the panics of the rest
+	"map",
 	"locale", // github.com/simia-tech/caddy-locale
+	"health",
 	"log",
+	"audit",
+	"accounting",
+	"load_shed",
+	"honeypot",
+	"ban",
+	"waf", // before the rest, so that they don't see the requests it blocks
+	"bots",
+	"canonical",
 	"cache", // github.com/nicolasazrak/caddy-cache
+	"transform",
 	"rewrite",
+	"try_files",
+	"spa",
 	"ext",
+	"throttle",
 	"gzip",
+	"cache_control",
+	"hsts",
 	"header",
+	"disposition",
 	"errors",
-	"authz",        // github.com/casbin/caddy-authz
-	"filter",       // github.com/echocat/caddy-filter
-	"minify",       // github.com/hacdias/caddy-minify
+	"response",
+	"authz",  // github.com/casbin/caddy-authz
+	"filter", // github.com/echocat/caddy-filter
+	"minify",
+	"inject",
 	"ipfilter",     // github.com/pyed/ipfilter
 	"ratelimit",    // github.com/xuqingfeng/caddy-rate-limit
 	"search",       // github.com/pedronasser/caddy-search
 	"expires",      // github.com/epicagency/caddy-expires
 	"forwardproxy", // github.com/caddyserver/forwardproxy
 	"basicauth",
+	"oidc",
+	"forward_auth",
+	"api_keys",
+	"authorize",
+	"quota",
+	"signed_url",
+	"split", // after authentication, so that it doesn't give cookies to those who fail it
+	"webhook",
+	"forms",
 	"redir",
 	"status",
 	"cors",   // github.com/captncraig/cors/caddy
@@ -482,16 +593,22 @@ var directives = []string{
 	"internal",
 	"pprof",
 	"expvar",
+	"metrics",
 	"push",
+	"sse",
 	"datadog",    // github.com/payintech/caddy-datadog
 	"prometheus", // github.com/miekg/caddy-prometheus
+	"esi",
+	"ssi",
 	"templates",
 	"proxy",
+	"external",
 	"fastcgi",
 	"cgi", // github.com/jung-kurt/caddy-cgi
 	"websocket",
 	"filemanager", // github.com/hacdias/filemanager/caddy/filemanager
-	"webdav",      // github.com/hacdias/caddy-webdav
+	"webdav",
+	"images",
 	"markdown",
 	"browse",
 	"jekyll",    // github.com/hacdias/filemanager/caddy/jekyll
@@ -153,6 +153,35 @@ func TestInspectServerBlocksCaseInsensitiveKey(t *testing.T) {
 	}
 }
 
+func TestListeners(t *testing.T) {
+	defer func(port string) { Port = port }(Port)
+	Port = DefaultPort
+	filename := "Testfile"
+	ctx := newContext().(*httpContext)
+	input := strings.NewReader(`example.com {
+}
+http://plain.example.com {
+}
+localhost:2015 {
+	bind 127.0.0.1
+}
+internal.example.com {
+	tls off
+}`)
+	sblocks, err := caddyfile.Parse(filename, input, nil)
+	if err != nil {
+		t.Fatalf("Expected no error setting up test, got: %v", err)
+	}
+	sblocks, err = ctx.InspectServerBlocks(filename, sblocks)
+	if err != nil {
+		t.Fatalf("Didn't expect an error, but got: %v", err)
+	}
+	expected := []string{":80", ":443", ":80", "127.0.0.1:2015", ":2015"}
+	if actual := ctx.Listeners(sblocks); strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected listeners %v, got %v", expected, actual)
+	}
+}
+
 func TestGetConfig(t *testing.T) {
 	// case insensitivity for key
 	con := caddy.NewTestController("http", "")
@@ -0,0 +1,198 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout limits how long a trusted peer may take to
+// send the PROXY protocol header of a connection.
+const proxyHeaderTimeout = 10 * time.Second
+
+// proxyV2Signature begins the header of version 2 of the PROXY protocol.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolNetworks returns the networks from which the sites
+// in group accept PROXY protocol headers, or nil if none do.
+func proxyProtocolNetworks(group []*SiteConfig) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, site := range group {
+		networks = append(networks, site.ProxyProtocol...)
+	}
+	return networks
+}
+
+// proxyProtocolListener accepts connections whose remote address,
+// if they come from a trusted network, is the source address that
+// their PROXY protocol header gives.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+// Accept accepts the next connection.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !inNetworks(l.trusted, conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// inNetworks returns whether addr is in one of networks.
+func inNetworks(networks []*net.IPNet, addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyProtocolConn is a connection that begins with a PROXY protocol
+// header. The header is read on first use, rather than by Accept, so
+// that a slow peer can't hold up other connections.
+type proxyProtocolConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr // from the header, if not nil
+	err    error
+}
+
+// readHeader reads the header, once.
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.err = fmt.Errorf("PROXY protocol header from %s: %v", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+// Read reads from the connection after its header.
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the source address in the header, or that of
+// the peer if there's none.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads a PROXY protocol header of either version
+// from r and returns the source address it gives, which is nil if it
+// gives none, as for health checks of the proxy itself. Connections
+// without a header are let through as they are.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch first[0] {
+	case 'P':
+		if prefix, err := r.Peek(6); err != nil || string(prefix) != "PROXY " {
+			return nil, nil
+		}
+		return readProxyHeaderV1(r)
+	case proxyV2Signature[0]:
+		if prefix, err := r.Peek(len(proxyV2Signature)); err != nil || !bytes.Equal(prefix, proxyV2Signature) {
+			return nil, nil
+		}
+		return readProxyHeaderV2(r)
+	}
+	return nil, nil
+}
+
+// readProxyHeaderV1 reads a header such as
+//
+//	PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 { // the longest header allowed
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("header too long")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed header %q", strings.TrimSpace(string(line)))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed source address %s:%s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads a header of the binary version 2.
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	verCmd, family := hdr[12], hdr[13]
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported version %d", verCmd>>4)
+	}
+	if verCmd&0xF == 0 { // LOCAL: the proxy's own connection
+		return nil, nil
+	}
+	switch family >> 4 {
+	case 1: // IPv4
+		if len(body) < 12 {
+			return nil, errors.New("short IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}, nil
+	case 2: // IPv6
+		if len(body) < 36 {
+			return nil, errors.New("short IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}, nil
+	}
+	return nil, nil
+}
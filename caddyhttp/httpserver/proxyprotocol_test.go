@@ -0,0 +1,106 @@
+package httpserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func proxyHeaderV2(cmd byte, family byte, addrs []byte) string {
+	hdr := append([]byte{}, proxyV2Signature...)
+	hdr = append(hdr, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(hdr[14:], uint16(len(addrs)))
+	return string(append(hdr, addrs...))
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	v4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xDC, 0x04, 0x01, 0xBB}
+	v6 := make([]byte, 36)
+	copy(v6, net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(v6[32:], 56324)
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expect    string // the source address, or "" if none
+	}{
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n", false, "192.0.2.1:56324"},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\nGET / HTTP/1.1\r\n", false, "[2001:db8::1]:56324"},
+		{"PROXY UNKNOWN\r\nGET / HTTP/1.1\r\n", false, ""},
+		{proxyHeaderV2(1, 0x11, v4) + "GET / HTTP/1.1\r\n", false, "192.0.2.1:56324"},
+		{proxyHeaderV2(1, 0x21, v6) + "GET / HTTP/1.1\r\n", false, "[2001:db8::1]:56324"},
+		{proxyHeaderV2(0, 0x00, nil) + "GET / HTTP/1.1\r\n", false, ""},
+		{"GET / HTTP/1.1\r\n", false, ""},
+		{"POST / HTTP/1.1\r\n", false, ""},
+		{"PROXY TCP4 192.0.2.1\r\nGET / HTTP/1.1\r\n", true, ""},
+		{"PROXY TCP4 nonsense 198.51.100.1 56324 443\r\nGET / HTTP/1.1\r\n", true, ""},
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443" + strings.Repeat(" ", 100) + "\r\n", true, ""},
+		{proxyHeaderV2(1, 0x11, v4[:4]), true, ""},
+	}
+
+	for i, test := range tests {
+		r := bufio.NewReader(strings.NewReader(test.input))
+		addr, err := readProxyHeader(r)
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		var got string
+		if addr != nil {
+			got = addr.String()
+		}
+		if got != test.expect {
+			t.Errorf("Test %d: Expected source address %q, got %q", i, test.expect, got)
+		}
+		if rest, _ := ioutil.ReadAll(r); !strings.HasPrefix(string(rest), "GET ") && !strings.HasPrefix(string(rest), "POST ") {
+			t.Errorf("Test %d: Expected the request to follow the header, got %q", i, rest)
+		}
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	for i, test := range []struct {
+		trusted string
+		expect  string
+	}{
+		{"127.0.0.0/8", "192.0.2.1"},
+		{"10.0.0.0/8", "127.0.0.1"}, // the header isn't read from others
+	} {
+		_, trusted, _ := net.ParseCIDR(test.trusted)
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln := &proxyProtocolListener{Listener: inner, trusted: []*net.IPNet{trusted}}
+
+		go func() {
+			conn, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello"))
+		}()
+
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if host != test.expect {
+			t.Errorf("Test %d: Expected remote address %s, got %s", i, test.expect, host)
+		}
+		data, _ := ioutil.ReadAll(conn)
+		if test.expect == "192.0.2.1" && string(data) != "hello" {
+			t.Errorf("Test %d: Expected to read what follows the header, got %q", i, data)
+		}
+		conn.Close()
+		ln.Close()
+	}
+}
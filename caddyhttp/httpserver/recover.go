@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+var panicsTotal = metrics.NewCounter("caddy_http_panics_total",
+	"Number of panics recovered while handling HTTP requests, by site and handler.",
+	"site", "handler")
+
+// Panic is a panic recovered while handling a request.
+type Panic struct {
+	Time       time.Time    `json:"time"`
+	Site       string       `json:"site"`
+	Method     string       `json:"method"`
+	Host       string       `json:"host"`
+	URI        string       `json:"uri"`
+	RemoteAddr string       `json:"remote_addr"`
+	Handler    string       `json:"handler,omitempty"` // see FailedHandler
+	Value      string       `json:"value"`             // what was panicked with
+	Stack      []StackFrame `json:"stack"`             // from where it panicked
+}
+
+// StackFrame is a function call in the stack of a Panic.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// RecoverPanic logs and counts rec, the value recovered from a panic
+// while handling r for site, and returns it as a Panic. It must be
+// called by the deferred function that recovered it, for the stack
+// to be that of the panic. http.ErrAbortHandler, with which handlers
+// abort responses on purpose, is panicked with again instead.
+func RecoverPanic(site string, r *http.Request, rec interface{}) *Panic {
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+	p := &Panic{
+		Time:       time.Now(),
+		Site:       site,
+		Method:     r.Method,
+		Host:       r.Host,
+		URI:        r.RequestURI,
+		RemoteAddr: r.RemoteAddr,
+		Handler:    FailedHandler(r),
+		Value:      fmt.Sprint(rec),
+		Stack:      panicStack(),
+	}
+	panicsTotal.Inc(site, p.Handler)
+	log.Print(p)
+	return p
+}
+
+// String returns the panic as it is logged: a line about the request
+// and what was panicked with, then a line for each frame of the stack.
+func (p *Panic) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[PANIC] %s %s %s%s from %s", p.Site, p.Method, p.Host, p.URI, p.RemoteAddr)
+	if p.Handler != "" {
+		fmt.Fprintf(&b, " in %s", p.Handler)
+	}
+	fmt.Fprintf(&b, ": %s", p.Value)
+	for _, frame := range p.Stack {
+		fmt.Fprintf(&b, "\n\tat %s (%s:%d)", frame.Function, frame.File, frame.Line)
+	}
+	return b.String()
+}
+
+// panicStack returns the stack of the goroutine from where it
+// panicked, when called while it's panicking.
+func panicStack() []StackFrame {
+	pc := make([]uintptr, 64)
+	pc = pc[:runtime.Callers(1, pc)]
+	var stack []StackFrame
+	frames := runtime.CallersFrames(pc)
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			stack = nil // what came before is recovering it
+		} else {
+			stack = append(stack, StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
@@ -0,0 +1,56 @@
+package httpserver
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	var p *Panic
+	func() {
+		defer func() {
+			p = RecoverPanic("panic.test:80", httptest.NewRequest("GET", "/x", nil), recover())
+		}()
+		panicking()
+	}()
+
+	if p.Value != "oops" || p.Site != "panic.test:80" || p.URI != "/x" {
+		t.Errorf("Expected the panic of the request, got %+v", p)
+	}
+	if len(p.Stack) == 0 || !strings.HasSuffix(p.Stack[0].Function, ".panicking") {
+		t.Errorf("Expected the stack to begin where it panicked, got %+v", p.Stack)
+	}
+	if !strings.Contains(buf.String(), "[PANIC] panic.test:80 GET example.com/x from 192.0.2.1:1234: oops\n\tat ") {
+		t.Errorf("Expected the panic to be logged, got %q", buf.String())
+	}
+
+	var metricsBuf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&metricsBuf)
+	if expected := `caddy_http_panics_total{site="panic.test:80",handler=""} 1`; !strings.Contains(metricsBuf.String(), expected) {
+		t.Errorf("Expected %s in metrics, got:\n%s", expected, metricsBuf.String())
+	}
+}
+
+func panicking() {
+	panic("oops")
+}
+
+func TestRecoverPanicAbort(t *testing.T) {
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler to be panicked with again, got %v", rec)
+		}
+	}()
+	RecoverPanic("panic.test:80", httptest.NewRequest("GET", "/", nil), http.ErrAbortHandler)
+}
@@ -30,7 +30,9 @@ var now = time.Now
 // Replacer is a type which can replace placeholder
 // substrings in a string with actual values from a
 // http.Request and ResponseRecorder. Always use
-// NewReplacer to get one of these. Any placeholders
+// NewReplacer to get one of these. Values are only
+// computed for the placeholders that actually appear
+// in the string being replaced. Any placeholders
 // made with Set() should overwrite existing values if
 // the key is already used.
 type Replacer interface {
@@ -42,13 +44,15 @@ type Replacer interface {
 // is used to store custom replacements created with
 // Set() until the time of replacement, at which point
 // they will be used to overwrite other replacements
-// if there is a name conflict.
+// if there is a name conflict. query caches the parsed
+// query string the first time it is needed.
 type replacer struct {
 	customReplacements map[string]string
 	emptyValue         string
 	responseRecorder   *ResponseRecorder
 	request            *http.Request
 	requestBody        *limitWriter
+	query              url.Values
 }
 
 type limitWriter struct {
@@ -82,26 +86,28 @@ func (lw *limitWriter) String() string {
 
 // NewReplacer makes a new replacer based on r and rr which
 // are used for request and response placeholders, respectively.
-// Request placeholders are created immediately, whereas
-// response placeholders are not created until Replace()
-// is invoked. rr may be nil if it is not available.
-// emptyValue should be the string that is used in place
-// of empty string (can still be empty string).
+// No placeholder values are computed until Replace() is
+// invoked, and then only those used in the string. rr may
+// be nil if it is not available. emptyValue should be the
+// string that is used in place of empty string (can still
+// be empty string).
 func NewReplacer(r *http.Request, rr *ResponseRecorder, emptyValue string) Replacer {
-	rb := newLimitWriter(MaxLogBodySize)
-	if r.Body != nil {
+	repl := &replacer{
+		request:          r,
+		responseRecorder: rr,
+		emptyValue:       emptyValue,
+	}
+	// the body can only be read once, so it has to be
+	// captured as it goes by, but only if it could ever
+	// be logged
+	if r.Body != nil && canLogRequest(r) {
+		repl.requestBody = newLimitWriter(MaxLogBodySize)
 		r.Body = struct {
 			io.Reader
 			io.Closer
-		}{io.TeeReader(r.Body, rb), io.Closer(r.Body)}
-	}
-	return &replacer{
-		request:            r,
-		requestBody:        rb,
-		responseRecorder:   rr,
-		customReplacements: make(map[string]string),
-		emptyValue:         emptyValue,
+		}{io.TeeReader(r.Body, repl.requestBody), io.Closer(r.Body)}
 	}
+	return repl
 }
 
 func canLogRequest(r *http.Request) bool {
@@ -124,7 +130,7 @@ func (r *replacer) Replace(s string) string {
 		return s
 	}
 
-	result := ""
+	var result bytes.Buffer
 	for {
 		idxStart := strings.Index(s, "{")
 		if idxStart == -1 {
@@ -143,14 +149,16 @@ func (r *replacer) Replace(s string) string {
 		replacement := r.getSubstitution(placeholder)
 
 		// append prefix + replacement
-		result += s[:idxStart] + replacement
+		result.WriteString(s[:idxStart])
+		result.WriteString(replacement)
 
 		// strip out scanned parts
 		s = s[idxEnd+1:]
 	}
 
 	// append unscanned parts
-	return result + s
+	result.WriteString(s)
+	return result.String()
 }
 
 func roundDuration(d time.Duration) time.Duration {
@@ -189,6 +197,10 @@ func (r *replacer) getSubstitution(key string) string {
 	if value, ok := r.customReplacements[key]; ok {
 		return value
 	}
+	// then those set for the request
+	if value, ok := placeholder(r.request, key); ok {
+		return value
+	}
 
 	// search request headers then
 	if key[1] == '>' {
@@ -209,9 +221,51 @@ func (r *replacer) getSubstitution(key string) string {
 	}
 	// next check for query argument
 	if key[1] == '?' {
-		query := r.request.URL.Query()
+		if r.query == nil {
+			r.query = r.request.URL.Query()
+		}
 		name := key[2 : len(key)-1]
-		return query.Get(name)
+		return r.query.Get(name)
+	}
+	// next check for response headers
+	if key[1] == '<' {
+		if r.responseRecorder == nil {
+			return r.emptyValue
+		}
+		want := key[2 : len(key)-1]
+		if values := r.responseRecorder.Header()[http.CanonicalHeaderKey(want)]; len(values) > 0 {
+			return strings.Join(values, ",")
+		}
+		return r.emptyValue
+	}
+	// next check for environment variables; unlike {$VAR}, which
+	// is replaced when the Caddyfile is parsed, {env.VAR} is looked
+	// up each time
+	if strings.HasPrefix(key, "{env.") {
+		if value := os.Getenv(key[5 : len(key)-1]); value != "" {
+			return value
+		}
+		return r.emptyValue
+	}
+
+	// next check for maps
+	if strings.HasPrefix(key, "{map.") {
+		maps, _ := r.request.Context().Value(MapsCtxKey).(map[string]func(*http.Request) string)
+		if lookup, ok := maps[key[5:len(key)-1]]; ok {
+			if value := lookup(r.request); value != "" {
+				return value
+			}
+		}
+		return r.emptyValue
+	}
+
+	// next check for the variants of experiments
+	if strings.HasPrefix(key, "{split.") {
+		variants, _ := r.request.Context().Value(SplitCtxKey).(map[string]string)
+		if variant, ok := variants[key[7:len(key)-1]]; ok {
+			return variant
+		}
+		return r.emptyValue
 	}
 
 	// search default replacements in the end
@@ -246,6 +300,12 @@ func (r *replacer) getSubstitution(key string) string {
 	case "{request_id}":
 		reqid, _ := r.request.Context().Value(RequestIDCtxKey).(string)
 		return reqid
+	case "{trace_id}":
+		traceID, _ := r.request.Context().Value(TraceIDCtxKey).(string)
+		return traceID
+	case "{span_id}":
+		spanID, _ := r.request.Context().Value(SpanIDCtxKey).(string)
+		return spanID
 	case "{rewrite_path}":
 		return r.request.URL.Path
 	case "{rewrite_path_escaped}":
@@ -267,6 +327,16 @@ func (r *replacer) getSubstitution(key string) string {
 			return r.request.RemoteAddr
 		}
 		return host
+	case "{peer}":
+		addr, ok := r.request.Context().Value(PeerAddrCtxKey).(string)
+		if !ok {
+			addr = r.request.RemoteAddr
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return addr
+		}
+		return host
 	case "{port}":
 		_, port, err := net.SplitHostPort(r.request.RemoteAddr)
 		if err != nil {
@@ -287,8 +357,12 @@ func (r *replacer) getSubstitution(key string) string {
 		return now().Format(timeFormat)
 	case "{when_iso}":
 		return now().UTC().Format(timeFormatISOUTC)
+	case "{when_iso_local}":
+		return now().Format(timeFormatISO)
 	case "{when_unix}":
 		return strconv.FormatInt(now().Unix(), 10)
+	case "{when_unix_ms}":
+		return strconv.FormatInt(now().UnixNano()/int64(time.Millisecond), 10)
 	case "{file}":
 		_, file := path.Split(r.request.URL.Path)
 		return file
@@ -302,7 +376,7 @@ func (r *replacer) getSubstitution(key string) string {
 		}
 		return requestReplacer.Replace(string(dump))
 	case "{request_body}":
-		if !canLogRequest(r.request) {
+		if r.requestBody == nil || !canLogRequest(r.request) {
 			return r.emptyValue
 		}
 		_, err := ioutil.ReadAll(r.request.Body)
@@ -320,6 +394,18 @@ func (r *replacer) getSubstitution(key string) string {
 			return "unlikely"
 		}
 		return "unknown"
+	case "{tls_ja3}":
+		ja3, _ := r.request.Context().Value(TLSFingerprintCtxKey).(string)
+		return ja3
+	case "{bot_class}":
+		class, _ := r.request.Context().Value(BotClassCtxKey).(string)
+		return class
+	case "{window}":
+		windows, _ := r.request.Context().Value(WindowsCtxKey).([]string)
+		if len(windows) == 0 {
+			return r.emptyValue
+		}
+		return strings.Join(windows, ",")
 	case "{status}":
 		if r.responseRecorder == nil {
 			return r.emptyValue
@@ -341,6 +427,11 @@ func (r *replacer) getSubstitution(key string) string {
 		}
 		elapsedDuration := time.Since(r.responseRecorder.start)
 		return strconv.FormatInt(convertToMilliseconds(elapsedDuration), 10)
+	case "{middleware_timings}":
+		if timings := middlewareTimings(r.request); timings != "" {
+			return timings
+		}
+		return r.emptyValue
 	}
 
 	return r.emptyValue
@@ -353,12 +444,16 @@ func convertToMilliseconds(d time.Duration) int64 {
 
 // Set sets key to value in the r.customReplacements map.
 func (r *replacer) Set(key, value string) {
+	if r.customReplacements == nil {
+		r.customReplacements = make(map[string]string)
+	}
 	r.customReplacements["{"+key+"}"] = value
 }
 
 const (
 	timeFormat        = "02/Jan/2006:15:04:05 -0700"
-	timeFormatISOUTC  = "2006-01-02T15:04:05Z" // ISO 8601 with timezone to be assumed as UTC
+	timeFormatISO     = "2006-01-02T15:04:05-07:00" // ISO 8601 with numeric timezone offset
+	timeFormatISOUTC  = "2006-01-02T15:04:05Z"      // ISO 8601 with timezone to be assumed as UTC
 	headerContentType = "Content-Type"
 	contentTypeJSON   = "application/json"
 	contentTypeXML    = "application/xml"
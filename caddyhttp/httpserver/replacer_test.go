@@ -65,6 +65,9 @@ func TestReplace(t *testing.T) {
 	defer func() {
 		now = old
 	}()
+	recordRequest.Header().Set("X-Served-By", "caddy")
+	os.Setenv("CADDY_REPLACER_TEST", "envvalue")
+	defer os.Unsetenv("CADDY_REPLACER_TEST")
 	testCases := []struct {
 		template string
 		expect   string
@@ -92,6 +95,12 @@ func TestReplace(t *testing.T) {
 		{"Query string is {query}", "Query string is foo=bar"},
 		{"Query string value for foo is {?foo}", "Query string value for foo is bar"},
 		{"Missing query string argument is {?missing}", "Missing query string argument is "},
+		{"{when_iso_local}", "2006-01-02T15:04:05+00:00"},
+		{"{when_unix_ms}", "1136214252000"},
+		{"The response header is {<X-Served-By}.", "The response header is caddy."},
+		{"Missing response header is {<Missing}", "Missing response header is -"},
+		{"The environment variable is {env.CADDY_REPLACER_TEST}.", "The environment variable is envvalue."},
+		{"Missing environment variable is {env.CADDY_REPLACER_MISSING}", "Missing environment variable is -"},
 	}
 
 	for _, c := range testCases {
@@ -154,8 +163,77 @@ func TestSet(t *testing.T) {
 	}
 }
 
+func TestMapPlaceholders(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost/old", nil)
+	if err != nil {
+		t.Fatalf("Request Formation Failed: %s\n", err.Error())
+	}
+	lookups := map[string]func(*http.Request) string{
+		"redirects": func(r *http.Request) string { return "/new" + r.URL.Path },
+		"empty":     func(r *http.Request) string { return "" },
+	}
+	request = request.WithContext(context.WithValue(request.Context(), MapsCtxKey, lookups))
+	repl := NewReplacer(request, nil, "-")
+
+	if got, want := repl.Replace("{map.redirects} {map.empty} {map.none}"), "/new/old - -"; got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+}
+
+func TestSplitPlaceholders(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost/", nil)
+	if err != nil {
+		t.Fatalf("Request Formation Failed: %s\n", err.Error())
+	}
+	variants := map[string]string{"homepage": "b"}
+	request = request.WithContext(context.WithValue(request.Context(), SplitCtxKey, variants))
+	repl := NewReplacer(request, nil, "-")
+
+	if got, want := repl.Replace("{split.homepage} {split.none}"), "b -"; got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+}
+
+func TestWindowPlaceholder(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost/", nil)
+	if err != nil {
+		t.Fatalf("Request Formation Failed: %s\n", err.Error())
+	}
+	if got, want := NewReplacer(request, nil, "-").Replace("{window}"), "-"; got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+	request = request.WithContext(context.WithValue(request.Context(), WindowsCtxKey, []string{"business", "lunch"}))
+	if got, want := NewReplacer(request, nil, "-").Replace("{window}"), "business,lunch"; got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+}
+
 // Test function to test that various placeholders hold correct values after a rewrite
 // has been performed.  The NewRequest actually contains the rewritten value.
+func TestRequestBodyOnlyCapturedWhenLoggable(t *testing.T) {
+	for i, test := range []struct {
+		contentType string
+		expect      string
+	}{
+		{"application/json", `{"username": "dennis"}`},
+		{"text/plain", "-"},
+	} {
+		request, err := http.NewRequest("POST", "http://localhost", strings.NewReader(`{"username": "dennis"}`))
+		if err != nil {
+			t.Fatalf("Test %d: Request Formation Failed: %v", i, err)
+		}
+		request.Header.Set("Content-Type", test.contentType)
+		repl := NewReplacer(request, nil, "-")
+
+		if got := repl.Replace("{request_body}"); got != test.expect {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.expect, got)
+		}
+		if got := repl.(*replacer).requestBody != nil; got != (test.expect != "-") {
+			t.Errorf("Test %d: Expected body captured to be %v, got %v", i, !got, got)
+		}
+	}
+}
+
 func TestPathRewrite(t *testing.T) {
 	w := httptest.NewRecorder()
 	recordRequest := NewResponseRecorder(w)
@@ -226,3 +304,24 @@ func TestMillisecondConverstion(t *testing.T) {
 		}
 	}
 }
+
+func TestSetPlaceholder(t *testing.T) {
+	// without somewhere to keep it, it isn't kept
+	r := httptest.NewRequest("GET", "/", nil)
+	SetPlaceholder(r, "status_note", "ok")
+	if got := NewReplacer(r, nil, "-").Replace("{status_note}"); got != "-" {
+		t.Errorf("Expected the placeholder not to be set, got %q", got)
+	}
+
+	r = WithPlaceholders(httptest.NewRequest("GET", "/", nil))
+	repl := NewReplacer(r, nil, "-") // as by middleware before the one that sets it
+	inner := r.WithContext(context.WithValue(r.Context(), RemoteUserCtxKey, "alice"))
+	SetPlaceholder(inner, "status_note", "ok")
+	if got := repl.Replace("{status_note}"); got != "ok" {
+		t.Errorf("Expected the placeholder set by later middleware, got %q", got)
+	}
+	repl.Set("status_note", "overridden")
+	if got := repl.Replace("{status_note}"); got != "overridden" {
+		t.Errorf("Expected the replacer's own value to take precedence, got %q", got)
+	}
+}
@@ -0,0 +1,322 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+// RequestTrace is the record of a request kept for inspection, with
+// the time spent in each handler it passed through.
+type RequestTrace struct {
+	Time       time.Time       `json:"time"`
+	Site       string          `json:"site"`
+	Method     string          `json:"method"`
+	Host       string          `json:"host"`
+	URI        string          `json:"uri"`
+	RemoteAddr string          `json:"remote_addr"`
+	Status     int             `json:"status"`
+	DurationMS float64         `json:"duration_ms"`
+	Handlers   []HandlerTiming `json:"handlers"`
+}
+
+// HandlerTiming is the time spent in a handler by a request. Total
+// includes the handlers it passed the request on to; Self doesn't.
+// Start is since the request reached the first handler.
+type HandlerTiming struct {
+	Name    string  `json:"name"`
+	Depth   int     `json:"depth"`
+	StartMS float64 `json:"start_ms"`
+	TotalMS float64 `json:"total_ms"`
+	SelfMS  float64 `json:"self_ms"`
+
+	self time.Duration
+}
+
+// traceCtxKey is the context key of the trace of a request; see
+// traceHandler.
+const traceCtxKey = caddy.CtxKey("request_trace")
+
+// requestTrace collects the timings of a request as it passes
+// through the handlers of a chain.
+type requestTrace struct {
+	mu     sync.Mutex
+	start  time.Time
+	depth  int
+	spans  []span
+	failed string // the first handler to return an error or panic
+}
+
+// span is the time a request spent in a handler.
+type span struct {
+	name       string
+	depth      int
+	start, end time.Time
+}
+
+// enter records that the request entered the handler name, and
+// returns the index of its span.
+func (t *requestTrace) enter(name string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, span{name: name, depth: t.depth, start: time.Now()})
+	t.depth++
+	return len(t.spans) - 1
+}
+
+// exit records that the request left the handler of span i.
+func (t *requestTrace) exit(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans[i].end = time.Now()
+	t.depth--
+}
+
+// fail records that the handler name returned an error or panicked,
+// unless one it passed the request on to did so first.
+func (t *requestTrace) fail(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed == "" {
+		t.failed = name
+	}
+}
+
+// FailedHandler returns the name of the handler, such as the
+// directive of a middleware, that first returned an error or
+// panicked while handling r, or "" if none did. It is only known
+// on sites that time their handlers; see SiteConfig.TimeHandlers.
+func FailedHandler(r *http.Request) string {
+	t, ok := r.Context().Value(traceCtxKey).(*requestTrace)
+	if !ok {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
+
+// timings returns the timings of the handlers of t. Handlers the
+// request is still in are timed until now.
+func (t *requestTrace) timings() []HandlerTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	elapsed := func(s span) time.Duration {
+		if s.end.IsZero() {
+			return now.Sub(s.start)
+		}
+		return s.end.Sub(s.start)
+	}
+	timings := make([]HandlerTiming, len(t.spans))
+	for i, s := range t.spans {
+		total := elapsed(s)
+		self := total
+		for _, child := range t.spans[i+1:] {
+			if child.depth <= s.depth {
+				break
+			}
+			if child.depth == s.depth+1 {
+				self -= elapsed(child)
+			}
+		}
+		timings[i] = HandlerTiming{
+			Name:    s.name,
+			Depth:   s.depth,
+			StartMS: milliseconds(s.start.Sub(t.start)),
+			TotalMS: milliseconds(total),
+			SelfMS:  milliseconds(self),
+			self:    self,
+		}
+	}
+	return timings
+}
+
+// middlewareTimings returns the time each handler that r passed
+// through took itself, as name=duration pairs separated by commas,
+// for the {middleware_timings} placeholder, if the handlers of the
+// site are timed.
+func middlewareTimings(r *http.Request) string {
+	t, ok := r.Context().Value(traceCtxKey).(*requestTrace)
+	if !ok {
+		return ""
+	}
+	var pairs []string
+	for _, timing := range t.timings() {
+		pairs = append(pairs, timing.Name+"="+timing.self.Round(time.Microsecond).String())
+	}
+	return strings.Join(pairs, ",")
+}
+
+// milliseconds returns d in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// traceHandler wraps next so that the time requests spend in it is
+// recorded under name, if they are being traced, as is whether it
+// failed; see FailedHandler.
+func traceHandler(name string, next Handler) Handler {
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		t, ok := r.Context().Value(traceCtxKey).(*requestTrace)
+		if !ok {
+			return next.ServeHTTP(w, r)
+		}
+		i := t.enter(name)
+		returned := false
+		defer func() {
+			if !returned {
+				t.fail(name) // it panicked
+			}
+			t.exit(i)
+		}()
+		status, err := next.ServeHTTP(w, r)
+		returned = true
+		if err != nil {
+			t.fail(name)
+		}
+		return status, err
+	})
+}
+
+// timeChain wraps the middleware chain of a site so that the time
+// its requests spend in each handler wrapped by traceHandler is
+// recorded: observed in the metrics registry if metrics is set, and
+// kept in ring, if not nil, with the traces of the requests. Either
+// way, the timings are there for FailedHandler and the
+// {middleware_timings} placeholder while the request is handled.
+func timeChain(site string, ring *traceRing, metrics bool, next Handler) Handler {
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		t := &requestTrace{start: time.Now()}
+		traced := r.WithContext(context.WithValue(r.Context(), traceCtxKey, t))
+		if !metrics && ring == nil {
+			return next.ServeHTTP(w, traced)
+		}
+		rec := NewResponseRecorder(w)
+
+		status, err := next.ServeHTTP(rec, traced)
+
+		timings := t.timings()
+		if metrics {
+			for _, timing := range timings {
+				middlewareDuration.Observe(timing.self.Seconds(), site, timing.Name)
+			}
+		}
+		if ring != nil {
+			code := status
+			if code == 0 {
+				code = rec.Status()
+			}
+			ring.add(RequestTrace{
+				Time:       t.start,
+				Site:       site,
+				Method:     r.Method,
+				Host:       r.Host,
+				URI:        r.RequestURI,
+				RemoteAddr: r.RemoteAddr,
+				Status:     code,
+				DurationMS: milliseconds(time.Since(t.start)),
+				Handlers:   timings,
+			})
+		}
+		return status, err
+	})
+}
+
+// traceRing keeps the last traces added to it.
+type traceRing struct {
+	mu     sync.Mutex
+	traces []RequestTrace
+	next   int
+	full   bool
+}
+
+// add adds t to the ring, replacing the oldest trace if it is full.
+func (r *traceRing) add(t RequestTrace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.traces) == 0 {
+		return
+	}
+	r.traces[r.next] = t
+	r.next = (r.next + 1) % len(r.traces)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the traces of the ring, oldest first.
+func (r *traceRing) list() []RequestTrace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ordered()
+}
+
+// ordered returns the traces of the ring, oldest first; r.mu must be
+// held.
+func (r *traceRing) ordered() []RequestTrace {
+	if !r.full {
+		return append([]RequestTrace(nil), r.traces[:r.next]...)
+	}
+	return append(append([]RequestTrace(nil), r.traces[r.next:]...), r.traces[:r.next]...)
+}
+
+// resize makes the ring hold size traces, keeping the latest.
+func (r *traceRing) resize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size == len(r.traces) {
+		return
+	}
+	traces := r.ordered()
+	if len(traces) > size {
+		traces = traces[len(traces)-size:]
+	}
+	r.traces = make([]RequestTrace, size)
+	r.next = copy(r.traces, traces) % size
+	r.full = len(traces) == size
+}
+
+// traceRings are the rings of request traces of sites, by site
+// address. They are kept across restarts.
+var (
+	traceRings   = make(map[string]*traceRing)
+	traceRingsMu sync.Mutex
+)
+
+// siteTraceRing returns the ring of request traces of the site with
+// address addr, creating it if necessary, to hold size traces.
+func siteTraceRing(addr string, size int) *traceRing {
+	traceRingsMu.Lock()
+	defer traceRingsMu.Unlock()
+	ring, ok := traceRings[addr]
+	if !ok {
+		ring = new(traceRing)
+		traceRings[addr] = ring
+	}
+	ring.resize(size)
+	return ring
+}
+
+// RecentRequests returns the traces of the last requests to the
+// site with address site, or to all sites if site is empty, most
+// recent first.
+func RecentRequests(site string) []RequestTrace {
+	traceRingsMu.Lock()
+	var traces []RequestTrace
+	for addr, ring := range traceRings {
+		if site == "" || addr == site {
+			traces = append(traces, ring.list()...)
+		}
+	}
+	traceRingsMu.Unlock()
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].Time.After(traces[j].Time)
+	})
+	return traces
+}
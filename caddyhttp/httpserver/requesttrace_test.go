@@ -0,0 +1,170 @@
+package httpserver
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+func TestTraceRing(t *testing.T) {
+	ring := new(traceRing)
+	ring.resize(3)
+	for i := 1; i <= 4; i++ {
+		ring.add(RequestTrace{Status: i})
+	}
+	statuses := func() []int {
+		var s []int
+		for _, trace := range ring.list() {
+			s = append(s, trace.Status)
+		}
+		return s
+	}
+	if got := statuses(); len(got) != 3 || got[0] != 2 || got[2] != 4 {
+		t.Errorf("Expected the last 3 traces, oldest first, got %v", got)
+	}
+
+	ring.resize(2)
+	if got := statuses(); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("Expected the latest traces to be kept when shrinking, got %v", got)
+	}
+	ring.resize(4)
+	ring.add(RequestTrace{Status: 5})
+	if got := statuses(); len(got) != 3 || got[0] != 3 || got[2] != 5 {
+		t.Errorf("Expected the traces to be kept when growing, got %v", got)
+	}
+}
+
+func TestRecordTraces(t *testing.T) {
+	sleep := func(d time.Duration, next Handler) Handler {
+		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			time.Sleep(d)
+			return next.ServeHTTP(w, r)
+		})
+	}
+	var stack Handler = HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		time.Sleep(20 * time.Millisecond)
+		return http.StatusNotFound, nil
+	})
+	stack = traceHandler("fileserver", stack)
+	stack = traceHandler("rewrite", sleep(10*time.Millisecond, stack))
+	stack = traceHandler("log", stack)
+
+	ring := siteTraceRing("trace.test:80", 10)
+	stack = timeChain("trace.test:80", ring, false, stack)
+	stack.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	traces := RecentRequests("trace.test:80")
+	if len(traces) != 1 {
+		t.Fatalf("Expected 1 trace, got %d", len(traces))
+	}
+	trace := traces[0]
+	if trace.Status != http.StatusNotFound || trace.Method != "GET" || trace.URI != "/missing" {
+		t.Errorf("Unexpected trace: %+v", trace)
+	}
+	if trace.DurationMS < 30 {
+		t.Errorf("Expected the request to take at least 30ms, got %v", trace.DurationMS)
+	}
+	if len(trace.Handlers) != 3 {
+		t.Fatalf("Expected 3 handlers, got %+v", trace.Handlers)
+	}
+	for i, name := range []string{"log", "rewrite", "fileserver"} {
+		h := trace.Handlers[i]
+		if h.Name != name || h.Depth != i {
+			t.Errorf("Handler %d: expected %s at depth %d, got %+v", i, name, i, h)
+		}
+	}
+	if h := trace.Handlers[1]; h.SelfMS < 10 || h.SelfMS >= h.TotalMS {
+		t.Errorf("Expected rewrite to take at least 10ms itself, less than in total, got %+v", h)
+	}
+	if h := trace.Handlers[0]; h.SelfMS >= 10 {
+		t.Errorf("Expected log to take little time itself, got %+v", h)
+	}
+	if len(RecentRequests("other.test:80")) != 0 {
+		t.Error("Expected no traces for another site")
+	}
+}
+
+func TestMiddlewareTimings(t *testing.T) {
+	var timings string
+	var stack Handler = HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		time.Sleep(5 * time.Millisecond)
+		return http.StatusOK, nil
+	})
+	stack = traceHandler("fileserver", stack)
+	next := stack
+	stack = traceHandler("log", HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		status, err := next.ServeHTTP(w, r)
+		timings = NewReplacer(r, nil, "-").Replace("{middleware_timings}")
+		return status, err
+	}))
+	stack = timeChain("timings.test:80", nil, true, stack)
+
+	stack.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	pairs := strings.Split(timings, ",")
+	if len(pairs) != 2 || !strings.HasPrefix(pairs[0], "log=") || !strings.HasPrefix(pairs[1], "fileserver=") {
+		t.Fatalf("Expected timings of log and fileserver, got %q", timings)
+	}
+	d, err := time.ParseDuration(strings.TrimPrefix(pairs[1], "fileserver="))
+	if err != nil || d < 5*time.Millisecond {
+		t.Errorf("Expected fileserver to take at least 5ms, got %q", pairs[1])
+	}
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	for _, expected := range []string{
+		`caddy_http_middleware_duration_seconds_count{site="timings.test:80",handler="log"} 1`,
+		`caddy_http_middleware_duration_seconds_count{site="timings.test:80",handler="fileserver"} 1`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected %s in metrics, got:\n%s", expected, buf.String())
+		}
+	}
+
+	if got := NewReplacer(httptest.NewRequest("GET", "/", nil), nil, "-").Replace("{middleware_timings}"); got != "-" {
+		t.Errorf("Expected no timings outside of a chain, got %q", got)
+	}
+}
+
+func TestFailedHandler(t *testing.T) {
+	for i, test := range []struct {
+		fail   func() (int, error) // of the innermost handler
+		expect string
+	}{
+		{func() (int, error) { return http.StatusOK, nil }, ""},
+		{func() (int, error) { return http.StatusNotFound, nil }, ""},
+		{func() (int, error) { return http.StatusBadGateway, errors.New("no upstream") }, "proxy"},
+		{func() (int, error) { panic("oops") }, "proxy"},
+	} {
+		var failed string
+		var stack Handler = HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return test.fail()
+		})
+		stack = traceHandler("proxy", stack)
+		next := stack
+		stack = traceHandler("errors", HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			defer func() {
+				recover()
+				failed = FailedHandler(r)
+			}()
+			return next.ServeHTTP(w, r)
+		}))
+		stack = timeChain("failed.test:80", nil, false, stack)
+
+		stack.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		if failed != test.expect {
+			t.Errorf("Test %d: Expected failed handler %q, got %q", i, test.expect, failed)
+		}
+	}
+
+	if got := FailedHandler(httptest.NewRequest("GET", "/", nil)); got != "" {
+		t.Errorf("Expected no failed handler outside of a chain, got %q", got)
+	}
+}
@@ -52,6 +52,12 @@ func (rww *ResponseWriterWrapper) Push(target string, opts *http.PushOptions) er
 	return NonPusherError{Underlying: rww.ResponseWriter}
 }
 
+// Unwrap returns the underlying ResponseWriter, so that
+// http.ResponseController can reach the connection.
+func (rww *ResponseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rww.ResponseWriter
+}
+
 // HTTPInterfaces mix all the interfaces that middleware ResponseWriters need to support.
 type HTTPInterfaces interface {
 	http.ResponseWriter
@@ -16,6 +16,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/h2quic"
@@ -34,6 +35,12 @@ type Server struct {
 	connTimeout time.Duration // max time to wait for a connection before force stop
 	tlsGovChan  chan struct{} // close to stop the TLS maintenance goroutine
 	vhosts      *vhostTrie
+	passthrough map[string]string // backends of sites that pass TLS through
+	proxyProto  []*net.IPNet      // networks trusted to send PROXY protocol headers
+	validation  *RequestValidation
+	limits      connLimits
+	connLimit   *ConnLimit
+	refuseBans  bool
 }
 
 // ensure it satisfies the interface
@@ -75,10 +82,19 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		vhosts:      newVHostTrie(),
 		sites:       group,
 		connTimeout: GracefulTimeout,
+		passthrough: passthroughRoutes(group),
+		proxyProto:  proxyProtocolNetworks(group),
+		validation:  requestValidation(group),
+		limits:      slowClientLimits(group),
+		connLimit:   connLimit(group),
+		refuseBans:  refuseBanned(group),
 	}
 	s.vhosts.fallbackHosts = append(s.vhosts.fallbackHosts, getFallbacks(group)...)
 	s.Server = makeHTTPServerWithHeaderLimit(s.Server, group)
 	s.Server.Handler = s // this is weird, but whatever
+	if s.limits.maxRequests > 0 {
+		s.Server.ConnContext = countConnRequests
+	}
 
 	// extract TLS settings from each site config to build
 	// a tls.Config, which will not be nil if TLS is enabled
@@ -87,6 +103,7 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		return nil, err
 	}
 	s.Server.TLSConfig = tlsConfig
+	warnUnvalidated(addr, s.validation, tlsConfig != nil)
 
 	// if TLS is enabled, make sure we prepare the Server accordingly
 	if s.Server.TLSConfig != nil {
@@ -126,13 +143,50 @@ func NewServer(addr string, group []*SiteConfig) (*Server, error) {
 		}
 	}
 
+	// count open connections, in addition to anything
+	// else that needs to know about connection states
+	trackConn, connState := trackConnState(addr), s.Server.ConnState
+	s.Server.ConnState = func(c net.Conn, cs http.ConnState) {
+		trackConn(c, cs)
+		if connState != nil {
+			connState(c, cs)
+		}
+	}
+
 	// Compile custom middleware for every site (enables virtual hosting)
 	for _, site := range group {
-		stack := Handler(staticfiles.FileServer{Root: http.Dir(site.Root), Hide: site.HiddenFiles})
+		// requests are only timed if something uses the timings
+		timed := site.Metrics || site.TraceRequests > 0 || site.TimeHandlers
+		stack := Handler(staticfiles.FileServer{Root: site.FileSystem(), Hide: site.HiddenFiles, Languages: site.Languages})
+		if timed {
+			stack = traceHandler(fileServerName, stack)
+		}
+		if site.Metrics {
+			stack = nameHandler(fileServerName, stack)
+		}
 		for i := len(site.middleware) - 1; i >= 0; i-- {
 			stack = site.middleware[i](stack)
+			if i < len(site.middlewareNames) && site.middlewareNames[i] != "" {
+				if timed {
+					stack = traceHandler(site.middlewareNames[i], stack)
+				}
+				if site.Metrics {
+					stack = nameHandler(site.middlewareNames[i], stack)
+				}
+			}
+		}
+		if site.Metrics {
+			stack = instrumentHandler(site.Addr.String(), stack)
+		}
+		var ring *traceRing
+		if site.TraceRequests > 0 {
+			ring = siteTraceRing(site.Addr.String(), site.TraceRequests)
+		}
+		if timed {
+			stack = timeChain(site.Addr.String(), ring, site.Metrics, stack)
 		}
 		site.middlewareChain = stack
+		site.requests = siteRequestCounter(site.Addr.String())
 		s.vhosts.Insert(site.Addr.VHost(), site)
 	}
 
@@ -289,12 +343,34 @@ func (s *Server) Serve(ln net.Listener) error {
 	s.listener = ln
 	s.listenerMu.Unlock()
 
+	if s.connLimit != nil {
+		// limit by peer, before reading anything from the connection
+		ln = newLimitListener(ln, s.Server.Addr, s.connLimit)
+	}
+
+	if s.proxyProto != nil {
+		ln = &proxyProtocolListener{Listener: ln, trusted: s.proxyProto}
+	}
+
+	if s.refuseBans {
+		// after the PROXY protocol, which gives the client address
+		ln = &banListener{Listener: ln, server: s.Server.Addr}
+	}
+
+	if s.validation != nil && s.Server.TLSConfig == nil {
+		ln = &validatingListener{Listener: ln, server: s.Server.Addr, validation: s.validation}
+	}
+
 	if s.Server.TLSConfig != nil {
 		// Create TLS listener - note that we do not replace s.listener
 		// with this TLS listener; tls.listener is unexported and does
 		// not implement the File() method we need for graceful restarts
 		// on POSIX systems.
 		// TODO: Is this ^ still relevant anymore? Maybe we can now that it's a net.Listener...
+		if s.passthrough != nil {
+			// connections to sites that pass TLS through never reach the TLS listener
+			ln = newPassthroughListener(ln, s.passthrough)
+		}
 		ln = newTLSListener(ln, s.Server.TLSConfig)
 		if handler, ok := s.Server.Handler.(*tlsHandler); ok {
 			handler.listener = ln.(*tlsHelloListener)
@@ -326,7 +402,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// We absolutely need to be sure we stay alive up here,
 		// even though, in theory, the errors middleware does this.
 		if rec := recover(); rec != nil {
-			log.Printf("[PANIC] %v", rec)
+			RecoverPanic(s.Server.Addr, r, rec)
 			DefaultErrorFunc(w, r, http.StatusInternalServerError)
 		}
 	}()
@@ -340,10 +416,26 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		urlCopy.User = userInfo
 	}
 	c := context.WithValue(r.Context(), OriginalURLCtxKey, urlCopy)
+	c = withPlaceholders(c)
+	c, releaseBodies := withBodies(c)
+	defer releaseBodies()
 	r = r.WithContext(c)
 
 	w.Header().Set("Server", caddy.AppName)
 
+	if s.validation != nil && s.validation.Host && !validHost(r.Host) {
+		rejectedRequests.Inc(s.Server.Addr, rejectHost)
+		DefaultErrorFunc(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if lastConnRequest(r, s.limits.maxRequests) {
+		w.Header().Set("Connection", "close")
+	}
+	if s.limits.minRate > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = newMinRateBody(w, r, s.Server.Addr, s.limits.minRate, s.Server.ReadTimeout)
+	}
+
 	status, _ := s.serveHTTP(w, r)
 
 	// Fallback error response in case error handling wasn't chained in
@@ -383,11 +475,21 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		return 0, nil
 	}
 
+	if vhost.requests != nil {
+		atomic.AddUint64(vhost.requests, 1)
+	}
+
 	// we still check for ACME challenge if the vhost exists,
 	// because we must apply its HTTP challenge config settings
 	if s.proxyHTTPChallenge(vhost, w, r) {
 		return 0, nil
 	}
+	// challenges that aren't Caddy's own may be passed through,
+	// before any middleware can get in the way
+	if vhost.ACMEChallenge != nil && strings.HasPrefix(r.URL.Path, caddytls.HTTPChallengePath+"/") {
+		vhost.ACMEChallenge.ServeHTTP(w, r)
+		return 0, nil
+	}
 
 	// trim the path portion of the site address from the beginning of
 	// the URL path, so a request to example.com/foo/blog on the site
@@ -399,6 +501,11 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 		}
 	}
 
+	if InMaintenance() && !vhost.maintenanceExempt(r.URL.Path) {
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		return http.StatusServiceUnavailable, nil
+	}
+
 	return vhost.middlewareChain.ServeHTTP(w, r)
 }
 
@@ -462,8 +569,24 @@ func (s *Server) OnStartupComplete() {
 
 // defaultTimeouts stores the default timeout values to use
 // if left unset by user configuration. NOTE: Most default
-// timeouts are disabled (see issues #1464 and #1733).
-var defaultTimeouts = Timeouts{IdleTimeout: 5 * time.Minute}
+// timeouts are disabled (see issues #1464 and #1733); the
+// header timeout, which doesn't limit bodies or hijacked
+// connections, stops clients holding connections open by
+// sending their headers slowly.
+var defaultTimeouts = Timeouts{ReadHeaderTimeout: 10 * time.Second, IdleTimeout: 5 * time.Minute}
+
+// ExemptFromTimeouts clears the read and write deadlines of the
+// connection that w writes to, so that long-lived responses such
+// as event streams are not cut off by the server's timeouts.
+// Handlers should only do this for requests that they keep alive
+// deliberately (and close eventually).
+func ExemptFromTimeouts(w http.ResponseWriter) error {
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+	return rc.SetWriteDeadline(time.Time{})
+}
 
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by ListenAndServe and ListenAndServeTLS so
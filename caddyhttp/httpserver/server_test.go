@@ -1,9 +1,13 @@
 package httpserver
 
 import (
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/mholt/caddy/caddytls"
 )
 
 func TestAddress(t *testing.T) {
@@ -144,3 +148,214 @@ func TestMakeHTTPServerWithHeaderLimit(t *testing.T) {
 		})
 	}
 }
+
+func TestExemptFromTimeouts(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the deadline must be reachable through Caddy's wrappers
+		rr := NewResponseRecorder(w)
+		if err := ExemptFromTimeouts(rr); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		rr.Write([]byte("late"))
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected response despite write timeout, got %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "late" {
+		t.Errorf("Expected body 'late', got '%s'", body)
+	}
+}
+
+func TestMaintenanceExempt(t *testing.T) {
+	site := &SiteConfig{
+		Addr:              Address{Original: "localhost:2015", Host: "localhost", Port: "2015"},
+		TLS:               new(caddytls.Config),
+		MaintenanceExempt: []string{"/healthz"},
+		middleware: []Middleware{func(next Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				return http.StatusTeapot, nil
+			})
+		}},
+	}
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	SetMaintenance(true)
+	defer SetMaintenance(false)
+
+	for _, test := range []struct {
+		path     string
+		expected int
+	}{
+		{"/healthz", http.StatusTeapot},
+		{"/", http.StatusServiceUnavailable},
+	} {
+		r := httptest.NewRequest("GET", "http://localhost:2015"+test.path, nil)
+		if status, _ := s.serveHTTP(httptest.NewRecorder(), r); status != test.expected {
+			t.Errorf("%s: Expected status %d in maintenance mode, got %d", test.path, test.expected, status)
+		}
+	}
+}
+
+func TestTimeHandlers(t *testing.T) {
+	for i, test := range []struct {
+		site   SiteConfig
+		expect bool
+	}{
+		{SiteConfig{}, false},
+		{SiteConfig{TimeHandlers: true}, true},
+		{SiteConfig{Metrics: true}, true},
+		{SiteConfig{TraceRequests: 1}, true},
+	} {
+		var traced bool
+		site := test.site
+		site.Addr = Address{Original: "timed.test:2015", Host: "timed.test", Port: "2015"}
+		site.TLS = new(caddytls.Config)
+		site.middleware = []Middleware{func(next Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				_, traced = r.Context().Value(traceCtxKey).(*requestTrace)
+				return http.StatusTeapot, nil
+			})
+		}}
+		site.middlewareNames = []string{"teapot"}
+		s, err := NewServer("127.0.0.1:0", []*SiteConfig{&site})
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		s.serveHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://timed.test:2015/", nil))
+		if traced != test.expect {
+			t.Errorf("Test %d: Expected traced to be %t, got %t", i, test.expect, traced)
+		}
+	}
+}
+
+func TestACMEChallengePassThrough(t *testing.T) {
+	site := &SiteConfig{
+		Addr: Address{Original: "localhost:2015", Host: "localhost", Port: "2015"},
+		TLS:  new(caddytls.Config),
+		ACMEChallenge: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("keyauth"))
+		}),
+		middleware: []Middleware{func(next Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				return http.StatusTeapot, nil
+			})
+		}},
+	}
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, test := range []struct {
+		path     string
+		expected int
+	}{
+		{caddytls.HTTPChallengePath + "/tok", 0},
+		{caddytls.HTTPChallengePath, http.StatusTeapot},
+		{"/", http.StatusTeapot},
+	} {
+		r := httptest.NewRequest("GET", "http://localhost:2015"+test.path, nil)
+		w := httptest.NewRecorder()
+		status, _ := s.serveHTTP(w, r)
+		if status != test.expected {
+			t.Errorf("%s: Expected status %d, got %d", test.path, test.expected, status)
+		}
+		if test.expected == 0 && w.Body.String() != "keyauth" {
+			t.Errorf("%s: Expected challenge to be passed through, got '%s'", test.path, w.Body.String())
+		}
+	}
+}
+
+func TestHostValidation(t *testing.T) {
+	site := &SiteConfig{
+		Addr:              Address{Original: "localhost:2015", Host: "localhost", Port: "2015"},
+		TLS:               new(caddytls.Config),
+		RequestValidation: &RequestValidation{Host: true},
+		middleware: []Middleware{func(next Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				return http.StatusTeapot, nil
+			})
+		}},
+	}
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, test := range []struct {
+		host     string
+		expected int
+	}{
+		{"localhost:2015", http.StatusTeapot},
+		{"", http.StatusBadRequest},
+		{"local host", http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("GET", "http://localhost:2015/", nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != test.expected {
+			t.Errorf("Host %q: Expected status %d, got %d", test.host, test.expected, w.Code)
+		}
+	}
+}
+
+func TestHasMiddleware(t *testing.T) {
+	site := &SiteConfig{directive: "real_ip"}
+	site.AddMiddleware(func(next Handler) Handler { return next })
+	if !site.HasMiddleware("real_ip") {
+		t.Error("Expected the site to have the middleware of real_ip")
+	}
+	if site.HasMiddleware("gzip") {
+		t.Error("Expected the site not to have the middleware of gzip")
+	}
+}
+
+func TestServeSubrequest(t *testing.T) {
+	fallback := HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusTeapot, nil
+	})
+	var site *SiteConfig
+	if status, _ := site.ServeSubrequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), fallback); status != http.StatusTeapot {
+		t.Errorf("Expected the fallback to serve without a site, got %d", status)
+	}
+	site = &SiteConfig{}
+	if status, _ := site.ServeSubrequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), fallback); status != http.StatusTeapot {
+		t.Errorf("Expected the fallback to serve before the site is, got %d", status)
+	}
+	site.middlewareChain = HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusUnauthorized, nil
+	})
+	if status, _ := site.ServeSubrequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), fallback); status != http.StatusUnauthorized {
+		t.Errorf("Expected the middleware chain of the site to serve, got %d", status)
+	}
+}
+
+func TestSubresponse(t *testing.T) {
+	rec := NewSubresponse()
+	rec.Header().Set("X-Fragment", "1")
+	rec.Write([]byte("hello"))
+	rec.WriteHeader(http.StatusNotFound)
+	if rec.Status != http.StatusOK || rec.Body.String() != "hello" || rec.Header().Get("X-Fragment") != "1" {
+		t.Errorf("Expected 200 with the body and header written, got %d %q %v", rec.Status, rec.Body.String(), rec.Header())
+	}
+
+	h := http.Header{"Cookie": {"a=1"}}
+	clone := CloneHeader(h)
+	clone["Cookie"][0] = "b=2"
+	clone.Set("Range", "bytes=0-1")
+	if h.Get("Cookie") != "a=1" || h.Get("Range") != "" {
+		t.Errorf("Expected the original header to be unchanged, got %v", h)
+	}
+}
@@ -1,6 +1,9 @@
 package httpserver
 
 import (
+	"bytes"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/mholt/caddy/caddytls"
@@ -22,6 +25,18 @@ type SiteConfig struct {
 	// Uncompiled middleware stack
 	middleware []Middleware
 
+	// Names of the directives that added each
+	// middleware, for use as metrics labels
+	middlewareNames []string
+
+	// The directive currently being set up;
+	// see GetConfig
+	directive string
+
+	// Number of requests handled by this site;
+	// shared with any earlier config of the site
+	requests *uint64
+
 	// Compiled middleware stack
 	middlewareChain Handler
 
@@ -31,12 +46,33 @@ type SiteConfig struct {
 	// Directory from which to serve files
 	Root string
 
+	// The file system from which to serve files in
+	// place of the directory Root, such as an archive
+	// or a bucket of which Root is the location
+	RootFS http.FileSystem
+
+	// Directories searched, in order, for files
+	// that do not exist in Root
+	FallbackRoots []string
+
 	// A list of files to hide (for example, the
-	// source Caddyfile). TODO: Enforcing this
-	// should be centralized, for example, a
-	// standardized way of loading files from disk
-	// for a request.
-	HiddenFiles []string
+	// source Caddyfile), with everything within
+	// them, and glob patterns of the names or, if
+	// they contain a slash, the paths of others.
+	// What is hidden is taken out of the file
+	// system of the site; see HiddenFS.
+	HiddenFiles    []string
+	HiddenPatterns []string
+
+	// Whether to hide dot files, except the
+	// .well-known directory, and the directories
+	// of version control systems.
+	HideDotfiles bool
+	HideVCS      bool
+
+	// Languages that the static files of the site are in,
+	// the first being the default
+	Languages []string
 
 	// Max request's header/body size
 	Limits Limits
@@ -56,6 +92,56 @@ type SiteConfig struct {
 	// If true, any requests not matching other site definitions
 	// may be served by this site.
 	FallbackSite bool
+
+	// If true, requests to this site are counted and
+	// timed in the metrics registry.
+	Metrics bool
+
+	// Number of the last requests to this site whose
+	// traces are kept for inspection; 0 for none
+	TraceRequests int
+
+	// If true, the time requests to this site spend in each
+	// handler, and the handler that failed, are recorded even
+	// without Metrics or TraceRequests, for the directives
+	// that use them; see FailedHandler
+	TimeHandlers bool
+
+	// Paths that are served even in maintenance mode,
+	// such as health checks
+	MaintenanceExempt []string
+
+	// How plaintext HTTP requests are redirected to the site
+	// when it is served over HTTPS automatically; nil for the
+	// defaults
+	HTTPSRedirect *HTTPSRedirect
+
+	// Answers the ACME HTTP challenges for the site that
+	// Caddy isn't solving itself, such as those of a
+	// backend that manages its own certificates
+	ACMEChallenge http.Handler
+
+	// The address of the backend to which TLS connections
+	// for the site are passed through, without terminating
+	// TLS, if not empty
+	Passthrough string
+
+	// The networks of the proxies from which connections
+	// may begin with a PROXY protocol header, which gives
+	// the address of the client
+	ProxyProtocol []*net.IPNet
+
+	// How strictly the requests read by the listener of
+	// the site are validated, if at all
+	RequestValidation *RequestValidation
+
+	// The limit of the connections to the listener of the
+	// site from each client IP, if any
+	ConnLimit *ConnLimit
+
+	// Whether the listener of the site closes the connections
+	// of banned client IPs
+	RefuseBanned bool
 }
 
 // Timeouts specify various timeouts for a server to use.
@@ -73,6 +159,15 @@ type Timeouts struct {
 	WriteTimeoutSet      bool
 	IdleTimeout          time.Duration
 	IdleTimeoutSet       bool
+
+	// MinRate is the fewest bytes per second at which a request
+	// body may be sent, after a grace period, before the
+	// connection is closed; MaxRequests is the most requests
+	// that may be read from one connection. 0 is no limit.
+	MinRate        int64
+	MinRateSet     bool
+	MaxRequests    int
+	MaxRequestsSet bool
 }
 
 // Limits specify size limit of request's header and body.
@@ -91,6 +186,75 @@ type PathLimit struct {
 // AddMiddleware adds a middleware to a site's middleware stack.
 func (s *SiteConfig) AddMiddleware(m Middleware) {
 	s.middleware = append(s.middleware, m)
+	s.middlewareNames = append(s.middlewareNames, s.directive)
+}
+
+// HasMiddleware returns whether the directive has added middleware
+// to s, as directives set up before the one that asks have.
+func (s *SiteConfig) HasMiddleware(directive string) bool {
+	for _, name := range s.middlewareNames {
+		if name == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeSubrequest serves r, a request made while serving another,
+// such as for a fragment of a page, with the whole middleware chain
+// of the site, so that it passes all the middleware, such as that of
+// authentication, that requests of clients do. Until the site is
+// served, as in tests, r is served by fallback instead.
+func (s *SiteConfig) ServeSubrequest(w http.ResponseWriter, r *http.Request, fallback Handler) (int, error) {
+	if s == nil || s.middlewareChain == nil {
+		return fallback.ServeHTTP(w, r)
+	}
+	return s.middlewareChain.ServeHTTP(w, r)
+}
+
+// Subresponse is the http.ResponseWriter of a subrequest, which
+// keeps the response for the middleware that made the request.
+type Subresponse struct {
+	header http.Header
+
+	// Status is the status written, or 0 if none was.
+	Status int
+
+	// Body is what was written.
+	Body bytes.Buffer
+}
+
+// NewSubresponse returns a Subresponse with an empty header.
+func NewSubresponse() *Subresponse {
+	return &Subresponse{header: make(http.Header)}
+}
+
+// Header returns the header of the response.
+func (w *Subresponse) Header() http.Header { return w.header }
+
+// WriteHeader records the status of the response, unless it was
+// already written.
+func (w *Subresponse) WriteHeader(status int) {
+	if w.Status == 0 {
+		w.Status = status
+	}
+}
+
+// Write writes p to the body, with the status 200 if none was
+// written before.
+func (w *Subresponse) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.Body.Write(p)
+}
+
+// CloneHeader returns a copy of h, whose values can be changed
+// without changing those of h.
+func CloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, v := range h {
+		h2[k] = append([]string(nil), v...)
+	}
+	return h2
 }
 
 // AddListenerMiddleware adds a listener middleware to a site's listenerMiddleware stack.
@@ -0,0 +1,129 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/metrics"
+)
+
+var slowUploads = metrics.NewCounter("caddy_http_slow_uploads_total",
+	"Number of requests whose bodies were sent slower than the minimum rate, by listener address.",
+	"server")
+
+// minRateGrace is how long a request body may take before the
+// minimum rate applies to it, so that it can get up to speed.
+var minRateGrace = 5 * time.Second
+
+// connRequestsCtxKey is the key for the number of requests read so
+// far from a connection.
+const connRequestsCtxKey = caddy.CtxKey("conn_requests")
+
+// connLimits are the limits on slow or long-lived clients of a
+// listener, from the timeouts of the sites that share it.
+type connLimits struct {
+	minRate     int64 // bytes per second, or 0
+	maxRequests int   // per connection, or 0
+}
+
+// slowClientLimits returns the limits for the sites of group: for
+// each, the lowest that any of them set, none being the lowest.
+func slowClientLimits(group []*SiteConfig) connLimits {
+	var limits connLimits
+	var minRateSet, maxRequestsSet bool
+	for _, cfg := range group {
+		if cfg.Timeouts.MinRateSet &&
+			(!minRateSet || cfg.Timeouts.MinRate < limits.minRate) {
+			minRateSet = true
+			limits.minRate = cfg.Timeouts.MinRate
+		}
+		if cfg.Timeouts.MaxRequestsSet &&
+			(!maxRequestsSet || cfg.Timeouts.MaxRequests < limits.maxRequests) {
+			maxRequestsSet = true
+			limits.maxRequests = cfg.Timeouts.MaxRequests
+		}
+	}
+	return limits
+}
+
+// countConnRequests gives the context of each connection a count of
+// the requests read from it.
+func countConnRequests(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsCtxKey, new(int))
+}
+
+// lastConnRequest returns whether r is the last request that may be
+// read from its connection, which has a limit of max. Only HTTP/1
+// connections are limited, their requests being read one at a time.
+func lastConnRequest(r *http.Request, max int) bool {
+	if max <= 0 || r.ProtoMajor != 1 {
+		return false
+	}
+	n, ok := r.Context().Value(connRequestsCtxKey).(*int)
+	if !ok {
+		return false
+	}
+	*n++
+	return *n >= max
+}
+
+// minRateBody is the body of a request that fails to be read, closing
+// its connection, if it isn't sent at least as fast as a minimum rate
+// once the grace period is over. It works by moving the read deadline
+// of the connection along as the body is read.
+type minRateBody struct {
+	io.ReadCloser
+	rc     *http.ResponseController
+	server string
+	rate   int64     // bytes per second
+	start  time.Time // when the request was read
+	limit  time.Time // the deadline of the whole request, if any
+	read   int64
+	slow   bool
+}
+
+// newMinRateBody returns a minRateBody that replaces the body of r,
+// which is being written a response to by w.
+func newMinRateBody(w http.ResponseWriter, r *http.Request, server string, rate int64, readTimeout time.Duration) *minRateBody {
+	b := &minRateBody{
+		ReadCloser: r.Body,
+		rc:         http.NewResponseController(w),
+		server:     server,
+		rate:       rate,
+		start:      time.Now(),
+	}
+	if readTimeout > 0 {
+		b.limit = b.start.Add(readTimeout)
+	}
+	return b
+}
+
+// Read reads from the body, failing if the next byte of it doesn't
+// arrive when it must for the minimum rate to be met.
+func (b *minRateBody) Read(p []byte) (int, error) {
+	deadline := b.start.Add(minRateGrace + time.Duration(float64(b.read+1)/float64(b.rate)*float64(time.Second)))
+	if !b.limit.IsZero() && b.limit.Before(deadline) {
+		deadline = b.limit
+	}
+	if err := b.rc.SetReadDeadline(deadline); err != nil {
+		// the connection doesn't support deadlines; read it as it is
+		return b.ReadCloser.Read(p)
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	switch {
+	case err == io.EOF:
+		b.rc.SetReadDeadline(b.limit)
+	case errors.Is(err, os.ErrDeadlineExceeded) && !b.slow && deadline != b.limit:
+		b.slow = true
+		slowUploads.Inc(b.server)
+	}
+	return n, err
+}
@@ -0,0 +1,143 @@
+package httpserver
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestSlowClientLimits(t *testing.T) {
+	for i, test := range []struct {
+		group  []*SiteConfig
+		expect connLimits
+	}{
+		{[]*SiteConfig{{}}, connLimits{}},
+		{
+			[]*SiteConfig{
+				{Timeouts: Timeouts{MinRate: 1024, MinRateSet: true, MaxRequests: 100, MaxRequestsSet: true}},
+				{Timeouts: Timeouts{MinRate: 512, MinRateSet: true}},
+			},
+			connLimits{minRate: 512, maxRequests: 100},
+		},
+		{
+			[]*SiteConfig{
+				{Timeouts: Timeouts{MaxRequests: 100, MaxRequestsSet: true}},
+				{Timeouts: Timeouts{MaxRequestsSet: true}}, // none
+			},
+			connLimits{},
+		},
+	} {
+		if got := slowClientLimits(test.group); got != test.expect {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expect, got)
+		}
+	}
+}
+
+// serveSlowClientTest serves, until the test is over, a site that
+// reads the bodies of requests and responds with their length.
+func serveSlowClientTest(t *testing.T, timeouts Timeouts) string {
+	site := &SiteConfig{
+		Addr:     Address{Original: "localhost:2015", Host: "localhost", Port: "2015"},
+		TLS:      new(caddytls.Config),
+		Timeouts: timeouts,
+		middleware: []Middleware{func(next Handler) Handler {
+			return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				body, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					return http.StatusRequestTimeout, err
+				}
+				w.Write([]byte(strings.Repeat("x", len(body))))
+				return 0, nil
+			})
+		}},
+	}
+	s, err := NewServer("127.0.0.1:0", []*SiteConfig{site})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Server.Serve(ln)
+	t.Cleanup(func() { s.Server.Close() })
+	return ln.Addr().String()
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	addr := serveSlowClientTest(t, Timeouts{MaxRequests: 2, MaxRequestsSet: true})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for i := 1; i <= 3; i++ {
+		if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:2015\r\n\r\n")); err != nil {
+			if i == 3 {
+				break // closed already
+			}
+			t.Fatal(err)
+		}
+		resp, err := http.ReadResponse(br, nil)
+		if i == 3 {
+			if err == nil {
+				t.Errorf("Expected the connection to be closed after 2 requests, got a third response")
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Request %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if got, want := resp.Close, i == 2; got != want {
+			t.Errorf("Request %d: Expected Close=%v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestMinRate(t *testing.T) {
+	defer func(grace time.Duration) { minRateGrace = grace }(minRateGrace)
+	minRateGrace = 100 * time.Millisecond
+
+	addr := serveSlowClientTest(t, Timeouts{MinRate: 100, MinRateSet: true})
+
+	// fast enough
+	req, _ := http.NewRequest("POST", "http://"+addr+"/", strings.NewReader("hello"))
+	req.Host = "localhost:2015"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "xxxxx" {
+		t.Errorf("Expected the whole body to be read, got %q", body)
+	}
+
+	// too slow: 1 byte of 1000 promised, then nothing
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost:2015\r\nContent-Length: 1000\r\n\r\nx"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Expected a response to the slow request, got: %v", err)
+	}
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestTimeout, resp.StatusCode)
+	}
+	if !resp.Close {
+		t.Errorf("Expected the connection of the slow request to be closed")
+	}
+}
@@ -0,0 +1,116 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+var tarpittedRequests = metrics.NewGauge("caddy_http_tarpitted_requests",
+	"Number of requests being held in tarpits.")
+
+// maxTarpitted is the most requests held in tarpits at once. Requests
+// over it aren't held, so that tarpits tie up a bounded number of
+// connections and goroutines, however many clients fall into them.
+var maxTarpitted int32 = 1024
+
+// tarpitted is the number of requests held in tarpits.
+var tarpitted int32
+
+// trickleInterval is how often a byte of trickled responses is
+// written.
+var trickleInterval = time.Second
+
+// Tarpit holds the requests of suspect clients, such as those that a
+// firewall blocks, before responding to them, to waste their time and
+// tie up their connections, at little cost to the server.
+type Tarpit struct {
+	// Delay is how long requests are held.
+	Delay time.Duration
+
+	// Trickle is whether the response is written a byte at a time
+	// while the request is held, rather than after, which keeps
+	// clients that give up on slow responses waiting.
+	Trickle bool
+}
+
+// Hold holds a request for the delay of t, and returns whether it
+// held it until the end, rather than ctx, that of the request, being
+// done first. Requests over the limit aren't held.
+func (t Tarpit) Hold(ctx context.Context) bool {
+	if !enterTarpit() {
+		return true
+	}
+	defer leaveTarpit()
+
+	timer := time.NewTimer(t.Delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Respond holds r, and responds to it with status, as a handler does.
+// If t trickles, the response is written while r is held.
+func (t Tarpit) Respond(w http.ResponseWriter, r *http.Request, status int) (int, error) {
+	if !t.Trickle {
+		if !t.Hold(r.Context()) {
+			return 0, nil // gone, so there is no one to respond to
+		}
+		return status, nil
+	}
+	if !enterTarpit() {
+		return status, nil
+	}
+	defer leaveTarpit()
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(t.Delay + trickleInterval))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	ticker := time.NewTicker(trickleInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(t.Delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := w.Write([]byte{' '}); err != nil {
+				return 0, nil
+			}
+			if err := rc.Flush(); err != nil {
+				return 0, nil
+			}
+		case <-timer.C:
+			w.Write([]byte(http.StatusText(status) + "\n"))
+			return 0, nil
+		case <-r.Context().Done():
+			return 0, nil
+		}
+	}
+}
+
+// enterTarpit counts a request into tarpits, and returns whether it
+// may be held, leaving it uncounted if not.
+func enterTarpit() bool {
+	if atomic.AddInt32(&tarpitted, 1) > maxTarpitted {
+		atomic.AddInt32(&tarpitted, -1)
+		return false
+	}
+	tarpittedRequests.Inc()
+	return true
+}
+
+// leaveTarpit counts a request out of tarpits.
+func leaveTarpit() {
+	atomic.AddInt32(&tarpitted, -1)
+	tarpittedRequests.Dec()
+}
@@ -0,0 +1,65 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTarpitHold(t *testing.T) {
+	tarpit := Tarpit{Delay: 50 * time.Millisecond}
+
+	start := time.Now()
+	if !tarpit.Hold(context.Background()) {
+		t.Error("Expected the request to be held until the end")
+	}
+	if held := time.Since(start); held < tarpit.Delay {
+		t.Errorf("Expected the request to be held for %v, was %v", tarpit.Delay, held)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if tarpit.Hold(ctx) {
+		t.Error("Expected the request of a client that has gone not to be held")
+	}
+
+	defer func(max int32) { maxTarpitted = max }(maxTarpitted)
+	maxTarpitted = 0
+	start = time.Now()
+	if !tarpit.Hold(context.Background()) || time.Since(start) >= tarpit.Delay {
+		t.Error("Expected a request over the limit not to be held")
+	}
+}
+
+func TestTarpitRespond(t *testing.T) {
+	defer func(interval time.Duration) { trickleInterval = interval }(trickleInterval)
+	trickleInterval = 10 * time.Millisecond
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	status, err := Tarpit{Delay: 20 * time.Millisecond}.Respond(w, r, http.StatusForbidden)
+	if status != http.StatusForbidden || err != nil {
+		t.Errorf("Expected status 403 and no error, got %d and %v", status, err)
+	}
+
+	w = httptest.NewRecorder()
+	status, err = Tarpit{Delay: 55 * time.Millisecond, Trickle: true}.Respond(w, r, http.StatusForbidden)
+	if status != 0 || err != nil {
+		t.Errorf("Expected the response to be written, got %d and %v", status, err)
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.HasPrefix(body, " ") || !strings.HasSuffix(body, "Forbidden\n") {
+		t.Errorf("Expected trickled spaces and then Forbidden, got %q", body)
+	}
+	if !w.Flushed {
+		t.Error("Expected the trickled bytes to be flushed")
+	}
+	if tarpitted != 0 {
+		t.Errorf("Expected no requests left in tarpits, got %d", tarpitted)
+	}
+}
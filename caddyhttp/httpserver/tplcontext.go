@@ -30,6 +30,10 @@ type Context struct {
 	URL  *url.URL
 	Args []interface{} // defined by arguments to .Include
 
+	// EnvAllowed, if not nil, decides which environment
+	// variables Env gets.
+	EnvAllowed func(name string) bool
+
 	// just used for adding preload links for server push
 	responseHeader http.Header
 }
@@ -90,12 +94,16 @@ func (c Context) Hostname() string {
 	return hostnameList[0]
 }
 
-// Env gets a map of the environment variables.
+// Env gets a map of the environment variables, or of those that
+// EnvAllowed allows, if it is set.
 func (c Context) Env() map[string]string {
 	osEnv := os.Environ()
 	envVars := make(map[string]string, len(osEnv))
 	for _, env := range osEnv {
 		data := strings.SplitN(env, "=", 2)
+		if c.EnvAllowed != nil && !c.EnvAllowed(data[0]) {
+			continue
+		}
 		if len(data) == 2 && len(data[0]) > 0 {
 			envVars[data[0]] = data[1]
 		}
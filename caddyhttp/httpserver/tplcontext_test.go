@@ -312,6 +312,18 @@ func TestEnv(t *testing.T) {
 	}
 
 	os.Unsetenv("=" + invalidName)
+
+	otherName := "ENV_TEST_OTHER_NAME"
+	os.Setenv(otherName, testValue)
+	defer os.Unsetenv(otherName)
+	context.EnvAllowed = func(n string) bool { return n == name }
+	env = context.Env()
+	if value := env[name]; value != testValue {
+		t.Errorf("Expected allowed env-variable %s value '%s', found '%s'", name, testValue, value)
+	}
+	if value, ok := env[otherName]; ok {
+		t.Errorf("Expected env-variable %s that isn't allowed to be left out, found '%s'", otherName, value)
+	}
 }
 
 func TestIP(t *testing.T) {
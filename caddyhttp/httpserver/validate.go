@@ -0,0 +1,371 @@
+package httpserver
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+var rejectedRequests = metrics.NewCounter("caddy_http_rejected_requests_total",
+	"Number of requests rejected by request validation, by listener address and reason.",
+	"server", "reason")
+
+// RequestValidation is how strictly the requests that a listener
+// reads are validated, against request smuggling among other things.
+// Go parses requests leniently, so the checks other than Host are
+// made as requests are read, before it parses them; they apply to
+// plain HTTP/1 listeners, since on TLS ones Go reads the requests
+// off the connection it decrypts itself, so a warning is logged
+// for those.
+type RequestValidation struct {
+	// Host rejects requests without a Host, or with one that is
+	// not a valid host name or IP address and optional port.
+	Host bool
+
+	// Framing rejects requests of which the body could be framed
+	// more than one way: with both Content-Length and Transfer-
+	// Encoding, several of either, or a Transfer-Encoding other
+	// than chunked.
+	Framing bool
+
+	// ObsFold rejects headers folded over several lines.
+	ObsFold bool
+
+	// MaxChunkExt, if not 0, rejects chunked bodies with chunk
+	// extensions longer than that many bytes.
+	MaxChunkExt int
+}
+
+// Rejected reasons, the labels of the counter of rejected requests.
+const (
+	rejectHost     = "host"
+	rejectFraming  = "framing"
+	rejectObsFold  = "obs_fold"
+	rejectChunkExt = "chunk_ext"
+)
+
+// requestValidation returns the validation of the requests to the
+// sites of group, which share a listener: the strictest of theirs,
+// or nil if none of them validate requests.
+func requestValidation(group []*SiteConfig) *RequestValidation {
+	var v *RequestValidation
+	for _, site := range group {
+		sv := site.RequestValidation
+		if sv == nil {
+			continue
+		}
+		if v == nil {
+			v = new(RequestValidation)
+		}
+		v.Host = v.Host || sv.Host
+		v.Framing = v.Framing || sv.Framing
+		v.ObsFold = v.ObsFold || sv.ObsFold
+		if sv.MaxChunkExt > 0 && (v.MaxChunkExt == 0 || sv.MaxChunkExt < v.MaxChunkExt) {
+			v.MaxChunkExt = sv.MaxChunkExt
+		}
+	}
+	return v
+}
+
+// readChecks returns whether v has checks that are made as requests
+// are read, rather than by the handler.
+func (v *RequestValidation) readChecks() bool {
+	return v.Framing || v.ObsFold || v.MaxChunkExt > 0
+}
+
+// warnUnvalidated warns that the checks of v made as requests are
+// read can't be made on the listener at addr if it serves TLS, so
+// that nobody relies on them there.
+func warnUnvalidated(addr string, v *RequestValidation, tls bool) {
+	if v == nil || !tls || !v.readChecks() {
+		return
+	}
+	log.Printf("[WARNING] %s: validate_requests can't check the framing, folded headers or chunk extensions "+
+		"of requests over TLS, only their Host; put a plain HTTP/1 proxy that checks them in front to do so", addr)
+}
+
+// validHost returns whether host, the Host of a request, is a
+// host name or IP address, optionally with a port.
+func validHost(host string) bool {
+	name := host
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return false
+		}
+		name = h
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return net.ParseIP(host[1:len(host)-1]) != nil
+	} else if strings.Contains(host, ":") {
+		return false
+	}
+	if name == "" {
+		return false
+	}
+	if net.ParseIP(name) != nil {
+		return true
+	}
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rejectedError is the error of reading a request that validation
+// rejected. Go responds to it with 400 Bad Request.
+type rejectedError struct {
+	reason string
+}
+
+func (e rejectedError) Error() string {
+	return "request rejected by validation: " + e.reason
+}
+
+// validatingListener validates the requests read from the
+// connections it accepts.
+type validatingListener struct {
+	net.Listener
+	server     string // the address of the listener
+	validation *RequestValidation
+}
+
+// Accept accepts the next connection.
+func (l *validatingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &validatingConn{Conn: conn, server: l.server, parser: requestParser{validation: l.validation}}, nil
+}
+
+// validatingConn is a connection whose reads fail once what is read
+// from it isn't valid.
+type validatingConn struct {
+	net.Conn
+	server string
+	parser requestParser
+	err    error
+}
+
+// Read reads from the connection what is valid.
+func (c *validatingConn) Read(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.Conn.Read(b)
+	if reason := c.parser.feed(b[:n]); reason != "" {
+		rejectedRequests.Inc(c.server, reason)
+		c.err = rejectedError{reason}
+		return 0, c.err
+	}
+	return n, err
+}
+
+// parserState is what a requestParser is reading.
+type parserState int
+
+const (
+	readingHead parserState = iota
+	readingBody
+	readingChunkSize
+	readingChunk
+	readingTrailer
+	passingThrough // what isn't HTTP/1, or can't be validated
+)
+
+// maxHeadSize is the most of a request head or chunk size line that
+// a requestParser buffers; Go rejects longer ones itself.
+const maxHeadSize = 1<<20 + 4096
+
+// maxChunkSizeLen is the longest a chunk size may be, with the
+// semicolon before its extensions.
+const maxChunkSizeLen = 17
+
+// requestParser follows the requests read from a connection, just
+// closely enough to find their heads and validate them.
+type requestParser struct {
+	validation *RequestValidation
+	state      parserState
+	buf        []byte // of the head or line being read
+	remaining  int64  // of the body or chunk being read
+}
+
+// feed follows p with b, the next bytes read, and returns the reason
+// to reject the request they are of, or "" if it's valid so far.
+func (p *requestParser) feed(b []byte) string {
+	for len(b) > 0 {
+		switch p.state {
+		case readingHead, readingChunkSize, readingTrailer:
+			i := bytes.IndexByte(b, '\n')
+			if i < 0 {
+				p.buf = append(p.buf, b...)
+				if p.state == readingChunkSize && p.validation.MaxChunkExt > 0 && len(p.buf) > p.validation.MaxChunkExt+maxChunkSizeLen {
+					return rejectChunkExt
+				}
+				if len(p.buf) > maxHeadSize {
+					p.state, p.buf = passingThrough, nil
+				}
+				return ""
+			}
+			p.buf = append(p.buf, b[:i+1]...)
+			b = b[i+1:]
+			if reason := p.line(lastLineBlank(p.buf)); reason != "" {
+				return reason
+			}
+		case readingBody, readingChunk:
+			n := int64(len(b))
+			if n > p.remaining {
+				n = p.remaining
+			}
+			p.remaining -= n
+			b = b[n:]
+			if p.remaining == 0 {
+				if p.state == readingBody {
+					p.state = readingHead
+				} else {
+					p.state = readingChunkSize
+				}
+			}
+		case passingThrough:
+			return ""
+		}
+	}
+	return ""
+}
+
+// lastLineBlank returns whether the last line of buf, which ends
+// with a newline, is blank.
+func lastLineBlank(buf []byte) bool {
+	start := bytes.LastIndexByte(buf[:len(buf)-1], '\n') + 1
+	return len(bytes.TrimRight(buf[start:], "\r\n")) == 0
+}
+
+// line handles p.buf, which ends with a line, blank or not.
+func (p *requestParser) line(blank bool) string {
+	switch p.state {
+	case readingHead:
+		if !blank {
+			return ""
+		}
+		if len(bytes.Trim(p.buf, "\r\n")) == 0 {
+			p.buf = p.buf[:0] // blank lines may come before a request
+			return ""
+		}
+		head := p.buf
+		p.buf = nil
+		return p.head(head)
+	case readingChunkSize:
+		line := string(bytes.TrimRight(p.buf, "\r\n"))
+		p.buf = p.buf[:0]
+		size, ext := line, ""
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			size, ext = line[:i], line[i+1:]
+		}
+		if p.validation.MaxChunkExt > 0 && len(ext) > p.validation.MaxChunkExt {
+			return rejectChunkExt
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+		if err != nil || n < 0 {
+			p.state = passingThrough // Go rejects it itself
+			return ""
+		}
+		if n == 0 {
+			p.state = readingTrailer
+		} else {
+			p.state, p.remaining = readingChunk, n+2 // and its CRLF
+		}
+	case readingTrailer:
+		p.buf = p.buf[:0]
+		if blank {
+			p.state = readingHead
+		}
+	}
+	return ""
+}
+
+// head validates the head of a request and finds how its body, if
+// any, is framed.
+func (p *requestParser) head(head []byte) string {
+	lines := strings.Split(strings.Replace(string(head), "\r\n", "\n", -1), "\n")
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	requestLine := strings.Fields(lines[0])
+	if len(requestLine) != 3 || !strings.HasPrefix(requestLine[2], "HTTP/1.") {
+		p.state = passingThrough // such as the preface of HTTP/2
+		return ""
+	}
+
+	var contentLengths, transferEncodings []string
+	upgrade := requestLine[0] == http.MethodConnect
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if p.validation.ObsFold {
+				return rejectObsFold
+			}
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue // Go rejects it itself
+		}
+		name, value := http.CanonicalHeaderKey(strings.TrimSpace(line[:colon])), strings.TrimSpace(line[colon+1:])
+		switch name {
+		case "Content-Length":
+			contentLengths = append(contentLengths, value)
+		case "Transfer-Encoding":
+			transferEncodings = append(transferEncodings, value)
+		case "Upgrade":
+			upgrade = true
+		}
+	}
+
+	if p.validation.Framing {
+		if len(contentLengths) > 0 && len(transferEncodings) > 0 ||
+			len(contentLengths) > 1 || len(transferEncodings) > 1 ||
+			len(transferEncodings) == 1 && !strings.EqualFold(transferEncodings[0], "chunked") {
+			return rejectFraming
+		}
+		if len(contentLengths) == 1 {
+			if _, err := strconv.ParseUint(contentLengths[0], 10, 63); err != nil {
+				return rejectFraming
+			}
+		}
+	}
+
+	switch {
+	case upgrade:
+		// what follows the head may not be HTTP at all
+		p.state = passingThrough
+	case len(transferEncodings) > 0:
+		p.state = readingChunkSize
+	case len(contentLengths) > 0:
+		n, err := strconv.ParseInt(contentLengths[0], 10, 64)
+		if err != nil || n < 0 {
+			p.state = passingThrough // Go rejects it itself
+		} else if n > 0 {
+			p.state, p.remaining = readingBody, n
+		}
+	}
+	return ""
+}
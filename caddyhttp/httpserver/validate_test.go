@@ -0,0 +1,166 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidHost(t *testing.T) {
+	for i, test := range []struct {
+		host   string
+		expect bool
+	}{
+		{"example.com", true},
+		{"example.com.", true},
+		{"example.com:8080", true},
+		{"my_host-1.local", true},
+		{"127.0.0.1", true},
+		{"127.0.0.1:443", true},
+		{"[::1]", true},
+		{"[::1]:443", true},
+		{"", false},
+		{":80", false},
+		{"example.com:", false},
+		{"example.com:99999", false},
+		{"example.com:http", false},
+		{"exa mple.com", false},
+		{"example..com", false},
+		{"-example.com", false},
+		{"example.com/path", false},
+		{"user@example.com", false},
+		{"::1", false},
+		{"[example.com]", false},
+	} {
+		if got := validHost(test.host); got != test.expect {
+			t.Errorf("Test %d: Expected validHost(%q) to be %v, got %v", i, test.host, test.expect, got)
+		}
+	}
+}
+
+func TestRequestValidationMerge(t *testing.T) {
+	group := []*SiteConfig{
+		{},
+		{RequestValidation: &RequestValidation{Host: true, MaxChunkExt: 128}},
+		{RequestValidation: &RequestValidation{ObsFold: true, MaxChunkExt: 64}},
+	}
+	expect := &RequestValidation{Host: true, ObsFold: true, MaxChunkExt: 64}
+	if got := requestValidation(group); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected %+v, got %+v", expect, got)
+	}
+	if got := requestValidation(group[:1]); got != nil {
+		t.Errorf("Expected no validation when no site has any, got %+v", got)
+	}
+}
+
+func TestRequestParser(t *testing.T) {
+	all := &RequestValidation{Host: true, Framing: true, ObsFold: true, MaxChunkExt: 8}
+	for i, test := range []struct {
+		input  string
+		expect string
+	}{
+		{"GET / HTTP/1.1\r\nHost: a\r\n\r\n", ""},
+		{"\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n", ""},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhelloGET / HTTP/1.1\r\n\r\n", ""},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;a=b\r\nhello\r\n0\r\nX: y\r\n\r\nGET / HTTP/1.1\r\n\r\n", ""},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n", rejectFraming},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\n", rejectFraming},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n", rejectFraming},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n", rejectFraming},
+		{"POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\n", rejectFraming},
+		{"GET / HTTP/1.1\r\nX-A: b\r\n c\r\n\r\n", rejectObsFold},
+		{"GET / HTTP/1.1\r\nX-A: b\r\n\tc\r\n\r\n", rejectObsFold},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;aaaaaaaaa\r\nhello\r\n0\r\n\r\n", rejectChunkExt},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;" + strings.Repeat("a", 64), rejectChunkExt},
+		// what's smuggled in a body that's passed over isn't looked at
+		{"POST / HTTP/1.1\r\nContent-Length: 24\r\n\r\nGET / HTTP/1.1\r\nX: y\r\n z", ""},
+		// nor is what follows an upgrade, or what isn't HTTP/1
+		{"GET / HTTP/1.1\r\nUpgrade: websocket\r\n\r\nGET / HTTP/1.1\r\nX: y\r\n z\r\n\r\n", ""},
+		{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", ""},
+	} {
+		p := requestParser{validation: all}
+		if got := p.feed([]byte(test.input)); got != test.expect {
+			t.Errorf("Test %d: Expected %q fed at once, got %q", i, test.expect, got)
+		}
+
+		// the same, fed a byte at a time
+		p = requestParser{validation: all}
+		var got string
+		for j := 0; j < len(test.input) && got == ""; j++ {
+			got = p.feed([]byte{test.input[j]})
+		}
+		if got != test.expect {
+			t.Errorf("Test %d: Expected %q fed bytewise, got %q", i, test.expect, got)
+		}
+	}
+}
+
+func TestRequestParserDisabled(t *testing.T) {
+	p := requestParser{validation: &RequestValidation{}}
+	input := "POST / HTTP/1.1\r\nX-A: b\r\n c\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n5;" + strings.Repeat("a", 64) + "\r\n"
+	if got := p.feed([]byte(input)); got != "" {
+		t.Errorf("Expected nothing rejected when no checks are enabled, got %q", got)
+	}
+}
+
+func TestValidatingListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := &validatingListener{Listener: inner, server: "test", validation: &RequestValidation{Framing: true}}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	for i, test := range []struct {
+		request string
+		expect  int
+	}{
+		{"GET / HTTP/1.1\r\nHost: a\r\n\r\n", http.StatusOK},
+		{"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", http.StatusBadRequest},
+	} {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(test.request))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Errorf("Test %d: Reading response: %v", i, err)
+		} else if resp.StatusCode != test.expect {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expect, resp.StatusCode)
+		}
+		conn.Close()
+	}
+}
+
+func TestWarnUnvalidated(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	for i, test := range []struct {
+		v      *RequestValidation
+		tls    bool
+		expect bool
+	}{
+		{nil, true, false},
+		{&RequestValidation{Framing: true}, false, false},
+		{&RequestValidation{Host: true}, true, false},
+		{&RequestValidation{Framing: true}, true, true},
+		{&RequestValidation{MaxChunkExt: 64}, true, true},
+	} {
+		buf.Reset()
+		warnUnvalidated(":443", test.v, test.tls)
+		if warned := strings.Contains(buf.String(), "[WARNING] :443"); warned != test.expect {
+			t.Errorf("Test %d: Expected warning %v, got %q", i, test.expect, buf.String())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package httpsredirect implements the https_redirect directive,
+// which configures how plaintext HTTP requests are redirected to a
+// site that is served over HTTPS automatically.
+package httpsredirect
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("https_redirect", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+func setup(c *caddy.Controller) error {
+	r, err := parse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).HTTPSRedirect = r
+	return nil
+}
+
+// parse parses
+//
+//	https_redirect [status] {
+//		port   port
+//		except paths...
+//	}
+//
+// or
+//
+//	https_redirect off
+//
+// where status is 301, 302, 307 or 308, port is the port to redirect
+// to if not the one the site listens on, and the paths excepted are
+// served over plaintext HTTP rather than redirected. With off, there
+// is no redirect but the certificate of the site is still managed.
+func parse(c *caddy.Controller) (*httpserver.HTTPSRedirect, error) {
+	var r *httpserver.HTTPSRedirect
+
+	for c.Next() {
+		if r != nil {
+			return nil, c.Err("https_redirect may only be given once per site")
+		}
+		r = new(httpserver.HTTPSRedirect)
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if args[0] == "off" {
+				r.Off = true
+				break
+			}
+			status, err := strconv.Atoi(args[0])
+			if err != nil || !validStatus(status) {
+				return nil, c.Errf("https_redirect status must be 301, 302, 307 or 308, not '%s'", args[0])
+			}
+			r.Status = status
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			if r.Off {
+				return nil, c.Err("https_redirect off takes no properties")
+			}
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "port":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				port, err := strconv.Atoi(args[0])
+				if err != nil || port <= 0 || port > 65535 {
+					return nil, c.Errf("Invalid https_redirect port '%s'", args[0])
+				}
+				r.Port = args[0]
+			case "except":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				r.Except = append(r.Except, args...)
+			default:
+				return nil, c.Errf("Unknown https_redirect property '%s'", what)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// validStatus returns whether status is a redirect status code that
+// may be used.
+func validStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
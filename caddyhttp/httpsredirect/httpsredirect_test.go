@@ -0,0 +1,51 @@
+package httpsredirect
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	testCases := []struct {
+		input     string
+		shouldErr bool
+		expected  httpserver.HTTPSRedirect
+	}{
+		{input: "https_redirect", expected: httpserver.HTTPSRedirect{}},
+		{input: "https_redirect off", expected: httpserver.HTTPSRedirect{Off: true}},
+		{input: "https_redirect 308", expected: httpserver.HTTPSRedirect{Status: 308}},
+		{input: "https_redirect 302 {\n port 8443 \n}", expected: httpserver.HTTPSRedirect{Status: 302, Port: "8443"}},
+		{input: "https_redirect {\n except /health /status \n except /metrics \n}",
+			expected: httpserver.HTTPSRedirect{Except: []string{"/health", "/status", "/metrics"}}},
+		{input: "https_redirect 200", shouldErr: true},
+		{input: "https_redirect permanent", shouldErr: true},
+		{input: "https_redirect 301 302", shouldErr: true},
+		{input: "https_redirect off {\n port 8443 \n}", shouldErr: true},
+		{input: "https_redirect {\n port \n}", shouldErr: true},
+		{input: "https_redirect {\n port 70000 \n}", shouldErr: true},
+		{input: "https_redirect {\n except \n}", shouldErr: true},
+		{input: "https_redirect {\n foo \n}", shouldErr: true},
+		{input: "https_redirect\nhttps_redirect off", shouldErr: true},
+	}
+	for i, tc := range testCases {
+		c := caddy.NewTestController("http", tc.input)
+		err := setup(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but did not have one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Did not expect error, but got: %v", i, err)
+			continue
+		}
+		got := httpserver.GetConfig(c).HTTPSRedirect
+		if got == nil || !reflect.DeepEqual(*got, tc.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, tc.expected, got)
+		}
+	}
+}
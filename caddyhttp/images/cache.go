@@ -0,0 +1,107 @@
+package images
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCache keeps track of the size of a cache folder, so that
+// it can be kept under a limit.
+type diskCache struct {
+	sync.Mutex
+	dir    string
+	size   int64
+	loaded bool
+}
+
+var (
+	diskCachesMu sync.Mutex
+	diskCaches   = make(map[string]*diskCache)
+)
+
+// cacheFor returns the cache of the folder dir.
+func cacheFor(dir string) *diskCache {
+	diskCachesMu.Lock()
+	defer diskCachesMu.Unlock()
+	c, ok := diskCaches[dir]
+	if !ok {
+		c = &diskCache{dir: dir}
+		diskCaches[dir] = c
+	}
+	return c
+}
+
+// get returns the contents of the cached file name, and marks
+// it as recently used.
+func (c *diskCache) get(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(filepath.Join(c.dir, name), now, now)
+	return data, nil
+}
+
+// put writes data to the cached file name. If the folder then
+// holds more than max bytes, the least recently used files are
+// removed until it holds no more than 90% of max; max <= 0 means
+// no limit.
+func (c *diskCache) put(name string, data []byte, max int64) error {
+	if err := writeCacheFile(filepath.Join(c.dir, name), data); err != nil {
+		return err
+	}
+	if max <= 0 {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.size += int64(len(data))
+	if c.loaded && c.size <= max {
+		return nil
+	}
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	c.size = 0
+	for _, fi := range files {
+		c.size += fi.Size()
+	}
+	c.loaded = true
+	if c.size <= max {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, fi := range files {
+		if c.size <= max/10*9 {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.size -= fi.Size()
+	}
+	return nil
+}
+
+// files returns the cached files, leaving out those being written.
+func (c *diskCache) files() ([]os.FileInfo, error) {
+	all, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := all[:0]
+	for _, fi := range all {
+		if fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), ".tmp-") {
+			files = append(files, fi)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,56 @@
+package images
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_images_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &diskCache{dir: dir}
+	data := bytes.Repeat([]byte("x"), 100)
+	past := time.Now().Add(-time.Hour)
+	for i, name := range []string{"a", "b", "c", "d"} {
+		if err := c.put(name, data, 1000); err != nil {
+			t.Fatalf("Test %d: Unexpected error: %v", i, err)
+		}
+		// make the order of use unambiguous
+		modTime := past.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(dir, name), modTime, modTime)
+	}
+	// using a makes b the least recently used
+	if _, err := c.get("a"); err != nil {
+		t.Fatalf("Expected a to be cached, got %v", err)
+	}
+
+	for i, name := range []string{"e", "f", "g", "h", "i", "j", "k"} {
+		if err := c.put(name, data, 1000); err != nil {
+			t.Fatalf("Test %d: Unexpected error: %v", i, err)
+		}
+	}
+	files, err := c.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, fi := range files {
+		size += fi.Size()
+	}
+	if size > 1000 {
+		t.Errorf("Expected the cache to hold no more than 1000 bytes, got %d", size)
+	}
+	for name, expect := range map[string]bool{"a": true, "b": false, "k": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != expect {
+			t.Errorf("Expected %s cached to be %v, got error %v", name, expect, err)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package images is middleware for serving resized, cropped and
+// re-encoded variants of image files under the site root.
+package images
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Images is middleware that transforms image files on the fly.
+type Images struct {
+	Next    httpserver.Handler
+	Root    http.FileSystem
+	Configs []Config
+}
+
+// Config is the configuration for transforming images
+// under a base path.
+type Config struct {
+	// PathScope is the base path of this configuration.
+	PathScope string
+
+	// CacheDir is the directory to store transformed images
+	// in; if empty, results are not cached.
+	CacheDir string
+
+	// CacheSize limits the total size of the files in CacheDir;
+	// the least recently used ones are removed to stay under it.
+	// If 0, the cache can grow without bound.
+	CacheSize int64
+
+	// MaxWidth and MaxHeight limit the requested dimensions.
+	MaxWidth, MaxHeight int
+
+	// MaxSourcePixels limits the size of images that will be
+	// decoded, to protect against decompression bombs.
+	MaxSourcePixels int
+
+	// Quality is the default JPEG quality.
+	Quality int
+
+	// Secret, if set, requires every transform request to
+	// carry a valid signature; see Sign.
+	Secret []byte
+}
+
+// Query parameters understood by the middleware.
+const (
+	paramWidth   = "w"
+	paramHeight  = "h"
+	paramFit     = "fit"
+	paramFormat  = "fmt"
+	paramQuality = "q"
+	paramSig     = "sig"
+)
+
+// Fit modes.
+const (
+	// FitContain scales the image to fit within the
+	// requested box, preserving aspect ratio.
+	FitContain = "contain"
+
+	// FitCover scales and center-crops the image to
+	// fill the requested box exactly.
+	FitCover = "cover"
+
+	// FitStretch scales the image to the requested box,
+	// ignoring aspect ratio.
+	FitStretch = "stretch"
+)
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (i Images) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return i.Next.ServeHTTP(w, r)
+	}
+
+	var cfg *Config
+	for j := range i.Configs {
+		if httpserver.Path(r.URL.Path).Matches(i.Configs[j].PathScope) {
+			if cfg == nil || len(i.Configs[j].PathScope) > len(cfg.PathScope) {
+				cfg = &i.Configs[j]
+			}
+		}
+	}
+	if cfg == nil {
+		return i.Next.ServeHTTP(w, r)
+	}
+
+	query := r.URL.Query()
+	if query.Get(paramWidth) == "" && query.Get(paramHeight) == "" && query.Get(paramFormat) == "" {
+		return i.Next.ServeHTTP(w, r)
+	}
+
+	if len(cfg.Secret) > 0 && !Verify(cfg.Secret, r.URL.Path, query) {
+		return http.StatusForbidden, nil
+	}
+
+	opts, err := cfg.parseOptions(query, path.Ext(r.URL.Path))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	f, err := i.Root.Open(r.URL.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return http.StatusNotFound, nil
+		} else if os.IsPermission(err) {
+			return http.StatusForbidden, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if fi.IsDir() {
+		return i.Next.ServeHTTP(w, r)
+	}
+
+	enc, ok := encoders[opts.format]
+	if !ok {
+		return http.StatusBadRequest, fmt.Errorf("images: unsupported output format %q", opts.format)
+	}
+
+	var cache *diskCache
+	var cacheFile string
+	if cfg.CacheDir != "" {
+		cache = cacheFor(cfg.CacheDir)
+		cacheFile = opts.cacheKey(r.URL.Path, fi.ModTime()) + "." + opts.format
+		if data, err := cache.get(cacheFile); err == nil {
+			return serve(w, r, enc.ContentType, fi.ModTime(), data)
+		}
+	}
+
+	// guard against decompression bombs before decoding the pixel data
+	conf, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return http.StatusUnsupportedMediaType, err
+	}
+	if cfg.MaxSourcePixels > 0 && conf.Width*conf.Height > cfg.MaxSourcePixels {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	opts = cfg.clamp(opts, conf.Width, conf.Height)
+	if _, err := f.Seek(0, 0); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return http.StatusUnsupportedMediaType, err
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, Transform(src, opts.width, opts.height, opts.fit), opts.quality); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if cache != nil {
+		if err := cache.put(cacheFile, buf.Bytes(), cfg.CacheSize); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	return serve(w, r, enc.ContentType, fi.ModTime(), buf.Bytes())
+}
+
+// serve writes data to w as the response to r.
+func serve(w http.ResponseWriter, r *http.Request, contentType string, modTime time.Time, data []byte) (int, error) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+	return 0, nil
+}
+
+// writeCacheFile atomically writes data to name.
+func writeCacheFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// options are the transform options of a single request.
+type options struct {
+	width, height int
+	fit           string
+	format        string
+	quality       int
+}
+
+// parseOptions reads the transform options from query,
+// validating them against the limits in c. ext is the
+// extension of the source file, used for the default
+// output format.
+func (c Config) parseOptions(query url.Values, ext string) (options, error) {
+	opts := options{
+		fit:     FitContain,
+		format:  formatForExt(ext),
+		quality: c.Quality,
+	}
+
+	var err error
+	if v := query.Get(paramWidth); v != "" {
+		if opts.width, err = strconv.Atoi(v); err != nil || opts.width < 0 {
+			return opts, fmt.Errorf("images: invalid width %q", v)
+		}
+	}
+	if v := query.Get(paramHeight); v != "" {
+		if opts.height, err = strconv.Atoi(v); err != nil || opts.height < 0 {
+			return opts, fmt.Errorf("images: invalid height %q", v)
+		}
+	}
+	if c.MaxWidth > 0 && opts.width > c.MaxWidth {
+		return opts, fmt.Errorf("images: width %d exceeds maximum of %d", opts.width, c.MaxWidth)
+	}
+	if c.MaxHeight > 0 && opts.height > c.MaxHeight {
+		return opts, fmt.Errorf("images: height %d exceeds maximum of %d", opts.height, c.MaxHeight)
+	}
+	if v := query.Get(paramFit); v != "" {
+		switch v {
+		case FitContain, FitCover, FitStretch:
+			opts.fit = v
+		default:
+			return opts, fmt.Errorf("images: invalid fit %q", v)
+		}
+	}
+	if v := query.Get(paramFormat); v != "" {
+		opts.format = strings.ToLower(v)
+	}
+	if v := query.Get(paramQuality); v != "" {
+		if opts.quality, err = strconv.Atoi(v); err != nil || opts.quality < 1 || opts.quality > 100 {
+			return opts, fmt.Errorf("images: invalid quality %q", v)
+		}
+	}
+	return opts, nil
+}
+
+// clamp derives the dimension of the output that o leaves out from
+// the size of the source, sw x sh, as Transform would, and scales
+// both down if that exceeds the limits of c.
+func (c Config) clamp(o options, sw, sh int) options {
+	if sw == 0 || sh == 0 || (o.width == 0) == (o.height == 0) {
+		return o
+	}
+	if o.width == 0 {
+		o.width = max(1, sw*o.height/sh)
+	} else {
+		o.height = max(1, sh*o.width/sw)
+	}
+	if c.MaxWidth > 0 && o.width > c.MaxWidth {
+		o.width, o.height = c.MaxWidth, max(1, o.height*c.MaxWidth/o.width)
+	}
+	if c.MaxHeight > 0 && o.height > c.MaxHeight {
+		o.width, o.height = max(1, o.width*c.MaxHeight/o.height), c.MaxHeight
+	}
+	return o
+}
+
+// cacheKey returns a unique name for the result of applying
+// o to the file at urlPath last modified at modTime.
+func (o options) cacheKey(urlPath string, modTime time.Time) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\x00%s\x00%s\x00%d",
+		urlPath, modTime.UnixNano(), o.width, o.height, o.fit, o.format, o.quality)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign returns the signature for a request to urlPath with
+// the given query parameters. The signature is computed over
+// all parameters except the signature parameter itself, so
+// that the result can be added to query as "sig".
+func Sign(secret []byte, urlPath string, query url.Values) string {
+	q := url.Values{}
+	for k, v := range query {
+		if k != paramSig {
+			q[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(urlPath + "?" + q.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether query carries a valid signature
+// for urlPath.
+func Verify(secret []byte, urlPath string, query url.Values) bool {
+	sig, err := hex.DecodeString(query.Get(paramSig))
+	if err != nil || len(sig) == 0 {
+		return false
+	}
+	expected, _ := hex.DecodeString(Sign(secret, urlPath, query))
+	return hmac.Equal(sig, expected)
+}
@@ -0,0 +1,145 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func writeTestImage(t *testing.T, name string, w, h int) {
+	m := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImages(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	writeTestImage(t, filepath.Join(root, "pic.png"), 200, 100)
+	cacheDir := filepath.Join(root, "cache")
+
+	secret := []byte("secret")
+	im := Images{
+		Root: http.Dir(root),
+		Configs: []Config{
+			{PathScope: "/", MaxWidth: 500, MaxHeight: 500, Quality: 80, CacheDir: cacheDir},
+			{PathScope: "/private", Quality: 80, Secret: secret},
+		},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+	}
+
+	signed := url.Values{"w": {"10"}}
+	signed.Set("sig", Sign(secret, "/private/pic.png", signed))
+
+	tests := []struct {
+		url          string
+		expectedCode int
+		expectedType string
+		expectedSize image.Point
+	}{
+		{"/pic.png", http.StatusTeapot, "", image.Point{}},
+		{"/pic.png?w=50", http.StatusOK, "image/png", image.Pt(50, 25)},
+		{"/pic.png?w=50", http.StatusOK, "image/png", image.Pt(50, 25)}, // from cache
+		{"/pic.png?h=50&fmt=jpeg", http.StatusOK, "image/jpeg", image.Pt(100, 50)},
+		{"/pic.png?w=40&h=40&fit=cover", http.StatusOK, "image/png", image.Pt(40, 40)},
+		{"/pic.png?w=40&h=40", http.StatusOK, "image/png", image.Pt(40, 20)},
+		{"/pic.png?w=40&h=40&fit=stretch", http.StatusOK, "image/png", image.Pt(40, 40)},
+		{"/pic.png?h=400", http.StatusOK, "image/png", image.Pt(500, 250)},
+		{"/pic.png?w=50&fmt=webp", http.StatusOK, "image/webp", image.Pt(50, 25)},
+		{"/pic.png?w=1000", http.StatusBadRequest, "", image.Point{}},
+		{"/pic.png?w=abc", http.StatusBadRequest, "", image.Point{}},
+		{"/pic.png?w=10&fmt=bmp", http.StatusBadRequest, "", image.Point{}},
+		{"/missing.png?w=10", http.StatusNotFound, "", image.Point{}},
+		{"/private/pic.png?w=10", http.StatusForbidden, "", image.Point{}},
+		{"/private/pic.png?w=20&sig=" + signed.Get("sig"), http.StatusForbidden, "", image.Point{}},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		rec := httptest.NewRecorder()
+		code, _ := im.ServeHTTP(rec, req)
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedCode, code)
+			continue
+		}
+		if test.expectedType == "" {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != test.expectedType {
+			t.Errorf("Test %d: Expected Content-Type %s, got %s", i, test.expectedType, ct)
+		}
+		size, err := imageSize(rec.Body.Bytes())
+		if err != nil {
+			t.Errorf("Test %d: Could not decode response: %v", i, err)
+			continue
+		}
+		if size != test.expectedSize {
+			t.Errorf("Test %d: Expected size %v, got %v", i, test.expectedSize, size)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(cacheDir); len(files) == 0 {
+		t.Error("Expected transformed images to be cached")
+	}
+}
+
+// imageSize returns the size of the encoded image data, reading it
+// from the header of lossless webp images, which image can't decode.
+func imageSize(data []byte) (image.Point, error) {
+	if len(data) >= 25 && string(data[8:16]) == "WEBPVP8L" {
+		bits := binary.LittleEndian.Uint32(data[21:])
+		return image.Pt(int(bits&0x3fff)+1, int(bits>>14&0x3fff)+1), nil
+	}
+	conf, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return image.Pt(conf.Width, conf.Height), err
+}
+
+func TestSignature(t *testing.T) {
+	secret := []byte("secret")
+	q := url.Values{"w": {"100"}, "h": {"50"}}
+	q.Set("sig", Sign(secret, "/a.png", q))
+
+	if !Verify(secret, "/a.png", q) {
+		t.Error("Expected signature to verify")
+	}
+	if Verify(secret, "/b.png", q) {
+		t.Error("Expected signature for a different path to fail")
+	}
+	if Verify([]byte("other"), "/a.png", q) {
+		t.Error("Expected signature with a different secret to fail")
+	}
+	q.Set("w", "101")
+	if Verify(secret, "/a.png", q) {
+		t.Error("Expected signature with altered parameters to fail")
+	}
+}
@@ -0,0 +1,134 @@
+package images
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("images", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Images middleware instance.
+func setup(c *caddy.Controller) error {
+	configs, err := imagesParse(c)
+	if err != nil {
+		return err
+	}
+
+	for _, ic := range configs {
+		if ic.CacheDir != "" {
+			// images are cached once listening, also in a sandbox
+			caddy.RegisterWritableDir(ic.CacheDir)
+		}
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Images{Next: next, Root: cfg.FileSystem(), Configs: configs}
+	})
+
+	return nil
+}
+
+func imagesParse(c *caddy.Controller) ([]Config, error) {
+	var configs []Config
+
+	for c.Next() {
+		ic := Config{
+			PathScope:       "/",
+			MaxWidth:        defaultMaxDimension,
+			MaxHeight:       defaultMaxDimension,
+			MaxSourcePixels: defaultMaxSourcePixels,
+			Quality:         defaultQuality,
+			CacheSize:       defaultCacheSize,
+		}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			ic.PathScope = args[0]
+		default:
+			return configs, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "cache":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				dir, err := filepath.Abs(c.Val())
+				if err != nil {
+					return configs, err
+				}
+				ic.CacheDir = dir
+				if c.NextArg() {
+					size, err := humanize.ParseBytes(c.Val())
+					if err != nil || size == 0 || size > math.MaxInt64 {
+						return configs, c.Errf("Invalid cache size '%s'", c.Val())
+					}
+					ic.CacheSize = int64(size)
+				}
+			case "max_width", "max_height", "max_source_pixels", "quality":
+				prop := c.Val()
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 0 {
+					return configs, c.Errf("%s must be a non-negative integer, got '%s'", prop, c.Val())
+				}
+				switch prop {
+				case "max_width":
+					ic.MaxWidth = n
+				case "max_height":
+					ic.MaxHeight = n
+				case "max_source_pixels":
+					ic.MaxSourcePixels = n
+				case "quality":
+					if n < 1 || n > 100 {
+						return configs, c.Errf("quality must be between 1 and 100, got %d", n)
+					}
+					ic.Quality = n
+				}
+			case "secret":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				ic.Secret = []byte(c.Val())
+			default:
+				return configs, c.Errf("Unknown images property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return configs, c.ArgErr()
+			}
+		}
+
+		for _, other := range configs {
+			if other.PathScope == ic.PathScope {
+				return configs, fmt.Errorf("duplicate images config for %s", ic.PathScope)
+			}
+		}
+		configs = append(configs, ic)
+	}
+
+	return configs, nil
+}
+
+const (
+	defaultMaxDimension    = 4096
+	defaultMaxSourcePixels = 50 * 1000 * 1000
+	defaultQuality         = 85
+	defaultCacheSize       = 1 << 30
+)
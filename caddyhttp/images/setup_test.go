@@ -0,0 +1,143 @@
+package images
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `images /img`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Images)
+	if !ok {
+		t.Fatalf("Expected handler to be type Images, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	if len(myHandler.Configs) != 1 || myHandler.Configs[0].PathScope != "/img" {
+		t.Errorf("Expected one config for /img, got %+v", myHandler.Configs)
+	}
+}
+
+func TestImagesParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Config
+	}{
+		{`images`, false, []Config{{
+			PathScope:       "/",
+			MaxWidth:        defaultMaxDimension,
+			MaxHeight:       defaultMaxDimension,
+			MaxSourcePixels: defaultMaxSourcePixels,
+			Quality:         defaultQuality,
+			CacheSize:       defaultCacheSize,
+		}}},
+		{`images /photos {
+			max_width 800
+			max_height 600
+			max_source_pixels 1000000
+			quality 70
+			secret s3cr3t
+		}`, false, []Config{{
+			PathScope:       "/photos",
+			MaxWidth:        800,
+			MaxHeight:       600,
+			MaxSourcePixels: 1000000,
+			Quality:         70,
+			Secret:          []byte("s3cr3t"),
+			CacheSize:       defaultCacheSize,
+		}}},
+		{`images {
+			cache /tmp/images 100MB
+		}`, false, []Config{{
+			PathScope:       "/",
+			CacheSize:       100 * 1000 * 1000,
+			MaxWidth:        defaultMaxDimension,
+			MaxHeight:       defaultMaxDimension,
+			MaxSourcePixels: defaultMaxSourcePixels,
+			Quality:         defaultQuality,
+		}}},
+		{`images / /foo`, true, nil},
+		{`images {
+			max_width big
+		}`, true, nil},
+		{`images {
+			quality 0
+		}`, true, nil},
+		{`images {
+			secret
+		}`, true, nil},
+		{`images {
+			cache
+		}`, true, nil},
+		{`images {
+			cache /tmp/images lots
+		}`, true, nil},
+		{`images {
+			cache /tmp/images 0
+		}`, true, nil},
+		{`images {
+			resize_everything
+		}`, true, nil},
+		{"images /a\nimages /a", true, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		actual, err := imagesParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d expected %d configs, but got %d", i, len(test.expected), len(actual))
+		}
+		for j, ic := range actual {
+			expected := test.expected[j]
+			if ic.PathScope != expected.PathScope ||
+				ic.MaxWidth != expected.MaxWidth ||
+				ic.MaxHeight != expected.MaxHeight ||
+				ic.MaxSourcePixels != expected.MaxSourcePixels ||
+				ic.Quality != expected.Quality ||
+				ic.CacheSize != expected.CacheSize ||
+				string(ic.Secret) != string(expected.Secret) {
+				t.Errorf("Test %d, config %d: expected %+v, got %+v", i, j, expected, ic)
+			}
+		}
+	}
+}
+
+func TestSetupRegistersCacheDir(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "caddy-images-cache-test")
+	c := caddy.NewTestController("http", "images {\n\tcache "+dir+"\n}")
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	if !caddy.Writable(filepath.Join(dir, "thumb.jpg")) {
+		t.Errorf("Expected the cache folder %s to be writable once privileges are dropped", dir)
+	}
+}
@@ -0,0 +1,153 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Encoder writes an image in a particular format.
+type Encoder struct {
+	// ContentType is the MIME type of the encoded image.
+	ContentType string
+
+	// Encode writes m to w; quality is in the range 1-100
+	// and may be ignored by lossless formats.
+	Encode func(w io.Writer, m image.Image, quality int) error
+}
+
+// encoders maps output format names to their encoders.
+var encoders = make(map[string]Encoder)
+
+// RegisterEncoder makes an output format available under name,
+// which is the value of the "fmt" query parameter that selects
+// it. Formats without an encoder in the standard library or this
+// package, such as avif, can be plugged in this way. Registering a name twice replaces
+// the earlier encoder.
+func RegisterEncoder(name string, enc Encoder) {
+	encoders[strings.ToLower(name)] = enc
+}
+
+func init() {
+	RegisterEncoder("jpeg", Encoder{
+		ContentType: "image/jpeg",
+		Encode: func(w io.Writer, m image.Image, quality int) error {
+			return jpeg.Encode(w, m, &jpeg.Options{Quality: quality})
+		},
+	})
+	RegisterEncoder("png", Encoder{
+		ContentType: "image/png",
+		Encode: func(w io.Writer, m image.Image, quality int) error {
+			return png.Encode(w, m)
+		},
+	})
+	RegisterEncoder("gif", Encoder{
+		ContentType: "image/gif",
+		Encode: func(w io.Writer, m image.Image, quality int) error {
+			return gif.Encode(w, m, nil)
+		},
+	})
+	RegisterEncoder("webp", Encoder{
+		ContentType: "image/webp",
+		Encode: func(w io.Writer, m image.Image, quality int) error {
+			return encodeWebP(w, m)
+		},
+	})
+	RegisterEncoder("jpg", encoders["jpeg"])
+}
+
+// formatForExt returns the output format name for a file extension.
+func formatForExt(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "jpg" {
+		return "jpeg"
+	}
+	return ext
+}
+
+// Transform returns src resized to width x height according to
+// fit. If one of width and height is zero, it is derived from
+// the other so as to preserve the aspect ratio; if both are
+// zero, src is returned unchanged.
+func Transform(src image.Image, width, height int, fit string) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw == 0 || sh == 0 || (width == 0 && height == 0) {
+		return src
+	}
+	if width == 0 {
+		width = max(1, sw*height/sh)
+	} else if height == 0 {
+		height = max(1, sh*width/sw)
+	}
+
+	crop := b
+	switch fit {
+	case FitContain:
+		// shrink the box to the aspect ratio of the source
+		if sw*height > sh*width {
+			height = max(1, sh*width/sw)
+		} else {
+			width = max(1, sw*height/sh)
+		}
+	case FitCover:
+		// crop the source to the aspect ratio of the box
+		if sw*height > sh*width {
+			cw := sh * width / height
+			crop.Min.X += (sw - cw) / 2
+			crop.Max.X = crop.Min.X + cw
+		} else {
+			ch := sw * height / width
+			crop.Min.Y += (sh - ch) / 2
+			crop.Max.Y = crop.Min.Y + ch
+		}
+	}
+
+	return resample(src, crop, width, height)
+}
+
+// resample scales the region r of src to a new image of
+// width x height, averaging the source pixels that fall
+// within each destination pixel.
+func resample(src image.Image, r image.Rectangle, width, height int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rw, rh := r.Dx(), r.Dy()
+	for y := 0; y < height; y++ {
+		y0 := r.Min.Y + y*rh/height
+		y1 := max(y0+1, r.Min.Y+(y+1)*rh/height)
+		for x := 0; x < width; x++ {
+			x0 := r.Min.X + x*rw/width
+			x1 := max(x0+1, r.Min.X+(x+1)*rw/width)
+
+			var sr, sg, sb, sa, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					sr += uint64(c.R)
+					sg += uint64(c.G)
+					sb += uint64(c.B)
+					sa += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(sr / n >> 8),
+				G: uint8(sg / n >> 8),
+				B: uint8(sb / n >> 8),
+				A: uint8(sa / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
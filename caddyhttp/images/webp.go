@@ -0,0 +1,277 @@
+package images
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// encodeWebP writes m to w as a lossless WebP image. It uses only
+// the subtract green transform and a prefix code for each channel,
+// so it compresses less than libwebp, but needs no cgo.
+func encodeWebP(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return fmt.Errorf("images: can't encode a %dx%d image as webp", width, height)
+	}
+
+	pix := make([]color.NRGBA, 0, width*height)
+	alpha := false
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			c.R -= c.G
+			c.B -= c.G
+			alpha = alpha || c.A != 0xff
+			pix = append(pix, c)
+		}
+	}
+
+	// the green alphabet has the 24 length codes of backward
+	// references as well, which are not used
+	green, red, blue, alph := make([]int, 256+24), make([]int, 256), make([]int, 256), make([]int, 256)
+	for _, c := range pix {
+		green[c.G]++
+		red[c.R]++
+		blue[c.B]++
+		alph[c.A]++
+	}
+	codes := []prefixCode{
+		newPrefixCode(green, 15),
+		newPrefixCode(red, 15),
+		newPrefixCode(blue, 15),
+		newPrefixCode(alph, 15),
+		newPrefixCode(make([]int, 40), 15), // distances
+	}
+
+	bw := new(bitWriter)
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if alpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	// the subtract green transform, and no others
+	bw.write(1, 1)
+	bw.write(2, 2)
+	bw.write(0, 1)
+
+	// no color cache, and one group of prefix codes for the image
+	bw.write(0, 1)
+	bw.write(0, 1)
+	for _, pc := range codes {
+		pc.writeTo(bw)
+	}
+	for _, c := range pix {
+		codes[0].writeSymbol(bw, int(c.G))
+		codes[1].writeSymbol(bw, int(c.R))
+		codes[2].writeSymbol(bw, int(c.B))
+		codes[3].writeSymbol(bw, int(c.A))
+	}
+	data := bw.flush()
+
+	chunk := make([]byte, 8, 8+len(data)+1)
+	copy(chunk, "VP8L")
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	header := make([]byte, 12)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+len(chunk)))
+	copy(header[8:], "WEBP")
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(chunk)
+	return err
+}
+
+// bitWriter writes values least significant bit first, as WebP
+// reads them.
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (bw *bitWriter) write(v uint32, n uint) {
+	bw.acc |= uint64(v) << bw.nacc
+	bw.nacc += n
+	for bw.nacc >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nacc -= 8
+	}
+}
+
+// flush returns what was written, padded to whole bytes.
+func (bw *bitWriter) flush() []byte {
+	if bw.nacc > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nacc = 0, 0
+	}
+	return bw.buf
+}
+
+// codeLengthOrder is the order in which the lengths of the codes
+// of code lengths are written.
+var codeLengthOrder = []int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// prefixCode is a canonical prefix code of an alphabet.
+type prefixCode struct {
+	lengths []uint8  // the lengths of the codes, as written in the header
+	codes   []uint16 // the codes, bit reversed to be written
+	bits    []uint8  // how many bits of the codes are written
+}
+
+// newPrefixCode returns the prefix code for symbols with the
+// frequencies freq, with no code longer than limit.
+func newPrefixCode(freq []int, limit int) prefixCode {
+	lengths := huffmanLengths(freq, limit)
+	pc := prefixCode{lengths: lengths, codes: make([]uint16, len(freq)), bits: make([]uint8, len(freq))}
+
+	var count [16]int
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+		}
+	}
+	// a code of one symbol is read without reading any bits
+	if used == 1 {
+		return pc
+	}
+	var next [16]int
+	code := 0
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		var rev uint16
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | uint16(c>>i&1)
+		}
+		pc.codes[s], pc.bits[s] = rev, l
+	}
+	return pc
+}
+
+// huffmanLengths returns the lengths of the codes of a Huffman code
+// for symbols with the frequencies freq. If a code would be longer
+// than limit, the least frequent symbols are made more frequent
+// until none is.
+func huffmanLengths(freq []int, limit int) []uint8 {
+	lengths := make([]uint8, len(freq))
+	type node struct{ freq, parent int }
+	for minFreq := 1; ; minFreq *= 2 {
+		var nodes []node
+		var symbols []int
+		for s, f := range freq {
+			if f > 0 {
+				if f < minFreq {
+					f = minFreq
+				}
+				nodes = append(nodes, node{f, -1})
+				symbols = append(symbols, s)
+			}
+		}
+		if len(symbols) == 1 {
+			lengths[symbols[0]] = 1
+			return lengths
+		}
+		active := make([]int, len(nodes))
+		for i := range active {
+			active[i] = i
+		}
+		for len(active) > 1 {
+			sort.Slice(active, func(i, j int) bool { return nodes[active[i]].freq < nodes[active[j]].freq })
+			parent := len(nodes)
+			nodes = append(nodes, node{nodes[active[0]].freq + nodes[active[1]].freq, -1})
+			nodes[active[0]].parent, nodes[active[1]].parent = parent, parent
+			active = append(active[2:], parent)
+		}
+		fits := true
+		for i, s := range symbols {
+			depth := 0
+			for n := i; nodes[n].parent >= 0; n = nodes[n].parent {
+				depth++
+			}
+			fits = fits && depth <= limit
+			lengths[s] = uint8(depth)
+		}
+		if fits {
+			return lengths
+		}
+	}
+}
+
+// writeTo writes the header of pc, from which the decoder builds it.
+func (pc prefixCode) writeTo(bw *bitWriter) {
+	var used []int
+	for s, l := range pc.lengths {
+		if l > 0 {
+			used = append(used, s)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		// a simple code of one or two symbols
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+		}
+		return
+	}
+
+	// the lengths, written with a code of their own; the lengths
+	// that repeat others, 16 to 18, are not used
+	clFreq := make([]int, len(codeLengthOrder))
+	for _, l := range pc.lengths {
+		clFreq[l]++
+	}
+	cl := newPrefixCode(clFreq, 7)
+	n := len(codeLengthOrder)
+	for n > 4 && cl.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(0, 1)
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		bw.write(uint32(cl.lengths[s]), 3)
+	}
+	bw.write(0, 1) // the lengths of all the symbols follow
+	for _, l := range pc.lengths {
+		cl.writeSymbol(bw, int(l))
+	}
+}
+
+func (pc prefixCode) writeSymbol(bw *bitWriter, s int) {
+	bw.write(uint32(pc.codes[s]), uint(pc.bits[s]))
+}
@@ -0,0 +1,39 @@
+package images
+
+import "testing"
+
+func TestHuffmanLengths(t *testing.T) {
+	skewed := make([]int, 30)
+	for i := range skewed {
+		skewed[i] = 1 << uint(i)
+	}
+	for i, test := range []struct {
+		freq  []int
+		limit int
+	}{
+		{[]int{5, 0, 3, 1, 1}, 15},
+		{[]int{0, 7, 0}, 15},
+		{skewed, 15},
+		{skewed, 7},
+	} {
+		lengths := huffmanLengths(test.freq, test.limit)
+		// the code must be complete, so that decoders accept it
+		var sum float64
+		used := 0
+		for s, l := range lengths {
+			if int(l) > test.limit {
+				t.Errorf("Test %d: Expected no code longer than %d, got %d", i, test.limit, l)
+			}
+			if (l > 0) != (test.freq[s] > 0) {
+				t.Errorf("Test %d: Expected a code for symbol %d only if it is used, got length %d", i, s, l)
+			}
+			if l > 0 {
+				sum += 1 / float64(uint(1)<<l)
+				used++
+			}
+		}
+		if used > 1 && sum != 1 {
+			t.Errorf("Test %d: Expected a complete code, got lengths %v", i, lengths)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package inject implements middleware that injects a snippet of
+// HTML, such as an analytics script, a cookie banner or a banner
+// naming the environment, into HTML responses as they are streamed.
+package inject
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Inject is middleware that injects snippets into HTML responses.
+type Inject struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is a snippet and where it is injected.
+type Rule struct {
+	// Paths are the paths whose responses get the snippet, and
+	// Except those of them whose responses don't.
+	Paths  []string
+	Except []string
+
+	// Snippet is the HTML injected.
+	Snippet []byte
+
+	// Head is whether the snippet goes right after the opening
+	// head tag, rather than before the closing body tag.
+	Head bool
+}
+
+// matches returns whether responses for urlPath get the snippet
+// of rule.
+func (rule Rule) matches(urlPath string) bool {
+	for _, p := range rule.Except {
+		if httpserver.Path(urlPath).Matches(p) {
+			return false
+		}
+	}
+	for _, p := range rule.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (i Inject) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var writers []*injectWriter
+	for _, rule := range i.Rules {
+		if !rule.matches(r.URL.Path) {
+			continue
+		}
+		iw := &injectWriter{
+			ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+			rule:                  rule,
+		}
+		writers = append(writers, iw)
+		w = iw
+	}
+	if len(writers) == 0 {
+		return i.Next.ServeHTTP(w, r)
+	}
+
+	status, err := i.Next.ServeHTTP(w, r)
+
+	// the innermost writer writes to the others
+	for j := len(writers) - 1; j >= 0; j-- {
+		writers[j].finish()
+	}
+	return status, err
+}
+
+// injectWriter injects the snippet of a rule into the HTML written
+// to it, as it is written.
+type injectWriter struct {
+	*httpserver.ResponseWriterWrapper
+	rule        Rule
+	wroteHeader bool
+	active      bool // whether the response is HTML to inject into
+	scanner     scanner
+}
+
+// WriteHeader decides whether the response gets the snippet, and
+// since that changes its length, drops the length it had.
+func (w *injectWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.active = code == http.StatusOK && isHTML(w.Header().Get("Content-Type")) &&
+		w.Header().Get("Content-Encoding") == ""
+	if w.active {
+		w.Header().Del("Content-Length")
+		if etag := w.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			w.Header().Set("ETag", "W/"+etag)
+		}
+		w.scanner = scanner{head: w.rule.Head}
+	}
+	w.ResponseWriterWrapper.WriteHeader(code)
+}
+
+// Write writes b, with the snippet injected if it is due in b.
+func (w *injectWriter) Write(b []byte) (int, error) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType(b))
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.active {
+		return w.ResponseWriterWrapper.Write(b)
+	}
+	out := w.scanner.scan(b, w.rule.Snippet)
+	if _, err := w.ResponseWriterWrapper.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// finish writes what the writer held back, and the snippet, if it
+// goes before the closing body tag and the response had none.
+func (w *injectWriter) finish() {
+	if !w.active {
+		return
+	}
+	out := w.scanner.held
+	if !w.scanner.injected && !w.rule.Head {
+		out = append(out, w.rule.Snippet...)
+	}
+	w.scanner.held = nil
+	if len(out) > 0 {
+		w.ResponseWriterWrapper.Write(out)
+	}
+}
+
+// isHTML returns whether contentType is that of HTML.
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*injectWriter)(nil)
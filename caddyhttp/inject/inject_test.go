@@ -0,0 +1,80 @@
+package inject
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestInject(t *testing.T) {
+	for i, test := range []struct {
+		path        string
+		header      map[string]string
+		pieces      []string
+		expectBody  string
+		expectETag  string
+		expectShort bool // whether Content-Length is kept
+	}{
+		{"/", map[string]string{"Content-Type": "text/html; charset=utf-8", "Content-Length": "27", "ETag": `"abc"`},
+			[]string{"<html><body>hi</bo", "dy></html>"}, "<html><body>hi<p>banner</p></body></html>", `W/"abc"`, false},
+		{"/", nil, []string{"<html><body>sniffed</body></html>"}, "<html><body>sniffed<p>banner</p></body></html>", "", false},
+		{"/", map[string]string{"Content-Type": "text/html"}, []string{"<p>no body"}, "<p>no body<p>banner</p>", "", false},
+		{"/", map[string]string{"Content-Type": "text/css", "Content-Length": "6", "ETag": `"abc"`},
+			[]string{"</body"}, "</body", `"abc"`, true},
+		{"/", map[string]string{"Content-Type": "text/html", "Content-Encoding": "gzip", "Content-Length": "7"},
+			[]string{"</body>"}, "</body>", "", true},
+		{"/raw/page.html", map[string]string{"Content-Type": "text/html", "Content-Length": "7"},
+			[]string{"</body>"}, "</body>", "", true},
+	} {
+		next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			for k, v := range test.header {
+				w.Header().Set(k, v)
+			}
+			for _, piece := range test.pieces {
+				w.Write([]byte(piece))
+			}
+			return 0, nil
+		})
+		in := Inject{Next: next, Rules: []Rule{{
+			Paths:   []string{"/"},
+			Except:  []string{"/raw"},
+			Snippet: []byte("<p>banner</p>"),
+		}}}
+
+		rec := httptest.NewRecorder()
+		if _, err := in.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil)); err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if rec.Body.String() != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, rec.Body.String())
+		}
+		if rec.Header().Get("ETag") != test.expectETag {
+			t.Errorf("Test %d: expected ETag %q, got %q", i, test.expectETag, rec.Header().Get("ETag"))
+		}
+		if kept := rec.Header().Get("Content-Length") != ""; kept != test.expectShort {
+			t.Errorf("Test %d: expected Content-Length kept %v, got %v", i, test.expectShort, kept)
+		}
+	}
+}
+
+func TestInjectRules(t *testing.T) {
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("<html><head><title>t</title></head><body>hi</body></html>"))
+		return 0, nil
+	})
+	in := Inject{Next: next, Rules: []Rule{
+		{Paths: []string{"/"}, Snippet: []byte("<meta>"), Head: true},
+		{Paths: []string{"/"}, Snippet: []byte("<script></script>")},
+	}}
+
+	rec := httptest.NewRecorder()
+	in.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	expect := "<html><head><meta><title>t</title></head><body>hi<script></script></body></html>"
+	if rec.Body.String() != expect {
+		t.Errorf("Expected body %q, got %q", expect, rec.Body.String())
+	}
+}
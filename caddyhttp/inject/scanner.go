@@ -0,0 +1,125 @@
+package inject
+
+import "bytes"
+
+// scanState is where in a document a scanner is.
+type scanState int
+
+const (
+	inText scanState = iota
+	inComment
+	inScript
+	inHeadTag
+	scanDone
+)
+
+// markers are the markers that end each state but the last, in
+// lower case. They all start with the same byte.
+var markers = map[scanState][]string{
+	inComment: {"-->"},
+	inScript:  {"</script"},
+	inHeadTag: {">"},
+}
+
+// textMarkers are the markers of text, when the snippet goes after
+// the opening head tag and when it goes before the closing body tag.
+var textMarkers = map[bool][]string{
+	true:  {"<!--", "<script", "<head>", "<head ", "<head\t", "<head\n", "<head\r"},
+	false: {"<!--", "<script", "</body"},
+}
+
+// scanner finds where in an HTML document, written in pieces, a
+// snippet goes, skipping comments and scripts. It holds back the
+// bytes that may be the start of a marker until it knows.
+type scanner struct {
+	head     bool
+	state    scanState
+	held     []byte
+	injected bool
+}
+
+// scan returns b, with snippet injected if it is due in b, and
+// without the bytes held back.
+func (s *scanner) scan(b, snippet []byte) []byte {
+	out := make([]byte, 0, len(b)+len(snippet))
+	for _, c := range b {
+		if s.state == scanDone {
+			out = append(out, c)
+			continue
+		}
+		ms := s.markers()
+		if len(s.held) == 0 && c != ms[0][0] {
+			out = append(out, c)
+			continue
+		}
+		s.held = append(s.held, c)
+		for len(s.held) > 0 {
+			marker, full := match(s.held, ms)
+			if full {
+				out = s.reached(out, marker, snippet)
+				break
+			}
+			if marker != "" {
+				break // it may yet be one
+			}
+			out = append(out, s.held[0])
+			s.held = s.held[1:]
+		}
+	}
+	return out
+}
+
+// markers returns the markers that end the current state.
+func (s *scanner) markers() []string {
+	if s.state == inText {
+		return textMarkers[s.head]
+	}
+	return markers[s.state]
+}
+
+// match returns the marker that held is, or the start of, if any,
+// and whether it is all of it.
+func match(held []byte, markers []string) (string, bool) {
+	lower := bytes.ToLower(held)
+	for _, m := range markers {
+		if len(lower) <= len(m) && m[:len(lower)] == string(lower) {
+			return m, len(lower) == len(m)
+		}
+	}
+	return "", false
+}
+
+// reached appends the held marker to out, with snippet if it is due
+// there, and moves on to the state after it.
+func (s *scanner) reached(out []byte, marker string, snippet []byte) []byte {
+	switch {
+	case marker == "<!--":
+		out = append(out, s.held...)
+		s.state = inComment
+	case marker == "<script":
+		out = append(out, s.held...)
+		s.state = inScript
+	case marker == "</body":
+		out = append(append(out, snippet...), s.held...)
+		s.inject()
+	case marker == "<head>", s.state == inHeadTag:
+		out = append(append(out, s.held...), snippet...)
+		s.inject()
+	case s.state == inText:
+		// the opening head tag has attributes
+		out = append(out, s.held...)
+		s.state = inHeadTag
+	default:
+		// the end of a comment or script
+		out = append(out, s.held...)
+		s.state = inText
+	}
+	s.held = nil
+	return out
+}
+
+// inject notes that the snippet was injected.
+func (s *scanner) inject() {
+	s.injected = true
+	s.state = scanDone
+}
@@ -0,0 +1,40 @@
+package inject
+
+import "testing"
+
+func TestScanner(t *testing.T) {
+	const snippet = "<x>"
+	for i, test := range []struct {
+		head     bool
+		pieces   []string
+		expect   string
+		injected bool
+	}{
+		{false, []string{"<html><body>hi</body></html>"}, "<html><body>hi<x></body></html>", true},
+		{false, []string{"<html><body>hi</bo", "dy></html>"}, "<html><body>hi<x></body></html>", true},
+		{false, []string{"<", "/", "B", "O", "D", "Y", ">"}, "<x></BODY>", true},
+		{false, []string{"<body><!-- </body> --></body>"}, "<body><!-- </body> --><x></body>", true},
+		{false, []string{"<script>x = '</body>'</script></body>"}, "<script>x = '</body>'</script><x></body>", true},
+		{false, []string{"<script>x = '</body>'</scr", "ipt></body>"}, "<script>x = '</body>'</script><x></body>", true},
+		{false, []string{"<p>no body"}, "<p>no body", false},
+		{false, []string{"</body></body>"}, "<x></body></body>", true},
+		{true, []string{"<html><head><title>"}, "<html><head><x><title>", true},
+		{true, []string{"<html><HEAD lang=\"en\">", "<title>"}, "<html><HEAD lang=\"en\"><x><title>", true},
+		{true, []string{"<header><head>"}, "<header><head><x>", true},
+		{true, []string{"<!-- <head> --><he", "ad>"}, "<!-- <head> --><head><x>", true},
+		{true, []string{"<p>no head"}, "<p>no head", false},
+	} {
+		s := scanner{head: test.head}
+		var out []byte
+		for _, piece := range test.pieces {
+			out = append(out, s.scan([]byte(piece), []byte(snippet))...)
+		}
+		out = append(out, s.held...)
+		if string(out) != test.expect {
+			t.Errorf("Test %d: expected %q, got %q", i, test.expect, out)
+		}
+		if s.injected != test.injected {
+			t.Errorf("Test %d: expected injected %v, got %v", i, test.injected, s.injected)
+		}
+	}
+}
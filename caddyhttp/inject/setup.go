@@ -0,0 +1,107 @@
+package inject
+
+import (
+	"io/ioutil"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("inject", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Inject middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := injectParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Inject{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// injectParse parses
+//
+//	inject [paths...] {
+//		html snippet
+//		file snippet_file
+//		at body|head
+//		except paths...
+//	}
+//
+// where the snippet is given either inline or in a file, and goes
+// before the closing body tag, by default, or after the opening
+// head tag.
+func injectParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Paths: c.RemainingArgs()}
+		if len(rule.Paths) == 0 {
+			rule.Paths = []string{"/"}
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "html", "file":
+				kind := c.Val()
+				if rule.Snippet != nil {
+					return nil, c.Err("inject snippet given more than once")
+				}
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if kind == "html" {
+					rule.Snippet = []byte(c.Val())
+				} else {
+					snippet, err := ioutil.ReadFile(c.Val())
+					if err != nil {
+						return nil, c.Errf("reading inject snippet: %v", err)
+					}
+					rule.Snippet = snippet
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "at":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "body":
+					rule.Head = false
+				case "head":
+					rule.Head = true
+				default:
+					return nil, c.Errf("Unknown inject position '%s' (must be body or head)", c.Val())
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "except":
+				paths := c.RemainingArgs()
+				if len(paths) == 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Except = append(rule.Except, paths...)
+			default:
+				return nil, c.Errf("Unknown inject property '%s'", c.Val())
+			}
+		}
+
+		if rule.Snippet == nil {
+			return nil, c.Err("inject requires a snippet, with html or file")
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
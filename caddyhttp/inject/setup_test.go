@@ -0,0 +1,104 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `inject {
+		html "<p>staging</p>"
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Inject)
+	if !ok {
+		t.Fatalf("Expected handler to be type Inject, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestInjectParse(t *testing.T) {
+	f, err := ioutil.TempFile("", "caddy_inject")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("<script>{}</script>")
+	f.Close()
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`inject {
+			html "<p>staging</p>"
+		}`, false, []Rule{{Paths: []string{"/"}, Snippet: []byte("<p>staging</p>")}}},
+		{`inject /blog /docs {
+			file ` + f.Name() + `
+			at head
+			except /blog/raw
+		}
+		inject {
+			html <hr>
+			at body
+		}`, false, []Rule{
+			{Paths: []string{"/blog", "/docs"}, Except: []string{"/blog/raw"}, Snippet: []byte("<script>{}</script>"), Head: true},
+			{Paths: []string{"/"}, Snippet: []byte("<hr>")},
+		}},
+		{`inject`, true, nil},
+		{`inject {
+			at head
+		}`, true, nil},
+		{`inject {
+			html <hr>
+			file ` + f.Name() + `
+		}`, true, nil},
+		{`inject {
+			file /does/not/exist
+		}`, true, nil},
+		{`inject {
+			html <hr>
+			at footer
+		}`, true, nil},
+		{`inject {
+			html <hr>
+			except
+		}`, true, nil},
+		{`inject {
+			html <hr>
+			position body
+		}`, true, nil},
+	} {
+		rules, err := injectParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, test.expected, rules)
+		}
+	}
+}
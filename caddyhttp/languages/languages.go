@@ -0,0 +1,72 @@
+// Package languages implements the languages directive, which serves
+// the static files of multilingual sites in the languages their
+// visitors prefer.
+package languages
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("languages", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupLanguages,
+	})
+}
+
+// setupLanguages parses
+//
+//	languages default [others...]
+//
+// where the languages are tags such as en, de or pt-BR, that static
+// files are in according to their names, as in index.de.html. The
+// version of a file in the language that the Accept-Language header
+// of a request prefers is served, or else the version in the default
+// language, or else the file itself.
+func setupLanguages(c *caddy.Controller) error {
+	config := httpserver.GetConfig(c)
+
+	for c.Next() {
+		if len(config.Languages) > 0 {
+			return c.Err("languages may only be given once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		for i, lang := range args {
+			if !validTag(lang) {
+				return c.Errf("Bad language tag '%s'", lang)
+			}
+			for _, other := range args[:i] {
+				if strings.EqualFold(lang, other) {
+					return c.Errf("Language '%s' given twice", lang)
+				}
+			}
+		}
+		config.Languages = args
+	}
+
+	return nil
+}
+
+// validTag returns whether tag is made of subtags of 1 to 8 letters
+// or digits separated by hyphens, the first of letters, as language
+// tags are.
+func validTag(tag string) bool {
+	for i, subtag := range strings.Split(tag, "-") {
+		if len(subtag) == 0 || len(subtag) > 8 {
+			return false
+		}
+		for _, r := range subtag {
+			letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+			if !letter && (i == 0 || r < '0' || r > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
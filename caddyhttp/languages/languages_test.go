@@ -0,0 +1,43 @@
+package languages
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupLanguages(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expect    []string
+	}{
+		{`languages en`, false, []string{"en"}},
+		{`languages en de pt-BR zh-Hant-TW`, false, []string{"en", "de", "pt-BR", "zh-Hant-TW"}},
+		{`languages`, true, nil},
+		{`languages en english.html`, true, nil},
+		{`languages en 1a`, true, nil},
+		{`languages en de-`, true, nil},
+		{`languages en de DE`, true, nil},
+		{`languages en
+		  languages de`, true, nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupLanguages(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if langs := httpserver.GetConfig(c).Languages; !reflect.DeepEqual(langs, test.expect) {
+			t.Errorf("Test %d: expected %v, got %v", i, test.expect, langs)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package loadshed
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSamples is the most latencies kept to estimate the 99th
+// percentile from.
+const maxSamples = 1000
+
+// recomputeInterval is how often the 99th percentile is estimated
+// again, at most; sorting the samples on every request would cost
+// more than it is worth.
+const recomputeInterval = 100 * time.Millisecond
+
+// latencyWindow estimates the 99th percentile latency of the
+// requests of the last window.
+type latencyWindow struct {
+	mu       sync.Mutex
+	window   time.Duration
+	samples  []sample
+	next     int
+	p99      time.Duration
+	computed time.Time
+}
+
+// sample is the latency of a request, and when it ended.
+type sample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// add records the latency d of a request that ended at now.
+func (l *latencyWindow) add(d time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < maxSamples {
+		l.samples = append(l.samples, sample{now, d})
+		return
+	}
+	l.samples[l.next] = sample{now, d}
+	l.next = (l.next + 1) % maxSamples
+}
+
+// percentile99 returns the 99th percentile of the latencies of the
+// window before now, or 0 if there are none.
+func (l *latencyWindow) percentile99(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.computed) < recomputeInterval {
+		return l.p99
+	}
+	var recent []time.Duration
+	for _, s := range l.samples {
+		if now.Sub(s.at) <= l.window {
+			recent = append(recent, s.latency)
+		}
+	}
+	l.computed = now
+	l.p99 = 0
+	if len(recent) > 0 {
+		sort.Slice(recent, func(i, j int) bool { return recent[i] < recent[j] })
+		l.p99 = recent[(len(recent)*99-1)/100]
+	}
+	return l.p99
+}
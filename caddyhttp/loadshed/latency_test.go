@@ -0,0 +1,47 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	l := &latencyWindow{window: 10 * time.Second}
+	start := time.Now()
+	if p99 := l.percentile99(start); p99 != 0 {
+		t.Errorf("Expected 0 without samples, got %v", p99)
+	}
+
+	for i := 1; i <= 100; i++ {
+		l.add(time.Duration(i)*time.Millisecond, start)
+	}
+	now := start.Add(time.Second)
+	if p99 := l.percentile99(now); p99 != 99*time.Millisecond {
+		t.Errorf("Expected 99ms, got %v", p99)
+	}
+
+	// not estimated again so soon
+	l.add(time.Second, now)
+	if p99 := l.percentile99(now.Add(time.Millisecond)); p99 != 99*time.Millisecond {
+		t.Errorf("Expected the last estimate, 99ms, got %v", p99)
+	}
+
+	// the first samples are out of the window
+	if p99 := l.percentile99(start.Add(11 * time.Second)); p99 != time.Second {
+		t.Errorf("Expected 1s, got %v", p99)
+	}
+}
+
+func TestLatencyWindowFull(t *testing.T) {
+	l := &latencyWindow{window: time.Minute}
+	now := time.Now()
+	for i := 0; i < maxSamples*2; i++ {
+		l.add(time.Duration(i), now)
+	}
+	if len(l.samples) != maxSamples {
+		t.Errorf("Expected %d samples, got %d", maxSamples, len(l.samples))
+	}
+	if p99 := l.percentile99(now); p99 < maxSamples {
+		t.Errorf("Expected the oldest samples to be replaced, got p99 %v", p99)
+	}
+}
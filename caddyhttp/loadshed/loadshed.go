@@ -0,0 +1,92 @@
+// Package loadshed implements middleware that keeps a site
+// responsive under overload by turning away some of its low
+// priority requests while it is overloaded: while too many requests
+// are in flight, or the latency of the recent ones is too high.
+package loadshed
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var shedRequests = metrics.NewCounter("caddy_http_shed_requests_total",
+	"Number of requests turned away because the site was overloaded, by site.",
+	"site")
+
+// LoadShed is middleware that sheds low priority requests while a
+// site is overloaded.
+type LoadShed struct {
+	Next httpserver.Handler
+	Site string
+
+	// MaxInFlight is the most requests in flight before the site
+	// is overloaded, and LatencyTarget the highest 99th percentile
+	// latency of the requests of the last Window; 0 for no limit.
+	MaxInFlight   int64
+	LatencyTarget time.Duration
+	Window        time.Duration
+
+	// Low are the paths of low priority requests, and Fraction
+	// how many of them are shed while the site is overloaded.
+	Low      []string
+	Fraction float64
+
+	// RetryAfter is how long clients of shed requests are asked to
+	// wait before trying again.
+	RetryAfter time.Duration
+
+	inFlight  *int64
+	latencies *latencyWindow
+}
+
+// New returns l ready to serve requests.
+func New(l LoadShed) LoadShed {
+	l.inFlight = new(int64)
+	l.latencies = &latencyWindow{window: l.Window}
+	return l
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (l LoadShed) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	inFlight := atomic.AddInt64(l.inFlight, 1)
+	defer atomic.AddInt64(l.inFlight, -1)
+
+	start := time.Now()
+	if l.isLow(r.URL.Path) && l.overloaded(inFlight, start) && rand.Float64() < l.Fraction {
+		shedRequests.Inc(l.Site)
+		w.Header().Set("Retry-After", strconv.Itoa(int(l.RetryAfter/time.Second)))
+		return http.StatusServiceUnavailable, nil
+	}
+
+	status, err := l.Next.ServeHTTP(w, r)
+	if l.LatencyTarget > 0 {
+		end := time.Now()
+		l.latencies.add(end.Sub(start), end)
+	}
+	return status, err
+}
+
+// overloaded returns whether the site is overloaded at now, with
+// inFlight requests in flight.
+func (l LoadShed) overloaded(inFlight int64, now time.Time) bool {
+	if l.MaxInFlight > 0 && inFlight > l.MaxInFlight {
+		return true
+	}
+	return l.LatencyTarget > 0 && l.latencies.percentile99(now) > l.LatencyTarget
+}
+
+// isLow returns whether requests for urlPath are of low priority.
+func (l LoadShed) isLow(urlPath string) bool {
+	for _, p := range l.Low {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package loadshed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestLoadShedInFlight(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	l := New(LoadShed{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/slow" {
+				entered <- struct{}{}
+				<-release
+			}
+			return http.StatusOK, nil
+		}),
+		MaxInFlight: 1,
+		Low:         []string{"/search"},
+		Fraction:    1,
+		RetryAfter:  5 * time.Second,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		close(done)
+	}()
+	<-entered
+
+	for i, test := range []struct {
+		path       string
+		expectCode int
+	}{
+		{"/search", http.StatusServiceUnavailable},
+		{"/checkout", http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		code, _ := l.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if code != test.expectCode {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectCode, code)
+		}
+		if code == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") != "5" {
+			t.Errorf("Test %d: expected Retry-After 5, got %q", i, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	close(release)
+	<-done
+	if code, _ := l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/search", nil)); code != http.StatusOK {
+		t.Errorf("Expected requests to be served again, got %d", code)
+	}
+}
+
+func TestLoadShedLatency(t *testing.T) {
+	var delay time.Duration
+	l := New(LoadShed{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			time.Sleep(delay)
+			return http.StatusOK, nil
+		}),
+		LatencyTarget: 5 * time.Millisecond,
+		Window:        time.Minute,
+		Low:           []string{"/"},
+		Fraction:      1,
+		RetryAfter:    time.Second,
+	})
+
+	if code, _ := l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); code != http.StatusOK {
+		t.Errorf("Expected the first request to be served, got %d", code)
+	}
+	delay = 20 * time.Millisecond
+	l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	time.Sleep(recomputeInterval)
+	if code, _ := l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected requests to be shed while latency is high, got %d", code)
+	}
+}
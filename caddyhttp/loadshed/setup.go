@@ -0,0 +1,135 @@
+package loadshed
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("load_shed", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// Defaults of a LoadShed.
+const (
+	defaultWindow     = 10 * time.Second
+	defaultFraction   = 0.5
+	defaultRetryAfter = 5 * time.Second
+)
+
+// setup configures a new LoadShed middleware instance.
+func setup(c *caddy.Controller) error {
+	l, err := loadShedParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	l.Site = cfg.Addr.String()
+	l = New(l)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		l.Next = next
+		return l
+	})
+
+	return nil
+}
+
+// loadShedParse parses
+//
+//	load_shed {
+//		max_in_flight n
+//		latency target [window]
+//		low paths...
+//		fraction f
+//		retry_after duration
+//	}
+//
+// where at least one of max_in_flight and latency is required. All
+// requests are of low priority unless low paths are given.
+func loadShedParse(c *caddy.Controller) (LoadShed, error) {
+	l := LoadShed{
+		Window:     defaultWindow,
+		Fraction:   defaultFraction,
+		RetryAfter: defaultRetryAfter,
+	}
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return l, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "max_in_flight":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return l, c.ArgErr()
+				}
+				n, err := strconv.ParseInt(args[0], 10, 64)
+				if err != nil || n < 1 {
+					return l, c.Errf("Invalid load_shed max_in_flight '%s'", args[0])
+				}
+				l.MaxInFlight = n
+			case "latency":
+				args := c.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return l, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return l, c.Errf("Invalid load_shed latency '%s'", args[0])
+				}
+				l.LatencyTarget = d
+				if len(args) == 2 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil || d <= 0 {
+						return l, c.Errf("Invalid load_shed latency window '%s'", args[1])
+					}
+					l.Window = d
+				}
+			case "low":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return l, c.ArgErr()
+				}
+				l.Low = append(l.Low, args...)
+			case "fraction":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return l, c.ArgErr()
+				}
+				f, err := strconv.ParseFloat(args[0], 64)
+				if err != nil || f <= 0 || f > 1 {
+					return l, c.Errf("Invalid load_shed fraction '%s' (must be more than 0, and at most 1)", args[0])
+				}
+				l.Fraction = f
+			case "retry_after":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return l, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < time.Second {
+					return l, c.Errf("Invalid load_shed retry_after '%s' (must be at least 1s)", args[0])
+				}
+				l.RetryAfter = d
+			default:
+				return l, c.Errf("Unknown load_shed property '%s'", c.Val())
+			}
+		}
+	}
+
+	if l.MaxInFlight == 0 && l.LatencyTarget == 0 {
+		return l, c.Err("load_shed requires max_in_flight or latency")
+	}
+	if len(l.Low) == 0 {
+		l.Low = []string{"/"}
+	}
+	return l, nil
+}
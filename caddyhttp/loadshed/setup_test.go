@@ -0,0 +1,112 @@
+package loadshed
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `load_shed {
+		max_in_flight 100
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(LoadShed)
+	if !ok {
+		t.Fatalf("Expected handler to be type LoadShed, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if myHandler.inFlight == nil || myHandler.latencies == nil {
+		t.Error("Expected the handler to be ready to serve requests")
+	}
+}
+
+func TestLoadShedParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  LoadShed
+	}{
+		{`load_shed {
+			max_in_flight 100
+		}`, false, LoadShed{
+			MaxInFlight: 100,
+			Window:      defaultWindow,
+			Low:         []string{"/"},
+			Fraction:    defaultFraction,
+			RetryAfter:  defaultRetryAfter,
+		}},
+		{`load_shed {
+			latency 250ms 30s
+			low /search /reports
+			fraction 0.25
+			retry_after 10s
+		}`, false, LoadShed{
+			LatencyTarget: 250 * time.Millisecond,
+			Window:        30 * time.Second,
+			Low:           []string{"/search", "/reports"},
+			Fraction:      0.25,
+			RetryAfter:    10 * time.Second,
+		}},
+		{`load_shed`, true, LoadShed{}},
+		{`load_shed /api {
+			max_in_flight 100
+		}`, true, LoadShed{}},
+		{`load_shed {
+			max_in_flight 0
+		}`, true, LoadShed{}},
+		{`load_shed {
+			latency fast
+		}`, true, LoadShed{}},
+		{`load_shed {
+			latency 1s forever
+		}`, true, LoadShed{}},
+		{`load_shed {
+			max_in_flight 10
+			fraction 1.5
+		}`, true, LoadShed{}},
+		{`load_shed {
+			max_in_flight 10
+			retry_after 10ms
+		}`, true, LoadShed{}},
+		{`load_shed {
+			max_in_flight 10
+			low
+		}`, true, LoadShed{}},
+		{`load_shed {
+			max_in_flight 10
+			priority high /
+		}`, true, LoadShed{}},
+	} {
+		l, err := loadShedParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if l.MaxInFlight != test.expected.MaxInFlight || l.LatencyTarget != test.expected.LatencyTarget ||
+			l.Window != test.expected.Window || l.Fraction != test.expected.Fraction ||
+			l.RetryAfter != test.expected.RetryAfter || !reflect.DeepEqual(l.Low, test.expected.Low) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.expected, l)
+		}
+	}
+}
@@ -17,6 +17,9 @@ func setup(c *caddy.Controller) error {
 	for _, rule := range rules {
 		for _, entry := range rule.Entries {
 			entry.Log.Attach(c)
+			if strings.Contains(entry.Format, "{middleware_timings}") {
+				httpserver.GetConfig(c).TimeHandlers = true
+			}
 		}
 	}
 
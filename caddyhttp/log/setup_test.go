@@ -46,6 +46,17 @@ func TestSetup(t *testing.T) {
 	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
 		t.Error("'Next' field of handler was not set properly")
 	}
+	if cfg.TimeHandlers {
+		t.Error("Expected handlers not to be timed for the default format")
+	}
+
+	c = caddy.NewTestController("http", `log / access.log "{uri} {middleware_timings}"`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	if !httpserver.GetConfig(c).TimeHandlers {
+		t.Error("Expected handlers to be timed for a format with {middleware_timings}")
+	}
 }
 
 func TestLogParse(t *testing.T) {
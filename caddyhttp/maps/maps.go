@@ -0,0 +1,189 @@
+// Package maps is middleware that looks values up in tables of
+// keys and values, such as large tables of redirects, which are read
+// from files and read again when they change. The value for a request
+// is that of the {map.name} placeholder, for use by rewrite, redir,
+// proxy and other directives.
+package maps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Maps is middleware that makes the lookups of tables available
+// to the rest of the chain.
+type Maps struct {
+	Next   httpserver.Handler
+	Tables []*Table
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (m Maps) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	lookups := make(map[string]func(*http.Request) string, len(m.Tables))
+	if outer, ok := r.Context().Value(httpserver.MapsCtxKey).(map[string]func(*http.Request) string); ok {
+		for name, lookup := range outer {
+			lookups[name] = lookup
+		}
+	}
+	for _, t := range m.Tables {
+		lookups[t.Name] = t.Lookup
+	}
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.MapsCtxKey, lookups))
+	return m.Next.ServeHTTP(w, r)
+}
+
+// Table is a table of keys and values, read from a file.
+type Table struct {
+	// Name is that of the table, as in {map.name}.
+	Name string
+
+	// File is the file the table is read from.
+	File string
+
+	// Key is the key of requests, which may have placeholders,
+	// such as {path} or {host}.
+	Key string
+
+	// Default is the value for keys that are not in the table.
+	Default string
+
+	// Interval is how often the file is checked for changes; if
+	// 0, it is only read at startup.
+	Interval time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]string
+	modTime time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Lookup returns the value of the key of r.
+func (t *Table) Lookup(r *http.Request) string {
+	key := httpserver.NewReplacer(r, nil, "").Replace(t.Key)
+	t.mu.RLock()
+	value, ok := t.entries[key]
+	t.mu.RUnlock()
+	if !ok {
+		return t.Default
+	}
+	return value
+}
+
+// Len returns the number of entries of the table.
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.entries)
+}
+
+// maxTableFileSize bounds the size of table files.
+const maxTableFileSize = 64 << 20
+
+// Load reads the table from its file, in which each line is a key
+// and a value separated by spaces; blank lines and lines that start
+// with # are ignored. If the file is invalid, the entries read before
+// stay in effect.
+func (t *Table) Load() error {
+	fi, err := os.Stat(t.File)
+	if err != nil {
+		return err
+	}
+	if fi.Size() > maxTableFileSize {
+		return fmt.Errorf("map file %s is too large", t.File)
+	}
+	body, err := ioutil.ReadFile(t.File)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected a key and a value", t.File, n)
+		}
+		if _, dup := entries[fields[0]]; dup {
+			return fmt.Errorf("%s:%d: duplicate key %s", t.File, n, fields[0])
+		}
+		entries[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", t.File, err)
+	}
+
+	t.mu.Lock()
+	t.entries, t.modTime = entries, fi.ModTime()
+	t.mu.Unlock()
+	return nil
+}
+
+// Start starts watching the file of the table for changes.
+func (t *Table) Start() error {
+	if t.Interval <= 0 {
+		return nil
+	}
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go t.watch()
+	return nil
+}
+
+// Stop stops watching the file of the table for changes.
+func (t *Table) Stop() error {
+	if t.stop == nil {
+		return nil
+	}
+	close(t.stop)
+	<-t.done
+	t.stop = nil
+	return nil
+}
+
+func (t *Table) watch() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fi, err := os.Stat(t.File)
+			if err != nil {
+				continue
+			}
+			t.mu.RLock()
+			changed := !fi.ModTime().Equal(t.modTime)
+			t.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := t.Load(); err != nil {
+				log.Printf("[ERROR] map %s: reloading: %v", t.Name, err)
+				// don't try again until it changes again
+				t.mu.Lock()
+				t.modTime = fi.ModTime()
+				t.mu.Unlock()
+				continue
+			}
+			log.Printf("[INFO] map %s: reloaded %d entries from %s", t.Name, t.Len(), t.File)
+		case <-t.stop:
+			return
+		}
+	}
+}
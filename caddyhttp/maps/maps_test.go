@@ -0,0 +1,136 @@
+package maps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestMaps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	redirects := filepath.Join(dir, "redirects")
+	backends := filepath.Join(dir, "backends")
+	ioutil.WriteFile(redirects, []byte("# old pages\n/old /new\n/gone /\n"), 0644)
+	ioutil.WriteFile(backends, []byte("a.example.com 10.0.0.1:80\n"), 0644)
+
+	tables := []*Table{
+		{Name: "redirects", File: redirects, Key: "{path}"},
+		{Name: "backend", File: backends, Key: "{hostonly}", Default: "10.0.0.9:80"},
+	}
+	for _, table := range tables {
+		if err := table.Load(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got string
+	m := Maps{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			got = httpserver.NewReplacer(r, nil, "-").Replace("{map.redirects} {map.backend} {map.none}")
+			return http.StatusOK, nil
+		}),
+		Tables: tables,
+	}
+
+	for i, test := range []struct {
+		url, expect string
+	}{
+		{"http://a.example.com/old", "/new 10.0.0.1:80 -"},
+		{"http://b.example.com/gone", "/ 10.0.0.9:80 -"},
+		{"http://a.example.com/other", "- 10.0.0.1:80 -"},
+	} {
+		m.ServeHTTP(httptest.NewRecorder(), newRequest(test.url))
+		if got != test.expect {
+			t.Errorf("Test %d: expected %q, got %q", i, test.expect, got)
+		}
+	}
+}
+
+// newRequest returns a request for target, as the server passes
+// them on.
+func newRequest(target string) *http.Request {
+	r := httptest.NewRequest("GET", target, nil)
+	return r.WithContext(context.WithValue(r.Context(), httpserver.OriginalURLCtxKey, *r.URL))
+}
+
+func TestTableReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "table")
+	write := func(body string, mod time.Time) {
+		if err := ioutil.WriteFile(file, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lookup := func(table *Table, path string) string {
+		return table.Lookup(newRequest(path))
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("/a 1\n", start)
+	table := &Table{Name: "t", File: file, Key: "{path}", Interval: 10 * time.Millisecond}
+	if err := table.Load(); err != nil {
+		t.Fatal(err)
+	}
+	table.Start()
+	defer table.Stop()
+
+	// a change is picked up
+	write("/a 2\n/b 3\n", start.Add(time.Minute))
+	for i := 0; lookup(table, "/a") != "2"; i++ {
+		if i == 100 {
+			t.Fatal("Timed out waiting for the table to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if table.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", table.Len())
+	}
+
+	// a bad change keeps the entries in effect
+	write("/a 4 5\n", start.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if v := lookup(table, "/a"); v != "2" {
+		t.Errorf("Expected the entries to stay in effect after a bad change, got %q", v)
+	}
+}
+
+func TestTableLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, body := range []string{
+		"/a\n",
+		"/a 1 2\n",
+		"/a 1\n/a 2\n",
+	} {
+		file := filepath.Join(dir, "table")
+		ioutil.WriteFile(file, []byte(body), 0644)
+		if err := (&Table{File: file}).Load(); err == nil {
+			t.Errorf("Test %d: expected an error", i)
+		}
+	}
+	if err := (&Table{File: filepath.Join(dir, "missing")}).Load(); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
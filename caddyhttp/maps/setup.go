@@ -0,0 +1,96 @@
+package maps
+
+import (
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("map", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultInterval is how often table files are checked for
+// changes when reload is given without an interval.
+const defaultInterval = 5 * time.Second
+
+// setup configures a new Maps middleware instance.
+func setup(c *caddy.Controller) error {
+	tables, err := mapParse(c)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		if err := t.Load(); err != nil {
+			return c.Errf("Loading map %s: %v", t.Name, err)
+		}
+		c.OnStartup(t.Start)
+		c.OnShutdown(t.Stop)
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Maps{Next: next, Tables: tables}
+	})
+
+	return nil
+}
+
+func mapParse(c *caddy.Controller) ([]*Table, error) {
+	var tables []*Table
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return nil, c.ArgErr()
+		}
+		t := &Table{Name: args[0], File: args[1], Key: "{path}"}
+		for _, other := range tables {
+			if other.Name == t.Name {
+				return nil, c.Errf("Duplicate map '%s'", t.Name)
+			}
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "key":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				t.Key = c.Val()
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "default":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				t.Default = c.Val()
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "reload":
+				t.Interval = defaultInterval
+				if c.NextArg() {
+					d, err := time.ParseDuration(c.Val())
+					if err != nil || d <= 0 {
+						return nil, c.Errf("Bad map reload interval '%s'", c.Val())
+					}
+					t.Interval = d
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			default:
+				return nil, c.Errf("Unknown map property '%s'", c.Val())
+			}
+		}
+
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
@@ -0,0 +1,106 @@
+package maps
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	f, err := ioutil.TempFile("", "caddy_maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("/old /new\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	c := caddy.NewTestController("http", `map redirects `+f.Name())
+	err = setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Maps)
+	if !ok {
+		t.Fatalf("Expected handler to be type Maps, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if len(myHandler.Tables) != 1 || myHandler.Tables[0].Len() != 1 {
+		t.Error("Expected the table to be loaded")
+	}
+
+	if err := setup(caddy.NewTestController("http", `map redirects /nonexistent/file`)); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestMapParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []*Table
+	}{
+		{`map redirects redirects.txt`, false, []*Table{
+			{Name: "redirects", File: "redirects.txt", Key: "{path}"},
+		}},
+		{`map backend backends.txt {
+			key {host}
+			default 10.0.0.1:80
+			reload
+		}
+		map redirects redirects.txt {
+			reload 1m
+		}`, false, []*Table{
+			{Name: "backend", File: "backends.txt", Key: "{host}", Default: "10.0.0.1:80", Interval: defaultInterval},
+			{Name: "redirects", File: "redirects.txt", Key: "{path}", Interval: time.Minute},
+		}},
+		{`map`, true, nil},
+		{`map redirects`, true, nil},
+		{`map a a.txt
+		map a b.txt`, true, nil},
+		{`map a a.txt {
+			reload never
+		}`, true, nil},
+		{`map a a.txt {
+			key
+		}`, true, nil},
+		{`map a a.txt {
+			unknown
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := mapParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d: expected %d maps, got %d", i, len(test.expected), len(actual))
+		}
+		for j, table := range actual {
+			want := test.expected[j]
+			if table.Name != want.Name || table.File != want.File || table.Key != want.Key ||
+				table.Default != want.Default || table.Interval != want.Interval {
+				t.Errorf("Test %d, map %d: expected %+v, got %+v", i, j, want, table)
+			}
+		}
+	}
+}
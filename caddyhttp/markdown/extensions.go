@@ -0,0 +1,171 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// DefaultSyntax is the set of markdown extensions used when
+// none are configured.
+const DefaultSyntax = blackfriday.EXTENSION_TABLES |
+	blackfriday.EXTENSION_FENCED_CODE |
+	blackfriday.EXTENSION_STRIKETHROUGH |
+	blackfriday.EXTENSION_DEFINITION_LISTS
+
+// syntaxExtensions maps the names of markdown extensions that
+// can be enabled in the Caddyfile to their blackfriday flags.
+var syntaxExtensions = map[string]int{
+	"tables":            blackfriday.EXTENSION_TABLES,
+	"fenced_code":       blackfriday.EXTENSION_FENCED_CODE,
+	"strikethrough":     blackfriday.EXTENSION_STRIKETHROUGH,
+	"definition_lists":  blackfriday.EXTENSION_DEFINITION_LISTS,
+	"footnotes":         blackfriday.EXTENSION_FOOTNOTES,
+	"autolink":          blackfriday.EXTENSION_AUTOLINK,
+	"header_ids":        blackfriday.EXTENSION_HEADER_IDS,
+	"hard_line_breaks":  blackfriday.EXTENSION_HARD_LINE_BREAK,
+	"no_intra_emphasis": blackfriday.EXTENSION_NO_INTRA_EMPHASIS,
+	"task_lists":        0, // done after rendering; see renderTaskLists
+}
+
+// highlightVersion is the version of highlight.js that is loaded
+// to highlight code blocks.
+const highlightVersion = "9.12.0"
+
+// defaultHighlightBase is where highlight.js is loaded from, unless
+// configured otherwise.
+const defaultHighlightBase = "https://cdnjs.cloudflare.com/ajax/libs/highlight.js/" + highlightVersion
+
+// HighlightSource is where highlight.js is loaded from: Base, a URL
+// with highlight.min.js and styles/theme.min.css in it, such as that
+// of a copy on the site itself. If the integrity of the script and
+// stylesheet are given, as in Subresource Integrity, browsers only
+// use them if they match.
+type HighlightSource struct {
+	Base            string
+	ScriptIntegrity string
+	StyleIntegrity  string
+}
+
+// validIntegrity matches the values of integrity attributes.
+var validIntegrity = regexp.MustCompile(`^sha(256|384|512)-[A-Za-z0-9+/]+={0,2}$`)
+
+// validTheme matches the names of highlight.js themes.
+var validTheme = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Heading is an entry in the table of contents of a document.
+type Heading struct {
+	Level int    // 1 to 6
+	ID    string // of the heading element, to link to
+	Title string // as plain text
+}
+
+var (
+	headingRE = regexp.MustCompile(`(?s)<h([1-6]) id="([^"]+)">(.*?)</h[1-6]>`)
+	tagRE     = regexp.MustCompile(`<[^>]*>`)
+	taskRE    = regexp.MustCompile(`<li>(<p>)?\[([ xX])\] `)
+)
+
+// headings returns the headings in rendered, which must have
+// been rendered with heading IDs.
+func headings(rendered []byte) []Heading {
+	var toc []Heading
+	for _, m := range headingRE.FindAllSubmatch(rendered, -1) {
+		toc = append(toc, Heading{
+			Level: int(m[1][0] - '0'),
+			ID:    string(m[2]),
+			Title: html.UnescapeString(string(tagRE.ReplaceAll(m[3], nil))),
+		})
+	}
+	return toc
+}
+
+// tocHTML renders toc as nested lists of links to the headings.
+func tocHTML(toc []Heading) string {
+	if len(toc) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<nav class="toc">`)
+	depth := 0
+	// headings below the first level in the document are
+	// nested relative to it
+	base := toc[0].Level
+	for _, h := range toc {
+		if h.Level < base {
+			base = h.Level
+		}
+	}
+	for i, h := range toc {
+		level := h.Level - base + 1
+		switch {
+		case level > depth:
+			for ; depth < level; depth++ {
+				buf.WriteString("<ul><li>")
+			}
+		case level < depth:
+			for ; depth > level; depth-- {
+				buf.WriteString("</li></ul>")
+			}
+			buf.WriteString("</li><li>")
+		case i > 0:
+			buf.WriteString("</li><li>")
+		}
+		fmt.Fprintf(&buf, `<a href="#%s">%s</a>`, html.EscapeString(h.ID), html.EscapeString(h.Title))
+	}
+	buf.WriteString(strings.Repeat("</li></ul>", depth))
+	buf.WriteString("</nav>")
+	return buf.String()
+}
+
+// renderTaskLists turns list items that start with [ ] or [x]
+// into checkboxes, as on GitHub.
+func renderTaskLists(rendered []byte) []byte {
+	return taskRE.ReplaceAllFunc(rendered, func(m []byte) []byte {
+		sub := taskRE.FindSubmatch(m)
+		checked := ""
+		if sub[2][0] != ' ' {
+			checked = " checked"
+		}
+		return []byte(`<li class="task">` + string(sub[1]) + `<input type="checkbox" disabled` + checked + `> `)
+	})
+}
+
+// frontMatter returns a copy of the front matter of a document
+// in which all maps have string keys, as YAML maps don't, so that
+// templates can use it like any other front matter.
+func frontMatter(vars map[string]interface{}) map[string]interface{} {
+	fm := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		fm[k] = stringKeys(v)
+	}
+	return fm
+}
+
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = stringKeys(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = stringKeys(val)
+		}
+		return s
+	}
+	return v
+}
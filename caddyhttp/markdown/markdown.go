@@ -56,6 +56,26 @@ type Config struct {
 
 	// a pair of template's name and its underlying file path
 	TemplateFiles map[string]string
+
+	// Syntax is the set of blackfriday EXTENSION_* flags to
+	// parse markdown with; if 0, DefaultSyntax is used
+	Syntax int
+
+	// Whether to render task list items as checkboxes
+	TaskLists bool
+
+	// Whether to give headings IDs and make a table of contents
+	TOC bool
+
+	// The highlight.js theme to highlight code blocks with,
+	// if any
+	Highlight string
+
+	// Where highlight.js is loaded from, if not the default CDN
+	HighlightSource HighlightSource
+
+	// Static pre-renders the pages, if not nil
+	Static *Generator
 }
 
 // ServeHTTP implements the http.Handler interface.
@@ -117,6 +137,12 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 		return md.Next.ServeHTTP(w, r)
 	}
 
+	if cfg.Static != nil {
+		if code, ok := cfg.Static.serve(w, r, fpath); ok {
+			return code, nil
+		}
+	}
+
 	// At this point we have a supported extension/markdown
 	f, err := md.FileSys.Open(fpath)
 	switch {
@@ -52,14 +52,25 @@ func (c *Config) Markdown(title string, r io.Reader, dirents []os.FileInfo, ctx
 	parser := metadata.GetParser(body)
 	markdown := parser.Markdown()
 	mdata := parser.Metadata()
+	front := frontMatter(mdata.Variables)
 
 	// process markdown
-	extns := 0
-	extns |= blackfriday.EXTENSION_TABLES
-	extns |= blackfriday.EXTENSION_FENCED_CODE
-	extns |= blackfriday.EXTENSION_STRIKETHROUGH
-	extns |= blackfriday.EXTENSION_DEFINITION_LISTS
+	extns := c.Syntax
+	if extns == 0 {
+		extns = DefaultSyntax
+	}
+	if c.TOC {
+		extns |= blackfriday.EXTENSION_AUTO_HEADER_IDS
+	}
 	html := blackfriday.Markdown(markdown, c.Renderer, extns)
+	if c.TaskLists {
+		html = renderTaskLists(html)
+	}
+	var toc []Heading
+	if c.TOC {
+		toc = headings(html)
+		mdata.Variables["toc"] = tocHTML(toc)
+	}
 
 	// set it as body for template
 	mdata.Variables["body"] = string(html)
@@ -73,8 +84,8 @@ func (c *Config) Markdown(title string, r io.Reader, dirents []os.FileInfo, ctx
 	// move available and valid front matters to the meta values
 	meta := make(map[string]string)
 	for _, val := range recognizedMetaTags {
-		if mVal, ok := mdata.Variables[val]; ok {
-			meta[val] = mVal.(string)
+		if mVal, ok := mdata.Variables[val].(string); ok {
+			meta[val] = mVal
 		}
 	}
 
@@ -88,5 +99,5 @@ func (c *Config) Markdown(title string, r io.Reader, dirents []os.FileInfo, ctx
 		files = append(files, file)
 	}
 
-	return execTemplate(c, mdata, meta, files, ctx)
+	return execTemplate(c, mdata, front, meta, toc, files, ctx)
 }
@@ -4,8 +4,10 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/russross/blackfriday"
 )
 
 func TestConfig_Markdown(t *testing.T) {
@@ -41,3 +43,131 @@ func TestConfig_Markdown(t *testing.T) {
 		}
 	}
 }
+
+func TestConfig_MarkdownFeatures(t *testing.T) {
+	doc := `---
+title: Features
+tags: [a, b]
+author:
+  name: Someone
+---
+# Intro
+
+- [ ] todo
+- [x] done
+
+## Details & more
+
+Text.[^1]
+
+[^1]: A footnote.
+`
+	tpl := template.Must(template.New("").Parse(
+		`{{.FrontMatter.title}}|{{index .FrontMatter.tags 1}}|{{.FrontMatter.author.name}}|{{.Highlight}}|` +
+			`{{range .TOC}}{{.Level}}:{{.ID}}:{{.Title}};{{end}}|{{.Doc.toc}}|{{.Doc.body}}`))
+
+	config := &Config{
+		Renderer:  blackfriday.HtmlRenderer(0, "", ""),
+		Template:  tpl,
+		Syntax:    DefaultSyntax | blackfriday.EXTENSION_FOOTNOTES,
+		TaskLists: true,
+		TOC:       true,
+		Highlight: "monokai",
+	}
+	res, err := config.Markdown("Test title", strings.NewReader(doc), nil, httpserver.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(string(res), "|", 7)
+	if len(parts) != 7 {
+		t.Fatalf("Unexpected output: %s", res)
+	}
+
+	for i, expected := range []string{
+		"Features",
+		"b",
+		"Someone",
+		"monokai",
+		"1:intro:Intro;2:details-more:Details & more;",
+		`<nav class="toc"><ul><li><a href="#intro">Intro</a><ul><li><a href="#details-more">Details &amp; more</a></li></ul></li></ul></nav>`,
+	} {
+		if parts[i] != expected {
+			t.Errorf("Part %d: Expected %q, got %q", i, expected, parts[i])
+		}
+	}
+	body := parts[6]
+	for _, expected := range []string{
+		`<h1 id="intro">Intro</h1>`,
+		`<li class="task"><input type="checkbox" disabled> todo</li>`,
+		`<li class="task"><input type="checkbox" disabled checked> done</li>`,
+		`class="footnotes"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected body to contain %q, got:\n%s", expected, body)
+		}
+	}
+
+	// without the features, nothing changes
+	config = &Config{
+		Renderer: blackfriday.HtmlRenderer(0, "", ""),
+		Template: GetDefaultTemplate(),
+	}
+	res, err = config.Markdown("Test title", strings.NewReader(doc), nil, httpserver.Context{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unexpected := range []string{`id="intro"`, `class="toc"`, `checkbox`, `highlight.js`, `class="footnotes"`} {
+		if strings.Contains(string(res), unexpected) {
+			t.Errorf("Expected output not to contain %q, got:\n%s", unexpected, res)
+		}
+	}
+}
+
+func TestTOCHTML(t *testing.T) {
+	for i, test := range []struct {
+		toc      []Heading
+		expected string
+	}{
+		{nil, ""},
+		{[]Heading{{2, "a", "A"}, {3, "b", "B"}, {2, "c", "C"}},
+			`<nav class="toc"><ul><li><a href="#a">A</a><ul><li><a href="#b">B</a></li></ul></li><li><a href="#c">C</a></li></ul></nav>`},
+		{[]Heading{{3, "a", "A"}, {1, "b", "B"}},
+			`<nav class="toc"><ul><li><ul><li><ul><li><a href="#a">A</a></li></ul></li></ul></li><li><a href="#b">B</a></li></ul></nav>`},
+	} {
+		if got := tocHTML(test.toc); got != test.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expected, got)
+		}
+	}
+}
+
+func TestConfig_MarkdownHighlightSource(t *testing.T) {
+	for i, test := range []struct {
+		source   HighlightSource
+		expected []string
+	}{
+		{HighlightSource{}, []string{
+			`<link rel="stylesheet" href="` + defaultHighlightBase + `/styles/monokai.min.css" crossorigin="anonymous" referrerpolicy="no-referrer">`,
+			`<script src="` + defaultHighlightBase + `/highlight.min.js" crossorigin="anonymous" referrerpolicy="no-referrer"></script>`,
+		}},
+		{HighlightSource{Base: "/assets/hljs", ScriptIntegrity: "sha384-abc", StyleIntegrity: "sha384-def"}, []string{
+			`<link rel="stylesheet" href="/assets/hljs/styles/monokai.min.css" integrity="sha384-def" crossorigin="anonymous" referrerpolicy="no-referrer">`,
+			`<script src="/assets/hljs/highlight.min.js" integrity="sha384-abc" crossorigin="anonymous" referrerpolicy="no-referrer"></script>`,
+		}},
+	} {
+		config := &Config{
+			Renderer:        blackfriday.HtmlRenderer(0, "", ""),
+			Template:        GetDefaultTemplate(),
+			Highlight:       "monokai",
+			HighlightSource: test.source,
+		}
+		res, err := config.Markdown("Test title", strings.NewReader("`code`"), nil, httpserver.Context{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(string(res), expected) {
+				t.Errorf("Test %d: Expected output to contain %q, got:\n%s", i, expected, res)
+			}
+		}
+	}
+}
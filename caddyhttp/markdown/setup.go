@@ -1,8 +1,12 @@
 package markdown
 
 import (
-	"net/http"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -27,7 +31,7 @@ func setup(c *caddy.Controller) error {
 
 	md := Markdown{
 		Root:    cfg.Root,
-		FileSys: http.Dir(cfg.Root),
+		FileSys: cfg.FileSystem(),
 		Configs: mdconfigs,
 	}
 
@@ -36,6 +40,21 @@ func setup(c *caddy.Controller) error {
 		return md
 	})
 
+	for _, mdc := range mdconfigs {
+		if g := mdc.Static; g != nil {
+			g.FileSys, g.Root = md.FileSys, md.Root
+			if g.Dir == "" {
+				// each site and scope has its own directory
+				sum := sha256.Sum256([]byte(cfg.Addr.String() + mdc.PathScope))
+				g.Dir = filepath.Join(caddy.AssetsPath(), "markdown", hex.EncodeToString(sum[:8]))
+			}
+			// pages are rendered once listening, also in a sandbox
+			caddy.RegisterWritableDir(g.Dir)
+			c.OnStartup(g.Start)
+			c.OnShutdown(g.Stop)
+		}
+	}
+
 	return nil
 }
 
@@ -108,6 +127,9 @@ func loadParams(c *caddy.Controller, mdc *Config) error {
 		mdc.Scripts = append(mdc.Scripts, c.Val())
 		return nil
 	case "template":
+		if cfg.RootFS != nil {
+			return c.Err("markdown templates must be on disk, but the site root is not")
+		}
 		tArgs := c.RemainingArgs()
 		switch len(tArgs) {
 		default:
@@ -153,6 +175,98 @@ func loadParams(c *caddy.Controller, mdc *Config) error {
 			mdc.TemplateFiles[filepath.Base(path)] = path
 		}
 		return nil
+	case "extensions":
+		names := c.RemainingArgs()
+		if len(names) == 0 {
+			return c.ArgErr()
+		}
+		mdc.Syntax = 0
+		for _, name := range names {
+			flag, ok := syntaxExtensions[name]
+			if !ok {
+				return c.Errf("unknown markdown extension '%s'", name)
+			}
+			mdc.Syntax |= flag
+			if name == "task_lists" {
+				mdc.TaskLists = true
+			}
+		}
+		if mdc.Syntax == 0 {
+			// only task lists, which are no syntax of their own
+			mdc.Syntax = DefaultSyntax
+		}
+		return nil
+	case "static":
+		if cfg.RootFS != nil {
+			return c.Err("static markdown needs a site root on disk")
+		}
+		mdc.Static = &Generator{Config: mdc, Interval: defaultWatchInterval}
+		if c.NextArg() {
+			mdc.Static.Dir = c.Val()
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		return nil
+	case "watch":
+		if mdc.Static == nil {
+			return c.Err("watch requires static")
+		}
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		if c.Val() == "off" {
+			mdc.Static.Interval = 0
+		} else {
+			interval, err := time.ParseDuration(c.Val())
+			if err != nil || interval <= 0 {
+				return c.Errf("invalid watch interval '%s'", c.Val())
+			}
+			mdc.Static.Interval = interval
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		return nil
+	case "toc":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		mdc.TOC = true
+		return nil
+	case "highlight":
+		mdc.Highlight = "default"
+		if c.NextArg() {
+			mdc.Highlight = c.Val()
+		}
+		if !validTheme.MatchString(mdc.Highlight) {
+			return c.Errf("invalid highlight theme '%s'", mdc.Highlight)
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		return nil
+	case "highlight_from":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 3 {
+			return c.ArgErr()
+		}
+		u, err := url.Parse(args[0])
+		if err != nil || strings.ContainsAny(args[0], "\"<> ") || (u.Scheme != "" && u.Scheme != "https") || (u.Scheme == "" && !strings.HasPrefix(u.Path, "/")) {
+			return c.Errf("highlight.js must be loaded from an https URL or a path on the site, not '%s'", args[0])
+		}
+		mdc.HighlightSource = HighlightSource{Base: strings.TrimSuffix(args[0], "/")}
+		for i, integrity := range args[1:] {
+			if !validIntegrity.MatchString(integrity) {
+				return c.Errf("invalid integrity '%s'", integrity)
+			}
+			if i == 0 {
+				mdc.HighlightSource.ScriptIntegrity = integrity
+			} else {
+				mdc.HighlightSource.StyleIntegrity = integrity
+			}
+		}
+		return nil
 	default:
 		return c.Err("Expected valid markdown configuration property")
 	}
@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/russross/blackfriday"
 )
 
 func TestSetup(t *testing.T) {
@@ -156,3 +160,192 @@ func equalTemplates(i, j *template.Template) (bool, string, string) {
 
 	return bytes.Equal(bufi.Bytes(), bufj.Bytes()), string(bufi.Bytes()), string(bufj.Bytes())
 }
+
+func TestMarkdownParseFeatures(t *testing.T) {
+	for i, test := range []struct {
+		input             string
+		shouldErr         bool
+		expectedSyntax    int
+		expectedTaskLists bool
+		expectedTOC       bool
+		expectedHighlight string
+	}{
+		{`markdown`, false, 0, false, false, ""},
+		{`markdown {
+			extensions tables footnotes task_lists
+			toc
+			highlight
+		}`, false, blackfriday.EXTENSION_TABLES | blackfriday.EXTENSION_FOOTNOTES, true, true, "default"},
+		{`markdown {
+			extensions task_lists
+			highlight solarized-dark
+		}`, false, DefaultSyntax, true, false, "solarized-dark"},
+		{`markdown {
+			extensions
+		}`, true, 0, false, false, ""},
+		{`markdown {
+			extensions emoji
+		}`, true, 0, false, false, ""},
+		{`markdown {
+			toc yes
+		}`, true, 0, false, false, ""},
+		{`markdown {
+			highlight ../../etc
+		}`, true, 0, false, false, ""},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		configs, err := markdownParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		mdc := configs[0]
+		if mdc.Syntax != test.expectedSyntax {
+			t.Errorf("Test %d: Expected syntax %b, got %b", i, test.expectedSyntax, mdc.Syntax)
+		}
+		if mdc.TaskLists != test.expectedTaskLists {
+			t.Errorf("Test %d: Expected TaskLists %v, got %v", i, test.expectedTaskLists, mdc.TaskLists)
+		}
+		if mdc.TOC != test.expectedTOC {
+			t.Errorf("Test %d: Expected TOC %v, got %v", i, test.expectedTOC, mdc.TOC)
+		}
+		if mdc.Highlight != test.expectedHighlight {
+			t.Errorf("Test %d: Expected Highlight %q, got %q", i, test.expectedHighlight, mdc.Highlight)
+		}
+	}
+}
+
+func TestMarkdownParseHighlightFrom(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  HighlightSource
+	}{
+		{`markdown`, false, HighlightSource{}},
+		{`markdown {
+			highlight_from /assets/hljs/
+		}`, false, HighlightSource{Base: "/assets/hljs"}},
+		{`markdown {
+			highlight_from https://cdn.example.com/hljs sha384-YWJj sha384-ZGVm
+		}`, false, HighlightSource{Base: "https://cdn.example.com/hljs", ScriptIntegrity: "sha384-YWJj", StyleIntegrity: "sha384-ZGVm"}},
+		{`markdown {
+			highlight_from
+		}`, true, HighlightSource{}},
+		{`markdown {
+			highlight_from http://cdn.example.com/hljs
+		}`, true, HighlightSource{}},
+		{`markdown {
+			highlight_from assets/hljs
+		}`, true, HighlightSource{}},
+		{`markdown {
+			highlight_from /assets/hljs md5-abc
+		}`, true, HighlightSource{}},
+	} {
+		configs, err := markdownParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		if configs[0].HighlightSource != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, configs[0].HighlightSource)
+		}
+	}
+}
+
+func TestMarkdownParseStatic(t *testing.T) {
+	for i, test := range []struct {
+		input            string
+		shouldErr        bool
+		expectStatic     bool
+		expectedDir      string
+		expectedInterval time.Duration
+	}{
+		{`markdown`, false, false, "", 0},
+		{`markdown {
+			static
+		}`, false, true, "", defaultWatchInterval},
+		{`markdown {
+			static /var/cache/site
+			watch 10s
+		}`, false, true, "/var/cache/site", 10 * time.Second},
+		{`markdown {
+			static
+			watch off
+		}`, false, true, "", 0},
+		{`markdown {
+			watch 10s
+		}`, true, false, "", 0},
+		{`markdown {
+			static
+			watch -1s
+		}`, true, false, "", 0},
+		{`markdown {
+			static a b
+		}`, true, false, "", 0},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		configs, err := markdownParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but got: %v", i, err)
+			continue
+		}
+		g := configs[0].Static
+		if (g != nil) != test.expectStatic {
+			t.Fatalf("Test %d: Expected static %v, got %v", i, test.expectStatic, g != nil)
+		}
+		if g == nil {
+			continue
+		}
+		if g.Config != configs[0] {
+			t.Errorf("Test %d: Expected generator of the config", i)
+		}
+		if g.Dir != test.expectedDir {
+			t.Errorf("Test %d: Expected dir %q, got %q", i, test.expectedDir, g.Dir)
+		}
+		if g.Interval != test.expectedInterval {
+			t.Errorf("Test %d: Expected interval %v, got %v", i, test.expectedInterval, g.Interval)
+		}
+	}
+}
+
+func TestSetupRegistersStaticDir(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "caddy-markdown-static-test")
+	c := caddy.NewTestController("http", "markdown {\n\tstatic "+dir+"\n}")
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	if !caddy.Writable(filepath.Join(dir, "index.html")) {
+		t.Errorf("Expected the static folder %s to be writable once privileges are dropped", dir)
+	}
+}
+
+func TestSetupArchiveRoot(t *testing.T) {
+	for i, input := range []string{
+		"markdown {\n\ttemplate default.html\n}",
+		"markdown {\n\tstatic\n}",
+	} {
+		c := caddy.NewTestController("http", input)
+		httpserver.GetConfig(c).RootFS = http.Dir(".")
+		if err := setup(c); err == nil {
+			t.Errorf("Test %d: Expected an error when the root is not on disk", i)
+		}
+	}
+}
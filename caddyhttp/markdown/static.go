@@ -0,0 +1,282 @@
+package markdown
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// defaultWatchInterval is how often the files of a static
+// site are checked for changes, unless configured otherwise.
+// Each check walks the whole scope, so it is not often: a site
+// that needs changes picked up sooner can set it with watch.
+const defaultWatchInterval = 30 * time.Second
+
+// Generator pre-renders all the markdown files in the scope of
+// a Config to a directory, from which they are then served, and
+// renders them again whenever any file in the scope or any
+// template changes.
+//
+// Pages are rendered without a client request, so templates
+// must not depend on one. Pages that can't be pre-rendered, or
+// that were added since the last rendering, are rendered on
+// request as usual.
+type Generator struct {
+	// Config is the configuration of the pages to render.
+	Config *Config
+
+	// FileSys is where the markdown files are read from, and
+	// Root is the directory on disk it is rooted at.
+	FileSys http.FileSystem
+	Root    string
+
+	// Dir is the directory that pages are rendered to.
+	Dir string
+
+	// Interval is how often files are checked for changes;
+	// if 0, pages are only rendered at startup.
+	Interval time.Duration
+
+	mu       sync.RWMutex
+	pages    map[string]staticPage // by URL path of the markdown file
+	snapshot map[string]fileState
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// staticPage is a pre-rendered page.
+type staticPage struct {
+	file    string
+	modTime time.Time
+	etag    string
+}
+
+// fileState is what is compared to detect that a file changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Start renders all pages and starts watching for changes.
+func (g *Generator) Start() error {
+	if err := os.MkdirAll(g.Dir, 0700); err != nil {
+		return fmt.Errorf("markdown: creating static directory: %v", err)
+	}
+	g.Render()
+	if g.Interval > 0 {
+		g.stop = make(chan struct{})
+		g.done = make(chan struct{})
+		go g.watch()
+	}
+	return nil
+}
+
+// Stop stops watching for changes.
+func (g *Generator) Stop() error {
+	if g.stop == nil {
+		return nil
+	}
+	close(g.stop)
+	<-g.done
+	g.stop = nil
+	return nil
+}
+
+func (g *Generator) watch() {
+	defer close(g.done)
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !g.changed() {
+				continue
+			}
+			g.Render()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// changed returns whether any file has changed since the pages
+// were last rendered.
+func (g *Generator) changed() bool {
+	snapshot := g.scan()
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if len(snapshot) != len(g.snapshot) {
+		return true
+	}
+	for name, state := range snapshot {
+		if prev, ok := g.snapshot[name]; !ok || !prev.modTime.Equal(state.modTime) || prev.size != state.size {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeDir returns the directory on disk of the scope.
+func (g *Generator) scopeDir() string {
+	return filepath.Join(g.Root, filepath.FromSlash(path.Clean("/"+g.Config.PathScope)))
+}
+
+// scan returns the state of every file in the scope and of
+// every template, all of which a page may depend on.
+func (g *Generator) scan() map[string]fileState {
+	snapshot := make(map[string]fileState)
+	add := func(name string, fi os.FileInfo) {
+		snapshot[name] = fileState{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	filepath.Walk(g.scopeDir(), func(name string, fi os.FileInfo, err error) error {
+		if err == nil {
+			add(name, fi)
+		}
+		return nil
+	})
+	for _, name := range g.Config.TemplateFiles {
+		if fi, err := os.Stat(name); err == nil {
+			add(name, fi)
+		}
+	}
+	return snapshot
+}
+
+// Render renders all pages, replacing those rendered before.
+// Errors are logged, since a page that fails to render is
+// rendered on request instead.
+func (g *Generator) Render() {
+	snapshot := g.scan()
+	pages := make(map[string]staticPage)
+
+	scope := g.scopeDir()
+	for name, state := range snapshot {
+		if _, ok := g.Config.Extensions[filepath.Ext(name)]; !ok || !isWithin(scope, name) {
+			continue
+		}
+		rel, err := filepath.Rel(g.Root, name)
+		if err != nil {
+			continue
+		}
+		urlPath := "/" + filepath.ToSlash(rel)
+		page, err := g.renderPage(urlPath, state.modTime)
+		if err != nil {
+			log.Printf("[ERROR] markdown: rendering %s: %v", urlPath, err)
+			continue
+		}
+		pages[urlPath] = page
+	}
+
+	g.mu.Lock()
+	old := g.pages
+	g.pages, g.snapshot = pages, snapshot
+	g.mu.Unlock()
+
+	for urlPath, page := range old {
+		if _, ok := pages[urlPath]; !ok {
+			os.Remove(page.file)
+		}
+	}
+}
+
+func isWithin(dir, name string) bool {
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != ".." && !filepath.IsAbs(rel) &&
+		(len(rel) < 3 || rel[:3] != ".."+string(filepath.Separator))
+}
+
+// renderPage renders the markdown file at urlPath, last
+// modified at modTime, into the static directory.
+func (g *Generator) renderPage(urlPath string, modTime time.Time) (staticPage, error) {
+	// index files get the entries of their directory, as
+	// they do when rendered on request
+	var dirents []os.FileInfo
+	for _, index := range g.Config.IndexFiles {
+		if path.Base(urlPath) != index {
+			continue
+		}
+		if dir, err := g.FileSys.Open(path.Dir(urlPath)); err == nil {
+			dirents, _ = dir.Readdir(-1)
+			dir.Close()
+		}
+		for _, d := range dirents {
+			modTime = latest(modTime, d.ModTime())
+		}
+		break
+	}
+
+	f, err := g.FileSys.Open(urlPath)
+	if err != nil {
+		return staticPage{}, err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return staticPage{}, err
+	}
+	ctx := httpserver.NewContextWithHeader(make(http.Header))
+	ctx.Root = g.FileSys
+	ctx.Req = req
+	ctx.URL = req.URL
+	html, err := g.Config.Markdown(title(urlPath), f, dirents, ctx)
+	if err != nil {
+		return staticPage{}, err
+	}
+
+	file := filepath.Join(g.Dir, filepath.FromSlash(urlPath)+".html")
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return staticPage{}, err
+	}
+	// write to a temporary file first, so that a page being
+	// served is never seen half written
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".render-")
+	if err != nil {
+		return staticPage{}, err
+	}
+	_, err = tmp.Write(html)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return staticPage{}, err
+	}
+
+	sum := sha256.Sum256(html)
+	return staticPage{file: file, modTime: modTime, etag: fmt.Sprintf(`"%x"`, sum[:8])}, nil
+}
+
+// serve serves the pre-rendered page of the markdown file at
+// urlPath, returning 0 once it has, and returns false if there
+// is none.
+func (g *Generator) serve(w http.ResponseWriter, r *http.Request, urlPath string) (int, bool) {
+	g.mu.RLock()
+	page, ok := g.pages[urlPath]
+	g.mu.RUnlock()
+	if !ok {
+		return 0, false
+	}
+	f, err := os.Open(page.file)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("ETag", page.etag)
+	http.ServeContent(w, r, "", page.modTime, f)
+	return 0, true
+}
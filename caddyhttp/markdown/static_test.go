@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/russross/blackfriday"
+)
+
+func TestGenerator(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_markdown_static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(name, content string, modTime time.Time) {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fpath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write("site/blog/post.md", "# First", past)
+	write("site/blog/index.md", "Index", past)
+	write("site/other.md", "Out of scope", past)
+
+	site := filepath.Join(root, "site")
+	cfg := &Config{
+		Renderer:   blackfriday.HtmlRenderer(0, "", ""),
+		PathScope:  "/blog",
+		Extensions: map[string]struct{}{".md": {}},
+		IndexFiles: []string{"index.md"},
+		Template:   template.Must(template.New("").Parse(`{{.Doc.body}}{{range .Files}}[{{.Name}}]{{end}}`)),
+	}
+	g := &Generator{
+		Config:   cfg,
+		FileSys:  http.Dir(site),
+		Root:     site,
+		Dir:      filepath.Join(root, "static"),
+		Interval: 10 * time.Millisecond,
+	}
+	cfg.Static = g
+	md := Markdown{
+		Root:    site,
+		FileSys: http.Dir(site),
+		Configs: []*Config{cfg},
+		Next:    httpserver.EmptyNext,
+	}
+
+	if err := g.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+
+	for _, rendered := range []string{"blog/post.md.html", "blog/index.md.html"} {
+		if _, err := os.Stat(filepath.Join(g.Dir, filepath.FromSlash(rendered))); err != nil {
+			t.Errorf("Expected %s to be rendered: %v", rendered, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(g.Dir, "other.md.html")); !os.IsNotExist(err) {
+		t.Errorf("Expected page out of scope not to be rendered")
+	}
+
+	get := func(url, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		code, err := md.ServeHTTP(rec, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// pre-rendered pages are written by the time they're
+		// returned; the others are rendered as usual
+		if code != 0 && code != http.StatusOK {
+			t.Fatalf("Expected status 0 or 200 for %s, got %d", url, code)
+		}
+		return rec
+	}
+
+	rec := get("/blog/post.md", "")
+	if code, _ := md.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/blog/post.md", nil)); code != 0 {
+		t.Errorf("Expected status 0 once a pre-rendered page is written, got %d", code)
+	}
+	etag := rec.Header().Get("ETag")
+	if body := rec.Body.String(); body != "<h1>First</h1>\n" {
+		t.Errorf("Unexpected page: %q", body)
+	}
+	if etag == "" || rec.Header().Get("Last-Modified") != past.UTC().Format(http.TimeFormat) {
+		t.Errorf("Expected caching headers, got %v", rec.Header())
+	}
+	if rec := get("/blog/post.md", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching ETag, got %d", rec.Code)
+	}
+	if body := get("/blog/", "").Body.String(); !strings.Contains(body, "[index.md]") || !strings.Contains(body, "[post.md]") {
+		t.Errorf("Expected index to list its directory, got %q", body)
+	}
+
+	// a new page is rendered on request until the next rendering
+	write("site/blog/new.md", "New", time.Now())
+	if body := get("/blog/new.md", "").Body.String(); body != "<p>New</p>\n" {
+		t.Errorf("Unexpected new page: %q", body)
+	}
+
+	// changes are picked up
+	write("site/blog/post.md", "# Second", time.Now())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := get("/blog/post.md", "")
+		if rec.Body.String() == "<h1>Second</h1>\n" && rec.Header().Get("ETag") != etag {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Page was not rendered again after a change, got %q", rec.Body.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// and pages of deleted files are removed
+	os.Remove(filepath.Join(site, "blog", "new.md"))
+	for {
+		if _, err := os.Stat(filepath.Join(g.Dir, "blog", "new.md.html")); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Page of deleted file was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -17,6 +17,21 @@ type Data struct {
 	Scripts []string
 	Meta    map[string]string
 	Files   []FileInfo
+
+	// FrontMatter holds all the fields of the document's
+	// front matter, whatever its format.
+	FrontMatter map[string]interface{}
+
+	// TOC lists the headings of the document, if the
+	// table of contents is enabled; Doc.toc renders it.
+	TOC []Heading
+
+	// Highlight is the highlight.js theme for code blocks,
+	// or empty if they aren't highlighted.
+	Highlight string
+
+	// HighlightSource is where highlight.js is loaded from.
+	HighlightSource HighlightSource
 }
 
 // Include "overrides" the embedded httpserver.Context's Include()
@@ -28,14 +43,23 @@ func (d Data) Include(filename string, args ...interface{}) (string, error) {
 }
 
 // execTemplate executes a template given a requestPath, template, and metadata
-func execTemplate(c *Config, mdata metadata.Metadata, meta map[string]string, files []FileInfo, ctx httpserver.Context) ([]byte, error) {
+func execTemplate(c *Config, mdata metadata.Metadata, front map[string]interface{}, meta map[string]string, toc []Heading, files []FileInfo, ctx httpserver.Context) ([]byte, error) {
+	highlightSource := c.HighlightSource
+	if highlightSource.Base == "" {
+		highlightSource.Base = defaultHighlightBase
+	}
 	mdData := Data{
-		Context: ctx,
-		Doc:     mdata.Variables,
-		Styles:  c.Styles,
-		Scripts: c.Scripts,
-		Meta:    meta,
-		Files:   files,
+		Context:     ctx,
+		Doc:         mdata.Variables,
+		Styles:      c.Styles,
+		Scripts:     c.Scripts,
+		Meta:        meta,
+		Files:       files,
+		FrontMatter: front,
+		TOC:         toc,
+		Highlight:   c.Highlight,
+
+		HighlightSource: highlightSource,
 	}
 
 	templateName := mdata.Template
@@ -96,8 +120,18 @@ const (
 		{{- range .Scripts}}
 		<script src="{{.}}"></script>
 		{{- end}}
+		{{- if .Highlight}}
+		{{- with .HighlightSource}}
+		<link rel="stylesheet" href="{{.Base}}/styles/{{$.Highlight}}.min.css"{{with .StyleIntegrity}} integrity="{{.}}"{{end}} crossorigin="anonymous" referrerpolicy="no-referrer">
+		<script src="{{.Base}}/highlight.min.js"{{with .ScriptIntegrity}} integrity="{{.}}"{{end}} crossorigin="anonymous" referrerpolicy="no-referrer"></script>
+		{{- end}}
+		<script>hljs.initHighlightingOnLoad();</script>
+		{{- end}}
 	</head>
 	<body>
+		{{- with .Doc.toc}}
+		{{.}}
+		{{- end}}
 		{{.Doc.body}}
 	</body>
 </html>`
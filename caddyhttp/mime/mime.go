@@ -3,6 +3,7 @@ package mime
 import (
 	"net/http"
 	"path"
+	"strings"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -12,20 +13,90 @@ import (
 // not modified concurrently.
 type Config map[string]string
 
+// PathConfig is a mime config for the files under Path, which
+// overrides the configs of the site and of shorter paths.
+type PathConfig struct {
+	Path    string
+	Configs Config
+}
+
 // Mime sets Content-Type header of requests based on configurations.
 type Mime struct {
 	Next    httpserver.Handler
 	Configs Config
+
+	// Paths are the configs of paths, longest first.
+	Paths []PathConfig
+
+	// Charset is added to text types that have none, if set.
+	Charset string
+
+	// Strict are the paths under which files with extensions that
+	// have no mime-type are not served.
+	Strict []string
 }
 
 // ServeHTTP implements the httpserver.Handler interface.
 func (e Mime) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	// Get a clean /-path, grab the extension
-	ext := path.Ext(path.Clean(r.URL.Path))
+	cleanPath := path.Clean(r.URL.Path)
+	ext := path.Ext(cleanPath)
 
-	if contentType, ok := e.Configs[ext]; ok {
-		w.Header().Set("Content-Type", contentType)
+	if contentType, ok := e.lookup(cleanPath, ext); ok {
+		w.Header().Set("Content-Type", e.withCharset(contentType))
+	} else if ext != "" && e.strict(cleanPath) {
+		return http.StatusForbidden, nil
 	}
 
 	return e.Next.ServeHTTP(w, r)
 }
+
+// lookup returns the mime-type of ext for files at urlPath.
+func (e Mime) lookup(urlPath, ext string) (string, bool) {
+	for _, pc := range e.Paths {
+		if !httpserver.Path(urlPath).Matches(pc.Path) {
+			continue
+		}
+		if contentType, ok := pc.Configs[ext]; ok {
+			return contentType, true
+		}
+	}
+	contentType, ok := e.Configs[ext]
+	return contentType, ok
+}
+
+// strict returns whether files with extensions that have no
+// mime-type may not be served at urlPath.
+func (e Mime) strict(urlPath string) bool {
+	for _, p := range e.Strict {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// withCharset returns contentType with the charset parameter, if
+// it is a text type without one.
+func (e Mime) withCharset(contentType string) string {
+	if e.Charset == "" || strings.Contains(contentType, "charset=") || !isText(contentType) {
+		return contentType
+	}
+	return contentType + "; charset=" + e.Charset
+}
+
+// isText returns whether contentType is of text, to which a charset
+// applies.
+func isText(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/javascript",
+		mediaType == "application/json",
+		mediaType == "application/xml":
+		return true
+	}
+	return false
+}
@@ -67,3 +67,55 @@ func nextFunc(shouldMime bool, contentType string) httpserver.Handler {
 		return 0, nil
 	})
 }
+
+func TestMimePathsCharsetStrict(t *testing.T) {
+	m := Mime{
+		Configs: Config{
+			".html": "text/html",
+			".txt":  "text/plain",
+			".json": "application/json",
+			".png":  "image/png",
+			".csv":  "text/csv; charset=iso-8859-1",
+		},
+		Paths: []PathConfig{
+			{Path: "/legacy/old", Configs: Config{".txt": "text/x-older"}},
+			{Path: "/legacy", Configs: Config{".txt": "text/x-legacy", ".dat": "application/x-legacy"}},
+		},
+		Charset: "utf-8",
+		Strict:  []string{"/downloads"},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+	}
+
+	for i, test := range []struct {
+		path         string
+		expectedCode int
+		expectedType string
+	}{
+		{"/index.html", http.StatusOK, "text/html; charset=utf-8"},
+		{"/data.json", http.StatusOK, "application/json; charset=utf-8"},
+		{"/logo.png", http.StatusOK, "image/png"},
+		{"/table.csv", http.StatusOK, "text/csv; charset=iso-8859-1"},
+		{"/legacy/a.txt", http.StatusOK, "text/x-legacy; charset=utf-8"},
+		{"/legacy/old/a.txt", http.StatusOK, "text/x-older; charset=utf-8"},
+		{"/legacy/old/a.dat", http.StatusOK, "application/x-legacy"},
+		{"/legacy/a.html", http.StatusOK, "text/html; charset=utf-8"},
+		{"/a.dat", http.StatusOK, ""},
+		{"/downloads/a.exe", http.StatusForbidden, ""},
+		{"/downloads/a.txt", http.StatusOK, "text/plain; charset=utf-8"},
+		{"/downloads/", http.StatusOK, ""},
+	} {
+		rec := httptest.NewRecorder()
+		code, err := m.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d: expected status %d, got %d", i, test.expectedCode, code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != test.expectedType {
+			t.Errorf("Test %d: expected Content-Type %q, got %q", i, test.expectedType, ct)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package mime
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -17,20 +18,39 @@ func init() {
 
 // setup configures a new mime middleware instance.
 func setup(c *caddy.Controller) error {
-	configs, err := mimeParse(c)
+	m, err := mimeParse(c)
 	if err != nil {
 		return err
 	}
 
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return Mime{Next: next, Configs: configs}
+		m.Next = next
+		return m
 	})
 
 	return nil
 }
 
-func mimeParse(c *caddy.Controller) (Config, error) {
-	configs := Config{}
+// mimeParse parses the mime directives of a site, which are
+//
+//	mime .ext type
+//
+// or
+//
+//	mime [/path] {
+//		.ext type
+//		import [file|builtin]
+//		charset name
+//		strict [paths...]
+//	}
+//
+// Mime-types of a block with a path are for the files under it.
+// Imported mime-types are those of a mime.types file, and give way
+// to those listed in the Caddyfile.
+func mimeParse(c *caddy.Controller) (Mime, error) {
+	m := Mime{Configs: Config{}}
+	imported := Config{}
+	pathIndex := map[string]int{}
 
 	for c.Next() {
 		// At least one extension is required
@@ -38,28 +58,104 @@ func mimeParse(c *caddy.Controller) (Config, error) {
 		args := c.RemainingArgs()
 		switch len(args) {
 		case 2:
-			if err := validateExt(configs, args[0]); err != nil {
-				return configs, err
+			if err := validateExt(m.Configs, args[0]); err != nil {
+				return m, err
 			}
-			configs[args[0]] = args[1]
+			m.Configs[args[0]] = args[1]
 		case 1:
-			return configs, c.ArgErr()
+			if !strings.HasPrefix(args[0], "/") {
+				return m, c.ArgErr()
+			}
+			i, ok := pathIndex[args[0]]
+			if !ok {
+				i = len(m.Paths)
+				pathIndex[args[0]] = i
+				m.Paths = append(m.Paths, PathConfig{Path: args[0], Configs: Config{}})
+			}
+			pc := &m.Paths[i]
+			pathImported := Config{}
+			if err := parseBlock(c, &m, pc.Path, pc.Configs, pathImported); err != nil {
+				return m, err
+			}
+			merge(pc.Configs, pathImported)
 		case 0:
-			for c.NextBlock() {
-				ext := c.Val()
-				if err := validateExt(configs, ext); err != nil {
-					return configs, err
-				}
-				if !c.NextArg() {
-					return configs, c.ArgErr()
-				}
-				configs[ext] = c.Val()
+			if err := parseBlock(c, &m, "/", m.Configs, imported); err != nil {
+				return m, err
 			}
+		default:
+			return m, c.ArgErr()
 		}
+	}
+	merge(m.Configs, imported)
 
+	sort.SliceStable(m.Paths, func(i, j int) bool {
+		return len(m.Paths[i].Path) > len(m.Paths[j].Path)
+	})
+	return m, nil
+}
+
+// parseBlock parses the block of a mime directive for the files
+// under basePath into m, with the mime-types listed added to configs
+// and those imported to imported.
+func parseBlock(c *caddy.Controller, m *Mime, basePath string, configs, imported Config) error {
+	empty := true
+	for c.NextBlock() {
+		empty = false
+		switch c.Val() {
+		case "import":
+			args := c.RemainingArgs()
+			if len(args) > 1 {
+				return c.ArgErr()
+			}
+			var file string
+			if len(args) == 1 {
+				file = args[0]
+			}
+			if err := importTypes(imported, file); err != nil {
+				return c.Errf("mime: %v", err)
+			}
+		case "charset":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			if m.Charset != "" && m.Charset != c.Val() {
+				return c.Errf("mime: conflicting charsets %s and %s", m.Charset, c.Val())
+			}
+			m.Charset = c.Val()
+			if c.NextArg() {
+				return c.ArgErr()
+			}
+		case "strict":
+			paths := c.RemainingArgs()
+			if len(paths) == 0 {
+				paths = []string{basePath}
+			}
+			m.Strict = append(m.Strict, paths...)
+		default:
+			ext := c.Val()
+			if err := validateExt(configs, ext); err != nil {
+				return err
+			}
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			configs[ext] = c.Val()
+		}
 	}
+	if empty {
+		return c.ArgErr()
+	}
+	return nil
+}
 
-	return configs, nil
+// merge adds the mime-types of imported to configs for the extensions
+// that have none.
+func merge(configs, imported Config) {
+	for ext, contentType := range imported {
+		if _, ok := configs[ext]; !ok {
+			configs[ext] = contentType
+		}
+	}
 }
 
 // validateExt checks for valid file name extension.
@@ -51,6 +51,33 @@ func TestSetup(t *testing.T) {
 		{`mime { .html
 		} `, true},
 		{`mime .txt text/plain`, false},
+		{`mime {
+		 import builtin
+		 .css text/x-css
+		 charset utf-8
+		 strict /downloads /files
+		}`, false},
+		{`mime {
+		 import /nonexistent/mime.types
+		}`, true},
+		{`mime {
+		 import builtin extra
+		}`, true},
+		{`mime {
+		 charset
+		}`, true},
+		{`mime /legacy {
+		 .txt text/x-legacy
+		 strict
+		}
+		mime .txt text/plain`, false},
+		{`mime /legacy`, true},
+		{`mime {
+		 charset utf-8
+		}
+		mime /legacy {
+		 charset latin1
+		}`, true},
 	}
 	for i, test := range tests {
 		m, err := mimeParse(caddy.NewTestController("http", test.input))
@@ -61,3 +88,40 @@ func TestSetup(t *testing.T) {
 		}
 	}
 }
+
+func TestMimeParse(t *testing.T) {
+	m, err := mimeParse(caddy.NewTestController("http", `mime {
+		import builtin
+		.css text/x-css
+		charset utf-8
+		strict /downloads
+	}
+	mime /a {
+		.txt text/x-a
+		strict
+	}
+	mime /a/b {
+		.txt text/x-b
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Configs[".css"] != "text/x-css" {
+		t.Errorf("Expected listed types to take precedence over imported ones, got %q", m.Configs[".css"])
+	}
+	if m.Configs[".png"] != "image/png" {
+		t.Errorf("Expected imported types, got %q", m.Configs[".png"])
+	}
+	if m.Charset != "utf-8" {
+		t.Errorf("Expected charset utf-8, got %q", m.Charset)
+	}
+	if len(m.Strict) != 2 || m.Strict[0] != "/downloads" || m.Strict[1] != "/a" {
+		t.Errorf("Expected strict paths [/downloads /a], got %v", m.Strict)
+	}
+	if len(m.Paths) != 2 || m.Paths[0].Path != "/a/b" || m.Paths[1].Path != "/a" {
+		t.Fatalf("Expected paths sorted longest first, got %v", m.Paths)
+	}
+	if m.Paths[0].Configs[".txt"] != "text/x-b" {
+		t.Errorf("Expected the path's types, got %v", m.Paths[0].Configs)
+	}
+}
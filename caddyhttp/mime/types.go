@@ -0,0 +1,123 @@
+package mime
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// SystemTypes is the mime.types file that is imported if no file is
+// given and it exists; otherwise the builtin table is.
+const SystemTypes = "/etc/mime.types"
+
+// builtinTypes is the table of mime-types imported by 'import builtin'
+// or on systems without a mime.types file, in the format of one.
+const builtinTypes = `
+application/atom+xml		atom
+application/gzip		gz
+application/javascript		js mjs
+application/json		json map
+application/ld+json		jsonld
+application/manifest+json	webmanifest
+application/octet-stream	bin exe dll iso img
+application/pdf			pdf
+application/rss+xml		rss
+application/vnd.ms-fontobject	eot
+application/wasm		wasm
+application/x-7z-compressed	7z
+application/x-bzip2		bz2
+application/x-shockwave-flash	swf
+application/x-tar		tar
+application/xhtml+xml		xhtml
+application/xml			xml xsl
+application/zip			zip
+audio/aac			aac
+audio/flac			flac
+audio/midi			mid midi
+audio/mpeg			mp3
+audio/ogg			oga ogg opus
+audio/wav			wav
+audio/webm			weba
+font/otf			otf
+font/ttf			ttf
+font/woff			woff
+font/woff2			woff2
+image/avif			avif
+image/bmp			bmp
+image/gif			gif
+image/jpeg			jpeg jpg
+image/png			png
+image/svg+xml			svg svgz
+image/tiff			tif tiff
+image/vnd.microsoft.icon	ico
+image/webp			webp
+text/calendar			ics
+text/css			css
+text/csv			csv
+text/html			html htm
+text/markdown			md markdown
+text/plain			txt text log
+text/vcard			vcf
+text/vtt			vtt
+text/yaml			yaml yml
+video/mp4			mp4 m4v
+video/mpeg			mpeg mpg
+video/ogg			ogv
+video/quicktime			mov
+video/webm			webm
+video/x-msvideo			avi
+`
+
+// importTypes adds the mime-types of file, in the format of
+// mime.types, to configs. The file "builtin" is the builtin table,
+// and no file is SystemTypes if it exists and the builtin table if
+// not.
+func importTypes(configs Config, file string) error {
+	switch file {
+	case "":
+		if _, err := os.Stat(SystemTypes); err != nil {
+			return parseTypes(configs, strings.NewReader(builtinTypes), "builtin")
+		}
+		file = SystemTypes
+	case "builtin":
+		return parseTypes(configs, strings.NewReader(builtinTypes), file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return parseTypes(configs, f, file)
+}
+
+// parseTypes adds the mime-types read from r to configs. Each line
+// is a mime-type followed by its extensions, without dots; blank
+// lines, lines without extensions and comments, which start with #,
+// are skipped. Extensions listed again take the later mime-type.
+func parseTypes(configs Config, r io.Reader, name string) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			continue
+		}
+		if !strings.Contains(fields[0], "/") {
+			return fmt.Errorf("%s:%d: invalid mime-type %q", name, line, fields[0])
+		}
+		for _, ext := range fields[1:] {
+			configs["."+strings.TrimPrefix(ext, ".")] = fields[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package mime
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseTypes(t *testing.T) {
+	configs := Config{}
+	err := parseTypes(configs, strings.NewReader(`# mime.types
+text/html	html htm
+application/x-empty
+image/jpeg	jpeg jpg  # photos
+text/x-jpeg	jpg
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{".html": "text/html", ".htm": "text/html", ".jpeg": "image/jpeg", ".jpg": "text/x-jpeg"}
+	if len(configs) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, configs)
+	}
+	for ext, contentType := range expected {
+		if configs[ext] != contentType {
+			t.Errorf("Expected %s to be %s, got %q", ext, contentType, configs[ext])
+		}
+	}
+
+	if err := parseTypes(Config{}, strings.NewReader("html text/html\n"), "test"); err == nil {
+		t.Error("Expected an error for an invalid mime-type")
+	}
+}
+
+func TestImportTypes(t *testing.T) {
+	configs := Config{}
+	if err := importTypes(configs, "builtin"); err != nil {
+		t.Fatal(err)
+	}
+	if configs[".css"] != "text/css" || configs[".woff2"] != "font/woff2" {
+		t.Errorf("Expected the builtin table, got %v", configs)
+	}
+
+	f, err := ioutil.TempFile("", "caddy_mime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("text/x-custom custom\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	configs = Config{}
+	if err := importTypes(configs, f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[".custom"] != "text/x-custom" {
+		t.Errorf("Expected the types of the file, got %v", configs)
+	}
+
+	if err := importTypes(Config{}, "/nonexistent/mime.types"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
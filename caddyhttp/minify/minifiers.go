@@ -0,0 +1,480 @@
+package minify
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// The minifiers here are conservative: they only remove what
+// cannot change the meaning of a document, such as comments and
+// insignificant whitespace, and leave what they don't understand,
+// such as unterminated strings, as it is.
+
+// minifyJSON removes the insignificant whitespace of JSON. Invalid
+// JSON is left as it is.
+func minifyJSON(src []byte) []byte {
+	var out bytes.Buffer
+	if err := json.Compact(&out, src); err != nil {
+		return src
+	}
+	return out.Bytes()
+}
+
+// minifyCSS removes the comments of CSS, collapses whitespace and
+// removes it around braces, semicolons, commas and child combinators,
+// and around the colons of declarations, along with the last
+// semicolons of blocks.
+func minifyCSS(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	var blocks []bool // whether each open block holds declarations
+	preludeStart := 0
+	space := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+			space = true
+		case isSpace(c):
+			space = true
+		default:
+			inDecl := len(blocks) > 0 && blocks[len(blocks)-1]
+			punct := "{};,>"
+			if inDecl {
+				punct += ":"
+			}
+			if space && len(out) > 0 && !strings.ContainsRune(punct+":", rune(out[len(out)-1])) && !strings.ContainsRune(punct, rune(c)) {
+				out = append(out, ' ')
+			}
+			space = false
+			switch c {
+			case '"', '\'':
+				end := endOfString(src, i)
+				out = append(out, src[i:end]...)
+				i = end - 1
+				continue
+			case '{':
+				blocks = append(blocks, !isGroupRule(out[preludeStart:]))
+			case '}':
+				if len(out) > 0 && out[len(out)-1] == ';' {
+					out = out[:len(out)-1]
+				}
+				if len(blocks) > 0 {
+					blocks = blocks[:len(blocks)-1]
+				}
+			}
+			out = append(out, c)
+			if c == '{' || c == '}' || c == ';' {
+				preludeStart = len(out)
+			}
+		}
+	}
+	return out
+}
+
+// isGroupRule returns whether the prelude of a block is that of an
+// at-rule whose block holds rules rather than declarations.
+func isGroupRule(prelude []byte) bool {
+	for _, rule := range []string{"@media", "@supports", "@document", "@layer", "@container", "@scope"} {
+		if bytes.HasPrefix(prelude, []byte(rule)) {
+			return true
+		}
+	}
+	return false
+}
+
+// endOfString returns the index after the end of the string quoted
+// at src[start], or len(src) if it doesn't end.
+func endOfString(src []byte, start int) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// isSpace returns whether c is whitespace.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// minifyJS removes the comments and the insignificant whitespace of
+// JavaScript. Line breaks are kept where automatic semicolon
+// insertion might depend on them.
+func minifyJS(src []byte) []byte {
+	m := &jsMinifier{src: src, out: make([]byte, 0, len(src))}
+	m.code(false)
+	return m.out
+}
+
+// jsMinifier minifies JavaScript.
+type jsMinifier struct {
+	src []byte
+	i   int
+	out []byte
+}
+
+// code minifies code until the end of src or, if inTemplate, the
+// brace that closes a substitution of a template literal.
+func (m *jsMinifier) code(inTemplate bool) {
+	depth := 0
+	for m.i < len(m.src) {
+		c := m.src[m.i]
+		switch {
+		case isSpace(c):
+			m.whitespace()
+			continue
+		case c == '/' && m.peek(1) == '/':
+			for m.i < len(m.src) && m.src[m.i] != '\n' {
+				m.i++
+			}
+			continue
+		case c == '/' && m.peek(1) == '*':
+			end := bytes.Index(m.src[m.i+2:], []byte("*/"))
+			if end < 0 {
+				m.i = len(m.src)
+				return
+			}
+			comment := m.src[m.i : m.i+end+4]
+			m.i += end + 4
+			if bytes.IndexByte(comment, '\n') >= 0 {
+				m.newline()
+			} else {
+				m.space()
+			}
+			continue
+		case c == '"' || c == '\'':
+			end := endOfString(m.src, m.i)
+			m.out = append(m.out, m.src[m.i:end]...)
+			m.i = end
+			continue
+		case c == '`':
+			m.template()
+			continue
+		case c == '/' && m.regexAllowed():
+			m.regex()
+			continue
+		case c == '{':
+			depth++
+		case c == '}':
+			if inTemplate && depth == 0 {
+				return
+			}
+			depth--
+		}
+		m.out = append(m.out, c)
+		m.i++
+	}
+}
+
+// template copies a template literal, minifying the code of its
+// substitutions.
+func (m *jsMinifier) template() {
+	m.out = append(m.out, '`')
+	m.i++
+	for m.i < len(m.src) {
+		c := m.src[m.i]
+		switch {
+		case c == '\\':
+			m.out = append(m.out, m.src[m.i:min(m.i+2, len(m.src))]...)
+			m.i += 2
+		case c == '`':
+			m.out = append(m.out, c)
+			m.i++
+			return
+		case c == '$' && m.peek(1) == '{':
+			m.out = append(m.out, "${"...)
+			m.i += 2
+			m.code(true)
+			if m.i < len(m.src) {
+				m.out = append(m.out, '}')
+				m.i++
+			}
+		default:
+			m.out = append(m.out, c)
+			m.i++
+		}
+	}
+}
+
+// regex copies a regular expression literal.
+func (m *jsMinifier) regex() {
+	start := m.i
+	inClass := false
+	for m.i++; m.i < len(m.src); m.i++ {
+		c := m.src[m.i]
+		if c == '\\' {
+			m.i++
+		} else if c == '\n' {
+			break
+		} else if c == '[' {
+			inClass = true
+		} else if c == ']' {
+			inClass = false
+		} else if c == '/' && !inClass {
+			m.i++
+			break
+		}
+	}
+	for m.i < len(m.src) && isIdent(m.src[m.i]) {
+		m.i++ // flags
+	}
+	m.out = append(m.out, m.src[start:min(m.i, len(m.src))]...)
+}
+
+// regexAllowed returns whether a slash at this point starts a
+// regular expression rather than being a division.
+func (m *jsMinifier) regexAllowed() bool {
+	j := len(m.out) - 1
+	for j >= 0 && isSpace(m.out[j]) {
+		j--
+	}
+	if j < 0 || strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", rune(m.out[j])) {
+		return true
+	}
+	end := j + 1
+	for j >= 0 && isIdent(m.out[j]) {
+		j--
+	}
+	switch string(m.out[j+1 : end]) {
+	case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else", "yield", "await":
+		return true
+	}
+	return false
+}
+
+// whitespace replaces whitespace with a line break, if it has one,
+// or a space, where one is needed.
+func (m *jsMinifier) whitespace() {
+	newline := false
+	for m.i < len(m.src) && isSpace(m.src[m.i]) {
+		if m.src[m.i] == '\n' {
+			newline = true
+		}
+		m.i++
+	}
+	if newline {
+		m.newline()
+	} else {
+		m.space()
+	}
+}
+
+// newline adds a line break, unless the code before it is
+// unfinished so that no semicolon can be inserted there.
+func (m *jsMinifier) newline() {
+	if len(m.out) == 0 {
+		return
+	}
+	switch m.out[len(m.out)-1] {
+	case '\n', '{', ';', ',', '(', '[', '=', ':', '?':
+		return
+	}
+	m.out = append(m.out, '\n')
+}
+
+// space adds a space if the code before and after it would run
+// together without it.
+func (m *jsMinifier) space() {
+	if len(m.out) == 0 || m.i >= len(m.src) {
+		return
+	}
+	prev, next := m.out[len(m.out)-1], m.src[m.i]
+	if (isIdent(prev) && isIdent(next)) || (prev == next && (prev == '+' || prev == '-')) ||
+		(prev == '/' && next == '/') {
+		m.out = append(m.out, ' ')
+	}
+}
+
+// peek returns the byte n after the current one, or 0.
+func (m *jsMinifier) peek(n int) byte {
+	if m.i+n < len(m.src) {
+		return m.src[m.i+n]
+	}
+	return 0
+}
+
+// isIdent returns whether c may be part of an identifier or number.
+func isIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '$' || c == '\\' || c >= 0x80
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// minifyHTML removes the comments of HTML, other than conditional
+// comments, and collapses whitespace, except in pre and textarea
+// elements. The contents of style elements and of script elements
+// of JavaScript are minified as such.
+func minifyHTML(src []byte) []byte {
+	return minifyMarkup(src, true)
+}
+
+// minifySVG removes the comments of SVG, collapses whitespace and
+// removes it between tags.
+func minifySVG(src []byte) []byte {
+	return minifyMarkup(src, false)
+}
+
+// minifyMarkup minifies HTML or, if not html, XML.
+func minifyMarkup(src []byte, html bool) []byte {
+	out := make([]byte, 0, len(src))
+	lower := asciiLower(src)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				return append(out, src[i:]...)
+			}
+			comment := src[i : i+end+7]
+			if html && bytes.HasPrefix(comment, []byte("<!--[if")) {
+				out = append(out, comment...)
+			}
+			i += len(comment)
+		case bytes.HasPrefix(src[i:], []byte("<![CDATA[")):
+			end := bytes.Index(src[i:], []byte("]]>"))
+			if end < 0 {
+				return append(out, src[i:]...)
+			}
+			out = append(out, src[i:i+end+3]...)
+			i += end + 3
+		case c == '<':
+			end := endOfTag(src, i)
+			tag := collapseTag(src[i:end])
+			out = append(out, tag...)
+			i = end
+			if !html {
+				continue
+			}
+			name := tagName(tag)
+			switch name {
+			case "script", "style", "pre", "textarea":
+				closeAt := bytes.Index(lower[i:], []byte("</"+name))
+				if closeAt < 0 {
+					closeAt = len(src) - i
+				}
+				content := src[i : i+closeAt]
+				switch {
+				case name == "style":
+					content = minifyCSS(content)
+				case name == "script" && isJavaScript(tag):
+					content = minifyJS(content)
+				}
+				out = append(out, content...)
+				i += closeAt
+			}
+		case isSpace(c):
+			j := i
+			for j < len(src) && isSpace(src[j]) {
+				j++
+			}
+			atEdge := len(out) == 0 || j == len(src)
+			if !atEdge && out[len(out)-1] != ' ' && (html || out[len(out)-1] != '>' || src[j] != '<') {
+				out = append(out, ' ')
+			}
+			i = j
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out
+}
+
+// endOfTag returns the index after the end of the tag that starts
+// at src[start].
+func endOfTag(src []byte, start int) int {
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '"', '\'':
+			i = endOfString(src, i) - 1
+		case '>':
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// collapseTag collapses the whitespace of tag outside of quoted
+// attribute values, and removes it before the end of the tag.
+func collapseTag(tag []byte) []byte {
+	out := make([]byte, 0, len(tag))
+	space := false
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		switch {
+		case isSpace(c):
+			space = true
+		case c == '"' || c == '\'':
+			if space {
+				out = append(out, ' ')
+				space = false
+			}
+			end := endOfString(tag, i)
+			out = append(out, tag[i:end]...)
+			i = end - 1
+		default:
+			if space && c != '>' && !(c == '/' && i+1 < len(tag) && tag[i+1] == '>') {
+				out = append(out, ' ')
+			}
+			space = false
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// tagName returns the lower-case name of an opening tag, or "" if
+// tag isn't one.
+func tagName(tag []byte) string {
+	if len(tag) < 2 || !isIdent(tag[1]) {
+		return ""
+	}
+	end := 1
+	for end < len(tag) && (isIdent(tag[end]) || tag[end] == '-') {
+		end++
+	}
+	return strings.ToLower(string(tag[1:end]))
+}
+
+// isJavaScript returns whether the script element that starts with
+// tag contains JavaScript.
+func isJavaScript(tag []byte) bool {
+	lower := string(asciiLower(tag))
+	i := strings.Index(lower, " type=")
+	if i < 0 {
+		return true
+	}
+	t := strings.Trim(strings.Fields(lower[i+len(" type="):] + " ")[0], `"'>/`)
+	return t == "" || t == "module" || strings.Contains(t, "javascript") || strings.Contains(t, "ecmascript")
+}
+
+// asciiLower returns a copy of s with ASCII letters in lower case,
+// so that indexes into it are indexes into s.
+func asciiLower(s []byte) []byte {
+	lower := make([]byte, len(s))
+	for i, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return lower
+}
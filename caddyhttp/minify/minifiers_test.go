@@ -0,0 +1,45 @@
+package minify
+
+import "testing"
+
+func TestMinifiers(t *testing.T) {
+	for i, test := range []struct {
+		minify func([]byte) []byte
+		input  string
+		expect string
+	}{
+		// CSS
+		{minifyCSS, "a  >  b , c {\n  color : red ;\n  margin: 0  auto;\n}\n", "a>b,c{color:red;margin:0 auto}"},
+		{minifyCSS, "/* comment */ a :hover { content: \"a  /* b */  c\"; }", `a :hover{content:"a  /* b */  c"}`},
+		{minifyCSS, "@media screen and (max-width: 10px) {\n  p { width: calc(1px + 2px) }\n}", "@media screen and (max-width:10px){p{width:calc(1px + 2px)}}"},
+
+		// JavaScript
+		{minifyJS, "// comment\nvar a = 1;\n\n  var b = a + +1; /* c */\n", "var a=1;var b=a+ +1;"},
+		{minifyJS, "var s = 'a  // b', t = \"c /* d */\";", `var s='a  // b',t="c /* d */";`},
+		{minifyJS, "var re = /[/]  \\/ x/g, d = a / b / c;", `var re=/[/]  \/ x/g,d=a/b/c;`},
+		{minifyJS, "return /  re/.test(x)", "return/  re/.test(x)"},
+		{minifyJS, "a = b\nc()\nx = {}\ny", "a=b\nc()\nx={}\ny"},
+		{minifyJS, "var t = `a  ${ f( `b  ${ c }` ) }  // d`;", "var t=`a  ${f(`b  ${c}`)}  // d`;"},
+		{minifyJS, "if (a) {\n  return\n  b\n}", "if(a){return\nb\n}"},
+
+		// JSON
+		{minifyJSON, "{\n  \"a\": [1, 2],\n  \"b\": \"c  d\"\n}\n", `{"a":[1,2],"b":"c  d"}`},
+		{minifyJSON, "{invalid  json", "{invalid  json"},
+
+		// HTML
+		{minifyHTML, "<!DOCTYPE html>\n<html>\n  <!-- comment -->\n  <p class=\"a  b\"   id=x >Some   <b>bold</b>  text</p>\n</html>\n",
+			"<!DOCTYPE html> <html> <p class=\"a  b\" id=x>Some <b>bold</b> text</p> </html>"},
+		{minifyHTML, "<pre>  keep\n  this </pre>  <TEXTAREA>  and  this</TEXTAREA>", "<pre>  keep\n  this </pre> <TEXTAREA>  and  this</TEXTAREA>"},
+		{minifyHTML, "<style>\n  p { color: red; }\n</style><script>\n  // c\n  var a = 1;\n</script>", "<style>p{color:red}</style><script>var a=1;</script>"},
+		{minifyHTML, "<script type=\"text/template\">  <b>  x </b>  </script>", "<script type=\"text/template\">  <b>  x </b>  </script>"},
+		{minifyHTML, "<!--[if IE]><p>IE</p><![endif]--><br />", "<!--[if IE]><p>IE</p><![endif]--><br/>"},
+
+		// SVG
+		{minifySVG, "<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <!-- c -->\n  <text x=\"0\">Hello   world</text>\n</svg>\n",
+			"<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\"><text x=\"0\">Hello world</text></svg>"},
+	} {
+		if got := string(test.minify([]byte(test.input))); got != test.expect {
+			t.Errorf("Test %d: expected\n%q\ngot\n%q", i, test.expect, got)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Package minify implements middleware that minifies HTML, CSS,
+// JavaScript, JSON and SVG responses.
+package minify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Minify is middleware that minifies responses.
+type Minify struct {
+	Next httpserver.Handler
+
+	// Paths are the paths whose responses are minified, and
+	// Except those of them whose responses aren't.
+	Paths  []string
+	Except []string
+
+	// Kinds are the kinds of responses minified: some of html,
+	// css, js, json and svg.
+	Kinds map[string]bool
+
+	// MaxSize is the size of the largest response minified; 0
+	// for no limit.
+	MaxSize int64
+
+	// CacheDir, if set, is where minified files of Root are kept,
+	// until the files change.
+	CacheDir string
+	Root     string
+
+	// FileSys is the file system of the site, in place of Root,
+	// if it isn't a directory on disk, such as an archive.
+	FileSys http.FileSystem
+
+	BufPool *sync.Pool
+}
+
+// minifiers are the minifiers of the kinds of responses.
+var minifiers = map[string]func([]byte) []byte{
+	"html": minifyHTML,
+	"css":  minifyCSS,
+	"js":   minifyJS,
+	"json": minifyJSON,
+	"svg":  minifySVG,
+}
+
+// kindOf returns the kind of responses of contentType, or "".
+func kindOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "text/html":
+		return "html"
+	case mediaType == "text/css":
+		return "css"
+	case mediaType == "application/javascript", mediaType == "text/javascript",
+		mediaType == "application/x-javascript", mediaType == "application/ecmascript":
+		return "js"
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "image/svg+xml":
+		return "svg"
+	}
+	return ""
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (m Minify) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !m.matches(r.URL.Path) {
+		return m.Next.ServeHTTP(w, r)
+	}
+
+	buf := m.BufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer m.BufPool.Put(buf)
+
+	shouldBuf := func(status int, header http.Header) bool {
+		if !m.minifies(status, header) {
+			return false
+		}
+		if r.Method == http.MethodHead {
+			// the length of the minified body isn't known
+			header.Del("Content-Length")
+			return false
+		}
+		return true
+	}
+	rb := &cappedBuffer{
+		ResponseBuffer: httpserver.NewResponseBuffer(buf, w, shouldBuf),
+		max:            m.MaxSize,
+		status:         http.StatusOK,
+	}
+	code, err := m.Next.ServeHTTP(rb, r)
+	if !rb.Buffered() || rb.passed || code >= 300 || err != nil {
+		return code, err
+	}
+
+	body := rb.Buffer.Bytes()
+	status := code
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if m.minifies(status, rb.Header()) {
+		body = m.minify(r, kindOf(rb.Header().Get("Content-Type")), body)
+		if etag := rb.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			// the minified response is equivalent to,
+			// but not the same as, the original
+			rb.Header().Set("ETag", "W/"+etag)
+		}
+	}
+
+	rb.CopyHeader()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+	return 0, nil
+}
+
+// matches returns whether responses for urlPath are minified.
+func (m Minify) matches(urlPath string) bool {
+	for _, p := range m.Except {
+		if httpserver.Path(urlPath).Matches(p) {
+			return false
+		}
+	}
+	for _, p := range m.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// minifies returns whether a response with status and header is
+// minified, as far as is known before its body.
+func (m Minify) minifies(status int, header http.Header) bool {
+	if status != http.StatusOK || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if !m.Kinds[kindOf(header.Get("Content-Type"))] {
+		return false
+	}
+	if m.MaxSize > 0 {
+		if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && length > m.MaxSize {
+			return false
+		}
+	}
+	return true
+}
+
+// minify returns body, of kind, minified. Files of Root are taken
+// from and added to the cache, if there is one, by the checksum of
+// what they were minified from, so that only responses that are the
+// same get them.
+func (m Minify) minify(r *http.Request, kind string, body []byte) []byte {
+	if m.CacheDir == "" || m.Root == "" {
+		return minifiers[kind](body)
+	}
+	sum := sha256.Sum256([]byte(m.Root + "\x00" + r.URL.Path))
+	cacheFile := filepath.Join(m.CacheDir, hex.EncodeToString(sum[:])+"."+kind)
+	bodySum := sha256.Sum256(body)
+	if cached, err := ioutil.ReadFile(cacheFile); err == nil && bytes.HasPrefix(cached, bodySum[:]) {
+		return cached[len(bodySum):]
+	}
+
+	out := minifiers[kind](body)
+	if !m.isFile(r.URL.Path, body) {
+		// a response made for the path, or from the file, which
+		// would fill the cache
+		return out
+	}
+	if err := writeCacheFile(cacheFile, append(bodySum[:], out...)); err != nil {
+		log.Printf("[ERROR] minify: caching %s: %v", r.URL.Path, err)
+	}
+	return out
+}
+
+// isFile returns whether body is the content of the file of the site
+// at urlPath.
+func (m Minify) isFile(urlPath string, body []byte) bool {
+	var f http.File
+	var err error
+	if m.FileSys == nil {
+		f, err = os.Open(httpserver.SafePath(m.Root, urlPath))
+	} else {
+		f, err = m.FileSys.Open(urlPath)
+	}
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != int64(len(body)) {
+		return false
+	}
+	content, err := ioutil.ReadAll(f)
+	return err == nil && bytes.Equal(content, body)
+}
+
+// cappedBuffer is a ResponseBuffer that stops buffering a response
+// once it is larger than max, if max isn't 0, and writes what it has
+// buffered and the rest of the response as they are.
+type cappedBuffer struct {
+	*httpserver.ResponseBuffer
+	max    int64
+	status int
+	passed bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (cb *cappedBuffer) WriteHeader(status int) {
+	cb.status = status
+	cb.ResponseBuffer.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (cb *cappedBuffer) Write(p []byte) (int, error) {
+	if cb.passed {
+		return cb.ResponseWriterWrapper.Write(p)
+	}
+	if !cb.Buffered() || cb.max == 0 || int64(cb.Buffer.Len()+len(p)) <= cb.max {
+		return cb.ResponseBuffer.Write(p)
+	}
+	cb.passed = true
+	cb.CopyHeader()
+	cb.ResponseWriterWrapper.WriteHeader(cb.status)
+	if _, err := cb.ResponseWriterWrapper.Write(cb.Buffer.Bytes()); err != nil {
+		return 0, err
+	}
+	return cb.ResponseWriterWrapper.Write(p)
+}
+
+// ReadFrom implements io.ReaderFrom, so that the response is capped
+// when it is copied too.
+func (cb *cappedBuffer) ReadFrom(src io.Reader) (int64, error) {
+	if !cb.Buffered() {
+		return cb.ResponseBuffer.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{cb}, src)
+}
+
+// writeCacheFile atomically writes data to name.
+func writeCacheFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,217 @@
+package minify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func newMinify(root string) Minify {
+	return Minify{
+		Next:    staticfiles.FileServer{Root: http.Dir(root)},
+		Paths:   []string{"/"},
+		Except:  []string{"/raw"},
+		Kinds:   map[string]bool{"html": true, "css": true, "js": true, "json": true},
+		MaxSize: 100,
+		Root:    root,
+		BufPool: &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
+	}
+}
+
+func TestMinify(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_minify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "raw"), 0755)
+	for name, body := range map[string]string{
+		"style.css":     "p {\n  color: red;\n}\n",
+		"raw/style.css": "p {\n  color: red;\n}\n",
+		"big.css":       "p {\n  color: red;\n}\n" + strings.Repeat(" ", 100),
+		"data.json":     "{ \"a\": 1 }",
+		"image.svg":     "<svg>  </svg>",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := newMinify(root)
+
+	for i, test := range []struct {
+		method, path string
+		expectBody   string
+	}{
+		{"GET", "/style.css", "p{color:red}"},
+		{"GET", "/data.json", `{"a":1}`},
+		{"GET", "/raw/style.css", "p {\n  color: red;\n}\n"},
+		{"GET", "/big.css", "p {\n  color: red;\n}\n" + strings.Repeat(" ", 100)},
+		{"GET", "/image.svg", "<svg>  </svg>"},
+		{"HEAD", "/style.css", ""},
+	} {
+		rec := httptest.NewRecorder()
+		if _, err := m.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil)); err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if rec.Body.String() != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, rec.Body.String())
+		}
+		if test.method == "GET" && rec.Header().Get("Content-Length") != strconv.Itoa(len(test.expectBody)) {
+			t.Errorf("Test %d: expected Content-Length %d, got %s", i, len(test.expectBody), rec.Header().Get("Content-Length"))
+		}
+		if test.method == "HEAD" && rec.Header().Get("Content-Length") != "" {
+			t.Errorf("Test %d: expected no Content-Length, got %s", i, rec.Header().Get("Content-Length"))
+		}
+	}
+
+	// a 404 is passed on
+	code, _ := m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing.css", nil))
+	if code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing file, got %d", code)
+	}
+}
+
+func TestMinifyDynamic(t *testing.T) {
+	m := newMinify("")
+	m.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("<p>\n  Hello  </p>\n"))
+		return 0, nil
+	})
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/page", nil))
+	if rec.Body.String() != "<p> Hello </p>" {
+		t.Errorf("Expected the response to be minified, got %q", rec.Body.String())
+	}
+	if etag := rec.Header().Get("ETag"); etag != `W/"abc"` {
+		t.Errorf("Expected a weak ETag, got %s", etag)
+	}
+}
+
+func TestMinifyLargeDynamic(t *testing.T) {
+	m := newMinify("")
+	body := strings.Repeat("<p>  Hello  </p>\n", 10)
+	rec := httptest.NewRecorder()
+	m.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		for rest := body; rest != ""; rest = rest[10:] {
+			w.Write([]byte(rest[:10]))
+		}
+		// no more than max_size of it is kept back
+		if rec.Body.Len() != len(body) {
+			t.Errorf("Expected the response to be written as it comes, got %d bytes of it", rec.Body.Len())
+		}
+		return 0, nil
+	})
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/page", nil))
+	if rec.Body.String() != body {
+		t.Errorf("Expected the response larger than max_size to be passed on as it is, got %q", rec.Body.String())
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestMinifyCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_minify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, "app.js")
+	write := func(body string, mod time.Time) {
+		if err := ioutil.WriteFile(file, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := newMinify(root)
+	m.CacheDir = filepath.Join(root, "cache")
+	get := func() string {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", "/app.js", nil))
+		return rec.Body.String()
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("var  a = 1;\n", start)
+	if got := get(); got != "var a=1;" {
+		t.Fatalf("Expected the script to be minified, got %q", got)
+	}
+	entries, _ := ioutil.ReadDir(m.CacheDir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 cached file, got %d", len(entries))
+	}
+
+	// the cached file is served while the file is unchanged
+	cached := filepath.Join(m.CacheDir, entries[0].Name())
+	sum := sha256.Sum256([]byte("var  a = 1;\n"))
+	ioutil.WriteFile(cached, append(sum[:], "var cached;"...), 0644)
+	if got := get(); got != "var cached;" {
+		t.Errorf("Expected the cached file, got %q", got)
+	}
+
+	// but not for other responses for the path, which aren't cached
+	next := m.Next
+	m.Next = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte("var  c = 3;\n"))
+		return 0, nil
+	})
+	if got := get(); got != "var c=3;" {
+		t.Errorf("Expected the response to be minified, got %q", got)
+	}
+	m.Next = next
+	if got := get(); got != "var cached;" {
+		t.Errorf("Expected the cached file to be kept, got %q", got)
+	}
+
+	// and replaced when it changes
+	write("var  b = 2;\n", start.Add(time.Minute))
+	if got := get(); got != "var b=2;" {
+		t.Errorf("Expected the changed script to be minified, got %q", got)
+	}
+	if entries, _ := ioutil.ReadDir(m.CacheDir); len(entries) != 1 {
+		t.Errorf("Expected the cached file to be replaced, got %d files", len(entries))
+	}
+}
+
+func TestMinifyCacheFileSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_minify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("var  a = 1;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the root of a site served from an archive isn't a directory
+	m := newMinify(filepath.Join(dir, "site.zip"))
+	m.FileSys = http.Dir(dir)
+	m.Next = staticfiles.FileServer{Root: m.FileSys}
+	m.CacheDir = filepath.Join(dir, "cache")
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/app.js", nil))
+	if got := rec.Body.String(); got != "var a=1;" {
+		t.Fatalf("Expected the script to be minified, got %q", got)
+	}
+	if entries, _ := ioutil.ReadDir(m.CacheDir); len(entries) != 1 {
+		t.Errorf("Expected the file of the file system to be cached, got %d files", len(entries))
+	}
+}
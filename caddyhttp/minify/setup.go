@@ -0,0 +1,127 @@
+package minify
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("minify", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultMaxSize is the size of the largest response minified,
+// unless configured.
+const defaultMaxSize = 1 << 20
+
+// setup configures a new Minify middleware instance.
+func setup(c *caddy.Controller) error {
+	m, err := minifyParse(c)
+	if err != nil {
+		return err
+	}
+
+	if m.CacheDir != "" {
+		// files are minified once listening, also in a sandbox
+		caddy.RegisterWritableDir(m.CacheDir)
+	}
+
+	cfg := httpserver.GetConfig(c)
+	m.Root, m.FileSys = cfg.Root, cfg.RootFS
+	m.BufPool = &sync.Pool{
+		New: func() interface{} {
+			return new(bytes.Buffer)
+		},
+	}
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		m.Next = next
+		return m
+	})
+
+	return nil
+}
+
+// minifyParse parses
+//
+//	minify [paths...] {
+//		types kinds...
+//		max_size size
+//		cache dir
+//		except paths...
+//	}
+//
+// where kinds are some of html, css, js, json and svg, all by
+// default, and a max_size of 0 means no limit.
+func minifyParse(c *caddy.Controller) (Minify, error) {
+	m := Minify{MaxSize: defaultMaxSize}
+
+	for c.Next() {
+		m.Paths = append(m.Paths, c.RemainingArgs()...)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "types":
+				kinds := c.RemainingArgs()
+				if len(kinds) == 0 {
+					return m, c.ArgErr()
+				}
+				m.Kinds = make(map[string]bool)
+				for _, kind := range kinds {
+					if _, ok := minifiers[kind]; !ok {
+						return m, c.Errf("Unknown minify type '%s'", kind)
+					}
+					m.Kinds[kind] = true
+				}
+			case "max_size":
+				if !c.NextArg() {
+					return m, c.ArgErr()
+				}
+				if c.Val() == "0" {
+					m.MaxSize = 0
+				} else {
+					size, err := humanize.ParseBytes(c.Val())
+					if err != nil {
+						return m, c.Errf("Invalid minify max_size '%s'", c.Val())
+					}
+					m.MaxSize = int64(size)
+				}
+				if c.NextArg() {
+					return m, c.ArgErr()
+				}
+			case "cache":
+				if !c.NextArg() {
+					return m, c.ArgErr()
+				}
+				m.CacheDir = c.Val()
+				if c.NextArg() {
+					return m, c.ArgErr()
+				}
+			case "except":
+				paths := c.RemainingArgs()
+				if len(paths) == 0 {
+					return m, c.ArgErr()
+				}
+				m.Except = append(m.Except, paths...)
+			default:
+				return m, c.Errf("Unknown minify property '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(m.Paths) == 0 {
+		m.Paths = []string{"/"}
+	}
+	if m.Kinds == nil {
+		m.Kinds = make(map[string]bool)
+		for kind := range minifiers {
+			m.Kinds[kind] = true
+		}
+	}
+	return m, nil
+}
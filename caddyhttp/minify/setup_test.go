@@ -0,0 +1,100 @@
+package minify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `minify`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Minify)
+	if !ok {
+		t.Fatalf("Expected handler to be type Minify, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if myHandler.BufPool == nil {
+		t.Error("Expected a buffer pool")
+	}
+}
+
+func TestMinifyParse(t *testing.T) {
+	all := map[string]bool{"html": true, "css": true, "js": true, "json": true, "svg": true}
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Minify
+	}{
+		{`minify`, false, Minify{Paths: []string{"/"}, Kinds: all, MaxSize: defaultMaxSize}},
+		{`minify /assets /blog {
+			types css js
+			max_size 512KB
+			cache /tmp/minified
+			except /assets/vendor
+		}`, false, Minify{
+			Paths:    []string{"/assets", "/blog"},
+			Except:   []string{"/assets/vendor"},
+			Kinds:    map[string]bool{"css": true, "js": true},
+			MaxSize:  512000,
+			CacheDir: "/tmp/minified",
+		}},
+		{`minify {
+			max_size 0
+		}`, false, Minify{Paths: []string{"/"}, Kinds: all}},
+		{`minify {
+			types xml
+		}`, true, Minify{}},
+		{`minify {
+			types
+		}`, true, Minify{}},
+		{`minify {
+			max_size big
+		}`, true, Minify{}},
+		{`minify {
+			cache
+		}`, true, Minify{}},
+		{`minify {
+			unknown
+		}`, true, Minify{}},
+	} {
+		actual, err := minifyParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestSetupRegistersCacheDir(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "caddy-minify-cache-test")
+	c := caddy.NewTestController("http", "minify {\n\tcache "+dir+"\n}")
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	if !caddy.Writable(filepath.Join(dir, "abc.css")) {
+		t.Errorf("Expected the cache folder %s to be writable once privileges are dropped", dir)
+	}
+}
@@ -0,0 +1,401 @@
+// Package oidc is middleware that requires users to log in with an
+// OpenID Connect provider before they can access a site, so that the
+// applications behind it get single sign-on without knowing about it.
+//
+// Users are sent to the provider with the authorization code flow,
+// protected with PKCE. Once they return, who they are is kept in their
+// session, and passed on to the applications in request headers, and
+// to other middleware, such as authorize, in the context of requests.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/sessions"
+)
+
+// Headers that tell applications who the user is, and the CSRF
+// token of their session. They are removed from every request, so
+// that clients can't set them.
+const (
+	userHeader   = "X-Forwarded-User"
+	emailHeader  = "X-Forwarded-Email"
+	groupsHeader = "X-Forwarded-Groups"
+	csrfHeader   = "X-Forwarded-Csrf-Token"
+)
+
+// loginTimeout is how long users have to log in with the
+// provider before they must start again.
+const loginTimeout = 10 * time.Minute
+
+// OIDC is middleware that authenticates users with OpenID Connect.
+type OIDC struct {
+	Next    httpserver.Handler
+	Configs []*Config
+}
+
+// Config is the configuration of the paths protected by a provider.
+type Config struct {
+	// Paths are protected; users must log in to access them.
+	Paths []string
+
+	// Issuer is the URL of the provider, from which its
+	// endpoints are discovered.
+	Issuer string
+
+	// ClientID and ClientSecret identify this site to the
+	// provider. The secret may be empty for public clients.
+	ClientID     string
+	ClientSecret string
+
+	// Scopes are requested from the provider; openid is
+	// always one of them.
+	Scopes []string
+
+	// CallbackPath is where the provider sends users back
+	// to, and LogoutPath ends their session.
+	CallbackPath string
+	LogoutPath   string
+
+	// CookieName is the name of the session cookie.
+	CookieName string
+
+	// SessionTTL is how long users stay logged in, and
+	// IdleTimeout, if not 0, how long they stay logged in
+	// without using the site.
+	SessionTTL  time.Duration
+	IdleTimeout time.Duration
+
+	// SessionStore, if not empty, is the URL of the store that
+	// sessions are kept in, such as redis://host:6379, rather
+	// than in their cookie.
+	SessionStore string
+
+	// CSRF is whether requests other than GET and HEAD must carry
+	// the CSRF token of the session, which is passed on to the
+	// applications in a request header.
+	CSRF bool
+
+	// UserClaim is the claim of the ID token that identifies
+	// the user to applications, and GroupsClaim the one that
+	// lists the groups or roles of the user. Nested claims are
+	// separated by dots, as in realm_access.roles.
+	UserClaim   string
+	GroupsClaim string
+
+	// Rules restrict paths to users in certain groups.
+	Rules []Rule
+
+	sessions *sessions.Manager
+	provider *provider
+}
+
+// Rule allows only users in one of Groups to access Path.
+type Rule struct {
+	Path   string
+	Groups []string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (o OIDC) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	r.Header.Del(userHeader)
+	r.Header.Del(emailHeader)
+	r.Header.Del(groupsHeader)
+	r.Header.Del(csrfHeader)
+
+	for _, c := range o.Configs {
+		switch {
+		case r.URL.Path == c.CallbackPath:
+			return c.callback(w, r)
+		case r.URL.Path == c.LogoutPath:
+			return c.logout(w, r)
+		case !c.protects(r.URL.Path):
+			continue
+		}
+
+		sess, err := c.sessions.Load(w, r)
+		if err == sessions.ErrNoSession {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				return http.StatusUnauthorized, nil
+			}
+			return c.login(w, r)
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		var s session
+		if err := sess.Decode(&s); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !c.allows(s, r.URL.Path) {
+			return http.StatusForbidden, nil
+		}
+		if c.CSRF {
+			if !sessions.ValidCSRF(r, sess) {
+				return http.StatusForbidden, nil
+			}
+			r.Header.Set(csrfHeader, sess.CSRF)
+		}
+
+		r.Header.Set(userHeader, s.User)
+		if s.Email != "" {
+			r.Header.Set(emailHeader, s.Email)
+		}
+		if len(s.Groups) > 0 {
+			r.Header.Set(groupsHeader, strings.Join(s.Groups, ","))
+		}
+		ctx := context.WithValue(sessions.NewContext(r.Context(), sess), httpserver.RemoteUserCtxKey, s.User)
+		if s.Claims != nil {
+			ctx = context.WithValue(ctx, httpserver.ClaimsCtxKey, s.Claims)
+		}
+		r = r.WithContext(ctx)
+		return o.Next.ServeHTTP(w, r)
+	}
+	return o.Next.ServeHTTP(w, r)
+}
+
+// protects returns whether users must log in to access urlPath.
+func (c *Config) protects(urlPath string) bool {
+	for _, p := range c.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns whether the user of s may access urlPath,
+// according to the rule with the longest matching path.
+func (c *Config) allows(s session, urlPath string) bool {
+	var rule *Rule
+	for i, r := range c.Rules {
+		if httpserver.Path(urlPath).Matches(r.Path) && (rule == nil || len(r.Path) > len(rule.Path)) {
+			rule = &c.Rules[i]
+		}
+	}
+	if rule == nil {
+		return true
+	}
+	for _, want := range rule.Groups {
+		for _, have := range s.Groups {
+			if want == have {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loginState is what is remembered of a login while the user
+// is at the provider.
+type loginState struct {
+	State    string
+	Verifier string // of PKCE
+	Nonce    string
+	Return   string // the URL the user asked for
+	Expires  time.Time
+}
+
+// stateCookie returns the name of the cookie that holds the
+// state of a login.
+func (c *Config) stateCookie() string {
+	return c.CookieName + "_login"
+}
+
+// login sends the user to the provider to log in.
+func (c *Config) login(w http.ResponseWriter, r *http.Request) (int, error) {
+	meta, err := c.provider.metadata()
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	ls := loginState{
+		State:    randomString(),
+		Verifier: randomString(),
+		Nonce:    randomString(),
+		Return:   r.URL.RequestURI(),
+		Expires:  time.Now().Add(loginTimeout),
+	}
+	value, err := c.sessions.Codec().Encode(c.stateCookie(), ls)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.stateCookie(),
+		Value:    value,
+		Path:     c.CallbackPath,
+		MaxAge:   int(loginTimeout / time.Second),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(ls.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.redirectURI(r)},
+		"scope":                 {strings.Join(c.Scopes, " ")},
+		"state":                 {ls.State},
+		"nonce":                 {ls.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, withQuery(meta.AuthorizationEndpoint, q), http.StatusFound)
+	return 0, nil
+}
+
+// callback completes a login when the provider sends the user
+// back, and starts the session.
+func (c *Config) callback(w http.ResponseWriter, r *http.Request) (int, error) {
+	var ls loginState
+	cookie, err := r.Cookie(c.stateCookie())
+	if err != nil || c.sessions.Codec().Decode(c.stateCookie(), cookie.Value, &ls) != nil ||
+		time.Now().After(ls.Expires) || r.URL.Query().Get("state") != ls.State {
+		return http.StatusBadRequest, nil
+	}
+	http.SetCookie(w, &http.Cookie{Name: c.stateCookie(), Path: c.CallbackPath, MaxAge: -1})
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		log.Printf("[ERROR] oidc: login failed: %s: %s", e, r.URL.Query().Get("error_description"))
+		return http.StatusForbidden, nil
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	rawIDToken, err := c.provider.exchange(code, ls.Verifier, c.redirectURI(r), c.ClientID, c.ClientSecret)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+	claims, err := c.provider.verify(rawIDToken, c.ClientID, ls.Nonce)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+
+	s := session{
+		User:   claimString(claims, c.UserClaim),
+		Email:  claimString(claims, "email"),
+		Groups: ClaimStrings(claims, c.GroupsClaim),
+		Claims: userClaims(claims),
+	}
+	if s.User == "" {
+		s.User = claimString(claims, "sub")
+	}
+	sess, err := c.sessions.New(claimString(claims, "sub"), s)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := c.sessions.Save(w, r, sess); err == sessions.ErrTooLarge {
+		return http.StatusInternalServerError, errSessionTooLarge
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// only ever return to a path on this site
+	target := ls.Return
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		target = "/"
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+	return 0, nil
+}
+
+// logout ends the session of the user, and, if the provider
+// supports it, the session at the provider too.
+func (c *Config) logout(w http.ResponseWriter, r *http.Request) (int, error) {
+	if err := c.sessions.End(w, r); err != nil {
+		log.Printf("[ERROR] oidc: ending session: %v", err)
+	}
+	target := "/"
+	if meta, err := c.provider.metadata(); err == nil && meta.EndSessionEndpoint != "" {
+		q := url.Values{"client_id": {c.ClientID}, "post_logout_redirect_uri": {c.siteURL(r) + "/"}}
+		target = withQuery(meta.EndSessionEndpoint, q)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+	return 0, nil
+}
+
+// withQuery returns endpoint with q added to the query it may
+// already have.
+func withQuery(endpoint string, q url.Values) string {
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + q.Encode()
+	}
+	return endpoint + "?" + q.Encode()
+}
+
+// siteURL returns the scheme and host of the site r was made to.
+func (c *Config) siteURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// redirectURI returns the URL the provider sends users back to.
+func (c *Config) redirectURI(r *http.Request) string {
+	return c.siteURL(r) + c.CallbackPath
+}
+
+// randomString returns a string of 32 random bytes, encoded to
+// be safe in URLs.
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// claim returns the claim at the dotted path name.
+func claim(claims map[string]interface{}, name string) interface{} {
+	var v interface{} = claims
+	for _, part := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	s, _ := claim(claims, name).(string)
+	return s
+}
+
+// ClaimStrings returns the claim at the dotted path name of claims as
+// a list of strings, whether it is a list of strings or a single
+// string, boolean or number, so that any claim can be compared to
+// strings, as by authorize policies.
+func ClaimStrings(claims map[string]interface{}, name string) []string {
+	switch v := claim(claims, name).(type) {
+	case string:
+		return []string{v}
+	case bool, float64:
+		return []string{fmt.Sprint(v)}
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
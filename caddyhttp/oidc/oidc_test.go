@@ -0,0 +1,334 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/sessions"
+	jose "gopkg.in/square/go-jose.v1"
+)
+
+// testProvider is an OpenID Connect provider that logs in
+// anyone who asks, issuing ID tokens with the claims set.
+type testProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	claims    map[string]interface{}
+	challenge string // of the last authorization request
+	nonce     string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(providerMetadata{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+			EndSessionEndpoint:    p.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JsonWebKeySet{Keys: []jose.JsonWebKey{
+			{Key: &key.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if id != "client" || secret != "secret" || r.FormValue("code") != "code" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "x", "id_token": p.sign(t, "k1", p.claims)})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+func (p *testProvider) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.RS256, &jose.JsonWebKey{Key: p.key, KeyID: kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(claims)
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func (p *testProvider) validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    p.URL,
+		"aud":    "client",
+		"sub":    "1234",
+		"email":  "user@example.com",
+		"nonce":  p.nonce,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"users", "ops"},
+	}
+}
+
+func TestOIDC(t *testing.T) {
+	p := newTestProvider(t)
+	defer p.Close()
+
+	manager, err := sessions.NewManager(defaultCookieName, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.AbsoluteTimeout = time.Hour
+	cfg := &Config{
+		Paths:        []string{"/app"},
+		Issuer:       p.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       defaultScopes,
+		CallbackPath: defaultCallbackPath,
+		LogoutPath:   defaultLogoutPath,
+		CookieName:   defaultCookieName,
+		SessionTTL:   time.Hour,
+		UserClaim:    defaultUserClaim,
+		GroupsClaim:  defaultGroupsClaim,
+		Rules: []Rule{
+			{Path: "/app/ops", Groups: []string{"ops"}},
+			{Path: "/app/admin", Groups: []string{"admins"}},
+		},
+		sessions: manager,
+		provider: newProvider(p.URL),
+	}
+	var seen *http.Request
+	o := OIDC{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			seen = r
+			return http.StatusOK, nil
+		}),
+		Configs: []*Config{cfg},
+	}
+	var csrfToken string // sent with the next request
+	serve := func(method, target string, cookies ...*http.Cookie) (*httptest.ResponseRecorder, int) {
+		seen = nil
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(userHeader, "spoofed")
+		if csrfToken != "" {
+			req.Header.Set(sessions.CSRFHeader, csrfToken)
+			csrfToken = ""
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		code, err := o.ServeHTTP(rec, req)
+		if err != nil {
+			t.Logf("%s %s: %v", method, target, err)
+		}
+		return rec, code
+	}
+	cookie := func(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("Expected cookie %s to be set", name)
+		return nil
+	}
+
+	// unprotected paths are served as they are, but the
+	// user headers can't be spoofed
+	if _, code := serve("GET", "/public"); code != http.StatusOK || seen.Header.Get(userHeader) != "" {
+		t.Errorf("Expected unprotected path to be served without user header, got %d", code)
+	}
+	if _, code := serve("POST", "/app/form"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for POST without a session, got %d", code)
+	}
+
+	// log in
+	rec, _ := serve("GET", "/app/page?x=1")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to the provider, got %d", rec.Code)
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(loc.String(), p.URL+"/authorize?") {
+		t.Fatalf("Expected redirect to the authorization endpoint, got %s", loc)
+	}
+	q := loc.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("redirect_uri") != "http://example.com/oauth2/callback" ||
+		q.Get("scope") != "openid email profile" || q.Get("client_id") != "client" {
+		t.Errorf("Unexpected authorization request: %v", q)
+	}
+	p.challenge, p.nonce = q.Get("code_challenge"), q.Get("nonce")
+	p.claims = p.validClaims()
+	stateCookie := cookie(rec, cfg.stateCookie())
+
+	if _, code := serve("GET", "/oauth2/callback?code=code&state=wrong", stateCookie); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for the wrong state, got %d", code)
+	}
+	if _, code := serve("GET", "/oauth2/callback?code=code&state="+q.Get("state")); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without the state cookie, got %d", code)
+	}
+	rec, _ = serve("GET", "/oauth2/callback?code=code&state="+q.Get("state"), stateCookie)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/app/page?x=1" {
+		t.Fatalf("Expected redirect back to the page, got %d to %s: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	sessionCookie := cookie(rec, defaultCookieName)
+	if !sessionCookie.HttpOnly {
+		t.Error("Expected session cookie to be HttpOnly")
+	}
+
+	// logged in
+	if _, code := serve("GET", "/app/page", sessionCookie); code != http.StatusOK {
+		t.Fatalf("Expected 200 with a session, got %d", code)
+	}
+	if seen.Header.Get(userHeader) != "user@example.com" || seen.Header.Get(groupsHeader) != "users,ops" {
+		t.Errorf("Expected user headers, got %v", seen.Header)
+	}
+	if user, _ := seen.Context().Value(httpserver.RemoteUserCtxKey).(string); user != "user@example.com" {
+		t.Errorf("Expected remote user in context, got %q", user)
+	}
+	claims, _ := seen.Context().Value(httpserver.ClaimsCtxKey).(map[string]interface{})
+	if claims["sub"] != "1234" || claims["nonce"] != nil {
+		t.Errorf("Expected user claims in context, got %v", claims)
+	}
+	if _, code := serve("GET", "/app/ops/x", sessionCookie); code != http.StatusOK {
+		t.Errorf("Expected 200 for a path the user's group may access, got %d", code)
+	}
+	if _, code := serve("GET", "/app/admin", sessionCookie); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a path the user's groups may not access, got %d", code)
+	}
+
+	// forged and foreign cookies are ignored
+	forged := &http.Cookie{Name: defaultCookieName, Value: sessionCookie.Value[:len(sessionCookie.Value)-2] + "AA"}
+	if rec, _ := serve("GET", "/app/page", forged); rec.Code != http.StatusFound {
+		t.Errorf("Expected forged cookie to be ignored, got %d", rec.Code)
+	}
+	foreign := &http.Cookie{Name: defaultCookieName, Value: stateCookie.Value}
+	if rec, _ := serve("GET", "/app/page", foreign); rec.Code != http.StatusFound {
+		t.Errorf("Expected state cookie not to be taken for a session, got %d", rec.Code)
+	}
+
+	// with CSRF protection, unsafe requests need the token of
+	// the session, which applications are given
+	cfg.CSRF = true
+	if _, code := serve("POST", "/app/form", sessionCookie); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for POST without the CSRF token, got %d", code)
+	}
+	serve("GET", "/app/page", sessionCookie)
+	csrfToken = seen.Header.Get(csrfHeader)
+	if s, ok := sessions.FromContext(seen.Context()); !ok || csrfToken == "" || csrfToken != s.CSRF {
+		t.Errorf("Expected the CSRF token of the session in a header, got %q", csrfToken)
+	}
+	if _, code := serve("POST", "/app/form", sessionCookie); code != http.StatusOK {
+		t.Errorf("Expected 200 for POST with the CSRF token, got %d", code)
+	}
+
+	// log out
+	rec, _ = serve("GET", "/oauth2/logout", sessionCookie)
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), p.URL+"/logout?") {
+		t.Errorf("Expected redirect to the provider to log out, got %d to %s", rec.Code, rec.Header().Get("Location"))
+	}
+	if c := cookie(rec, defaultCookieName); c.MaxAge >= 0 {
+		t.Error("Expected session cookie to be removed")
+	}
+	if rec, _ := serve("GET", "/app/page", sessionCookie); rec.Code != http.StatusFound {
+		t.Errorf("Expected session to be revoked on logout, got %d", rec.Code)
+	}
+}
+
+func TestWithQuery(t *testing.T) {
+	q := url.Values{"client_id": {"client"}}
+	for i, test := range []struct {
+		endpoint, expect string
+	}{
+		{"https://idp/logout", "https://idp/logout?client_id=client"},
+		{"https://idp/logout?tenant=a", "https://idp/logout?tenant=a&client_id=client"},
+	} {
+		if actual := withQuery(test.endpoint, q); actual != test.expect {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expect, actual)
+		}
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p := newTestProvider(t)
+	defer p.Close()
+	p.nonce = "nonce"
+	prov := newProvider(p.URL)
+
+	for i, test := range []struct {
+		kid       string
+		change    func(map[string]interface{})
+		shouldErr bool
+	}{
+		{"k1", func(map[string]interface{}) {}, false},
+		{"k1", func(c map[string]interface{}) { c["aud"] = []string{"other", "client"} }, false},
+		{"k1", func(c map[string]interface{}) { c["aud"] = "other" }, true},
+		{"k1", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, true},
+		{"k1", func(c map[string]interface{}) { c["nonce"] = "other" }, true},
+		{"k1", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, true},
+		{"k1", func(c map[string]interface{}) { delete(c, "exp") }, true},
+		{"k2", func(map[string]interface{}) {}, true},
+	} {
+		claims := p.validClaims()
+		test.change(claims)
+		_, err := prov.verify(p.sign(t, test.kid, claims), "client", "nonce")
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d: expected an error", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+	}
+
+	// a token signed with another key fails
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.key = other
+	if _, err := prov.verify(p.sign(t, "k1", p.validClaims()), "client", "nonce"); err == nil {
+		t.Error("Expected token signed with the wrong key to fail")
+	}
+}
+
+func TestClaims(t *testing.T) {
+	var claims map[string]interface{}
+	json.Unmarshal([]byte(`{"sub": "x", "realm_access": {"roles": ["a", "b", 3]}, "group": "g", "email_verified": true, "age": 42}`), &claims)
+	if got := ClaimStrings(claims, "realm_access.roles"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected nested roles, got %v", got)
+	}
+	if got := ClaimStrings(claims, "group"); len(got) != 1 || got[0] != "g" {
+		t.Errorf("Expected single group, got %v", got)
+	}
+	if got := ClaimStrings(claims, "sub.x"); got != nil {
+		t.Errorf("Expected no groups, got %v", got)
+	}
+	if got := ClaimStrings(claims, "email_verified"); len(got) != 1 || got[0] != "true" {
+		t.Errorf("Expected boolean as a string, got %v", got)
+	}
+	if got := ClaimStrings(claims, "age"); len(got) != 1 || got[0] != "42" {
+		t.Errorf("Expected number as a string, got %v", got)
+	}
+}
@@ -0,0 +1,240 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v1"
+)
+
+// maxResponseSize bounds what is read of the responses of
+// providers.
+const maxResponseSize = 1 << 20
+
+// keysRefreshInterval is how often the keys of a provider may be
+// fetched again when an ID token is signed with an unknown key,
+// as they are after the provider rotates its keys.
+const keysRefreshInterval = time.Minute
+
+// clockSkew is how far the clock of a provider may be off.
+const clockSkew = time.Minute
+
+// providerMetadata is what is discovered about a provider.
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// provider is an OpenID Connect provider. Its metadata and keys
+// are fetched when first needed, so that a site starts even if
+// the provider is unavailable.
+type provider struct {
+	issuer string
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *providerMetadata
+	keys        *jose.JsonWebKeySet
+	keysFetched time.Time
+}
+
+func newProvider(issuer string) *provider {
+	return &provider{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// metadata returns the metadata of the provider, discovering it
+// if it hasn't been yet.
+func (p *provider) metadata() (*providerMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var meta providerMetadata
+	if err := p.get(p.issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc: discovering %s: %v", p.issuer, err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc: provider at %s claims to be %s", p.issuer, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: provider at %s is missing endpoints", p.issuer)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the key of the provider with ID kid, fetching the
+// keys again if none has that ID.
+func (p *provider) key(kid string) (*jose.JsonWebKey, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys == nil || (len(p.find(kid)) == 0 && time.Since(p.keysFetched) > keysRefreshInterval) {
+		var keys jose.JsonWebKeySet
+		if err := p.get(meta.JWKSURI, &keys); err != nil {
+			return nil, fmt.Errorf("oidc: fetching keys: %v", err)
+		}
+		p.keys, p.keysFetched = &keys, time.Now()
+	}
+	found := p.find(kid)
+	if len(found) == 0 {
+		return nil, fmt.Errorf("oidc: no key with ID %q", kid)
+	}
+	return &found[0], nil
+}
+
+// find returns the signing keys with ID kid, or all of them if
+// kid is empty. p.mu must be held.
+func (p *provider) find(kid string) []jose.JsonWebKey {
+	var found []jose.JsonWebKey
+	if p.keys == nil {
+		return nil
+	}
+	for _, k := range p.keys.Keys {
+		if (kid == "" || k.KeyID == kid) && (k.Use == "" || k.Use == "sig") {
+			found = append(found, k)
+		}
+	}
+	return found
+}
+
+// get fetches the JSON document at u into v.
+func (p *provider) get(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// exchange exchanges an authorization code for tokens, and
+// returns the ID token.
+func (p *provider) exchange(code, verifier, redirectURI, clientID, clientSecret string) (string, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	if clientSecret == "" {
+		form.Set("client_id", clientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc: exchanging code: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: exchanging code: %s: %s", resp.Status, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", fmt.Errorf("oidc: exchanging code: %v", err)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("oidc: provider returned no ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+// verify verifies the signature and claims of an ID token
+// issued by the provider to clientID for the login with nonce,
+// and returns its claims.
+func (p *provider) verify(rawIDToken, clientID, nonce string) (map[string]interface{}, error) {
+	jws, err := jose.ParseSigned(rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: malformed ID token: %v", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, errors.New("oidc: ID token must have one signature")
+	}
+	hdr := jws.Signatures[0].Header
+	if hdr.Algorithm == "" || hdr.Algorithm == "none" || strings.HasPrefix(hdr.Algorithm, "HS") {
+		return nil, fmt.Errorf("oidc: ID token signed with unsupported algorithm %q", hdr.Algorithm)
+	}
+	key, err := p.key(hdr.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: ID token signature: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("oidc: ID token claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc: ID token issued by %q", iss)
+	}
+	if !hasAudience(claims["aud"], clientID) {
+		return nil, errors.New("oidc: ID token not issued to this client")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("oidc: ID token has the wrong nonce")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Unix(int64(exp), 0).Add(clockSkew).Before(time.Now()) {
+		return nil, errors.New("oidc: ID token expired")
+	}
+	return claims, nil
+}
+
+// hasAudience returns whether aud, a string or a list of them,
+// is or includes clientID.
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
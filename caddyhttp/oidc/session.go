@@ -0,0 +1,31 @@
+package oidc
+
+import "errors"
+
+var errSessionTooLarge = errors.New("oidc: session too large for a cookie; the user may be in too many groups or have too many claims")
+
+// session is who a logged in user is, as kept in the data of
+// their session.
+type session struct {
+	User   string
+	Email  string                 `json:",omitempty"`
+	Groups []string               `json:",omitempty"`
+	Claims map[string]interface{} `json:",omitempty"`
+}
+
+// tokenClaims are the claims of ID tokens that are about the
+// token rather than the user, which are not kept in sessions.
+var tokenClaims = []string{"iss", "aud", "azp", "exp", "iat", "nbf", "auth_time", "nonce", "at_hash", "c_hash", "jti", "sid"}
+
+// userClaims returns the claims of an ID token that are about
+// the user.
+func userClaims(claims map[string]interface{}) map[string]interface{} {
+	user := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		user[k] = v
+	}
+	for _, k := range tokenClaims {
+		delete(user, k)
+	}
+	return user
+}
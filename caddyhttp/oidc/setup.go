@@ -0,0 +1,208 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/sessions"
+)
+
+func init() {
+	caddy.RegisterPlugin("oidc", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// Defaults of a Config.
+const (
+	defaultCallbackPath = "/oauth2/callback"
+	defaultLogoutPath   = "/oauth2/logout"
+	defaultCookieName   = "caddy_session"
+	defaultSessionTTL   = 12 * time.Hour
+	defaultUserClaim    = "email"
+	defaultGroupsClaim  = "groups"
+)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// minSecretLength is the shortest cookie secret accepted.
+const minSecretLength = 32
+
+// setup configures a new OIDC middleware instance.
+func setup(c *caddy.Controller) error {
+	configs, err := oidcParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return OIDC{Next: next, Configs: configs}
+	})
+
+	return nil
+}
+
+func oidcParse(c *caddy.Controller) ([]*Config, error) {
+	var configs []*Config
+
+	for c.Next() {
+		cfg := &Config{
+			Paths:        c.RemainingArgs(),
+			CallbackPath: defaultCallbackPath,
+			LogoutPath:   defaultLogoutPath,
+			CookieName:   defaultCookieName,
+			SessionTTL:   defaultSessionTTL,
+			UserClaim:    defaultUserClaim,
+			GroupsClaim:  defaultGroupsClaim,
+		}
+		if len(cfg.Paths) == 0 {
+			cfg.Paths = []string{"/"}
+		}
+		var secret string
+
+		for c.NextBlock() {
+			var err error
+			switch c.Val() {
+			case "issuer":
+				err = singleArg(c, &cfg.Issuer)
+				if err == nil {
+					if u, perr := url.Parse(cfg.Issuer); perr != nil || u.Scheme == "" || u.Host == "" {
+						return nil, c.Errf("Bad issuer URL '%s'", cfg.Issuer)
+					}
+				}
+			case "client_id":
+				err = singleArg(c, &cfg.ClientID)
+			case "client_secret":
+				err = singleArg(c, &cfg.ClientSecret)
+			case "scopes":
+				cfg.Scopes = c.RemainingArgs()
+				if len(cfg.Scopes) == 0 {
+					return nil, c.ArgErr()
+				}
+			case "callback":
+				err = singleArg(c, &cfg.CallbackPath)
+			case "logout":
+				err = singleArg(c, &cfg.LogoutPath)
+			case "cookie":
+				err = singleArg(c, &cfg.CookieName)
+			case "cookie_secret":
+				err = singleArg(c, &secret)
+				if err == nil && len(secret) < minSecretLength {
+					return nil, c.Errf("cookie_secret must be at least %d characters", minSecretLength)
+				}
+			case "session_ttl":
+				var s string
+				if err = singleArg(c, &s); err == nil {
+					cfg.SessionTTL, err = time.ParseDuration(s)
+					if err != nil || cfg.SessionTTL <= 0 {
+						return nil, c.Errf("Bad session_ttl '%s'", s)
+					}
+				}
+			case "idle_timeout":
+				var s string
+				if err = singleArg(c, &s); err == nil {
+					cfg.IdleTimeout, err = time.ParseDuration(s)
+					if err != nil || cfg.IdleTimeout <= 0 {
+						return nil, c.Errf("Bad idle_timeout '%s'", s)
+					}
+				}
+			case "session_store":
+				err = singleArg(c, &cfg.SessionStore)
+			case "csrf":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				cfg.CSRF = true
+			case "user_claim":
+				err = singleArg(c, &cfg.UserClaim)
+			case "groups_claim":
+				err = singleArg(c, &cfg.GroupsClaim)
+			case "require":
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return nil, c.ArgErr()
+				}
+				cfg.Rules = append(cfg.Rules, Rule{Path: args[0], Groups: args[1:]})
+			default:
+				return nil, c.Errf("Unknown oidc property '%s'", c.Val())
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, c.Err("oidc requires an issuer and a client_id")
+		}
+		cfg.Scopes = withOpenID(cfg.Scopes)
+		for _, other := range configs {
+			if other.CookieName == cfg.CookieName || other.CallbackPath == cfg.CallbackPath {
+				return nil, c.Err("each oidc block needs its own cookie and callback")
+			}
+		}
+
+		if secret == "" {
+			// sessions won't survive a restart or be valid
+			// on other instances, but they work
+			log.Printf("[WARNING] oidc: no cookie_secret; users must log in again after every restart")
+			b := make([]byte, minSecretLength)
+			if _, err := rand.Read(b); err != nil {
+				return nil, fmt.Errorf("oidc: generating cookie secret: %v", err)
+			}
+			secret = string(b)
+		}
+		var err error
+		if cfg.sessions, err = sessions.NewManager(cfg.CookieName, []byte(secret)); err != nil {
+			return nil, err
+		}
+		cfg.sessions.AbsoluteTimeout = cfg.SessionTTL
+		cfg.sessions.IdleTimeout = cfg.IdleTimeout
+		if cfg.SessionStore != "" {
+			if cfg.sessions.Store, err = cachestore.New(cfg.SessionStore); err != nil {
+				return nil, c.Errf("Bad session_store: %v", err)
+			}
+			cfg.sessions.InCookie = false
+			if _, ok := cfg.sessions.Store.(*cachestore.Memory); !ok {
+				// shared with other instances, and not evicted
+				cfg.sessions.Revocations = cfg.sessions.Store
+			}
+		}
+		cfg.provider = newProvider(cfg.Issuer)
+
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+// singleArg reads the only argument of a property into s.
+func singleArg(c *caddy.Controller, s *string) error {
+	if !c.NextArg() {
+		return c.ArgErr()
+	}
+	*s = c.Val()
+	if c.NextArg() {
+		return c.ArgErr()
+	}
+	return nil
+}
+
+// withOpenID returns scopes, or the default ones, including
+// the openid scope.
+func withOpenID(scopes []string) []string {
+	if len(scopes) == 0 {
+		return defaultScopes
+	}
+	for _, s := range scopes {
+		if s == "openid" {
+			return scopes
+		}
+	}
+	return append([]string{"openid"}, scopes...)
+}
@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `oidc {
+		issuer https://id.example.com
+		client_id site
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(OIDC)
+	if !ok {
+		t.Fatalf("Expected handler to be type OIDC, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestOIDCParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Config
+	}{
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+		}`, false, []Config{{
+			Paths:        []string{"/"},
+			Issuer:       "https://id.example.com",
+			ClientID:     "site",
+			Scopes:       []string{"openid", "email", "profile"},
+			CallbackPath: "/oauth2/callback",
+			LogoutPath:   "/oauth2/logout",
+			CookieName:   "caddy_session",
+			SessionTTL:   12 * time.Hour,
+			UserClaim:    "email",
+			GroupsClaim:  "groups",
+		}}},
+		{`oidc /app /api {
+			issuer https://id.example.com/realms/x
+			client_id site
+			client_secret s3cret
+			scopes email roles
+			callback /auth/cb
+			logout /auth/logout
+			cookie app_session
+			cookie_secret 0123456789abcdef0123456789abcdef
+			session_ttl 1h
+			idle_timeout 15m
+			session_store memory
+			csrf
+			user_claim preferred_username
+			groups_claim realm_access.roles
+			require /app/admin admin ops
+		}`, false, []Config{{
+			Paths:        []string{"/app", "/api"},
+			Issuer:       "https://id.example.com/realms/x",
+			ClientID:     "site",
+			ClientSecret: "s3cret",
+			Scopes:       []string{"openid", "email", "roles"},
+			CallbackPath: "/auth/cb",
+			LogoutPath:   "/auth/logout",
+			CookieName:   "app_session",
+			SessionTTL:   time.Hour,
+			IdleTimeout:  15 * time.Minute,
+			SessionStore: "memory",
+			CSRF:         true,
+			UserClaim:    "preferred_username",
+			GroupsClaim:  "realm_access.roles",
+			Rules:        []Rule{{Path: "/app/admin", Groups: []string{"admin", "ops"}}},
+		}}},
+		{`oidc {
+			client_id site
+		}`, true, nil},
+		{`oidc {
+			issuer id.example.com
+			client_id site
+		}`, true, nil},
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+			cookie_secret short
+		}`, true, nil},
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+			require /admin
+		}`, true, nil},
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+			session_ttl forever
+		}`, true, nil},
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+			idle_timeout 0s
+		}`, true, nil},
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+			session_store bolt://localhost
+		}`, true, nil},
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+			csrf yes
+		}`, true, nil},
+		{`oidc {
+			issuer https://id.example.com
+			client_id site
+			flow implicit
+		}`, true, nil},
+		{`oidc /a {
+			issuer https://id.example.com
+			client_id site
+		}
+		oidc /b {
+			issuer https://id.example.com
+			client_id site
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := oidcParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d: expected %d configs, got %d", i, len(test.expected), len(actual))
+		}
+		for j, cfg := range actual {
+			if cfg.sessions == nil || cfg.provider == nil {
+				t.Errorf("Test %d: expected sessions and provider to be set up", i)
+			}
+			cfg.sessions, cfg.provider = nil, nil
+			if !reflect.DeepEqual(*cfg, test.expected[j]) {
+				t.Errorf("Test %d: expected %#v, got %#v", i, test.expected[j], *cfg)
+			}
+		}
+	}
+}
+
+func TestSessionStoreRevocations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_oidc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, test := range []struct {
+		store          string
+		expectedShared bool
+	}{
+		// an evicting memory store would forget revocations
+		{"memory", false},
+		{"file://" + filepath.ToSlash(dir), true},
+	} {
+		configs, err := oidcParse(caddy.NewTestController("http", "oidc {\n\tissuer https://id.example.com\n\tclient_id site\n\tsession_store "+test.store+"\n}"))
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		m := configs[0].sessions
+		if shared := m.Revocations == m.Store; shared != test.expectedShared {
+			t.Errorf("Test %d: Expected revocations to be kept in the session store %t, got %t", i, test.expectedShared, shared)
+		}
+	}
+}
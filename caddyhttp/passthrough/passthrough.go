@@ -0,0 +1,58 @@
+// Package passthrough implements the passthrough directive, which
+// passes the TLS connections of a site through to a backend without
+// terminating TLS, routing them by the server name (SNI) of their
+// ClientHello, so that Caddy can front services that must terminate
+// their own TLS.
+package passthrough
+
+import (
+	"net"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("passthrough", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures the TLS connections of the site to be passed
+// through to a backend:
+//
+//	passthrough host:port
+//
+// The site doesn't get a certificate, since the backend has its own,
+// and its address defaults to port 443.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		if c.NextBlock() {
+			return c.ArgErr()
+		}
+		if cfg.Passthrough != "" {
+			return c.Err("passthrough may only be given once per site")
+		}
+		if _, _, err := net.SplitHostPort(args[0]); err != nil {
+			return c.Errf("Invalid passthrough backend '%s'; must be host:port", args[0])
+		}
+		if cfg.Addr.Scheme == "http" || cfg.Addr.Port == httpserver.HTTPPort {
+			return c.Errf("Site %s can't pass TLS through, since it is plain HTTP", cfg.Addr)
+		}
+		if cfg.Addr.Host == "" || cfg.Addr.Host == "*" {
+			return c.Errf("Site %s can't pass TLS through without a host name to route by", cfg.Addr)
+		}
+		cfg.Passthrough = args[0]
+
+		// the site is on the TLS listener, but its certificate is the backend's
+		cfg.TLS.Enabled = true
+		cfg.TLS.Manual = true
+	}
+	return nil
+}
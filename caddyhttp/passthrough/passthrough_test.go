@@ -0,0 +1,51 @@
+package passthrough
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		addr      httpserver.Address
+		input     string
+		shouldErr bool
+	}{
+		{httpserver.Address{Host: "example.com"}, `passthrough 10.0.0.5:443`, false},
+		{httpserver.Address{Host: "*.example.com", Port: "443"}, `passthrough backend:8443`, false},
+		{httpserver.Address{Host: "example.com"}, `passthrough`, true},
+		{httpserver.Address{Host: "example.com"}, `passthrough 10.0.0.5`, true},
+		{httpserver.Address{Host: "example.com"}, `passthrough a:1 b:2`, true},
+		{httpserver.Address{Host: "example.com"}, `passthrough 10.0.0.5:443 {
+			foo
+		}`, true},
+		{httpserver.Address{Host: "example.com"}, `passthrough 10.0.0.5:443
+		passthrough 10.0.0.6:443`, true},
+		{httpserver.Address{Host: "example.com", Scheme: "http"}, `passthrough 10.0.0.5:443`, true},
+		{httpserver.Address{Host: "example.com", Port: "80"}, `passthrough 10.0.0.5:443`, true},
+		{httpserver.Address{}, `passthrough 10.0.0.5:443`, true},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		cfg := httpserver.GetConfig(c)
+		cfg.Addr = test.addr
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if cfg.Passthrough == "" {
+			t.Errorf("Test %d: Expected Passthrough to be set", i)
+		}
+		if !cfg.TLS.Enabled || !cfg.TLS.Manual {
+			t.Errorf("Test %d: Expected TLS to be enabled without a managed certificate, got %+v", i, cfg.TLS)
+		}
+	}
+}
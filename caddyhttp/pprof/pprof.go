@@ -1,6 +1,7 @@
 package pprof
 
 import (
+	"net"
 	"net/http"
 	pp "net/http/pprof"
 
@@ -15,18 +16,43 @@ const BasePath = "/debug/pprof"
 type Handler struct {
 	Next httpserver.Handler
 	Mux  *http.ServeMux
+
+	// Allow, if not empty, restricts the pprof endpoints
+	// to clients in these networks.
+	Allow []*net.IPNet
 }
 
 // ServeHTTP handles requests to BasePath with pprof, or passes
 // all other requests up the chain.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	if httpserver.Path(r.URL.Path).Matches(BasePath) {
+		if !h.allowed(r) {
+			return http.StatusForbidden, nil
+		}
 		h.Mux.ServeHTTP(w, r)
 		return 0, nil
 	}
 	return h.Next.ServeHTTP(w, r)
 }
 
+// allowed returns whether the client of r may use pprof.
+func (h *Handler) allowed(r *http.Request) bool {
+	if len(h.Allow) == 0 {
+		return true
+	}
+	host := httpserver.ClientIP(r)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // NewMux returns a new http.ServeMux that routes pprof requests.
 // It pretty much copies what the std lib pprof does on init:
 // https://golang.org/src/net/http/pprof/pprof.go#L67
@@ -2,6 +2,7 @@ package pprof
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -49,6 +50,37 @@ func TestServeHTTP(t *testing.T) {
 	}
 }
 
+func TestServeHTTPAllow(t *testing.T) {
+	network, _ := httpserver.ParseNetwork("192.168.0.0/16")
+	single, _ := httpserver.ParseNetwork("::1")
+	h := Handler{
+		Next:  httpserver.HandlerFunc(nextHandler),
+		Mux:   NewMux(),
+		Allow: []*net.IPNet{network, single},
+	}
+
+	for i, test := range []struct {
+		remoteAddr string
+		path       string
+		expected   int
+	}{
+		{"192.168.1.2:1234", "/debug/pprof/cmdline", 0},
+		{"[::1]:1234", "/debug/pprof/cmdline", 0},
+		{"10.0.0.1:1234", "/debug/pprof/cmdline", http.StatusForbidden},
+		{"10.0.0.1:1234", "/foo", http.StatusNotFound},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.RemoteAddr = test.remoteAddr
+		status, err := h.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("Test %d: Expected nil error, but got: %v", i, err)
+		}
+		if status != test.expected {
+			t.Errorf("Test %d: Expected status %d but got %d", i, test.expected, status)
+		}
+	}
+}
+
 func nextHandler(w http.ResponseWriter, r *http.Request) (int, error) {
 	fmt.Fprintf(w, "content")
 	return http.StatusNotFound, nil
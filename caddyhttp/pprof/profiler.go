@@ -0,0 +1,185 @@
+package pprof
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profiler periodically captures CPU and heap profiles and
+// saves them to a directory or sends them to a remote endpoint,
+// for debugging the performance of a server in production.
+type Profiler struct {
+	// Dest is the directory in which profiles are saved, or
+	// the http or https URL to which they are POSTed.
+	Dest string
+
+	// Interval is how often profiles are captured.
+	Interval time.Duration
+
+	// CPUTime is how long the CPU is profiled each time;
+	// if zero, no CPU profiles are captured.
+	CPUTime time.Duration
+
+	// Keep is how many profiles of each kind are kept
+	// in Dest when it is a directory; if zero, all are.
+	Keep int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Profile file names look like heap-20171026T150405Z.pb.gz.
+const (
+	profileExt        = ".pb.gz"
+	profileTimeLayout = "20060102T150405Z"
+)
+
+// isRemote returns whether profiles are sent to a URL.
+func (p *Profiler) isRemote() bool {
+	return strings.HasPrefix(p.Dest, "http://") || strings.HasPrefix(p.Dest, "https://")
+}
+
+// Start starts capturing profiles in the background.
+func (p *Profiler) Start() error {
+	if !p.isRemote() {
+		if err := os.MkdirAll(p.Dest, 0700); err != nil {
+			return fmt.Errorf("pprof: creating profile directory: %v", err)
+		}
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run()
+	return nil
+}
+
+// Stop stops capturing profiles, cutting short any CPU
+// profile being captured.
+func (p *Profiler) Stop() error {
+	if p.stop == nil {
+		return nil
+	}
+	close(p.stop)
+	<-p.done
+	p.stop = nil
+	return nil
+}
+
+func (p *Profiler) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.capture()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// capture captures and saves one profile of each kind.
+func (p *Profiler) capture() {
+	now := time.Now()
+
+	if p.CPUTime > 0 {
+		var buf bytes.Buffer
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			// most likely someone is using the profile endpoint
+			log.Printf("[WARNING] pprof: skipping CPU profile: %v", err)
+		} else {
+			timer := time.NewTimer(p.CPUTime)
+			select {
+			case <-timer.C:
+			case <-p.stop:
+				timer.Stop()
+			}
+			pprof.StopCPUProfile()
+			p.save("cpu", now, buf.Bytes())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		log.Printf("[ERROR] pprof: capturing heap profile: %v", err)
+		return
+	}
+	p.save("heap", now, buf.Bytes())
+}
+
+// save saves or sends a profile of the given kind, logging any error.
+func (p *Profiler) save(kind string, t time.Time, profile []byte) {
+	var err error
+	if p.isRemote() {
+		err = p.send(kind, t, profile)
+	} else {
+		err = p.write(kind, t, profile)
+	}
+	if err != nil {
+		log.Printf("[ERROR] pprof: saving %s profile: %v", kind, err)
+	}
+}
+
+func (p *Profiler) write(kind string, t time.Time, profile []byte) error {
+	name := filepath.Join(p.Dest, kind+"-"+t.UTC().Format(profileTimeLayout)+profileExt)
+	if err := ioutil.WriteFile(name, profile, 0600); err != nil {
+		return err
+	}
+	return p.prune(kind)
+}
+
+// prune removes all but the Keep newest profiles of kind.
+func (p *Profiler) prune(kind string) error {
+	if p.Keep <= 0 {
+		return nil
+	}
+	names, err := filepath.Glob(filepath.Join(p.Dest, kind+"-*"+profileExt))
+	if err != nil {
+		return err
+	}
+	// the timestamps in the names sort chronologically
+	sort.Strings(names)
+	for len(names) > p.Keep {
+		if err := os.Remove(names[0]); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+func (p *Profiler) send(kind string, t time.Time, profile []byte) error {
+	u, err := url.Parse(p.Dest)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("type", kind)
+	q.Set("time", t.UTC().Format(time.RFC3339))
+	if host, err := os.Hostname(); err == nil {
+		q.Set("host", host)
+	}
+	u.RawQuery = q.Encode()
+
+	resp, err := profileClient.Post(u.String(), "application/octet-stream", bytes.NewReader(profile))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with %s", p.Dest, resp.Status)
+	}
+	return nil
+}
+
+var profileClient = &http.Client{Timeout: time.Minute}
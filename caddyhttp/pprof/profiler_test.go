@@ -0,0 +1,67 @@
+package pprof
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProfilerDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := &Profiler{Dest: dir, Keep: 2}
+	start := time.Date(2017, 10, 26, 15, 4, 5, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		p.save("heap", start.Add(time.Duration(i)*time.Second), []byte("profile"))
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(names) != 2 {
+		t.Fatalf("Expected 2 profiles to be kept, got %v", names)
+	}
+	for i, expected := range []string{"heap-20171026T150407Z.pb.gz", "heap-20171026T150408Z.pb.gz"} {
+		if filepath.Base(names[i]) != expected {
+			t.Errorf("Expected newest profiles to be kept, got %v", names)
+		}
+	}
+}
+
+func TestProfilerRemote(t *testing.T) {
+	received := make(chan *http.Request, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- r:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	p := &Profiler{Dest: srv.URL + "/upload", Interval: 20 * time.Millisecond, CPUTime: 5 * time.Millisecond}
+	if err := p.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var kinds []string
+	for len(kinds) < 2 {
+		select {
+		case r := <-received:
+			if r.Method != "POST" || r.URL.Path != "/upload" || r.URL.Query().Get("time") == "" {
+				t.Errorf("Expected POST to /upload with a time, got %s %s", r.Method, r.URL)
+			}
+			kinds = append(kinds, r.URL.Query().Get("type"))
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for profiles")
+		}
+	}
+	p.Stop()
+	if kinds[0] != "cpu" || kinds[1] != "heap" {
+		t.Errorf("Expected a CPU and then a heap profile, got %v", kinds)
+	}
+}
@@ -1,7 +1,11 @@
 package pprof
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/basicauth"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
@@ -12,26 +16,135 @@ func init() {
 	})
 }
 
-// setup returns a new instance of a pprof handler. It accepts no arguments or options.
+// setup returns a new instance of a pprof handler and, if
+// configured, starts a continuous profiler with the server.
 func setup(c *caddy.Controller) error {
+	h, auth, profiler, err := pprofParse(c)
+	if err != nil {
+		return err
+	}
+
+	if profiler != nil {
+		if !profiler.isRemote() {
+			// profiles are saved once listening, also in a sandbox
+			caddy.RegisterWritableDir(profiler.Dest)
+		}
+		c.OnStartup(profiler.Start)
+		c.OnShutdown(profiler.Stop)
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		h.Next = next
+		if auth != nil {
+			return basicauth.BasicAuth{Next: h, SiteRoot: cfg.Root, Rules: []basicauth.Rule{*auth}}
+		}
+		return h
+	})
+
+	return nil
+}
+
+// pprofParse parses
+//
+//	pprof {
+//	    basicauth     <username> <password>
+//	    allow         <cidr...>
+//	    profile_to    <directory|url>
+//	    profile_every <interval>
+//	    profile_cpu   <duration>
+//	    profile_keep  <count>
+//	}
+//
+// where the profile options configure continuous profiling.
+func pprofParse(c *caddy.Controller) (*Handler, *basicauth.Rule, *Profiler, error) {
+	h := &Handler{Mux: NewMux()}
+	var auth *basicauth.Rule
+	profiler := &Profiler{
+		Interval: defaultProfileInterval,
+		CPUTime:  defaultProfileCPUTime,
+		Keep:     defaultProfileKeep,
+	}
 	found := false
 
 	for c.Next() {
 		if found {
-			return c.Err("pprof can only be specified once")
+			return nil, nil, nil, c.Err("pprof can only be specified once")
 		}
 		if len(c.RemainingArgs()) != 0 {
-			return c.ArgErr()
-		}
-		if c.NextBlock() {
-			return c.ArgErr()
+			return nil, nil, nil, c.ArgErr()
 		}
 		found = true
-	}
 
-	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return &Handler{Next: next, Mux: NewMux()}
-	})
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, nil, nil, c.ArgErr()
+			}
+			switch what {
+			case "basicauth":
+				if len(args) != 2 {
+					return nil, nil, nil, c.ArgErr()
+				}
+				pm, err := basicauth.GetPasswordMatcher(args[0], args[1], httpserver.GetConfig(c).Root)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				auth = &basicauth.Rule{Username: args[0], Password: pm, Resources: []string{BasePath}, Realm: "pprof"}
+			case "allow":
+				for _, arg := range args {
+					network, err := httpserver.ParseNetwork(arg)
+					if err != nil {
+						return nil, nil, nil, c.Errf("invalid network '%s': %v", arg, err)
+					}
+					h.Allow = append(h.Allow, network)
+				}
+			case "profile_to":
+				if len(args) != 1 {
+					return nil, nil, nil, c.ArgErr()
+				}
+				profiler.Dest = args[0]
+			case "profile_every", "profile_cpu":
+				if len(args) != 1 {
+					return nil, nil, nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 || (d == 0 && what == "profile_every") {
+					return nil, nil, nil, c.Errf("invalid duration '%s'", args[0])
+				}
+				if what == "profile_every" {
+					profiler.Interval = d
+				} else {
+					profiler.CPUTime = d
+				}
+			case "profile_keep":
+				if len(args) != 1 {
+					return nil, nil, nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return nil, nil, nil, c.Errf("invalid count '%s'", args[0])
+				}
+				profiler.Keep = n
+			default:
+				return nil, nil, nil, c.Errf("unknown property '%s'", what)
+			}
+		}
+	}
 
-	return nil
+	if profiler.Dest == "" {
+		return h, auth, nil, nil
+	}
+	if profiler.CPUTime >= profiler.Interval {
+		return nil, nil, nil, c.Errf("profile_cpu (%s) must be shorter than profile_every (%s)", profiler.CPUTime, profiler.Interval)
+	}
+	return h, auth, profiler, nil
 }
+
+// Continuous profiling defaults.
+const (
+	defaultProfileInterval = time.Minute
+	defaultProfileCPUTime  = 10 * time.Second
+	defaultProfileKeep     = 60
+)
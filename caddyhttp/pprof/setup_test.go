@@ -1,6 +1,8 @@
 package pprof
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -19,6 +21,15 @@ func TestSetup(t *testing.T) {
         }`, true},
 		{`pprof
           pprof`, true},
+		{"pprof {\n basicauth admin s3cret\n allow 10.0.0.0/8 ::1\n}", false},
+		{"pprof {\n basicauth admin\n}", true},
+		{"pprof {\n allow\n}", true},
+		{"pprof {\n allow 10.0.0.0/33\n}", true},
+		{"pprof {\n profile_to /tmp/profiles\n profile_every 5m\n profile_cpu 30s\n profile_keep 10\n}", false},
+		{"pprof {\n profile_to https://profiles.example.com/upload\n}", false},
+		{"pprof {\n profile_to /tmp/profiles\n profile_every 10s\n}", true},
+		{"pprof {\n profile_to /tmp/profiles\n profile_every 0s\n}", true},
+		{"pprof {\n profile_keep many\n}", true},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("http", test.input)
@@ -30,3 +41,32 @@ func TestSetup(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupOptions(t *testing.T) {
+	c := caddy.NewTestController("http", "pprof {\n basicauth admin s3cret\n allow 10.0.0.0/8\n profile_to /tmp/p\n profile_cpu 0s\n}")
+	h, auth, profiler, err := pprofParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(h.Allow) != 1 || h.Allow[0].String() != "10.0.0.0/8" {
+		t.Errorf("Expected 10.0.0.0/8 to be allowed, got %v", h.Allow)
+	}
+	if auth == nil || auth.Username != "admin" || !auth.Password("s3cret") || auth.Resources[0] != BasePath {
+		t.Errorf("Expected basicauth rule for admin on %s, got %#v", BasePath, auth)
+	}
+	if profiler == nil || profiler.Dest != "/tmp/p" || profiler.CPUTime != 0 ||
+		profiler.Interval != defaultProfileInterval || profiler.Keep != defaultProfileKeep {
+		t.Errorf("Expected profiler to /tmp/p without CPU profiles, got %#v", profiler)
+	}
+}
+
+func TestSetupRegistersDest(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "caddy-pprof-test")
+	c := caddy.NewTestController("http", "pprof {\n\tprofile_to "+dir+"\n}")
+	if err := setup(c); err != nil {
+		t.Fatal(err)
+	}
+	if !caddy.Writable(filepath.Join(dir, "heap.pb.gz")) {
+		t.Errorf("Expected the profile folder %s to be writable once privileges are dropped", dir)
+	}
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var (
+	canaryRequests = metrics.NewCounter("caddy_proxy_canary_requests_total",
+		"Number of requests sent to the hosts of a canary or of the stable release, by canary and track (canary or stable).",
+		"canary", "track")
+	canaryFailures = metrics.NewCounter("caddy_proxy_canary_failures_total",
+		"Number of requests to the hosts of a canary or of the stable release that failed or got a 5xx response, by canary and track.",
+		"canary", "track")
+)
+
+// ErrNoCanary is returned when setting the share of requests of a
+// canary that no running proxy has.
+var ErrNoCanary = errors.New("no such canary")
+
+// canary is a release of an upstream that some of the requests of
+// a proxy are sent to, while the rest are sent to its stable hosts:
+// those of clients in Percent percent of them, by the hash of their
+// IP, so that each client stays with one release, and those that
+// carry Header or Cookie.
+type canary struct {
+	name   string
+	hosts  HostPool
+	stable HostPool
+
+	// Header and Cookie, if not "", send the requests that carry
+	// them to the canary, if their value is HeaderValue or
+	// CookieValue, or any if that is "".
+	Header      string
+	HeaderValue string
+	Cookie      string
+	CookieValue string
+
+	configured int32 // percent, as configured
+	percent    int32 // accessed atomically
+}
+
+// newCanary returns a canary named name that no requests are sent
+// to yet.
+func newCanary(name string) *canary {
+	return &canary{name: name}
+}
+
+// Percent returns the percentage of clients whose requests are sent
+// to the canary.
+func (c *canary) Percent() int {
+	return int(atomic.LoadInt32(&c.percent))
+}
+
+// wants returns whether r is sent to the canary.
+func (c *canary) wants(r *http.Request) bool {
+	if c.Header != "" {
+		if v := r.Header.Get(c.Header); v != "" && (c.HeaderValue == "" || v == c.HeaderValue) {
+			return true
+		}
+	}
+	if c.Cookie != "" {
+		if cookie, err := r.Cookie(c.Cookie); err == nil && (c.CookieValue == "" || cookie.Value == c.CookieValue) {
+			return true
+		}
+	}
+	percent := c.Percent()
+	if percent <= 0 {
+		return false
+	}
+	ip := httpserver.ClientIP(r)
+	h := fnv.New32a()
+	h.Write([]byte(c.name))
+	h.Write([]byte{0})
+	h.Write([]byte(ip))
+	return int(h.Sum32()%100) < percent
+}
+
+// track returns the name of the release of host, for metrics.
+func (c *canary) track(host *UpstreamHost) string {
+	if c.hosts.contains(host) {
+		return "canary"
+	}
+	return "stable"
+}
+
+// record records the outcome of a request sent to host.
+func (c *canary) record(host *UpstreamHost, failed bool) {
+	track := c.track(host)
+	canaryRequests.Inc(c.name, track)
+	if failed {
+		canaryFailures.Inc(c.name, track)
+	}
+}
+
+// adopt takes on the percentage of old, which it replaces, if it was
+// changed at runtime and not in the configuration, so that reloading
+// doesn't undo changes.
+func (c *canary) adopt(old *canary) {
+	percent := old.Percent()
+	if percent != int(old.configured) && c.configured == old.configured {
+		atomic.StoreInt32(&c.percent, int32(percent))
+	}
+}
+
+// canaries are those of the running proxies, by name.
+var (
+	canaries   = make(map[string]*canary)
+	canariesMu sync.Mutex
+)
+
+// trackCanary adds the canary of u to the running ones if track is
+// true, in place of any of the same name, or removes it if track is
+// false.
+func trackCanary(u *staticUpstream, track bool) {
+	c := u.canary
+	if c == nil {
+		return
+	}
+	canariesMu.Lock()
+	defer canariesMu.Unlock()
+	old, ok := canaries[c.name]
+	if track {
+		if ok && old != c {
+			c.adopt(old)
+		}
+		canaries[c.name] = c
+	} else if ok && old == c {
+		delete(canaries, c.name)
+	}
+}
+
+// SetCanaryPercent sends the requests of percent percent of clients,
+// from 0 to 100, to the canary with the given name, as in the
+// canary_name property of the proxy directive.
+func SetCanaryPercent(name string, percent int) error {
+	if percent < 0 || percent > 100 {
+		return errors.New("percent must be from 0 to 100")
+	}
+	canariesMu.Lock()
+	c, ok := canaries[name]
+	canariesMu.Unlock()
+	if !ok {
+		return ErrNoCanary
+	}
+	atomic.StoreInt32(&c.percent, int32(percent))
+	log.Printf("[INFO] Canary %s: sending %d%% of clients to the canary", name, percent)
+	return nil
+}
+
+// CanaryInfo describes a canary.
+type CanaryInfo struct {
+	Name    string   `json:"name"`
+	Hosts   []string `json:"hosts"`
+	Percent int      `json:"percent"`
+}
+
+// Canaries describes the running canaries, in alphabetical order.
+func Canaries() []CanaryInfo {
+	canariesMu.Lock()
+	defer canariesMu.Unlock()
+	list := make([]CanaryInfo, 0, len(canaries))
+	for _, c := range canaries {
+		info := CanaryInfo{Name: c.name, Percent: c.Percent()}
+		for _, host := range c.hosts {
+			info.Hosts = append(info.Hosts, host.Name)
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
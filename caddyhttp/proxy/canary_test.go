@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+func TestParseCanary(t *testing.T) {
+	tests := []struct {
+		config        string
+		shouldErr     bool
+		expectName    string
+		expectHosts   int // of the canary
+		expectStable  int
+		expectPercent int
+		expectHeader  string
+		expectCookie  string
+	}{
+		{"proxy / a:80 b:80 {\n canary c:80\n}", false, "example.com/", 1, 2, 0, "", ""},
+		{"proxy /api a:80 {\n canary c:80 d:80-81\n canary_percent 5\n canary_header X-Canary always\n canary_cookie canary\n canary_name api\n}", false, "api", 3, 1, 5, "X-Canary=always", "canary="},
+		{"proxy / {\n pool blue a:80\n pool green b:80\n canary c:80\n}", false, "example.com/", 1, 1, 0, "", ""},
+		{"proxy / a:80 {\n canary_percent 5\n}", true, "", 0, 0, 0, "", ""},
+		{"proxy / a:80 {\n canary\n}", true, "", 0, 0, 0, "", ""},
+		{"proxy / a:80 {\n canary c:80\n canary_percent 101\n}", true, "", 0, 0, 0, "", ""},
+		{"proxy / a:80 {\n canary c:80\n canary_percent some\n}", true, "", 0, 0, 0, "", ""},
+		{"proxy / a:80 {\n canary c:80\n canary_header\n}", true, "", 0, 0, 0, "", ""},
+		{"proxy / a:80 {\n canary c:80\n canary_cookie a b c\n}", true, "", 0, 0, 0, "", ""},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)), "example.com")
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i+1, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		u := upstreams[0].(*staticUpstream)
+		cn := u.canary
+		if cn == nil || cn.name != test.expectName || len(cn.hosts) != test.expectHosts || len(u.livePool()) != test.expectStable {
+			t.Errorf("Test %d: Expected canary %s of %d hosts and %d stable, got %+v", i+1, test.expectName, test.expectHosts, test.expectStable, cn)
+			continue
+		}
+		if cn.Percent() != test.expectPercent {
+			t.Errorf("Test %d: Expected %d%%, got %d%%", i+1, test.expectPercent, cn.Percent())
+		}
+		if header := cn.Header + "=" + cn.HeaderValue; test.expectHeader != "" && header != test.expectHeader {
+			t.Errorf("Test %d: Expected header %s, got %s", i+1, test.expectHeader, header)
+		}
+		if cookie := cn.Cookie + "=" + cn.CookieValue; test.expectCookie != "" && cookie != test.expectCookie {
+			t.Errorf("Test %d: Expected cookie %s, got %s", i+1, test.expectCookie, cookie)
+		}
+		for _, host := range cn.hosts {
+			if !u.Hosts.contains(host) || u.livePool().contains(host) {
+				t.Errorf("Test %d: Expected canary host %s to be health checked but not stable", i+1, host.Name)
+			}
+		}
+	}
+}
+
+func TestCanary(t *testing.T) {
+	newRelease := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(name))
+		}))
+	}
+	stable := newRelease("stable", http.StatusOK)
+	defer stable.Close()
+	canaryRelease := newRelease("canary", http.StatusInternalServerError)
+	defer canaryRelease.Close()
+
+	config := "proxy / " + stable.URL + " {\n canary " + canaryRelease.URL +
+		"\n canary_name test\n canary_header X-Canary\n canary_cookie release canary\n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	trackUpstream(u, true)
+	defer trackUpstream(u, false)
+	p := Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+
+	// serve returns the releases that served the requests of 100
+	// clients, with the header and cookie given, if not ""
+	serve := func(header, cookie string) map[string]int {
+		served := make(map[string]int)
+		for i := 0; i < 100; i++ {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+			if header != "" {
+				r.Header.Set("X-Canary", header)
+			}
+			if cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "release", Value: cookie})
+			}
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, r)
+			served[w.Body.String()]++
+		}
+		return served
+	}
+
+	if got := serve("", ""); got["canary"] != 0 {
+		t.Errorf("Expected no client to be sent to the canary, got %v", got)
+	}
+	if got := serve("1", ""); got["canary"] != 100 {
+		t.Errorf("Expected the header to send clients to the canary, got %v", got)
+	}
+	if got := serve("", "canary"); got["canary"] != 100 {
+		t.Errorf("Expected the cookie to send clients to the canary, got %v", got)
+	}
+	if got := serve("", "stable"); got["canary"] != 0 {
+		t.Errorf("Expected the cookie of another value not to send clients to the canary, got %v", got)
+	}
+
+	if err := SetCanaryPercent("other", 10); err != ErrNoCanary {
+		t.Errorf("Expected no canary, got %v", err)
+	}
+	if err := SetCanaryPercent("test", 30); err != nil {
+		t.Fatal(err)
+	}
+	first := serve("", "")
+	if first["canary"] < 10 || first["canary"] > 50 {
+		t.Errorf("Expected about 30 clients to be sent to the canary, got %v", first)
+	}
+	if again := serve("", ""); again["canary"] != first["canary"] {
+		t.Errorf("Expected the same clients to be sent to the canary, got %v then %v", first, again)
+	}
+	if list := Canaries(); len(list) != 1 || list[0].Percent != 30 || len(list[0].Hosts) != 1 {
+		t.Errorf("Expected a canary of 30%%, got %+v", list)
+	}
+
+	// reloading keeps the percentage set at runtime
+	reloaded, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reloaded[0].(*staticUpstream)
+	trackUpstream(r, true)
+	trackUpstream(u, false)
+	if r.canary.Percent() != 30 {
+		t.Errorf("Expected reloaded canary to keep 30%%, got %d%%", r.canary.Percent())
+	}
+	trackUpstream(r, false)
+	trackUpstream(u, true)
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	for _, expect := range []string{
+		`caddy_proxy_canary_requests_total{canary="test",track="stable"}`,
+		fmt.Sprintf(`caddy_proxy_canary_failures_total{canary="test",track="canary"} %d`, 200+2*first["canary"]),
+	} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("Expected %s in:\n%s", expect, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), `caddy_proxy_canary_failures_total{canary="test",track="stable"}`) {
+		t.Errorf("Expected no failures of the stable release in:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var rollbacks = metrics.NewCounter("caddy_proxy_rollbacks_total",
+	"Number of times a deployment was switched back to its previous pool because too many requests failed, by deployment.",
+	"deployment")
+
+var (
+	// ErrNoDeployment is returned when switching a deployment
+	// that no running proxy has.
+	ErrNoDeployment = errors.New("no such deployment")
+
+	// ErrNoPool is returned when switching a deployment to a pool
+	// it doesn't have.
+	ErrNoPool = errors.New("no such pool")
+)
+
+// Rollback defaults.
+const defaultRollbackMinRequests = 10
+
+// deployment is a blue/green deployment: the hosts of a proxy are in
+// pools, such as blue and green, of which only the live one is sent
+// requests. It is switched to another pool only if the hosts of that
+// pool are healthy, and, for a while after that, switched back if too
+// many of its requests fail.
+type deployment struct {
+	name  string
+	pools map[string]HostPool
+	order []string // of the pools, as given
+
+	// RollbackWindow, if not 0, is how long after a switch it's
+	// switched back if more than RollbackErrorRate of at least
+	// RollbackMinRequests requests fail.
+	RollbackWindow      time.Duration
+	RollbackErrorRate   float64
+	RollbackMinRequests int
+
+	mu       sync.RWMutex
+	live     string
+	previous string    // pool, if switched back to on failures
+	until    time.Time // when failures stop being watched
+	requests int       // since the switch
+	failures int
+}
+
+// newDeployment returns a deployment named name whose live pool is
+// the first to be added.
+func newDeployment(name string) *deployment {
+	return &deployment{
+		name:                name,
+		pools:               make(map[string]HostPool),
+		RollbackMinRequests: defaultRollbackMinRequests,
+	}
+}
+
+// addPool adds the pool with name of hosts.
+func (d *deployment) addPool(name string, hosts HostPool) {
+	if len(d.order) == 0 {
+		d.live = name
+	}
+	d.pools[name] = hosts
+	d.order = append(d.order, name)
+}
+
+// hosts returns the hosts of the live pool.
+func (d *deployment) hosts() HostPool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.pools[d.live]
+}
+
+// watching returns whether the outcomes of requests are watched,
+// since the deployment was switched recently.
+func (d *deployment) watching() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.previous != "" && time.Now().Before(d.until)
+}
+
+// record records the outcome of a request sent to host, switching
+// back to the previous pool if too many have failed since the switch.
+func (d *deployment) record(host *UpstreamHost, failed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.previous == "" || time.Now().After(d.until) || !d.pools[d.live].contains(host) {
+		return
+	}
+	d.requests++
+	if failed {
+		d.failures++
+	}
+	if d.requests < d.RollbackMinRequests ||
+		float64(d.failures)/float64(d.requests) <= d.RollbackErrorRate {
+		return
+	}
+	log.Printf("[ERROR] Deployment %s: %d of %d requests to pool %s failed; switching back to pool %s",
+		d.name, d.failures, d.requests, d.live, d.previous)
+	rollbacks.Inc(d.name)
+	d.live, d.previous = d.previous, ""
+}
+
+// switchTo makes pool the live pool, if all its hosts are healthy,
+// checking them now: by their health check, if one is configured,
+// or else by connecting to them.
+func (d *deployment) switchTo(u *staticUpstream, pool string) error {
+	hosts, ok := d.pools[pool]
+	if !ok {
+		return ErrNoPool
+	}
+	for _, host := range hosts {
+		if u.HealthCheck.Path != "" {
+			u.checkHost(host)
+		} else if err := probeHost(host.Name); err != nil {
+			return fmt.Errorf("host %s of pool %s is unreachable: %v", host.Name, pool, err)
+		}
+		if host.Down() {
+			return fmt.Errorf("host %s of pool %s is down", host.Name, pool)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if pool == d.live {
+		return nil
+	}
+	d.previous, d.live = d.live, pool
+	d.requests, d.failures = 0, 0
+	d.until = time.Now().Add(d.RollbackWindow)
+	if d.RollbackWindow <= 0 {
+		d.previous = ""
+	}
+	return nil
+}
+
+// probeTimeout is how long probeHost waits to connect.
+const probeTimeout = 5 * time.Second
+
+// probeHost connects to the upstream host name, a URL or unix socket,
+// to find out whether it can be reached.
+func probeHost(name string) error {
+	network, addr := "tcp", ""
+	if strings.HasPrefix(name, "unix:") {
+		network = "unix"
+		addr = strings.TrimPrefix(strings.TrimPrefix(name, "unix:"), "//")
+	} else {
+		u, err := url.Parse(name)
+		if err != nil {
+			return err
+		}
+		addr = u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			addr = net.JoinHostPort(u.Hostname(), port)
+		}
+	}
+	conn, err := net.DialTimeout(network, addr, probeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// adopt takes on the live pool of old, which it replaces, if it has
+// a pool of that name, so that reloading doesn't undo switches.
+func (d *deployment) adopt(old *deployment) {
+	old.mu.RLock()
+	live, previous, until := old.live, old.previous, old.until
+	old.mu.RUnlock()
+	if _, ok := d.pools[live]; !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.live = live
+	if _, ok := d.pools[previous]; ok && d.RollbackWindow > 0 {
+		d.previous, d.until = previous, until
+	}
+}
+
+// contains returns whether host is in p.
+func (p HostPool) contains(host *UpstreamHost) bool {
+	for _, h := range p {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// deployments are those of the running proxies, by name.
+var (
+	deployments   = make(map[string]*staticUpstream)
+	deploymentsMu sync.Mutex
+)
+
+// trackDeployment adds the deployment of u to the running ones if
+// track is true, in place of any of the same name, or removes it if
+// track is false.
+func trackDeployment(u *staticUpstream, track bool) {
+	d := u.deployment
+	if d == nil {
+		return
+	}
+	deploymentsMu.Lock()
+	defer deploymentsMu.Unlock()
+	old, ok := deployments[d.name]
+	if track {
+		if ok && old != u {
+			d.adopt(old.deployment)
+		}
+		deployments[d.name] = u
+	} else if ok && old == u {
+		delete(deployments, d.name)
+	}
+}
+
+// SwitchDeployment switches the deployment with the given name, as
+// in the deployment property of the proxy directive, to the pool with
+// the given name, if the hosts of that pool are healthy.
+func SwitchDeployment(name, pool string) error {
+	deploymentsMu.Lock()
+	u, ok := deployments[name]
+	deploymentsMu.Unlock()
+	if !ok {
+		return ErrNoDeployment
+	}
+	if err := u.deployment.switchTo(u, pool); err != nil {
+		return err
+	}
+	log.Printf("[INFO] Deployment %s: switched to pool %s", name, pool)
+	return nil
+}
+
+// DeploymentInfo describes a deployment.
+type DeploymentInfo struct {
+	Name  string   `json:"name"`
+	Pools []string `json:"pools"`
+	Live  string   `json:"live"`
+
+	// Previous is the pool switched back to if too many requests
+	// fail before WatchedUntil.
+	Previous     string     `json:"previous,omitempty"`
+	WatchedUntil *time.Time `json:"watched_until,omitempty"`
+}
+
+// Deployments describes the running deployments, in alphabetical
+// order.
+func Deployments() []DeploymentInfo {
+	deploymentsMu.Lock()
+	defer deploymentsMu.Unlock()
+	list := make([]DeploymentInfo, 0, len(deployments))
+	for _, u := range deployments {
+		d := u.deployment
+		d.mu.RLock()
+		info := DeploymentInfo{Name: d.name, Pools: d.order, Live: d.live}
+		if d.previous != "" && time.Now().Before(d.until) {
+			until := d.until
+			info.Previous, info.WatchedUntil = d.previous, &until
+		}
+		d.mu.RUnlock()
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// statusWriter records the status of the response it writes.
+type statusWriter struct {
+	*httpserver.ResponseWriterWrapper
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriterWrapper.Write(p)
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseDeployment(t *testing.T) {
+	tests := []struct {
+		config        string
+		shouldErr     bool
+		expectName    string
+		expectPools   []string
+		expectHosts   int
+		expectWindow  time.Duration
+		expectMinimum int
+	}{
+		{"proxy / {\n pool blue a:80 b:80\n pool green c:80\n}", false, "example.com/", []string{"blue", "green"}, 3, 0, defaultRollbackMinRequests},
+		{"proxy /api {\n pool blue a:80\n pool green b:80-81\n deployment api\n rollback 5m 0.1 50\n}", false, "api", []string{"blue", "green"}, 3, 5 * time.Minute, 50},
+		{"proxy / {\n pool blue a:80\n}", true, "", nil, 0, 0, 0},
+		{"proxy / a:80 {\n pool blue b:80\n pool green c:80\n}", true, "", nil, 0, 0, 0},
+		{"proxy / {\n pool blue a:80\n pool blue b:80\n}", true, "", nil, 0, 0, 0},
+		{"proxy / {\n pool blue\n pool green b:80\n}", true, "", nil, 0, 0, 0},
+		{"proxy / a:80 {\n deployment app\n}", true, "", nil, 0, 0, 0},
+		{"proxy / a:80 {\n rollback 5m 0.1\n}", true, "", nil, 0, 0, 0},
+		{"proxy / {\n pool blue a:80\n pool green b:80\n rollback 5m\n}", true, "", nil, 0, 0, 0},
+		{"proxy / {\n pool blue a:80\n pool green b:80\n rollback 0s 0.1\n}", true, "", nil, 0, 0, 0},
+		{"proxy / {\n pool blue a:80\n pool green b:80\n rollback 5m 1\n}", true, "", nil, 0, 0, 0},
+		{"proxy / {\n pool blue a:80\n pool green b:80\n rollback 5m 0.1 0\n}", true, "", nil, 0, 0, 0},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)), "example.com")
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i+1, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		u := upstreams[0].(*staticUpstream)
+		d := u.deployment
+		if d == nil || d.name != test.expectName || strings.Join(d.order, ",") != strings.Join(test.expectPools, ",") {
+			t.Errorf("Test %d: Expected deployment %s of pools %v, got %+v", i+1, test.expectName, test.expectPools, d)
+			continue
+		}
+		if len(u.Hosts) != test.expectHosts || d.live != test.expectPools[0] {
+			t.Errorf("Test %d: Expected %d hosts, live in %s, got %d live in %s", i+1, test.expectHosts, test.expectPools[0], len(u.Hosts), d.live)
+		}
+		if d.RollbackWindow != test.expectWindow || d.RollbackMinRequests != test.expectMinimum {
+			t.Errorf("Test %d: Expected rollback in %v after %d requests, got %v after %d", i+1, test.expectWindow, test.expectMinimum, d.RollbackWindow, d.RollbackMinRequests)
+		}
+	}
+}
+
+// newPool returns a server that answers with its name, and fails
+// health checks while healthy is 0.
+func newPool(name string, healthy *int32, status *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			if atomic.LoadInt32(healthy) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(status)))
+		w.Write([]byte(name))
+	}))
+}
+
+func TestDeploymentSwitch(t *testing.T) {
+	blueHealthy, greenHealthy := int32(1), int32(0)
+	blueStatus, greenStatus := int32(http.StatusOK), int32(http.StatusOK)
+	blue := newPool("blue", &blueHealthy, &blueStatus)
+	defer blue.Close()
+	green := newPool("green", &greenHealthy, &greenStatus)
+	defer green.Close()
+
+	config := "proxy / {\n pool blue " + blue.URL + "\n pool green " + green.URL +
+		"\n deployment test\n health_check /health\n health_check_interval 1h\n rollback 1h 0.5 5\n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	defer u.Stop()
+	trackUpstream(u, true)
+	defer trackUpstream(u, false)
+	p := Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+
+	serve := func() string {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Body.String()
+	}
+	if got := serve(); got != "blue" {
+		t.Errorf("Expected blue to be live, got %s", got)
+	}
+
+	if err := SwitchDeployment("other", "green"); err != ErrNoDeployment {
+		t.Errorf("Expected no deployment, got %v", err)
+	}
+	if err := SwitchDeployment("test", "red"); err != ErrNoPool {
+		t.Errorf("Expected no pool, got %v", err)
+	}
+	if err := SwitchDeployment("test", "green"); err == nil {
+		t.Error("Expected no switch to an unhealthy pool")
+	}
+	if got := serve(); got != "blue" {
+		t.Errorf("Expected blue to stay live, got %s", got)
+	}
+
+	// the health of the pool is checked when switching
+	atomic.StoreInt32(&greenHealthy, 1)
+	if err := SwitchDeployment("test", "green"); err != nil {
+		t.Fatalf("Expected switch to a healthy pool, got %v", err)
+	}
+	if got := serve(); got != "green" {
+		t.Errorf("Expected green to be live, got %s", got)
+	}
+	if list := Deployments(); len(list) != 1 || list[0].Live != "green" || list[0].Previous != "blue" || list[0].WatchedUntil == nil {
+		t.Errorf("Expected green to be live and watched, got %+v", list)
+	}
+
+	// reloading keeps the live pool
+	reloaded, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reloaded[0].(*staticUpstream)
+	defer r.Stop()
+	trackUpstream(r, true)
+	trackUpstream(u, false)
+	if r.deployment.live != "green" || r.deployment.previous != "blue" {
+		t.Errorf("Expected reloaded deployment to keep green live, got %s", r.deployment.live)
+	}
+	trackUpstream(r, false)
+	trackUpstream(u, true)
+
+	// too many failures, of the requests since the switch, switch back
+	atomic.StoreInt32(&greenStatus, http.StatusInternalServerError)
+	for i := 0; i < 3; i++ {
+		if got := serve(); got != "green" {
+			t.Errorf("Expected green to be live until enough requests fail, got %s", got)
+		}
+	}
+	atomic.StoreInt32(&greenStatus, http.StatusOK)
+	if got := serve(); got != "green" {
+		t.Errorf("Expected green to be live until enough requests fail, got %s", got)
+	}
+	if got := serve(); got != "blue" {
+		t.Errorf("Expected to have switched back to blue, got %s", got)
+	}
+	if list := Deployments(); len(list) != 1 || list[0].Live != "blue" || list[0].WatchedUntil != nil {
+		t.Errorf("Expected blue to be live and not watched, got %+v", list)
+	}
+}
+
+func TestDeploymentSwitchWithoutHealthCheck(t *testing.T) {
+	healthy, status := int32(1), int32(http.StatusOK)
+	blue := newPool("blue", &healthy, &status)
+	defer blue.Close()
+	green := newPool("green", &healthy, &status)
+	greenURL := green.URL
+	green.Close()
+
+	config := "proxy / {\n pool blue " + blue.URL + "\n pool green " + greenURL + "\n deployment probed\n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	defer u.Stop()
+	trackUpstream(u, true)
+	defer trackUpstream(u, false)
+
+	if err := SwitchDeployment("probed", "green"); err == nil {
+		t.Error("Expected no switch to a pool whose hosts can't be reached")
+	}
+	if live := u.deployment.live; live != "blue" {
+		t.Errorf("Expected blue to stay live, got %s", live)
+	}
+}
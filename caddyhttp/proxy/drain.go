@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+)
+
+// drained is the set of upstream hosts, by name, to which no
+// new requests are sent; requests in flight are unaffected.
+var (
+	drained   = make(map[string]struct{})
+	drainedMu sync.RWMutex
+)
+
+// Drain stops (or, if drain is false, resumes) sending new
+// requests to the upstream host with the given name, as it
+// appears in the proxy directive, in all proxies.
+func Drain(name string, drain bool) {
+	drainedMu.Lock()
+	defer drainedMu.Unlock()
+	if drain {
+		drained[name] = struct{}{}
+	} else {
+		delete(drained, name)
+	}
+}
+
+// IsDrained returns whether the upstream host with the given
+// name is being drained.
+func IsDrained(name string) bool {
+	drainedMu.RLock()
+	defer drainedMu.RUnlock()
+	_, ok := drained[name]
+	return ok
+}
+
+// Drained returns the names of the drained upstream hosts in
+// alphabetical order.
+func Drained() []string {
+	drainedMu.RLock()
+	defer drainedMu.RUnlock()
+	names := make([]string, 0, len(drained))
+	for name := range drained {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,330 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var dynamicRejected = metrics.NewCounter("caddy_proxy_dynamic_rejected_total",
+	"Number of requests whose upstream, resolved from placeholders, was not used, by proxy path and reason (invalid, not_allowed or full).",
+	"from", "reason")
+
+// defaultMaxTargets is the number of resolved targets of a dynamic
+// upstream that are kept, each with its own connections, by default.
+const defaultMaxTargets = 100
+
+// dynamicIdleTimeout is how long the connections to a resolved target
+// are kept while idle.
+const dynamicIdleTimeout = 90 * time.Second
+
+// errTargetsFull is returned when a dynamic upstream resolves to a new
+// target while all of the targets it keeps have requests in flight.
+var errTargetsFull = errors.New("too many upstream targets in use")
+
+// isTemplate returns whether the upstream host h has placeholders.
+func isTemplate(h string) bool {
+	return strings.Contains(h, "{")
+}
+
+// dynamicTarget is the upstream host of a proxy that is given with
+// placeholders, such as http://{>X-Tenant}.internal:8080, which are
+// resolved for each request. Only hosts that match one of allowed
+// may be resolved to, and each target resolved to is kept as a host
+// of its own, with its own connections, fails and drain, up to max
+// of them; the one used least recently whose requests are done makes
+// way for a new one.
+type dynamicTarget struct {
+	from     string
+	template string
+	path     string // of template, which placeholders can't change
+	allowed  []hostPattern
+	max      int
+	newHost  func(string) (*UpstreamHost, error)
+
+	mu      sync.Mutex
+	targets map[string]*resolvedTarget
+}
+
+// resolvedTarget is a host that a dynamicTarget resolved to.
+type resolvedTarget struct {
+	host *UpstreamHost
+	used time.Time
+}
+
+// newDynamicTarget returns the dynamic upstream of template, whose
+// scheme and path, if any, must not have placeholders.
+func newDynamicTarget(from, template string, allowed []hostPattern, max int, newHost func(string) (*UpstreamHost, error)) (*dynamicTarget, error) {
+	if strings.HasPrefix(template, "unix:") {
+		return nil, fmt.Errorf("upstream '%s': placeholders are not allowed in unix sockets", template)
+	}
+	if !strings.HasPrefix(template, "http://") && !strings.HasPrefix(template, "https://") {
+		if strings.Contains(template, "://") {
+			return nil, fmt.Errorf("upstream '%s': scheme must be http or https", template)
+		}
+		template = "http://" + template
+	}
+	rest := template[strings.Index(template, "://")+3:]
+	if strings.ContainsAny(rest, "@?#") {
+		return nil, fmt.Errorf("upstream '%s': only a host and path may be given with placeholders", template)
+	}
+	var path string
+	if i := strings.Index(rest, "/"); i != -1 {
+		if path = rest[i:]; strings.Contains(path, "{") {
+			return nil, fmt.Errorf("upstream '%s': placeholders are only allowed in the host", template)
+		}
+	}
+	// with each placeholder standing for a label, it must be a host
+	sample := template
+	for strings.Contains(sample, "{") {
+		i := strings.Index(sample, "{")
+		j := strings.Index(sample[i:], "}")
+		if j == -1 {
+			return nil, fmt.Errorf("upstream '%s': unclosed placeholder", template)
+		}
+		sample = sample[:i] + "x" + sample[i+j+1:]
+	}
+	if u, err := url.Parse(sample); err != nil || !validHostname(u.Hostname()) {
+		return nil, fmt.Errorf("upstream '%s' is not a valid host", template)
+	} else if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("upstream '%s' has an invalid port", template)
+		}
+	}
+	if max <= 0 {
+		max = defaultMaxTargets
+	}
+	return &dynamicTarget{
+		from:     from,
+		template: template,
+		path:     path,
+		allowed:  allowed,
+		max:      max,
+		newHost:  newHost,
+		targets:  make(map[string]*resolvedTarget),
+	}, nil
+}
+
+// Select returns the host that the template resolves to for r, if
+// it is allowed and available, or else nil.
+func (d *dynamicTarget) Select(r *http.Request) *UpstreamHost {
+	name, err := d.resolve(r)
+	if err != nil {
+		dynamicRejected.Inc(d.from, "invalid")
+		return nil
+	}
+	if !d.allows(name) {
+		dynamicRejected.Inc(d.from, "not_allowed")
+		return nil
+	}
+	host, err := d.host(name)
+	if err != nil {
+		dynamicRejected.Inc(d.from, "full")
+		return nil
+	}
+	if !host.Available() {
+		return nil
+	}
+	return host
+}
+
+// resolve returns the name of the host, as scheme://host[:port][/path],
+// that the template resolves to for r, or an error if it is not a
+// valid one.
+func (d *dynamicTarget) resolve(r *http.Request) (string, error) {
+	target := httpserver.NewReplacer(r, nil, "").Replace(d.template)
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if u.User != nil || u.Opaque != "" || u.RawQuery != "" || u.Fragment != "" || u.Path != d.path {
+		return "", fmt.Errorf("upstream '%s' is not a host", target)
+	}
+	if !validHostname(u.Hostname()) {
+		return "", fmt.Errorf("upstream '%s' has an invalid host", target)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("upstream '%s' has an invalid port", target)
+		}
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host) + u.Path, nil
+}
+
+// allows returns whether the host of name, a resolved target, matches
+// one of the allowed patterns.
+func (d *dynamicTarget) allows(name string) bool {
+	u, err := url.Parse(name)
+	if err != nil {
+		return false
+	}
+	for _, p := range d.allowed {
+		if p.matches(u.Hostname(), u.Port()) {
+			return true
+		}
+	}
+	return false
+}
+
+// host returns the host of the target name, which is kept from then
+// on, unless all the targets kept are busy.
+func (d *dynamicTarget) host(name string) (*UpstreamHost, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.targets[name]; ok {
+		t.used = time.Now()
+		return t.host, nil
+	}
+	if len(d.targets) >= d.max && !d.evict() {
+		return nil, errTargetsFull
+	}
+	host, err := d.newHost(name)
+	if err != nil {
+		return nil, err
+	}
+	d.targets[name] = &resolvedTarget{host: host, used: time.Now()}
+	return host, nil
+}
+
+// evict drops the target used least recently that has no requests in
+// flight, and returns whether there was one. d.mu must be held.
+func (d *dynamicTarget) evict() bool {
+	var oldest string
+	var used time.Time
+	for name, t := range d.targets {
+		if atomic.LoadInt64(&t.host.Conns) > 0 {
+			continue
+		}
+		if oldest == "" || t.used.Before(used) {
+			oldest, used = name, t.used
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	closeIdle(d.targets[oldest].host)
+	delete(d.targets, oldest)
+	return true
+}
+
+// hosts returns the hosts of the targets kept.
+func (d *dynamicTarget) hosts() HostPool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pool := make(HostPool, 0, len(d.targets))
+	for _, t := range d.targets {
+		pool = append(pool, t.host)
+	}
+	return pool
+}
+
+// close closes the idle connections of all the targets kept.
+func (d *dynamicTarget) close() {
+	for _, host := range d.hosts() {
+		closeIdle(host)
+	}
+}
+
+// closeIdle closes the idle connections to host.
+func closeIdle(host *UpstreamHost) {
+	if host.ReverseProxy == nil {
+		return
+	}
+	if t, ok := host.ReverseProxy.Transport.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+// validHostname returns whether h is an IP address or a name of
+// letters, digits and hyphens, in labels separated by dots.
+func validHostname(h string) bool {
+	if h == "" || len(h) > 253 {
+		return false
+	}
+	if net.ParseIP(h) != nil {
+		return true
+	}
+	for _, label := range strings.Split(h, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hostPattern is a host that a dynamic upstream may resolve to: a
+// name, in which a label of * stands for any one label, an IP address
+// or a CIDR range, and a port, if it must be that one.
+type hostPattern struct {
+	host string
+	cidr *net.IPNet
+	port string
+}
+
+// parseHostPattern parses s, which is host, host:port, or [ip]:port
+// for IPv6 addresses.
+func parseHostPattern(s string) (hostPattern, error) {
+	var p hostPattern
+	host := s
+	if h, port, err := net.SplitHostPort(s); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return p, fmt.Errorf("allowed host '%s' has an invalid port", s)
+		}
+		host, p.port = h, port
+	}
+	if strings.Contains(host, "/") {
+		_, cidr, err := net.ParseCIDR(host)
+		if err != nil {
+			return p, fmt.Errorf("allowed host '%s': %v", s, err)
+		}
+		p.cidr = cidr
+		return p, nil
+	}
+	if !validHostname(strings.Replace(host, "*", "x", -1)) {
+		return p, fmt.Errorf("allowed host '%s' is not a valid host", s)
+	}
+	for _, label := range strings.Split(host, ".") {
+		if strings.Contains(label, "*") && label != "*" {
+			return p, fmt.Errorf("allowed host '%s': * must be a whole label", s)
+		}
+	}
+	p.host = strings.ToLower(host)
+	return p, nil
+}
+
+// matches returns whether host and port match p.
+func (p hostPattern) matches(host, port string) bool {
+	if p.port != "" && port != p.port {
+		return false
+	}
+	if p.cidr != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && p.cidr.Contains(ip)
+	}
+	want := strings.Split(p.host, ".")
+	got := strings.Split(strings.ToLower(host), ".")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] != "*" && want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
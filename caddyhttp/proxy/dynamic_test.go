@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseDynamic(t *testing.T) {
+	tests := []struct {
+		config         string
+		shouldErr      bool
+		expectTemplate string
+		expectMax      int
+	}{
+		{"proxy / http://{>X-Tenant}.internal:8080 {\n allow_hosts *.internal:8080\n}", false, "http://{>X-Tenant}.internal:8080", defaultMaxTargets},
+		{"proxy / {>X-Tenant}.internal/api {\n allow_hosts *.internal 10.0.0.0/8\n max_targets 5\n}", false, "http://{>X-Tenant}.internal/api", 5},
+		{"proxy / {\n upstream https://{>X-Tenant-Id}.{>X-Region}.internal:8443\n allow_hosts *.*.internal\n}", false, "https://{>X-Tenant-Id}.{>X-Region}.internal:8443", defaultMaxTargets},
+		{"proxy / http://{>X-Tenant}.internal:8080-8081 {\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant.internal {\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}_a.internal {\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal:8080\n", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal http://b:80 {\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / http://b:80 {\n canary http://{>X-Tenant}.internal\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / {\n pool blue http://{>X-Tenant}.internal\n pool green b:80\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal {\n allow_hosts *.internal\n health_check /health\n}", true, "", 0},
+		{"proxy / http://internal/{>X-Tenant} {\n allow_hosts internal\n}", true, "", 0},
+		{"proxy / ftp://{>X-Tenant}.internal {\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / unix:/tmp/{>X-Tenant}.sock {\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / http://user@{>X-Tenant}.internal {\n allow_hosts *.internal\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal {\n allow_hosts a*.internal\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal {\n allow_hosts *.internal:http\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal {\n allow_hosts 10.0.0.0/33\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal {\n allow_hosts\n}", true, "", 0},
+		{"proxy / http://{>X-Tenant}.internal {\n allow_hosts *.internal\n max_targets 0\n}", true, "", 0},
+		{"proxy / http://b:80 {\n allow_hosts *.internal\n}", true, "", 0},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)), "")
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i+1, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		d := upstreams[0].(*staticUpstream).dynamic
+		if d == nil || d.template != test.expectTemplate || d.max != test.expectMax {
+			t.Errorf("Test %d: Expected template %s of up to %d targets, got %+v", i+1, test.expectTemplate, test.expectMax, d)
+		}
+	}
+}
+
+func TestDynamicSelect(t *testing.T) {
+	config := "proxy / http://{>X-Tenant}.internal:8080/api {\n allow_hosts *.internal:8080 10.1.0.0/16\n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := upstreams[0].(*staticUpstream)
+	tests := []struct {
+		tenant     string
+		expectHost string // or "" if none
+	}{
+		{"acme", "http://acme.internal:8080/api"},
+		{"ACME", "http://acme.internal:8080/api"},
+		{"", ""},
+		{"a.b", ""},                     // not one label
+		{"evil.com/", ""},               // changes the path
+		{"evil.com#", ""},               // fragment
+		{"evil.com?", ""},               // query
+		{"evil.com:80@x", ""},           // credentials
+		{"acme.internal:9090/x", ""},    // changes the port and path
+		{"a_b", ""},                     // not a host name
+		{"-acme", ""},                   // not a host name
+		{"{>X-Other}", ""},              // unresolved
+		{"acme.internal:8080/api?", ""}, // query
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", test.tenant)
+		host := u.Select(r)
+		if test.expectHost == "" {
+			if host != nil {
+				t.Errorf("Test %d: Expected %q to select no host, got %s", i+1, test.tenant, host.Name)
+			}
+			continue
+		}
+		if host == nil || host.Name != test.expectHost {
+			t.Errorf("Test %d: Expected %q to select %s, got %v", i+1, test.tenant, test.expectHost, host)
+		}
+	}
+	if n := len(u.dynamic.hosts()); n != 1 {
+		t.Errorf("Expected 1 target to be kept, got %d", n)
+	}
+}
+
+func TestHostPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		port    string
+		expect  bool
+	}{
+		{"*.internal", "acme.internal", "8080", true},
+		{"*.internal", "ACME.internal", "", true},
+		{"*.internal", "a.acme.internal", "", false},
+		{"*.internal", "internal", "", false},
+		{"*.internal:8080", "acme.internal", "8080", true},
+		{"*.internal:8080", "acme.internal", "8081", false},
+		{"*.internal:8080", "acme.internal", "", false},
+		{"api.*.internal", "api.eu.internal", "", true},
+		{"api.internal", "api.internal", "443", true},
+		{"api.internal", "web.internal", "", false},
+		{"10.0.0.0/8", "10.2.3.4", "", true},
+		{"10.0.0.0/8", "11.2.3.4", "", false},
+		{"10.0.0.0/8", "ten.internal", "", false},
+		{"10.0.0.1", "10.0.0.1", "", true},
+		{"[::1]:8080", "::1", "8080", true},
+	}
+	for i, test := range tests {
+		p, err := parseHostPattern(test.pattern)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i+1, err)
+			continue
+		}
+		if got := p.matches(test.host, test.port); got != test.expect {
+			t.Errorf("Test %d: Expected %s matching %s:%s to be %v, got %v", i+1, test.pattern, test.host, test.port, test.expect, got)
+		}
+	}
+}
+
+func TestDynamicTargets(t *testing.T) {
+	d, err := newDynamicTarget("/", "{>X-Tenant}.internal", []hostPattern{{host: "*.internal"}}, 2, (&staticUpstream{MaxFails: 1}).newDynamicHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectTenant := func(tenant string) *UpstreamHost {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", tenant)
+		return d.Select(r)
+	}
+
+	a, b := selectTenant("a"), selectTenant("b")
+	if a == nil || b == nil || a == b {
+		t.Fatalf("Expected a host of each target, got %v and %v", a, b)
+	}
+	if a.ReverseProxy.Transport == nil || a.ReverseProxy.Transport == b.ReverseProxy.Transport {
+		t.Error("Expected each target to have a transport of its own")
+	}
+	if selectTenant("a") != a {
+		t.Error("Expected the target to be kept")
+	}
+
+	// b is used least recently, so it makes way
+	if selectTenant("c") == nil {
+		t.Fatal("Expected a host for a new target")
+	}
+	if selectTenant("a") != a {
+		t.Error("Expected the target used recently to be kept")
+	}
+	if selectTenant("b") == b {
+		t.Error("Expected the target used least recently to be dropped")
+	}
+
+	// while all targets are busy, new ones can't be kept
+	for _, host := range d.hosts() {
+		host.Conns = 1
+	}
+	if host := selectTenant("d"); host != nil {
+		t.Errorf("Expected no host while all targets are busy, got %s", host.Name)
+	}
+}
+
+func TestDynamicProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	port := backendURL.Port()
+
+	config := "proxy / http://{>X-Backend}:" + port + " {\n allow_hosts 127.0.0.0/8:" + port + "\n}"
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+	defer upstreams[0].Stop()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Backend", "127.0.0.1")
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Body.String(); got != "127.0.0.1:"+port {
+		t.Errorf("Expected the backend to be sent the resolved host, got %q", got)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Backend", "192.168.0.1")
+	status, err := p.ServeHTTP(httptest.NewRecorder(), r)
+	if status != http.StatusBadGateway || err == nil {
+		t.Errorf("Expected a host that isn't allowed to be a bad gateway, got %d and %v", status, err)
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderPolicy decides which of the headers of a client's request
+// are forwarded upstream. It applies before the header_upstream
+// rules, so that those can still set any header; X-Forwarded-For,
+// which the proxy sets itself, is not subject to it. Its names may
+// end in * to match every header that begins with what comes before
+// it, such as X-Internal-*.
+type HeaderPolicy struct {
+	// Allow, if not empty, are the only headers forwarded.
+	Allow []string
+
+	// Deny are headers never forwarded, such as internal ones
+	// like X-Request-ID that clients must not be able to set.
+	Deny []string
+}
+
+// filter returns a copy of h without the headers that p doesn't
+// forward. It doesn't modify h, which is shared with the request.
+func (p *HeaderPolicy) filter(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		if name != "X-Forwarded-For" {
+			if len(p.Allow) > 0 && !matchHeader(p.Allow, name) {
+				continue
+			}
+			if matchHeader(p.Deny, name) {
+				continue
+			}
+		}
+		out[name] = values
+	}
+	return out
+}
+
+// matchHeader returns whether name is one of names.
+func matchHeader(names []string, name string) bool {
+	for _, n := range names {
+		if strings.HasSuffix(n, "*") {
+			prefix := n[:len(n)-1]
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeConnection removes from the Connection header going
+// upstream, which the websocket preset copies from the client, the
+// names of other headers, so that a client can't have the upstream
+// drop headers that the proxy sets, such as X-Real-IP, as hop-by-hop.
+// Upgrade stays, for websockets.
+func sanitizeConnection(h http.Header) {
+	values, ok := h["Connection"]
+	if !ok {
+		return
+	}
+	var tokens []string
+	for _, v := range values {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			switch strings.ToLower(token) {
+			case "upgrade", "keep-alive", "close":
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	if len(tokens) == 0 {
+		h.Del("Connection")
+		return
+	}
+	h.Set("Connection", strings.Join(tokens, ", "))
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/mholt/caddy/metrics"
+)
+
+var (
+	upstreamHealthy = metrics.NewGauge("caddy_proxy_upstream_healthy",
+		"Whether each proxy upstream host is up (1) or down (0), by proxy path and host.",
+		"from", "upstream")
+	upstreamConns = metrics.NewGauge("caddy_proxy_upstream_connections",
+		"Number of requests in flight to each proxy upstream host, by proxy path and host.",
+		"from", "upstream")
+)
+
+// running is the set of upstreams of the running proxies, whose
+// hosts are reported in the metrics registry and readiness checks.
+var (
+	running   = make(map[*staticUpstream]struct{})
+	runningMu sync.Mutex
+)
+
+func init() {
+	metrics.OnScrape(collectUpstreams)
+}
+
+// trackUpstream adds u, and its deployment and canary, if any, to the
+// running upstreams if track is true, or removes them if track is false.
+func trackUpstream(u Upstream, track bool) {
+	su, ok := u.(*staticUpstream)
+	if !ok {
+		return
+	}
+	trackDeployment(su, track)
+	trackCanary(su, track)
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if track {
+		running[su] = struct{}{}
+	} else {
+		delete(running, su)
+	}
+}
+
+// collectUpstreams sets the upstream gauges from the running upstreams.
+func collectUpstreams() {
+	upstreamHealthy.Reset()
+	upstreamConns.Reset()
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	for u := range running {
+		hosts := u.Hosts
+		if u.dynamic != nil {
+			hosts = u.dynamic.hosts()
+		}
+		for _, host := range hosts {
+			var up float64
+			if !host.Down() {
+				up = 1
+			}
+			upstreamHealthy.Set(up, u.from, host.Name)
+			upstreamConns.Set(float64(atomic.LoadInt64(&host.Conns)), u.from, host.Name)
+		}
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 // HostPool is a collection of UpstreamHosts.
@@ -25,6 +28,7 @@ func init() {
 	RegisterPolicy("first", func(arg string) Policy { return &First{} })
 	RegisterPolicy("uri_hash", func(arg string) Policy { return &URIHash{} })
 	RegisterPolicy("header", func(arg string) Policy { return &Header{arg} })
+	RegisterPolicy("placeholder", func(arg string) Policy { return &Placeholder{arg} })
 }
 
 // Random is a policy that selects up hosts from a pool at random.
@@ -180,3 +184,33 @@ func (r *Header) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	}
 	return hostByHashing(pool, val)
 }
+
+// Placeholder is a policy that selects the host named by the value
+// of a placeholder, such as {map.backend}, so that a map can route
+// requests to upstreams
+type Placeholder struct {
+	// The placeholder, the value of which is the name of the host,
+	// with or without its scheme
+	Value string
+}
+
+// Select selects the available host named by the value of the
+// placeholder, if there is one
+func (r *Placeholder) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	if r.Value == "" {
+		return nil
+	}
+	name := httpserver.NewReplacer(request, nil, "").Replace(r.Value)
+	if name == "" {
+		return nil
+	}
+	for _, host := range pool {
+		if !host.Available() {
+			continue
+		}
+		if host.Name == name || strings.TrimPrefix(strings.TrimPrefix(host.Name, "http://"), "https://") == name {
+			return host
+		}
+	}
+	return nil
+}
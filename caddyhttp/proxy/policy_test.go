@@ -341,3 +341,37 @@ func TestHeaderPolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestPlaceholderPolicy(t *testing.T) {
+	pool := testPool()
+	tests := []struct {
+		Policy       *Placeholder
+		BackendValue string
+		NilHost      bool
+		HostIndex    int
+	}{
+		{&Placeholder{""}, "http://C", true, 0},
+		{&Placeholder{"{>Backend}"}, "", true, 0},
+		{&Placeholder{"{>Backend}"}, "http://C", false, 2},
+		{&Placeholder{"{>Backend}"}, "C", false, 2},
+		{&Placeholder{"{>Backend}"}, "D", true, 0},
+	}
+
+	for idx, test := range tests {
+		request, _ := http.NewRequest("GET", "/", nil)
+		if test.BackendValue != "" {
+			request.Header.Add("Backend", test.BackendValue)
+		}
+
+		host := test.Policy.Select(pool, request)
+		if test.NilHost && host != nil {
+			t.Errorf("%d: Expected host to be nil", idx)
+		}
+		if !test.NilHost && host == nil {
+			t.Errorf("%d: Did not expect host to be nil", idx)
+		}
+		if !test.NilHost && host != pool[test.HostIndex] {
+			t.Errorf("%d: Expected Placeholder policy to be host %d", idx, test.HostIndex)
+		}
+	}
+}
@@ -48,6 +48,12 @@ type Upstream interface {
 	Stop() error
 }
 
+// staleUpstream is an Upstream that may keep responses to serve,
+// though stale, when none of its hosts can serve a request.
+type staleUpstream interface {
+	stale() *staleCache
+}
+
 // UpstreamHostDownFunc can be used to customize how Down behaves.
 type UpstreamHostDownFunc func(*UpstreamHost) bool
 
@@ -60,11 +66,15 @@ type UpstreamHost struct {
 	Name              string // hostname of this upstream host
 	UpstreamHeaders   http.Header
 	DownstreamHeaders http.Header
+	HeaderPolicy      *HeaderPolicy // of the client's headers, if not nil
 	FailTimeout       time.Duration
 	CheckDown         UpstreamHostDownFunc
 	WithoutPathPrefix string
-	ReverseProxy      *ReverseProxy
-	Fails             int32
+	// HostHeader, if not "", is the Host header sent upstream, which
+	// may have placeholders, in place of any the header rules give.
+	HostHeader   string
+	ReverseProxy *ReverseProxy
+	Fails        int32
 	// This is an int32 so that we can use atomic operations to do concurrent
 	// reads & writes to this value.  The default value of 0 indicates that it
 	// is healthy and any non-zero value indicates unhealthy.
@@ -89,7 +99,7 @@ func (uh *UpstreamHost) Full() bool {
 
 // Available checks whether the upstream host is available for proxying to
 func (uh *UpstreamHost) Available() bool {
-	return !uh.Down() && !uh.Full()
+	return !uh.Down() && !uh.Full() && !IsDrained(uh.Name)
 }
 
 // ServeHTTP satisfies the httpserver.Handler interface.
@@ -147,7 +157,19 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		return true
 	}
 
+	var stale *staleCache
+	if su, ok := upstream.(staleUpstream); ok {
+		stale = su.stale()
+	}
+
+	var deploy *deployment
+	var cn *canary
+	if su, ok := upstream.(*staticUpstream); ok {
+		deploy, cn = su.deployment, su.canary
+	}
+
 	var backendErr error
+	var rec *staleRecorder // of the response, to keep it if it's cacheable
 	for {
 		// since Select() should give us "up" hosts, keep retrying
 		// hosts until timeout (or until we get a nil host).
@@ -187,6 +209,11 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			return http.StatusInternalServerError, errors.New("proxy for host '" + host.Name + "' is nil")
 		}
 
+		// drop the client's headers that aren't forwarded
+		if host.HeaderPolicy != nil {
+			outreq.Header = host.HeaderPolicy.filter(outreq.Header)
+		}
+
 		// set headers for request going upstream
 		if host.UpstreamHeaders != nil {
 			// modify headers for request that will be sent to the upstream host
@@ -194,6 +221,10 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			if hostHeaders, ok := outreq.Header["Host"]; ok && len(hostHeaders) > 0 {
 				outreq.Host = hostHeaders[len(hostHeaders)-1]
 			}
+			sanitizeConnection(outreq.Header)
+		}
+		if host.HostHeader != "" {
+			outreq.Host = replacer.Replace(host.HostHeader)
 		}
 
 		// prepare a function that will update response
@@ -217,14 +248,37 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		//   The call to proxy.ServeHTTP can theoretically panic.
 		//   To prevent host.Conns from getting out-of-sync we thus have to
 		//   make sure that it's _always_ correctly decremented afterwards.
+		dst := w
+		if stale != nil {
+			if rec = stale.record(w, r); rec != nil {
+				dst = rec
+			}
+		}
+		var sw *statusWriter // of the response, if its outcome is recorded
+		if deploy != nil && deploy.watching() || cn != nil {
+			sw = &statusWriter{ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: dst}}
+			dst = sw
+		}
 		func() {
 			atomic.AddInt64(&host.Conns, 1)
 			defer atomic.AddInt64(&host.Conns, -1)
-			backendErr = proxy.ServeHTTP(w, outreq, downHeaderUpdateFn)
+			backendErr = proxy.ServeHTTP(dst, outreq, downHeaderUpdateFn)
 		}()
+		if sw != nil {
+			failed := backendErr != nil || sw.status >= 500
+			if deploy != nil {
+				deploy.record(host, failed)
+			}
+			if cn != nil {
+				cn.record(host, failed)
+			}
+		}
 
 		// if no errors, we're done here
 		if backendErr == nil {
+			if rec != nil {
+				stale.store(r, rec, time.Now())
+			}
 			return 0, nil
 		}
 
@@ -249,6 +303,13 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		}
 	}
 
+	// serve a stale response, unless an upstream host started to
+	// respond before failing
+	if stale != nil && (rec == nil || rec.status == 0) && stale.serve(w, r, time.Now()) {
+		staleResponses.Inc(upstream.From())
+		return 0, nil
+	}
+
 	return http.StatusBadGateway, backendErr
 }
 
@@ -329,7 +390,13 @@ func createUpstreamRequest(rw http.ResponseWriter, r *http.Request) (*http.Reque
 		}
 	}
 
-	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+	// the peer, rather than the client that real_ip found behind it,
+	// is the next hop of X-Forwarded-For
+	peer, ok := r.Context().Value(httpserver.PeerAddrCtxKey).(string)
+	if !ok {
+		peer = r.RemoteAddr
+	}
+	if clientIP, _, err := net.SplitHostPort(peer); err == nil {
 		// If we aren't the first proxy, retain prior
 		// X-Forwarded-For information as a comma+space
 		// separated list and fold multiple headers into one.
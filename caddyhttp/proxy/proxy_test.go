@@ -689,6 +689,84 @@ func TestUpstreamHeadersUpdate(t *testing.T) {
 
 }
 
+func TestUpstreamHeaderPolicy(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var actualHeaders http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualHeaders = r.Header
+	}))
+	defer backend.Close()
+
+	upstream := newFakeUpstream(backend.URL, false)
+	upstream.host.HeaderPolicy = &HeaderPolicy{
+		Allow: []string{"Accept", "Connection", "Upgrade", "X-Real-IP", "X-Request-*"},
+		Deny:  []string{"X-Request-ID"},
+	}
+	upstream.host.UpstreamHeaders = http.Header{
+		"Connection":   {"{>Connection}"},
+		"Upgrade":      {"{>Upgrade}"},
+		"X-Real-Ip":    {"{remote}"},
+		"X-Request-Id": {"internal"},
+	}
+	p := &Proxy{
+		Next:      httpserver.EmptyNext, // prevents panic in some cases when test fails
+		Upstreams: []Upstream{upstream},
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	r.Header.Set("Accept", "text/plain")
+	r.Header.Set("Cookie", "secret")
+	r.Header.Set("X-Request-Id", "spoofed")
+	r.Header.Set("X-Request-Start", "1")
+	r.Header.Set("Connection", "Upgrade, X-Real-IP")
+	r.Header.Set("Upgrade", "websocket")
+
+	p.ServeHTTP(w, r)
+
+	for headerKey, expect := range map[string][]string{
+		"Accept":          {"text/plain"},
+		"Cookie":          nil,
+		"X-Request-Id":    {"internal"},
+		"X-Request-Start": {"1"},
+		"X-Real-Ip":       {"192.0.2.1"},
+		"X-Forwarded-For": {"192.0.2.1"},
+	} {
+		if got := actualHeaders[headerKey]; !reflect.DeepEqual(got, expect) {
+			t.Errorf("Upstream request does not contain expected %v header: expect %v, but got %v",
+				headerKey, expect, got)
+		}
+	}
+
+	// the policy must not change the headers of the client's request
+	if got := r.Header.Get("Cookie"); got != "secret" {
+		t.Errorf("Expected the request to keep its Cookie header, but got %q", got)
+	}
+}
+
+func TestSanitizeConnection(t *testing.T) {
+	for i, test := range []struct {
+		connection []string
+		expect     []string
+	}{
+		{nil, nil},
+		{[]string{"Upgrade"}, []string{"Upgrade"}},
+		{[]string{"keep-alive, X-Real-IP", "Upgrade"}, []string{"keep-alive, Upgrade"}},
+		{[]string{"X-Real-IP, X-Forwarded-Proto"}, nil},
+	} {
+		h := http.Header{}
+		if test.connection != nil {
+			h["Connection"] = test.connection
+		}
+		sanitizeConnection(h)
+		if got := h["Connection"]; !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Test %d: Expected Connection %v, got %v", i+1, test.expect, got)
+		}
+	}
+}
+
 func TestDownstreamHeadersUpdate(t *testing.T) {
 	log.SetOutput(ioutil.Discard)
 	defer log.SetOutput(os.Stderr)
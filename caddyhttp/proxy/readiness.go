@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterReadinessCheck("proxy_upstreams", checkUpstreams)
+}
+
+// checkUpstreams is ready unless some running proxy has no
+// upstream host that is up, in its live pool if it has pools.
+func checkUpstreams() error {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	var down []string
+	for u := range running {
+		hosts := u.livePool()
+		if len(hosts) == 0 {
+			continue
+		}
+		up := false
+		for _, host := range hosts {
+			if !host.Down() {
+				up = true
+				break
+			}
+		}
+		if !up {
+			down = append(down, u.from)
+		}
+	}
+	if len(down) > 0 {
+		sort.Strings(down)
+		return fmt.Errorf("no upstream hosts are up for %s", strings.Join(down, ", "))
+	}
+	return nil
+}
@@ -189,25 +189,33 @@ func NewSingleHostReverseProxy(target *url.URL, without string, keepalive int) *
 		// if keepalive is equal to the default,
 		// just use default transport, to avoid creating
 		// a brand new transport
-		transport := &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			Dial:                  defaultDialer.Dial,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		}
-		if keepalive == 0 {
-			transport.DisableKeepAlives = true
-		} else {
-			transport.MaxIdleConnsPerHost = keepalive
-		}
-		if httpserver.HTTP2 {
-			http2.ConfigureTransport(transport)
-		}
-		rp.Transport = transport
+		rp.Transport = newTransport(keepalive, nil)
 	}
 	return rp
 }
 
+// newTransport returns a transport of its own, which keeps up to
+// keepalive idle connections per host, or none if it is 0, and makes
+// TLS connections with tlsConfig, if not nil.
+func newTransport(keepalive int, tlsConfig *tls.Config) *http.Transport {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		Dial:                  defaultDialer.Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+	if keepalive == 0 {
+		transport.DisableKeepAlives = true
+	} else {
+		transport.MaxIdleConnsPerHost = keepalive
+	}
+	if httpserver.HTTP2 {
+		http2.ConfigureTransport(transport)
+	}
+	return transport
+}
+
 // UseInsecureTransport is used to facilitate HTTPS proxying
 // when it is OK for upstream to be using a bad certificate,
 // since this transport skips verification.
@@ -238,6 +246,9 @@ func (rp *ReverseProxy) UseInsecureTransport() {
 // It is designed to handle websocket connection upgrades as well.
 func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, outreq *http.Request, respUpdateFn respUpdateFn) error {
 	transport := rp.Transport
+	if t, ok := transport.(*sniTransport); ok {
+		transport = t.transportFor(outreq.Host)
+	}
 	if requestIsWebsocket(outreq) {
 		transport = newConnHijackerTransport(transport)
 	} else if transport == nil {
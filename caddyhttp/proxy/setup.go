@@ -22,8 +22,17 @@ func setup(c *caddy.Controller) error {
 		return Proxy{Next: next, Upstreams: upstreams}
 	})
 
-	// Register shutdown handlers.
+	// Register startup and shutdown handlers.
 	for _, upstream := range upstreams {
+		upstream := upstream
+		c.OnStartup(func() error {
+			trackUpstream(upstream, true)
+			return nil
+		})
+		c.OnShutdown(func() error {
+			trackUpstream(upstream, false)
+			return nil
+		})
 		c.OnShutdown(upstream.Stop)
 	}
 
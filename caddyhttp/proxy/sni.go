@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxServerNames is the number of server names that an sniTransport
+// keeps a transport, and so connections, for.
+const maxServerNames = 100
+
+// sniIdleTimeout is how long the connections of an sniTransport are
+// kept while idle, unless it is given another time.
+const sniIdleTimeout = 90 * time.Second
+
+// sniTransport is the transport to a TLS upstream whose server name
+// is the Host header of each request sent to it, rather than its own
+// host. As a connection is only good for the name it was made for,
+// there is a transport for each name; once there are maxServerNames
+// of them, the one used least recently makes way for that of a new
+// one.
+type sniTransport struct {
+	keepalive          int
+	insecureSkipVerify bool
+	idleTimeout        time.Duration
+
+	mu         sync.Mutex
+	transports map[string]*sniEntry
+	uses       uint64
+}
+
+// sniEntry is the transport for a server name.
+type sniEntry struct {
+	transport *http.Transport
+	used      uint64 // the number of uses of all transports when last used
+}
+
+// RoundTrip sends r with the transport for its Host.
+func (t *sniTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.transportFor(r.Host).RoundTrip(r)
+}
+
+// transportFor returns the transport whose server name is that of
+// host, which may have a port.
+func (t *sniTransport) transportFor(host string) *http.Transport {
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	name = strings.ToLower(name)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.uses++
+	if e, ok := t.transports[name]; ok {
+		e.used = t.uses
+		return e.transport
+	}
+	if t.transports == nil {
+		t.transports = make(map[string]*sniEntry)
+	}
+	if len(t.transports) >= maxServerNames {
+		// requests in flight keep their connections
+		var oldest string
+		for n, e := range t.transports {
+			if oldest == "" || e.used < t.transports[oldest].used {
+				oldest = n
+			}
+		}
+		t.transports[oldest].transport.CloseIdleConnections()
+		delete(t.transports, oldest)
+	}
+	transport := newTransport(t.keepalive, &tls.Config{
+		ServerName:         name,
+		InsecureSkipVerify: t.insecureSkipVerify,
+	})
+	transport.IdleConnTimeout = t.idleTimeout
+	if transport.IdleConnTimeout == 0 {
+		transport.IdleConnTimeout = sniIdleTimeout
+	}
+	t.transports[name] = &sniEntry{transport: transport, used: t.uses}
+	return transport
+}
+
+// CloseIdleConnections closes the idle connections of all the
+// transports.
+func (t *sniTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.transports {
+		e.transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseBlockHostHeader(t *testing.T) {
+	tests := []struct {
+		config           string
+		shouldErr        bool
+		expectHostHeader string
+		expectSNI        bool
+	}{
+		{"proxy / a:8080", false, "", false},
+		{"proxy / a:8080 {\n host_header preserve\n}", false, "{host}", false},
+		{"proxy / a:8080 {\n transparent\n host_header upstream\n}", false, "a:8080", false},
+		{"proxy / a:8080 {\n host_header {>X-Tenant}.example.com\n}", false, "{>X-Tenant}.example.com", false},
+		{"proxy / https://a:8443 {\n host_header preserve\n sni host\n}", false, "{host}", true},
+		{"proxy / https://a:8443 {\n sni host\n sni upstream\n}", false, "", false},
+		{"proxy / http://a:8080 {\n sni host\n}", false, "", false},
+		{"proxy / a:8080 {\n host_header\n}", true, "", false},
+		{"proxy / a:8080 {\n host_header a b\n}", true, "", false},
+		{"proxy / a:8080 {\n sni\n}", true, "", false},
+		{"proxy / a:8080 {\n sni client\n}", true, "", false},
+	}
+	for i, test := range tests {
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(test.config)), "")
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i+1, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		host := upstreams[0].(*staticUpstream).Hosts[0]
+		if host.HostHeader != test.expectHostHeader {
+			t.Errorf("Test %d: Expected Host header %q, got %q", i+1, test.expectHostHeader, host.HostHeader)
+		}
+		if _, sni := host.ReverseProxy.Transport.(*sniTransport); sni != test.expectSNI {
+			t.Errorf("Test %d: Expected server name to follow the Host header to be %v, got %v", i+1, test.expectSNI, sni)
+		}
+	}
+}
+
+func TestHostHeader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer backend.Close()
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+
+	tests := []struct {
+		properties string
+		expectHost string
+	}{
+		{"", backendHost},
+		{"transparent", "example.com"},
+		{"host_header preserve", "example.com"},
+		{"host_header upstream", backendHost},
+		{"transparent\n host_header upstream", backendHost},
+		{"host_header api.internal", "api.internal"},
+		{"header_upstream Host other.internal\n host_header {>X-Tenant}.internal", "acme.internal"},
+	}
+	for i, test := range tests {
+		config := "proxy / " + backend.URL + " {\n " + test.properties + "\n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i+1, err)
+			continue
+		}
+		p := Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+		r := httptest.NewRequest("GET", "http://example.com/", nil)
+		r.Header.Set("X-Tenant", "acme")
+		w := httptest.NewRecorder()
+		if _, err := p.ServeHTTP(w, r); err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i+1, err)
+			continue
+		}
+		if got := w.Body.String(); got != test.expectHost {
+			t.Errorf("Test %d: Expected Host %s, got %s", i+1, test.expectHost, got)
+		}
+	}
+}
+
+func TestSNIFollowsHost(t *testing.T) {
+	var mu sync.Mutex
+	var serverNames []string
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	backend.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			serverNames = append(serverNames, hello.ServerName)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	backend.StartTLS()
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	// the upstream is given by name, so that it has a server name
+	upstream := "https://localhost:" + backendURL.Port()
+	tests := []struct {
+		properties        string
+		expectServerNames []string
+	}{
+		{"", []string{"localhost"}},
+		{"host_header preserve", []string{"localhost"}},
+		{"host_header preserve\n sni host", []string{"a.example.com", "b.example.com"}},
+		{"host_header {>X-Tenant}.internal\n sni host", []string{"acme.internal"}},
+	}
+	for i, test := range tests {
+		config := "proxy / " + upstream + " {\n insecure_skip_verify\n keepalive 0\n " + test.properties + "\n}"
+		upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile", strings.NewReader(config)), "")
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i+1, err)
+			continue
+		}
+		p := Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+		mu.Lock()
+		serverNames = nil
+		mu.Unlock()
+		for _, site := range []string{"a.example.com", "b.example.com", "a.example.com"} {
+			r := httptest.NewRequest("GET", "http://"+site+"/", nil)
+			r.Header.Set("X-Tenant", "acme")
+			if _, err := p.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+				t.Errorf("Test %d: Expected no error, got %v", i+1, err)
+			}
+		}
+		mu.Lock()
+		got := make(map[string]bool)
+		for _, name := range serverNames {
+			got[name] = true
+		}
+		mu.Unlock()
+		if len(got) != len(test.expectServerNames) {
+			t.Errorf("Test %d: Expected server names %v, got %v", i+1, test.expectServerNames, got)
+			continue
+		}
+		for _, name := range test.expectServerNames {
+			if !got[name] {
+				t.Errorf("Test %d: Expected server names %v, got %v", i+1, test.expectServerNames, got)
+			}
+		}
+		upstreams[0].Stop()
+	}
+}
+
+func TestSNITransports(t *testing.T) {
+	st := &sniTransport{keepalive: 2}
+	first := st.transportFor("a.example.com:443")
+	if first.IdleConnTimeout == 0 {
+		t.Error("Expected idle connections to time out")
+	}
+	if st.transportFor("A.example.com") != first {
+		t.Error("Expected the transport of a server name to be kept")
+	}
+	for i := 1; i < maxServerNames; i++ {
+		st.transportFor("host" + strconv.Itoa(i) + ".example.com")
+		if i == maxServerNames/2 {
+			// used again, so it isn't used least recently
+			st.transportFor("a.example.com")
+		}
+	}
+	// host1 is used least recently, so it makes way
+	st.transportFor("new.example.com")
+	if len(st.transports) != maxServerNames {
+		t.Errorf("Expected %d transports, got %d", maxServerNames, len(st.transports))
+	}
+	if _, ok := st.transports["a.example.com"]; !ok {
+		t.Error("Expected the transport used recently to be kept")
+	}
+	if _, ok := st.transports["host1.example.com"]; ok {
+		t.Error("Expected the transport used least recently to be dropped")
+	}
+}
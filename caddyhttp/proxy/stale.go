@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var staleResponses = metrics.NewCounter("caddy_proxy_stale_responses_total",
+	"Number of responses served from the stale cache because no upstream host could serve them, by proxy path.",
+	"from")
+
+// maxStaleBody is the size of the largest response body kept to
+// serve stale.
+const maxStaleBody = 1 << 20
+
+// defaultStaleEntries is the number of responses kept in memory to
+// serve stale by default, which bounds their bodies to 64 MiB.
+const defaultStaleEntries = 64
+
+// staleCache keeps the latest cacheable responses from upstream hosts,
+// so that they can be served, with a Warning header, for up to
+// MaxStale past their freshness when no host can serve the request.
+// They are kept in Store, which may be shared by several instances.
+//
+// Responses are stored in the background, so that a slow store doesn't
+// hold up the responses; those that come while staleQueue of them are
+// waiting to be stored aren't kept.
+type staleCache struct {
+	MaxStale time.Duration
+	Store    cachestore.Store
+
+	start   sync.Once
+	queue   chan staleWrite
+	done    chan struct{}
+	pending sync.WaitGroup
+}
+
+// staleWrite is a response waiting to be stored.
+type staleWrite struct {
+	key   string
+	value []byte
+	ttl   time.Duration
+	path  string // of the request, for logging
+}
+
+// staleQueue is the number of responses that may wait to be stored.
+const staleQueue = 64
+
+func newStaleCache(maxStale time.Duration, store cachestore.Store) *staleCache {
+	return &staleCache{
+		MaxStale: maxStale,
+		Store:    store,
+		queue:    make(chan staleWrite, staleQueue),
+		done:     make(chan struct{}),
+	}
+}
+
+// run stores the responses queued until c is stopped.
+func (c *staleCache) run() {
+	for {
+		select {
+		case sw := <-c.queue:
+			if err := c.Store.Set(sw.key, sw.value, sw.ttl); err != nil {
+				log.Printf("[ERROR] Storing stale response for %s: %v", sw.path, err)
+			}
+			c.pending.Done()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// flush waits for the responses queued to be stored.
+func (c *staleCache) flush() {
+	c.pending.Wait()
+}
+
+// stop stops storing responses; those still queued aren't stored.
+func (c *staleCache) stop() {
+	close(c.done)
+}
+
+// staleKey returns the key of the response to r, or "" if it is not
+// one that is cached.
+func staleKey(r *http.Request) string {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || r.Header.Get("Upgrade") != "" {
+		return ""
+	}
+	return r.Host + r.URL.RequestURI() + "\n" + r.Header.Get("Accept-Encoding")
+}
+
+// credentialed returns whether r has credentials, with which its
+// response may be for that client only.
+func credentialed(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// public returns whether a response with the headers h is explicitly
+// one that may be shared, even if the request had credentials.
+func public(h http.Header) bool {
+	for _, directive := range cacheDirectives(h) {
+		if directive == "public" {
+			return true
+		}
+	}
+	return false
+}
+
+// record returns a writer that writes to w and records the response,
+// if it is one to r that may be cached.
+func (c *staleCache) record(w http.ResponseWriter, r *http.Request) *staleRecorder {
+	if r.Method != http.MethodGet || staleKey(r) == "" {
+		return nil
+	}
+	return &staleRecorder{ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w}}
+}
+
+// store caches the response recorded by rec for r, if it may be.
+func (c *staleCache) store(r *http.Request, rec *staleRecorder, now time.Time) {
+	if rec.tooBig || !storable(rec.status, rec.Header()) ||
+		credentialed(r) && !public(rec.Header()) {
+		return
+	}
+	resp := &cachestore.Response{
+		Status: rec.status,
+		Header: make(http.Header, len(rec.Header())),
+		Body:   rec.body.Bytes(),
+		Stored: now,
+		TTL:    freshness(rec.Header(), now),
+	}
+	copyHeader(resp.Header, rec.Header())
+	c.start.Do(func() { go c.run() })
+	c.pending.Add(1)
+	select {
+	case c.queue <- staleWrite{key: staleKey(r), value: cachestore.EncodeResponse(resp), ttl: resp.TTL + c.MaxStale, path: r.URL.Path}:
+	default:
+		c.pending.Done()
+	}
+}
+
+// serve writes the cached response to r to w, returning false if
+// there is none that may be served at now.
+func (c *staleCache) serve(w http.ResponseWriter, r *http.Request, now time.Time) bool {
+	key := staleKey(r)
+	if key == "" {
+		return false
+	}
+	b, err := c.Store.Get(key)
+	if err != nil {
+		if err != cachestore.ErrNotFound {
+			log.Printf("[ERROR] Getting stale response for %s: %v", r.URL.Path, err)
+		}
+		return false
+	}
+	entry, err := cachestore.DecodeResponse(b)
+	if err != nil || now.After(entry.Stored.Add(entry.TTL+c.MaxStale)) {
+		c.Store.Delete(key)
+		return false
+	}
+	if credentialed(r) && !public(entry.Header) {
+		// it may not be what the client, with its credentials, sees
+		return false
+	}
+
+	h := w.Header()
+	for field := range entry.Header {
+		h.Del(field)
+	}
+	copyHeader(h, entry.Header)
+	h.Set("Age", strconv.FormatInt(int64(now.Sub(entry.Stored)/time.Second), 10))
+	if now.After(entry.Stored.Add(entry.TTL)) {
+		h.Add("Warning", `110 - "Response is Stale"`)
+	}
+	h.Add("Warning", `111 - "Revalidation Failed"`)
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+	return true
+}
+
+// storable returns whether a response of status with the headers h
+// may be cached.
+func storable(status int, h http.Header) bool {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently, http.StatusGone:
+	default:
+		return false
+	}
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, directive := range cacheDirectives(h) {
+		if directive == "no-store" || directive == "private" {
+			return false
+		}
+	}
+	for _, field := range strings.Split(strings.Join(h["Vary"], ","), ",") {
+		if field = strings.TrimSpace(field); field != "" && !strings.EqualFold(field, "Accept-Encoding") {
+			return false
+		}
+	}
+	return true
+}
+
+// freshness returns how long a response with the headers h, received
+// at now, is fresh for.
+func freshness(h http.Header, now time.Time) time.Duration {
+	var maxAge, sMaxAge string
+	for _, directive := range cacheDirectives(h) {
+		if strings.HasPrefix(directive, "max-age=") {
+			maxAge = directive[len("max-age="):]
+		} else if strings.HasPrefix(directive, "s-maxage=") {
+			sMaxAge = directive[len("s-maxage="):]
+		}
+	}
+	for _, age := range []string{sMaxAge, maxAge} {
+		if seconds, err := strconv.ParseInt(age, 10, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	if expires, err := http.ParseTime(h.Get("Expires")); err == nil {
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		if d := expires.Sub(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// cacheDirectives returns the lowercased directives of the
+// Cache-Control header in h.
+func cacheDirectives(h http.Header) []string {
+	var directives []string
+	for _, directive := range strings.Split(strings.Join(h["Cache-Control"], ","), ",") {
+		if directive = strings.ToLower(strings.TrimSpace(directive)); directive != "" {
+			directives = append(directives, strings.Replace(directive, `"`, "", -1))
+		}
+	}
+	return directives
+}
+
+// staleRecorder is a response writer that keeps a copy of the response
+// it writes, up to maxStaleBody of its body.
+type staleRecorder struct {
+	*httpserver.ResponseWriterWrapper
+	status int
+	body   bytes.Buffer
+	tooBig bool
+}
+
+func (rec *staleRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (rec *staleRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if !rec.tooBig {
+		if rec.body.Len()+len(b) > maxStaleBody {
+			rec.tooBig = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriterWrapper.Write(b)
+}
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*staleRecorder)(nil)
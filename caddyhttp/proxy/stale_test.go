@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyfile"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestStorable(t *testing.T) {
+	for i, test := range []struct {
+		status int
+		header http.Header
+		expect bool
+	}{
+		{200, http.Header{}, true},
+		{200, http.Header{"Cache-Control": {"public, max-age=60"}}, true},
+		{200, http.Header{"Cache-Control": {"max-age=60", "Private"}}, false},
+		{200, http.Header{"Cache-Control": {"no-store"}}, false},
+		{200, http.Header{"Set-Cookie": {"a=b"}}, false},
+		{200, http.Header{"Vary": {"Accept-Encoding"}}, true},
+		{200, http.Header{"Vary": {"Accept-Encoding, Cookie"}}, false},
+		{301, http.Header{}, true},
+		{404, http.Header{}, false},
+		{500, http.Header{}, false},
+	} {
+		if got := storable(test.status, test.header); got != test.expect {
+			t.Errorf("Test %d: expected %t, got %t", i, test.expect, got)
+		}
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i, test := range []struct {
+		header http.Header
+		expect time.Duration
+	}{
+		{http.Header{}, 0},
+		{http.Header{"Cache-Control": {"max-age=60"}}, time.Minute},
+		{http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}}, 2 * time.Minute},
+		{http.Header{"Cache-Control": {`max-age="30"`}}, 30 * time.Second},
+		{http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, time.Hour},
+		{http.Header{
+			"Date":    {now.Add(-time.Hour).Format(http.TimeFormat)},
+			"Expires": {now.Format(http.TimeFormat)},
+		}, time.Hour},
+		{http.Header{"Expires": {"0"}}, 0},
+	} {
+		if got := freshness(test.header, now); got != test.expect {
+			t.Errorf("Test %d: expected %v, got %v", i, test.expect, got)
+		}
+	}
+}
+
+func TestStaleCache(t *testing.T) {
+	c := newStaleCache(time.Hour, cachestore.NewMemory(2))
+	now := time.Now()
+	store := func(path, cacheControl, body string) {
+		r := httptest.NewRequest("GET", path, nil)
+		rec := c.record(httptest.NewRecorder(), r)
+		rec.Header().Set("Cache-Control", cacheControl)
+		rec.Write([]byte(body))
+		c.store(r, rec, now)
+	}
+	store("/a", "max-age=60", "a")
+	store("/b", "", "b")
+	store("/c", "", "c") // evicts /a
+	c.flush()
+
+	for i, test := range []struct {
+		method, path  string
+		at            time.Duration
+		auth          bool
+		expectServed  bool
+		expectBody    string
+		expectWarning []string
+	}{
+		{"GET", "/a", 0, false, false, "", nil},
+		{"GET", "/b", 0, false, true, "b", []string{`111 - "Revalidation Failed"`}},
+		{"GET", "/b", time.Minute, false, true, "b", []string{`110 - "Response is Stale"`, `111 - "Revalidation Failed"`}},
+		{"HEAD", "/c", time.Minute, false, true, "", []string{`110 - "Response is Stale"`, `111 - "Revalidation Failed"`}},
+		{"GET", "/c", 0, true, false, "", nil},
+		{"POST", "/c", 0, false, false, "", nil},
+		{"GET", "/c", 2 * time.Hour, false, false, "", nil},
+		{"GET", "/c", 0, false, false, "", nil}, // expired above
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.auth {
+			r.Header.Set("Authorization", "Basic x")
+		}
+		w := httptest.NewRecorder()
+		if served := c.serve(w, r, now.Add(test.at)); served != test.expectServed {
+			t.Fatalf("Test %d: expected served %t, got %t", i, test.expectServed, served)
+		}
+		if !test.expectServed {
+			continue
+		}
+		if w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, w.Body.String())
+		}
+		if got := strings.Join(w.Header()["Warning"], "|"); got != strings.Join(test.expectWarning, "|") {
+			t.Errorf("Test %d: expected warnings %v, got %v", i, test.expectWarning, w.Header()["Warning"])
+		}
+	}
+}
+
+// blockedStore is a store whose Set blocks until it is released.
+type blockedStore struct {
+	cachestore.Store
+	release chan struct{}
+}
+
+func (s blockedStore) Set(key string, value []byte, ttl time.Duration) error {
+	<-s.release
+	return s.Store.Set(key, value, ttl)
+}
+
+func TestStaleCacheSlowStore(t *testing.T) {
+	store := blockedStore{Store: cachestore.NewMemory(1000), release: make(chan struct{})}
+	c := newStaleCache(time.Hour, store)
+	defer c.stop()
+
+	stored := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*staleQueue; i++ {
+			r := httptest.NewRequest("GET", "/"+strconv.Itoa(i), nil)
+			rec := c.record(httptest.NewRecorder(), r)
+			rec.Write([]byte("x"))
+			c.store(r, rec, time.Now())
+		}
+		close(stored)
+	}()
+	select {
+	case <-stored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected storing responses not to wait for the store")
+	}
+
+	close(store.release)
+	c.flush()
+	if n := store.Store.(*cachestore.Memory).Len(); n == 0 || n > staleQueue+1 {
+		t.Errorf("Expected up to %d responses to be stored, got %d", staleQueue+1, n)
+	}
+}
+
+func TestStaleCacheCredentials(t *testing.T) {
+	c := newStaleCache(time.Hour, cachestore.NewMemory(10))
+	now := time.Now()
+	store := func(path, cookie, cacheControl string) {
+		r := httptest.NewRequest("GET", path, nil)
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		rec := c.record(httptest.NewRecorder(), r)
+		rec.Header().Set("Cache-Control", cacheControl)
+		rec.Write([]byte(path))
+		c.store(r, rec, now)
+	}
+	store("/mine", "session=1", "max-age=60")
+	store("/shared", "session=1", "public, max-age=60")
+	store("/anonymous", "", "max-age=60")
+	c.flush()
+
+	for i, test := range []struct {
+		path         string
+		cookie       string
+		auth         bool
+		expectServed bool
+	}{
+		{"/mine", "", false, false},
+		{"/mine", "session=1", false, false},
+		{"/shared", "", false, true},
+		{"/shared", "session=2", false, true},
+		{"/shared", "", true, true},
+		{"/anonymous", "", false, true},
+		{"/anonymous", "session=2", false, false},
+		{"/anonymous", "", true, false},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.cookie != "" {
+			r.Header.Set("Cookie", test.cookie)
+		}
+		if test.auth {
+			r.Header.Set("Authorization", "Basic x")
+		}
+		if served := c.serve(httptest.NewRecorder(), r, now); served != test.expectServed {
+			t.Errorf("Test %d: expected served %t, got %t", i, test.expectServed, served)
+		}
+	}
+}
+
+func TestProxyServeStale(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1")
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	upstreams, err := NewStaticUpstreams(caddyfile.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL+" {\n serve_stale 1h\n}")), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Proxy{Next: httpserver.EmptyNext, Upstreams: upstreams}
+
+	w := httptest.NewRecorder()
+	if _, err := p.ServeHTTP(w, httptest.NewRequest("GET", "/page", nil)); err != nil {
+		t.Fatalf("Expected no error while the upstream is up, got %v", err)
+	}
+	upstreams[0].(*staticUpstream).staleCache.flush()
+	backend.Close()
+
+	w = httptest.NewRecorder()
+	status, err := p.ServeHTTP(w, httptest.NewRequest("GET", "/page", nil))
+	if status != 0 || err != nil {
+		t.Fatalf("Expected the stale response to be served, got %d (%v)", status, err)
+	}
+	if w.Body.String() != "hello /page" || len(w.Header()["Warning"]) == 0 {
+		t.Errorf("Expected the stale response with a warning, got %q %v", w.Body.String(), w.Header())
+	}
+
+	status, err = p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+	if status != http.StatusBadGateway || err == nil {
+		t.Errorf("Expected a bad gateway error without a stale response, got %d (%v)", status, err)
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"crypto/tls"
 
+	"github.com/mholt/caddy/cachestore"
 	"github.com/mholt/caddy/caddyfile"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -29,6 +30,7 @@ type staticUpstream struct {
 	from              string
 	upstreamHeaders   http.Header
 	downstreamHeaders http.Header
+	headerPolicy      *HeaderPolicy
 	stop              chan struct{}  // Signals running goroutines to stop.
 	wg                sync.WaitGroup // Used to wait for running goroutines to stop.
 	Hosts             HostPool
@@ -51,6 +53,15 @@ type staticUpstream struct {
 	IgnoredSubPaths    []string
 	insecureSkipVerify bool
 	MaxFails           int32
+	staleCache         *staleCache // if serve_stale is given
+	deployment         *deployment // if pools are given
+	canary             *canary     // if canary hosts are given
+	hostHeader         string      // of host_header, unless that is upstream
+	hostHeaderUpstream bool        // if host_header is upstream
+	sniFollowsHost     bool
+	allowHosts         []hostPattern
+	maxTargets         int
+	dynamic            *dynamicTarget // if the host has placeholders
 }
 
 // NewStaticUpstreams parses the configuration input and sets up
@@ -79,6 +90,8 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 		}
 
 		var to []string
+		var pools [][]string // each the name of a pool, then its hosts
+		var canaryTo []string
 		for _, t := range c.RemainingArgs() {
 			parsed, err := parseUpstream(t)
 			if err != nil {
@@ -98,6 +111,37 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 					return upstreams, err
 				}
 				to = append(to, parsed...)
+			case "pool":
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return upstreams, c.ArgErr()
+				}
+				for _, pool := range pools {
+					if pool[0] == args[0] {
+						return upstreams, c.Errf("duplicate pool '%s'", args[0])
+					}
+				}
+				pool := []string{args[0]}
+				for _, t := range args[1:] {
+					parsed, err := parseUpstream(t)
+					if err != nil {
+						return upstreams, err
+					}
+					pool = append(pool, parsed...)
+				}
+				pools = append(pools, pool)
+			case "canary":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return upstreams, c.ArgErr()
+				}
+				for _, t := range args {
+					parsed, err := parseUpstream(t)
+					if err != nil {
+						return upstreams, err
+					}
+					canaryTo = append(canaryTo, parsed...)
+				}
 			default:
 				if err := parseBlock(&c, upstream); err != nil {
 					return upstreams, err
@@ -105,17 +149,97 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 			}
 		}
 
-		if len(to) == 0 {
+		if len(pools) > 0 {
+			if len(to) > 0 {
+				return upstreams, c.Err("upstream hosts must all be in pools if any are")
+			}
+			if len(pools) < 2 {
+				return upstreams, c.Err("a deployment needs two pools or more")
+			}
+			if upstream.deploy().name == "" {
+				upstream.deployment.name = host + upstream.from
+			}
+		} else if upstream.deployment != nil {
+			return upstreams, c.Err("deployment and rollback require pools")
+		}
+
+		if len(to) == 0 && len(pools) == 0 {
 			return upstreams, c.ArgErr()
 		}
 
-		upstream.Hosts = make([]*UpstreamHost, len(to))
-		for i, host := range to {
+		if len(to) == 1 && isTemplate(to[0]) {
+			if len(canaryTo) > 0 || upstream.canary != nil {
+				return upstreams, c.Err("an upstream with placeholders can't have a canary")
+			}
+			if upstream.HealthCheck.Path != "" {
+				return upstreams, c.Err("an upstream with placeholders can't be health checked")
+			}
+			if len(upstream.allowHosts) == 0 {
+				return upstreams, c.Err("an upstream with placeholders needs allow_hosts")
+			}
+			d, err := newDynamicTarget(upstream.from, to[0], upstream.allowHosts, upstream.maxTargets, upstream.newDynamicHost)
+			if err != nil {
+				return upstreams, c.Err(err.Error())
+			}
+			upstream.dynamic = d
+			upstreams = append(upstreams, upstream)
+			continue
+		}
+		for _, host := range append(to[:len(to):len(to)], canaryTo...) {
+			if isTemplate(host) {
+				return upstreams, c.Errf("upstream '%s' has placeholders, so it must be the only one", host)
+			}
+		}
+		for _, pool := range pools {
+			for _, host := range pool[1:] {
+				if isTemplate(host) {
+					return upstreams, c.Errf("upstream '%s' has placeholders, so it can't be in a pool", host)
+				}
+			}
+		}
+		if upstream.allowHosts != nil || upstream.maxTargets != 0 {
+			return upstreams, c.Err("allow_hosts and max_targets need an upstream with placeholders")
+		}
+
+		upstream.Hosts = make([]*UpstreamHost, 0, len(to))
+		for _, host := range to {
 			uh, err := upstream.NewHost(host)
 			if err != nil {
 				return upstreams, err
 			}
-			upstream.Hosts[i] = uh
+			upstream.Hosts = append(upstream.Hosts, uh)
+		}
+		for _, pool := range pools {
+			hosts := make(HostPool, 0, len(pool)-1)
+			for _, host := range pool[1:] {
+				uh, err := upstream.NewHost(host)
+				if err != nil {
+					return upstreams, err
+				}
+				hosts = append(hosts, uh)
+			}
+			upstream.Hosts = append(upstream.Hosts, hosts...)
+			upstream.deployment.addPool(pool[0], hosts)
+		}
+
+		if len(canaryTo) > 0 {
+			cn := upstream.canaryRelease()
+			if cn.name == "" {
+				cn.name = host + upstream.from
+			}
+			cn.stable = upstream.Hosts
+			for _, host := range canaryTo {
+				uh, err := upstream.NewHost(host)
+				if err != nil {
+					return upstreams, err
+				}
+				cn.hosts = append(cn.hosts, uh)
+			}
+			// all hosts are health checked, in a new array, so
+			// that the stable hosts stay as they are
+			upstream.Hosts = append(upstream.Hosts[:len(upstream.Hosts):len(upstream.Hosts)], cn.hosts...)
+		} else if upstream.canary != nil {
+			return upstreams, c.Err("canary properties require canary hosts")
 		}
 
 		if upstream.HealthCheck.Path != "" {
@@ -129,6 +253,9 @@ func NewStaticUpstreams(c caddyfile.Dispenser, host string) ([]Upstream, error)
 			// set up health check upstream host if we have one
 			if host != "" {
 				hostHeader := upstream.upstreamHeaders.Get("Host")
+				if upstream.hostHeader != "" || upstream.hostHeaderUpstream {
+					hostHeader = upstream.hostHeader
+				}
 				if strings.Contains(hostHeader, "{host}") {
 					upstream.HealthCheck.Host = strings.Replace(hostHeader, "{host}", host, -1)
 				}
@@ -161,6 +288,7 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 		Unhealthy:         0,
 		UpstreamHeaders:   u.upstreamHeaders,
 		DownstreamHeaders: u.downstreamHeaders,
+		HeaderPolicy:      u.headerPolicy,
 		CheckDown: func(u *staticUpstream) UpstreamHostDownFunc {
 			return func(uh *UpstreamHost) bool {
 				if atomic.LoadInt32(&uh.Unhealthy) != 0 {
@@ -181,15 +309,50 @@ func (u *staticUpstream) NewHost(host string) (*UpstreamHost, error) {
 		return nil, err
 	}
 
+	if u.hostHeaderUpstream {
+		uh.HostHeader = baseURL.Host
+	} else {
+		uh.HostHeader = u.hostHeader
+	}
+
 	uh.ReverseProxy = NewSingleHostReverseProxy(baseURL, uh.WithoutPathPrefix, u.KeepAlive)
-	if u.insecureSkipVerify {
+	if u.sniFollowsHost && baseURL.Scheme == "https" {
+		uh.ReverseProxy.Transport = &sniTransport{
+			keepalive:          u.KeepAlive,
+			insecureSkipVerify: u.insecureSkipVerify,
+		}
+	} else if u.insecureSkipVerify {
 		uh.ReverseProxy.UseInsecureTransport()
 	}
 
 	return uh, nil
 }
 
+// newDynamicHost returns a new host for name, a target the dynamic
+// upstream resolved to, with a transport, and so connections, of its
+// own, which are closed once idle for dynamicIdleTimeout.
+func (u *staticUpstream) newDynamicHost(name string) (*UpstreamHost, error) {
+	uh, err := u.NewHost(name)
+	if err != nil {
+		return nil, err
+	}
+	if uh.ReverseProxy.Transport == nil {
+		uh.ReverseProxy.Transport = newTransport(u.KeepAlive, nil)
+	}
+	switch transport := uh.ReverseProxy.Transport.(type) {
+	case *http.Transport:
+		transport.IdleConnTimeout = dynamicIdleTimeout
+	case *sniTransport:
+		transport.idleTimeout = dynamicIdleTimeout
+	}
+	return uh, nil
+}
+
 func parseUpstream(u string) ([]string, error) {
+	if isTemplate(u) {
+		// placeholders may be resolved to anything
+		return []string{u}, nil
+	}
 	if !strings.HasPrefix(u, "unix:") {
 		colonIdx := strings.LastIndex(u, ":")
 		protoIdx := strings.Index(u, "://")
@@ -278,6 +441,96 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			return err
 		}
 		u.TryDuration = dur
+	case "serve_stale":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		maxStale, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		if maxStale <= 0 {
+			return c.Err("serve_stale duration must be positive")
+		}
+		var store cachestore.Store = cachestore.NewMemory(defaultStaleEntries)
+		if len(args) == 2 {
+			// the number of responses to keep in memory, or the
+			// URL of a store to share them with other instances
+			if entries, err := strconv.Atoi(args[1]); err == nil {
+				if entries < 1 {
+					return c.Err("serve_stale must keep at least 1 response")
+				}
+				store = cachestore.NewMemory(entries)
+			} else if store, err = cachestore.New(args[1]); err != nil {
+				return c.Err(err.Error())
+			}
+		}
+		u.staleCache = newStaleCache(maxStale, store)
+	case "deployment":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		u.deploy().name = c.Val()
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "rollback":
+		args := c.RemainingArgs()
+		if len(args) < 2 || len(args) > 3 {
+			return c.ArgErr()
+		}
+		window, err := time.ParseDuration(args[0])
+		if err != nil || window <= 0 {
+			return c.Errf("invalid rollback window '%s'", args[0])
+		}
+		rate, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || rate < 0 || rate >= 1 {
+			return c.Errf("invalid rollback error rate '%s'", args[1])
+		}
+		d := u.deploy()
+		d.RollbackWindow, d.RollbackErrorRate = window, rate
+		if len(args) == 3 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < 1 {
+				return c.Errf("invalid rollback minimum of requests '%s'", args[2])
+			}
+			d.RollbackMinRequests = n
+		}
+	case "canary_percent":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil || n < 0 || n > 100 {
+			return c.Errf("invalid canary_percent '%s'", c.Val())
+		}
+		cn := u.canaryRelease()
+		cn.configured, cn.percent = int32(n), int32(n)
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	case "canary_header", "canary_cookie":
+		what := c.Val()
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		args = append(args, "")
+		cn := u.canaryRelease()
+		if what == "canary_header" {
+			cn.Header, cn.HeaderValue = args[0], args[1]
+		} else {
+			cn.Cookie, cn.CookieValue = args[0], args[1]
+		}
+	case "canary_name":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		u.canaryRelease().name = c.Val()
+		if c.NextArg() {
+			return c.ArgErr()
+		}
 	case "try_interval":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -366,6 +619,20 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			}
 		}
 		u.downstreamHeaders.Add(header, value)
+	case "header_allow", "header_deny":
+		what := c.Val()
+		names := c.RemainingArgs()
+		if len(names) == 0 {
+			return c.ArgErr()
+		}
+		if u.headerPolicy == nil {
+			u.headerPolicy = &HeaderPolicy{}
+		}
+		if what == "header_allow" {
+			u.headerPolicy.Allow = append(u.headerPolicy.Allow, names...)
+		} else {
+			u.headerPolicy.Deny = append(u.headerPolicy.Deny, names...)
+		}
 	case "transparent":
 		u.upstreamHeaders.Add("Host", "{host}")
 		u.upstreamHeaders.Add("X-Real-IP", "{remote}")
@@ -399,6 +666,55 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 			return c.ArgErr()
 		}
 		u.KeepAlive = n
+	case "host_header":
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		u.hostHeader, u.hostHeaderUpstream = args[0], false
+		switch args[0] {
+		case "preserve":
+			u.hostHeader = "{host}"
+		case "upstream":
+			u.hostHeader, u.hostHeaderUpstream = "", true
+		}
+	case "sni":
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return c.ArgErr()
+		}
+		switch args[0] {
+		case "host":
+			u.sniFollowsHost = true
+		case "upstream":
+			u.sniFollowsHost = false
+		default:
+			return c.Errf("unknown sni '%s', must be host or upstream", args[0])
+		}
+	case "allow_hosts":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		for _, arg := range args {
+			p, err := parseHostPattern(arg)
+			if err != nil {
+				return c.Err(err.Error())
+			}
+			u.allowHosts = append(u.allowHosts, p)
+		}
+	case "max_targets":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(c.Val())
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return c.Err("max_targets must be at least 1")
+		}
+		u.maxTargets = n
 	default:
 		return c.Errf("unknown property '%s'", c.Val())
 	}
@@ -407,53 +723,59 @@ func parseBlock(c *caddyfile.Dispenser, u *staticUpstream) error {
 
 func (u *staticUpstream) healthCheck() {
 	for _, host := range u.Hosts {
-		hostURL := host.Name
-		if u.HealthCheck.Port != "" {
-			hostURL = replacePort(host.Name, u.HealthCheck.Port)
-		}
-		hostURL += u.HealthCheck.Path
+		u.checkHost(host)
+	}
+}
 
-		unhealthy := func() bool {
-			// set up request, needed to be able to modify headers
-			// possible errors are bad HTTP methods or un-parsable urls
-			req, err := http.NewRequest("GET", hostURL, nil)
-			if err != nil {
-				return true
-			}
-			// set host for request going upstream
-			if u.HealthCheck.Host != "" {
-				req.Host = u.HealthCheck.Host
-			}
-			r, err := u.HealthCheck.Client.Do(req)
-			if err != nil {
-				return true
-			}
-			defer func() {
-				io.Copy(ioutil.Discard, r.Body)
-				r.Body.Close()
-			}()
-			if r.StatusCode < 200 || r.StatusCode >= 400 {
-				return true
-			}
-			if u.HealthCheck.ContentString == "" { // don't check for content string
-				return false
-			}
-			// TODO ReadAll will be replaced if deemed necessary
-			//      See https://github.com/mholt/caddy/pull/1691
-			buf, err := ioutil.ReadAll(r.Body)
-			if err != nil {
-				return true
-			}
-			if bytes.Contains(buf, []byte(u.HealthCheck.ContentString)) {
-				return false
-			}
+// checkHost checks the health of host, marking it unhealthy if it
+// fails the check.
+func (u *staticUpstream) checkHost(host *UpstreamHost) {
+	hostURL := host.Name
+	if u.HealthCheck.Port != "" {
+		hostURL = replacePort(host.Name, u.HealthCheck.Port)
+	}
+	hostURL += u.HealthCheck.Path
+
+	unhealthy := func() bool {
+		// set up request, needed to be able to modify headers
+		// possible errors are bad HTTP methods or un-parsable urls
+		req, err := http.NewRequest("GET", hostURL, nil)
+		if err != nil {
 			return true
+		}
+		// set host for request going upstream
+		if u.HealthCheck.Host != "" {
+			req.Host = u.HealthCheck.Host
+		}
+		r, err := u.HealthCheck.Client.Do(req)
+		if err != nil {
+			return true
+		}
+		defer func() {
+			io.Copy(ioutil.Discard, r.Body)
+			r.Body.Close()
 		}()
-		if unhealthy {
-			atomic.StoreInt32(&host.Unhealthy, 1)
-		} else {
-			atomic.StoreInt32(&host.Unhealthy, 0)
+		if r.StatusCode < 200 || r.StatusCode >= 400 {
+			return true
+		}
+		if u.HealthCheck.ContentString == "" { // don't check for content string
+			return false
 		}
+		// TODO ReadAll will be replaced if deemed necessary
+		//      See https://github.com/mholt/caddy/pull/1691
+		buf, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return true
+		}
+		if bytes.Contains(buf, []byte(u.HealthCheck.ContentString)) {
+			return false
+		}
+		return true
+	}()
+	if unhealthy {
+		atomic.StoreInt32(&host.Unhealthy, 1)
+	} else {
+		atomic.StoreInt32(&host.Unhealthy, 0)
 	}
 }
 
@@ -472,7 +794,20 @@ func (u *staticUpstream) HealthCheckWorker(stop chan struct{}) {
 }
 
 func (u *staticUpstream) Select(r *http.Request) *UpstreamHost {
-	pool := u.Hosts
+	if u.dynamic != nil {
+		return u.dynamic.Select(r)
+	}
+	if u.canary != nil && u.canary.wants(r) {
+		// the stable hosts serve if the canary can't
+		if host := u.selectFrom(u.canary.hosts, r); host != nil {
+			return host
+		}
+	}
+	return u.selectFrom(u.livePool(), r)
+}
+
+// selectFrom selects an available host of pool for r, if any.
+func (u *staticUpstream) selectFrom(pool HostPool, r *http.Request) *UpstreamHost {
 	if len(pool) == 1 {
 		if !pool[0].Available() {
 			return nil
@@ -514,8 +849,45 @@ func (u *staticUpstream) GetTryInterval() time.Duration {
 	return u.TryInterval
 }
 
+// stale returns the cache of responses to serve when no host can,
+// which is nil unless serve_stale is given.
+func (u *staticUpstream) stale() *staleCache {
+	return u.staleCache
+}
+
 func (u *staticUpstream) GetHostCount() int {
-	return len(u.Hosts)
+	return len(u.livePool())
+}
+
+// livePool returns the hosts that requests are sent to: those of the
+// live pool of the deployment, if pools are given, or else all but
+// those of the canary.
+func (u *staticUpstream) livePool() HostPool {
+	if u.deployment != nil {
+		return u.deployment.hosts()
+	}
+	if u.canary != nil {
+		return u.canary.stable
+	}
+	return u.Hosts
+}
+
+// canaryRelease returns the canary of u, which it is given if it has
+// none yet.
+func (u *staticUpstream) canaryRelease() *canary {
+	if u.canary == nil {
+		u.canary = newCanary("")
+	}
+	return u.canary
+}
+
+// deploy returns the deployment of u, which it is given if it has
+// none yet.
+func (u *staticUpstream) deploy() *deployment {
+	if u.deployment == nil {
+		u.deployment = newDeployment("")
+	}
+	return u.deployment
 }
 
 // Stop sends a signal to all goroutines started by this staticUpstream to exit
@@ -523,6 +895,12 @@ func (u *staticUpstream) GetHostCount() int {
 func (u *staticUpstream) Stop() error {
 	close(u.stop)
 	u.wg.Wait()
+	if u.dynamic != nil {
+		u.dynamic.close()
+	}
+	if u.staleCache != nil {
+		u.staleCache.stop()
+	}
 	return nil
 }
 
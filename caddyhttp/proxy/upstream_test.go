@@ -5,11 +5,13 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/mholt/caddy/cachestore"
 	"github.com/mholt/caddy/caddyfile"
 )
 
@@ -300,6 +302,89 @@ func TestParseBlock(t *testing.T) {
 	}
 }
 
+func TestParseBlockHeaderPolicy(t *testing.T) {
+	tests := []struct {
+		config    string
+		shouldErr bool
+		expect    *HeaderPolicy
+	}{
+		{"header_upstream X-Test Tester", false, nil},
+		{"header_allow Accept Content-* \n header_allow Cookie", false, &HeaderPolicy{Allow: []string{"Accept", "Content-*", "Cookie"}}},
+		{"header_deny X-Request-ID X-Internal-*", false, &HeaderPolicy{Deny: []string{"X-Request-ID", "X-Internal-*"}}},
+		{"header_allow Accept \n header_deny Cookie", false, &HeaderPolicy{Allow: []string{"Accept"}, Deny: []string{"Cookie"}}},
+		{"header_allow", true, nil},
+		{"header_deny", true, nil},
+	}
+
+	for i, test := range tests {
+		u := staticUpstream{upstreamHeaders: make(http.Header), downstreamHeaders: make(http.Header)}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(test.config))
+		var err error
+		for c.Next() && err == nil {
+			err = parseBlock(&c, &u)
+		}
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i+1, test.shouldErr, err)
+			continue
+		}
+		if !test.shouldErr && !reflect.DeepEqual(u.headerPolicy, test.expect) {
+			t.Errorf("Test %d: Expected header policy %+v, got %+v", i+1, test.expect, u.headerPolicy)
+		}
+	}
+}
+
+func TestParseBlockServeStale(t *testing.T) {
+	tests := []struct {
+		config         string
+		shouldErr      bool
+		expectMaxStale time.Duration
+		expectEntries  int // 0 for a Redis store
+	}{
+		{"serve_stale 1h", false, time.Hour, defaultStaleEntries},
+		{"serve_stale 10m 50", false, 10 * time.Minute, 50},
+		{"serve_stale", true, 0, 0},
+		{"serve_stale soon", true, 0, 0},
+		{"serve_stale 0s", true, 0, 0},
+		{"serve_stale 1h none", true, 0, 0},
+		{"serve_stale 1h 0", true, 0, 0},
+		{"serve_stale 1h 5 5", true, 0, 0},
+		{"serve_stale 1h redis://localhost:6379/1", false, time.Hour, 0},
+		{"serve_stale 1h bolt://localhost", true, 0, 0},
+	}
+
+	for i, test := range tests {
+		u := staticUpstream{}
+		c := caddyfile.NewDispenser("Testfile", strings.NewReader(test.config))
+		var err error
+		for c.Next() && err == nil {
+			err = parseBlock(&c, &u)
+		}
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i+1, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if u.stale() == nil || u.stale().MaxStale != test.expectMaxStale {
+			t.Errorf("Test %d: Expected %v stale, got %+v", i+1, test.expectMaxStale, u.stale())
+			continue
+		}
+		switch store := u.stale().Store.(type) {
+		case *cachestore.Memory:
+			if store.Max() != test.expectEntries {
+				t.Errorf("Test %d: Expected %d responses in memory, got %d", i+1, test.expectEntries, store.Max())
+			}
+		case *cachestore.Redis:
+			if test.expectEntries != 0 {
+				t.Errorf("Test %d: Expected %d responses in memory, got Redis store", i+1, test.expectEntries)
+			}
+		default:
+			t.Errorf("Test %d: Unexpected store %#v", i+1, store)
+		}
+	}
+}
+
 func TestHealthSetUp(t *testing.T) {
 	// tests for insecure skip verify
 	tests := []struct {
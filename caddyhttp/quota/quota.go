@@ -0,0 +1,306 @@
+// Package quota is middleware that enforces daily and monthly quotas
+// of requests and bandwidth per API key, keeping the counters in a
+// cache store so that they outlive restarts and can be shared by
+// several Caddy instances.
+package quota
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var exceeded = metrics.NewCounter("caddy_http_quota_exceeded_total",
+	"Number of requests refused because a quota was used up, by kind of quota.",
+	"kind")
+
+// Quota is middleware that enforces quotas.
+type Quota struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (q Quota) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range q.Rules {
+		if rule.matches(r.URL.Path) {
+			return rule.serve(q.Next, w, r)
+		}
+	}
+	return q.Next.ServeHTTP(w, r)
+}
+
+// Period is how long a quota lasts before it starts over.
+type Period int
+
+// Periods of quotas, which start over at midnight UTC and on the
+// first day of the month.
+const (
+	Day Period = iota
+	Month
+)
+
+func (p Period) String() string {
+	if p == Month {
+		return "month"
+	}
+	return "day"
+}
+
+// bounds returns the name and the end of the period that t is in.
+func (p Period) bounds(t time.Time) (string, time.Time) {
+	t = t.UTC()
+	if p == Month {
+		return t.Format("2006-01"), time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t.Format("2006-01-02"), time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Limit is a quota of requests, or of bytes of responses, per Period.
+type Limit struct {
+	Bandwidth bool
+	Max       int64
+	Period    Period
+}
+
+// usage is how much of the quotas of a key has been used in a period.
+type usage struct {
+	Requests, Bytes int64
+}
+
+// Rule enforces quotas on requests for Paths that have an API key in
+// the header Header or the query parameter Query. Requests without
+// one are not counted; making sure they have one is up to other
+// middleware.
+type Rule struct {
+	Paths  []string
+	Header string // the name of the header with the key, if not Query
+	Query  string // the name of the query parameter with the key
+	Limits []Limit
+	Store  cachestore.Store
+
+	// scope sets the counters of the rule apart from those of
+	// other rules in the same store.
+	scope string
+
+	// locks serialize the updates of the counters of each key,
+	// without those of other keys waiting on the store.
+	locks [lockStripes]sync.Mutex
+}
+
+// lockStripes is how many locks the keys of a rule share.
+const lockStripes = 64
+
+// lock returns the lock of the counters of key.
+func (rule *Rule) lock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &rule.locks[h.Sum32()%lockStripes]
+}
+
+func (rule *Rule) matches(urlPath string) bool {
+	for _, p := range rule.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the API key of r, if any.
+func (rule *Rule) key(r *http.Request) string {
+	if rule.Header != "" {
+		return r.Header.Get(rule.Header)
+	}
+	return r.URL.Query().Get(rule.Query)
+}
+
+func (rule *Rule) serve(next httpserver.Handler, w http.ResponseWriter, r *http.Request) (int, error) {
+	key := rule.key(r)
+	if key == "" {
+		return next.ServeHTTP(w, r)
+	}
+	t := now()
+
+	used, over, err := rule.admit(key, t)
+	if err == cachestore.ErrFull {
+		// too many keys are counted already to count this one,
+		// which is likelier to be made up than used before
+		return next.ServeHTTP(w, r)
+	}
+	if err != nil {
+		// the quota is not worth refusing requests over
+		log.Printf("[ERROR] quota: %v", err)
+		return next.ServeHTTP(w, r)
+	}
+	if over != nil {
+		_, end := over.Period.bounds(t)
+		reset := strconv.FormatInt(int64(end.Sub(t)/time.Second)+1, 10)
+		w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(over.Max, 10))
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", reset)
+		w.Header().Set("Retry-After", reset)
+		kind := "requests"
+		if over.Bandwidth {
+			kind = "bandwidth"
+		}
+		exceeded.Inc(kind)
+		return http.StatusTooManyRequests, nil
+	}
+	rule.setHeaders(w, used, t)
+
+	if !rule.metersBandwidth() {
+		return next.ServeHTTP(w, r)
+	}
+	rec := httpserver.NewResponseRecorder(w)
+	status, err := next.ServeHTTP(rec, r)
+	if n := rec.Size(); n > 0 {
+		if err := rule.addBytes(key, t, int64(n)); err != nil {
+			log.Printf("[ERROR] quota: %v", err)
+		}
+	}
+	return status, err
+}
+
+// setHeaders describes the request quota with the fewest requests
+// remaining, if there is one, in the headers of w.
+func (rule *Rule) setHeaders(w http.ResponseWriter, used map[Period]usage, t time.Time) {
+	var tightest *Limit
+	var remaining int64
+	for i, l := range rule.Limits {
+		if l.Bandwidth {
+			continue
+		}
+		left := l.Max - used[l.Period].Requests
+		if tightest == nil || left < remaining {
+			tightest, remaining = &rule.Limits[i], left
+		}
+	}
+	if tightest == nil {
+		return
+	}
+	_, end := tightest.Period.bounds(t)
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(tightest.Max, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(end.Sub(t)/time.Second)+1, 10))
+}
+
+func (rule *Rule) metersBandwidth() bool {
+	for _, l := range rule.Limits {
+		if l.Bandwidth {
+			return true
+		}
+	}
+	return false
+}
+
+// periods returns the periods the rule has quotas for.
+func (rule *Rule) periods() []Period {
+	var day, month bool
+	for _, l := range rule.Limits {
+		day = day || l.Period == Day
+		month = month || l.Period == Month
+	}
+	var periods []Period
+	if day {
+		periods = append(periods, Day)
+	}
+	if month {
+		periods = append(periods, Month)
+	}
+	return periods
+}
+
+// admit counts a request with key at t, unless a quota is used up,
+// which it returns. It returns how much of the quotas is used.
+func (rule *Rule) admit(key string, t time.Time) (map[Period]usage, *Limit, error) {
+	mu := rule.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	used := make(map[Period]usage)
+	for _, p := range rule.periods() {
+		u, err := rule.load(key, p, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		used[p] = u
+	}
+	for i, l := range rule.Limits {
+		u := used[l.Period]
+		if (!l.Bandwidth && u.Requests >= l.Max) || (l.Bandwidth && u.Bytes >= l.Max) {
+			return used, &rule.Limits[i], nil
+		}
+	}
+	for p, u := range used {
+		u.Requests++
+		used[p] = u
+		if err := rule.save(key, p, t, u); err != nil {
+			return nil, nil, err
+		}
+	}
+	return used, nil, nil
+}
+
+// addBytes counts n bytes sent in response to a request with key at t.
+func (rule *Rule) addBytes(key string, t time.Time, n int64) error {
+	mu := rule.lock(key)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range rule.periods() {
+		u, err := rule.load(key, p, t)
+		if err != nil {
+			return err
+		}
+		u.Bytes += n
+		if err := rule.save(key, p, t, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeKey returns where the counters of key for the period that t
+// is in are stored. The key is hashed so that it isn't stored.
+func (rule *Rule) storeKey(key string, p Period, t time.Time) string {
+	name, _ := p.bounds(t)
+	sum := sha256.Sum256([]byte(rule.scope + "\x00" + key))
+	return "quota:" + hex.EncodeToString(sum[:16]) + ":" + name
+}
+
+func (rule *Rule) load(key string, p Period, t time.Time) (usage, error) {
+	var u usage
+	value, err := rule.Store.Get(rule.storeKey(key, p, t))
+	if err == cachestore.ErrNotFound {
+		return u, nil
+	}
+	if err != nil {
+		return u, err
+	}
+	if _, err := fmt.Sscanf(string(value), "%d %d", &u.Requests, &u.Bytes); err != nil {
+		return usage{}, fmt.Errorf("bad counters %q: %v", value, err)
+	}
+	return u, nil
+}
+
+func (rule *Rule) save(key string, p Period, t time.Time, u usage) error {
+	_, end := p.bounds(t)
+	// keep the counters a little past the end of the period, in
+	// case the clocks of instances that share them differ
+	ttl := end.Sub(t) + time.Hour
+	value := fmt.Sprintf("%d %d", u.Requests, u.Bytes)
+	return rule.Store.Set(rule.storeKey(key, p, t), []byte(value), ttl)
+}
+
+// now is the clock of quotas; tests replace it.
+var now = time.Now
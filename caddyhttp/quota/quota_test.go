@@ -0,0 +1,204 @@
+package quota
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+func newQuota(limits ...Limit) Quota {
+	return Quota{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write([]byte("0123456789"))
+			return http.StatusOK, nil
+		}),
+		Rules: []*Rule{{
+			Paths:  []string{"/api"},
+			Header: DefaultHeader,
+			Limits: limits,
+			Store:  cachestore.NewMemory(100),
+			scope:  "test",
+		}},
+	}
+}
+
+func request(q Quota, path, key string) (*httptest.ResponseRecorder, int) {
+	req := httptest.NewRequest("GET", path, nil)
+	if key != "" {
+		req.Header.Set(DefaultHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	status, _ := q.ServeHTTP(rec, req)
+	return rec, status
+}
+
+func TestRequestQuota(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2026, 10, 15, 23, 59, 0, 0, time.UTC) }
+
+	q := newQuota(Limit{Max: 5, Period: Month}, Limit{Max: 2, Period: Day})
+
+	for i := 1; i <= 2; i++ {
+		rec, status := request(q, "/api/items", "alice")
+		if status != http.StatusOK {
+			t.Fatalf("Request %d: expected status %d, got %d", i, http.StatusOK, status)
+		}
+		if got, want := rec.Header().Get("X-RateLimit-Remaining"), []string{"1", "0"}[i-1]; got != want {
+			t.Errorf("Request %d: expected %s requests remaining, got %s", i, want, got)
+		}
+		if got, want := rec.Header().Get("X-RateLimit-Limit"), "2"; got != want {
+			t.Errorf("Request %d: expected the daily limit, got %s", i, got)
+		}
+	}
+	rec, status := request(q, "/api/items", "alice")
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d once the quota is used up, got %d", http.StatusTooManyRequests, status)
+	}
+	if got, want := rec.Header().Get("Retry-After"), "61"; got != want {
+		t.Errorf("Expected Retry-After %s, got %s", want, got)
+	}
+
+	// others have quotas of their own, and paths outside the rule are free
+	if _, status := request(q, "/api/items", "bob"); status != http.StatusOK {
+		t.Errorf("Expected another key to be allowed, got %d", status)
+	}
+	if _, status := request(q, "/public", "alice"); status != http.StatusOK {
+		t.Errorf("Expected a path without quota to be allowed, got %d", status)
+	}
+	if _, status := request(q, "/api/items", ""); status != http.StatusOK {
+		t.Errorf("Expected a request without a key to be allowed, got %d", status)
+	}
+
+	// the next days, the daily quota starts over but not the monthly one
+	for day := 16; day <= 17; day++ {
+		day := day
+		now = func() time.Time { return time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC) }
+		for i := 0; i < 2; i++ {
+			request(q, "/api/items", "alice")
+		}
+	}
+	rec, status = request(q, "/api/items", "alice")
+	if status != http.StatusTooManyRequests || rec.Header().Get("X-RateLimit-Limit") != "5" {
+		t.Errorf("Expected the monthly quota to be used up, got %d with limit %s", status, rec.Header().Get("X-RateLimit-Limit"))
+	}
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `caddy_http_quota_exceeded_total{kind="requests"}`) {
+		t.Errorf("Expected refusals to be counted, got:\n%s", buf.String())
+	}
+}
+
+func TestBandwidthQuota(t *testing.T) {
+	q := newQuota(Limit{Bandwidth: true, Max: 25, Period: Day})
+
+	for i := 0; i < 3; i++ {
+		if _, status := request(q, "/api", "alice"); status != http.StatusOK {
+			t.Fatalf("Request %d: expected status %d, got %d", i, http.StatusOK, status)
+		}
+	}
+	// 30 bytes have been sent, more than the 25 allowed
+	if _, status := request(q, "/api", "alice"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d once the bandwidth is used up, got %d", http.StatusTooManyRequests, status)
+	}
+}
+
+func TestQueryKey(t *testing.T) {
+	q := newQuota(Limit{Max: 1, Period: Day})
+	q.Rules[0].Header, q.Rules[0].Query = "", "api_key"
+
+	if _, status := request(q, "/api?api_key=alice", ""); status != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, status)
+	}
+	if _, status := request(q, "/api?api_key=alice", ""); status != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, status)
+	}
+}
+
+func TestStoreKey(t *testing.T) {
+	rule := &Rule{scope: "test"}
+	at := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	day := rule.storeKey("secret", Day, at)
+	if strings.Contains(day, "secret") || !strings.HasSuffix(day, ":2026-10-15") {
+		t.Errorf("Unexpected store key %s", day)
+	}
+	if month := rule.storeKey("secret", Month, at); !strings.HasSuffix(month, ":2026-10") {
+		t.Errorf("Unexpected store key %s", month)
+	}
+	other := &Rule{scope: "other"}
+	if other.storeKey("secret", Day, at) == day {
+		t.Error("Expected the keys of rules to differ")
+	}
+}
+
+func TestFullStore(t *testing.T) {
+	q := newQuota(Limit{Max: 1, Period: Day})
+	q.Rules[0].Store = cachestore.NewBoundedMemory(1)
+
+	if _, status := request(q, "/api", "alice"); status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+	}
+	// a flood of new keys doesn't evict the counters of alice
+	for _, key := range []string{"mallory1", "mallory2"} {
+		if _, status := request(q, "/api", key); status != http.StatusOK {
+			t.Errorf("Expected a key not counted to be let through, got status %d", status)
+		}
+	}
+	if _, status := request(q, "/api", "alice"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, status)
+	}
+}
+
+// slowStore is a store whose Get waits for release for the key
+// "slow".
+type slowStore struct {
+	cachestore.Store
+	release chan struct{}
+}
+
+func (s slowStore) Get(key string) ([]byte, error) {
+	if strings.Contains(key, s.slowKey()) {
+		<-s.release
+	}
+	return s.Store.Get(key)
+}
+
+func (s slowStore) slowKey() string {
+	return strings.Split((&Rule{scope: "test"}).storeKey("slow", Day, now()), ":")[1]
+}
+
+func TestKeysDontWait(t *testing.T) {
+	q := newQuota(Limit{Max: 10, Period: Day})
+	store := slowStore{Store: cachestore.NewMemory(100), release: make(chan struct{})}
+	q.Rules[0].Store = store
+	// a key that shares no lock with slow
+	other := "other"
+	for q.Rules[0].lock(other) == q.Rules[0].lock("slow") {
+		other += "x"
+	}
+
+	done := make(chan struct{})
+	go func() {
+		request(q, "/api", "slow")
+		close(done)
+	}()
+	finished := make(chan struct{})
+	go func() {
+		request(q, "/api", other)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Error("Expected a request with another key not to wait for the store")
+	}
+	close(store.release)
+	<-done
+}
@@ -0,0 +1,164 @@
+package quota
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("quota", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// DefaultHeader is the header with the API key when no other
+// is given.
+const DefaultHeader = "X-API-Key"
+
+// setup configures a new Quota middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := quotaParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	for _, rule := range rules {
+		rule.scope = cfg.Addr.String() + " " + strings.Join(rule.Paths, " ")
+	}
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Quota{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// DefaultMaxCounters is how many counters, of a key in a period, the
+// memory store of quotas keeps.
+const DefaultMaxCounters = 100000
+
+// stores are the stores of counters by URL, "" being the default
+// one in memory. Like the counters, they outlive reloads.
+var (
+	stores   = make(map[string]cachestore.Store)
+	storesMu sync.Mutex
+)
+
+// storeFor returns the store of rawurl, making it if it's new. Stores
+// in memory don't evict counters for those of new keys.
+func storeFor(rawurl string) (cachestore.Store, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[rawurl]; ok {
+		return s, nil
+	}
+	var s cachestore.Store = cachestore.NewBoundedMemory(DefaultMaxCounters)
+	if rawurl != "" {
+		var err error
+		if s, err = cachestore.New(rawurl); err != nil {
+			return nil, err
+		}
+		if m, ok := s.(*cachestore.Memory); ok {
+			s = cachestore.NewBoundedMemory(m.Max())
+		}
+	}
+	stores[rawurl] = s
+	return s, nil
+}
+
+// quotaParse parses
+//
+//	quota [paths...] {
+//		key       header|query name
+//		requests  count day|month
+//		bandwidth size day|month
+//		store     url
+//	}
+//
+// where the key is in the X-API-Key header by default, sizes are
+// like 10GB, and the store is any cache store, in memory by default.
+// Quotas start over at midnight UTC and on the first of the month.
+func quotaParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Paths: c.RemainingArgs(), Header: DefaultHeader}
+		if len(rule.Paths) == 0 {
+			rule.Paths = []string{"/"}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "key":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "header":
+					rule.Header, rule.Query = args[1], ""
+				case "query":
+					rule.Header, rule.Query = "", args[1]
+				default:
+					return nil, c.Errf("quota key must be in a header or query parameter, not '%s'", args[0])
+				}
+			case "requests", "bandwidth":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				l := Limit{Bandwidth: what == "bandwidth"}
+				if l.Bandwidth {
+					size, err := humanize.ParseBytes(args[0])
+					if err != nil || size == 0 {
+						return nil, c.Errf("Bad quota bandwidth '%s'", args[0])
+					}
+					l.Max = int64(size)
+				} else {
+					n, err := strconv.ParseInt(args[0], 10, 64)
+					if err != nil || n <= 0 {
+						return nil, c.Errf("Bad quota requests '%s'", args[0])
+					}
+					l.Max = n
+				}
+				switch args[1] {
+				case "day":
+					l.Period = Day
+				case "month":
+					l.Period = Month
+				default:
+					return nil, c.Errf("quota period must be day or month, not '%s'", args[1])
+				}
+				rule.Limits = append(rule.Limits, l)
+			case "store":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				store, err := storeFor(args[0])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				rule.Store = store
+			default:
+				return nil, c.Errf("Unknown quota property '%s'", what)
+			}
+		}
+
+		if len(rule.Limits) == 0 {
+			return nil, c.Err("quota needs requests or bandwidth")
+		}
+		if rule.Store == nil {
+			rule.Store, _ = storeFor("")
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
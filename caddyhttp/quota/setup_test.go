@@ -0,0 +1,135 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `quota {
+		requests 1000 day
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Quota)
+	if !ok {
+		t.Fatalf("Expected handler to be type Quota, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if myHandler.Rules[0].scope == "" {
+		t.Error("Expected the rule to be scoped to the site")
+	}
+}
+
+func TestQuotaParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		paths     []string
+		header    string
+		query     string
+		limits    []Limit
+	}{
+		{`quota {
+			requests 1000 day
+		}`, false, []string{"/"}, DefaultHeader, "", []Limit{{Max: 1000, Period: Day}}},
+		{`quota /api /v2 {
+			key query api_key
+			requests 20000 month
+			bandwidth 1GB day
+			store memory
+		}`, false, []string{"/api", "/v2"}, "", "api_key", []Limit{{Max: 20000, Period: Month}, {Bandwidth: true, Max: 1000000000, Period: Day}}},
+		{`quota {
+			key header Authorization
+			bandwidth 10MB month
+		}`, false, []string{"/"}, "Authorization", "", []Limit{{Bandwidth: true, Max: 10000000, Period: Month}}},
+		{`quota`, true, nil, "", "", nil},
+		{`quota {
+			requests 0 day
+		}`, true, nil, "", "", nil},
+		{`quota {
+			requests 10 week
+		}`, true, nil, "", "", nil},
+		{`quota {
+			bandwidth lots day
+		}`, true, nil, "", "", nil},
+		{`quota {
+			requests 10
+		}`, true, nil, "", "", nil},
+		{`quota {
+			key cookie id
+			requests 10 day
+		}`, true, nil, "", "", nil},
+		{`quota {
+			requests 10 day
+			store nowhere://
+		}`, true, nil, "", "", nil},
+		{`quota {
+			requests 10 day
+			foo
+		}`, true, nil, "", "", nil},
+	}
+	for i, test := range tests {
+		rules, err := quotaParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr || err != nil {
+			continue
+		}
+		rule := rules[0]
+		if len(rule.Paths) != len(test.paths) || rule.Paths[0] != test.paths[0] {
+			t.Errorf("Test %d: expected paths %v, got %v", i, test.paths, rule.Paths)
+		}
+		if rule.Header != test.header || rule.Query != test.query {
+			t.Errorf("Test %d: expected key in header %q or query %q, got %q and %q", i, test.header, test.query, rule.Header, rule.Query)
+		}
+		if len(rule.Limits) != len(test.limits) {
+			t.Fatalf("Test %d: expected %d limits, got %d", i, len(test.limits), len(rule.Limits))
+		}
+		for j, l := range rule.Limits {
+			if l != test.limits[j] {
+				t.Errorf("Test %d: expected limit %d to be %+v, got %+v", i, j, test.limits[j], l)
+			}
+		}
+		if rule.Store == nil {
+			t.Errorf("Test %d: expected a store", i)
+		}
+	}
+}
+
+func TestSetupKeepsStores(t *testing.T) {
+	rules := func(input string) []*Rule {
+		rules, err := quotaParse(caddy.NewTestController("http", input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rules
+	}
+	// as on reload
+	if a, b := rules("quota {\n\trequests 10 day\n}"), rules("quota {\n\trequests 20 day\n}"); a[0].Store != b[0].Store {
+		t.Error("Expected the store in memory to be kept on reload")
+	}
+	a, b := rules("quota {\n\trequests 10 day\n\tstore memory://?max=5\n}"), rules("quota {\n\trequests 10 day\n\tstore memory://?max=5\n}")
+	if a[0].Store != b[0].Store {
+		t.Error("Expected the store of a URL to be kept on reload")
+	}
+	if m, ok := a[0].Store.(*cachestore.Memory); !ok || m.Max() != 5 {
+		t.Errorf("Expected a store in memory of 5 counters, got %#v", a[0].Store)
+	}
+}
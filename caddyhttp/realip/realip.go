@@ -0,0 +1,101 @@
+// Package realip implements the real_ip directive, which makes the
+// address of the client behind trusted proxies the RemoteAddr of its
+// requests, so that the logs, placeholders such as {remote} and the
+// middleware that limit or filter clients by address see the client
+// rather than the proxy.
+package realip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// RealIP is middleware that finds the address of the client of each
+// request that comes through trusted proxies.
+type RealIP struct {
+	Next httpserver.Handler
+
+	// Trusted are the networks of the proxies trusted to say who
+	// the client is.
+	Trusted []*net.IPNet
+
+	// Headers are those in which the proxies say it, the first
+	// that a request has being used. A header may list a chain of
+	// proxies, as X-Forwarded-For does.
+	Headers []string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (h RealIP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if client := h.clientIP(r); client != nil {
+		_, port, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			port = "0"
+		}
+		ctx := context.WithValue(r.Context(), httpserver.PeerAddrCtxKey, r.RemoteAddr)
+		r = r.WithContext(ctx)
+		r.RemoteAddr = net.JoinHostPort(client.String(), port)
+	}
+	return h.Next.ServeHTTP(w, r)
+}
+
+// clientIP returns the address of the client of r, or nil if it is
+// the peer, as it is when the peer isn't trusted or doesn't say.
+func (h RealIP) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !h.trusted(peer) {
+		return nil
+	}
+	for _, name := range h.Headers {
+		values := r.Header[name]
+		if len(values) == 0 {
+			continue
+		}
+		// each proxy appends the address it got the request from,
+		// so the client is the last of them that isn't a trusted
+		// proxy itself; if all are, the first is as close as it gets
+		hops := strings.Split(strings.Join(values, ","), ",")
+		var client net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := parseHop(hops[i])
+			if ip == nil {
+				// a client can write anything before its address;
+				// what a trusted proxy wrote after it still counts
+				break
+			}
+			client = ip
+			if !h.trusted(ip) {
+				break
+			}
+		}
+		return client
+	}
+	return nil
+}
+
+// trusted returns whether ip is that of a trusted proxy.
+func (h RealIP) trusted(ip net.IP) bool {
+	for _, network := range h.Trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHop parses an address in a header, which may have a port.
+func parseHop(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
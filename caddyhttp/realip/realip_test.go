@@ -0,0 +1,70 @@
+package realip
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRealIP(t *testing.T) {
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	_, cloudflare, _ := net.ParseCIDR("173.245.48.0/20")
+
+	tests := []struct {
+		remote     string
+		headers    map[string][]string
+		expect     string // RemoteAddr
+		expectPeer string // {peer}
+	}{
+		// untrusted peers can't say who the client is
+		{"192.0.2.1:1234", map[string][]string{"X-Forwarded-For": {"198.51.100.7"}}, "192.0.2.1:1234", "192.0.2.1"},
+		// trusted peers can
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"198.51.100.7"}}, "198.51.100.7:1234", "10.0.0.1"},
+		// but not without saying it
+		{"10.0.0.1:1234", nil, "10.0.0.1:1234", "10.0.0.1"},
+		// the client is the last hop that isn't trusted, not what it says
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"203.0.113.9, 198.51.100.7, 10.0.0.2"}}, "198.51.100.7:1234", "10.0.0.1"},
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"203.0.113.9", "198.51.100.7"}}, "198.51.100.7:1234", "10.0.0.1"},
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"garbage, 198.51.100.7"}}, "198.51.100.7:1234", "10.0.0.1"},
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"garbage"}}, "10.0.0.1:1234", "10.0.0.1"},
+		// ports and IPv6
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"198.51.100.7:5678"}}, "198.51.100.7:1234", "10.0.0.1"},
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"[2001:db8::1]:5678"}}, "[2001:db8::1]:1234", "10.0.0.1"},
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"2001:db8::1"}}, "[2001:db8::1]:1234", "10.0.0.1"},
+		// if all hops are trusted, the first is as close as it gets
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3:1234", "10.0.0.1"},
+		// the first header given wins
+		{"173.245.48.1:1234", map[string][]string{"Cf-Connecting-Ip": {"198.51.100.7"}, "X-Forwarded-For": {"203.0.113.9"}}, "198.51.100.7:1234", "173.245.48.1"},
+		{"173.245.48.1:1234", map[string][]string{"X-Forwarded-For": {"203.0.113.9"}}, "203.0.113.9:1234", "173.245.48.1"},
+	}
+
+	for i, test := range tests {
+		var gotRemote, gotPeer string
+		h := RealIP{
+			Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				gotRemote = r.RemoteAddr
+				gotPeer = httpserver.NewReplacer(r, nil, "").Replace("{peer}")
+				return http.StatusOK, nil
+			}),
+			Trusted: []*net.IPNet{private, cloudflare},
+			Headers: []string{"Cf-Connecting-Ip", "X-Forwarded-For"},
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remote
+		for name, values := range test.headers {
+			r.Header[name] = values
+		}
+		if _, err := h.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if gotRemote != test.expect {
+			t.Errorf("Test %d: Expected RemoteAddr %s, got %s", i, test.expect, gotRemote)
+		}
+		if gotPeer != test.expectPeer {
+			t.Errorf("Test %d: Expected {peer} %s, got %s", i, test.expectPeer, gotPeer)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package realip
+
+import (
+	"net/http"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("real_ip", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// privateNetworks are the networks that "private" stands for.
+var privateNetworks = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "fc00::/7", "::1/128"}
+
+// setup configures a new RealIP middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	handler, proxyProtocol, err := realIPParse(c)
+	if err != nil {
+		return err
+	}
+	if proxyProtocol {
+		cfg.ProxyProtocol = append(cfg.ProxyProtocol, handler.Trusted...)
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return RealIP{Next: next, Trusted: handler.Trusted, Headers: handler.Headers}
+	})
+
+	return nil
+}
+
+// realIPParse parses
+//
+//	real_ip [networks...] {
+//		from   networks...
+//		header names...
+//		proxy_protocol
+//	}
+//
+// where the networks, given either way, are those of the proxies
+// trusted to say who the client is, "private" standing for all the
+// private ones. The headers, X-Forwarded-For by default, are those
+// they say it in. With proxy_protocol, they may also say it in a
+// PROXY protocol header at the start of each connection.
+func realIPParse(c *caddy.Controller) (RealIP, bool, error) {
+	var handler RealIP
+	var proxyProtocol bool
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return handler, false, c.Err("real_ip may only be given once per site")
+		}
+		parsed = true
+
+		if err := addNetworks(&handler, c.RemainingArgs()); err != nil {
+			return handler, false, c.Err(err.Error())
+		}
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "from":
+				if len(args) == 0 {
+					return handler, false, c.ArgErr()
+				}
+				if err := addNetworks(&handler, args); err != nil {
+					return handler, false, c.Err(err.Error())
+				}
+			case "header":
+				if len(args) == 0 {
+					return handler, false, c.ArgErr()
+				}
+				for _, name := range args {
+					handler.Headers = append(handler.Headers, http.CanonicalHeaderKey(name))
+				}
+			case "proxy_protocol":
+				if len(args) != 0 {
+					return handler, false, c.ArgErr()
+				}
+				proxyProtocol = true
+			default:
+				return handler, false, c.Errf("Unknown real_ip property '%s'", what)
+			}
+		}
+		if len(handler.Trusted) == 0 {
+			return handler, false, c.Err("real_ip needs the networks of the trusted proxies")
+		}
+	}
+
+	if len(handler.Headers) == 0 {
+		handler.Headers = []string{"X-Forwarded-For"}
+	}
+	return handler, proxyProtocol, nil
+}
+
+// addNetworks adds the networks of args to the trusted ones of h.
+func addNetworks(h *RealIP, args []string) error {
+	for _, arg := range args {
+		if arg == "private" {
+			if err := addNetworks(h, privateNetworks); err != nil {
+				return err
+			}
+			continue
+		}
+		network, err := httpserver.ParseNetwork(arg)
+		if err != nil {
+			return err
+		}
+		h.Trusted = append(h.Trusted, network)
+	}
+	return nil
+}
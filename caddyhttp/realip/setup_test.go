@@ -0,0 +1,99 @@
+package realip
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `real_ip 10.0.0.0/8 {
+		proxy_protocol
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	cfg := httpserver.GetConfig(c)
+	mids := cfg.Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(RealIP)
+	if !ok {
+		t.Fatalf("Expected handler to be type RealIP, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if len(cfg.ProxyProtocol) != 1 || cfg.ProxyProtocol[0].String() != "10.0.0.0/8" {
+		t.Errorf("Expected PROXY protocol from 10.0.0.0/8, got %v", cfg.ProxyProtocol)
+	}
+}
+
+func TestRealIPParse(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		trusted       []string
+		headers       []string
+		proxyProtocol bool
+	}{
+		{`real_ip 10.0.0.1`, false, []string{"10.0.0.1/32"}, []string{"X-Forwarded-For"}, false},
+		{`real_ip 10.0.0.0/8 2001:db8::/32`, false, []string{"10.0.0.0/8", "2001:db8::/32"}, []string{"X-Forwarded-For"}, false},
+		{`real_ip {
+			from   173.245.48.0/20
+			from   103.21.244.0/22
+			header cf-connecting-ip
+		}`, false, []string{"173.245.48.0/20", "103.21.244.0/22"}, []string{"Cf-Connecting-Ip"}, false},
+		{`real_ip private {
+			header X-Real-IP X-Forwarded-For
+			proxy_protocol
+		}`, false, []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "fc00::/7", "::1/128"}, []string{"X-Real-Ip", "X-Forwarded-For"}, true},
+		{`real_ip`, true, nil, nil, false},
+		{`real_ip {
+			header X-Real-IP
+		}`, true, nil, nil, false},
+		{`real_ip 10.0.0.256`, true, nil, nil, false},
+		{`real_ip 10.0.0.0/8 {
+			from
+		}`, true, nil, nil, false},
+		{`real_ip 10.0.0.0/8 {
+			header
+		}`, true, nil, nil, false},
+		{`real_ip 10.0.0.0/8 {
+			proxy_protocol v2
+		}`, true, nil, nil, false},
+		{`real_ip 10.0.0.0/8 {
+			hops 2
+		}`, true, nil, nil, false},
+		{"real_ip 10.0.0.0/8\nreal_ip 192.168.0.0/16", true, nil, nil, false},
+	}
+
+	for i, test := range tests {
+		handler, proxyProtocol, err := realIPParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		var trusted []string
+		for _, network := range handler.Trusted {
+			trusted = append(trusted, network.String())
+		}
+		if !reflect.DeepEqual(trusted, test.trusted) {
+			t.Errorf("Test %d: Expected trusted %v, got %v", i, test.trusted, trusted)
+		}
+		if !reflect.DeepEqual(handler.Headers, test.headers) {
+			t.Errorf("Test %d: Expected headers %v, got %v", i, test.headers, handler.Headers)
+		}
+		if proxyProtocol != test.proxyProtocol {
+			t.Errorf("Test %d: Expected proxy_protocol %v, got %v", i, test.proxyProtocol, proxyProtocol)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package recovery implements the recover directive, which recovers
+// from the panics of the handlers of a site at the top of its chain:
+// it logs each with its stack, counts it in the metrics registry,
+// responds with an error page and may emit an event for it.
+package recovery
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Recover is middleware that recovers from panics.
+type Recover struct {
+	Next httpserver.Handler
+	Site string
+
+	// Status is that of the response to a request whose handler
+	// panicked, and Page, if not nil, its body, of PageType.
+	Status   int
+	Page     []byte
+	PageType string
+
+	// Event is whether to emit caddy.PanicEvent.
+	Event bool
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (h Recover) ServeHTTP(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	rw := &recoverWriter{ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w}}
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		p := httpserver.RecoverPanic(h.Site, r, rec)
+		if h.Event {
+			go caddy.EmitEvent(caddy.PanicEvent, p)
+		}
+		if rw.wroteHeader {
+			// the response can't be replaced; cut it short, so that
+			// it isn't taken for all of it
+			panic(http.ErrAbortHandler)
+		}
+		h.respond(w, r)
+		status, err = 0, nil
+	}()
+	return h.Next.ServeHTTP(rw, r)
+}
+
+// respond writes the response to a request whose handler panicked.
+func (h Recover) respond(w http.ResponseWriter, r *http.Request) {
+	// drop whatever the handler set for its own response
+	for name := range w.Header() {
+		delete(w.Header(), name)
+	}
+	if h.Page == nil {
+		httpserver.DefaultErrorFunc(w, r, h.Status)
+		return
+	}
+	w.Header().Set("Content-Type", h.PageType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(h.Page)))
+	w.WriteHeader(h.Status)
+	w.Write(h.Page)
+}
+
+// recoverWriter records whether the response has begun.
+type recoverWriter struct {
+	*httpserver.ResponseWriterWrapper
+	wroteHeader bool
+}
+
+// WriteHeader writes the header of the response.
+func (rw *recoverWriter) WriteHeader(status int) {
+	rw.wroteHeader = true
+	rw.ResponseWriterWrapper.WriteHeader(status)
+}
+
+// Write writes the body of the response.
+func (rw *recoverWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriterWrapper.Write(b)
+}
@@ -0,0 +1,91 @@
+package recovery
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	events := make(chan interface{}, 1)
+	unsubscribe := caddy.Subscribe(caddy.PanicEvent, func(info interface{}) error {
+		events <- info
+		return nil
+	})
+	defer unsubscribe()
+
+	h := Recover{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("X-Half-Done", "yes")
+			panic("oops")
+		}),
+		Site:     "recover.test:80",
+		Status:   http.StatusServiceUnavailable,
+		Page:     []byte("<h1>Oops</h1>"),
+		PageType: "text/html; charset=utf-8",
+		Event:    true,
+	}
+	rec := httptest.NewRecorder()
+	status, err := h.ServeHTTP(rec, httptest.NewRequest("GET", "/page", nil))
+
+	if status != 0 || err != nil {
+		t.Errorf("Expected the response to be written, got %d, %v", status, err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "<h1>Oops</h1>" {
+		t.Errorf("Expected the page with status 503, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Half-Done") != "" {
+		t.Errorf("Expected the headers of the handler to be dropped, got %v", rec.Header())
+	}
+	if !strings.Contains(buf.String(), "[PANIC] recover.test:80 GET example.com/page") ||
+		!strings.Contains(buf.String(), "recovery_test.go") {
+		t.Errorf("Expected the panic and its stack to be logged, got %q", buf.String())
+	}
+
+	select {
+	case info := <-events:
+		if p, ok := info.(*httpserver.Panic); !ok || p.Value != "oops" {
+			t.Errorf("Expected the panic as the info of the event, got %#v", info)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected a panic event")
+	}
+}
+
+func TestRecoverAfterWriting(t *testing.T) {
+	log.SetOutput(&bytes.Buffer{})
+	defer log.SetOutput(os.Stderr)
+
+	h := Recover{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write([]byte("half"))
+			panic("oops")
+		}),
+		Status: http.StatusInternalServerError,
+	}
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("Expected the response to be aborted, got %v", rec)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestRecoverNoPanic(t *testing.T) {
+	h := Recover{Next: httpserver.EmptyNext, Status: http.StatusInternalServerError}
+	if status, err := h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); status != 0 || err != nil {
+		t.Errorf("Expected the status and error of the next handler, got %d, %v", status, err)
+	}
+}
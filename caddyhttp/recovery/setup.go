@@ -0,0 +1,105 @@
+package recovery
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("recover", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Recover middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	handler, err := recoverParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+	handler.Site = cfg.Addr.String()
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		h := handler
+		h.Next = next
+		return h
+	})
+
+	return nil
+}
+
+// recoverParse parses
+//
+//	recover {
+//		status code
+//		page   file
+//		event
+//	}
+//
+// where status, 500 by default, is that of the response to requests
+// whose handlers panic, and the page, relative to root, its body.
+// With event, caddy.PanicEvent is emitted for each panic.
+func recoverParse(c *caddy.Controller, root string) (Recover, error) {
+	handler := Recover{Status: http.StatusInternalServerError}
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return handler, c.Err("recover may only be given once per site")
+		}
+		parsed = true
+		if len(c.RemainingArgs()) != 0 {
+			return handler, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "status":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				status, err := strconv.Atoi(args[0])
+				if err != nil || status < 400 || status > 599 {
+					return handler, c.Errf("Invalid recover status '%s'; must be an error status", args[0])
+				}
+				handler.Status = status
+			case "page":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				file := args[0]
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(root, file)
+				}
+				page, err := ioutil.ReadFile(file)
+				if err != nil {
+					return handler, c.Errf("Unable to read recover page: %v", err)
+				}
+				handler.Page = page
+				handler.PageType = mime.TypeByExtension(filepath.Ext(file))
+				if handler.PageType == "" {
+					handler.PageType = http.DetectContentType(page)
+				}
+			case "event":
+				if len(args) != 0 {
+					return handler, c.ArgErr()
+				}
+				handler.Event = true
+			default:
+				return handler, c.Errf("Unknown recover property '%s'", what)
+			}
+		}
+	}
+
+	return handler, nil
+}
@@ -0,0 +1,91 @@
+package recovery
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `recover`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Recover)
+	if !ok {
+		t.Fatalf("Expected handler to be type Recover, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if myHandler.Status != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 by default, got %d", myHandler.Status)
+	}
+}
+
+func TestRecoverParse(t *testing.T) {
+	root, err := ioutil.TempDir("", "recover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "oops.html"), []byte("<h1>Oops</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expect    Recover
+	}{
+		{`recover`, false, Recover{Status: 500}},
+		{`recover {
+			status 503
+			page   oops.html
+			event
+		}`, false, Recover{Status: 503, Page: []byte("<h1>Oops</h1>"), PageType: "text/html; charset=utf-8", Event: true}},
+		{`recover on`, true, Recover{}},
+		{`recover {
+			status 200
+		}`, true, Recover{}},
+		{`recover {
+			status
+		}`, true, Recover{}},
+		{`recover {
+			page missing.html
+		}`, true, Recover{}},
+		{`recover {
+			event now
+		}`, true, Recover{}},
+		{`recover {
+			stack off
+		}`, true, Recover{}},
+		{"recover\nrecover", true, Recover{}},
+	}
+
+	for i, test := range tests {
+		handler, err := recoverParse(caddy.NewTestController("http", test.input), root)
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if handler.Status != test.expect.Status || string(handler.Page) != string(test.expect.Page) ||
+			handler.PageType != test.expect.PageType || handler.Event != test.expect.Event {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expect, handler)
+		}
+	}
+}
@@ -12,8 +12,9 @@ import (
 
 // Redirect is middleware to respond with HTTP redirects
 type Redirect struct {
-	Next  httpserver.Handler
-	Rules []Rule
+	Next   httpserver.Handler
+	Rules  []Rule
+	Tables []*Table
 }
 
 // ServeHTTP implements the httpserver.Handler interface.
@@ -30,6 +31,15 @@ func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 			return 0, nil
 		}
 	}
+	for _, table := range rd.Tables {
+		if !table.Match(r) {
+			continue
+		}
+		if to, code, ok := table.Redirect(r); ok {
+			http.Redirect(w, r, to, code)
+			return 0, nil
+		}
+	}
 	return rd.Next.ServeHTTP(w, r)
 }
 
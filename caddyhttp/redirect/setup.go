@@ -16,20 +16,21 @@ func init() {
 
 // setup configures a new Redirect middleware instance.
 func setup(c *caddy.Controller) error {
-	rules, err := redirParse(c)
+	rules, tables, err := redirParse(c)
 	if err != nil {
 		return err
 	}
 
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return Redirect{Next: next, Rules: rules}
+		return Redirect{Next: next, Rules: rules, Tables: tables}
 	})
 
 	return nil
 }
 
-func redirParse(c *caddy.Controller) ([]Rule, error) {
+func redirParse(c *caddy.Controller) ([]Rule, []*Table, error) {
 	var redirects []Rule
+	var tables []*Table
 
 	cfg := httpserver.GetConfig(c)
 
@@ -103,7 +104,7 @@ func redirParse(c *caddy.Controller) ([]Rule, error) {
 		args := c.RemainingArgs()
 		matcher, err := httpserver.SetupIfMatcher(c)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		var hadOptionalBlock bool
@@ -114,27 +115,37 @@ func redirParse(c *caddy.Controller) ([]Rule, error) {
 
 			hadOptionalBlock = true
 
-			rule := Rule{
-				RequestMatcher: matcher,
-			}
-
 			defaultCode := initDefaultCode
 			// Set initial redirect code
 			if len(args) == 1 {
 				defaultCode = args[0]
 			}
 
+			if c.Val() == "table" {
+				table, err := tableParse(c, defaultCode)
+				if err != nil {
+					return redirects, tables, err
+				}
+				table.RequestMatcher = matcher
+				tables = append(tables, table)
+				continue
+			}
+
+			rule := Rule{
+				RequestMatcher: matcher,
+			}
+
 			// RemainingArgs only gets the values after the current token, but in our
 			// case we want to include the current token to get an accurate count.
 			insideArgs := append([]string{c.Val()}, c.RemainingArgs()...)
 			err := initRule(&rule, defaultCode, insideArgs)
 			if err != nil {
-				return redirects, err
+				return redirects, tables, err
 			}
 
 			err = checkAndSaveRule(rule)
 			if err != nil {
-				return redirects, err
+				return redirects, tables, err
 			}
 		}
 
@@ -144,17 +155,45 @@ func redirParse(c *caddy.Controller) ([]Rule, error) {
 			}
 			err := initRule(&rule, initDefaultCode, args)
 			if err != nil {
-				return redirects, err
+				return redirects, tables, err
 			}
 
 			err = checkAndSaveRule(rule)
 			if err != nil {
-				return redirects, err
+				return redirects, tables, err
 			}
 		}
 	}
 
-	return redirects, nil
+	return redirects, tables, nil
+}
+
+// tableParse parses a table of redirects:
+//
+//	table <file> [keep_query]
+//
+// Redirects of the table without a status code get defaultCode.
+func tableParse(c *caddy.Controller, defaultCode string) (*Table, error) {
+	args := c.RemainingArgs()
+	if len(args) < 1 || len(args) > 2 {
+		return nil, c.ArgErr()
+	}
+	code, ok := httpRedirs[defaultCode]
+	if !ok {
+		return nil, c.Errf("Invalid redirect code '%v'", defaultCode)
+	}
+	table, err := LoadTable(args[0])
+	if err != nil {
+		return nil, c.Errf("Loading redirect table: %v", err)
+	}
+	table.Code = code
+	if len(args) == 2 {
+		if args[1] != "keep_query" {
+			return nil, c.Errf("Unknown redirect table option '%s'", args[1])
+		}
+		table.KeepQuery = true
+	}
+	return table, nil
 }
 
 // httpRedirs is a list of supported HTTP redirect codes.
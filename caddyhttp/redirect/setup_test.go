@@ -2,6 +2,9 @@ package redirect
 
 import (
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -93,3 +96,37 @@ func TestSetup(t *testing.T) {
 	}
 
 }
+
+func TestSetupTable(t *testing.T) {
+	file := writeTable(t, "redirects", "/a /b\n/c /d 308\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		code      int
+		keepQuery bool
+	}{
+		{"redir {\n table " + file + "\n}", false, http.StatusMovedPermanently, false},
+		{"redir 302 {\n table " + file + " keep_query\n /x /y\n}", false, http.StatusFound, true},
+		{"redir {\n table\n}", true, 0, false},
+		{"redir {\n table " + file + " keep_path\n}", true, 0, false},
+		{"redir {\n table /nonexistent/file\n}", true, 0, false},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if err != nil && !test.shouldErr {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		} else if err == nil && test.shouldErr {
+			t.Errorf("Test %d: expected an error", i)
+		}
+		if test.shouldErr {
+			continue
+		}
+		mids := httpserver.GetConfig(c).Middleware()
+		tables := mids[len(mids)-1](nil).(Redirect).Tables
+		if len(tables) != 1 || tables[0].Len() != 2 || tables[0].Code != test.code || tables[0].KeepQuery != test.keepQuery {
+			t.Errorf("Test %d: unexpected tables %+v", i, tables)
+		}
+	}
+}
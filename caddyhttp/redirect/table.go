@@ -0,0 +1,266 @@
+package redirect
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Table is a table of redirects read from a file, for sites with
+// too many of them to list in the Caddyfile. Sources are paths,
+// matched exactly; paths that end in /*, which match everything
+// under them; or regular expressions, which start with ~. Exact
+// matches come first, then the first regular expression that
+// matches, in the order of the file, then the longest wildcard.
+//
+// What a wildcard matched, and the groups of a regular expression,
+// are the placeholders {1}, {2} and so on of the target, and named
+// groups are placeholders by their names.
+type Table struct {
+	// File is the file the table was read from.
+	File string
+
+	// Code is the status code of redirects for which the table
+	// has none.
+	Code int
+
+	// KeepQuery is whether the query string of requests is passed
+	// on to the targets of redirects.
+	KeepQuery bool
+
+	httpserver.RequestMatcher
+
+	root    *trieNode
+	regexps []*tableEntry
+	size    int
+}
+
+// tableEntry is a redirect of a table.
+type tableEntry struct {
+	re   *regexp.Regexp // if the source is a regular expression
+	to   string
+	code int
+}
+
+// trieNode is a node of a trie of the segments of paths.
+type trieNode struct {
+	children map[string]*trieNode
+	exact    *tableEntry // for the path that ends here
+	wildcard *tableEntry // for the paths under this one
+}
+
+// insert adds e to the trie for the segments of a path; if wildcard,
+// it is for the paths under it.
+func (n *trieNode) insert(segments []string, wildcard bool, e *tableEntry) bool {
+	for _, seg := range segments {
+		child, ok := n.children[seg]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*trieNode)
+			}
+			child = &trieNode{}
+			n.children[seg] = child
+		}
+		n = child
+	}
+	slot := &n.exact
+	if wildcard {
+		slot = &n.wildcard
+	}
+	if *slot != nil {
+		return false
+	}
+	*slot = e
+	return true
+}
+
+// lookup returns the entry for the path of the segments, what a
+// wildcard matched, if it was one, and whether it was an exact match.
+func (n *trieNode) lookup(segments []string) (*tableEntry, string, bool) {
+	var best *tableEntry
+	var rest string
+	for i, seg := range segments {
+		if n.wildcard != nil {
+			best, rest = n.wildcard, strings.Join(segments[i:], "/")
+		}
+		child, ok := n.children[seg]
+		if !ok {
+			return best, rest, false
+		}
+		n = child
+	}
+	if n.exact != nil {
+		return n.exact, "", true
+	}
+	if n.wildcard != nil {
+		return n.wildcard, "", false
+	}
+	return best, rest, false
+}
+
+// splitPath returns the segments of the path p.
+func splitPath(p string) []string {
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+// Len returns the number of redirects of the table.
+func (t *Table) Len() int {
+	return t.size
+}
+
+// Redirect returns the target and status code of the redirect of r,
+// if there is one.
+func (t *Table) Redirect(r *http.Request) (string, int, bool) {
+	if t.root == nil {
+		return "", 0, false
+	}
+	repl := httpserver.NewReplacer(r, nil, "")
+	e, rest, exact := t.root.lookup(splitPath(r.URL.Path))
+	if !exact {
+		for _, re := range t.regexps {
+			matches := re.re.FindStringSubmatch(r.URL.Path)
+			if matches == nil {
+				continue
+			}
+			for i := 1; i < len(matches); i++ {
+				repl.Set(fmt.Sprint(i), matches[i])
+				if name := re.re.SubexpNames()[i]; name != "" {
+					repl.Set(name, matches[i])
+				}
+			}
+			e, rest = re, ""
+			break
+		}
+	}
+	if e == nil {
+		return "", 0, false
+	}
+	if e.re == nil {
+		repl.Set("1", rest)
+	}
+
+	to := repl.Replace(e.to)
+	if t.KeepQuery && r.URL.RawQuery != "" {
+		if strings.Contains(to, "?") {
+			to += "&" + r.URL.RawQuery
+		} else {
+			to += "?" + r.URL.RawQuery
+		}
+	}
+	code := e.code
+	if code == 0 {
+		code = t.Code
+	}
+	return to, code, true
+}
+
+// LoadTable reads a table of redirects from file. Each line of the
+// file is a redirect: a source, a target and, optionally, a status
+// code, separated by spaces, or by commas if the name of the file
+// ends in .csv. Blank lines and lines that start with # are ignored.
+func LoadTable(file string) (*Table, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &Table{File: file, root: &trieNode{}}
+	var read func() ([]string, error)
+	line := 0
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		cr := csv.NewReader(f)
+		cr.Comment = '#'
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		read = func() ([]string, error) {
+			fields, err := cr.Read()
+			if err == nil {
+				line, _ = cr.FieldPos(0)
+			}
+			return fields, err
+		}
+	} else {
+		scanner := bufio.NewScanner(f)
+		read = func() ([]string, error) {
+			for scanner.Scan() {
+				line++
+				text := strings.TrimSpace(scanner.Text())
+				if text != "" && !strings.HasPrefix(text, "#") {
+					return strings.Fields(text), nil
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+	}
+
+	for {
+		fields, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if err := t.add(fields); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+		}
+	}
+	return t, nil
+}
+
+// add adds the redirect of the fields of a line of a table file.
+func (t *Table) add(fields []string) error {
+	if len(fields) < 2 || len(fields) > 3 {
+		return fmt.Errorf("expected a source, a target and an optional status code")
+	}
+	from, to := fields[0], fields[1]
+	e := &tableEntry{to: to}
+	if len(fields) == 3 {
+		code, ok := httpRedirs[fields[2]]
+		if !ok {
+			return fmt.Errorf("invalid redirect code '%v'", fields[2])
+		}
+		e.code = code
+	}
+
+	switch {
+	case strings.HasPrefix(from, "~"):
+		re, err := regexp.Compile(from[1:])
+		if err != nil {
+			return err
+		}
+		e.re = re
+		t.regexps = append(t.regexps, e)
+	case strings.HasPrefix(from, "/"):
+		wildcard := strings.HasSuffix(from, "/*")
+		if wildcard {
+			from = strings.TrimSuffix(from, "/*")
+		}
+		if strings.Contains(from, "*") {
+			return fmt.Errorf("wildcards may only end sources, as in /path/*: %s", fields[0])
+		}
+		var segments []string
+		if from != "" {
+			segments = splitPath(from)
+		}
+		if !t.root.insert(segments, wildcard, e) {
+			return fmt.Errorf("duplicate source %s", fields[0])
+		}
+	default:
+		return fmt.Errorf("source must be a path or a regular expression starting with ~: %s", from)
+	}
+	t.size++
+	return nil
+}
@@ -0,0 +1,112 @@
+package redirect
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func writeTable(t *testing.T, name, body string) string {
+	dir, err := ioutil.TempDir("", "caddy_redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestTable(t *testing.T) {
+	file := writeTable(t, "redirects.csv", `# source,target,code
+/old,/new
+/old/,/new/,302
+/blog/*,/news/{1},308
+/docs/v1/*,/docs/v2/{1}
+/docs/v1/faq,/faq,307
+/*,https://example.com/{1},302
+"~^/p/(?P<id>[0-9]+)$",/products?id={id}
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	table, err := LoadTable(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Code = http.StatusMovedPermanently
+	table.KeepQuery = true
+	if table.Len() != 7 {
+		t.Errorf("Expected 7 redirects, got %d", table.Len())
+	}
+	re := Redirect{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Tables: []*Table{table},
+	}
+	table.RequestMatcher = httpserver.IfMatcher{}
+
+	for i, test := range []struct {
+		from             string
+		expectedLocation string
+		expectedCode     int
+	}{
+		{"/old", "/new", http.StatusMovedPermanently},
+		{"/old/", "/new/", http.StatusFound},
+		{"/old?a=1", "/new?a=1", http.StatusMovedPermanently},
+		{"/blog", "/news/", http.StatusPermanentRedirect},
+		{"/blog/2018/post", "/news/2018/post", http.StatusPermanentRedirect},
+		{"/docs/v1/intro", "/docs/v2/intro", http.StatusMovedPermanently},
+		{"/docs/v1/faq", "/faq", http.StatusTemporaryRedirect},
+		{"/docs/v1/faq/more", "/docs/v2/faq/more", http.StatusMovedPermanently},
+		{"/p/42?ref=x", "/products?id=42&ref=x", http.StatusMovedPermanently},
+		{"/other/page", "https://example.com/other/page", http.StatusFound},
+	} {
+		rec := httptest.NewRecorder()
+		re.ServeHTTP(rec, httptest.NewRequest("GET", test.from, nil))
+		if loc := rec.Header().Get("Location"); loc != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location %q, got %q", i, test.expectedLocation, loc)
+		}
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedCode, rec.Code)
+		}
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	file := writeTable(t, "redirects", "# a map of redirects\n\n/a /b 302\n/c/* /d/{1}\n")
+	defer os.RemoveAll(filepath.Dir(file))
+	table, err := LoadTable(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Len() != 2 {
+		t.Errorf("Expected 2 redirects, got %d", table.Len())
+	}
+
+	for i, test := range []struct {
+		name, body, expectedErr string
+	}{
+		{"bad", "/a\n", ":1: expected a source"},
+		{"bad", "/a /b 200\n", "invalid redirect code"},
+		{"bad", "/a /b\n\n/a /c\n", ":3: duplicate source /a"},
+		{"bad", "/a/*/b /c\n", "wildcards may only end sources"},
+		{"bad", "a /c\n", "source must be a path"},
+		{"bad", "~( /c\n", "error parsing regexp"},
+		{"bad.csv", "# comment\n/a,/b\n/a,/c\n", ":3: duplicate source /a"},
+	} {
+		file := writeTable(t, test.name, test.body)
+		_, err := LoadTable(file)
+		os.RemoveAll(filepath.Dir(file))
+		if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("Test %d: Expected error containing %q, got %v", i, test.expectedErr, err)
+		}
+	}
+}
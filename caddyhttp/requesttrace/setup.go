@@ -0,0 +1,59 @@
+// Package requesttrace implements the request_trace directive, which
+// keeps the traces of the last requests to a site, with the time they
+// spent in each handler, for inspection through the admin API.
+package requesttrace
+
+import (
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("request_trace", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup turns on request tracing for a site.
+func setup(c *caddy.Controller) error {
+	size, err := requestTraceParse(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).TraceRequests = size
+	return nil
+}
+
+// requestTraceParse parses
+//
+//	request_trace [size]
+//
+// where size is the number of requests whose traces are kept.
+func requestTraceParse(c *caddy.Controller) (int, error) {
+	size := defaultSize
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return 0, c.Errf("invalid request_trace size '%s'", args[0])
+			}
+			size = n
+		default:
+			return 0, c.ArgErr()
+		}
+		if c.NextBlock() {
+			return 0, c.Errf("unknown property '%s'", c.Val())
+		}
+	}
+	return size, nil
+}
+
+// defaultSize is the number of requests whose traces are kept if
+// not configured.
+const defaultSize = 100
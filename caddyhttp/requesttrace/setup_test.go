@@ -0,0 +1,39 @@
+package requesttrace
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input        string
+		shouldErr    bool
+		expectedSize int
+	}{
+		{`request_trace`, false, defaultSize},
+		{`request_trace 20`, false, 20},
+		{`request_trace 0`, true, 0},
+		{`request_trace many`, true, 0},
+		{`request_trace 1 2`, true, 0},
+		{"request_trace {\n size 5\n}", true, 0},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if size := httpserver.GetConfig(c).TraceRequests; size != test.expectedSize {
+			t.Errorf("Test %d: Expected size %d, got %d", i, test.expectedSize, size)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package response provides middleware that overrides the responses
+// of the rest of the site once they are known: it changes their
+// status, replaces their body with a document and revises their
+// headers, on conditions on their original status and content type,
+// such as to turn the 404 of an upstream into a default document.
+package response
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy/caddyhttp/header"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Response is middleware that overrides responses.
+type Response struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Rule is how the responses that satisfy its conditions, the
+// conditions of its header.Rule, are overridden.
+type Rule struct {
+	header.Rule
+
+	// NewStatus, if not 0, is the status the response is
+	// given instead.
+	NewStatus int
+
+	// Document, if not nil, is the body the response is
+	// given instead, of DocumentType.
+	Document     []byte
+	DocumentType string
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (resp Response) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rules []*Rule
+	for _, rule := range resp.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+		if rule.Matcher != nil && !rule.Matcher.Match(r) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return resp.Next.ServeHTTP(w, r)
+	}
+
+	rw := &responseWriter{
+		ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+		rules:                 rules,
+		replacer:              httpserver.NewReplacer(r, nil, ""),
+		head:                  r.Method == http.MethodHead,
+	}
+	status, err := resp.Next.ServeHTTP(rw, r)
+	if rw.wroteHeader || status < 400 {
+		return status, err
+	}
+
+	// the error would be written further up the chain, unless
+	// the response is overridden here
+	rule := rw.override(status)
+	switch {
+	case rule == nil || rule.NewStatus == 0 && rule.Document == nil:
+		return status, err
+	case rule.Document == nil && rule.NewStatus >= 400:
+		return rule.NewStatus, err
+	}
+	rw.write(rule, status)
+	return 0, nil
+}
+
+// responseWriter overrides the response written to it by the first
+// of the rules that it satisfies.
+type responseWriter struct {
+	*httpserver.ResponseWriterWrapper
+	rules    []*Rule
+	replacer httpserver.Replacer
+	head     bool // whether no body is written
+
+	wroteHeader bool
+	discard     bool // whether the body written is replaced
+}
+
+// override revises the headers of a response of status according to
+// the first rule it satisfies, which it returns, or nil if none.
+func (rw *responseWriter) override(status int) *Rule {
+	h := rw.Header()
+	for _, rule := range rw.rules {
+		if rule.MatchesResponse(h, status) {
+			rule.Apply(h, rw.replacer)
+			return rule
+		}
+	}
+	return nil
+}
+
+// WriteHeader writes the header of the response of status, or of
+// the response that overrides it.
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.wroteHeader {
+		return
+	}
+	if rule := rw.override(status); rule != nil {
+		rw.write(rule, status)
+		return
+	}
+	rw.wroteHeader = true
+	rw.ResponseWriterWrapper.WriteHeader(status)
+}
+
+// write writes the header of the response of status as overridden by
+// rule, and its document if it has one, after which whatever else is
+// written is discarded.
+func (rw *responseWriter) write(rule *Rule, status int) {
+	rw.wroteHeader = true
+	if rule.NewStatus != 0 {
+		status = rule.NewStatus
+	}
+	if rule.Document == nil {
+		rw.ResponseWriterWrapper.WriteHeader(status)
+		return
+	}
+
+	h := rw.Header()
+	for _, name := range []string{"Content-Encoding", "Content-Range", "ETag", "Last-Modified", "Accept-Ranges"} {
+		h.Del(name)
+	}
+	h.Set("Content-Type", rule.DocumentType)
+	h.Set("Content-Length", strconv.Itoa(len(rule.Document)))
+	rw.ResponseWriterWrapper.WriteHeader(status)
+	if !rw.head {
+		rw.ResponseWriterWrapper.Write(rule.Document)
+	}
+	rw.discard = true
+}
+
+// Write writes the body of the response, unless it is replaced.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.discard {
+		return len(b), nil
+	}
+	return rw.ResponseWriterWrapper.Write(b)
+}
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*responseWriter)(nil)
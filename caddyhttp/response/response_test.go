@@ -0,0 +1,123 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/header"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestResponse(t *testing.T) {
+	notFound := &Rule{
+		Rule:         header.Rule{Path: "/", Status: []string{"404"}, Headers: http.Header{"X-Fallback": {"yes"}}},
+		NewStatus:    http.StatusOK,
+		Document:     []byte("index"),
+		DocumentType: "text/html; charset=utf-8",
+	}
+	serverError := &Rule{
+		Rule:      header.Rule{Path: "/", Status: []string{"5xx"}, ContentTypes: []string{"application/json"}},
+		NewStatus: http.StatusBadGateway,
+	}
+	headers := &Rule{
+		Rule: header.Rule{Path: "/", Headers: http.Header{"-Server": {""}, "X-Served-By": {"caddy"}}},
+	}
+	resp := Response{Rules: []*Rule{notFound, serverError, headers}}
+
+	for i, test := range []struct {
+		method        string
+		next          httpserver.HandlerFunc
+		status        int // returned
+		code          int // written
+		body          string
+		expectHeaders map[string]string
+	}{
+		// upstream writes a 404, which becomes the document
+		{"GET", func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Length", "9")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+			return http.StatusNotFound, nil
+		}, http.StatusNotFound, http.StatusOK, "index", map[string]string{
+			"Content-Type": "text/html; charset=utf-8", "Content-Length": "5", "X-Fallback": "yes",
+		}},
+		// a 404 that would be written by the errors middleware
+		{"GET", func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusNotFound, errors.New("missing")
+		}, 0, http.StatusOK, "index", map[string]string{"X-Fallback": "yes"}},
+		// no body for HEAD
+		{"HEAD", func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusNotFound, nil
+		}, 0, http.StatusOK, "", map[string]string{"Content-Length": "5"}},
+		// status rewritten on the content type
+		{"GET", func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{}`))
+			return http.StatusInternalServerError, nil
+		}, http.StatusInternalServerError, http.StatusBadGateway, `{}`, nil},
+		// an error of another content type is left alone
+		{"GET", func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Server", "upstream")
+			w.WriteHeader(http.StatusInternalServerError)
+			return http.StatusInternalServerError, nil
+		}, http.StatusInternalServerError, http.StatusInternalServerError, "", map[string]string{
+			"Server": "", "X-Served-By": "caddy",
+		}},
+		// an unwritten error to be rewritten is returned as the new status
+		{"GET", func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Content-Type", "application/json")
+			return http.StatusServiceUnavailable, errors.New("down")
+		}, http.StatusBadGateway, http.StatusOK, "", nil},
+		// other responses only get the headers
+		{"GET", func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Server", "upstream")
+			w.Write([]byte("ok"))
+			return http.StatusOK, nil
+		}, http.StatusOK, http.StatusOK, "ok", map[string]string{"Server": "", "X-Served-By": "caddy"}},
+	} {
+		resp.Next = test.next
+		r := httptest.NewRequest(test.method, "/page", nil)
+		w := httptest.NewRecorder()
+		status, _ := resp.ServeHTTP(w, r)
+		if status != test.status {
+			t.Errorf("Test %d: Expected returned status %d, got %d", i, test.status, status)
+		}
+		if w.Code != test.code {
+			t.Errorf("Test %d: Expected written status %d, got %d", i, test.code, w.Code)
+		}
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.body, body)
+		}
+		for name, value := range test.expectHeaders {
+			if actual := w.Header().Get(name); actual != value {
+				t.Errorf("Test %d: Expected header %s '%s', got '%s'", i, name, value, actual)
+			}
+		}
+	}
+}
+
+func TestResponsePath(t *testing.T) {
+	resp := Response{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusNotFound, nil
+		}),
+		Rules: []*Rule{{Rule: header.Rule{Path: "/app", Status: []string{"404"}}, NewStatus: http.StatusGone}},
+	}
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{"/app/x", http.StatusGone},
+		{"/other", http.StatusNotFound},
+	} {
+		status, _ := resp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if status != test.status {
+			t.Errorf("%s: Expected status %d, got %d", test.path, test.status, status)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package response
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/header"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("response", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Response middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	rules, err := responseParse(c, cfg.Root)
+	if err != nil {
+		return err
+	}
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Response{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// responseParse parses
+//
+//	response [path] {
+//		if              a cond b
+//		if_status       codes...
+//		if_content_type types...
+//		status          code
+//		document        file
+//		header          [+|-|?]name [value]
+//		header          ~name regexp replacement
+//	}
+//
+// where the conditions are on the request, and on the status and
+// Content-Type of the response from the rest of the site; the
+// document, relative to root, replaces the body of the response,
+// whose status stays the same unless status changes it.
+func responseParse(c *caddy.Controller, root string) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Rule: header.Rule{Path: "/", Headers: http.Header{}}}
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return nil, c.ArgErr()
+		}
+
+		matcher, err := httpserver.SetupIfMatcher(c)
+		if err != nil {
+			return nil, err
+		}
+
+		for c.NextBlock() {
+			if httpserver.IfMatcherKeyword(c) {
+				rule.Matcher = matcher
+				continue
+			}
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "if_status":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, status := range args {
+					if !header.ValidStatus(status) {
+						return nil, c.Errf("Invalid status '%s'", status)
+					}
+				}
+				rule.Status = append(rule.Status, args...)
+			case "if_content_type":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, ct := range args {
+					rule.ContentTypes = append(rule.ContentTypes, strings.ToLower(ct))
+				}
+			case "status":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				code, err := strconv.Atoi(args[0])
+				if err != nil || code < 100 || code > 599 {
+					return nil, c.Errf("Invalid status '%s'", args[0])
+				}
+				rule.NewStatus = code
+			case "document":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				file := args[0]
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(root, file)
+				}
+				body, err := ioutil.ReadFile(file)
+				if err != nil {
+					return nil, c.Errf("Unable to read response document: %v", err)
+				}
+				rule.Document = body
+				rule.DocumentType = mime.TypeByExtension(filepath.Ext(file))
+				if rule.DocumentType == "" {
+					rule.DocumentType = http.DetectContentType(body)
+				}
+			case "header":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				name := args[0]
+				if strings.HasPrefix(name, "~") {
+					if len(args) != 3 {
+						return nil, c.ArgErr()
+					}
+					repl, err := header.NewReplacement(name, args[1], args[2])
+					if err != nil {
+						return nil, c.Err(err.Error())
+					}
+					rule.Replacements = append(rule.Replacements, repl)
+					continue
+				}
+				if len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				value := ""
+				if len(args) == 2 {
+					value = args[1]
+				}
+				rule.Headers.Add(name, value)
+			default:
+				return nil, c.Errf("Unknown response property '%s'", what)
+			}
+		}
+
+		if rule.NewStatus == 0 && rule.Document == nil && len(rule.Headers) == 0 && len(rule.Replacements) == 0 {
+			return nil, c.Errf("response %s must change the status, document or headers", rule.Path)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
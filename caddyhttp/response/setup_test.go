@@ -0,0 +1,114 @@
+package response
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `response {
+		if_status 404
+		status 200
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Response)
+	if !ok {
+		t.Fatalf("Expected handler to be type Response, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestResponseParse(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_response")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "index.html"), []byte("<h1>Home</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		check     func(*Rule) bool
+	}{
+		{`response /app {
+			if_status 404 5xx
+			if_content_type text/*
+			status 200
+			document index.html
+		}`, false, func(r *Rule) bool {
+			return r.Path == "/app" && len(r.Status) == 2 && r.ContentTypes[0] == "text/*" &&
+				r.NewStatus == 200 && string(r.Document) == "<h1>Home</h1>" &&
+				r.DocumentType == "text/html; charset=utf-8"
+		}},
+		{`response {
+			header X-Served-By caddy
+			header -Server
+			header ~Location ^http://upstream https://example.com
+		}`, false, func(r *Rule) bool {
+			return r.Path == "/" && r.Headers.Get("X-Served-By") == "caddy" &&
+				len(r.Headers["-Server"]) == 1 && len(r.Replacements) == 1
+		}},
+		{`response {
+			if {path} starts_with /api
+			status 503
+		}`, false, func(r *Rule) bool {
+			return r.Matcher != nil && r.NewStatus == 503
+		}},
+		{`response`, true, nil},
+		{`response / /other {
+			status 200
+		}`, true, nil},
+		{`response {
+			if_status 4xy
+			status 200
+		}`, true, nil},
+		{`response {
+			status 700
+		}`, true, nil},
+		{`response {
+			document missing.html
+		}`, true, nil},
+		{`response {
+			header ~Location (
+		}`, true, nil},
+		{`response {
+			header A b c
+		}`, true, nil},
+		{`response {
+			foo
+		}`, true, nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		rules, err := responseParse(c, root)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(rules) != 1 || !test.check(rules[0]) {
+			t.Errorf("Test %d: Unexpected rules %+v", i, rules)
+		}
+	}
+}
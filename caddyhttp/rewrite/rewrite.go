@@ -166,7 +166,8 @@ func (r ComplexRule) Rewrite(fs http.FileSystem, req *http.Request) (re Result)
 			// no match
 			return
 		default:
-			// set regexp match variables {1}, {2} ...
+			// set regexp match variables {1}, {2} ..., and
+			// those of named groups, such as {name}
 
 			// url escaped values of ? and #.
 			q, f := url.QueryEscape("?"), url.QueryEscape("#")
@@ -179,6 +180,9 @@ func (r ComplexRule) Rewrite(fs http.FileSystem, req *http.Request) (re Result)
 				}
 
 				replacer.Set(fmt.Sprint(i), matches[i])
+				if name := r.Regexp.SubexpNames()[i]; name != "" {
+					replacer.Set(name, matches[i])
+				}
 			}
 		}
 	}
@@ -37,6 +37,7 @@ func TestRewrite(t *testing.T) {
 		{"/reg2grp", `(.*)`, "/{1}", ""},
 		{"/reg3grp", `(.*)/(.*)/(.*)`, "/{1}{2}{3}", ""},
 		{"/hashtest", "(.*)", "/{1}", ""},
+		{"/named", `/(?P<user>[a-z]+)/(?P<page>[0-9]+)`, "/u/{user}?page={page}&n={2}", ""},
 	}
 
 	for _, regexpRule := range regexps {
@@ -98,6 +99,7 @@ func TestRewrite(t *testing.T) {
 		{"/hashtest/a%20%23%20test", "/a%20%23%20test"},
 		{"/hashtest/a%20%3F%20test", "/a%20%3F%20test"},
 		{"/hashtest/a%20%3F%23test", "/a%20%3F%23test"},
+		{"/named/alice/42", "/u/alice?page=42&n=42"},
 	}
 
 	for i, test := range tests {
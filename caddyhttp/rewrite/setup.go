@@ -1,7 +1,6 @@
 package rewrite
 
 import (
-	"net/http"
 	"strings"
 
 	"github.com/mholt/caddy"
@@ -27,7 +26,7 @@ func setup(c *caddy.Controller) error {
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		return Rewrite{
 			Next:    next,
-			FileSys: http.Dir(cfg.Root),
+			FileSys: cfg.FileSystem(),
 			Rules:   rewrites,
 		}
 	})
@@ -2,10 +2,15 @@ package root
 
 import (
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/objectstore"
 )
 
 func init() {
@@ -23,30 +28,119 @@ func setupRoot(c *caddy.Controller) error {
 			return c.ArgErr()
 		}
 		config.Root = c.Val()
-		if c.NextArg() {
-			// only one argument allowed
-			return c.ArgErr()
+		config.RootFS = nil
+		// the root may be an archive, served as it is,
+		// or a bucket of object storage
+		var bucket *objectstore.Bucket
+		if strings.HasPrefix(config.Root, httpserver.ArchivePrefix) {
+			config.Root = strings.TrimPrefix(config.Root, httpserver.ArchivePrefix)
+			archive, err := httpserver.OpenArchive(config.Root)
+			if err != nil {
+				return c.Errf("Unable to open root archive '%s': %v", config.Root, err)
+			}
+			config.RootFS = archive
+		} else if objectstore.IsLocation(config.Root) {
+			var err error
+			bucket, err = objectstore.NewBucket(config.Root)
+			if err != nil {
+				return c.Errf("Invalid root bucket: %v", err)
+			}
+			config.RootFS = bucket
+		}
+		// any further arguments are fallback roots,
+		// searched in order for files missing from root
+		config.FallbackRoots = c.RemainingArgs()
+		for _, root := range config.FallbackRoots {
+			if strings.HasPrefix(root, httpserver.ArchivePrefix) || objectstore.IsLocation(root) {
+				return c.Errf("Fallback root '%s' can't be an archive or bucket; only the first root can", root)
+			}
+		}
+		for c.NextBlock() {
+			if bucket == nil {
+				return c.Errf("Root properties are only for buckets, not '%s'", config.Root)
+			}
+			if err := parseBucketProperty(c, bucket); err != nil {
+				return err
+			}
+		}
+	}
+
+	roots := config.FallbackRoots
+	if config.RootFS == nil {
+		roots = append([]string{config.Root}, roots...)
+	}
+	for _, root := range roots {
+		if err := checkRoot(root); err != nil {
+			return c.Errf("Unable to access root path '%s': %v", root, err)
+		}
+	}
+
+	return nil
+}
+
+// parseBucketProperty parses a property of the block of a root
+// that is a bucket into bucket.
+func parseBucketProperty(c *caddy.Controller, bucket *objectstore.Bucket) error {
+	property := c.Val()
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return c.ArgErr()
+	}
+	switch property {
+	case "region":
+		bucket.Region = args[0]
+	case "endpoint":
+		endpoint, err := url.Parse(args[0])
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return c.Errf("Invalid bucket endpoint '%s'", args[0])
 		}
+		bucket.Endpoint = endpoint
+	case "access_key":
+		bucket.Credentials.AccessKeyID = args[0]
+	case "secret_key":
+		bucket.Credentials.SecretAccessKey = args[0]
+	case "session_token":
+		bucket.Credentials.SessionToken = args[0]
+	case "metadata_ttl":
+		ttl, err := time.ParseDuration(args[0])
+		if err != nil || ttl < 0 {
+			return c.Errf("Invalid metadata_ttl '%s'", args[0])
+		}
+		bucket.MetadataTTL = ttl
+	case "content_cache":
+		size, err := humanize.ParseBytes(args[0])
+		if err != nil {
+			return c.Errf("Invalid content_cache size '%s': %v", args[0], err)
+		}
+		bucket.ContentCache = int64(size)
+	default:
+		return c.Errf("Unknown root property '%s'", property)
 	}
+	return nil
+}
+
+// checkRoot makes sure root is usable, logging a warning if
+// it does not (yet) exist.
+func checkRoot(root string) error {
 	//first check that the path is not a symlink, os.Stat panics when this is true
-	info, _ := os.Lstat(config.Root)
+	info, _ := os.Lstat(root)
 	if info != nil && info.Mode()&os.ModeSymlink == os.ModeSymlink {
 		//just print out info, delegate responsibility for symlink validity to
 		//underlying Go framework, no need to test / verify twice
-		log.Printf("[INFO] Root path is symlink: %s", config.Root)
-	} else {
-		// Check if root path exists
-		_, err := os.Stat(config.Root)
-		if err != nil {
-			if os.IsNotExist(err) {
-				// Allow this, because the folder might appear later.
-				// But make sure the user knows!
-				log.Printf("[WARNING] Root path does not exist: %s", config.Root)
-			} else {
-				return c.Errf("Unable to access root path '%s': %v", config.Root, err)
-			}
-		}
+		log.Printf("[INFO] Root path is symlink: %s", root)
+		return nil
 	}
 
+	// Check if root path exists
+	_, err := os.Stat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Allow this, because the folder might appear later.
+			// But make sure the user knows!
+			log.Printf("[WARNING] Root path does not exist: %s", root)
+			return nil
+		}
+		return err
+	}
 	return nil
 }
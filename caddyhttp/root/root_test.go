@@ -1,15 +1,18 @@
 package root
 
 import (
+	"archive/zip"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/objectstore"
 )
 
 func TestRoot(t *testing.T) {
@@ -48,15 +51,18 @@ func TestRoot(t *testing.T) {
 		{
 			fmt.Sprintf(`root %s`, existingDirPath), false, existingDirPath, "",
 		},
+		{
+			fmt.Sprintf(`root %s %s`, existingDirPath, nonExistingDir), false, existingDirPath, "",
+		},
 		// negative
 		{
 			`root `, true, "", parseErrContent,
 		},
 		{
-			`root /a /b`, true, "", parseErrContent,
+			fmt.Sprintf(`root %s`, inaccessiblePath), true, "", unableToAccessErrContent,
 		},
 		{
-			fmt.Sprintf(`root %s`, inaccessiblePath), true, "", unableToAccessErrContent,
+			fmt.Sprintf(`root %s %s`, existingDirPath, inaccessiblePath), true, "", unableToAccessErrContent,
 		},
 		{
 			fmt.Sprintf(`root {
@@ -91,6 +97,108 @@ func TestRoot(t *testing.T) {
 	}
 }
 
+func TestArchiveRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "root_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "site.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("index.html")
+	w.Write([]byte("home"))
+	zw.Close()
+	f.Close()
+
+	for i, test := range []struct {
+		input              string
+		expectedErrContent string
+	}{
+		{"root archive:" + archive, ""},
+		{"root archive:" + archive + " " + dir, ""},
+		{"root archive:" + filepath.Join(dir, "missing.zip"), "Unable to open root archive"},
+		{"root archive:" + dir, "Unable to open root archive"},
+		{"root " + dir + " archive:" + archive, "can't be an archive"},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupRoot(c)
+		cfg := httpserver.GetConfig(c)
+		if test.expectedErrContent != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErrContent) {
+				t.Errorf("Test %d: Expected error containing '%s', got %v", i, test.expectedErrContent, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if _, ok := cfg.RootFS.(*httpserver.Archive); cfg.Root != archive || !ok {
+			t.Errorf("Test %d: Expected root archive %s, got root %s (%v)", i, archive, cfg.Root, cfg.RootFS)
+			continue
+		}
+		if _, err := cfg.FileSystem().Open("/index.html"); err != nil {
+			t.Errorf("Test %d: Expected index.html to be served from the archive, got %v", i, err)
+		}
+	}
+}
+
+func TestBucketRoot(t *testing.T) {
+	for i, test := range []struct {
+		input              string
+		expectedErrContent string
+		check              func(*objectstore.Bucket) bool
+	}{
+		{"root s3://site/www", "", func(b *objectstore.Bucket) bool {
+			return b.Name == "site" && b.Prefix == "www/" && b.MetadataTTL == objectstore.DefaultMetadataTTL
+		}},
+		{`root gs://site {
+			access_key GOOG1
+			secret_key shh
+			metadata_ttl 30s
+			content_cache 64MB
+		}`, "", func(b *objectstore.Bucket) bool {
+			return b.Credentials.AccessKeyID == "GOOG1" && b.Credentials.SecretAccessKey == "shh" &&
+				b.MetadataTTL == 30*time.Second && b.ContentCache == 64000000
+		}},
+		{`root s3://site {
+			region eu-west-1
+			endpoint http://localhost:9000
+		}`, "", func(b *objectstore.Bucket) bool {
+			return b.Region == "eu-west-1" && b.Endpoint.Host == "localhost:9000"
+		}},
+		{"root s3://site {\nendpoint localhost\n}", "Invalid bucket endpoint", nil},
+		{"root s3://site {\nmetadata_ttl soon\n}", "Invalid metadata_ttl", nil},
+		{"root s3://site {\ncontent_cache lots\n}", "Invalid content_cache", nil},
+		{"root s3://site {\nregion\n}", "Wrong argument count", nil},
+		{"root s3://site {\nbucket other\n}", "Unknown root property", nil},
+		{"root s3:///www", "Invalid root bucket", nil},
+		{"root " + os.TempDir() + " {\nregion eu-west-1\n}", "only for buckets", nil},
+		{"root " + os.TempDir() + " s3://site", "can't be an archive or bucket", nil},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setupRoot(c)
+		if test.expectedErrContent != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErrContent) {
+				t.Errorf("Test %d: Expected error containing '%s', got %v", i, test.expectedErrContent, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		bucket, ok := httpserver.GetConfig(c).RootFS.(*objectstore.Bucket)
+		if !ok || !test.check(bucket) {
+			t.Errorf("Test %d: Bucket not as expected: %+v", i, bucket)
+		}
+	}
+}
+
 // getTempDirPath returns the path to the system temp directory. If it does not exists - an error is returned.
 func getTempDirPath() (string, error) {
 	tempDir := os.TempDir()
@@ -140,3 +248,17 @@ func TestSymlinkRoot(t *testing.T) {
 		t.Errorf("Test Symlink Root: Expected no error but found one for input %s. Error was: %v", input, err)
 	}
 }
+
+func TestFallbackRoots(t *testing.T) {
+	c := caddy.NewTestController("http", `root /srv/build /srv/src /srv/assets`)
+	if err := setupRoot(c); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	cfg := httpserver.GetConfig(c)
+	if cfg.Root != "/srv/build" {
+		t.Errorf("Expected root /srv/build, got %s", cfg.Root)
+	}
+	if len(cfg.FallbackRoots) != 2 || cfg.FallbackRoots[0] != "/srv/src" || cfg.FallbackRoots[1] != "/srv/assets" {
+		t.Errorf("Expected fallback roots [/srv/src /srv/assets], got %v", cfg.FallbackRoots)
+	}
+}
@@ -0,0 +1,64 @@
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Codec encrypts and authenticates the values of cookies, so that
+// clients can neither read nor forge them.
+type Codec struct {
+	aead cipher.AEAD
+}
+
+// NewCodec returns a codec with a key derived from secret.
+func NewCodec(secret []byte) (*Codec, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Codec{aead: aead}, nil
+}
+
+// Encode returns v encrypted as the value of the cookie name;
+// the name is authenticated too, so that the value of one
+// cookie can't be passed off as that of another.
+func (c *Codec) Encode(name string, v interface{}) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, plain, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode decrypts value, the value of the cookie name, into v.
+func (c *Codec) Decode(name, value string, v interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return errors.New("sessions: cookie value too short")
+	}
+	nonce, sealed := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
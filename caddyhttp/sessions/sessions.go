@@ -0,0 +1,368 @@
+// Package sessions keeps the sessions of users for the middleware
+// that authenticates them, such as oidc. Sessions are kept either
+// entirely in an encrypted cookie, or in a store, which several
+// instances may share, with only their ID in the cookie. They end
+// when they have been idle or have lasted too long, or when they are
+// revoked, and carry a token that protects the forms and APIs of a
+// site from cross-site request forgery.
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/cachestore"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+var (
+	// ErrNoSession is returned when a request has no session, or
+	// its session has ended.
+	ErrNoSession = errors.New("sessions: no session")
+
+	// ErrTooLarge is returned when a session is too large to be
+	// kept in a cookie.
+	ErrTooLarge = errors.New("sessions: session too large for a cookie")
+)
+
+// Session defaults.
+const (
+	DefaultAbsoluteTimeout = 12 * time.Hour
+	DefaultMaxSessions     = 100000
+)
+
+// maxCookieSize is the largest session cookie browsers are sure
+// to keep.
+const maxCookieSize = 4000
+
+// The CSRF token of a session is looked for in the CSRFHeader
+// header of requests, then the CSRFField field of their forms.
+const (
+	CSRFHeader = "X-CSRF-Token"
+	CSRFField  = "csrf_token"
+)
+
+// maxFormSize is the most of a form read to find its CSRF token.
+const maxFormSize = 1 << 20
+
+// Session is the session of a user.
+type Session struct {
+	ID      string
+	Subject string `json:",omitempty"` // who the user is
+	CSRF    string // token that unsafe requests must carry
+	Created time.Time
+	Seen    time.Time       // when last used, roughly
+	Data    json.RawMessage `json:",omitempty"`
+}
+
+// Decode decodes the data of s into v.
+func (s *Session) Decode(v interface{}) error {
+	return json.Unmarshal(s.Data, v)
+}
+
+// Manager starts, loads and ends the sessions of a site.
+type Manager struct {
+	// CookieName is the name of the session cookie.
+	CookieName string
+
+	// IdleTimeout, if not 0, ends sessions that haven't been
+	// used for that long, and AbsoluteTimeout ends them that
+	// long after they started, however much they're used.
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+
+	// InCookie is whether sessions are kept in their cookie, in
+	// which case Store isn't used. Otherwise they're kept in Store
+	// and their cookie has only their ID.
+	InCookie bool
+	Store    cachestore.Store
+
+	// Revocations keeps the revocations of sessions, which, unlike
+	// sessions, mustn't be evicted to make room for others, or the
+	// sessions would be valid again.
+	Revocations cachestore.Store
+
+	codec *Codec
+}
+
+// NewManager returns a manager of sessions kept in the cookie
+// cookieName, encrypted with a key derived from secret. Their
+// revocations are kept in memory, in a store that refuses more once
+// it is full rather than forgetting any.
+func NewManager(cookieName string, secret []byte) (*Manager, error) {
+	codec, err := NewCodec(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		CookieName:      cookieName,
+		AbsoluteTimeout: DefaultAbsoluteTimeout,
+		InCookie:        true,
+		Store:           cachestore.NewMemory(DefaultMaxSessions),
+		Revocations:     cachestore.NewBoundedMemory(DefaultMaxSessions),
+		codec:           codec,
+	}, nil
+}
+
+// Codec returns the codec of the session cookie, so that other
+// cookies can be encrypted with the same secret.
+func (m *Manager) Codec() *Codec {
+	return m.codec
+}
+
+// New returns a new session of subject carrying data, which is
+// started once it is saved.
+func (m *Manager) New(subject string, data interface{}) (*Session, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Session{
+		ID:      randomString(),
+		Subject: subject,
+		CSRF:    randomString(),
+		Created: now,
+		Seen:    now,
+		Data:    raw,
+	}, nil
+}
+
+// Save saves s and sets its cookie.
+func (m *Manager) Save(w http.ResponseWriter, r *http.Request, s *Session) error {
+	remaining := s.Created.Add(m.AbsoluteTimeout).Sub(time.Now())
+	if remaining <= 0 {
+		return ErrNoSession
+	}
+	var v interface{} = s
+	if !m.InCookie {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		ttl := remaining
+		if m.IdleTimeout > 0 && m.IdleTimeout < ttl {
+			ttl = m.IdleTimeout
+		}
+		if err := m.Store.Set(m.key("session", s.ID), b, ttl); err != nil {
+			return err
+		}
+		v = s.ID
+	}
+	value, err := m.codec.Encode(m.CookieName, v)
+	if err != nil {
+		return err
+	}
+	if len(value) > maxCookieSize {
+		return ErrTooLarge
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(remaining / time.Second),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Load returns the session of r, or ErrNoSession if it has none
+// that hasn't ended. It records that the session was used, saving
+// it if it can end by being idle.
+func (m *Manager) Load(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	s, err := m.get(r)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.After(s.Created.Add(m.AbsoluteTimeout)) ||
+		m.IdleTimeout > 0 && now.After(s.Seen.Add(m.IdleTimeout)) {
+		return nil, ErrNoSession
+	}
+	if err := m.checkRevoked(s); err != nil {
+		return nil, err
+	}
+	if m.IdleTimeout > 0 && now.Sub(s.Seen) >= touchInterval(m.IdleTimeout) {
+		s.Seen = now
+		if err := m.Save(w, r, s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// End ends the session of r, if it has one, and removes its cookie.
+func (m *Manager) End(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{Name: m.CookieName, Path: "/", MaxAge: -1})
+	s, err := m.get(r)
+	if err == ErrNoSession {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return m.Revoke(s.ID)
+}
+
+// Revoke ends the session with id.
+func (m *Manager) Revoke(id string) error {
+	if !m.InCookie {
+		return m.Store.Delete(m.key("session", id))
+	}
+	return m.Revocations.Set(m.key("revoked", id), []byte{1}, m.AbsoluteTimeout)
+}
+
+// RevokeSubject ends every session of subject that has started.
+func (m *Manager) RevokeSubject(subject string) error {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return m.Revocations.Set(m.key("revoked-subject", subject), []byte(now), m.AbsoluteTimeout)
+}
+
+// get returns the session in the cookie of r, or of the ID in it.
+func (m *Manager) get(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(m.CookieName)
+	if err != nil {
+		return nil, ErrNoSession
+	}
+	s := new(Session)
+	if m.InCookie {
+		if m.codec.Decode(m.CookieName, cookie.Value, s) != nil {
+			return nil, ErrNoSession
+		}
+		return s, nil
+	}
+	var id string
+	if m.codec.Decode(m.CookieName, cookie.Value, &id) != nil {
+		return nil, ErrNoSession
+	}
+	b, err := m.Store.Get(m.key("session", id))
+	if err == cachestore.ErrNotFound {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil || s.ID != id {
+		return nil, ErrNoSession
+	}
+	return s, nil
+}
+
+// checkRevoked returns ErrNoSession if s has been revoked, or an
+// error if that can't be told.
+func (m *Manager) checkRevoked(s *Session) error {
+	if m.InCookie {
+		_, err := m.Revocations.Get(m.key("revoked", s.ID))
+		if err == nil {
+			return ErrNoSession
+		}
+		if err != cachestore.ErrNotFound {
+			return err
+		}
+	}
+	if s.Subject == "" {
+		return nil
+	}
+	b, err := m.Revocations.Get(m.key("revoked-subject", s.Subject))
+	if err == cachestore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if revoked, err := strconv.ParseInt(string(b), 10, 64); err != nil || !s.Created.After(time.Unix(0, revoked)) {
+		return ErrNoSession
+	}
+	return nil
+}
+
+// key returns the key in the store of what of id; keys start with
+// the cookie name, so that sites can share a store.
+func (m *Manager) key(what, id string) string {
+	return "sessions:" + m.CookieName + ":" + what + ":" + id
+}
+
+// touchInterval is how often the use of sessions that end after
+// idleTimeout is recorded, at most, so that they aren't saved on
+// every request.
+func touchInterval(idleTimeout time.Duration) time.Duration {
+	if d := idleTimeout / 10; d < time.Minute {
+		return d
+	}
+	return time.Minute
+}
+
+// ValidCSRF returns whether r carries the CSRF token of s, in the
+// CSRFHeader header or the CSRFField field of a URL-encoded form,
+// unless its method is safe and so needs none.
+func ValidCSRF(r *http.Request, s *Session) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	token := r.Header.Get(CSRFHeader)
+	if token == "" {
+		token = formValue(r, CSRFField)
+	}
+	return s.ValidToken(token)
+}
+
+// ValidToken returns whether token is the CSRF token of s.
+func (s *Session) ValidToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.CSRF)) == 1
+}
+
+// formValue returns the value of field in the URL-encoded form in
+// the body of r, which it buffers so that it can still be read.
+func formValue(r *http.Request, field string) string {
+	if r.Body == nil {
+		return ""
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/x-www-form-urlencoded" {
+		return ""
+	}
+	b, err := httpserver.BufferBody(r, maxFormSize)
+	if err != nil {
+		return ""
+	}
+	body, err := b.Bytes()
+	if err != nil {
+		return ""
+	}
+	form, _ := url.ParseQuery(string(body))
+	return form.Get(field)
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying s.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext returns the session in ctx, if any.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(ctxKey{}).(*Session)
+	return s, ok
+}
+
+// randomString returns a string of 32 random bytes, encoded to
+// be safe in URLs.
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
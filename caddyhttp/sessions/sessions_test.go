@@ -0,0 +1,205 @@
+package sessions
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/cachestore"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestManager(t *testing.T, inCookie bool) *Manager {
+	m, err := NewManager("session", []byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inCookie {
+		m.InCookie = false
+		m.Store = cachestore.NewMemory(10)
+	}
+	return m
+}
+
+// save saves s and returns a request with its cookie.
+func save(t *testing.T, m *Manager, s *Session) *http.Request {
+	w := httptest.NewRecorder()
+	if err := m.Save(w, httptest.NewRequest("GET", "/", nil), s); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestManager(t *testing.T) {
+	for _, inCookie := range []bool{true, false} {
+		m := newTestManager(t, inCookie)
+		m.IdleTimeout = time.Hour
+
+		s, err := m.New("ann", map[string]string{"role": "admin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := save(t, m, s)
+		loaded, err := m.Load(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("In cookie %t: expected the session, got %v", inCookie, err)
+		}
+		var data map[string]string
+		if err := loaded.Decode(&data); err != nil || data["role"] != "admin" || loaded.ID != s.ID || loaded.CSRF != s.CSRF {
+			t.Errorf("In cookie %t: expected %+v, got %+v (%v)", inCookie, s, loaded, err)
+		}
+
+		// idle and old sessions have ended
+		idle, _ := m.New("ann", nil)
+		idle.Seen = idle.Seen.Add(-2 * time.Hour)
+		if _, err := m.Load(httptest.NewRecorder(), save(t, m, idle)); err != ErrNoSession {
+			t.Errorf("In cookie %t: expected idle session to have ended, got %v", inCookie, err)
+		}
+		old, _ := m.New("ann", nil)
+		old.Created = old.Created.Add(-m.AbsoluteTimeout - time.Minute)
+		if err := m.Save(httptest.NewRecorder(), r, old); err != ErrNoSession {
+			t.Errorf("In cookie %t: expected old session not to be saved, got %v", inCookie, err)
+		}
+
+		// use of sessions is recorded, now and then
+		used, _ := m.New("ann", nil)
+		used.Seen = used.Seen.Add(-30 * time.Minute)
+		w := httptest.NewRecorder()
+		if _, err := m.Load(w, save(t, m, used)); err != nil {
+			t.Fatal(err)
+		}
+		if len(w.Result().Cookies()) != 1 {
+			t.Errorf("In cookie %t: expected session to be saved once used", inCookie)
+		}
+		w = httptest.NewRecorder()
+		m.Load(w, r)
+		if len(w.Result().Cookies()) != 0 {
+			t.Errorf("In cookie %t: expected session not to be saved again so soon", inCookie)
+		}
+
+		// ending a session revokes it
+		w = httptest.NewRecorder()
+		if err := m.End(w, r); err != nil {
+			t.Fatal(err)
+		}
+		if c := w.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+			t.Errorf("In cookie %t: expected cookie to be removed, got %v", inCookie, c)
+		}
+		if _, err := m.Load(httptest.NewRecorder(), r); err != ErrNoSession {
+			t.Errorf("In cookie %t: expected ended session to be revoked, got %v", inCookie, err)
+		}
+
+		// revoking a subject ends the sessions it has started
+		before, _ := m.New("bob", nil)
+		rBefore := save(t, m, before)
+		time.Sleep(time.Millisecond)
+		if err := m.RevokeSubject("bob"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+		after, _ := m.New("bob", nil)
+		rAfter := save(t, m, after)
+		if _, err := m.Load(httptest.NewRecorder(), rBefore); err != ErrNoSession {
+			t.Errorf("In cookie %t: expected session of revoked subject to have ended, got %v", inCookie, err)
+		}
+		if _, err := m.Load(httptest.NewRecorder(), rAfter); err != nil {
+			t.Errorf("In cookie %t: expected later session of revoked subject, got %v", inCookie, err)
+		}
+	}
+}
+
+func TestRevocationsKept(t *testing.T) {
+	m := newTestManager(t, true)
+	m.Revocations = cachestore.NewBoundedMemory(2)
+	s, err := m.New("ann", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := save(t, m, s)
+	if err := m.Revoke(s.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// a flood of revocations doesn't make room by forgetting others
+	for i := 0; i < 3; i++ {
+		other, _ := m.New("", nil)
+		err = m.Revoke(other.ID)
+	}
+	if err != cachestore.ErrFull {
+		t.Errorf("Expected revocations to be refused once full, got %v", err)
+	}
+	if _, err := m.Load(httptest.NewRecorder(), r); err != ErrNoSession {
+		t.Errorf("Expected the revoked session to stay revoked, got %v", err)
+	}
+}
+
+func TestManagerCookies(t *testing.T) {
+	m := newTestManager(t, true)
+	other, err := NewManager("session", []byte(strings.Repeat("x", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := m.New("ann", nil)
+	r := save(t, m, s)
+
+	if _, err := other.Load(httptest.NewRecorder(), r); err != ErrNoSession {
+		t.Errorf("Expected cookie of another secret to be ignored, got %v", err)
+	}
+	renamed := httptest.NewRequest("GET", "/", nil)
+	cookie, _ := r.Cookie("session")
+	renamed.AddCookie(&http.Cookie{Name: "other", Value: cookie.Value})
+	m.CookieName = "other"
+	if _, err := m.Load(httptest.NewRecorder(), renamed); err != ErrNoSession {
+		t.Errorf("Expected value of another cookie to be ignored, got %v", err)
+	}
+	if _, err := m.Load(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); err != ErrNoSession {
+		t.Errorf("Expected no session without a cookie, got %v", err)
+	}
+
+	large, _ := m.New("ann", strings.Repeat("x", maxCookieSize))
+	if err := m.Save(httptest.NewRecorder(), r, large); err != ErrTooLarge {
+		t.Errorf("Expected large session not to fit in a cookie, got %v", err)
+	}
+	m.InCookie = false
+	if err := m.Save(httptest.NewRecorder(), r, large); err != nil {
+		t.Errorf("Expected large session to be kept in the store, got %v", err)
+	}
+}
+
+func TestValidCSRF(t *testing.T) {
+	s := &Session{CSRF: "token"}
+	for i, test := range []struct {
+		method      string
+		header      string
+		contentType string
+		body        string
+		expect      bool
+	}{
+		{"GET", "", "", "", true},
+		{"POST", "token", "", "", true},
+		{"POST", "", "application/x-www-form-urlencoded", url.Values{CSRFField: {"token"}, "a": {"b"}}.Encode(), true},
+		{"POST", "", "application/x-www-form-urlencoded; charset=utf-8", "csrf_token=token", true},
+		{"POST", "", "text/plain", "csrf_token=token", false},
+		{"POST", "wrong", "", "", false},
+		{"DELETE", "", "", "", false},
+	} {
+		r := httptest.NewRequest(test.method, "/", strings.NewReader(test.body))
+		r.Header.Set(CSRFHeader, test.header)
+		r.Header.Set("Content-Type", test.contentType)
+		if got := ValidCSRF(r, s); got != test.expect {
+			t.Errorf("Test %d: expected %t, got %t", i, test.expect, got)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != test.body {
+			t.Errorf("Test %d: expected the body to still be read, got %q", i, body)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package signedurl
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/templates"
+)
+
+func init() {
+	caddy.RegisterPlugin("signed_url", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+	templates.RegisterFunc("signURL", templates.Func{New: signURLFunc})
+}
+
+// minSecretLength is the shortest secret accepted.
+const minSecretLength = 32
+
+// setup configures a new SignedURL middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := signedURLParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	register(cfg.Addr.String(), rules)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SignedURL{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// signedURLParse parses
+//
+//	signed_url paths... {
+//		secret key
+//		bind_ip
+//	}
+//
+// where the secret is at least 32 characters long.
+func signedURLParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Paths: c.RemainingArgs()}
+		if len(rule.Paths) == 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "secret":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if len(c.Val()) < minSecretLength {
+					return nil, c.Errf("signed_url secret must be at least %d characters", minSecretLength)
+				}
+				rule.Secret = []byte(c.Val())
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			case "bind_ip":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				rule.BindIP = true
+			default:
+				return nil, c.Errf("Unknown signed_url property '%s'", c.Val())
+			}
+		}
+
+		if rule.Secret == nil {
+			return nil, c.Err("signed_url requires a secret")
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// signURLFunc returns the signURL template function, which returns
+// a link to a path, signed for the client of ctx, that expires after
+// a duration such as "1h".
+func signURLFunc(ctx httpserver.Context) interface{} {
+	return func(urlPath, ttl string) (string, error) {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return "", err
+		}
+		rules, _ := ctx.Req.Context().Value(rulesCtxKey).([]*Rule)
+		rule := ruleFor(rules, urlPath)
+		if rule == nil {
+			return "", errors.New("signed url: " + urlPath + " is not served through signed links")
+		}
+		return rule.Sign(urlPath, time.Now().Add(d), ctx.IP())
+	}
+}
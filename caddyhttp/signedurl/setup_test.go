@@ -0,0 +1,109 @@
+package signedurl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `signed_url /dl {
+		secret `+testSecret+`
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(SignedURL)
+	if !ok {
+		t.Fatalf("Expected handler to be type SignedURL, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSignedURLParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []*Rule
+	}{
+		{`signed_url /dl {
+			secret ` + testSecret + `
+		}`, false, []*Rule{{Paths: []string{"/dl"}, Secret: []byte(testSecret)}}},
+		{`signed_url /dl /private {
+			secret ` + testSecret + `
+			bind_ip
+		}`, false, []*Rule{{Paths: []string{"/dl", "/private"}, Secret: []byte(testSecret), BindIP: true}}},
+		{`signed_url {
+			secret ` + testSecret + `
+		}`, true, nil},
+		{`signed_url /dl`, true, nil},
+		{`signed_url /dl {
+			secret short
+		}`, true, nil},
+		{`signed_url /dl {
+			secret ` + testSecret + `
+			bind_ip yes
+		}`, true, nil},
+		{`signed_url /dl {
+			secret ` + testSecret + `
+			ttl 1h
+		}`, true, nil},
+	} {
+		rules, err := signedURLParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestSignURLFunc(t *testing.T) {
+	rule := &Rule{Paths: []string{"/private"}, Secret: []byte(testSecret), BindIP: true}
+	var signed string
+	s := SignedURL{Rules: []*Rule{rule}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		ctx := httpserver.NewContextWithHeader(nil)
+		ctx.Req = r
+		var err error
+		signed, err = signURLFunc(ctx).(func(string, string) (string, error))("/private/a.zip", "1h")
+		return 0, err
+	})}
+
+	r := httptest.NewRequest("GET", "/page.html", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if _, err := s.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(signed, "/private/a.zip?expires=") {
+		t.Errorf("Expected a signed link, got %s", signed)
+	}
+
+	r = httptest.NewRequest("GET", signed, nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+	s.Next = httpserver.EmptyNext
+	if code, err := s.ServeHTTP(httptest.NewRecorder(), r); code != 0 || err != nil {
+		t.Errorf("Expected the signed link to be valid, got %d, %v", code, err)
+	}
+}
@@ -0,0 +1,197 @@
+// Package signedurl implements middleware that serves paths only
+// through links signed with a secret, which expire and may be bound
+// to the address of a client, so that time-limited downloads don't
+// need an application server to hand them out.
+package signedurl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// The query parameters of a signed link.
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+// SignedURL is middleware that requires requests for some paths to
+// be signed.
+type SignedURL struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Rule is a set of paths that are served through signed links only,
+// and the secret they are signed with.
+type Rule struct {
+	Paths  []string
+	Secret []byte
+
+	// BindIP is whether links are only valid for the client they
+	// were signed for.
+	BindIP bool
+}
+
+// rulesCtxKey is the context key of the rules of the site a request
+// is for, for the signURL template function.
+const rulesCtxKey = caddy.CtxKey("signed_url_rules")
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s SignedURL) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	urlPath := requestPath(r)
+	for _, rule := range s.Rules {
+		if rule.matches(urlPath) {
+			if err := rule.verify(r, urlPath, time.Now()); err != nil {
+				return http.StatusForbidden, err
+			}
+			break
+		}
+	}
+	r = r.WithContext(context.WithValue(r.Context(), rulesCtxKey, s.Rules))
+	return s.Next.ServeHTTP(w, r)
+}
+
+// requestPath returns the path of r as the client requested it,
+// before any rewrite, since that is the path links are signed for.
+func requestPath(r *http.Request) string {
+	if u, ok := r.Context().Value(httpserver.OriginalURLCtxKey).(url.URL); ok {
+		return u.Path
+	}
+	return r.URL.Path
+}
+
+// matches returns whether urlPath is served through signed links of
+// rule only.
+func (rule *Rule) matches(urlPath string) bool {
+	for _, p := range rule.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors of requests that aren't signed properly.
+var (
+	errUnsigned     = errors.New("signed url: request is not signed")
+	errBadSignature = errors.New("signed url: invalid signature")
+	errExpired      = errors.New("signed url: link expired")
+)
+
+// verify returns why r, for urlPath, is not signed with the secret
+// of rule at now, or nil if it is.
+func (rule *Rule) verify(r *http.Request, urlPath string, now time.Time) error {
+	q := r.URL.Query()
+	expires, sig := q.Get(ExpiresParam), q.Get(SignatureParam)
+	if expires == "" || sig == "" {
+		return errUnsigned
+	}
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return errBadSignature
+	}
+	// the signature is checked first so that a forged link can't
+	// tell anything about the expiry of a real one
+	if !hmac.Equal(given, rule.mac(urlPath, expires, httpserver.ClientIP(r))) {
+		return errBadSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errBadSignature
+	}
+	if now.Unix() > unix {
+		return errExpired
+	}
+	return nil
+}
+
+// mac returns the signature of a link to urlPath that expires at the
+// unix time expires, for the client at ip if links are bound to
+// clients.
+func (rule *Rule) mac(urlPath, expires, ip string) []byte {
+	h := hmac.New(sha256.New, rule.Secret)
+	h.Write([]byte(urlPath + "\n" + expires))
+	if rule.BindIP {
+		h.Write([]byte("\n" + ip))
+	}
+	return h.Sum(nil)
+}
+
+// Sign returns a link to urlPath, signed with the secret of rule,
+// that expires at expires. If rule binds links to clients, the link
+// is only valid for the client at ip.
+func (rule *Rule) Sign(urlPath string, expires time.Time, ip string) (string, error) {
+	if rule.BindIP && net.ParseIP(ip) == nil {
+		return "", errors.New("signed url: links are bound to clients, so an IP address is required")
+	}
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	q := url.Values{}
+	q.Set(ExpiresParam, exp)
+	q.Set(SignatureParam, base64.RawURLEncoding.EncodeToString(rule.mac(urlPath, exp, ip)))
+	u := url.URL{Path: urlPath, RawQuery: q.Encode()}
+	return u.String(), nil
+}
+
+// ruleFor returns the rule of rules that urlPath is served through
+// signed links of, or nil.
+func ruleFor(rules []*Rule, urlPath string) *Rule {
+	for _, rule := range rules {
+		if rule.matches(urlPath) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// siteRules are the rules of sites, by site address, for signing
+// links through the admin API.
+var (
+	siteRules   = make(map[string][]*Rule)
+	siteRulesMu sync.Mutex
+)
+
+// register makes rules the rules of the site with address addr.
+func register(addr string, rules []*Rule) {
+	siteRulesMu.Lock()
+	defer siteRulesMu.Unlock()
+	siteRules[addr] = rules
+}
+
+// Sign returns a link to urlPath on the site with address site,
+// signed with the secret it is served through, that expires after
+// ttl, for the client at ip. The site may be empty if only one site
+// serves urlPath through signed links.
+func Sign(site, urlPath string, ttl time.Duration, ip string) (string, error) {
+	siteRulesMu.Lock()
+	var found *Rule
+	for addr, rules := range siteRules {
+		if site != "" && addr != site {
+			continue
+		}
+		if rule := ruleFor(rules, urlPath); rule != nil {
+			if found != nil {
+				siteRulesMu.Unlock()
+				return "", errors.New("signed url: " + urlPath + " is signed on more than one site; give the site")
+			}
+			found = rule
+		}
+	}
+	siteRulesMu.Unlock()
+	if found == nil {
+		return "", errors.New("signed url: " + urlPath + " is not served through signed links")
+	}
+	return found.Sign(urlPath, time.Now().Add(ttl), ip)
+}
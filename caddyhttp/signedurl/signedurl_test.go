@@ -0,0 +1,93 @@
+package signedurl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestSignedURL(t *testing.T) {
+	rule := &Rule{Paths: []string{"/dl"}, Secret: []byte(testSecret)}
+	bound := &Rule{Paths: []string{"/private"}, Secret: []byte(testSecret), BindIP: true}
+	s := SignedURL{Next: httpserver.EmptyNext, Rules: []*Rule{rule, bound}}
+
+	now := time.Now()
+	sign := func(rule *Rule, urlPath string, expires time.Time, ip string) string {
+		link, err := rule.Sign(urlPath, expires, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link
+	}
+	valid := sign(rule, "/dl/a file.zip", now.Add(time.Hour), "")
+	other := &Rule{Paths: []string{"/dl"}, Secret: []byte(strings.Repeat("x", 32))}
+
+	for i, test := range []struct {
+		target     string
+		remoteAddr string
+		expectCode int
+	}{
+		{"/index.html", "", 0},
+		{valid, "", 0},
+		{valid, "10.0.0.9:1234", 0},
+		{"/dl/a%20file.zip", "", http.StatusForbidden},
+		{strings.Replace(valid, "/a%20file.zip", "/b.zip", 1), "", http.StatusForbidden},
+		{sign(other, "/dl/a.zip", now.Add(time.Hour), ""), "", http.StatusForbidden},
+		{sign(rule, "/dl/a.zip", now.Add(-time.Minute), ""), "", http.StatusForbidden},
+		{"/dl/a.zip?expires=9999999999&signature=%%%", "", http.StatusForbidden},
+		{sign(bound, "/private/a.zip", now.Add(time.Hour), "10.0.0.1"), "10.0.0.1:1234", 0},
+		{sign(bound, "/private/a.zip", now.Add(time.Hour), "10.0.0.1"), "10.0.0.2:1234", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest("GET", test.target, nil)
+		if test.remoteAddr != "" {
+			r.RemoteAddr = test.remoteAddr
+		}
+		code, _ := s.ServeHTTP(httptest.NewRecorder(), r)
+		if code != test.expectCode {
+			t.Errorf("Test %d: expected status %d for %s, got %d", i, test.expectCode, test.target, code)
+		}
+	}
+}
+
+func TestSignedURLRewritten(t *testing.T) {
+	rule := &Rule{Paths: []string{"/dl"}, Secret: []byte(testSecret)}
+	s := SignedURL{Next: httpserver.EmptyNext, Rules: []*Rule{rule}}
+
+	link, _ := rule.Sign("/dl/a.zip", time.Now().Add(time.Hour), "")
+	r := httptest.NewRequest("GET", link, nil)
+	orig := *r.URL
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.OriginalURLCtxKey, orig))
+	r.URL.Path = "/files/a.zip"
+	if code, err := s.ServeHTTP(httptest.NewRecorder(), r); code != 0 || err != nil {
+		t.Errorf("Expected the link to be valid for the requested path, got %d, %v", code, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	bound := &Rule{Paths: []string{"/private"}, Secret: []byte(testSecret), BindIP: true}
+	if _, err := bound.Sign("/private/a.zip", time.Now(), ""); err == nil {
+		t.Error("Expected an error signing a bound link without an IP address")
+	}
+
+	register("signed.example.com:443", []*Rule{bound})
+	defer register("signed.example.com:443", nil)
+	link, err := Sign("", "/private/a.zip", time.Hour, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Path != "/private/a.zip" || u.Query().Get(SignatureParam) == "" {
+		t.Errorf("Expected a signed link to /private/a.zip, got %s", link)
+	}
+	if _, err := Sign("other.example.com:443", "/private/a.zip", time.Hour, "10.0.0.1"); err == nil {
+		t.Error("Expected an error signing for a site without the path")
+	}
+}
@@ -0,0 +1,82 @@
+package spa
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("spa", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new SPA middleware instance.
+func setup(c *caddy.Controller) error {
+	configs, err := spaParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SPA{Next: next, FileSys: cfg.FileSystem(), Configs: configs}
+	})
+
+	return nil
+}
+
+func spaParse(c *caddy.Controller) ([]Config, error) {
+	var configs []Config
+
+	for c.Next() {
+		sc := Config{Base: "/", NoCacheIndex: true}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			sc.Base = args[0]
+		case 2:
+			sc.Base = args[0]
+			sc.Index = args[1]
+		default:
+			return configs, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "except":
+				except := c.RemainingArgs()
+				if len(except) == 0 {
+					return configs, c.ArgErr()
+				}
+				sc.Except = append(sc.Except, except...)
+			case "cache_index":
+				sc.NoCacheIndex = false
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			default:
+				return configs, c.Errf("Unknown spa property '%s'", c.Val())
+			}
+		}
+
+		if sc.Index == "" {
+			sc.Index = path.Join(sc.Base, "index.html")
+		}
+
+		for _, other := range configs {
+			if other.Base == sc.Base {
+				return configs, fmt.Errorf("duplicate spa config for %s", sc.Base)
+			}
+		}
+		configs = append(configs, sc)
+	}
+
+	return configs, nil
+}
@@ -0,0 +1,86 @@
+package spa
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `spa`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(SPA)
+	if !ok {
+		t.Fatalf("Expected handler to be type SPA, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSpaParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Config
+	}{
+		{`spa`, false, []Config{{Base: "/", Index: "/index.html", NoCacheIndex: true}}},
+		{`spa /app`, false, []Config{{Base: "/app", Index: "/app/index.html", NoCacheIndex: true}}},
+		{`spa /app /app/shell.html {
+			except /app/api /app/static
+			cache_index
+		}`, false, []Config{{
+			Base:   "/app",
+			Index:  "/app/shell.html",
+			Except: []string{"/app/api", "/app/static"},
+		}}},
+		{`spa /a /b /c`, true, nil},
+		{`spa {
+			except
+		}`, true, nil},
+		{`spa {
+			cache_index forever
+		}`, true, nil},
+		{`spa {
+			fallback /x
+		}`, true, nil},
+		{"spa /app\nspa /app", true, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		actual, err := spaParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d expected %d configs, but got %d", i, len(test.expected), len(actual))
+		}
+		for j, sc := range actual {
+			expected := test.expected[j]
+			if sc.Base != expected.Base || sc.Index != expected.Index ||
+				sc.NoCacheIndex != expected.NoCacheIndex || len(sc.Except) != len(expected.Except) {
+				t.Errorf("Test %d, config %d: expected %+v, got %+v", i, j, expected, sc)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package spa is middleware for serving single-page applications,
+// which route on the client side and expect their index page to be
+// served for any path that is not a real file.
+package spa
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+// Config is the configuration of a single-page application
+// mounted at a base path.
+type Config struct {
+	// Base path of the application.
+	Base string
+
+	// Index is the page served in place of missing paths.
+	Index string
+
+	// Except lists sub-paths, such as an API, which are never
+	// answered with the index page.
+	Except []string
+
+	// NoCacheIndex causes the index page to be served with
+	// headers that prevent caching, so a new deployment is
+	// picked up immediately while hashed assets stay cached.
+	NoCacheIndex bool
+}
+
+// SPA is middleware that serves the index page of a single-page
+// application for paths that don't match an existing file.
+type SPA struct {
+	Next    httpserver.Handler
+	FileSys http.FileSystem
+	Configs []Config
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s SPA) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return s.Next.ServeHTTP(w, r)
+	}
+
+	cfg := s.selectConfig(r.URL.Path)
+	if cfg == nil || s.exists(r.URL.Path) {
+		return s.Next.ServeHTTP(w, r)
+	}
+
+	// a missing asset, such as a stale script reference, must
+	// still be a 404 rather than an HTML page with status 200
+	if path.Ext(r.URL.Path) != "" {
+		return s.Next.ServeHTTP(w, r)
+	}
+
+	r.URL.Path = s.indexPath(cfg.Index)
+	if cfg.NoCacheIndex {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	return s.Next.ServeHTTP(w, r)
+}
+
+// selectConfig returns the config with the longest base path
+// matching urlPath, or nil if there is none.
+func (s SPA) selectConfig(urlPath string) *Config {
+	var cfg *Config
+outer:
+	for i := range s.Configs {
+		c := &s.Configs[i]
+		if !httpserver.Path(urlPath).Matches(c.Base) {
+			continue
+		}
+		for _, except := range c.Except {
+			if httpserver.Path(urlPath).Matches(except) {
+				continue outer
+			}
+		}
+		if cfg == nil || len(c.Base) > len(cfg.Base) {
+			cfg = c
+		}
+	}
+	return cfg
+}
+
+// indexPath returns the path at which the file server serves the
+// page index: its directory, if it is the index page of that, since
+// requests for index pages are redirected to their directories.
+func (s SPA) indexPath(index string) string {
+	dir, name := path.Split(index)
+	for _, page := range staticfiles.IndexPages {
+		if s.exists(dir + page) {
+			if page == name {
+				return dir
+			}
+			break
+		}
+	}
+	return index
+}
+
+// exists reports whether urlPath names a file or directory.
+func (s SPA) exists(urlPath string) bool {
+	f, err := s.FileSys.Open(urlPath)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
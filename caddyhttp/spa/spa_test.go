@@ -0,0 +1,118 @@
+package spa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func TestSPA(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_spa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"index.html", "assets/app.1234.js"} {
+		if err := ioutil.WriteFile(filepath.Join(root, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := SPA{
+		FileSys: http.Dir(root),
+		Configs: []Config{{Base: "/", Index: "/index.html", NoCacheIndex: true, Except: []string{"/api"}}},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write([]byte(r.URL.Path))
+			return 0, nil
+		}),
+	}
+
+	tests := []struct {
+		method        string
+		url           string
+		expectedPath  string
+		expectNoCache bool
+	}{
+		{"GET", "/", "/", false},
+		{"GET", "/assets/app.1234.js", "/assets/app.1234.js", false},
+		{"GET", "/users/42/profile", "/", true},
+		{"HEAD", "/settings", "/", true},
+		{"GET", "/assets/app.5678.js", "/assets/app.5678.js", false},
+		{"GET", "/api/users", "/api/users", false},
+		{"POST", "/form", "/form", false},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, nil)
+		rec := httptest.NewRecorder()
+		if _, err := s.ServeHTTP(rec, req); err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if body := rec.Body.String(); test.method != "HEAD" && body != test.expectedPath {
+			t.Errorf("Test %d: Expected path '%s', got '%s'", i, test.expectedPath, body)
+		}
+		if noCache := rec.Header().Get("Cache-Control") == "no-cache"; noCache != test.expectNoCache {
+			t.Errorf("Test %d: Expected no-cache to be %v, got %v", i, test.expectNoCache, noCache)
+		}
+	}
+}
+
+func TestSPAFileServer(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_spa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range map[string]string{
+		"index.html":     "home",
+		"app/index.html": "app",
+		"shell.html":     "shell",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := SPA{
+		FileSys: http.Dir(root),
+		Configs: []Config{
+			{Base: "/", Index: "/index.html"},
+			{Base: "/app", Index: "/app/index.html"},
+			{Base: "/shell", Index: "/shell.html"},
+		},
+		Next: staticfiles.FileServer{Root: http.Dir(root)},
+	}
+
+	for i, test := range []struct {
+		url    string
+		expect string
+	}{
+		{"/users/42", "home"},
+		{"/app/settings/profile", "app"},
+		{"/shell/x", "shell"},
+	} {
+		rec := httptest.NewRecorder()
+		status, err := s.ServeHTTP(rec, httptest.NewRequest("GET", test.url, nil))
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if status != http.StatusOK && status != 0 {
+			t.Errorf("Test %d: Expected status 200, got %d", i, status)
+		}
+		if body := rec.Body.String(); body != test.expect {
+			t.Errorf("Test %d: Expected '%s', got '%s'", i, test.expect, body)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package split
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("split", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Split middleware instance.
+func setup(c *caddy.Controller) error {
+	experiments, err := splitParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Split{Next: next, Experiments: experiments}
+	})
+
+	return nil
+}
+
+// splitParse parses
+//
+//	split name [path] {
+//		variant name weight [prefix]
+//		by      cookie|ip
+//		cookie  name [max_age]
+//	}
+//
+// once for each experiment, which has two variants or more. Clients
+// are told apart by an ID in the cookie caddy_split, which lasts for
+// 30 days, unless they're told apart by IP.
+func splitParse(c *caddy.Controller) ([]*Experiment, error) {
+	var experiments []*Experiment
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return nil, c.ArgErr()
+		}
+		e := &Experiment{Name: args[0], Path: "/", Cookie: DefaultCookie, MaxAge: DefaultMaxAge}
+		if len(args) == 2 {
+			e.Path = args[1]
+		}
+		for _, other := range experiments {
+			if other.Name == e.Name {
+				return nil, c.Errf("Duplicate split experiment '%s'", e.Name)
+			}
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "variant":
+				if len(args) < 2 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				v := Variant{Name: args[0]}
+				for _, other := range e.Variants {
+					if other.Name == v.Name {
+						return nil, c.Errf("Duplicate split variant '%s'", v.Name)
+					}
+				}
+				weight, err := strconv.Atoi(args[1])
+				if err != nil || weight < 0 {
+					return nil, c.Errf("Bad split variant weight '%s'", args[1])
+				}
+				v.Weight = weight
+				if len(args) == 3 {
+					if !strings.HasPrefix(args[2], "/") || args[2] == "/" {
+						return nil, c.Errf("Bad split variant prefix '%s'", args[2])
+					}
+					v.Prefix = strings.TrimSuffix(args[2], "/")
+				}
+				e.Variants = append(e.Variants, v)
+				e.total += v.Weight
+			case "by":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "cookie":
+					e.ByIP = false
+				case "ip":
+					e.ByIP = true
+				default:
+					return nil, c.Errf("Unknown split client identity '%s'", args[0])
+				}
+			case "cookie":
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				e.Cookie = args[0]
+				if len(args) == 2 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil || d <= 0 {
+						return nil, c.Errf("Bad split cookie max_age '%s'", args[1])
+					}
+					e.MaxAge = d
+				}
+			default:
+				return nil, c.Errf("Unknown split property '%s'", what)
+			}
+		}
+
+		if len(e.Variants) < 2 {
+			return nil, c.Errf("Split experiment '%s' needs two variants or more", e.Name)
+		}
+		if e.total == 0 {
+			return nil, c.Errf("Split experiment '%s' has no variant with weight", e.Name)
+		}
+		experiments = append(experiments, e)
+	}
+	return experiments, nil
+}
@@ -0,0 +1,122 @@
+package split
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `split homepage {
+		variant a 1
+		variant b 1
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Split)
+	if !ok {
+		t.Fatalf("Expected handler to be type Split, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSplitParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []*Experiment
+	}{
+		{`split homepage {
+			variant control 90
+			variant new     10 /new/
+		}
+		split checkout /shop {
+			variant a 1
+			variant b 0
+			variant c 1
+			by ip
+		}
+		split pricing {
+			variant a 1
+			variant b 1
+			cookie ab 24h
+		}`, false, []*Experiment{
+			{Name: "homepage", Path: "/", Cookie: DefaultCookie, MaxAge: DefaultMaxAge, total: 100,
+				Variants: []Variant{{Name: "control", Weight: 90}, {Name: "new", Weight: 10, Prefix: "/new"}}},
+			{Name: "checkout", Path: "/shop", ByIP: true, Cookie: DefaultCookie, MaxAge: DefaultMaxAge, total: 2,
+				Variants: []Variant{{Name: "a", Weight: 1}, {Name: "b"}, {Name: "c", Weight: 1}}},
+			{Name: "pricing", Path: "/", Cookie: "ab", MaxAge: 24 * time.Hour, total: 2,
+				Variants: []Variant{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}},
+		}},
+		{`split`, true, nil},
+		{`split a / b`, true, nil},
+		{`split a {
+			variant a 1
+		}`, true, nil},
+		{`split a {
+			variant a 0
+			variant b 0
+		}`, true, nil},
+		{`split a {
+			variant a 1
+			variant a 1
+		}`, true, nil},
+		{`split a {
+			variant a -1
+			variant b 1
+		}`, true, nil},
+		{`split a {
+			variant a 1 b
+			variant b 1
+		}`, true, nil},
+		{`split a {
+			variant a 1
+			variant b 1
+			by header
+		}`, true, nil},
+		{`split a {
+			variant a 1
+			variant b 1
+			cookie ab forever
+		}`, true, nil},
+		{`split a {
+			variant a 1
+			variant b 1
+			weights 1
+		}`, true, nil},
+		{`split a {
+			variant a 1
+			variant b 1
+		}
+		split a {
+			variant a 1
+			variant b 1
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := splitParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Package split is middleware for A/B tests: it assigns each client
+// to a variant of an experiment, with the configured weights, always
+// to the same one, by the hash of an ID kept in a cookie or of the
+// client's IP. The variant is that of the {split.name} placeholder,
+// and may prefix the path of requests, so that the variants of a site
+// can be served from different roots or upstreams.
+package split
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"hash/fnv"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var requestsTotal = metrics.NewCounter("caddy_http_split_requests_total",
+	"Number of requests in an experiment, by the variant they were assigned to.",
+	"experiment", "variant")
+
+// Split is middleware that assigns clients to the variants of
+// experiments.
+type Split struct {
+	Next        httpserver.Handler
+	Experiments []*Experiment
+}
+
+// Experiment is an A/B test of the requests in a path.
+type Experiment struct {
+	Name string
+	Path string
+
+	// ByIP is whether clients are told apart by their IP, rather
+	// than by an ID in the cookie Cookie, which lasts for MaxAge.
+	ByIP   bool
+	Cookie string
+	MaxAge time.Duration
+
+	Variants []Variant
+	total    int // of the weights of the variants
+}
+
+// Variant is a variant of an experiment.
+type Variant struct {
+	Name string
+
+	// Weight is how many, of the total of the weights of the
+	// variants of the experiment, of clients are assigned to it.
+	Weight int
+
+	// Prefix, if not "", is put before the paths of the requests
+	// of clients assigned to the variant.
+	Prefix string
+}
+
+// Split defaults.
+const (
+	DefaultCookie = "caddy_split"
+	DefaultMaxAge = 30 * 24 * time.Hour
+)
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s Split) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	variants := make(map[string]string)
+	if outer, ok := r.Context().Value(httpserver.SplitCtxKey).(map[string]string); ok {
+		for name, variant := range outer {
+			variants[name] = variant
+		}
+	}
+
+	ids := make(map[string]string) // by cookie name
+	var prefix string
+	for _, e := range s.Experiments {
+		if !httpserver.Path(r.URL.Path).Matches(e.Path) {
+			continue
+		}
+		var key string
+		if e.ByIP {
+			key = httpserver.ClientIP(r)
+		} else {
+			key = e.clientID(w, r, ids)
+		}
+		v := e.Assign(key)
+		variants[e.Name] = v.Name
+		httpserver.SetPlaceholder(r, "split."+e.Name, v.Name)
+		if prefix == "" {
+			prefix = v.Prefix
+		}
+		requestsTotal.Inc(e.Name, v.Name)
+	}
+
+	if prefix != "" {
+		r.URL.Path = prefix + r.URL.Path
+		r.URL.RawPath = ""
+	}
+	r = r.WithContext(context.WithValue(r.Context(), httpserver.SplitCtxKey, variants))
+	return s.Next.ServeHTTP(w, r)
+}
+
+// Assign returns the variant of the client with key, which is always
+// the same one, as long as the weights of the variants don't change.
+func (e *Experiment) Assign(key string) Variant {
+	h := fnv.New64a()
+	h.Write([]byte(e.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	n := int(h.Sum64() % uint64(e.total))
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1] // not reached
+}
+
+// clientID returns the ID of the client of r in the experiment's
+// cookie, giving it one if it has none; ids are those given to the
+// client in this response, by cookie name, which experiments that
+// use the same cookie share.
+func (e *Experiment) clientID(w http.ResponseWriter, r *http.Request, ids map[string]string) string {
+	if id, ok := ids[e.Cookie]; ok {
+		return id
+	}
+	if c, err := r.Cookie(e.Cookie); err == nil && validID(c.Value) {
+		ids[e.Cookie] = c.Value
+		return c.Value
+	}
+	id := newID()
+	ids[e.Cookie] = id
+	http.SetCookie(w, &http.Cookie{
+		Name:     e.Cookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(e.MaxAge / time.Second),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// idLen is the length of client IDs, which are 16 random bytes
+// encoded to be safe in cookies.
+var idLen = base64.RawURLEncoding.EncodedLen(16)
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validID returns whether id is one that newID could have returned;
+// cookies with other values are replaced.
+func validID(id string) bool {
+	if len(id) != idLen {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil && len(b) == 16
+}
@@ -0,0 +1,100 @@
+package split
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestAssign(t *testing.T) {
+	e := &Experiment{Name: "homepage", total: 100, Variants: []Variant{
+		{Name: "a", Weight: 80},
+		{Name: "b", Weight: 0},
+		{Name: "c", Weight: 20},
+	}}
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("client%d", i)
+		v := e.Assign(key)
+		if again := e.Assign(key); again.Name != v.Name {
+			t.Fatalf("Expected %s to be assigned %s again, got %s", key, v.Name, again.Name)
+		}
+		counts[v.Name]++
+	}
+	if counts["b"] != 0 {
+		t.Errorf("Expected no client to be assigned a variant of weight 0, got %d", counts["b"])
+	}
+	if counts["a"] < 7600 || counts["a"] > 8400 {
+		t.Errorf("Expected about 8000 clients to be assigned a, got %d", counts["a"])
+	}
+}
+
+func TestSplit(t *testing.T) {
+	var got, gotPath string
+	s := Split{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			got = httpserver.NewReplacer(r, nil, "-").Replace("{split.homepage} {split.byip} {split.shop}")
+			gotPath = r.URL.Path
+			return http.StatusOK, nil
+		}),
+		Experiments: []*Experiment{
+			{Name: "homepage", Path: "/", Cookie: DefaultCookie, MaxAge: DefaultMaxAge, total: 1,
+				Variants: []Variant{{Name: "a"}, {Name: "b", Weight: 1, Prefix: "/b"}}},
+			{Name: "byip", Path: "/", ByIP: true, total: 1,
+				Variants: []Variant{{Name: "x", Weight: 1}, {Name: "y"}}},
+			{Name: "shop", Path: "/shop", Cookie: DefaultCookie, MaxAge: DefaultMaxAge, total: 1,
+				Variants: []Variant{{Name: "c", Weight: 1}, {Name: "d"}}},
+		},
+	}
+
+	// a new client is given an ID, once for every experiment
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/shop/cart", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultCookie || !validID(cookies[0].Value) {
+		t.Fatalf("Expected a cookie with an ID, got %v", cookies)
+	}
+	if got != "b x c" || gotPath != "/b/shop/cart" {
+		t.Errorf("Expected variants 'b x c' at /b/shop/cart, got '%s' at %s", got, gotPath)
+	}
+
+	// a client with an ID keeps it
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected a client with an ID to keep it, got %v", w.Result().Cookies())
+	}
+	if got != "b x -" || gotPath != "/b/" {
+		t.Errorf("Expected variants 'b x -' at /b/, got '%s' at %s", got, gotPath)
+	}
+
+	// an ID that couldn't have been given is replaced
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: DefaultCookie, Value: "mine"})
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].Value == "mine" {
+		t.Errorf("Expected an ID of the client's own to be replaced, got %v", c)
+	}
+}
+
+func TestSplitEarlierPlaceholders(t *testing.T) {
+	s := Split{
+		Next: httpserver.EmptyNext,
+		Experiments: []*Experiment{
+			{Name: "byip", Path: "/", ByIP: true, total: 1,
+				Variants: []Variant{{Name: "x", Weight: 1}, {Name: "y"}}},
+		},
+	}
+	// the request of middleware before split, such as log
+	r := httpserver.WithPlaceholders(httptest.NewRequest("GET", "/", nil))
+	s.ServeHTTP(&httpserver.ResponseWriterWrapper{ResponseWriter: httptest.NewRecorder()}, r)
+	if got := httpserver.NewReplacer(r, nil, "-").Replace("{split.byip}"); got != "x" {
+		t.Errorf("Expected the variant to be seen by the middleware before, got '%s'", got)
+	}
+}
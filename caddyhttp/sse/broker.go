@@ -0,0 +1,154 @@
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Event is a server-sent event.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// WriteTo writes e to w in the text/event-stream format.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Event)
+	}
+	for _, line := range strings.Split(lineBreaks.Replace(e.Data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return b.WriteTo(w)
+}
+
+// lineBreaks normalizes the line breaks of event data, all of which
+// end lines in the stream, to "\n".
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// ErrTooManyClients is returned by Subscribe when the broker
+// already has its maximum number of subscribers.
+var ErrTooManyClients = errors.New("sse: too many clients")
+
+// clientBuffer is the number of events queued for a client
+// before it is considered too slow and disconnected.
+const clientBuffer = 64
+
+// Broker fans events out to subscribers, and keeps a history
+// of recent events so that reconnecting clients can catch up.
+type Broker struct {
+	// MaxClients limits the number of subscribers; 0 means
+	// no limit.
+	MaxClients int
+
+	// HistorySize is the number of events retained for
+	// replay to reconnecting clients.
+	HistorySize int
+
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+	history []Event
+	lastID  uint64
+}
+
+// NewBroker returns a new Broker.
+func NewBroker(maxClients, historySize int) *Broker {
+	return &Broker{
+		MaxClients:  maxClients,
+		HistorySize: historySize,
+		clients:     make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends e to all subscribers. If e has no ID, one is
+// assigned. Subscribers that can't keep up are dropped.
+func (b *Broker) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e.ID == "" {
+		b.lastID++
+		e.ID = strconv.FormatUint(b.lastID, 10)
+	} else if n, err := strconv.ParseUint(e.ID, 10, 64); err == nil && n > b.lastID {
+		b.lastID = n
+	}
+
+	if b.HistorySize > 0 {
+		b.history = append(b.history, e)
+		if len(b.history) > b.HistorySize {
+			b.history = b.history[len(b.history)-b.HistorySize:]
+		}
+	}
+
+	for ch := range b.clients {
+		select {
+		case ch <- e:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+	return e
+}
+
+// Subscribe registers a new subscriber. Events published after
+// the one with ID lastEventID, if it is still in the history,
+// are queued immediately. The returned channel is closed when
+// the subscriber is dropped or unsubscribed.
+func (b *Broker) Subscribe(lastEventID string) (chan Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.MaxClients > 0 && len(b.clients) >= b.MaxClients {
+		return nil, ErrTooManyClients
+	}
+
+	var missed []Event
+	if lastEventID != "" {
+		for i, e := range b.history {
+			if e.ID == lastEventID {
+				missed = b.history[i+1:]
+				break
+			}
+		}
+	}
+
+	size := clientBuffer
+	if len(missed) > size {
+		size = len(missed)
+	}
+	ch := make(chan Event, size)
+	for _, e := range missed {
+		ch <- e
+	}
+	b.clients[ch] = struct{}{}
+	return ch, nil
+}
+
+// Unsubscribe removes a subscriber.
+func (b *Broker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// Clients returns the number of subscribers.
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
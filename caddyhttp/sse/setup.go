@@ -0,0 +1,114 @@
+package sse
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("sse", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new SSE middleware instance.
+func setup(c *caddy.Controller) error {
+	configs, err := sseParse(c)
+	if err != nil {
+		return err
+	}
+
+	for _, cfg := range configs {
+		if cfg.Upstream != "" {
+			rl := newRelay(cfg.Upstream, cfg.Broker)
+			c.OnStartup(rl.Start)
+			c.OnShutdown(rl.Stop)
+		}
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SSE{Next: next, Configs: configs}
+	})
+
+	return nil
+}
+
+func sseParse(c *caddy.Controller) ([]*Config, error) {
+	var configs []*Config
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return configs, c.ArgErr()
+		}
+		cfg := &Config{Path: args[0], Heartbeat: defaultHeartbeat}
+		maxClients, history := 0, defaultHistory
+
+		for c.NextBlock() {
+			prop := c.Val()
+			if !c.NextArg() {
+				return configs, c.ArgErr()
+			}
+			val := c.Val()
+			switch prop {
+			case "upstream":
+				u, err := url.Parse(val)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					return configs, c.Errf("Invalid upstream URL '%s'", val)
+				}
+				cfg.Upstream = val
+			case "publish":
+				cfg.PublishPath = val
+			case "heartbeat", "retry":
+				d, err := time.ParseDuration(val)
+				if err != nil || d < 0 {
+					return configs, c.Errf("Invalid duration for %s: '%s'", prop, val)
+				}
+				if prop == "heartbeat" {
+					cfg.Heartbeat = d
+				} else {
+					cfg.Retry = d
+				}
+			case "max_clients", "history":
+				n, err := strconv.Atoi(val)
+				if err != nil || n < 0 {
+					return configs, c.Errf("%s must be a non-negative integer, got '%s'", prop, val)
+				}
+				if prop == "max_clients" {
+					maxClients = n
+				} else {
+					history = n
+				}
+			default:
+				return configs, c.Errf("Unknown sse property '%s'", prop)
+			}
+			if c.NextArg() {
+				return configs, c.ArgErr()
+			}
+		}
+
+		if cfg.PublishPath == cfg.Path {
+			return configs, c.Err("sse: publish path must differ from the stream path")
+		}
+		for _, other := range configs {
+			if other.Path == cfg.Path {
+				return configs, fmt.Errorf("duplicate sse config for %s", cfg.Path)
+			}
+		}
+		cfg.Broker = NewBroker(maxClients, history)
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+const (
+	defaultHeartbeat = 15 * time.Second
+	defaultHistory   = 100
+)
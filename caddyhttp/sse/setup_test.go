@@ -0,0 +1,106 @@
+package sse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `sse /events`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(SSE)
+	if !ok {
+		t.Fatalf("Expected handler to be type SSE, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSseParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  Config
+		clients   int
+		history   int
+	}{
+		{`sse /events`, false, Config{Path: "/events", Heartbeat: defaultHeartbeat}, 0, defaultHistory},
+		{`sse /events {
+			upstream http://localhost:9000/stream
+			publish /events/publish
+			heartbeat 30s
+			retry 2s
+			max_clients 10
+			history 5
+		}`, false, Config{
+			Path:        "/events",
+			PublishPath: "/events/publish",
+			Upstream:    "http://localhost:9000/stream",
+			Heartbeat:   30 * time.Second,
+			Retry:       2 * time.Second,
+		}, 10, 5},
+		{`sse`, true, Config{}, 0, 0},
+		{`sse /a /b`, true, Config{}, 0, 0},
+		{`sse /a {
+			upstream ftp://example.com
+		}`, true, Config{}, 0, 0},
+		{`sse /a {
+			heartbeat often
+		}`, true, Config{}, 0, 0},
+		{`sse /a {
+			max_clients -1
+		}`, true, Config{}, 0, 0},
+		{`sse /a {
+			publish /a
+		}`, true, Config{}, 0, 0},
+		{`sse /a {
+			history
+		}`, true, Config{}, 0, 0},
+		{`sse /a {
+			colour blue
+		}`, true, Config{}, 0, 0},
+		{"sse /a\nsse /a", true, Config{}, 0, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		actual, err := sseParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		cfg := actual[0]
+		if cfg.Path != test.expected.Path ||
+			cfg.PublishPath != test.expected.PublishPath ||
+			cfg.Upstream != test.expected.Upstream ||
+			cfg.Heartbeat != test.expected.Heartbeat ||
+			cfg.Retry != test.expected.Retry {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, *cfg)
+		}
+		if cfg.Broker.MaxClients != test.clients || cfg.Broker.HistorySize != test.history {
+			t.Errorf("Test %d: Expected broker limits %d/%d, got %d/%d",
+				i, test.clients, test.history, cfg.Broker.MaxClients, cfg.Broker.HistorySize)
+		}
+	}
+}
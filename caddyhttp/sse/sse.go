@@ -0,0 +1,156 @@
+// Package sse is middleware that serves server-sent event
+// streams, broadcasting events from an upstream event stream
+// or from an internal publish endpoint to all connected clients.
+package sse
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// SSE is middleware that serves event streams.
+type SSE struct {
+	Next    httpserver.Handler
+	Configs []*Config
+}
+
+// Config is the configuration of one event stream.
+type Config struct {
+	// Path is where clients subscribe to the stream.
+	Path string
+
+	// PublishPath, if set, is where events can be POSTed to
+	// be broadcast; protect it, for example with basicauth.
+	PublishPath string
+
+	// Upstream, if set, is the URL of an event stream whose
+	// events are relayed to the clients.
+	Upstream string
+
+	// Heartbeat is the interval between comments sent to keep
+	// idle connections open; 0 disables heartbeats.
+	Heartbeat time.Duration
+
+	// Retry is the reconnection delay suggested to clients;
+	// 0 leaves it up to the client.
+	Retry time.Duration
+
+	// Broker distributes the events.
+	Broker *Broker
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s SSE) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, cfg := range s.Configs {
+		if cfg.PublishPath != "" && r.URL.Path == cfg.PublishPath {
+			return cfg.publish(w, r)
+		}
+	}
+	for _, cfg := range s.Configs {
+		if r.URL.Path == cfg.Path {
+			return cfg.subscribe(w, r)
+		}
+	}
+	return s.Next.ServeHTTP(w, r)
+}
+
+// maxEventSize limits the size of published events.
+const maxEventSize = 1 << 20
+
+// publish handles a request to broadcast an event. The body is
+// the event data; the event type and ID may be given as the
+// query parameters "event" and "id", which may not contain line
+// breaks, as they would end their fields in the stream.
+func (cfg *Config) publish(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return http.StatusMethodNotAllowed, nil
+	}
+	id, event := r.URL.Query().Get("id"), r.URL.Query().Get("event")
+	if strings.ContainsAny(id, "\r\n") || strings.ContainsAny(event, "\r\n") {
+		return http.StatusBadRequest, nil
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	e := cfg.Broker.Publish(Event{
+		ID:    id,
+		Event: event,
+		Data:  string(data),
+	})
+	w.Header().Set("X-Event-Id", e.ID)
+	w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+}
+
+// subscribe streams events to the client until it goes away.
+func (cfg *Config) subscribe(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		return http.StatusMethodNotAllowed, nil
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return http.StatusInternalServerError, httpserver.NonFlusherError{Underlying: w}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		// EventSource polyfills can't set headers
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	events, err := cfg.Broker.Subscribe(lastEventID)
+	if err == ErrTooManyClients {
+		w.Header().Set("Retry-After", "10")
+		return http.StatusServiceUnavailable, nil
+	}
+	defer cfg.Broker.Unsubscribe(events)
+
+	// the stream is meant to stay open, so the server's
+	// timeouts must not apply; if that's not possible, the
+	// client will simply reconnect when cut off
+	httpserver.ExemptFromTimeouts(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if cfg.Retry > 0 {
+		w.Write([]byte("retry: " + strconv.FormatInt(int64(cfg.Retry/time.Millisecond), 10) + "\n\n"))
+	}
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if cfg.Heartbeat > 0 {
+		ticker := time.NewTicker(cfg.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// dropped for being too slow
+				return 0, nil
+			}
+			if _, err := e.WriteTo(w); err != nil {
+				return 0, nil
+			}
+			flusher.Flush()
+		case <-heartbeat:
+			if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+				return 0, nil
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return 0, nil
+		}
+	}
+}
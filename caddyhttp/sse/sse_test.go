@@ -0,0 +1,200 @@
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(2, 3)
+
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Data: "x"})
+	}
+
+	ch, err := b.Subscribe("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"4", "5"} {
+		if e := <-ch; e.ID != expected {
+			t.Errorf("Expected replayed event %s, got %s", expected, e.ID)
+		}
+	}
+
+	if _, err := b.Subscribe(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Subscribe(""); err != ErrTooManyClients {
+		t.Errorf("Expected ErrTooManyClients, got %v", err)
+	}
+
+	b.Publish(Event{ID: "41", Data: "y"})
+	if e := b.Publish(Event{Data: "z"}); e.ID != "42" {
+		t.Errorf("Expected IDs to continue after explicit ID, got %s", e.ID)
+	}
+
+	b.Unsubscribe(ch)
+	if n := b.Clients(); n != 1 {
+		t.Errorf("Expected 1 client after unsubscribe, got %d", n)
+	}
+}
+
+func TestBrokerDropsSlowClients(t *testing.T) {
+	b := NewBroker(0, 0)
+	ch, _ := b.Subscribe("")
+	for i := 0; i <= clientBuffer; i++ {
+		b.Publish(Event{Data: "x"})
+	}
+	for range ch {
+	}
+	if n := b.Clients(); n != 0 {
+		t.Errorf("Expected slow client to be dropped, still have %d clients", n)
+	}
+}
+
+func TestEventWriteTo(t *testing.T) {
+	var buf strings.Builder
+	Event{ID: "7", Event: "update", Data: "line1\nline2"}.WriteTo(&buf)
+	expected := "id: 7\nevent: update\ndata: line1\ndata: line2\n\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	// a bare CR ends a line too, so it can't smuggle in a field
+	var crlf strings.Builder
+	Event{Data: "a\rid: 9\r\nb"}.WriteTo(&crlf)
+	if expected := "data: a\ndata: id: 9\ndata: b\n\n"; crlf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, crlf.String())
+	}
+
+	var events []Event
+	if err := readEvents(strings.NewReader(": hello\n"+expected+"data:no space\n\n"), func(e Event) {
+		events = append(events, e)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != "7" || events[0].Event != "update" ||
+		events[0].Data != "line1\nline2" || events[1].Data != "no space" {
+		t.Errorf("Unexpected events parsed: %+v", events)
+	}
+}
+
+func TestSSE(t *testing.T) {
+	cfg := &Config{
+		Path:        "/events",
+		PublishPath: "/publish",
+		Heartbeat:   20 * time.Millisecond,
+		Retry:       time.Second,
+		Broker:      NewBroker(0, 10),
+	}
+	s := SSE{
+		Configs: []*Config{cfg},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, _ := s.ServeHTTP(w, r); status != 0 {
+			w.WriteHeader(status)
+		}
+	}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/publish?event=greeting", "text/plain", strings.NewReader("early"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("X-Event-Id") != "1" {
+		t.Fatalf("Expected event 1 to be published, got %s (id %s)", resp.Status, resp.Header.Get("X-Event-Id"))
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected event stream content type, got %s", ct)
+	}
+
+	resp, err = http.Post(srv.URL+"/publish", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(stream.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if scanner.Text() == ": ping" {
+			break
+		}
+	}
+	got := strings.Join(lines, "\n")
+	for _, expected := range []string{"retry: 1000", "data: hello", "id: 2", ": ping"} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Expected stream to contain %q, got:\n%s", expected, got)
+		}
+	}
+
+	resp, err = http.Post(srv.URL+"/publish?id=3%0Aevent:%20admin", "text/plain", strings.NewReader("forged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an ID with a line break to be refused, got %s", resp.Status)
+	}
+
+	resp, err = http.Get(srv.URL + "/publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET on publish path to be refused, got %s", resp.Status)
+	}
+
+	resp, err = http.Get(srv.URL + "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("Expected other paths to be passed on, got %s", resp.Status)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("id: 10\nevent: tick\ndata: from upstream\n\n"))
+	}))
+	defer upstream.Close()
+
+	b := NewBroker(0, 10)
+	ch, _ := b.Subscribe("")
+	rl := newRelay(upstream.URL, b)
+	rl.Start()
+	defer rl.Stop()
+
+	select {
+	case e := <-ch:
+		if e.ID != "10" || e.Event != "tick" || e.Data != "from upstream" {
+			t.Errorf("Unexpected relayed event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for relayed event")
+	}
+}
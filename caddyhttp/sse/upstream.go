@@ -0,0 +1,159 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// relay consumes an upstream event stream and publishes its
+// events to a broker, reconnecting when the stream ends.
+type relay struct {
+	url    string
+	broker *Broker
+	client *http.Client
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newRelay(url string, broker *Broker) *relay {
+	return &relay{url: url, broker: broker, client: http.DefaultClient}
+}
+
+// Start begins relaying events in the background.
+func (rl *relay) Start() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rl.cancel = cancel
+	rl.done = make(chan struct{})
+	go rl.run(ctx)
+	return nil
+}
+
+// Stop stops relaying and waits for the connection to close.
+func (rl *relay) Stop() error {
+	rl.mu.Lock()
+	cancel, done := rl.cancel, rl.done
+	rl.cancel = nil
+	rl.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return nil
+}
+
+// Minimum and maximum delay between reconnection attempts.
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+func (rl *relay) run(ctx context.Context) {
+	defer close(rl.done)
+
+	var lastID string
+	delay := minReconnectDelay
+	for {
+		received, err := rl.stream(ctx, &lastID)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			delay = minReconnectDelay
+		}
+		if err != nil {
+			log.Printf("[ERROR] sse: upstream %s: %v", rl.url, err)
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// stream reads events from a single connection to the upstream,
+// resuming after *lastID. It reports whether any events were
+// received.
+func (rl *relay) stream(ctx context.Context, lastID *string) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, rl.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+
+	resp, err := rl.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	received := false
+	err = readEvents(resp.Body, func(e Event) {
+		received = true
+		if e.ID != "" {
+			*lastID = e.ID
+		}
+		rl.broker.Publish(e)
+	})
+	return received, err
+}
+
+// readEvents parses a text/event-stream from r, calling fn for
+// every complete event.
+func readEvents(r io.Reader, fn func(Event)) error {
+	var e Event
+	var data []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxEventSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data != nil {
+				e.Data = strings.Join(data, "\n")
+				fn(e)
+			}
+			e, data = Event{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment
+		}
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			e.ID = value
+		case "event":
+			e.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	return scanner.Err()
+}
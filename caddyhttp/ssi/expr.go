@@ -0,0 +1,215 @@
+package ssi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// evalExpr evaluates expr, a condition in the syntax of
+// mod_include before Apache 2.4: strings, which may refer to
+// variables, compared with =, !=, <, <=, > and >=, or matched
+// with = and != against /regular expressions/, combined with !,
+// && and || and grouped with parentheses. A string on its own is
+// true if it is not empty.
+func evalExpr(expr string, lookup func(string) (string, bool)) (bool, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return false, err
+	}
+	e := &exprParser{toks: toks, lookup: lookup}
+	v, err := e.or()
+	if err != nil {
+		return false, err
+	}
+	if e.pos < len(e.toks) {
+		return false, fmt.Errorf("unexpected %s in expression", e.toks[e.pos].text)
+	}
+	return v, nil
+}
+
+// token kinds of expressions.
+const (
+	tokString = iota
+	tokRegexp
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+// ops are the operators of expressions, longest first.
+var ops = []string{"&&", "||", "!=", "==", "<=", ">=", "=", "<", ">", "!", "(", ")"}
+
+// tokenize splits expr into strings, regular expressions and
+// operators. Unquoted strings are separated by whitespace.
+func tokenize(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '\'' || c == '/':
+			// the delimiter can be escaped with a backslash
+			j := i + 1
+			for j < len(expr) && expr[j] != c {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated %c in expression", c)
+			}
+			tok := token{tokRegexp, expr[i+1 : j]} // \/ is valid in a regexp
+			if c == '\'' {
+				tok = token{tokString, strings.Replace(tok.text, `\'`, "'", -1)}
+			}
+			toks = append(toks, tok)
+			i = j + 1
+		default:
+			op := ""
+			for _, o := range ops {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op != "" {
+				toks = append(toks, token{tokOp, op})
+				i += len(op)
+				continue
+			}
+			j := i
+			for j < len(expr) && !strings.ContainsRune(" \t\r\n'/=!<>&|()", rune(expr[j])) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected %c in expression", c)
+			}
+			toks = append(toks, token{tokString, expr[i:j]})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+// exprParser evaluates the tokens of an expression as it
+// parses them.
+type exprParser struct {
+	toks   []token
+	pos    int
+	lookup func(string) (string, bool)
+}
+
+func (e *exprParser) peekOp(ops ...string) string {
+	if e.pos < len(e.toks) && e.toks[e.pos].kind == tokOp {
+		for _, op := range ops {
+			if e.toks[e.pos].text == op {
+				return op
+			}
+		}
+	}
+	return ""
+}
+
+func (e *exprParser) or() (bool, error) {
+	v, err := e.and()
+	for err == nil && e.peekOp("||") != "" {
+		e.pos++
+		var w bool
+		w, err = e.and()
+		v = v || w
+	}
+	return v, err
+}
+
+func (e *exprParser) and() (bool, error) {
+	v, err := e.unary()
+	for err == nil && e.peekOp("&&") != "" {
+		e.pos++
+		var w bool
+		w, err = e.unary()
+		v = v && w
+	}
+	return v, err
+}
+
+func (e *exprParser) unary() (bool, error) {
+	if e.peekOp("!") != "" {
+		e.pos++
+		v, err := e.unary()
+		return !v, err
+	}
+	if e.peekOp("(") != "" {
+		e.pos++
+		v, err := e.or()
+		if err != nil {
+			return false, err
+		}
+		if e.peekOp(")") == "" {
+			return false, fmt.Errorf("missing ) in expression")
+		}
+		e.pos++
+		return v, nil
+	}
+	return e.comparison()
+}
+
+func (e *exprParser) comparison() (bool, error) {
+	left, ok := e.str()
+	if !ok {
+		return false, fmt.Errorf("expected a string in expression")
+	}
+	op := e.peekOp("=", "==", "!=", "<", "<=", ">", ">=")
+	if op == "" {
+		return left != "", nil
+	}
+	e.pos++
+
+	if e.pos < len(e.toks) && e.toks[e.pos].kind == tokRegexp {
+		if op != "=" && op != "==" && op != "!=" {
+			return false, fmt.Errorf("can't compare with %s to a regular expression", op)
+		}
+		re, err := regexp.Compile(e.toks[e.pos].text)
+		if err != nil {
+			return false, err
+		}
+		e.pos++
+		return re.MatchString(left) == (op != "!="), nil
+	}
+
+	right, ok := e.str()
+	if !ok {
+		return false, fmt.Errorf("expected a string after %s in expression", op)
+	}
+	switch op {
+	case "=", "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	default:
+		return left >= right, nil
+	}
+}
+
+// str returns the string at the current position, with its
+// variables substituted. Consecutive unquoted strings are joined
+// by a space, as in Apache.
+func (e *exprParser) str() (string, bool) {
+	var parts []string
+	for e.pos < len(e.toks) && e.toks[e.pos].kind == tokString {
+		parts = append(parts, substitute(e.toks[e.pos].text, e.lookup))
+		e.pos++
+	}
+	return strings.Join(parts, " "), len(parts) > 0
+}
@@ -0,0 +1,46 @@
+package ssi
+
+import "testing"
+
+func TestEvalExpr(t *testing.T) {
+	vars := map[string]string{"URI": "/docs/index.shtml", "EMPTY": "", "LANG": "en"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	for i, test := range []struct {
+		expr      string
+		expected  bool
+		shouldErr bool
+	}{
+		{`$URI`, true, false},
+		{`$EMPTY`, false, false},
+		{`$MISSING`, false, false},
+		{`${LANG} = en`, true, false},
+		{`$LANG = 'de'`, false, false},
+		{`$LANG != de`, true, false},
+		{`$URI = /^\/docs\//`, true, false},
+		{`$URI != /\.html$/`, true, false},
+		{`a < b`, true, false},
+		{`b <= a`, false, false},
+		{`!$EMPTY && $LANG = en`, true, false},
+		{`$EMPTY || $LANG = de`, false, false},
+		{`!($LANG = de || $LANG = fr)`, true, false},
+		{`'hello world' = hello world`, true, false},
+		{`($LANG = en`, false, true},
+		{`$LANG = 'en`, false, true},
+		{`$LANG < /x/`, false, true},
+		{`= en`, false, true},
+		{`$LANG = en )`, false, true},
+	} {
+		actual, err := evalExpr(test.expr, lookup)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d (%s): expected an error", i, test.expr)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d (%s): unexpected error: %v", i, test.expr, err)
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d (%s): expected %t, got %t", i, test.expr, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ssi
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("ssi", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new SSI middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := ssiParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return SSI{
+			Next:    next,
+			Rules:   rules,
+			FileSys: cfg.FileSystem(),
+			BufPool: &sync.Pool{
+				New: func() interface{} {
+					return new(bytes.Buffer)
+				},
+			},
+		}
+	})
+
+	return nil
+}
+
+func ssiParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{
+			Path:       "/",
+			Extensions: defaultExtensions,
+			ErrMsg:     defaultErrMsg,
+		}
+
+		args := c.RemainingArgs()
+		if len(args) > 0 {
+			rule.Path = args[0]
+		}
+		if len(args) > 1 {
+			rule.Extensions = args[1:]
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "ext":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Extensions = args
+			case "errmsg":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				rule.ErrMsg = c.Val()
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+			default:
+				return nil, c.Errf("Unknown ssi property '%s'", c.Val())
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// defaultExtensions are those of the documents processed,
+// unless configured otherwise, as conventional in Apache.
+var defaultExtensions = []string{".shtml"}
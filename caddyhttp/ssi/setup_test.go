@@ -0,0 +1,71 @@
+package ssi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `ssi`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(SSI)
+	if !ok {
+		t.Fatalf("Expected handler to be type SSI, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSSIParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`ssi`, false, []Rule{{Path: "/", Extensions: []string{".shtml"}, ErrMsg: defaultErrMsg}}},
+		{`ssi /legacy .shtml .html`, false, []Rule{{
+			Path:       "/legacy",
+			Extensions: []string{".shtml", ".html"},
+			ErrMsg:     defaultErrMsg,
+		}}},
+		{`ssi /old {
+			ext .htm
+			errmsg "<!-- error -->"
+		}`, false, []Rule{{Path: "/old", Extensions: []string{".htm"}, ErrMsg: "<!-- error -->"}}},
+		{`ssi {
+			ext
+		}`, true, nil},
+		{`ssi {
+			errmsg a b
+		}`, true, nil},
+		{`ssi {
+			exec cmd
+		}`, true, nil},
+	}
+	for i, test := range tests {
+		actual, err := ssiParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+// Package ssi implements server-side includes, as processed by
+// Apache's mod_include, for sites that still depend on them.
+package ssi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// SSI is middleware that processes the server-side include
+// directives of documents.
+type SSI struct {
+	Next    httpserver.Handler
+	Rules   []Rule
+	FileSys http.FileSystem
+	BufPool *sync.Pool
+}
+
+// Rule is the configuration of the documents in a path that
+// are processed.
+type Rule struct {
+	Path       string
+	Extensions []string
+
+	// ErrMsg is shown in place of directives that fail,
+	// unless a document configures its own.
+	ErrMsg string
+}
+
+// defaultErrMsg is the message Apache shows in place of a
+// directive that fails.
+const defaultErrMsg = "[an error occurred while processing this directive]"
+
+// maxDepth bounds how deeply includes may nest, so that a
+// document that includes itself fails instead of looping.
+const maxDepth = 8
+
+// depthKey is the context key of the depth of a subrequest.
+const depthKey caddy.CtxKey = "ssi_depth"
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (s SSI) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range s.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+
+		buf := s.BufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer s.BufPool.Put(buf)
+
+		shouldBuf := func(status int, header http.Header) bool {
+			return rule.matches(r.URL.Path, header)
+		}
+		rb := httpserver.NewResponseBuffer(buf, w, shouldBuf)
+		code, err := s.Next.ServeHTTP(rb, r)
+		if !rb.Buffered() || code >= 300 || err != nil {
+			return code, err
+		}
+
+		p := &processor{
+			ssi:    s,
+			rule:   rule,
+			req:    r,
+			errMsg: rule.ErrMsg,
+			vars:   documentVars(r, rb.Header()),
+		}
+		out := p.process(rb.Buffer.Bytes(), r.URL.Path, 0)
+
+		rb.CopyHeader()
+		// the document is different every time it is served
+		w.Header().Del("Last-Modified")
+		w.Header().Del("ETag")
+		w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(out)
+		}
+		return 0, nil
+	}
+	return s.Next.ServeHTTP(w, r)
+}
+
+// matches returns whether the document at urlPath, served
+// with header, is to be processed by r.
+func (r Rule) matches(urlPath string, header http.Header) bool {
+	ext := path.Ext(urlPath)
+	for _, e := range r.Extensions {
+		if ext == "" {
+			// directory index; go by its content type
+			if header != nil && strings.HasPrefix(header.Get("Content-Type"), "text/html") {
+				return true
+			}
+		} else if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentVars returns the variables that documents requested by
+// r can echo and test.
+func documentVars(r *http.Request, header http.Header) map[string]string {
+	now := time.Now()
+	vars := map[string]string{
+		"DOCUMENT_URI":           r.URL.Path,
+		"DOCUMENT_NAME":          path.Base(r.URL.Path),
+		"QUERY_STRING":           r.URL.RawQuery,
+		"QUERY_STRING_UNESCAPED": unescapeQuery(r.URL.RawQuery),
+		"DATE_LOCAL":             now.Format(time.RFC1123),
+		"DATE_GMT":               now.UTC().Format(time.RFC1123),
+		"LAST_MODIFIED":          header.Get("Last-Modified"),
+		"REQUEST_METHOD":         r.Method,
+		"REQUEST_URI":            r.URL.RequestURI(),
+		"REMOTE_ADDR":            r.RemoteAddr,
+		"SERVER_NAME":            r.Host,
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		vars["REMOTE_ADDR"] = host
+	}
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		vars["SERVER_NAME"] = host
+	}
+	for name, values := range r.Header {
+		vars["HTTP_"+strings.ToUpper(strings.Replace(name, "-", "_", -1))] = strings.Join(values, ", ")
+	}
+	return vars
+}
+
+func unescapeQuery(q string) string {
+	if s, err := url.QueryUnescape(q); err == nil {
+		return s
+	}
+	return q
+}
+
+// processor processes the directives of a document.
+type processor struct {
+	ssi    SSI
+	rule   Rule
+	req    *http.Request
+	errMsg string
+	vars   map[string]string
+}
+
+// directiveRE matches a directive: its element and attributes.
+var directiveRE = regexp.MustCompile(`<!--#([a-z]+)((?:\s+[a-z]+\s*=\s*(?:"[^"]*"|'[^']*'))*)\s*-->`)
+
+// attrRE matches an attribute of a directive.
+var attrRE = regexp.MustCompile(`([a-z]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// attr is an attribute of a directive, in order.
+type attr struct{ name, value string }
+
+// condition is the state of an if directive being processed.
+type condition struct {
+	outer bool // whether the enclosing block is output
+	taken bool // whether a branch has been output
+	on    bool // whether the current branch is output
+}
+
+// process returns doc, the document at urlPath, with its
+// directives processed; depth is how deeply it is included.
+func (p *processor) process(doc []byte, urlPath string, depth int) []byte {
+	var out bytes.Buffer
+	var conds []condition
+	output := func() bool { return len(conds) == 0 || conds[len(conds)-1].on }
+
+	for len(doc) > 0 {
+		loc := directiveRE.FindSubmatchIndex(doc)
+		if loc == nil {
+			if output() {
+				out.Write(doc)
+			}
+			break
+		}
+		if output() {
+			out.Write(doc[:loc[0]])
+		}
+		element := string(doc[loc[2]:loc[3]])
+		var attrs []attr
+		for _, m := range attrRE.FindAllSubmatch(doc[loc[4]:loc[5]], -1) {
+			value := m[2]
+			if value == nil {
+				value = m[3]
+			}
+			attrs = append(attrs, attr{string(m[1]), string(value)})
+		}
+		doc = doc[loc[1]:]
+
+		shown := output()
+		var err error
+		switch element {
+		case "if":
+			c := condition{outer: shown}
+			if c.outer {
+				c.on, err = p.test(attrs)
+				c.taken = c.on
+			}
+			conds = append(conds, c)
+		case "elif":
+			if len(conds) == 0 {
+				err = fmt.Errorf("elif without if")
+				break
+			}
+			c := &conds[len(conds)-1]
+			c.on = false
+			if c.outer && !c.taken {
+				c.on, err = p.test(attrs)
+				c.taken = c.on
+			}
+		case "else":
+			if len(conds) == 0 {
+				err = fmt.Errorf("else without if")
+				break
+			}
+			c := &conds[len(conds)-1]
+			c.on = c.outer && !c.taken
+			c.taken = true
+		case "endif":
+			if len(conds) == 0 {
+				err = fmt.Errorf("endif without if")
+				break
+			}
+			conds = conds[:len(conds)-1]
+		default:
+			if !shown {
+				continue
+			}
+			err = p.directive(&out, element, attrs, urlPath, depth)
+		}
+		if err != nil {
+			log.Printf("[ERROR] ssi: %s: %s directive: %v", urlPath, element, err)
+			if shown {
+				out.WriteString(p.errMsg)
+			}
+		}
+	}
+	if len(conds) > 0 {
+		log.Printf("[ERROR] ssi: %s: if without endif", urlPath)
+		out.WriteString(p.errMsg)
+	}
+	return out.Bytes()
+}
+
+// test evaluates the expr attribute of an if or elif directive.
+func (p *processor) test(attrs []attr) (bool, error) {
+	if len(attrs) != 1 || attrs[0].name != "expr" {
+		return false, fmt.Errorf("expected an expr attribute")
+	}
+	return evalExpr(attrs[0].value, p.lookup)
+}
+
+// directive processes the directive element with attrs, other
+// than those of conditionals, writing its output to out.
+func (p *processor) directive(out *bytes.Buffer, element string, attrs []attr, urlPath string, depth int) error {
+	switch element {
+	case "include":
+		for _, a := range attrs {
+			var body []byte
+			var err error
+			switch a.name {
+			case "virtual":
+				body, err = p.includeVirtual(p.substitute(a.value), urlPath)
+			case "file":
+				body, err = p.includeFile(p.substitute(a.value), urlPath, depth)
+			default:
+				err = fmt.Errorf("unknown attribute %s", a.name)
+			}
+			if err != nil {
+				return err
+			}
+			out.Write(body)
+		}
+	case "echo":
+		encoding := "entity"
+		for _, a := range attrs {
+			switch a.name {
+			case "encoding":
+				encoding = a.value
+			case "var":
+				value, ok := p.lookup(p.substitute(a.value))
+				if !ok {
+					value = "(none)"
+				}
+				switch encoding {
+				case "none":
+				case "url":
+					value = url.QueryEscape(value)
+				case "entity":
+					value = html.EscapeString(value)
+				default:
+					return fmt.Errorf("unknown encoding %s", encoding)
+				}
+				out.WriteString(value)
+			default:
+				return fmt.Errorf("unknown attribute %s", a.name)
+			}
+		}
+	case "set":
+		var name string
+		for _, a := range attrs {
+			switch a.name {
+			case "var":
+				name = p.substitute(a.value)
+			case "value":
+				if name == "" {
+					return fmt.Errorf("value without var")
+				}
+				p.vars[name] = p.substitute(a.value)
+			default:
+				return fmt.Errorf("unknown attribute %s", a.name)
+			}
+		}
+	case "config":
+		for _, a := range attrs {
+			switch a.name {
+			case "errmsg":
+				p.errMsg = a.value
+			default:
+				return fmt.Errorf("unsupported attribute %s", a.name)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported directive")
+	}
+	return nil
+}
+
+// resolve returns the URL path of target, relative to the
+// document at urlPath unless it is absolute.
+func resolve(target, urlPath string) string {
+	if strings.HasPrefix(target, "/") {
+		return target
+	}
+	return path.Join(path.Dir(urlPath), target)
+}
+
+// includeVirtual returns the response to a subrequest for target,
+// a URL on this site, which is handled by this middleware and
+// those after it.
+func (p *processor) includeVirtual(target, urlPath string) ([]byte, error) {
+	depth, _ := p.req.Context().Value(depthKey).(int)
+	if depth >= maxDepth {
+		return nil, fmt.Errorf("includes nested too deeply")
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsAbs() || u.Host != "" {
+		return nil, fmt.Errorf("%s is not on this site", target)
+	}
+	u.Path = resolve(u.Path, urlPath)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = httpserver.CloneHeader(p.req.Header)
+	// the whole response is needed, and uncompressed
+	req.Header.Del("Range")
+	req.Header.Del("Accept-Encoding")
+	req.Header.Del("If-Modified-Since")
+	req.Header.Del("If-None-Match")
+	req.Host = p.req.Host
+	req.RemoteAddr = p.req.RemoteAddr
+	ctx := context.WithValue(p.req.Context(), depthKey, depth+1)
+	req = req.WithContext(context.WithValue(ctx, httpserver.OriginalURLCtxKey, *req.URL))
+
+	rec := httpserver.NewSubresponse()
+	status, err := p.ssi.ServeHTTP(rec, req)
+	if err != nil {
+		return nil, err
+	}
+	if status == 0 {
+		status = rec.Status
+	}
+	if status >= 400 {
+		return nil, fmt.Errorf("%s: %d %s", target, status, http.StatusText(status))
+	}
+	return rec.Body.Bytes(), nil
+}
+
+// includeFile returns the file at target, relative to the
+// document at urlPath, processed if it is itself a document
+// with directives. As in Apache, it can't be above the
+// directory of the document.
+func (p *processor) includeFile(target, urlPath string, depth int) ([]byte, error) {
+	if strings.HasPrefix(target, "/") {
+		return nil, fmt.Errorf("%s is not a relative path", target)
+	}
+	for _, part := range strings.Split(target, "/") {
+		if part == ".." {
+			return nil, fmt.Errorf("%s is not below the document", target)
+		}
+	}
+	if depth >= maxDepth {
+		return nil, fmt.Errorf("includes nested too deeply")
+	}
+	name := resolve(target, urlPath)
+	f, err := p.ssi.FileSys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if p.rule.matches(name, nil) {
+		body = p.process(body, name, depth+1)
+	}
+	return body, nil
+}
+
+// lookup returns the value of the variable name.
+func (p *processor) lookup(name string) (string, bool) {
+	value, ok := p.vars[name]
+	return value, ok
+}
+
+// varRE matches a variable reference in a value: $name or ${name},
+// or an escaped dollar sign.
+var varRE = regexp.MustCompile(`\\\$|\$\{([A-Za-z0-9_]+)\}|\$([A-Za-z0-9_]+)`)
+
+// substitute returns s with the variables it refers to replaced
+// with their values.
+func (p *processor) substitute(s string) string {
+	return substitute(s, p.lookup)
+}
+
+func substitute(s string, lookup func(string) (string, bool)) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	return varRE.ReplaceAllStringFunc(s, func(m string) string {
+		if m == `\$` {
+			return "$"
+		}
+		name := strings.Trim(m, "${}")
+		value, _ := lookup(name)
+		return value
+	})
+}
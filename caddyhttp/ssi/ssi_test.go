@@ -0,0 +1,96 @@
+package ssi
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func TestSSI(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_ssi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"plain.html":         `<!--#include virtual="/header.html" -->`,
+		"header.html":        `<h1>Header</h1>`,
+		"virtual.shtml":      `[<!--#include virtual="header.html" -->]`,
+		"nested.shtml":       `(<!--#include virtual="/virtual.shtml" -->)`,
+		"loop.shtml":         `<!--#config errmsg="ERR" --><!--#include virtual="/loop.shtml" -->`,
+		"sub/file.shtml":     `<!--#include file="part.shtml" -->|<!--#include file="../header.html" -->`,
+		"sub/part.shtml":     `part <!--#echo var="DOCUMENT_NAME" -->`,
+		"missing.shtml":      `a<!--#include virtual="/nope.html" -->b`,
+		"echo.shtml":         `<!--#set var="greeting" value="<hi> $QUERY_STRING" --><!--#echo var="greeting" --> <!--#echo encoding="none" var="greeting" --> <!--#echo var="nothing" -->`,
+		"if.shtml":           `<!--#if expr="$QUERY_STRING = a" -->A<!--#elif expr="$QUERY_STRING = /^b/" -->B<!--#if expr="$QUERY_STRING = bb" -->BB<!--#endif --><!--#else -->other<!--#endif -->`,
+		"header_var.shtml":   `<!--#echo var="HTTP_X_TEST" -->`,
+		"unterminated.shtml": `<!--#if expr="a" -->x`,
+		"unsupported.shtml":  `<!--#exec cmd="ls" -->`,
+	}
+	for name, body := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := SSI{
+		Next:    staticfiles.FileServer{Root: http.Dir(root)},
+		Rules:   []Rule{{Path: "/", Extensions: []string{".shtml"}, ErrMsg: defaultErrMsg}},
+		FileSys: http.Dir(root),
+		BufPool: &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
+	}
+
+	for i, test := range []struct {
+		target   string
+		expected string
+	}{
+		{"/plain.html", `<!--#include virtual="/header.html" -->`},
+		{"/virtual.shtml", `[<h1>Header</h1>]`},
+		{"/nested.shtml", `([<h1>Header</h1>])`},
+		{"/loop.shtml", `ERR`},
+		{"/sub/file.shtml", `part file.shtml|` + defaultErrMsg},
+		{"/missing.shtml", `a` + defaultErrMsg + `b`},
+		{"/echo.shtml?q", `&lt;hi&gt; q <hi> q (none)`},
+		{"/if.shtml?a", `A`},
+		{"/if.shtml?bb", `BBB`},
+		{"/if.shtml?b", `B`},
+		{"/if.shtml?c", `other`},
+		{"/header_var.shtml", `test`},
+		{"/unterminated.shtml", `x` + defaultErrMsg},
+		{"/unsupported.shtml", defaultErrMsg},
+	} {
+		req := httptest.NewRequest("GET", test.target, nil)
+		req.Header.Set("X-Test", "test")
+		req = req.WithContext(context.WithValue(req.Context(), httpserver.OriginalURLCtxKey, *req.URL))
+		rec := httptest.NewRecorder()
+
+		code, err := s.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d (%s): unexpected error: %v", i, test.target, err)
+			continue
+		}
+		if code != 0 && code != http.StatusOK {
+			t.Errorf("Test %d (%s): expected status 200, got %d", i, test.target, code)
+		}
+		if body := rec.Body.String(); body != test.expected {
+			t.Errorf("Test %d (%s): expected body %q, got %q", i, test.target, test.expected, body)
+		}
+		if test.target != "/plain.html" && rec.Header().Get("Last-Modified") != "" {
+			t.Errorf("Test %d (%s): expected no Last-Modified header", i, test.target)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package staticfiles
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AcceptValue is a value of a header such as Accept, a media range
+// there, with the quality the client gives it.
+type AcceptValue struct {
+	Value string // in lower case, without parameters
+	Q     float64
+}
+
+// ParseAccept parses the values of a header whose values have
+// qualities, such as Accept, Accept-Encoding or Accept-Language,
+// in the order they are given. Values without a valid quality have
+// the quality 1; empty values are left out.
+func ParseAccept(values []string) []AcceptValue {
+	var accepted []AcceptValue
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			params := strings.Split(part, ";")
+			v := strings.ToLower(strings.TrimSpace(params[0]))
+			if v == "" {
+				continue
+			}
+			q := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						q = f
+					}
+				}
+			}
+			accepted = append(accepted, AcceptValue{Value: v, Q: q})
+		}
+	}
+	return accepted
+}
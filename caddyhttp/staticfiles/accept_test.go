@@ -0,0 +1,23 @@
+package staticfiles
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	for i, test := range []struct {
+		values   []string
+		expected []AcceptValue
+	}{
+		{nil, nil},
+		{[]string{""}, nil},
+		{[]string{"text/HTML, application/json;q=0.5"}, []AcceptValue{{"text/html", 1}, {"application/json", 0.5}}},
+		{[]string{"gzip; q=0", "br"}, []AcceptValue{{"gzip", 0}, {"br", 1}}},
+		{[]string{"de-AT;level=1;q=0.9, , fr;q=x"}, []AcceptValue{{"de-at", 0.9}, {"fr", 1}}},
+	} {
+		if actual := ParseAccept(test.values); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, actual)
+		}
+	}
+}
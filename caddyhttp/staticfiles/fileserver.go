@@ -31,6 +31,11 @@ import (
 type FileServer struct {
 	Root http.FileSystem // jailed access to the file system
 	Hide []string        // list of files for which to respond with "Not Found"
+
+	// Languages that the site is in, the first being the default.
+	// If not empty, the version of a file in the language that the
+	// client prefers, as in index.de.html, is served in its place.
+	Languages []string
 }
 
 // ServeHTTP serves static files for r according to fs's configuration.
@@ -49,8 +54,21 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 		return http.StatusNotFound, nil
 	}
 
+	// the languages the client prefers, if the site is in several
+	var langs []string
+	if len(fs.Languages) > 0 {
+		langs = preferredLanguages(r, fs.Languages)
+	}
+	var lang string // of the file being served, if chosen by it
+
 	// open the requested file
 	f, err := fs.Root.Open(reqPath)
+	if err != nil && len(langs) > 0 && os.IsNotExist(mapFSRootOpenErr(err)) {
+		// there may only be versions of it in languages
+		if langFile, _, langPath, l, ok := fs.openLanguage(reqPath, langs); ok {
+			f, err, reqPath, lang = langFile, nil, langPath, l
+		}
+	}
 	if err != nil {
 		// TODO: remove when http.Dir handles this (Go 1.9?)
 		// Go issue #18984
@@ -125,6 +143,15 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 	if d.IsDir() {
 		for _, indexPage := range IndexPages {
 			indexPath := path.Join(reqPath, indexPage)
+
+			// prefer the index file in the client's language
+			if langFile, langInfo, langPath, l, ok := fs.openLanguage(indexPath, langs); ok {
+				defer langFile.Close()
+				f.Close()
+				d, f, reqPath, lang = langInfo, langFile, langPath, l
+				break
+			}
+
 			indexFile, err := fs.Root.Open(indexPath)
 			if err != nil {
 				continue
@@ -150,6 +177,13 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 			reqPath = indexPath
 			break
 		}
+	} else if len(langs) > 0 && lang == "" && pathLanguage(reqPath, fs.Languages) == "" {
+		// serve the version of the file in the client's language
+		if langFile, langInfo, langPath, l, ok := fs.openLanguage(reqPath, langs); ok {
+			defer langFile.Close()
+			f.Close()
+			d, f, reqPath, lang = langInfo, langFile, langPath, l
+		}
 	}
 
 	// return Not Found if we either did not find an index file (and thus are
@@ -203,6 +237,21 @@ func (fs FileServer) serveFile(w http.ResponseWriter, r *http.Request) (int, err
 		break
 	}
 
+	// Tell caches which language the file is in and, unless the
+	// client asked for a language by the path, that it depends on
+	// the languages the client prefers.
+	if len(fs.Languages) > 0 {
+		if lang == "" {
+			lang = pathLanguage(reqPath, fs.Languages)
+		}
+		if lang != "" {
+			w.Header().Set("Content-Language", lang)
+		}
+		if pathLanguage(r.URL.Path, fs.Languages) == "" {
+			w.Header().Add("Vary", "Accept-Language")
+		}
+	}
+
 	// Set the ETag returned to the user-agent. Note that a conditional If-None-Match
 	// request is handled in http.ServeContent below, which checks against this ETag value.
 	w.Header().Set("ETag", etag)
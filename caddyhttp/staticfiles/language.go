@@ -0,0 +1,110 @@
+package staticfiles
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// preferredLanguages returns the languages, of those the site is in,
+// that the client of r accepts, in the order it prefers them, then
+// the default language, which is the first the site is in.
+func preferredLanguages(r *http.Request, languages []string) []string {
+	var tags []AcceptValue
+	for _, a := range ParseAccept(r.Header["Accept-Language"]) {
+		if a.Value != "*" && a.Q > 0 {
+			tags = append(tags, a)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Q > tags[j].Q })
+
+	var preferred []string
+	add := func(lang string) {
+		for _, l := range preferred {
+			if l == lang {
+				return
+			}
+		}
+		preferred = append(preferred, lang)
+	}
+	for _, a := range tags {
+		if lang := matchLanguage(a.Value, languages); lang != "" {
+			add(lang)
+		}
+	}
+	if len(languages) > 0 {
+		add(languages[0])
+	}
+	return preferred
+}
+
+// matchLanguage returns the language of languages that is tag, or,
+// failing that, the one that tag is a variety of, as de is of de-at,
+// or "" if there's none.
+func matchLanguage(tag string, languages []string) string {
+	for _, lang := range languages {
+		if strings.EqualFold(lang, tag) {
+			return lang
+		}
+	}
+	if i := strings.Index(tag, "-"); i > 0 {
+		for _, lang := range languages {
+			if strings.EqualFold(lang, tag[:i]) {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// languagePath returns the path of the version of the file at name in
+// lang, which has the language before its extension, as in
+// index.de.html.
+func languagePath(name, lang string) string {
+	ext := path.Ext(name)
+	if ext == path.Base(name) {
+		ext = "" // a dot file, such as .htaccess
+	}
+	return name[:len(name)-len(ext)] + "." + lang + ext
+}
+
+// pathLanguage returns the language, of languages, that the file at
+// name is in, according to its name, or "" if it's in none.
+func pathLanguage(name string, languages []string) string {
+	base := path.Base(name)
+	for i := 0; i < 2; i++ {
+		ext := path.Ext(base)
+		if ext == "" || ext == base {
+			return ""
+		}
+		for _, lang := range languages {
+			if strings.EqualFold(lang, ext[1:]) {
+				return lang
+			}
+		}
+		base = strings.TrimSuffix(base, ext)
+	}
+	return ""
+}
+
+// openLanguage opens the first of the versions of the file at name in
+// langs, in order, that exists and isn't a directory, returning its
+// path and language.
+func (fs FileServer) openLanguage(name string, langs []string) (http.File, os.FileInfo, string, string, bool) {
+	for _, lang := range langs {
+		langPath := languagePath(name, lang)
+		f, err := fs.Root.Open(langPath)
+		if err != nil {
+			continue
+		}
+		d, err := f.Stat()
+		if err != nil || d.IsDir() {
+			f.Close()
+			continue
+		}
+		return f, d, langPath, lang, true
+	}
+	return nil, nil, "", "", false
+}
@@ -0,0 +1,123 @@
+package staticfiles
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreferredLanguages(t *testing.T) {
+	languages := []string{"en", "de", "pt-BR"}
+	for i, test := range []struct {
+		acceptLanguage string
+		expect         []string
+	}{
+		{"", []string{"en"}},
+		{"de", []string{"de", "en"}},
+		{"de-AT, fr;q=0.9, en;q=0.5", []string{"de", "en"}},
+		{"en;q=0.5, pt-br", []string{"pt-BR", "en"}},
+		{"de;q=0, *", []string{"en"}},
+		{"fr, DE;q=0.8", []string{"de", "en"}},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", test.acceptLanguage)
+		if got := preferredLanguages(r, languages); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Test %d: expected %v, got %v", i, test.expect, got)
+		}
+	}
+}
+
+func TestLanguagePath(t *testing.T) {
+	languages := []string{"en", "de"}
+	for i, test := range []struct {
+		name, lang, expect string
+	}{
+		{"/index.html", "de", "/index.de.html"},
+		{"/docs/README", "en", "/docs/README.en"},
+		{"/archive.tar.gz", "de", "/archive.tar.de.gz"},
+		{"/.htaccess", "de", "/.htaccess.de"},
+	} {
+		got := languagePath(test.name, test.lang)
+		if got != test.expect {
+			t.Errorf("Test %d: expected %s, got %s", i, test.expect, got)
+		}
+		if lang := pathLanguage(got, languages); lang != test.lang {
+			t.Errorf("Test %d: expected %s to be in %s, got %q", i, got, test.lang, lang)
+		}
+	}
+	for _, name := range []string{"/index.html", "/file.fr.html", "/de.html", "/.de"} {
+		if lang := pathLanguage(name, languages); lang != "" {
+			t.Errorf("Expected %s not to be in a language, got %s", name, lang)
+		}
+	}
+}
+
+func TestServeHTTPLanguages(t *testing.T) {
+	root, err := ioutil.TempDir("", testDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{
+		"index.en.html":      "welcome",
+		"index.de.html":      "willkommen",
+		"about.html":         "about",
+		"about.de.html":      "über",
+		"contact.html":       "contact",
+		"docs/index.de.html": "dokumente",
+		"docs/index.html":    "documents",
+	} {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fileserver := FileServer{Root: http.Dir(root), Languages: []string{"en", "de"}}
+
+	for i, test := range []struct {
+		path, acceptLanguage string
+		expectBody           string
+		expectLanguage       string
+		expectVary           bool
+	}{
+		{"/", "de-DE,de;q=0.9", "willkommen", "de", true},
+		{"/", "fr", "welcome", "en", true},
+		{"/about.html", "de", "über", "de", true},
+		{"/about.html", "en", "about", "", true},
+		{"/contact.html", "de", "contact", "", true},
+		{"/docs/", "de", "dokumente", "de", true},
+		{"/docs/", "en", "documents", "", true},
+		{"/about.de.html", "en", "über", "de", false},
+		{"/index.en.html", "de", "welcome", "en", false},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Language", test.acceptLanguage)
+		w := httptest.NewRecorder()
+		status, err := fileserver.ServeHTTP(w, r)
+		if status != http.StatusOK || err != nil {
+			t.Errorf("Test %d: expected 200, got %d (%v)", i, status, err)
+			continue
+		}
+		if w.Body.String() != test.expectBody {
+			t.Errorf("Test %d: expected body %q, got %q", i, test.expectBody, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Language"); got != test.expectLanguage {
+			t.Errorf("Test %d: expected Content-Language %q, got %q", i, test.expectLanguage, got)
+		}
+		if vary := strings.Contains(strings.Join(w.Header()["Vary"], ","), "Accept-Language"); vary != test.expectVary {
+			t.Errorf("Test %d: expected Vary on Accept-Language %t, got %v", i, test.expectVary, w.Header()["Vary"])
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("Test %d: expected HTML, got %s", i, ct)
+		}
+	}
+
+	if status, _ := fileserver.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing.html", nil)); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a file in no language, got %d", status)
+	}
+}
@@ -1,6 +1,8 @@
 package status
 
 import (
+	"net/http"
+	"path/filepath"
 	"strconv"
 
 	"github.com/mholt/caddy"
@@ -83,6 +85,9 @@ func statusParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
 			}
 
 			rule := NewRule(basePath, status)
+			if err := ruleOptions(c, rule); err != nil {
+				return rules, err
+			}
 			rules = append(rules, rule)
 		default:
 			return rules, c.ArgErr()
@@ -91,3 +96,59 @@ func statusParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
 
 	return rules, nil
 }
+
+// ruleOptions parses the options of the response of rule:
+//
+//	status <code> <path> {
+//	    body         <text>
+//	    body_file    <file>
+//	    content_type <type>
+//	    header       <name> <value>
+//	}
+func ruleOptions(c *caddy.Controller, rule *Rule) error {
+	cfg := httpserver.GetConfig(c)
+	for c.NextBlock() {
+		switch c.Val() {
+		case "body":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			rule.Body = c.Val()
+		case "body_file":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			rule.BodyFile = c.Val()
+			if !filepath.IsAbs(rule.BodyFile) {
+				rule.BodyFile = filepath.Join(cfg.Root, rule.BodyFile)
+			}
+		case "content_type":
+			if !c.NextArg() {
+				return c.ArgErr()
+			}
+			rule.ContentType = c.Val()
+		case "header":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return c.ArgErr()
+			}
+			if rule.Headers == nil {
+				rule.Headers = make(http.Header)
+			}
+			rule.Headers.Add(args[0], args[1])
+			continue
+		default:
+			return c.Errf("Unknown status property '%s'", c.Val())
+		}
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+	}
+	if rule.Body != "" && rule.BodyFile != "" {
+		return c.Err("status can have a body or a body_file, not both")
+	}
+	if (rule.Body != "" || rule.BodyFile != "") && !bodyAllowed(rule.StatusCode) {
+		return c.Errf("status %d can't have a body", rule.StatusCode)
+	}
+	return nil
+}
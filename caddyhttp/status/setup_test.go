@@ -1,6 +1,8 @@
 package status
 
 import (
+	"net/http"
+	"reflect"
 	"testing"
 
 	"github.com/mholt/caddy"
@@ -72,6 +74,55 @@ func TestStatusParse(t *testing.T) {
 			true,
 			[]*Rule{},
 		},
+		{`status 200 /health {
+			body "ok from {host}"
+			header Cache-Control no-store
+		 }`,
+			false,
+			[]*Rule{
+				{Base: "/health", StatusCode: 200, Body: "ok from {host}", Headers: http.Header{"Cache-Control": {"no-store"}}},
+			},
+		},
+		{`status 418 /teapot {
+			body_file /srv/teapot.json
+			content_type application/json
+		 }`,
+			false,
+			[]*Rule{
+				{Base: "/teapot", StatusCode: 418, BodyFile: "/srv/teapot.json", ContentType: "application/json"},
+			},
+		},
+		{`status 200 /x {
+			body a
+			body_file b
+		 }`,
+			true,
+			[]*Rule{},
+		},
+		{`status 204 /x {
+			body a
+		 }`,
+			true,
+			[]*Rule{},
+		},
+		{`status 200 /x {
+			header X-Only-Name
+		 }`,
+			true,
+			[]*Rule{},
+		},
+		{`status 200 /x {
+			body a b
+		 }`,
+			true,
+			[]*Rule{},
+		},
+		{`status 200 /x {
+			unknown
+		 }`,
+			true,
+			[]*Rule{},
+		},
 		{`status 404 {
 			/foo
 			/bar
@@ -126,6 +177,12 @@ func TestStatusParse(t *testing.T) {
 				t.Errorf("Test %d: Expected status code %d for path '%s'. Got %d",
 					i, expectedRule.StatusCode, expectedRule.Base, actualRule.StatusCode)
 			}
+
+			if actualRule.Body != expectedRule.Body || actualRule.BodyFile != expectedRule.BodyFile ||
+				actualRule.ContentType != expectedRule.ContentType || !reflect.DeepEqual(actualRule.Headers, expectedRule.Headers) {
+				t.Errorf("Test %d: Expected response %+v for path '%s'. Got %+v",
+					i, expectedRule, expectedRule.Base, actualRule)
+			}
 		}
 	}
 }
@@ -2,7 +2,11 @@
 package status
 
 import (
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"strconv"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -15,6 +19,19 @@ type Rule struct {
 	// Status code to return
 	StatusCode int
 
+	// Body of the response, in which anything in braces is a
+	// placeholder, or the file the body is read from, which is
+	// sent as it is, so it may be JSON
+	Body     string
+	BodyFile string
+
+	// Content type of the body; if empty, it is plain text, or
+	// that of the extension of BodyFile
+	ContentType string
+
+	// Headers added to the response, which may have placeholders
+	Headers http.Header
+
 	// Request matcher
 	httpserver.RequestMatcher
 }
@@ -44,6 +61,19 @@ func (status Status) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, err
 	if cfg := httpserver.ConfigSelector(status.Rules).Select(r); cfg != nil {
 		rule := cfg.(*Rule)
 
+		if len(rule.Headers) > 0 {
+			repl := httpserver.NewReplacer(r, nil, "")
+			for name, values := range rule.Headers {
+				for _, v := range values {
+					w.Header().Add(name, repl.Replace(v))
+				}
+			}
+		}
+
+		if rule.Body != "" || rule.BodyFile != "" {
+			return rule.respond(w, r)
+		}
+
 		if rule.StatusCode < 400 {
 			// There's no ability to return response body --
 			// write the response status code in header and signal
@@ -57,3 +87,48 @@ func (status Status) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, err
 
 	return status.Next.ServeHTTP(w, r)
 }
+
+// respond writes the response of rule, with its body unless its
+// status can't have one.
+func (rule *Rule) respond(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !bodyAllowed(rule.StatusCode) {
+		w.WriteHeader(rule.StatusCode)
+		return 0, nil
+	}
+
+	var body []byte
+	contentType := rule.ContentType
+	if rule.BodyFile != "" {
+		var err error
+		body, err = ioutil.ReadFile(rule.BodyFile)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(rule.BodyFile))
+		}
+	} else {
+		body = []byte(httpserver.NewReplacer(r, nil, "").Replace(rule.Body))
+	}
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(rule.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+	return 0, nil
+}
+
+// bodyAllowed returns whether a response with status may have
+// a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case status < 200, status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
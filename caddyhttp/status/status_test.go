@@ -1,9 +1,12 @@
 package status
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -74,3 +77,79 @@ func urlPrinter(w http.ResponseWriter, r *http.Request) (int, error) {
 	fmt.Fprint(w, r.URL.String())
 	return 0, nil
 }
+
+func TestStatusBody(t *testing.T) {
+	file, err := ioutil.TempFile("", "security*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("Contact: mailto:security@{host}\n")
+	file.Close()
+	defer os.Remove(file.Name())
+
+	status := Status{
+		Rules: []httpserver.HandlerConfig{
+			&Rule{Base: "/health", StatusCode: http.StatusOK, Body: "ok from {host}",
+				Headers:        http.Header{"Cache-Control": {"no-store"}, "X-Path": {"{path}"}},
+				RequestMatcher: httpserver.PathMatcher("/health")},
+			&Rule{Base: "/teapot", StatusCode: http.StatusTeapot, Body: "short and stout",
+				ContentType:    "text/x-teapot",
+				RequestMatcher: httpserver.PathMatcher("/teapot")},
+			&Rule{Base: "/.well-known/security.txt", StatusCode: http.StatusOK, BodyFile: file.Name(),
+				RequestMatcher: httpserver.PathMatcher("/.well-known/security.txt")},
+			&Rule{Base: "/gone", StatusCode: http.StatusGone, Headers: http.Header{"X-Gone": {"yes"}},
+				RequestMatcher: httpserver.PathMatcher("/gone")},
+			&Rule{Base: "/empty", StatusCode: http.StatusNoContent, Body: "dropped",
+				RequestMatcher: httpserver.PathMatcher("/empty")},
+			&Rule{Base: "/unchanged", StatusCode: http.StatusNotModified, Body: "dropped",
+				Headers:        http.Header{"Etag": {`"x"`}},
+				RequestMatcher: httpserver.PathMatcher("/unchanged")},
+		},
+		Next: httpserver.HandlerFunc(urlPrinter),
+	}
+
+	tests := []struct {
+		method      string
+		path        string
+		code        int
+		status      int
+		contentType string
+		body        string
+		header      string
+		headerValue string
+	}{
+		{"GET", "/health", 0, http.StatusOK, "text/plain; charset=utf-8", "ok from example.com", "Cache-Control", "no-store"},
+		{"GET", "/health", 0, http.StatusOK, "text/plain; charset=utf-8", "ok from example.com", "X-Path", "/health"},
+		{"HEAD", "/health", 0, http.StatusOK, "text/plain; charset=utf-8", "", "Content-Length", "19"},
+		{"GET", "/teapot", 0, http.StatusTeapot, "text/x-teapot", "short and stout", "", ""},
+		{"GET", "/.well-known/security.txt", 0, http.StatusOK, "text/plain; charset=utf-8", "Contact: mailto:security@{host}\n", "", ""},
+		{"GET", "/gone", http.StatusGone, http.StatusOK, "", "", "X-Gone", "yes"},
+		{"GET", "/empty", 0, http.StatusNoContent, "", "", "Content-Length", ""},
+		{"GET", "/unchanged", 0, http.StatusNotModified, "", "", "Etag", `"x"`},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, "http://example.com"+test.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), httpserver.OriginalURLCtxKey, *req.URL))
+		rec := httptest.NewRecorder()
+		code, err := status.ServeHTTP(rec, req)
+		if err != nil {
+			t.Fatalf("Test %d: Serving request failed with error %v", i, err)
+		}
+		if code != test.code {
+			t.Errorf("Test %d: Expected returned status %d, got %d", i, test.code, code)
+		}
+		if rec.Code != test.status {
+			t.Errorf("Test %d: Expected response status %d, got %d", i, test.status, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("Test %d: Expected Content-Type '%s', got '%s'", i, test.contentType, ct)
+		}
+		if rec.Body.String() != test.body {
+			t.Errorf("Test %d: Expected body '%s', got '%s'", i, test.body, rec.Body.String())
+		}
+		if test.header != "" && rec.Header().Get(test.header) != test.headerValue {
+			t.Errorf("Test %d: Expected header %s '%s', got '%s'", i, test.header, test.headerValue, rec.Header().Get(test.header))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package templates
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// maxCacheEntries and maxCacheSize bound how many pages and
+// fragments are cached at once, and the size of their output.
+// When the cache is full, new output is not cached until
+// entries expire or are purged.
+const (
+	maxCacheEntries = 10000
+	maxCacheSize    = 64 << 20
+)
+
+// cacheKey identifies a cached page or fragment.
+type cacheKey struct {
+	host     string
+	path     string // the URL path of the page
+	query    string // the query string of the page
+	fragment string // the name of the fragment, or "" for the page
+	vary     string // the vary-by key, with placeholders replaced
+}
+
+// cacheEntry is cached template output.
+type cacheEntry struct {
+	body    []byte
+	header  http.Header // of a page; nil for a fragment
+	expires time.Time
+}
+
+// outputCache holds rendered template output, shared by all
+// sites so that it can be purged from the admin API.
+var outputCache = struct {
+	sync.Mutex
+	entries map[cacheKey]cacheEntry
+	size    int // of the bodies of the entries
+}{entries: make(map[cacheKey]cacheEntry)}
+
+// cacheGet returns the output cached for key, if any has not
+// yet expired.
+func cacheGet(key cacheKey) (cacheEntry, bool) {
+	outputCache.Lock()
+	defer outputCache.Unlock()
+	e, ok := outputCache.entries[key]
+	if !ok {
+		return e, false
+	}
+	if time.Now().After(e.expires) {
+		cacheRemove(key)
+		return e, false
+	}
+	return e, true
+}
+
+// cachePut caches e as the output for key.
+func cachePut(key cacheKey, e cacheEntry) {
+	outputCache.Lock()
+	defer outputCache.Unlock()
+	cacheRemove(key)
+	if len(outputCache.entries) >= maxCacheEntries || outputCache.size+len(e.body) > maxCacheSize {
+		now := time.Now()
+		for k, old := range outputCache.entries {
+			if now.After(old.expires) {
+				cacheRemove(k)
+			}
+		}
+		if len(outputCache.entries) >= maxCacheEntries || outputCache.size+len(e.body) > maxCacheSize {
+			return
+		}
+	}
+	outputCache.entries[key] = e
+	outputCache.size += len(e.body)
+}
+
+// cacheRemove removes the output cached for key, if any; the
+// cache must be locked.
+func cacheRemove(key cacheKey) {
+	if e, ok := outputCache.entries[key]; ok {
+		delete(outputCache.entries, key)
+		outputCache.size -= len(e.body)
+	}
+}
+
+// Purge removes the cached output of pages, and fragments of
+// them, whose path is within the path prefix; if host is not
+// empty, only of pages of that host. It returns how many
+// entries were removed.
+func Purge(host, prefix string) int {
+	outputCache.Lock()
+	defer outputCache.Unlock()
+	n := 0
+	for k := range outputCache.entries {
+		if (host == "" || k.host == host) && httpserver.Path(k.path).Matches(prefix) {
+			cacheRemove(k)
+			n++
+		}
+	}
+	return n
+}
+
+// CacheSize returns how many pages and fragments are cached.
+func CacheSize() int {
+	outputCache.Lock()
+	defer outputCache.Unlock()
+	return len(outputCache.entries)
+}
+
+// cacheable returns whether the response to r may be cached
+// according to rule.
+func (r Rule) cacheable(req *http.Request) bool {
+	return r.CacheTTL > 0 && (req.Method == http.MethodGet || req.Method == http.MethodHead)
+}
+
+// pageKey returns the key under which the page requested by r
+// is cached for rule.
+func (r Rule) pageKey(req *http.Request) cacheKey {
+	key := cacheKey{host: req.Host, path: req.URL.Path, query: req.URL.RawQuery}
+	if r.CacheVary != "" {
+		key.vary = httpserver.NewReplacer(req, nil, "").Replace(r.CacheVary)
+	}
+	return key
+}
@@ -0,0 +1,126 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+)
+
+func TestTemplateCache(t *testing.T) {
+	defer Purge("", "/")
+
+	root, err := ioutil.TempDir("", "caddy_templates_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(name, body string) {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("page.html", `v1 {{.URL.RawQuery}}`)
+	write("fragment.html", `{{define "side"}}side v1{{end}}[{{cache "side" "1h"}}] page v1`)
+
+	tmpl := Templates{
+		Next: staticfiles.FileServer{Root: http.Dir(root)},
+		Rules: []Rule{{
+			Path:       "/page.html",
+			Extensions: []string{".html"},
+			CacheTTL:   time.Hour,
+			CacheVary:  "{query}",
+		}, {
+			Path:       "/",
+			Extensions: []string{".html"},
+		}},
+		Root:    root,
+		FileSys: http.Dir(root),
+		BufPool: &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
+	}
+
+	get := func(target string) string {
+		req := httptest.NewRequest("GET", target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), httpserver.OriginalURLCtxKey, *req.URL))
+		rec := httptest.NewRecorder()
+		if _, err := tmpl.ServeHTTP(rec, req); err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		return rec.Body.String()
+	}
+
+	if body := get("/page.html?a"); body != "v1 a" {
+		t.Errorf("Expected first rendering, got %q", body)
+	}
+	write("page.html", `v2 {{.URL.RawQuery}}`)
+	if body := get("/page.html?a"); body != "v1 a" {
+		t.Errorf("Expected cached page, got %q", body)
+	}
+	if body := get("/page.html?b"); body != "v2 b" {
+		t.Errorf("Expected page rendered for a different query, got %q", body)
+	}
+
+	if body := get("/fragment.html"); body != "[side v1] page v1" {
+		t.Errorf("Expected first rendering of fragment, got %q", body)
+	}
+	write("fragment.html", `{{define "side"}}side v2{{end}}[{{cache "side" "1h"}}] page v2`)
+	if body := get("/fragment.html"); body != "[side v1] page v2" {
+		t.Errorf("Expected cached fragment in rendered page, got %q", body)
+	}
+
+	if n := Purge("example.org", "/"); n != 0 {
+		t.Errorf("Expected nothing purged for another host, got %d", n)
+	}
+	if n := Purge("", "/page.html"); n != 2 {
+		t.Errorf("Expected 2 pages purged, got %d", n)
+	}
+	if body := get("/page.html?a"); body != "v2 a" {
+		t.Errorf("Expected page rendered again after purge, got %q", body)
+	}
+	if body := get("/fragment.html"); body != "[side v1] page v2" {
+		t.Errorf("Expected fragment of another page to stay cached, got %q", body)
+	}
+	Purge("", "/")
+	if CacheSize() != 0 {
+		t.Errorf("Expected empty cache after purging all, got %d entries", CacheSize())
+	}
+	if body := get("/fragment.html"); body != "[side v2] page v2" {
+		t.Errorf("Expected fragment rendered again after purge, got %q", body)
+	}
+}
+
+func TestTemplateCacheKeys(t *testing.T) {
+	defer Purge("", "/")
+	rule := Rule{CacheTTL: time.Hour}
+
+	// pages are cached by query even without cache_vary
+	a, b := httptest.NewRequest("GET", "/p?id=1", nil), httptest.NewRequest("GET", "/p?id=2", nil)
+	cachePut(rule.pageKey(a), cacheEntry{body: []byte("1"), expires: time.Now().Add(time.Hour)})
+	if _, ok := cacheGet(rule.pageKey(b)); ok {
+		t.Error("Expected the page cached for another query not to be used")
+	}
+
+	// and the cache doesn't grow past its size
+	big := make([]byte, maxCacheSize/2-1)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/big?"+string(rune('a'+i)), nil)
+		cachePut(rule.pageKey(req), cacheEntry{body: big, expires: time.Now().Add(time.Hour)})
+	}
+	if CacheSize() != 3 || outputCache.size != 2*len(big)+1 {
+		t.Errorf("Expected the page that doesn't fit not to be cached, got %d entries of %d bytes", CacheSize(), outputCache.size)
+	}
+	Purge("", "/")
+	if outputCache.size != 0 {
+		t.Errorf("Expected no output cached after purging all, got %d bytes", outputCache.size)
+	}
+}
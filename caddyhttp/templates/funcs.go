@@ -0,0 +1,258 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/russross/blackfriday"
+)
+
+// Func is a function that can be called from templates.
+type Func struct {
+	// New returns the function for a template executed in
+	// ctx. It is called for every template, so that functions
+	// can depend on the request.
+	New func(ctx httpserver.Context) interface{}
+
+	// Risky functions, such as those that read files or make
+	// requests, can only be called where the sandbox policy
+	// of a rule allows them.
+	Risky bool
+}
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = make(map[string]Func)
+)
+
+// builtinFuncs are the names of the functions this package
+// provides, and whether each is risky.
+var builtinFuncs = map[string]bool{
+	"httpInclude": true,
+	"fromJSON":    false,
+	"listDir":     true,
+	"markdown":    false,
+	"env":         false, // limited by the allowlist instead
+	"cache":       false,
+}
+
+// RegisterFunc makes f available to templates as name. Plugins
+// should call it from their init functions. It panics if a
+// function with that name is already registered.
+func RegisterFunc(name string, f Func) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	_, builtin := builtinFuncs[name]
+	if _, ok := funcs[name]; ok || builtin {
+		panic("templates: function named " + name + " already registered")
+	}
+	funcs[name] = f
+}
+
+// maxSubrequestDepth bounds how deeply subrequests may nest, so
+// that a page that includes itself fails instead of looping.
+const maxSubrequestDepth = 3
+
+// subrequestDepthKey is the context key of the depth of a
+// subrequest.
+const subrequestDepthKey caddy.CtxKey = "templates_subrequest_depth"
+
+// DirEntry describes a file listed by the listDir function.
+type DirEntry struct {
+	Name    string
+	Size    int64
+	IsDir   bool
+	ModTime time.Time
+}
+
+// funcMap returns the functions for tpl, executed in ctx for
+// rule. Functions that aren't allowed by the rule still
+// exist, so that templates using them parse, but fail if called.
+func (t Templates) funcMap(rule Rule, ctx httpserver.Context, tpl *template.Template) template.FuncMap {
+	fm := template.FuncMap{
+		"httpInclude": func(target string) (string, error) { return t.subrequest(ctx.Req, target) },
+		"fromJSON":    fromJSON,
+		"listDir":     func(name string) ([]DirEntry, error) { return listDir(ctx.Root, name) },
+		"markdown":    markdown,
+		"env":         func(name string) (string, error) { return rule.env(name) },
+		"cache": func(name, ttl string, vary ...string) (string, error) {
+			return cacheFragment(tpl, ctx, name, ttl, vary)
+		},
+	}
+	for name, risky := range builtinFuncs {
+		if risky && !rule.allows(name) {
+			fm[name] = denied(name)
+		}
+	}
+
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	for name, f := range funcs {
+		if f.Risky && !rule.allows(name) {
+			fm[name] = denied(name)
+			continue
+		}
+		fm[name] = f.New(ctx)
+	}
+	return fm
+}
+
+// denied returns a function that fails when called, whatever
+// its arguments.
+func denied(name string) func(...interface{}) (interface{}, error) {
+	return func(...interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("template function %s is not allowed", name)
+	}
+}
+
+// allows returns whether the sandbox policy of r allows the
+// risky function name.
+func (r Rule) allows(name string) bool {
+	for _, allowed := range r.AllowFuncs {
+		if allowed == "*" || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// envAllowed returns whether the environment variable name
+// matches one of the patterns that r allows.
+func (r Rule) envAllowed(name string) bool {
+	for _, pattern := range r.EnvAllow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// env returns the value of the environment variable name, if
+// r allows it.
+func (r Rule) env(name string) (string, error) {
+	if !r.envAllowed(name) {
+		return "", fmt.Errorf("environment variable %s is not allowed", name)
+	}
+	return os.Getenv(name), nil
+}
+
+// subrequest serves a GET request for target, a path on the same
+// site, and returns the response body. The request is handled by
+// the whole middleware chain of the site, with the headers of r,
+// so that the middleware before this one, such as that of
+// authentication, applies to it too.
+func (t Templates) subrequest(r *http.Request, target string) (string, error) {
+	depth, _ := r.Context().Value(subrequestDepthKey).(int)
+	if depth >= maxSubrequestDepth {
+		return "", fmt.Errorf("subrequest to %s: nested too deeply", target)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if u.IsAbs() || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		return "", fmt.Errorf("subrequest to %s: not a path on this site", target)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header = httpserver.CloneHeader(r.Header)
+	req.Header.Del("Range")
+	req.Host = r.Host
+	req.RemoteAddr = r.RemoteAddr
+	c := context.WithValue(r.Context(), subrequestDepthKey, depth+1)
+	req = req.WithContext(context.WithValue(c, httpserver.OriginalURLCtxKey, *req.URL))
+
+	rec := httpserver.NewSubresponse()
+	status, err := t.Site.ServeSubrequest(rec, req, t)
+	if err != nil {
+		return "", err
+	}
+	if status == 0 {
+		status = rec.Status
+	}
+	if status >= 400 {
+		return "", fmt.Errorf("subrequest to %s: %d %s", target, status, http.StatusText(status))
+	}
+	return rec.Body.String(), nil
+}
+
+// cacheFragment returns the output of the template named name,
+// defined in tpl, executing it in ctx only if it hasn't been
+// within ttl. The output is cached for the page, with its query,
+// and for the values of vary, if given.
+func cacheFragment(tpl *template.Template, ctx httpserver.Context, name, ttl string, vary []string) (string, error) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return "", err
+	}
+	key := cacheKey{
+		host:     ctx.Req.Host,
+		path:     ctx.Req.URL.Path,
+		query:    ctx.Req.URL.RawQuery,
+		fragment: name,
+		vary:     strings.Join(vary, "\x00"),
+	}
+	if e, ok := cacheGet(key); ok {
+		return string(e.body), nil
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, name, ctx); err != nil {
+		return "", err
+	}
+	if d > 0 {
+		cachePut(key, cacheEntry{body: buf.Bytes(), expires: time.Now().Add(d)})
+	}
+	return buf.String(), nil
+}
+
+// fromJSON decodes the JSON document s.
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+// listDir returns the entries of the directory name in fs,
+// sorted by name.
+func listDir(fs http.FileSystem, name string) ([]DirEntry, error) {
+	dir, err := fs.Open(path.Clean("/" + name))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]DirEntry, len(files))
+	for i, fi := range files {
+		entries[i] = DirEntry{Name: fi.Name(), Size: fi.Size(), IsDir: fi.IsDir(), ModTime: fi.ModTime()}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// markdown renders the markdown s as HTML, leaving out any raw
+// HTML it contains.
+func markdown(s string) string {
+	renderer := blackfriday.HtmlRenderer(blackfriday.HTML_SKIP_HTML|blackfriday.HTML_SAFELINK, "", "")
+	extns := blackfriday.EXTENSION_TABLES | blackfriday.EXTENSION_FENCED_CODE |
+		blackfriday.EXTENSION_STRIKETHROUGH | blackfriday.EXTENSION_DEFINITION_LISTS
+	return string(blackfriday.Markdown([]byte(s), renderer, extns))
+}
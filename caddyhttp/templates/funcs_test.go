@@ -0,0 +1,223 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/staticfiles"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates_funcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"data.json":         `{"name": "caddy", "tags": ["a", "b"]}`,
+		"fragment.html":     `<b>{{.URL.Path}}</b>`,
+		"loop.html":         `{{httpInclude "/loop.html"}}`,
+		"dir/one.txt":       "1",
+		"dir/two/three.txt": "3",
+		"json.html":         `{{$d := fromJSON (.Include "data.json")}}{{$d.name}} {{index $d.tags 1}}`,
+		"include.html":      `[{{httpInclude "/fragment.html"}}]`,
+		"missing.html":      `{{httpInclude "/nope.html"}}`,
+		"external.html":     `{{httpInclude "http://example.com/"}}`,
+		"list.html":         `{{range listDir "/dir"}}{{.Name}}:{{.IsDir}} {{end}}`,
+		"markdown.html":     `{{markdown "# Hi <script>x</script>"}}`,
+		"env.html":          `{{env "CADDY_TPL_TEST"}}`,
+		"envdenied.html":    `{{env "CADDY_SECRET"}}`,
+		"envmap.html":       `{{range $k, $v := .Env}}{{$k}}={{$v}} {{end}}`,
+		"plugin.html":       `{{shout "hi"}} {{fileName}}`,
+		"pluginrisky.html":  `{{readSecret}}`,
+	}
+	for name, body := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	os.Setenv("CADDY_TPL_TEST", "value")
+	defer os.Unsetenv("CADDY_TPL_TEST")
+	os.Setenv("CADDY_SECRET", "secret")
+	defer os.Unsetenv("CADDY_SECRET")
+
+	RegisterFunc("shout", Func{New: func(ctx httpserver.Context) interface{} {
+		return strings.ToUpper
+	}})
+	RegisterFunc("fileName", Func{New: func(ctx httpserver.Context) interface{} {
+		return func() string { return ctx.URL.Path }
+	}})
+	RegisterFunc("readSecret", Func{Risky: true, New: func(ctx httpserver.Context) interface{} {
+		return func() string { return "secret" }
+	}})
+	defer func() {
+		funcsMu.Lock()
+		delete(funcs, "shout")
+		delete(funcs, "fileName")
+		delete(funcs, "readSecret")
+		funcsMu.Unlock()
+	}()
+
+	newTemplates := func(allow ...string) Templates {
+		return Templates{
+			Next: staticfiles.FileServer{Root: http.Dir(root)},
+			Rules: []Rule{{
+				Path:       "/",
+				Extensions: []string{".html"},
+				IndexFiles: []string{"index.html"},
+				AllowFuncs: allow,
+				EnvAllow:   []string{"CADDY_TPL_*"},
+			}},
+			Root:    root,
+			FileSys: http.Dir(root),
+			BufPool: &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
+		}
+	}
+	sandboxed := newTemplates()
+	permissive := newTemplates("*")
+
+	for i, test := range []struct {
+		tmpl      Templates
+		path      string
+		shouldErr bool
+		expected  string
+	}{
+		{sandboxed, "/json.html", false, "caddy b"},
+		{sandboxed, "/markdown.html", false, "<h1>Hi x</h1>\n"},
+		{sandboxed, "/env.html", false, "value"},
+		{sandboxed, "/envdenied.html", true, ""},
+		{sandboxed, "/envmap.html", false, "CADDY_TPL_TEST=value "},
+		{sandboxed, "/include.html", true, ""},
+		{sandboxed, "/list.html", true, ""},
+		{sandboxed, "/plugin.html", false, "HI /plugin.html"},
+		{sandboxed, "/pluginrisky.html", true, ""},
+		{permissive, "/include.html", false, "[<b>/fragment.html</b>]"},
+		{permissive, "/missing.html", true, ""},
+		{permissive, "/external.html", true, ""},
+		{permissive, "/loop.html", true, ""},
+		{permissive, "/list.html", false, "one.txt:false two:true "},
+		{permissive, "/pluginrisky.html", false, "secret"},
+		{newTemplates("listDir"), "/list.html", false, "one.txt:false two:true "},
+		{newTemplates("listDir"), "/include.html", true, ""},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), httpserver.OriginalURLCtxKey, *req.URL))
+		rec := httptest.NewRecorder()
+
+		code, err := test.tmpl.ServeHTTP(rec, req)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d (%s): expected an error, got none", i, test.path)
+			}
+			continue
+		}
+		if err != nil || code != http.StatusOK {
+			t.Errorf("Test %d (%s): expected status 200 and no error, got %d and %v", i, test.path, code, err)
+			continue
+		}
+		if body := rec.Body.String(); body != test.expected {
+			t.Errorf("Test %d (%s): expected body %q, got %q", i, test.path, test.expected, body)
+		}
+	}
+}
+
+func TestSubrequestSiteChain(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates_funcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "private"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"page.html":           `[{{httpInclude "/public.html"}}]`,
+		"leak.html":           `[{{httpInclude "/private/secret.html"}}]`,
+		"public.html":         "public",
+		"private/secret.html": "secret",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	site := &httpserver.SiteConfig{
+		Addr: httpserver.Address{Original: "localhost:2015", Host: "localhost", Port: "2015"},
+		TLS:  new(caddytls.Config),
+		Root: root,
+	}
+	// stands for authentication, before the templates
+	site.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if httpserver.Path(r.URL.Path).Matches("/private") {
+				return http.StatusUnauthorized, nil
+			}
+			return next.ServeHTTP(w, r)
+		})
+	})
+	site.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Templates{
+			Next:    next,
+			Rules:   []Rule{{Path: "/", Extensions: []string{".html"}, AllowFuncs: []string{"httpInclude"}}},
+			Root:    root,
+			FileSys: http.Dir(root),
+			BufPool: &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
+			Site:    site,
+		}
+	})
+	s, err := httpserver.NewServer("127.0.0.1:0", []*httpserver.SiteConfig{site})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/page.html", http.StatusOK, "[public]"},
+		{"/leak.html", http.StatusInternalServerError, ""},
+	} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost:2015"+test.path, nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d (%s): expected status %d, got %d", i, test.path, test.expectedStatus, rec.Code)
+		}
+		if test.expectedBody != "" && rec.Body.String() != test.expectedBody {
+			t.Errorf("Test %d (%s): expected body %q, got %q", i, test.path, test.expectedBody, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("Test %d (%s): expected the subrequest to be refused, got %q", i, test.path, rec.Body.String())
+		}
+	}
+}
+
+func TestRegisterFuncDuplicate(t *testing.T) {
+	for _, name := range []string{"markdown", "env"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected registering %s to panic", name)
+				}
+			}()
+			RegisterFunc(name, Func{})
+		}()
+	}
+}
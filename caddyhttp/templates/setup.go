@@ -2,8 +2,9 @@ package templates
 
 import (
 	"bytes"
-	"net/http"
+	"path"
 	"sync"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -28,7 +29,8 @@ func setup(c *caddy.Controller) error {
 	tmpls := Templates{
 		Rules:   rules,
 		Root:    cfg.Root,
-		FileSys: http.Dir(cfg.Root),
+		FileSys: cfg.FileSystem(),
+		Site:    cfg,
 		BufPool: &sync.Pool{
 			New: func() interface{} {
 				return new(bytes.Buffer)
@@ -36,6 +38,18 @@ func setup(c *caddy.Controller) error {
 		},
 	}
 
+	// pages cached by the previous configuration may no
+	// longer be what this one renders
+	for _, rule := range rules {
+		if rule.CacheTTL > 0 {
+			c.OnStartup(func() error {
+				Purge("", "/")
+				return nil
+			})
+			break
+		}
+	}
+
 	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		tmpls.Next = next
 		return tmpls
@@ -81,6 +95,39 @@ func templatesParse(c *caddy.Controller) ([]Rule, error) {
 					}
 					rule.Delims[0] = args[0]
 					rule.Delims[1] = args[1]
+
+				case "allow":
+					args := c.RemainingArgs()
+					if len(args) == 0 {
+						return nil, c.ArgErr()
+					}
+					rule.AllowFuncs = append(rule.AllowFuncs, args...)
+
+				case "env":
+					args := c.RemainingArgs()
+					if len(args) == 0 {
+						return nil, c.ArgErr()
+					}
+					for _, pattern := range args {
+						if _, err := path.Match(pattern, ""); err != nil {
+							return nil, c.Errf("Bad env pattern '%s': %v", pattern, err)
+						}
+					}
+					rule.EnvAllow = append(rule.EnvAllow, args...)
+
+				case "cache":
+					args := c.RemainingArgs()
+					if len(args) == 0 || len(args) > 2 {
+						return nil, c.ArgErr()
+					}
+					ttl, err := time.ParseDuration(args[0])
+					if err != nil || ttl <= 0 {
+						return nil, c.Errf("Bad cache TTL '%s'", args[0])
+					}
+					rule.CacheTTL = ttl
+					if len(args) == 2 {
+						rule.CacheVary = args[1]
+					}
 				}
 			}
 		default:
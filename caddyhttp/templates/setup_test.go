@@ -3,6 +3,7 @@ package templates
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -80,6 +81,32 @@ func TestTemplatesParse(t *testing.T) {
 			Extensions: []string{".html"},
 			Delims:     [2]string{"{%", "%}"},
 		}}},
+		{`templates {
+				allow httpInclude listDir
+				env APP_* HOME
+			}`, false, []Rule{{
+			Path:       defaultTemplatePath,
+			Extensions: defaultTemplateExtensions,
+			AllowFuncs: []string{"httpInclude", "listDir"},
+			EnvAllow:   []string{"APP_*", "HOME"},
+		}}},
+		{`templates {
+				cache 5m {path}{query}
+			}`, false, []Rule{{
+			Path:       defaultTemplatePath,
+			Extensions: defaultTemplateExtensions,
+			CacheTTL:   5 * time.Minute,
+			CacheVary:  "{path}{query}",
+		}}},
+		{`templates {
+				cache 0
+			}`, true, nil},
+		{`templates {
+				allow
+			}`, true, nil},
+		{`templates {
+				env [
+			}`, true, nil},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("http", test.inputTemplateConfig)
@@ -102,6 +129,17 @@ func TestTemplatesParse(t *testing.T) {
 			if fmt.Sprint(actualTemplateConfig.Extensions) != fmt.Sprint(test.expectedTemplateConfig[j].Extensions) {
 				t.Errorf("Expected %v to be the  Extensions , but got %v instead", test.expectedTemplateConfig[j].Extensions, actualTemplateConfig.Extensions)
 			}
+			if fmt.Sprint(actualTemplateConfig.AllowFuncs) != fmt.Sprint(test.expectedTemplateConfig[j].AllowFuncs) {
+				t.Errorf("Test %d expected AllowFuncs %v, but got %v", i, test.expectedTemplateConfig[j].AllowFuncs, actualTemplateConfig.AllowFuncs)
+			}
+			if fmt.Sprint(actualTemplateConfig.EnvAllow) != fmt.Sprint(test.expectedTemplateConfig[j].EnvAllow) {
+				t.Errorf("Test %d expected EnvAllow %v, but got %v", i, test.expectedTemplateConfig[j].EnvAllow, actualTemplateConfig.EnvAllow)
+			}
+			if actualTemplateConfig.CacheTTL != test.expectedTemplateConfig[j].CacheTTL ||
+				actualTemplateConfig.CacheVary != test.expectedTemplateConfig[j].CacheVary {
+				t.Errorf("Test %d expected cache %v %q, but got %v %q", i, test.expectedTemplateConfig[j].CacheTTL,
+					test.expectedTemplateConfig[j].CacheVary, actualTemplateConfig.CacheTTL, actualTemplateConfig.CacheVary)
+			}
 		}
 	}
 
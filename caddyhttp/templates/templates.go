@@ -27,6 +27,18 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 
 		fpath := r.URL.Path
 
+		// serve the page as rendered before, if it is cached
+		if rule.cacheable(r) {
+			if e, ok := cacheGet(rule.pageKey(r)); ok {
+				for k, v := range e.header {
+					w.Header()[k] = v
+				}
+				modTime, _ := time.Parse(http.TimeFormat, w.Header().Get("Last-Modified"))
+				http.ServeContent(w, r, filepath.Base(fpath), modTime, bytes.NewReader(e.body))
+				return http.StatusOK, nil
+			}
+		}
+
 		// get a buffer from the pool and make a response recorder
 		buf := t.BufPool.Get().(*bytes.Buffer)
 		buf.Reset()
@@ -68,8 +80,16 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 			tpl.Delims(rule.Delims[0], rule.Delims[1])
 		}
 
+		// create execution context for the template template
+		ctx := httpserver.NewContextWithHeader(w.Header())
+		ctx.Root = t.FileSys
+		ctx.Req = r
+		ctx.URL = r.URL
+		ctx.EnvAllowed = rule.envAllowed
+
 		// add custom functions
 		tpl.Funcs(httpserver.TemplateFuncs)
+		tpl.Funcs(t.funcMap(rule, ctx, tpl))
 
 		// parse the template
 		parsedTpl, err := tpl.Parse(rb.Buffer.String())
@@ -77,12 +97,6 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 			return http.StatusInternalServerError, err
 		}
 
-		// create execution context for the template template
-		ctx := httpserver.NewContextWithHeader(w.Header())
-		ctx.Root = t.FileSys
-		ctx.Req = r
-		ctx.URL = r.URL
-
 		// execute the template
 		buf.Reset()
 		err = parsedTpl.Execute(buf, ctx)
@@ -96,6 +110,15 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 		// set the actual content length now that the template was executed
 		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
 
+		// cache the page, unless it is specific to the client
+		if rule.cacheable(r) && w.Header().Get("Set-Cookie") == "" {
+			cachePut(rule.pageKey(r), cacheEntry{
+				body:    append([]byte(nil), buf.Bytes()...),
+				header:  httpserver.CloneHeader(w.Header()),
+				expires: time.Now().Add(rule.CacheTTL),
+			})
+		}
+
 		// get the modification time in preparation to ServeContent
 		modTime, _ := time.Parse(http.TimeFormat, w.Header().Get("Last-Modified"))
 
@@ -115,6 +138,10 @@ type Templates struct {
 	Root    string
 	FileSys http.FileSystem
 	BufPool *sync.Pool // docs: "A Pool must not be copied after first use."
+
+	// Site is the config of the site, whose middleware chain
+	// serves the subrequests of httpInclude.
+	Site *httpserver.SiteConfig
 }
 
 // Rule represents a template rule. A template will only execute
@@ -125,4 +152,19 @@ type Rule struct {
 	Extensions []string
 	IndexFiles []string
 	Delims     [2]string
+
+	// AllowFuncs are the names of the risky functions that
+	// templates may call, or "*" for all of them.
+	AllowFuncs []string
+
+	// EnvAllow are patterns of the names of the environment
+	// variables that the env function may read.
+	EnvAllow []string
+
+	// CacheTTL is how long rendered pages are cached; if 0,
+	// they are rendered on every request. Pages are cached by
+	// host and path, and by CacheVary, a placeholder expression,
+	// with its placeholders replaced.
+	CacheTTL  time.Duration
+	CacheVary string
 }
@@ -0,0 +1,41 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket: it fills with tokens, one per byte, at
+// rate per second, up to burst.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket returns a full bucket for limit.
+func newBucket(limit Limit) *bucket {
+	return &bucket{rate: float64(limit.Rate), burst: float64(limit.Burst), tokens: float64(limit.Burst)}
+}
+
+// reserve takes n tokens from the bucket at now, and returns how long
+// to wait before they are there. Tokens taken before they are there
+// are owed, so that whoever reserves next waits for them too.
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,26 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	b := newBucket(Limit{Rate: 100, Burst: 50})
+	start := time.Now()
+	for i, test := range []struct {
+		n          int
+		at         time.Duration
+		expectWait time.Duration
+	}{
+		{50, 0, 0},                      // the burst
+		{10, 0, 100 * time.Millisecond}, // owed
+		{10, 100 * time.Millisecond, 100 * time.Millisecond}, // paid back, owes again
+		{30, time.Second, 0}, // refilled, to the burst only
+		{30, time.Second, 100 * time.Millisecond},
+	} {
+		if wait := b.reserve(test.n, start.Add(test.at)); wait != test.expectWait {
+			t.Errorf("Test %d: expected to wait %v, got %v", i, test.expectWait, wait)
+		}
+	}
+}
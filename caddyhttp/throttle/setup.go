@@ -0,0 +1,106 @@
+package throttle
+
+import (
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("throttle", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Throttle middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := throttleParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Throttle{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// throttleParse parses
+//
+//	throttle [paths...] {
+//		connection rate [burst]
+//		total rate [burst]
+//		except paths...
+//	}
+//
+// where rates are sizes per second, such as 512KB or 1MB/s, and
+// bursts are sizes, the rate by default.
+func throttleParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		paths := c.RemainingArgs()
+		if len(paths) == 0 {
+			paths = []string{"/"}
+		}
+		var except []string
+		var conn, total Limit
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "connection":
+				var err error
+				if conn, err = parseLimit(c); err != nil {
+					return nil, err
+				}
+			case "total":
+				var err error
+				if total, err = parseLimit(c); err != nil {
+					return nil, err
+				}
+			case "except":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				except = append(except, args...)
+			default:
+				return nil, c.Errf("Unknown throttle property '%s'", c.Val())
+			}
+		}
+
+		if conn.Rate == 0 && total.Rate == 0 {
+			return nil, c.Err("throttle requires a connection or total rate")
+		}
+		rules = append(rules, NewRule(paths, except, conn, total))
+	}
+
+	return rules, nil
+}
+
+// parseLimit parses the rate and optional burst of the property c
+// is at.
+func parseLimit(c *caddy.Controller) (Limit, error) {
+	property := c.Val()
+	args := c.RemainingArgs()
+	if len(args) < 1 || len(args) > 2 {
+		return Limit{}, c.ArgErr()
+	}
+	rate, err := humanize.ParseBytes(strings.TrimSuffix(args[0], "/s"))
+	if err != nil || rate == 0 {
+		return Limit{}, c.Errf("Invalid throttle %s rate '%s'", property, args[0])
+	}
+	limit := Limit{Rate: int64(rate), Burst: int64(rate)}
+	if len(args) == 2 {
+		burst, err := humanize.ParseBytes(args[1])
+		if err != nil || burst == 0 {
+			return Limit{}, c.Errf("Invalid throttle %s burst '%s'", property, args[1])
+		}
+		limit.Burst = int64(burst)
+	}
+	return limit, nil
+}
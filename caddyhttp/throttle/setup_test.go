@@ -0,0 +1,95 @@
+package throttle
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `throttle {
+		connection 1MB
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Throttle)
+	if !ok {
+		t.Fatalf("Expected handler to be type Throttle, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestThrottleParse(t *testing.T) {
+	for i, test := range []struct {
+		input        string
+		shouldErr    bool
+		expectPaths  []string
+		expectExcept []string
+		expectConn   Limit
+		expectTotal  Limit
+	}{
+		{`throttle {
+			connection 1MB
+		}`, false, []string{"/"}, nil, Limit{1000000, 1000000}, Limit{}},
+		{`throttle /downloads /videos {
+			connection 512KiB/s 1MiB
+			total 10MB/s
+			except /downloads/small
+		}`, false, []string{"/downloads", "/videos"}, []string{"/downloads/small"},
+			Limit{512 * 1024, 1024 * 1024}, Limit{10000000, 10000000}},
+		{`throttle`, true, nil, nil, Limit{}, Limit{}},
+		{`throttle {
+			connection fast
+		}`, true, nil, nil, Limit{}, Limit{}},
+		{`throttle {
+			connection 1MB lots
+		}`, true, nil, nil, Limit{}, Limit{}},
+		{`throttle {
+			total 0
+		}`, true, nil, nil, Limit{}, Limit{}},
+		{`throttle {
+			connection 1MB 2MB 3MB
+		}`, true, nil, nil, Limit{}, Limit{}},
+		{`throttle {
+			connection 1MB
+			except
+		}`, true, nil, nil, Limit{}, Limit{}},
+		{`throttle {
+			rate 1MB
+		}`, true, nil, nil, Limit{}, Limit{}},
+	} {
+		rules, err := throttleParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		rule := rules[0]
+		if !reflect.DeepEqual(rule.Paths, test.expectPaths) || !reflect.DeepEqual(rule.Except, test.expectExcept) {
+			t.Errorf("Test %d: expected paths %v except %v, got %v except %v", i, test.expectPaths, test.expectExcept, rule.Paths, rule.Except)
+		}
+		if rule.Conn != test.expectConn || rule.Total != test.expectTotal {
+			t.Errorf("Test %d: expected limits %v and %v, got %v and %v", i, test.expectConn, test.expectTotal, rule.Conn, rule.Total)
+		}
+		if (rule.total != nil) != (test.expectTotal.Rate > 0) {
+			t.Errorf("Test %d: expected a total bucket only with a total limit", i)
+		}
+	}
+}
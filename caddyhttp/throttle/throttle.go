@@ -0,0 +1,181 @@
+// Package throttle implements middleware that limits the bandwidth
+// of responses, of each connection and of all of them together, to
+// protect the bandwidth of sites that serve large files.
+package throttle
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Throttle is middleware that limits the bandwidth of responses.
+type Throttle struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Limit is a bandwidth, in bytes per second, and how many bytes may
+// be sent at once after sending less for a while.
+type Limit struct {
+	Rate  int64
+	Burst int64
+}
+
+// Rule is the bandwidth limits of the responses for some paths. The
+// first rule that matches a request applies to it.
+type Rule struct {
+	// Paths are the paths whose responses are limited, and Except
+	// those of them whose responses aren't.
+	Paths  []string
+	Except []string
+
+	// Conn limits the bandwidth of each connection, and Total that
+	// of all of the responses together; a zero Rate means no limit.
+	Conn  Limit
+	Total Limit
+
+	total   *bucket
+	connsMu sync.Mutex
+	conns   map[string]*connBucket
+}
+
+// connBucket is the bucket of a connection, and how many responses
+// are using it.
+type connBucket struct {
+	*bucket
+	refs int
+}
+
+// NewRule returns a rule limiting the responses for paths, but not
+// those for except, to conn per connection and total together.
+func NewRule(paths, except []string, conn, total Limit) *Rule {
+	rule := &Rule{Paths: paths, Except: except, Conn: conn, Total: total, conns: make(map[string]*connBucket)}
+	if total.Rate > 0 {
+		rule.total = newBucket(total)
+	}
+	return rule
+}
+
+// matches returns whether the responses for urlPath are limited by
+// rule.
+func (rule *Rule) matches(urlPath string) bool {
+	for _, p := range rule.Except {
+		if httpserver.Path(urlPath).Matches(p) {
+			return false
+		}
+	}
+	for _, p := range rule.Paths {
+		if httpserver.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireConn returns the bucket of the connection addr, which must
+// be released when the response is written.
+func (rule *Rule) acquireConn(addr string) *bucket {
+	rule.connsMu.Lock()
+	defer rule.connsMu.Unlock()
+	cb, ok := rule.conns[addr]
+	if !ok {
+		cb = &connBucket{bucket: newBucket(rule.Conn)}
+		rule.conns[addr] = cb
+	}
+	cb.refs++
+	return cb.bucket
+}
+
+// releaseConn releases the bucket of the connection addr, forgetting
+// it when no response is using it.
+func (rule *Rule) releaseConn(addr string) {
+	rule.connsMu.Lock()
+	defer rule.connsMu.Unlock()
+	if cb, ok := rule.conns[addr]; ok {
+		cb.refs--
+		if cb.refs == 0 {
+			delete(rule.conns, addr)
+		}
+	}
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (t Throttle) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range t.Rules {
+		if !rule.matches(r.URL.Path) {
+			continue
+		}
+		tw := &throttleWriter{
+			ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w},
+			ctx:                   r.Context(),
+		}
+		if rule.Conn.Rate > 0 {
+			tw.add(rule.acquireConn(r.RemoteAddr), rule.Conn)
+			defer rule.releaseConn(r.RemoteAddr)
+		}
+		if rule.total != nil {
+			tw.add(rule.total, rule.Total)
+		}
+		return t.Next.ServeHTTP(tw, r)
+	}
+	return t.Next.ServeHTTP(w, r)
+}
+
+// throttleWriter writes no faster than its buckets allow.
+type throttleWriter struct {
+	*httpserver.ResponseWriterWrapper
+	ctx     context.Context
+	buckets []*bucket
+	chunk   int // the most written at once
+}
+
+// add makes w write no faster than b, which is for limit, allows.
+func (w *throttleWriter) add(b *bucket, limit Limit) {
+	w.buckets = append(w.buckets, b)
+	if w.chunk == 0 || int(limit.Burst) < w.chunk {
+		w.chunk = int(limit.Burst)
+	}
+}
+
+// Write writes b in chunks no bigger than the smallest burst, waiting
+// before each until the buckets allow it. It gives up if the client
+// goes away.
+func (w *throttleWriter) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		n := len(b)
+		if n > w.chunk {
+			n = w.chunk
+		}
+		var wait time.Duration
+		now := time.Now()
+		for _, bucket := range w.buckets {
+			if d := bucket.reserve(n, now); d > wait {
+				wait = d
+			}
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-w.ctx.Done():
+				timer.Stop()
+				return written, w.ctx.Err()
+			}
+		}
+		m, err := w.ResponseWriterWrapper.Write(b[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// Interface guards
+var _ httpserver.HTTPInterfaces = (*throttleWriter)(nil)
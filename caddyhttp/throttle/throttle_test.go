@@ -0,0 +1,82 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func writeBody(size int) httpserver.Handler {
+	return httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		_, err := w.Write(bytes.Repeat([]byte("x"), size))
+		return 0, err
+	})
+}
+
+func TestThrottle(t *testing.T) {
+	rule := NewRule([]string{"/files"}, []string{"/files/small"}, Limit{Rate: 1000, Burst: 100}, Limit{})
+	th := Throttle{Next: writeBody(300), Rules: []*Rule{rule}}
+
+	for i, test := range []struct {
+		path    string
+		minWait time.Duration
+		maxWait time.Duration
+	}{
+		{"/files/big.iso", 150 * time.Millisecond, time.Second},
+		{"/files/small/a.txt", 0, 100 * time.Millisecond},
+		{"/index.html", 0, 100 * time.Millisecond},
+	} {
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		if _, err := th.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil)); err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		took := time.Since(start)
+		if took < test.minWait || took > test.maxWait {
+			t.Errorf("Test %d: expected to take between %v and %v, took %v", i, test.minWait, test.maxWait, took)
+		}
+		if rec.Body.Len() != 300 {
+			t.Errorf("Test %d: expected 300 bytes, got %d", i, rec.Body.Len())
+		}
+	}
+	if len(rule.conns) != 0 {
+		t.Errorf("Expected connection buckets to be released, got %d", len(rule.conns))
+	}
+}
+
+func TestThrottleTotal(t *testing.T) {
+	// two connections share the total bandwidth
+	rule := NewRule([]string{"/"}, nil, Limit{}, Limit{Rate: 1000, Burst: 100})
+	th := Throttle{Next: writeBody(100), Rules: []*Rule{rule}}
+
+	start := time.Now()
+	for _, addr := range []string{"10.0.0.1:1000", "10.0.0.2:1000", "10.0.0.3:1000"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		th.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if took := time.Since(start); took < 150*time.Millisecond {
+		t.Errorf("Expected the responses to share the total bandwidth, took %v", took)
+	}
+}
+
+func TestThrottleCanceled(t *testing.T) {
+	rule := NewRule([]string{"/"}, nil, Limit{Rate: 10, Burst: 10}, Limit{})
+	th := Throttle{Next: writeBody(100), Rules: []*Rule{rule}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := th.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if err == nil {
+		t.Error("Expected an error when the client goes away")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Expected to give up when the client went away, took %v", took)
+	}
+}
@@ -1,6 +1,7 @@
 package timeouts
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/mholt/caddy"
@@ -24,8 +25,14 @@ func setupTimeouts(c *caddy.Controller) error {
 
 			// ensure the kind of timeout is recognized
 			kind := c.Val()
+			if kind == "min_rate" || kind == "max_requests" {
+				if err := setConnLimit(c, &config.Timeouts, kind); err != nil {
+					return err
+				}
+				continue
+			}
 			if kind != "read" && kind != "header" && kind != "write" && kind != "idle" {
-				return c.Errf("unknown timeout '%s': must be read, header, write, or idle", kind)
+				return c.Errf("unknown timeout '%s': must be read, header, write, idle, min_rate, or max_requests", kind)
 			}
 
 			// parse the timeout duration
@@ -104,3 +111,31 @@ func setupTimeouts(c *caddy.Controller) error {
 
 	return nil
 }
+
+// setConnLimit parses the value of the min_rate or max_requests
+// limit, kind, into timeouts. min_rate is the fewest bytes per
+// second at which request bodies may be sent, max_requests the
+// most requests per connection; either may be none.
+func setConnLimit(c *caddy.Controller, timeouts *httpserver.Timeouts, kind string) error {
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return c.ArgErr()
+	}
+	var n int64
+	if args[0] != "none" {
+		var err error
+		n, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil || n <= 0 {
+			return c.Errf("%s must be a positive number or none, not '%s'", kind, args[0])
+		}
+	}
+	switch kind {
+	case "min_rate":
+		timeouts.MinRate = n
+		timeouts.MinRateSet = true
+	case "max_requests":
+		timeouts.MaxRequests = int(n)
+		timeouts.MaxRequestsSet = true
+	}
+	return nil
+}
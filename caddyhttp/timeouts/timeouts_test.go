@@ -26,6 +26,12 @@ func TestSetupTimeouts(t *testing.T) {
 		{input: "timeouts { \n read \n }", shouldErr: true},
 		{input: "timeouts { \n read 1s 2s \n }", shouldErr: true},
 		{input: "timeouts { \n foo \n }", shouldErr: true},
+		{input: "timeouts { \n min_rate 1024 \n max_requests 100 \n }", shouldErr: false},
+		{input: "timeouts { \n min_rate none \n }", shouldErr: false},
+		{input: "timeouts { \n min_rate \n }", shouldErr: true},
+		{input: "timeouts { \n min_rate 1kb \n }", shouldErr: true},
+		{input: "timeouts { \n max_requests 0 \n }", shouldErr: true},
+		{input: "timeouts { \n max_requests 1 2 \n }", shouldErr: true},
 	}
 	for i, tc := range testCases {
 		controller := caddy.NewTestController("", tc.input)
@@ -102,6 +108,20 @@ func TestTimeoutsSetProperly(t *testing.T) {
 				WriteTimeout: 2 * time.Second, WriteTimeoutSet: true,
 			},
 		},
+		{
+			input: "timeouts {\n min_rate 512 \n max_requests 100 \n read 1m \n }",
+			expected: httpserver.Timeouts{
+				ReadTimeout: 1 * time.Minute, ReadTimeoutSet: true,
+				MinRate: 512, MinRateSet: true,
+				MaxRequests: 100, MaxRequestsSet: true,
+			},
+		},
+		{
+			input: "timeouts {\n max_requests none \n }",
+			expected: httpserver.Timeouts{
+				MaxRequests: 0, MaxRequestsSet: true,
+			},
+		},
 		{
 			input: "timeouts 1s\ntimeouts 2s",
 			expected: httpserver.Timeouts{
@@ -143,5 +163,17 @@ func TestTimeoutsSetProperly(t *testing.T) {
 		if got, want := cfg.Timeouts.IdleTimeoutSet, tc.expected.IdleTimeoutSet; got != want {
 			t.Errorf("Test %d: Expected IdleTimeoutSet=%v, got %v", i, want, got)
 		}
+		if got, want := cfg.Timeouts.MinRate, tc.expected.MinRate; got != want {
+			t.Errorf("Test %d: Expected MinRate=%v, got %v", i, want, got)
+		}
+		if got, want := cfg.Timeouts.MinRateSet, tc.expected.MinRateSet; got != want {
+			t.Errorf("Test %d: Expected MinRateSet=%v, got %v", i, want, got)
+		}
+		if got, want := cfg.Timeouts.MaxRequests, tc.expected.MaxRequests; got != want {
+			t.Errorf("Test %d: Expected MaxRequests=%v, got %v", i, want, got)
+		}
+		if got, want := cfg.Timeouts.MaxRequestsSet, tc.expected.MaxRequestsSet; got != want {
+			t.Errorf("Test %d: Expected MaxRequestsSet=%v, got %v", i, want, got)
+		}
 	}
 }
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+// TraceID identifies a trace, which is a tree of spans.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid returns whether t is not all zeros.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid returns whether s is not all zeros.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// flagSampled is the trace-flags bit that marks a trace as sampled.
+const flagSampled = 0x01
+
+// SpanContext is what is propagated between services about
+// a span: its trace, its ID and whether it is sampled, as
+// carried in a W3C traceparent header.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// ParseTraceparent parses the value of a traceparent header as
+// described by https://www.w3.org/TR/trace-context/. It returns
+// false if the value is malformed, in which case the header must
+// be ignored.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 ||
+		len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, false
+	}
+	if !isLowerHex(parts[1]) || !isLowerHex(parts[2]) {
+		return sc, false
+	}
+	hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&flagSampled != 0
+	return sc, true
+}
+
+// Traceparent formats sc as the value of a traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		rand.Read(t[:])
+	}
+	return t
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		rand.Read(s[:])
+	}
+	return s
+}
+
+// shouldSample decides whether a new trace with the given ID is
+// sampled at rate, which is between 0 and 1. The decision depends
+// only on the ID, so every service sampling at the same rate makes
+// the same decision about a trace.
+func shouldSample(t TraceID, rate float64) bool {
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	// the low 8 bytes of a random trace ID are uniformly distributed
+	return binary.BigEndian.Uint64(t[8:]) < uint64(rate*(1<<64-1))
+}
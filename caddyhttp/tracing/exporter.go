@@ -0,0 +1,251 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Span is a finished span of a request served by Caddy.
+type Span struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanID
+	Start, End time.Time
+	Attributes map[string]interface{}
+	Error      bool
+}
+
+// OTLP exporter batching settings.
+const (
+	batchSize     = 512
+	queueSize     = 4096
+	flushInterval = 5 * time.Second
+)
+
+// Exporter sends finished spans in batches to an OpenTelemetry
+// collector using OTLP over HTTP with JSON encoding.
+type Exporter struct {
+	Endpoint string
+	Headers  http.Header
+	Service  string
+
+	client  *http.Client
+	queue   chan Span
+	stop    chan struct{}
+	stopped chan struct{}
+	started bool
+	mu      sync.Mutex
+}
+
+// NewExporter returns an exporter that sends spans of service
+// to endpoint, the full URL of the collector's traces resource,
+// adding headers to each request.
+func NewExporter(endpoint, service string, headers http.Header) *Exporter {
+	return &Exporter{
+		Endpoint: endpoint,
+		Headers:  headers,
+		Service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan Span, queueSize),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Start starts sending queued spans in the background.
+func (e *Exporter) Start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started {
+		e.started = true
+		go e.run()
+	}
+	return nil
+}
+
+// Stop sends any queued spans and stops the exporter.
+// An exporter cannot be restarted once stopped.
+func (e *Exporter) Stop() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started {
+		return nil
+	}
+	select {
+	case <-e.stop:
+	default:
+		close(e.stop)
+	}
+	<-e.stopped
+	return nil
+}
+
+// Export queues span to be sent. If the queue is full, as it may
+// be when the collector is unreachable, the span is dropped.
+func (e *Exporter) Export(span Span) {
+	select {
+	case e.queue <- span:
+	default:
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			log.Printf("[ERROR] tracing: exporting %d spans to %s: %v", len(batch), e.Endpoint, err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Exporter) send(spans []Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for field, values := range e.Headers {
+		req.Header[field] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// The following types are the parts of the OTLP JSON encoding
+// of an ExportTraceServiceRequest that are used by the exporter.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpKeyValue struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+	otlpStatus struct {
+		Code int `json:"code,omitempty"`
+	}
+)
+
+// OTLP enumeration values.
+const (
+	otlpSpanKindServer  = 2
+	otlpStatusCodeError = 2
+)
+
+func (e *Exporter) encode(spans []Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.Context.TraceID.String(),
+			SpanID:            span.Context.SpanID.String(),
+			Name:              span.Name,
+			Kind:              otlpSpanKindServer,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.Parent.IsValid() {
+			s.ParentSpanID = span.Parent.String()
+		}
+		if span.Error {
+			s.Status.Code = otlpStatusCodeError
+		}
+		out = append(out, s)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]interface{}{"service.name": e.Service})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "caddy"}, Spans: out}},
+	}}}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case int:
+			// 64-bit integers are strings in OTLP JSON
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: value})
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
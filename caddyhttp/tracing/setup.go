@@ -0,0 +1,163 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("tracing", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// config is the parsed tracing directive.
+type config struct {
+	endpoint string
+	headers  http.Header
+	sample   float64
+	service  string
+}
+
+// setup configures a new Tracing middleware instance. The sites
+// of a server block share one exporter.
+func setup(c *caddy.Controller) error {
+	cfg, err := tracingParse(c)
+	if err != nil {
+		return err
+	}
+
+	t := Tracing{Sample: cfg.sample}
+	if cfg.endpoint != "" {
+		exporter, ok := c.ServerBlockStorage.(*Exporter)
+		if !ok {
+			exporter = NewExporter(cfg.endpoint, cfg.service, cfg.headers)
+			c.ServerBlockStorage = exporter
+			c.OnStartup(exporter.Start)
+			c.OnShutdown(exporter.Stop)
+		}
+		t.Exporter = exporter
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		t.Next = next
+		return t
+	})
+
+	return nil
+}
+
+// tracingParse parses
+//
+//     tracing [endpoint] {
+//         endpoint <url>
+//         header   <name> <value>
+//         sample   <rate>
+//         service  <name>
+//     }
+//
+// where the endpoint is the URL of an OTLP/HTTP collector and the
+// sample rate is a fraction or a percentage.
+func tracingParse(c *caddy.Controller) (config, error) {
+	cfg := config{headers: make(http.Header), sample: 1, service: defaultServiceName}
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			cfg.endpoint = args[0]
+		default:
+			return cfg, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "endpoint":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				cfg.endpoint = args[0]
+			case "header":
+				if len(args) != 2 {
+					return cfg, c.ArgErr()
+				}
+				cfg.headers.Add(args[0], args[1])
+			case "sample":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				rate, err := parseRate(args[0])
+				if err != nil {
+					return cfg, c.Errf("invalid sample rate '%s': must be between 0 and 1, or 0%% and 100%%", args[0])
+				}
+				cfg.sample = rate
+			case "service":
+				if len(args) != 1 {
+					return cfg, c.ArgErr()
+				}
+				cfg.service = args[0]
+			default:
+				return cfg, c.Errf("unknown property '%s'", what)
+			}
+		}
+	}
+
+	if cfg.endpoint != "" {
+		endpoint, err := tracesURL(cfg.endpoint)
+		if err != nil {
+			return cfg, c.Errf("invalid endpoint '%s': %v", cfg.endpoint, err)
+		}
+		cfg.endpoint = endpoint
+	}
+	return cfg, nil
+}
+
+// parseRate parses a sample rate such as 0.25 or 25%.
+func parseRate(s string) (float64, error) {
+	divisor := 1.0
+	if strings.HasSuffix(s, "%") {
+		s, divisor = strings.TrimSuffix(s, "%"), 100
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	rate /= divisor
+	if rate < 0 || rate > 1 {
+		return 0, strconv.ErrRange
+	}
+	return rate, nil
+}
+
+// tracesURL returns the URL to which spans are sent for the
+// given endpoint. As with OTLP exporters generally, an endpoint
+// without a path is a collector's base URL.
+func tracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errBadScheme
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultTracesPath
+	}
+	return u.String(), nil
+}
+
+const (
+	defaultServiceName = "caddy"
+	defaultTracesPath  = "/v1/traces"
+)
+
+var errBadScheme = errors.New("scheme must be http or https")
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	for i, test := range []struct {
+		input            string
+		shouldErr        bool
+		expectedEndpoint string // empty if no exporter is expected
+		expectedSample   float64
+	}{
+		{`tracing`, false, "", 1},
+		{`tracing http://collector:4318`, false, "http://collector:4318/v1/traces", 1},
+		{`tracing https://collector/otlp/traces`, false, "https://collector/otlp/traces", 1},
+		{"tracing {\n endpoint http://c/\n sample 0.25\n service web\n header Authorization secret\n}", false, "http://c/v1/traces", 0.25},
+		{"tracing {\n sample 10%\n}", false, "", 0.1},
+		{"tracing {\n sample 1.5\n}", true, "", 0},
+		{"tracing {\n sample lots\n}", true, "", 0},
+		{"tracing {\n header Authorization\n}", true, "", 0},
+		{"tracing {\n bogus\n}", true, "", 0},
+		{`tracing ftp://collector`, true, "", 0},
+		{`tracing a b`, true, "", 0},
+	} {
+		c := caddy.NewTestController("http", test.input)
+		err := setup(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+
+		mids := httpserver.GetConfig(c).Middleware()
+		if len(mids) == 0 {
+			t.Fatalf("Test %d: Expected middleware, got 0 instead", i)
+		}
+		handler := mids[0](httpserver.EmptyNext)
+		tr, ok := handler.(Tracing)
+		if !ok {
+			t.Fatalf("Test %d: Expected handler to be type Tracing, got: %#v", i, handler)
+		}
+		if tr.Sample != test.expectedSample {
+			t.Errorf("Test %d: Expected sample rate %v, got %v", i, test.expectedSample, tr.Sample)
+		}
+		if test.expectedEndpoint == "" {
+			if tr.Exporter != nil {
+				t.Errorf("Test %d: Expected no exporter, got one for %s", i, tr.Exporter.Endpoint)
+			}
+		} else if tr.Exporter == nil || tr.Exporter.Endpoint != test.expectedEndpoint {
+			t.Errorf("Test %d: Expected exporter for %s, got %#v", i, test.expectedEndpoint, tr.Exporter)
+		}
+		if !httpserver.SameNext(tr.Next, httpserver.EmptyNext) {
+			t.Errorf("Test %d: 'Next' field of handler was not set properly", i)
+		}
+	}
+}
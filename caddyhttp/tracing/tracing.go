@@ -0,0 +1,84 @@
+// Package tracing implements the tracing directive, which creates
+// a span for each request, propagates W3C trace context to upstream
+// services and exports sampled spans to an OpenTelemetry collector.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Tracing is a middleware that traces requests.
+type Tracing struct {
+	Next httpserver.Handler
+
+	// Sample is the fraction of new traces, between 0 and 1,
+	// that are sampled. Requests that are part of a trace
+	// already follow the sampling decision of their caller.
+	Sample float64
+
+	// Exporter sends sampled spans; if nil, spans are not
+	// exported, but trace context is still propagated.
+	Exporter *Exporter
+}
+
+// ServeHTTP starts a span for r, continuing the trace in its
+// traceparent header if there is one, and replaces that header
+// with the new span's context, so that the span becomes the
+// parent of any request proxied upstream.
+func (t Tracing) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	parent, continued := ParseTraceparent(r.Header.Get("Traceparent"))
+	sc := SpanContext{SpanID: newSpanID()}
+	if continued {
+		sc.TraceID, sc.Sampled = parent.TraceID, parent.Sampled
+	} else {
+		parent = SpanContext{}
+		sc.TraceID = newTraceID()
+		sc.Sampled = shouldSample(sc.TraceID, t.Sample)
+	}
+
+	// any tracestate header is passed on unchanged
+	r.Header.Set("Traceparent", sc.Traceparent())
+	c := context.WithValue(r.Context(), httpserver.TraceIDCtxKey, sc.TraceID.String())
+	c = context.WithValue(c, httpserver.SpanIDCtxKey, sc.SpanID.String())
+	r = r.WithContext(c)
+
+	if !sc.Sampled || t.Exporter == nil {
+		return t.Next.ServeHTTP(w, r)
+	}
+
+	rec := httpserver.NewResponseRecorder(w)
+	start := time.Now()
+	status, err := t.Next.ServeHTTP(rec, r)
+
+	code := status
+	if code == 0 {
+		code = rec.Status()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	t.Exporter.Export(Span{
+		Name:    r.Method,
+		Context: sc,
+		Parent:  parent.SpanID,
+		Start:   start,
+		End:     time.Now(),
+		Attributes: map[string]interface{}{
+			"http.method":      r.Method,
+			"http.scheme":      scheme,
+			"http.host":        r.Host,
+			"http.target":      r.URL.RequestURI(),
+			"http.flavor":      r.Proto,
+			"http.user_agent":  r.UserAgent(),
+			"http.status_code": code,
+			"net.peer.addr":    r.RemoteAddr,
+		},
+		Error: err != nil || code >= 500,
+	})
+	return status, err
+}
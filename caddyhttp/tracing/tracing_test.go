@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	for i, test := range []struct {
+		value           string
+		expectedOK      bool
+		expectedSampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"", false, false},
+	} {
+		sc, ok := ParseTraceparent(test.value)
+		if ok != test.expectedOK {
+			t.Errorf("Test %d: Expected ok=%v, got %v", i, test.expectedOK, ok)
+			continue
+		}
+		if ok && sc.Sampled != test.expectedSampled {
+			t.Errorf("Test %d: Expected sampled=%v, got %v", i, test.expectedSampled, sc.Sampled)
+		}
+		if ok && test.value[:2] == "00" && sc.Traceparent() != test.value {
+			t.Errorf("Test %d: Expected %s to format as itself, got %s", i, test.value, sc.Traceparent())
+		}
+	}
+}
+
+func TestShouldSample(t *testing.T) {
+	var sampled int
+	for i := 0; i < 1000; i++ {
+		if shouldSample(newTraceID(), 0.5) {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Errorf("Expected about half of traces to be sampled at 0.5, got %d of 1000", sampled)
+	}
+	id := newTraceID()
+	if !shouldSample(id, 1) || shouldSample(id, 0) {
+		t.Error("Expected rate 1 to sample and rate 0 not to sample")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "secret" {
+			t.Errorf("Expected configured header to be sent to the collector")
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var req otlpRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("Expected OTLP JSON, got error: %v", err)
+		}
+		received <- req
+	}))
+	defer collector.Close()
+
+	exporter := NewExporter(collector.URL+defaultTracesPath, "test", http.Header{"Authorization": {"secret"}})
+	exporter.Start()
+
+	var upstreamTraceparent, traceID, spanID string
+	tr := Tracing{Sample: 0, Exporter: exporter, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		upstreamTraceparent = r.Header.Get("Traceparent")
+		traceID, _ = r.Context().Value(httpserver.TraceIDCtxKey).(string)
+		spanID, _ = r.Context().Value(httpserver.SpanIDCtxKey).(string)
+		return http.StatusBadGateway, nil
+	})}
+
+	// a new trace, not sampled at rate 0
+	r := httptest.NewRequest("GET", "/", nil)
+	tr.ServeHTTP(httptest.NewRecorder(), r)
+	sc, ok := ParseTraceparent(upstreamTraceparent)
+	if !ok || sc.Sampled {
+		t.Errorf("Expected an unsampled traceparent to be propagated, got %q", upstreamTraceparent)
+	}
+	if sc.TraceID.String() != traceID || sc.SpanID.String() != spanID {
+		t.Errorf("Expected placeholders %s and %s to match traceparent %s", traceID, spanID, upstreamTraceparent)
+	}
+
+	// a sampled trace continued from the caller
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	r = httptest.NewRequest("GET", "/a?b=c", nil)
+	r.Header.Set("Traceparent", incoming)
+	tr.ServeHTTP(httptest.NewRecorder(), r)
+	sc, ok = ParseTraceparent(upstreamTraceparent)
+	if !ok || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() == "00f067aa0ba902b7" {
+		t.Errorf("Expected the trace to continue with a new span, got %q", upstreamTraceparent)
+	}
+
+	exporter.Stop()
+	req := <-received
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Expected one resource and scope, got %#v", req)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("Expected only the sampled span to be exported, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" || span.SpanID != spanID {
+		t.Errorf("Expected exported span to match propagated context, got %#v", span)
+	}
+	if span.Status.Code != otlpStatusCodeError {
+		t.Errorf("Expected 502 response to mark the span as an error")
+	}
+	var target string
+	for _, kv := range span.Attributes {
+		if kv.Key == "http.target" {
+			target, _ = kv.Value["stringValue"].(string)
+		}
+	}
+	if target != "/a?b=c" {
+		t.Errorf("Expected http.target /a?b=c, got %q", target)
+	}
+}
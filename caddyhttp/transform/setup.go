@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("transform", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new Transform middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := transformParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Transform{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// transformParse parses
+//
+//	transform [path] {
+//		if              a cond b
+//		method_override [header]
+//		query_add       name value
+//		query_set       name value
+//		query_remove    names...
+//		query_rename    name to
+//		header_to_query header name
+//		query_to_header name header
+//	}
+//
+// once for each rule, whose transformations are applied in order.
+// The values of query_add and query_set may have placeholders.
+func transformParse(c *caddy.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return nil, c.ArgErr()
+		}
+
+		matcher, err := httpserver.SetupIfMatcher(c)
+		if err != nil {
+			return nil, err
+		}
+
+		for c.NextBlock() {
+			if httpserver.IfMatcherKeyword(c) {
+				rule.Matcher = matcher
+				continue
+			}
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "method_override":
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				rule.MethodOverride = DefaultMethodOverride
+				if len(args) == 1 {
+					rule.MethodOverride = args[0]
+				}
+			case QueryAdd, QuerySet, QueryRename, HeaderToQuery, QueryToHeader:
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				rule.Ops = append(rule.Ops, Op{Action: what, Name: args[0], Value: args[1]})
+			case QueryRemove:
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, name := range args {
+					rule.Ops = append(rule.Ops, Op{Action: what, Name: name})
+				}
+			default:
+				return nil, c.Errf("Unknown transform property '%s'", what)
+			}
+		}
+
+		if rule.MethodOverride == "" && len(rule.Ops) == 0 {
+			return nil, c.Err("transform needs at least one transformation")
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
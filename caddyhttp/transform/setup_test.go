@@ -0,0 +1,112 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `transform {
+		method_override
+	}`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Transform)
+	if !ok {
+		t.Fatalf("Expected handler to be type Transform, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestTransformParse(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expected      []Rule
+		expectMatcher bool
+	}{
+		{`transform /api {
+			method_override
+			query_add       source legacy
+			query_set       host {host}
+			query_remove    debug trace
+			query_rename    q search
+			header_to_query X-Api-Key api_key
+			query_to_header token Authorization
+		}
+		transform {
+			method_override X-Method
+		}`, false, []Rule{
+			{Path: "/api", MethodOverride: DefaultMethodOverride, Ops: []Op{
+				{QueryAdd, "source", "legacy"},
+				{QuerySet, "host", "{host}"},
+				{QueryRemove, "debug", ""},
+				{QueryRemove, "trace", ""},
+				{QueryRename, "q", "search"},
+				{HeaderToQuery, "X-Api-Key", "api_key"},
+				{QueryToHeader, "token", "Authorization"},
+			}},
+			{Path: "/", MethodOverride: "X-Method"},
+		}, false},
+		{`transform / {
+			if {>User-Agent} has legacy
+			query_add v 1
+		}`, false, []Rule{
+			{Path: "/", Ops: []Op{{QueryAdd, "v", "1"}}},
+		}, true},
+		{`transform`, true, nil, false},
+		{`transform / /api {
+			method_override
+		}`, true, nil, false},
+		{`transform {
+			method_override a b
+		}`, true, nil, false},
+		{`transform {
+			query_add v
+		}`, true, nil, false},
+		{`transform {
+			query_remove
+		}`, true, nil, false},
+		{`transform {
+			query_rename a
+		}`, true, nil, false},
+		{`transform {
+			path_add /v1
+		}`, true, nil, false},
+	}
+	for i, test := range tests {
+		actual, err := transformParse(caddy.NewTestController("http", test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		for j := range actual {
+			if (actual[j].Matcher != nil) != test.expectMatcher {
+				t.Errorf("Test %d: expected matcher %t, got %v", i, test.expectMatcher, actual[j].Matcher)
+			}
+			actual[j].Matcher = nil
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
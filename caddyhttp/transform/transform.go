@@ -0,0 +1,128 @@
+// Package transform is middleware that adapts the requests of legacy
+// clients to the APIs they're sent to: it overrides the methods of
+// POST requests with X-HTTP-Method-Override, and adds, removes and
+// renames query parameters, and maps headers to them and back.
+package transform
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// Transform is middleware that transforms requests.
+type Transform struct {
+	Next  httpserver.Handler
+	Rules []Rule
+}
+
+// Rule is a transformation of the requests in a path.
+type Rule struct {
+	Path string
+
+	// Matcher, if not nil, must match the request,
+	// as in if conditions.
+	Matcher httpserver.RequestMatcher
+
+	// MethodOverride, if not "", is the header whose value is the
+	// method POST requests are given, if it's one of overridable.
+	MethodOverride string
+
+	// Ops are the transformations of the request, in order.
+	Ops []Op
+}
+
+// Op is a transformation of a request.
+type Op struct {
+	Action string // one of the actions below
+	Name   string // of a query parameter, or a header for header_to_query
+	Value  string // of it, which may have placeholders, or what it maps to
+}
+
+// The actions of operations.
+const (
+	QueryAdd      = "query_add"       // adds the parameter Name with Value
+	QuerySet      = "query_set"       // sets the parameter Name to Value
+	QueryRemove   = "query_remove"    // removes the parameter Name
+	QueryRename   = "query_rename"    // renames the parameter Name to Value
+	HeaderToQuery = "header_to_query" // sets the parameter Value to the header Name
+	QueryToHeader = "query_to_header" // sets the header Value to the parameter Name
+)
+
+// DefaultMethodOverride is the header of the method of POST requests
+// overridden.
+const DefaultMethodOverride = "X-HTTP-Method-Override"
+
+// overridable are the methods that POST requests may be given.
+var overridable = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (t Transform) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range t.Rules {
+		if !httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+		if rule.Matcher != nil && !rule.Matcher.Match(r) {
+			continue
+		}
+		rule.apply(r)
+	}
+	return t.Next.ServeHTTP(w, r)
+}
+
+// apply transforms r.
+func (rule Rule) apply(r *http.Request) {
+	if rule.MethodOverride != "" && r.Method == http.MethodPost {
+		method := strings.ToUpper(strings.TrimSpace(r.Header.Get(rule.MethodOverride)))
+		if overridable[method] {
+			r.Method = method
+		}
+		r.Header.Del(rule.MethodOverride)
+	}
+	if len(rule.Ops) == 0 {
+		return
+	}
+
+	replacer := httpserver.NewReplacer(r, nil, "")
+	query := r.URL.Query()
+	queryChanged := false
+	for _, op := range rule.Ops {
+		switch op.Action {
+		case QueryAdd:
+			query.Add(op.Name, replacer.Replace(op.Value))
+			queryChanged = true
+		case QuerySet:
+			query.Set(op.Name, replacer.Replace(op.Value))
+			queryChanged = true
+		case QueryRemove:
+			if _, ok := query[op.Name]; ok {
+				query.Del(op.Name)
+				queryChanged = true
+			}
+		case QueryRename:
+			if values, ok := query[op.Name]; ok {
+				query.Del(op.Name)
+				query[op.Value] = append(query[op.Value], values...)
+				queryChanged = true
+			}
+		case HeaderToQuery:
+			if value := r.Header.Get(op.Name); value != "" {
+				query.Set(op.Value, value)
+				queryChanged = true
+			}
+		case QueryToHeader:
+			if value := query.Get(op.Name); value != "" {
+				r.Header.Set(op.Value, value)
+			}
+		}
+	}
+	if queryChanged {
+		r.URL.RawQuery = query.Encode()
+	}
+}
@@ -0,0 +1,106 @@
+package transform
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestTransform(t *testing.T) {
+	var got *http.Request
+	tr := Transform{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			got = r
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{
+			{Path: "/api", MethodOverride: DefaultMethodOverride, Ops: []Op{
+				{QueryAdd, "source", "legacy"},
+				{QuerySet, "host", "{hostonly}"},
+				{QueryRemove, "debug", ""},
+				{QueryRename, "q", "search"},
+				{HeaderToQuery, "X-Api-Key", "api_key"},
+				{QueryToHeader, "token", "X-Token"},
+			}},
+			{Path: "/old", MethodOverride: "X-Method"},
+		},
+	}
+
+	for i, test := range []struct {
+		method       string
+		url          string
+		header       http.Header
+		expectMethod string
+		expectQuery  string
+		expectHeader http.Header
+	}{
+		{"POST", "/api/items", http.Header{"X-Http-Method-Override": {"delete"}},
+			"DELETE", "host=example.com&source=legacy", http.Header{"X-Http-Method-Override": nil}},
+		{"POST", "/api/items", http.Header{"X-Http-Method-Override": {"CONNECT"}},
+			"POST", "host=example.com&source=legacy", http.Header{"X-Http-Method-Override": nil}},
+		{"GET", "/api/items", http.Header{"X-Http-Method-Override": {"DELETE"}},
+			"GET", "host=example.com&source=legacy", http.Header{"X-Http-Method-Override": {"DELETE"}}},
+		{"GET", "/api/items?q=cats&q=dogs&debug=1&source=app&host=evil", nil,
+			"GET", "host=example.com&search=cats&search=dogs&source=app&source=legacy", nil},
+		{"GET", "/api/items?token=secret", http.Header{"X-Api-Key": {"k"}},
+			"GET", "api_key=k&host=example.com&source=legacy&token=secret", http.Header{"X-Token": {"secret"}}},
+		{"POST", "/old/form?debug=1", http.Header{"X-Method": {"PUT"}},
+			"PUT", "debug=1", nil},
+		{"POST", "/other?debug=1", http.Header{"X-Http-Method-Override": {"PUT"}},
+			"POST", "debug=1", http.Header{"X-Http-Method-Override": {"PUT"}}},
+	} {
+		r := httptest.NewRequest(test.method, "http://example.com:8080"+test.url, nil)
+		for name, values := range test.header {
+			r.Header[name] = values
+		}
+		tr.ServeHTTP(httptest.NewRecorder(), r)
+		if got.Method != test.expectMethod {
+			t.Errorf("Test %d: expected method %s, got %s", i, test.expectMethod, got.Method)
+		}
+		if got.URL.RawQuery != test.expectQuery {
+			t.Errorf("Test %d: expected query %s, got %s", i, test.expectQuery, got.URL.RawQuery)
+		}
+		for name, values := range test.expectHeader {
+			if values == nil && got.Header.Get(name) != "" {
+				t.Errorf("Test %d: expected no %s header, got %s", i, name, got.Header.Get(name))
+			} else if values != nil && got.Header.Get(name) != values[0] {
+				t.Errorf("Test %d: expected %s header %s, got %s", i, name, values[0], got.Header.Get(name))
+			}
+		}
+	}
+}
+
+func TestTransformCondition(t *testing.T) {
+	rules, err := transformParse(caddy.NewTestController("http", `transform {
+		if {>User-Agent} has legacy
+		query_add v 1
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var query string
+	tr := Transform{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			query = r.URL.RawQuery
+			return http.StatusOK, nil
+		}),
+		Rules: rules,
+	}
+
+	for i, test := range []struct {
+		userAgent, expectQuery string
+	}{
+		{"legacy-client/1.0", "v=1"},
+		{"modern-client/2.0", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", test.userAgent)
+		tr.ServeHTTP(httptest.NewRecorder(), r)
+		if query != test.expectQuery {
+			t.Errorf("Test %d: expected query %q, got %q", i, test.expectQuery, query)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tryfiles
+
+import (
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("try_files", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new TryFiles middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := tryFilesParse(c)
+	if err != nil {
+		return err
+	}
+
+	cfg := httpserver.GetConfig(c)
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return TryFiles{Next: next, FileSys: cfg.FileSystem(), Rules: rules}
+	})
+
+	return nil
+}
+
+// tryFilesParse parses the try_files directive, which
+// has two forms:
+//
+//     try_files candidates... fallback
+//
+// which applies to the whole site, or
+//
+//     try_files basepath {
+//         files    candidates...
+//         fallback fallback
+//     }
+func tryFilesParse(c *caddy.Controller) ([]httpserver.HandlerConfig, error) {
+	var rules []httpserver.HandlerConfig
+
+	for c.Next() {
+		var rule *Rule
+		args := c.RemainingArgs()
+
+		if c.NextBlock() {
+			if len(args) != 1 {
+				return rules, c.ArgErr()
+			}
+			rule = NewRule(args[0], nil, "")
+			for {
+				switch c.Val() {
+				case "files":
+					rule.Files = append(rule.Files, c.RemainingArgs()...)
+				case "fallback":
+					if !c.NextArg() {
+						return rules, c.ArgErr()
+					}
+					rule.Fallback = c.Val()
+					if c.NextArg() {
+						return rules, c.ArgErr()
+					}
+				default:
+					return rules, c.Errf("Unknown try_files property '%s'", c.Val())
+				}
+				if !c.NextBlock() {
+					break
+				}
+			}
+			if len(rule.Files) == 0 {
+				return rules, c.Err("try_files: no candidate files given")
+			}
+		} else {
+			if len(args) < 2 {
+				return rules, c.ArgErr()
+			}
+			rule = NewRule("/", args[:len(args)-1], args[len(args)-1])
+		}
+
+		if _, isStatus := fallbackStatus(rule.Fallback); !isStatus && len(rule.Fallback) > 0 && rule.Fallback[0] == '=' {
+			return rules, c.Errf("Invalid fallback status '%s'", rule.Fallback)
+		}
+
+		for _, other := range rules {
+			if other.BasePath() == rule.Base {
+				return rules, c.Errf("Duplicate path: '%s'", rule.Base)
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
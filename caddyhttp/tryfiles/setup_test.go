@@ -0,0 +1,107 @@
+package tryfiles
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `try_files {path} /index.html`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(TryFiles)
+	if !ok {
+		t.Fatalf("Expected handler to be type TryFiles, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestTryFilesParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{`try_files {path} /index.html`, false, []Rule{
+			{Base: "/", Files: []string{"{path}"}, Fallback: "/index.html"},
+		}},
+		{`try_files {path} {path}/ {path}.html =404`, false, []Rule{
+			{Base: "/", Files: []string{"{path}", "{path}/", "{path}.html"}, Fallback: "=404"},
+		}},
+		{`try_files /app {
+			files {path} /app/index.html
+			fallback /api/render
+		}`, false, []Rule{
+			{Base: "/app", Files: []string{"{path}", "/app/index.html"}, Fallback: "/api/render"},
+		}},
+		{`try_files /app {
+			files {path}
+		}`, false, []Rule{
+			{Base: "/app", Files: []string{"{path}"}},
+		}},
+		{`try_files`, true, nil},
+		{`try_files {path}`, true, nil},
+		{`try_files {path} =abc`, true, nil},
+		{`try_files /a /b {
+			files {path}
+		}`, true, nil},
+		{`try_files /app {
+			fallback =404
+		}`, true, nil},
+		{`try_files /app {
+			files {path}
+			fallback
+		}`, true, nil},
+		{`try_files /app {
+			files {path}
+			other thing
+		}`, true, nil},
+		{"try_files {path} /a\ntry_files {path} /b", true, nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		actual, err := tryFilesParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		if len(actual) != len(test.expected) {
+			t.Fatalf("Test %d expected %d rules, but got %d", i, len(test.expected), len(actual))
+		}
+		for j, cfg := range actual {
+			rule := cfg.(*Rule)
+			expected := test.expected[j]
+			if rule.Base != expected.Base || rule.Fallback != expected.Fallback ||
+				len(rule.Files) != len(expected.Files) {
+				t.Errorf("Test %d, rule %d: expected %+v, got %+v", i, j, expected, *rule)
+				continue
+			}
+			for k := range rule.Files {
+				if rule.Files[k] != expected.Files[k] {
+					t.Errorf("Test %d, rule %d: expected files %v, got %v", i, j, expected.Files, rule.Files)
+				}
+			}
+		}
+	}
+}
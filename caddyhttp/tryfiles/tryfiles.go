@@ -0,0 +1,114 @@
+// Package tryfiles is middleware that rewrites requests to the
+// first of a list of candidate paths that exists on disk.
+package tryfiles
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/caddyhttp/rewrite"
+)
+
+// Rule is a list of candidate paths tried for requests
+// under a base path.
+type Rule struct {
+	// Base path. Requests to this path and sub-paths are
+	// subject to this rule.
+	Base string
+
+	// Files are the candidate paths, which may contain
+	// placeholders. A candidate ending in a slash only
+	// matches a directory.
+	Files []string
+
+	// Fallback is used when none of the candidates exist.
+	// It is either a path the request is rewritten to,
+	// which need not exist (so it may be handled by a
+	// proxy, for instance), or "=" followed by a status
+	// code to respond with. If empty, the request is
+	// passed on unchanged.
+	Fallback string
+
+	httpserver.RequestMatcher
+}
+
+// NewRule creates a new Rule.
+func NewRule(base string, files []string, fallback string) *Rule {
+	return &Rule{
+		Base:           base,
+		Files:          files,
+		Fallback:       fallback,
+		RequestMatcher: httpserver.PathMatcher(base),
+	}
+}
+
+// BasePath implements httpserver.HandlerConfig interface.
+func (rule *Rule) BasePath() string {
+	return rule.Base
+}
+
+// TryFiles is middleware that rewrites requests to the first
+// existing candidate file.
+type TryFiles struct {
+	Next    httpserver.Handler
+	FileSys http.FileSystem
+	Rules   []httpserver.HandlerConfig
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (t TryFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	cfg := httpserver.ConfigSelector(t.Rules).Select(r)
+	if cfg == nil {
+		return t.Next.ServeHTTP(w, r)
+	}
+	rule := cfg.(*Rule)
+
+	repl := httpserver.NewReplacer(r, nil, "")
+	for _, file := range rule.Files {
+		if exists(t.FileSys, repl.Replace(file)) {
+			rewrite.To(t.FileSys, r, file, repl)
+			return t.Next.ServeHTTP(w, r)
+		}
+	}
+
+	if code, ok := fallbackStatus(rule.Fallback); ok {
+		return code, nil
+	}
+	if rule.Fallback != "" {
+		rewrite.To(t.FileSys, r, rule.Fallback, repl)
+	}
+	return t.Next.ServeHTTP(w, r)
+}
+
+// fallbackStatus returns the status code of a "=NNN"
+// fallback, if that's what fallback is.
+func fallbackStatus(fallback string) (int, bool) {
+	if !strings.HasPrefix(fallback, "=") {
+		return 0, false
+	}
+	code, err := strconv.Atoi(fallback[1:])
+	return code, err == nil
+}
+
+// exists reports whether the file at the given path, which
+// may include a query string, exists in fs. A path ending
+// in a slash must be a directory, otherwise a regular file.
+func exists(fs http.FileSystem, name string) bool {
+	if i := strings.Index(name, "?"); i >= 0 {
+		name = name[:i]
+	}
+	wantDir := strings.HasSuffix(name, "/")
+	f, err := fs.Open(path.Clean("/" + name))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.IsDir() == wantDir
+}
@@ -0,0 +1,77 @@
+package tryfiles
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestTryFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_tryfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"docs", "app"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"index.html", "about.html", "style.css", "app/index.html"} {
+		if err := ioutil.WriteFile(filepath.Join(root, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tf := TryFiles{
+		FileSys: http.Dir(root),
+		Rules: []httpserver.HandlerConfig{
+			NewRule("/", []string{"{path}", "{path}/", "{path}.html"}, "=404"),
+			NewRule("/app", []string{"{path}"}, "/app/index.html"),
+			NewRule("/api", []string{"{path}"}, "/backend{path}"),
+			NewRule("/loose", []string{"{path}"}, ""),
+		},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write([]byte(r.URL.Path))
+			return 0, nil
+		}),
+	}
+
+	tests := []struct {
+		url          string
+		expectedCode int
+		expectedPath string
+	}{
+		{"/style.css", 0, "/style.css"},
+		{"/about", 0, "/about.html"},
+		{"/docs", 0, "/docs/"},
+		{"/nothing", http.StatusNotFound, ""},
+		{"/app/route/deep", 0, "/app/index.html"},
+		{"/app/index.html", 0, "/app/index.html"},
+		{"/api/users?id=1", 0, "/backend/api/users"},
+		{"/loose/thing", 0, "/loose/thing"},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		ctx := context.WithValue(req.Context(), httpserver.OriginalURLCtxKey, *req.URL)
+		req = req.WithContext(ctx)
+		rec := httptest.NewRecorder()
+		code, err := tf.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedCode, code)
+		}
+		if body := rec.Body.String(); body != test.expectedPath {
+			t.Errorf("Test %d: Expected path '%s', got '%s'", i, test.expectedPath, body)
+		}
+	}
+}
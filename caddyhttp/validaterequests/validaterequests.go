@@ -0,0 +1,89 @@
+package validaterequests
+
+import (
+	"strconv"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("validate_requests", caddy.Plugin{
+		ServerType: "http",
+		Action:     setupValidateRequests,
+	})
+}
+
+// defaultMaxChunkExt is the longest chunk extension allowed when
+// no other length is given.
+const defaultMaxChunkExt = 128
+
+func setupValidateRequests(c *caddy.Controller) error {
+	v, err := parseValidateRequests(c)
+	if err != nil {
+		return err
+	}
+	httpserver.GetConfig(c).RequestValidation = v
+	return nil
+}
+
+// parseValidateRequests parses
+//
+//	validate_requests {
+//		host
+//		framing
+//		obs_fold
+//		chunk_ext [max]
+//	}
+//
+// which enables the checks listed, or all of them if there's no block.
+// As they are made by the listener, they apply to all the sites that
+// share it; on listeners that serve TLS, only host is checked.
+func parseValidateRequests(c *caddy.Controller) (*httpserver.RequestValidation, error) {
+	var v *httpserver.RequestValidation
+
+	for c.Next() {
+		if v != nil {
+			return nil, c.Err("validate_requests may only be given once per site")
+		}
+		if len(c.RemainingArgs()) != 0 {
+			return nil, c.ArgErr()
+		}
+		v = new(httpserver.RequestValidation)
+
+		var hasBlock bool
+		for c.NextBlock() {
+			hasBlock = true
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "host":
+				v.Host = true
+			case "framing":
+				v.Framing = true
+			case "obs_fold":
+				v.ObsFold = true
+			case "chunk_ext":
+				v.MaxChunkExt = defaultMaxChunkExt
+				if len(args) == 1 {
+					n, err := strconv.Atoi(args[0])
+					if err != nil || n <= 0 {
+						return nil, c.Errf("chunk_ext must be a positive number of bytes, not '%s'", args[0])
+					}
+					v.MaxChunkExt = n
+					continue
+				}
+			default:
+				return nil, c.Errf("Unknown validate_requests property '%s'", what)
+			}
+			if len(args) != 0 {
+				return nil, c.ArgErr()
+			}
+		}
+		if !hasBlock {
+			*v = httpserver.RequestValidation{Host: true, Framing: true, ObsFold: true, MaxChunkExt: defaultMaxChunkExt}
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,47 @@
+package validaterequests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetupValidateRequests(t *testing.T) {
+	testCases := []struct {
+		input     string
+		shouldErr bool
+		expected  httpserver.RequestValidation
+	}{
+		{input: "validate_requests", expected: httpserver.RequestValidation{Host: true, Framing: true, ObsFold: true, MaxChunkExt: 128}},
+		{input: "validate_requests {\n host \n}", expected: httpserver.RequestValidation{Host: true}},
+		{input: "validate_requests {\n framing \n obs_fold \n}", expected: httpserver.RequestValidation{Framing: true, ObsFold: true}},
+		{input: "validate_requests {\n chunk_ext \n}", expected: httpserver.RequestValidation{MaxChunkExt: 128}},
+		{input: "validate_requests {\n chunk_ext 16 \n}", expected: httpserver.RequestValidation{MaxChunkExt: 16}},
+		{input: "validate_requests on", shouldErr: true},
+		{input: "validate_requests {\n host yes \n}", shouldErr: true},
+		{input: "validate_requests {\n chunk_ext 0 \n}", shouldErr: true},
+		{input: "validate_requests {\n chunk_ext 1 2 \n}", shouldErr: true},
+		{input: "validate_requests {\n foo \n}", shouldErr: true},
+		{input: "validate_requests\nvalidate_requests", shouldErr: true},
+	}
+	for i, tc := range testCases {
+		c := caddy.NewTestController("http", tc.input)
+		err := setupValidateRequests(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but did not have one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Did not expect error, but got: %v", i, err)
+			continue
+		}
+		got := httpserver.GetConfig(c).RequestValidation
+		if got == nil || !reflect.DeepEqual(*got, tc.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, tc.expected, got)
+		}
+	}
+}
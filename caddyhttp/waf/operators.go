@@ -0,0 +1,266 @@
+package waf
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Operator is what a rule looks for in the variables it inspects,
+// such as @rx or @pm. Go's regular expressions don't support the
+// lookarounds or backreferences of PCRE, so rules that use them
+// fail to load.
+type Operator struct {
+	Name   string // without @
+	Arg    string
+	Negate bool
+
+	rx      *regexp.Regexp
+	phrases []string
+	nets    []*net.IPNet
+	macros  bool // whether Arg has macros to expand
+}
+
+// parseOperator parses an operator such as "@pm foo bar" or "!@eq 0";
+// without an @, the operator is @rx.
+func parseOperator(s string) (*Operator, error) {
+	op := &Operator{Name: "rx", Arg: s}
+	if strings.HasPrefix(s, "!@") {
+		op.Negate, s = true, s[1:]
+	}
+	if strings.HasPrefix(s, "@") {
+		op.Name, op.Arg = s[1:], ""
+		if i := strings.IndexAny(s, " \t"); i >= 0 {
+			op.Name, op.Arg = s[1:i], strings.TrimSpace(s[i+1:])
+		}
+	}
+	op.macros = strings.Contains(op.Arg, "%{")
+
+	switch op.Name {
+	case "rx":
+		rx, err := regexp.Compile(op.Arg)
+		if err != nil {
+			return nil, err
+		}
+		op.rx, op.macros = rx, false
+	case "pm":
+		op.phrases = strings.Fields(strings.ToLower(op.Arg))
+		if len(op.phrases) == 0 {
+			return nil, fmt.Errorf("@pm takes phrases")
+		}
+	case "ipMatch":
+		for _, s := range strings.Split(op.Arg, ",") {
+			s = strings.TrimSpace(s)
+			if !strings.Contains(s, "/") {
+				if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+					s += "/32"
+				} else {
+					s += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, err
+			}
+			op.nets = append(op.nets, network)
+		}
+	case "eq", "ge", "gt", "le", "lt":
+		if !op.macros {
+			if _, err := strconv.Atoi(op.Arg); err != nil {
+				return nil, fmt.Errorf("@%s takes a number, not %q", op.Name, op.Arg)
+			}
+		}
+	case "contains", "streq", "beginsWith", "endsWith", "within",
+		"unconditionalMatch", "noMatch":
+	default:
+		return nil, fmt.Errorf("unsupported operator @%s", op.Name)
+	}
+	return op, nil
+}
+
+// match returns whether value matches o, with the macros of its
+// argument expanded by t.
+func (o *Operator) match(t *transaction, value string) bool {
+	return o.matches(t, value) != o.Negate
+}
+
+func (o *Operator) matches(t *transaction, value string) bool {
+	arg := o.Arg
+	if o.macros {
+		arg = t.expand(arg)
+	}
+	switch o.Name {
+	case "rx":
+		return o.rx.MatchString(value)
+	case "pm":
+		value = strings.ToLower(value)
+		for _, phrase := range o.phrases {
+			if strings.Contains(value, phrase) {
+				return true
+			}
+		}
+		return false
+	case "ipMatch":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return false
+		}
+		for _, network := range o.nets {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	case "eq", "ge", "gt", "le", "lt":
+		a, _ := strconv.Atoi(strings.TrimSpace(value))
+		b, _ := strconv.Atoi(arg)
+		switch o.Name {
+		case "eq":
+			return a == b
+		case "ge":
+			return a >= b
+		case "gt":
+			return a > b
+		case "le":
+			return a <= b
+		}
+		return a < b
+	case "contains":
+		return strings.Contains(value, arg)
+	case "streq":
+		return value == arg
+	case "beginsWith":
+		return strings.HasPrefix(value, arg)
+	case "endsWith":
+		return strings.HasSuffix(value, arg)
+	case "within":
+		return strings.Contains(arg, value)
+	case "unconditionalMatch":
+		return true
+	}
+	return false // noMatch
+}
+
+// transform is a transformation of a variable before it's inspected.
+type transform func(string) string
+
+// transforms are the transformations that the t action may name.
+var transforms = map[string]transform{
+	"lowercase":          strings.ToLower,
+	"uppercase":          strings.ToUpper,
+	"urlDecode":          func(s string) string { return urlDecode(s, false) },
+	"urlDecodeUni":       func(s string) string { return urlDecode(s, true) },
+	"htmlEntityDecode":   html.UnescapeString,
+	"compressWhitespace": compressWhitespace,
+	"removeWhitespace":   func(s string) string { return strings.Map(dropSpace, s) },
+	"removeNulls":        func(s string) string { return strings.Replace(s, "\x00", "", -1) },
+	"replaceNulls":       func(s string) string { return strings.Replace(s, "\x00", " ", -1) },
+	"trim":               strings.TrimSpace,
+	"trimLeft":           func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) },
+	"trimRight":          func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) },
+	"normalizePath":      normalizePath,
+	"normalisePath":      normalizePath,
+	"normalizePathWin":   func(s string) string { return normalizePath(strings.Replace(s, "\\", "/", -1)) },
+	"normalisePathWin":   func(s string) string { return normalizePath(strings.Replace(s, "\\", "/", -1)) },
+	"base64Decode":       base64Decode,
+	"hexDecode":          hexDecode,
+	"length":             func(s string) string { return strconv.Itoa(len(s)) },
+}
+
+// urlDecode decodes %XX escapes and +, leniently: invalid escapes are
+// left as they are. With uni, %uXXXX escapes are decoded too.
+func urlDecode(s string, uni bool) string {
+	if !strings.ContainsAny(s, "%+") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '+':
+			b.WriteByte(' ')
+		case s[i] == '%' && uni && i+5 < len(s) && (s[i+1] == 'u' || s[i+1] == 'U'):
+			if n, err := strconv.ParseUint(s[i+2:i+6], 16, 16); err == nil {
+				b.WriteRune(rune(n))
+				i += 5
+			} else {
+				b.WriteByte('%')
+			}
+		case s[i] == '%' && i+2 < len(s):
+			if n, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 2
+			} else {
+				b.WriteByte('%')
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// compressWhitespace replaces each run of whitespace with a space.
+func compressWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func dropSpace(r rune) rune {
+	if unicode.IsSpace(r) {
+		return -1
+	}
+	return r
+}
+
+// normalizePath removes the . and .. segments and repeated slashes
+// of a path, keeping a trailing slash.
+func normalizePath(s string) string {
+	if s == "" {
+		return s
+	}
+	clean := path.Clean(s)
+	if strings.HasSuffix(s, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// base64Decode decodes as much of s as is valid base64.
+func base64Decode(s string) string {
+	s = strings.TrimRight(s, "=")
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		if e, ok := err.(base64.CorruptInputError); ok {
+			b, _ = base64.RawStdEncoding.DecodeString(s[:int(e)/4*4])
+		}
+	}
+	return string(b)
+}
+
+// hexDecode decodes s, or returns it as it is if it isn't hex.
+func hexDecode(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return string(b)
+}
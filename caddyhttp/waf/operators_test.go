@@ -0,0 +1,71 @@
+package waf
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOperators(t *testing.T) {
+	tx := newTransaction(httptest.NewRequest("GET", "/", nil))
+	tx.tx["limit"] = "3"
+	for i, test := range []struct {
+		operator string
+		value    string
+		expect   bool
+	}{
+		{`(?i)union\s+select`, "1 UNION  SELECT", true},
+		{`@rx ^\d+$`, "12a", false},
+		{`!@rx ^\d+$`, "12a", true},
+		{"@pm nikto sqlmap", "Mozilla sqlmap/1.0", true},
+		{"@pm nikto sqlmap", "Mozilla", false},
+		{"@contains ../", "/a/../b", true},
+		{"@streq GET", "GET", true},
+		{"@beginsWith /admin", "/admin/x", true},
+		{"@endsWith .php", "/x.php", true},
+		{"@within GET HEAD POST", "HEAD", true},
+		{"@within GET HEAD POST", "DELETE", false},
+		{"@eq 0", "0", true},
+		{"@ge %{tx.limit}", "3", true},
+		{"@gt %{tx.limit}", "3", false},
+		{"@lt 10", "9", true},
+		{"@ipMatch 10.0.0.0/8,192.0.2.1", "10.1.2.3", true},
+		{"@ipMatch 10.0.0.0/8,192.0.2.1", "192.0.2.2", false},
+		{"@unconditionalMatch", "", true},
+		{"@noMatch", "x", false},
+	} {
+		op, err := parseOperator(test.operator)
+		if err != nil {
+			t.Errorf("Test %d: Did not expect error, got: %v", i, err)
+			continue
+		}
+		if got := op.match(tx, test.value); got != test.expect {
+			t.Errorf("Test %d: Expected %s to match %q: %v, got %v", i, test.operator, test.value, test.expect, got)
+		}
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	for i, test := range []struct {
+		transform string
+		value     string
+		expect    string
+	}{
+		{"lowercase", "SeLeCt", "select"},
+		{"urlDecode", "a%20b+c%2", "a b c%2"},
+		{"urlDecodeUni", "%u0041%zz", "A%zz"},
+		{"htmlEntityDecode", "&lt;script&gt;", "<script>"},
+		{"compressWhitespace", "a \t\n b", "a b"},
+		{"removeWhitespace", "a \t b", "ab"},
+		{"removeNulls", "a\x00b", "ab"},
+		{"trim", "  a  ", "a"},
+		{"normalizePath", "/a/./b/../c//d/", "/a/c/d/"},
+		{"normalizePathWin", `\a\..\b`, "/b"},
+		{"base64Decode", "aGVsbG8=", "hello"},
+		{"hexDecode", "68656c6c6f", "hello"},
+		{"length", "hello", "5"},
+	} {
+		if got := transforms[test.transform](test.value); got != test.expect {
+			t.Errorf("Test %d: Expected %s of %q to be %q, got %q", i, test.transform, test.value, test.expect, got)
+		}
+	}
+}
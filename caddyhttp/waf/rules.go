@@ -0,0 +1,446 @@
+package waf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule is a SecRule, SecAction or SecMarker of a rule file.
+type Rule struct {
+	ID    int
+	Phase int // 1, request headers, or 2, request body
+
+	// Vars are the variables the rule inspects, and Operator what
+	// it looks for in them; a SecAction, which has neither, always
+	// matches.
+	Vars       []Variable
+	Operator   *Operator
+	Transforms []string // applied to the variables, in order
+
+	Action    Action
+	Status    int // of the response when denied, if not 0
+	Msg       string
+	LogData   string
+	Log       bool
+	SetVars   []SetVar
+	SkipAfter string // a marker to skip to after the rule matches
+
+	// Chain is the next rule of a chain, which must match for this
+	// rule to; only the first rule of a chain has an ID, a phase
+	// and actions other than setvar.
+	Chain *Rule
+
+	// Marker is the name of a SecMarker, which is a place to skip
+	// to rather than a rule.
+	Marker string
+
+	File string // where the rule was read from
+	Line int
+
+	transforms []transform
+	secAction  bool
+	chained    bool // continued by the next rule of the file
+	skipTo     int  // the index of SkipAfter in the rule set
+}
+
+// Action is what a rule does to a request when it matches.
+type Action int
+
+// Actions a rule may take.
+const (
+	// ActionPass carries on with the next rule.
+	ActionPass Action = iota
+	// ActionDeny stops processing and denies the request.
+	ActionDeny
+	// ActionBlock denies the request too, unless anomaly scoring
+	// is used, when it only adds to the score, as with ActionPass.
+	ActionBlock
+	// ActionAllow stops processing and lets the request through.
+	ActionAllow
+)
+
+// Variable is a variable, or a collection of them, that a rule
+// inspects, such as ARGS or REQUEST_HEADERS:User-Agent.
+type Variable struct {
+	Collection string // such as ARGS, in upper case
+	Key        string // selects the members named so, if not ""
+	KeyRx      *regexp.Regexp
+	Count      bool // &: the number of members, rather than them
+	Exclude    bool // !: the members aren't to be inspected
+}
+
+// SetVar is a setvar action, which sets, adds to, subtracts from or
+// deletes a transaction variable, such as tx.anomaly_score.
+type SetVar struct {
+	Name   string // without tx.
+	Value  string // may have macros, such as %{tx.critical_anomaly_score}
+	Op     byte   // '=', '+', '-' or '!' to delete
+	Action string // as it was written
+}
+
+// ParseRuleFiles parses the rule files that match patterns, in order.
+func ParseRuleFiles(patterns []string) ([]*Rule, error) {
+	var rules []*Rule
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no rule files match %s", pattern)
+		}
+		for _, file := range files {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			fileRules, err := ParseRules(f, file)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, fileRules...)
+		}
+	}
+	return rules, nil
+}
+
+// ParseRules parses the rules read from r, a rule file named name.
+// Rules of the response phases, 3 to 5, are left out, since only
+// requests are inspected.
+func ParseRules(r io.Reader, name string) ([]*Rule, error) {
+	var rules []*Rule
+	var chain *Rule // the last rule of an unfinished chain
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum, startLine := 0, 0
+	var text string
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			startLine = lineNum
+			if line == "" || line[0] == '#' {
+				continue
+			}
+		}
+		if strings.HasSuffix(line, "\\") {
+			text += line[:len(line)-1] + " "
+			continue
+		}
+		text += line
+
+		phase := 0
+		if chain != nil {
+			phase = chain.Phase
+		}
+		rule, err := parseDirective(text, phase)
+		text = ""
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, startLine, err)
+		}
+		if rule == nil {
+			continue
+		}
+		rule.File, rule.Line = name, startLine
+		if chain != nil {
+			if rule.Marker != "" || rule.secAction {
+				return nil, fmt.Errorf("%s:%d: a chain must be continued by a SecRule", name, startLine)
+			}
+			if rule.ID != 0 || rule.Action != ActionPass || rule.Msg != "" {
+				return nil, fmt.Errorf("%s:%d: only the first rule of a chain may have an id, disruptive action or msg", name, startLine)
+			}
+			chain.Chain = rule
+		} else if rule.Phase <= 2 {
+			rules = append(rules, rule)
+		}
+		if rule.chained {
+			chain = rule
+		} else {
+			chain = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if chain != nil {
+		return nil, fmt.Errorf("%s: the chain of the last rule is unfinished", name)
+	}
+
+	return rules, nil
+}
+
+// parseDirective parses a line of a rule file, which may be a SecRule,
+// SecAction or SecMarker; it returns nil for other directives that
+// don't affect the rules, such as SecComponentSignature. A rule that
+// continues a chain takes the phase of the chain, if not 0. Rules of
+// the response phases are only parsed as far as their actions.
+func parseDirective(text string, phase int) (*Rule, error) {
+	args, err := splitArgs(text)
+	if err != nil {
+		return nil, err
+	}
+	switch args[0] {
+	case "SecRule":
+		if len(args) != 3 && len(args) != 4 {
+			return nil, fmt.Errorf("SecRule takes variables, an operator and actions")
+		}
+		rule := &Rule{Phase: 2, Log: true}
+		if len(args) == 4 {
+			if err := rule.parseActions(args[3]); err != nil {
+				return nil, err
+			}
+		}
+		if phase != 0 {
+			rule.Phase = phase
+		}
+		if rule.Phase > 2 {
+			return rule, nil
+		}
+		if rule.Vars, err = parseVariables(args[1]); err != nil {
+			return nil, err
+		}
+		if rule.Operator, err = parseOperator(args[2]); err != nil {
+			return nil, err
+		}
+		return rule, nil
+	case "SecAction":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("SecAction takes actions")
+		}
+		rule := &Rule{Phase: 2, Log: true, secAction: true}
+		if err := rule.parseActions(args[1]); err != nil {
+			return nil, err
+		}
+		return rule, nil
+	case "SecMarker":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("SecMarker takes a name")
+		}
+		return &Rule{Marker: args[1]}, nil
+	case "SecComponentSignature":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported directive %s", args[0])
+}
+
+// splitArgs splits text into its words, or strings within double
+// quotes, in which \" is a quote; other backslashes are kept, for
+// the regular expressions.
+func splitArgs(text string) ([]string, error) {
+	var args []string
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) && text[i+1] == '"' {
+					i++
+				}
+				b.WriteByte(text[i])
+			}
+			if i == len(text) {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			i++
+			args = append(args, b.String())
+		default:
+			j := i
+			for j < len(text) && text[j] != ' ' && text[j] != '\t' {
+				j++
+			}
+			args = append(args, text[i:j])
+			i = j
+		}
+	}
+	return args, nil
+}
+
+// parseVariables parses variables such as ARGS|!ARGS:id|&ARGS, in
+// which a key between slashes is a regular expression.
+func parseVariables(s string) ([]Variable, error) {
+	var vars []Variable
+	for s != "" {
+		var v Variable
+		if s[0] == '!' {
+			v.Exclude, s = true, s[1:]
+		} else if s[0] == '&' {
+			v.Count, s = true, s[1:]
+		}
+		end := strings.IndexAny(s, ":|")
+		if end < 0 {
+			end = len(s)
+		}
+		v.Collection, s = strings.ToUpper(s[:end]), s[end:]
+		if !knownCollections[v.Collection] {
+			return nil, fmt.Errorf("unsupported variable %s", v.Collection)
+		}
+		if strings.HasPrefix(s, ":") {
+			s = s[1:]
+			if strings.HasPrefix(s, "/") {
+				end := strings.Index(s[1:], "/")
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated regular expression in %s key", v.Collection)
+				}
+				rx, err := regexp.Compile("(?i)" + s[1:end+1])
+				if err != nil {
+					return nil, err
+				}
+				v.KeyRx, s = rx, s[end+2:]
+			} else {
+				end := strings.IndexByte(s, '|')
+				if end < 0 {
+					end = len(s)
+				}
+				v.Key, s = s[:end], s[end:]
+			}
+		}
+		if v.Exclude && v.Key == "" && v.KeyRx == nil {
+			return nil, fmt.Errorf("only members of %s can be excluded", v.Collection)
+		}
+		vars = append(vars, v)
+		if s != "" {
+			if s[0] != '|' {
+				return nil, fmt.Errorf("expected | after %s", v.Collection)
+			}
+			s = s[1:]
+		}
+	}
+	if len(vars) == 0 {
+		return nil, fmt.Errorf("no variables")
+	}
+	return vars, nil
+}
+
+// parseActions parses the comma-separated actions of r, of which
+// values may be within single quotes.
+func (r *Rule) parseActions(s string) error {
+	for _, action := range splitActions(s) {
+		name, value := action, ""
+		if i := strings.IndexByte(action, ':'); i >= 0 {
+			name, value = strings.TrimSpace(action[:i]), strings.TrimSpace(action[i+1:])
+			if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = value[1 : len(value)-1]
+			}
+		}
+		var err error
+		switch name {
+		case "id":
+			r.ID, err = strconv.Atoi(value)
+		case "phase":
+			switch value {
+			case "request":
+				r.Phase = 2
+			case "response":
+				r.Phase = 4
+			case "logging":
+				r.Phase = 5
+			default:
+				r.Phase, err = strconv.Atoi(value)
+				if err == nil && (r.Phase < 1 || r.Phase > 5) {
+					err = fmt.Errorf("no phase %d", r.Phase)
+				}
+			}
+		case "deny", "drop":
+			r.Action = ActionDeny
+		case "block":
+			r.Action = ActionBlock
+		case "pass":
+			r.Action = ActionPass
+		case "allow":
+			r.Action = ActionAllow
+		case "status":
+			r.Status, err = strconv.Atoi(value)
+		case "msg":
+			r.Msg = value
+		case "logdata":
+			r.LogData = value
+		case "log":
+			r.Log = true
+		case "nolog":
+			r.Log = false
+		case "t":
+			if value == "none" {
+				r.Transforms, r.transforms = nil, nil
+				break
+			}
+			t, ok := transforms[value]
+			if !ok {
+				return fmt.Errorf("unsupported transformation %s", value)
+			}
+			r.Transforms = append(r.Transforms, value)
+			r.transforms = append(r.transforms, t)
+		case "setvar":
+			var sv SetVar
+			sv, err = parseSetVar(value)
+			r.SetVars = append(r.SetVars, sv)
+		case "skipAfter":
+			r.SkipAfter = value
+		case "chain":
+			r.chained = true
+		case "severity", "tag", "rev", "ver", "maturity", "accuracy", "auditlog", "noauditlog", "capture", "multiMatch":
+			// metadata, or of no effect here
+		default:
+			return fmt.Errorf("unsupported action %s", name)
+		}
+		if err != nil {
+			return fmt.Errorf("action %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// splitActions splits s at the commas outside single quotes.
+func splitActions(s string) []string {
+	var actions []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				actions = append(actions, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		actions = append(actions, last)
+	}
+	return actions
+}
+
+// parseSetVar parses the value of a setvar action, such as
+// tx.anomaly_score=+5 or !tx.flag.
+func parseSetVar(s string) (SetVar, error) {
+	sv := SetVar{Op: '=', Value: "1", Action: s}
+	if strings.HasPrefix(s, "!") {
+		sv.Op, s = '!', s[1:]
+	}
+	name := s
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		name, sv.Value = s[:i], s[i+1:]
+		if strings.HasPrefix(sv.Value, "+") || strings.HasPrefix(sv.Value, "-") {
+			sv.Op, sv.Value = sv.Value[0], sv.Value[1:]
+		}
+	}
+	name = strings.ToLower(name)
+	if !strings.HasPrefix(name, "tx.") || len(name) == len("tx.") {
+		return sv, fmt.Errorf("only tx variables can be set, not %s", name)
+	}
+	sv.Name = name[len("tx."):]
+	return sv, nil
+}
@@ -0,0 +1,97 @@
+package waf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# a comment
+SecComponentSignature "test"
+
+SecAction "id:900000,phase:1,nolog,pass,setvar:tx.critical_anomaly_score=5"
+
+SecRule REQUEST_HEADERS:User-Agent|!REQUEST_HEADERS:Referer "@pm nikto sqlmap" \
+    "id:913100,phase:1,block,t:none,t:lowercase,msg:'Scanner: %{MATCHED_VAR}',\
+    setvar:'tx.anomaly_score=+%{tx.critical_anomaly_score}'"
+
+SecRule &REQUEST_HEADERS:Host "@eq 0" "id:920280,phase:1,deny,status:400,chain"
+    SecRule REQUEST_METHOD "!@streq OPTIONS" "setvar:tx.x=1"
+
+SecRule ARGS:/^id$/ "\"quoted\" \d+" "id:2,skipAfter:END"
+SecMarker END
+SecRule RESPONSE_STATUS_LINE "@rx (?!x)" "id:3,phase:3,chain"
+    SecRule RESPONSE_BODY "x"
+`), "test.conf")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("Expected 5 rules, got %d", len(rules))
+	}
+
+	action := rules[0]
+	if action.ID != 900000 || action.Phase != 1 || action.Log || action.Operator != nil ||
+		len(action.SetVars) != 1 || action.SetVars[0] != (SetVar{Name: "critical_anomaly_score", Value: "5", Op: '=', Action: "tx.critical_anomaly_score=5"}) {
+		t.Errorf("Unexpected SecAction: %+v", action)
+	}
+
+	scanner := rules[1]
+	if scanner.ID != 913100 || scanner.Action != ActionBlock || scanner.Line != 7 {
+		t.Errorf("Unexpected rule: %+v", scanner)
+	}
+	if len(scanner.Vars) != 2 || scanner.Vars[0].Key != "User-Agent" || !scanner.Vars[1].Exclude {
+		t.Errorf("Unexpected variables: %+v", scanner.Vars)
+	}
+	if scanner.Operator.Name != "pm" || len(scanner.Operator.phrases) != 2 {
+		t.Errorf("Unexpected operator: %+v", scanner.Operator)
+	}
+	if len(scanner.Transforms) != 1 || scanner.Transforms[0] != "lowercase" {
+		t.Errorf("Expected t:none to reset the transformations, got %v", scanner.Transforms)
+	}
+	if scanner.Msg != "Scanner: %{MATCHED_VAR}" || scanner.SetVars[0].Op != '+' {
+		t.Errorf("Unexpected msg or setvar: %q %+v", scanner.Msg, scanner.SetVars)
+	}
+
+	host := rules[2]
+	if !host.Vars[0].Count || host.Status != 400 || host.Chain == nil ||
+		!host.Chain.Operator.Negate || host.Chain.Phase != 1 {
+		t.Errorf("Unexpected chain: %+v then %+v", host, host.Chain)
+	}
+
+	args := rules[3]
+	if args.Vars[0].KeyRx == nil || args.Operator.Arg != `"quoted" \d+` || args.SkipAfter != "END" {
+		t.Errorf("Unexpected rule: %+v %+v", args, args.Operator)
+	}
+	if rules[4].Marker != "END" {
+		t.Errorf("Expected a marker, got %+v", rules[4])
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	for i, test := range []struct {
+		rules  string
+		expect string
+	}{
+		{"SecRuleEngine On", "test.conf:1: unsupported directive SecRuleEngine"},
+		{"\nSecRule ARGS", "test.conf:2: SecRule takes"},
+		{`SecRule FOO "@rx x" "id:1"`, "unsupported variable FOO"},
+		{`SecRule !ARGS "@rx x" "id:1"`, "only members of ARGS can be excluded"},
+		{`SecRule ARGS "@detectSQLi" "id:1"`, "unsupported operator @detectSQLi"},
+		{`SecRule ARGS "(?=x)" "id:1"`, "invalid or unsupported Perl syntax"},
+		{`SecRule ARGS "@eq x" "id:1"`, "@eq takes a number"},
+		{`SecRule ARGS "x" "id:1,t:jsDecode"`, "unsupported transformation jsDecode"},
+		{`SecRule ARGS "x" "id:1,ctl:ruleEngine=Off"`, "unsupported action ctl"},
+		{`SecRule ARGS "x" "id:1,setvar:ip.x=1"`, "only tx variables can be set"},
+		{`SecRule ARGS "x" "id:1,phase:9"`, "no phase 9"},
+		{`SecRule ARGS "x`, "unterminated quoted string"},
+		{`SecRule ARGS "x" "id:1,chain"`, "unfinished"},
+		{"SecRule ARGS \"x\" \"id:1,chain\"\nSecRule ARGS \"y\" \"id:2\"", "only the first rule of a chain"},
+	} {
+		_, err := ParseRules(strings.NewReader(test.rules), "test.conf")
+		if err == nil || !strings.Contains(err.Error(), test.expect) {
+			t.Errorf("Test %d: Expected an error containing %q, got: %v", i, test.expect, err)
+		}
+	}
+}
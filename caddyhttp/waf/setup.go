@@ -0,0 +1,180 @@
+package waf
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("waf", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultBodyLimit is how much of request bodies is inspected by
+// default.
+const defaultBodyLimit = 128 * 1024
+
+// setup configures a new WAF middleware instance.
+func setup(c *caddy.Controller) error {
+	cfg := httpserver.GetConfig(c)
+	handler, err := wafParse(c)
+	if err != nil {
+		return err
+	}
+	handler.Site = cfg.Addr.String()
+
+	cfg.AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		handler.Next = next
+		return handler
+	})
+
+	return nil
+}
+
+// wafParse parses
+//
+//	waf {
+//		rules             files...
+//		exclude           ids...
+//		body_limit        size
+//		anomaly_threshold score
+//		detect_only
+//		status            code
+//		tarpit            delay [trickle]
+//	}
+//
+// where the rule files, which may be glob patterns, are loaded in
+// order, and the IDs, which may be ranges such as 920000-920999, are
+// those of rules left out of them. With tarpit, blocked requests are
+// held for the delay before they are responded to, or with trickle,
+// while the response is written a byte at a time.
+func wafParse(c *caddy.Controller) (WAF, error) {
+	handler := WAF{BodyLimit: defaultBodyLimit, Status: http.StatusForbidden}
+	var files []string
+	var excluded [][2]int
+	parsed := false
+
+	for c.Next() {
+		if parsed {
+			return handler, c.Err("waf may only be given once per site")
+		}
+		parsed = true
+		if len(c.RemainingArgs()) != 0 {
+			return handler, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "rules":
+				if len(args) == 0 {
+					return handler, c.ArgErr()
+				}
+				files = append(files, args...)
+			case "exclude":
+				if len(args) == 0 {
+					return handler, c.ArgErr()
+				}
+				for _, arg := range args {
+					ids, err := parseIDRange(arg)
+					if err != nil {
+						return handler, c.Errf("invalid rule ID '%s'", arg)
+					}
+					excluded = append(excluded, ids)
+				}
+			case "body_limit":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(args[0])
+				if err != nil || size > math.MaxInt64 {
+					return handler, c.Errf("invalid body_limit '%s'", args[0])
+				}
+				handler.BodyLimit = int64(size)
+			case "anomaly_threshold":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return handler, c.Errf("anomaly_threshold must be a positive score, not '%s'", args[0])
+				}
+				handler.AnomalyThreshold = n
+			case "detect_only":
+				if len(args) != 0 {
+					return handler, c.ArgErr()
+				}
+				handler.DetectOnly = true
+			case "status":
+				if len(args) != 1 {
+					return handler, c.ArgErr()
+				}
+				code, err := strconv.Atoi(args[0])
+				if err != nil || code < 400 || code > 599 {
+					return handler, c.Errf("status must be an error status code, not '%s'", args[0])
+				}
+				handler.Status = code
+			case "tarpit":
+				if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "trickle") {
+					return handler, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return handler, c.Errf("invalid tarpit delay '%s'", args[0])
+				}
+				handler.Tarpit = httpserver.Tarpit{Delay: d, Trickle: len(args) == 2}
+			default:
+				return handler, c.Errf("Unknown waf property '%s'", what)
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return handler, c.Err("waf needs rules")
+	}
+	rules, err := ParseRuleFiles(files)
+	if err != nil {
+		return handler, c.Err(err.Error())
+	}
+	handler.Rules, err = NewRuleSet(rules, func(id int) bool {
+		for _, ids := range excluded {
+			if ids[0] <= id && id <= ids[1] {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return handler, c.Err(err.Error())
+	}
+
+	return handler, nil
+}
+
+// parseIDRange parses a rule ID, or a range of them such as
+// 920000-920999, into the first and last IDs.
+func parseIDRange(s string) ([2]int, error) {
+	first, last := s, s
+	if i := strings.IndexByte(s, '-'); i > 0 {
+		first, last = s[:i], s[i+1:]
+	}
+	a, err := strconv.Atoi(first)
+	if err != nil {
+		return [2]int{}, err
+	}
+	b, err := strconv.Atoi(last)
+	if err != nil {
+		return [2]int{}, err
+	}
+	return [2]int{a, b}, nil
+}
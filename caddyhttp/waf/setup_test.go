@@ -0,0 +1,114 @@
+package waf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "waf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rules := filepath.Join(dir, "rules.conf")
+	if err := ioutil.WriteFile(rules, []byte(testRules), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("http", "waf {\n rules "+rules+"\n}")
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(WAF)
+	if !ok {
+		t.Fatalf("Expected handler to be type WAF, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestWAFParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "waf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"a.conf":   `SecRule ARGS "x" "id:1,deny"`,
+		"b.conf":   `SecRule ARGS "y" "id:920100,deny"`,
+		"bad.conf": `SecRule ARGS "(?<=x)" "id:3,deny"`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, bad := filepath.Join(dir, "a.conf"), filepath.Join(dir, "b.conf"), filepath.Join(dir, "bad.conf")
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		rules     int
+		expect    WAF
+	}{
+		{input: "waf {\n rules " + a + " " + b + "\n}", rules: 2,
+			expect: WAF{BodyLimit: defaultBodyLimit, Status: http.StatusForbidden}},
+		{input: "waf {\n rules " + filepath.Join(dir, "[ab].conf") + "\n exclude 920000-920999\n}", rules: 1,
+			expect: WAF{BodyLimit: defaultBodyLimit, Status: http.StatusForbidden}},
+		{input: "waf {\n rules " + a + "\n body_limit 1MiB\n anomaly_threshold 5\n detect_only\n status 406\n}", rules: 1,
+			expect: WAF{BodyLimit: 1024 * 1024, AnomalyThreshold: 5, DetectOnly: true, Status: http.StatusNotAcceptable}},
+		{input: "waf {\n rules " + a + "\n tarpit 10s\n}", rules: 1,
+			expect: WAF{BodyLimit: defaultBodyLimit, Status: http.StatusForbidden, Tarpit: httpserver.Tarpit{Delay: 10 * time.Second}}},
+		{input: "waf {\n rules " + a + "\n tarpit 1m trickle\n}", rules: 1,
+			expect: WAF{BodyLimit: defaultBodyLimit, Status: http.StatusForbidden, Tarpit: httpserver.Tarpit{Delay: time.Minute, Trickle: true}}},
+		{input: "waf {\n rules " + a + "\n body_limit 2GB\n}", rules: 1,
+			expect: WAF{BodyLimit: 2000 * 1000 * 1000, Status: http.StatusForbidden}},
+		{input: "waf {\n rules " + a + "\n body_limit 64KiB\n}", rules: 1,
+			expect: WAF{BodyLimit: 64 * 1024, Status: http.StatusForbidden}},
+		{input: "waf", shouldErr: true},
+		{input: "waf " + a, shouldErr: true},
+		{input: "waf {\n rules\n}", shouldErr: true},
+		{input: "waf {\n rules " + filepath.Join(dir, "none*.conf") + "\n}", shouldErr: true},
+		{input: "waf {\n rules " + bad + "\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n exclude x\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n body_limit lots\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n anomaly_threshold 0\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n status 200\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n tarpit\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n tarpit never\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n tarpit 10s slowly\n}", shouldErr: true},
+		{input: "waf {\n rules " + a + "\n foo\n}", shouldErr: true},
+	} {
+		actual, err := wafParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but did not have one", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Did not expect error, but got: %v", i, err)
+			continue
+		}
+		if got := len(actual.Rules.rules); got != test.rules {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, test.rules, got)
+		}
+		actual.Rules = nil
+		if actual != test.expect {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expect, actual)
+		}
+	}
+}
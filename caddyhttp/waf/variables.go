@@ -0,0 +1,237 @@
+package waf
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// knownCollections are the variables that rules may inspect.
+var knownCollections = map[string]bool{
+	"ARGS":                  true,
+	"ARGS_NAMES":            true,
+	"ARGS_GET":              true,
+	"ARGS_GET_NAMES":        true,
+	"ARGS_POST":             true,
+	"ARGS_POST_NAMES":       true,
+	"QUERY_STRING":          true,
+	"REMOTE_ADDR":           true,
+	"REQUEST_BASENAME":      true,
+	"REQUEST_BODY":          true,
+	"REQUEST_BODY_LENGTH":   true,
+	"REQUEST_COOKIES":       true,
+	"REQUEST_COOKIES_NAMES": true,
+	"REQUEST_FILENAME":      true,
+	"REQUEST_HEADERS":       true,
+	"REQUEST_HEADERS_NAMES": true,
+	"REQUEST_LINE":          true,
+	"REQUEST_METHOD":        true,
+	"REQUEST_PROTOCOL":      true,
+	"REQUEST_URI":           true,
+	"TX":                    true,
+}
+
+// bodyCollections are the variables that need the body of a request.
+var bodyCollections = map[string]bool{
+	"ARGS":                true,
+	"ARGS_NAMES":          true,
+	"ARGS_POST":           true,
+	"ARGS_POST_NAMES":     true,
+	"REQUEST_BODY":        true,
+	"REQUEST_BODY_LENGTH": true,
+}
+
+// member is a member of a collection, or a variable, by name.
+type member struct {
+	name, value string
+}
+
+// transaction is the state of the rules inspecting a request.
+type transaction struct {
+	r    *http.Request
+	body []byte // as much as was buffered, in phase 2
+	form url.Values
+
+	tx          map[string]string // the tx collection
+	rule        *Rule             // being evaluated, for %{rule.*}
+	matchedVar  string
+	matchedName string
+}
+
+func newTransaction(r *http.Request) *transaction {
+	return &transaction{r: r, tx: make(map[string]string)}
+}
+
+// setBody sets the body of the request, as buffered, parsing it if
+// it's a form.
+func (t *transaction) setBody(body []byte) {
+	t.body = body
+	ct := t.r.Header.Get("Content-Type")
+	if strings.HasPrefix(strings.ToLower(ct), "application/x-www-form-urlencoded") {
+		t.form, _ = url.ParseQuery(string(body))
+	}
+}
+
+// collect returns the members of the collection of v that v selects,
+// or the number of them if it counts them.
+func (t *transaction) collect(v Variable) []member {
+	members := t.collection(v.Collection)
+	if v.Key != "" || v.KeyRx != nil {
+		var selected []member
+		for _, m := range members {
+			if v.selects(m.name) {
+				selected = append(selected, m)
+			}
+		}
+		members = selected
+	}
+	if v.Count {
+		return []member{{v.Collection, strconv.Itoa(len(members))}}
+	}
+	return members
+}
+
+// selects returns whether v selects the member named name.
+func (v Variable) selects(name string) bool {
+	if v.KeyRx != nil {
+		return v.KeyRx.MatchString(name)
+	}
+	return strings.EqualFold(v.Key, name)
+}
+
+// collection returns all the members of the collection called name.
+func (t *transaction) collection(name string) []member {
+	r := t.r
+	switch name {
+	case "ARGS":
+		return append(t.collection("ARGS_GET"), t.collection("ARGS_POST")...)
+	case "ARGS_NAMES":
+		return append(t.collection("ARGS_GET_NAMES"), t.collection("ARGS_POST_NAMES")...)
+	case "ARGS_GET":
+		return valueMembers(r.URL.Query())
+	case "ARGS_GET_NAMES":
+		return nameMembers(valueMembers(r.URL.Query()))
+	case "ARGS_POST":
+		return valueMembers(t.form)
+	case "ARGS_POST_NAMES":
+		return nameMembers(valueMembers(t.form))
+	case "QUERY_STRING":
+		return []member{{name, r.URL.RawQuery}}
+	case "REMOTE_ADDR":
+		return []member{{name, httpserver.ClientIP(r)}}
+	case "REQUEST_BASENAME":
+		return []member{{name, path.Base(r.URL.Path)}}
+	case "REQUEST_BODY":
+		if t.body == nil {
+			return nil
+		}
+		return []member{{name, string(t.body)}}
+	case "REQUEST_BODY_LENGTH":
+		return []member{{name, strconv.Itoa(len(t.body))}}
+	case "REQUEST_COOKIES":
+		var members []member
+		for _, c := range r.Cookies() {
+			members = append(members, member{c.Name, c.Value})
+		}
+		return members
+	case "REQUEST_COOKIES_NAMES":
+		return nameMembers(t.collection("REQUEST_COOKIES"))
+	case "REQUEST_FILENAME":
+		return []member{{name, r.URL.Path}}
+	case "REQUEST_HEADERS":
+		header := make(http.Header, len(r.Header)+1)
+		for k, v := range r.Header {
+			header[k] = v
+		}
+		if r.Host != "" {
+			header.Set("Host", r.Host) // which Go takes out of the headers
+		}
+		return valueMembers(url.Values(header))
+	case "REQUEST_HEADERS_NAMES":
+		return nameMembers(t.collection("REQUEST_HEADERS"))
+	case "REQUEST_LINE":
+		return []member{{name, r.Method + " " + r.RequestURI + " " + r.Proto}}
+	case "REQUEST_METHOD":
+		return []member{{name, r.Method}}
+	case "REQUEST_PROTOCOL":
+		return []member{{name, r.Proto}}
+	case "REQUEST_URI":
+		return []member{{name, r.RequestURI}}
+	case "TX":
+		var members []member
+		for k, v := range t.tx {
+			members = append(members, member{k, v})
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i].name < members[j].name })
+		return members
+	}
+	return nil
+}
+
+// valueMembers returns the values of values as members, in order of
+// their names.
+func valueMembers(values url.Values) []member {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var members []member
+	for _, name := range names {
+		for _, value := range values[name] {
+			members = append(members, member{name, value})
+		}
+	}
+	return members
+}
+
+// nameMembers returns the distinct names of members, as members.
+func nameMembers(members []member) []member {
+	var names []member
+	for i, m := range members {
+		if i == 0 || m.name != members[i-1].name {
+			names = append(names, member{m.name, m.name})
+		}
+	}
+	return names
+}
+
+// macro matches the macros of action values and operator arguments,
+// such as %{tx.anomaly_score} or %{MATCHED_VAR}.
+var macro = regexp.MustCompile(`%\{([^}]+)\}`)
+
+// expand expands the macros of s.
+func (t *transaction) expand(s string) string {
+	if !strings.Contains(s, "%{") {
+		return s
+	}
+	return macro.ReplaceAllStringFunc(s, func(m string) string {
+		name := m[2 : len(m)-1]
+		switch lower := strings.ToLower(name); {
+		case strings.HasPrefix(lower, "tx."):
+			return t.tx[lower[len("tx."):]]
+		case lower == "matched_var":
+			return t.matchedVar
+		case lower == "matched_var_name":
+			return t.matchedName
+		case lower == "rule.id" && t.rule != nil:
+			return strconv.Itoa(t.rule.ID)
+		case lower == "rule.msg" && t.rule != nil:
+			rule := t.rule
+			t.rule = nil // so that a msg can't expand itself
+			msg := t.expand(rule.Msg)
+			t.rule = rule
+			return msg
+		}
+		if ms := t.collection(strings.ToUpper(name)); len(ms) == 1 {
+			return ms[0].value
+		}
+		return m
+	})
+}
@@ -0,0 +1,293 @@
+// Package waf implements the waf directive, a web application
+// firewall that inspects requests with rules written in a subset of
+// the ModSecurity rule language, so that rule sets such as the OWASP
+// Core Rule Set can be used, in part. It supports the request phases,
+// 1 for headers and 2 for bodies, the common variables, operators and
+// transformations, chains, skipAfter and anomaly scoring with setvar.
+package waf
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+var blockedRequests = metrics.NewCounter("caddy_http_waf_blocked_total",
+	"Number of requests blocked by the web application firewall, by site and rule.",
+	"site", "rule")
+
+// anomalyScore is the tx variable that rules add to for anomaly
+// scoring, as the OWASP Core Rule Set does.
+const anomalyScore = "anomaly_score"
+
+// WAF is middleware that inspects requests with rules, blocking those
+// that they deny.
+type WAF struct {
+	Next httpserver.Handler
+	Site string // for logs and metrics
+
+	Rules *RuleSet
+
+	// BodyLimit is the most of a request body that is buffered to
+	// be inspected; the rest of it goes through uninspected.
+	BodyLimit int64
+
+	// AnomalyThreshold, if not 0, is the anomaly score, which rules
+	// add to with setvar:tx.anomaly_score=+N, at which requests are
+	// blocked once all the rules have been evaluated; rules that
+	// block then only add to the score.
+	AnomalyThreshold int
+
+	// DetectOnly logs the requests that would be blocked, rather
+	// than blocking them.
+	DetectOnly bool
+
+	// Status is that of the response to blocked requests, unless
+	// the rule that blocks them says otherwise.
+	Status int
+
+	// Tarpit, if its Delay isn't 0, holds blocked requests before
+	// they are responded to.
+	Tarpit httpserver.Tarpit
+}
+
+// RuleSet is the rules of a site, in the order they are evaluated.
+type RuleSet struct {
+	rules     []*Rule
+	needsBody bool // whether rules inspect request bodies
+}
+
+// NewRuleSet makes a rule set of rules, without those with the IDs
+// that exclude returns true for.
+func NewRuleSet(rules []*Rule, exclude func(id int) bool) (*RuleSet, error) {
+	rs := new(RuleSet)
+	markers := make(map[string]int)
+	for _, rule := range rules {
+		if rule.Marker == "" && exclude != nil && exclude(rule.ID) {
+			continue
+		}
+		if rule.Marker != "" {
+			markers[rule.Marker] = len(rs.rules)
+		}
+		rs.rules = append(rs.rules, rule)
+		for c := rule; c != nil; c = c.Chain {
+			for _, v := range c.Vars {
+				if c.Phase == 2 && bodyCollections[v.Collection] {
+					rs.needsBody = true
+				}
+			}
+		}
+	}
+	for i, rule := range rs.rules {
+		if rule.SkipAfter == "" {
+			continue
+		}
+		j, ok := markers[rule.SkipAfter]
+		if !ok || j < i {
+			return nil, fmt.Errorf("%s:%d: no SecMarker %s after the rule", rule.File, rule.Line, rule.SkipAfter)
+		}
+		rule.skipTo = j
+	}
+	return rs, nil
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (w WAF) ServeHTTP(rw http.ResponseWriter, r *http.Request) (int, error) {
+	t := newTransaction(r)
+
+	if rule, deny := w.evaluate(t, 1); deny {
+		if status := w.block(t, rule); status != 0 {
+			return w.respond(rw, r, status)
+		}
+	} else if rule != nil {
+		return w.Next.ServeHTTP(rw, r) // allowed
+	}
+
+	if w.Rules.needsBody && r.Body != nil && r.Body != http.NoBody && w.BodyLimit > 0 {
+		b, err := httpserver.BufferBody(r, w.BodyLimit)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		body, err := b.Bytes()
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		t.setBody(body)
+	}
+
+	if rule, deny := w.evaluate(t, 2); deny {
+		if status := w.block(t, rule); status != 0 {
+			return w.respond(rw, r, status)
+		}
+	} else if rule != nil {
+		return w.Next.ServeHTTP(rw, r)
+	}
+
+	if w.AnomalyThreshold > 0 {
+		if score, _ := strconv.Atoi(t.tx[anomalyScore]); score >= w.AnomalyThreshold {
+			t.matchedVar, t.matchedName = "", ""
+			if status := w.block(t, nil); status != 0 {
+				return w.respond(rw, r, status)
+			}
+		}
+	}
+
+	return w.Next.ServeHTTP(rw, r)
+}
+
+// evaluate evaluates the rules of phase in t, and returns the rule
+// that decided the request, if any, and whether it denied it.
+func (w WAF) evaluate(t *transaction, phase int) (*Rule, bool) {
+	rules := w.Rules.rules
+	for i := 0; i < len(rules); i++ {
+		rule := rules[i]
+		if rule.Marker != "" || rule.Phase != phase {
+			continue
+		}
+		t.rule = rule
+		if !t.matchChain(rule) {
+			continue
+		}
+		for c := rule; c != nil; c = c.Chain {
+			t.setVars(c)
+		}
+		switch rule.Action {
+		case ActionDeny:
+			return rule, true
+		case ActionBlock:
+			if w.AnomalyThreshold == 0 {
+				return rule, true
+			}
+		case ActionAllow:
+			return rule, false
+		}
+		if rule.Log {
+			w.logMatch(t, rule, "matched")
+		}
+		if rule.SkipAfter != "" {
+			i = rule.skipTo
+		}
+	}
+	return nil, false
+}
+
+// matchChain returns whether rule, and the rest of its chain, match.
+func (t *transaction) matchChain(rule *Rule) bool {
+	for c := rule; c != nil; c = c.Chain {
+		if !t.match(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns whether rule, one of a chain, matches, noting the
+// variable that it matched.
+func (t *transaction) match(rule *Rule) bool {
+	if rule.Operator == nil {
+		return true // SecAction
+	}
+	for _, v := range rule.Vars {
+		if v.Exclude {
+			continue
+		}
+	members:
+		for _, m := range t.collect(v) {
+			for _, x := range rule.Vars {
+				if x.Exclude && x.Collection == v.Collection && x.selects(m.name) {
+					continue members
+				}
+			}
+			value := m.value
+			for _, tf := range rule.transforms {
+				value = tf(value)
+			}
+			if rule.Operator.match(t, value) {
+				t.matchedVar = value
+				t.matchedName = v.Collection
+				if m.name != v.Collection {
+					t.matchedName += ":" + m.name
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setVars performs the setvar actions of rule.
+func (t *transaction) setVars(rule *Rule) {
+	for _, sv := range rule.SetVars {
+		value := t.expand(sv.Value)
+		switch sv.Op {
+		case '!':
+			delete(t.tx, sv.Name)
+		case '+', '-':
+			a, _ := strconv.Atoi(t.tx[sv.Name])
+			b, _ := strconv.Atoi(value)
+			if sv.Op == '-' {
+				b = -b
+			}
+			t.tx[sv.Name] = strconv.Itoa(a + b)
+		default:
+			t.tx[sv.Name] = value
+		}
+	}
+}
+
+// block blocks the request of t, which rule, or the anomaly score if
+// rule is nil, denies, and returns the status to respond with; or 0
+// if only detecting, when the request is let through.
+func (w WAF) block(t *transaction, rule *Rule) int {
+	if w.DetectOnly {
+		w.logMatch(t, rule, "would have blocked")
+		return 0
+	}
+	id := "anomaly"
+	if rule != nil {
+		id = strconv.Itoa(rule.ID)
+	}
+	blockedRequests.Inc(w.Site, id)
+	w.logMatch(t, rule, "blocked")
+	if rule != nil && rule.Status != 0 {
+		return rule.Status
+	}
+	return w.Status
+}
+
+// respond responds to a blocked request with status, after holding
+// it in the tarpit, if there is one.
+func (w WAF) respond(rw http.ResponseWriter, r *http.Request, status int) (int, error) {
+	if w.Tarpit.Delay > 0 {
+		return w.Tarpit.Respond(rw, r, status)
+	}
+	return status, nil
+}
+
+// logMatch logs that rule, or the anomaly score if rule is nil,
+// matched the request of t, and what it did about it.
+func (w WAF) logMatch(t *transaction, rule *Rule, what string) {
+	r := t.r
+	var b strings.Builder
+	fmt.Fprintf(&b, "[WARNING] waf: %s %s %s %s: ", w.Site, r.RemoteAddr, r.Method, r.RequestURI)
+	if rule == nil {
+		fmt.Fprintf(&b, "anomaly score %s %s", t.tx[anomalyScore], what)
+	} else {
+		fmt.Fprintf(&b, "rule %d %s", rule.ID, what)
+		if t.matchedName != "" {
+			fmt.Fprintf(&b, " %s", t.matchedName)
+		}
+		if rule.Msg != "" {
+			fmt.Fprintf(&b, ": %s", t.expand(rule.Msg))
+		}
+		if rule.LogData != "" {
+			fmt.Fprintf(&b, " [%s]", t.expand(rule.LogData))
+		}
+	}
+	log.Print(b.String())
+}
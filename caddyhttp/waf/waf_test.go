@@ -0,0 +1,170 @@
+package waf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/mholt/caddy/metrics"
+)
+
+const testRules = `
+SecAction "id:900000,phase:1,nolog,pass,setvar:tx.critical_anomaly_score=5,setvar:tx.warning_anomaly_score=3"
+
+SecRule REMOTE_ADDR "@ipMatch 203.0.113.0/24" "id:1000,phase:1,allow,nolog"
+
+SecRule REQUEST_HEADERS:User-Agent "@pm nikto sqlmap" \
+	"id:913100,phase:1,block,t:lowercase,msg:'Scanner %{MATCHED_VAR}',setvar:tx.anomaly_score=+%{tx.critical_anomaly_score}"
+
+SecRule &REQUEST_HEADERS:Host "@eq 0" "id:920280,phase:1,deny,status:400"
+
+SecRule REQUEST_METHOD "@streq DELETE" "id:1001,phase:1,deny,chain"
+	SecRule REQUEST_FILENAME "@beginsWith /admin"
+
+SecRule REQUEST_FILENAME "@beginsWith /static/" "id:1002,phase:2,pass,nolog,skipAfter:END_CHECKS"
+
+SecRule ARGS|!ARGS:comment "@rx (?i)union\s+select" \
+	"id:942100,phase:2,block,t:urlDecodeUni,msg:'SQL injection',setvar:tx.anomaly_score=+%{tx.critical_anomaly_score}"
+
+SecRule ARGS "@contains <script" "id:941100,phase:2,block,t:htmlEntityDecode,t:lowercase,setvar:tx.anomaly_score=+%{tx.warning_anomaly_score}"
+
+SecMarker END_CHECKS
+`
+
+func newTestWAF(t *testing.T, threshold int) (WAF, *[]byte) {
+	rules, err := ParseRules(strings.NewReader(testRules), "test.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := NewRuleSet(rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := new([]byte)
+	return WAF{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			*seen, _ = ioutil.ReadAll(r.Body)
+			return http.StatusOK, nil
+		}),
+		Site:             "test",
+		Rules:            rs,
+		BodyLimit:        1024,
+		AnomalyThreshold: threshold,
+		Status:           http.StatusForbidden,
+	}, seen
+}
+
+func TestWAF(t *testing.T) {
+	for i, test := range []struct {
+		method, target, body string
+		header               map[string]string
+		remote               string
+		threshold            int
+		expect               int
+	}{
+		{method: "GET", target: "/?q=hello", expect: http.StatusOK},
+		{method: "GET", target: "/", header: map[string]string{"User-Agent": "SQLMap/1.0"}, expect: http.StatusForbidden},
+		{method: "GET", target: "/", header: map[string]string{"User-Agent": "SQLMap/1.0"}, threshold: 5, expect: http.StatusForbidden},
+		{method: "GET", target: "/", header: map[string]string{"User-Agent": "SQLMap/1.0"}, threshold: 6, expect: http.StatusOK},
+		{method: "GET", target: "/", header: map[string]string{"User-Agent": "SQLMap/1.0"}, remote: "203.0.113.7:1234", expect: http.StatusOK},
+		{method: "GET", target: "/", header: map[string]string{"Host": ""}, expect: http.StatusBadRequest},
+		{method: "DELETE", target: "/admin/users", expect: http.StatusForbidden},
+		{method: "DELETE", target: "/users", expect: http.StatusOK},
+		{method: "GET", target: "/?id=1%20UNION%20SELECT%20pw", expect: http.StatusForbidden},
+		{method: "GET", target: "/?comment=1%20UNION%20SELECT%20pw", expect: http.StatusOK},
+		{method: "GET", target: "/static/?id=1%20UNION%20SELECT%20pw", expect: http.StatusOK},
+		{method: "POST", target: "/", body: "id=1+union+select+pw", expect: http.StatusForbidden},
+		{method: "POST", target: "/", body: "id=%26lt%3BSCRIPT%26gt%3B", expect: http.StatusForbidden},
+		{method: "POST", target: "/", body: "id=%26lt%3BSCRIPT%26gt%3B", threshold: 5, expect: http.StatusOK},
+		{method: "POST", target: "/", body: "id=%26lt%3BSCRIPT%26gt%3B&q=1+union+select", threshold: 5, expect: http.StatusForbidden},
+	} {
+		w, _ := newTestWAF(t, test.threshold)
+		r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		if test.body != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for k, v := range test.header {
+			if k == "Host" {
+				r.Host = v
+				continue
+			}
+			r.Header.Set(k, v)
+		}
+		if test.remote != "" {
+			r.RemoteAddr = test.remote
+		}
+		status, err := w.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("Test %d: Did not expect error, got: %v", i, err)
+		}
+		if status != test.expect {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expect, status)
+		}
+	}
+}
+
+func TestWAFBody(t *testing.T) {
+	w, seen := newTestWAF(t, 0)
+	w.BodyLimit = 8
+	body := "q=hello&comment=" + strings.Repeat("x", 100) + "&id=union+select"
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if status, _ := w.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusOK {
+		t.Errorf("Expected what's past the body limit to go uninspected, got status %d", status)
+	}
+	if string(*seen) != body {
+		t.Errorf("Expected the whole body to be passed on, got %q", *seen)
+	}
+}
+
+func TestWAFDetectOnly(t *testing.T) {
+	w, _ := newTestWAF(t, 0)
+	w.DetectOnly = true
+	r := httptest.NewRequest("GET", "/?id=1%20UNION%20SELECT%20pw", nil)
+	if status, _ := w.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusOK {
+		t.Errorf("Expected the request to be let through when only detecting, got status %d", status)
+	}
+}
+
+func TestWAFTarpit(t *testing.T) {
+	w, _ := newTestWAF(t, 0)
+	w.Tarpit = httpserver.Tarpit{Delay: 20 * time.Millisecond}
+	r := httptest.NewRequest("GET", "/?id=1%20UNION%20SELECT%20pw", nil)
+	start := time.Now()
+	if status, _ := w.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusForbidden {
+		t.Errorf("Expected the request to be blocked, got status %d", status)
+	}
+	if held := time.Since(start); held < w.Tarpit.Delay {
+		t.Errorf("Expected the blocked request to be held for %v, was %v", w.Tarpit.Delay, held)
+	}
+}
+
+func TestWAFMetrics(t *testing.T) {
+	w, _ := newTestWAF(t, 0)
+	w.Site = "metrics-test"
+	r := httptest.NewRequest("GET", "/?id=1%20UNION%20SELECT%20pw", nil)
+	w.ServeHTTP(httptest.NewRecorder(), r)
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteTo(&buf)
+	if expect := `caddy_http_waf_blocked_total{site="metrics-test",rule="942100"} 1`; !strings.Contains(buf.String(), expect) {
+		t.Errorf("Expected %s in:\n%s", expect, buf.String())
+	}
+}
+
+func TestNewRuleSetSkipAfter(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+SecRule ARGS "x" "id:1,skipAfter:MISSING"
+`), "test.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRuleSet(rules, nil); err == nil {
+		t.Error("Expected an error for a missing marker")
+	}
+}
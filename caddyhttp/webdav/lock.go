@@ -0,0 +1,207 @@
+package webdav
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// Lock is a WebDAV write lock on a resource.
+type Lock struct {
+	// Token is the lock token, an opaquelocktoken URI.
+	Token string
+
+	// Root is the name of the locked resource.
+	Root string
+
+	// Exclusive is false for shared locks.
+	Exclusive bool
+
+	// Infinite is true if the lock covers all members
+	// of a locked collection.
+	Infinite bool
+
+	// Owner is the XML owner element supplied by the client.
+	Owner string
+
+	// Timeout is the lock's lifetime; zero means infinite.
+	Timeout time.Duration
+
+	// Expires is when the lock lapses.
+	Expires time.Time
+}
+
+// covers reports whether l applies to name.
+func (l *Lock) covers(name string) bool {
+	if name == l.Root {
+		return true
+	}
+	if !l.Infinite {
+		return false
+	}
+	root := l.Root
+	if !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	return strings.HasPrefix(name, root)
+}
+
+// Lock errors.
+var (
+	ErrLocked       = errors.New("webdav: resource is locked")
+	ErrNoSuchLock   = errors.New("webdav: no such lock")
+	ErrConfirmation = errors.New("webdav: lock token not submitted")
+)
+
+// LockSystem keeps track of the locks held on resources. It
+// is safe for concurrent use.
+type LockSystem struct {
+	mu    sync.Mutex
+	locks map[string]*Lock // by token
+	now   func() time.Time
+}
+
+// NewLockSystem returns a new, empty LockSystem.
+func NewLockSystem() *LockSystem {
+	return &LockSystem{locks: make(map[string]*Lock), now: time.Now}
+}
+
+// expire removes lapsed locks. ls.mu must be held.
+func (ls *LockSystem) expire() {
+	now := ls.now()
+	for token, l := range ls.locks {
+		if l.Timeout > 0 && now.After(l.Expires) {
+			delete(ls.locks, token)
+		}
+	}
+}
+
+// conflicts reports whether a new lock rooted at name would
+// conflict with an existing one. ls.mu must be held.
+func (ls *LockSystem) conflicts(name string, exclusive, infinite bool) bool {
+	probe := &Lock{Root: name, Infinite: infinite}
+	for _, l := range ls.locks {
+		if !l.covers(name) && !probe.covers(l.Root) {
+			continue
+		}
+		if exclusive || l.Exclusive {
+			return true
+		}
+	}
+	return false
+}
+
+// Create creates a new lock as described by l, filling in
+// its token and expiry. It returns ErrLocked if the lock
+// would conflict with one that is already held.
+func (ls *LockSystem) Create(l Lock) (*Lock, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire()
+
+	if ls.conflicts(l.Root, l.Exclusive, l.Infinite) {
+		return nil, ErrLocked
+	}
+	u4, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	l.Token = "opaquelocktoken:" + u4.String()
+	l.Expires = ls.now().Add(l.Timeout)
+	ls.locks[l.Token] = &l
+	return &l, nil
+}
+
+// Refresh extends the lock identified by token.
+func (ls *LockSystem) Refresh(token string, timeout time.Duration) (*Lock, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire()
+
+	l, ok := ls.locks[token]
+	if !ok {
+		return nil, ErrNoSuchLock
+	}
+	l.Timeout = timeout
+	l.Expires = ls.now().Add(timeout)
+	cp := *l
+	return &cp, nil
+}
+
+// Unlock releases the lock identified by token on the
+// resource name, which must be covered by the lock.
+func (ls *LockSystem) Unlock(name, token string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire()
+
+	l, ok := ls.locks[token]
+	if !ok || !l.covers(name) {
+		return ErrNoSuchLock
+	}
+	delete(ls.locks, token)
+	return nil
+}
+
+// Confirm checks that every lock covering one of names,
+// including locks on their members if a name is a
+// collection, is matched by one of the submitted tokens.
+func (ls *LockSystem) Confirm(tokens []string, names ...string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire()
+
+	for _, name := range names {
+		probe := &Lock{Root: name, Infinite: true}
+		for _, l := range ls.locks {
+			if !l.covers(name) && !probe.covers(l.Root) {
+				continue
+			}
+			if !containsString(tokens, l.Token) {
+				return ErrConfirmation
+			}
+		}
+	}
+	return nil
+}
+
+// Discover returns the locks that cover name.
+func (ls *LockSystem) Discover(name string) []Lock {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire()
+
+	var locks []Lock
+	for _, l := range ls.locks {
+		if l.covers(name) {
+			locks = append(locks, *l)
+		}
+	}
+	return locks
+}
+
+// Remove drops all locks on name and its members, as
+// happens when the resource is deleted or moved away.
+func (ls *LockSystem) Remove(name string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	probe := &Lock{Root: name, Infinite: true}
+	for token, l := range ls.locks {
+		if probe.covers(l.Root) {
+			delete(ls.locks, token)
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
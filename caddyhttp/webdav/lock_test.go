@@ -0,0 +1,68 @@
+package webdav
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockSystem(t *testing.T) {
+	ls := NewLockSystem()
+	now := time.Now()
+	ls.now = func() time.Time { return now }
+
+	dir, err := ls.Create(Lock{Root: "/dir", Exclusive: true, Infinite: true, Timeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Expected no error creating lock, got %v", err)
+	}
+
+	if _, err := ls.Create(Lock{Root: "/dir/file", Exclusive: false}); err != ErrLocked {
+		t.Errorf("Expected member of exclusively locked collection to be locked, got %v", err)
+	}
+	if _, err := ls.Create(Lock{Root: "/", Infinite: true}); err != ErrLocked {
+		t.Errorf("Expected infinite lock on ancestor to conflict, got %v", err)
+	}
+	if _, err := ls.Create(Lock{Root: "/other", Exclusive: true}); err != nil {
+		t.Errorf("Expected unrelated lock to succeed, got %v", err)
+	}
+
+	if err := ls.Confirm(nil, "/dir/file"); err != ErrConfirmation {
+		t.Errorf("Expected confirmation without token to fail, got %v", err)
+	}
+	if err := ls.Confirm([]string{dir.Token}, "/dir/file"); err != nil {
+		t.Errorf("Expected confirmation with token to succeed, got %v", err)
+	}
+	if err := ls.Confirm(nil, "/"); err != ErrConfirmation {
+		t.Errorf("Expected modifying an ancestor of a lock to need the token, got %v", err)
+	}
+
+	if locks := ls.Discover("/dir/file"); len(locks) != 1 || locks[0].Token != dir.Token {
+		t.Errorf("Expected to discover the collection lock, got %+v", locks)
+	}
+
+	if err := ls.Unlock("/elsewhere", dir.Token); err != ErrNoSuchLock {
+		t.Errorf("Expected unlock of an uncovered resource to fail, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := ls.Confirm(nil, "/dir/file"); err != nil {
+		t.Errorf("Expected lock to have expired, got %v", err)
+	}
+	if _, err := ls.Refresh(dir.Token, time.Minute); err != ErrNoSuchLock {
+		t.Errorf("Expected refresh of expired lock to fail, got %v", err)
+	}
+
+	shared1, err := ls.Create(Lock{Root: "/shared", Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.Create(Lock{Root: "/shared", Timeout: time.Minute}); err != nil {
+		t.Errorf("Expected shared locks to coexist, got %v", err)
+	}
+	if err := ls.Unlock("/shared", shared1.Token); err != nil {
+		t.Errorf("Expected unlock to succeed, got %v", err)
+	}
+	ls.Remove("/shared")
+	if locks := ls.Discover("/shared"); len(locks) != 0 {
+		t.Errorf("Expected locks to be removed, got %+v", locks)
+	}
+}
@@ -0,0 +1,257 @@
+package webdav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// propfind is the body of a PROPFIND request.
+type propfind struct {
+	XMLName  xml.Name   `xml:"DAV: propfind"`
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *propNames `xml:"DAV: prop"`
+}
+
+// propNames collects the names of the child elements of a
+// prop element, which are the requested properties.
+type propNames []xml.Name
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (pn *propNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch elem := t.(type) {
+		case xml.StartElement:
+			*pn = append(*pn, elem.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// propertyupdate is the body of a PROPPATCH request.
+type propertyupdate struct {
+	XMLName xml.Name `xml:"DAV: propertyupdate"`
+	Set     []struct {
+		Prop propNames `xml:"DAV: prop"`
+	} `xml:"DAV: set"`
+	Remove []struct {
+		Prop propNames `xml:"DAV: prop"`
+	} `xml:"DAV: remove"`
+}
+
+// lockinfo is the body of a LOCK request.
+type lockinfo struct {
+	XMLName   xml.Name `xml:"DAV: lockinfo"`
+	LockScope struct {
+		Exclusive *struct{} `xml:"DAV: exclusive"`
+		Shared    *struct{} `xml:"DAV: shared"`
+	} `xml:"DAV: lockscope"`
+	LockType struct {
+		Write *struct{} `xml:"DAV: write"`
+	} `xml:"DAV: locktype"`
+	Owner struct {
+		InnerXML string `xml:",innerxml"`
+	} `xml:"DAV: owner"`
+}
+
+// readPropfind parses a PROPFIND request body. An empty
+// body is treated as a request for all properties.
+func readPropfind(r io.Reader) (propfind, error) {
+	var pf propfind
+	err := xml.NewDecoder(r).Decode(&pf)
+	if err == io.EOF {
+		return propfind{AllProp: &struct{}{}}, nil
+	}
+	if err != nil {
+		return pf, err
+	}
+	if pf.AllProp == nil && pf.PropName == nil && pf.Prop == nil {
+		return pf, fmt.Errorf("webdav: invalid propfind")
+	}
+	return pf, nil
+}
+
+// davName returns the name of a property in the DAV: namespace.
+func davName(local string) xml.Name {
+	return xml.Name{Space: "DAV:", Local: local}
+}
+
+// liveProps are the properties computed for every resource,
+// in the order in which they are reported.
+var liveProps = []xml.Name{
+	davName("resourcetype"),
+	davName("displayname"),
+	davName("getcontentlength"),
+	davName("getlastmodified"),
+	davName("getcontenttype"),
+	davName("getetag"),
+	davName("supportedlock"),
+	davName("lockdiscovery"),
+}
+
+// liveProp returns the XML value of the live property name of
+// the resource with the given name and info, or false if the
+// resource doesn't have that property.
+func liveProp(name xml.Name, resName string, fi os.FileInfo, locks []Lock) (string, bool) {
+	if name.Space != "DAV:" {
+		return "", false
+	}
+	switch name.Local {
+	case "resourcetype":
+		if fi.IsDir() {
+			return "<D:collection/>", true
+		}
+		return "", true
+	case "displayname":
+		return escape(path.Base(resName)), true
+	case "getcontentlength":
+		if fi.IsDir() {
+			return "", false
+		}
+		return strconv.FormatInt(fi.Size(), 10), true
+	case "getlastmodified":
+		return fi.ModTime().UTC().Format(http.TimeFormat), true
+	case "getcontenttype":
+		if fi.IsDir() {
+			return "", false
+		}
+		ctype := mime.TypeByExtension(path.Ext(resName))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		return escape(ctype), true
+	case "getetag":
+		if fi.IsDir() {
+			return "", false
+		}
+		return escape(etag(fi)), true
+	case "supportedlock":
+		return "<D:lockentry><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockentry>" +
+			"<D:lockentry><D:lockscope><D:shared/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockentry>", true
+	case "lockdiscovery":
+		var buf bytes.Buffer
+		for _, l := range locks {
+			writeActiveLock(&buf, l)
+		}
+		return buf.String(), true
+	}
+	return "", false
+}
+
+// etag returns the entity tag of a file.
+func etag(fi os.FileInfo) string {
+	return fmt.Sprintf(`"%x%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
+
+// multistatus accumulates a 207 Multi-Status response body.
+type multistatus struct {
+	buf bytes.Buffer
+}
+
+func newMultistatus() *multistatus {
+	ms := new(multistatus)
+	ms.buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<D:multistatus xmlns:D="DAV:">`)
+	return ms
+}
+
+// propstat is a group of properties sharing a status.
+type propstat struct {
+	status int
+	props  []xml.Name
+	values []string // parallel to props; nil for names only
+}
+
+// addResponse adds a response for href with the given propstats.
+func (ms *multistatus) addResponse(href string, stats ...propstat) {
+	ms.buf.WriteString("<D:response><D:href>" + escape(href) + "</D:href>")
+	for _, ps := range stats {
+		if len(ps.props) == 0 {
+			continue
+		}
+		ms.buf.WriteString("<D:propstat><D:prop>")
+		for i, name := range ps.props {
+			value := ""
+			if ps.values != nil {
+				value = ps.values[i]
+			}
+			writeProp(&ms.buf, name, value)
+		}
+		ms.buf.WriteString("</D:prop>")
+		ms.buf.WriteString(statusLine(ps.status))
+		ms.buf.WriteString("</D:propstat>")
+	}
+	ms.buf.WriteString("</D:response>")
+}
+
+// addStatus adds a response for href that consists only of a status.
+func (ms *multistatus) addStatus(href string, status int) {
+	ms.buf.WriteString("<D:response><D:href>" + escape(href) + "</D:href>" + statusLine(status) + "</D:response>")
+}
+
+// writeTo writes the response to w.
+func (ms *multistatus) writeTo(w http.ResponseWriter) {
+	ms.buf.WriteString("</D:multistatus>")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write(ms.buf.Bytes())
+}
+
+func statusLine(status int) string {
+	return fmt.Sprintf("<D:status>HTTP/1.1 %d %s</D:status>", status, http.StatusText(status))
+}
+
+// writeProp writes a property element with the given inner XML.
+func writeProp(buf *bytes.Buffer, name xml.Name, value string) {
+	if name.Space == "DAV:" {
+		if value == "" {
+			fmt.Fprintf(buf, "<D:%s/>", name.Local)
+		} else {
+			fmt.Fprintf(buf, "<D:%s>%s</D:%s>", name.Local, value, name.Local)
+		}
+		return
+	}
+	fmt.Fprintf(buf, `<X:%s xmlns:X="%s">%s</X:%s>`, name.Local, escape(name.Space), value, name.Local)
+}
+
+// writeActiveLock writes the activelock element describing l.
+func writeActiveLock(buf *bytes.Buffer, l Lock) {
+	scope, depth, timeout := "shared", "0", "Infinite"
+	if l.Exclusive {
+		scope = "exclusive"
+	}
+	if l.Infinite {
+		depth = "infinity"
+	}
+	if l.Timeout > 0 {
+		timeout = "Second-" + strconv.FormatInt(int64(l.Timeout/time.Second), 10)
+	}
+	fmt.Fprintf(buf, "<D:activelock><D:locktype><D:write/></D:locktype><D:lockscope><D:%s/></D:lockscope><D:depth>%s</D:depth>", scope, depth)
+	if l.Owner != "" {
+		fmt.Fprintf(buf, "<D:owner>%s</D:owner>", l.Owner)
+	}
+	fmt.Fprintf(buf, "<D:timeout>%s</D:timeout><D:locktoken><D:href>%s</D:href></D:locktoken><D:lockroot><D:href>%s</D:href></D:lockroot></D:activelock>",
+		timeout, escape(l.Token), escape(l.Root))
+}
+
+// escape escapes s for use as XML character data.
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
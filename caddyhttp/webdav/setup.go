@@ -0,0 +1,141 @@
+package webdav
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("webdav", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// setup configures a new WebDAV middleware instance.
+func setup(c *caddy.Controller) error {
+	configs, err := webdavParse(c)
+	if err != nil {
+		return err
+	}
+	for _, dc := range configs {
+		// files are written once listening, also in a sandbox
+		caddy.RegisterWritableDir(dc.Root)
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return WebDAV{Next: next, Configs: configs}
+	})
+
+	return nil
+}
+
+func webdavParse(c *caddy.Controller) ([]*Config, error) {
+	var configs []*Config
+
+	site := httpserver.GetConfig(c)
+	siteRoot := site.Root
+
+	for c.Next() {
+		dc := &Config{Scope: "/", Root: siteRoot, Locks: NewLockSystem(), MaxUpload: defaultMaxUpload, Site: site}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			dc.Scope = args[0]
+		default:
+			return configs, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "root":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				dc.Root = c.Val()
+				if !filepath.IsAbs(dc.Root) {
+					dc.Root = filepath.Join(siteRoot, dc.Root)
+				}
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			case "allow", "deny":
+				allow := c.Val() == "allow"
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return configs, c.ArgErr()
+				}
+				methods, err := expandMethods(args[1:])
+				if err != nil {
+					return configs, c.Err(err.Error())
+				}
+				dc.Rules = append(dc.Rules, AccessRule{User: args[0], Allow: allow, Methods: methods})
+			case "max_upload":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				size, err := parseSize(c.Val())
+				if err != nil {
+					return configs, c.Err(err.Error())
+				}
+				dc.MaxUpload = size
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+			case "readonly":
+				if c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				dc.Rules = append(dc.Rules, AccessRule{User: "*", Allow: false, Methods: methodGroups["write"]})
+			default:
+				return configs, c.Errf("Unknown webdav property '%s'", c.Val())
+			}
+		}
+
+		for _, other := range configs {
+			if other.Scope == dc.Scope {
+				return configs, fmt.Errorf("duplicate webdav config for %s", dc.Scope)
+			}
+		}
+		configs = append(configs, dc)
+	}
+
+	return configs, nil
+}
+
+// parseSize parses a size such as 10MB, where 0 means no limit.
+func parseSize(s string) (int64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	size, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(size), nil
+}
+
+// expandMethods normalizes a list of methods, expanding the
+// method groups and the "*" wildcard.
+func expandMethods(list []string) ([]string, error) {
+	var methods []string
+	for _, m := range list {
+		if group, ok := methodGroups[strings.ToLower(m)]; ok {
+			methods = append(methods, group...)
+			continue
+		}
+		m = strings.ToUpper(m)
+		if m != "*" && !containsString(strings.Split(allowedMethods, ", "), m) {
+			return nil, fmt.Errorf("unknown method '%s'", m)
+		}
+		methods = append(methods, m)
+	}
+	return methods, nil
+}
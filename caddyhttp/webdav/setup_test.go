@@ -0,0 +1,159 @@
+package webdav
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `webdav /dav`)
+	err := setup(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, had 0 instead")
+	}
+
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(WebDAV)
+	if !ok {
+		t.Fatalf("Expected handler to be type WebDAV, got: %#v", handler)
+	}
+
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+
+	if len(myHandler.Configs) != 1 || myHandler.Configs[0].Locks == nil {
+		t.Errorf("Expected one config with a lock system, got %+v", myHandler.Configs)
+	}
+	if !caddy.Writable(filepath.Join(myHandler.Configs[0].Root, "dav", "file.txt")) {
+		t.Error("Expected the root to be writable once privileges are dropped")
+	}
+}
+
+func TestWebdavParse(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expectedScope string
+		expectedRoot  string
+		expectedRules []AccessRule
+	}{
+		{`webdav`, false, "/", ".", nil},
+		{`webdav /files {
+			root /srv/share
+		}`, false, "/files", "/srv/share", nil},
+		{`webdav {
+			root share
+		}`, false, "/", "share", nil},
+		{`webdav {
+			readonly
+		}`, false, "/", ".", []AccessRule{{User: "*", Methods: methodGroups["write"]}}},
+		{`webdav {
+			allow alice *
+			deny bob write
+			deny * delete
+		}`, false, "/", ".", []AccessRule{
+			{User: "alice", Allow: true, Methods: []string{"*"}},
+			{User: "bob", Methods: methodGroups["write"]},
+			{User: "*", Methods: []string{"DELETE"}},
+		}},
+		{`webdav / /x`, true, "", "", nil},
+		{`webdav {
+			root
+		}`, true, "", "", nil},
+		{`webdav {
+			allow alice
+		}`, true, "", "", nil},
+		{`webdav {
+			allow alice FROB
+		}`, true, "", "", nil},
+		{`webdav {
+			readonly please
+		}`, true, "", "", nil},
+		{`webdav {
+			listing
+		}`, true, "", "", nil},
+		{"webdav /a\nwebdav /a", true, "", "", nil},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("http", test.input)
+		actual, err := webdavParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		if len(actual) != 1 {
+			t.Fatalf("Test %d expected 1 config, but got %d", i, len(actual))
+		}
+		dc := actual[0]
+		if dc.Scope != test.expectedScope {
+			t.Errorf("Test %d: Expected scope %s, got %s", i, test.expectedScope, dc.Scope)
+		}
+		if dc.Root != filepath.FromSlash(test.expectedRoot) {
+			t.Errorf("Test %d: Expected root %s, got %s", i, test.expectedRoot, dc.Root)
+		}
+		if len(dc.Rules) != len(test.expectedRules) {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, len(test.expectedRules), len(dc.Rules))
+			continue
+		}
+		for j, rule := range dc.Rules {
+			expected := test.expectedRules[j]
+			if rule.User != expected.User || rule.Allow != expected.Allow || len(rule.Methods) != len(expected.Methods) {
+				t.Errorf("Test %d, rule %d: Expected %+v, got %+v", i, j, expected, rule)
+			}
+		}
+	}
+}
+
+func TestWebdavParseMaxUpload(t *testing.T) {
+	tests := []struct {
+		input             string
+		shouldErr         bool
+		expectedMaxUpload int64
+	}{
+		{`webdav`, false, defaultMaxUpload},
+		{`webdav {
+			max_upload 1MiB
+		}`, false, 1 << 20},
+		{`webdav {
+			max_upload 0
+		}`, false, 0},
+		{`webdav {
+			max_upload lots
+		}`, true, 0},
+		{`webdav {
+			max_upload
+		}`, true, 0},
+		{`webdav {
+			max_upload 1MB 2MB
+		}`, true, 0},
+	}
+	for i, test := range tests {
+		actual, err := webdavParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr != (err != nil) {
+			t.Errorf("Test %d: Expected error %v, got %v", i, test.shouldErr, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if actual[0].MaxUpload != test.expectedMaxUpload {
+			t.Errorf("Test %d: Expected MaxUpload %d, got %d", i, test.expectedMaxUpload, actual[0].MaxUpload)
+		}
+	}
+}
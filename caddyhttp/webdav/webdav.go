@@ -0,0 +1,827 @@
+// Package webdav is middleware that serves a directory over
+// WebDAV (RFC 4918), including locking (compliance class 2).
+package webdav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// WebDAV is middleware that handles WebDAV requests.
+type WebDAV struct {
+	Next    httpserver.Handler
+	Configs []*Config
+}
+
+// Config is the configuration of a WebDAV share.
+type Config struct {
+	// Scope is the base path of the share.
+	Scope string
+
+	// Root is the directory that is shared.
+	Root string
+
+	// Rules control which users may use which methods.
+	Rules []AccessRule
+
+	// Locks holds the locks on resources in this share.
+	Locks *LockSystem
+
+	// MaxUpload is the largest request body allowed for PUT,
+	// in bytes, or 0 for no limit.
+	MaxUpload int64
+
+	// Site is the config of the site the share is in, whose
+	// hidden files are hidden from the share too.
+	Site *httpserver.SiteConfig
+}
+
+// IsHidden returns whether fpath, a path within Root, is hidden
+// from the site, either as a path of the site, if it is within
+// the site's root, or by name, as a path of the share.
+func (c *Config) IsHidden(fpath string) bool {
+	if c.Site == nil {
+		return false
+	}
+	if rel, err := filepath.Rel(c.Site.Root, fpath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		if c.Site.IsHidden(filepath.ToSlash(rel)) {
+			return true
+		}
+	}
+	rel, err := filepath.Rel(c.Root, fpath)
+	if err != nil {
+		return true
+	}
+	return c.Site.IsHidden(filepath.ToSlash(rel))
+}
+
+// containsHidden returns whether fpath is, or is a directory
+// that has within it, a path that is hidden.
+func (c *Config) containsHidden(fpath string) bool {
+	err := filepath.Walk(fpath, func(p string, fi os.FileInfo, err error) error {
+		if c.IsHidden(p) {
+			return errHidden
+		}
+		return nil
+	})
+	return err == errHidden
+}
+
+// errHidden stops a walk at a path that is hidden.
+var errHidden = errors.New("hidden")
+
+// AccessRule allows or denies a user a set of methods.
+type AccessRule struct {
+	// User is the authenticated user (as set by basicauth)
+	// the rule applies to, or "*" for anyone.
+	User string
+
+	// Allow is false if the rule denies access.
+	Allow bool
+
+	// Methods are the HTTP methods the rule applies to.
+	Methods []string
+}
+
+// Method groups that may be used in access rules.
+var methodGroups = map[string][]string{
+	"read":  {"GET", "HEAD", "OPTIONS", "PROPFIND"},
+	"write": {"PUT", "DELETE", "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK"},
+}
+
+// Allowed reports whether user may use method according to
+// the rules; the first rule that applies decides, and if no
+// rule applies, reading is allowed, but writing only to
+// authenticated users, so that anonymous clients need a rule
+// for user "*".
+func (c *Config) Allowed(user, method string) bool {
+	for _, rule := range c.Rules {
+		if rule.User != "*" && rule.User != user {
+			continue
+		}
+		for _, m := range rule.Methods {
+			if m == "*" || m == method {
+				return rule.Allow
+			}
+		}
+	}
+	return user != "" || !isWriteMethod(method)
+}
+
+// isWriteMethod returns whether method modifies the share.
+func isWriteMethod(method string) bool {
+	for _, m := range methodGroups["write"] {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// errSymlink is returned for a path that goes through a symlink,
+// which could lead out of the share.
+var errSymlink = errors.New("path goes through a symlink")
+
+// checkSymlinks returns errSymlink if fpath, a path within Root,
+// or any directory it is in below Root, is a symlink. Those that
+// don't exist yet are not checked, nor are any below them.
+func (c *Config) checkSymlinks(fpath string) error {
+	rel, err := filepath.Rel(c.Root, fpath)
+	if err != nil {
+		return err
+	}
+	p := c.Root
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		if elem == "" || elem == "." {
+			continue
+		}
+		p = filepath.Join(p, elem)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errSymlink
+		}
+	}
+	return nil
+}
+
+// defaultMaxUpload is the default limit on the size of a PUT.
+const defaultMaxUpload = 32 << 20
+
+const allowedMethods = "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND, PROPPATCH, LOCK, UNLOCK"
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (d WebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var cfg *Config
+	for _, c := range d.Configs {
+		if httpserver.Path(r.URL.Path).Matches(c.Scope) {
+			if cfg == nil || len(c.Scope) > len(cfg.Scope) {
+				cfg = c
+			}
+		}
+	}
+	if cfg == nil {
+		return d.Next.ServeHTTP(w, r)
+	}
+
+	user, _ := r.Context().Value(httpserver.RemoteUserCtxKey).(string)
+	if !cfg.Allowed(user, r.Method) {
+		return http.StatusForbidden, nil
+	}
+
+	h := handler{cfg: cfg, w: w, r: r}
+	fpath := h.file(h.name(r.URL.Path))
+	if cfg.IsHidden(fpath) {
+		return http.StatusNotFound, nil
+	}
+	if err := cfg.checkSymlinks(fpath); err == errSymlink {
+		return http.StatusForbidden, nil
+	} else if err != nil {
+		return statusForError(err), err
+	}
+	switch r.Method {
+	case "OPTIONS":
+		return h.options()
+	case "GET", "HEAD":
+		return h.get()
+	case "PUT":
+		return h.put()
+	case "DELETE":
+		return h.delete()
+	case "MKCOL":
+		return h.mkcol()
+	case "COPY", "MOVE":
+		return h.copyMove()
+	case "PROPFIND":
+		return h.propfind()
+	case "PROPPATCH":
+		return h.proppatch()
+	case "LOCK":
+		return h.lock()
+	case "UNLOCK":
+		return h.unlock()
+	}
+	w.Header().Set("Allow", allowedMethods)
+	return http.StatusMethodNotAllowed, nil
+}
+
+// handler handles a single WebDAV request.
+type handler struct {
+	cfg *Config
+	w   http.ResponseWriter
+	r   *http.Request
+}
+
+// name returns the cleaned resource name of urlPath, which
+// is the URL path that identifies the resource.
+func (h handler) name(urlPath string) string {
+	name := path.Clean("/" + urlPath)
+	if name != "/" && strings.HasSuffix(urlPath, "/") {
+		name += "/"
+	}
+	return name
+}
+
+// lockName returns the name under which locks on the
+// resource name are held, which disregards trailing slashes.
+func lockName(name string) string {
+	if name == "/" {
+		return name
+	}
+	return strings.TrimSuffix(name, "/")
+}
+
+// file returns the path on disk of the resource name.
+func (h handler) file(name string) string {
+	rel := strings.TrimPrefix(path.Clean(name), path.Clean(h.cfg.Scope))
+	return filepath.Join(h.cfg.Root, filepath.FromSlash(path.Clean("/"+rel)))
+}
+
+// tokens returns the lock tokens submitted with the request.
+func (h handler) tokens() []string {
+	var tokens []string
+	s := h.r.Header.Get("If")
+	for {
+		i := strings.Index(s, "<")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(s[i:], ">")
+		if j < 0 {
+			break
+		}
+		tokens = append(tokens, s[i+1:i+j])
+		s = s[i+j+1:]
+	}
+	return tokens
+}
+
+// confirm checks that the request may modify names.
+func (h handler) confirm(names ...string) (int, error) {
+	for i := range names {
+		names[i] = lockName(names[i])
+	}
+	if err := h.cfg.Locks.Confirm(h.tokens(), names...); err != nil {
+		return http.StatusLocked, nil
+	}
+	return 0, nil
+}
+
+func (h handler) options() (int, error) {
+	h.w.Header().Set("Allow", allowedMethods)
+	h.w.Header().Set("DAV", "1, 2")
+	h.w.Header().Set("MS-Author-Via", "DAV")
+	h.w.WriteHeader(http.StatusOK)
+	return 0, nil
+}
+
+func (h handler) get() (int, error) {
+	f, err := os.Open(h.file(h.name(h.r.URL.Path)))
+	if err != nil {
+		return statusForError(err), nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if fi.IsDir() {
+		h.w.Header().Set("Allow", allowedMethods)
+		return http.StatusMethodNotAllowed, nil
+	}
+	h.w.Header().Set("ETag", etag(fi))
+	http.ServeContent(h.w, h.r, fi.Name(), fi.ModTime(), f)
+	return 0, nil
+}
+
+func (h handler) put() (int, error) {
+	name := h.name(h.r.URL.Path)
+	if code, err := h.confirm(name); code != 0 {
+		return code, err
+	}
+	fpath := h.file(name)
+
+	fi, err := os.Stat(fpath)
+	created := os.IsNotExist(err)
+	if err == nil && fi.IsDir() {
+		return http.StatusMethodNotAllowed, nil
+	}
+	if _, err := os.Stat(filepath.Dir(fpath)); err != nil {
+		return http.StatusConflict, nil
+	}
+
+	body := h.r.Body
+	if h.cfg.MaxUpload > 0 {
+		if h.r.ContentLength > h.cfg.MaxUpload {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		body = http.MaxBytesReader(h.w, body, h.cfg.MaxUpload)
+	}
+
+	f, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return statusForError(err), err
+	}
+	_, copyErr := io.Copy(f, body)
+	closeErr := f.Close()
+	if copyErr != nil {
+		if created {
+			os.Remove(fpath)
+		}
+		if strings.Contains(copyErr.Error(), "request body too large") {
+			return http.StatusRequestEntityTooLarge, nil
+		}
+		return http.StatusInternalServerError, copyErr
+	}
+	if closeErr != nil {
+		return http.StatusInternalServerError, closeErr
+	}
+
+	if fi, err := os.Stat(fpath); err == nil {
+		h.w.Header().Set("ETag", etag(fi))
+	}
+	if created {
+		h.w.WriteHeader(http.StatusCreated)
+	} else {
+		h.w.WriteHeader(http.StatusNoContent)
+	}
+	return 0, nil
+}
+
+// isScope returns whether the resource name is the share itself,
+// which may not be deleted, moved or replaced.
+func (h handler) isScope(name string) bool {
+	return lockName(name) == path.Clean("/"+h.cfg.Scope)
+}
+
+func (h handler) delete() (int, error) {
+	name := h.name(h.r.URL.Path)
+	if h.isScope(name) {
+		return http.StatusForbidden, nil
+	}
+	if code, err := h.confirm(name); code != 0 {
+		return code, err
+	}
+	fpath := h.file(name)
+	if _, err := os.Stat(fpath); err != nil {
+		return statusForError(err), nil
+	}
+	if h.cfg.containsHidden(fpath) {
+		return http.StatusForbidden, nil
+	}
+	if err := os.RemoveAll(fpath); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	h.cfg.Locks.Remove(lockName(name))
+	h.w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+}
+
+func (h handler) mkcol() (int, error) {
+	name := h.name(h.r.URL.Path)
+	if code, err := h.confirm(name); code != 0 {
+		return code, err
+	}
+	if h.r.ContentLength > 0 {
+		return http.StatusUnsupportedMediaType, nil
+	}
+	fpath := h.file(name)
+	if _, err := os.Stat(fpath); err == nil {
+		return http.StatusMethodNotAllowed, nil
+	}
+	if err := os.Mkdir(fpath, 0777); err != nil {
+		if os.IsNotExist(err) {
+			return http.StatusConflict, nil
+		}
+		return statusForError(err), err
+	}
+	h.w.WriteHeader(http.StatusCreated)
+	return 0, nil
+}
+
+func (h handler) copyMove() (int, error) {
+	src := h.name(h.r.URL.Path)
+
+	dest, err := url.Parse(h.r.Header.Get("Destination"))
+	if err != nil || dest.Path == "" {
+		return http.StatusBadRequest, nil
+	}
+	if dest.Host != "" && dest.Host != h.r.Host {
+		// copying to another server is not supported
+		return http.StatusBadGateway, nil
+	}
+	dst := h.name(dest.Path)
+	if !httpserver.Path(dst).Matches(h.cfg.Scope) {
+		return http.StatusBadGateway, nil
+	}
+	if strings.TrimSuffix(src, "/") == strings.TrimSuffix(dst, "/") {
+		return http.StatusForbidden, nil
+	}
+	if h.isScope(dst) || (h.r.Method == "MOVE" && h.isScope(src)) {
+		return http.StatusForbidden, nil
+	}
+
+	srcPath, dstPath := h.file(src), h.file(dst)
+	if h.cfg.IsHidden(dstPath) {
+		return http.StatusForbidden, nil
+	}
+	if err := h.cfg.checkSymlinks(dstPath); err == errSymlink {
+		return http.StatusForbidden, nil
+	} else if err != nil {
+		return statusForError(err), err
+	}
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return statusForError(err), nil
+	}
+	if srcInfo.IsDir() && strings.HasPrefix(dstPath+string(filepath.Separator), srcPath+string(filepath.Separator)) {
+		// a collection can't be copied or moved into itself
+		return http.StatusForbidden, nil
+	}
+
+	if h.r.Method == "MOVE" {
+		if code, err := h.confirm(src, dst); code != 0 {
+			return code, err
+		}
+	} else if code, err := h.confirm(dst); code != 0 {
+		return code, err
+	}
+
+	if _, err := os.Stat(filepath.Dir(dstPath)); err != nil {
+		return http.StatusConflict, nil
+	}
+	created := true
+	if _, err := os.Stat(dstPath); err == nil {
+		if h.r.Header.Get("Overwrite") == "F" {
+			return http.StatusPreconditionFailed, nil
+		}
+		if h.cfg.containsHidden(dstPath) {
+			return http.StatusForbidden, nil
+		}
+		created = false
+		if err := os.RemoveAll(dstPath); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		h.cfg.Locks.Remove(lockName(dst))
+	}
+
+	if h.r.Method == "MOVE" {
+		// what is hidden where it is may not be where it goes
+		if h.cfg.containsHidden(srcPath) {
+			return http.StatusForbidden, nil
+		}
+		if err := os.Rename(srcPath, dstPath); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		h.cfg.Locks.Remove(lockName(src))
+	} else {
+		recurse := h.r.Header.Get("Depth") != "0"
+		if err := copyFiles(srcPath, dstPath, recurse, h.cfg.IsHidden); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	if created {
+		h.w.WriteHeader(http.StatusCreated)
+	} else {
+		h.w.WriteHeader(http.StatusNoContent)
+	}
+	return 0, nil
+}
+
+// copyFiles copies the file or directory src to dst, leaving out
+// what is hidden and symlinks, which could lead out of the share;
+// the contents of directories are only copied if recurse is true.
+func copyFiles(src, dst string, recurse bool, hidden func(string) bool) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if fi.IsDir() {
+		if err := os.Mkdir(dst, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		if !recurse {
+			return nil
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if hidden(filepath.Join(src, name)) {
+				continue
+			}
+			if err := copyFiles(filepath.Join(src, name), filepath.Join(dst, name), true, hidden); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (h handler) propfind() (int, error) {
+	name := h.name(h.r.URL.Path)
+	fpath := h.file(name)
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return statusForError(err), nil
+	}
+
+	depth := -1
+	switch h.r.Header.Get("Depth") {
+	case "0":
+		depth = 0
+	case "1":
+		depth = 1
+	case "", "infinity":
+	default:
+		return http.StatusBadRequest, nil
+	}
+
+	pf, err := readPropfind(h.r.Body)
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+
+	ms := newMultistatus()
+	var walk func(name, fpath string, fi os.FileInfo, depth int) error
+	walk = func(name, fpath string, fi os.FileInfo, depth int) error {
+		if fi.IsDir() && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		h.addPropResponse(ms, pf, name, fi)
+		if !fi.IsDir() || depth == 0 {
+			return nil
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			return err
+		}
+		children, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if h.cfg.IsHidden(filepath.Join(fpath, child.Name())) {
+				continue
+			}
+			err := walk(name+child.Name(), filepath.Join(fpath, child.Name()), child, depth-1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(name, fpath, fi, depth); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	ms.writeTo(h.w)
+	return 0, nil
+}
+
+// addPropResponse adds the response for one resource to a
+// PROPFIND multistatus.
+func (h handler) addPropResponse(ms *multistatus, pf propfind, name string, fi os.FileInfo) {
+	locks := h.cfg.Locks.Discover(lockName(name))
+	href := (&url.URL{Path: name}).EscapedPath()
+
+	var found, missing propstat
+	found.status, missing.status = http.StatusOK, http.StatusNotFound
+
+	requested := liveProps
+	if pf.Prop != nil {
+		requested = *pf.Prop
+	}
+	for _, prop := range requested {
+		value, ok := liveProp(prop, name, fi, locks)
+		if !ok {
+			missing.props = append(missing.props, prop)
+			continue
+		}
+		found.props = append(found.props, prop)
+		if pf.PropName == nil {
+			found.values = append(found.values, value)
+		}
+	}
+	if pf.Prop == nil {
+		// allprop and propname only report existing properties
+		missing.props = nil
+	}
+	ms.addResponse(href, found, missing)
+}
+
+func (h handler) proppatch() (int, error) {
+	name := h.name(h.r.URL.Path)
+	if code, err := h.confirm(name); code != 0 {
+		return code, err
+	}
+	if _, err := os.Stat(h.file(name)); err != nil {
+		return statusForError(err), nil
+	}
+
+	var pu propertyupdate
+	if err := xml.NewDecoder(h.r.Body).Decode(&pu); err != nil {
+		return http.StatusBadRequest, nil
+	}
+
+	// live properties are protected and dead properties are
+	// not stored, so every change is refused
+	var denied propstat
+	denied.status = http.StatusForbidden
+	for _, set := range pu.Set {
+		denied.props = append(denied.props, set.Prop...)
+	}
+	for _, remove := range pu.Remove {
+		denied.props = append(denied.props, remove.Prop...)
+	}
+
+	ms := newMultistatus()
+	ms.addResponse((&url.URL{Path: name}).EscapedPath(), denied)
+	ms.writeTo(h.w)
+	return 0, nil
+}
+
+func (h handler) lock() (int, error) {
+	name := lockName(h.name(h.r.URL.Path))
+	timeout, err := parseTimeout(h.r.Header.Get("Timeout"))
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+
+	var body bytes.Buffer
+	if _, err := io.Copy(&body, h.r.Body); err != nil {
+		return http.StatusBadRequest, nil
+	}
+
+	var l *Lock
+	created := false
+	if body.Len() == 0 {
+		// an empty body refreshes an existing lock
+		tokens := h.tokens()
+		if len(tokens) != 1 {
+			return http.StatusBadRequest, nil
+		}
+		l, err = h.cfg.Locks.Refresh(tokens[0], timeout)
+		if err != nil {
+			return http.StatusPreconditionFailed, nil
+		}
+	} else {
+		var li lockinfo
+		if err := xml.NewDecoder(&body).Decode(&li); err != nil {
+			return http.StatusBadRequest, nil
+		}
+		if li.LockType.Write == nil || (li.LockScope.Exclusive == nil) == (li.LockScope.Shared == nil) {
+			return http.StatusBadRequest, nil
+		}
+		infinite := true
+		switch h.r.Header.Get("Depth") {
+		case "0":
+			infinite = false
+		case "", "infinity":
+		default:
+			return http.StatusBadRequest, nil
+		}
+
+		l, err = h.cfg.Locks.Create(Lock{
+			Root:      name,
+			Exclusive: li.LockScope.Exclusive != nil,
+			Infinite:  infinite,
+			Owner:     li.Owner.InnerXML,
+			Timeout:   timeout,
+		})
+		if err == ErrLocked {
+			return http.StatusLocked, nil
+		} else if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		// locking an unmapped URL creates an empty resource
+		fpath := h.file(name)
+		if _, err := os.Stat(fpath); os.IsNotExist(err) {
+			f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+			if err != nil {
+				h.cfg.Locks.Unlock(name, l.Token)
+				if os.IsNotExist(err) {
+					return http.StatusConflict, nil
+				}
+				return http.StatusInternalServerError, err
+			}
+			f.Close()
+			created = true
+		}
+		h.w.Header().Set("Lock-Token", "<"+l.Token+">")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n" + `<D:prop xmlns:D="DAV:"><D:lockdiscovery>`)
+	writeActiveLock(&buf, *l)
+	buf.WriteString("</D:lockdiscovery></D:prop>")
+
+	h.w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if created {
+		h.w.WriteHeader(http.StatusCreated)
+	} else {
+		h.w.WriteHeader(http.StatusOK)
+	}
+	h.w.Write(buf.Bytes())
+	return 0, nil
+}
+
+func (h handler) unlock() (int, error) {
+	name := lockName(h.name(h.r.URL.Path))
+	token := strings.TrimSuffix(strings.TrimPrefix(h.r.Header.Get("Lock-Token"), "<"), ">")
+	if token == "" {
+		return http.StatusBadRequest, nil
+	}
+	if err := h.cfg.Locks.Unlock(name, token); err != nil {
+		return http.StatusConflict, nil
+	}
+	h.w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+}
+
+// maxLockTimeout bounds lock timeouts, so that locks of
+// clients that went away are eventually released.
+const maxLockTimeout = 24 * time.Hour
+
+// parseTimeout parses the value of a Timeout header, such as
+// "Second-3600" or "Infinite", choosing the first supported
+// option. An empty value yields the maximum timeout.
+func parseTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return maxLockTimeout, nil
+	}
+	for _, opt := range strings.Split(s, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "Infinite" {
+			return maxLockTimeout, nil
+		}
+		if strings.HasPrefix(opt, "Second-") {
+			n, err := strconv.ParseInt(opt[len("Second-"):], 10, 64)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("webdav: invalid timeout %q", opt)
+			}
+			d := time.Duration(n) * time.Second
+			if d > maxLockTimeout || d <= 0 {
+				d = maxLockTimeout
+			}
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("webdav: invalid timeout %q", s)
+}
+
+// statusForError maps a file system error to a status code.
+func statusForError(err error) int {
+	switch {
+	case os.IsNotExist(err):
+		return http.StatusNotFound
+	case os.IsPermission(err):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,366 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestWebDAV(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := WebDAV{
+		Configs: []*Config{{
+			Scope: "/dav",
+			Root:  root,
+			Rules: []AccessRule{
+				{User: "guest", Allow: false, Methods: methodGroups["write"]},
+				{User: "*", Allow: true, Methods: []string{"*"}},
+			},
+			Locks: NewLockSystem(),
+		}},
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+	}
+
+	var lockToken string
+	tests := []struct {
+		method       string
+		url          string
+		headers      map[string]string
+		body         string
+		user         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"GET", "/other", nil, "", "", http.StatusTeapot, ""},
+		{"OPTIONS", "/dav/", nil, "", "", http.StatusOK, ""},
+		{"MKCOL", "/dav/docs", nil, "", "", http.StatusCreated, ""},
+		{"MKCOL", "/dav/docs", nil, "", "", http.StatusMethodNotAllowed, ""},
+		{"MKCOL", "/dav/a/b", nil, "", "", http.StatusConflict, ""},
+		{"PUT", "/dav/docs/readme.txt", nil, "hello", "", http.StatusCreated, ""},
+		{"PUT", "/dav/docs/readme.txt", nil, "hello world", "", http.StatusNoContent, ""},
+		{"PUT", "/dav/missing/readme.txt", nil, "x", "", http.StatusConflict, ""},
+		{"PUT", "/dav/docs/guest.txt", nil, "x", "guest", http.StatusForbidden, ""},
+		{"GET", "/dav/docs/readme.txt", nil, "", "", http.StatusOK, "hello world"},
+		{"GET", "/dav/docs/nothing.txt", nil, "", "", http.StatusNotFound, ""},
+		{"PROPFIND", "/dav/docs", map[string]string{"Depth": "1"}, "", "", http.StatusMultiStatus,
+			"<D:href>/dav/docs/readme.txt</D:href>"},
+		{"PROPFIND", "/dav/docs/readme.txt", map[string]string{"Depth": "0"},
+			`<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:getcontentlength/><x:color xmlns:x="urn:x"/></D:prop></D:propfind>`,
+			"", http.StatusMultiStatus, "<D:getcontentlength>11</D:getcontentlength>"},
+		{"PROPPATCH", "/dav/docs/readme.txt", nil,
+			`<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:"><D:set><D:prop><x:color xmlns:x="urn:x">red</x:color></D:prop></D:set></D:propertyupdate>`,
+			"", http.StatusMultiStatus, "403 Forbidden"},
+		{"COPY", "/dav/docs/readme.txt", map[string]string{"Destination": "/dav/copy.txt"}, "", "", http.StatusCreated, ""},
+		{"COPY", "/dav/docs/readme.txt", map[string]string{"Destination": "/dav/copy.txt", "Overwrite": "F"}, "", "", http.StatusPreconditionFailed, ""},
+		{"COPY", "/dav/docs/readme.txt", map[string]string{"Destination": "http://elsewhere/dav/x.txt"}, "", "", http.StatusBadGateway, ""},
+		{"MOVE", "/dav/copy.txt", map[string]string{"Destination": "/dav/moved.txt"}, "", "", http.StatusCreated, ""},
+		{"GET", "/dav/copy.txt", nil, "", "", http.StatusNotFound, ""},
+		{"LOCK", "/dav/docs", nil,
+			`<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>me</D:owner></D:lockinfo>`,
+			"", http.StatusOK, "<D:depth>infinity</D:depth>"},
+		{"PUT", "/dav/docs/readme.txt", nil, "locked out", "", http.StatusLocked, ""},
+		{"DELETE", "/dav/docs", nil, "", "", http.StatusLocked, ""},
+		{"PUT", "/dav/docs/readme.txt", map[string]string{"If": "(<TOKEN>)"}, "let in", "", http.StatusNoContent, ""},
+		{"LOCK", "/dav/docs", map[string]string{"If": "(<TOKEN>)", "Timeout": "Second-60"}, "", "", http.StatusOK, "Second-60"},
+		{"UNLOCK", "/dav/docs", map[string]string{"Lock-Token": "<TOKEN>"}, "", "", http.StatusNoContent, ""},
+		{"LOCK", "/dav/new.txt", nil,
+			`<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:shared/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`,
+			"", http.StatusCreated, "<D:shared/>"},
+		{"DELETE", "/dav/docs", nil, "", "", http.StatusNoContent, ""},
+		{"PROPFIND", "/dav/docs", nil, "", "", http.StatusNotFound, ""},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		for k, v := range test.headers {
+			req.Header.Set(k, strings.Replace(v, "TOKEN", lockToken, -1))
+		}
+		if test.user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), httpserver.RemoteUserCtxKey, test.user))
+		}
+		rec := httptest.NewRecorder()
+		code, err := d.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d (%s %s): Expected status %d, got %d", i, test.method, test.url, test.expectedCode, code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Errorf("Test %d (%s %s): Expected body to contain %q, got %q", i, test.method, test.url, test.expectedBody, rec.Body.String())
+		}
+		if tok := rec.Header().Get("Lock-Token"); tok != "" && lockToken == "" {
+			lockToken = strings.Trim(tok, "<>")
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "moved.txt")); err != nil {
+		t.Errorf("Expected moved file to exist: %v", err)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  string
+		shouldErr bool
+	}{
+		{"", "24h0m0s", false},
+		{"Infinite", "24h0m0s", false},
+		{"Second-30", "30s", false},
+		{"Infinite, Second-30", "24h0m0s", false},
+		{"Second-999999999", "24h0m0s", false},
+		{"Second-x", "", true},
+		{"Minute-1", "", true},
+	} {
+		d, err := parseTimeout(test.input)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error for %q", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if d.String() != test.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expected, d)
+		}
+	}
+}
+
+// allowAll lets anyone use any method.
+var allowAll = []AccessRule{{User: "*", Allow: true, Methods: []string{"*"}}}
+
+func TestWebDAVHidden(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{".git", "docs/.git", "share/.git"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"Caddyfile", ".git/config", "docs/readme.txt", "docs/.git/config", "share/.git/config", "share/notes.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(root, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	site := &httpserver.SiteConfig{Root: root, HiddenFiles: []string{"/Caddyfile"}, HideVCS: true}
+	d := WebDAV{
+		Configs: []*Config{
+			{Scope: "/", Root: root, Rules: allowAll, Locks: NewLockSystem(), Site: site},
+			{Scope: "/share", Root: filepath.Join(root, "share"), Rules: allowAll, Locks: NewLockSystem(), Site: site},
+		},
+		Next: httpserver.EmptyNext,
+	}
+
+	tests := []struct {
+		method       string
+		url          string
+		headers      map[string]string
+		body         string
+		expectedCode int
+		expectedBody string
+		omittedBody  string
+	}{
+		{"GET", "/Caddyfile", nil, "", http.StatusNotFound, "", ""},
+		{"GET", "/caddyfile", nil, "", http.StatusNotFound, "", ""},
+		{"GET", "/.git/config", nil, "", http.StatusNotFound, "", ""},
+		{"GET", "/share/.git/config", nil, "", http.StatusNotFound, "", ""},
+		{"PUT", "/Caddyfile", nil, "overwritten", http.StatusNotFound, "", ""},
+		{"PUT", "/.git/hooks", nil, "overwritten", http.StatusNotFound, "", ""},
+		{"DELETE", "/.git", nil, "", http.StatusNotFound, "", ""},
+		{"LOCK", "/.git/new", nil, "", http.StatusNotFound, "", ""},
+		{"PROPFIND", "/", map[string]string{"Depth": "infinity"}, "", http.StatusMultiStatus, "<D:href>/docs/readme.txt</D:href>", "Caddyfile"},
+		{"PROPFIND", "/", map[string]string{"Depth": "1"}, "", http.StatusMultiStatus, "<D:href>/docs/</D:href>", ".git"},
+		{"COPY", "/docs/readme.txt", map[string]string{"Destination": "/Caddyfile"}, "", http.StatusForbidden, "", ""},
+		{"MOVE", "/docs/readme.txt", map[string]string{"Destination": "/.git/config"}, "", http.StatusForbidden, "", ""},
+		{"MOVE", "/docs", map[string]string{"Destination": "/moved"}, "", http.StatusForbidden, "", ""},
+		{"DELETE", "/docs", nil, "", http.StatusForbidden, "", ""},
+		{"COPY", "/docs", map[string]string{"Destination": "/copied"}, "", http.StatusCreated, "", ""},
+		{"GET", "/copied/readme.txt", nil, "", http.StatusOK, "docs/readme.txt", ""},
+		{"GET", "/share/notes.txt", nil, "", http.StatusOK, "share/notes.txt", ""},
+		{"GET", "/docs/readme.txt", nil, "", http.StatusOK, "docs/readme.txt", ""},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		code, err := d.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d (%s %s): Expected status %d, got %d", i, test.method, test.url, test.expectedCode, code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Errorf("Test %d (%s %s): Expected body to contain %q, got %q", i, test.method, test.url, test.expectedBody, rec.Body.String())
+		}
+		if test.omittedBody != "" && strings.Contains(rec.Body.String(), test.omittedBody) {
+			t.Errorf("Test %d (%s %s): Expected body not to contain %q, got %q", i, test.method, test.url, test.omittedBody, rec.Body.String())
+		}
+	}
+
+	if b, _ := ioutil.ReadFile(filepath.Join(root, "Caddyfile")); string(b) != "Caddyfile" {
+		t.Errorf("Expected the Caddyfile to be untouched, got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(root, "copied", ".git")); !os.IsNotExist(err) {
+		t.Errorf("Expected hidden files not to be copied, got %v", err)
+	}
+}
+
+// unsizedReader hides the size of a body from httptest.NewRequest.
+type unsizedReader struct{ io.Reader }
+
+func TestWebDAVMaxUpload(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d := WebDAV{
+		Configs: []*Config{{Scope: "/", Root: root, Rules: allowAll, Locks: NewLockSystem(), MaxUpload: 10}},
+		Next:    httpserver.EmptyNext,
+	}
+	tests := []struct {
+		name         string
+		body         io.Reader
+		expectedCode int
+	}{
+		{"small.txt", strings.NewReader("0123456789"), http.StatusCreated},
+		{"large.txt", strings.NewReader("0123456789a"), http.StatusRequestEntityTooLarge},
+		{"chunked.txt", unsizedReader{strings.NewReader("0123456789a")}, http.StatusRequestEntityTooLarge},
+	}
+	for i, test := range tests {
+		rec := httptest.NewRecorder()
+		code, err := d.ServeHTTP(rec, httptest.NewRequest("PUT", "/"+test.name, test.body))
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedCode, code)
+		}
+		_, err = os.Stat(filepath.Join(root, test.name))
+		expectCreated := test.expectedCode == http.StatusCreated
+		if created := err == nil; created != expectCreated {
+			t.Errorf("Test %d: Expected %s to be created to be %v, got %v", i, test.name, expectCreated, created)
+		}
+	}
+}
+
+func TestWebDAVWriteAccess(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", "caddy_webdav_outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "docs", "readme.txt"), []byte("readme"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "docs", "secret.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	d := WebDAV{
+		Configs: []*Config{{Scope: "/dav", Root: root, Locks: NewLockSystem()}},
+		Next:    httpserver.EmptyNext,
+	}
+	tests := []struct {
+		method       string
+		url          string
+		headers      map[string]string
+		user         string
+		expectedCode int
+	}{
+		{"GET", "/dav/docs/readme.txt", nil, "", http.StatusOK},
+		{"PUT", "/dav/anonymous.txt", nil, "", http.StatusForbidden},
+		{"DELETE", "/dav/docs", nil, "", http.StatusForbidden},
+		{"PUT", "/dav/user.txt", nil, "alice", http.StatusCreated},
+		{"DELETE", "/dav/", nil, "alice", http.StatusForbidden},
+		{"DELETE", "/dav", nil, "alice", http.StatusForbidden},
+		{"MOVE", "/dav/", map[string]string{"Destination": "/dav/moved"}, "alice", http.StatusForbidden},
+		{"COPY", "/dav/user.txt", map[string]string{"Destination": "/dav/"}, "alice", http.StatusForbidden},
+		{"GET", "/dav/out/secret.txt", nil, "", http.StatusForbidden},
+		{"GET", "/dav/docs/secret.txt", nil, "", http.StatusForbidden},
+		{"PUT", "/dav/out/new.txt", nil, "alice", http.StatusForbidden},
+		{"COPY", "/dav/out/secret.txt", map[string]string{"Destination": "/dav/stolen.txt"}, "alice", http.StatusForbidden},
+		{"COPY", "/dav/user.txt", map[string]string{"Destination": "/dav/out/planted.txt"}, "alice", http.StatusForbidden},
+		{"COPY", "/dav/docs", map[string]string{"Destination": "/dav/copied"}, "alice", http.StatusCreated},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, strings.NewReader("x"))
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		if test.user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), httpserver.RemoteUserCtxKey, test.user))
+		}
+		rec := httptest.NewRecorder()
+		code, err := d.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Unexpected error: %v", i, err)
+		}
+		if code == 0 {
+			code = rec.Code
+		}
+		if code != test.expectedCode {
+			t.Errorf("Test %d (%s %s): Expected status %d, got %d", i, test.method, test.url, test.expectedCode, code)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "docs", "readme.txt")); err != nil {
+		t.Errorf("Expected the share to be untouched: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "copied", "secret.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected symlinks not to be copied, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "planted.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written outside the share, got %v", err)
+	}
+}
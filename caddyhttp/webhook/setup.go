@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func init() {
+	caddy.RegisterPlugin("webhook", caddy.Plugin{
+		ServerType: "http",
+		Action:     setup,
+	})
+}
+
+// defaultMaxBody is the largest payload accepted by default.
+const defaultMaxBody = 5 << 20
+
+// setup configures a new Webhook middleware instance.
+func setup(c *caddy.Controller) error {
+	rules, err := webhookParse(c)
+	if err != nil {
+		return err
+	}
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return Webhook{Next: next, Rules: rules}
+	})
+
+	return nil
+}
+
+// webhookParse parses
+//
+//	webhook path {
+//		type        github|gitlab|stripe|hmac
+//		secret      key
+//		header      name
+//		allow       networks...
+//		max_body    size
+//		run         command [args...] [&]
+//		timeout     duration
+//		max_running n
+//		rewrite     path
+//		publish
+//	}
+//
+// where the type defaults to github, header is the header of the
+// signature of hmac webhooks, timeout and max_running limit how long
+// and how many of the command run, and at least one of run, rewrite
+// or publish says what to do with them. Deliveries received already
+// are refused, so that they can't be replayed.
+func webhookParse(c *caddy.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		rule := &Rule{Path: args[0], Type: GitHub, Header: DefaultHMACHeader, MaxBody: defaultMaxBody}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "type":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case GitHub, GitLab, Stripe, HMAC:
+					rule.Type = args[0]
+				default:
+					return nil, c.Errf("Unknown webhook type '%s'; must be github, gitlab, stripe or hmac", args[0])
+				}
+			case "secret":
+				if len(args) != 1 || args[0] == "" {
+					return nil, c.ArgErr()
+				}
+				rule.Secret = []byte(args[0])
+			case "header":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				rule.Header = args[0]
+			case "allow":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := httpserver.ParseNetwork(arg)
+					if err != nil {
+						return nil, c.Errf("Invalid network '%s': %v", arg, err)
+					}
+					rule.Allow = append(rule.Allow, network)
+				}
+			case "max_body":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(args[0])
+				if err != nil || size == 0 {
+					return nil, c.Errf("Invalid max_body size '%s'", args[0])
+				}
+				rule.MaxBody = int64(size)
+			case "run":
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				if args[len(args)-1] == "&" {
+					rule.Background = true
+					args = args[:len(args)-1]
+				}
+				command, cmdArgs, err := caddy.SplitCommandAndArgs(strings.Join(args, " "))
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				rule.Command, rule.Args = command, cmdArgs
+				// webhooks come after the servers listen, also in a sandbox
+				caddy.AllowExec()
+			case "timeout":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return nil, c.Errf("Invalid timeout '%s'", args[0])
+				}
+				rule.Timeout = d
+			case "max_running":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return nil, c.Errf("Invalid max_running '%s'", args[0])
+				}
+				rule.MaxRunning = n
+			case "rewrite":
+				if len(args) != 1 || !strings.HasPrefix(args[0], "/") {
+					return nil, c.ArgErr()
+				}
+				rule.Rewrite = args[0]
+			case "publish":
+				if len(args) != 0 {
+					return nil, c.ArgErr()
+				}
+				rule.Publish = true
+			default:
+				return nil, c.Errf("Unknown webhook property '%s'", what)
+			}
+		}
+
+		if rule.Secret == nil {
+			return nil, c.Errf("webhook %s requires a secret", rule.Path)
+		}
+		if rule.Command == "" && rule.Rewrite == "" && !rule.Publish {
+			return nil, c.Errf("webhook %s must run, rewrite or publish", rule.Path)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func TestSetup(t *testing.T) {
+	c := caddy.NewTestController("http", `webhook /hooks/deploy {
+		secret shh
+		publish
+	}`)
+	if err := setup(c); err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	mids := httpserver.GetConfig(c).Middleware()
+	if len(mids) == 0 {
+		t.Fatal("Expected middleware, got 0 instead")
+	}
+	handler := mids[0](httpserver.EmptyNext)
+	myHandler, ok := handler.(Webhook)
+	if !ok {
+		t.Fatalf("Expected handler to be type Webhook, got: %#v", handler)
+	}
+	if !httpserver.SameNext(myHandler.Next, httpserver.EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestWebhookParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		check     func(*Rule) bool
+	}{
+		{`webhook /gh {
+			secret shh
+			publish
+		}`, false, func(r *Rule) bool {
+			return r.Type == GitHub && string(r.Secret) == "shh" && r.Publish && r.MaxBody == defaultMaxBody
+		}},
+		{`webhook /deploy {
+			type stripe
+			secret whsec_1
+			allow 10.0.0.0/8 192.168.1.1
+			max_body 64KB
+			run /usr/local/bin/deploy --now &
+			rewrite /internal/deploy
+		}`, false, func(r *Rule) bool {
+			return r.Type == Stripe && len(r.Allow) == 2 && r.Allow[1].String() == "192.168.1.1/32" &&
+				r.MaxBody == 64000 && r.Command == "/usr/local/bin/deploy" && len(r.Args) == 1 &&
+				r.Background && r.Rewrite == "/internal/deploy"
+		}},
+		{`webhook /h {
+			type hmac
+			header X-Hook-Signature
+			secret shh
+			run deploy
+		}`, false, func(r *Rule) bool {
+			return r.Type == HMAC && r.Header == "X-Hook-Signature" && !r.Background && r.Timeout == 0 && r.MaxRunning == 0
+		}},
+		{`webhook /h {
+			secret shh
+			run deploy
+			timeout 30s
+			max_running 1
+		}`, false, func(r *Rule) bool {
+			return r.Timeout == 30*time.Second && r.MaxRunning == 1
+		}},
+		{`webhook /h {
+			secret shh
+			run deploy
+			timeout forever
+		}`, true, nil},
+		{`webhook /h {
+			secret shh
+			run deploy
+			max_running 0
+		}`, true, nil},
+		{`webhook /h {
+			publish
+		}`, true, nil},
+		{`webhook /h {
+			secret shh
+		}`, true, nil},
+		{`webhook /h {
+			secret shh
+			publish
+			type bitbucket
+		}`, true, nil},
+		{`webhook /h {
+			secret shh
+			publish
+			allow nowhere
+		}`, true, nil},
+		{`webhook /h {
+			secret shh
+			rewrite internal
+		}`, true, nil},
+		{`webhook /h {
+			secret shh
+			publish
+			max_body lots
+		}`, true, nil},
+		{`webhook /h {
+			secret shh
+			publish
+			respond 200
+		}`, true, nil},
+		{`webhook /h /i {
+			secret shh
+			publish
+		}`, true, nil},
+		{`webhook`, true, nil},
+	} {
+		rules, err := webhookParse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if len(rules) != 1 || !test.check(rules[0]) {
+			t.Errorf("Test %d: Rule not as expected: %+v", i, rules[0])
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// Package webhook implements middleware that receives webhooks,
+// such as those of GitHub, GitLab and Stripe: it verifies their
+// signatures and the addresses they come from, then runs a command,
+// rewrites them internally or publishes them as an event, so that
+// common webhook handling doesn't need an application behind Caddy.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// The kinds of signature that webhooks are verified with.
+const (
+	GitHub = "github" // X-Hub-Signature-256, or X-Hub-Signature
+	GitLab = "gitlab" // X-Gitlab-Token
+	Stripe = "stripe" // Stripe-Signature
+	HMAC   = "hmac"   // hex HMAC-SHA256 of the body in Header
+)
+
+// DefaultHMACHeader is the header of the signature of hmac webhooks.
+const DefaultHMACHeader = "X-Signature"
+
+// stripeTolerance is how old a Stripe webhook may be, so that
+// one can't be replayed later.
+const stripeTolerance = 5 * time.Minute
+
+// Command defaults.
+const (
+	DefaultTimeout    = 10 * time.Minute
+	DefaultMaxRunning = 4
+)
+
+// replayWindow is how long deliveries are remembered, so that they
+// can't be replayed, and maxRemembered how many are at most.
+const (
+	replayWindow  = 24 * time.Hour
+	maxRemembered = 10000
+)
+
+// Webhook is middleware that receives webhooks.
+type Webhook struct {
+	Next  httpserver.Handler
+	Rules []*Rule
+}
+
+// Rule is the path that webhooks are received at, how they are
+// verified and what is done with them.
+type Rule struct {
+	Path   string
+	Type   string // GitHub, GitLab, Stripe or HMAC
+	Secret []byte
+	Header string // of the signature, for the HMAC type
+
+	// Allow, if not empty, are the networks from which
+	// webhooks are accepted.
+	Allow []*net.IPNet
+
+	// MaxBody is the largest payload accepted.
+	MaxBody int64
+
+	// Command, if not empty, is run with the payload as its
+	// input and the delivery in the environment; in the
+	// background, if Background is set. It is killed if it
+	// runs longer than Timeout, and no more than MaxRunning
+	// are run at once; if 0, the defaults are used.
+	Command    string
+	Args       []string
+	Background bool
+	Timeout    time.Duration
+	MaxRunning int
+
+	// Rewrite, if not empty, is the path to which webhooks
+	// are rewritten internally, to be handled by the rest
+	// of the site.
+	Rewrite string
+
+	// Publish is whether to emit caddy.WebhookEvent.
+	Publish bool
+
+	init    sync.Once
+	running chan struct{} // a token for each command running
+	seen    *deliveryLog
+}
+
+// Delivery is a verified webhook, the info of caddy.WebhookEvent.
+type Delivery struct {
+	Path    string          `json:"path"`
+	Type    string          `json:"type"`
+	Event   string          `json:"event,omitempty"` // such as "push"
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"` // if it is JSON
+}
+
+// ServeHTTP implements the httpserver.Handler interface.
+func (wh Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range wh.Rules {
+		if httpserver.Path(r.URL.Path).Matches(rule.Path) {
+			return rule.serve(w, r, wh.Next)
+		}
+	}
+	return wh.Next.ServeHTTP(w, r)
+}
+
+// serve receives a webhook, which is then handled by next if the
+// rule rewrites it.
+func (rule *Rule) serve(w http.ResponseWriter, r *http.Request, next httpserver.Handler) (int, error) {
+	if !rule.allowed(r) {
+		return http.StatusForbidden, fmt.Errorf("webhook %s: client %s not allowed", rule.Path, r.RemoteAddr)
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return http.StatusMethodNotAllowed, nil
+	}
+	b, err := httpserver.BufferBody(r, rule.MaxBody+1)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("webhook %s: %v", rule.Path, err)
+	}
+	if b.Size() > rule.MaxBody {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("webhook %s: payload larger than %d bytes", rule.Path, rule.MaxBody)
+	}
+	body, err := b.Bytes()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("webhook %s: %v", rule.Path, err)
+	}
+	now := time.Now()
+	if err := rule.verify(r, body, now); err != nil {
+		return http.StatusUnauthorized, fmt.Errorf("webhook %s: %v", rule.Path, err)
+	}
+	delivery := rule.delivery(r, body)
+	rule.init.Do(rule.setup)
+	key := deliveryKey(body)
+	if !rule.seen.add(key, now) {
+		return http.StatusConflict, fmt.Errorf("webhook %s: delivery %s already received", rule.Path, delivery.ID)
+	}
+
+	if rule.Publish {
+		go caddy.EmitEvent(caddy.WebhookEvent, delivery)
+	}
+	if rule.Command != "" {
+		if err := rule.run(delivery, body); err != nil {
+			// so that it can be delivered again
+			rule.seen.remove(key)
+			if err == errTooManyRunning {
+				w.Header().Set("Retry-After", "60")
+				return http.StatusServiceUnavailable, fmt.Errorf("webhook %s: %v", rule.Path, err)
+			}
+			return http.StatusInternalServerError, fmt.Errorf("webhook %s: %v", rule.Path, err)
+		}
+	}
+	if rule.Rewrite != "" {
+		if err := b.Rewind(); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("webhook %s: %v", rule.Path, err)
+		}
+		r.ContentLength = int64(len(body))
+		r.URL.Path, r.URL.RawPath = rule.Rewrite, ""
+		return next.ServeHTTP(w, r)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return http.StatusNoContent, nil
+}
+
+// allowed returns whether the client of r may deliver webhooks.
+func (rule *Rule) allowed(r *http.Request) bool {
+	if len(rule.Allow) == 0 {
+		return true
+	}
+	host := httpserver.ClientIP(r)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range rule.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify returns an error unless r, with body, is signed with the
+// secret of the rule.
+func (rule *Rule) verify(r *http.Request, body []byte, now time.Time) error {
+	switch rule.Type {
+	case GitHub:
+		if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+			return checkMAC(sha256.New, rule.Secret, body, strings.TrimPrefix(sig, "sha256="))
+		}
+		if sig := r.Header.Get("X-Hub-Signature"); sig != "" {
+			return checkMAC(sha1.New, rule.Secret, body, strings.TrimPrefix(sig, "sha1="))
+		}
+		return errors.New("no signature")
+	case GitLab:
+		token := r.Header.Get("X-Gitlab-Token")
+		if token == "" {
+			return errors.New("no token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), rule.Secret) != 1 {
+			return errors.New("wrong token")
+		}
+		return nil
+	case Stripe:
+		return verifyStripe(r.Header.Get("Stripe-Signature"), rule.Secret, body, now)
+	default:
+		sig := r.Header.Get(rule.Header)
+		if sig == "" {
+			return errors.New("no signature")
+		}
+		return checkMAC(sha256.New, rule.Secret, body, strings.TrimPrefix(sig, "sha256="))
+	}
+}
+
+// verifyStripe verifies the Stripe-Signature header, sig, which has
+// the time the body was signed at and its signatures, as in
+// "t=1492774577,v1=5257a869...".
+func verifyStripe(sig string, secret, body []byte, now time.Time) error {
+	if sig == "" {
+		return errors.New("no signature")
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(sig, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("no signature time")
+	}
+	if age := now.Sub(time.Unix(t, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return fmt.Errorf("signed %s ago, which is too long", age)
+	}
+	signed := append([]byte(timestamp+"."), body...)
+	for _, s := range signatures {
+		if checkMAC(sha256.New, secret, signed, s) == nil {
+			return nil
+		}
+	}
+	return errors.New("wrong signature")
+}
+
+// checkMAC returns an error unless sig is the hex HMAC of body.
+func checkMAC(h func() hash.Hash, secret, body []byte, sig string) error {
+	actual, err := hex.DecodeString(sig)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+	mac := hmac.New(h, secret)
+	mac.Write(body)
+	if !hmac.Equal(actual, mac.Sum(nil)) {
+		return errors.New("wrong signature")
+	}
+	return nil
+}
+
+// delivery describes the webhook r, with body.
+func (rule *Rule) delivery(r *http.Request, body []byte) Delivery {
+	d := Delivery{Path: rule.Path, Type: rule.Type}
+	if json.Valid(body) {
+		d.Payload = body
+	}
+	switch rule.Type {
+	case GitHub:
+		d.Event, d.ID = r.Header.Get("X-GitHub-Event"), r.Header.Get("X-GitHub-Delivery")
+	case GitLab:
+		d.Event, d.ID = r.Header.Get("X-Gitlab-Event"), r.Header.Get("X-Gitlab-Event-UUID")
+	case Stripe:
+		var event struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		}
+		json.Unmarshal(body, &event)
+		d.Event, d.ID = event.Type, event.ID
+	}
+	return d
+}
+
+// setup readies the rule to receive webhooks.
+func (rule *Rule) setup() {
+	max := rule.MaxRunning
+	if max <= 0 {
+		max = DefaultMaxRunning
+	}
+	rule.running = make(chan struct{}, max)
+	rule.seen = &deliveryLog{times: make(map[string]time.Time)}
+}
+
+// errTooManyRunning is the error of running a command while as many
+// as may be already are.
+var errTooManyRunning = errors.New("too many commands running")
+
+// run runs the command of the rule, with the payload as its input.
+func (rule *Rule) run(d Delivery, body []byte) error {
+	select {
+	case rule.running <- struct{}{}:
+	default:
+		return errTooManyRunning
+	}
+	timeout := rule.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	done := func() {
+		cancel()
+		<-rule.running
+	}
+
+	cmd := exec.CommandContext(ctx, rule.Command, rule.Args...)
+	cmd.Env = append(os.Environ(),
+		"CADDY_WEBHOOK_PATH="+d.Path,
+		"CADDY_WEBHOOK_TYPE="+d.Type,
+		"CADDY_WEBHOOK_EVENT="+d.Event,
+		"CADDY_WEBHOOK_ID="+d.ID)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if rule.Background {
+		log.Printf("[INFO] Webhook %s: Nonblocking Command:\"%s %s\"", rule.Path, rule.Command, strings.Join(rule.Args, " "))
+		if err := cmd.Start(); err != nil {
+			done()
+			return err
+		}
+		go func() {
+			if err := cmd.Wait(); err != nil {
+				log.Printf("[ERROR] Webhook %s: %v", rule.Path, err)
+			}
+			done()
+		}()
+		return nil
+	}
+	defer done()
+	log.Printf("[INFO] Webhook %s: Blocking Command:\"%s %s\"", rule.Path, rule.Command, strings.Join(rule.Args, " "))
+	return cmd.Run()
+}
+
+// deliveryKey returns what identifies a delivery with body: the
+// hash of the body, which is what is signed. The delivery ID comes
+// from a header anyone can change, so it can't tell replays apart.
+func deliveryKey(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// deliveryLog remembers the deliveries received in the replay window.
+type deliveryLog struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+	order []string // of the keys of times, oldest first
+}
+
+// add records the delivery with key at now, and returns whether it
+// wasn't received before in the replay window. The oldest deliveries
+// are forgotten first when too many are remembered.
+func (l *deliveryLog) add(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for len(l.order) > 0 && (now.Sub(l.times[l.order[0]]) > replayWindow || len(l.order) >= maxRemembered) {
+		delete(l.times, l.order[0])
+		l.order = l.order[1:]
+	}
+	if _, ok := l.times[key]; ok {
+		return false
+	}
+	l.times[key] = now
+	l.order = append(l.order, key)
+	return true
+}
+
+// remove forgets the delivery with key.
+func (l *deliveryLog) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.times[key]; !ok {
+		return
+	}
+	delete(l.times, key)
+	for i, k := range l.order {
+		if k == key {
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	const body = `{"id":"evt_1","type":"invoice.paid"}`
+	now := time.Unix(1500000000, 0)
+	stamp := strconv.FormatInt(now.Unix(), 10)
+	for i, test := range []struct {
+		typ       string
+		header    http.Header
+		shouldErr bool
+	}{
+		{GitHub, http.Header{"X-Hub-Signature-256": {"sha256=" + sign("shh", body)}}, false},
+		{GitHub, http.Header{"X-Hub-Signature-256": {"sha256=" + sign("other", body)}}, true},
+		{GitHub, http.Header{"X-Hub-Signature-256": {"sha256=zz"}}, true},
+		{GitHub, http.Header{}, true},
+		{GitLab, http.Header{"X-Gitlab-Token": {"shh"}}, false},
+		{GitLab, http.Header{"X-Gitlab-Token": {"sh"}}, true},
+		{Stripe, http.Header{"Stripe-Signature": {"t=" + stamp + ",v1=" + sign("shh", stamp+"."+body)}}, false},
+		{Stripe, http.Header{"Stripe-Signature": {"t=" + stamp + ",v1=00,v1=" + sign("shh", stamp+"."+body)}}, false},
+		{Stripe, http.Header{"Stripe-Signature": {"t=" + stamp + ",v1=" + sign("shh", body)}}, true},
+		{Stripe, http.Header{"Stripe-Signature": {"t=1400000000,v1=" + sign("shh", "1400000000."+body)}}, true},
+		{Stripe, http.Header{"Stripe-Signature": {"v1=" + sign("shh", body)}}, true},
+		{HMAC, http.Header{"X-Signature": {sign("shh", body)}}, false},
+		{HMAC, http.Header{"X-Signature": {"sha256=" + sign("shh", body)}}, false},
+		{HMAC, http.Header{"X-Hub-Signature-256": {sign("shh", body)}}, true},
+	} {
+		rule := &Rule{Type: test.typ, Secret: []byte("shh"), Header: DefaultHMACHeader}
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header = test.header
+		err := rule.verify(r, []byte(body), now)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected an error, got none", i)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	const body = `{"ref":"refs/heads/master"}`
+	_, local, _ := net.ParseCIDR("192.0.2.0/24")
+	var rewritten string
+	wh := Webhook{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			content, _ := ioutil.ReadAll(r.Body)
+			rewritten = r.URL.Path + " " + string(content)
+			return http.StatusOK, nil
+		}),
+		Rules: []*Rule{
+			{Path: "/hooks/publish", Type: GitHub, Secret: []byte("shh"), MaxBody: 1024, Publish: true},
+			{Path: "/hooks/rewrite", Type: GitHub, Secret: []byte("shh"), MaxBody: 1024, Rewrite: "/internal/hook",
+				Allow: []*net.IPNet{local}},
+			{Path: "/hooks/small", Type: GitHub, Secret: []byte("shh"), MaxBody: 4, Publish: true},
+		},
+	}
+
+	deliveries := make(chan interface{}, 1)
+	unsubscribe := caddy.Subscribe(caddy.WebhookEvent, func(info interface{}) error {
+		deliveries <- info
+		return nil
+	})
+	defer unsubscribe()
+
+	for i, test := range []struct {
+		method, path, remoteAddr string
+		signature                string
+		expectStatus             int
+		expectRewrite            string
+	}{
+		{"POST", "/hooks/publish", "203.0.113.1:1234", sign("shh", body), http.StatusNoContent, ""},
+		{"POST", "/hooks/publish", "203.0.113.1:1234", sign("nope", body), http.StatusUnauthorized, ""},
+		{"GET", "/hooks/publish", "203.0.113.1:1234", sign("shh", body), http.StatusMethodNotAllowed, ""},
+		{"POST", "/hooks/rewrite", "192.0.2.7:1234", sign("shh", body), http.StatusOK, "/internal/hook " + body},
+		{"POST", "/hooks/rewrite", "203.0.113.1:1234", sign("shh", body), http.StatusForbidden, ""},
+		{"POST", "/hooks/small", "203.0.113.1:1234", sign("shh", body), http.StatusRequestEntityTooLarge, ""},
+		{"POST", "/other", "203.0.113.1:1234", "", http.StatusOK, "/other " + body},
+	} {
+		rewritten = ""
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(body))
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set("X-Hub-Signature-256", "sha256="+test.signature)
+		r.Header.Set("X-GitHub-Event", "push")
+		r.Header.Set("X-GitHub-Delivery", "72d3162e")
+		w := httptest.NewRecorder()
+		status, _ := wh.ServeHTTP(w, r)
+		if status != test.expectStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectStatus, status)
+		}
+		if rewritten != test.expectRewrite {
+			t.Errorf("Test %d: Expected '%s' to be handled next, got '%s'", i, test.expectRewrite, rewritten)
+		}
+	}
+
+	select {
+	case info := <-deliveries:
+		d, ok := info.(Delivery)
+		if !ok || d.Path != "/hooks/publish" || d.Event != "push" || d.ID != "72d3162e" || string(d.Payload) != body {
+			t.Errorf("Expected the delivery of a push to be published, got %+v", info)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected a delivery to be published, got none")
+	}
+}
+
+func TestWebhookRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs sh")
+	}
+	const body = "hello"
+	wh := Webhook{
+		Next: httpserver.EmptyNext,
+		Rules: []*Rule{
+			{Path: "/ok", Type: GitLab, Secret: []byte("shh"), MaxBody: 1024,
+				Command: "sh", Args: []string{"-c", `test "$(cat)" = hello && test "$CADDY_WEBHOOK_EVENT" = "Push Hook"`}},
+			{Path: "/fail", Type: GitLab, Secret: []byte("shh"), MaxBody: 1024, Command: "sh", Args: []string{"-c", "exit 1"}},
+		},
+	}
+	for path, expectStatus := range map[string]int{"/ok": http.StatusNoContent, "/fail": http.StatusInternalServerError} {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("X-Gitlab-Token", "shh")
+		r.Header.Set("X-Gitlab-Event", "Push Hook")
+		if status, _ := wh.ServeHTTP(httptest.NewRecorder(), r); status != expectStatus {
+			t.Errorf("%s: Expected status %d, got %d", path, expectStatus, status)
+		}
+	}
+}
+
+func TestWebhookRunLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs sh")
+	}
+	slow := &Rule{Path: "/slow", Type: GitLab, Secret: []byte("shh"), MaxBody: 1024,
+		Command: "sh", Args: []string{"-c", "exec sleep 5"}, Timeout: 50 * time.Millisecond}
+	busy := &Rule{Path: "/busy", Type: GitLab, Secret: []byte("shh"), MaxBody: 1024,
+		Command: "sh", Args: []string{"-c", "exec sleep 5"}, Background: true, MaxRunning: 1, Timeout: 200 * time.Millisecond}
+	wh := Webhook{Next: httpserver.EmptyNext, Rules: []*Rule{slow, busy}}
+	deliver := func(path, id, body string) int {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("X-Gitlab-Token", "shh")
+		r.Header.Set("X-Gitlab-Event-UUID", id)
+		status, _ := wh.ServeHTTP(httptest.NewRecorder(), r)
+		return status
+	}
+
+	start := time.Now()
+	if status := deliver("/slow", "1", "hello 1"); status != http.StatusInternalServerError {
+		t.Errorf("Expected a command that runs too long to fail, got status %d", status)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the command to be killed after its timeout, took %v", elapsed)
+	}
+	// it failed, so it can be delivered again
+	if status := deliver("/slow", "1", "hello 1"); status == http.StatusConflict {
+		t.Error("Expected a failed delivery to be accepted again")
+	}
+
+	if status := deliver("/busy", "1", "hello 1"); status != http.StatusNoContent {
+		t.Errorf("Expected the first command to run, got status %d", status)
+	}
+	if status := deliver("/busy", "2", "hello 2"); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected no more than one command to run at once, got status %d", status)
+	}
+	if status := deliver("/busy", "1", "hello 1"); status != http.StatusConflict {
+		t.Errorf("Expected a delivery received already to be refused, got status %d", status)
+	}
+	// the same payload under another delivery ID is still a replay
+	if status := deliver("/busy", "4", "hello 1"); status != http.StatusConflict {
+		t.Errorf("Expected a payload received already to be refused, got status %d", status)
+	}
+	// once the background command is killed, another may run
+	time.Sleep(500 * time.Millisecond)
+	if status := deliver("/busy", "3", "hello 3"); status != http.StatusNoContent {
+		t.Errorf("Expected a command to run after the last one was killed, got status %d", status)
+	}
+	time.Sleep(300 * time.Millisecond)
+}
+
+func TestDeliveryLog(t *testing.T) {
+	l := &deliveryLog{times: make(map[string]time.Time)}
+	now := time.Now()
+	if !l.add("a", now) || l.add("a", now.Add(time.Hour)) {
+		t.Error("Expected a delivery to be accepted once")
+	}
+	if !l.add("a", now.Add(replayWindow+time.Minute)) {
+		t.Error("Expected a delivery to be forgotten after the replay window")
+	}
+	for i := 0; i < maxRemembered+10; i++ {
+		l.add(strconv.Itoa(i), now)
+	}
+	if len(l.times) > maxRemembered || len(l.order) != len(l.times) {
+		t.Errorf("Expected no more than %d deliveries to be remembered, got %d", maxRemembered, len(l.times))
+	}
+}
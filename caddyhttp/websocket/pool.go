@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// process is a running command of an endpoint.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+// startProcess starts the command of config for r, with the
+// meta-variables of r in its environment. Without r, as for
+// processes of a pool, only those that don't depend on requests
+// are.
+func startProcess(config *Config, r *http.Request) (*process, error) {
+	cmd := exec.Command(config.Command, config.Arguments...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+
+	var metavars []string
+	if r != nil {
+		metavars, err = buildEnv(cmd.Path, r)
+		if err != nil {
+			stdout.Close()
+			stdin.Close()
+			return nil, err
+		}
+		replacer := httpserver.NewReplacer(r, nil, "")
+		for _, envVar := range config.EnvVars {
+			metavars = append(metavars, envVar[0]+"="+replacer.Replace(envVar[1]))
+		}
+	} else {
+		metavars = []string{
+			`GATEWAY_INTERFACE=` + GatewayInterface,
+			`SCRIPT_NAME=` + cmd.Path,
+			`SERVER_SOFTWARE=` + ServerSoftware,
+		}
+		for _, envVar := range config.EnvVars {
+			metavars = append(metavars, envVar[0]+"="+envVar[1])
+		}
+	}
+	cmd.Env = metavars
+
+	if err := cmd.Start(); err != nil {
+		stdout.Close()
+		stdin.Close()
+		return nil, err
+	}
+	return &process{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+// kill ends a process that served no connection.
+func (p *process) kill() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+// pool keeps processes of an endpoint started ahead of the
+// connections they serve, so connections need not wait for them.
+// Each process serves one connection, and is replaced by another.
+type pool struct {
+	config Config
+	procs  chan *process
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// newPool returns a pool of processes of config, of its PoolSize.
+func newPool(config Config) *pool {
+	return &pool{
+		config: config,
+		procs:  make(chan *process, config.PoolSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start starts filling the pool.
+func (p *pool) Start() error {
+	go p.fill()
+	return nil
+}
+
+// Stop stops filling the pool and ends the processes in it.
+func (p *pool) Stop() error {
+	close(p.stop)
+	<-p.done
+	for {
+		select {
+		case proc := <-p.procs:
+			proc.kill()
+		default:
+			return nil
+		}
+	}
+}
+
+// fill starts processes while the pool has room for them, until
+// the pool is stopped.
+func (p *pool) fill() {
+	defer close(p.done)
+	for {
+		proc, err := startProcess(&p.config, nil)
+		if err != nil {
+			log.Printf("[ERROR] websocket %s: starting %s: %v", p.config.Path, p.config.Command, err)
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-p.stop:
+				return
+			}
+		}
+		select {
+		case p.procs <- proc:
+		case <-p.stop:
+			proc.kill()
+			return
+		}
+	}
+}
+
+// get returns a process of the pool, or a new one if the pool is
+// empty.
+func (p *pool) get() (*process, error) {
+	select {
+	case proc := <-p.procs:
+		return proc, nil
+	default:
+		return startProcess(&p.config, nil)
+	}
+}
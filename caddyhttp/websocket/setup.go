@@ -1,6 +1,10 @@
 package websocket
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
@@ -22,6 +26,18 @@ func setup(c *caddy.Controller) error {
 	GatewayInterface = caddy.AppName + "-CGI/1.1"
 	ServerSoftware = caddy.AppName + "/" + caddy.AppVersion
 
+	// commands are run for each connection, also in a sandbox
+	caddy.AllowExec()
+
+	for i := range websocks {
+		if websocks[i].PoolSize > 0 {
+			p := newPool(websocks[i])
+			websocks[i].pool = p
+			c.OnStartup(p.Start)
+			c.OnShutdown(p.Stop)
+		}
+	}
+
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
 		return WebSocket{Next: next, Sockets: websocks}
 	})
@@ -29,24 +45,22 @@ func setup(c *caddy.Controller) error {
 	return nil
 }
 
+// webSocketParse parses the websocket directives, which are
+//
+//	websocket [path] command {
+//		respawn
+//		framing line|binary
+//		env name value
+//		pool size
+//		idle_timeout duration
+//		max_lifetime duration
+//	}
 func webSocketParse(c *caddy.Controller) ([]Config, error) {
 	var websocks []Config
-	var respawn bool
-
-	optionalBlock := func() (hadBlock bool, err error) {
-		for c.NextBlock() {
-			hadBlock = true
-			if c.Val() == "respawn" {
-				respawn = true
-			} else {
-				return true, c.Err("Expected websocket configuration parameter in block")
-			}
-		}
-		return
-	}
 
 	for c.Next() {
 		var val, path, command string
+		var config Config
 
 		// Path or command; not sure which yet
 		if !c.NextArg() {
@@ -55,7 +69,7 @@ func webSocketParse(c *caddy.Controller) ([]Config, error) {
 		val = c.Val()
 
 		// Extra configuration may be in a block
-		hadBlock, err := optionalBlock()
+		hadBlock, err := parseBlock(c, &config)
 		if err != nil {
 			return nil, err
 		}
@@ -71,7 +85,7 @@ func webSocketParse(c *caddy.Controller) ([]Config, error) {
 			}
 
 			// Okay, check again for optional block
-			_, err = optionalBlock()
+			_, err = parseBlock(c, &config)
 			if err != nil {
 				return nil, err
 			}
@@ -83,14 +97,73 @@ func webSocketParse(c *caddy.Controller) ([]Config, error) {
 			return nil, err
 		}
 
-		websocks = append(websocks, Config{
-			Path:      path,
-			Command:   cmd,
-			Arguments: args,
-			Respawn:   respawn, // TODO: This isn't used currently
-		})
+		config.Path = path
+		config.Command = cmd
+		config.Arguments = args
+		websocks = append(websocks, config)
 	}
 
 	return websocks, nil
 
 }
+
+// parseBlock parses the optional block of a websocket directive into
+// config, and returns whether there was one.
+func parseBlock(c *caddy.Controller, config *Config) (hadBlock bool, err error) {
+	for c.NextBlock() {
+		hadBlock = true
+		switch c.Val() {
+		case "respawn":
+			config.Respawn = true // TODO: This isn't used currently
+		case "framing":
+			if !c.NextArg() {
+				return true, c.ArgErr()
+			}
+			switch c.Val() {
+			case FramingLine, FramingBinary:
+				config.Framing = c.Val()
+			default:
+				return true, c.Errf("Unknown websocket framing '%s'", c.Val())
+			}
+		case "env":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return true, c.ArgErr()
+			}
+			config.EnvVars = append(config.EnvVars, [2]string{args[0], args[1]})
+		case "pool":
+			if !c.NextArg() {
+				return true, c.ArgErr()
+			}
+			size, err := strconv.Atoi(c.Val())
+			if err != nil || size < 1 {
+				return true, c.Errf("Invalid websocket pool size '%s'", c.Val())
+			}
+			config.PoolSize = size
+		case "idle_timeout", "max_lifetime":
+			name := c.Val()
+			if !c.NextArg() {
+				return true, c.ArgErr()
+			}
+			d, err := time.ParseDuration(c.Val())
+			if err != nil || d <= 0 {
+				return true, c.Errf("Invalid websocket %s '%s'", name, c.Val())
+			}
+			if name == "idle_timeout" {
+				config.IdleTimeout = d
+			} else {
+				config.MaxLifetime = d
+			}
+		default:
+			return true, c.Err("Expected websocket configuration parameter in block")
+		}
+	}
+	if config.PoolSize > 0 {
+		for _, envVar := range config.EnvVars {
+			if strings.Contains(envVar[1], "{") {
+				return true, c.Errf("websocket env %s: placeholders can't be used with a pool, whose processes start before requests", envVar[0])
+			}
+		}
+	}
+	return hadBlock, nil
+}
@@ -1,7 +1,9 @@
 package websocket
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
@@ -71,6 +73,47 @@ func TestWebSocketParse(t *testing.T) {
 		{`websocket /api7 cat {
 			invalid
 		}`, true, []Config{}},
+
+		{`websocket /api8 cat {
+			framing binary
+			env USER {>X-User}
+			idle_timeout 30s
+			max_lifetime 1h
+		}`, false, []Config{{
+			Path:        "/api8",
+			Command:     "cat",
+			Framing:     FramingBinary,
+			EnvVars:     [][2]string{{"USER", "{>X-User}"}},
+			IdleTimeout: 30 * time.Second,
+			MaxLifetime: time.Hour,
+		}}},
+
+		{`websocket /api9 cat {
+			pool 4
+			env MODE pooled
+		}`, false, []Config{{
+			Path:     "/api9",
+			Command:  "cat",
+			PoolSize: 4,
+			EnvVars:  [][2]string{{"MODE", "pooled"}},
+		}}},
+
+		{`websocket /api10 cat {
+			framing text
+		}`, true, []Config{}},
+		{`websocket /api11 cat {
+			pool 0
+		}`, true, []Config{}},
+		{`websocket /api12 cat {
+			idle_timeout forever
+		}`, true, []Config{}},
+		{`websocket /api13 cat {
+			env USER
+		}`, true, []Config{}},
+		{`websocket /api14 cat {
+			pool 2
+			env USER {>X-User}
+		}`, true, []Config{}},
 	}
 	for i, test := range tests {
 		c := caddy.NewTestController("http", test.inputWebSocketConfig)
@@ -97,6 +140,13 @@ func TestWebSocketParse(t *testing.T) {
 					i, j, test.expectedWebSocketConfig[j].Command, actualWebSocketConfig.Command)
 			}
 
+			want := test.expectedWebSocketConfig[j]
+			if actualWebSocketConfig.Framing != want.Framing || actualWebSocketConfig.PoolSize != want.PoolSize ||
+				actualWebSocketConfig.IdleTimeout != want.IdleTimeout || actualWebSocketConfig.MaxLifetime != want.MaxLifetime ||
+				!reflect.DeepEqual(actualWebSocketConfig.EnvVars, want.EnvVars) {
+				t.Errorf("Test %d expected %dth WebSocket Config to be %+v, but got %+v", i, j, want, actualWebSocketConfig)
+			}
+
 		}
 	}
 
@@ -10,7 +10,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -30,6 +29,20 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 1024 * 1024 * 10 // 10 MB default.
+
+	// Size of the chunks of output sent as binary messages.
+	chunkSize = 32 * 1024
+)
+
+// Framings of messages.
+const (
+	// FramingLine sends each line of output as a text message and
+	// writes each message received, followed by a newline, as input.
+	FramingLine = "line"
+
+	// FramingBinary sends output as binary messages as it is read
+	// and writes messages received as input as they are.
+	FramingBinary = "binary"
 )
 
 var (
@@ -61,6 +74,26 @@ type (
 		Command   string
 		Arguments []string
 		Respawn   bool // TODO: Not used, but parser supports it until we decide on it
+
+		// Framing is how messages map to the input and output of
+		// the command: FramingLine, the default, or FramingBinary.
+		Framing string
+
+		// EnvVars are added to the environment of the command, with
+		// placeholders in values replaced for the request.
+		EnvVars [][2]string
+
+		// PoolSize is the number of processes started ahead of the
+		// connections they serve, if not zero.
+		PoolSize int
+
+		// IdleTimeout closes connections with no messages either
+		// way for this long, and MaxLifetime closes connections
+		// open this long, if not zero.
+		IdleTimeout time.Duration
+		MaxLifetime time.Duration
+
+		pool *pool
 	}
 )
 
@@ -77,7 +110,8 @@ func (ws WebSocket) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, erro
 }
 
 // serveWS is used for setting and upgrading the HTTP connection to a websocket connection.
-// It also spawns the child process that is associated with matched HTTP path/url.
+// It also spawns the child process that is associated with matched HTTP path/url,
+// or takes one from the pool of the endpoint.
 func serveWS(w http.ResponseWriter, r *http.Request, config *Config) (int, error) {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
@@ -90,38 +124,29 @@ func serveWS(w http.ResponseWriter, r *http.Request, config *Config) (int, error
 	}
 	defer conn.Close()
 
-	cmd := exec.Command(config.Command, config.Arguments...)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return http.StatusBadGateway, err
+	var proc *process
+	if config.pool != nil {
+		proc, err = config.pool.get()
+	} else {
+		proc, err = startProcess(config, r)
 	}
-	defer stdout.Close()
-
-	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return http.StatusBadGateway, err
 	}
-	defer stdin.Close()
+	defer proc.stdout.Close()
+	defer proc.stdin.Close()
 
-	metavars, err := buildEnv(cmd.Path, r)
-	if err != nil {
-		return http.StatusBadGateway, err
-	}
-
-	cmd.Env = metavars
-
-	if err := cmd.Start(); err != nil {
-		return http.StatusBadGateway, err
-	}
+	activity := make(chan struct{}, 1)
+	stopLimits := enforceLimits(conn, config, activity)
+	defer stopLimits()
 
 	done := make(chan struct{})
-	go pumpStdout(conn, stdout, done)
-	pumpStdin(conn, stdin)
+	go pumpStdout(conn, proc.stdout, done, config.Framing, activity)
+	pumpStdin(conn, proc.stdin, config.Framing, activity)
 
-	stdin.Close() // close stdin to end the process
+	proc.stdin.Close() // close stdin to end the process
 
-	if err := cmd.Process.Signal(os.Interrupt); err != nil { // signal an interrupt to kill the process
+	if err := proc.cmd.Process.Signal(os.Interrupt); err != nil { // signal an interrupt to kill the process
 		return http.StatusInternalServerError, err
 	}
 
@@ -129,7 +154,7 @@ func serveWS(w http.ResponseWriter, r *http.Request, config *Config) (int, error
 	case <-done:
 	case <-time.After(time.Second):
 		// terminate with extreme prejudice.
-		if err := cmd.Process.Signal(os.Kill); err != nil {
+		if err := proc.cmd.Process.Signal(os.Kill); err != nil {
 			return http.StatusInternalServerError, err
 		}
 		<-done
@@ -139,11 +164,70 @@ func serveWS(w http.ResponseWriter, r *http.Request, config *Config) (int, error
 	// status for an "exited" process is greater
 	// than 0, but isn't really an error per se.
 	// just going to ignore it for now.
-	cmd.Wait()
+	proc.cmd.Wait()
 
 	return 0, nil
 }
 
+// enforceLimits closes conn once it has had no activity for the idle
+// timeout of config, or has been open for its maximum lifetime. The
+// returned function stops enforcing them.
+func enforceLimits(conn *websocket.Conn, config *Config, activity <-chan struct{}) func() {
+	if config.IdleTimeout == 0 && config.MaxLifetime == 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		var idle, lifetime <-chan time.Time
+		var idleTimer *time.Timer
+		if config.IdleTimeout > 0 {
+			idleTimer = time.NewTimer(config.IdleTimeout)
+			defer idleTimer.Stop()
+			idle = idleTimer.C
+		}
+		if config.MaxLifetime > 0 {
+			lifetimeTimer := time.NewTimer(config.MaxLifetime)
+			defer lifetimeTimer.Stop()
+			lifetime = lifetimeTimer.C
+		}
+		for {
+			select {
+			case <-activity:
+				if idleTimer != nil {
+					if !idleTimer.Stop() {
+						<-idleTimer.C
+					}
+					idleTimer.Reset(config.IdleTimeout)
+				}
+			case <-idle:
+				closeConn(conn, "idle timeout")
+				return
+			case <-lifetime:
+				closeConn(conn, "maximum lifetime reached")
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// closeConn closes conn, telling the peer why.
+func closeConn(conn *websocket.Conn, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason), time.Now().Add(writeWait))
+	conn.Close()
+}
+
+// active notes activity on a connection, without waiting for it to
+// be taken in.
+func active(activity chan<- struct{}) {
+	select {
+	case activity <- struct{}{}:
+	default:
+	}
+}
+
 // buildEnv creates the meta-variables for the child process according
 // to the CGI 1.1 specification: http://tools.ietf.org/html/rfc3875#section-4.1
 // cmdPath should be the path of the command being run.
@@ -201,7 +285,7 @@ func buildEnv(cmdPath string, r *http.Request) (metavars []string, err error) {
 
 // pumpStdin handles reading data from the websocket connection and writing
 // it to stdin of the process.
-func pumpStdin(conn *websocket.Conn, stdin io.WriteCloser) {
+func pumpStdin(conn *websocket.Conn, stdin io.WriteCloser, framing string, activity chan<- struct{}) {
 	// Setup our connection's websocket ping/pong handlers from our const values.
 	defer conn.Close()
 	conn.SetReadLimit(maxMessageSize)
@@ -212,7 +296,10 @@ func pumpStdin(conn *websocket.Conn, stdin io.WriteCloser) {
 		if err != nil {
 			break
 		}
-		message = append(message, '\n')
+		active(activity)
+		if framing != FramingBinary {
+			message = append(message, '\n')
+		}
 		if _, err := stdin.Write(message); err != nil {
 			break
 		}
@@ -221,22 +308,57 @@ func pumpStdin(conn *websocket.Conn, stdin io.WriteCloser) {
 
 // pumpStdout handles reading data from stdout of the process and writing
 // it to websocket connection.
-func pumpStdout(conn *websocket.Conn, stdout io.Reader, done chan struct{}) {
+func pumpStdout(conn *websocket.Conn, stdout io.Reader, done chan struct{}, framing string, activity chan<- struct{}) {
 	go pinger(conn, done)
 	defer func() {
 		conn.Close()
 		close(done) // make sure to close the pinger when we are done.
 	}()
 
+	var err error
+	if framing == FramingBinary {
+		err = pumpChunks(conn, stdout, activity)
+	} else {
+		err = pumpLines(conn, stdout, activity)
+	}
+	if err != nil {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, err.Error()), time.Time{})
+	}
+}
+
+// pumpLines sends each line read from stdout as a text message. It
+// returns an error if stdout could not be read.
+func pumpLines(conn *websocket.Conn, stdout io.Reader, activity chan<- struct{}) error {
 	s := bufio.NewScanner(stdout)
 	for s.Scan() {
+		active(activity)
 		conn.SetWriteDeadline(time.Now().Add(writeWait))
 		if err := conn.WriteMessage(websocket.TextMessage, bytes.TrimSpace(s.Bytes())); err != nil {
-			break
+			return nil
 		}
 	}
-	if s.Err() != nil {
-		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, s.Err().Error()), time.Time{})
+	return s.Err()
+}
+
+// pumpChunks sends what is read from stdout as binary messages, as it
+// is read. It returns an error if stdout could not be read.
+func pumpChunks(conn *websocket.Conn, stdout io.Reader, activity chan<- struct{}) error {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			active(activity)
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
 }
 
@@ -2,7 +2,14 @@ package websocket
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
 )
 
 func TestBuildEnv(t *testing.T) {
@@ -20,3 +27,80 @@ func TestBuildEnv(t *testing.T) {
 		t.Fatalf("Expected non-empty environment; got %#v", env)
 	}
 }
+
+func TestWebSocketServe(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is not available")
+	}
+
+	for i, test := range []struct {
+		config      Config
+		messageType int
+		send        string
+		expect      string
+	}{
+		{Config{Path: "/", Command: "cat"}, websocket.TextMessage, "hello", "hello"},
+		{Config{Path: "/", Command: "cat", Framing: FramingBinary}, websocket.BinaryMessage, "\x00\x01raw", "\x00\x01raw"},
+		{Config{Path: "/", Command: "cat", PoolSize: 1}, websocket.TextMessage, "pooled", "pooled"},
+	} {
+		config := test.config
+		if config.PoolSize > 0 {
+			config.pool = newPool(config)
+			config.pool.Start()
+		}
+		conn, stop := dial(t, config)
+
+		if err := conn.WriteMessage(test.messageType, []byte(test.send)); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if messageType != test.messageType || string(message) != test.expect {
+			t.Errorf("Test %d: expected message %d %q, got %d %q", i, test.messageType, test.expect, messageType, message)
+		}
+
+		stop()
+		if config.pool != nil {
+			config.pool.Stop()
+		}
+	}
+}
+
+func TestWebSocketIdleTimeout(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is not available")
+	}
+
+	conn, stop := dial(t, Config{Path: "/", Command: "cat", IdleTimeout: 50 * time.Millisecond})
+	defer stop()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("Expected the connection to be closed when idle, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "idle timeout") {
+		t.Errorf("Expected the reason to be the idle timeout, got %v", err)
+	}
+}
+
+// dial serves config and returns a connection to it, and a function
+// that closes both.
+func dial(t *testing.T, config Config) (*websocket.Conn, func()) {
+	ws := WebSocket{Sockets: []Config{config}, Next: httpserver.EmptyNext}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeHTTP(w, r)
+	}))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Close()
+	}
+}
@@ -44,6 +44,27 @@ type Certificate struct {
 	Config *Config
 }
 
+// CachedCertificates returns the certificates in the in-memory
+// cache, each one only once even if it serves several names.
+func CachedCertificates() []Certificate {
+	certCacheMu.RLock()
+	defer certCacheMu.RUnlock()
+	seen := make(map[string]struct{})
+	var certs []Certificate
+	for _, cert := range certCache {
+		if len(cert.Certificate.Certificate) == 0 {
+			continue
+		}
+		leaf := string(cert.Certificate.Certificate[0])
+		if _, ok := seen[leaf]; ok {
+			continue
+		}
+		seen[leaf] = struct{}{}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
 // getCertificate gets a certificate that matches name (a server name)
 // from the in-memory cache. If there is no exact match for name, it
 // will be checked against names of the form '*.example.com' (wildcard
@@ -5,9 +5,10 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
-
 	"net/url"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/codahale/aesnicheck"
 	"github.com/mholt/caddy"
@@ -110,6 +111,11 @@ type Config struct {
 	// so implementors are encouraged to cache any heavy instantiations.
 	StorageProvider string
 
+	// StoragePath, if not empty, is the assets path under which
+	// file storage keeps the assets, in place of that of the
+	// process; tenants keep theirs apart this way.
+	StoragePath string
+
 	// The state needed to operate on-demand TLS
 	OnDemandState OnDemandState
 
@@ -169,7 +175,11 @@ func (c *Config) ObtainCert(name string, allowPrompts bool) error {
 	if err != nil {
 		return err
 	}
-	return client.Obtain(name)
+	if err := client.Obtain(name); err != nil {
+		return err
+	}
+	c.emitCertObtained(name)
+	return nil
 }
 
 // RenewCert renews the certificate for name using c. It stows the
@@ -179,7 +189,42 @@ func (c *Config) RenewCert(name string, allowPrompts bool) error {
 	if err != nil {
 		return err
 	}
-	return client.Renew(name)
+	if err := client.Renew(name); err != nil {
+		return err
+	}
+	c.emitCertObtained(name)
+	return nil
+}
+
+// CertificateEvent is the info of certificate events.
+type CertificateEvent struct {
+	Names    []string  `json:"names"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// newCertificateEvent returns the event info describing cert.
+func newCertificateEvent(cert Certificate) CertificateEvent {
+	info := CertificateEvent{NotAfter: cert.NotAfter}
+	for _, name := range cert.Names {
+		if name != "" { // the key of the default certificate
+			info.Names = append(info.Names, name)
+		}
+	}
+	return info
+}
+
+// emitCertObtained emits the event for the certificate for
+// name having been obtained and stored.
+func (c *Config) emitCertObtained(name string) {
+	info := CertificateEvent{Names: []string{name}}
+	if storage, err := c.StorageFor(c.CAUrl); err == nil {
+		if site, err := storage.LoadSite(name); err == nil {
+			if cert, err := makeCertificate(site.Cert, site.Key); err == nil {
+				info = newCertificateEvent(cert)
+			}
+		}
+	}
+	caddy.EmitEvent(caddy.CertObtainedEvent, info)
 }
 
 // StorageFor obtains a TLS Storage instance for the given CA URL which should
@@ -217,6 +262,10 @@ func (c *Config) StorageFor(caURL string) (Storage, error) {
 		c.StorageProvider = "file"
 	}
 
+	if c.StorageProvider == "file" && c.StoragePath != "" {
+		return newFileStorage(filepath.Join(c.StoragePath, "acme"), u), nil
+	}
+
 	creator, ok := storageProviders[c.StorageProvider]
 	if !ok {
 		return nil, fmt.Errorf("%s: Unknown storage: %v", caURL, c.StorageProvider)
@@ -26,7 +26,6 @@ import (
 
 	"golang.org/x/crypto/ocsp"
 
-	"github.com/mholt/caddy"
 	"github.com/xenolf/lego/acme"
 )
 
@@ -95,7 +94,7 @@ func stapleOCSP(cert *Certificate, pemBundle []byte) error {
 		ocspFileNamePrefix = cert.Names[0] + "-"
 	}
 	ocspFileName := ocspFileNamePrefix + fastHash(pemBundle)
-	ocspCachePath := filepath.Join(ocspFolder, ocspFileName)
+	ocspCachePath := filepath.Join(ocspFolder(), ocspFileName)
 	cachedOCSP, err := ioutil.ReadFile(ocspCachePath)
 	if err == nil {
 		resp, err := ocsp.ParseResponse(cachedOCSP, nil)
@@ -140,7 +139,7 @@ func stapleOCSP(cert *Certificate, pemBundle []byte) error {
 		cert.Certificate.OCSPStaple = ocspBytes
 		cert.OCSP = ocspResp
 		if gotNewOCSP {
-			err := os.MkdirAll(filepath.Join(caddy.AssetsPath(), "ocsp"), 0700)
+			err := os.MkdirAll(ocspFolder(), 0700)
 			if err != nil {
 				return fmt.Errorf("unable to make OCSP staple path for %v: %v", cert.Names, err)
 			}
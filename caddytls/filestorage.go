@@ -18,17 +18,29 @@ func init() {
 }
 
 // storageBasePath is the root path in which all TLS/ACME assets are
-// stored. Do not change this value during the lifetime of the program.
-var storageBasePath = filepath.Join(caddy.AssetsPath(), "acme")
+// stored; if empty, it is the acme folder of the assets path, which
+// changes if the process is confined to a chroot. Do not change this
+// value during the lifetime of the program.
+var storageBasePath string
 
 // NewFileStorage is a StorageConstructor function that creates a new
 // Storage instance backed by the local disk. The resulting Storage
 // instance is guaranteed to be non-nil if there is no error.
 func NewFileStorage(caURL *url.URL) (Storage, error) {
+	basePath := storageBasePath
+	if basePath == "" {
+		basePath = filepath.Join(caddy.AssetsPath(), "acme")
+	}
+	return newFileStorage(basePath, caURL), nil
+}
+
+// newFileStorage returns file storage for the CA at caURL, in the
+// folder basePath.
+func newFileStorage(basePath string, caURL *url.URL) *FileStorage {
 	return &FileStorage{
-		Path:      filepath.Join(storageBasePath, caURL.Host),
+		Path:      filepath.Join(basePath, caURL.Host),
 		nameLocks: make(map[string]*sync.WaitGroup),
-	}, nil
+	}
 }
 
 // FileStorage facilitates forming file paths derived from a root
@@ -83,6 +83,11 @@ func (cg configGroup) GetConfigForClient(clientHello *tls.ClientHelloInfo) (*tls
 // This method is safe for use as a tls.Config.GetCertificate callback.
 func (cfg *Config) GetCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	cert, err := cfg.getCertDuringHandshake(strings.ToLower(clientHello.ServerName), true, true)
+	if err != nil {
+		handshakesTotal.Inc("error")
+	} else {
+		handshakesTotal.Inc("ok")
+	}
 	return &cert.Certificate, err
 }
 
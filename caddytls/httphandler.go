@@ -10,14 +10,16 @@ import (
 	"strings"
 )
 
-const challengeBasePath = "/.well-known/acme-challenge"
+// HTTPChallengePath is the path under which the tokens of ACME
+// HTTP challenges are requested.
+const HTTPChallengePath = "/.well-known/acme-challenge"
 
 // HTTPChallengeHandler proxies challenge requests to ACME client if the
-// request path starts with challengeBasePath. It returns true if it
+// request path starts with HTTPChallengePath. It returns true if it
 // handled the request and no more needs to be done; it returns false
 // if this call was a no-op and the request still needs handling.
 func HTTPChallengeHandler(w http.ResponseWriter, r *http.Request, listenHost, altPort string) bool {
-	if !strings.HasPrefix(r.URL.Path, challengeBasePath) {
+	if !strings.HasPrefix(r.URL.Path, HTTPChallengePath) {
 		return false
 	}
 	if DisableHTTPChallenge {
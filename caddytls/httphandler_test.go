@@ -32,7 +32,7 @@ func TestHTTPChallengeHandlerNoOp(t *testing.T) {
 }
 
 func TestHTTPChallengeHandlerSuccess(t *testing.T) {
-	expectedPath := challengeBasePath + "/asdf"
+	expectedPath := HTTPChallengePath + "/asdf"
 
 	// Set up fake acme handler backend to make sure proxying succeeds
 	var proxySuccess bool
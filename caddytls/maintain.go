@@ -116,6 +116,8 @@ func RenewManagedCertificates(allowPrompts bool) (err error) {
 
 	// Perform renewals that are queued
 	for _, cert := range renewQueue {
+		caddy.EmitEvent(caddy.CertExpiringEvent, newCertificateEvent(cert))
+
 		// Get the name which we should use to renew this certificate;
 		// we only support managing certificates with one name per cert,
 		// so this should be easy. We can't rely on cert.Config.Hostname
@@ -276,7 +278,7 @@ func UpdateOCSPStaples() {
 // DeleteOldStapleFiles deletes cached OCSP staples that have expired.
 // TODO: Should we do this for certificates too?
 func DeleteOldStapleFiles() {
-	files, err := ioutil.ReadDir(ocspFolder)
+	files, err := ioutil.ReadDir(ocspFolder())
 	if err != nil {
 		// maybe just hasn't been created yet; no big deal
 		return
@@ -286,7 +288,7 @@ func DeleteOldStapleFiles() {
 			// weird, what's a folder doing inside the OCSP cache?
 			continue
 		}
-		stapleFile := filepath.Join(ocspFolder, file.Name())
+		stapleFile := filepath.Join(ocspFolder(), file.Name())
 		ocspBytes, err := ioutil.ReadFile(stapleFile)
 		if err != nil {
 			continue
@@ -318,4 +320,8 @@ func freshOCSP(resp *ocsp.Response) bool {
 	return time.Now().Before(refreshTime)
 }
 
-var ocspFolder = filepath.Join(caddy.AssetsPath(), "ocsp")
+// ocspFolder returns the folder in which OCSP staples are cached;
+// it changes if the process is confined to a chroot.
+func ocspFolder() string {
+	return filepath.Join(caddy.AssetsPath(), "ocsp")
+}
@@ -0,0 +1,26 @@
+package caddytls
+
+import "github.com/mholt/caddy/metrics"
+
+var (
+	handshakesTotal = metrics.NewCounter("caddy_tls_handshakes_total",
+		"Number of TLS handshakes that needed a certificate, by result.",
+		"result")
+	certExpiry = metrics.NewGauge("caddy_tls_certificate_expiry_timestamp_seconds",
+		"Expiry time of each managed or loaded certificate since unix epoch in seconds, by name.",
+		"name")
+)
+
+func init() {
+	metrics.OnScrape(collectCertificates)
+}
+
+// collectCertificates sets certExpiry from the certificate cache.
+func collectCertificates() {
+	certExpiry.Reset()
+	for _, cert := range CachedCertificates() {
+		for _, name := range cert.Names {
+			certExpiry.Set(float64(cert.NotAfter.Unix()), name)
+		}
+	}
+}
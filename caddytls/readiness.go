@@ -0,0 +1,35 @@
+package caddytls
+
+import (
+	"fmt"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterReadinessCheck("tls_storage", checkStorage)
+}
+
+// checkStorage is ready if the storage of every managed
+// certificate in the cache can be reached.
+func checkStorage() error {
+	checked := make(map[string]struct{})
+	for _, cert := range CachedCertificates() {
+		if cert.Config == nil || !cert.Config.Managed || len(cert.Names) == 0 {
+			continue
+		}
+		key := cert.Config.StorageProvider + " " + cert.Config.CAUrl
+		if _, ok := checked[key]; ok {
+			continue
+		}
+		checked[key] = struct{}{}
+		storage, err := cert.Config.StorageFor(cert.Config.CAUrl)
+		if err != nil {
+			return err
+		}
+		if _, err := storage.SiteExists(cert.Names[0]); err != nil {
+			return fmt.Errorf("%s storage: %v", cert.Config.StorageProvider, err)
+		}
+	}
+	return nil
+}
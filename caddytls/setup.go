@@ -199,6 +199,13 @@ func setupTLS(c *caddy.Controller) error {
 			config.OnDemandState.MaxObtain = int32(maxCertsNum)
 		}
 
+		// the files are read again on reload, also in a sandbox
+		for _, file := range append([]string{certificateFile, keyFile, loadDir}, config.ClientCerts...) {
+			if file != "" {
+				caddy.RegisterReadablePath(file)
+			}
+		}
+
 		// don't try to load certificates unless we're supposed to
 		if !config.Enabled || !config.Manual {
 			continue
@@ -48,6 +48,9 @@ func TestSetupParseBasic(t *testing.T) {
 	if !cfg.Enabled {
 		t.Error("Expected TLS Enabled=true, but was false")
 	}
+	if !caddy.Readable(certFile) || !caddy.Readable(keyFile) {
+		t.Error("Expected the certificate and key to be readable on reload once privileges are dropped")
+	}
 
 	// Security defaults
 	if cfg.ProtocolMinVersion != tls.VersionTLS11 {
@@ -47,6 +47,10 @@ type Controller struct {
 	// setup function to persist state between all
 	// the keys on a server block.
 	ServerBlockStorage interface{}
+
+	// Directive is the name of the directive
+	// being set up.
+	Directive string
 }
 
 // ServerType gets the name of the server type that is being set up.
@@ -60,10 +64,18 @@ func (c *Controller) OnFirstStartup(fn func() error) {
 	c.instance.onFirstStartup = append(c.instance.onFirstStartup, fn)
 }
 
+// OnFirstStartupComplete adds fn to the list of callback functions
+// to execute once the servers are started and listening, NOT as
+// part of a restart. If fn returns an error, the servers are stopped.
+func (c *Controller) OnFirstStartupComplete(fn func() error) {
+	c.instance.onFirstStartupComplete = append(c.instance.onFirstStartupComplete, fn)
+}
+
 // OnStartup adds fn to the list of callback functions to execute
 // when the server is about to be started (including restarts).
 func (c *Controller) OnStartup(fn func() error) {
 	c.instance.onStartup = append(c.instance.onStartup, fn)
+	c.instance.onStartupBlocks = append(c.instance.onStartupBlocks, c.ServerBlockIndex)
 }
 
 // OnRestart adds fn to the list of callback functions to execute
@@ -84,6 +96,12 @@ func (c *Controller) OnFinalShutdown(fn func() error) {
 	c.instance.onFinalShutdown = append(c.instance.onFinalShutdown, fn)
 }
 
+// Tenant returns the tenant whose configuration is being set up,
+// or nil if it is not a tenant's.
+func (c *Controller) Tenant() *Tenant {
+	return c.instance.tenant
+}
+
 // Context gets the context associated with the instance associated with c.
 func (c *Controller) Context() Context {
 	return c.instance.context
@@ -0,0 +1,224 @@
+package caddy
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// ConfigDiff is how a candidate Caddyfile differs from a running
+// one: a preview of what reloading with it would change. Sites are
+// named by the addresses that start their server blocks.
+type ConfigDiff struct {
+	SitesAdded       []string   `json:"sites_added"`
+	SitesRemoved     []string   `json:"sites_removed"`
+	SitesChanged     []SiteDiff `json:"sites_changed"`
+	ListenersAdded   []string   `json:"listeners_added"`
+	ListenersRemoved []string   `json:"listeners_removed"`
+}
+
+// SiteDiff is how the directives of a site differ between two
+// Caddyfiles.
+type SiteDiff struct {
+	Site              string   `json:"site"`
+	DirectivesAdded   []string `json:"directives_added,omitempty"`
+	DirectivesRemoved []string `json:"directives_removed,omitempty"`
+	DirectivesChanged []string `json:"directives_changed,omitempty"`
+}
+
+// ListenersReporter is implemented by the Contexts of server types
+// that can tell which addresses their servers would listen on, once
+// the server blocks are inspected, without executing directives.
+type ListenersReporter interface {
+	Listeners(serverBlocks []caddyfile.ServerBlock) []string
+}
+
+// Empty returns whether there are no differences.
+func (d ConfigDiff) Empty() bool {
+	return len(d.SitesAdded) == 0 && len(d.SitesRemoved) == 0 && len(d.SitesChanged) == 0 &&
+		len(d.ListenersAdded) == 0 && len(d.ListenersRemoved) == 0
+}
+
+// String returns the differences for people to read, one per line.
+func (d ConfigDiff) String() string {
+	if d.Empty() {
+		return "No changes\n"
+	}
+	var buf bytes.Buffer
+	for _, site := range d.SitesAdded {
+		fmt.Fprintf(&buf, "+ site %s\n", site)
+	}
+	for _, site := range d.SitesRemoved {
+		fmt.Fprintf(&buf, "- site %s\n", site)
+	}
+	for _, site := range d.SitesChanged {
+		fmt.Fprintf(&buf, "~ site %s\n", site.Site)
+		for _, dir := range site.DirectivesAdded {
+			fmt.Fprintf(&buf, "    + %s\n", dir)
+		}
+		for _, dir := range site.DirectivesRemoved {
+			fmt.Fprintf(&buf, "    - %s\n", dir)
+		}
+		for _, dir := range site.DirectivesChanged {
+			fmt.Fprintf(&buf, "    ~ %s\n", dir)
+		}
+	}
+	for _, addr := range d.ListenersAdded {
+		fmt.Fprintf(&buf, "+ listener %s\n", addr)
+	}
+	for _, addr := range d.ListenersRemoved {
+		fmt.Fprintf(&buf, "- listener %s\n", addr)
+	}
+	return buf.String()
+}
+
+// DiffCaddyfiles returns how candidate differs from running. Both
+// are parsed and their server blocks inspected by their server type,
+// but no directives are executed, so nothing is set up or started.
+func DiffCaddyfiles(running, candidate Input) (ConfigDiff, error) {
+	diff := ConfigDiff{
+		SitesAdded:   []string{},
+		SitesRemoved: []string{},
+		SitesChanged: []SiteDiff{},
+	}
+	oldSites, oldListeners, err := inspectForDiff(running)
+	if err != nil {
+		return ConfigDiff{}, fmt.Errorf("running Caddyfile: %v", err)
+	}
+	newSites, newListeners, err := inspectForDiff(candidate)
+	if err != nil {
+		return ConfigDiff{}, fmt.Errorf("candidate Caddyfile: %v", err)
+	}
+
+	for site, newDirs := range newSites {
+		oldDirs, ok := oldSites[site]
+		if !ok {
+			diff.SitesAdded = append(diff.SitesAdded, site)
+			continue
+		}
+		if sd := diffDirectives(site, oldDirs, newDirs); sd != nil {
+			diff.SitesChanged = append(diff.SitesChanged, *sd)
+		}
+	}
+	for site := range oldSites {
+		if _, ok := newSites[site]; !ok {
+			diff.SitesRemoved = append(diff.SitesRemoved, site)
+		}
+	}
+	diff.ListenersAdded = missingFrom(oldListeners, newListeners)
+	diff.ListenersRemoved = missingFrom(newListeners, oldListeners)
+
+	sort.Strings(diff.SitesAdded)
+	sort.Strings(diff.SitesRemoved)
+	sort.Slice(diff.SitesChanged, func(i, j int) bool {
+		return diff.SitesChanged[i].Site < diff.SitesChanged[j].Site
+	})
+	return diff, nil
+}
+
+// inspectForDiff parses input and has its server type inspect it.
+// It returns the directives of each site, each as a canonical form
+// of its lines, and the addresses its servers would listen on, if
+// the server type can tell.
+func inspectForDiff(input Input) (map[string]map[string]string, []string, error) {
+	stypeName := input.ServerType()
+	stype, err := getServerType(stypeName)
+	if err != nil {
+		return nil, nil, err
+	}
+	sblocks, err := loadServerBlocks(stypeName, input.Path(), bytes.NewReader(input.Body()))
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := stype.NewContext()
+	if ctx == nil {
+		return nil, nil, fmt.Errorf("server type %s produced a nil Context", stypeName)
+	}
+	sblocks, err = ctx.InspectServerBlocks(input.Path(), sblocks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sites := make(map[string]map[string]string)
+	for _, sb := range sblocks {
+		dirs := make(map[string]string)
+		for dir, tokens := range sb.Tokens {
+			dirs[dir] = canonicalTokens(tokens)
+		}
+		for _, key := range sb.Keys {
+			sites[strings.ToLower(key)] = dirs
+		}
+	}
+	var listeners []string
+	if lr, ok := ctx.(ListenersReporter); ok {
+		listeners = lr.Listeners(sblocks)
+	}
+	return sites, listeners, nil
+}
+
+// canonicalTokens returns the texts of tokens, with their line
+// breaks but not their positions, so that a directive moved within
+// its Caddyfile is not changed.
+func canonicalTokens(tokens []caddyfile.Token) string {
+	var buf bytes.Buffer
+	for i, tok := range tokens {
+		if i > 0 {
+			if tok.Line != tokens[i-1].Line || tok.File != tokens[i-1].File {
+				buf.WriteByte('\n')
+			} else {
+				buf.WriteByte(' ')
+			}
+		}
+		buf.WriteString(strconv.Quote(tok.Text))
+	}
+	return buf.String()
+}
+
+// diffDirectives returns how the directives of site differ, or nil
+// if they don't.
+func diffDirectives(site string, oldDirs, newDirs map[string]string) *SiteDiff {
+	sd := SiteDiff{Site: site}
+	for dir, lines := range newDirs {
+		oldLines, ok := oldDirs[dir]
+		switch {
+		case !ok:
+			sd.DirectivesAdded = append(sd.DirectivesAdded, dir)
+		case oldLines != lines:
+			sd.DirectivesChanged = append(sd.DirectivesChanged, dir)
+		}
+	}
+	for dir := range oldDirs {
+		if _, ok := newDirs[dir]; !ok {
+			sd.DirectivesRemoved = append(sd.DirectivesRemoved, dir)
+		}
+	}
+	if len(sd.DirectivesAdded) == 0 && len(sd.DirectivesRemoved) == 0 && len(sd.DirectivesChanged) == 0 {
+		return nil
+	}
+	sort.Strings(sd.DirectivesAdded)
+	sort.Strings(sd.DirectivesRemoved)
+	sort.Strings(sd.DirectivesChanged)
+	return &sd
+}
+
+// missingFrom returns the strings of b that aren't in a, sorted and
+// without repeats.
+func missingFrom(a, b []string) []string {
+	inA := make(map[string]bool)
+	for _, s := range a {
+		inA[s] = true
+	}
+	missing := []string{}
+	for _, s := range b {
+		if !inA[s] {
+			missing = append(missing, s)
+			inA[s] = true
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
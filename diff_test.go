@@ -0,0 +1,131 @@
+package caddy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+type diffTestContext struct{}
+
+func (diffTestContext) InspectServerBlocks(_ string, sblocks []caddyfile.ServerBlock) ([]caddyfile.ServerBlock, error) {
+	return sblocks, nil
+}
+
+func (diffTestContext) MakeServers() ([]Server, error) { return nil, nil }
+
+// Listeners listens on the first argument of the listen directive.
+func (diffTestContext) Listeners(sblocks []caddyfile.ServerBlock) []string {
+	var listeners []string
+	for _, sb := range sblocks {
+		if tokens := sb.Tokens["listen"]; len(tokens) > 1 {
+			listeners = append(listeners, tokens[1].Text)
+		}
+	}
+	return listeners
+}
+
+func init() {
+	RegisterServerType("difftest", ServerType{
+		Directives: func() []string { return []string{"listen", "root", "gzip", "log"} },
+		NewContext: func() Context { return diffTestContext{} },
+	})
+}
+
+func TestDiffCaddyfiles(t *testing.T) {
+	running := CaddyfileInput{ServerTypeName: "difftest", Filepath: "Caddyfile", Contents: []byte(`a.com b.com {
+	listen :443
+	root /srv/a
+	gzip
+}
+c.com {
+	listen :8080
+	log access.log {
+		rotate_size 10
+	}
+}
+gone.com {
+	listen :9000
+}`)}
+	candidate := CaddyfileInput{ServerTypeName: "difftest", Filepath: "Caddyfile", Contents: []byte(`# moved, but the same
+c.com {
+	listen :8080
+	log access.log {
+		rotate_size 10
+	}
+}
+A.com {
+	listen :443
+	root /srv/a2
+	log
+}
+b.com {
+	listen :443
+	root /srv/a
+	gzip
+}
+new.com {
+	listen :9001
+}`)}
+
+	diff, err := DiffCaddyfiles(running, candidate)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := ConfigDiff{
+		SitesAdded:   []string{"new.com"},
+		SitesRemoved: []string{"gone.com"},
+		SitesChanged: []SiteDiff{{
+			Site:              "a.com",
+			DirectivesAdded:   []string{"log"},
+			DirectivesRemoved: []string{"gzip"},
+			DirectivesChanged: []string{"root"},
+		}},
+		ListenersAdded:   []string{":9001"},
+		ListenersRemoved: []string{":9000"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diff)
+	}
+	if diff.Empty() {
+		t.Error("Expected the diff not to be empty")
+	}
+	for _, line := range []string{"+ site new.com", "- site gone.com", "~ site a.com", "    ~ root", "+ listener :9001"} {
+		if !strings.Contains(diff.String(), line+"\n") {
+			t.Errorf("Expected the diff to have the line %q, got:\n%s", line, diff)
+		}
+	}
+
+	same, err := DiffCaddyfiles(running, running)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !same.Empty() || same.String() != "No changes\n" {
+		t.Errorf("Expected no changes, got %+v", same)
+	}
+}
+
+func TestDiffCaddyfilesLineBreaks(t *testing.T) {
+	running := CaddyfileInput{ServerTypeName: "difftest", Contents: []byte("a.com {\n\tlog a.log\n}")}
+	candidate := CaddyfileInput{ServerTypeName: "difftest", Contents: []byte("a.com {\n\tlog\n\tlog a.log\n}")}
+	diff, err := DiffCaddyfiles(running, candidate)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(diff.SitesChanged) != 1 || !reflect.DeepEqual(diff.SitesChanged[0].DirectivesChanged, []string{"log"}) {
+		t.Errorf("Expected log to have changed, got %+v", diff)
+	}
+}
+
+func TestDiffCaddyfilesInvalid(t *testing.T) {
+	good := CaddyfileInput{ServerTypeName: "difftest", Contents: []byte("a.com {\n\troot /srv\n}")}
+	bad := CaddyfileInput{ServerTypeName: "difftest", Contents: []byte("a.com {\n\tnope\n}")}
+	if _, err := DiffCaddyfiles(good, bad); err == nil || !strings.Contains(err.Error(), "candidate") {
+		t.Errorf("Expected an error about the candidate, got %v", err)
+	}
+	if _, err := DiffCaddyfiles(bad, good); err == nil || !strings.Contains(err.Error(), "running") {
+		t.Errorf("Expected an error about the running Caddyfile, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+// +build !linux,!windows,!plan9,!nacl
+
+package caddy
+
+import "errors"
+
+// landlockWrites returns an error, since Landlock is only
+// available on Linux.
+func landlockWrites(dirs []string) (func() error, error) {
+	return nil, errors.New("Landlock is only available on Linux")
+}
+
+// sandbox returns an error, since the sandbox is only available on
+// Linux.
+func sandbox(read, written []string, exec bool) (func() error, error) {
+	return nil, errors.New("the sandbox is only available on Linux")
+}
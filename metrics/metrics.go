@@ -0,0 +1,342 @@
+// Package metrics is a small, dependency-free registry of counters,
+// gauges and histograms that can be written out in the Prometheus
+// text exposition format. Any part of Caddy may record metrics here;
+// it is up to a server type to expose them.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format
+// written by Registry.WriteTo.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, suitable for
+// request latencies measured in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry is a set of metric families.
+type Registry struct {
+	mu         sync.Mutex
+	families   map[string]*family
+	collectors []func()
+}
+
+// NewRegistry returns a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// DefaultRegistry is the registry used by the package-level
+// functions and exposed by Caddy.
+var DefaultRegistry = NewRegistry()
+
+// NewCounter registers a counter in the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers a gauge in the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help, labels...)
+}
+
+// NewHistogram registers a histogram in the default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+// OnScrape registers f with the default registry; see
+// Registry.OnScrape.
+func OnScrape(f func()) {
+	DefaultRegistry.OnScrape(f)
+}
+
+// NewCounter registers and returns a counter with the given name,
+// help text and label names. It panics if name is already taken.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", nil, labels)}
+}
+
+// NewGauge registers and returns a gauge with the given name,
+// help text and label names. It panics if name is already taken.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", nil, labels)}
+}
+
+// NewHistogram registers and returns a histogram with the given
+// name, help text, upper bucket bounds and label names. If buckets
+// is nil, DefBuckets is used. It panics if name is already taken.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(name, help, "histogram", buckets, labels)}
+}
+
+// OnScrape registers f to be called each time the registry is
+// written out, before anything is written. It is how values that
+// are cheaper to read on demand than to track, such as runtime
+// statistics, are brought up to date.
+func (r *Registry) OnScrape(f func()) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, f)
+	r.mu.Unlock()
+}
+
+func (r *Registry) register(name, help, typ string, buckets []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	if len(labels) == 0 {
+		// a metric without labels always has exactly one value
+		f.get("", nil)
+	}
+	r.families[name] = f
+	return f
+}
+
+// WriteTo writes every metric in r to w in the Prometheus text
+// exposition format, ordered by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]func(){}, r.collectors...)
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+
+	for _, collect := range collectors {
+		collect()
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	cw := &countingWriter{w: w}
+	for _, f := range families {
+		if err := f.write(cw); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// Counter is a metric whose value only goes up.
+type Counter struct{ f *family }
+
+// Inc adds 1 to the counter with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter
+// with the given label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.f.name + " cannot decrease")
+	}
+	c.f.update(values, func(s *series) { s.value += v })
+}
+
+// Gauge is a metric whose value can go up and down.
+type Gauge struct{ f *family }
+
+// Set sets the gauge with the given label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.update(values, func(s *series) { s.value = v })
+}
+
+// Add adds v, which may be negative, to the gauge with
+// the given label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.f.update(values, func(s *series) { s.value += v })
+}
+
+// Inc adds 1 to the gauge with the given label values.
+func (g *Gauge) Inc(values ...string) { g.Add(1, values...) }
+
+// Dec subtracts 1 from the gauge with the given label values.
+func (g *Gauge) Dec(values ...string) { g.Add(-1, values...) }
+
+// Delete removes the gauge with the given label values, so that
+// it is no longer exported.
+func (g *Gauge) Delete(values ...string) {
+	k := g.f.key(values)
+	g.f.mu.Lock()
+	delete(g.f.series, k)
+	g.f.mu.Unlock()
+}
+
+// Reset removes all label values of the gauge.
+func (g *Gauge) Reset() {
+	g.f.mu.Lock()
+	g.f.series = make(map[string]*series)
+	g.f.mu.Unlock()
+}
+
+// Histogram is a metric that counts observations in buckets.
+type Histogram struct{ f *family }
+
+// Observe records v in the histogram with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.update(values, func(s *series) {
+		for i, bound := range h.f.buckets {
+			if v <= bound {
+				s.counts[i]++
+			}
+		}
+		s.sum += v
+		s.count++
+	})
+}
+
+// family is a metric name together with all its label values.
+type family struct {
+	name, help, typ string
+	labels          []string
+	buckets         []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series is the value of a metric for one set of label values.
+type series struct {
+	values []string
+	value  float64
+
+	// for histograms; counts are cumulative
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// get returns the series for values, whose key is k, creating it
+// if necessary. f.mu must be held unless f is not yet shared.
+func (f *family) get(k string, values []string) *series {
+	s, ok := f.series[k]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[k] = s
+	}
+	return s
+}
+
+func (f *family) update(values []string, fn func(*series)) {
+	k := f.key(values)
+	f.mu.Lock()
+	fn(f.get(k, values))
+	f.mu.Unlock()
+}
+
+func (f *family) write(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != "histogram" {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.values, ""), formatFloat(s.value)); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, bound := range f.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.values, formatFloat(bound)), s.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			f.name, f.labelString(s.values, "+Inf"), s.count,
+			f.name, f.labelString(s.values, ""), formatFloat(s.sum),
+			f.name, f.labelString(s.values, ""), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelString formats the label pairs of a sample, adding an "le"
+// label if le is not empty.
+func (f *family) labelString(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, f.labels[i]+`="`+escapeLabel(v)+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_requests_total", "Number of requests.", "site", "code")
+	g := r.NewGauge("test_open", "Open things.")
+	h := r.NewHistogram("test_duration_seconds", "Durations.", []float64{1, 0.5}, "site")
+
+	c.Inc("b.com", "200")
+	c.Add(2, "a.com", "404")
+	c.Inc("a.com", "404")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	h.Observe(0.1, `q"x`)
+	h.Observe(0.7, `q"x`)
+	h.Observe(3, `q"x`)
+
+	var scraped bool
+	r.OnScrape(func() { scraped = true })
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written to be reported, got %d", buf.Len(), n)
+	}
+	if !scraped {
+		t.Error("Expected scrape callback to be called")
+	}
+
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{site="q\"x",le="0.5"} 1
+test_duration_seconds_bucket{site="q\"x",le="1"} 2
+test_duration_seconds_bucket{site="q\"x",le="+Inf"} 3
+test_duration_seconds_sum{site="q\"x"} 3.8
+test_duration_seconds_count{site="q\"x"} 3
+# HELP test_open Open things.
+# TYPE test_open gauge
+test_open 1
+# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{site="a.com",code="404"} 3
+test_requests_total{site="b.com",code="200"} 1
+`
+	if got := buf.String(); got != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestGaugeDeleteAndReset(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("test_healthy", "Health.", "host")
+	g.Set(1, "a")
+	g.Set(0, "b")
+	g.Delete("a")
+
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	if strings.Contains(buf.String(), `host="a"`) || !strings.Contains(buf.String(), `test_healthy{host="b"} 0`) {
+		t.Errorf("Expected only host b after delete, got:\n%s", buf.String())
+	}
+
+	g.Reset()
+	buf.Reset()
+	r.WriteTo(&buf)
+	if strings.Contains(buf.String(), "host=") {
+		t.Errorf("Expected no values after reset, got:\n%s", buf.String())
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "Total.", "a")
+
+	for i, fn := range []func(){
+		func() { c.Inc() },
+		func() { c.Inc("x", "y") },
+		func() { c.Add(-1, "x") },
+		func() { r.NewGauge("test_total", "Again.") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Test %d: Expected a panic", i)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestDefaultRegistryRuntime(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := DefaultRegistry.WriteTo(&buf); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, name := range []string{"go_goroutines ", "go_memstats_alloc_bytes ", "go_info{version=", "process_start_time_seconds "} {
+		if !strings.Contains(buf.String(), "\n"+name) {
+			t.Errorf("Expected %s in output:\n%s", name, buf.String())
+		}
+	}
+}
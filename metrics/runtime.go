@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+var startTime = time.Now()
+
+// Go runtime and process statistics, read at each scrape.
+var (
+	goInfo       = NewGauge("go_info", "Information about the Go environment.", "version")
+	goGoroutines = NewGauge("go_goroutines", "Number of goroutines that currently exist.")
+	goAlloc      = NewGauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.")
+	goSys        = NewGauge("go_memstats_sys_bytes", "Number of bytes obtained from the system.")
+	goHeapObj    = NewGauge("go_memstats_heap_objects", "Number of allocated objects.")
+	goGCCycles   = NewCounter("go_gc_cycles_total", "Number of completed GC cycles.")
+	goGCPause    = NewCounter("go_gc_pause_seconds_total", "Total time spent in GC stop-the-world pauses.")
+	procStart    = NewGauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.")
+)
+
+func init() {
+	goInfo.Set(1, runtime.Version())
+	procStart.Set(float64(startTime.UnixNano()) / 1e9)
+	OnScrape(collectRuntime)
+}
+
+func collectRuntime() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	goGoroutines.Set(float64(runtime.NumGoroutine()))
+	goAlloc.Set(float64(ms.Alloc))
+	goSys.Set(float64(ms.Sys))
+	goHeapObj.Set(float64(ms.HeapObjects))
+	// these only ever go up, so they are exported as counters,
+	// but it's simplest to copy the runtime's totals directly
+	goGCCycles.f.update(nil, func(s *series) { s.value = float64(ms.NumGC) })
+	goGCPause.f.update(nil, func(s *series) { s.value = float64(ms.PauseTotalNs) / 1e9 })
+}
@@ -0,0 +1,541 @@
+// Package objectstore serves files from the buckets of S3 and of
+// compatible object storage services, such as Google Cloud Storage
+// through its interoperability API, or MinIO.
+package objectstore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetadataTTL is how long, by default, the metadata of
+// objects is cached before they are looked up again.
+const DefaultMetadataTTL = time.Minute
+
+// maxMetadata limits the number of objects of which metadata is
+// cached, so that requests for random names can't exhaust memory.
+const maxMetadata = 10000
+
+// Bucket is an http.FileSystem of the objects in a bucket under
+// a prefix, in which the slashes of keys make directories. The
+// metadata of objects, including whether they exist, is cached
+// for MetadataTTL; their contents are read as they are served,
+// unless they are small enough for the content cache.
+//
+// The fields of a Bucket must not be changed once it is in use.
+type Bucket struct {
+	Name   string
+	Prefix string // of the keys served, ending in a slash if not empty
+	Region string
+
+	// Endpoint is the URL of a service compatible with S3, of
+	// which objects are addressed path-style, as in
+	// https://endpoint/bucket/key; nil for S3 itself.
+	Endpoint *url.URL
+
+	// Credentials sign the requests; without them, the objects
+	// must be public.
+	Credentials Credentials
+
+	// MetadataTTL is how long metadata is cached; if 0, objects
+	// are looked up each time they are opened.
+	MetadataTTL time.Duration
+
+	// ContentCache is how many bytes of the objects to keep in
+	// memory; if 0, none are. Only objects of up to an eighth of
+	// this size are kept, so that large ones don't evict the
+	// rest.
+	ContentCache int64
+
+	// Client makes the requests; if nil, defaultClient does.
+	Client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadataCache
+	content  *contentCache
+}
+
+// defaultClient makes the requests of buckets without a Client.
+// It times out connecting and waiting for responses, but not
+// reading them, since objects are read as they are served.
+var defaultClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	},
+}
+
+// NewBucket returns the bucket at location, which is
+// s3://bucket/prefix, optionally with region and endpoint
+// query parameters, or gs://bucket/prefix for Google Cloud
+// Storage. Credentials are taken from the environment.
+func NewBucket(location string) (*Bucket, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s: location must be %s://bucket/prefix", location, u.Scheme)
+	}
+	b := &Bucket{
+		Name:        u.Host,
+		Prefix:      strings.Trim(u.Path, "/"),
+		Credentials: EnvCredentials(),
+		MetadataTTL: DefaultMetadataTTL,
+	}
+	if b.Prefix != "" {
+		b.Prefix += "/"
+	}
+	switch u.Scheme {
+	case "s3":
+		b.Region = u.Query().Get("region")
+		if b.Region == "" {
+			b.Region = os.Getenv("AWS_REGION")
+		}
+		if b.Region == "" {
+			b.Region = "us-east-1"
+		}
+		if endpoint := u.Query().Get("endpoint"); endpoint != "" {
+			if b.Endpoint, err = url.Parse(endpoint); err != nil {
+				return nil, fmt.Errorf("%s: endpoint: %v", location, err)
+			}
+		}
+	case "gs":
+		b.Region = "auto"
+		b.Endpoint = &url.URL{Scheme: "https", Host: "storage.googleapis.com"}
+	default:
+		return nil, fmt.Errorf("%s: not an s3:// or gs:// location", location)
+	}
+	return b, nil
+}
+
+// IsLocation returns whether s is the location of a bucket.
+func IsLocation(s string) bool {
+	return strings.HasPrefix(s, "s3://") || strings.HasPrefix(s, "gs://")
+}
+
+// Open implements http.FileSystem.
+func (b *Bucket) Open(name string) (http.File, error) {
+	rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if rel == "" {
+		return &bucketFile{b: b, info: &objectInfo{name: "/", dir: true}, key: b.Prefix}, nil
+	}
+	key := b.Prefix + rel
+	info, err := b.stat(key)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	f := &bucketFile{b: b, key: key, info: info}
+	if info.dir {
+		f.key += "/"
+		return f, nil
+	}
+	if content, ok := b.cachedContent(key, info.etag); ok {
+		f.content = bytes.NewReader(content)
+	} else if b.ContentCache > 0 && info.size <= b.ContentCache/8 {
+		content, err := b.getAll(key, info)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		b.cacheContent(key, info.etag, content)
+		f.content = bytes.NewReader(content)
+	}
+	return f, nil
+}
+
+// stat returns the metadata of the object at key, or of the
+// directory that key is the prefix of, from the cache if it is
+// fresh; os.ErrNotExist if there is neither.
+func (b *Bucket) stat(key string) (*objectInfo, error) {
+	var entry metadataEntry
+	var ok bool
+	b.mu.Lock()
+	if b.metadata != nil {
+		entry, ok = b.metadata.get(key)
+	}
+	b.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		if entry.info == nil {
+			return nil, os.ErrNotExist
+		}
+		return entry.info, nil
+	}
+	info, err := b.head(key)
+	if err == os.ErrNotExist {
+		var list *listResult
+		list, err = b.list(key+"/", "", 1)
+		if err == nil && (len(list.Contents) > 0 || len(list.CommonPrefixes) > 0) {
+			info = &objectInfo{name: path.Base(key), dir: true}
+		} else if err == nil {
+			err = os.ErrNotExist
+		}
+	}
+	if err != nil && err != os.ErrNotExist {
+		return nil, err // not cached, so that it is tried again
+	}
+	b.cacheMetadata(key, info)
+	return info, err
+}
+
+// cacheMetadata caches info, which is nil if nothing is at key.
+func (b *Bucket) cacheMetadata(key string, info *objectInfo) {
+	if b.MetadataTTL <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.metadata == nil {
+		b.metadata = newMetadataCache(maxMetadata)
+	}
+	b.metadata.put(key, info, time.Now().Add(b.MetadataTTL))
+}
+
+// forget drops what is cached of the object at key, which changed.
+func (b *Bucket) forget(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.metadata != nil {
+		b.metadata.remove(key)
+	}
+	if b.content != nil {
+		b.content.remove(key)
+	}
+}
+
+func (b *Bucket) cachedContent(key, etag string) ([]byte, bool) {
+	if b.ContentCache <= 0 {
+		return nil, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.content == nil {
+		return nil, false
+	}
+	return b.content.get(key, etag)
+}
+
+func (b *Bucket) cacheContent(key, etag string, content []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.content == nil {
+		b.content = newContentCache(b.ContentCache)
+	}
+	b.content.put(key, etag, content)
+}
+
+// head returns the metadata of the object at key.
+func (b *Bucket) head(key string) (*objectInfo, error) {
+	resp, err := b.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, os.ErrNotExist
+	case http.StatusForbidden:
+		return nil, os.ErrPermission
+	default:
+		return nil, fmt.Errorf("HEAD %s: %s", key, resp.Status)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &objectInfo{
+		name:    path.Base(key),
+		size:    resp.ContentLength,
+		modTime: modTime,
+		etag:    resp.Header.Get("ETag"),
+	}, nil
+}
+
+// get returns the body of the object at key from offset on, so
+// long as its ETag is still etag.
+func (b *Bucket) get(key, etag string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+	if offset > 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := b.do(http.MethodGet, key, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK && offset == 0, resp.StatusCode == http.StatusPartialContent:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusPreconditionFailed, resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		b.forget(key)
+		return nil, fmt.Errorf("GET %s: object changed while being served", key)
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("GET %s: %s", key, resp.Status)
+}
+
+// getAll returns the contents of the object at key, of which
+// info is the metadata.
+func (b *Bucket) getAll(key string, info *objectInfo) ([]byte, error) {
+	body, err := b.get(key, info.etag, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(io.LimitReader(body, info.size))
+}
+
+// listResult is a page of the results of ListObjectsV2.
+type listResult struct {
+	Contents []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// list returns a page of at most max keys that start with prefix,
+// of which those with a further slash are rolled up into common
+// prefixes; token is the continuation token of the page.
+func (b *Bucket) list(prefix, token string, max int) (*listResult, error) {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"delimiter": {"/"},
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	if max > 0 {
+		query.Set("max-keys", strconv.Itoa(max))
+	}
+	resp, err := b.do(http.MethodGet, "", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing %s: %s", prefix, resp.Status)
+	}
+	result := new(listResult)
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("listing %s: %v", prefix, err)
+	}
+	return result, nil
+}
+
+// readDir returns the files and directories under prefix.
+func (b *Bucket) readDir(prefix string) ([]os.FileInfo, error) {
+	var infos []os.FileInfo
+	var token string
+	for {
+		list, err := b.list(prefix, token, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/")
+			if name != "" {
+				infos = append(infos, &objectInfo{name: name, dir: true})
+			}
+		}
+		for _, obj := range list.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			if name == "" {
+				continue // a placeholder for the directory itself
+			}
+			info := &objectInfo{name: name, size: obj.Size, modTime: obj.LastModified, etag: obj.ETag}
+			b.cacheMetadata(obj.Key, info)
+			infos = append(infos, info)
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			break
+		}
+		token = list.NextContinuationToken
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// do makes a request of method for the object at key, or for the
+// bucket if key is empty.
+func (b *Bucket) do(method, key string, query url.Values, header http.Header) (*http.Response, error) {
+	u := &url.URL{Scheme: "https", Host: b.Name + ".s3." + b.Region + ".amazonaws.com", Path: "/" + key}
+	if b.Endpoint != nil {
+		u = &url.URL{Scheme: b.Endpoint.Scheme, Host: b.Endpoint.Host, Path: "/" + b.Name + "/" + key}
+	}
+	u.RawPath = escape(u.Path, false)
+	u.RawQuery = encodeQuery(query)
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if b.Credentials.Valid() {
+		Sign(req, b.Region, b.Credentials, time.Now())
+	}
+	client := b.Client
+	if client == nil {
+		client = defaultClient
+	}
+	return client.Do(req)
+}
+
+// bucketFile is an open object or directory of a bucket.
+type bucketFile struct {
+	b    *Bucket
+	key  string // of the object, or prefix of the directory
+	info *objectInfo
+
+	content *bytes.Reader // if it is in memory
+
+	offset int64
+	body   io.ReadCloser // of the object from bodyAt on
+	bodyAt int64
+
+	children []os.FileInfo // of a directory, once listed
+	listed   bool
+	dirPos   int // how many children Readdir returned
+}
+
+// Read implements http.File.
+func (f *bucketFile) Read(p []byte) (int, error) {
+	if f.info.dir {
+		return 0, errors.New("is a directory")
+	}
+	if f.content != nil {
+		return f.content.Read(p)
+	}
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyAt != f.offset {
+		f.closeBody()
+		body, err := f.b.get(f.key, f.info.etag, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body, f.bodyAt = body, f.offset
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyAt += int64(n)
+	if err == io.EOF && f.offset < f.info.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek implements http.File. The object is requested again from
+// the new offset when it is next read.
+func (f *bucketFile) Seek(offset int64, whence int) (int64, error) {
+	if f.content != nil {
+		return f.content.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *bucketFile) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+// Close implements http.File.
+func (f *bucketFile) Close() error {
+	f.closeBody()
+	return nil
+}
+
+// Stat implements http.File.
+func (f *bucketFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+// Readdir implements http.File.
+func (f *bucketFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.dir {
+		return nil, errors.New("not a directory")
+	}
+	if !f.listed {
+		children, err := f.b.readDir(f.key)
+		if err != nil {
+			return nil, err
+		}
+		f.children, f.listed = children, true
+	}
+	rest := f.children[f.dirPos:]
+	if count <= 0 {
+		f.dirPos += len(rest)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	f.dirPos += count
+	return rest[:count], nil
+}
+
+// objectInfo is the file info of an object, or of a directory
+// that the keys of objects imply.
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	etag    string
+	dir     bool
+}
+
+func (fi *objectInfo) Name() string       { return fi.name }
+func (fi *objectInfo) Size() int64        { return fi.size }
+func (fi *objectInfo) ModTime() time.Time { return fi.modTime }
+func (fi *objectInfo) IsDir() bool        { return fi.dir }
+func (fi *objectInfo) Sys() interface{}   { return nil }
+
+func (fi *objectInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
@@ -0,0 +1,364 @@
+package objectstore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStorage serves the objects of a bucket as S3 does, path-style.
+type fakeStorage struct {
+	bucket string
+
+	mu       sync.Mutex
+	objects  map[string]string
+	requests []string // as "METHOD key"
+}
+
+func (s *fakeStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+s.bucket+"/")
+	s.requests = append(s.requests, r.Method+" "+key)
+
+	if key == "" {
+		s.list(w, r.URL.Query())
+		return
+	}
+	content, ok := s.objects[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	etag := fmt.Sprintf(`"%d"`, len(content))
+	if match := r.Header.Get("If-Match"); match != "" && match != etag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", "Thu, 01 Jun 2017 12:00:00 GMT")
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		content = content[offset:]
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		io.WriteString(w, content)
+	}
+}
+
+func (s *fakeStorage) list(w http.ResponseWriter, query url.Values) {
+	prefix := query.Get("prefix")
+	max, _ := strconv.Atoi(query.Get("max-keys"))
+	if max == 0 {
+		max = 2 // so that continuation is needed
+	}
+	var keys []string
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result listResult
+	var seen []string
+	after := query.Get("continuation-token")
+	prefixes := make(map[string]bool)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= after || strings.HasSuffix(after, "/") && strings.HasPrefix(key, after) {
+			continue
+		}
+		if len(seen) == max {
+			result.IsTruncated = true
+			result.NextContinuationToken = seen[len(seen)-1]
+			break
+		}
+		if i := strings.Index(key[len(prefix):], "/"); i >= 0 {
+			p := key[:len(prefix)+i+1]
+			if prefixes[p] {
+				continue
+			}
+			prefixes[p] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, struct{ Prefix string }{p})
+			key = p
+		} else {
+			result.Contents = append(result.Contents, struct {
+				Key          string
+				LastModified time.Time
+				ETag         string
+				Size         int64
+			}{key, time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC), fmt.Sprintf(`"%d"`, len(s.objects[key])), int64(len(s.objects[key]))})
+		}
+		seen = append(seen, key)
+	}
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listResult
+	}{listResult: result})
+}
+
+func (s *fakeStorage) takeRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+func newTestBucket(t *testing.T, objects map[string]string) (*Bucket, *fakeStorage, func()) {
+	storage := &fakeStorage{bucket: "site", objects: objects}
+	srv := httptest.NewServer(storage)
+	b, err := NewBucket("s3://site/www/?endpoint=" + url.QueryEscape(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Credentials = Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	return b, storage, srv.Close
+}
+
+func TestNewBucket(t *testing.T) {
+	for i, test := range []struct {
+		location, name, prefix, region, endpoint string
+		shouldErr                                bool
+	}{
+		{"s3://site", "site", "", "us-east-1", "", false},
+		{"s3://site/www/?region=eu-west-1", "site", "www/", "eu-west-1", "", false},
+		{"s3://site/a/b?endpoint=http://localhost:9000", "site", "a/b/", "us-east-1", "http://localhost:9000", false},
+		{"gs://site/www", "site", "www/", "auto", "https://storage.googleapis.com", false},
+		{"s3:///www", "", "", "", "", true},
+		{"ftp://site/www", "", "", "", "", true},
+	} {
+		b, err := NewBucket(test.location)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		var endpoint string
+		if b.Endpoint != nil {
+			endpoint = b.Endpoint.String()
+		}
+		if b.Name != test.name || b.Prefix != test.prefix || b.Region != test.region || endpoint != test.endpoint {
+			t.Errorf("Test %d: Expected bucket %s, prefix '%s', region %s and endpoint '%s', got %s, '%s', %s and '%s'",
+				i, test.name, test.prefix, test.region, test.endpoint, b.Name, b.Prefix, b.Region, endpoint)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	b, storage, done := newTestBucket(t, map[string]string{
+		"www/index.html":       "<h1>home</h1>",
+		"www/docs/a/page.html": "0123456789",
+		"www/docs/b.txt":       "b",
+		"www/docs/c.txt":       "c",
+		"www/docs/d e.txt":     "d",
+		"other/secret.txt":     "secret",
+	})
+	defer done()
+	b.MetadataTTL = 0
+
+	f, err := b.Open("/index.html")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	content, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(content) != "<h1>home</h1>" {
+		t.Errorf("Expected index.html to contain '<h1>home</h1>', got '%s'", content)
+	}
+
+	// ranges are requested as the file is read after seeking
+	f, err = b.Open("/docs/a/page.html")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info, _ := f.Stat(); info.Name() != "page.html" || info.Size() != 10 || info.IsDir() {
+		t.Errorf("Expected info of page.html of 10 bytes, got %s of %d", info.Name(), info.Size())
+	}
+	storage.takeRequests()
+	f.Seek(4, io.SeekStart)
+	part := make([]byte, 3)
+	io.ReadFull(f, part)
+	if string(part) != "456" {
+		t.Errorf("Expected to read '456' at offset 4, got '%s'", part)
+	}
+	if requests := storage.takeRequests(); len(requests) != 1 {
+		t.Errorf("Expected one request to read, got %v", requests)
+	}
+	f.Close()
+
+	f, err = b.Open("/docs/d e.txt")
+	if err != nil {
+		t.Errorf("Expected no error opening a name with a space, got %v", err)
+	} else {
+		f.Close()
+	}
+
+	// directories are implied, and list their children
+	for dirName, expected := range map[string][]string{
+		"/":      {"docs", "index.html"},
+		"/docs":  {"a", "b.txt", "c.txt", "d e.txt"},
+		"/docs/": {"a", "b.txt", "c.txt", "d e.txt"},
+	} {
+		d, err := b.Open(dirName)
+		if err != nil {
+			t.Errorf("Expected no error opening %s, got %v", dirName, err)
+			continue
+		}
+		if info, _ := d.Stat(); !info.IsDir() {
+			t.Errorf("Expected %s to be a directory", dirName)
+		}
+		infos, err := d.Readdir(-1)
+		if err != nil {
+			t.Errorf("Expected no error listing %s, got %v", dirName, err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		if fmt.Sprint(names) != fmt.Sprint(expected) {
+			t.Errorf("Expected %s to list %v, got %v", dirName, expected, names)
+		}
+	}
+
+	for _, missing := range []string{"/nope.html", "/index.html/x", "/../other/secret.txt"} {
+		if _, err := b.Open(missing); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to exist, got %v", missing, err)
+		}
+	}
+
+	b.Credentials = Credentials{}
+	if _, err := b.Open("/index.html"); !os.IsPermission(err) {
+		t.Errorf("Expected a permission error without credentials, got %v", err)
+	}
+}
+
+func TestBucketCaching(t *testing.T) {
+	objects := map[string]string{
+		"www/index.html": "home",
+		"www/big.bin":    strings.Repeat("x", 100),
+	}
+	b, storage, done := newTestBucket(t, objects)
+	defer done()
+	b.ContentCache = 400
+
+	read := func(name string) string {
+		f, err := b.Open(name)
+		if err != nil {
+			return err.Error()
+		}
+		defer f.Close()
+		content, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err.Error()
+		}
+		return string(content)
+	}
+
+	read("/index.html")
+	if requests := storage.takeRequests(); fmt.Sprint(requests) != "[HEAD www/index.html GET www/index.html]" {
+		t.Errorf("Expected the object to be looked up and read, got %v", requests)
+	}
+	if actual := read("/index.html"); actual != "home" {
+		t.Errorf("Expected cached contents 'home', got '%s'", actual)
+	}
+	if requests := storage.takeRequests(); len(requests) != 0 {
+		t.Errorf("Expected no requests for a cached object, got %v", requests)
+	}
+
+	// objects too big for the cache are read each time
+	read("/big.bin")
+	read("/big.bin")
+	if requests := storage.takeRequests(); fmt.Sprint(requests) != "[HEAD www/big.bin GET www/big.bin GET www/big.bin]" {
+		t.Errorf("Expected a big object to be read each time, got %v", requests)
+	}
+
+	// missing objects are remembered too
+	read("/missing.html")
+	read("/missing.html")
+	if requests := storage.takeRequests(); len(requests) != 2 {
+		t.Errorf("Expected a missing object to be looked up once, got %v", requests)
+	}
+
+	// a stale entry is noticed when the object is read
+	storage.mu.Lock()
+	objects["www/big.bin"] = "changed"
+	storage.mu.Unlock()
+	if actual := read("/big.bin"); !strings.Contains(actual, "changed while being served") {
+		t.Errorf("Expected an error reading a changed object, got '%s'", actual)
+	}
+	if actual := read("/big.bin"); actual != "changed" {
+		t.Errorf("Expected the changed object to be looked up again, got '%s'", actual)
+	}
+}
+
+func TestContentCache(t *testing.T) {
+	c := newContentCache(10)
+	c.put("a", "1", []byte("aaaa"))
+	c.put("b", "1", []byte("bbbb"))
+	c.get("a", "1")
+	c.put("c", "1", []byte("cccc"))
+	if _, ok := c.get("b", "1"); ok {
+		t.Error("Expected the least recently used object to be evicted")
+	}
+	if _, ok := c.get("a", "1"); !ok {
+		t.Error("Expected the recently used object to be kept")
+	}
+	if _, ok := c.get("a", "2"); ok {
+		t.Error("Expected another version of an object not to be found")
+	}
+	if c.size != 4 {
+		t.Errorf("Expected 4 bytes to be cached, got %d", c.size)
+	}
+}
+
+func TestMetadataCache(t *testing.T) {
+	expires := time.Now().Add(time.Minute)
+	c := newMetadataCache(3)
+	c.put("a", &objectInfo{name: "a"}, expires)
+	c.put("missing1", nil, expires)
+	c.put("missing2", nil, expires)
+	c.put("b", &objectInfo{name: "b"}, expires)
+	if _, ok := c.get("missing1"); ok {
+		t.Error("Expected the oldest missing object to be evicted")
+	}
+	for _, key := range []string{"a", "missing2", "b"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+
+	// with no missing objects left, the oldest one found goes
+	c.remove("missing2")
+	c.put("c", &objectInfo{name: "c"}, expires)
+	c.put("d", &objectInfo{name: "d"}, expires)
+	if _, ok := c.get("a"); ok {
+		t.Error("Expected the oldest object to be evicted")
+	}
+	if len(c.entries) != 3 || c.found.Len() != 3 || c.missing.Len() != 0 {
+		t.Errorf("Expected 3 objects found and none missing, got %d entries, %d found and %d missing",
+			len(c.entries), c.found.Len(), c.missing.Len())
+	}
+}
@@ -0,0 +1,126 @@
+package objectstore
+
+import (
+	"container/list"
+	"time"
+)
+
+// contentCache keeps the contents of objects in memory, up to a
+// number of bytes, evicting those least recently used.
+type contentCache struct {
+	max, size int64
+	order     *list.List               // of *cachedObject, most recently used first
+	objects   map[string]*list.Element // by key
+}
+
+type cachedObject struct {
+	key, etag string
+	content   []byte
+}
+
+func newContentCache(max int64) *contentCache {
+	return &contentCache{max: max, order: list.New(), objects: make(map[string]*list.Element)}
+}
+
+// get returns the contents of the object at key, if they are
+// cached and of the version etag.
+func (c *contentCache) get(key, etag string) ([]byte, bool) {
+	elem, ok := c.objects[key]
+	if !ok {
+		return nil, false
+	}
+	obj := elem.Value.(*cachedObject)
+	if obj.etag != etag {
+		c.remove(key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return obj.content, true
+}
+
+// put caches content, of the object at key of version etag.
+func (c *contentCache) put(key, etag string, content []byte) {
+	c.remove(key)
+	if int64(len(content)) > c.max {
+		return
+	}
+	c.objects[key] = c.order.PushFront(&cachedObject{key: key, etag: etag, content: content})
+	c.size += int64(len(content))
+	for c.size > c.max {
+		c.remove(c.order.Back().Value.(*cachedObject).key)
+	}
+}
+
+// remove drops the object at key, if it is cached.
+func (c *contentCache) remove(key string) {
+	elem, ok := c.objects[key]
+	if !ok {
+		return
+	}
+	c.order.Remove(elem)
+	delete(c.objects, key)
+	c.size -= int64(len(elem.Value.(*cachedObject).content))
+}
+
+// metadataCache keeps the metadata of up to max objects. When it
+// is full, it evicts the oldest entry of an object that doesn't
+// exist, so that requests for random names evict each other rather
+// than the objects served, or the oldest entry if there is none.
+type metadataCache struct {
+	max     int
+	found   *list.List               // of *metadataEntry, newest first
+	missing *list.List               // of *metadataEntry of objects that don't exist, newest first
+	entries map[string]*list.Element // by key
+}
+
+// metadataEntry is the cached result of looking up an object.
+type metadataEntry struct {
+	key     string
+	info    *objectInfo // nil if it doesn't exist
+	expires time.Time
+}
+
+func newMetadataCache(max int) *metadataCache {
+	return &metadataCache{max: max, found: list.New(), missing: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the entry of the object at key, if it is cached.
+func (c *metadataCache) get(key string) (metadataEntry, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return metadataEntry{}, false
+	}
+	return *elem.Value.(*metadataEntry), true
+}
+
+// put caches info, which is nil if nothing is at key, until expires.
+func (c *metadataCache) put(key string, info *objectInfo, expires time.Time) {
+	c.remove(key)
+	for len(c.entries) >= c.max {
+		oldest := c.missing.Back()
+		if oldest == nil {
+			oldest = c.found.Back()
+		}
+		c.remove(oldest.Value.(*metadataEntry).key)
+	}
+	entry := &metadataEntry{key: key, info: info, expires: expires}
+	if info == nil {
+		c.entries[key] = c.missing.PushFront(entry)
+	} else {
+		c.entries[key] = c.found.PushFront(entry)
+	}
+}
+
+// remove drops the entry of the object at key, if it is cached.
+func (c *metadataCache) remove(key string) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	if elem.Value.(*metadataEntry).info == nil {
+		c.missing.Remove(elem)
+	} else {
+		c.found.Remove(elem)
+	}
+	delete(c.entries, key)
+}
@@ -0,0 +1,204 @@
+// Package onevent implements the on directive, which runs a
+// command or calls a webhook when an event occurs.
+package onevent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("on", caddy.Plugin{Action: setup})
+}
+
+// webhookTimeout limits how long a webhook may take.
+const webhookTimeout = 10 * time.Second
+
+// setup configures a handler for each use of the directive.
+func setup(c *caddy.Controller) error {
+	startup, subscriptions, err := parse(c)
+	if err != nil {
+		return err
+	}
+
+	return c.OncePerServerBlock(func() error {
+		for _, handler := range startup {
+			handler := handler
+			c.OnFirstStartup(func() error { return handler(nil) })
+		}
+		// subscribe only while this configuration is running
+		var unsubscribe []func()
+		c.OnStartup(func() error {
+			for event, handlers := range subscriptions {
+				for _, handler := range handlers {
+					unsubscribe = append(unsubscribe, caddy.Subscribe(event, handler))
+				}
+			}
+			return nil
+		})
+		c.OnShutdown(func() error {
+			for _, unsub := range unsubscribe {
+				unsub()
+			}
+			unsubscribe = nil
+			return nil
+		})
+		return nil
+	})
+}
+
+// parse parses the on directives:
+//
+//	on <event> <command> [<args...>] [&]
+//	on <event> <url>
+//
+// Commands get the event in the CADDY_EVENT environment variable
+// and its info in CADDY_EVENT_INFO; webhooks are POSTed both as
+// JSON. Commands block unless the last argument is &; webhooks
+// never do. Handlers for the startup event are returned apart,
+// since it's emitted before the Caddyfile is loaded.
+func parse(c *caddy.Controller) ([]caddy.EventHandler, map[caddy.EventName][]caddy.EventHandler, error) {
+	var startup []caddy.EventHandler
+	subscriptions := make(map[caddy.EventName][]caddy.EventHandler)
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return nil, nil, c.ArgErr()
+		}
+		event, err := parseEvent(args[0])
+		if err != nil {
+			return nil, nil, c.Err(err.Error())
+		}
+
+		var handler caddy.EventHandler
+		if len(args) == 2 && (strings.HasPrefix(args[1], "http://") || strings.HasPrefix(args[1], "https://")) {
+			handler = webhook(event, args[1])
+		} else {
+			handler, err = command(event, args[1:])
+			if err != nil {
+				return nil, nil, c.Err(err.Error())
+			}
+			// events come after the servers listen, also in a sandbox
+			caddy.AllowExec()
+		}
+
+		if event == caddy.StartupEvent {
+			startup = append(startup, handler)
+		} else {
+			subscriptions[event] = append(subscriptions[event], handler)
+		}
+	}
+	return startup, subscriptions, nil
+}
+
+// parseEvent returns the event named name.
+func parseEvent(name string) (caddy.EventName, error) {
+	var names []string
+	for _, event := range caddy.Events {
+		if string(event) == name {
+			return event, nil
+		}
+		names = append(names, string(event))
+	}
+	return "", fmt.Errorf("unknown event '%s'; must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// command returns a handler that runs the command in args.
+func command(event caddy.EventName, args []string) (caddy.EventHandler, error) {
+	nonblock := false
+	if len(args) > 1 && args[len(args)-1] == "&" {
+		// Run command in background; non-blocking
+		nonblock = true
+		args = args[:len(args)-1]
+	}
+	command, args, err := caddy.SplitCommandAndArgs(strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+	return func(info interface{}) error {
+		cmd := exec.Command(command, args...)
+		cmd.Env = append(os.Environ(), "CADDY_EVENT="+string(event), "CADDY_EVENT_INFO="+infoString(info))
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if nonblock {
+			log.Printf("[INFO] %s: Nonblocking Command:\"%s %s\"", event, command, strings.Join(args, " "))
+			if err := cmd.Start(); err != nil {
+				return err
+			}
+			go func() {
+				if err := cmd.Wait(); err != nil {
+					log.Printf("[ERROR] %s: Nonblocking Command \"%s\": %v", event, command, err)
+				}
+			}()
+			return nil
+		}
+		log.Printf("[INFO] %s: Blocking Command:\"%s %s\"", event, command, strings.Join(args, " "))
+		return cmd.Run()
+	}, nil
+}
+
+// webhook returns a handler that POSTs the event to url.
+func webhook(event caddy.EventName, url string) caddy.EventHandler {
+	client := &http.Client{Timeout: webhookTimeout}
+	return func(info interface{}) error {
+		body, err := json.Marshal(struct {
+			Event caddy.EventName `json:"event"`
+			Info  interface{}     `json:"info"`
+		}{event, describe(info)})
+		if err != nil {
+			return err
+		}
+		go func() {
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("[ERROR] %s webhook: %v", event, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				log.Printf("[ERROR] %s webhook: %s responded %s", event, url, resp.Status)
+			}
+		}()
+		return nil
+	}
+}
+
+// describe returns info in a form that can be encoded as JSON.
+func describe(info interface{}) interface{} {
+	switch v := info.(type) {
+	case caddy.Input:
+		return map[string]string{"path": v.Path(), "server_type": v.ServerType()}
+	case *caddy.Instance:
+		if input := v.Caddyfile(); input != nil {
+			return describe(input)
+		}
+		return nil
+	}
+	return info
+}
+
+// infoString returns info as a string for the environment.
+func infoString(info interface{}) string {
+	if s, ok := info.(string); ok {
+		return s
+	}
+	desc := describe(info)
+	if desc == nil {
+		return ""
+	}
+	b, err := json.Marshal(desc)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,119 @@
+package onevent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddytls"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		expectStartup int
+		expectEvents  map[caddy.EventName]int
+	}{
+		{`on startup echo hello`, false, 1, map[caddy.EventName]int{}},
+		{`on cert_obtained https://example.com/hook`, false, 0, map[caddy.EventName]int{caddy.CertObtainedEvent: 1}},
+		{`on config_loaded echo loaded &
+		  on config_loaded http://localhost/hook
+		  on shutdown echo bye`, false, 0, map[caddy.EventName]int{caddy.ConfigLoadedEvent: 2, caddy.ShutdownEvent: 1}},
+		{`on startup`, true, 0, nil},
+		{`on`, true, 0, nil},
+		{`on restart echo hello`, true, 0, nil},
+	} {
+		startup, subscriptions, err := parse(caddy.NewTestController("http", test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if len(startup) != test.expectStartup {
+			t.Errorf("Test %d: Expected %d startup handlers, got %d", i, test.expectStartup, len(startup))
+		}
+		if len(subscriptions) != len(test.expectEvents) {
+			t.Errorf("Test %d: Expected handlers for %d events, got %d", i, len(test.expectEvents), len(subscriptions))
+		}
+		for event, n := range test.expectEvents {
+			if len(subscriptions[event]) != n {
+				t.Errorf("Test %d: Expected %d handlers for %s, got %d", i, n, event, len(subscriptions[event]))
+			}
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onevent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newDir := filepath.Join(dir, "made")
+
+	handler, err := command(caddy.ShutdownEvent, []string{"mkdir", newDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handler("SIGQUIT"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(newDir); err != nil {
+		t.Errorf("Expected command to have run, got: %v", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+	}))
+	defer srv.Close()
+
+	handler := webhook(caddy.CertExpiringEvent, srv.URL)
+	err := handler(caddytls.CertificateEvent{Names: []string{"example.com"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	select {
+	case body := <-received:
+		if body["event"] != "cert_expiring" {
+			t.Errorf("Expected event cert_expiring, got %v", body["event"])
+		}
+		info, _ := body["info"].(map[string]interface{})
+		if names, _ := info["names"].([]interface{}); len(names) != 1 || names[0] != "example.com" {
+			t.Errorf("Expected names [example.com], got %v", info["names"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected webhook to be called")
+	}
+}
+
+func TestInfoString(t *testing.T) {
+	for i, test := range []struct {
+		info   interface{}
+		expect string
+	}{
+		{nil, ""},
+		{"SIGTERM", "SIGTERM"},
+		{caddy.CaddyfileInput{Filepath: "Caddyfile", ServerTypeName: "http"}, `{"path":"Caddyfile","server_type":"http"}`},
+	} {
+		if actual := infoString(test.info); actual != test.expect {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package caddy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OrderDirectives returns the directives of serverType in the
+// order in which they execute. It starts from base, the order
+// given by the server type, and adds the directives of plugins
+// that declare where they belong with Plugin.Before or
+// Plugin.After, moving them as little as possible to satisfy
+// every such constraint. Constraints relative to directives
+// that are not known are ignored, since those plugins may
+// simply not be plugged in. It is an error for constraints to
+// contradict each other.
+func OrderDirectives(serverType string, base []string) ([]string, error) {
+	// priority is where a directive would go without
+	// constraints; base directives keep their position
+	priority := make(map[string]float64)
+	for i, dir := range base {
+		priority[dir] = float64(i)
+	}
+
+	var constrained []string
+	for name, p := range plugins[serverType] {
+		if p.Action != nil && (len(p.Before) > 0 || len(p.After) > 0) {
+			constrained = append(constrained, name)
+		}
+	}
+	sort.Strings(constrained)
+
+	// place new directives right after the last directive they
+	// follow or, failing that, right before the first one they
+	// precede, or else at the end; those relative to other new
+	// directives are placed once those are
+	unplaced := make(map[string]bool)
+	for _, name := range constrained {
+		if _, ok := priority[name]; !ok {
+			unplaced[name] = true
+		}
+	}
+	for progress := true; progress; {
+		progress = false
+		for _, name := range constrained {
+			if !unplaced[name] {
+				continue
+			}
+			if pos, ok := placement(plugins[serverType][name], priority); ok {
+				priority[name] = pos
+				delete(unplaced, name)
+				progress = true
+			}
+		}
+	}
+	for name := range unplaced {
+		priority[name] = float64(len(base))
+	}
+
+	// edges[a] lists the directives that must run after a
+	edges := make(map[string][]string)
+	inDegree := make(map[string]int)
+	for dir := range priority {
+		inDegree[dir] = 0
+	}
+	addEdge := func(from, to string) {
+		if _, ok := priority[from]; !ok {
+			return
+		}
+		if _, ok := priority[to]; !ok {
+			return
+		}
+		edges[from] = append(edges[from], to)
+		inDegree[to]++
+	}
+	// the server type's order holds among the directives
+	// that don't declare their own position
+	var prev string
+	for _, dir := range base {
+		if isConstrained(serverType, dir) {
+			continue
+		}
+		if prev != "" {
+			addEdge(prev, dir)
+		}
+		prev = dir
+	}
+	for _, name := range constrained {
+		p := plugins[serverType][name]
+		for _, before := range p.Before {
+			addEdge(name, before)
+		}
+		for _, after := range p.After {
+			addEdge(after, name)
+		}
+	}
+
+	// repeatedly take the ready directive that comes first
+	var ready []string
+	for dir, n := range inDegree {
+		if n == 0 {
+			ready = append(ready, dir)
+		}
+	}
+	less := func(a, b string) bool {
+		if priority[a] != priority[b] {
+			return priority[a] < priority[b]
+		}
+		return a < b
+	}
+	ordered := make([]string, 0, len(priority))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(ready[i], ready[j]) })
+		dir := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, dir)
+		for _, next := range edges[dir] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	if len(ordered) < len(priority) {
+		// what's left are cycles and the directives after them;
+		// peel off the latter to report only the former
+		left := make(map[string]bool)
+		for dir, n := range inDegree {
+			if n > 0 {
+				left[dir] = true
+			}
+		}
+		for peeled := true; peeled; {
+			peeled = false
+			for dir := range left {
+				sink := true
+				for _, next := range edges[dir] {
+					if left[next] {
+						sink = false
+						break
+					}
+				}
+				if sink {
+					delete(left, dir)
+					peeled = true
+				}
+			}
+		}
+		var cycle []string
+		for dir := range left {
+			cycle = append(cycle, dir)
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("ordering constraints of %s directives contradict each other: %s",
+			serverType, strings.Join(cycle, ", "))
+	}
+	return ordered, nil
+}
+
+// isConstrained returns whether the directive name of serverType
+// declares its own position, in which case its place in the
+// server type's list is only a default.
+func isConstrained(serverType, name string) bool {
+	p, ok := plugins[serverType][name]
+	return ok && (len(p.Before) > 0 || len(p.After) > 0)
+}
+
+// placement returns the priority of a new directive declared
+// by p: just after the last directive it follows or, if none of
+// those are placed yet, just before the first one it precedes.
+// It returns false if none of them are placed.
+func placement(p Plugin, priority map[string]float64) (float64, bool) {
+	var pos float64
+	var found bool
+	for _, after := range p.After {
+		if prio, ok := priority[after]; ok && (!found || prio > pos) {
+			pos, found = prio, true
+		}
+	}
+	if found {
+		next := pos + 1
+		for _, prio := range priority {
+			if prio > pos && prio < next {
+				next = prio
+			}
+		}
+		return (pos + next) / 2, true
+	}
+	for _, before := range p.Before {
+		if prio, ok := priority[before]; ok && (!found || prio < pos) {
+			pos, found = prio, true
+		}
+	}
+	if found {
+		prev := pos - 1
+		for _, prio := range priority {
+			if prio < pos && prio > prev {
+				prev = prio
+			}
+		}
+		return (prev + pos) / 2, true
+	}
+	return 0, false
+}
+
+// directivesOf returns the directives of the server type
+// stype, named serverType, in execution order.
+func directivesOf(serverType string, stype ServerType) ([]string, error) {
+	return OrderDirectives(serverType, stype.Directives())
+}
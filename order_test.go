@@ -0,0 +1,93 @@
+package caddy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderDirectives(t *testing.T) {
+	const stype = "ordertest"
+	action := func(c *Controller) error { return nil }
+	base := []string{"a", "b", "c", "d"}
+
+	for i, test := range []struct {
+		plugins     map[string]Plugin
+		expect      []string
+		expectError string
+	}{
+		{
+			expect: []string{"a", "b", "c", "d"},
+		},
+		{
+			// new directives are placed next to their constraints
+			plugins: map[string]Plugin{
+				"x": {Action: action, After: []string{"b"}},
+				"y": {Action: action, Before: []string{"b"}},
+				"z": {Action: action},
+			},
+			expect: []string{"a", "y", "b", "x", "c", "d"},
+		},
+		{
+			// several constraints are all satisfied
+			plugins: map[string]Plugin{
+				"x": {Action: action, After: []string{"a", "c"}, Before: []string{"d"}},
+			},
+			expect: []string{"a", "b", "c", "x", "d"},
+		},
+		{
+			// constraints relative to unknown directives are ignored
+			plugins: map[string]Plugin{
+				"x": {Action: action, After: []string{"missing"}, Before: []string{"c"}},
+				"y": {Action: action, Before: []string{"missing"}},
+			},
+			expect: []string{"a", "b", "x", "c", "d", "y"},
+		},
+		{
+			// a directive in the list can move itself
+			plugins: map[string]Plugin{
+				"b": {Action: action, After: []string{"d"}},
+			},
+			expect: []string{"a", "c", "d", "b"},
+		},
+		{
+			// new directives can depend on each other
+			plugins: map[string]Plugin{
+				"x": {Action: action, After: []string{"y"}},
+				"y": {Action: action, After: []string{"c"}},
+			},
+			expect: []string{"a", "b", "c", "y", "x", "d"},
+		},
+		{
+			plugins: map[string]Plugin{
+				"x": {Action: action, After: []string{"c"}, Before: []string{"a"}},
+			},
+			expectError: "contradict each other: a, b, c, x",
+		},
+		{
+			// plugins without an action aren't directives
+			plugins: map[string]Plugin{
+				"x": {After: []string{"a"}},
+			},
+			expect: []string{"a", "b", "c", "d"},
+		},
+	} {
+		plugins[stype] = test.plugins
+		actual, err := OrderDirectives(stype, base)
+		delete(plugins, stype)
+
+		if test.expectError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectError) {
+				t.Errorf("Test %d: Expected error containing '%s', got: %v", i, test.expectError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expect) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expect, actual)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"sort"
+	"sync"
 
 	"github.com/mholt/caddy/caddyfile"
 )
@@ -83,6 +84,20 @@ func DescribePlugins() string {
 	return str
 }
 
+// ListPlugins returns the names of the registered plugins, in
+// alphabetical order, keyed by server type; plugins that aren't
+// associated with a server type are under the empty string.
+func ListPlugins() map[string][]string {
+	list := make(map[string][]string)
+	for stype, stypePlugins := range plugins {
+		for name := range stypePlugins {
+			list[stype] = append(list[stype], name)
+		}
+		sort.Strings(list[stype])
+	}
+	return list
+}
+
 // ValidDirectives returns the list of all directives that are
 // recognized for the server type serverType. However, not all
 // directives may be installed. This makes it possible to give
@@ -93,7 +108,12 @@ func ValidDirectives(serverType string) []string {
 	if err != nil {
 		return nil
 	}
-	return stype.Directives()
+	dirs, err := directivesOf(serverType, stype)
+	if err != nil {
+		// reported when the directives are executed
+		return stype.Directives()
+	}
+	return dirs
 }
 
 // ServerListener pairs a server to its listener and/or packetconn.
@@ -162,7 +182,8 @@ type ServerType struct {
 	// Function that returns the list of directives, in
 	// execution order, that are valid for this server
 	// type. Directives should be one word if possible
-	// and lower-cased.
+	// and lower-cased. Plugins may add to this list and
+	// change its order; see Plugin.Before and Plugin.After.
 	Directives func() []string
 
 	// DefaultInput returns a default config input if none
@@ -190,6 +211,18 @@ type Plugin struct {
 	// Action is the plugin's setup function, if associated
 	// with a directive in the Caddyfile.
 	Action SetupFunc
+
+	// Deprecated, if set, marks the plugin's directive as
+	// deprecated and explains what to use instead.
+	Deprecated string
+
+	// Before and After list the directives that the plugin's
+	// directive must execute before and after, respectively.
+	// A directive that declares either is added to the server
+	// type's list of directives in a place that satisfies them,
+	// so it doesn't have to be in the list already.
+	Before []string
+	After  []string
 }
 
 // RegisterPlugin plugs in plugin. All plugins should register
@@ -217,12 +250,55 @@ func RegisterPlugin(name string, plugin Plugin) {
 // EventName represents the name of an event used with event hooks.
 type EventName string
 
-// Define the event names for the startup and shutdown events
+// Define the event names. The info passed with each event is
+// given in parentheses.
 const (
-	StartupEvent  EventName = "startup"
+	// StartupEvent is emitted when the process starts, before
+	// the Caddyfile is loaded (nil).
+	StartupEvent EventName = "startup"
+
+	// ShutdownEvent is emitted when the process is about to
+	// exit (the name of the signal or other cause, a string).
 	ShutdownEvent EventName = "shutdown"
+
+	// ConfigLoadedEvent is emitted when a Caddyfile has been
+	// loaded and its servers started (the Input).
+	ConfigLoadedEvent EventName = "config_loaded"
+
+	// InstanceRestartedEvent is emitted when an instance has
+	// been replaced by a new one on reload (the new *Instance).
+	InstanceRestartedEvent EventName = "instance_restarted"
+
+	// CertObtainedEvent is emitted when a certificate has been
+	// obtained or renewed (a caddytls.CertificateEvent).
+	CertObtainedEvent EventName = "cert_obtained"
+
+	// CertExpiringEvent is emitted when a managed certificate
+	// is due for renewal (a caddytls.CertificateEvent).
+	CertExpiringEvent EventName = "cert_expiring"
+
+	// WebhookEvent is emitted when a webhook that is to be
+	// published has been received (a webhook.Delivery).
+	WebhookEvent EventName = "webhook"
+
+	// PanicEvent is emitted when a panic has been recovered
+	// while handling a request, by a recover directive set to
+	// emit it (an *httpserver.Panic).
+	PanicEvent EventName = "panic"
 )
 
+// Events lists the names of all events.
+var Events = []EventName{
+	StartupEvent,
+	ShutdownEvent,
+	ConfigLoadedEvent,
+	InstanceRestartedEvent,
+	CertObtainedEvent,
+	CertExpiringEvent,
+	WebhookEvent,
+	PanicEvent,
+}
+
 // EventHook is a type which holds information about a startup hook plugin.
 type EventHook func(eventType EventName, eventInfo interface{}) error
 
@@ -238,9 +314,40 @@ func RegisterEventHook(name string, hook EventHook) {
 	eventHooks[name] = hook
 }
 
+// EventHandler handles an event; what info is depends on the event.
+type EventHandler func(info interface{}) error
+
+// eventSubscription is a handler subscribed to an event.
+type eventSubscription struct {
+	event   EventName
+	handler EventHandler
+}
+
+var (
+	eventSubscriptions   = make(map[*eventSubscription]struct{})
+	eventSubscriptionsMu sync.Mutex
+)
+
+// Subscribe calls handler every time event is emitted, until
+// the returned function is called. Unlike event hooks, which
+// are registered once per process, subscriptions can come and
+// go, for example with the configuration that asked for them.
+func Subscribe(event EventName, handler EventHandler) (unsubscribe func()) {
+	sub := &eventSubscription{event: event, handler: handler}
+	eventSubscriptionsMu.Lock()
+	eventSubscriptions[sub] = struct{}{}
+	eventSubscriptionsMu.Unlock()
+	return func() {
+		eventSubscriptionsMu.Lock()
+		delete(eventSubscriptions, sub)
+		eventSubscriptionsMu.Unlock()
+	}
+}
+
 // EmitEvent executes the different hooks passing the EventType as an
-// argument. This is a blocking function. Hook developers should
-// use 'go' keyword if they don't want to block Caddy.
+// argument, then the handlers subscribed to event. This is a blocking
+// function. Hook developers should use 'go' keyword if they don't
+// want to block Caddy.
 func EmitEvent(event EventName, info interface{}) {
 	for name, hook := range eventHooks {
 		err := hook(event, info)
@@ -249,6 +356,20 @@ func EmitEvent(event EventName, info interface{}) {
 			log.Printf("error on '%s' hook: %v", name, err)
 		}
 	}
+
+	var handlers []EventHandler
+	eventSubscriptionsMu.Lock()
+	for sub := range eventSubscriptions {
+		if sub.event == event {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	eventSubscriptionsMu.Unlock()
+	for _, handler := range handlers {
+		if err := handler(info); err != nil {
+			log.Printf("[ERROR] Handling %s event: %v", event, err)
+		}
+	}
 }
 
 // ParsingCallback is a function that is called after
@@ -287,6 +408,18 @@ func DirectiveAction(serverType, dir string) (SetupFunc, error) {
 		dir, serverType)
 }
 
+// directiveDeprecation returns the deprecation message of
+// directive dir of server type serverType, or "" if it is
+// not deprecated.
+func directiveDeprecation(serverType, dir string) string {
+	for _, stype := range []string{serverType, ""} {
+		if plugin, ok := plugins[stype][dir]; ok {
+			return plugin.Deprecated
+		}
+	}
+	return ""
+}
+
 // Loader is a type that can load a Caddyfile.
 // It is passed the name of the server type.
 // It returns an error only if something went
@@ -0,0 +1,263 @@
+package caddy
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Privileges are what the process keeps once its servers are
+// listening: it can be started as root to bind privileged ports,
+// then run as User from then on.
+type Privileges struct {
+	// User is the name or ID of the user to run as, and Group that
+	// of the group; the primary group of User if empty.
+	User  string
+	Group string
+
+	// Chroot, if not empty, is the directory the process is
+	// confined to. The assets path must be inside it.
+	Chroot string
+
+	// Landlock is whether the process is confined, using Landlock
+	// on Linux, to writing to the assets path and to the folders
+	// of the writable paths.
+	Landlock bool
+
+	// Sandbox is whether the process is confined, on Linux, to
+	// reading the readable paths and writing as for Landlock, and
+	// to the system calls a server needs.
+	Sandbox bool
+}
+
+// String returns p as user[:group], with its confinement.
+func (p Privileges) String() string {
+	s := p.User
+	if s == "" {
+		s = "the current user"
+	}
+	if p.Group != "" {
+		s += ":" + p.Group
+	}
+	if p.Chroot != "" {
+		s += " in " + p.Chroot
+	}
+	if p.Landlock {
+		s += " with Landlock"
+	}
+	if p.Sandbox {
+		s += " in a sandbox"
+	}
+	return s
+}
+
+var (
+	// writablePaths are the files that the process writes to, such
+	// as logs, which are given to the user privileges are dropped to.
+	writablePaths = make(map[string]bool)
+
+	// writableDirs are the folders that the process writes files
+	// in, such as caches, which are given to the user privileges are
+	// dropped to, with what is in them, unless anyone may write to
+	// them already, as to the temporary folder.
+	writableDirs = make(map[string]bool)
+
+	// readablePaths are the files and folders, such as site roots,
+	// that the process reads from in a sandbox.
+	readablePaths = make(map[string]bool)
+
+	// execAllowed is whether the sandbox lets the process run
+	// commands.
+	execAllowed bool
+
+	// dropped are the privileges dropped to, if they were.
+	dropped *Privileges
+
+	// chroot is the folder the process is to be confined to once
+	// privileges are dropped, if any.
+	chroot string
+
+	privilegesMu sync.Mutex
+)
+
+// RegisterWritablePath registers path as a file that the process
+// writes to, so that it stays writable once privileges are dropped.
+// Files registered after that must be writable by the user already.
+func RegisterWritablePath(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	privilegesMu.Lock()
+	writablePaths[path] = true
+	privilegesMu.Unlock()
+}
+
+// RegisterWritableDir registers dir as a folder that the process
+// writes files in, so that it stays writable once privileges are
+// dropped. It is made then if it doesn't exist.
+func RegisterWritableDir(dir string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	privilegesMu.Lock()
+	writableDirs[dir] = true
+	privilegesMu.Unlock()
+}
+
+// RegisterReadablePath registers path, a file or a folder, as read
+// by the process, so that it stays readable in a sandbox.
+func RegisterReadablePath(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	privilegesMu.Lock()
+	readablePaths[path] = true
+	privilegesMu.Unlock()
+}
+
+// Writable returns whether path was registered as written to, or is
+// in a folder that was.
+func Writable(path string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	privilegesMu.Lock()
+	defer privilegesMu.Unlock()
+	if writablePaths[path] {
+		return true
+	}
+	for dir := range writableDirs {
+		if _, ok := pathInChroot(dir, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Readable returns whether path was registered as read, or is in a
+// folder that was.
+func Readable(path string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	privilegesMu.Lock()
+	defer privilegesMu.Unlock()
+	for p := range readablePaths {
+		if _, ok := pathInChroot(p, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowExec records that the process runs commands, so that a
+// sandbox lets it, and lets the commands read the system folders.
+func AllowExec() {
+	privilegesMu.Lock()
+	execAllowed = true
+	privilegesMu.Unlock()
+}
+
+// PlanChroot records dir as the folder the process is to be confined
+// to once privileges are dropped, so that paths can be checked for it
+// at setup with CheckChroot.
+func PlanChroot(dir string) {
+	if abs, err := filepath.Abs(dir); err == nil && dir != "" {
+		dir = abs
+	}
+	privilegesMu.Lock()
+	chroot = dir
+	privilegesMu.Unlock()
+}
+
+// CheckChroot returns an error if path, such as a site root, can't be
+// reached by the same name from inside the folder the process is to
+// be confined to: it must be inside, and relative, the process being
+// run from there, since the folder becomes / and the working folder.
+// Once privileges are dropped, or in an upgraded process, paths are
+// those seen from inside already, so they aren't checked.
+func CheckChroot(path string) error {
+	privilegesMu.Lock()
+	dir, done := chroot, dropped != nil
+	privilegesMu.Unlock()
+	if dir == "" || done || IsUpgrade() {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	inside, ok := pathInChroot(dir, abs)
+	if !ok {
+		return fmt.Errorf("%s is outside the chroot %s", path, dir)
+	}
+	seen := filepath.Clean(path)
+	if !filepath.IsAbs(seen) {
+		seen = filepath.Join(string(filepath.Separator), seen)
+	}
+	if seen != inside {
+		return fmt.Errorf("%s must be given as it is inside the chroot %s, relative to it and with the process run from there", path, dir)
+	}
+	return nil
+}
+
+// access is what a process needs once its privileges are dropped.
+type access struct {
+	read      []string // files and folders read
+	write     []string // files written, in folders written
+	writeDirs []string // folders written in
+	exec      bool     // whether commands are run
+}
+
+// DropPrivileges makes the process run with the privileges p, for
+// good; without a user, it keeps its user, but is still confined.
+// The assets path and the writable paths are given to the user
+// first, and the writable folders too unless anyone may write to
+// them. Since privileges can only be dropped once, later calls do
+// nothing, unless they are for other privileges, which is an error.
+func DropPrivileges(p Privileges) error {
+	privilegesMu.Lock()
+	defer privilegesMu.Unlock()
+	if dropped != nil {
+		if *dropped != p {
+			return fmt.Errorf("privileges were already dropped to %s", dropped)
+		}
+		return nil
+	}
+	if p == (Privileges{}) {
+		return fmt.Errorf("no privileges to drop")
+	}
+
+	acc := access{exec: execAllowed}
+	for path := range readablePaths {
+		acc.read = append(acc.read, path)
+	}
+	for path := range writablePaths {
+		acc.write = append(acc.write, path)
+	}
+	for dir := range writableDirs {
+		acc.writeDirs = append(acc.writeDirs, dir)
+	}
+	sort.Strings(acc.read)
+	sort.Strings(acc.write)
+	sort.Strings(acc.writeDirs)
+	if err := dropPrivileges(p, acc); err != nil {
+		return fmt.Errorf("dropping privileges to %s: %v", p, err)
+	}
+	dropped = &p
+	log.Printf("[INFO] Dropped privileges to %s", p)
+	return nil
+}
+
+// pathInChroot returns path as it is seen from inside the chroot
+// dir, and whether it is inside at all. Both must be absolute.
+func pathInChroot(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(string(filepath.Separator), rel), true
+}
@@ -0,0 +1,98 @@
+// Package privileges implements the privileges directive, which
+// drops the privileges of the process once its servers are
+// listening, so that it can bind privileged ports as root without
+// serving as root, and can confine it to what its configuration
+// needs.
+package privileges
+
+import (
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("privileges", caddy.Plugin{Action: setup})
+}
+
+// Flags are the privileges given on the command line, which take
+// the place of any in the Caddyfile.
+var Flags caddy.Privileges
+
+// setup drops privileges once the servers first listen. Reloads
+// don't drop them again, so they can't bind other privileged ports.
+func setup(c *caddy.Controller) error {
+	p, err := parse(c)
+	if err != nil {
+		return err
+	}
+	if Flags == (caddy.Privileges{}) {
+		// site roots are checked for it as servers are made
+		caddy.PlanChroot(p.Chroot)
+	}
+	return c.OncePerServerBlock(func() error {
+		c.OnFirstStartupComplete(func() error {
+			if Flags != (caddy.Privileges{}) {
+				return caddy.DropPrivileges(Flags)
+			}
+			return caddy.DropPrivileges(p)
+		})
+		return nil
+	})
+}
+
+// parse parses
+//
+//	privileges [user [group]] {
+//		chroot dir
+//		landlock
+//		sandbox
+//	}
+//
+// where the user and group are names or IDs, the group being the
+// primary group of the user by default. Without a user, the process
+// keeps its own, but is confined all the same.
+func parse(c *caddy.Controller) (caddy.Privileges, error) {
+	var p caddy.Privileges
+	for c.Next() {
+		if p != (caddy.Privileges{}) {
+			return p, c.Err("privileges can only be given once per site")
+		}
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return p, c.ArgErr()
+		}
+		if len(args) > 0 {
+			p.User = args[0]
+		}
+		if len(args) > 1 {
+			p.Group = args[1]
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "chroot":
+				if !c.NextArg() {
+					return p, c.ArgErr()
+				}
+				p.Chroot = c.Val()
+				if c.NextArg() {
+					return p, c.ArgErr()
+				}
+			case "landlock":
+				if c.NextArg() {
+					return p, c.ArgErr()
+				}
+				p.Landlock = true
+			case "sandbox":
+				if c.NextArg() {
+					return p, c.ArgErr()
+				}
+				p.Sandbox = true
+			default:
+				return p, c.Errf("Unknown privileges property '%s'", c.Val())
+			}
+		}
+		if p == (caddy.Privileges{}) {
+			return p, c.ArgErr()
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,48 @@
+package privileges
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  caddy.Privileges
+	}{
+		{`privileges www`, false, caddy.Privileges{User: "www"}},
+		{`privileges 33 33`, false, caddy.Privileges{User: "33", Group: "33"}},
+		{`privileges www web {
+			chroot /srv
+			landlock
+		}`, false, caddy.Privileges{User: "www", Group: "web", Chroot: "/srv", Landlock: true}},
+		{"privileges {\n sandbox\n}", false, caddy.Privileges{Sandbox: true}},
+		{`privileges`, true, caddy.Privileges{}},
+		{"privileges {\n}", true, caddy.Privileges{}},
+		{"privileges www {\n sandbox yes\n}", true, caddy.Privileges{}},
+		{`privileges www web extra`, true, caddy.Privileges{}},
+		{"privileges www {\n chroot\n}", true, caddy.Privileges{}},
+		{"privileges www {\n chroot /a /b\n}", true, caddy.Privileges{}},
+		{"privileges www {\n landlock yes\n}", true, caddy.Privileges{}},
+		{"privileges www {\n setuid\n}", true, caddy.Privileges{}},
+		{"privileges www\nprivileges nobody", true, caddy.Privileges{}},
+	} {
+		c := caddy.NewTestController("", test.input)
+		actual, err := parse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
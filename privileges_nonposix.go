@@ -0,0 +1,11 @@
+// +build windows plan9 nacl
+
+package caddy
+
+import "errors"
+
+// dropPrivileges returns an error, since privileges can't be
+// dropped on this platform.
+func dropPrivileges(p Privileges, acc access) error {
+	return errors.New("dropping privileges is not supported on this platform")
+}
@@ -0,0 +1,170 @@
+// +build !windows,!plan9,!nacl
+
+package caddy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// dropPrivileges gives the assets path and the files and folders
+// written to the user of p, confines the process to acc as p says, and then changes
+// its user and group, after which root privileges can't be regained.
+func dropPrivileges(p Privileges, acc access) error {
+	uid, gid, err := lookupPrivileges(p)
+	if err != nil {
+		return err
+	}
+
+	assets, err := filepath.Abs(AssetsPath())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(assets, 0700); err != nil {
+		return err
+	}
+	if err := chownAll(assets, uid, gid); err != nil {
+		return err
+	}
+	for _, file := range acc.write {
+		if err := os.Chown(file, uid, gid); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, dir := range acc.writeDirs {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if fi.Mode().Perm()&0002 != 0 {
+			continue // such as the temporary folder
+		}
+		if err := chownAll(dir, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	// the paths are opened now, so that they are found outside
+	// the chroot, and the restrictions enforced once the user has
+	// changed, since they would prevent it
+	dirs := []string{assets}
+	for _, file := range acc.write {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	dirs = append(dirs, acc.writeDirs...)
+	var restrict func() error
+	switch {
+	case p.Sandbox:
+		restrict, err = sandbox(acc.read, dirs, acc.exec)
+	case p.Landlock:
+		restrict, err = landlockWrites(dirs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.Chroot != "" {
+		dir, err := filepath.Abs(p.Chroot)
+		if err != nil {
+			return err
+		}
+		inside, ok := pathInChroot(dir, assets)
+		if !ok {
+			return fmt.Errorf("the assets path %s must be inside the chroot %s; set CADDYPATH", assets, dir)
+		}
+		for _, file := range acc.write {
+			if _, ok := pathInChroot(dir, file); !ok {
+				log.Printf("[WARNING] %s is outside the chroot %s, so it can't be reopened to rotate it", file, dir)
+			}
+		}
+		for _, wd := range acc.writeDirs {
+			if _, ok := pathInChroot(dir, wd); !ok {
+				log.Printf("[WARNING] %s is outside the chroot %s, so files can't be written in it", wd, dir)
+			}
+		}
+		if err := syscall.Chroot(dir); err != nil {
+			return err
+		}
+		if err := os.Chdir("/"); err != nil {
+			return err
+		}
+		// the assets, such as certificates, are found inside
+		if err := os.Setenv("CADDYPATH", inside); err != nil {
+			return err
+		}
+	}
+
+	if uid != os.Getuid() || gid != os.Getgid() {
+		if err := syscall.Setgroups([]int{gid}); err != nil {
+			return err
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return err
+		}
+		if err := syscall.Setuid(uid); err != nil {
+			return err
+		}
+	}
+	if restrict != nil {
+		if err := restrict(); err != nil {
+			return err
+		}
+	}
+	if uid != 0 && syscall.Setuid(0) == nil {
+		return errors.New("root privileges could be regained")
+	}
+	return nil
+}
+
+// lookupPrivileges returns the user and group IDs of p, whose user
+// and group may be given by name or ID; they are those of the
+// process if not given.
+func lookupPrivileges(p Privileges) (uid, gid int, err error) {
+	if p.User == "" && p.Group == "" {
+		return os.Getuid(), os.Getgid(), nil
+	}
+	u := &user.User{Uid: strconv.Itoa(os.Getuid()), Gid: strconv.Itoa(os.Getgid())}
+	if p.User != "" {
+		if u, err = user.Lookup(p.User); err != nil {
+			if u, err = user.LookupId(p.User); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	groupID := u.Gid
+	if p.Group != "" {
+		g, err := user.LookupGroup(p.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(p.Group); err != nil {
+				return 0, 0, err
+			}
+		}
+		groupID = g.Gid
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, err
+	}
+	if gid, err = strconv.Atoi(groupID); err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
+
+// chownAll changes the owner of dir and everything in it.
+func chownAll(dir string, uid, gid int) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
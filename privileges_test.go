@@ -0,0 +1,128 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrivilegesString(t *testing.T) {
+	for i, test := range []struct {
+		p        Privileges
+		expected string
+	}{
+		{Privileges{User: "www"}, "www"},
+		{Privileges{User: "www", Group: "web", Chroot: "/srv", Landlock: true}, "www:web in /srv with Landlock"},
+		{Privileges{Sandbox: true}, "the current user in a sandbox"},
+	} {
+		if actual := test.p.String(); actual != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, actual)
+		}
+	}
+}
+
+func TestDropPrivilegesOnce(t *testing.T) {
+	if err := DropPrivileges(Privileges{}); err == nil {
+		t.Error("Expected an error without privileges to drop")
+	}
+
+	defer func() { dropped = nil }()
+	dropped = &Privileges{User: "www"}
+	if err := DropPrivileges(Privileges{User: "www"}); err != nil {
+		t.Errorf("Expected dropping to the same privileges again to do nothing, got %v", err)
+	}
+	err := DropPrivileges(Privileges{User: "nobody"})
+	if err == nil || !strings.Contains(err.Error(), "already dropped to www") {
+		t.Errorf("Expected an error dropping to other privileges, got %v", err)
+	}
+}
+
+func TestPathInChroot(t *testing.T) {
+	for i, test := range []struct {
+		dir, path string
+		expected  string
+		inside    bool
+	}{
+		{"/srv/caddy", "/srv/caddy/.caddy", "/.caddy", true},
+		{"/srv/caddy", "/srv/caddy", "/", true},
+		{"/srv/caddy", "/srv/caddyfiles/.caddy", "", false},
+		{"/srv/caddy", "/root/.caddy", "", false},
+		{"/srv/caddy", "/srv/caddy/../..foo", "", false},
+	} {
+		actual, inside := pathInChroot(test.dir, test.path)
+		if actual != test.expected || inside != test.inside {
+			t.Errorf("Test %d: Expected %q, %t, got %q, %t", i, test.expected, test.inside, actual, inside)
+		}
+	}
+}
+
+func TestWritableAndReadable(t *testing.T) {
+	RegisterWritablePath("/var/log/caddy/test.log")
+	RegisterWritableDir("/var/cache/caddy-test")
+	RegisterReadablePath("/srv/caddy-test")
+	for i, test := range []struct {
+		path               string
+		writable, readable bool
+	}{
+		{"/var/log/caddy/test.log", true, false},
+		{"/var/log/caddy/other.log", false, false},
+		{"/var/cache/caddy-test/ab/cd", true, false},
+		{"/var/cache/caddy-testing", false, false},
+		{"/srv/caddy-test/index.html", false, true},
+		{"/srv", false, false},
+	} {
+		if actual := Writable(test.path); actual != test.writable {
+			t.Errorf("Test %d: Expected %s writable to be %t, got %t", i, test.path, test.writable, actual)
+		}
+		if actual := Readable(test.path); actual != test.readable {
+			t.Errorf("Test %d: Expected %s readable to be %t, got %t", i, test.path, test.readable, actual)
+		}
+	}
+}
+
+func TestCheckChroot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer PlanChroot("")
+
+	PlanChroot("")
+	if err := CheckChroot("/anywhere"); err != nil {
+		t.Errorf("Expected no error without a chroot, got %v", err)
+	}
+
+	PlanChroot(wd)
+	for i, test := range []struct {
+		path      string
+		shouldErr bool
+	}{
+		{".", false},
+		{"www", false},
+		{"www/../site", false},
+		{"..", true},
+		{"../www", true},
+		{filepath.Join(wd, "www"), true},
+		{"/srv", true},
+	} {
+		err := CheckChroot(test.path)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected an error for %s, got none", i, test.path)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no error for %s, got %v", i, test.path, err)
+		}
+	}
+
+	PlanChroot("/")
+	if err := CheckChroot("/srv/www"); err != nil {
+		t.Errorf("Expected no error for an absolute path in /, got %v", err)
+	}
+
+	defer func() { dropped = nil }()
+	dropped = &Privileges{Chroot: wd}
+	PlanChroot(wd)
+	if err := CheckChroot("/www"); err != nil {
+		t.Errorf("Expected paths not to be checked once privileges are dropped, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package caddy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReadinessCheck returns an error if something that Caddy
+// depends on is not ready, for example if no upstream of a
+// proxy is available. It must be safe for concurrent use.
+type ReadinessCheck func() error
+
+var (
+	readinessChecks   = make(map[string]ReadinessCheck)
+	readinessChecksMu sync.Mutex
+)
+
+func init() {
+	RegisterReadinessCheck("config", checkConfigLoaded)
+}
+
+// RegisterReadinessCheck registers check with the given name,
+// replacing any check already registered with that name.
+// Plugins typically register their checks in init.
+func RegisterReadinessCheck(name string, check ReadinessCheck) {
+	readinessChecksMu.Lock()
+	readinessChecks[name] = check
+	readinessChecksMu.Unlock()
+}
+
+// CheckReadiness runs all the readiness checks concurrently and
+// returns their results by name; a nil error means the check
+// passed. Checks that have not finished within timeout fail.
+func CheckReadiness(timeout time.Duration) map[string]error {
+	readinessChecksMu.Lock()
+	checks := make(map[string]ReadinessCheck, len(readinessChecks))
+	for name, check := range readinessChecks {
+		checks[name] = check
+	}
+	readinessChecksMu.Unlock()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check ReadinessCheck) {
+			defer func() {
+				if r := recover(); r != nil {
+					results <- result{name, fmt.Errorf("panic: %v", r)}
+				}
+			}()
+			results <- result{name, check()}
+		}(name, check)
+	}
+
+	errs := make(map[string]error, len(checks))
+	deadline := time.After(timeout)
+	for len(errs) < len(checks) {
+		select {
+		case res := <-results:
+			errs[res.name] = res.err
+		case <-deadline:
+			for name := range checks {
+				if _, ok := errs[name]; !ok {
+					errs[name] = errReadinessTimeout
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// ReadinessChecks returns the names of the registered
+// readiness checks in alphabetical order.
+func ReadinessChecks() []string {
+	readinessChecksMu.Lock()
+	defer readinessChecksMu.Unlock()
+	names := make([]string, 0, len(readinessChecks))
+	for name := range readinessChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkConfigLoaded is ready when there is a running instance.
+func checkConfigLoaded() error {
+	if len(Instances()) == 0 {
+		return errNoInstance
+	}
+	return nil
+}
+
+var (
+	errReadinessTimeout = errors.New("timed out")
+	errNoInstance       = errors.New("no configuration is running")
+)
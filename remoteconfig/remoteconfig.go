@@ -0,0 +1,253 @@
+// Package remoteconfig fetches the Caddyfile from a remote
+// location, optionally verifying its signature, and polls the
+// location so that changes can be applied by reloading; this
+// lets a fleet of servers share one configuration.
+//
+// Supported locations are:
+//
+//	http://host/path and https://host/path
+//	etcd://host:port/key and etcds://host:port/key (etcd v2 keys API)
+//	s3://bucket/key[?region=region&endpoint=url]
+package remoteconfig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// Source is a location from which a file can be fetched.
+type Source interface {
+	// Fetch returns the contents of the file.
+	Fetch() ([]byte, error)
+}
+
+// IsRemote returns whether location is the URL of a remote
+// Caddyfile, rather than a local file.
+func IsRemote(location string) bool {
+	u, err := url.Parse(location)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "etcd", "etcds", "s3":
+		return true
+	}
+	return false
+}
+
+// NewSource returns the Source for location.
+func NewSource(location string) (Source, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return httpSource{url: u.String()}, nil
+	case "etcd", "etcds":
+		return newEtcdSource(u)
+	case "s3":
+		return newS3Source(u)
+	}
+	return nil, fmt.Errorf("unsupported config location scheme '%s'", u.Scheme)
+}
+
+// SignatureLocation returns the location of the signature of
+// the file at location, which is the same with ".sig" appended
+// to its path.
+func SignatureLocation(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location + ".sig"
+	}
+	u.Path += ".sig"
+	return u.String()
+}
+
+// LoadPublicKey reads a PEM-encoded RSA or ECDSA public key
+// from file.
+func LoadPublicKey(file string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported public key type %T", file, key)
+}
+
+// ErrBadSignature is returned when a signature doesn't match.
+var ErrBadSignature = errors.New("signature verification failed")
+
+// Verify checks that sig is a signature of the SHA-256 digest
+// of contents made by the private key belonging to key: PKCS #1
+// v1.5 for RSA keys, ASN.1 DER for ECDSA keys. The signature may
+// be raw or base64-encoded.
+func Verify(key crypto.PublicKey, contents, sig []byte) error {
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		sig = decoded
+	}
+	digest := sha256.Sum256(contents)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return ErrBadSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		var esig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+			return ErrBadSignature
+		}
+		if !ecdsa.Verify(k, digest[:], esig.R, esig.S) {
+			return ErrBadSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", key)
+}
+
+// Remote is a remote Caddyfile.
+type Remote struct {
+	// Location is the URL of the Caddyfile.
+	Location string
+
+	// PublicKey, if not nil, is used to verify the signature
+	// at SignatureLocation(Location) whenever the Caddyfile
+	// is fetched.
+	PublicKey crypto.PublicKey
+
+	source    Source
+	sigSource Source
+
+	mu  sync.Mutex
+	sum [sha256.Size]byte // of the last loaded contents
+}
+
+// New returns the Remote at location, verified with key if not nil.
+func New(location string, key crypto.PublicKey) (*Remote, error) {
+	source, err := NewSource(location)
+	if err != nil {
+		return nil, err
+	}
+	r := &Remote{Location: location, PublicKey: key, source: source}
+	if key != nil {
+		r.sigSource, err = NewSource(SignatureLocation(location))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Name returns the file name of the Caddyfile, from which its
+// format can be told by extension.
+func (r *Remote) Name() string {
+	u, err := url.Parse(r.Location)
+	if err != nil {
+		return r.Location
+	}
+	return path.Base(u.Path)
+}
+
+// fetch fetches the Caddyfile and verifies it.
+func (r *Remote) fetch() ([]byte, error) {
+	contents, err := r.source.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	if r.PublicKey != nil {
+		sig, err := r.sigSource.Fetch()
+		if err != nil {
+			return nil, fmt.Errorf("fetching signature: %v", err)
+		}
+		if err := Verify(r.PublicKey, contents, sig); err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
+
+// Load fetches and verifies the Caddyfile, remembering it so
+// that Changed can tell when it changes.
+func (r *Remote) Load() ([]byte, error) {
+	contents, err := r.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", r.Location, err)
+	}
+	r.mu.Lock()
+	r.sum = sha256.Sum256(contents)
+	r.mu.Unlock()
+	return contents, nil
+}
+
+// Changed fetches and verifies the Caddyfile, and returns
+// whether it differs from the one last loaded.
+func (r *Remote) Changed() (bool, error) {
+	contents, err := r.fetch()
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", r.Location, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return sha256.Sum256(contents) != r.sum, nil
+}
+
+// Poll checks the Caddyfile for changes every interval and
+// calls reload, which is expected to Load it, when it changes.
+// Errors are logged and the current configuration is kept.
+// Polling continues until the returned function is called.
+func (r *Remote) Poll(interval time.Duration, reload func() error) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				changed, err := r.Changed()
+				if err != nil {
+					log.Printf("[ERROR] Polling config: %v", err)
+					continue
+				}
+				if !changed {
+					continue
+				}
+				log.Printf("[INFO] Config at %s changed; reloading", r.Location)
+				if err := reload(); err != nil {
+					log.Printf("[ERROR] Reloading changed config: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
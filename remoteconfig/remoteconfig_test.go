@@ -0,0 +1,272 @@
+package remoteconfig
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/objectstore"
+)
+
+func TestIsRemote(t *testing.T) {
+	for i, test := range []struct {
+		location string
+		expect   bool
+	}{
+		{"Caddyfile", false},
+		{"/etc/caddy/Caddyfile", false},
+		{`C:\caddy\Caddyfile`, false},
+		{"stdin", false},
+		{"http://example.com/Caddyfile", true},
+		{"https://example.com/Caddyfile", true},
+		{"etcd://127.0.0.1:2379/caddy", true},
+		{"etcds://127.0.0.1:2379/caddy", true},
+		{"s3://bucket/Caddyfile", true},
+		{"ftp://example.com/Caddyfile", false},
+	} {
+		if actual := IsRemote(test.location); actual != test.expect {
+			t.Errorf("Test %d: Expected IsRemote(%s) to be %t, got %t", i, test.location, test.expect, actual)
+		}
+	}
+}
+
+func TestSignatureLocation(t *testing.T) {
+	for i, test := range []struct {
+		location, expect string
+	}{
+		{"https://example.com/Caddyfile", "https://example.com/Caddyfile.sig"},
+		{"https://example.com/Caddyfile?v=2", "https://example.com/Caddyfile.sig?v=2"},
+		{"etcd://127.0.0.1:2379/caddy/config", "etcd://127.0.0.1:2379/caddy/config.sig"},
+		{"s3://bucket/Caddyfile?region=eu-west-1", "s3://bucket/Caddyfile.sig?region=eu-west-1"},
+	} {
+		if actual := SignatureLocation(test.location); actual != test.expect {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expect, actual)
+		}
+	}
+}
+
+func TestHTTPWithSignature(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(contents string) string {
+		digest := sha256.Sum256([]byte(contents))
+		sig, err := priv.Sign(rand.Reader, digest[:], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	files := map[string]string{"/Caddyfile": "localhost:2015"}
+	files["/Caddyfile.sig"] = sign(files["/Caddyfile"])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "remoteconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadPublicKey(keyFile)
+	if err != nil {
+		t.Fatalf("Expected no error loading key, got: %v", err)
+	}
+
+	remote, err := New(srv.URL+"/Caddyfile", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.Name() != "Caddyfile" {
+		t.Errorf("Expected name Caddyfile, got %s", remote.Name())
+	}
+	contents, err := remote.Load()
+	if err != nil {
+		t.Fatalf("Expected no error loading, got: %v", err)
+	}
+	if string(contents) != files["/Caddyfile"] {
+		t.Errorf("Expected contents %q, got %q", files["/Caddyfile"], contents)
+	}
+	if changed, err := remote.Changed(); err != nil || changed {
+		t.Errorf("Expected no change and no error, got %t and %v", changed, err)
+	}
+
+	// a change that isn't signed must be rejected
+	files["/Caddyfile"] = "localhost:2016"
+	if _, err := remote.Changed(); err == nil || !strings.Contains(err.Error(), ErrBadSignature.Error()) {
+		t.Errorf("Expected signature error, got: %v", err)
+	}
+
+	files["/Caddyfile.sig"] = sign(files["/Caddyfile"])
+	if changed, err := remote.Changed(); err != nil || !changed {
+		t.Errorf("Expected change and no error, got %t and %v", changed, err)
+	}
+
+	// polling reloads on change
+	reloaded := make(chan struct{}, 1)
+	stop := remote.Poll(10*time.Millisecond, func() error {
+		_, err := remote.Load()
+		reloaded <- struct{}{}
+		return err
+	})
+	defer stop()
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected reload after change")
+	}
+	if changed, err := remote.Changed(); err != nil || changed {
+		t.Errorf("Expected no change after reload, got %t and %v", changed, err)
+	}
+}
+
+func TestHTTPSourceTooLarge(t *testing.T) {
+	for _, size := range []int{maxConfigSize, maxConfigSize + 1} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(bytes.Repeat([]byte("#"), size))
+		}))
+		contents, err := httpSource{url: srv.URL}.Fetch()
+		srv.Close()
+		if size > maxConfigSize {
+			if err == nil {
+				t.Errorf("Size %d: Expected an error, got %d bytes", size, len(contents))
+			}
+		} else if err != nil || len(contents) != size {
+			t.Errorf("Size %d: Expected all of it, got %d bytes and error %v", size, len(contents), err)
+		}
+	}
+}
+
+func TestEtcdSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/keys/caddy/config" {
+			http.Error(w, `{"errorCode":100,"message":"Key not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/caddy/config","value":"localhost:2015\ngzip"}}`))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	source, err := NewSource("etcd://" + host + "/caddy/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := source.Fetch()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expect := "localhost:2015\ngzip"; string(contents) != expect {
+		t.Errorf("Expected %q, got %q", expect, contents)
+	}
+
+	source, err = NewSource("etcd://" + host + "/caddy/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Fetch(); err == nil {
+		t.Error("Expected error for missing key, got none")
+	}
+
+	if _, err := NewSource("etcd://" + host); err == nil {
+		t.Error("Expected error for location without key, got none")
+	}
+}
+
+func TestS3Source(t *testing.T) {
+	var auth, amzDate string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/caddy/Caddyfile" {
+			http.NotFound(w, r)
+			return
+		}
+		auth, amzDate = r.Header.Get("Authorization"), r.Header.Get("X-Amz-Date")
+		w.Write([]byte("localhost:2015"))
+	}))
+	defer srv.Close()
+
+	defer os.Setenv("AWS_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID"))
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	defer os.Setenv("AWS_REGION", os.Getenv("AWS_REGION"))
+	os.Unsetenv("AWS_REGION")
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	source, err := NewSource("s3://bucket/caddy/Caddyfile?region=eu-west-1&endpoint=" + srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := source.Fetch()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if string(contents) != "localhost:2015" {
+		t.Errorf("Expected contents, got %q", contents)
+	}
+	expectPrefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/" + amzDate[:8] + "/eu-west-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(auth, expectPrefix) {
+		t.Errorf("Expected Authorization to start with %q, got %q", expectPrefix, auth)
+	}
+
+	s3, err := newS3Source(mustParseURL(t, "s3://bucket/Caddyfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "https://bucket.s3.us-east-1.amazonaws.com/Caddyfile"; s3.url.String() != expect {
+		t.Errorf("Expected URL %s, got %s", expect, s3.url)
+	}
+}
+
+func TestSignS3Deterministic(t *testing.T) {
+	sign := func(secret string) string {
+		req, _ := http.NewRequest(http.MethodGet, "https://bucket.s3.us-east-1.amazonaws.com/Caddyfile", nil)
+		objectstore.Sign(req, "us-east-1", objectstore.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: secret}, time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC))
+		return req.Header.Get("Authorization")
+	}
+	if sign("secret") != sign("secret") {
+		t.Error("Expected the same signature for the same request")
+	}
+	if sign("secret") == sign("other") {
+		t.Error("Expected different signatures for different secrets")
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
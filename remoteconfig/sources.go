@@ -0,0 +1,144 @@
+package remoteconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/objectstore"
+)
+
+// maxConfigSize limits the size of a fetched file.
+const maxConfigSize = 10 << 20
+
+// client is the HTTP client used by all sources.
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// do performs req and returns the response body, which must
+// come with a 200 status.
+func do(req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxConfigSize {
+		return nil, fmt.Errorf("file larger than %d bytes", maxConfigSize)
+	}
+	return body, nil
+}
+
+// httpSource fetches a file with a GET request.
+type httpSource struct {
+	url string
+}
+
+func (s httpSource) Fetch() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do(req)
+}
+
+// etcdSource fetches the value of a key from etcd through its
+// v2 keys API.
+type etcdSource struct {
+	url string
+}
+
+func newEtcdSource(u *url.URL) (etcdSource, error) {
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return etcdSource{}, fmt.Errorf("etcd location must be etcd://host:port/key")
+	}
+	scheme := "http"
+	if u.Scheme == "etcds" {
+		scheme = "https"
+	}
+	keysURL := url.URL{Scheme: scheme, Host: u.Host, User: u.User, Path: "/v2/keys" + u.Path}
+	return etcdSource{url: keysURL.String()}, nil
+}
+
+func (s etcdSource) Fetch() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Node struct {
+			Value string `json:"value"`
+			Dir   bool   `json:"dir"`
+		} `json:"node"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decoding etcd response: %v", err)
+	}
+	if resp.Node.Dir {
+		return nil, fmt.Errorf("etcd key is a directory")
+	}
+	return []byte(resp.Node.Value), nil
+}
+
+// s3Source fetches an object from S3 or a compatible service.
+// Requests are signed with the credentials in the environment
+// variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and, if
+// temporary, AWS_SESSION_TOKEN; without them, the object must
+// be public.
+type s3Source struct {
+	url    *url.URL
+	region string
+}
+
+func newS3Source(u *url.URL) (s3Source, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return s3Source{}, fmt.Errorf("s3 location must be s3://bucket/key")
+	}
+	region := u.Query().Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	var objectURL *url.URL
+	if endpoint := u.Query().Get("endpoint"); endpoint != "" {
+		// path-style, for S3-compatible services
+		ep, err := url.Parse(endpoint)
+		if err != nil {
+			return s3Source{}, fmt.Errorf("s3 endpoint: %v", err)
+		}
+		objectURL = &url.URL{Scheme: ep.Scheme, Host: ep.Host, Path: "/" + bucket + "/" + key}
+	} else {
+		objectURL = &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}
+	}
+	return s3Source{url: objectURL, region: region}, nil
+}
+
+func (s s3Source) Fetch() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if creds := objectstore.EnvCredentials(); creds.Valid() {
+		objectstore.Sign(req, s.region, creds, time.Now())
+	}
+	return do(req)
+}
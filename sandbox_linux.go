@@ -0,0 +1,202 @@
+package caddy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// More Landlock rights, and those of files rather than folders.
+const (
+	landlockAccessFSExecute  = 1 << 0
+	landlockAccessFSReadFile = 1 << 2
+	landlockAccessFSReadDir  = 1 << 3
+
+	landlockAccessFSRead = landlockAccessFSReadFile | landlockAccessFSReadDir
+	landlockAccessFSAll  = landlockAccessFSExecute | landlockAccessFSRead | landlockAccessFSWrite
+	landlockAccessFile   = landlockAccessFSExecute | landlockAccessFSReadFile | 1<<1 // write file
+)
+
+// systemReadPaths are read by the standard library, to resolve
+// names, verify certificates and know the time zones and MIME types.
+var systemReadPaths = []string{
+	"/etc/hosts",
+	"/etc/resolv.conf",
+	"/etc/nsswitch.conf",
+	"/etc/host.conf",
+	"/etc/services",
+	"/etc/gai.conf",
+	"/etc/localtime",
+	"/etc/mime.types",
+	"/etc/ssl",
+	"/etc/pki",
+	"/usr/share/ca-certificates",
+	"/usr/share/zoneinfo",
+}
+
+// systemExecPaths are read and executed by commands.
+var systemExecPaths = []string{"/bin", "/sbin", "/usr", "/lib", "/lib64", "/etc"}
+
+// sandbox prepares to confine the process to reading the files and
+// folders read, reading and writing beneath the folders written, and
+// the system calls a server needs, as well as running commands if
+// exec is true; and returns the function that does so once called.
+func sandbox(read, written []string, exec bool) (func() error, error) {
+	if seccompTable == nil {
+		return nil, fmt.Errorf("the sandbox is not supported on %s", runtime.GOARCH)
+	}
+
+	rules := make(map[string]uint64)
+	for _, path := range systemReadPaths {
+		rules[path] |= landlockAccessFSRead
+	}
+	for _, path := range read {
+		rules[path] |= landlockAccessFSRead
+	}
+	for _, path := range written {
+		rules[path] |= landlockAccessFSRead | landlockAccessFSWrite
+	}
+	// opened by commands for their standard streams
+	rules[os.DevNull] |= landlockAccessFSReadFile | 1<<1
+	if exec {
+		for _, path := range systemExecPaths {
+			rules[path] |= landlockAccessFSRead | landlockAccessFSExecute
+		}
+	}
+
+	attr := landlockRulesetAttr{handledAccessFS: landlockAccessFSAll}
+	ruleset, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("Landlock is not available: %v", errno)
+	}
+	for path, allowed := range rules {
+		fi, err := os.Stat(path)
+		if os.IsNotExist(err) && !contains(read, path) && !contains(written, path) {
+			continue // not on this system
+		}
+		if err != nil {
+			syscall.Close(int(ruleset))
+			return nil, err
+		}
+		if !fi.IsDir() {
+			allowed &= landlockAccessFile
+		}
+		fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			syscall.Close(int(ruleset))
+			return nil, err
+		}
+		rule := landlockPathBeneathAttr{allowedAccess: allowed, parentFd: int32(fd)}
+		_, _, errno = syscall.Syscall(sysLandlockAddRule, ruleset, landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule)))
+		syscall.Close(fd)
+		if errno != 0 {
+			syscall.Close(int(ruleset))
+			return nil, fmt.Errorf("allowing access to %s: %v", path, errno)
+		}
+	}
+
+	denied := seccompTable.denied
+	if !exec {
+		denied = append(denied[:len(denied):len(denied)], seccompTable.exec...)
+	}
+	filter := seccompFilter(seccompTable, denied)
+
+	return func() error {
+		defer syscall.Close(int(ruleset))
+		// every thread must be restricted, not just this one
+		_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+		if errno == syscall.ENOTSUP {
+			return errors.New("the sandbox needs a build without cgo")
+		}
+		if errno != 0 {
+			return fmt.Errorf("setting no_new_privs: %v", errno)
+		}
+		if _, _, errno = syscall.AllThreadsSyscall(sysLandlockRestrictSelf, ruleset, 0, 0); errno != 0 {
+			return fmt.Errorf("enforcing Landlock: %v", errno)
+		}
+		prog := sockFprog{len: uint16(len(filter)), filter: &filter[0]}
+		_, _, errno = syscall.Syscall(seccompTable.sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+		runtime.KeepAlive(filter)
+		if errno != 0 {
+			return fmt.Errorf("enforcing seccomp: %v", errno)
+		}
+		return nil
+	}, nil
+}
+
+// contains returns whether paths contains path.
+func contains(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// seccompArch is what a seccomp filter needs to know about the
+// architecture of the process.
+type seccompArch struct {
+	auditArch  uint32  // AUDIT_ARCH_*, that system calls are checked to be made with
+	x32        bool    // whether the x32 system calls must be denied too
+	sysSeccomp uintptr // the number of the seccomp system call
+
+	// denied are the numbers of the system calls denied, which
+	// administer the system or other processes, and exec those of
+	// the calls that run commands, unless commands are allowed.
+	denied []uint32
+	exec   []uint32
+}
+
+// Seccomp and its filters, from linux/seccomp.h and linux/filter.h.
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+	seccompRetAllow        = 0x7fff0000
+	seccompRetErrno        = 0x00050000
+
+	bpfLdWAbs = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgeK   = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK   = 0x06 // BPF_RET | BPF_K
+
+	seccompDataNr   = 0 // offsetof(struct seccomp_data, nr)
+	seccompDataArch = 4 // offsetof(struct seccomp_data, arch)
+
+	x32SyscallBit = 0x40000000
+)
+
+type sockFilter struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+type sockFprog struct {
+	len    uint16
+	filter *sockFilter
+}
+
+// seccompFilter returns a filter that fails the system calls denied,
+// and those of other architectures, with EPERM, and allows the rest.
+func seccompFilter(arch *seccompArch, denied []uint32) []sockFilter {
+	deny := sockFilter{code: bpfRetK, k: seccompRetErrno | uint32(syscall.EPERM)}
+	filter := []sockFilter{
+		{code: bpfLdWAbs, k: seccompDataArch},
+		{code: bpfJeqK, jt: 1, k: arch.auditArch},
+		deny,
+		{code: bpfLdWAbs, k: seccompDataNr},
+	}
+	// each jump is past the checks after it, and the allow, to deny
+	if arch.x32 {
+		filter = append(filter, sockFilter{code: bpfJgeK, jt: uint8(len(denied) + 1), k: x32SyscallBit})
+	}
+	for i, nr := range denied {
+		filter = append(filter, sockFilter{code: bpfJeqK, jt: uint8(len(denied) - i), k: nr})
+	}
+	return append(filter, sockFilter{code: bpfRetK, k: seccompRetAllow}, deny)
+}
@@ -0,0 +1,45 @@
+package caddy
+
+import "testing"
+
+func TestSeccompFilter(t *testing.T) {
+	arch := &seccompArch{auditArch: 0xc000003e, x32: true, denied: []uint32{101, 165}, exec: []uint32{59}}
+	filter := seccompFilter(arch, append(arch.denied, arch.exec...))
+	deny := len(filter) - 1
+	allow := len(filter) - 2
+	if filter[deny].code != bpfRetK || filter[deny].k != seccompRetErrno|1 {
+		t.Fatalf("Expected the filter to end by denying with EPERM, got %+v", filter[deny])
+	}
+	if filter[allow].code != bpfRetK || filter[allow].k != seccompRetAllow {
+		t.Fatalf("Expected the filter to allow the rest, got %+v", filter[allow])
+	}
+
+	// another architecture is denied
+	if filter[1].k != arch.auditArch || 1+1+int(filter[1].jt) != 3 || filter[2] != filter[deny] {
+		t.Errorf("Expected other architectures to be denied, got %+v", filter[:3])
+	}
+
+	// every system call checked jumps to the denial
+	var checked []uint32
+	for i, ins := range filter[3:allow] {
+		i += 3
+		switch ins.code {
+		case bpfLdWAbs:
+			continue
+		case bpfJgeK:
+			if ins.k != x32SyscallBit {
+				t.Errorf("Instruction %d: Expected to check for x32, got %+v", i, ins)
+			}
+		case bpfJeqK:
+			checked = append(checked, ins.k)
+		default:
+			t.Errorf("Instruction %d: Unexpected %+v", i, ins)
+		}
+		if i+1+int(ins.jt) != deny || ins.jf != 0 {
+			t.Errorf("Instruction %d: Expected a jump to %d, got %+v", i, deny, ins)
+		}
+	}
+	if len(checked) != 3 || checked[0] != 101 || checked[1] != 165 || checked[2] != 59 {
+		t.Errorf("Expected the denied system calls to be checked, got %v", checked)
+	}
+}
@@ -0,0 +1,61 @@
+package caddy
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sdNotify reports state to systemd, if it started this process
+// as a service with Type=notify; otherwise it does nothing. See
+// sd_notify(3) for the states.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if socket[0] == '@' {
+		// abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("[ERROR] Notifying service manager: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Printf("[ERROR] Notifying service manager: %v", err)
+	}
+}
+
+// sdNotifyReady reports that startup or a reload is complete,
+// and starts keeping the watchdog at bay, if it is enabled.
+func sdNotifyReady() {
+	sdNotify("READY=1\nMAINPID=" + strconv.Itoa(os.Getpid()))
+	watchdogOnce.Do(startWatchdog)
+}
+
+// watchdogOnce ensures only one watchdog goroutine is started.
+var watchdogOnce sync.Once
+
+// startWatchdog pings systemd's watchdog at half the interval
+// it requires, if the watchdog is enabled for this process.
+func startWatchdog() {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return // meant for another process
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	go func() {
+		for range time.Tick(interval) {
+			sdNotify("WATCHDOG=1")
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package caddy
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unixgram sockets on Windows")
+	}
+	dir, err := ioutil.TempDir("", "sdnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET"))
+	os.Setenv("NOTIFY_SOCKET", socket)
+
+	sdNotify("RELOADING=1")
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Expected notification, got: %v", err)
+	}
+	if got := string(buf[:n]); got != "RELOADING=1" {
+		t.Errorf("Expected RELOADING=1, got %q", got)
+	}
+
+	// without a socket, nothing happens
+	os.Setenv("NOTIFY_SOCKET", "")
+	sdNotify("READY=1")
+}
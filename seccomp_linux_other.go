@@ -0,0 +1,7 @@
+// +build linux,!amd64,!arm64
+
+package caddy
+
+// seccompTable is nil, since there is no sandbox for this
+// architecture.
+var seccompTable *seccompArch
@@ -1,6 +1,7 @@
 package caddy
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -49,11 +50,61 @@ func trapSignalsCrossPlatform() {
 	}()
 }
 
+// Reload loads the Caddyfile again with the loader that loaded
+// it at startup, along with the environment file, if any, and
+// restarts the running instance with it.
+func Reload() error {
+	// Start with the existing Caddyfile
+	caddyfileToUse, inst, err := getCurrentCaddyfile()
+	if err != nil {
+		return err
+	}
+	if loaderUsed.loader == nil {
+		// This also should never happen
+		return fmt.Errorf("no Caddyfile loader with which to reload Caddyfile")
+	}
+
+	// Pick up changed environment variables
+	if err := LoadEnvFile(); err != nil {
+		return fmt.Errorf("loading environment file: %v", err)
+	}
+
+	// Load the updated Caddyfile
+	newCaddyfile, err := loaderUsed.loader.Load(inst.serverType)
+	if err != nil {
+		return fmt.Errorf("loading updated Caddyfile: %v", err)
+	}
+	if newCaddyfile != nil {
+		caddyfileToUse = newCaddyfile
+	}
+
+	_, err = inst.Restart(caddyfileToUse)
+	return err
+}
+
+// Quit executes the shutdown callbacks, as initiated by reason,
+// and then stops all servers, as SIGQUIT does. It returns the
+// recommended exit status; the caller should exit the process.
+func Quit(reason string) int {
+	exitCode := executeShutdownCallbacks(reason)
+	err := Stop()
+	if err != nil {
+		log.Printf("[ERROR] %s stop: %v", reason, err)
+		exitCode = 3
+	}
+	if PidFile != "" {
+		os.Remove(PidFile)
+	}
+	return exitCode
+}
+
 // executeShutdownCallbacks executes the shutdown callbacks as initiated
 // by signame. It logs any errors and returns the recommended exit status.
 // This function is idempotent; subsequent invocations always return 0.
 func executeShutdownCallbacks(signame string) (exitCode int) {
 	shutdownCallbacksOnce.Do(func() {
+		sdNotify("STOPPING=1")
+
 		// execute third-party shutdown hooks
 		EmitEvent(ShutdownEvent, signame)
 
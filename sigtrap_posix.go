@@ -26,16 +26,7 @@ func trapSignalsPosix() {
 
 			case syscall.SIGQUIT:
 				log.Println("[INFO] SIGQUIT: Shutting down")
-				exitCode := executeShutdownCallbacks("SIGQUIT")
-				err := Stop()
-				if err != nil {
-					log.Printf("[ERROR] SIGQUIT stop: %v", err)
-					exitCode = 3
-				}
-				if PidFile != "" {
-					os.Remove(PidFile)
-				}
-				os.Exit(exitCode)
+				os.Exit(Quit("SIGQUIT"))
 
 			case syscall.SIGHUP:
 				log.Println("[INFO] SIGHUP: Hanging up")
@@ -46,32 +37,7 @@ func trapSignalsPosix() {
 
 			case syscall.SIGUSR1:
 				log.Println("[INFO] SIGUSR1: Reloading")
-
-				// Start with the existing Caddyfile
-				caddyfileToUse, inst, err := getCurrentCaddyfile()
-				if err != nil {
-					log.Printf("[ERROR] SIGUSR1: %v", err)
-					continue
-				}
-				if loaderUsed.loader == nil {
-					// This also should never happen
-					log.Println("[ERROR] SIGUSR1: no Caddyfile loader with which to reload Caddyfile")
-					continue
-				}
-
-				// Load the updated Caddyfile
-				newCaddyfile, err := loaderUsed.loader.Load(inst.serverType)
-				if err != nil {
-					log.Printf("[ERROR] SIGUSR1: loading updated Caddyfile: %v", err)
-					continue
-				}
-				if newCaddyfile != nil {
-					caddyfileToUse = newCaddyfile
-				}
-
-				// Kick off the restart; our work is done
-				inst, err = inst.Restart(caddyfileToUse)
-				if err != nil {
+				if err := Reload(); err != nil {
 					log.Printf("[ERROR] SIGUSR1: %v", err)
 				}
 
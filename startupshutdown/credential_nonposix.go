@@ -0,0 +1,21 @@
+// +build windows plan9 nacl
+
+package startupshutdown
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// credential is a user that commands can run as; there are none
+// on this platform.
+type credential struct{}
+
+// lookupCredential returns an error, since commands can't run as
+// another user on this platform.
+func lookupCredential(name string) (*credential, error) {
+	return nil, errors.New("running commands as another user is not supported on this platform")
+}
+
+// apply does nothing.
+func (cred *credential) apply(cmd *exec.Cmd) {}
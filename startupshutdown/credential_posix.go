@@ -0,0 +1,45 @@
+// +build !windows,!plan9,!nacl
+
+package startupshutdown
+
+import (
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// credential is a user that commands can run as.
+type credential struct {
+	uid, gid uint32
+}
+
+// lookupCredential returns the credential of the user with the
+// given name, or numeric ID.
+func lookupCredential(name string) (*credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, err
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &credential{uid: uint32(uid), gid: uint32(gid)}, nil
+}
+
+// apply makes cmd run as cred, if cred is not nil.
+func (cred *credential) apply(cmd *exec.Cmd) {
+	if cred == nil {
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: cred.uid, Gid: cred.gid},
+	}
+}
@@ -1,10 +1,14 @@
 package startupshutdown
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy"
 )
@@ -16,58 +20,248 @@ func init() {
 
 // Startup registers a startup callback to execute during server start.
 func Startup(c *caddy.Controller) error {
-	return registerCallback(c, c.OnFirstStartup)
+	return registerCallback(c, c.OnFirstStartup, c.OnFirstStartupComplete)
 }
 
 // Shutdown registers a shutdown callback to execute during server stop.
 func Shutdown(c *caddy.Controller) error {
-	return registerCallback(c, c.OnFinalShutdown)
+	return registerCallback(c, c.OnFinalShutdown, nil)
+}
+
+// hook is a command run by the startup or shutdown directive.
+type hook struct {
+	event    string // the directive: startup or shutdown
+	site     string // the key of the server block
+	command  string
+	args     []string
+	nonblock bool
+
+	// timeout, if not 0, is how long the command may run for
+	// before it is killed.
+	timeout time.Duration
+
+	// env are the variables added to the environment of the
+	// command, as name=value with placeholders in the value.
+	env []string
+
+	// cred, if not nil, is the user the command runs as.
+	cred *credential
+
+	// warn is whether a failure is only logged, rather than
+	// failing the start, or the exit status of the shutdown.
+	warn bool
+
+	// afterListen is whether the command runs once the servers
+	// are listening, rather than before they are started.
+	afterListen bool
 }
 
 // registerCallback registers a callback function to execute by
-// using c to parse the directive. It registers the callback
-// to be executed using registerFunc.
-func registerCallback(c *caddy.Controller, registerFunc func(func() error)) error {
-	var funcs []func() error
+// using c to parse the directive. It registers the callback to be
+// executed using registerFunc, or, if it runs once the servers are
+// listening, afterListenFunc; a nil afterListenFunc means that the
+// directive can't be ordered after listening.
+func registerCallback(c *caddy.Controller, registerFunc, afterListenFunc func(func() error)) error {
+	var hooks []hook
 
 	for c.Next() {
-		args := c.RemainingArgs()
-		if len(args) == 0 {
-			return c.ArgErr()
+		h, err := parseHook(c, afterListenFunc != nil)
+		if err != nil {
+			return err
 		}
+		hooks = append(hooks, h)
+	}
 
-		nonblock := false
-		if len(args) > 1 && args[len(args)-1] == "&" {
-			// Run command in background; non-blocking
-			nonblock = true
-			args = args[:len(args)-1]
-		}
+	// commands may run after the servers listen, also in a sandbox
+	caddy.AllowExec()
 
-		command, args, err := caddy.SplitCommandAndArgs(strings.Join(args, " "))
-		if err != nil {
-			return c.Err(err.Error())
+	return c.OncePerServerBlock(func() error {
+		for _, h := range hooks {
+			if h.afterListen {
+				afterListenFunc(h.run)
+			} else {
+				registerFunc(h.run)
+			}
 		}
+		return nil
+	})
+}
+
+// parseHook parses a use of the directive:
+//
+//	startup|shutdown command [args...] [&] {
+//		timeout    duration
+//		env        name value
+//		user       username
+//		on_failure abort|warn
+//		order      before_listen|after_listen
+//	}
+//
+// where env values may have the placeholders {event}, {site},
+// {hostname} and {pid}. Commands are ordered before the servers
+// listen unless ordered, and failures abort unless they warn.
+func parseHook(c *caddy.Controller, canOrder bool) (hook, error) {
+	h := hook{event: c.Val(), site: c.Key}
 
-		fn := func() error {
-			cmd := exec.Command(command, args...)
-			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			if nonblock {
-				log.Printf("[INFO] Nonblocking Command:\"%s %s\"", command, strings.Join(args, " "))
-				return cmd.Start()
+	args := c.RemainingArgs()
+	if len(args) == 0 {
+		return h, c.ArgErr()
+	}
+	if len(args) > 1 && args[len(args)-1] == "&" {
+		// Run command in background; non-blocking
+		h.nonblock = true
+		args = args[:len(args)-1]
+	}
+	var err error
+	h.command, h.args, err = caddy.SplitCommandAndArgs(strings.Join(args, " "))
+	if err != nil {
+		return h, c.Err(err.Error())
+	}
+
+	for c.NextBlock() {
+		switch c.Val() {
+		case "timeout":
+			if !c.NextArg() {
+				return h, c.ArgErr()
+			}
+			timeout, err := time.ParseDuration(c.Val())
+			if err != nil || timeout <= 0 {
+				return h, c.Errf("Invalid %s timeout '%s'", h.event, c.Val())
+			}
+			h.timeout = timeout
+		case "env":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return h, c.ArgErr()
+			}
+			if args[0] == "" || strings.Contains(args[0], "=") {
+				return h, c.Errf("Invalid %s environment variable name '%s'", h.event, args[0])
+			}
+			h.env = append(h.env, args[0]+"="+args[1])
+			continue
+		case "user":
+			if !c.NextArg() {
+				return h, c.ArgErr()
+			}
+			h.cred, err = lookupCredential(c.Val())
+			if err != nil {
+				return h, c.Errf("Invalid %s user '%s': %v", h.event, c.Val(), err)
 			}
-			log.Printf("[INFO] Blocking Command:\"%s %s\"", command, strings.Join(args, " "))
-			return cmd.Run()
+		case "on_failure":
+			if !c.NextArg() {
+				return h, c.ArgErr()
+			}
+			switch c.Val() {
+			case "abort":
+				h.warn = false
+			case "warn":
+				h.warn = true
+			default:
+				return h, c.Errf("Invalid %s on_failure '%s'; must be abort or warn", h.event, c.Val())
+			}
+		case "order":
+			if !c.NextArg() {
+				return h, c.ArgErr()
+			}
+			switch c.Val() {
+			case "before_listen":
+				h.afterListen = false
+			case "after_listen":
+				if !canOrder {
+					return h, c.Errf("The %s directive can't be ordered after listening", h.event)
+				}
+				h.afterListen = true
+			default:
+				return h, c.Errf("Invalid %s order '%s'; must be before_listen or after_listen", h.event, c.Val())
+			}
+		default:
+			return h, c.Errf("Unknown %s property '%s'", h.event, c.Val())
 		}
+		if c.NextArg() {
+			return h, c.ArgErr()
+		}
+	}
+	return h, nil
+}
 
-		funcs = append(funcs, fn)
+// run runs the command of h, applying its failure policy.
+func (h hook) run() error {
+	err := h.exec()
+	if err != nil && h.warn {
+		log.Printf("[WARNING] %s command \"%s\": %v", h.event, h.commandLine(), err)
+		return nil
 	}
+	return err
+}
 
-	return c.OncePerServerBlock(func() error {
-		for _, fn := range funcs {
-			registerFunc(fn)
+// exec runs the command of h. A non-blocking command only fails
+// if it can't be started; failures after that are logged.
+func (h hook) exec() error {
+	ctx, cancel := context.Background(), func() {}
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+	}
+	cmd := exec.CommandContext(ctx, h.command, h.args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = h.environ()
+	h.cred.apply(cmd)
+
+	if h.nonblock {
+		log.Printf("[INFO] Nonblocking Command:\"%s\"", h.commandLine())
+		if err := cmd.Start(); err != nil {
+			cancel()
+			return err
 		}
+		go func() {
+			defer cancel()
+			if err := h.wait(ctx, cmd); err != nil {
+				log.Printf("[ERROR] %s command \"%s\": %v", h.event, h.commandLine(), err)
+			}
+		}()
 		return nil
-	})
+	}
+
+	defer cancel()
+	log.Printf("[INFO] Blocking Command:\"%s\"", h.commandLine())
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return h.wait(ctx, cmd)
+}
+
+// wait waits for cmd, started with ctx, to exit, and reports if it
+// ran out of time.
+func (h hook) wait(ctx context.Context, cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %v", h.timeout)
+	}
+	return err
+}
+
+// environ returns the environment of the command of h: that of
+// the process, with the variables of h added.
+func (h hook) environ() []string {
+	if len(h.env) == 0 {
+		return nil // the environment of the process
+	}
+	hostname, _ := os.Hostname()
+	repl := strings.NewReplacer(
+		"{event}", h.event,
+		"{site}", h.site,
+		"{hostname}", hostname,
+		"{pid}", strconv.Itoa(os.Getpid()),
+	)
+	env := os.Environ()
+	for _, v := range h.env {
+		env = append(env, repl.Replace(v))
+	}
+	return env
+}
+
+// commandLine returns the command of h as it is logged.
+func (h hook) commandLine() string {
+	return strings.TrimSpace(h.command + " " + strings.Join(h.args, " "))
 }
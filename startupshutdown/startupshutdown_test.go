@@ -3,7 +3,10 @@ package startupshutdown
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -47,7 +50,7 @@ func TestStartup(t *testing.T) {
 
 	for i, test := range tests {
 		c := caddy.NewTestController("", test.input)
-		err := registerCallback(c, fakeRegister)
+		err := registerCallback(c, fakeRegister, nil)
 		if err != nil {
 			t.Errorf("Expected no errors, got: %v", err)
 		}
@@ -64,3 +67,103 @@ func TestStartup(t *testing.T) {
 		}
 	}
 }
+
+func TestParseHook(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		canOrder  bool
+		shouldErr bool
+		expected  hook
+	}{
+		{`startup echo hi &`, true, false, hook{event: "startup", command: "echo", args: []string{"hi"}, nonblock: true}},
+		{`shutdown echo a b {
+			timeout 30s
+			env SITE {site}
+			env PID {pid}
+			on_failure warn
+			order before_listen
+		}`, false, false, hook{event: "shutdown", command: "echo", args: []string{"a", "b"}, timeout: 30 * time.Second,
+			env: []string{"SITE={site}", "PID={pid}"}, warn: true}},
+		{`startup echo hi {
+			order after_listen
+			on_failure abort
+		}`, true, false, hook{event: "startup", command: "echo", args: []string{"hi"}, afterListen: true}},
+		{`startup`, true, true, hook{}},
+		{`startup echo { timeout }`, true, true, hook{}},
+		{`startup echo { timeout soon }`, true, true, hook{}},
+		{`startup echo { timeout -1s }`, true, true, hook{}},
+		{"startup echo {\n env A\n}", true, true, hook{}},
+		{"startup echo {\n env A=B C\n}", true, true, hook{}},
+		{`startup echo { on_failure ignore }`, true, true, hook{}},
+		{`startup echo { order later }`, true, true, hook{}},
+		{`shutdown echo { order after_listen }`, false, true, hook{}},
+		{`startup echo { user nobody-at-all-here }`, true, true, hook{}},
+		{`startup echo { retries 3 }`, true, true, hook{}},
+	} {
+		c := caddy.NewTestController("", test.input)
+		c.Next()
+		actual, err := parseHook(c, test.canOrder)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestRegisterAfterListen(t *testing.T) {
+	var before, after int
+	c := caddy.NewTestController("", "startup echo 1\nstartup echo 2 {\n order after_listen\n}")
+	err := registerCallback(c, func(func() error) { before++ }, func(func() error) { after++ })
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if before != 1 || after != 1 {
+		t.Errorf("Expected 1 callback before and 1 after listening, got %d and %d", before, after)
+	}
+}
+
+func TestHookFailurePolicy(t *testing.T) {
+	missing := strconv.Itoa(int(time.Now().UnixNano()))
+	if err := (hook{event: "startup", command: missing}).run(); err == nil {
+		t.Error("Expected the failure to abort")
+	}
+	if err := (hook{event: "startup", command: missing, warn: true}).run(); err != nil {
+		t.Errorf("Expected the failure to be a warning, got %v", err)
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep command")
+	}
+	h := hook{event: "startup", command: "sleep", args: []string{"5"}, timeout: 50 * time.Millisecond}
+	start := time.Now()
+	err := h.run()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Expected the command to be killed")
+	}
+}
+
+func TestHookEnviron(t *testing.T) {
+	h := hook{event: "shutdown", site: "example.com", env: []string{"HOOK={event}:{site}:{pid}"}}
+	env := h.environ()
+	expected := "HOOK=shutdown:example.com:" + strconv.Itoa(os.Getpid())
+	if len(env) == 0 || env[len(env)-1] != expected {
+		t.Errorf("Expected the environment to end with %s, got %v", expected, env)
+	}
+	if env := (hook{}).environ(); env != nil {
+		t.Errorf("Expected the environment of the process, got %v", env)
+	}
+}
@@ -0,0 +1,165 @@
+package caddy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Tenant is a group of servers run in the process apart from the
+// others: with its own Caddyfile, reloads and assets, so that the
+// configurations of many tenants can be hosted together. Tenants
+// can't listen on the addresses of other instances, share the logs
+// of the process, and are not carried over by upgrades.
+type Tenant struct {
+	// Name identifies the tenant in the process.
+	Name string
+
+	// AssetsPath is where the assets of the tenant, such as its
+	// certificates, are kept; by default, the tenants/<name> folder
+	// of the assets path of the process.
+	AssetsPath string
+}
+
+// TenantContext is implemented by the contexts of server types
+// that keep the assets of tenants apart.
+type TenantContext interface {
+	Context
+
+	// SetTenant tells the context that it is that of t.
+	SetTenant(t Tenant)
+}
+
+var (
+	// tenants are the running instances of tenants, by name.
+	tenants   = make(map[string]*Instance)
+	tenantsMu sync.Mutex
+)
+
+// Tenant returns the tenant that i runs, or nil if it is not a
+// tenant's.
+func (i *Instance) Tenant() *Tenant {
+	return i.tenant
+}
+
+// MainInstance returns the running instance that is not a tenant's,
+// or nil if there is none.
+func MainInstance() *Instance {
+	instancesMu.Lock()
+	defer instancesMu.Unlock()
+	for _, inst := range instances {
+		if inst.tenant == nil {
+			return inst
+		}
+	}
+	return nil
+}
+
+// StartTenant starts the servers of tenant t with the configuration
+// in cdyfile. There can only be one tenant of each name.
+func StartTenant(t Tenant, cdyfile Input) (*Instance, error) {
+	if t.Name == "" {
+		return nil, fmt.Errorf("tenant has no name")
+	}
+	if t.AssetsPath == "" {
+		t.AssetsPath = filepath.Join(AssetsPath(), "tenants", t.Name)
+	}
+
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	if _, ok := tenants[t.Name]; ok {
+		return nil, fmt.Errorf("tenant %s is already running", t.Name)
+	}
+	inst := &Instance{serverType: cdyfile.ServerType(), wg: new(sync.WaitGroup), tenant: &t}
+	if err := startWithListenerFds(cdyfile, nil, inst, nil); err != nil {
+		inst.Stop()
+		return nil, fmt.Errorf("starting tenant %s: %v", t.Name, err)
+	}
+	tenants[t.Name] = inst
+	log.Printf("[INFO] Started tenant %s", t.Name)
+	EmitEvent(ConfigLoadedEvent, cdyfile)
+	return inst, nil
+}
+
+// ReloadTenant restarts the servers of the tenant named name with
+// the configuration in cdyfile, or, if it is nil, with the Caddyfile
+// it has read again, leaving the other instances as they are. If
+// it fails, the tenant carries on as before.
+func ReloadTenant(name string, cdyfile Input) (*Instance, error) {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	inst, ok := tenants[name]
+	if !ok {
+		return nil, fmt.Errorf("no tenant %s is running", name)
+	}
+	if cdyfile == nil {
+		current := inst.Caddyfile()
+		if current.Path() == "" {
+			return inst, fmt.Errorf("tenant %s has no Caddyfile to read again", name)
+		}
+		contents, err := ioutil.ReadFile(current.Path())
+		if err != nil {
+			return inst, fmt.Errorf("reading the Caddyfile of tenant %s again: %v", name, err)
+		}
+		cdyfile = CaddyfileInput{Contents: contents, Filepath: current.Path(), ServerTypeName: current.ServerType()}
+	}
+	newInst, err := inst.Restart(cdyfile)
+	if err != nil {
+		return inst, fmt.Errorf("reloading tenant %s: %v", name, err)
+	}
+	tenants[name] = newInst
+	return newInst, nil
+}
+
+// StopTenant runs the shutdown callbacks of the tenant named name,
+// and stops its servers.
+func StopTenant(name string) error {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	inst, ok := tenants[name]
+	if !ok {
+		return fmt.Errorf("no tenant %s is running", name)
+	}
+	for _, err := range inst.ShutdownCallbacks() {
+		log.Printf("[ERROR] Stopping tenant %s: %v", name, err)
+	}
+	delete(tenants, name)
+	if err := inst.Stop(); err != nil {
+		return err
+	}
+	log.Printf("[INFO] Stopped tenant %s", name)
+	return nil
+}
+
+// TenantInstance returns the running instance of the tenant named
+// name, or nil if there is none.
+func TenantInstance(name string) *Instance {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	return tenants[name]
+}
+
+// TenantNames returns the names of the running tenants, sorted.
+func TenantNames() []string {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	var names []string
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newContext returns a new context of stype for i, telling it the
+// tenant of i, if any.
+func (i *Instance) newContext(stype ServerType) Context {
+	ctx := stype.NewContext()
+	if tc, ok := ctx.(TenantContext); ok && i.tenant != nil {
+		tc.SetTenant(*i.tenant)
+	}
+	return ctx
+}
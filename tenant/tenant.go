@@ -0,0 +1,219 @@
+// Package tenant implements the tenant directive, which runs the
+// configuration of a tenant in the process, apart from the servers
+// of the Caddyfile that declares it.
+package tenant
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/mholt/caddy"
+)
+
+func init() {
+	caddy.RegisterPlugin("tenant", caddy.Plugin{Action: setup})
+}
+
+// declaration is a tenant declared by the directive.
+type declaration struct {
+	tenant     caddy.Tenant
+	file       string // the path of its Caddyfile
+	contents   string // the Caddyfile, as read when declared
+	serverType string
+}
+
+var (
+	// declared are the declarations of the instances being set
+	// up, by context, until the instances start.
+	declared = make(map[caddy.Context][]declaration)
+
+	// running are the declarations of the tenants started by the
+	// directive, by name.
+	running = make(map[string]declaration)
+
+	// started is whether the instance that replaced the one that
+	// declared the running tenants has declared them in turn.
+	started bool
+
+	mu sync.Mutex
+
+	// subscribeOnce subscribes stopUndeclared to restarts once
+	// tenants are declared.
+	subscribeOnce sync.Once
+)
+
+// setup declares the tenants of the instance. Once it starts, the
+// tenants it declares are started, or reloaded if their Caddyfile
+// changed, and those it no longer declares are stopped.
+func setup(c *caddy.Controller) error {
+	if c.Tenant() != nil {
+		return c.Err("tenants can't declare tenants")
+	}
+	decls, err := parse(c)
+	if err != nil {
+		return err
+	}
+
+	subscribeOnce.Do(func() { caddy.Subscribe(caddy.InstanceRestartedEvent, stopUndeclared) })
+
+	ctx := c.Context()
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := declared[ctx]; !ok {
+		c.OnStartup(func() error { return start(ctx) })
+		c.OnRestart(func() error {
+			mu.Lock()
+			started = false
+			mu.Unlock()
+			return nil
+		})
+	}
+	for _, d := range decls {
+		for _, other := range declared[ctx] {
+			if other.tenant.Name == d.tenant.Name {
+				return c.Errf("Tenant %s is declared more than once", d.tenant.Name)
+			}
+		}
+		declared[ctx] = append(declared[ctx], d)
+	}
+	return nil
+}
+
+// parse parses
+//
+//	tenant name caddyfile {
+//		assets dir
+//		type   servertype
+//	}
+//
+// where the Caddyfile is relative to the folder of the one that
+// declares the tenant, and is read then. The tenant is of the server
+// type of the declaring Caddyfile, unless type says otherwise.
+func parse(c *caddy.Controller) ([]declaration, error) {
+	var decls []declaration
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 2 {
+			return nil, c.ArgErr()
+		}
+		d := declaration{tenant: caddy.Tenant{Name: args[0]}, file: args[1], serverType: c.ServerType()}
+		if !filepath.IsAbs(d.file) {
+			d.file = filepath.Join(filepath.Dir(c.File()), d.file)
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "assets":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d.tenant.AssetsPath = c.Val()
+			case "type":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d.serverType = c.Val()
+			default:
+				return nil, c.Errf("Unknown tenant property '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+		contents, err := ioutil.ReadFile(d.file)
+		if err != nil {
+			return nil, c.Errf("Reading the Caddyfile of tenant %s: %v", d.tenant.Name, err)
+		}
+		d.contents = string(contents)
+		decls = append(decls, d)
+	}
+	return decls, nil
+}
+
+// start makes the tenants running those declared for ctx. A tenant
+// that fails to start, reload or stop is logged and skipped, so that
+// it doesn't keep the others, or the instance, from starting.
+func start(ctx caddy.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	decls := declared[ctx]
+
+	// the instances that were only validated never start, so
+	// forget them as well
+	declared = make(map[caddy.Context][]declaration)
+
+	started = true
+	forgetStopped()
+
+	want := make(map[string]declaration)
+	for _, d := range decls {
+		want[d.tenant.Name] = d
+	}
+
+	for name, d := range running {
+		if w, ok := want[name]; !ok || w.tenant != d.tenant || w.file != d.file || w.serverType != d.serverType {
+			delete(running, name)
+			if err := caddy.StopTenant(name); err != nil {
+				log.Printf("[ERROR] %v", err)
+			}
+		}
+	}
+
+	for _, d := range decls {
+		input := caddy.CaddyfileInput{
+			Contents:       []byte(d.contents),
+			Filepath:       d.file,
+			ServerTypeName: d.serverType,
+		}
+		if r, ok := running[d.tenant.Name]; ok {
+			if r.contents == d.contents {
+				continue
+			}
+			if _, err := caddy.ReloadTenant(d.tenant.Name, input); err != nil {
+				// it carries on as before, and is reloaded again
+				// next time
+				log.Printf("[ERROR] %v", err)
+				continue
+			}
+		} else if _, err := caddy.StartTenant(d.tenant, input); err != nil {
+			log.Printf("[ERROR] %v", err)
+			continue
+		}
+		running[d.tenant.Name] = d
+	}
+	return nil
+}
+
+// forgetStopped removes the tenants that were stopped by other means,
+// such as the admin API, from running, so that they are started
+// again rather than taken to be running.
+func forgetStopped() {
+	for name := range running {
+		if caddy.TenantInstance(name) == nil {
+			delete(running, name)
+		}
+	}
+}
+
+// stopUndeclared stops the running tenants once the instance that
+// declared them is replaced by one that declares none.
+func stopUndeclared(info interface{}) error {
+	inst, ok := info.(*caddy.Instance)
+	if !ok || inst.Tenant() != nil {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if started {
+		return nil
+	}
+	forgetStopped()
+	for name := range running {
+		delete(running, name)
+		if err := caddy.StopTenant(name); err != nil {
+			log.Printf("[ERROR] %v", err)
+		}
+	}
+	return nil
+}
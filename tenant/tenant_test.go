@@ -0,0 +1,142 @@
+package tenant
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyfile"
+)
+
+type testContext struct{}
+
+func (testContext) InspectServerBlocks(_ string, sblocks []caddyfile.ServerBlock) ([]caddyfile.ServerBlock, error) {
+	return sblocks, nil
+}
+
+func (testContext) MakeServers() ([]caddy.Server, error) { return nil, nil }
+
+func init() {
+	caddy.RegisterServerType("tenantdirtest", caddy.ServerType{
+		Directives: func() []string { return []string{"fine", "broken"} },
+		NewContext: func() caddy.Context { return testContext{} },
+	})
+	caddy.RegisterPlugin("fine", caddy.Plugin{ServerType: "tenantdirtest", Action: func(c *caddy.Controller) error { return nil }})
+	caddy.RegisterPlugin("broken", caddy.Plugin{ServerType: "tenantdirtest", Action: func(c *caddy.Controller) error {
+		return errors.New("broken")
+	}})
+}
+
+func TestParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.caddyfile")
+	if err := ioutil.WriteFile(file, []byte("a.com"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []declaration
+	}{
+		{`tenant a ` + file, false, []declaration{
+			{tenant: caddy.Tenant{Name: "a"}, file: file, contents: "a.com"},
+		}},
+		{"tenant a " + file + " {\n assets /srv/a\n}\ntenant b " + file, false, []declaration{
+			{tenant: caddy.Tenant{Name: "a", AssetsPath: "/srv/a"}, file: file, contents: "a.com"},
+			{tenant: caddy.Tenant{Name: "b"}, file: file, contents: "a.com"},
+		}},
+		{"tenant a " + file + " {\n type http\n}", false, []declaration{
+			{tenant: caddy.Tenant{Name: "a"}, file: file, contents: "a.com", serverType: "http"},
+		}},
+		{`tenant a`, true, nil},
+		{`tenant a ` + file + ` extra`, true, nil},
+		{`tenant a ` + filepath.Join(dir, "missing"), true, nil},
+		{"tenant a " + file + " {\n assets\n}", true, nil},
+		{"tenant a " + file + " {\n assets /a /b\n}", true, nil},
+		{"tenant a " + file + " {\n storage /a\n}", true, nil},
+		{"tenant a " + file + " {\n type\n}", true, nil},
+	} {
+		c := caddy.NewTestController("", test.input)
+		actual, err := parse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	decl := func(name, contents string) declaration {
+		return declaration{tenant: caddy.Tenant{Name: name}, contents: contents, serverType: "tenantdirtest"}
+	}
+	ctx := testContext{}
+	defer func() {
+		for _, name := range []string{"a", "b", "c"} {
+			caddy.StopTenant(name)
+		}
+		running = make(map[string]declaration)
+	}()
+
+	// a broken tenant is skipped, and the others start
+	declared[ctx] = []declaration{decl("a", "a.com {\nfine\n}"), decl("b", "b.com {\nbroken\n}"), decl("c", "c.com {\nfine\n}")}
+	if err := start(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if names := caddy.TenantNames(); !reflect.DeepEqual(names, []string{"a", "c"}) {
+		t.Errorf("Expected tenants a and c to run, got %v", names)
+	}
+	if _, ok := running["b"]; ok {
+		t.Error("Expected the broken tenant not to be running")
+	}
+
+	// a tenant stopped by the admin API is started again
+	if err := caddy.StopTenant("a"); err != nil {
+		t.Fatal(err)
+	}
+	declared[ctx] = []declaration{decl("a", "a.com {\nfine\n}"), decl("c", "c.com {\nbroken\n}")}
+	if err := start(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if caddy.TenantInstance("a") == nil {
+		t.Error("Expected tenant a to be started again")
+	}
+	// and one that fails to reload carries on as before
+	if caddy.TenantInstance("c") == nil || running["c"].contents != "c.com {\nfine\n}" {
+		t.Error("Expected tenant c to carry on as before")
+	}
+}
+
+func TestSetupDeclaredTwice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.caddyfile")
+	if err := ioutil.WriteFile(file, []byte("a.com"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := caddy.NewTestController("", "tenant a "+file+"\ntenant a "+file)
+	defer delete(declared, c.Context())
+	if err := setup(c); err == nil {
+		t.Error("Expected an error declaring a tenant twice, got none")
+	}
+}
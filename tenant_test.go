@@ -0,0 +1,100 @@
+package caddy
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+type tenantTestContext struct {
+	tenant *Tenant
+}
+
+func (*tenantTestContext) InspectServerBlocks(_ string, sblocks []caddyfile.ServerBlock) ([]caddyfile.ServerBlock, error) {
+	return sblocks, nil
+}
+
+func (*tenantTestContext) MakeServers() ([]Server, error) { return nil, nil }
+
+func (ctx *tenantTestContext) SetTenant(t Tenant) { ctx.tenant = &t }
+
+func init() {
+	RegisterServerType("tenanttest", ServerType{
+		Directives: func() []string { return []string{"fine", "broken"} },
+		NewContext: func() Context { return new(tenantTestContext) },
+	})
+	RegisterPlugin("fine", Plugin{ServerType: "tenanttest", Action: func(c *Controller) error { return nil }})
+	RegisterPlugin("broken", Plugin{ServerType: "tenanttest", Action: func(c *Controller) error {
+		return errors.New("broken")
+	}})
+}
+
+func TestTenants(t *testing.T) {
+	input := func(contents string) Input {
+		return CaddyfileInput{Contents: []byte(contents), ServerTypeName: "tenanttest"}
+	}
+
+	if _, err := StartTenant(Tenant{}, input("a.com {\nfine\n}")); err == nil {
+		t.Error("Expected an error starting a tenant without a name, got none")
+	}
+
+	inst, err := StartTenant(Tenant{Name: "a"}, input("a.com {\nfine\n}"))
+	if err != nil {
+		t.Fatalf("Expected no error starting tenant, got %v", err)
+	}
+	defer StopTenant("a")
+	expected := Tenant{Name: "a", AssetsPath: filepath.Join(AssetsPath(), "tenants", "a")}
+	if got := inst.context.(*tenantTestContext).tenant; got == nil || *got != expected {
+		t.Errorf("Expected context of tenant %+v, got %+v", expected, got)
+	}
+	if MainInstance() == inst {
+		t.Error("Expected the tenant not to be the main instance")
+	}
+	if _, err := StartTenant(Tenant{Name: "a"}, input("b.com {\nfine\n}")); err == nil {
+		t.Error("Expected an error starting a tenant twice, got none")
+	}
+	if _, err := StartTenant(Tenant{Name: "b"}, input("b.com {\nbroken\n}")); err == nil {
+		t.Error("Expected an error starting a broken tenant, got none")
+	}
+	if names := TenantNames(); !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("Expected tenants [a], got %v", names)
+	}
+
+	// a failed reload leaves the tenant as it was
+	if _, err := ReloadTenant("a", input("a.com {\nbroken\n}")); err == nil {
+		t.Error("Expected an error reloading a broken configuration, got none")
+	}
+	if TenantInstance("a") != inst {
+		t.Error("Expected the tenant to carry on after a failed reload")
+	}
+	if _, err := ReloadTenant("a", nil); err == nil {
+		t.Error("Expected an error reloading a tenant without a Caddyfile file, got none")
+	}
+
+	newInst, err := ReloadTenant("a", input("a.com {\nfine\n}\nc.com {\nfine\n}"))
+	if err != nil {
+		t.Fatalf("Expected no error reloading tenant, got %v", err)
+	}
+	if newInst == inst || TenantInstance("a") != newInst {
+		t.Error("Expected the reloaded instance to replace the tenant's")
+	}
+	if newInst.Tenant() == nil || *newInst.Tenant() != expected {
+		t.Errorf("Expected the reloaded instance to be of tenant %+v, got %+v", expected, newInst.Tenant())
+	}
+	if _, err := ReloadTenant("b", nil); err == nil {
+		t.Error("Expected an error reloading a tenant that isn't running, got none")
+	}
+
+	if err := StopTenant("a"); err != nil {
+		t.Errorf("Expected no error stopping tenant, got %v", err)
+	}
+	if err := StopTenant("a"); err == nil {
+		t.Error("Expected an error stopping a tenant twice, got none")
+	}
+	if names := TenantNames(); len(names) != 0 {
+		t.Errorf("Expected no tenants, got %v", names)
+	}
+}
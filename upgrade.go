@@ -2,12 +2,17 @@ package caddy
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"runtime"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 func init() {
@@ -25,15 +30,36 @@ func IsUpgrade() bool {
 	return isUpgrade
 }
 
+// UpgradeTimeout is how long Upgrade waits for the new process
+// to start before giving up on it.
+var UpgradeTimeout = 5 * time.Minute
+
+// ErrUpgradeInProgress is returned by Upgrade while another
+// upgrade hasn't finished.
+var ErrUpgradeInProgress = errors.New("upgrade already in progress")
+
 // Upgrade re-launches the process, preserving the listeners
 // for a graceful upgrade. It does NOT load new configuration;
 // it only starts the process anew with the current config.
-// This makes it possible to perform zero-downtime binary upgrades.
+// This makes it possible to perform zero-downtime binary upgrades:
+// replace the executable, then call Upgrade (or send SIGUSR2). The
+// new process is started from the executable's path, and once it
+// is serving, this process stops its servers gracefully, letting
+// requests in flight finish. If the new process fails to start,
+// this one carries on as before.
 //
 // TODO: For more information when debugging, see:
 // https://forum.golangbridge.org/t/bind-address-already-in-use-even-after-listener-closed/1510?u=matt
 // https://github.com/mholt/shared-conn
 func Upgrade() error {
+	if runtime.GOOS == "windows" {
+		return errors.New("upgrades are not supported on Windows")
+	}
+	if !atomic.CompareAndSwapInt32(&upgrading, 0, 1) {
+		return ErrUpgradeInProgress
+	}
+	defer atomic.StoreInt32(&upgrading, 0)
+
 	log.Println("[INFO] Upgrading")
 
 	// use existing Caddyfile; do not change configuration during upgrade
@@ -106,8 +132,13 @@ func Upgrade() error {
 		}
 	}
 
-	// set up the command
-	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	// set up the command; start the executable at the path this
+	// one was started from, which is where its replacement is
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
 	cmd.Stdin = rpipe      // fd 0
 	cmd.Stdout = os.Stdout // fd 1
 	cmd.Stderr = os.Stderr // fd 2
@@ -133,31 +164,48 @@ func Upgrade() error {
 	wpipe.Close()
 
 	// determine whether child startup succeeded
-	answer, readErr := ioutil.ReadAll(sigrpipe)
-	if answer == nil || len(answer) == 0 {
+	type answer struct {
+		data []byte
+		err  error
+	}
+	answerChan := make(chan answer, 1)
+	go func() {
+		data, err := ioutil.ReadAll(sigrpipe)
+		answerChan <- answer{data, err}
+	}()
+	var ans answer
+	select {
+	case ans = <-answerChan:
+	case <-time.After(UpgradeTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		sigrpipe.Close()
+		return fmt.Errorf("child did not initialize within %v", UpgradeTimeout)
+	}
+	sigrpipe.Close()
+	if len(ans.data) == 0 {
 		cmdErr := cmd.Wait() // get exit status
 		errStr := fmt.Sprintf("child failed to initialize: %v", cmdErr)
-		if readErr != nil {
-			errStr += fmt.Sprintf(" - additionally, error communicating with child process: %v", readErr)
+		if ans.err != nil {
+			errStr += fmt.Sprintf(" - additionally, error communicating with child process: %v", ans.err)
 		}
-		return fmt.Errorf(errStr)
+		return errors.New(errStr)
 	}
 
 	// looks like child is successful; we can exit gracefully.
+	sdNotify("MAINPID=" + strconv.Itoa(cmd.Process.Pid))
 	log.Println("[INFO] Upgrade finished")
 	return Stop()
 }
 
 // getCurrentCaddyfile gets the Caddyfile used by the
-// current (first) Instance and returns both of them.
+// current main Instance, which is not a tenant's, and returns
+// both of them.
 func getCurrentCaddyfile() (Input, *Instance, error) {
-	instancesMu.Lock()
-	if len(instances) == 0 {
-		instancesMu.Unlock()
+	inst := MainInstance()
+	if inst == nil {
 		return nil, nil, fmt.Errorf("no server instances are fully running")
 	}
-	inst := instances[0]
-	instancesMu.Unlock()
 
 	currentCaddyfile := inst.caddyfileInput
 	if currentCaddyfile == nil {
@@ -196,6 +244,9 @@ func signalSuccessToParent() {
 // instead.
 var signalParentOnce sync.Once
 
+// upgrading is 1 while an upgrade is in progress.
+var upgrading int32
+
 // transferGob is used if this is a child process as part of
 // a graceful upgrade; it is used to map listeners to their
 // index in the list of inherited file descriptors. This
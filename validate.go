@@ -0,0 +1,161 @@
+package caddy
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+// Diagnostic describes a problem found in a Caddyfile
+// by Validate.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Warning bool // false for errors
+	Message string
+}
+
+// String returns the diagnostic in the conventional
+// file:line:column: severity: message form.
+func (d Diagnostic) String() string {
+	severity := "error"
+	if d.Warning {
+		severity = "warning"
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, severity, d.Message)
+}
+
+// Validate checks cdyfile thoroughly without starting it: the
+// Caddyfile is parsed and the setup of every directive is run,
+// but no listeners are bound, no certificates are obtained and
+// no startup callbacks are executed. Unlike ValidateAndExecuteDirectives,
+// it doesn't stop at the first directive that fails, and it also
+// warns of deprecated directives and of directive lines that are
+// repeated, and so shadowed, within a server block. The diagnostics
+// are returned in order of their position in the input.
+func Validate(cdyfile Input) []Diagnostic {
+	var diags []Diagnostic
+	addError := func(err error, tokens []caddyfile.Token) {
+		diags = append(diags, errorDiagnostic(cdyfile.Path(), err, tokens))
+	}
+
+	stypeName := cdyfile.ServerType()
+	stype, err := getServerType(stypeName)
+	if err != nil {
+		addError(err, nil)
+		return diags
+	}
+	directives, err := directivesOf(stypeName, stype)
+	if err != nil {
+		addError(err, nil)
+		return diags
+	}
+
+	sblocks, err := loadServerBlocks(stypeName, cdyfile.Path(), bytes.NewReader(cdyfile.Body()))
+	if err != nil {
+		addError(err, nil)
+		return diags
+	}
+
+	inst := &Instance{serverType: stypeName, wg: new(sync.WaitGroup), caddyfileInput: cdyfile}
+	inst.context = stype.NewContext()
+	if inst.context == nil {
+		addError(fmt.Errorf("server type %s produced a nil Context", stypeName), nil)
+		return diags
+	}
+
+	sblocks, err = inst.context.InspectServerBlocks(cdyfile.Path(), sblocks)
+	if err != nil {
+		addError(err, nil)
+		return diags
+	}
+
+	diags = append(diags, lintServerBlocks(stypeName, cdyfile.Path(), sblocks)...)
+
+	err = executeDirectives(inst, cdyfile.Path(), directives, sblocks, true,
+		func(_ int, err error, tokens []caddyfile.Token) { addError(err, tokens) })
+	if err != nil {
+		addError(err, nil)
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+	return diags
+}
+
+// errorDiagnostic makes a Diagnostic out of err. Errors from the
+// Caddyfile parser carry their own position; otherwise the error
+// is placed at the first of tokens, if any.
+func errorDiagnostic(filename string, err error, tokens []caddyfile.Token) Diagnostic {
+	if perr, ok := err.(caddyfile.Error); ok {
+		return Diagnostic{File: perr.File, Line: perr.Line, Column: perr.Column, Message: perr.Message}
+	}
+	d := Diagnostic{File: filename, Message: err.Error()}
+	if len(tokens) > 0 {
+		if tokens[0].File != "" {
+			d.File = tokens[0].File
+		}
+		d.Line, d.Column = tokens[0].Line, tokens[0].Column
+	}
+	return d
+}
+
+// lintServerBlocks returns warnings about deprecated directives
+// and directive lines that are exact repeats of an earlier line
+// in the same server block.
+func lintServerBlocks(serverType, filename string, sblocks []caddyfile.ServerBlock) []Diagnostic {
+	var diags []Diagnostic
+	for _, sb := range sblocks {
+		for dir, tokens := range sb.Tokens {
+			deprecation := directiveDeprecation(serverType, dir)
+			seen := make(map[string]int)
+			d := caddyfile.NewDispenserTokens(filename, tokens)
+			for d.Next() {
+				diag := Diagnostic{File: d.File(), Line: d.Line(), Column: d.Column(), Warning: true}
+				if deprecation != "" {
+					diag.Message = fmt.Sprintf("Directive '%s' is deprecated: %s", dir, deprecation)
+					diags = append(diags, diag)
+				}
+
+				line := directiveLine(&d)
+				if firstLine, ok := seen[line]; ok {
+					diag.Message = fmt.Sprintf("Directive '%s' repeats line %d exactly, so one of them has no effect", dir, firstLine)
+					diags = append(diags, diag)
+				} else {
+					seen[line] = diag.Line
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// directiveLine consumes the rest of the directive at the
+// dispenser's cursor, including any block, and returns its
+// tokens joined into a single string.
+func directiveLine(d *caddyfile.Dispenser) string {
+	texts := []string{d.Val()}
+	nesting := 0
+	for d.NextArg() || (nesting > 0 && d.Next()) {
+		switch d.Val() {
+		case "{":
+			nesting++
+		case "}":
+			nesting--
+		}
+		texts = append(texts, d.Val())
+	}
+	return strings.Join(texts, "\x00")
+}
@@ -0,0 +1,94 @@
+package caddy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/caddyfile"
+)
+
+type validateTestContext struct{}
+
+func (validateTestContext) InspectServerBlocks(_ string, sblocks []caddyfile.ServerBlock) ([]caddyfile.ServerBlock, error) {
+	return sblocks, nil
+}
+
+func (validateTestContext) MakeServers() ([]Server, error) { return nil, nil }
+
+func init() {
+	RegisterServerType("validatetest", ServerType{
+		Directives: func() []string { return []string{"good", "bad", "old", "failstart"} },
+		NewContext: func() Context { return validateTestContext{} },
+	})
+	RegisterPlugin("good", Plugin{ServerType: "validatetest", Action: func(c *Controller) error {
+		goodSetups++
+		return nil
+	}})
+	RegisterPlugin("bad", Plugin{ServerType: "validatetest", Action: func(c *Controller) error {
+		for c.Next() {
+			if c.NextArg() {
+				return c.Errf("Unexpected argument '%s'", c.Val())
+			}
+		}
+		return nil
+	}})
+	RegisterPlugin("old", Plugin{ServerType: "validatetest", Action: func(c *Controller) error { return nil },
+		Deprecated: "use good instead"})
+	RegisterPlugin("failstart", Plugin{ServerType: "validatetest", Action: func(c *Controller) error {
+		c.OnStartup(func() error { return errors.New("failed to start") })
+		return nil
+	}})
+}
+
+// goodSetups counts the setups of the good directive.
+var goodSetups int
+
+func TestValidate(t *testing.T) {
+	input := CaddyfileInput{
+		Filepath:       "Caddyfile",
+		ServerTypeName: "validatetest",
+		Contents: []byte(`host1 {
+	good a
+	bad
+	  bad x
+	good a
+}
+host2 {
+	old
+	good {
+		b
+	}
+	good {
+		c
+	}
+	bad y
+}`),
+	}
+
+	var actual []string
+	for _, diag := range Validate(input) {
+		actual = append(actual, diag.String())
+	}
+	expected := []string{
+		"Caddyfile:4:8: error: Error during parsing: Unexpected argument 'x'",
+		"Caddyfile:5:2: warning: Directive 'good' repeats line 2 exactly, so one of them has no effect",
+		"Caddyfile:8:2: warning: Directive 'old' is deprecated: use good instead",
+		"Caddyfile:15:6: error: Error during parsing: Unexpected argument 'y'",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected diagnostics:\n%q\ngot:\n%q", expected, actual)
+	}
+
+	// a parse error stops validation
+	input.Contents = []byte("host1 {\n\tgood\n\tunknown\n\tbad x\n}")
+	diags := Validate(input)
+	if len(diags) != 1 || diags[0].Warning || diags[0].Line != 3 {
+		t.Errorf("Expected one error on line 3, got %v", diags)
+	}
+
+	input.Contents = []byte("host1 {\n\tgood\n}")
+	if diags := Validate(input); len(diags) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diags)
+	}
+}